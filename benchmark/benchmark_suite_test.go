@@ -2,6 +2,7 @@ package benchmark
 
 import (
 	"flag"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -17,10 +18,18 @@ func TestBenchmark(t *testing.T) {
 var (
 	size    int // file size in MB, will be read from flags
 	samples int // number of samples for Measure, will be read from flags
+
+	// parameters of the handshake benchmark, will be read from flags
+	lossRates  string
+	rtts       string
+	reportFile string
 )
 
 func init() {
 	flag.IntVar(&size, "size", 50, "data length (in MB)")
 	flag.IntVar(&samples, "samples", 6, "number of samples")
+	flag.StringVar(&lossRates, "loss", "0,5,10", "comma-separated list of packet loss rates (in percent) for the handshake benchmark")
+	flag.StringVar(&rtts, "rtt", (10 * time.Millisecond).String(), "comma-separated list of RTTs for the handshake benchmark")
+	flag.StringVar(&reportFile, "report", "", "write the handshake times to this file (as JSON)")
 	flag.Parse()
 }
@@ -0,0 +1,160 @@
+package benchmark
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	quicproxy "github.com/lucas-clemente/quic-go/integrationtests/tools/proxy"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// A handshakeScenario is the result of running handshakes with one set of parameters.
+type handshakeScenario struct {
+	Version   string  `json:"version"`
+	LossRate  float64 `json:"loss_rate"` // in percent
+	RTT       float64 `json:"rtt_ms"`
+	Succeeded int     `json:"succeeded"`
+	Failed    int     `json:"failed"`
+	// all handshake times are in milliseconds, and only include successful handshakes
+	Min    float64   `json:"min_ms"`
+	Median float64   `json:"median_ms"`
+	P90    float64   `json:"p90_ms"`
+	P99    float64   `json:"p99_ms"`
+	Max    float64   `json:"max_ms"`
+	Times  []float64 `json:"times_ms"`
+}
+
+func (s *handshakeScenario) addHandshake(d time.Duration) {
+	s.Succeeded++
+	s.Times = append(s.Times, float64(d)/float64(time.Millisecond))
+}
+
+// summarize calculates the distribution of the handshake times
+func (s *handshakeScenario) summarize() {
+	if len(s.Times) == 0 {
+		return
+	}
+	sorted := make([]float64, len(s.Times))
+	copy(sorted, s.Times)
+	sort.Float64s(sorted)
+	// percentile uses the nearest-rank method
+	percentile := func(p float64) float64 {
+		return sorted[int(math.Ceil(p*float64(len(sorted))))-1]
+	}
+	s.Min = sorted[0]
+	s.Median = percentile(0.5)
+	s.P90 = percentile(0.9)
+	s.P99 = percentile(0.99)
+	s.Max = sorted[len(sorted)-1]
+}
+
+func parseLossRates(s string) []float64 {
+	var rates []float64
+	for _, f := range strings.Split(s, ",") {
+		rate, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || rate < 0 || rate >= 100 {
+			panic(fmt.Sprintf("invalid loss rate: %s", f))
+		}
+		rates = append(rates, rate)
+	}
+	return rates
+}
+
+func parseRTTs(s string) []time.Duration {
+	var durations []time.Duration
+	for _, f := range strings.Split(s, ",") {
+		rtt, err := time.ParseDuration(strings.TrimSpace(f))
+		if err != nil || rtt < 0 {
+			panic(fmt.Sprintf("invalid RTT: %s", f))
+		}
+		durations = append(durations, rtt)
+	}
+	return durations
+}
+
+// the results of the handshake benchmarks, written to the report file after all benchmarks ran
+var handshakeScenarios []*handshakeScenario
+
+var _ = AfterSuite(func() {
+	if reportFile == "" {
+		return
+	}
+	for _, s := range handshakeScenarios {
+		s.summarize()
+	}
+	data, err := json.MarshalIndent(handshakeScenarios, "", "  ")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(ioutil.WriteFile(reportFile, data, 0644)).To(Succeed())
+})
+
+func init() {
+	var _ = Describe("Handshake benchmarks", func() {
+		for i := range protocol.SupportedVersions {
+			version := protocol.SupportedVersions[i]
+
+			for _, r := range parseLossRates(lossRates) {
+				lossRate := r
+
+				for _, d := range parseRTTs(rtts) {
+					rtt := d
+					scenario := &handshakeScenario{
+						Version:  version.String(),
+						LossRate: lossRate,
+						RTT:      float64(rtt) / float64(time.Millisecond),
+					}
+					handshakeScenarios = append(handshakeScenarios, scenario)
+
+					Context(fmt.Sprintf("with version %s, %.1f%% packet loss and %s RTT", version, lossRate, rtt), func() {
+						Measure("completing the handshake", func(b Benchmarker) {
+							ln, err := quic.ListenAddr(
+								"localhost:0",
+								testdata.GetTLSConfig(),
+								&quic.Config{Versions: []protocol.VersionNumber{version}},
+							)
+							Expect(err).ToNot(HaveOccurred())
+							defer ln.Close()
+							proxy, err := quicproxy.NewQuicProxy("localhost:0", version, &quicproxy.Opts{
+								RemoteAddr: ln.Addr().String(),
+								DropPacket: func(quicproxy.Direction, uint64) bool {
+									return rand.Float64()*100 < lossRate
+								},
+								DelayPacket: func(quicproxy.Direction, uint64) time.Duration { return rtt / 2 },
+							})
+							Expect(err).ToNot(HaveOccurred())
+							defer proxy.Close()
+
+							var sess quic.Session
+							runtime := b.Time("handshake time", func() {
+								sess, err = quic.DialAddr(
+									fmt.Sprintf("localhost:%d", proxy.LocalPort()),
+									&tls.Config{InsecureSkipVerify: true},
+									&quic.Config{Versions: []protocol.VersionNumber{version}},
+								)
+							})
+							// handshakes are expected to fail occasionally if packets are lost
+							if err != nil && lossRate > 0 {
+								scenario.Failed++
+								return
+							}
+							Expect(err).ToNot(HaveOccurred())
+							scenario.addHandshake(runtime)
+							sess.Close(nil)
+						}, samples)
+					})
+				}
+			}
+		}
+	})
+}
@@ -6,6 +6,9 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 )
 
+// The bufferPool holds the buffers that packets are read into and written from.
+// Buffers of received packets are returned to the pool once the packet was processed, see receivedPacket.release.
+// Note that the pool stores pointers to slices, such that putting a buffer back doesn't allocate.
 var bufferPool sync.Pool
 
 func getPacketBuffer() *[]byte {
@@ -16,6 +19,7 @@ func putPacketBuffer(buf *[]byte) {
 	if cap(*buf) != int(protocol.MaxReceivePacketSize) {
 		panic("putPacketBuffer called with packet of wrong size!")
 	}
+	*buf = (*buf)[:0]
 	bufferPool.Put(buf)
 }
 
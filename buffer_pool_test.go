@@ -13,6 +13,14 @@ var _ = Describe("Buffer Pool", func() {
 		Expect(buf).To(HaveCap(int(protocol.MaxReceivePacketSize)))
 	})
 
+	It("resets the length of buffers that are put back", func() {
+		buf := getPacketBuffer()
+		*buf = (*buf)[:protocol.MaxReceivePacketSize]
+		putPacketBuffer(buf)
+		Expect(*buf).To(BeEmpty())
+		Expect(*buf).To(HaveCap(int(protocol.MaxReceivePacketSize)))
+	})
+
 	It("panics if wrong-sized buffers are passed", func() {
 		Expect(func() {
 			putPacketBuffer(&[]byte{0})
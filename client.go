@@ -2,6 +2,7 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -23,6 +24,13 @@ type client struct {
 	conn     connection
 	hostname string
 
+	// If the client created the net.PacketConn (in DialAddr), it is closed when the session is closed.
+	createdPacketConn bool
+
+	// transport is set if the client shares its net.PacketConn with other connections.
+	// In that case, the Transport reads from the net.PacketConn, and passes the packets for our connection IDs to the client.
+	transport *Transport
+
 	versionNegotiated                bool // has the server accepted our version
 	receivedVersionNegotiationPacket bool
 	negotiatedVersions               []protocol.VersionNumber // the list of versions from the version negotiation packet
@@ -34,6 +42,13 @@ type client struct {
 	srcConnID  protocol.ConnectionID
 	destConnID protocol.ConnectionID
 
+	// connIDs are the additional connection IDs issued by the session,
+	// resetTokens are the stateless reset tokens issued by the server (IETF QUIC only).
+	// They use their own mutex, since the session adds and removes them from its run loop.
+	connIDsMutex sync.Mutex
+	connIDs      map[string]struct{}
+	resetTokens  map[[16]byte]struct{}
+
 	initialVersion protocol.VersionNumber
 	version        protocol.VersionNumber
 
@@ -53,6 +68,13 @@ var (
 // DialAddr establishes a new QUIC connection to a server.
 // The hostname for SNI is taken from the given address.
 func DialAddr(addr string, tlsConf *tls.Config, config *Config) (Session, error) {
+	return DialAddrContext(context.Background(), addr, tlsConf, config)
+}
+
+// DialAddrContext establishes a new QUIC connection to a server, using the provided context.
+// The hostname for SNI is taken from the given address.
+// If the context expires before the handshake completes, dialing is aborted, and the context's error is returned.
+func DialAddrContext(ctx context.Context, addr string, tlsConf *tls.Config, config *Config) (Session, error) {
 	udpAddr, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
 		return nil, err
@@ -61,30 +83,71 @@ func DialAddr(addr string, tlsConf *tls.Config, config *Config) (Session, error)
 	if err != nil {
 		return nil, err
 	}
-	return Dial(udpConn, udpAddr, addr, tlsConf, config)
+	sess, err := dial(ctx, udpConn, udpAddr, addr, tlsConf, config, nil, true)
+	if err != nil {
+		udpConn.Close()
+		return nil, err
+	}
+	return sess, nil
 }
 
 // Dial establishes a new QUIC connection to a server using a net.PacketConn.
 // The host parameter is used for SNI.
+// The net.PacketConn is provided by the caller, e.g. a socket with custom options, or an in-memory connection for testing.
+// It is not closed when the session is closed. It must not be used for other QUIC connections, see Transport for that.
 func Dial(
 	pconn net.PacketConn,
 	remoteAddr net.Addr,
 	host string,
 	tlsConf *tls.Config,
 	config *Config,
+) (Session, error) {
+	return DialContext(context.Background(), pconn, remoteAddr, host, tlsConf, config)
+}
+
+// DialContext establishes a new QUIC connection to a server using a net.PacketConn, using the provided context.
+// The host parameter is used for SNI.
+// If the context expires before the handshake completes, dialing is aborted, and the context's error is returned.
+func DialContext(
+	ctx context.Context,
+	pconn net.PacketConn,
+	remoteAddr net.Addr,
+	host string,
+	tlsConf *tls.Config,
+	config *Config,
+) (Session, error) {
+	return dial(ctx, pconn, remoteAddr, host, tlsConf, config, nil, false)
+}
+
+func dial(
+	ctx context.Context,
+	pconn net.PacketConn,
+	remoteAddr net.Addr,
+	host string,
+	tlsConf *tls.Config,
+	config *Config,
+	transport *Transport,
+	createdPacketConn bool,
 ) (Session, error) {
 	clientConfig := populateClientConfig(config)
-	version := clientConfig.Versions[0]
-	srcConnID, err := generateConnectionID()
-	if err != nil {
+	if err := checkConnectionIDConfig(clientConfig); err != nil {
 		return nil, err
 	}
-	destConnID := srcConnID
-	if version.UsesTLS() {
-		destConnID, err = generateConnectionID()
-		if err != nil {
+	if err := checkDSCP(clientConfig.DSCP); err != nil {
+		return nil, err
+	}
+	// The socket buffers of a Transport were already set when it was created.
+	if transport != nil {
+		if err := transport.checkConfig(clientConfig); err != nil {
 			return nil, err
 		}
+	} else {
+		setSocketBuffers(pconn, clientConfig)
+	}
+	version := serverVersions.ChooseVersion(host, clientConfig.Versions)
+	srcConnID, destConnID, err := generateConnectionIDs(version, clientConfig.ConnectionIDLength)
+	if err != nil {
+		return nil, err
 	}
 
 	var hostname string
@@ -107,22 +170,25 @@ func Dial(
 		}
 	}
 	c := &client{
-		conn:          &conn{pconn: pconn, currentAddr: remoteAddr},
-		srcConnID:     srcConnID,
-		destConnID:    destConnID,
-		hostname:      hostname,
-		tlsConf:       tlsConf,
-		config:        clientConfig,
-		version:       version,
-		handshakeChan: make(chan struct{}),
-		logger:        utils.DefaultLogger.WithPrefix("client"),
+		conn:              &conn{pconn: wrapConn(pconn), currentAddr: remoteAddr},
+		srcConnID:         srcConnID,
+		destConnID:        destConnID,
+		hostname:          hostname,
+		tlsConf:           tlsConf,
+		config:            clientConfig,
+		version:           version,
+		handshakeChan:     make(chan struct{}),
+		transport:         transport,
+		createdPacketConn: createdPacketConn,
+		logger:            utils.DefaultLogger.WithPrefix("client"),
 	}
 
 	c.logger.Infof("Starting new connection to %s (%s -> %s), source connection ID %s, destination connection ID %s, version %s", hostname, c.conn.LocalAddr(), c.conn.RemoteAddr(), c.srcConnID, c.destConnID, c.version)
 
-	if err := c.dial(); err != nil {
+	if err := c.dial(ctx); err != nil {
 		return nil, err
 	}
+	serverVersions.Add(host, c.session.ConnectionState().SupportedVersions)
 	return c.session, nil
 }
 
@@ -141,10 +207,34 @@ func populateClientConfig(config *Config) *Config {
 	if config.HandshakeTimeout != 0 {
 		handshakeTimeout = config.HandshakeTimeout
 	}
+	handshakeRetransmissionBackoff := config.HandshakeRetransmissionBackoff
+	if handshakeRetransmissionBackoff < 1 {
+		handshakeRetransmissionBackoff = protocol.DefaultHandshakeRetransmissionBackoff
+	}
 	idleTimeout := protocol.DefaultIdleTimeout
 	if config.IdleTimeout != 0 {
 		idleTimeout = config.IdleTimeout
 	}
+	connIDLen := config.ConnectionIDLength
+	if connIDLen == 0 {
+		connIDLen = protocol.ConnectionIDLen
+	}
+	connIDCount := config.ConnectionIDCount
+	if connIDCount == 0 {
+		connIDCount = 1
+	}
+	pathValidationTimeout := protocol.DefaultPathValidationTimeout
+	if config.PathValidationTimeout != 0 {
+		pathValidationTimeout = config.PathValidationTimeout
+	}
+	maxPathValidationProbes := protocol.DefaultMaxPathValidationProbes
+	if config.MaxPathValidationProbes != 0 {
+		maxPathValidationProbes = config.MaxPathValidationProbes
+	}
+	sendCoalescingDelay := config.SendCoalescingDelay
+	if sendCoalescingDelay > protocol.MaxSendCoalescingDelay {
+		sendCoalescingDelay = protocol.MaxSendCoalescingDelay
+	}
 
 	maxReceiveStreamFlowControlWindow := config.MaxReceiveStreamFlowControlWindow
 	if maxReceiveStreamFlowControlWindow == 0 {
@@ -154,6 +244,47 @@ func populateClientConfig(config *Config) *Config {
 	if maxReceiveConnectionFlowControlWindow == 0 {
 		maxReceiveConnectionFlowControlWindow = protocol.DefaultMaxReceiveConnectionFlowControlWindowClient
 	}
+	initialReceiveStreamFlowControlWindow := config.InitialReceiveStreamFlowControlWindow
+	if initialReceiveStreamFlowControlWindow == 0 {
+		initialReceiveStreamFlowControlWindow = protocol.ReceiveStreamFlowControlWindow
+	}
+	if initialReceiveStreamFlowControlWindow > maxReceiveStreamFlowControlWindow {
+		initialReceiveStreamFlowControlWindow = maxReceiveStreamFlowControlWindow
+	}
+	initialReceiveConnectionFlowControlWindow := config.InitialReceiveConnectionFlowControlWindow
+	if initialReceiveConnectionFlowControlWindow == 0 {
+		initialReceiveConnectionFlowControlWindow = protocol.ReceiveConnectionFlowControlWindow
+	}
+	if initialReceiveConnectionFlowControlWindow > maxReceiveConnectionFlowControlWindow {
+		initialReceiveConnectionFlowControlWindow = maxReceiveConnectionFlowControlWindow
+	}
+	maxStreamReassemblyBuffer := config.MaxStreamReassemblyBuffer
+	if maxStreamReassemblyBuffer == 0 {
+		maxStreamReassemblyBuffer = maxReceiveStreamFlowControlWindow
+	}
+	maxConnectionReassemblyBuffer := config.MaxConnectionReassemblyBuffer
+	if maxConnectionReassemblyBuffer == 0 {
+		maxConnectionReassemblyBuffer = maxReceiveConnectionFlowControlWindow
+	}
+	maxUndecryptablePackets := config.MaxUndecryptablePackets
+	if maxUndecryptablePackets <= 0 {
+		maxUndecryptablePackets = protocol.DefaultMaxUndecryptablePackets
+	}
+	maxUndecryptablePacketBytes := config.MaxUndecryptablePacketBytes
+	if maxUndecryptablePacketBytes == 0 {
+		maxUndecryptablePacketBytes = uint64(maxUndecryptablePackets) * uint64(protocol.MaxReceivePacketSize)
+	}
+	maxTransientWriteErrors := config.MaxTransientWriteErrors
+	if maxTransientWriteErrors == 0 {
+		maxTransientWriteErrors = protocol.DefaultMaxTransientWriteErrors
+	} else if maxTransientWriteErrors < 0 {
+		maxTransientWriteErrors = 0
+	}
+	maxReasonPhraseLength := config.MaxReasonPhraseLength
+	if maxReasonPhraseLength <= 0 {
+		maxReasonPhraseLength = protocol.DefaultMaxReasonPhraseLength
+	}
+	initialPacketSize, maxPacketSize := getPacketSizes(config.InitialPacketSize, config.MaxPacketSize)
 	maxIncomingStreams := config.MaxIncomingStreams
 	if maxIncomingStreams == 0 {
 		maxIncomingStreams = protocol.DefaultMaxIncomingStreams
@@ -168,47 +299,89 @@ func populateClientConfig(config *Config) *Config {
 	}
 
 	return &Config{
-		Versions:                              versions,
-		HandshakeTimeout:                      handshakeTimeout,
-		IdleTimeout:                           idleTimeout,
-		RequestConnectionIDOmission:           config.RequestConnectionIDOmission,
-		MaxReceiveStreamFlowControlWindow:     maxReceiveStreamFlowControlWindow,
-		MaxReceiveConnectionFlowControlWindow: maxReceiveConnectionFlowControlWindow,
-		MaxIncomingStreams:                    maxIncomingStreams,
-		MaxIncomingUniStreams:                 maxIncomingUniStreams,
-		KeepAlive:                             config.KeepAlive,
+		Versions:                                  versions,
+		HandshakeTimeout:                          handshakeTimeout,
+		HandshakeRetransmissionTimeout:            config.HandshakeRetransmissionTimeout,
+		HandshakeRetransmissionBackoff:            handshakeRetransmissionBackoff,
+		MaxHandshakeRetransmissions:               config.MaxHandshakeRetransmissions,
+		IdleTimeout:                               idleTimeout,
+		ConnectionIDLength:                        connIDLen,
+		ConnectionIDCount:                         connIDCount,
+		PathValidationTimeout:                     pathValidationTimeout,
+		MaxPathValidationProbes:                   maxPathValidationProbes,
+		RequestConnectionIDOmission:               config.RequestConnectionIDOmission,
+		InitialReceiveStreamFlowControlWindow:     initialReceiveStreamFlowControlWindow,
+		InitialReceiveConnectionFlowControlWindow: initialReceiveConnectionFlowControlWindow,
+		MaxReceiveStreamFlowControlWindow:         maxReceiveStreamFlowControlWindow,
+		MaxReceiveConnectionFlowControlWindow:     maxReceiveConnectionFlowControlWindow,
+		MaxStreamReassemblyBuffer:                 maxStreamReassemblyBuffer,
+		MaxConnectionReassemblyBuffer:             maxConnectionReassemblyBuffer,
+		MaxUndecryptablePackets:                   maxUndecryptablePackets,
+		MaxUndecryptablePacketBytes:               maxUndecryptablePacketBytes,
+		MaxTransientWriteErrors:                   maxTransientWriteErrors,
+		MaxReasonPhraseLength:                     maxReasonPhraseLength,
+		MaxIncomingStreams:                        maxIncomingStreams,
+		MaxIncomingUniStreams:                     maxIncomingUniStreams,
+		KeepAlive:                                 config.KeepAlive,
+		KeepAlivePeriod:                           config.KeepAlivePeriod,
+		SendCoalescingDelay:                       sendCoalescingDelay,
+		CongestionWindowDecay:                     config.CongestionWindowDecay,
+		EnableECN:                                 config.EnableECN,
+		DSCP:                                      config.DSCP,
+		TTL:                                       config.TTL,
+		Features:                                  config.Features,
+		UnknownFrames:                             config.UnknownFrames,
+		OnClose:                                   config.OnClose,
+		OnStreamCompleted:                         config.OnStreamCompleted,
+		OnInvariantViolation:                      config.OnInvariantViolation,
+		LimitReceiveWindowGrowth:                  config.LimitReceiveWindowGrowth,
+		ReceiveBufferSize:                         getSocketBufferSize(config.ReceiveBufferSize),
+		SendBufferSize:                            getSocketBufferSize(config.SendBufferSize),
+		OnSocketBufferWarning:                     config.OnSocketBufferWarning,
+		DisablePathMTUDiscovery:                   config.DisablePathMTUDiscovery,
+		InitialPacketSize:                         initialPacketSize,
+		MaxPacketSize:                             maxPacketSize,
+		CongestionControl:                         config.CongestionControl,
+		AckPolicy:                                 config.AckPolicy,
+		PeerAckPolicy:                             config.PeerAckPolicy,
+		ResumeCongestionState:                     config.ResumeCongestionState,
+		StreamCoalescing:                          config.StreamCoalescing,
+		Padding:                                   config.Padding,
 	}
 }
 
-func (c *client) dial() error {
+func (c *client) dial(ctx context.Context) error {
 	var err error
 	if c.version.UsesTLS() {
-		err = c.dialTLS()
+		err = c.dialTLS(ctx)
 	} else {
-		err = c.dialGQUIC()
+		err = c.dialGQUIC(ctx)
 	}
 	if err == errCloseSessionForNewVersion {
-		return c.dial()
+		return c.dial(ctx)
 	}
 	return err
 }
 
-func (c *client) dialGQUIC() error {
+func (c *client) dialGQUIC(ctx context.Context) error {
 	if err := c.createNewGQUICSession(); err != nil {
 		return err
 	}
-	go c.listen()
-	return c.establishSecureConnection()
+	if c.transport == nil {
+		go c.listen()
+	}
+	return c.establishSecureConnection(ctx)
 }
 
-func (c *client) dialTLS() error {
+func (c *client) dialTLS(ctx context.Context) error {
 	params := &handshake.TransportParameters{
-		StreamFlowControlWindow:     protocol.ReceiveStreamFlowControlWindow,
-		ConnectionFlowControlWindow: protocol.ReceiveConnectionFlowControlWindow,
+		StreamFlowControlWindow:     protocol.ByteCount(c.config.InitialReceiveStreamFlowControlWindow),
+		ConnectionFlowControlWindow: protocol.ByteCount(c.config.InitialReceiveConnectionFlowControlWindow),
 		IdleTimeout:                 c.config.IdleTimeout,
 		OmitConnectionID:            c.config.RequestConnectionIDOmission,
 		MaxBidiStreams:              uint16(c.config.MaxIncomingStreams),
 		MaxUniStreams:               uint16(c.config.MaxIncomingUniStreams),
+		Features:                    protocol.NewFeatureSet(c.config.Features...),
 	}
 	csc := handshake.NewCryptoStreamConn(nil)
 	extHandler := handshake.NewExtensionHandlerClient(params, c.initialVersion, c.config.Versions, c.version, c.logger)
@@ -223,8 +396,10 @@ func (c *client) dialTLS() error {
 	if err := c.createNewTLSSession(extHandler.GetPeerParams(), c.version); err != nil {
 		return err
 	}
-	go c.listen()
-	if err := c.establishSecureConnection(); err != nil {
+	if c.transport == nil {
+		go c.listen()
+	}
+	if err := c.establishSecureConnection(ctx); err != nil {
 		if err != handshake.ErrCloseSessionForRetry {
 			return err
 		}
@@ -232,7 +407,7 @@ func (c *client) dialTLS() error {
 		if err := c.createNewTLSSession(extHandler.GetPeerParams(), c.version); err != nil {
 			return err
 		}
-		if err := c.establishSecureConnection(); err != nil {
+		if err := c.establishSecureConnection(ctx); err != nil {
 			return err
 		}
 	}
@@ -243,17 +418,25 @@ func (c *client) dialTLS() error {
 // It returns:
 // - errCloseSessionForNewVersion when the server sends a version negotiation packet
 // - handshake.ErrCloseSessionForRetry when the server performs a stateless retry (for IETF QUIC)
+// - the context's error when the context expires, after closing the session
 // - any other error that might occur
 // - when the connection is secure (for gQUIC), or forward-secure (for IETF QUIC)
-func (c *client) establishSecureConnection() error {
+func (c *client) establishSecureConnection(ctx context.Context) error {
 	errorChan := make(chan error, 1)
 
 	go func() {
 		err := c.session.run() // returns as soon as the session is closed
+		// the session is only closed for a new version or a retry while dialing, in which case the net.PacketConn is reused
+		if c.createdPacketConn && err != errCloseSessionForNewVersion && err != handshake.ErrCloseSessionForRetry {
+			c.conn.Close()
+		}
 		errorChan <- err
 	}()
 
 	select {
+	case <-ctx.Done():
+		c.session.Close(qerr.Error(qerr.PeerGoingAway, "dialing cancelled"))
+		return ctx.Err()
 	case err := <-errorChan:
 		return err
 	case <-c.handshakeChan:
@@ -270,80 +453,138 @@ func (c *client) listen() {
 	for {
 		var n int
 		var addr net.Addr
-		data := *getPacketBuffer()
-		data = data[:protocol.MaxReceivePacketSize]
+		var info packetInfo
+		buf := getPacketBuffer()
+		data := (*buf)[:protocol.MaxReceivePacketSize]
 		// The packet size should not exceed protocol.MaxReceivePacketSize bytes
 		// If it does, we only read a truncated packet, which will then end up undecryptable
-		n, addr, err = c.conn.Read(data)
+		n, addr, info, err = c.conn.Read(data)
 		if err != nil {
+			putPacketBuffer(buf)
 			if !strings.HasSuffix(err.Error(), "use of closed network connection") {
-				c.mutex.Lock()
-				if c.session != nil {
-					c.session.Close(err)
-				}
-				c.mutex.Unlock()
+				c.closeWithError(err)
 			}
 			break
 		}
-		if err := c.handlePacket(addr, data[:n]); err != nil {
+		if err := c.handlePacket(addr, data[:n], buf, info); err != nil {
 			c.logger.Errorf("error handling packet: %s", err.Error())
 		}
 	}
 }
 
-func (c *client) handlePacket(remoteAddr net.Addr, packet []byte) error {
-	rcvTime := time.Now()
+// closeWithError closes the session, if there is one.
+// It is called when reading from the net.PacketConn fails.
+func (c *client) closeWithError(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.session != nil {
+		c.session.Close(err)
+	}
+}
+
+// generateConnectionIDs generates the connection IDs used by a new session.
+// srcConnIDLen is the length of the source connection ID for IETF QUIC.
+func generateConnectionIDs(version protocol.VersionNumber, srcConnIDLen int) (protocol.ConnectionID, protocol.ConnectionID, error) {
+	// in gQUIC, there's only one connection ID
+	if !version.UsesTLS() {
+		connID, err := generateConnectionID(protocol.ConnectionIDLen)
+		return connID, connID, err
+	}
+	srcConnID, err := generateConnectionID(srcConnIDLen)
+	if err != nil {
+		return nil, nil, err
+	}
+	destConnID, err := generateConnectionID(protocol.ConnectionIDLen)
+	if err != nil {
+		return nil, nil, err
+	}
+	return srcConnID, destConnID, nil
+}
+
+// handlePacket handles a packet received on the client's net.PacketConn.
+// The buffer is the buffer from the buffer pool that backs the packet, if any.
+// It is returned to the pool, unless the packet is passed on to the session.
+func (c *client) handlePacket(remoteAddr net.Addr, packet []byte, buffer *[]byte, info packetInfo) error {
+	p := &receivedPacket{
+		remoteAddr: remoteAddr,
+		rcvTime:    time.Now(),
+		ecn:        info.ecn,
+		ttl:        info.ttl,
+		buffer:     buffer,
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	session, err := c.handlePacketImpl(p, packet)
+	if session == nil {
+		p.release()
+		return err
+	}
+	session.handlePacket(p)
+	return nil
+}
 
+// handlePacketImpl parses the header of a packet, and returns the session that the packet has to be passed to.
+func (c *client) handlePacketImpl(p *receivedPacket, packet []byte) (packetHandler, error) {
 	r := bytes.NewReader(packet)
-	hdr, err := wire.ParseHeaderSentByServer(r)
+	// all connection IDs issued by the client have the same length
+	hdr, err := wire.ParseHeaderSentByServer(r, c.srcConnID.Len())
 	// drop the packet if we can't parse the header
 	if err != nil {
-		return fmt.Errorf("error parsing packet from %s: %s", remoteAddr.String(), err.Error())
+		return nil, fmt.Errorf("error parsing packet from %s: %s", p.remoteAddr.String(), err.Error())
 	}
 	// reject packets with truncated connection id if we didn't request truncation
 	if hdr.OmitConnectionID && !c.config.RequestConnectionIDOmission {
-		return errors.New("received packet with truncated connection ID, but didn't request truncation")
+		return nil, errors.New("received packet with truncated connection ID, but didn't request truncation")
 	}
 	hdr.Raw = packet[:len(packet)-r.Len()]
-	packetData := packet[len(packet)-r.Len():]
-
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	p.header = hdr
+	p.data = packet[len(packet)-r.Len():]
 
 	// handle Version Negotiation Packets
 	if hdr.IsVersionNegotiation {
 		// ignore delayed / duplicated version negotiation packets
 		if c.receivedVersionNegotiationPacket || c.versionNegotiated {
-			return errors.New("received a delayed Version Negotiation Packet")
+			return nil, errors.New("received a delayed Version Negotiation Packet")
 		}
 
 		// version negotiation packets have no payload
 		if err := c.handleVersionNegotiationPacket(hdr); err != nil {
 			c.session.Close(err)
 		}
-		return nil
+		return nil, nil
 	}
 
 	if hdr.IsPublicHeader {
-		return c.handleGQUICPacket(hdr, r, packetData, remoteAddr, rcvTime)
+		return c.handleGQUICPacket(p, r)
 	}
-	return c.handleIETFQUICPacket(hdr, packetData, remoteAddr, rcvTime)
+	return c.handleIETFQUICPacket(p)
 }
 
-func (c *client) handleIETFQUICPacket(hdr *wire.Header, packetData []byte, remoteAddr net.Addr, rcvTime time.Time) error {
+func (c *client) handleIETFQUICPacket(p *receivedPacket) (packetHandler, error) {
+	hdr := p.header
+	packetData := p.data
 	// reject packets with the wrong connection ID
-	if !hdr.DestConnectionID.Equal(c.srcConnID) {
-		return fmt.Errorf("received a packet with an unexpected connection ID (%s, expected %s)", hdr.DestConnectionID, c.srcConnID)
+	if !c.isOwnConnectionID(hdr.DestConnectionID) {
+		// A Stateless Reset looks like a Short Header packet with a random connection ID.
+		if !hdr.IsLongHeader && c.isStatelessReset(packetData) {
+			c.logger.Infof("Received a Stateless Reset.")
+			c.session.closeRemote(ErrStatelessReset)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("received a packet with an unexpected connection ID (%s, expected %s)", hdr.DestConnectionID, c.srcConnID)
 	}
 	if hdr.IsLongHeader {
 		if hdr.Type != protocol.PacketTypeRetry && hdr.Type != protocol.PacketTypeHandshake {
-			return fmt.Errorf("Received unsupported packet type: %s", hdr.Type)
+			return nil, fmt.Errorf("Received unsupported packet type: %s", hdr.Type)
 		}
 		c.logger.Debugf("len(packet data): %d, payloadLen: %d", len(packetData), hdr.PayloadLen)
 		if protocol.ByteCount(len(packetData)) < hdr.PayloadLen {
-			return fmt.Errorf("packet payload (%d bytes) is smaller than the expected payload length (%d bytes)", len(packetData), hdr.PayloadLen)
+			return nil, fmt.Errorf("packet payload (%d bytes) is smaller than the expected payload length (%d bytes)", len(packetData), hdr.PayloadLen)
 		}
 		packetData = packetData[:int(hdr.PayloadLen)]
+		p.data = packetData
 		// TODO(#1312): implement parsing of compound packets
 	}
 
@@ -352,20 +593,15 @@ func (c *client) handleIETFQUICPacket(hdr *wire.Header, packetData []byte, remot
 	if !c.versionNegotiated {
 		c.versionNegotiated = true
 	}
-
-	c.session.handlePacket(&receivedPacket{
-		remoteAddr: remoteAddr,
-		header:     hdr,
-		data:       packetData,
-		rcvTime:    rcvTime,
-	})
-	return nil
+	return c.session, nil
 }
 
-func (c *client) handleGQUICPacket(hdr *wire.Header, r *bytes.Reader, packetData []byte, remoteAddr net.Addr, rcvTime time.Time) error {
+func (c *client) handleGQUICPacket(p *receivedPacket, r *bytes.Reader) (packetHandler, error) {
+	hdr := p.header
+	remoteAddr := p.remoteAddr
 	// reject packets with the wrong connection ID
 	if !hdr.OmitConnectionID && !hdr.DestConnectionID.Equal(c.srcConnID) {
-		return fmt.Errorf("received a packet with an unexpected connection ID (%s, expected %s)", hdr.DestConnectionID, c.srcConnID)
+		return nil, fmt.Errorf("received a packet with an unexpected connection ID (%s, expected %s)", hdr.DestConnectionID, c.srcConnID)
 	}
 
 	if hdr.ResetFlag {
@@ -373,15 +609,15 @@ func (c *client) handleGQUICPacket(hdr *wire.Header, r *bytes.Reader, packetData
 		// check if the remote address and the connection ID match
 		// otherwise this might be an attacker trying to inject a PUBLIC_RESET to kill the connection
 		if cr.Network() != remoteAddr.Network() || cr.String() != remoteAddr.String() || !hdr.DestConnectionID.Equal(c.srcConnID) {
-			return errors.New("Received a spoofed Public Reset")
+			return nil, errors.New("Received a spoofed Public Reset")
 		}
 		pr, err := wire.ParsePublicReset(r)
 		if err != nil {
-			return fmt.Errorf("Received a Public Reset. An error occurred parsing the packet: %s", err)
+			return nil, fmt.Errorf("Received a Public Reset. An error occurred parsing the packet: %s", err)
 		}
-		c.session.closeRemote(qerr.Error(qerr.PublicReset, fmt.Sprintf("Received a Public Reset for packet number %#x", pr.RejectedPacketNumber)))
+		c.session.closeRemote(qerr.RemoteError(qerr.PublicReset, fmt.Sprintf("Received a Public Reset for packet number %#x", pr.RejectedPacketNumber)))
 		c.logger.Infof("Received Public Reset, rejected packet number: %#x", pr.RejectedPacketNumber)
-		return nil
+		return nil, nil
 	}
 
 	// this is the first packet we are receiving
@@ -389,14 +625,7 @@ func (c *client) handleGQUICPacket(hdr *wire.Header, r *bytes.Reader, packetData
 	if !c.versionNegotiated {
 		c.versionNegotiated = true
 	}
-
-	c.session.handlePacket(&receivedPacket{
-		remoteAddr: remoteAddr,
-		header:     hdr,
-		data:       packetData,
-		rcvTime:    rcvTime,
-	})
-	return nil
+	return c.session, nil
 }
 
 func (c *client) handleVersionNegotiationPacket(hdr *wire.Header) error {
@@ -422,25 +651,93 @@ func (c *client) handleVersionNegotiationPacket(hdr *wire.Header) error {
 	c.initialVersion = c.version
 	c.version = newVersion
 	var err error
-	c.destConnID, err = generateConnectionID()
+	c.srcConnID, c.destConnID, err = generateConnectionIDs(c.version, c.config.ConnectionIDLength)
 	if err != nil {
 		return err
 	}
-	// in gQUIC, there's only one connection ID
-	if !c.version.UsesTLS() {
-		c.srcConnID = c.destConnID
-	}
 	c.logger.Infof("Switching to QUIC version %s. New connection ID: %s", newVersion, c.destConnID)
 	c.session.Close(errCloseSessionForNewVersion)
 	return nil
 }
 
+func (c *client) isOwnConnectionID(connID protocol.ConnectionID) bool {
+	if connID.Equal(c.srcConnID) {
+		return true
+	}
+	c.connIDsMutex.Lock()
+	defer c.connIDsMutex.Unlock()
+	_, ok := c.connIDs[string(connID)]
+	return ok
+}
+
+func (c *client) addConnectionID(connID protocol.ConnectionID) {
+	c.connIDsMutex.Lock()
+	defer c.connIDsMutex.Unlock()
+	if c.connIDs == nil {
+		c.connIDs = make(map[string]struct{})
+	}
+	c.connIDs[string(connID)] = struct{}{}
+	if c.transport != nil {
+		c.transport.addClient(connID, c)
+	}
+}
+
+func (c *client) removeConnectionID(connID protocol.ConnectionID) {
+	c.connIDsMutex.Lock()
+	defer c.connIDsMutex.Unlock()
+	delete(c.connIDs, string(connID))
+	if c.transport != nil {
+		c.transport.removeClient(connID)
+	}
+}
+
+// isStatelessReset says if a packet ends with one of the stateless reset tokens issued by the server
+func (c *client) isStatelessReset(data []byte) bool {
+	if len(data) < 16 {
+		return false
+	}
+	var token [16]byte
+	copy(token[:], data[len(data)-16:])
+	c.connIDsMutex.Lock()
+	defer c.connIDsMutex.Unlock()
+	_, ok := c.resetTokens[token]
+	return ok
+}
+
+func (c *client) addResetToken(token [16]byte) {
+	c.connIDsMutex.Lock()
+	defer c.connIDsMutex.Unlock()
+	if c.resetTokens == nil {
+		c.resetTokens = make(map[[16]byte]struct{})
+	}
+	c.resetTokens[token] = struct{}{}
+	if c.transport != nil {
+		c.transport.addResetToken(token, c)
+	}
+}
+
+func (c *client) removeResetToken(token [16]byte) {
+	c.connIDsMutex.Lock()
+	defer c.connIDsMutex.Unlock()
+	delete(c.resetTokens, token)
+	if c.transport != nil {
+		c.transport.removeResetToken(token, c)
+	}
+}
+
 func (c *client) createNewGQUICSession() (err error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	runner := &runner{
-		onHandshakeCompleteImpl: func(_ packetHandler) { close(c.handshakeChan) },
-		removeConnectionIDImpl:  func(protocol.ConnectionID) {},
+		onHandshakeCompleteImpl:    func(_ packetHandler) { close(c.handshakeChan) },
+		addConnectionIDImpl:        func(protocol.ConnectionID, packetHandler) {},
+		removeConnectionIDImpl:     c.removeConnectionID,
+		getStatelessResetTokenImpl: getRandomStatelessResetToken,
+		addResetTokenImpl:          func([16]byte) {},
+		removeResetTokenImpl:       func([16]byte) {},
+	}
+	if c.transport != nil {
+		c.transport.addClient(c.srcConnID, c)
 	}
 	c.session, err = newClientSession(
 		c.conn,
@@ -464,8 +761,15 @@ func (c *client) createNewTLSSession(
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	runner := &runner{
-		onHandshakeCompleteImpl: func(_ packetHandler) { close(c.handshakeChan) },
-		removeConnectionIDImpl:  func(protocol.ConnectionID) {},
+		onHandshakeCompleteImpl:    func(_ packetHandler) { close(c.handshakeChan) },
+		addConnectionIDImpl:        func(connID protocol.ConnectionID, _ packetHandler) { c.addConnectionID(connID) },
+		removeConnectionIDImpl:     c.removeConnectionID,
+		getStatelessResetTokenImpl: getRandomStatelessResetToken,
+		addResetTokenImpl:          c.addResetToken,
+		removeResetTokenImpl:       c.removeResetToken,
+	}
+	if c.transport != nil {
+		c.transport.addClient(c.srcConnID, c)
 	}
 	c.session, err = newTLSClientSession(
 		c.conn,
@@ -0,0 +1,251 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/qerr"
+)
+
+var errClientPoolClosed = errors.New("client pool closed")
+
+type pooledSession struct {
+	sess Session
+	// lastUsed is the time when the last stream was opened on this session
+	lastUsed time.Time
+}
+
+// A ClientPool dials QUIC sessions, and reuses them for subsequent streams to the same host.
+// This saves the handshake for every request, e.g. for RPC clients.
+// A session is only reused if the peer's concurrent stream limit allows opening another stream.
+// Otherwise, a new session is dialed.
+// Sessions that didn't have any open streams for the idle timeout are closed.
+// Warning: This API should not be considered stable and might change soon.
+type ClientPool struct {
+	mutex sync.Mutex
+
+	tlsConf     *tls.Config
+	config      *Config
+	idleTimeout time.Duration
+
+	sessions map[string][]*pooledSession
+	// dialing contains a channel for every host that a session is currently dialed to.
+	// The channel is closed when dialing completes.
+	dialing map[string]chan struct{}
+
+	dialAddr func(ctx context.Context, host string, tlsConf *tls.Config, config *Config) (Session, error)
+
+	closed    bool
+	closeChan chan struct{}
+	runDone   chan struct{}
+}
+
+// NewClientPool creates a new ClientPool.
+// All sessions are dialed using the same tls.Config and Config.
+// If the idle timeout is zero, sessions are closed after 30 seconds without any open streams.
+func NewClientPool(tlsConf *tls.Config, config *Config, idleTimeout time.Duration) *ClientPool {
+	if idleTimeout == 0 {
+		idleTimeout = protocol.DefaultClientPoolIdleTimeout
+	}
+	p := &ClientPool{
+		tlsConf:     tlsConf,
+		config:      config,
+		idleTimeout: idleTimeout,
+		sessions:    make(map[string][]*pooledSession),
+		dialing:     make(map[string]chan struct{}),
+		dialAddr:    DialAddrContext,
+		closeChan:   make(chan struct{}),
+		runDone:     make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *ClientPool) run() {
+	defer close(p.runDone)
+
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.closeChan:
+			return
+		case now := <-ticker.C:
+			p.evictIdle(now)
+		}
+	}
+}
+
+// OpenStream opens a new bidirectional stream to the host.
+// It uses an existing session to the host, if that session's stream limit allows opening another stream,
+// and dials a new session otherwise.
+// If a session to the host is already being dialed, it waits for that dial to complete first.
+// If the stream limit of a newly dialed session doesn't allow opening a stream, it blocks until it does, or until ctx is canceled.
+func (p *ClientPool) OpenStream(ctx context.Context, host string) (Stream, error) {
+	for {
+		p.mutex.Lock()
+		if p.closed {
+			p.mutex.Unlock()
+			return nil, errClientPoolClosed
+		}
+		if str := p.openStreamOnExistingSession(host); str != nil {
+			p.mutex.Unlock()
+			return str, nil
+		}
+		dialing, ok := p.dialing[host]
+		if !ok {
+			dialing = make(chan struct{})
+			p.dialing[host] = dialing
+			p.mutex.Unlock()
+			return p.dial(ctx, host, dialing)
+		}
+		p.mutex.Unlock()
+
+		// wait for the dial that is in progress, then try to use that session
+		select {
+		case <-dialing:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// openStreamOnExistingSession tries to open a stream on the sessions to the host.
+// Sessions that were closed are removed from the pool.
+// It must be called with the mutex held.
+func (p *ClientPool) openStreamOnExistingSession(host string) Stream {
+	sessions := p.sessions[host]
+	for i := 0; i < len(sessions); i++ {
+		ps := sessions[i]
+		str, err := ps.sess.OpenStream()
+		if err == nil {
+			ps.lastUsed = time.Now()
+			return str
+		}
+		if err == qerr.TooManyOpenStreams {
+			continue
+		}
+		// the session is no longer usable
+		sessions = append(sessions[:i], sessions[i+1:]...)
+		i--
+	}
+	p.setSessions(host, sessions)
+	return nil
+}
+
+func (p *ClientPool) dial(ctx context.Context, host string, dialing chan struct{}) (Stream, error) {
+	sess, err := p.dialAddr(ctx, host, p.tlsConf, p.config)
+
+	p.mutex.Lock()
+	delete(p.dialing, host)
+	close(dialing)
+	if err != nil {
+		p.mutex.Unlock()
+		return nil, err
+	}
+	if p.closed {
+		p.mutex.Unlock()
+		sess.Close(nil)
+		return nil, errClientPoolClosed
+	}
+	ps := &pooledSession{sess: sess, lastUsed: time.Now()}
+	p.sessions[host] = append(p.sessions[host], ps)
+	// The OpenStream calls waiting for this dial can only use the session once we release the mutex.
+	// Open our stream first, so that they can't use up the stream limit.
+	str, err := sess.OpenStream()
+	p.mutex.Unlock()
+	if err != qerr.TooManyOpenStreams {
+		return str, err
+	}
+	// The peer doesn't allow opening any streams yet.
+	return openStreamSync(ctx, sess)
+}
+
+// openStreamSync opens a stream on the session, blocking until the peer's stream limit allows it, or until ctx is canceled.
+// If ctx is canceled, the stream that is opened later is canceled.
+func openStreamSync(ctx context.Context, sess Session) (Stream, error) {
+	type result struct {
+		str Stream
+		err error
+	}
+	resultChan := make(chan result, 1)
+	go func() {
+		str, err := sess.OpenStreamSync()
+		resultChan <- result{str: str, err: err}
+	}()
+	select {
+	case r := <-resultChan:
+		return r.str, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-resultChan; r.err == nil {
+				r.str.CancelWrite(0)
+				r.str.CancelRead(0)
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+func (p *ClientPool) setSessions(host string, sessions []*pooledSession) {
+	if len(sessions) == 0 {
+		delete(p.sessions, host)
+		return
+	}
+	p.sessions[host] = sessions
+}
+
+// evictIdle closes all sessions that didn't have any open streams for the idle timeout,
+// and removes sessions that were closed.
+func (p *ClientPool) evictIdle(now time.Time) {
+	p.mutex.Lock()
+	var idle []Session
+	for host, sessions := range p.sessions {
+		active := sessions[:0]
+		for _, ps := range sessions {
+			select {
+			case <-ps.sess.Context().Done():
+				continue
+			default:
+			}
+			if ps.sess.Stats().OpenStreams == 0 && now.Sub(ps.lastUsed) >= p.idleTimeout {
+				idle = append(idle, ps.sess)
+				continue
+			}
+			active = append(active, ps)
+		}
+		p.setSessions(host, active)
+	}
+	p.mutex.Unlock()
+
+	for _, sess := range idle {
+		sess.Close(nil)
+	}
+}
+
+// Close closes all sessions in the pool.
+// Subsequent calls to OpenStream return an error.
+func (p *ClientPool) Close() error {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return nil
+	}
+	p.closed = true
+	sessions := p.sessions
+	p.sessions = make(map[string][]*pooledSession)
+	p.mutex.Unlock()
+
+	close(p.closeChan)
+	<-p.runDone
+	for _, ss := range sessions {
+		for _, ps := range ss {
+			ps.sess.Close(nil)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/lucas-clemente/quic-go/qerr"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client Pool", func() {
+	var (
+		pool     *ClientPool
+		dialChan chan Session // sessions returned by dialAddr
+		dialed   chan string  // hosts passed to dialAddr
+	)
+
+	BeforeEach(func() {
+		pool = NewClientPool(nil, nil, time.Hour)
+		dialChan = make(chan Session, 10)
+		dialed = make(chan string, 10)
+		pool.dialAddr = func(_ context.Context, host string, _ *tls.Config, _ *Config) (Session, error) {
+			dialed <- host
+			return <-dialChan, nil
+		}
+	})
+
+	AfterEach(func() {
+		// don't close the mocked sessions
+		pool.mutex.Lock()
+		pool.sessions = make(map[string][]*pooledSession)
+		pool.mutex.Unlock()
+		Expect(pool.Close()).To(Succeed())
+	})
+
+	It("uses the default idle timeout", func() {
+		p := NewClientPool(nil, nil, 0)
+		Expect(p.idleTimeout).To(Equal(30 * time.Second))
+		Expect(p.Close()).To(Succeed())
+	})
+
+	It("dials a new session", func() {
+		sess := NewMockPacketHandler(mockCtrl)
+		str := NewMockStreamI(mockCtrl)
+		sess.EXPECT().OpenStream().Return(str, nil)
+		dialChan <- sess
+		s, err := pool.OpenStream(context.Background(), "quic.clemente.io:443")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s).To(Equal(str))
+		Expect(dialed).To(Receive(Equal("quic.clemente.io:443")))
+	})
+
+	It("reuses a session to the same host", func() {
+		sess := NewMockPacketHandler(mockCtrl)
+		sess.EXPECT().OpenStream().Return(NewMockStreamI(mockCtrl), nil)
+		dialChan <- sess
+		_, err := pool.OpenStream(context.Background(), "quic.clemente.io:443")
+		Expect(err).ToNot(HaveOccurred())
+		str := NewMockStreamI(mockCtrl)
+		sess.EXPECT().OpenStream().Return(str, nil)
+		s, err := pool.OpenStream(context.Background(), "quic.clemente.io:443")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s).To(Equal(str))
+		Expect(dialed).To(HaveLen(1))
+	})
+
+	It("uses different sessions for different hosts", func() {
+		sess1 := NewMockPacketHandler(mockCtrl)
+		sess1.EXPECT().OpenStream().Return(NewMockStreamI(mockCtrl), nil)
+		sess2 := NewMockPacketHandler(mockCtrl)
+		sess2.EXPECT().OpenStream().Return(NewMockStreamI(mockCtrl), nil)
+		dialChan <- sess1
+		dialChan <- sess2
+		_, err := pool.OpenStream(context.Background(), "quic.clemente.io:443")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = pool.OpenStream(context.Background(), "example.com:443")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dialed).To(HaveLen(2))
+		Expect(pool.sessions).To(HaveLen(2))
+	})
+
+	It("dials a new session when the stream limit of the existing session is reached", func() {
+		sess1 := NewMockPacketHandler(mockCtrl)
+		sess1.EXPECT().OpenStream().Return(NewMockStreamI(mockCtrl), nil)
+		dialChan <- sess1
+		_, err := pool.OpenStream(context.Background(), "quic.clemente.io:443")
+		Expect(err).ToNot(HaveOccurred())
+		sess1.EXPECT().OpenStream().Return(nil, qerr.TooManyOpenStreams)
+		sess2 := NewMockPacketHandler(mockCtrl)
+		str := NewMockStreamI(mockCtrl)
+		sess2.EXPECT().OpenStream().Return(str, nil)
+		dialChan <- sess2
+		s, err := pool.OpenStream(context.Background(), "quic.clemente.io:443")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s).To(Equal(str))
+		Expect(pool.sessions["quic.clemente.io:443"]).To(HaveLen(2))
+	})
+
+	It("removes sessions that can't be used any more", func() {
+		sess1 := NewMockPacketHandler(mockCtrl)
+		sess1.EXPECT().OpenStream().Return(NewMockStreamI(mockCtrl), nil)
+		dialChan <- sess1
+		_, err := pool.OpenStream(context.Background(), "quic.clemente.io:443")
+		Expect(err).ToNot(HaveOccurred())
+		sess1.EXPECT().OpenStream().Return(nil, errors.New("session closed"))
+		sess2 := NewMockPacketHandler(mockCtrl)
+		sess2.EXPECT().OpenStream().Return(NewMockStreamI(mockCtrl), nil)
+		dialChan <- sess2
+		_, err = pool.OpenStream(context.Background(), "quic.clemente.io:443")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pool.sessions["quic.clemente.io:443"]).To(HaveLen(1))
+		Expect(pool.sessions["quic.clemente.io:443"][0].sess).To(Equal(sess2))
+	})
+
+	It("returns dial errors", func() {
+		testErr := errors.New("dial failed")
+		pool.dialAddr = func(context.Context, string, *tls.Config, *Config) (Session, error) {
+			return nil, testErr
+		}
+		_, err := pool.OpenStream(context.Background(), "quic.clemente.io:443")
+		Expect(err).To(MatchError(testErr))
+		Expect(pool.dialing).To(BeEmpty())
+		Expect(pool.sessions).To(BeEmpty())
+	})
+
+	It("waits for a session that is being dialed to the same host", func() {
+		sess := NewMockPacketHandler(mockCtrl)
+		sess.EXPECT().OpenStream().Return(NewMockStreamI(mockCtrl), nil)
+		sess.EXPECT().OpenStream().Return(NewMockStreamI(mockCtrl), nil)
+		done := make(chan struct{}, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				defer GinkgoRecover()
+				_, err := pool.OpenStream(context.Background(), "quic.clemente.io:443")
+				Expect(err).ToNot(HaveOccurred())
+				done <- struct{}{}
+			}()
+		}
+		Eventually(dialed).Should(Receive())
+		Consistently(done).ShouldNot(Receive())
+		dialChan <- sess
+		Eventually(done).Should(Receive())
+		Eventually(done).Should(Receive())
+		Expect(dialed).To(BeEmpty())
+	})
+
+	It("stops waiting for a session that is being dialed when the context is canceled", func() {
+		sess := NewMockPacketHandler(mockCtrl)
+		sess.EXPECT().OpenStream().Return(NewMockStreamI(mockCtrl), nil)
+		go func() {
+			defer GinkgoRecover()
+			_, err := pool.OpenStream(context.Background(), "quic.clemente.io:443")
+			Expect(err).ToNot(HaveOccurred())
+		}()
+		Eventually(dialed).Should(Receive())
+		ctx, cancel := context.WithCancel(context.Background())
+		errChan := make(chan error)
+		go func() {
+			defer GinkgoRecover()
+			_, err := pool.OpenStream(ctx, "quic.clemente.io:443")
+			errChan <- err
+		}()
+		Consistently(errChan).ShouldNot(Receive())
+		cancel()
+		Eventually(errChan).Should(Receive(MatchError(context.Canceled)))
+		dialChan <- sess
+		Eventually(func() int {
+			pool.mutex.Lock()
+			defer pool.mutex.Unlock()
+			return len(pool.sessions)
+		}).Should(Equal(1))
+	})
+
+	It("waits for the stream limit of a newly dialed session", func() {
+		sess := NewMockPacketHandler(mockCtrl)
+		str := NewMockStreamI(mockCtrl)
+		sess.EXPECT().OpenStream().Return(nil, qerr.TooManyOpenStreams)
+		sess.EXPECT().OpenStreamSync().Return(str, nil)
+		dialChan <- sess
+		s, err := pool.OpenStream(context.Background(), "quic.clemente.io:443")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s).To(Equal(str))
+	})
+
+	It("stops waiting for the stream limit of a newly dialed session when the context is canceled", func() {
+		sess := NewMockPacketHandler(mockCtrl)
+		str := NewMockStreamI(mockCtrl)
+		openStream := make(chan struct{})
+		sess.EXPECT().OpenStream().Return(nil, qerr.TooManyOpenStreams)
+		sess.EXPECT().OpenStreamSync().DoAndReturn(func() (Stream, error) {
+			<-openStream
+			return str, nil
+		})
+		canceled := make(chan struct{}, 2)
+		str.EXPECT().CancelWrite(gomock.Any()).Do(func(ErrorCode) { canceled <- struct{}{} })
+		str.EXPECT().CancelRead(gomock.Any()).Do(func(ErrorCode) { canceled <- struct{}{} })
+		dialChan <- sess
+		ctx, cancel := context.WithCancel(context.Background())
+		errChan := make(chan error)
+		go func() {
+			defer GinkgoRecover()
+			_, err := pool.OpenStream(ctx, "quic.clemente.io:443")
+			errChan <- err
+		}()
+		Consistently(errChan).ShouldNot(Receive())
+		cancel()
+		Eventually(errChan).Should(Receive(MatchError(context.Canceled)))
+		// the stream opened after the context was canceled is not leaked
+		close(openStream)
+		Eventually(canceled).Should(Receive())
+		Eventually(canceled).Should(Receive())
+	})
+
+	Context("evicting idle sessions", func() {
+		addSession := func(host string, lastUsed time.Time) *MockPacketHandler {
+			sess := NewMockPacketHandler(mockCtrl)
+			pool.sessions[host] = append(pool.sessions[host], &pooledSession{sess: sess, lastUsed: lastUsed})
+			return sess
+		}
+
+		It("closes sessions without open streams after the idle timeout", func() {
+			now := time.Now()
+			sess1 := addSession("quic.clemente.io:443", now.Add(-time.Hour))
+			sess1.EXPECT().Context().Return(context.Background())
+			sess1.EXPECT().Stats().Return(SessionStats{})
+			sess1.EXPECT().Close(nil)
+			sess2 := addSession("quic.clemente.io:443", now.Add(-time.Hour+time.Second))
+			sess2.EXPECT().Context().Return(context.Background())
+			sess2.EXPECT().Stats().Return(SessionStats{})
+			pool.evictIdle(now)
+			Expect(pool.sessions["quic.clemente.io:443"]).To(HaveLen(1))
+			Expect(pool.sessions["quic.clemente.io:443"][0].sess).To(Equal(sess2))
+		})
+
+		It("doesn't close sessions that have open streams", func() {
+			now := time.Now()
+			sess := addSession("quic.clemente.io:443", now.Add(-2*time.Hour))
+			sess.EXPECT().Context().Return(context.Background())
+			sess.EXPECT().Stats().Return(SessionStats{OpenStreams: 1})
+			pool.evictIdle(now)
+			Expect(pool.sessions["quic.clemente.io:443"]).To(HaveLen(1))
+		})
+
+		It("removes sessions that were closed", func() {
+			sess := addSession("quic.clemente.io:443", time.Now())
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			sess.EXPECT().Context().Return(ctx)
+			pool.evictIdle(time.Now())
+			Expect(pool.sessions).To(BeEmpty())
+		})
+
+		It("evicts sessions periodically", func() {
+			p := NewClientPool(nil, nil, 20*time.Millisecond)
+			sess := NewMockPacketHandler(mockCtrl)
+			p.sessions["quic.clemente.io:443"] = []*pooledSession{{sess: sess, lastUsed: time.Now()}}
+			closed := make(chan struct{})
+			sess.EXPECT().Context().Return(context.Background()).AnyTimes()
+			sess.EXPECT().Stats().Return(SessionStats{}).AnyTimes()
+			sess.EXPECT().Close(nil).Do(func(error) { close(closed) })
+			Eventually(closed).Should(BeClosed())
+			Expect(p.Close()).To(Succeed())
+		})
+	})
+
+	Context("closing", func() {
+		It("closes all sessions", func() {
+			sess1 := NewMockPacketHandler(mockCtrl)
+			sess2 := NewMockPacketHandler(mockCtrl)
+			pool.sessions["quic.clemente.io:443"] = []*pooledSession{{sess: sess1}}
+			pool.sessions["example.com:443"] = []*pooledSession{{sess: sess2}}
+			sess1.EXPECT().Close(nil)
+			sess2.EXPECT().Close(nil)
+			Expect(pool.Close()).To(Succeed())
+			Expect(pool.runDone).To(BeClosed())
+			_, err := pool.OpenStream(context.Background(), "quic.clemente.io:443")
+			Expect(err).To(MatchError(errClientPoolClosed))
+			// closing it again is a no-op
+			Expect(pool.Close()).To(Succeed())
+		})
+
+		It("closes sessions that finish dialing after the pool was closed", func() {
+			sess := NewMockPacketHandler(mockCtrl)
+			errChan := make(chan error)
+			go func() {
+				defer GinkgoRecover()
+				_, err := pool.OpenStream(context.Background(), "quic.clemente.io:443")
+				errChan <- err
+			}()
+			Eventually(dialed).Should(Receive())
+			Expect(pool.Close()).To(Succeed())
+			sess.EXPECT().Close(nil)
+			dialChan <- sess
+			Eventually(errChan).Should(Receive(MatchError(errClientPoolClosed)))
+		})
+	})
+})
@@ -2,6 +2,7 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -74,11 +75,11 @@ var _ = Describe("Client", func() {
 	})
 
 	Context("Dialing", func() {
-		var origGenerateConnectionID func() (protocol.ConnectionID, error)
+		var origGenerateConnectionID func(int) (protocol.ConnectionID, error)
 
 		BeforeEach(func() {
 			origGenerateConnectionID = generateConnectionID
-			generateConnectionID = func() (protocol.ConnectionID, error) {
+			generateConnectionID = func(int) (protocol.ConnectionID, error) {
 				return connID, nil
 			}
 		})
@@ -107,6 +108,7 @@ var _ = Describe("Client", func() {
 				remoteAddrChan <- conn.RemoteAddr().String()
 				sess := NewMockPacketHandler(mockCtrl)
 				sess.EXPECT().run()
+				sess.EXPECT().ConnectionState()
 				return sess, nil
 			}
 			_, err := DialAddr("localhost:17890", nil, &Config{HandshakeTimeout: time.Millisecond})
@@ -131,6 +133,7 @@ var _ = Describe("Client", func() {
 				hostnameChan <- h
 				sess := NewMockPacketHandler(mockCtrl)
 				sess.EXPECT().run()
+				sess.EXPECT().ConnectionState()
 				return sess, nil
 			}
 			_, err := DialAddr("localhost:17890", &tls.Config{ServerName: "foobar"}, nil)
@@ -161,6 +164,7 @@ var _ = Describe("Client", func() {
 			) (packetHandler, error) {
 				sess := NewMockPacketHandler(mockCtrl)
 				sess.EXPECT().run().Do(func() { close(run) })
+				sess.EXPECT().ConnectionState()
 				sess.EXPECT().handlePacket(gomock.Any())
 				runner.onHandshakeComplete(sess)
 				return sess, nil
@@ -172,6 +176,107 @@ var _ = Describe("Client", func() {
 			Eventually(run).Should(BeClosed())
 		})
 
+		Context("caching the versions supported by the server", func() {
+			var origServerVersions *serverVersionCache
+
+			BeforeEach(func() {
+				origServerVersions = serverVersions
+				serverVersions = newServerVersionCache(10)
+			})
+
+			AfterEach(func() {
+				serverVersions = origServerVersions
+			})
+
+			It("records the versions the server announced in the handshake", func() {
+				newClientSession = func(
+					_ connection,
+					_ sessionRunner,
+					_ string,
+					_ protocol.VersionNumber,
+					_ protocol.ConnectionID,
+					_ *tls.Config,
+					_ *Config,
+					_ protocol.VersionNumber,
+					_ []protocol.VersionNumber,
+					_ utils.Logger,
+				) (packetHandler, error) {
+					sess := NewMockPacketHandler(mockCtrl)
+					sess.EXPECT().run()
+					sess.EXPECT().ConnectionState().Return(ConnectionState{SupportedVersions: []protocol.VersionNumber{protocol.Version39}})
+					return sess, nil
+				}
+				_, err := Dial(packetConn, addr, "quic.clemente.io:1337", nil, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serverVersions.versions).To(HaveKeyWithValue("quic.clemente.io:1337", []protocol.VersionNumber{protocol.Version39}))
+			})
+
+			It("dials with the version the server supported on the last connection", func() {
+				serverVersions.Add("quic.clemente.io:1337", []protocol.VersionNumber{protocol.Version39})
+				versionChan := make(chan protocol.VersionNumber, 1)
+				newClientSession = func(
+					_ connection,
+					_ sessionRunner,
+					_ string,
+					v protocol.VersionNumber,
+					_ protocol.ConnectionID,
+					_ *tls.Config,
+					_ *Config,
+					_ protocol.VersionNumber,
+					_ []protocol.VersionNumber,
+					_ utils.Logger,
+				) (packetHandler, error) {
+					versionChan <- v
+					sess := NewMockPacketHandler(mockCtrl)
+					sess.EXPECT().run()
+					sess.EXPECT().ConnectionState()
+					return sess, nil
+				}
+				config := &Config{Versions: []protocol.VersionNumber{protocol.VersionTLS, protocol.Version39}}
+				_, err := Dial(packetConn, addr, "quic.clemente.io:1337", nil, config)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(versionChan).To(Receive(Equal(protocol.Version39)))
+			})
+		})
+
+		It("aborts dialing when the context is cancelled", func() {
+			closed := make(chan struct{})
+			newClientSession = func(
+				_ connection,
+				_ sessionRunner,
+				_ string,
+				_ protocol.VersionNumber,
+				_ protocol.ConnectionID,
+				_ *tls.Config,
+				_ *Config,
+				_ protocol.VersionNumber,
+				_ []protocol.VersionNumber,
+				_ utils.Logger,
+			) (packetHandler, error) {
+				sess := NewMockPacketHandler(mockCtrl)
+				sess.EXPECT().run().DoAndReturn(func() error {
+					<-closed
+					return nil
+				})
+				sess.EXPECT().Close(gomock.Any()).Do(func(err error) {
+					Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.PeerGoingAway))
+					close(closed)
+				})
+				return sess, nil
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			dialErr := make(chan error)
+			go func() {
+				defer GinkgoRecover()
+				_, err := DialContext(ctx, packetConn, addr, "quic.clemente.io:1337", nil, nil)
+				dialErr <- err
+			}()
+			Consistently(dialErr).ShouldNot(Receive())
+			cancel()
+			Eventually(dialErr).Should(Receive(MatchError(context.Canceled)))
+			Eventually(closed).Should(BeClosed())
+		})
+
 		It("returns an error that occurs while waiting for the connection to become secure", func() {
 			testErr := errors.New("early handshake error")
 			handledPacket := make(chan struct{})
@@ -198,14 +303,64 @@ var _ = Describe("Client", func() {
 			Eventually(handledPacket).Should(BeClosed())
 		})
 
+		It("doesn't close a net.PacketConn passed by the caller when the session is closed", func() {
+			sess := NewMockPacketHandler(mockCtrl)
+			sess.EXPECT().run()
+			cl.session = sess
+			cl.handshakeChan = make(chan struct{})
+			Expect(cl.establishSecureConnection(context.Background())).To(Succeed())
+			Expect(packetConn.closed).To(BeFalse())
+		})
+
+		It("closes the net.PacketConn it created when the session is closed", func() {
+			sess := NewMockPacketHandler(mockCtrl)
+			sess.EXPECT().run()
+			cl.session = sess
+			cl.handshakeChan = make(chan struct{})
+			cl.createdPacketConn = true
+			Expect(cl.establishSecureConnection(context.Background())).To(Succeed())
+			Expect(packetConn.closed).To(BeTrue())
+		})
+
+		It("doesn't close the net.PacketConn it created when the session is closed for a new version", func() {
+			sess := NewMockPacketHandler(mockCtrl)
+			sess.EXPECT().run().Return(errCloseSessionForNewVersion)
+			cl.session = sess
+			cl.handshakeChan = make(chan struct{})
+			cl.createdPacketConn = true
+			Expect(cl.establishSecureConnection(context.Background())).To(MatchError(errCloseSessionForNewVersion))
+			Expect(packetConn.closed).To(BeFalse())
+		})
+
 		Context("quic.Config", func() {
 			It("setups with the right values", func() {
 				config := &Config{
-					HandshakeTimeout:            1337 * time.Minute,
-					IdleTimeout:                 42 * time.Hour,
-					RequestConnectionIDOmission: true,
-					MaxIncomingStreams:          1234,
-					MaxIncomingUniStreams:       4321,
+					HandshakeTimeout:               1337 * time.Minute,
+					IdleTimeout:                    42 * time.Hour,
+					RequestConnectionIDOmission:    true,
+					MaxIncomingStreams:             1234,
+					MaxIncomingUniStreams:          4321,
+					CongestionWindowDecay:          CongestionWindowDecayReset,
+					CongestionControl:              CongestionControlBBRv2,
+					UnknownFrames:                  UnknownFramesIgnore,
+					HandshakeRetransmissionTimeout: 3 * time.Second,
+					HandshakeRetransmissionBackoff: 1.5,
+					MaxHandshakeRetransmissions:    7,
+					PathValidationTimeout:          5 * time.Second,
+					MaxPathValidationProbes:        5,
+					ConnectionIDLength:             12,
+					ConnectionIDCount:              4,
+					KeepAlivePeriod:                15 * time.Second,
+					SendCoalescingDelay:            200 * time.Microsecond,
+					Features:                       []Feature{FeatureAckFrequency},
+					EnableECN:                      true,
+					DSCP:                           46,
+					TTL:                            64,
+					AckPolicy:                      AckPolicy{PacketThreshold: 4},
+					PeerAckPolicy:                  &AckPolicy{PacketThreshold: 10},
+					ResumeCongestionState:          &CongestionState{CongestionWindow: 100000},
+					StreamCoalescing:               StreamCoalescingNone,
+					Padding:                        PaddingAll,
 				}
 				c := populateClientConfig(config)
 				Expect(c.HandshakeTimeout).To(Equal(1337 * time.Minute))
@@ -213,6 +368,42 @@ var _ = Describe("Client", func() {
 				Expect(c.RequestConnectionIDOmission).To(BeTrue())
 				Expect(c.MaxIncomingStreams).To(Equal(1234))
 				Expect(c.MaxIncomingUniStreams).To(Equal(4321))
+				Expect(c.CongestionWindowDecay).To(Equal(CongestionWindowDecayReset))
+				Expect(c.CongestionControl).To(Equal(CongestionControlBBRv2))
+				Expect(c.UnknownFrames).To(Equal(UnknownFramesIgnore))
+				Expect(c.HandshakeRetransmissionTimeout).To(Equal(3 * time.Second))
+				Expect(c.HandshakeRetransmissionBackoff).To(Equal(1.5))
+				Expect(c.MaxHandshakeRetransmissions).To(Equal(7))
+				Expect(c.PathValidationTimeout).To(Equal(5 * time.Second))
+				Expect(c.MaxPathValidationProbes).To(Equal(5))
+				Expect(c.ConnectionIDLength).To(Equal(12))
+				Expect(c.ConnectionIDCount).To(Equal(4))
+				Expect(c.KeepAlivePeriod).To(Equal(15 * time.Second))
+				Expect(c.SendCoalescingDelay).To(Equal(200 * time.Microsecond))
+				Expect(c.Features).To(Equal([]Feature{FeatureAckFrequency}))
+				Expect(c.EnableECN).To(BeTrue())
+				Expect(c.DSCP).To(BeEquivalentTo(46))
+				Expect(c.TTL).To(BeEquivalentTo(64))
+				Expect(c.AckPolicy).To(Equal(AckPolicy{PacketThreshold: 4}))
+				Expect(c.PeerAckPolicy).To(Equal(&AckPolicy{PacketThreshold: 10}))
+				Expect(c.ResumeCongestionState).To(Equal(&CongestionState{CongestionWindow: 100000}))
+				Expect(c.StreamCoalescing).To(Equal(StreamCoalescingNone))
+				Expect(c.Padding).To(Equal(PaddingAll))
+			})
+
+			It("limits the send coalescing delay", func() {
+				c := populateClientConfig(&Config{SendCoalescingDelay: time.Second})
+				Expect(c.SendCoalescingDelay).To(Equal(protocol.MaxSendCoalescingDelay))
+			})
+
+			It("errors when the Config contains an invalid connection ID length", func() {
+				_, err := Dial(nil, nil, "localhost:1234", &tls.Config{}, &Config{ConnectionIDLength: 19})
+				Expect(err).To(MatchError("invalid connection ID length: 19 bytes"))
+			})
+
+			It("errors when the Config contains an invalid DSCP", func() {
+				_, err := Dial(nil, nil, "localhost:1234", &tls.Config{}, &Config{DSCP: 64})
+				Expect(err).To(MatchError("invalid DSCP: 64"))
 			})
 
 			It("errors when the Config contains an invalid version", func() {
@@ -221,6 +412,137 @@ var _ = Describe("Client", func() {
 				Expect(err).To(MatchError("0x1234 is not a valid QUIC version"))
 			})
 
+			It("sets the initial flow control windows", func() {
+				c := populateClientConfig(&Config{
+					InitialReceiveStreamFlowControlWindow:     1000,
+					InitialReceiveConnectionFlowControlWindow: 2000,
+				})
+				Expect(c.InitialReceiveStreamFlowControlWindow).To(BeEquivalentTo(1000))
+				Expect(c.InitialReceiveConnectionFlowControlWindow).To(BeEquivalentTo(2000))
+				c = populateClientConfig(&Config{})
+				Expect(c.InitialReceiveStreamFlowControlWindow).To(BeEquivalentTo(protocol.ReceiveStreamFlowControlWindow))
+				Expect(c.InitialReceiveConnectionFlowControlWindow).To(BeEquivalentTo(protocol.ReceiveConnectionFlowControlWindow))
+				Expect(c.MaxReceiveStreamFlowControlWindow).To(BeEquivalentTo(protocol.DefaultMaxReceiveStreamFlowControlWindowClient))
+				Expect(c.MaxReceiveConnectionFlowControlWindow).To(BeEquivalentTo(protocol.DefaultMaxReceiveConnectionFlowControlWindowClient))
+			})
+
+			It("limits the initial flow control windows to the maximum flow control windows", func() {
+				c := populateClientConfig(&Config{
+					InitialReceiveStreamFlowControlWindow:     1000,
+					MaxReceiveStreamFlowControlWindow:         500,
+					InitialReceiveConnectionFlowControlWindow: 2000,
+					MaxReceiveConnectionFlowControlWindow:     1500,
+				})
+				Expect(c.InitialReceiveStreamFlowControlWindow).To(BeEquivalentTo(500))
+				Expect(c.InitialReceiveConnectionFlowControlWindow).To(BeEquivalentTo(1500))
+			})
+
+			It("uses the default handshake retransmission backoff", func() {
+				c := populateClientConfig(&Config{})
+				Expect(c.HandshakeRetransmissionBackoff).To(BeEquivalentTo(protocol.DefaultHandshakeRetransmissionBackoff))
+				c = populateClientConfig(&Config{HandshakeRetransmissionBackoff: 0.5})
+				Expect(c.HandshakeRetransmissionBackoff).To(BeEquivalentTo(protocol.DefaultHandshakeRetransmissionBackoff))
+			})
+
+			It("uses the flow control windows as the default reassembly buffer sizes", func() {
+				c := populateClientConfig(&Config{
+					MaxReceiveStreamFlowControlWindow:     1000,
+					MaxReceiveConnectionFlowControlWindow: 2000,
+				})
+				Expect(c.MaxStreamReassemblyBuffer).To(BeEquivalentTo(1000))
+				Expect(c.MaxConnectionReassemblyBuffer).To(BeEquivalentTo(2000))
+				c = populateClientConfig(&Config{
+					MaxStreamReassemblyBuffer:     100,
+					MaxConnectionReassemblyBuffer: 200,
+				})
+				Expect(c.MaxStreamReassemblyBuffer).To(BeEquivalentTo(100))
+				Expect(c.MaxConnectionReassemblyBuffer).To(BeEquivalentTo(200))
+			})
+
+			It("sets the limits for undecryptable packets", func() {
+				c := populateClientConfig(&Config{})
+				Expect(c.MaxUndecryptablePackets).To(Equal(protocol.DefaultMaxUndecryptablePackets))
+				Expect(c.MaxUndecryptablePacketBytes).To(BeEquivalentTo(protocol.DefaultMaxUndecryptablePackets * protocol.MaxReceivePacketSize))
+				c = populateClientConfig(&Config{MaxUndecryptablePackets: -1})
+				Expect(c.MaxUndecryptablePackets).To(Equal(protocol.DefaultMaxUndecryptablePackets))
+				c = populateClientConfig(&Config{MaxUndecryptablePackets: 5})
+				Expect(c.MaxUndecryptablePackets).To(Equal(5))
+				Expect(c.MaxUndecryptablePacketBytes).To(BeEquivalentTo(5 * protocol.MaxReceivePacketSize))
+				c = populateClientConfig(&Config{
+					MaxUndecryptablePackets:     5,
+					MaxUndecryptablePacketBytes: 3000,
+				})
+				Expect(c.MaxUndecryptablePackets).To(Equal(5))
+				Expect(c.MaxUndecryptablePacketBytes).To(BeEquivalentTo(3000))
+			})
+
+			It("sets the number of retries for transient write errors", func() {
+				Expect(populateClientConfig(&Config{}).MaxTransientWriteErrors).To(Equal(protocol.DefaultMaxTransientWriteErrors))
+				Expect(populateClientConfig(&Config{MaxTransientWriteErrors: 3}).MaxTransientWriteErrors).To(Equal(3))
+				Expect(populateClientConfig(&Config{MaxTransientWriteErrors: -1}).MaxTransientWriteErrors).To(BeZero())
+			})
+
+			It("sets the maximum reason phrase length", func() {
+				Expect(populateClientConfig(&Config{}).MaxReasonPhraseLength).To(Equal(protocol.DefaultMaxReasonPhraseLength))
+				Expect(populateClientConfig(&Config{MaxReasonPhraseLength: 10}).MaxReasonPhraseLength).To(Equal(10))
+			})
+
+			It("copies the OnClose callback", func() {
+				var called bool
+				c := populateClientConfig(&Config{OnClose: func(Session, error, *DiagnosticSnapshot) { called = true }})
+				c.OnClose(nil, nil, nil)
+				Expect(called).To(BeTrue())
+			})
+
+			It("copies the OnStreamCompleted callback", func() {
+				var called bool
+				c := populateClientConfig(&Config{OnStreamCompleted: func(Session, StreamRecord) { called = true }})
+				c.OnStreamCompleted(nil, StreamRecord{})
+				Expect(called).To(BeTrue())
+			})
+
+			It("copies the OnInvariantViolation callback", func() {
+				var called bool
+				c := populateClientConfig(&Config{OnInvariantViolation: func(Session, InvariantViolation) { called = true }})
+				c.OnInvariantViolation(nil, InvariantViolation{})
+				Expect(called).To(BeTrue())
+			})
+
+			It("copies the LimitReceiveWindowGrowth callback", func() {
+				c := populateClientConfig(&Config{LimitReceiveWindowGrowth: func(Session) bool { return true }})
+				Expect(c.LimitReceiveWindowGrowth(nil)).To(BeTrue())
+			})
+
+			It("copies the OnSocketBufferWarning callback", func() {
+				var warning SocketBufferWarning
+				c := populateClientConfig(&Config{OnSocketBufferWarning: func(w SocketBufferWarning) { warning = w }})
+				c.OnSocketBufferWarning(SocketBufferWarning{Requested: 1234})
+				Expect(warning.Requested).To(Equal(1234))
+			})
+
+			It("disables Path MTU Discovery", func() {
+				Expect(populateClientConfig(&Config{}).DisablePathMTUDiscovery).To(BeFalse())
+				Expect(populateClientConfig(&Config{DisablePathMTUDiscovery: true}).DisablePathMTUDiscovery).To(BeTrue())
+			})
+
+			It("sets the packet sizes", func() {
+				c := populateClientConfig(&Config{InitialPacketSize: 1300, MaxPacketSize: 1400})
+				Expect(c.InitialPacketSize).To(Equal(uint16(1300)))
+				Expect(c.MaxPacketSize).To(Equal(uint16(1400)))
+			})
+
+			It("uses the default packet sizes", func() {
+				c := populateClientConfig(&Config{})
+				Expect(c.InitialPacketSize).To(BeZero())
+				Expect(c.MaxPacketSize).To(BeEquivalentTo(protocol.MaxReceivePacketSize))
+			})
+
+			It("doesn't change the socket buffers if the sizes are negative", func() {
+				c := populateClientConfig(&Config{ReceiveBufferSize: -1, SendBufferSize: 4321})
+				Expect(c.ReceiveBufferSize).To(Equal(-1))
+				Expect(c.SendBufferSize).To(Equal(4321))
+			})
+
 			It("disables bidirectional streams", func() {
 				config := &Config{
 					MaxIncomingStreams:    -1,
@@ -246,7 +568,13 @@ var _ = Describe("Client", func() {
 				Expect(c.Versions).To(Equal(protocol.SupportedVersions))
 				Expect(c.HandshakeTimeout).To(Equal(protocol.DefaultHandshakeTimeout))
 				Expect(c.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
+				Expect(c.PathValidationTimeout).To(Equal(protocol.DefaultPathValidationTimeout))
+				Expect(c.MaxPathValidationProbes).To(Equal(protocol.DefaultMaxPathValidationProbes))
+				Expect(c.ConnectionIDLength).To(Equal(protocol.ConnectionIDLen))
+				Expect(c.ConnectionIDCount).To(Equal(1))
 				Expect(c.RequestConnectionIDOmission).To(BeFalse())
+				Expect(c.ReceiveBufferSize).To(Equal(protocol.DefaultSocketBufferSize))
+				Expect(c.SendBufferSize).To(Equal(protocol.DefaultSocketBufferSize))
 			})
 		})
 
@@ -301,6 +629,7 @@ var _ = Describe("Client", func() {
 					// TODO: check connection IDs?
 					sess := NewMockPacketHandler(mockCtrl)
 					sess.EXPECT().run()
+					sess.EXPECT().ConnectionState()
 					return sess, nil
 				}
 				_, err := Dial(packetConn, addr, "quic.clemente.io:1337", nil, config)
@@ -361,7 +690,7 @@ var _ = Describe("Client", func() {
 				b := &bytes.Buffer{}
 				err := ph.Write(b, protocol.PerspectiveServer, protocol.VersionWhatever)
 				Expect(err).ToNot(HaveOccurred())
-				err = cl.handlePacket(nil, b.Bytes())
+				err = cl.handlePacket(nil, b.Bytes(), nil, packetInfo{})
 				Expect(err).ToNot(HaveOccurred())
 				Expect(cl.versionNegotiated).To(BeTrue())
 			})
@@ -398,12 +727,12 @@ var _ = Describe("Client", func() {
 				dialed := make(chan struct{})
 				go func() {
 					defer GinkgoRecover()
-					err := cl.dial()
+					err := cl.dial(context.Background())
 					Expect(err).ToNot(HaveOccurred())
 					close(dialed)
 				}()
 				Eventually(sessionChan).Should(HaveLen(1))
-				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{version2}))
+				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{version2}), nil, packetInfo{})
 				Expect(err).ToNot(HaveOccurred())
 				Eventually(sessionChan).Should(BeEmpty())
 			})
@@ -442,15 +771,15 @@ var _ = Describe("Client", func() {
 				dialed := make(chan struct{})
 				go func() {
 					defer GinkgoRecover()
-					err := cl.dial()
+					err := cl.dial(context.Background())
 					Expect(err).ToNot(HaveOccurred())
 					close(dialed)
 				}()
 				Eventually(sessionChan).Should(HaveLen(1))
-				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{version2}))
+				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{version2}), nil, packetInfo{})
 				Expect(err).ToNot(HaveOccurred())
 				Eventually(sessionChan).Should(BeEmpty())
-				err = cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{version3}))
+				err = cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{version3}), nil, packetInfo{})
 				Expect(err).To(MatchError("received a delayed Version Negotiation Packet"))
 				Eventually(dialed).Should(BeClosed())
 			})
@@ -460,7 +789,7 @@ var _ = Describe("Client", func() {
 				sess.EXPECT().Close(gomock.Any())
 				cl.session = sess
 				cl.config = &Config{Versions: protocol.SupportedVersions}
-				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{1}))
+				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{1}), nil, packetInfo{})
 				Expect(err).ToNot(HaveOccurred())
 			})
 
@@ -471,7 +800,7 @@ var _ = Describe("Client", func() {
 				v := protocol.VersionNumber(1234)
 				Expect(v).ToNot(Equal(cl.version))
 				cl.config = &Config{Versions: protocol.SupportedVersions}
-				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{v}))
+				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{v}), nil, packetInfo{})
 				Expect(err).ToNot(HaveOccurred())
 			})
 
@@ -481,14 +810,14 @@ var _ = Describe("Client", func() {
 				cl.session = sess
 				config := &Config{Versions: []protocol.VersionNumber{1234, 4321}}
 				cl.config = config
-				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{4321, 1234}))
+				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{4321, 1234}), nil, packetInfo{})
 				Expect(err).ToNot(HaveOccurred())
 				Expect(cl.version).To(Equal(protocol.VersionNumber(1234)))
 			})
 
 			It("drops version negotiation packets that contain the offered version", func() {
 				ver := cl.version
-				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{ver}))
+				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{ver}), nil, packetInfo{})
 				Expect(err).ToNot(HaveOccurred())
 				Expect(cl.version).To(Equal(ver))
 			})
@@ -497,11 +826,19 @@ var _ = Describe("Client", func() {
 
 	It("ignores packets with an invalid public header", func() {
 		cl.session = NewMockPacketHandler(mockCtrl) // don't EXPECT any handlePacket calls
-		err := cl.handlePacket(addr, []byte("invalid packet"))
+		err := cl.handlePacket(addr, []byte("invalid packet"), nil, packetInfo{})
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring("error parsing packet from"))
 	})
 
+	It("returns the buffer of packets that are dropped", func() {
+		cl.session = NewMockPacketHandler(mockCtrl) // don't EXPECT any handlePacket calls
+		buf := getPacketBuffer()
+		*buf = append(*buf, []byte("invalid packet")...)
+		Expect(cl.handlePacket(addr, *buf, buf, packetInfo{})).ToNot(Succeed())
+		Expect(*buf).To(BeEmpty())
+	})
+
 	It("errors on packets that are smaller than the Payload Length in the packet header", func() {
 		cl.session = NewMockPacketHandler(mockCtrl) // don't EXPECT any handlePacket calls
 		b := &bytes.Buffer{}
@@ -514,7 +851,7 @@ var _ = Describe("Client", func() {
 			Version:          versionIETFFrames,
 		}
 		Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
-		cl.handlePacket(addr, append(b.Bytes(), make([]byte, 456)...))
+		cl.handlePacket(addr, append(b.Bytes(), make([]byte, 456)...), nil, packetInfo{})
 	})
 
 	It("cuts packets at the payload length", func() {
@@ -533,10 +870,32 @@ var _ = Describe("Client", func() {
 			Version:          versionIETFFrames,
 		}
 		Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
-		err := cl.handlePacket(addr, append(b.Bytes(), make([]byte, 456)...))
+		err := cl.handlePacket(addr, append(b.Bytes(), make([]byte, 456)...), nil, packetInfo{})
 		Expect(err).ToNot(HaveOccurred())
 	})
 
+	It("passes the buffer of the packet to the session", func() {
+		buf := getPacketBuffer()
+		sess := NewMockPacketHandler(mockCtrl)
+		sess.EXPECT().handlePacket(gomock.Any()).Do(func(packet *receivedPacket) {
+			Expect(packet.buffer).To(Equal(buf))
+		})
+		cl.session = sess
+		b := &bytes.Buffer{}
+		hdr := &wire.Header{
+			IsLongHeader:     true,
+			Type:             protocol.PacketTypeHandshake,
+			PayloadLen:       123,
+			SrcConnectionID:  connID,
+			DestConnectionID: connID,
+			Version:          versionIETFFrames,
+		}
+		Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
+		*buf = append(append(*buf, b.Bytes()...), make([]byte, 123)...)
+		Expect(cl.handlePacket(addr, *buf, buf, packetInfo{})).To(Succeed())
+		Expect(*buf).ToNot(BeEmpty())
+	})
+
 	It("ignores packets with the wrong Long Header Type", func() {
 		b := &bytes.Buffer{}
 		hdr := &wire.Header{
@@ -548,7 +907,7 @@ var _ = Describe("Client", func() {
 			Version:          versionIETFFrames,
 		}
 		Expect(hdr.Write(b, protocol.PerspectiveServer, versionIETFFrames)).To(Succeed())
-		err := cl.handlePacket(addr, append(b.Bytes(), make([]byte, 456)...))
+		err := cl.handlePacket(addr, append(b.Bytes(), make([]byte, 456)...), nil, packetInfo{})
 		Expect(err).To(MatchError("Received unsupported packet type: Initial"))
 	})
 
@@ -564,7 +923,7 @@ var _ = Describe("Client", func() {
 			PacketNumberLen:  1,
 		}).Write(buf, protocol.PerspectiveServer, versionGQUICFrames)
 		Expect(err).ToNot(HaveOccurred())
-		err = cl.handlePacket(addr, buf.Bytes())
+		err = cl.handlePacket(addr, buf.Bytes(), nil, packetInfo{})
 		Expect(err).To(MatchError("received packet with truncated connection ID, but didn't request truncation"))
 	})
 
@@ -583,10 +942,65 @@ var _ = Describe("Client", func() {
 			Version:          versionIETFFrames,
 		}).Write(buf, protocol.PerspectiveServer, versionIETFFrames)
 		Expect(err).ToNot(HaveOccurred())
-		err = cl.handlePacket(addr, buf.Bytes())
+		err = cl.handlePacket(addr, buf.Bytes(), nil, packetInfo{})
 		Expect(err).To(MatchError(fmt.Sprintf("received a packet with an unexpected connection ID (0x0807060504030201, expected %s)", connID)))
 	})
 
+	It("accepts packets for connection IDs issued by the session", func() {
+		sess := NewMockPacketHandler(mockCtrl)
+		cl.session = sess
+		cl.version = versionIETFFrames
+		cl.config = &Config{}
+		connID2 := protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}
+		cl.addConnectionID(connID2)
+		buf := &bytes.Buffer{}
+		err := (&wire.Header{
+			DestConnectionID: connID2,
+			SrcConnectionID:  connID,
+			PacketNumber:     1,
+			PacketNumberLen:  1,
+			Version:          versionIETFFrames,
+		}).Write(buf, protocol.PerspectiveServer, versionIETFFrames)
+		Expect(err).ToNot(HaveOccurred())
+		sess.EXPECT().handlePacket(gomock.Any())
+		Expect(cl.handlePacket(addr, buf.Bytes(), nil, packetInfo{})).To(Succeed())
+		// after the connection ID was retired, packets are rejected
+		cl.removeConnectionID(connID2)
+		Expect(cl.handlePacket(addr, buf.Bytes(), nil, packetInfo{})).To(MatchError(fmt.Sprintf("received a packet with an unexpected connection ID (0x0807060504030201, expected %s)", connID)))
+	})
+
+	It("closes the session when receiving a stateless reset", func() {
+		sess := NewMockPacketHandler(mockCtrl)
+		cl.session = sess
+		cl.version = versionIETFFrames
+		cl.config = &Config{}
+		token := [16]byte{0xde, 0xca, 0xfb, 0xad}
+		cl.addResetToken(token)
+		data, err := wire.ComposeStatelessReset(token)
+		Expect(err).ToNot(HaveOccurred())
+		sess.EXPECT().closeRemote(ErrStatelessReset)
+		Expect(cl.handlePacket(addr, data, nil, packetInfo{})).To(Succeed())
+	})
+
+	It("doesn't treat packets with an unknown stateless reset token as a stateless reset", func() {
+		cl.session = NewMockPacketHandler(mockCtrl) // don't EXPECT any calls
+		cl.version = versionIETFFrames
+		cl.config = &Config{}
+		cl.addResetToken([16]byte{0xde, 0xca, 0xfb, 0xad})
+		cl.removeResetToken([16]byte{0xde, 0xca, 0xfb, 0xad})
+		data, err := wire.ComposeStatelessReset([16]byte{0xde, 0xca, 0xfb, 0xad})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cl.handlePacket(addr, data, nil, packetInfo{})).To(MatchError(ContainSubstring("received a packet with an unexpected connection ID")))
+	})
+
+	It("registers stateless reset tokens with the Transport", func() {
+		cl.transport = &Transport{resetTokens: make(map[[16]byte]packetReceiver)}
+		cl.addResetToken([16]byte{0xde, 0xca, 0xfb, 0xad})
+		Expect(cl.transport.resetTokens).To(HaveKeyWithValue([16]byte{0xde, 0xca, 0xfb, 0xad}, cl))
+		cl.removeResetToken([16]byte{0xde, 0xca, 0xfb, 0xad})
+		Expect(cl.transport.resetTokens).To(BeEmpty())
+	})
+
 	It("creates new gQUIC sessions with the right parameters", func() {
 		config := &Config{Versions: protocol.SupportedVersions}
 		c := make(chan struct{})
@@ -613,6 +1027,7 @@ var _ = Describe("Client", func() {
 			close(c)
 			sess := NewMockPacketHandler(mockCtrl)
 			sess.EXPECT().run()
+			sess.EXPECT().ConnectionState()
 			return sess, nil
 		}
 		_, err := Dial(packetConn, addr, "quic.clemente.io:1337", nil, config)
@@ -631,6 +1046,7 @@ var _ = Describe("Client", func() {
 		sess1.EXPECT().run().Return(handshake.ErrCloseSessionForRetry)
 		sess2 := NewMockPacketHandler(mockCtrl)
 		sess2.EXPECT().run()
+		sess2.EXPECT().ConnectionState()
 		sessions := []*MockPacketHandler{sess1, sess2}
 		newTLSClientSession = func(
 			connP connection,
@@ -702,21 +1118,21 @@ var _ = Describe("Client", func() {
 				Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.PublicReset))
 			})
 			cl.session = sess
-			err := cl.handlePacket(addr, wire.WritePublicReset(cl.destConnID, 1, 0))
+			err := cl.handlePacket(addr, wire.WritePublicReset(cl.destConnID, 1, 0), nil, packetInfo{})
 			Expect(err).ToNot(HaveOccurred())
 		})
 
 		It("ignores Public Resets from the wrong remote address", func() {
 			cl.session = NewMockPacketHandler(mockCtrl) // don't EXPECT any calls
 			spoofedAddr := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 5678}
-			err := cl.handlePacket(spoofedAddr, wire.WritePublicReset(cl.destConnID, 1, 0))
+			err := cl.handlePacket(spoofedAddr, wire.WritePublicReset(cl.destConnID, 1, 0), nil, packetInfo{})
 			Expect(err).To(MatchError("Received a spoofed Public Reset"))
 		})
 
 		It("ignores unparseable Public Resets", func() {
 			cl.session = NewMockPacketHandler(mockCtrl) // don't EXPECT any calls
 			pr := wire.WritePublicReset(cl.destConnID, 1, 0)
-			err := cl.handlePacket(addr, pr[:len(pr)-5])
+			err := cl.handlePacket(addr, pr[:len(pr)-5], nil, packetInfo{})
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("Received a Public Reset. An error occurred parsing the packet"))
 		})
@@ -0,0 +1,64 @@
+package quic
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// A CongestionState is the validated congestion control state of a session.
+// It is saved when the session is closed (see Session.CongestionState), and allows a new session
+// to the same peer to skip slow start, using the Careful Resume algorithm (see Config.ResumeCongestionState).
+// Warning: This API should not be considered stable and might change soon.
+type CongestionState struct {
+	// RemoteAddr is the address of the peer.
+	RemoteAddr string
+	// Time is the time when the state was saved.
+	Time time.Time
+	// CongestionWindow is the congestion window, in bytes.
+	CongestionWindow uint64
+	// RTT is the minimum RTT measured on the session.
+	RTT time.Duration
+}
+
+// saveCongestionState saves the congestion state when the session is closed.
+// The sentPacketHandler is not safe for concurrent use, so this has to be called from the run loop.
+func (s *session) saveCongestionState() {
+	state, ok := s.sentPacketHandler.GetResumeState()
+	if !ok {
+		return
+	}
+	s.statsMutex.Lock()
+	s.congestionState = &CongestionState{
+		RemoteAddr:       s.conn.RemoteAddr().String(),
+		Time:             time.Now(),
+		CongestionWindow: uint64(state.CongestionWindow),
+		RTT:              state.RTT,
+	}
+	s.statsMutex.Unlock()
+}
+
+func (s *session) CongestionState() *CongestionState {
+	s.statsMutex.Lock()
+	defer s.statsMutex.Unlock()
+	return s.congestionState
+}
+
+// resumeCongestionState passes a saved congestion state to the congestion controller,
+// if it was saved for the same peer, and if it is not too old.
+func (s *session) resumeCongestionState(state *CongestionState) {
+	if state.RemoteAddr != s.conn.RemoteAddr().String() {
+		s.logger.Debugf("Not resuming congestion state saved for a different peer (%s).", state.RemoteAddr)
+		return
+	}
+	if age := time.Since(state.Time); age < 0 || age > protocol.MaxCongestionStateAge {
+		s.logger.Debugf("Not resuming congestion state saved at %s.", state.Time)
+		return
+	}
+	s.logger.Debugf("Resuming congestion state: congestion window %d, RTT %s", state.CongestionWindow, state.RTT)
+	s.sentPacketHandler.ResumeCongestionState(congestion.ResumeState{
+		CongestionWindow: protocol.ByteCount(state.CongestionWindow),
+		RTT:              state.RTT,
+	})
+}
@@ -3,15 +3,41 @@ package quic
 import (
 	"net"
 	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
 )
 
 type connection interface {
 	Write([]byte) error
-	Read([]byte) (int, net.Addr, error)
+	WriteTo([]byte, net.Addr) error
+	Read([]byte) (int, net.Addr, packetInfo, error)
 	Close() error
 	LocalAddr() net.Addr
 	RemoteAddr() net.Addr
 	SetCurrentRemoteAddr(net.Addr)
+	SetPacketConn(net.PacketConn)
+	// EnableECN enables reading the ECN codepoint of received packets.
+	// It returns false if the connection doesn't support ECN.
+	EnableECN() bool
+	// SetECN sets the ECN codepoint that packets are marked with.
+	SetECN(protocol.ECN)
+	// SetDSCP sets the DSCP that packets are marked with.
+	SetDSCP(uint8)
+	// SetTTL sets the TTL / hop limit of packets. 0 means that the default of the socket is used.
+	SetTTL(uint8)
+	// SupportsBatching says if the connection can send multiple packets in a single system call, see WriteSegments.
+	SupportsBatching() bool
+	// WriteSegments writes multiple packets to the current remote address.
+	// All packets have the size segmentSize, except for the last one, which may be smaller.
+	// It returns the number of packets that were written. If an error is returned, the remaining packets were not written.
+	WriteSegments(b []byte, segmentSize int) (int, error)
+	// EnableMTUDiscovery sets the Don't Fragment bit on outgoing packets, which is required for discovering the path MTU.
+	// It returns false if this is not supported.
+	EnableMTUDiscovery() bool
+	// SocketBufferSizes returns the sizes of the receive and the send buffer of the socket.
+	// They are 0 if the sizes can't be determined.
+	SocketBufferSizes() (receive, send int)
 }
 
 type conn struct {
@@ -19,17 +45,50 @@ type conn struct {
 
 	pconn       net.PacketConn
 	currentAddr net.Addr
+	// info is used for sending packets: it contains the ECN codepoint, the DSCP, the TTL,
+	// and the local address that packets are sent from (for sockets bound to the unspecified address)
+	info packetInfo
 }
 
 var _ connection = &conn{}
 
 func (c *conn) Write(p []byte) error {
-	_, err := c.pconn.WriteTo(p, c.currentAddr)
-	return err
+	c.mutex.RLock()
+	pconn := c.pconn
+	addr := c.currentAddr
+	info := c.info
+	c.mutex.RUnlock()
+	return writePacket(pconn, p, addr, info)
+}
+
+func (c *conn) WriteSegments(b []byte, segmentSize int) (int, error) {
+	c.mutex.RLock()
+	pconn := c.pconn
+	addr := c.currentAddr
+	info := c.info
+	c.mutex.RUnlock()
+	return writeSegments(pconn, b, segmentSize, addr, info)
+}
+
+// WriteTo writes a packet to addr, without changing the current remote address.
+func (c *conn) WriteTo(p []byte, addr net.Addr) error {
+	c.mutex.RLock()
+	pconn := c.pconn
+	info := c.info
+	c.mutex.RUnlock()
+	return writePacket(pconn, p, addr, info)
 }
 
-func (c *conn) Read(p []byte) (int, net.Addr, error) {
-	return c.pconn.ReadFrom(p)
+func (c *conn) Read(p []byte) (int, net.Addr, packetInfo, error) {
+	for {
+		pconn := c.getPacketConn()
+		n, addr, info, err := readPacket(pconn, p)
+		// If we switched to a new net.PacketConn, reading from the old one was interrupted.
+		if err != nil && c.getPacketConn() != pconn {
+			continue
+		}
+		return n, addr, info, err
+	}
 }
 
 func (c *conn) SetCurrentRemoteAddr(addr net.Addr) {
@@ -38,8 +97,62 @@ func (c *conn) SetCurrentRemoteAddr(addr net.Addr) {
 	c.mutex.Unlock()
 }
 
+// SetPacketConn switches to a new net.PacketConn.
+// A Read call that is blocked on the old net.PacketConn continues reading from the new one.
+func (c *conn) SetPacketConn(pconn net.PacketConn) {
+	c.mutex.Lock()
+	oldPconn := c.pconn
+	c.pconn = pconn
+	// the local address belongs to the old net.PacketConn
+	c.info.localAddr = nil
+	c.info.ifIndex = 0
+	c.mutex.Unlock()
+	// unblock Read
+	oldPconn.SetReadDeadline(time.Now())
+}
+
+func (c *conn) EnableECN() bool {
+	return enableECN(c.getPacketConn())
+}
+
+func (c *conn) SupportsBatching() bool {
+	return supportsBatching(c.getPacketConn())
+}
+
+func (c *conn) EnableMTUDiscovery() bool {
+	return enableMTUDiscovery(c.getPacketConn())
+}
+
+func (c *conn) SocketBufferSizes() (int, int) {
+	return socketBufferSizes(c.getPacketConn())
+}
+
+func (c *conn) SetECN(ecn protocol.ECN) {
+	c.mutex.Lock()
+	c.info.ecn = ecn
+	c.mutex.Unlock()
+}
+
+func (c *conn) SetDSCP(dscp uint8) {
+	c.mutex.Lock()
+	c.info.dscp = dscp
+	c.mutex.Unlock()
+}
+
+func (c *conn) SetTTL(ttl uint8) {
+	c.mutex.Lock()
+	c.info.ttl = ttl
+	c.mutex.Unlock()
+}
+
+func (c *conn) getPacketConn() net.PacketConn {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.pconn
+}
+
 func (c *conn) LocalAddr() net.Addr {
-	return c.pconn.LocalAddr()
+	return c.getPacketConn().LocalAddr()
 }
 
 func (c *conn) RemoteAddr() net.Addr {
@@ -50,5 +163,5 @@ func (c *conn) RemoteAddr() net.Addr {
 }
 
 func (c *conn) Close() error {
-	return c.pconn.Close()
+	return c.getPacketConn().Close()
 }
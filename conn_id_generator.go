@@ -0,0 +1,97 @@
+package quic
+
+import (
+	"fmt"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+	"github.com/lucas-clemente/quic-go/qerr"
+)
+
+// The connIDGenerator issues connection IDs to the peer (using NEW_CONNECTION_ID frames),
+// and replaces the connection IDs that the peer retires.
+// Only used for IETF QUIC.
+type connIDGenerator struct {
+	connIDLen   int
+	connIDCount int
+
+	highestSeq       uint64
+	activeSrcConnIDs map[uint64]protocol.ConnectionID
+
+	addConnectionID        func(protocol.ConnectionID)
+	removeConnectionID     func(protocol.ConnectionID)
+	getStatelessResetToken func(protocol.ConnectionID) [16]byte
+	queueControlFrame      func(wire.Frame)
+}
+
+func newConnIDGenerator(
+	initialConnID protocol.ConnectionID,
+	connIDLen int,
+	connIDCount int,
+	addConnectionID func(protocol.ConnectionID),
+	removeConnectionID func(protocol.ConnectionID),
+	getStatelessResetToken func(protocol.ConnectionID) [16]byte,
+	queueControlFrame func(wire.Frame),
+) *connIDGenerator {
+	return &connIDGenerator{
+		connIDLen:              connIDLen,
+		connIDCount:            connIDCount,
+		activeSrcConnIDs:       map[uint64]protocol.ConnectionID{0: initialConnID},
+		addConnectionID:        addConnectionID,
+		removeConnectionID:     removeConnectionID,
+		getStatelessResetToken: getStatelessResetToken,
+		queueControlFrame:      queueControlFrame,
+	}
+}
+
+// SetHandshakeComplete issues the additional connection IDs.
+// They are only issued after completion of the handshake,
+// since NEW_CONNECTION_ID frames must be sent in forward-secure packets.
+func (g *connIDGenerator) SetHandshakeComplete() error {
+	for i := 1; i < g.connIDCount; i++ {
+		if err := g.issueNewConnID(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Retire retires a connection ID, and issues a new connection ID to replace it.
+func (g *connIDGenerator) Retire(seq uint64) error {
+	if seq > g.highestSeq {
+		return qerr.Error(qerr.InvalidFrameData, fmt.Sprintf("tried to retire connection ID %d, but the highest connection ID issued is %d", seq, g.highestSeq))
+	}
+	connID, ok := g.activeSrcConnIDs[seq]
+	// The connection ID might already have been retired, if the RETIRE_CONNECTION_ID frame was retransmitted.
+	if !ok {
+		return nil
+	}
+	g.removeConnectionID(connID)
+	delete(g.activeSrcConnIDs, seq)
+	return g.issueNewConnID()
+}
+
+func (g *connIDGenerator) issueNewConnID() error {
+	connID, err := protocol.GenerateConnectionID(g.connIDLen)
+	if err != nil {
+		return err
+	}
+	frame := &wire.NewConnectionIDFrame{
+		ConnectionID:        connID,
+		StatelessResetToken: g.getStatelessResetToken(connID),
+	}
+	g.highestSeq++
+	frame.SequenceNumber = g.highestSeq
+	g.activeSrcConnIDs[g.highestSeq] = connID
+	g.addConnectionID(connID)
+	g.queueControlFrame(frame)
+	return nil
+}
+
+// RemoveAll removes all active connection IDs.
+// It is called when the session is closed.
+func (g *connIDGenerator) RemoveAll() {
+	for _, connID := range g.activeSrcConnIDs {
+		g.removeConnectionID(connID)
+	}
+}
@@ -0,0 +1,96 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+	"github.com/lucas-clemente/quic-go/qerr"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connection ID Generator", func() {
+	var (
+		g              *connIDGenerator
+		initialConnID  protocol.ConnectionID
+		addedConnIDs   []protocol.ConnectionID
+		removedConnIDs []protocol.ConnectionID
+		queuedFrames   []wire.Frame
+	)
+
+	BeforeEach(func() {
+		initialConnID = protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+		addedConnIDs = nil
+		removedConnIDs = nil
+		queuedFrames = nil
+		g = newConnIDGenerator(
+			initialConnID,
+			6,
+			4,
+			func(c protocol.ConnectionID) { addedConnIDs = append(addedConnIDs, c) },
+			func(c protocol.ConnectionID) { removedConnIDs = append(removedConnIDs, c) },
+			func(c protocol.ConnectionID) [16]byte { return getStatelessResetToken([]byte("foobar"), c) },
+			func(f wire.Frame) { queuedFrames = append(queuedFrames, f) },
+		)
+	})
+
+	It("issues new connection IDs when the handshake completes", func() {
+		Expect(g.SetHandshakeComplete()).To(Succeed())
+		Expect(queuedFrames).To(HaveLen(3))
+		Expect(addedConnIDs).To(HaveLen(3))
+		for i, f := range queuedFrames {
+			Expect(f).To(BeAssignableToTypeOf(&wire.NewConnectionIDFrame{}))
+			frame := f.(*wire.NewConnectionIDFrame)
+			Expect(frame.SequenceNumber).To(BeEquivalentTo(i + 1))
+			Expect(frame.ConnectionID.Len()).To(Equal(6))
+			Expect(frame.ConnectionID).To(Equal(addedConnIDs[i]))
+			Expect(frame.StatelessResetToken).To(Equal(getStatelessResetToken([]byte("foobar"), frame.ConnectionID)))
+		}
+	})
+
+	It("doesn't issue any connection IDs if the count is 1", func() {
+		g.connIDCount = 1
+		Expect(g.SetHandshakeComplete()).To(Succeed())
+		Expect(queuedFrames).To(BeEmpty())
+		Expect(addedConnIDs).To(BeEmpty())
+	})
+
+	It("replaces retired connection IDs", func() {
+		Expect(g.SetHandshakeComplete()).To(Succeed())
+		queuedFrames = nil
+		Expect(g.Retire(0)).To(Succeed())
+		Expect(removedConnIDs).To(Equal([]protocol.ConnectionID{initialConnID}))
+		Expect(queuedFrames).To(HaveLen(1))
+		Expect(queuedFrames[0].(*wire.NewConnectionIDFrame).SequenceNumber).To(BeEquivalentTo(4))
+		Expect(addedConnIDs).To(HaveLen(4))
+	})
+
+	It("ignores connection IDs that were already retired", func() {
+		Expect(g.SetHandshakeComplete()).To(Succeed())
+		Expect(g.Retire(2)).To(Succeed())
+		Expect(removedConnIDs).To(HaveLen(1))
+		queuedFrames = nil
+		Expect(g.Retire(2)).To(Succeed())
+		Expect(removedConnIDs).To(HaveLen(1))
+		Expect(queuedFrames).To(BeEmpty())
+	})
+
+	It("errors when the peer retires a connection ID that wasn't issued yet", func() {
+		Expect(g.SetHandshakeComplete()).To(Succeed())
+		err := g.Retire(4)
+		Expect(err).To(MatchError("InvalidFrameData: tried to retire connection ID 4, but the highest connection ID issued is 3"))
+		Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.InvalidFrameData))
+	})
+
+	It("removes all active connection IDs", func() {
+		Expect(g.SetHandshakeComplete()).To(Succeed())
+		Expect(g.Retire(1)).To(Succeed())
+		g.RemoveAll()
+		// the connection ID with sequence number 1 was already removed when it was retired
+		Expect(removedConnIDs).To(HaveLen(1 + 4))
+		Expect(removedConnIDs).To(ContainElement(initialConnID))
+		for _, c := range addedConnIDs {
+			Expect(removedConnIDs).To(ContainElement(c))
+		}
+	})
+})
@@ -0,0 +1,105 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+// The connIDManager keeps track of the connection IDs that the peer issued (using NEW_CONNECTION_ID frames),
+// and switches to an unused connection ID when the session migrates to a new path.
+// Only used for IETF QUIC.
+type connIDManager struct {
+	// the sequence number of the connection ID currently used
+	// The connection ID used during the handshake has sequence number 0.
+	activeSeq uint64
+	// the stateless reset token of the connection ID currently used, if known
+	activeToken *[16]byte
+	// the unused connection IDs, sorted by sequence number
+	queue []*wire.NewConnectionIDFrame
+
+	changeDestConnID  func(protocol.ConnectionID)
+	addResetToken     func([16]byte)
+	removeResetToken  func([16]byte)
+	queueControlFrame func(wire.Frame)
+}
+
+func newConnIDManager(
+	changeDestConnID func(protocol.ConnectionID),
+	addResetToken func([16]byte),
+	removeResetToken func([16]byte),
+	queueControlFrame func(wire.Frame),
+) *connIDManager {
+	return &connIDManager{
+		changeDestConnID:  changeDestConnID,
+		addResetToken:     addResetToken,
+		removeResetToken:  removeResetToken,
+		queueControlFrame: queueControlFrame,
+	}
+}
+
+// SetStatelessResetToken sets the stateless reset token for the connection ID used during the handshake.
+// The server sends it in the transport parameters.
+func (m *connIDManager) SetStatelessResetToken(token [16]byte) {
+	// ignore the token if we already switched to another connection ID
+	if m.activeSeq != 0 || m.activeToken != nil {
+		return
+	}
+	m.setActiveToken(&token)
+}
+
+// Add adds a connection ID issued by the peer.
+func (m *connIDManager) Add(f *wire.NewConnectionIDFrame) {
+	// ignore retransmissions of connection IDs that are already used, or already were retired
+	if f.SequenceNumber <= m.activeSeq {
+		return
+	}
+	var i int
+	for ; i < len(m.queue); i++ {
+		if m.queue[i].SequenceNumber == f.SequenceNumber {
+			return
+		}
+		if m.queue[i].SequenceNumber > f.SequenceNumber {
+			break
+		}
+	}
+	// Don't keep track of too many connection IDs.
+	// Retire the connection ID right away, such that the peer can reuse the state associated with it.
+	if len(m.queue) >= protocol.MaxActiveConnectionIDs {
+		m.queueControlFrame(&wire.RetireConnectionIDFrame{SequenceNumber: f.SequenceNumber})
+		return
+	}
+	m.queue = append(m.queue, nil)
+	copy(m.queue[i+1:], m.queue[i:])
+	m.queue[i] = f
+}
+
+// Rotate switches to the next unused connection ID, and retires the connection ID that was used before.
+// It returns false if the peer didn't issue any unused connection IDs.
+func (m *connIDManager) Rotate() bool {
+	if len(m.queue) == 0 {
+		return false
+	}
+	next := m.queue[0]
+	m.queue = m.queue[1:]
+	m.queueControlFrame(&wire.RetireConnectionIDFrame{SequenceNumber: m.activeSeq})
+	m.activeSeq = next.SequenceNumber
+	m.setActiveToken(&next.StatelessResetToken)
+	m.changeDestConnID(next.ConnectionID)
+	return true
+}
+
+// Close removes the stateless reset token of the connection ID currently used.
+// It is called when the session is closed.
+func (m *connIDManager) Close() {
+	m.setActiveToken(nil)
+}
+
+func (m *connIDManager) setActiveToken(token *[16]byte) {
+	if m.activeToken != nil {
+		m.removeResetToken(*m.activeToken)
+	}
+	m.activeToken = token
+	if token != nil {
+		m.addResetToken(*token)
+	}
+}
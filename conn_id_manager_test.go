@@ -0,0 +1,110 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connection ID Manager", func() {
+	var (
+		m            *connIDManager
+		destConnID   protocol.ConnectionID
+		resetTokens  map[[16]byte]struct{}
+		queuedFrames []wire.Frame
+	)
+
+	BeforeEach(func() {
+		destConnID = nil
+		resetTokens = make(map[[16]byte]struct{})
+		queuedFrames = nil
+		m = newConnIDManager(
+			func(c protocol.ConnectionID) { destConnID = c },
+			func(t [16]byte) { resetTokens[t] = struct{}{} },
+			func(t [16]byte) { delete(resetTokens, t) },
+			func(f wire.Frame) { queuedFrames = append(queuedFrames, f) },
+		)
+	})
+
+	newFrame := func(seq uint64) *wire.NewConnectionIDFrame {
+		return &wire.NewConnectionIDFrame{
+			SequenceNumber:      seq,
+			ConnectionID:        protocol.ConnectionID{byte(seq), 2, 3, 4, 5, 6, 7, 8},
+			StatelessResetToken: [16]byte{byte(seq), 0xde, 0xad},
+		}
+	}
+
+	It("doesn't rotate if the peer didn't issue any connection IDs", func() {
+		Expect(m.Rotate()).To(BeFalse())
+		Expect(destConnID).To(BeNil())
+		Expect(queuedFrames).To(BeEmpty())
+	})
+
+	It("rotates to the next connection ID, and retires the old one", func() {
+		m.Add(newFrame(1))
+		m.Add(newFrame(2))
+		Expect(m.Rotate()).To(BeTrue())
+		Expect(destConnID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}))
+		Expect(queuedFrames).To(Equal([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 0}}))
+		queuedFrames = nil
+		Expect(m.Rotate()).To(BeTrue())
+		Expect(destConnID).To(Equal(protocol.ConnectionID{2, 2, 3, 4, 5, 6, 7, 8}))
+		Expect(queuedFrames).To(Equal([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 1}}))
+		Expect(m.Rotate()).To(BeFalse())
+	})
+
+	It("uses the connection IDs in order of their sequence numbers", func() {
+		m.Add(newFrame(3))
+		m.Add(newFrame(1))
+		m.Add(newFrame(2))
+		for i := 1; i <= 3; i++ {
+			Expect(m.Rotate()).To(BeTrue())
+			Expect(destConnID[0]).To(BeEquivalentTo(i))
+		}
+	})
+
+	It("ignores duplicate connection IDs", func() {
+		m.Add(newFrame(1))
+		m.Add(newFrame(1))
+		Expect(m.queue).To(HaveLen(1))
+	})
+
+	It("ignores connection IDs that were already used", func() {
+		m.Add(newFrame(1))
+		Expect(m.Rotate()).To(BeTrue())
+		m.Add(newFrame(1))
+		Expect(m.queue).To(BeEmpty())
+	})
+
+	It("keeps track of the stateless reset token of the connection ID used", func() {
+		m.SetStatelessResetToken([16]byte{0xca, 0xfe})
+		Expect(resetTokens).To(HaveLen(1))
+		Expect(resetTokens).To(HaveKey([16]byte{0xca, 0xfe}))
+		m.Add(newFrame(1))
+		Expect(m.Rotate()).To(BeTrue())
+		Expect(resetTokens).To(HaveLen(1))
+		Expect(resetTokens).To(HaveKey([16]byte{1, 0xde, 0xad}))
+		m.Close()
+		Expect(resetTokens).To(BeEmpty())
+	})
+
+	It("ignores the stateless reset token from the transport parameters after switching to another connection ID", func() {
+		m.Add(newFrame(1))
+		Expect(m.Rotate()).To(BeTrue())
+		m.SetStatelessResetToken([16]byte{0xca, 0xfe})
+		Expect(resetTokens).To(HaveLen(1))
+		Expect(resetTokens).To(HaveKey([16]byte{1, 0xde, 0xad}))
+	})
+
+	It("retires connection IDs right away if it already keeps track of too many", func() {
+		for i := 1; i <= protocol.MaxActiveConnectionIDs; i++ {
+			m.Add(newFrame(uint64(i)))
+		}
+		Expect(queuedFrames).To(BeEmpty())
+		m.Add(newFrame(protocol.MaxActiveConnectionIDs + 1))
+		Expect(m.queue).To(HaveLen(protocol.MaxActiveConnectionIDs))
+		Expect(queuedFrames).To(Equal([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: protocol.MaxActiveConnectionIDs + 1}}))
+	})
+})
@@ -6,6 +6,7 @@ import (
 	"net"
 	"time"
 
+	"github.com/lucas-clemente/quic-go/internal/protocol"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -78,12 +79,22 @@ var _ = Describe("Connection", func() {
 		Expect(packetConn.dataWrittenTo.String()).To(Equal("192.168.100.200:1337"))
 	})
 
+	It("writes to a different address", func() {
+		addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 7331}
+		err := c.WriteTo([]byte("foobar"), addr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(packetConn.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+		Expect(packetConn.dataWrittenTo).To(Equal(addr))
+		Expect(c.RemoteAddr().String()).To(Equal("192.168.100.200:1337"))
+	})
+
 	It("reads", func() {
 		packetConn.dataToRead <- []byte("foo")
 		packetConn.dataReadFrom = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1336}
 		p := make([]byte, 10)
-		n, raddr, err := c.Read(p)
+		n, raddr, info, err := c.Read(p)
 		Expect(err).ToNot(HaveOccurred())
+		Expect(info).To(Equal(packetInfo{}))
 		Expect(raddr.String()).To(Equal("127.0.0.1:1336"))
 		Expect(n).To(Equal(3))
 		Expect(p[0:3]).To(Equal([]byte("foo")))
@@ -111,6 +122,78 @@ var _ = Describe("Connection", func() {
 		Expect(c.RemoteAddr().String()).To(Equal(addr.String()))
 	})
 
+	Context("switching to a new net.PacketConn", func() {
+		var oldConn, newConn *net.UDPConn
+
+		BeforeEach(func() {
+			var err error
+			oldConn, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+			Expect(err).ToNot(HaveOccurred())
+			newConn, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+			Expect(err).ToNot(HaveOccurred())
+			c.pconn = oldConn
+		})
+
+		AfterEach(func() {
+			oldConn.Close()
+			newConn.Close()
+		})
+
+		It("uses the new net.PacketConn", func() {
+			c.SetPacketConn(newConn)
+			Expect(c.LocalAddr()).To(Equal(newConn.LocalAddr()))
+			c.SetCurrentRemoteAddr(oldConn.LocalAddr())
+			Expect(c.Write([]byte("foobar"))).To(Succeed())
+			// SetPacketConn sets a read deadline on the old net.PacketConn
+			Expect(oldConn.SetReadDeadline(time.Time{})).To(Succeed())
+			p := make([]byte, 10)
+			n, addr, err := oldConn.ReadFrom(p)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p[:n]).To(Equal([]byte("foobar")))
+			Expect(addr.String()).To(Equal(newConn.LocalAddr().String()))
+		})
+
+		It("forgets the local address of the old net.PacketConn", func() {
+			c.info = packetInfo{ecn: protocol.ECT0, dscp: 46, ttl: 10, localAddr: net.IPv4(127, 0, 0, 2), ifIndex: 1}
+			c.SetPacketConn(newConn)
+			Expect(c.info).To(Equal(packetInfo{ecn: protocol.ECT0, dscp: 46, ttl: 10}))
+		})
+
+		It("continues a blocked Read on the new net.PacketConn", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				p := make([]byte, 10)
+				n, _, _, err := c.Read(p)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p[:n]).To(Equal([]byte("foobar")))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			c.SetPacketConn(newConn)
+			Consistently(done).ShouldNot(BeClosed())
+			_, err := oldConn.WriteTo([]byte("foobar"), newConn.LocalAddr())
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	It("doesn't support ECN on a net.PacketConn that is not a UDP connection", func() {
+		Expect(c.EnableECN()).To(BeFalse())
+		c.SetECN(protocol.ECT0)
+		Expect(c.Write([]byte("foobar"))).To(Succeed())
+		Expect(packetConn.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+	})
+
+	It("writes segments one by one on a net.PacketConn that is not a UDP connection", func() {
+		Expect(c.SupportsBatching()).To(BeFalse())
+		n, err := c.WriteSegments([]byte("foobarfoo"), 6)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(2))
+		Expect(packetConn.dataWritten.Bytes()).To(Equal([]byte("foobarfoo")))
+		Expect(packetConn.dataWrittenTo.String()).To(Equal("192.168.100.200:1337"))
+	})
+
 	It("closes", func() {
 		err := c.Close()
 		Expect(err).ToNot(HaveOccurred())
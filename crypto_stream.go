@@ -28,7 +28,7 @@ type cryptoStream struct {
 var _ cryptoStreamI = &cryptoStream{}
 
 func newCryptoStream(sender streamSender, flowController flowcontrol.StreamFlowController, version protocol.VersionNumber) cryptoStreamI {
-	str := newStream(version.CryptoStreamID(), sender, flowController, version)
+	str := newStream(version.CryptoStreamID(), sender, flowController, nil, version)
 	return &cryptoStream{str}
 }
 
@@ -0,0 +1,109 @@
+package quic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+// A DiagnosticSnapshot captures the state of a session at the moment it was closed due to an internal error.
+// Warning: This API should not be considered stable and might change soon.
+type DiagnosticSnapshot struct {
+	// Time is the time when the snapshot was taken.
+	Time time.Time
+	// RecentFrames describes the most recently sent (prefixed with "->") and received (prefixed with "<-") frames.
+	// The oldest frame comes first.
+	RecentFrames []string
+
+	SmoothedRTT time.Duration
+	MinRTT      time.Duration
+	LatestRTT   time.Duration
+
+	CongestionWindow uint64
+	BytesInFlight    uint64
+	// BandwidthEstimate and PacingRate are given in bits per second.
+	BandwidthEstimate uint64
+	PacingRate        uint64
+
+	// ConnectionFlowControl contains the offsets of the connection-level flow controller.
+	ConnectionFlowControl FlowControlOffsets
+}
+
+// FlowControlOffsets are the offsets tracked by a flow controller.
+type FlowControlOffsets struct {
+	BytesSent       uint64
+	SendWindow      uint64
+	BytesRead       uint64
+	HighestReceived uint64
+	ReceiveWindow   uint64
+}
+
+type frameHistoryEntry struct {
+	sent  bool
+	frame wire.Frame
+	// STREAM frames are saved without their data, so we need to remember the data length
+	dataLen protocol.ByteCount
+}
+
+// The frameHistory is a ring buffer holding the most recently sent and received frames.
+// All methods may be called on a nil frameHistory, which doesn't save anything.
+type frameHistory struct {
+	entries []frameHistoryEntry
+	next    int
+	full    bool
+}
+
+func newFrameHistory(size int) *frameHistory {
+	return &frameHistory{entries: make([]frameHistoryEntry, size)}
+}
+
+func (h *frameHistory) Add(frame wire.Frame, sent bool) {
+	if h == nil {
+		return
+	}
+	entry := frameHistoryEntry{sent: sent, frame: frame}
+	// Don't hold on to the data of STREAM frames.
+	// It might be backed by a packet buffer that will be reused.
+	if f, ok := frame.(*wire.StreamFrame); ok {
+		entry.frame = &wire.StreamFrame{
+			StreamID: f.StreamID,
+			FinBit:   f.FinBit,
+			Offset:   f.Offset,
+		}
+		entry.dataLen = f.DataLen()
+	}
+	h.entries[h.next] = entry
+	h.next++
+	if h.next == len(h.entries) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+// Frames returns a description of the saved frames, the oldest frame first.
+func (h *frameHistory) Frames() []string {
+	if h == nil {
+		return nil
+	}
+	var entries []frameHistoryEntry
+	if h.full {
+		entries = append(entries, h.entries[h.next:]...)
+	}
+	entries = append(entries, h.entries[:h.next]...)
+
+	frames := make([]string, len(entries))
+	for i, e := range entries {
+		dir := "<-"
+		if e.sent {
+			dir = "->"
+		}
+		if f, ok := e.frame.(*wire.StreamFrame); ok {
+			frames[i] = fmt.Sprintf("%s &wire.StreamFrame{StreamID: %d, FinBit: %t, Offset: 0x%x, Data length: 0x%x}", dir, f.StreamID, f.FinBit, f.Offset, e.dataLen)
+		} else {
+			frames[i] = fmt.Sprintf("%s %#v", dir, e.frame)
+		}
+	}
+	return frames
+}
@@ -0,0 +1,47 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Frame History", func() {
+	It("doesn't save anything when nil", func() {
+		var h *frameHistory
+		h.Add(&wire.PingFrame{}, true)
+		Expect(h.Frames()).To(BeNil())
+	})
+
+	It("saves frames", func() {
+		h := newFrameHistory(3)
+		h.Add(&wire.PingFrame{}, true)
+		h.Add(&wire.MaxDataFrame{ByteOffset: 0x42}, false)
+		Expect(h.Frames()).To(Equal([]string{
+			"-> &wire.PingFrame{}",
+			"<- &wire.MaxDataFrame{ByteOffset:0x42}",
+		}))
+	})
+
+	It("only keeps the most recent frames", func() {
+		h := newFrameHistory(2)
+		h.Add(&wire.MaxDataFrame{ByteOffset: 1}, true)
+		h.Add(&wire.MaxDataFrame{ByteOffset: 2}, true)
+		h.Add(&wire.MaxDataFrame{ByteOffset: 3}, true)
+		Expect(h.Frames()).To(Equal([]string{
+			"-> &wire.MaxDataFrame{ByteOffset:0x2}",
+			"-> &wire.MaxDataFrame{ByteOffset:0x3}",
+		}))
+	})
+
+	It("doesn't hold on to the data of STREAM frames", func() {
+		h := newFrameHistory(2)
+		f := &wire.StreamFrame{StreamID: 5, Offset: 0x100, Data: []byte("foobar"), FinBit: true}
+		h.Add(f, false)
+		Expect(h.entries[0].frame.(*wire.StreamFrame).Data).To(BeNil())
+		Expect(h.Frames()).To(Equal([]string{
+			"<- &wire.StreamFrame{StreamID: 5, FinBit: true, Offset: 0x100, Data length: 0x6}",
+		}))
+	})
+})
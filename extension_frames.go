@@ -0,0 +1,48 @@
+package quic
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+// An extensionFrameHandler is called for every extension frame of the type it was registered for.
+// It is called from the session's run loop, and therefore must not block.
+type extensionFrameHandler func(sess Session, data []byte)
+
+// The extensionFrameRegistry holds the handlers for extension frames.
+// Handlers can only be registered by the experimental API that is compiled in with the quic_extensions build tag.
+// Without any registered handlers, receiving an extension frame is treated like receiving an unknown frame.
+type extensionFrameRegistry struct {
+	mutex    sync.RWMutex
+	handlers map[byte]extensionFrameHandler
+}
+
+var extensionFrames extensionFrameRegistry
+
+func (r *extensionFrameRegistry) Register(frameType byte, handler extensionFrameHandler) error {
+	if !wire.IsExtensionFrameType(frameType) {
+		return fmt.Errorf("invalid extension frame type 0x%x (must be between 0x%x and 0x%x)", frameType, wire.MinExtensionFrameType, wire.MaxExtensionFrameType)
+	}
+	if handler == nil {
+		return errors.New("extension frame handler must not be nil")
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.handlers[frameType]; ok {
+		return fmt.Errorf("extension frame type 0x%x already registered", frameType)
+	}
+	if r.handlers == nil {
+		r.handlers = make(map[byte]extensionFrameHandler)
+	}
+	r.handlers[frameType] = handler
+	return nil
+}
+
+func (r *extensionFrameRegistry) Get(frameType byte) extensionFrameHandler {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.handlers[frameType]
+}
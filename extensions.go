@@ -0,0 +1,28 @@
+// +build quic_extensions
+
+package quic
+
+import "errors"
+
+// RegisterExtensionFrame registers a handler for extension frames of the given type.
+// Extension frames allow experimenting with new frame types (e.g. timestamps) without changes to the QUIC implementation.
+// The frame type must be between 0x18 and 0x1f, and can only be registered once.
+// The handler is called for every frame of this type received on any session, from the session's run loop.
+// It must not block.
+// Handlers should be registered before dialing or listening, since the session is closed when receiving an extension frame that no handler was registered for.
+// Warning: This API should not be considered stable and might change soon.
+func RegisterExtensionFrame(frameType byte, handler func(sess Session, data []byte)) error {
+	return extensionFrames.Register(frameType, handler)
+}
+
+// SendExtensionFrame queues an extension frame for sending on the session.
+// The data must fit into a single packet, i.e. it must not be longer than 1000 bytes.
+// Like all other frames, extension frames are retransmitted when the packet they were sent in is lost.
+// Warning: This API should not be considered stable and might change soon.
+func SendExtensionFrame(sess Session, frameType byte, data []byte) error {
+	s, ok := sess.(*session)
+	if !ok {
+		return errors.New("SendExtensionFrame: not a quic-go session")
+	}
+	return s.sendExtensionFrame(frameType, data)
+}
@@ -0,0 +1,33 @@
+// +build quic_extensions
+
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Extension frames", func() {
+	AfterEach(func() {
+		extensionFrames = extensionFrameRegistry{}
+	})
+
+	It("registers handlers", func() {
+		Expect(RegisterExtensionFrame(0x18, func(Session, []byte) {})).To(Succeed())
+		Expect(extensionFrames.Get(0x18)).ToNot(BeNil())
+	})
+
+	It("sends extension frames", func() {
+		sess := &session{}
+		sess.packer = &packetPacker{}
+		sess.sendingScheduled = make(chan struct{}, 1)
+		Expect(SendExtensionFrame(sess, 0x18, []byte("foo"))).To(Succeed())
+		Expect(sess.packer.controlFrames).To(Equal([]wire.Frame{&wire.ExtensionFrame{FrameType: 0x18, Data: []byte("foo")}}))
+	})
+
+	It("refuses to send on sessions not created by quic-go", func() {
+		Expect(SendExtensionFrame(nil, 0x18, []byte("foo"))).To(MatchError("SendExtensionFrame: not a quic-go session"))
+	})
+})
@@ -0,0 +1,106 @@
+// +build ignore
+
+// This program generates the seed corpus for the session fuzz target.
+// For every QUIC version, it records the datagrams sent by a client during a connection to a local server,
+// and writes them to the corpus directory, encoded in the format expected by the fuzz target.
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+)
+
+// recordingConn records all datagrams written to it
+type recordingConn struct {
+	net.PacketConn
+
+	mutex   sync.Mutex
+	written []byte
+}
+
+func (c *recordingConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.mutex.Lock()
+	// the datagrams are all sent from the first peer
+	c.written = append(c.written, 0, 0, 0)
+	binary.BigEndian.PutUint16(c.written[len(c.written)-2:], uint16(len(b)))
+	c.written = append(c.written, b...)
+	c.mutex.Unlock()
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+func record(version protocol.VersionNumber) []byte {
+	config := &quic.Config{Versions: []protocol.VersionNumber{version}}
+	ln, err := quic.ListenAddr("localhost:0", testdata.GetTLSConfig(), config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			sess, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				str, err := sess.AcceptStream()
+				if err != nil {
+					return
+				}
+				data, _ := ioutil.ReadAll(str)
+				str.Write(data)
+				str.Close()
+			}()
+		}
+	}()
+
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer udpConn.Close()
+	conn := &recordingConn{PacketConn: udpConn}
+	sess, err := quic.Dial(conn, ln.Addr(), "quic.clemente.io:443", nil, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	str, err := sess.OpenStreamSync()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := str.Write([]byte("foobar")); err != nil {
+		log.Fatal(err)
+	}
+	str.Close()
+	if _, err := ioutil.ReadAll(str); err != nil {
+		log.Fatal(err)
+	}
+	sess.Close(nil)
+
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return conn.written
+}
+
+func main() {
+	dir := "corpus"
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	for _, v := range append(protocol.SupportedVersions, protocol.VersionTLS) {
+		filename := filepath.Join(dir, fmt.Sprintf("%d", v))
+		if err := ioutil.WriteFile(filename, record(v), 0644); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Wrote corpus for %s to %s", v, filename)
+	}
+}
@@ -0,0 +1,201 @@
+// +build gofuzz
+
+// Package session contains a fuzz target that drives a complete server, from the packet dispatcher to the sessions and their streams.
+// Frame-level fuzzing can't find panics and hangs caused by the interaction of multiple packets, such as state machine bugs.
+// The fuzzer input is a sequence of datagrams, which are read by the server from an in-memory net.PacketConn.
+// Each datagram is encoded as a single byte selecting the peer it is sent from, followed by the 2 byte length of the datagram and the datagram itself.
+// A seed corpus containing the datagrams sent by a client during a real connection can be generated by running cmd/corpus.go.
+//
+// To run the fuzzer using go-fuzz (https://github.com/dvyukov/go-fuzz), run the following commands in this directory:
+//     go run cmd/corpus.go
+//     go-fuzz-build github.com/lucas-clemente/quic-go/fuzzing/session
+//     go-fuzz -bin=session-fuzz.zip -workdir=.
+package session
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+)
+
+// the number of different peers that datagrams can be sent from
+const numPeers = 4
+
+var tlsConf = testdata.GetTLSConfig()
+
+// processingTime is the time the sessions are given to process the datagrams after the server read all of them.
+// Closing the server right away would close the sessions before they handled their packets.
+const processingTime = 5 * time.Millisecond
+
+// closeTimeout is the time that closing the server may take.
+// If it takes longer, a session or a stream is probably hanging.
+const closeTimeout = 5 * time.Second
+
+type datagram struct {
+	data []byte
+	addr net.Addr
+}
+
+// memPacketConn is an in-memory net.PacketConn.
+// It returns the datagrams it was created with from ReadFrom, and discards everything that is written to it.
+type memPacketConn struct {
+	mutex     sync.Mutex
+	datagrams []datagram
+	drained   chan struct{} // closed when all datagrams were read
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+var _ net.PacketConn = &memPacketConn{}
+
+func newMemPacketConn(datagrams []datagram) *memPacketConn {
+	return &memPacketConn{
+		datagrams: datagrams,
+		drained:   make(chan struct{}),
+		closed:    make(chan struct{}),
+	}
+}
+
+func (c *memPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	c.mutex.Lock()
+	if len(c.datagrams) > 0 {
+		d := c.datagrams[0]
+		c.datagrams = c.datagrams[1:]
+		c.mutex.Unlock()
+		return copy(b, d.data), d.addr, nil
+	}
+	select {
+	case <-c.drained:
+	default:
+		close(c.drained)
+	}
+	c.mutex.Unlock()
+	<-c.closed
+	return 0, nil, errors.New("use of closed network connection")
+}
+
+func (c *memPacketConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, errors.New("use of closed network connection")
+	default:
+		return len(b), nil
+	}
+}
+
+func (c *memPacketConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *memPacketConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 443}
+}
+func (c *memPacketConn) SetDeadline(time.Time) error      { return nil }
+func (c *memPacketConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *memPacketConn) SetWriteDeadline(time.Time) error { return nil }
+
+// parseDatagrams parses the fuzzer input.
+// A truncated datagram at the end of the input is ignored.
+func parseDatagrams(data []byte) []datagram {
+	var datagrams []datagram
+	for len(data) >= 3 {
+		peer := int(data[0] % numPeers)
+		l := int(binary.BigEndian.Uint16(data[1:3]))
+		data = data[3:]
+		if l > len(data) {
+			break
+		}
+		datagrams = append(datagrams, datagram{
+			data: data[:l],
+			addr: &net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(peer+1)), Port: 1000 + peer},
+		})
+		data = data[l:]
+	}
+	return datagrams
+}
+
+// handleSession accepts all streams opened by the peer, and echoes the data received on them.
+func handleSession(sess quic.Session) {
+	go func() {
+		for {
+			str, err := sess.AcceptUniStream()
+			if err != nil {
+				return
+			}
+			go io.Copy(ioutil.Discard, str)
+		}
+	}()
+	for {
+		str, err := sess.AcceptStream()
+		if err != nil {
+			return
+		}
+		go func() {
+			io.Copy(str, str)
+			str.Close()
+		}()
+	}
+}
+
+// Fuzz fuzzes the server.
+// It panics if closing the server hangs.
+func Fuzz(data []byte) int {
+	datagrams := parseDatagrams(data)
+	if len(datagrams) == 0 {
+		return 0
+	}
+	conn := newMemPacketConn(datagrams)
+	config := &quic.Config{
+		Versions:         append(protocol.SupportedVersions, protocol.VersionTLS),
+		AcceptCookie:     func(net.Addr, *quic.Cookie) bool { return true },
+		IdleTimeout:      time.Second,
+		HandshakeTimeout: time.Second,
+	}
+	ln, err := quic.Listen(conn, tlsConf, config)
+	if err != nil {
+		panic(err)
+	}
+
+	var acceptedSession bool
+	acceptDone := make(chan struct{})
+	go func() {
+		defer close(acceptDone)
+		for {
+			sess, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			acceptedSession = true
+			go handleSession(sess)
+		}
+	}()
+
+	<-conn.drained
+	time.Sleep(processingTime)
+	closed := make(chan struct{})
+	go func() {
+		ln.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(closeTimeout):
+		panic(fmt.Sprintf("closing the server took longer than %s", closeTimeout))
+	}
+	<-acceptDone
+	if acceptedSession {
+		return 1
+	}
+	return 0
+}
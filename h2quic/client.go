@@ -7,6 +7,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"strings"
 	"sync"
 
@@ -21,11 +22,18 @@ import (
 )
 
 type roundTripperOpts struct {
-	DisableCompression bool
+	DisableCompression        bool
+	DisableContentLengthCheck bool
 }
 
 var dialAddr = quic.DialAddr
 
+// the maximum number of informational (1xx) responses that are accepted before the final response
+// the same limit is used by net/http
+const max1xxResponses = 5
+
+var errTooMany1xxResponses = errors.New("h2quic: too many 1xx informational responses")
+
 // client is a HTTP2 client doing QUIC requests
 type client struct {
 	mutex sync.RWMutex
@@ -46,13 +54,20 @@ type client struct {
 	requestWriter *requestWriter
 
 	// Responses pending header receipt.
-	responses map[protocol.StreamID]chan *http.Response
+	responses map[protocol.StreamID]chan *responseHeaders
 
 	logger utils.Logger
 }
 
 var _ http.RoundTripper = &client{}
 
+// a response received on the header stream
+type responseHeaders struct {
+	rsp *http.Response
+	// the HEADERS frame had the END_STREAM flag set, i.e. the response doesn't have a body
+	streamEnded bool
+}
+
 var defaultQuicConfig = &quic.Config{
 	RequestConnectionIDOmission: true,
 	KeepAlive:                   true,
@@ -72,7 +87,7 @@ func newClient(
 	}
 	return &client{
 		hostname:      authorityAddr("https", hostname),
-		responses:     make(map[protocol.StreamID]chan *http.Response),
+		responses:     make(map[protocol.StreamID]chan *responseHeaders),
 		tlsConf:       tlsConfig,
 		config:        config,
 		opts:          opts,
@@ -146,7 +161,7 @@ func (c *client) readResponse(h2framer *http2.Framer, decoder *hpack.Decoder) er
 	if err != nil {
 		return err
 	}
-	responseChan <- rsp
+	responseChan <- &responseHeaders{rsp: rsp, streamEnded: hframe.StreamEnded()}
 	return nil
 }
 
@@ -170,7 +185,7 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	hasBody := (req.Body != nil)
 
-	responseChan := make(chan *http.Response)
+	responseChan := make(chan *responseHeaders)
 	dataStream, err := c.session.OpenStreamSync()
 	if err != nil {
 		_ = c.CloseWithError(err)
@@ -193,24 +208,61 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	}
 
 	// This will write the request body in a separate goroutine.
+	// If writing the body fails before the response was received, the error is returned.
+	var requestBodyErr chan error
 	if hasBody {
+		requestBodyErr = make(chan error, 1)
 		go func() {
-			c.writeRequestBody(dataStream, req.Body)
+			requestBodyErr <- c.writeRequestBody(dataStream, req.Body)
 		}()
 	}
 
 	var res *http.Response
+	var streamEnded bool
 
 	var receivedResponse bool
 
 	ctx := req.Context()
+	var num1xx int
 	for !(receivedResponse) {
 		select {
-		case res = <-responseChan:
+		case r := <-responseChan:
+			res = r.rsp
+			streamEnded = r.streamEnded
+			// Informational (1xx) responses are followed by the final response.
+			if res.StatusCode >= 100 && res.StatusCode <= 199 {
+				num1xx++
+				if num1xx > max1xxResponses {
+					dataStream.CancelRead(6)
+					dataStream.CancelWrite(6)
+					c.mutex.Lock()
+					delete(c.responses, dataStream.StreamID())
+					c.mutex.Unlock()
+					return nil, errTooMany1xxResponses
+				}
+				if res.StatusCode == 100 {
+					if trace := httptrace.ContextClientTrace(ctx); trace != nil && trace.Got100Continue != nil {
+						trace.Got100Continue()
+					}
+				}
+				continue
+			}
 			receivedResponse = true
 			c.mutex.Lock()
 			delete(c.responses, dataStream.StreamID())
 			c.mutex.Unlock()
+		case err := <-requestBodyErr:
+			if err == nil {
+				// the body was written, continue waiting for the response
+				requestBodyErr = nil
+				continue
+			}
+			// writeRequestBody already canceled writing
+			dataStream.CancelRead(6)
+			c.mutex.Lock()
+			delete(c.responses, dataStream.StreamID())
+			c.mutex.Unlock()
+			return nil, err
 		case <-ctx.Done():
 			// error code 6 signals that stream was canceled
 			dataStream.CancelRead(6)
@@ -226,16 +278,23 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 		}
 	}
 
-	// TODO: correctly set this variable
-	var streamEnded bool
 	isHead := (req.Method == "HEAD")
 
 	res = setLength(res, isHead, streamEnded)
 
+	if streamEnded {
+		// The server won't send any data on the data stream.
+		// Read the EOF, so that the stream is completed.
+		dataStream.(remoteCloser).CloseRemote(0)
+		_, _ = dataStream.Read([]byte{0})
+	}
 	if streamEnded || isHead {
 		res.Body = noBody
 	} else {
-		res.Body = dataStream
+		res.Body = newResponseBody(dataStream, ctx)
+		if !c.opts.DisableContentLengthCheck && res.ContentLength >= 0 {
+			res.Body = &contentLengthBody{body: res.Body, remaining: res.ContentLength}
+		}
 		if requestedGzip && res.Header.Get("Content-Encoding") == "gzip" {
 			res.Header.Del("Content-Encoding")
 			res.Header.Del("Content-Length")
@@ -249,18 +308,16 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	return res, nil
 }
 
-func (c *client) writeRequestBody(dataStream quic.Stream, body io.ReadCloser) (err error) {
-	defer func() {
-		cerr := body.Close()
-		if err == nil {
-			// TODO: what to do with dataStream here? Maybe reset it?
-			err = cerr
-		}
-	}()
-
-	_, err = io.Copy(dataStream, body)
+// writeRequestBody writes the request body to the data stream, and closes the body.
+// If reading or closing the body fails, the data stream is reset.
+func (c *client) writeRequestBody(dataStream quic.Stream, body io.ReadCloser) error {
+	_, err := io.Copy(dataStream, body)
+	if cerr := body.Close(); err == nil {
+		err = cerr
+	}
 	if err != nil {
-		// TODO: what to do with dataStream here? Maybe reset it?
+		// error code 6 signals that stream was canceled
+		dataStream.CancelWrite(6)
 		return err
 	}
 	return dataStream.Close()
@@ -7,7 +7,9 @@ import (
 	"crypto/tls"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
 
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/hpack"
@@ -32,7 +34,7 @@ var _ = Describe("Client", func() {
 		origDialAddr = dialAddr
 	)
 
-	injectResponse := func(id protocol.StreamID, rsp *http.Response) {
+	injectResponseHeaders := func(id protocol.StreamID, rsp *http.Response, streamEnded bool) {
 		EventuallyWithOffset(0, func() bool {
 			client.mutex.Lock()
 			defer client.mutex.Unlock()
@@ -41,7 +43,11 @@ var _ = Describe("Client", func() {
 		}).Should(BeTrue())
 		rspChan := client.responses[5]
 		ExpectWithOffset(0, rspChan).ToNot(BeClosed())
-		rspChan <- rsp
+		rspChan <- &responseHeaders{rsp: rsp, streamEnded: streamEnded}
+	}
+
+	injectResponse := func(id protocol.StreamID, rsp *http.Response) {
+		injectResponseHeaders(id, rsp, false)
 	}
 
 	BeforeEach(func() {
@@ -220,7 +226,7 @@ var _ = Describe("Client", func() {
 				rsp, err := client.RoundTrip(request)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(rsp).To(Equal(teapot))
-				Expect(rsp.Body).To(Equal(dataStream))
+				Expect(rsp.Body.(*responseBody).dataStream).To(Equal(dataStream))
 				Expect(rsp.ContentLength).To(BeEquivalentTo(-1))
 				Expect(rsp.Request).To(Equal(request))
 				close(done)
@@ -246,11 +252,32 @@ var _ = Describe("Client", func() {
 
 			cancel()
 			Eventually(done).Should(BeClosed())
-			Expect(dataStream.reset).To(BeTrue())
-			Expect(dataStream.canceledWrite).To(BeTrue())
+			Expect(dataStream.reset.Get()).To(BeTrue())
+			Expect(dataStream.canceledWrite.Get()).To(BeTrue())
 			Expect(client.headerErrored).ToNot(BeClosed())
 		})
 
+		It("cancels the data stream if a request is canceled after the response was received", func() {
+			done := make(chan struct{})
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				defer GinkgoRecover()
+				request = request.WithContext(ctx)
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.Body).ToNot(Equal(noBody))
+				close(done)
+			}()
+
+			Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeEmpty())
+			injectResponse(5, &http.Response{StatusCode: 200})
+			Eventually(done).Should(BeClosed())
+			Expect(dataStream.reset.Get()).To(BeFalse())
+			cancel()
+			Eventually(dataStream.reset.Get).Should(BeTrue())
+			Eventually(dataStream.canceledWrite.Get).Should(BeTrue())
+		})
+
 		It("errors if a request with a body is canceled after the body is sent", func() {
 			done := make(chan struct{})
 			ctx, cancel := context.WithCancel(context.Background())
@@ -267,8 +294,8 @@ var _ = Describe("Client", func() {
 			time.Sleep(10 * time.Millisecond)
 			cancel()
 			Eventually(done).Should(BeClosed())
-			Expect(dataStream.reset).To(BeTrue())
-			Expect(dataStream.canceledWrite).To(BeTrue())
+			Expect(dataStream.reset.Get()).To(BeTrue())
+			Expect(dataStream.canceledWrite.Get()).To(BeTrue())
 			Expect(client.headerErrored).ToNot(BeClosed())
 		})
 
@@ -288,8 +315,8 @@ var _ = Describe("Client", func() {
 			}()
 
 			Eventually(done).Should(BeClosed())
-			Expect(dataStream.reset).To(BeTrue())
-			Expect(dataStream.canceledWrite).To(BeTrue())
+			Expect(dataStream.reset.Get()).To(BeTrue())
+			Expect(dataStream.canceledWrite.Get()).To(BeTrue())
 			Expect(client.headerErrored).ToNot(BeClosed())
 		})
 
@@ -452,6 +479,9 @@ var _ = Describe("Client", func() {
 				}()
 				Eventually(done).Should(BeClosed())
 				Expect(request.Body.(*mockBody).closed).To(BeTrue())
+				Expect(dataStream.canceledWrite.Get()).To(BeTrue())
+				Expect(dataStream.reset.Get()).To(BeTrue())
+				Expect(dataStream.closed).To(BeFalse())
 			})
 
 			It("returns the error that occurred when closing the body", func() {
@@ -575,12 +605,144 @@ var _ = Describe("Client", func() {
 			})
 		})
 
+		Context("Content-Length checks", func() {
+			var response *http.Response
+
+			BeforeEach(func() {
+				response = &http.Response{
+					StatusCode: 200,
+					Header:     http.Header{"Content-Length": []string{"6"}},
+				}
+				dataStream.dataToRead.Write([]byte("foobar"))
+				close(dataStream.unblockRead)
+			})
+
+			roundTrip := func() *http.Response {
+				rspChan := make(chan *http.Response)
+				go func() {
+					defer GinkgoRecover()
+					rsp, err := client.RoundTrip(request)
+					Expect(err).ToNot(HaveOccurred())
+					rspChan <- rsp
+				}()
+				injectResponse(5, response)
+				var rsp *http.Response
+				Eventually(rspChan).Should(Receive(&rsp))
+				return rsp
+			}
+
+			It("reads a body that has the declared length", func() {
+				data, err := ioutil.ReadAll(roundTrip().Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+			})
+
+			It("errors when the body is longer than the declared length", func() {
+				response.Header.Set("Content-Length", "4")
+				data, err := ioutil.ReadAll(roundTrip().Body)
+				Expect(err).To(MatchError(errBodyLongerThanContentLength))
+				Expect(data).To(Equal([]byte("foob")))
+			})
+
+			It("errors when the body is shorter than the declared length", func() {
+				response.Header.Set("Content-Length", "10")
+				data, err := ioutil.ReadAll(roundTrip().Body)
+				Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+				Expect(data).To(Equal([]byte("foobar")))
+			})
+
+			It("doesn't check the length, if the check is disabled", func() {
+				client.opts.DisableContentLengthCheck = true
+				response.Header.Set("Content-Length", "4")
+				rsp := roundTrip()
+				Expect(rsp.ContentLength).To(BeEquivalentTo(4))
+				data, err := ioutil.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+			})
+		})
+
+		Context("responses without a body", func() {
+			It("doesn't read from the data stream if the response headers ended the stream", func() {
+				rspChan := make(chan *http.Response)
+				go func() {
+					defer GinkgoRecover()
+					rsp, err := client.RoundTrip(request)
+					Expect(err).ToNot(HaveOccurred())
+					rspChan <- rsp
+				}()
+				close(dataStream.unblockRead)
+				injectResponseHeaders(5, &http.Response{StatusCode: 204, Header: http.Header{}}, true)
+				var rsp *http.Response
+				Eventually(rspChan).Should(Receive(&rsp))
+				Expect(rsp.Body).To(Equal(noBody))
+				Expect(rsp.ContentLength).To(BeZero())
+				Expect(dataStream.remoteClosed).To(BeTrue())
+			})
+
+			It("doesn't return a body for HEAD requests", func() {
+				request.Method = "HEAD"
+				rspChan := make(chan *http.Response)
+				go func() {
+					defer GinkgoRecover()
+					rsp, err := client.RoundTrip(request)
+					Expect(err).ToNot(HaveOccurred())
+					rspChan <- rsp
+				}()
+				close(dataStream.unblockRead)
+				injectResponseHeaders(5, &http.Response{StatusCode: 200, Header: http.Header{"Content-Length": []string{"1337"}}}, true)
+				var rsp *http.Response
+				Eventually(rspChan).Should(Receive(&rsp))
+				Expect(rsp.Body).To(Equal(noBody))
+				Expect(rsp.ContentLength).To(BeEquivalentTo(1337))
+			})
+		})
+
+		Context("informational responses", func() {
+			It("skips 1xx responses", func() {
+				var got100Continue bool
+				trace := &httptrace.ClientTrace{Got100Continue: func() { got100Continue = true }}
+				request = request.WithContext(httptrace.WithClientTrace(context.Background(), trace))
+				rspChan := make(chan *http.Response)
+				go func() {
+					defer GinkgoRecover()
+					rsp, err := client.RoundTrip(request)
+					Expect(err).ToNot(HaveOccurred())
+					rspChan <- rsp
+				}()
+				injectResponse(5, &http.Response{StatusCode: 100})
+				injectResponse(5, &http.Response{StatusCode: 103})
+				injectResponse(5, &http.Response{StatusCode: 200})
+				var rsp *http.Response
+				Eventually(rspChan).Should(Receive(&rsp))
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(got100Continue).To(BeTrue())
+			})
+
+			It("errors when receiving too many 1xx responses", func() {
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					_, err := client.RoundTrip(request)
+					Expect(err).To(MatchError(errTooMany1xxResponses))
+					close(done)
+				}()
+				for i := 0; i <= max1xxResponses; i++ {
+					injectResponse(5, &http.Response{StatusCode: 103})
+				}
+				Eventually(done).Should(BeClosed())
+				Expect(dataStream.reset.Get()).To(BeTrue())
+				Expect(dataStream.canceledWrite.Get()).To(BeTrue())
+				Expect(client.responses).ToNot(HaveKey(protocol.StreamID(5)))
+			})
+		})
+
 		Context("handling the header stream", func() {
 			var h2framer *http2.Framer
 
 			BeforeEach(func() {
 				h2framer = http2.NewFramer(&headerStream.dataToRead, nil)
-				client.responses[23] = make(chan *http.Response)
+				client.responses[23] = make(chan *responseHeaders)
 			})
 
 			It("reads header values from a response", func() {
@@ -589,8 +751,10 @@ var _ = Describe("Client", func() {
 				headerStream.dataToRead.Write([]byte{0x0, 0x0, byte(len(data)), 0x1, 0x5, 0x0, 0x0, 0x0, 23})
 				headerStream.dataToRead.Write(data)
 				go client.handleHeaderStream()
-				var rsp *http.Response
-				Eventually(client.responses[23]).Should(Receive(&rsp))
+				var rspHeaders *responseHeaders
+				Eventually(client.responses[23]).Should(Receive(&rspHeaders))
+				Expect(rspHeaders.streamEnded).To(BeTrue())
+				rsp := rspHeaders.rsp
 				Expect(rsp).ToNot(BeNil())
 				Expect(rsp.Proto).To(Equal("HTTP/2.0"))
 				Expect(rsp.ProtoMajor).To(BeEquivalentTo(2))
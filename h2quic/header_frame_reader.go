@@ -0,0 +1,33 @@
+package h2quic
+
+import (
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// The headerFrameReader reads from the header stream.
+// Once the first byte of a frame was received, the whole frame has to be received within the timeout.
+// This prevents clients from holding resources by sending the request headers very slowly.
+type headerFrameReader struct {
+	stream  quic.Stream
+	timeout time.Duration
+
+	frameStarted bool
+}
+
+func (r *headerFrameReader) Read(p []byte) (int, error) {
+	n, err := r.stream.Read(p)
+	if n > 0 && !r.frameStarted {
+		r.frameStarted = true
+		r.stream.SetReadDeadline(time.Now().Add(r.timeout))
+	}
+	return n, err
+}
+
+// frameDone must be called after a frame was read completely.
+// It removes the deadline, such that the client may take arbitrarily long until it starts sending the next frame.
+func (r *headerFrameReader) frameDone() {
+	r.frameStarted = false
+	r.stream.SetReadDeadline(time.Time{})
+}
@@ -0,0 +1,45 @@
+package h2quic
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Header frame reader", func() {
+	var (
+		stream *mockStream
+		r      *headerFrameReader
+	)
+
+	BeforeEach(func() {
+		stream = &mockStream{}
+		stream.dataToRead.Write([]byte("foobar"))
+		r = &headerFrameReader{stream: stream, timeout: time.Minute}
+	})
+
+	It("sets a deadline when the first byte of a frame is received", func() {
+		n, err := r.Read(make([]byte, 3))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(3))
+		deadline := stream.readDeadline
+		Expect(deadline).To(BeTemporally("~", time.Now().Add(time.Minute), 10*time.Millisecond))
+		// the deadline is not extended when reading more data
+		time.Sleep(5 * time.Millisecond)
+		_, err = r.Read(make([]byte, 3))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stream.readDeadline).To(Equal(deadline))
+	})
+
+	It("removes the deadline when the frame is done", func() {
+		_, err := r.Read(make([]byte, 3))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stream.readDeadline).ToNot(BeZero())
+		r.frameDone()
+		Expect(stream.readDeadline).To(BeZero())
+		_, err = r.Read(make([]byte, 3))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stream.readDeadline).ToNot(BeZero())
+	})
+})
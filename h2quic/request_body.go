@@ -2,25 +2,66 @@ package h2quic
 
 import (
 	"io"
+	"time"
 
 	quic "github.com/lucas-clemente/quic-go"
 )
 
+// minRequestBodyRateGracePeriod is the time a client has to send the first bytes of the request body,
+// before the Server.MinRequestBodyRate is enforced
+const minRequestBodyRateGracePeriod = 5 * time.Second
+
 type requestBody struct {
 	requestRead bool
 	dataStream  quic.Stream
+
+	// the time by which the whole body has to be read, derived from the http.Server's ReadTimeout
+	deadline time.Time
+	// the minimum rate (in bytes per second) at which the client has to send the body
+	minRate int64
+	// the number of bytes read, and the time that Read was waiting for the client to send data
+	bytesRead   int64
+	blockedTime time.Duration
 }
 
 // make sure the requestBody can be used as a http.Request.Body
 var _ io.ReadCloser = &requestBody{}
 
-func newRequestBody(stream quic.Stream) *requestBody {
-	return &requestBody{dataStream: stream}
+func newRequestBody(stream quic.Stream, deadline time.Time, minRate int64) *requestBody {
+	return &requestBody{
+		dataStream: stream,
+		deadline:   deadline,
+		minRate:    minRate,
+	}
 }
 
 func (b *requestBody) Read(p []byte) (int, error) {
 	b.requestRead = true
-	return b.dataStream.Read(p)
+	if b.deadline.IsZero() && b.minRate <= 0 {
+		return b.dataStream.Read(p)
+	}
+
+	b.dataStream.SetReadDeadline(b.getReadDeadline())
+	start := time.Now()
+	n, err := b.dataStream.Read(p)
+	b.blockedTime += time.Since(start)
+	b.bytesRead += int64(n)
+	return n, err
+}
+
+// getReadDeadline gets the deadline for the next call to Read.
+// Only the time spent waiting for the client counts towards the minimum rate,
+// so that a slow handler doesn't cause the request to time out.
+func (b *requestBody) getReadDeadline() time.Time {
+	deadline := b.deadline
+	if b.minRate > 0 {
+		allowed := minRequestBodyRateGracePeriod + time.Duration(float64(b.bytesRead)/float64(b.minRate)*float64(time.Second))
+		rateDeadline := time.Now().Add(allowed - b.blockedTime)
+		if deadline.IsZero() || rateDeadline.Before(deadline) {
+			deadline = rateDeadline
+		}
+	}
+	return deadline
 }
 
 func (b *requestBody) Close() error {
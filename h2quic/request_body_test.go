@@ -1,6 +1,8 @@
 package h2quic
 
 import (
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -14,7 +16,7 @@ var _ = Describe("Request body", func() {
 	BeforeEach(func() {
 		stream = &mockStream{}
 		stream.dataToRead.Write([]byte("foobar")) // provides data to be read
-		rb = newRequestBody(stream)
+		rb = newRequestBody(stream, time.Time{}, 0)
 	})
 
 	It("reads from the stream", func() {
@@ -30,6 +32,55 @@ var _ = Describe("Request body", func() {
 		Expect(rb.requestRead).To(BeTrue())
 	})
 
+	It("doesn't set a deadline by default", func() {
+		_, err := rb.Read(make([]byte, 1))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stream.readDeadline).To(BeZero())
+	})
+
+	It("sets the deadline for reading the body", func() {
+		deadline := time.Now().Add(time.Hour)
+		rb = newRequestBody(stream, deadline, 0)
+		_, err := rb.Read(make([]byte, 1))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stream.readDeadline).To(Equal(deadline))
+	})
+
+	Context("enforcing the minimum rate", func() {
+		BeforeEach(func() {
+			rb = newRequestBody(stream, time.Time{}, 100) // 100 bytes per second
+		})
+
+		It("grants a grace period for the first read", func() {
+			_, err := rb.Read(make([]byte, 2))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stream.readDeadline).To(BeTemporally("~", time.Now().Add(minRequestBodyRateGracePeriod), 20*time.Millisecond))
+		})
+
+		It("extends the deadline for every byte received", func() {
+			_, err := rb.Read(make([]byte, 3))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rb.Read(make([]byte, 1))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stream.readDeadline).To(BeTemporally("~", time.Now().Add(minRequestBodyRateGracePeriod+30*time.Millisecond), 20*time.Millisecond))
+		})
+
+		It("subtracts the time spent waiting for data", func() {
+			rb.blockedTime = time.Second
+			_, err := rb.Read(make([]byte, 1))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stream.readDeadline).To(BeTemporally("~", time.Now().Add(minRequestBodyRateGracePeriod-time.Second), 20*time.Millisecond))
+		})
+
+		It("doesn't extend the deadline beyond the deadline for reading the body", func() {
+			deadline := time.Now().Add(time.Second)
+			rb.deadline = deadline
+			_, err := rb.Read(make([]byte, 1))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stream.readDeadline).To(Equal(deadline))
+		})
+	})
+
 	It("doesn't close the stream when closing the request body", func() {
 		Expect(stream.closed).To(BeFalse())
 		err := rb.Close()
@@ -32,7 +32,7 @@ func responseFromHeaders(f *http2.MetaHeadersFrame) (*http.Response, error) {
 		return nil, errors.New("malformed non-numeric status pseudo header")
 	}
 
-	// TODO: handle statusCode == 100
+	// informational (1xx) responses are handled by the client's RoundTrip
 
 	header := make(http.Header)
 	res := &http.Response{
@@ -0,0 +1,71 @@
+package h2quic
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// The responseBody is the body of a response received by the client.
+// If the request context is canceled before the body was read completely, the data stream is canceled.
+type responseBody struct {
+	dataStream quic.Stream
+	ctx        context.Context
+
+	doneOnce sync.Once
+	done     chan struct{} // closed when the body was read completely, or closed
+}
+
+// make sure the responseBody can be used as a http.Response.Body
+var _ io.ReadCloser = &responseBody{}
+
+func newResponseBody(stream quic.Stream, ctx context.Context) *responseBody {
+	b := &responseBody{
+		dataStream: stream,
+		ctx:        ctx,
+		done:       make(chan struct{}),
+	}
+	// contexts that can't be canceled return a nil channel
+	if ctx.Done() != nil {
+		go b.cancelOnContextDone()
+	}
+	return b
+}
+
+func (b *responseBody) cancelOnContextDone() {
+	select {
+	case <-b.ctx.Done():
+		// If the body was completed before the goroutine was scheduled, both channels might be closed.
+		select {
+		case <-b.done:
+			return
+		default:
+		}
+		// error code 6 signals that stream was canceled
+		b.dataStream.CancelRead(6)
+		b.dataStream.CancelWrite(6)
+	case <-b.done:
+	}
+}
+
+func (b *responseBody) Read(p []byte) (int, error) {
+	n, err := b.dataStream.Read(p)
+	if err != nil {
+		if ctxErr := b.ctx.Err(); ctxErr != nil && err != io.EOF {
+			err = ctxErr
+		}
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *responseBody) Close() error {
+	b.finish()
+	return b.dataStream.Close()
+}
+
+func (b *responseBody) finish() {
+	b.doneOnce.Do(func() { close(b.done) })
+}
@@ -0,0 +1,89 @@
+package h2quic
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	quic "github.com/lucas-clemente/quic-go"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// a stream whose Read returns an error once unblocked
+type erroringReadStream struct {
+	*mockStream
+	readErr error
+}
+
+func (s *erroringReadStream) Read(p []byte) (int, error) {
+	<-s.unblockRead
+	return 0, s.readErr
+}
+
+var _ = Describe("Response body", func() {
+	var (
+		stream    *mockStream
+		ctx       context.Context
+		ctxCancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		stream = newMockStream(5)
+		stream.dataToRead.Write([]byte("foobar"))
+		ctx, ctxCancel = context.WithCancel(context.Background())
+	})
+
+	It("reads from the stream", func() {
+		rb := newResponseBody(stream, ctx)
+		b := make([]byte, 10)
+		n, err := rb.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("foobar")))
+	})
+
+	It("closes the stream", func() {
+		rb := newResponseBody(stream, ctx)
+		Expect(rb.Close()).To(Succeed())
+		Expect(stream.closed).To(BeTrue())
+	})
+
+	It("cancels the stream when the context is canceled", func() {
+		newResponseBody(stream, ctx)
+		ctxCancel()
+		Eventually(stream.reset.Get).Should(BeTrue())
+		Eventually(stream.canceledWrite.Get).Should(BeTrue())
+	})
+
+	It("doesn't cancel the stream after the body was read completely", func() {
+		rb := newResponseBody(stream, ctx)
+		close(stream.unblockRead)
+		_, err := rb.Read(make([]byte, 10))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rb.Read(make([]byte, 10))
+		Expect(err).To(MatchError(io.EOF))
+		ctxCancel()
+		Consistently(stream.reset.Get).Should(BeFalse())
+	})
+
+	It("doesn't cancel the stream after the body was closed", func() {
+		rb := newResponseBody(stream, ctx)
+		Expect(rb.Close()).To(Succeed())
+		ctxCancel()
+		Consistently(stream.reset.Get).Should(BeFalse())
+	})
+
+	It("returns the context error when reading is canceled", func() {
+		str := &erroringReadStream{
+			mockStream: stream,
+			readErr:    errors.New("Read on stream 5 canceled with error code 6"),
+		}
+		var _ quic.Stream = str
+		rb := newResponseBody(str, ctx)
+		ctxCancel()
+		close(stream.unblockRead)
+		_, err := rb.Read(make([]byte, 10))
+		Expect(err).To(MatchError(context.Canceled))
+	})
+})
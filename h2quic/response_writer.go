@@ -24,6 +24,9 @@ type responseWriter struct {
 	header        http.Header
 	status        int // status code passed to WriteHeader
 	headerWritten bool
+	isHead        bool // if the request was a HEAD request, the body is discarded
+	// the data stream is closed as soon as it is clear that no body will be sent
+	dataStreamClosed bool
 
 	logger utils.Logger
 }
@@ -33,9 +36,11 @@ func newResponseWriter(
 	headerStreamMutex *sync.Mutex,
 	dataStream quic.Stream,
 	dataStreamID protocol.StreamID,
+	isHead bool,
 	logger utils.Logger,
 ) *responseWriter {
 	return &responseWriter{
+		isHead:            isHead,
 		header:            http.Header{},
 		headerStream:      headerStream,
 		headerStreamMutex: headerStreamMutex,
@@ -50,6 +55,11 @@ func (w *responseWriter) Header() http.Header {
 }
 
 func (w *responseWriter) WriteHeader(status int) {
+	// If the response can't have a body, we can end the stream right away.
+	w.writeHeader(status, w.isHead || !bodyAllowedForStatus(status))
+}
+
+func (w *responseWriter) writeHeader(status int, endStream bool) {
 	if w.headerWritten {
 		return
 	}
@@ -72,12 +82,16 @@ func (w *responseWriter) WriteHeader(status int) {
 	h2framer := http2.NewFramer(w.headerStream, nil)
 	err := h2framer.WriteHeaders(http2.HeadersFrameParam{
 		StreamID:      uint32(w.dataStreamID),
+		EndStream:     endStream,
 		EndHeaders:    true,
 		BlockFragment: headers.Bytes(),
 	})
 	if err != nil {
 		w.logger.Errorf("could not write h2 header: %s", err.Error())
 	}
+	if endStream {
+		w.closeDataStream()
+	}
 }
 
 func (w *responseWriter) Write(p []byte) (int, error) {
@@ -87,9 +101,29 @@ func (w *responseWriter) Write(p []byte) (int, error) {
 	if !bodyAllowedForStatus(w.status) {
 		return 0, http.ErrBodyNotAllowed
 	}
+	// Just like net/http, silently discard the body of responses to HEAD requests.
+	if w.isHead {
+		return len(p), nil
+	}
 	return w.dataStream.Write(p)
 }
 
+// finish must be called after the handler returned.
+// If the handler didn't write anything, the response is sent with the given status code, without a body.
+// It closes the data stream, if that didn't happen yet.
+func (w *responseWriter) finish(status int) {
+	w.writeHeader(status, true)
+	w.closeDataStream()
+}
+
+func (w *responseWriter) closeDataStream() {
+	if w.dataStreamClosed || w.dataStream == nil {
+		return
+	}
+	w.dataStreamClosed = true
+	w.dataStream.Close()
+}
+
 func (w *responseWriter) Flush() {}
 
 // This is a NOP. Use http.Request.Context
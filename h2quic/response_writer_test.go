@@ -19,13 +19,15 @@ import (
 )
 
 type mockStream struct {
-	id            protocol.StreamID
-	dataToRead    bytes.Buffer
-	dataWritten   bytes.Buffer
-	reset         bool
-	canceledWrite bool
+	id          protocol.StreamID
+	dataToRead  bytes.Buffer
+	dataWritten bytes.Buffer
+	// reset and canceledWrite are set from the go routine that cancels the stream when the context is done
+	reset         utils.AtomicBool
+	canceledWrite utils.AtomicBool
 	closed        bool
 	remoteClosed  bool
+	readDeadline  time.Time
 
 	unblockRead chan struct{}
 	ctx         context.Context
@@ -44,14 +46,16 @@ func newMockStream(id protocol.StreamID) *mockStream {
 }
 
 func (s *mockStream) Close() error                          { s.closed = true; s.ctxCancel(); return nil }
-func (s *mockStream) CancelRead(quic.ErrorCode) error       { s.reset = true; return nil }
-func (s *mockStream) CancelWrite(quic.ErrorCode) error      { s.canceledWrite = true; return nil }
+func (s *mockStream) CancelRead(quic.ErrorCode) error       { s.reset.Set(true); return nil }
+func (s *mockStream) CancelWrite(quic.ErrorCode) error      { s.canceledWrite.Set(true); return nil }
 func (s *mockStream) CloseRemote(offset protocol.ByteCount) { s.remoteClosed = true; s.ctxCancel() }
 func (s mockStream) StreamID() protocol.StreamID            { return s.id }
 func (s *mockStream) Context() context.Context              { return s.ctx }
 func (s *mockStream) SetDeadline(time.Time) error           { panic("not implemented") }
-func (s *mockStream) SetReadDeadline(time.Time) error       { panic("not implemented") }
+func (s *mockStream) SetReadDeadline(t time.Time) error     { s.readDeadline = t; return nil }
 func (s *mockStream) SetWriteDeadline(time.Time) error      { panic("not implemented") }
+func (s *mockStream) SetDataLifetime(time.Duration)         { panic("not implemented") }
+func (s *mockStream) Stats() quic.StreamStats               { panic("not implemented") }
 
 func (s *mockStream) Read(p []byte) (int, error) {
 	n, _ := s.dataToRead.Read(p)
@@ -62,6 +66,17 @@ func (s *mockStream) Read(p []byte) (int, error) {
 	return n, nil // never return an EOF
 }
 func (s *mockStream) Write(p []byte) (int, error) { return s.dataWritten.Write(p) }
+func (s *mockStream) WriteVectored(bufs [][]byte) (int, error) {
+	var n int
+	for _, b := range bufs {
+		m, err := s.Write(b)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
 
 var _ = Describe("Response Writer", func() {
 	var (
@@ -72,8 +87,8 @@ var _ = Describe("Response Writer", func() {
 
 	BeforeEach(func() {
 		headerStream = &mockStream{}
-		dataStream = &mockStream{}
-		w = newResponseWriter(headerStream, &sync.Mutex{}, dataStream, 5, utils.DefaultLogger)
+		dataStream = newMockStream(5)
+		w = newResponseWriter(headerStream, &sync.Mutex{}, dataStream, 5, false, utils.DefaultLogger)
 	})
 
 	decodeHeaderFields := func() map[string][]string {
@@ -153,6 +168,74 @@ var _ = Describe("Response Writer", func() {
 		Expect(fields).To(HaveKeyWithValue(":status", []string{"200"}))
 	})
 
+	getHeadersFrame := func() *http2.HeadersFrame {
+		h2framer := http2.NewFramer(nil, bytes.NewReader(headerStream.dataWritten.Bytes()))
+		frame, err := h2framer.ReadFrame()
+		Expect(err).ToNot(HaveOccurred())
+		return frame.(*http2.HeadersFrame)
+	}
+
+	It("doesn't end the stream when writing the header", func() {
+		w.WriteHeader(200)
+		Expect(getHeadersFrame().StreamEnded()).To(BeFalse())
+		Expect(dataStream.closed).To(BeFalse())
+	})
+
+	It("ends the stream if the status code doesn't allow a body", func() {
+		w.WriteHeader(204)
+		Expect(getHeadersFrame().StreamEnded()).To(BeTrue())
+		Expect(dataStream.closed).To(BeTrue())
+	})
+
+	Context("finishing the response", func() {
+		It("sends the status and ends the stream, if nothing was written", func() {
+			w.finish(200)
+			hf := getHeadersFrame()
+			Expect(hf.StreamEnded()).To(BeTrue())
+			Expect(decodeHeaderFields()).To(HaveKeyWithValue(":status", []string{"200"}))
+			Expect(dataStream.closed).To(BeTrue())
+		})
+
+		It("closes the data stream after a body was written", func() {
+			_, err := w.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			w.finish(200)
+			Expect(getHeadersFrame().StreamEnded()).To(BeFalse())
+			Expect(dataStream.closed).To(BeTrue())
+			Expect(dataStream.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+		})
+
+		It("closes the data stream only once", func() {
+			w.WriteHeader(304)
+			Expect(dataStream.closed).To(BeTrue())
+			dataStream.closed = false
+			w.finish(200)
+			Expect(dataStream.closed).To(BeFalse())
+		})
+	})
+
+	Context("responding to HEAD requests", func() {
+		BeforeEach(func() {
+			w.isHead = true
+		})
+
+		It("ends the stream when writing the header", func() {
+			w.Header().Add("content-length", "6")
+			w.WriteHeader(200)
+			Expect(getHeadersFrame().StreamEnded()).To(BeTrue())
+			Expect(decodeHeaderFields()).To(HaveKeyWithValue("content-length", []string{"6"}))
+			Expect(dataStream.closed).To(BeTrue())
+		})
+
+		It("discards the body", func() {
+			n, err := w.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(6))
+			Expect(getHeadersFrame().StreamEnded()).To(BeTrue())
+			Expect(dataStream.dataWritten.Len()).To(BeZero())
+		})
+	})
+
 	It("doesn't allow writes if the status code doesn't allow a body", func() {
 		w.WriteHeader(304)
 		n, err := w.Write([]byte("foobar"))
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 
@@ -33,6 +34,13 @@ type RoundTripper struct {
 	// uncompressed.
 	DisableCompression bool
 
+	// DisableContentLengthCheck, if true, prevents the Transport from
+	// checking that the length of a response body matches the
+	// Content-Length sent by the server. By default, reading a
+	// body that is longer or shorter than the Content-Length
+	// results in an error, just like for http.Transport.
+	DisableContentLengthCheck bool
+
 	// TLSClientConfig specifies the TLS configuration to use with
 	// tls.Client. If nil, the default configuration is used.
 	TLSClientConfig *tls.Config
@@ -46,7 +54,21 @@ type RoundTripper struct {
 	// If Dial is nil, quic.DialAddr will be used.
 	Dial func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error)
 
-	clients map[string]roundTripCloser
+	// Proxy specifies a function to return a proxy for a given
+	// Request. QUIC can't be used through HTTP proxies, so if the
+	// function returns a non-nil URL, the request is sent over
+	// TCP, using the ProxyTransport.
+	// If Proxy is nil, no proxy is used. Use http.ProxyFromEnvironment
+	// to respect the standard proxy environment variables.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// ProxyTransport is used for requests that are sent via a proxy.
+	// If nil, an http.Transport with the same Proxy function,
+	// TLSClientConfig and DisableCompression setting is used.
+	ProxyTransport http.RoundTripper
+
+	clients        map[string]roundTripCloser
+	proxyTransport http.RoundTripper
 }
 
 // RoundTripOpt are options for the Transport.RoundTripOpt method.
@@ -99,6 +121,17 @@ func (r *RoundTripper) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.
 		return nil, fmt.Errorf("quic: invalid method %q", req.Method)
 	}
 
+	if r.Proxy != nil {
+		proxyURL, err := r.Proxy(req)
+		if err != nil {
+			closeRequestBody(req)
+			return nil, err
+		}
+		if proxyURL != nil {
+			return r.getProxyTransport().RoundTrip(req)
+		}
+	}
+
 	hostname := authorityAddr("https", hostnameFromRequest(req))
 	cl, err := r.getClient(hostname, opt.OnlyCachedConn)
 	if err != nil {
@@ -128,7 +161,10 @@ func (r *RoundTripper) getClient(hostname string, onlyCached bool) (http.RoundTr
 		client = newClient(
 			hostname,
 			r.TLSClientConfig,
-			&roundTripperOpts{DisableCompression: r.DisableCompression},
+			&roundTripperOpts{
+				DisableCompression:        r.DisableCompression,
+				DisableContentLengthCheck: r.DisableContentLengthCheck,
+			},
 			r.QuicConfig,
 			r.Dial,
 		)
@@ -137,10 +173,31 @@ func (r *RoundTripper) getClient(hostname string, onlyCached bool) (http.RoundTr
 	return client, nil
 }
 
-// Close closes the QUIC connections that this RoundTripper has used
+func (r *RoundTripper) getProxyTransport() http.RoundTripper {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.ProxyTransport != nil {
+		return r.ProxyTransport
+	}
+	if r.proxyTransport == nil {
+		r.proxyTransport = &http.Transport{
+			Proxy:              r.Proxy,
+			TLSClientConfig:    r.TLSClientConfig,
+			DisableCompression: r.DisableCompression,
+		}
+	}
+	return r.proxyTransport
+}
+
+// Close closes the QUIC connections that this RoundTripper has used,
+// as well as idle connections of the transport used for proxied requests.
 func (r *RoundTripper) Close() error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
+	if t, ok := r.proxyTransport.(*http.Transport); ok {
+		t.CloseIdleConnections()
+	}
 	for _, client := range r.clients {
 		if err := client.Close(); err != nil {
 			return err
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	quic "github.com/lucas-clemente/quic-go"
@@ -197,6 +198,52 @@ var _ = Describe("RoundTripper", func() {
 		})
 	})
 
+	Context("proxies", func() {
+		var proxyTransport *mockClient
+
+		BeforeEach(func() {
+			proxyTransport = &mockClient{}
+			rt.ProxyTransport = proxyTransport
+		})
+
+		It("uses the ProxyTransport for proxied requests", func() {
+			rt.Proxy = func(req *http.Request) (*url.URL, error) {
+				Expect(req).To(Equal(req1))
+				return url.Parse("http://proxy.example.org:3128")
+			}
+			rsp, err := rt.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Request).To(Equal(req1))
+			Expect(rt.clients).To(BeEmpty())
+		})
+
+		It("uses QUIC if the Proxy function doesn't return a proxy", func() {
+			rt.Proxy = func(*http.Request) (*url.URL, error) { return nil, nil }
+			_, err := rt.RoundTripOpt(req1, RoundTripOpt{OnlyCachedConn: true})
+			Expect(err).To(MatchError(ErrNoCachedConn))
+		})
+
+		It("returns the error returned by the Proxy function", func() {
+			testErr := errors.New("proxy error")
+			rt.Proxy = func(*http.Request) (*url.URL, error) { return nil, testErr }
+			req1.Body = &mockBody{}
+			_, err := rt.RoundTrip(req1)
+			Expect(err).To(MatchError(testErr))
+			Expect(req1.Body.(*mockBody).closed).To(BeTrue())
+		})
+
+		It("creates an http.Transport, if no ProxyTransport is set", func() {
+			rt.ProxyTransport = nil
+			rt.Proxy = http.ProxyFromEnvironment
+			rt.TLSClientConfig = &tls.Config{ServerName: "foo.bar"}
+			t, ok := rt.getProxyTransport().(*http.Transport)
+			Expect(ok).To(BeTrue())
+			Expect(t.TLSClientConfig).To(Equal(rt.TLSClientConfig))
+			Expect(t.Proxy).ToNot(BeNil())
+			Expect(rt.getProxyTransport()).To(BeIdenticalTo(t))
+		})
+	})
+
 	Context("closing", func() {
 		It("closes", func() {
 			rt.clients = make(map[string]roundTripCloser)
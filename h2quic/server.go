@@ -43,6 +43,15 @@ type Server struct {
 	// If nil, it uses reasonable default values.
 	QuicConfig *quic.Config
 
+	// MinRequestBodyRate is the minimum rate (in bytes per second) at which clients have to send request bodies.
+	// If a client sends the body slower, reading the body returns a timeout error.
+	// Only the time that the handler spends waiting for data counts towards the rate,
+	// and clients are granted a grace period of 5 seconds.
+	// If zero, no minimum rate is enforced.
+	// The request headers are subject to the http.Server's ReadHeaderTimeout and MaxHeaderBytes,
+	// and the request body to the ReadTimeout, measured from the time the request headers were received.
+	MinRequestBodyRate int64
+
 	// Private flag for demo, do not use
 	CloseAfterFirstRequest bool
 
@@ -131,12 +140,26 @@ func (s *Server) handleHeaderStream(session streamCreator) {
 		return
 	}
 
+	maxHeaderBytes := s.maxHeaderBytes()
 	hpackDecoder := hpack.NewDecoder(4096, nil)
-	h2framer := http2.NewFramer(nil, stream)
+	hpackDecoder.SetMaxStringLength(maxHeaderBytes)
+	var headerReader *headerFrameReader
+	var h2framer *http2.Framer
+	if s.ReadHeaderTimeout > 0 {
+		headerReader = &headerFrameReader{stream: stream, timeout: s.ReadHeaderTimeout}
+		h2framer = http2.NewFramer(nil, headerReader)
+	} else {
+		h2framer = http2.NewFramer(nil, stream)
+	}
+	h2framer.SetMaxReadFrameSize(uint32(maxHeaderBytes))
 
 	var headerStreamMutex sync.Mutex // Protects concurrent calls to Write()
 	for {
-		if err := s.handleRequest(session, stream, &headerStreamMutex, hpackDecoder, h2framer); err != nil {
+		err := s.handleRequest(session, stream, &headerStreamMutex, hpackDecoder, h2framer)
+		if headerReader != nil {
+			headerReader.frameDone()
+		}
+		if err != nil {
 			// QuicErrors must originate from stream.Read() returning an error.
 			// In this case, the session has already logged the error, so we don't
 			// need to log it again.
@@ -158,10 +181,14 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 	if !ok {
 		return qerr.Error(qerr.InvalidHeadersStreamData, "expected a header frame")
 	}
+	headerBlock := h2headersFrame.HeaderBlockFragment()
 	if !h2headersFrame.HeadersEnded() {
-		return errors.New("http2 header continuation not implemented")
+		headerBlock, err = s.readContinuationFrames(h2framer, headerBlock)
+		if err != nil {
+			return err
+		}
 	}
-	headers, err := hpackDecoder.DecodeFull(h2headersFrame.HeaderBlockFragment())
+	headers, err := hpackDecoder.DecodeFull(headerBlock)
 	if err != nil {
 		s.logger.Errorf("invalid http2 headers encoding: %s", err.Error())
 		return err
@@ -199,12 +226,16 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 		}
 
 		req = req.WithContext(dataStream.Context())
-		reqBody := newRequestBody(dataStream)
+		var bodyDeadline time.Time
+		if s.ReadTimeout > 0 {
+			bodyDeadline = time.Now().Add(s.ReadTimeout)
+		}
+		reqBody := newRequestBody(dataStream, bodyDeadline, s.MinRequestBodyRate)
 		req.Body = reqBody
 
 		req.RemoteAddr = session.RemoteAddr().String()
 
-		responseWriter := newResponseWriter(headerStream, headerStreamMutex, dataStream, protocol.StreamID(h2headersFrame.StreamID), s.logger)
+		responseWriter := newResponseWriter(headerStream, headerStreamMutex, dataStream, protocol.StreamID(h2headersFrame.StreamID), req.Method == http.MethodHead, s.logger)
 
 		handler := s.Handler
 		if handler == nil {
@@ -224,18 +255,15 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 			}()
 			handler.ServeHTTP(responseWriter, req)
 		}()
+		status := http.StatusOK
 		if panicked {
-			responseWriter.WriteHeader(500)
-		} else {
-			responseWriter.WriteHeader(200)
+			status = http.StatusInternalServerError
 		}
-		if responseWriter.dataStream != nil {
-			if !streamEnded && !reqBody.requestRead {
-				// in gQUIC, the error code doesn't matter, so just use 0 here
-				responseWriter.dataStream.CancelRead(0)
-			}
-			responseWriter.dataStream.Close()
+		if responseWriter.dataStream != nil && !streamEnded && !reqBody.requestRead {
+			// in gQUIC, the error code doesn't matter, so just use 0 here
+			responseWriter.dataStream.CancelRead(0)
 		}
+		responseWriter.finish(status)
 		if s.CloseAfterFirstRequest {
 			time.Sleep(100 * time.Millisecond)
 			session.Close(nil)
@@ -245,6 +273,45 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 	return nil
 }
 
+// readContinuationFrames reads the CONTINUATION frames following a HEADERS frame,
+// and appends their header block fragments to the header block.
+func (s *Server) readContinuationFrames(h2framer *http2.Framer, headerBlock []byte) ([]byte, error) {
+	// The header block fragment is only valid until the next call to ReadFrame.
+	headerBlock = append([]byte(nil), headerBlock...)
+	maxHeaderBytes := s.maxHeaderBytes()
+	for {
+		h2frame, err := h2framer.ReadFrame()
+		if err != nil {
+			return nil, qerr.Error(qerr.HeadersStreamDataDecompressFailure, "cannot read frame")
+		}
+		// The framer makes sure that the CONTINUATION frames belong to the same stream as the HEADERS frame.
+		continuationFrame, ok := h2frame.(*http2.ContinuationFrame)
+		if !ok {
+			return nil, qerr.Error(qerr.InvalidHeadersStreamData, "expected a continuation frame")
+		}
+		headerBlock = append(headerBlock, continuationFrame.HeaderBlockFragment()...)
+		if len(headerBlock) > maxHeaderBytes {
+			return nil, qerr.Error(qerr.InvalidHeadersStreamData, "header block too large")
+		}
+		if continuationFrame.HeadersEnded() {
+			return headerBlock, nil
+		}
+	}
+}
+
+// maxHeaderBytes is the maximum size of a HEADERS frame
+func (s *Server) maxHeaderBytes() int {
+	if s.MaxHeaderBytes <= 0 {
+		return http.DefaultMaxHeaderBytes
+	}
+	// the maximum frame size allowed by HTTP/2
+	const maxFrameSize = 1<<24 - 1
+	if s.MaxHeaderBytes > maxFrameSize {
+		return maxFrameSize
+	}
+	return s.MaxHeaderBytes
+}
+
 // Close the server immediately, aborting requests and sending CONNECTION_CLOSE frames to connected clients.
 // Close in combination with ListenAndServe() (instead of Serve()) may race if it is called before a UDP socket is established.
 func (s *Server) Close() error {
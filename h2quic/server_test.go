@@ -70,19 +70,30 @@ func (s *mockSession) Close(e error) error {
 	s.closed = true
 	return nil
 }
+func (s *mockSession) CloseWithError(quic.ErrorCode, string) error { panic("not implemented") }
 func (s *mockSession) LocalAddr() net.Addr {
 	panic("not implemented")
 }
 func (s *mockSession) RemoteAddr() net.Addr {
 	return &net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: 42}
 }
+func (s *mockSession) Migrate(net.PacketConn) error { panic("not implemented") }
+func (s *mockSession) SetIdleTimeout(time.Duration) { panic("not implemented") }
+func (s *mockSession) SetDSCP(uint8) error          { panic("not implemented") }
+func (s *mockSession) SetTTL(uint8)                 { panic("not implemented") }
+func (s *mockSession) SetUserData(interface{})      { panic("not implemented") }
+func (s *mockSession) UserData() interface{}        { panic("not implemented") }
 func (s *mockSession) Context() context.Context {
 	return s.ctx
 }
-func (s *mockSession) ConnectionState() quic.ConnectionState        { panic("not implemented") }
-func (s *mockSession) AcceptUniStream() (quic.ReceiveStream, error) { panic("not implemented") }
-func (s *mockSession) OpenUniStream() (quic.SendStream, error)      { panic("not implemented") }
-func (s *mockSession) OpenUniStreamSync() (quic.SendStream, error)  { panic("not implemented") }
+func (s *mockSession) ConnectionState() quic.ConnectionState              { panic("not implemented") }
+func (s *mockSession) WaitForHandshakeConfirmation(context.Context) error { panic("not implemented") }
+func (s *mockSession) AcceptUniStream() (quic.ReceiveStream, error)       { panic("not implemented") }
+func (s *mockSession) OpenUniStream() (quic.SendStream, error)            { panic("not implemented") }
+func (s *mockSession) OpenUniStreamSync() (quic.SendStream, error)        { panic("not implemented") }
+func (s *mockSession) Stats() quic.SessionStats                           { panic("not implemented") }
+func (s *mockSession) CorrelationID() string                              { panic("not implemented") }
+func (s *mockSession) CongestionState() *quic.CongestionState             { panic("not implemented") }
 
 var _ = Describe("H2 server", func() {
 	var (
@@ -141,7 +152,7 @@ var _ = Describe("H2 server", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Expect(dataStream.remoteClosed).To(BeTrue())
-			Expect(dataStream.reset).To(BeFalse())
+			Expect(dataStream.reset.Get()).To(BeFalse())
 		})
 
 		It("returns 200 with an empty handler", func() {
@@ -155,7 +166,7 @@ var _ = Describe("H2 server", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() []byte {
 				return headerStream.dataWritten.Bytes()
-			}).Should(Equal([]byte{0x0, 0x0, 0x1, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5, 0x88})) // 0x88 is 200
+			}).Should(Equal([]byte{0x0, 0x0, 0x1, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5, 0x88})) // 0x88 is 200, the END_STREAM flag is set
 		})
 
 		It("correctly handles a panicking handler", func() {
@@ -171,7 +182,7 @@ var _ = Describe("H2 server", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() []byte {
 				return headerStream.dataWritten.Bytes()
-			}).Should(Equal([]byte{0x0, 0x0, 0x1, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5, 0x8e})) // 0x82 is 500
+			}).Should(Equal([]byte{0x0, 0x0, 0x1, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5, 0x8e})) // 0x82 is 500, the END_STREAM flag is set
 		})
 
 		It("resets the dataStream when client sends a body in GET request", func() {
@@ -188,7 +199,7 @@ var _ = Describe("H2 server", func() {
 			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
-			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
+			Eventually(dataStream.reset.Get).Should(BeTrue())
 			Expect(dataStream.remoteClosed).To(BeFalse())
 		})
 
@@ -202,7 +213,7 @@ var _ = Describe("H2 server", func() {
 			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
 			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
-			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
+			Eventually(dataStream.reset.Get).Should(BeTrue())
 			Consistently(func() bool { return dataStream.remoteClosed }).Should(BeFalse())
 			Expect(handlerCalled).To(BeTrue())
 		})
@@ -235,7 +246,7 @@ var _ = Describe("H2 server", func() {
 			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
 			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
-			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
+			Eventually(dataStream.reset.Get).Should(BeTrue())
 			Consistently(func() bool { return dataStream.remoteClosed }).Should(BeFalse())
 			Expect(handlerCalled).To(BeTrue())
 		})
@@ -256,7 +267,26 @@ var _ = Describe("H2 server", func() {
 			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
-			Expect(dataStream.reset).To(BeFalse())
+			Expect(dataStream.reset.Get()).To(BeFalse())
+		})
+
+		It("applies the ReadTimeout to the request body", func() {
+			s.ReadTimeout = time.Hour
+			s.MinRequestBodyRate = 1000
+			var body *requestBody
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body = r.Body.(*requestBody)
+			})
+			headerStream.dataToRead.Write([]byte{
+				0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
+				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+			})
+			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(func() *requestBody { return body }).ShouldNot(BeNil())
+			Expect(body.deadline).To(BeTemporally("~", time.Now().Add(time.Hour), time.Second))
+			Expect(body.minRate).To(BeEquivalentTo(1000))
 		})
 
 		It("errors when non-header frames are received", func() {
@@ -268,6 +298,66 @@ var _ = Describe("H2 server", func() {
 			Expect(err).To(MatchError("InvalidHeadersStreamData: expected a header frame"))
 		})
 
+		Context("CONTINUATION frames", func() {
+			var headerBlock []byte
+
+			BeforeEach(func() {
+				buf := &bytes.Buffer{}
+				enc := hpack.NewEncoder(buf)
+				enc.WriteField(hpack.HeaderField{Name: ":method", Value: "GET"})
+				enc.WriteField(hpack.HeaderField{Name: ":scheme", Value: "https"})
+				enc.WriteField(hpack.HeaderField{Name: ":path", Value: "/"})
+				enc.WriteField(hpack.HeaderField{Name: ":authority", Value: "www.example.com"})
+				enc.WriteField(hpack.HeaderField{Name: "foo", Value: strings.Repeat("a", 100)})
+				headerBlock = buf.Bytes()
+			})
+
+			writeHeaderBlock := func(fragments ...[]byte) {
+				framer := http2.NewFramer(&headerStream.dataToRead, nil)
+				Expect(framer.WriteHeaders(http2.HeadersFrameParam{
+					StreamID:      5,
+					BlockFragment: fragments[0],
+					EndStream:     true,
+					EndHeaders:    len(fragments) == 1,
+				})).To(Succeed())
+				for i, f := range fragments[1:] {
+					Expect(framer.WriteContinuation(5, i == len(fragments)-2, f)).To(Succeed())
+				}
+			}
+
+			It("reads the header block from CONTINUATION frames", func() {
+				var handlerCalled bool
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					Expect(r.Host).To(Equal("www.example.com"))
+					Expect(r.Header.Get("foo")).To(Equal(strings.Repeat("a", 100)))
+					handlerCalled = true
+				})
+				writeHeaderBlock(headerBlock[:10], headerBlock[10:50], headerBlock[50:])
+				err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(func() bool { return handlerCalled }).Should(BeTrue())
+			})
+
+			It("errors when the header block is larger than MaxHeaderBytes", func() {
+				s.MaxHeaderBytes = len(headerBlock) - 1
+				writeHeaderBlock(headerBlock[:10], headerBlock[10:])
+				err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+				Expect(err).To(MatchError("InvalidHeadersStreamData: header block too large"))
+			})
+
+			It("errors when the HEADERS frame is not followed by a CONTINUATION frame", func() {
+				framer := http2.NewFramer(&headerStream.dataToRead, nil)
+				Expect(framer.WriteHeaders(http2.HeadersFrameParam{
+					StreamID:      5,
+					BlockFragment: headerBlock[:10],
+				})).To(Succeed())
+				Expect(framer.WriteData(5, true, []byte("foobar"))).To(Succeed())
+				err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+				Expect(err).To(MatchError("HeadersStreamDataDecompressFailure: cannot read frame"))
+			})
+		})
+
 		It("Cancels the request context when the datstream is closed", func() {
 			var handlerCalled bool
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -287,7 +377,7 @@ var _ = Describe("H2 server", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Expect(dataStream.remoteClosed).To(BeTrue())
-			Expect(dataStream.reset).To(BeFalse())
+			Expect(dataStream.reset.Get()).To(BeFalse())
 		})
 	})
 
@@ -322,6 +412,44 @@ var _ = Describe("H2 server", func() {
 		Expect(session.closedWithError).To(MatchError(qerr.Error(qerr.HeadersStreamDataDecompressFailure, "cannot read frame")))
 	})
 
+	It("closes the connection if a HEADERS frame is larger than MaxHeaderBytes", func() {
+		s.MaxHeaderBytes = 0x10
+		var handlerCalled bool
+		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlerCalled = true
+		})
+		headerStream := &mockStream{id: 3}
+		headerStream.dataToRead.Write([]byte{
+			0x0, 0x0, 0x11, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5,
+			// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+			0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+		})
+		session.streamToAccept = headerStream
+		go s.handleHeaderStream(session)
+		Eventually(func() bool { return session.closed }).Should(BeTrue())
+		Expect(session.closedWithError).To(MatchError(qerr.Error(qerr.HeadersStreamDataDecompressFailure, "cannot read frame")))
+		Expect(handlerCalled).To(BeFalse())
+	})
+
+	It("applies the ReadHeaderTimeout to the header stream", func() {
+		s.ReadHeaderTimeout = time.Hour
+		handlerCalled := make(chan struct{})
+		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(handlerCalled)
+		})
+		headerStream := &mockStream{id: 3}
+		headerStream.dataToRead.Write([]byte{
+			0x0, 0x0, 0x11, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5,
+			// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+			0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+		})
+		session.streamToAccept = headerStream
+		go s.handleHeaderStream(session)
+		Eventually(handlerCalled).Should(BeClosed())
+		// the deadline is removed after the frame was read
+		Eventually(func() time.Time { return headerStream.readDeadline }).Should(BeZero())
+	})
+
 	It("supports closing after first request", func() {
 		s.CloseAfterFirstRequest = true
 		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
@@ -0,0 +1,104 @@
+package http3
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// A body reads the payload of the DATA frames on a request stream.
+// It is used for both request and response bodies.
+type body struct {
+	str quic.Stream
+	// called when the peer sent an invalid sequence of frames
+	onFrameError func(*connectionError)
+	// called with the HEADERS frame that carries the trailers, before its payload was read from the stream
+	// If nil, the trailers are discarded.
+	onTrailers func(*headersFrame) error
+
+	remainingInFrame uint64
+	readTrailers     bool
+	err              error // sticky error
+}
+
+var _ io.Reader = &body{}
+
+func newBody(str quic.Stream, onFrameError func(*connectionError)) *body {
+	return &body{str: str, onFrameError: onFrameError}
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	for b.remainingInFrame == 0 {
+		if err := b.nextFrame(); err != nil {
+			b.err = err
+			return 0, err
+		}
+	}
+	if uint64(len(p)) > b.remainingInFrame {
+		p = p[:b.remainingInFrame]
+	}
+	n, err := b.str.Read(p)
+	b.remainingInFrame -= uint64(n)
+	if err == io.EOF && b.remainingInFrame > 0 {
+		err = b.frameError(errorFrameError, "stream ended within a DATA frame")
+	} else if err == io.EOF {
+		// The next call to Read returns io.EOF, once it has checked that there's no data left.
+		err = nil
+	}
+	if err != nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// nextFrame reads the header of the next DATA frame.
+// Trailers are passed to onTrailers.
+func (b *body) nextFrame() error {
+	f, err := parseNextFrame(b.str)
+	if err != nil {
+		if connErr, ok := err.(*connectionError); ok {
+			b.onFrameError(connErr)
+		}
+		if err == io.ErrUnexpectedEOF {
+			return b.frameError(errorFrameError, "stream ended within a frame")
+		}
+		return err
+	}
+	switch f := f.(type) {
+	case *dataFrame:
+		if b.readTrailers {
+			return b.frameError(errorFrameUnexpected, "DATA frame after the trailers")
+		}
+		b.remainingInFrame = f.Length
+		return nil
+	case *headersFrame:
+		if b.readTrailers {
+			return b.frameError(errorFrameUnexpected, "second HEADERS frame after the body")
+		}
+		b.readTrailers = true
+		if b.onTrailers != nil {
+			err := b.onTrailers(f)
+			if connErr, ok := err.(*connectionError); ok {
+				b.onFrameError(connErr)
+			}
+			return err
+		}
+		if _, err := io.CopyN(ioutil.Discard, b.str, int64(f.Length)); err != nil {
+			return err
+		}
+		return nil
+	default:
+		return b.frameError(errorFrameUnexpected, fmt.Sprintf("unexpected frame on a request stream: %T", f))
+	}
+}
+
+func (b *body) frameError(code errorCode, reason string) error {
+	err := &connectionError{code: code, reason: reason}
+	b.onFrameError(err)
+	return err
+}
@@ -0,0 +1,164 @@
+package http3
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Body", func() {
+	var (
+		str         *mockStream
+		b           *body
+		frameErrors []*connectionError
+	)
+
+	writeData := func(data string) {
+		(&dataFrame{Length: uint64(len(data))}).Write(&str.dataToRead)
+		str.dataToRead.WriteString(data)
+	}
+
+	BeforeEach(func() {
+		str = newMockStream(4)
+		frameErrors = nil
+		b = newBody(str, func(err *connectionError) { frameErrors = append(frameErrors, err) })
+	})
+
+	It("reads the payload of a DATA frame", func() {
+		writeData("foobar")
+		data, err := ioutil.ReadAll(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+	})
+
+	It("reads the payload of multiple DATA frames", func() {
+		writeData("foo")
+		writeData("")
+		writeData("bar")
+		data, err := ioutil.ReadAll(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+	})
+
+	It("doesn't read beyond the DATA frame", func() {
+		writeData("foo")
+		writeData("bar")
+		p := make([]byte, 10)
+		n, err := b.Read(p)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p[:n]).To(Equal([]byte("foo")))
+	})
+
+	It("skips unknown frames", func() {
+		writeData("foo")
+		utils.WriteVarInt(&str.dataToRead, 0x21)
+		utils.WriteVarInt(&str.dataToRead, 3)
+		str.dataToRead.WriteString("baz")
+		writeData("bar")
+		data, err := ioutil.ReadAll(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+	})
+
+	It("discards the trailers", func() {
+		writeData("foobar")
+		(&headersFrame{Length: 4}).Write(&str.dataToRead)
+		str.dataToRead.Write([]byte{0, 0, 0, 0})
+		data, err := ioutil.ReadAll(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+	})
+
+	It("passes the trailers to onTrailers", func() {
+		var trailers []*headersFrame
+		b.onTrailers = func(f *headersFrame) error {
+			trailers = append(trailers, f)
+			_, err := io.CopyN(ioutil.Discard, str, int64(f.Length))
+			return err
+		}
+		writeData("foobar")
+		(&headersFrame{Length: 4}).Write(&str.dataToRead)
+		str.dataToRead.Write([]byte{0, 0, 0, 0})
+		data, err := ioutil.ReadAll(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+		Expect(trailers).To(Equal([]*headersFrame{{Length: 4}}))
+	})
+
+	It("closes the connection if onTrailers returns a connection error", func() {
+		b.onTrailers = func(*headersFrame) error {
+			return &connectionError{code: errorQPACKDecompressionFailed, reason: "foobar"}
+		}
+		(&headersFrame{Length: 4}).Write(&str.dataToRead)
+		str.dataToRead.Write([]byte{0, 0, 0, 0})
+		_, err := ioutil.ReadAll(b)
+		Expect(err).To(MatchError("QPACK_DECOMPRESSION_FAILED: foobar"))
+		Expect(frameErrors).To(HaveLen(1))
+	})
+
+	It("errors on DATA frames after the trailers", func() {
+		(&headersFrame{Length: 2}).Write(&str.dataToRead)
+		str.dataToRead.Write([]byte{0, 0})
+		writeData("foobar")
+		_, err := ioutil.ReadAll(b)
+		Expect(err).To(MatchError("H3_FRAME_UNEXPECTED: DATA frame after the trailers"))
+		Expect(frameErrors).To(HaveLen(1))
+		Expect(frameErrors[0].code).To(Equal(errorFrameUnexpected))
+	})
+
+	It("errors on unexpected frames", func() {
+		(&goAwayFrame{ID: 4}).Write(&str.dataToRead)
+		_, err := b.Read(make([]byte, 10))
+		Expect(err).To(MatchError("H3_FRAME_UNEXPECTED: unexpected frame on a request stream: *http3.goAwayFrame"))
+		Expect(frameErrors).To(HaveLen(1))
+	})
+
+	It("errors when the stream ends within a DATA frame", func() {
+		(&dataFrame{Length: 10}).Write(&str.dataToRead)
+		str.dataToRead.WriteString("foo")
+		data, err := ioutil.ReadAll(b)
+		Expect(data).To(Equal([]byte("foo")))
+		Expect(err).To(MatchError("H3_FRAME_ERROR: stream ended within a DATA frame"))
+		Expect(frameErrors).To(HaveLen(1))
+		Expect(frameErrors[0].code).To(Equal(errorFrameError))
+	})
+
+	It("errors when the stream ends within a frame header", func() {
+		str.dataToRead.Write([]byte{frameTypeData})
+		_, err := b.Read(make([]byte, 10))
+		Expect(err).To(MatchError("H3_FRAME_ERROR: stream ended within a frame"))
+		Expect(frameErrors).To(HaveLen(1))
+	})
+
+	It("returns sticky errors", func() {
+		(&goAwayFrame{ID: 4}).Write(&str.dataToRead)
+		_, err := b.Read(make([]byte, 10))
+		Expect(err).To(HaveOccurred())
+		writeData("foobar")
+		_, err2 := b.Read(make([]byte, 10))
+		Expect(err2).To(Equal(err))
+		Expect(frameErrors).To(HaveLen(1))
+	})
+
+	It("returns io.EOF", func() {
+		n, err := b.Read(make([]byte, 10))
+		Expect(n).To(BeZero())
+		Expect(err).To(Equal(io.EOF))
+		Expect(frameErrors).To(BeEmpty())
+	})
+
+	It("doesn't read more than the DATA frame from the stream", func() {
+		writeData("foo")
+		str.dataToRead.WriteString("not a frame")
+		p := make([]byte, 100)
+		n, err := b.Read(p)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(3))
+		Expect(str.dataToRead.String()).To(Equal("not a frame"))
+	})
+
+})
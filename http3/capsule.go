@@ -0,0 +1,57 @@
+package http3
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// The capsule types, see Section 3.5 of RFC 9297, and Section 5 of draft-ietf-webtrans-http3-02.
+// Capsules are sent in the payload of the DATA frames on a request stream.
+const (
+	capsuleTypeDatagram                 = 0x00
+	capsuleTypeCloseWebTransportSession = 0x2843
+)
+
+var errMalformedCapsule = errors.New("http3: malformed capsule")
+
+// readCapsuleHeader reads the type and the length of the next capsule.
+// If r ends before the first byte of a capsule, io.EOF is returned.
+// If it ends within the capsule header, errMalformedCapsule is returned.
+func readCapsuleHeader(r io.Reader) (capsuleType, length uint64, err error) {
+	br := &byteReader{Reader: r}
+	capsuleType, err = utils.ReadVarInt(br)
+	if err != nil {
+		if err == io.EOF && br.n == 0 {
+			return 0, 0, io.EOF
+		}
+		return 0, 0, capsuleError(err)
+	}
+	length, err = utils.ReadVarInt(br)
+	if err != nil {
+		return 0, 0, capsuleError(err)
+	}
+	return capsuleType, length, nil
+}
+
+// skipCapsule skips the payload of a capsule
+func skipCapsule(r io.Reader, length uint64) error {
+	_, err := io.CopyN(ioutil.Discard, r, int64(length))
+	return capsuleError(err)
+}
+
+func writeCapsuleHeader(b *bytes.Buffer, capsuleType, length uint64) {
+	utils.WriteVarInt(b, capsuleType)
+	utils.WriteVarInt(b, length)
+}
+
+// capsuleError converts the error returned when r ends within a capsule
+func capsuleError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errMalformedCapsule
+	}
+	return err
+}
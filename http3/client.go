@@ -0,0 +1,477 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/idna"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3/qpack"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+type roundTripperOpts struct {
+	DisableCompression        bool
+	DisableContentLengthCheck bool
+	MaxHeaderBytes            int64
+	QPACKConfig               *qpack.Config
+}
+
+var dialAddr = quic.DialAddr
+
+// the maximum number of informational (1xx) responses that are accepted before the final response
+// the same limit is used by net/http
+const max1xxResponses = 5
+
+// the size of the DATA frames used to send the request body
+const requestBodyFrameSize = 16 * 1024
+
+var (
+	errTooMany1xxResponses = errors.New("http3: too many 1xx informational responses")
+	errGoingAway           = errors.New("http3: the server is going away")
+	// errRequestRejected is returned for requests that the server didn't process, since they raced with a GOAWAY frame.
+	errRequestRejected = errors.New("http3: the request was rejected by the server")
+)
+
+// client is a HTTP/3 client doing requests to one host
+type client struct {
+	tlsConf *tls.Config
+	config  *quic.Config
+	opts    *roundTripperOpts
+
+	hostname     string
+	handshakeErr error
+	dialOnce     sync.Once
+	dialer       func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error)
+
+	session       quic.Session
+	conn          *connection
+	requestWriter *requestWriter // created when dialing, since it uses the QPACK encoder of the connection
+
+	mutex          sync.Mutex
+	goingAway      bool
+	goAwayID       uint64        // the ID of the first request stream that the server won't process
+	goAwayChan     chan struct{} // closed when the GOAWAY frame is received
+	activeRequests int
+
+	logger utils.Logger
+}
+
+var _ roundTripCloser = &client{}
+
+// newClient creates a new client
+func newClient(
+	hostname string,
+	tlsConfig *tls.Config,
+	opts *roundTripperOpts,
+	quicConfig *quic.Config,
+	dialer func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error),
+) *client {
+	var tlsConf *tls.Config
+	if tlsConfig == nil {
+		tlsConf = &tls.Config{}
+	} else {
+		tlsConf = tlsConfig.Clone()
+	}
+	tlsConf.NextProtos = []string{nextProtoH3}
+	config := &quic.Config{KeepAlive: true}
+	if quicConfig != nil {
+		c := *quicConfig
+		config = &c
+	}
+	config.Versions = []quic.VersionNumber{protocol.VersionTLS}
+	return &client{
+		hostname:   authorityAddr("https", hostname),
+		tlsConf:    tlsConf,
+		config:     config,
+		opts:       opts,
+		dialer:     dialer,
+		goAwayChan: make(chan struct{}),
+		logger:     utils.DefaultLogger.WithPrefix("client"),
+	}
+}
+
+// dial dials the connection
+func (c *client) dial() error {
+	var err error
+	if c.dialer != nil {
+		c.session, err = c.dialer("udp", c.hostname, c.tlsConf, c.config)
+	} else {
+		c.session, err = dialAddr(c.hostname, c.tlsConf, c.config)
+	}
+	if err != nil {
+		return err
+	}
+	if proto := c.session.ConnectionState().NegotiatedProtocol; proto != nextProtoH3 {
+		c.session.CloseWithError(quic.ErrorCode(errorVersionFallback), "")
+		return fmt.Errorf("http3: server didn't negotiate HTTP/3 (ALPN: %q)", proto)
+	}
+	settings := map[uint64]uint64{settingMaxFieldSectionSize: c.maxHeaderBytes()}
+	c.conn = newConnection(c.session, false, settings, c.opts.QPACKConfig, c.handleGoAway, c.logger)
+	if err := c.conn.start(); err != nil {
+		return err
+	}
+	c.requestWriter = newRequestWriter(c.conn.encoder, c.logger)
+	return nil
+}
+
+// handleGoAway is called when the server sends a GOAWAY frame.
+// Requests that are already in flight are allowed to complete, but no new requests are sent.
+// Requests on streams with an ID of at least id were not processed by the server, and fail with errRequestRejected.
+// Once all requests have completed, the connection is closed, see Section 5.2 of RFC 9114.
+func (c *client) handleGoAway(id uint64) {
+	c.mutex.Lock()
+	// The server may send multiple GOAWAY frames, each with a lower ID.
+	if !c.goingAway || id < c.goAwayID {
+		c.goAwayID = id
+	}
+	if !c.goingAway {
+		c.goingAway = true
+		close(c.goAwayChan)
+	}
+	idle := c.activeRequests == 0
+	c.mutex.Unlock()
+	if idle {
+		c.Close()
+	}
+}
+
+// startRequest is called before a request is sent.
+// It returns false if the server sent a GOAWAY frame.
+func (c *client) startRequest() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.goingAway {
+		return false
+	}
+	c.activeRequests++
+	return true
+}
+
+// completeRequest is called when a request failed, or when the response body was read completely or closed.
+func (c *client) completeRequest() {
+	c.mutex.Lock()
+	c.activeRequests--
+	idle := c.goingAway && c.activeRequests == 0
+	c.mutex.Unlock()
+	if idle {
+		c.Close()
+	}
+}
+
+// isRejected says if the request on the stream was rejected by a GOAWAY frame.
+func (c *client) isRejected(id quic.StreamID) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.goingAway && uint64(id) >= c.goAwayID
+}
+
+// isGoingAway says if the server sent a GOAWAY frame.
+func (c *client) isGoingAway() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.goingAway
+}
+
+// RoundTrip executes a request and returns a response
+func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" {
+		return nil, errors.New("http3: unsupported scheme")
+	}
+	if authorityAddr("https", hostnameFromRequest(req)) != c.hostname {
+		return nil, fmt.Errorf("http3 client BUG: RoundTrip called for the wrong client (expected %s, got %s)", c.hostname, req.Host)
+	}
+
+	c.dialOnce.Do(func() {
+		c.handshakeErr = c.dial()
+	})
+
+	if c.handshakeErr != nil {
+		return nil, c.handshakeErr
+	}
+	if !c.startRequest() {
+		return nil, errGoingAway
+	}
+	res, err := c.roundTrip(req)
+	if err != nil {
+		c.completeRequest()
+		return nil, err
+	}
+	return res, nil
+}
+
+// roundTrip sends the request, and reads the response header.
+// If it doesn't return an error, the request is completed when the response body was read completely, or closed.
+func (c *client) roundTrip(req *http.Request) (*http.Response, error) {
+	if isExtendedConnect(req) {
+		if err := c.checkExtendedConnect(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+
+	str, err := c.session.OpenStreamSync()
+	if err != nil {
+		return nil, err
+	}
+
+	var requestedGzip bool
+	if !c.opts.DisableCompression && req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" && req.Method != "HEAD" {
+		requestedGzip = true
+	}
+	if err := c.requestWriter.WriteRequestHeader(str, req, requestedGzip); err != nil {
+		cancelStream(str, errorRequestCanceled)
+		return nil, err
+	}
+
+	// This will write the request body in a separate goroutine.
+	// If writing the body fails before the response was received, the error is returned.
+	var requestBodyErr chan error
+	if req.Body != nil {
+		requestBodyErr = make(chan error, 1)
+		go func() {
+			requestBodyErr <- c.writeRequestBody(str, req.Body, req.Trailer)
+		}()
+	} else {
+		str.Close()
+	}
+
+	ctx := req.Context()
+	type responseOrError struct {
+		rsp *http.Response
+		err error
+	}
+	responseChan := make(chan responseOrError, 1)
+	go func() {
+		rsp, err := c.readResponse(str, ctx)
+		responseChan <- responseOrError{rsp: rsp, err: err}
+	}()
+
+	goAwayChan := c.goAwayChan
+	var res *http.Response
+	for res == nil {
+		select {
+		case r := <-responseChan:
+			if r.err != nil {
+				cancelStream(str, errorRequestCanceled)
+				if serr, ok := r.err.(quic.StreamError); ok && serr.ErrorCode() == quic.ErrorCode(errorRequestRejected) {
+					return nil, errRequestRejected
+				}
+				return nil, r.err
+			}
+			res = r.rsp
+		case <-goAwayChan:
+			if c.isRejected(str.StreamID()) {
+				cancelStream(str, errorRequestCanceled)
+				return nil, errRequestRejected
+			}
+			// the request is processed by the server, continue waiting for the response
+			goAwayChan = nil
+		case err := <-requestBodyErr:
+			if err == nil {
+				// the body was written, continue waiting for the response
+				requestBodyErr = nil
+				continue
+			}
+			// writeRequestBody already canceled writing
+			str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+			return nil, err
+		case <-ctx.Done():
+			cancelStream(str, errorRequestCanceled)
+			return nil, ctx.Err()
+		}
+	}
+
+	if req.Method == "HEAD" {
+		// The response to a HEAD request doesn't have a body.
+		str.CancelRead(quic.ErrorCode(errorNoError))
+		res.Body = noBody
+		c.completeRequest()
+	} else {
+		b := newBody(str, c.conn.closeWithError)
+		b.onTrailers = func(f *headersFrame) error {
+			return c.conn.readTrailers(ctx, str, f, c.maxHeaderBytes(), &res.Trailer)
+		}
+		res.Body = newResponseBody(b, str, ctx, c.completeRequest)
+		if !c.opts.DisableContentLengthCheck && res.ContentLength >= 0 {
+			res.Body = &contentLengthBody{body: res.Body, remaining: res.ContentLength}
+		}
+		if requestedGzip && res.Header.Get("Content-Encoding") == "gzip" {
+			res.Header.Del("Content-Encoding")
+			res.Header.Del("Content-Length")
+			res.ContentLength = -1
+			res.Body = &gzipReader{body: res.Body}
+			res.Uncompressed = true
+		}
+	}
+
+	res.Request = req
+	return res, nil
+}
+
+// checkExtendedConnect waits for the server's SETTINGS, and checks that the server enabled Extended CONNECT.
+func (c *client) checkExtendedConnect(ctx context.Context) error {
+	select {
+	case <-c.conn.receivedSettings:
+	case <-c.session.Context().Done():
+		return errors.New("http3: connection closed before the server's SETTINGS were received")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if val, _ := c.conn.peerSetting(settingEnableConnectProtocol); val != 1 {
+		return errors.New("http3: server didn't enable Extended CONNECT")
+	}
+	return nil
+}
+
+// maxHeaderBytes is the maximum size of a HEADERS frame of the response
+func (c *client) maxHeaderBytes() uint64 {
+	if c.opts.MaxHeaderBytes <= 0 {
+		return http.DefaultMaxHeaderBytes
+	}
+	return uint64(c.opts.MaxHeaderBytes)
+}
+
+// readResponse reads the response headers from the request stream.
+// Informational (1xx) responses are skipped.
+func (c *client) readResponse(str quic.Stream, ctx context.Context) (*http.Response, error) {
+	var num1xx int
+	for {
+		f, err := parseNextFrame(str)
+		if err != nil {
+			if connErr, ok := err.(*connectionError); ok {
+				c.conn.closeWithError(connErr)
+			}
+			return nil, err
+		}
+		if _, ok := f.(*pushPromiseFrame); ok {
+			// We never send a MAX_PUSH_ID frame, so the server is not allowed to push.
+			err := &connectionError{code: errorIDError, reason: "received a PUSH_PROMISE frame"}
+			c.conn.closeWithError(err)
+			return nil, err
+		}
+		hf, ok := f.(*headersFrame)
+		if !ok {
+			err := &connectionError{code: errorFrameUnexpected, reason: "expected first frame to be a HEADERS frame"}
+			c.conn.closeWithError(err)
+			return nil, err
+		}
+		if hf.Length > c.maxHeaderBytes() {
+			return nil, fmt.Errorf("http3: HEADERS frame too large (%d bytes)", hf.Length)
+		}
+		headerBlock := make([]byte, hf.Length)
+		if _, err := io.ReadFull(str, headerBlock); err != nil {
+			return nil, err
+		}
+		headers, err := c.conn.decoder.DecodeFieldSection(ctx, uint64(str.StreamID()), headerBlock, c.maxHeaderBytes())
+		if err != nil {
+			if ctx.Err() != nil {
+				// The request was canceled while the field section was blocked.
+				return nil, err
+			}
+			if err == qpack.ErrFieldSectionTooLarge {
+				return nil, errors.New("http3: response headers too large")
+			}
+			c.conn.closeWithError(&connectionError{code: errorQPACKDecompressionFailed, reason: err.Error()})
+			return nil, err
+		}
+		res, err := responseFromHeaders(headers)
+		if err != nil {
+			return nil, err
+		}
+		// Informational (1xx) responses are followed by the final response.
+		if res.StatusCode >= 100 && res.StatusCode <= 199 {
+			num1xx++
+			if num1xx > max1xxResponses {
+				return nil, errTooMany1xxResponses
+			}
+			if res.StatusCode == 100 {
+				if trace := httptrace.ContextClientTrace(ctx); trace != nil && trace.Got100Continue != nil {
+					trace.Got100Continue()
+				}
+			}
+			continue
+		}
+		return res, nil
+	}
+}
+
+// writeRequestBody writes the request body in DATA frames, closes the body, and writes the trailers.
+// If reading or closing the body fails, the request stream is reset.
+func (c *client) writeRequestBody(str quic.Stream, body io.ReadCloser, trailer http.Header) error {
+	err := c.writeDataFrames(str, body)
+	if cerr := body.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && len(trailer) > 0 {
+		// The values of the trailers might have been set while the body was read.
+		err = c.requestWriter.WriteRequestTrailer(str, trailer)
+	}
+	if err != nil {
+		str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+		return err
+	}
+	return str.Close()
+}
+
+func (c *client) writeDataFrames(str quic.Stream, body io.Reader) error {
+	buf := make([]byte, requestBodyFrameSize)
+	hdr := &bytes.Buffer{}
+	for {
+		n, rerr := body.Read(buf)
+		if n > 0 {
+			hdr.Reset()
+			(&dataFrame{Length: uint64(n)}).Write(hdr)
+			if _, err := str.WriteVectored([][]byte{hdr.Bytes(), buf[:n]}); err != nil {
+				return err
+			}
+		}
+		if rerr == io.EOF {
+			return nil
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+}
+
+// Close closes the client
+func (c *client) Close() error {
+	if c.session == nil {
+		return nil
+	}
+	return c.session.CloseWithError(quic.ErrorCode(errorNoError), "")
+}
+
+// copied from net/transport.go
+
+// authorityAddr returns a given authority (a host/IP, or host:port / ip:port)
+// and returns a host:port. The port 443 is added if needed.
+func authorityAddr(scheme string, authority string) (addr string) {
+	host, port, err := net.SplitHostPort(authority)
+	if err != nil { // authority didn't have a port
+		port = "443"
+		if scheme == "http" {
+			port = "80"
+		}
+		host = authority
+	}
+	if a, err := idna.ToASCII(host); err == nil {
+		host = a
+	}
+	// IPv6 address literal, without a port:
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		return host + ":" + port
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,401 @@
+package http3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// listenRaw starts a QUIC listener that negotiates h3, without starting a HTTP/3 server
+func listenRaw(nextProtos []string) (quic.Listener, string) {
+	tlsConf := testdata.GetTLSConfig()
+	tlsConf.NextProtos = nextProtos
+	ln, err := quic.ListenAddr("127.0.0.1:0", tlsConf, &quic.Config{Versions: []quic.VersionNumber{protocol.VersionTLS}})
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	return ln, ln.Addr().String()
+}
+
+var _ = Describe("Client", func() {
+	var (
+		cl  *client
+		req *http.Request
+	)
+
+	newTestClient := func(addr string) {
+		cl = newClient(addr, getClientTLSConfig(), &roundTripperOpts{}, nil, nil)
+		var err error
+		req, err = http.NewRequest("GET", "https://"+addr+"/file.html", nil)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	AfterEach(func() {
+		if cl != nil {
+			cl.Close()
+		}
+	})
+
+	It("rejects requests that don't use https", func() {
+		newTestClient("localhost:1337")
+		req.URL.Scheme = "http"
+		_, err := cl.RoundTrip(req)
+		Expect(err).To(MatchError("http3: unsupported scheme"))
+	})
+
+	It("rejects requests for the wrong host", func() {
+		newTestClient("localhost:1337")
+		req.Host = "quic.clemente.io"
+		_, err := cl.RoundTrip(req)
+		Expect(err).To(MatchError("http3 client BUG: RoundTrip called for the wrong client (expected localhost:1337, got quic.clemente.io)"))
+	})
+
+	It("returns the dial error", func() {
+		testErr := errors.New("dial error")
+		origDialAddr := dialAddr
+		defer func() { dialAddr = origDialAddr }()
+		dialAddr = func(string, *tls.Config, *quic.Config) (quic.Session, error) {
+			return nil, testErr
+		}
+		newTestClient("localhost:1337")
+		_, err := cl.RoundTrip(req)
+		Expect(err).To(MatchError(testErr))
+		// the error is returned for subsequent requests as well
+		_, err = cl.RoundTrip(req)
+		Expect(err).To(MatchError(testErr))
+	})
+
+	It("errors if the server doesn't negotiate h3", func() {
+		ln, addr := listenRaw(nil)
+		defer ln.Close()
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			sess, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			expectSessionClosedWithError(sess, errorVersionFallback)
+		}()
+		newTestClient(addr)
+		_, err := cl.RoundTrip(req)
+		Expect(err).To(MatchError(`http3: server didn't negotiate HTTP/3 (ALPN: "")`))
+		Eventually(done).Should(BeClosed())
+	})
+
+	Context("violations of the protocol", func() {
+		var (
+			ln   quic.Listener
+			addr string
+		)
+
+		BeforeEach(func() {
+			ln, addr = listenRaw([]string{nextProtoH3})
+			newTestClient(addr)
+		})
+
+		AfterEach(func() {
+			ln.Close()
+		})
+
+		// dial establishes the connection, without sending a request
+		dial := func() error {
+			cl.dialOnce.Do(func() { cl.handshakeErr = cl.dial() })
+			return cl.handshakeErr
+		}
+
+		// acceptSession accepts the client's session, and sends the SETTINGS
+		acceptSession := func() quic.Session {
+			sess, err := ln.Accept()
+			ExpectWithOffset(1, err).ToNot(HaveOccurred())
+			openControlStream(sess)
+			return sess
+		}
+
+		It("closes the connection if the server opens a push stream", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				sess := acceptSession()
+				str, err := sess.OpenUniStream()
+				Expect(err).ToNot(HaveOccurred())
+				_, err = str.Write([]byte{streamTypePush})
+				Expect(err).ToNot(HaveOccurred())
+				expectSessionClosedWithError(sess, errorIDError)
+			}()
+			Expect(dial()).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("closes the connection if the response doesn't start with a HEADERS frame", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				sess := acceptSession()
+				str, err := sess.AcceptStream()
+				Expect(err).ToNot(HaveOccurred())
+				b := &bytes.Buffer{}
+				(&dataFrame{Length: 6}).Write(b)
+				b.WriteString("foobar")
+				_, err = str.Write(b.Bytes())
+				Expect(err).ToNot(HaveOccurred())
+				expectSessionClosedWithError(sess, errorFrameUnexpected)
+			}()
+			_, err := cl.RoundTrip(req)
+			Expect(err).To(MatchError("H3_FRAME_UNEXPECTED: expected first frame to be a HEADERS frame"))
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("rejects responses with HEADERS frames that are too large", func() {
+			cl.opts.MaxHeaderBytes = 1000
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				sess := acceptSession()
+				str, err := sess.AcceptStream()
+				Expect(err).ToNot(HaveOccurred())
+				b := &bytes.Buffer{}
+				(&headersFrame{Length: 1 << 60}).Write(b)
+				_, err = str.Write(b.Bytes())
+				Expect(err).ToNot(HaveOccurred())
+			}()
+			_, err := cl.RoundTrip(req)
+			Expect(err).To(MatchError("http3: HEADERS frame too large (1152921504606846976 bytes)"))
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("closes the connection if the server sends a PUSH_PROMISE frame", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				sess := acceptSession()
+				str, err := sess.AcceptStream()
+				Expect(err).ToNot(HaveOccurred())
+				b := &bytes.Buffer{}
+				(&pushPromiseFrame{PushID: 0, Length: 2}).Write(b)
+				b.Write([]byte{0, 0})
+				_, err = str.Write(b.Bytes())
+				Expect(err).ToNot(HaveOccurred())
+				expectSessionClosedWithError(sess, errorIDError)
+			}()
+			_, err := cl.RoundTrip(req)
+			Expect(err).To(MatchError("H3_ID_ERROR: received a PUSH_PROMISE frame"))
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("closes the connection if the server sends a CANCEL_PUSH frame", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				sess, err := ln.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				str := openControlStream(sess)
+				b := &bytes.Buffer{}
+				(&cancelPushFrame{PushID: 0}).Write(b)
+				_, err = str.Write(b.Bytes())
+				Expect(err).ToNot(HaveOccurred())
+				expectSessionClosedWithError(sess, errorIDError)
+			}()
+			Expect(dial()).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("doesn't send requests after receiving a GOAWAY frame", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				sess, err := ln.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				str := openControlStream(sess)
+				b := &bytes.Buffer{}
+				(&goAwayFrame{ID: 0}).Write(b)
+				_, err = str.Write(b.Bytes())
+				Expect(err).ToNot(HaveOccurred())
+				// There are no requests in flight, so the client closes the connection.
+				expectSessionClosedWithError(sess, errorNoError)
+			}()
+			Expect(dial()).To(Succeed())
+			Eventually(cl.isGoingAway).Should(BeTrue())
+			_, err := cl.RoundTrip(req)
+			Expect(err).To(MatchError(errGoingAway))
+			cl.Close()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("fails requests that the server didn't process because of the GOAWAY frame", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				sess, err := ln.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				ctrl := openControlStream(sess)
+				str, err := sess.AcceptStream()
+				Expect(err).ToNot(HaveOccurred())
+				b := &bytes.Buffer{}
+				(&goAwayFrame{ID: uint64(str.StreamID())}).Write(b)
+				_, err = ctrl.Write(b.Bytes())
+				Expect(err).ToNot(HaveOccurred())
+				// There are no other requests in flight, so the client closes the connection.
+				expectSessionClosedWithError(sess, errorNoError)
+			}()
+			_, err := cl.RoundTrip(req)
+			Expect(err).To(MatchError(errRequestRejected))
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("fails requests that the server rejected", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				sess := acceptSession()
+				str, err := sess.AcceptStream()
+				Expect(err).ToNot(HaveOccurred())
+				cancelStream(str, errorRequestRejected)
+			}()
+			_, err := cl.RoundTrip(req)
+			Expect(err).To(MatchError(errRequestRejected))
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	Context("doing requests", func() {
+		var (
+			s    *Server
+			addr string
+			mux  *http.ServeMux
+		)
+
+		BeforeEach(func() {
+			mux = http.NewServeMux()
+			s, addr = startServer(mux)
+			newTestClient(addr)
+		})
+
+		AfterEach(func() {
+			Expect(s.Close()).To(Succeed())
+		})
+
+		It("returns the request context error", func() {
+			handlerCanceled := make(chan struct{})
+			mux.HandleFunc("/block", func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+				close(handlerCanceled)
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			req, err := http.NewRequest("GET", "https://"+addr+"/block", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req = req.WithContext(ctx)
+			errChan := make(chan error)
+			go func() {
+				_, err := cl.RoundTrip(req)
+				errChan <- err
+			}()
+			Consistently(errChan).ShouldNot(Receive())
+			cancel()
+			Eventually(errChan).Should(Receive(MatchError(context.Canceled)))
+			Eventually(handlerCanceled).Should(BeClosed())
+		})
+
+		It("cancels the request stream if a request is canceled after the response was received", func() {
+			mux.HandleFunc("/block", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("foo"))
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			req, err := http.NewRequest("GET", "https://"+addr+"/block", nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := cl.RoundTrip(req.WithContext(ctx))
+			Expect(err).ToNot(HaveOccurred())
+			b := make([]byte, 3)
+			_, err = io.ReadFull(rsp.Body, b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b)).To(Equal("foo"))
+			cancel()
+			_, err = rsp.Body.Read(b)
+			Expect(err).To(MatchError(context.Canceled))
+		})
+
+		It("returns errors that occur when reading the request body", func() {
+			mux.HandleFunc("/block", func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			})
+			testErr := errors.New("read error")
+			req, err := http.NewRequest("POST", "https://"+addr+"/block", &mockBody{readErr: testErr})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = cl.RoundTrip(req)
+			Expect(err).To(MatchError(testErr))
+			Expect(req.Body.(*mockBody).closed).To(BeTrue())
+		})
+
+		It("decompresses gzipped responses", func() {
+			mux.HandleFunc("/gzip", func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Header.Get("Accept-Encoding")).To(Equal("gzip"))
+				w.Header().Set("Content-Encoding", "gzip")
+				gz := gzip.NewWriter(w)
+				gz.Write([]byte("Hello, World!"))
+				gz.Close()
+			})
+			req, err := http.NewRequest("GET", "https://"+addr+"/gzip", nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := cl.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Uncompressed).To(BeTrue())
+			Expect(rsp.Header.Get("Content-Encoding")).To(BeEmpty())
+			body, err := ioutil.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal("Hello, World!"))
+		})
+
+		It("checks the content length", func() {
+			mux.HandleFunc("/short", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", "10")
+				w.Write([]byte("foo"))
+			})
+			req, err := http.NewRequest("GET", "https://"+addr+"/short", nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := cl.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.ContentLength).To(BeEquivalentTo(10))
+			_, err = ioutil.ReadAll(rsp.Body)
+			Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+		})
+
+		It("closes the response body", func() {
+			handlerDone := make(chan struct{})
+			mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+				defer close(handlerDone)
+				for {
+					if _, err := w.Write(make([]byte, 1000)); err != nil {
+						return
+					}
+				}
+			})
+			req, err := http.NewRequest("GET", "https://"+addr+"/large", nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := cl.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Body.Close()).To(Succeed())
+			Eventually(handlerDone, 5*time.Second).Should(BeClosed())
+		})
+	})
+})
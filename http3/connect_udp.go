@@ -0,0 +1,249 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// connectUDPProtocol is the value of the :protocol pseudo-header of CONNECT-UDP requests, see RFC 9298.
+const connectUDPProtocol = "connect-udp"
+
+// connectUDPPathPrefix is the beginning of the path of the default URI template /.well-known/masque/udp/{target_host}/{target_port}/,
+// see Section 3 of RFC 9298.
+const connectUDPPathPrefix = "/.well-known/masque/udp/"
+
+// maxUDPPayloadSize is the maximum size of a UDP payload
+const maxUDPPayloadSize = 65527
+
+// maxDatagramCapsuleSize is the maximum size of the payload of a DATAGRAM capsule carrying a UDP payload.
+// The UDP payload is preceded by the Context ID, which is a varint.
+const maxDatagramCapsuleSize = 8 + maxUDPPayloadSize
+
+// A ConnectUDPConn is a UDP tunnel through a proxy, established by a CONNECT-UDP request, see RFC 9298.
+// Each call to Read returns a single UDP payload, and each call to Write sends a single UDP payload.
+// The payloads are sent in DATAGRAM capsules on the request stream, since the QUIC layer doesn't support the DATAGRAM frame yet.
+type ConnectUDPConn struct {
+	r         io.Reader
+	w         io.Writer
+	closeFunc func() error
+
+	readMutex sync.Mutex
+	readBuf   []byte
+
+	writeMutex sync.Mutex
+}
+
+var _ io.ReadWriteCloser = &ConnectUDPConn{}
+
+func newConnectUDPConn(r io.Reader, w io.Writer, closeFunc func() error) *ConnectUDPConn {
+	return &ConnectUDPConn{
+		r:         r,
+		w:         w,
+		closeFunc: closeFunc,
+	}
+}
+
+// DialConnectUDP establishes a UDP tunnel to the target (a host:port) through a CONNECT-UDP proxy.
+// The template is the URI template of the proxy, e.g. https://proxy.example.org/.well-known/masque/udp/{target_host}/{target_port}/.
+// The tunnel is closed when ctx is canceled.
+func (r *RoundTripper) DialConnectUDP(ctx context.Context, template, target string) (*ConnectUDPConn, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	u := strings.NewReplacer(
+		"{target_host}", escapeTemplateVariable(host),
+		"{target_port}", escapeTemplateVariable(port),
+	).Replace(template)
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(http.MethodConnect, u, pr)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Proto = connectUDPProtocol
+	req.Header.Set("Capsule-Protocol", "?1")
+	rsp, err := r.RoundTrip(req)
+	if err != nil {
+		pw.Close()
+		return nil, err
+	}
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		pw.Close()
+		rsp.Body.Close()
+		return nil, fmt.Errorf("http3: CONNECT-UDP request failed: %s", rsp.Status)
+	}
+	return newConnectUDPConn(rsp.Body, pw, func() error {
+		pw.Close()
+		return rsp.Body.Close()
+	}), nil
+}
+
+// ProxyConnectUDP handles a CONNECT-UDP request, see RFC 9298.
+// The target is taken from the request path, which has to follow the default URI template /.well-known/masque/udp/{target_host}/{target_port}/.
+// It dials the target, and forwards UDP payloads between the client and the target, until the client closes the request stream.
+// Any target is proxied, so handlers should check the request before calling ProxyConnectUDP.
+// Extended CONNECT has to be enabled on the server, see Server.EnableExtendedConnect.
+func ProxyConnectUDP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect || r.Proto != connectUDPProtocol {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	target, err := parseConnectUDPTarget(r.URL.EscapedPath())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	conn, err := net.Dial("udp", target)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer conn.Close()
+
+	// Undo the http.Server's ReadTimeout, the tunnel might stay open for a long time.
+	if rw, ok := w.(*responseWriter); ok && rw.requestStream != nil {
+		rw.requestStream.SetReadDeadline(time.Time{})
+	}
+	w.Header().Set("Capsule-Protocol", "?1")
+	w.WriteHeader(http.StatusOK)
+	tunnel := newConnectUDPConn(r.Body, w, nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b := make([]byte, maxUDPPayloadSize)
+		for {
+			n, err := conn.Read(b)
+			if err != nil {
+				return
+			}
+			if _, err := tunnel.Write(b[:n]); err != nil {
+				return
+			}
+		}
+	}()
+
+	b := make([]byte, maxUDPPayloadSize)
+	for {
+		n, err := tunnel.Read(b)
+		if err != nil {
+			break
+		}
+		// UDP packets might be lost anyway, so there's no need to handle write errors.
+		conn.Write(b[:n])
+	}
+	conn.Close()
+	<-done
+}
+
+// parseConnectUDPTarget parses the target host and port from the path of a CONNECT-UDP request.
+func parseConnectUDPTarget(path string) (string, error) {
+	if !strings.HasPrefix(path, connectUDPPathPrefix) {
+		return "", errors.New("http3: invalid CONNECT-UDP path")
+	}
+	parts := strings.Split(strings.TrimPrefix(path, connectUDPPathPrefix), "/")
+	if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3 && parts[2] != "") {
+		return "", errors.New("http3: invalid CONNECT-UDP path")
+	}
+	host, err := url.PathUnescape(parts[0])
+	if err != nil {
+		return "", err
+	}
+	port, err := url.PathUnescape(parts[1])
+	if err != nil {
+		return "", err
+	}
+	if len(host) == 0 {
+		return "", errors.New("http3: empty CONNECT-UDP target host")
+	}
+	if p, err := strconv.ParseUint(port, 10, 16); err != nil || p == 0 {
+		return "", fmt.Errorf("http3: invalid CONNECT-UDP target port %q", port)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// escapeTemplateVariable escapes the value of a variable of a URI template, see Section 3.2.2 of RFC 6570.
+// The colons of IPv6 addresses have to be escaped as well.
+func escapeTemplateVariable(s string) string {
+	return strings.Replace(url.PathEscape(s), ":", "%3A", -1)
+}
+
+// Read reads the next UDP payload into b.
+// If b is too small for the payload, the rest of the payload is discarded, just like for a UDP socket.
+// Capsules of unknown types, and datagrams with an unknown Context ID are skipped.
+func (c *ConnectUDPConn) Read(b []byte) (int, error) {
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+
+	for {
+		capsuleType, l, err := readCapsuleHeader(c.r)
+		if err != nil {
+			return 0, err
+		}
+		if capsuleType != capsuleTypeDatagram {
+			if err := skipCapsule(c.r, l); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if l > maxDatagramCapsuleSize {
+			return 0, errMalformedCapsule
+		}
+		if uint64(cap(c.readBuf)) < l {
+			c.readBuf = make([]byte, l)
+		}
+		payload := c.readBuf[:l]
+		if _, err := io.ReadFull(c.r, payload); err != nil {
+			return 0, capsuleError(err)
+		}
+		r := bytes.NewReader(payload)
+		contextID, err := utils.ReadVarInt(r)
+		if err != nil {
+			return 0, errMalformedCapsule
+		}
+		// Context ID 0 is used for UDP payloads, see Section 4 of RFC 9298.
+		if contextID != 0 {
+			continue
+		}
+		return copy(b, payload[len(payload)-r.Len():]), nil
+	}
+}
+
+// Write sends b as a single UDP payload.
+func (c *ConnectUDPConn) Write(b []byte) (int, error) {
+	if len(b) > maxUDPPayloadSize {
+		return 0, fmt.Errorf("http3: UDP payload too large (%d bytes)", len(b))
+	}
+	buf := &bytes.Buffer{}
+	writeCapsuleHeader(buf, capsuleTypeDatagram, uint64(1+len(b)))
+	utils.WriteVarInt(buf, 0) // the Context ID
+	buf.Write(b)
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if _, err := c.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes the tunnel.
+func (c *ConnectUDPConn) Close() error {
+	if c.closeFunc == nil {
+		return nil
+	}
+	return c.closeFunc()
+}
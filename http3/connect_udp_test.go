@@ -0,0 +1,221 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CONNECT-UDP", func() {
+	// datagramCapsule is a DATAGRAM capsule
+	datagramCapsule := func(contextID uint64, payload []byte) []byte {
+		b := &bytes.Buffer{}
+		writeCapsuleHeader(b, capsuleTypeDatagram, uint64(utils.VarIntLen(contextID))+uint64(len(payload)))
+		utils.WriteVarInt(b, contextID)
+		b.Write(payload)
+		return b.Bytes()
+	}
+
+	Context("tunneling UDP payloads", func() {
+		It("reads UDP payloads", func() {
+			b := &bytes.Buffer{}
+			b.Write(datagramCapsule(0, []byte("foo")))
+			b.Write(datagramCapsule(0, []byte("bar")))
+			conn := newConnectUDPConn(b, nil, nil)
+			p := make([]byte, 100)
+			n, err := conn.Read(p)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(p[:n])).To(Equal("foo"))
+			n, err = conn.Read(p)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(p[:n])).To(Equal("bar"))
+		})
+
+		It("skips capsules of unknown types, and datagrams with unknown Context IDs", func() {
+			b := &bytes.Buffer{}
+			writeCapsuleHeader(b, 0x1337, 3)
+			b.Write([]byte("foo"))
+			b.Write(datagramCapsule(2, []byte("bar")))
+			b.Write(datagramCapsule(0, []byte("baz")))
+			conn := newConnectUDPConn(b, nil, nil)
+			p := make([]byte, 100)
+			n, err := conn.Read(p)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(p[:n])).To(Equal("baz"))
+		})
+
+		It("truncates UDP payloads that are larger than the buffer", func() {
+			b := &bytes.Buffer{}
+			b.Write(datagramCapsule(0, []byte("foobar")))
+			b.Write(datagramCapsule(0, []byte("baz")))
+			conn := newConnectUDPConn(b, nil, nil)
+			p := make([]byte, 3)
+			n, err := conn.Read(p)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(p[:n])).To(Equal("foo"))
+			n, err = conn.Read(p)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(p[:n])).To(Equal("baz"))
+		})
+
+		It("errors on truncated capsules", func() {
+			capsule := datagramCapsule(0, []byte("foobar"))
+			for i := 1; i < len(capsule); i++ {
+				conn := newConnectUDPConn(bytes.NewReader(capsule[:i]), nil, nil)
+				_, err := conn.Read(make([]byte, 100))
+				Expect(err).To(MatchError(errMalformedCapsule))
+			}
+		})
+
+		It("errors on DATAGRAM capsules that are too large", func() {
+			b := &bytes.Buffer{}
+			writeCapsuleHeader(b, capsuleTypeDatagram, maxDatagramCapsuleSize+1)
+			conn := newConnectUDPConn(b, nil, nil)
+			_, err := conn.Read(make([]byte, 100))
+			Expect(err).To(MatchError(errMalformedCapsule))
+		})
+
+		It("writes UDP payloads", func() {
+			b := &bytes.Buffer{}
+			conn := newConnectUDPConn(nil, b, nil)
+			n, err := conn.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(6))
+			Expect(b.Bytes()).To(Equal(datagramCapsule(0, []byte("foobar"))))
+		})
+
+		It("refuses to write UDP payloads that are too large", func() {
+			conn := newConnectUDPConn(nil, &bytes.Buffer{}, nil)
+			_, err := conn.Write(make([]byte, maxUDPPayloadSize+1))
+			Expect(err).To(MatchError("http3: UDP payload too large (65528 bytes)"))
+		})
+	})
+
+	Context("parsing the target", func() {
+		It("parses the target", func() {
+			target, err := parseConnectUDPTarget("/.well-known/masque/udp/quic.clemente.io/443/")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(target).To(Equal("quic.clemente.io:443"))
+		})
+
+		It("parses the target without a trailing slash", func() {
+			target, err := parseConnectUDPTarget("/.well-known/masque/udp/192.0.2.1/1337")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(target).To(Equal("192.0.2.1:1337"))
+		})
+
+		It("parses IPv6 targets", func() {
+			path := "/.well-known/masque/udp/" + escapeTemplateVariable("2001:db8::42") + "/443/"
+			Expect(path).To(Equal("/.well-known/masque/udp/2001%3Adb8%3A%3A42/443/"))
+			target, err := parseConnectUDPTarget(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(target).To(Equal("[2001:db8::42]:443"))
+		})
+
+		It("rejects invalid paths", func() {
+			for _, path := range []string{
+				"/masque/udp/quic.clemente.io/443/",
+				"/.well-known/masque/udp/quic.clemente.io/",
+				"/.well-known/masque/udp/quic.clemente.io/443/foo",
+				"/.well-known/masque/udp//443/",
+				"/.well-known/masque/udp/quic.clemente.io/0/",
+				"/.well-known/masque/udp/quic.clemente.io/65536/",
+				"/.well-known/masque/udp/quic.clemente.io/https/",
+			} {
+				_, err := parseConnectUDPTarget(path)
+				Expect(err).To(HaveOccurred(), path)
+			}
+		})
+	})
+
+	Context("proxying", func() {
+		const template = "/.well-known/masque/udp/{target_host}/{target_port}/"
+
+		var (
+			s       *Server
+			addr    string
+			rt      *RoundTripper
+			udpConn *net.UDPConn
+		)
+
+		BeforeEach(func() {
+			mux := http.NewServeMux()
+			mux.HandleFunc(connectUDPPathPrefix, ProxyConnectUDP)
+			s, addr = startServer(mux)
+			rt = &RoundTripper{TLSClientConfig: getClientTLSConfig()}
+			// a UDP server that echoes all packets
+			var err error
+			udpConn, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+			Expect(err).ToNot(HaveOccurred())
+			go func() {
+				b := make([]byte, 1500)
+				for {
+					n, raddr, err := udpConn.ReadFrom(b)
+					if err != nil {
+						return
+					}
+					udpConn.WriteTo(b[:n], raddr)
+				}
+			}()
+		})
+
+		AfterEach(func() {
+			Expect(rt.Close()).To(Succeed())
+			Expect(s.Close()).To(Succeed())
+			Expect(udpConn.Close()).To(Succeed())
+		})
+
+		It("proxies UDP payloads", func() {
+			s.EnableExtendedConnect = true
+			conn, err := rt.DialConnectUDP(context.Background(), "https://"+addr+template, udpConn.LocalAddr().String())
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+			for _, payload := range []string{"foo", "bar", "baz"} {
+				_, err = conn.Write([]byte(payload))
+				Expect(err).ToNot(HaveOccurred())
+				b := make([]byte, 100)
+				n, err := conn.Read(b)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(b[:n])).To(Equal(payload))
+			}
+		})
+
+		It("keeps the tunnel open longer than the ReadTimeout", func() {
+			s.EnableExtendedConnect = true
+			s.ReadTimeout = 50 * time.Millisecond
+			conn, err := rt.DialConnectUDP(context.Background(), "https://"+addr+template, udpConn.LocalAddr().String())
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+			time.Sleep(3 * s.ReadTimeout)
+			_, err = conn.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			b := make([]byte, 100)
+			n, err := conn.Read(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b[:n])).To(Equal("foobar"))
+		})
+
+		It("errors if the proxy rejects the request", func() {
+			s.EnableExtendedConnect = true
+			_, err := rt.DialConnectUDP(context.Background(), "https://"+addr+"/.well-known/masque/udp/{target_host}/", udpConn.LocalAddr().String())
+			Expect(err).To(MatchError("http3: CONNECT-UDP request failed: 400 Bad Request"))
+		})
+
+		It("errors if the server didn't enable Extended CONNECT", func() {
+			_, err := rt.DialConnectUDP(context.Background(), "https://"+addr+template, udpConn.LocalAddr().String())
+			Expect(err).To(MatchError("http3: server didn't enable Extended CONNECT"))
+		})
+
+		It("errors on invalid targets", func() {
+			_, err := rt.DialConnectUDP(context.Background(), "https://"+addr+template, "quic.clemente.io")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
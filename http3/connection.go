@@ -0,0 +1,351 @@
+package http3
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3/qpack"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// The unidirectional stream types, see Section 6.2 of RFC 9114 and Section 4.2 of RFC 9204.
+const (
+	streamTypeControl      = 0x00
+	streamTypePush         = 0x01
+	streamTypeQPACKEncoder = 0x02
+	streamTypeQPACKDecoder = 0x03
+)
+
+// streamTypeWebTransport is the type of unidirectional WebTransport streams.
+// It is followed by the session ID, and the stream data, see Section 4.1 of draft-ietf-webtrans-http3-02.
+const streamTypeWebTransport = 0x54
+
+// the QPACK configuration used if none is configured
+var defaultQPACKConfig = &qpack.Config{
+	MaxTableCapacity:  4096,
+	MaxBlockedStreams: 16,
+}
+
+// A connection runs the HTTP/3 control logic on a QUIC session.
+// It opens the control stream and the QPACK streams, sends the SETTINGS frame, and handles the unidirectional streams opened by the peer.
+// It is used by both the server and the client.
+type connection struct {
+	session  quic.Session
+	isServer bool
+
+	settings    map[uint64]uint64 // our settings
+	qpackConfig *qpack.Config
+
+	// The control stream, the encoder and the decoder are created when the connection is started.
+	// The encoder and the decoder are shared by all streams of the connection.
+	controlStr quic.SendStream
+	encoder    *qpack.DynamicEncoder
+	decoder    *qpack.DynamicDecoder
+
+	mutex            sync.Mutex
+	peerSettings     map[uint64]uint64
+	receivedSettings chan struct{} // closed when the peer's SETTINGS frame was received
+	hasControlStream bool
+	hasEncoderStream bool
+	hasDecoderStream bool
+
+	// server push, only used by the server
+	pushEnabled bool // set when the client sent a MAX_PUSH_ID frame
+	maxPushID   uint64
+	nextPushID  uint64
+	pushes      map[uint64]*pushedResponse // the promised responses that were not yet completed
+
+	// WebTransport, only used by the server
+	enableWebTransport   bool
+	webTransportSessions map[uint64]*WebTransportSession
+
+	// graceful shutdown, only used by the server
+	nextRequestStreamID uint64              // the ID following the ID of the last request stream that was accepted
+	activeRequests      map[uint64]struct{} // the IDs of the request streams that are being handled
+	goingAway           bool                // set when the GOAWAY frame was sent
+	requestsDone        chan struct{}       // closed when all requests accepted before the GOAWAY frame have completed
+
+	onGoAway func(id uint64)
+
+	logger utils.Logger
+}
+
+// newConnection creates a new connection.
+// The QPACK settings are added to the settings, according to the qpackConfig.
+// If qpackConfig is nil, the defaultQPACKConfig is used.
+func newConnection(sess quic.Session, isServer bool, settings map[uint64]uint64, qpackConfig *qpack.Config, onGoAway func(uint64), logger utils.Logger) *connection {
+	if qpackConfig == nil {
+		qpackConfig = defaultQPACKConfig
+	}
+	// The default value of both settings is 0, so there's no need to send them in that case.
+	if qpackConfig.MaxTableCapacity > 0 {
+		settings[settingQPACKMaxTableCapacity] = qpackConfig.MaxTableCapacity
+	}
+	if qpackConfig.MaxBlockedStreams > 0 {
+		settings[settingQPACKBlockedStreams] = qpackConfig.MaxBlockedStreams
+	}
+	return &connection{
+		session:              sess,
+		isServer:             isServer,
+		settings:             settings,
+		qpackConfig:          qpackConfig,
+		receivedSettings:     make(chan struct{}),
+		pushes:               make(map[uint64]*pushedResponse),
+		webTransportSessions: make(map[uint64]*WebTransportSession),
+		activeRequests:       make(map[uint64]struct{}),
+		onGoAway:             onGoAway,
+		logger:               logger,
+	}
+}
+
+// start opens the control stream, sends the SETTINGS frame, opens the QPACK encoder and decoder streams,
+// and starts accepting the unidirectional streams opened by the peer.
+func (c *connection) start() error {
+	b := &bytes.Buffer{}
+	(&settingsFrame{settings: c.settings}).Write(b)
+	controlStr, err := c.openUniStream(streamTypeControl, b.Bytes())
+	if err != nil {
+		return err
+	}
+	c.controlStr = controlStr
+	encoderStr, err := c.openUniStream(streamTypeQPACKEncoder, nil)
+	if err != nil {
+		return err
+	}
+	decoderStr, err := c.openUniStream(streamTypeQPACKDecoder, nil)
+	if err != nil {
+		return err
+	}
+	c.encoder = qpack.NewDynamicEncoder(c.qpackConfig, encoderStr)
+	c.decoder = qpack.NewDynamicDecoder(c.qpackConfig, decoderStr)
+	go c.acceptUniStreams()
+	return nil
+}
+
+// openUniStream opens a unidirectional stream, and writes the stream type, followed by data.
+func (c *connection) openUniStream(streamType uint64, data []byte) (quic.SendStream, error) {
+	str, err := c.session.OpenUniStream()
+	if err != nil {
+		return nil, err
+	}
+	b := &bytes.Buffer{}
+	utils.WriteVarInt(b, streamType)
+	b.Write(data)
+	if _, err := str.Write(b.Bytes()); err != nil {
+		return nil, err
+	}
+	return str, nil
+}
+
+func (c *connection) acceptUniStreams() {
+	for {
+		str, err := c.session.AcceptUniStream()
+		if err != nil {
+			c.logger.Debugf("Accepting unidirectional streams failed: %s", err)
+			return
+		}
+		go c.handleUniStream(str)
+	}
+}
+
+func (c *connection) handleUniStream(str quic.ReceiveStream) {
+	streamType, err := utils.ReadVarInt(&byteReader{Reader: str})
+	if err != nil {
+		c.logger.Debugf("Reading the type of stream %d failed: %s", str.StreamID(), err)
+		return
+	}
+	switch streamType {
+	case streamTypeControl:
+		if !c.registerStream(&c.hasControlStream) {
+			c.closeWithError(&connectionError{code: errorStreamCreationError, reason: "duplicate control stream"})
+			return
+		}
+		c.handleControlStream(str)
+	case streamTypePush:
+		if c.isServer {
+			c.closeWithError(&connectionError{code: errorStreamCreationError, reason: "client opened a push stream"})
+		} else {
+			// We never send a MAX_PUSH_ID frame, so the server is not allowed to push.
+			c.closeWithError(&connectionError{code: errorIDError, reason: "server opened a push stream"})
+		}
+	case streamTypeQPACKEncoder, streamTypeQPACKDecoder:
+		hasStream := &c.hasEncoderStream
+		if streamType == streamTypeQPACKDecoder {
+			hasStream = &c.hasDecoderStream
+		}
+		if !c.registerStream(hasStream) {
+			c.closeWithError(&connectionError{code: errorStreamCreationError, reason: "duplicate QPACK stream"})
+			return
+		}
+		c.handleQPACKStream(str, streamType)
+	default:
+		if streamType == streamTypeWebTransport && c.enableWebTransport {
+			c.handleWebTransportUniStream(str)
+			return
+		}
+		// Streams of unknown types must be ignored.
+		str.CancelRead(quic.ErrorCode(errorStreamCreationError))
+	}
+}
+
+// registerStream marks a critical stream as opened.
+// It returns false if the peer already opened a stream of the same type.
+func (c *connection) registerStream(has *bool) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if *has {
+		return false
+	}
+	*has = true
+	return true
+}
+
+// handleQPACKStream passes the instructions received on the peer's encoder stream to our decoder,
+// and the instructions received on the peer's decoder stream to our encoder.
+func (c *connection) handleQPACKStream(str quic.ReceiveStream, streamType uint64) {
+	var err error
+	code := errorQPACKEncoderStreamError
+	if streamType == streamTypeQPACKEncoder {
+		err = c.decoder.HandleEncoderStream(str)
+	} else {
+		err = c.encoder.HandleDecoderStream(str)
+		code = errorQPACKDecoderStreamError
+	}
+	if _, ok := err.(*qpack.InstructionError); ok {
+		c.closeWithError(&connectionError{code: code, reason: err.Error()})
+		return
+	}
+	// Closing a QPACK stream is a connection error.
+	// This also applies if the session was closed, in which case closing it again is a no-op.
+	c.closeWithError(&connectionError{code: errorClosedCriticalStream, reason: fmt.Sprintf("QPACK stream closed: %s", err)})
+}
+
+func (c *connection) handleControlStream(str quic.ReceiveStream) {
+	f, err := parseNextFrame(str)
+	if err != nil {
+		c.handleControlStreamError(err)
+		return
+	}
+	settings, ok := f.(*settingsFrame)
+	if !ok {
+		c.closeWithError(&connectionError{code: errorMissingSettings, reason: "first frame on the control stream was not a SETTINGS frame"})
+		return
+	}
+	c.mutex.Lock()
+	c.peerSettings = settings.settings
+	c.mutex.Unlock()
+	close(c.receivedSettings)
+	if err := c.encoder.SetPeerSettings(settings.settings[settingQPACKMaxTableCapacity], settings.settings[settingQPACKBlockedStreams]); err != nil {
+		c.closeWithError(&connectionError{code: errorClosedCriticalStream, reason: fmt.Sprintf("writing to the QPACK encoder stream failed: %s", err)})
+		return
+	}
+
+	for {
+		f, err := parseNextFrame(str)
+		if err != nil {
+			c.handleControlStreamError(err)
+			return
+		}
+		switch f := f.(type) {
+		case *goAwayFrame:
+			if c.onGoAway != nil {
+				c.onGoAway(f.ID)
+			}
+		case *maxPushIDFrame:
+			if err := c.handleMaxPushID(f.PushID); err != nil {
+				c.closeWithError(err)
+				return
+			}
+		case *cancelPushFrame:
+			if err := c.handleCancelPush(f.PushID); err != nil {
+				c.closeWithError(err)
+				return
+			}
+		case *settingsFrame:
+			c.closeWithError(&connectionError{code: errorFrameUnexpected, reason: "duplicate SETTINGS frame"})
+			return
+		default:
+			c.closeWithError(&connectionError{code: errorFrameUnexpected, reason: fmt.Sprintf("unexpected frame on the control stream: %T", f)})
+			return
+		}
+	}
+}
+
+func (c *connection) handleControlStreamError(err error) {
+	if connErr, ok := err.(*connectionError); ok {
+		c.closeWithError(connErr)
+		return
+	}
+	// Closing the control stream is a connection error.
+	// This also applies if the session was closed, in which case closing it again is a no-op.
+	c.closeWithError(&connectionError{code: errorClosedCriticalStream, reason: fmt.Sprintf("control stream closed: %s", err)})
+}
+
+// peerSetting returns the value of a setting sent by the peer.
+// If the peer's SETTINGS frame wasn't received yet, or it didn't contain the setting, ok is false.
+func (c *connection) peerSetting(id uint64) (val uint64, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	val, ok = c.peerSettings[id]
+	return
+}
+
+// acceptRequest is called by the server for every request stream opened by the client.
+// It returns false if the stream was opened after the GOAWAY frame was sent, in which case the request has to be rejected.
+func (c *connection) acceptRequest(id uint64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.goingAway && id >= c.nextRequestStreamID {
+		return false
+	}
+	if id >= c.nextRequestStreamID {
+		c.nextRequestStreamID = id + 4
+	}
+	c.activeRequests[id] = struct{}{}
+	return true
+}
+
+// completeRequest is called by the server when a request accepted by acceptRequest was handled.
+// If the request didn't establish a WebTransport session, the streams buffered for a session on the request stream are reset.
+func (c *connection) completeRequest(id uint64) {
+	c.mutex.Lock()
+	delete(c.activeRequests, id)
+	if c.goingAway && len(c.activeRequests) == 0 {
+		close(c.requestsDone)
+	}
+	c.mutex.Unlock()
+	if c.enableWebTransport {
+		c.rejectWebTransportSession(id)
+	}
+}
+
+// goAway sends a GOAWAY frame, see Section 5.2 of RFC 9114.
+// It contains the ID of the request stream following the last request stream that was accepted,
+// so that the client knows which requests will be processed.
+// The returned channel is closed when all these requests have completed.
+func (c *connection) goAway() (<-chan struct{}, error) {
+	c.mutex.Lock()
+	if c.goingAway {
+		c.mutex.Unlock()
+		return c.requestsDone, nil
+	}
+	c.goingAway = true
+	c.requestsDone = make(chan struct{})
+	if len(c.activeRequests) == 0 {
+		close(c.requestsDone)
+	}
+	id := c.nextRequestStreamID
+	c.mutex.Unlock()
+
+	b := &bytes.Buffer{}
+	(&goAwayFrame{ID: id}).Write(b)
+	_, err := c.controlStr.Write(b.Bytes())
+	return c.requestsDone, err
+}
+
+func (c *connection) closeWithError(err *connectionError) {
+	c.logger.Debugf("Closing the connection: %s", err)
+	c.session.CloseWithError(quic.ErrorCode(err.code), err.reason)
+}
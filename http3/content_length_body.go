@@ -0,0 +1,32 @@
+package http3
+
+import (
+	"errors"
+	"io"
+)
+
+var errBodyLongerThanContentLength = errors.New("http3: server sent data beyond declared content length")
+
+// contentLengthBody wraps a response body and makes sure
+// that the body has exactly the length declared in the Content-Length header
+type contentLengthBody struct {
+	body      io.ReadCloser
+	remaining int64
+}
+
+func (b *contentLengthBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		// only return the data up to the declared content length
+		return n + int(b.remaining), errBodyLongerThanContentLength
+	}
+	if err == io.EOF && b.remaining > 0 {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (b *contentLengthBody) Close() error {
+	return b.body.Close()
+}
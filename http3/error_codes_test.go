@@ -0,0 +1,26 @@
+package http3
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Error codes", func() {
+	It("has a string representation for every error code", func() {
+		for code := errorNoError; code <= errorVersionFallback; code++ {
+			Expect(code.String()).To(HavePrefix("H3_"))
+		}
+		for code := errorQPACKDecompressionFailed; code <= errorQPACKDecoderStreamError; code++ {
+			Expect(code.String()).To(HavePrefix("QPACK_"))
+		}
+	})
+
+	It("has a string representation for unknown error codes", func() {
+		Expect(errorCode(0x1337).String()).To(Equal("unknown error code: 0x1337"))
+	})
+
+	It("formats connection errors", func() {
+		err := &connectionError{code: errorMissingSettings, reason: "foobar"}
+		Expect(err.Error()).To(Equal("H3_MISSING_SETTINGS: foobar"))
+	})
+})
@@ -0,0 +1,289 @@
+package http3
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// The HTTP/3 frame types, see Section 7.2 of RFC 9114.
+const (
+	frameTypeData        = 0x0
+	frameTypeHeaders     = 0x1
+	frameTypeCancelPush  = 0x3
+	frameTypeSettings    = 0x4
+	frameTypePushPromise = 0x5
+	frameTypeGoAway      = 0x7
+	frameTypeMaxPushID   = 0xd
+)
+
+// frameTypeWebTransportStream is the signal value that starts a bidirectional WebTransport stream.
+// It is followed by the session ID, and the stream data, see Section 4.2 of draft-ietf-webtrans-http3-02.
+const frameTypeWebTransportStream = 0x41
+
+// maxControlFrameSize is the maximum size of the frames sent on the control stream.
+// These frames are read into memory, so their size has to be limited.
+const maxControlFrameSize = 1 << 14
+
+type frame interface{}
+
+// A dataFrame is the header of a DATA frame.
+// The payload is read from the stream.
+type dataFrame struct {
+	Length uint64
+}
+
+func (f *dataFrame) Write(b *bytes.Buffer) {
+	utils.WriteVarInt(b, frameTypeData)
+	utils.WriteVarInt(b, f.Length)
+}
+
+// A headersFrame is the header of a HEADERS frame.
+// The encoded field section is read from the stream.
+type headersFrame struct {
+	Length uint64
+}
+
+func (f *headersFrame) Write(b *bytes.Buffer) {
+	utils.WriteVarInt(b, frameTypeHeaders)
+	utils.WriteVarInt(b, f.Length)
+}
+
+// A pushPromiseFrame is the header of a PUSH_PROMISE frame.
+// The encoded field section of the promised request is read from the stream.
+type pushPromiseFrame struct {
+	PushID uint64
+	Length uint64 // the length of the encoded field section
+}
+
+func (f *pushPromiseFrame) Write(b *bytes.Buffer) {
+	utils.WriteVarInt(b, frameTypePushPromise)
+	utils.WriteVarInt(b, uint64(utils.VarIntLen(f.PushID))+f.Length)
+	utils.WriteVarInt(b, f.PushID)
+}
+
+// The HTTP/3 settings, see Section 7.2.4.1 of RFC 9114, and Section 5 of RFC 9204.
+const (
+	settingQPACKMaxTableCapacity = 0x1
+	settingMaxFieldSectionSize   = 0x6
+	settingQPACKBlockedStreams   = 0x7
+	settingEnableConnectProtocol = 0x8        // see Section 3 of RFC 9220
+	settingEnableWebTransport    = 0x2b603742 // see Section 3.1 of draft-ietf-webtrans-http3-02
+)
+
+type settingsFrame struct {
+	settings map[uint64]uint64
+}
+
+func parseSettingsFrame(b []byte) (*settingsFrame, error) {
+	r := bytes.NewReader(b)
+	f := &settingsFrame{settings: make(map[uint64]uint64)}
+	for r.Len() > 0 {
+		id, err := utils.ReadVarInt(r)
+		if err != nil {
+			return nil, &connectionError{code: errorFrameError, reason: "invalid SETTINGS frame"}
+		}
+		val, err := utils.ReadVarInt(r)
+		if err != nil {
+			return nil, &connectionError{code: errorFrameError, reason: "invalid SETTINGS frame"}
+		}
+		// the settings 0x2 to 0x5 are HTTP/2 settings that were not carried over to HTTP/3
+		if id >= 0x2 && id <= 0x5 {
+			return nil, &connectionError{code: errorSettingsError, reason: fmt.Sprintf("reserved setting %#x", id)}
+		}
+		if _, ok := f.settings[id]; ok {
+			return nil, &connectionError{code: errorSettingsError, reason: fmt.Sprintf("duplicate setting %#x", id)}
+		}
+		f.settings[id] = val
+	}
+	return f, nil
+}
+
+func (f *settingsFrame) Write(b *bytes.Buffer) {
+	var length protocol.ByteCount
+	for id, val := range f.settings {
+		length += utils.VarIntLen(id) + utils.VarIntLen(val)
+	}
+	utils.WriteVarInt(b, frameTypeSettings)
+	utils.WriteVarInt(b, uint64(length))
+	for id, val := range f.settings {
+		utils.WriteVarInt(b, id)
+		utils.WriteVarInt(b, val)
+	}
+}
+
+// A goAwayFrame is a GOAWAY frame.
+// When sent by the server, it contains a stream ID, when sent by the client, it contains a push ID.
+type goAwayFrame struct {
+	ID uint64
+}
+
+func parseGoAwayFrame(b []byte) (*goAwayFrame, error) {
+	id, err := parseIDFramePayload(b, "GOAWAY")
+	if err != nil {
+		return nil, err
+	}
+	return &goAwayFrame{ID: id}, nil
+}
+
+func (f *goAwayFrame) Write(b *bytes.Buffer) {
+	writeIDFrame(b, frameTypeGoAway, f.ID)
+}
+
+// A cancelPushFrame is a CANCEL_PUSH frame.
+type cancelPushFrame struct {
+	PushID uint64
+}
+
+func parseCancelPushFrame(b []byte) (*cancelPushFrame, error) {
+	id, err := parseIDFramePayload(b, "CANCEL_PUSH")
+	if err != nil {
+		return nil, err
+	}
+	return &cancelPushFrame{PushID: id}, nil
+}
+
+func (f *cancelPushFrame) Write(b *bytes.Buffer) {
+	writeIDFrame(b, frameTypeCancelPush, f.PushID)
+}
+
+// A maxPushIDFrame is a MAX_PUSH_ID frame.
+type maxPushIDFrame struct {
+	PushID uint64
+}
+
+func parseMaxPushIDFrame(b []byte) (*maxPushIDFrame, error) {
+	id, err := parseIDFramePayload(b, "MAX_PUSH_ID")
+	if err != nil {
+		return nil, err
+	}
+	return &maxPushIDFrame{PushID: id}, nil
+}
+
+func (f *maxPushIDFrame) Write(b *bytes.Buffer) {
+	writeIDFrame(b, frameTypeMaxPushID, f.PushID)
+}
+
+// parseIDFramePayload parses the payload of the frames that consist of a single stream ID or push ID
+func parseIDFramePayload(b []byte, frameName string) (uint64, error) {
+	r := bytes.NewReader(b)
+	id, err := utils.ReadVarInt(r)
+	if err != nil || r.Len() > 0 {
+		return 0, &connectionError{code: errorFrameError, reason: fmt.Sprintf("invalid %s frame", frameName)}
+	}
+	return id, nil
+}
+
+func writeIDFrame(b *bytes.Buffer, frameType, id uint64) {
+	utils.WriteVarInt(b, frameType)
+	utils.WriteVarInt(b, uint64(utils.VarIntLen(id)))
+	utils.WriteVarInt(b, id)
+}
+
+// parseNextFrame parses the next frame from r.
+// For DATA, HEADERS and PUSH_PROMISE frames, only the frame header (and the push ID) is read.
+// Frames of unknown types are skipped.
+// If r ends before the first byte of a frame, io.EOF is returned.
+// If it ends within a frame, io.ErrUnexpectedEOF is returned.
+func parseNextFrame(r io.Reader) (frame, error) {
+	br := &byteReader{Reader: r}
+	for {
+		t, err := utils.ReadVarInt(br)
+		if err != nil {
+			if err == io.EOF && br.n > 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		f, err := parseFrame(r, t)
+		if f != nil || err != nil {
+			return f, err
+		}
+		br.n = 0
+	}
+}
+
+// parseFrame parses the rest of a frame of type t, after the frame type was read from r.
+// Frames of unknown types are skipped, in which case nil is returned.
+func parseFrame(r io.Reader, t uint64) (frame, error) {
+	br := &byteReader{Reader: r}
+	l, err := utils.ReadVarInt(br)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	switch t {
+	case frameTypeData:
+		return &dataFrame{Length: l}, nil
+	case frameTypeHeaders:
+		return &headersFrame{Length: l}, nil
+	case frameTypePushPromise:
+		pushID, err := utils.ReadVarInt(br)
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if uint64(utils.VarIntLen(pushID)) > l {
+			return nil, &connectionError{code: errorFrameError, reason: "invalid PUSH_PROMISE frame"}
+		}
+		return &pushPromiseFrame{PushID: pushID, Length: l - uint64(utils.VarIntLen(pushID))}, nil
+	case frameTypeSettings, frameTypeGoAway, frameTypeCancelPush, frameTypeMaxPushID:
+		if l > maxControlFrameSize {
+			return nil, &connectionError{code: errorExcessiveLoad, reason: fmt.Sprintf("frame too large (%d bytes)", l)}
+		}
+		payload := make([]byte, l)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		switch t {
+		case frameTypeSettings:
+			return parseSettingsFrame(payload)
+		case frameTypeGoAway:
+			return parseGoAwayFrame(payload)
+		case frameTypeCancelPush:
+			return parseCancelPushFrame(payload)
+		default:
+			return parseMaxPushIDFrame(payload)
+		}
+	case 0x2, 0x6, 0x8, 0x9:
+		// frame types that were used in HTTP/2, but are reserved in HTTP/3
+		return nil, &connectionError{code: errorFrameUnexpected, reason: fmt.Sprintf("reserved frame type %#x", t)}
+	default:
+		// Skip frames of unknown types.
+		if _, err := io.CopyN(ioutil.Discard, r, int64(l)); err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return nil, nil
+	}
+}
+
+// A byteReader reads single bytes from an io.Reader.
+// Unlike a bufio.Reader, it doesn't read more than it needs to.
+type byteReader struct {
+	io.Reader
+	n int // the number of bytes read
+}
+
+func (br *byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(br.Reader, b[:]); err != nil {
+		return 0, err
+	}
+	br.n++
+	return b[0], nil
+}
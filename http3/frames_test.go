@@ -0,0 +1,215 @@
+package http3
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Frames", func() {
+	appendVarInt := func(b []byte, i uint64) []byte {
+		buf := &bytes.Buffer{}
+		utils.WriteVarInt(buf, i)
+		return append(b, buf.Bytes()...)
+	}
+
+	It("skips unknown frame types", func() {
+		data := appendVarInt(nil, 0xdeadbeef) // type byte
+		data = appendVarInt(data, 0x42)
+		data = append(data, make([]byte, 0x42)...)
+		buf := bytes.NewBuffer(data)
+		(&dataFrame{Length: 0x1234}).Write(buf)
+		frame, err := parseNextFrame(buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(Equal(&dataFrame{Length: 0x1234}))
+	})
+
+	It("returns io.EOF if the stream ends before a frame", func() {
+		_, err := parseNextFrame(bytes.NewReader(nil))
+		Expect(err).To(MatchError(io.EOF))
+	})
+
+	It("returns io.ErrUnexpectedEOF if the stream ends within a frame", func() {
+		buf := &bytes.Buffer{}
+		(&dataFrame{Length: 0x1234}).Write(buf)
+		data := buf.Bytes()
+		for i := 1; i < len(data); i++ {
+			_, err := parseNextFrame(bytes.NewReader(data[:i]))
+			Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+		}
+	})
+
+	It("returns io.ErrUnexpectedEOF if the stream ends within an unknown frame", func() {
+		data := appendVarInt(nil, 0x21)
+		data = appendVarInt(data, 10)
+		data = append(data, make([]byte, 5)...)
+		_, err := parseNextFrame(bytes.NewReader(data))
+		Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+	})
+
+	It("rejects frame types reserved for HTTP/2", func() {
+		for _, t := range []uint64{0x2, 0x6, 0x8, 0x9} {
+			data := appendVarInt(nil, t)
+			data = appendVarInt(data, 0)
+			_, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).To(BeAssignableToTypeOf(&connectionError{}))
+			Expect(err.(*connectionError).code).To(Equal(errorFrameUnexpected))
+		}
+	})
+
+	Context("DATA frames", func() {
+		It("writes and parses", func() {
+			buf := &bytes.Buffer{}
+			(&dataFrame{Length: 0x1337}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&dataFrame{Length: 0x1337}))
+			Expect(buf.Len()).To(BeZero())
+		})
+	})
+
+	Context("HEADERS frames", func() {
+		It("writes and parses", func() {
+			buf := &bytes.Buffer{}
+			(&headersFrame{Length: 0xdead}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&headersFrame{Length: 0xdead}))
+			Expect(buf.Len()).To(BeZero())
+		})
+	})
+
+	Context("SETTINGS frames", func() {
+		It("writes and parses", func() {
+			sf := &settingsFrame{settings: map[uint64]uint64{
+				settingMaxFieldSectionSize: 0x1000,
+				0xdeadbeef:                 0xdecafbad,
+			}}
+			buf := &bytes.Buffer{}
+			sf.Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(sf))
+			Expect(buf.Len()).To(BeZero())
+		})
+
+		It("writes and parses an empty SETTINGS frame", func() {
+			buf := &bytes.Buffer{}
+			(&settingsFrame{}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&settingsFrame{settings: map[uint64]uint64{}}))
+		})
+
+		It("rejects duplicate settings", func() {
+			data := appendVarInt(nil, settingMaxFieldSectionSize)
+			data = appendVarInt(data, 1)
+			data = appendVarInt(data, settingMaxFieldSectionSize)
+			data = appendVarInt(data, 2)
+			_, err := parseSettingsFrame(data)
+			Expect(err).To(Equal(&connectionError{code: errorSettingsError, reason: "duplicate setting 0x6"}))
+		})
+
+		It("rejects settings reserved for HTTP/2", func() {
+			data := appendVarInt(nil, 0x3)
+			data = appendVarInt(data, 100)
+			_, err := parseSettingsFrame(data)
+			Expect(err).To(Equal(&connectionError{code: errorSettingsError, reason: "reserved setting 0x3"}))
+		})
+
+		It("errors on truncated settings", func() {
+			data := appendVarInt(nil, settingMaxFieldSectionSize)
+			_, err := parseSettingsFrame(data)
+			Expect(err).To(Equal(&connectionError{code: errorFrameError, reason: "invalid SETTINGS frame"}))
+		})
+
+		It("rejects SETTINGS frames that are too large", func() {
+			data := appendVarInt(nil, frameTypeSettings)
+			data = appendVarInt(data, maxControlFrameSize+1)
+			_, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).To(BeAssignableToTypeOf(&connectionError{}))
+			Expect(err.(*connectionError).code).To(Equal(errorExcessiveLoad))
+		})
+	})
+
+	Context("GOAWAY frames", func() {
+		It("writes and parses", func() {
+			buf := &bytes.Buffer{}
+			(&goAwayFrame{ID: 0x1337}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&goAwayFrame{ID: 0x1337}))
+			Expect(buf.Len()).To(BeZero())
+		})
+
+		It("rejects GOAWAY frames with trailing data", func() {
+			data := appendVarInt(nil, 0x1337)
+			data = append(data, 0)
+			_, err := parseGoAwayFrame(data)
+			Expect(err).To(Equal(&connectionError{code: errorFrameError, reason: "invalid GOAWAY frame"}))
+		})
+	})
+
+	Context("PUSH_PROMISE frames", func() {
+		It("writes and parses", func() {
+			buf := &bytes.Buffer{}
+			(&pushPromiseFrame{PushID: 0x1337, Length: 0x42}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&pushPromiseFrame{PushID: 0x1337, Length: 0x42}))
+			Expect(buf.Len()).To(BeZero())
+		})
+
+		It("rejects PUSH_PROMISE frames that are shorter than the push ID", func() {
+			data := appendVarInt(nil, frameTypePushPromise)
+			data = appendVarInt(data, 1)
+			data = appendVarInt(data, 0x1337)
+			_, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).To(Equal(&connectionError{code: errorFrameError, reason: "invalid PUSH_PROMISE frame"}))
+		})
+
+		It("returns io.ErrUnexpectedEOF if the stream ends within the push ID", func() {
+			data := appendVarInt(nil, frameTypePushPromise)
+			data = appendVarInt(data, 10)
+			data = append(data, appendVarInt(nil, 0x1337)[:1]...)
+			_, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).To(Equal(io.ErrUnexpectedEOF))
+		})
+	})
+
+	Context("CANCEL_PUSH frames", func() {
+		It("writes and parses", func() {
+			buf := &bytes.Buffer{}
+			(&cancelPushFrame{PushID: 0x1337}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&cancelPushFrame{PushID: 0x1337}))
+			Expect(buf.Len()).To(BeZero())
+		})
+
+		It("rejects CANCEL_PUSH frames with trailing data", func() {
+			_, err := parseCancelPushFrame(append(appendVarInt(nil, 0x1337), 0))
+			Expect(err).To(Equal(&connectionError{code: errorFrameError, reason: "invalid CANCEL_PUSH frame"}))
+		})
+	})
+
+	Context("MAX_PUSH_ID frames", func() {
+		It("writes and parses", func() {
+			buf := &bytes.Buffer{}
+			(&maxPushIDFrame{PushID: 0x1337}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&maxPushIDFrame{PushID: 0x1337}))
+			Expect(buf.Len()).To(BeZero())
+		})
+
+		It("rejects MAX_PUSH_ID frames with trailing data", func() {
+			_, err := parseMaxPushIDFrame(append(appendVarInt(nil, 0x1337), 0))
+			Expect(err).To(Equal(&connectionError{code: errorFrameError, reason: "invalid MAX_PUSH_ID frame"}))
+		})
+	})
+})
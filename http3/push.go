@@ -0,0 +1,230 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3/qpack"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+var errRecursivePush = errors.New("http3: recursive push not allowed")
+
+// A pushedResponse is a response that the server promised to push.
+type pushedResponse struct {
+	id uint64
+
+	// canceled when the client cancels the push, or when the pushed response was sent
+	ctx       context.Context
+	cancelCtx context.CancelFunc
+
+	mutex    sync.Mutex
+	str      quic.SendStream // nil until the push stream is opened
+	canceled bool
+}
+
+// cancel is called when the client sends a CANCEL_PUSH frame.
+// If the push stream was already opened, it is reset.
+func (p *pushedResponse) cancel() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.canceled = true
+	p.cancelCtx()
+	if p.str != nil {
+		p.str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+	}
+}
+
+// setStream sets the push stream.
+// It returns false if the push was canceled, in which case the stream must not be used.
+func (p *pushedResponse) setStream(str quic.SendStream) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.canceled {
+		return false
+	}
+	p.str = str
+	return true
+}
+
+// handleMaxPushID handles a MAX_PUSH_ID frame, which allows the server to push.
+func (c *connection) handleMaxPushID(id uint64) *connectionError {
+	if !c.isServer {
+		return &connectionError{code: errorFrameUnexpected, reason: "MAX_PUSH_ID frame sent by the server"}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.pushEnabled && id < c.maxPushID {
+		return &connectionError{code: errorIDError, reason: fmt.Sprintf("MAX_PUSH_ID reduced from %d to %d", c.maxPushID, id)}
+	}
+	c.pushEnabled = true
+	c.maxPushID = id
+	return nil
+}
+
+// handleCancelPush handles a CANCEL_PUSH frame.
+// Our client never sends a MAX_PUSH_ID frame, so a server is not allowed to reference any push IDs.
+func (c *connection) handleCancelPush(id uint64) *connectionError {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.isServer || !c.pushEnabled || id >= c.nextPushID {
+		return &connectionError{code: errorIDError, reason: fmt.Sprintf("CANCEL_PUSH frame for push ID %d, which was not promised", id)}
+	}
+	// If the push is not found, the response was already sent.
+	if p, ok := c.pushes[id]; ok {
+		c.logger.Debugf("Client canceled push %d", id)
+		p.cancel()
+	}
+	return nil
+}
+
+// newPush allocates a push ID.
+// It returns http.ErrNotSupported if the client didn't allow the server to push, or if all allowed push IDs were used.
+func (c *connection) newPush() (*pushedResponse, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.pushEnabled || c.nextPushID > c.maxPushID {
+		return nil, http.ErrNotSupported
+	}
+	ctx, cancel := context.WithCancel(c.session.Context())
+	p := &pushedResponse{id: c.nextPushID, ctx: ctx, cancelCtx: cancel}
+	c.pushes[p.id] = p
+	c.nextPushID++
+	return p, nil
+}
+
+func (c *connection) removePush(p *pushedResponse) {
+	c.mutex.Lock()
+	delete(c.pushes, p.id)
+	c.mutex.Unlock()
+	p.cancelCtx()
+}
+
+// A pusher implements http.Pusher for the responseWriter.
+// It sends the PUSH_PROMISE frames on the request stream, and serves the promised requests.
+type pusher struct {
+	server *Server
+	conn   *connection
+	str    quic.Stream   // the request stream
+	req    *http.Request // the request that the pushed responses are associated with
+}
+
+// Push promises the request for target to the client, and serves it using the server's handler.
+// The semantics are the same as for http.Pusher in net/http.
+func (p *pusher) Push(target string, opts *http.PushOptions) error {
+	if opts == nil {
+		opts = &http.PushOptions{}
+	}
+	method := opts.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	// Only safe and cacheable requests can be pushed, see Section 4.6 of RFC 9114.
+	if method != http.MethodGet && method != http.MethodHead {
+		return fmt.Errorf("http3: method %q must be GET or HEAD", method)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" {
+		if !strings.HasPrefix(target, "/") {
+			return fmt.Errorf("http3: target must be an absolute URL or an absolute path: %q", target)
+		}
+		u.Scheme = "https"
+		u.Host = p.req.Host
+	} else {
+		if u.Scheme != "https" {
+			return fmt.Errorf("http3: cannot push URL with scheme %q", u.Scheme)
+		}
+		if u.Host == "" {
+			return errors.New("http3: URL must have a host")
+		}
+	}
+	fields := []qpack.HeaderField{
+		{Name: ":method", Value: method},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":authority", Value: u.Host},
+		{Name: ":path", Value: u.RequestURI()},
+	}
+	for k, vv := range opts.Header {
+		name := strings.ToLower(k)
+		if strings.HasPrefix(name, ":") {
+			return fmt.Errorf("http3: promised request headers cannot include pseudo header %q", k)
+		}
+		// Promised requests don't have a body.
+		// Connection-specific header fields must not be used in HTTP/3.
+		switch name {
+		case "content-length", "content-encoding", "trailer", "te", "expect", "host",
+			"connection", "proxy-connection", "transfer-encoding", "upgrade", "keep-alive":
+			return fmt.Errorf("http3: promised request headers cannot include %q", k)
+		}
+		for _, v := range vv {
+			fields = append(fields, qpack.HeaderField{Name: name, Value: v})
+		}
+	}
+	req, err := requestFromHeaders(fields)
+	if err != nil {
+		return err
+	}
+
+	push, err := p.conn.newPush()
+	if err != nil {
+		return err
+	}
+	// The field section is sent on the request stream, so the decoder acknowledges it for this stream.
+	headers, err := p.conn.encoder.EncodeFieldSection(uint64(p.str.StreamID()), fields)
+	if err != nil {
+		p.conn.removePush(push)
+		return err
+	}
+	b := &bytes.Buffer{}
+	(&pushPromiseFrame{PushID: push.id, Length: uint64(len(headers))}).Write(b)
+	if _, err := p.str.WriteVectored([][]byte{b.Bytes(), headers}); err != nil {
+		p.conn.removePush(push)
+		return err
+	}
+
+	req.Body = http.NoBody
+	req.RemoteAddr = p.req.RemoteAddr
+	go p.server.handlePush(p.conn, push, req.WithContext(push.ctx))
+	return nil
+}
+
+// handlePush opens the push stream, and serves a promised request.
+func (s *Server) handlePush(conn *connection, push *pushedResponse, req *http.Request) {
+	defer conn.removePush(push)
+
+	if push.ctx.Err() != nil {
+		// The client canceled the push before the push stream was opened.
+		return
+	}
+	str, err := conn.session.OpenUniStreamSync()
+	if err != nil {
+		s.logger.Debugf("Opening the stream for push %d failed: %s", push.id, err)
+		return
+	}
+	if !push.setStream(str) {
+		str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+		return
+	}
+	b := &bytes.Buffer{}
+	utils.WriteVarInt(b, streamTypePush)
+	utils.WriteVarInt(b, push.id)
+	if _, err := str.Write(b.Bytes()); err != nil {
+		s.logger.Debugf("Writing to the stream for push %d failed: %s", push.id, err)
+		return
+	}
+
+	s.logger.Infof("Pushing %s %s%s (push ID %d)", req.Method, req.Host, req.RequestURI, push.id)
+	// Responses can't be pushed from a pushed response, so the responseWriter doesn't get a pusher.
+	w := newResponseWriter(str, conn.encoder, req.Method == http.MethodHead, s.logger)
+	w.finish(s.runHandler(w, req))
+}
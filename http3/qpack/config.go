@@ -0,0 +1,25 @@
+package qpack
+
+// Config configures the dynamic table of a DynamicEncoder or a DynamicDecoder.
+type Config struct {
+	// MaxTableCapacity is the maximum capacity of the dynamic table, in bytes.
+	// A decoder announces it to the peer, whose encoder may then fill the dynamic table up to this capacity.
+	// An encoder uses the smaller of this value and the limit announced by the peer.
+	// If zero, the dynamic table is not used.
+	MaxTableCapacity uint64
+	// MaxBlockedStreams is the maximum number of streams whose field sections can't be decoded yet,
+	// because they reference dynamic table entries that were not yet received on the encoder stream.
+	// A decoder announces it to the peer, an encoder uses the smaller of this value and the limit announced by the peer.
+	// If zero, field sections are only encoded using entries that the decoder acknowledged, so they never block.
+	MaxBlockedStreams uint64
+}
+
+// An InstructionError occurs when the peer sends an invalid instruction on the encoder or the decoder stream.
+// This is a connection error of type QPACK_ENCODER_STREAM_ERROR or QPACK_DECODER_STREAM_ERROR, respectively.
+type InstructionError struct {
+	Err error
+}
+
+func (e *InstructionError) Error() string {
+	return e.Err.Error()
+}
@@ -0,0 +1,158 @@
+package qpack
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errNoDynamicTable = errors.New("qpack: reference to the dynamic table")
+
+// ErrFieldSectionTooLarge is returned by DynamicDecoder.DecodeFieldSection
+// when the size of the decoded field section exceeds the maximum size.
+// This is not a decoding error, so the connection doesn't need to be closed.
+var ErrFieldSectionTooLarge = errors.New("qpack: field section too large")
+
+// A Decoder decodes field sections.
+// It doesn't use the dynamic table, so the peer has to be told that the maximum table capacity is 0.
+// Use a DynamicDecoder to decode field sections that reference the dynamic table.
+type Decoder struct{}
+
+// NewDecoder creates a new Decoder.
+func NewDecoder() *Decoder {
+	return &Decoder{}
+}
+
+// DecodeFull decodes a field section.
+func (d *Decoder) DecodeFull(p []byte) ([]HeaderField, error) {
+	requiredInsertCount, p, err := readInt(p, 8)
+	if err != nil {
+		return nil, err
+	}
+	if requiredInsertCount != 0 {
+		return nil, errNoDynamicTable
+	}
+	// The sign bit and the Delta Base only matter for references to the dynamic table.
+	_, p, err = readInt(p, 7)
+	if err != nil {
+		return nil, err
+	}
+	return parseFieldLines(p, nil, 0, 0, 0)
+}
+
+// parseFieldLines parses the field lines of a field section.
+// References to the dynamic table are resolved using dt, which may be nil if the dynamic table is not used.
+// All references have to be to entries with an absolute index smaller than the Required Insert Count.
+// If maxSize is not 0, ErrFieldSectionTooLarge is returned as soon as the size of the decoded fields exceeds it.
+// The size of a field is calculated as defined in Section 4.2.2 of RFC 9114.
+func parseFieldLines(p []byte, dt *dynamicTable, requiredInsertCount, base, maxSize uint64) ([]HeaderField, error) {
+	var fields []HeaderField
+	var size uint64
+	for len(p) > 0 {
+		var hf HeaderField
+		var err error
+		hf, p, err = parseFieldLine(p, dt, requiredInsertCount, base)
+		if err != nil {
+			return nil, err
+		}
+		size += entrySize(hf)
+		if maxSize > 0 && size > maxSize {
+			return nil, ErrFieldSectionTooLarge
+		}
+		fields = append(fields, hf)
+	}
+	return fields, nil
+}
+
+func parseFieldLine(p []byte, dt *dynamicTable, requiredInsertCount, base uint64) (HeaderField, []byte, error) {
+	// getDynamic gets an entry from the dynamic table, using an index relative to the Base.
+	// Post-base indices count upwards from the Base, all other indices count downwards.
+	getDynamic := func(i uint64, postBase bool) (HeaderField, error) {
+		if dt == nil {
+			return HeaderField{}, errNoDynamicTable
+		}
+		var abs uint64
+		if postBase {
+			abs = base + i
+		} else {
+			if i >= base {
+				return HeaderField{}, fmt.Errorf("qpack: invalid relative index %d (base %d)", i, base)
+			}
+			abs = base - 1 - i
+		}
+		if abs >= requiredInsertCount {
+			return HeaderField{}, fmt.Errorf("qpack: reference to entry %d exceeds the Required Insert Count %d", abs, requiredInsertCount)
+		}
+		hf, ok := dt.get(abs)
+		if !ok {
+			return HeaderField{}, fmt.Errorf("qpack: reference to evicted entry %d", abs)
+		}
+		return hf, nil
+	}
+
+	switch {
+	case p[0]&0x80 > 0: // Indexed Field Line
+		isStatic := p[0]&0x40 > 0
+		i, p, err := readInt(p, 6)
+		if err != nil {
+			return HeaderField{}, nil, err
+		}
+		var hf HeaderField
+		if isStatic {
+			hf, err = getStaticTableEntry(i)
+		} else {
+			hf, err = getDynamic(i, false)
+		}
+		return hf, p, err
+	case p[0]&0x40 > 0: // Literal Field Line With Name Reference
+		isStatic := p[0]&0x10 > 0
+		i, p, err := readInt(p, 4)
+		if err != nil {
+			return HeaderField{}, nil, err
+		}
+		var hf HeaderField
+		if isStatic {
+			hf, err = getStaticTableEntry(i)
+		} else {
+			hf, err = getDynamic(i, false)
+		}
+		if err != nil {
+			return HeaderField{}, nil, err
+		}
+		hf.Value, p, err = readString(p, 7)
+		return hf, p, err
+	case p[0]&0x20 > 0: // Literal Field Line With Literal Name
+		var hf HeaderField
+		var err error
+		hf.Name, p, err = readString(p, 3)
+		if err != nil {
+			return HeaderField{}, nil, err
+		}
+		hf.Value, p, err = readString(p, 7)
+		return hf, p, err
+	case p[0]&0x10 > 0: // Indexed Field Line With Post-Base Index
+		i, p, err := readInt(p, 4)
+		if err != nil {
+			return HeaderField{}, nil, err
+		}
+		hf, err := getDynamic(i, true)
+		return hf, p, err
+	default: // Literal Field Line With Post-Base Name Reference
+		i, p, err := readInt(p, 3)
+		if err != nil {
+			return HeaderField{}, nil, err
+		}
+		hf, err := getDynamic(i, true)
+		if err != nil {
+			return HeaderField{}, nil, err
+		}
+		hf.Value, p, err = readString(p, 7)
+		return hf, p, err
+	}
+}
+
+func getStaticTableEntry(i uint64) (HeaderField, error) {
+	if i >= uint64(len(staticTable)) {
+		return HeaderField{}, fmt.Errorf("qpack: invalid static table index %d", i)
+	}
+	return staticTable[i], nil
+}
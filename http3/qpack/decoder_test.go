@@ -0,0 +1,77 @@
+package qpack
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Decoder", func() {
+	var dec *Decoder
+
+	BeforeEach(func() {
+		dec = NewDecoder()
+	})
+
+	It("decodes a field section using the static table", func() {
+		// taken from Appendix B.1 of RFC 9204
+		fields, err := dec.DecodeFull([]byte{
+			0x00, 0x00, 0x51, 0x0b, 0x2f, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x2e, 0x68, 0x74, 0x6d, 0x6c,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(Equal([]HeaderField{{Name: ":path", Value: "/index.html"}}))
+	})
+
+	It("decodes indexed field lines", func() {
+		fields, err := dec.DecodeFull([]byte{0x00, 0x00, 0xc0 | 17, 0xc0 | 23})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(Equal([]HeaderField{
+			{Name: ":method", Value: "GET"},
+			{Name: ":scheme", Value: "https"},
+		}))
+	})
+
+	It("decodes field lines with literal names", func() {
+		fields, err := dec.DecodeFull([]byte{0x00, 0x00, 0x23, 'f', 'o', 'o', 0x03, 'b', 'a', 'r'})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(Equal([]HeaderField{{Name: "foo", Value: "bar"}}))
+	})
+
+	It("decodes field lines with the never-indexed bit set", func() {
+		fields, err := dec.DecodeFull([]byte{0x00, 0x00, 0x33, 'f', 'o', 'o', 0x03, 'b', 'a', 'r'})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(Equal([]HeaderField{{Name: "foo", Value: "bar"}}))
+	})
+
+	It("errors when the Required Insert Count is not 0", func() {
+		_, err := dec.DecodeFull([]byte{0x02, 0x00, 0xc0 | 17})
+		Expect(err).To(MatchError(errNoDynamicTable))
+	})
+
+	It("errors on references to the dynamic table", func() {
+		for _, b := range [][]byte{
+			{0x00, 0x00, 0x80},                      // Indexed Field Line
+			{0x00, 0x00, 0x41, 0x03, 'f', 'o', 'o'}, // Literal Field Line With Name Reference
+			{0x00, 0x00, 0x10},                      // Indexed Field Line With Post-Base Index
+			{0x00, 0x00, 0x00, 0x03, 'f', 'o', 'o'}, // Literal Field Line With Post-Base Name Reference
+		} {
+			_, err := dec.DecodeFull(b)
+			Expect(err).To(MatchError(errNoDynamicTable))
+		}
+	})
+
+	It("errors on invalid static table indices", func() {
+		_, err := dec.DecodeFull([]byte{0x00, 0x00, 0xff, 0x40})
+		Expect(err).To(MatchError("qpack: invalid static table index 127"))
+	})
+
+	It("errors on truncated field sections", func() {
+		b := []byte{0x00, 0x00, 0x23, 'f', 'o', 'o', 0x03, 'b', 'a', 'r'}
+		for i := 0; i < len(b); i++ {
+			if i == 2 { // an empty field section is valid
+				continue
+			}
+			_, err := dec.DecodeFull(b[:i])
+			Expect(err).To(MatchError(errTruncated))
+		}
+	})
+})
@@ -0,0 +1,275 @@
+package qpack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var errEncoderStreamClosed = errors.New("qpack: encoder stream closed")
+
+// A DynamicDecoder decodes field sections that may reference the dynamic table.
+// The dynamic table is populated by the instructions that the peer's encoder sends on the encoder stream.
+// A DynamicDecoder is safe for concurrent use.
+type DynamicDecoder struct {
+	mutex sync.Mutex
+
+	config        Config
+	decoderStream io.Writer
+
+	table dynamicTable
+	// the number of inserts that the encoder knows were received,
+	// either from a Section Acknowledgment or from an Insert Count Increment
+	knownReceivedCount uint64
+	blockedStreams     uint64
+
+	inserted chan struct{} // closed (and replaced) when entries are inserted, to unblock blocked streams
+	closed   chan struct{} // closed when reading from the encoder stream failed
+}
+
+// NewDynamicDecoder creates a new DynamicDecoder.
+// The config has to match the SETTINGS sent to the peer.
+// Instructions to the peer's encoder are written to the decoder stream.
+func NewDynamicDecoder(config *Config, decoderStream io.Writer) *DynamicDecoder {
+	return &DynamicDecoder{
+		config:        *config,
+		decoderStream: decoderStream,
+		inserted:      make(chan struct{}),
+		closed:        make(chan struct{}),
+	}
+}
+
+// HandleEncoderStream reads the instructions that the peer sends on the encoder stream.
+// It blocks until reading from the stream fails, or an invalid instruction is received.
+// Invalid instructions result in an InstructionError.
+// Afterwards, blocked streams can't be decoded anymore.
+func (d *DynamicDecoder) HandleEncoderStream(r io.Reader) error {
+	defer close(d.closed)
+	// An insert instruction can't be larger than the table capacity,
+	// plus a few bytes for the encoding of the lengths.
+	return readInstructions(r, d.config.MaxTableCapacity+32, d.handleEncoderInstructions)
+}
+
+func (d *DynamicDecoder) handleEncoderInstructions(b []byte) ([]byte, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	insertCount := d.table.insertCount()
+	for len(b) > 0 {
+		rest, err := d.parseEncoderInstruction(b)
+		if err == errTruncated {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		b = rest
+	}
+	if d.table.insertCount() == insertCount {
+		return b, nil
+	}
+	close(d.inserted)
+	d.inserted = make(chan struct{})
+	// Acknowledge all inserts right away, so that the encoder can reference the new entries without risking blocking.
+	if err := d.writeInstruction(appendInt(nil, 6, 0, d.table.insertCount()-d.knownReceivedCount)); err != nil {
+		return nil, err
+	}
+	d.knownReceivedCount = d.table.insertCount()
+	return b, nil
+}
+
+// parseEncoderInstruction parses and executes one encoder instruction, see Section 4.3 of RFC 9204.
+// If b doesn't contain the complete instruction, errTruncated is returned, and the instruction is not executed.
+func (d *DynamicDecoder) parseEncoderInstruction(b []byte) ([]byte, error) {
+	var hf HeaderField
+	var err error
+	switch {
+	case b[0]&0x80 > 0: // Insert with Name Reference
+		isStatic := b[0]&0x40 > 0
+		var i uint64
+		i, b, err = readInt(b, 6)
+		if err != nil {
+			return nil, err
+		}
+		if isStatic {
+			hf, err = getStaticTableEntry(i)
+		} else {
+			hf, err = d.getRelative(i)
+		}
+		if err != nil {
+			return nil, err
+		}
+		hf.Value, b, err = readString(b, 7)
+		if err != nil {
+			return nil, err
+		}
+	case b[0]&0x40 > 0: // Insert with Literal Name
+		hf.Name, b, err = readString(b, 5)
+		if err != nil {
+			return nil, err
+		}
+		hf.Value, b, err = readString(b, 7)
+		if err != nil {
+			return nil, err
+		}
+	case b[0]&0x20 > 0: // Set Dynamic Table Capacity
+		var c uint64
+		c, b, err = readInt(b, 5)
+		if err != nil {
+			return nil, err
+		}
+		if c > d.config.MaxTableCapacity {
+			return nil, fmt.Errorf("qpack: table capacity %d exceeds the maximum table capacity %d", c, d.config.MaxTableCapacity)
+		}
+		d.table.setCapacity(c)
+		return b, nil
+	default: // Duplicate
+		var i uint64
+		i, b, err = readInt(b, 5)
+		if err != nil {
+			return nil, err
+		}
+		hf, err = d.getRelative(i)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if entrySize(hf) > d.table.capacity {
+		return nil, fmt.Errorf("qpack: entry of size %d exceeds the table capacity %d", entrySize(hf), d.table.capacity)
+	}
+	d.table.insert(hf)
+	return b, nil
+}
+
+// getRelative gets an entry using a relative index, as used in encoder instructions.
+func (d *DynamicDecoder) getRelative(i uint64) (HeaderField, error) {
+	insertCount := d.table.insertCount()
+	if i >= insertCount {
+		return HeaderField{}, fmt.Errorf("qpack: invalid relative index %d", i)
+	}
+	hf, ok := d.table.get(insertCount - 1 - i)
+	if !ok {
+		return HeaderField{}, fmt.Errorf("qpack: reference to evicted entry %d", insertCount-1-i)
+	}
+	return hf, nil
+}
+
+// DecodeFieldSection decodes a field section received on a stream.
+// If the field section references dynamic table entries that were not yet received on the encoder stream,
+// it blocks until these entries are received, or the context is canceled.
+// The size of the decoded field section (as defined in Section 4.2.2 of RFC 9114) is limited to maxSize bytes (0 means no limit).
+// If it is exceeded, ErrFieldSectionTooLarge is returned.
+// If decoding fails with any other error, the connection has to be closed with a QPACK_DECOMPRESSION_FAILED error,
+// unless the context was canceled.
+func (d *DynamicDecoder) DecodeFieldSection(ctx context.Context, streamID uint64, p []byte, maxSize uint64) ([]HeaderField, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	encodedInsertCount, p, err := readInt(p, 8)
+	if err != nil {
+		return nil, err
+	}
+	requiredInsertCount, err := d.decodeRequiredInsertCount(encodedInsertCount)
+	if err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return nil, errTruncated
+	}
+	negative := p[0]&0x80 > 0
+	deltaBase, p, err := readInt(p, 7)
+	if err != nil {
+		return nil, err
+	}
+	base := requiredInsertCount + deltaBase
+	if negative {
+		if deltaBase >= requiredInsertCount {
+			return nil, fmt.Errorf("qpack: invalid Delta Base %d", deltaBase)
+		}
+		base = requiredInsertCount - deltaBase - 1
+	}
+
+	if requiredInsertCount > d.table.insertCount() {
+		if err := d.waitForInserts(ctx, streamID, requiredInsertCount); err != nil {
+			return nil, err
+		}
+	}
+	fields, err := parseFieldLines(p, &d.table, requiredInsertCount, base, maxSize)
+	if err != nil && err != ErrFieldSectionTooLarge {
+		return nil, err
+	}
+	// A field section that is too large was still processed completely, as far as the encoder is concerned.
+	if requiredInsertCount > 0 {
+		// Section Acknowledgment
+		if err := d.writeInstruction(appendInt(nil, 7, 0x80, streamID)); err != nil {
+			return nil, err
+		}
+		if requiredInsertCount > d.knownReceivedCount {
+			d.knownReceivedCount = requiredInsertCount
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// decodeRequiredInsertCount decodes the Required Insert Count, see Section 4.5.1.1 of RFC 9204.
+func (d *DynamicDecoder) decodeRequiredInsertCount(encoded uint64) (uint64, error) {
+	if encoded == 0 {
+		return 0, nil
+	}
+	maxEntries := d.config.MaxTableCapacity / entryOverhead
+	fullRange := 2 * maxEntries
+	if encoded > fullRange {
+		return 0, fmt.Errorf("qpack: invalid encoded Required Insert Count %d", encoded)
+	}
+	maxValue := d.table.insertCount() + maxEntries
+	maxWrapped := (maxValue / fullRange) * fullRange
+	requiredInsertCount := maxWrapped + encoded - 1
+	if requiredInsertCount > maxValue {
+		if requiredInsertCount <= fullRange {
+			return 0, fmt.Errorf("qpack: invalid encoded Required Insert Count %d", encoded)
+		}
+		requiredInsertCount -= fullRange
+	}
+	if requiredInsertCount == 0 {
+		return 0, fmt.Errorf("qpack: invalid encoded Required Insert Count %d", encoded)
+	}
+	return requiredInsertCount, nil
+}
+
+// waitForInserts blocks until the table contains the entries referenced by a field section.
+// It must be called with the mutex held.
+func (d *DynamicDecoder) waitForInserts(ctx context.Context, streamID uint64, requiredInsertCount uint64) error {
+	if d.blockedStreams >= d.config.MaxBlockedStreams {
+		return fmt.Errorf("qpack: too many blocked streams (maximum %d)", d.config.MaxBlockedStreams)
+	}
+	d.blockedStreams++
+	defer func() { d.blockedStreams-- }()
+
+	for requiredInsertCount > d.table.insertCount() {
+		inserted := d.inserted
+		d.mutex.Unlock()
+		select {
+		case <-inserted:
+			d.mutex.Lock()
+		case <-d.closed:
+			d.mutex.Lock()
+			return errEncoderStreamClosed
+		case <-ctx.Done():
+			d.mutex.Lock()
+			// Stream Cancellation
+			d.writeInstruction(appendInt(nil, 6, 0x40, streamID))
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (d *DynamicDecoder) writeInstruction(b []byte) error {
+	_, err := d.decoderStream.Write(b)
+	return err
+}
@@ -0,0 +1,207 @@
+package qpack
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dynamic Decoder", func() {
+	var (
+		dec           *DynamicDecoder
+		decoderStream *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		decoderStream = &bytes.Buffer{}
+		dec = NewDynamicDecoder(&Config{MaxTableCapacity: 220, MaxBlockedStreams: 2}, decoderStream)
+	})
+
+	// handleEncoderStream passes everything written to the returned pipe to the decoder.
+	// The error returned by HandleEncoderStream is sent on the channel.
+	handleEncoderStream := func() (*io.PipeWriter, chan error) {
+		r, w := io.Pipe()
+		errChan := make(chan error, 1)
+		go func() {
+			defer GinkgoRecover()
+			errChan <- dec.HandleEncoderStream(r)
+		}()
+		return w, errChan
+	}
+
+	It("decodes field sections that reference the dynamic table", func() {
+		// taken from Appendix B.2 of RFC 9204
+		Expect(dec.HandleEncoderStream(bytes.NewReader([]byte{
+			0x3f, 0xbd, 0x01, // Set Dynamic Table Capacity=220
+			0xc0, 0x0f, 'w', 'w', 'w', '.', 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm',
+			0xc1, 0x0c, '/', 's', 'a', 'm', 'p', 'l', 'e', '/', 'p', 'a', 't', 'h',
+		}))).To(MatchError(io.EOF))
+		Expect(decoderStream.Bytes()).To(Equal([]byte{0x02})) // Insert Count Increment
+		decoderStream.Reset()
+		fields, err := dec.DecodeFieldSection(context.Background(), 4, []byte{0x03, 0x81, 0x10, 0x11}, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(Equal([]HeaderField{
+			{Name: ":authority", Value: "www.example.com"},
+			{Name: ":path", Value: "/sample/path"},
+		}))
+		Expect(decoderStream.Bytes()).To(Equal([]byte{0x84})) // Section Acknowledgment
+	})
+
+	It("handles Insert With Literal Name and Duplicate instructions", func() {
+		Expect(dec.HandleEncoderStream(bytes.NewReader([]byte{
+			0x3f, 0xbd, 0x01, // Set Dynamic Table Capacity=220
+			// taken from Appendix B.3 of RFC 9204
+			0x4a, 'c', 'u', 's', 't', 'o', 'm', '-', 'k', 'e', 'y', 0x0c, 'c', 'u', 's', 't', 'o', 'm', '-', 'v', 'a', 'l', 'u', 'e',
+			0x00,                      // Duplicate, Relative Index=0
+			0x80, 0x03, 'f', 'o', 'o', // Insert With Name Reference, Relative Index=0
+		}))).To(MatchError(io.EOF))
+		Expect(dec.table.insertCount()).To(BeEquivalentTo(3))
+		Expect(dec.table.entries).To(Equal([]HeaderField{
+			{Name: "custom-key", Value: "custom-value"},
+			{Name: "custom-key", Value: "custom-value"},
+			{Name: "custom-key", Value: "foo"},
+		}))
+	})
+
+	It("handles instructions split across multiple reads", func() {
+		w, _ := handleEncoderStream()
+		defer w.Close()
+		for _, b := range []byte{0x3f, 0xbd, 0x01, 0x4a, 'c', 'u', 's', 't', 'o', 'm', '-', 'k', 'e', 'y', 0x01, 'v'} {
+			_, err := w.Write([]byte{b})
+			Expect(err).ToNot(HaveOccurred())
+		}
+		fields, err := dec.DecodeFieldSection(context.Background(), 4, []byte{0x02, 0x00, 0x80}, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(Equal([]HeaderField{{Name: "custom-key", Value: "v"}}))
+	})
+
+	It("decodes field sections using post-base indices", func() {
+		Expect(dec.HandleEncoderStream(bytes.NewReader([]byte{
+			0x3f, 0xbd, 0x01, // Set Dynamic Table Capacity=220
+			0x43, 'f', 'o', 'o', 0x03, 'b', 'a', 'r',
+			0x43, 'f', 'o', 'o', 0x03, 'b', 'a', 'z',
+		}))).To(MatchError(io.EOF))
+		// Required Insert Count = 2, Base = 1
+		fields, err := dec.DecodeFieldSection(context.Background(), 0, []byte{0x03, 0x80, 0x80, 0x10, 0x00, 0x03, 'q', 'u', 'x'}, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(Equal([]HeaderField{
+			{Name: "foo", Value: "bar"},
+			{Name: "foo", Value: "baz"},
+			{Name: "foo", Value: "qux"},
+		}))
+	})
+
+	It("limits the size of the decoded field section", func() {
+		Expect(dec.HandleEncoderStream(bytes.NewReader([]byte{
+			0x3f, 0xbd, 0x01, // Set Dynamic Table Capacity=220
+			0x43, 'f', 'o', 'o', 0x03, 'b', 'a', 'r',
+		}))).To(MatchError(io.EOF))
+		decoderStream.Reset()
+		// Required Insert Count = 1, Base = 1, the entry is referenced 3 times
+		p := []byte{0x02, 0x00, 0x80, 0x80, 0x80}
+		fields, err := dec.DecodeFieldSection(context.Background(), 4, p, 3*(3+3+32))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(HaveLen(3))
+		decoderStream.Reset()
+		_, err = dec.DecodeFieldSection(context.Background(), 8, p, 3*(3+3+32)-1)
+		Expect(err).To(MatchError(ErrFieldSectionTooLarge))
+		// the field section is still acknowledged
+		Expect(decoderStream.Bytes()).To(Equal([]byte{0x80 | 8}))
+	})
+
+	It("blocks until the referenced entries are received", func() {
+		w, _ := handleEncoderStream()
+		defer w.Close()
+		fieldsChan := make(chan []HeaderField)
+		go func() {
+			defer GinkgoRecover()
+			fields, err := dec.DecodeFieldSection(context.Background(), 4, []byte{0x02, 0x00, 0x80}, 0)
+			Expect(err).ToNot(HaveOccurred())
+			fieldsChan <- fields
+		}()
+		Consistently(fieldsChan).ShouldNot(Receive())
+		_, err := w.Write([]byte{0x3f, 0xbd, 0x01, 0x43, 'f', 'o', 'o', 0x03, 'b', 'a', 'r'})
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(fieldsChan).Should(Receive(Equal([]HeaderField{{Name: "foo", Value: "bar"}})))
+	})
+
+	It("errors when too many streams are blocked", func() {
+		dec.config.MaxBlockedStreams = 0
+		_, err := dec.DecodeFieldSection(context.Background(), 4, []byte{0x02, 0x00, 0x80}, 0)
+		Expect(err).To(MatchError("qpack: too many blocked streams (maximum 0)"))
+	})
+
+	It("cancels the stream when the context is canceled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		errChan := make(chan error)
+		go func() {
+			defer GinkgoRecover()
+			_, err := dec.DecodeFieldSection(ctx, 4, []byte{0x02, 0x00, 0x80}, 0)
+			errChan <- err
+		}()
+		Consistently(errChan).ShouldNot(Receive())
+		cancel()
+		Eventually(errChan).Should(Receive(Equal(context.Canceled)))
+		Expect(decoderStream.Bytes()).To(Equal([]byte{0x44})) // Stream Cancellation
+	})
+
+	It("unblocks streams when the encoder stream is closed", func() {
+		w, handleErr := handleEncoderStream()
+		errChan := make(chan error)
+		go func() {
+			defer GinkgoRecover()
+			_, err := dec.DecodeFieldSection(context.Background(), 4, []byte{0x02, 0x00, 0x80}, 0)
+			errChan <- err
+		}()
+		Consistently(errChan).ShouldNot(Receive())
+		Expect(w.Close()).To(Succeed())
+		Eventually(handleErr).Should(Receive(Equal(io.EOF)))
+		Eventually(errChan).Should(Receive(Equal(errEncoderStreamClosed)))
+	})
+
+	It("errors on invalid encoded Required Insert Counts", func() {
+		// With a maximum table capacity of 220, MaxEntries is 6, so the encoded value can be at most 12.
+		_, err := dec.DecodeFieldSection(context.Background(), 4, []byte{0x0d, 0x00}, 0)
+		Expect(err).To(MatchError("qpack: invalid encoded Required Insert Count 13"))
+	})
+
+	It("errors on references beyond the Required Insert Count", func() {
+		Expect(dec.HandleEncoderStream(bytes.NewReader([]byte{
+			0x3f, 0xbd, 0x01, // Set Dynamic Table Capacity=220
+			0x43, 'f', 'o', 'o', 0x03, 'b', 'a', 'r',
+			0x43, 'f', 'o', 'o', 0x03, 'b', 'a', 'z',
+		}))).To(MatchError(io.EOF))
+		// Required Insert Count = 1, Base = 1, referencing the entry with the absolute index 1
+		_, err := dec.DecodeFieldSection(context.Background(), 4, []byte{0x02, 0x00, 0x10}, 0)
+		Expect(err).To(MatchError("qpack: reference to entry 1 exceeds the Required Insert Count 1"))
+	})
+
+	Context("invalid encoder instructions", func() {
+		It("errors when the capacity exceeds the maximum table capacity", func() {
+			err := dec.HandleEncoderStream(bytes.NewReader([]byte{0x3f, 0xbe, 0x01})) // Set Dynamic Table Capacity=221
+			Expect(err).To(BeAssignableToTypeOf(&InstructionError{}))
+			Expect(err).To(MatchError("qpack: table capacity 221 exceeds the maximum table capacity 220"))
+		})
+
+		It("errors when an entry exceeds the capacity", func() {
+			err := dec.HandleEncoderStream(bytes.NewReader([]byte{0x43, 'f', 'o', 'o', 0x03, 'b', 'a', 'r'}))
+			Expect(err).To(BeAssignableToTypeOf(&InstructionError{}))
+			Expect(err).To(MatchError("qpack: entry of size 38 exceeds the table capacity 0"))
+		})
+
+		It("errors on invalid relative indices", func() {
+			err := dec.HandleEncoderStream(bytes.NewReader([]byte{0x3f, 0xbd, 0x01, 0x00})) // Duplicate, Relative Index=0
+			Expect(err).To(BeAssignableToTypeOf(&InstructionError{}))
+			Expect(err).To(MatchError("qpack: invalid relative index 0"))
+		})
+
+		It("errors on instructions that are too large", func() {
+			b := appendInt([]byte{0x3f, 0xbd, 0x01}, 5, 0x40, 1000) // Insert With Literal Name, with a 1000 byte name
+			err := dec.HandleEncoderStream(bytes.NewReader(append(b, make([]byte, 500)...)))
+			Expect(err).To(MatchError(&InstructionError{Err: errInstructionTooLarge}))
+		})
+	})
+})
@@ -0,0 +1,313 @@
+package qpack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// Fields that are not inserted into the dynamic table,
+// since their values are either sensitive or unlikely to be repeated on a connection.
+var doNotIndex = map[string]bool{
+	":path":               true,
+	"content-length":      true,
+	"date":                true,
+	"etag":                true,
+	"if-modified-since":   true,
+	"if-none-match":       true,
+	"last-modified":       true,
+	"location":            true,
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+}
+
+// Fields that are encoded with the N bit set, telling intermediaries to never index them.
+var neverIndexed = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+}
+
+// A fieldSection is a field section that references the dynamic table, and wasn't acknowledged yet.
+type fieldSection struct {
+	requiredInsertCount uint64
+	refs                []uint64 // absolute indices of the referenced entries
+}
+
+// A DynamicEncoder encodes field sections, and inserts fields into the dynamic table.
+// Instructions are sent to the peer's decoder on the encoder stream.
+// A DynamicEncoder is safe for concurrent use.
+type DynamicEncoder struct {
+	mutex sync.Mutex
+
+	config        Config
+	encoderStream io.Writer
+
+	table dynamicTable
+	// derived from the peer's maximum table capacity, used to encode the Required Insert Count
+	maxEntries        uint64
+	maxBlockedStreams uint64
+	// the number of inserts that the decoder is known to have received
+	knownReceivedCount uint64
+
+	refs     map[uint64]int             // the number of unacknowledged field sections referencing an entry
+	sections map[uint64][]*fieldSection // the unacknowledged field sections, by stream ID
+}
+
+// NewDynamicEncoder creates a new DynamicEncoder.
+// It doesn't use the dynamic table until SetPeerSettings is called.
+func NewDynamicEncoder(config *Config, encoderStream io.Writer) *DynamicEncoder {
+	return &DynamicEncoder{
+		config:        *config,
+		encoderStream: encoderStream,
+		refs:          make(map[uint64]int),
+		sections:      make(map[uint64][]*fieldSection),
+	}
+}
+
+// SetPeerSettings sets the limits announced by the peer's decoder in its SETTINGS.
+// It must be called at most once.
+func (e *DynamicEncoder) SetPeerSettings(maxTableCapacity, maxBlockedStreams uint64) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.maxEntries = maxTableCapacity / entryOverhead
+	e.maxBlockedStreams = utils.MinUint64(e.config.MaxBlockedStreams, maxBlockedStreams)
+	capacity := utils.MinUint64(e.config.MaxTableCapacity, maxTableCapacity)
+	if capacity == 0 {
+		return nil
+	}
+	e.table.setCapacity(capacity)
+	// Set Dynamic Table Capacity
+	_, err := e.encoderStream.Write(appendInt(nil, 5, 0x20, capacity))
+	return err
+}
+
+// EncodeFieldSection encodes a field section that is sent on the stream with the given ID.
+// Entries that are inserted into the dynamic table are sent on the encoder stream before it returns.
+func (e *DynamicEncoder) EncodeFieldSection(streamID uint64, fields []HeaderField) ([]byte, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// Referencing entries that the decoder didn't acknowledge yet might block the stream.
+	canBlock := e.isBlocking(streamID) || e.numBlockedStreams() < e.maxBlockedStreams
+	usable := func(i uint64) bool { return canBlock || i < e.knownReceivedCount }
+
+	type fieldLine struct {
+		hf       HeaderField
+		index    uint64
+		isStatic bool
+		indexed  bool // if false, the index refers to the name
+		hasIndex bool
+	}
+	lines := make([]fieldLine, 0, len(fields))
+	var instructions []byte
+	section := &fieldSection{}
+	reference := func(i uint64) {
+		e.refs[i]++
+		section.refs = append(section.refs, i)
+		if i+1 > section.requiredInsertCount {
+			section.requiredInsertCount = i + 1
+		}
+	}
+
+	for _, hf := range fields {
+		line := fieldLine{hf: hf}
+		if i, ok := staticTableFieldIndex[hf]; ok {
+			line.index, line.isStatic, line.indexed, line.hasIndex = i, true, true, true
+			lines = append(lines, line)
+			continue
+		}
+		i, exact, ok := e.table.find(hf)
+		if !exact && !doNotIndex[hf.Name] {
+			instructions, ok = e.insert(instructions, hf)
+			if ok {
+				i, exact = e.table.insertCount()-1, true
+			}
+		}
+		if exact && usable(i) {
+			reference(i)
+			line.index, line.indexed, line.hasIndex = i, true, true
+		} else if si, sok := staticTableNameIndex[hf.Name]; sok {
+			line.index, line.isStatic, line.hasIndex = si, true, true
+		} else if i, _, ok := e.table.find(hf); ok && usable(i) {
+			reference(i)
+			line.index, line.hasIndex = i, true
+		}
+		lines = append(lines, line)
+	}
+
+	// All dynamic table references use an index relative to the Base, so no post-base indices are needed.
+	base := e.table.insertCount()
+	var b []byte
+	if ric := section.requiredInsertCount; ric > 0 {
+		b = appendInt(b, 8, 0, ric%(2*e.maxEntries)+1)
+		b = appendInt(b, 7, 0, base-ric)
+	} else {
+		b = append(b, 0, 0)
+	}
+	for _, line := range lines {
+		var n byte
+		if neverIndexed[line.hf.Name] {
+			n = 0x20
+		}
+		switch {
+		case line.indexed && line.isStatic: // Indexed Field Line, static table
+			b = appendInt(b, 6, 0xc0, line.index)
+		case line.indexed: // Indexed Field Line, dynamic table
+			b = appendInt(b, 6, 0x80, base-1-line.index)
+		case line.hasIndex && line.isStatic: // Literal Field Line With Name Reference, static table
+			b = appendInt(b, 4, 0x50|n, line.index)
+			b = appendString(b, 7, 0, line.hf.Value)
+		case line.hasIndex: // Literal Field Line With Name Reference, dynamic table
+			b = appendInt(b, 4, 0x40|n, base-1-line.index)
+			b = appendString(b, 7, 0, line.hf.Value)
+		default: // Literal Field Line With Literal Name
+			b = appendString(b, 3, 0x20|n>>1, line.hf.Name)
+			b = appendString(b, 7, 0, line.hf.Value)
+		}
+	}
+
+	if section.requiredInsertCount > 0 {
+		e.sections[streamID] = append(e.sections[streamID], section)
+	}
+	if len(instructions) > 0 {
+		if _, err := e.encoderStream.Write(instructions); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// insert inserts a field into the dynamic table, and appends the insert instruction to b.
+// It returns false if the field doesn't fit, or if inserting it would evict entries that are still referenced.
+func (e *DynamicEncoder) insert(b []byte, hf HeaderField) ([]byte, bool) {
+	n, ok := e.table.numEvictionsFor(entrySize(hf))
+	if !ok {
+		return b, false
+	}
+	for i := 0; i < n; i++ {
+		if e.refs[e.table.evicted+uint64(i)] > 0 {
+			return b, false
+		}
+	}
+	if i, ok := staticTableNameIndex[hf.Name]; ok {
+		// Insert with Name Reference, static table
+		b = appendInt(b, 6, 0xc0, i)
+	} else if i, _, ok := e.table.find(hf); ok {
+		// Insert with Name Reference, dynamic table.
+		// The decoder resolves the name before evicting entries, so this works even if the entry is evicted by this insert.
+		b = appendInt(b, 6, 0x80, e.table.insertCount()-1-i)
+	} else {
+		// Insert with Literal Name
+		b = appendString(b, 5, 0x40, hf.Name)
+	}
+	b = appendString(b, 7, 0, hf.Value)
+	e.table.insert(hf)
+	return b, true
+}
+
+// isBlocking says if the stream has a field section that might be blocked at the decoder.
+func (e *DynamicEncoder) isBlocking(streamID uint64) bool {
+	for _, s := range e.sections[streamID] {
+		if s.requiredInsertCount > e.knownReceivedCount {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *DynamicEncoder) numBlockedStreams() uint64 {
+	var n uint64
+	for id := range e.sections {
+		if e.isBlocking(id) {
+			n++
+		}
+	}
+	return n
+}
+
+// HandleDecoderStream reads the instructions that the peer sends on the decoder stream.
+// It blocks until reading from the stream fails, or an invalid instruction is received.
+// Invalid instructions result in an InstructionError.
+func (e *DynamicEncoder) HandleDecoderStream(r io.Reader) error {
+	// Decoder instructions consist of a single integer.
+	return readInstructions(r, 16, e.handleDecoderInstructions)
+}
+
+func (e *DynamicEncoder) handleDecoderInstructions(b []byte) ([]byte, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for len(b) > 0 {
+		rest, err := e.parseDecoderInstruction(b)
+		if err == errTruncated {
+			return b, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		b = rest
+	}
+	return b, nil
+}
+
+// parseDecoderInstruction parses and executes one decoder instruction, see Section 4.4 of RFC 9204.
+func (e *DynamicEncoder) parseDecoderInstruction(b []byte) ([]byte, error) {
+	switch {
+	case b[0]&0x80 > 0: // Section Acknowledgment
+		streamID, b, err := readInt(b, 7)
+		if err != nil {
+			return nil, err
+		}
+		sections := e.sections[streamID]
+		if len(sections) == 0 {
+			return nil, fmt.Errorf("qpack: Section Acknowledgment for stream %d without an outstanding field section", streamID)
+		}
+		e.release(sections[0])
+		if len(sections) == 1 {
+			delete(e.sections, streamID)
+		} else {
+			e.sections[streamID] = sections[1:]
+		}
+		if sections[0].requiredInsertCount > e.knownReceivedCount {
+			e.knownReceivedCount = sections[0].requiredInsertCount
+		}
+		return b, nil
+	case b[0]&0x40 > 0: // Stream Cancellation
+		streamID, b, err := readInt(b, 6)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range e.sections[streamID] {
+			e.release(s)
+		}
+		delete(e.sections, streamID)
+		return b, nil
+	default: // Insert Count Increment
+		inc, b, err := readInt(b, 6)
+		if err != nil {
+			return nil, err
+		}
+		if inc == 0 {
+			return nil, errors.New("qpack: Insert Count Increment of 0")
+		}
+		if inc > e.table.insertCount()-e.knownReceivedCount {
+			return nil, fmt.Errorf("qpack: Insert Count Increment of %d exceeds the number of inserts", inc)
+		}
+		e.knownReceivedCount += inc
+		return b, nil
+	}
+}
+
+func (e *DynamicEncoder) release(s *fieldSection) {
+	for _, i := range s.refs {
+		if e.refs[i]--; e.refs[i] == 0 {
+			delete(e.refs, i)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package qpack
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dynamic Encoder", func() {
+	var (
+		enc           *DynamicEncoder
+		encoderStream *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		encoderStream = &bytes.Buffer{}
+		enc = NewDynamicEncoder(&Config{MaxTableCapacity: 4096, MaxBlockedStreams: 10}, encoderStream)
+	})
+
+	// decode decodes a field section, using a decoder that received all instructions sent by the encoder so far
+	decode := func(streamID uint64, p []byte) []HeaderField {
+		dec := NewDynamicDecoder(&Config{MaxTableCapacity: 220, MaxBlockedStreams: 10}, ioutil.Discard)
+		Expect(dec.HandleEncoderStream(bytes.NewReader(encoderStream.Bytes()))).To(MatchError(io.EOF))
+		fields, err := dec.DecodeFieldSection(context.Background(), streamID, p, 0)
+		Expect(err).ToNot(HaveOccurred())
+		return fields
+	}
+
+	It("only uses the static table before receiving the peer's SETTINGS", func() {
+		fields := []HeaderField{
+			{Name: ":method", Value: "GET"},
+			{Name: ":path", Value: "/foo"},
+			{Name: "foo", Value: "bar"},
+		}
+		p, err := enc.EncodeFieldSection(0, fields)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(encoderStream.Len()).To(BeZero())
+		b := &bytes.Buffer{}
+		staticEnc := NewEncoder(b)
+		for _, f := range fields {
+			Expect(staticEnc.WriteField(f)).To(Succeed())
+		}
+		Expect(staticEnc.Close()).To(Succeed())
+		Expect(p).To(Equal(b.Bytes()))
+	})
+
+	It("sets the dynamic table capacity", func() {
+		Expect(enc.SetPeerSettings(220, 100)).To(Succeed())
+		Expect(encoderStream.Bytes()).To(Equal([]byte{0x3f, 0xbd, 0x01}))
+		Expect(enc.maxBlockedStreams).To(BeEquivalentTo(10))
+		Expect(enc.maxEntries).To(BeEquivalentTo(6))
+	})
+
+	It("doesn't use the dynamic table if the peer doesn't allow it", func() {
+		Expect(enc.SetPeerSettings(0, 100)).To(Succeed())
+		Expect(encoderStream.Len()).To(BeZero())
+		p, err := enc.EncodeFieldSection(0, []HeaderField{{Name: "foo", Value: "bar"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p[:2]).To(Equal([]byte{0, 0}))
+		Expect(encoderStream.Len()).To(BeZero())
+	})
+
+	It("inserts fields into the dynamic table, and references them", func() {
+		Expect(enc.SetPeerSettings(220, 100)).To(Succeed())
+		fields := []HeaderField{
+			{Name: ":authority", Value: "www.example.com"},
+			{Name: ":method", Value: "GET"},
+			{Name: "custom-key", Value: "custom-value"},
+			{Name: "custom-key", Value: "other-value"},
+		}
+		p, err := enc.EncodeFieldSection(4, fields)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(enc.table.insertCount()).To(BeEquivalentTo(3))
+		Expect(decode(4, p)).To(Equal(fields))
+		// the second field section doesn't insert anything
+		l := encoderStream.Len()
+		p, err = enc.EncodeFieldSection(8, fields)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(encoderStream.Len()).To(Equal(l))
+		Expect(decode(8, p)).To(Equal(fields))
+	})
+
+	It("doesn't insert fields that are unlikely to be repeated, and sets the N bit for sensitive fields", func() {
+		Expect(enc.SetPeerSettings(220, 100)).To(Succeed())
+		encoderStream.Reset()
+		fields := []HeaderField{
+			{Name: ":path", Value: "/foo"},
+			{Name: "authorization", Value: "secret"},
+		}
+		p, err := enc.EncodeFieldSection(0, fields)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(encoderStream.Len()).To(BeZero())
+		expected := appendInt([]byte{0, 0}, 4, 0x50, 1) // :path, with a static name reference
+		expected = appendString(expected, 7, 0, "/foo")
+		expected = appendInt(expected, 4, 0x70, 84) // authorization, with a static name reference and the N bit
+		expected = appendString(expected, 7, 0, "secret")
+		Expect(p).To(Equal(expected))
+		Expect(decode(0, p)).To(Equal(fields))
+	})
+
+	It("doesn't reference unacknowledged entries when it isn't allowed to block streams", func() {
+		Expect(enc.SetPeerSettings(220, 0)).To(Succeed())
+		fields := []HeaderField{{Name: "foo", Value: "bar"}}
+		p, err := enc.EncodeFieldSection(0, fields)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(enc.table.insertCount()).To(BeEquivalentTo(1))
+		Expect(p[:2]).To(Equal([]byte{0, 0}))
+		Expect(decode(0, p)).To(Equal(fields))
+		// Insert Count Increment
+		Expect(enc.HandleDecoderStream(bytes.NewReader([]byte{0x01}))).To(MatchError(io.EOF))
+		p, err = enc.EncodeFieldSection(4, fields)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(Equal([]byte{0x02, 0x00, 0x80}))
+	})
+
+	It("limits the number of blocked streams", func() {
+		Expect(enc.SetPeerSettings(220, 1)).To(Succeed())
+		p, err := enc.EncodeFieldSection(0, []HeaderField{{Name: "foo", Value: "bar"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(Equal([]byte{0x02, 0x00, 0x80}))
+		// the same stream can reference unacknowledged entries
+		p, err = enc.EncodeFieldSection(0, []HeaderField{{Name: "foo", Value: "baz"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(Equal([]byte{0x03, 0x00, 0x80}))
+		// other streams can't
+		p, err = enc.EncodeFieldSection(4, []HeaderField{{Name: "foo", Value: "bar"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p[:2]).To(Equal([]byte{0, 0}))
+		// Section Acknowledgment for the first field section on stream 0
+		Expect(enc.HandleDecoderStream(bytes.NewReader([]byte{0x80}))).To(MatchError(io.EOF))
+		p, err = enc.EncodeFieldSection(4, []HeaderField{{Name: "foo", Value: "bar"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(Equal([]byte{0x02, 0x01, 0x81}))
+	})
+
+	It("doesn't evict entries that are still referenced", func() {
+		Expect(enc.SetPeerSettings(100, 100)).To(Succeed())
+		_, err := enc.EncodeFieldSection(0, []HeaderField{{Name: "foo", Value: "bar"}})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = enc.EncodeFieldSection(4, []HeaderField{{Name: "lorem", Value: "ipsum"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(enc.table.insertCount()).To(BeEquivalentTo(2))
+		// inserting this entry would require evicting foo: bar
+		_, err = enc.EncodeFieldSection(8, []HeaderField{{Name: "dolor", Value: "sit amet"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(enc.table.insertCount()).To(BeEquivalentTo(2))
+		// Stream Cancellation for stream 0
+		Expect(enc.HandleDecoderStream(bytes.NewReader([]byte{0x40}))).To(MatchError(io.EOF))
+		_, err = enc.EncodeFieldSection(8, []HeaderField{{Name: "dolor", Value: "sit amet"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(enc.table.insertCount()).To(BeEquivalentTo(3))
+		Expect(enc.table.evicted).To(BeEquivalentTo(1))
+	})
+
+	It("encodes field sections that can be decoded by a DynamicDecoder", func() {
+		encR, encW := io.Pipe()
+		decR, decW := io.Pipe()
+		enc = NewDynamicEncoder(&Config{MaxTableCapacity: 300, MaxBlockedStreams: 3}, encW)
+		dec := NewDynamicDecoder(&Config{MaxTableCapacity: 300, MaxBlockedStreams: 3}, decW)
+		defer encW.Close()
+		defer decW.Close()
+		go dec.HandleEncoderStream(encR)
+		go enc.HandleDecoderStream(decR)
+		Expect(enc.SetPeerSettings(300, 3)).To(Succeed())
+
+		for i := 0; i < 50; i++ {
+			fields := []HeaderField{
+				{Name: ":method", Value: "GET"},
+				{Name: ":authority", Value: "quic.clemente.io"},
+				{Name: ":path", Value: "/" + string('a'+byte(i%26))},
+				{Name: "user-agent", Value: "quic-go HTTP/3"},
+				{Name: "x-counter", Value: string('a' + byte(i%7))},
+				{Name: "x-" + string('a'+byte(i%5)), Value: "value"},
+			}
+			streamID := uint64(4 * i)
+			p, err := enc.EncodeFieldSection(streamID, fields)
+			Expect(err).ToNot(HaveOccurred())
+			decoded, err := dec.DecodeFieldSection(context.Background(), streamID, p, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decoded).To(Equal(fields))
+		}
+	})
+
+	Context("invalid decoder instructions", func() {
+		It("errors on Section Acknowledgments for streams without outstanding field sections", func() {
+			err := enc.HandleDecoderStream(bytes.NewReader([]byte{0x84}))
+			Expect(err).To(BeAssignableToTypeOf(&InstructionError{}))
+			Expect(err).To(MatchError("qpack: Section Acknowledgment for stream 4 without an outstanding field section"))
+		})
+
+		It("errors on Insert Count Increments of 0", func() {
+			err := enc.HandleDecoderStream(bytes.NewReader([]byte{0x00}))
+			Expect(err).To(BeAssignableToTypeOf(&InstructionError{}))
+			Expect(err).To(MatchError("qpack: Insert Count Increment of 0"))
+		})
+
+		It("errors on Insert Count Increments that exceed the number of inserts", func() {
+			Expect(enc.SetPeerSettings(220, 100)).To(Succeed())
+			_, err := enc.EncodeFieldSection(0, []HeaderField{{Name: "foo", Value: "bar"}})
+			Expect(err).ToNot(HaveOccurred())
+			err = enc.HandleDecoderStream(bytes.NewReader([]byte{0x02}))
+			Expect(err).To(BeAssignableToTypeOf(&InstructionError{}))
+			Expect(err).To(MatchError("qpack: Insert Count Increment of 2 exceeds the number of inserts"))
+		})
+	})
+})
@@ -0,0 +1,91 @@
+package qpack
+
+// entryOverhead is the number of bytes added to the length of the name and the value
+// when calculating the size of a dynamic table entry, see Section 3.2.1 of RFC 9204.
+const entryOverhead = 32
+
+func entrySize(hf HeaderField) uint64 {
+	return uint64(len(hf.Name)+len(hf.Value)) + entryOverhead
+}
+
+// The dynamicTable is the dynamic table, as used by both the encoder and the decoder.
+// Entries are identified by their absolute index, see Section 3.2.4 of RFC 9204.
+type dynamicTable struct {
+	entries []HeaderField // the oldest entry first
+	evicted uint64        // the number of entries that were evicted, i.e. the absolute index of entries[0]
+
+	size     uint64
+	capacity uint64
+}
+
+// insertCount is the total number of entries inserted into the table.
+func (t *dynamicTable) insertCount() uint64 {
+	return t.evicted + uint64(len(t.entries))
+}
+
+// get returns the entry with the absolute index i.
+// It returns false if the entry was already evicted, or not yet inserted.
+func (t *dynamicTable) get(i uint64) (HeaderField, bool) {
+	if i < t.evicted || i >= t.insertCount() {
+		return HeaderField{}, false
+	}
+	return t.entries[i-t.evicted], true
+}
+
+// find returns the absolute index of the newest entry that matches hf.
+// If no entry matches both the name and the value, it returns the newest entry with the same name, and exact is false.
+func (t *dynamicTable) find(hf HeaderField) (index uint64, exact bool, ok bool) {
+	for i := len(t.entries) - 1; i >= 0; i-- {
+		e := t.entries[i]
+		if e.Name != hf.Name {
+			continue
+		}
+		if e.Value == hf.Value {
+			return t.evicted + uint64(i), true, true
+		}
+		if !ok {
+			index, ok = t.evicted+uint64(i), true
+		}
+	}
+	return
+}
+
+// insert adds an entry, evicting entries as needed.
+// The caller has to make sure that the entry fits into the table.
+func (t *dynamicTable) insert(hf HeaderField) {
+	size := entrySize(hf)
+	t.evictUntil(t.capacity - size)
+	t.entries = append(t.entries, hf)
+	t.size += size
+}
+
+// setCapacity sets the capacity, evicting entries as needed.
+func (t *dynamicTable) setCapacity(c uint64) {
+	t.capacity = c
+	t.evictUntil(c)
+}
+
+// evictUntil evicts the oldest entries until the size of the table is at most size.
+func (t *dynamicTable) evictUntil(size uint64) {
+	var n int
+	for t.size > size {
+		t.size -= entrySize(t.entries[n])
+		t.entries[n] = HeaderField{} // allow garbage collection
+		n++
+	}
+	t.entries = t.entries[n:]
+	t.evicted += uint64(n)
+}
+
+// numEvictionsFor returns the number of entries that have to be evicted to make room for an entry of the given size.
+// It returns false if the entry is larger than the capacity of the table.
+func (t *dynamicTable) numEvictionsFor(size uint64) (int, bool) {
+	if size > t.capacity {
+		return 0, false
+	}
+	var n int
+	for freed := t.capacity - t.size; freed < size; n++ {
+		freed += entrySize(t.entries[n])
+	}
+	return n, true
+}
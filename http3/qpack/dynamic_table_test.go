@@ -0,0 +1,91 @@
+package qpack
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dynamic Table", func() {
+	var table *dynamicTable
+
+	BeforeEach(func() {
+		table = &dynamicTable{}
+		table.setCapacity(100)
+	})
+
+	It("calculates the size of entries", func() {
+		Expect(entrySize(HeaderField{Name: "foo", Value: "bar"})).To(BeEquivalentTo(38))
+	})
+
+	It("inserts entries", func() {
+		table.insert(HeaderField{Name: "foo", Value: "bar"})
+		table.insert(HeaderField{Name: "lorem", Value: "ipsum"})
+		Expect(table.insertCount()).To(BeEquivalentTo(2))
+		Expect(table.size).To(BeEquivalentTo(38 + 42))
+		hf, ok := table.get(0)
+		Expect(ok).To(BeTrue())
+		Expect(hf).To(Equal(HeaderField{Name: "foo", Value: "bar"}))
+		hf, ok = table.get(1)
+		Expect(ok).To(BeTrue())
+		Expect(hf).To(Equal(HeaderField{Name: "lorem", Value: "ipsum"}))
+		_, ok = table.get(2)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("evicts the oldest entries when inserting", func() {
+		table.insert(HeaderField{Name: "foo", Value: "bar"})        // 38 bytes
+		table.insert(HeaderField{Name: "lorem", Value: "ipsum"})    // 42 bytes
+		table.insert(HeaderField{Name: "dolor", Value: "sit amet"}) // 45 bytes
+		Expect(table.insertCount()).To(BeEquivalentTo(3))
+		Expect(table.evicted).To(BeEquivalentTo(1))
+		Expect(table.size).To(BeEquivalentTo(42 + 45))
+		_, ok := table.get(0)
+		Expect(ok).To(BeFalse())
+		hf, ok := table.get(2)
+		Expect(ok).To(BeTrue())
+		Expect(hf).To(Equal(HeaderField{Name: "dolor", Value: "sit amet"}))
+	})
+
+	It("evicts entries when the capacity is reduced", func() {
+		table.insert(HeaderField{Name: "foo", Value: "bar"})
+		table.insert(HeaderField{Name: "lorem", Value: "ipsum"})
+		table.setCapacity(50)
+		Expect(table.evicted).To(BeEquivalentTo(1))
+		Expect(table.size).To(BeEquivalentTo(42))
+		table.setCapacity(0)
+		Expect(table.evicted).To(BeEquivalentTo(2))
+		Expect(table.size).To(BeZero())
+		Expect(table.insertCount()).To(BeEquivalentTo(2))
+	})
+
+	It("finds entries", func() {
+		table.insert(HeaderField{Name: "foo", Value: "bar"})
+		table.insert(HeaderField{Name: "foo", Value: "baz"})
+		i, exact, ok := table.find(HeaderField{Name: "foo", Value: "bar"})
+		Expect(ok).To(BeTrue())
+		Expect(exact).To(BeTrue())
+		Expect(i).To(BeZero())
+		i, exact, ok = table.find(HeaderField{Name: "foo", Value: "foobar"})
+		Expect(ok).To(BeTrue())
+		Expect(exact).To(BeFalse())
+		Expect(i).To(BeEquivalentTo(1))
+		_, _, ok = table.find(HeaderField{Name: "bar", Value: "foo"})
+		Expect(ok).To(BeFalse())
+	})
+
+	It("calculates the number of evictions needed to insert an entry", func() {
+		table.insert(HeaderField{Name: "foo", Value: "bar"})
+		table.insert(HeaderField{Name: "lorem", Value: "ipsum"})
+		n, ok := table.numEvictionsFor(20)
+		Expect(ok).To(BeTrue())
+		Expect(n).To(BeZero())
+		n, ok = table.numEvictionsFor(21)
+		Expect(ok).To(BeTrue())
+		Expect(n).To(Equal(1))
+		n, ok = table.numEvictionsFor(100)
+		Expect(ok).To(BeTrue())
+		Expect(n).To(Equal(2))
+		_, ok = table.numEvictionsFor(101)
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,42 @@
+package qpack
+
+import "io"
+
+// An Encoder encodes field sections.
+// It only uses the static table, so it never has to send instructions on the encoder stream.
+type Encoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewEncoder creates a new Encoder, which writes field sections to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// WriteField encodes f as a field line of the current field section.
+// The field section is written to the underlying io.Writer when Close is called.
+func (e *Encoder) WriteField(f HeaderField) error {
+	if i, ok := staticTableFieldIndex[f]; ok {
+		// Indexed Field Line, referencing the static table
+		e.buf = appendInt(e.buf, 6, 0xc0, i)
+	} else if i, ok := staticTableNameIndex[f.Name]; ok {
+		// Literal Field Line With Name Reference, referencing the static table
+		e.buf = appendInt(e.buf, 4, 0x50, i)
+		e.buf = appendString(e.buf, 7, 0, f.Value)
+	} else {
+		// Literal Field Line With Literal Name
+		e.buf = appendString(e.buf, 3, 0x20, f.Name)
+		e.buf = appendString(e.buf, 7, 0, f.Value)
+	}
+	return nil
+}
+
+// Close writes the field section to the underlying io.Writer.
+// Afterwards, the Encoder can be used to encode the next field section.
+func (e *Encoder) Close() error {
+	// Since the dynamic table is not used, the Required Insert Count and the Base are 0.
+	_, err := e.w.Write(append([]byte{0, 0}, e.buf...))
+	e.buf = e.buf[:0]
+	return err
+}
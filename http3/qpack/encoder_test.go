@@ -0,0 +1,82 @@
+package qpack
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Encoder", func() {
+	var (
+		buf *bytes.Buffer
+		enc *Encoder
+	)
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		enc = NewEncoder(buf)
+	})
+
+	decode := func() []HeaderField {
+		fields, err := NewDecoder().DecodeFull(buf.Bytes())
+		Expect(err).ToNot(HaveOccurred())
+		return fields
+	}
+
+	It("doesn't write anything before the field section is closed", func() {
+		Expect(enc.WriteField(HeaderField{Name: "foo", Value: "bar"})).To(Succeed())
+		Expect(buf.Len()).To(BeZero())
+	})
+
+	It("writes an empty field section", func() {
+		Expect(enc.Close()).To(Succeed())
+		Expect(buf.Bytes()).To(Equal([]byte{0, 0}))
+	})
+
+	It("uses the static table for fields that are in the static table", func() {
+		Expect(enc.WriteField(HeaderField{Name: ":method", Value: "GET"})).To(Succeed())
+		Expect(enc.Close()).To(Succeed())
+		Expect(buf.Bytes()).To(Equal([]byte{0, 0, 0xc0 | 17}))
+		Expect(decode()).To(Equal([]HeaderField{{Name: ":method", Value: "GET"}}))
+	})
+
+	It("references names in the static table", func() {
+		Expect(enc.WriteField(HeaderField{Name: ":path", Value: "/index.html"})).To(Succeed())
+		Expect(enc.Close()).To(Succeed())
+		Expect(buf.Bytes()[2]).To(Equal(byte(0x51)))
+		Expect(decode()).To(Equal([]HeaderField{{Name: ":path", Value: "/index.html"}}))
+	})
+
+	It("encodes names that are not in the static table", func() {
+		Expect(enc.WriteField(HeaderField{Name: "foo", Value: "bar"})).To(Succeed())
+		Expect(enc.Close()).To(Succeed())
+		Expect(buf.Bytes()[2] & 0xe0).To(Equal(byte(0x20)))
+		Expect(decode()).To(Equal([]HeaderField{{Name: "foo", Value: "bar"}}))
+	})
+
+	It("encodes multiple fields", func() {
+		fields := []HeaderField{
+			{Name: ":status", Value: "200"},
+			{Name: "content-type", Value: "text/html; charset=utf-8"},
+			{Name: "content-length", Value: "1337"},
+			{Name: "x-foo", Value: ""},
+			{Name: "x-bar", Value: "lorem ipsum dolor sit amet"},
+		}
+		for _, f := range fields {
+			Expect(enc.WriteField(f)).To(Succeed())
+		}
+		Expect(enc.Close()).To(Succeed())
+		Expect(decode()).To(Equal(fields))
+	})
+
+	It("encodes multiple field sections", func() {
+		Expect(enc.WriteField(HeaderField{Name: "foo", Value: "bar"})).To(Succeed())
+		Expect(enc.Close()).To(Succeed())
+		Expect(decode()).To(Equal([]HeaderField{{Name: "foo", Value: "bar"}}))
+		buf.Reset()
+		Expect(enc.WriteField(HeaderField{Name: "lorem", Value: "ipsum"})).To(Succeed())
+		Expect(enc.Close()).To(Succeed())
+		Expect(decode()).To(Equal([]HeaderField{{Name: "lorem", Value: "ipsum"}}))
+	})
+})
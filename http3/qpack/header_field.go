@@ -0,0 +1,18 @@
+// Package qpack implements QPACK, the field compression format for HTTP/3.
+// Warning: This API should not be considered stable and might change soon.
+package qpack
+
+// A HeaderField is a name-value pair.
+// Both the name and the value are treated as opaque sequences of octets.
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// IsPseudo reports whether the header field is an HTTP/3 pseudo header.
+// That is, it reports whether it starts with a colon.
+// It is not otherwise guaranteed to be a valid pseudo header field,
+// though.
+func (hf HeaderField) IsPseudo() bool {
+	return len(hf.Name) != 0 && hf.Name[0] == ':'
+}
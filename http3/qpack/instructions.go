@@ -0,0 +1,29 @@
+package qpack
+
+import "io"
+
+// readInstructions reads instructions from the encoder or the decoder stream, until reading fails.
+// The data read is passed to handle, which returns the bytes belonging to an incomplete instruction.
+// These bytes are passed to handle again, together with the next data read.
+// Instructions (including the bytes of an incomplete instruction) can be at most maxLen bytes long.
+func readInstructions(r io.Reader, maxLen uint64, handle func([]byte) ([]byte, error)) error {
+	var buf []byte
+	b := make([]byte, 2048)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			rest, herr := handle(append(buf, b[:n]...))
+			if herr != nil {
+				return &InstructionError{Err: herr}
+			}
+			if uint64(len(rest)) > maxLen {
+				return &InstructionError{Err: errInstructionTooLarge}
+			}
+			// copy the incomplete instruction to the start of the buffer
+			buf = append(buf[:0], rest...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
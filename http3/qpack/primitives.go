@@ -0,0 +1,99 @@
+package qpack
+
+import (
+	"errors"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+var (
+	errTruncated       = errors.New("qpack: truncated field section")
+	errIntegerOverflow = errors.New("qpack: integer overflow")
+	errInvalidHuffman  = errors.New("qpack: invalid Huffman-encoded data")
+
+	errInstructionTooLarge = errors.New("qpack: instruction too large")
+)
+
+// appendInt appends an integer with an n-bit prefix (see Section 4.1.1 of RFC 9204).
+// The flags are the bits of the first byte that precede the prefix.
+func appendInt(b []byte, n uint8, flags byte, i uint64) []byte {
+	max := uint64(1)<<n - 1
+	if i < max {
+		return append(b, flags|byte(i))
+	}
+	b = append(b, flags|byte(max))
+	i -= max
+	for i >= 0x80 {
+		b = append(b, byte(i&0x7f)|0x80)
+		i >>= 7
+	}
+	return append(b, byte(i))
+}
+
+// readInt reads an integer with an n-bit prefix.
+// It returns the remaining bytes.
+func readInt(b []byte, n uint8) (uint64, []byte, error) {
+	if len(b) == 0 {
+		return 0, nil, errTruncated
+	}
+	max := uint64(1)<<n - 1
+	i := uint64(b[0]) & max
+	b = b[1:]
+	if i < max {
+		return i, b, nil
+	}
+	var shift uint
+	for {
+		if len(b) == 0 {
+			return 0, nil, errTruncated
+		}
+		c := b[0]
+		b = b[1:]
+		i += uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return i, b, nil
+		}
+		shift += 7
+		if shift >= 63 {
+			return 0, nil, errIntegerOverflow
+		}
+	}
+}
+
+// appendString appends a string literal (see Section 4.1.2 of RFC 9204).
+// The length is encoded with an n-bit prefix, and the bit preceding the prefix is the Huffman flag.
+// The string is Huffman-encoded if that makes it shorter.
+func appendString(b []byte, n uint8, flags byte, s string) []byte {
+	if l := hpack.HuffmanEncodeLength(s); l < uint64(len(s)) {
+		b = appendInt(b, n, flags|1<<n, l)
+		return hpack.AppendHuffmanString(b, s)
+	}
+	b = appendInt(b, n, flags, uint64(len(s)))
+	return append(b, s...)
+}
+
+// readString reads a string literal, whose length is encoded with an n-bit prefix.
+// It returns the remaining bytes.
+func readString(b []byte, n uint8) (string, []byte, error) {
+	if len(b) == 0 {
+		return "", nil, errTruncated
+	}
+	huffman := b[0]&(1<<n) != 0
+	l, b, err := readInt(b, n)
+	if err != nil {
+		return "", nil, err
+	}
+	if uint64(len(b)) < l {
+		return "", nil, errTruncated
+	}
+	data := b[:l]
+	b = b[l:]
+	if !huffman {
+		return string(data), b, nil
+	}
+	s, err := hpack.HuffmanDecodeToString(data)
+	if err != nil {
+		return "", nil, errInvalidHuffman
+	}
+	return s, b, nil
+}
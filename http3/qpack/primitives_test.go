@@ -0,0 +1,87 @@
+package qpack
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Primitives", func() {
+	Context("integers", func() {
+		// examples from Appendix C.1 of RFC 7541
+		It("encodes and decodes an integer that fits into the prefix", func() {
+			b := appendInt(nil, 5, 0xa0, 10)
+			Expect(b).To(Equal([]byte{0xaa}))
+			i, rest, err := readInt(b, 5)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(i).To(BeEquivalentTo(10))
+			Expect(rest).To(BeEmpty())
+		})
+
+		It("encodes and decodes an integer that doesn't fit into the prefix", func() {
+			b := appendInt(nil, 5, 0, 1337)
+			Expect(b).To(Equal([]byte{0x1f, 0x9a, 0x0a}))
+			i, rest, err := readInt(append(b, 0x42), 5)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(i).To(BeEquivalentTo(1337))
+			Expect(rest).To(Equal([]byte{0x42}))
+		})
+
+		It("encodes and decodes an integer with an 8 bit prefix", func() {
+			b := appendInt(nil, 8, 0, 42)
+			Expect(b).To(Equal([]byte{0x2a}))
+			i, _, err := readInt(b, 8)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(i).To(BeEquivalentTo(42))
+		})
+
+		It("errors on truncated integers", func() {
+			b := appendInt(nil, 5, 0, 1337)
+			for i := range b {
+				_, _, err := readInt(b[:i], 5)
+				Expect(err).To(MatchError(errTruncated))
+			}
+		})
+
+		It("errors on integers that are too large", func() {
+			b := []byte{0x1f}
+			for i := 0; i < 10; i++ {
+				b = append(b, 0xff)
+			}
+			_, _, err := readInt(append(b, 0x1), 5)
+			Expect(err).To(MatchError(errIntegerOverflow))
+		})
+	})
+
+	Context("strings", func() {
+		It("encodes and decodes Huffman-encoded strings", func() {
+			b := appendString(nil, 7, 0, "www.example.com")
+			Expect(b[0] & 0x80).ToNot(BeZero())
+			Expect(len(b)).To(BeNumerically("<", 1+len("www.example.com")))
+			s, rest, err := readString(b, 7)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal("www.example.com"))
+			Expect(rest).To(BeEmpty())
+		})
+
+		It("doesn't Huffman-encode strings if that would make them longer", func() {
+			b := appendString(nil, 3, 0x20, "{}~^")
+			Expect(b).To(Equal([]byte{0x24, '{', '}', '~', '^'}))
+			s, _, err := readString(b, 3)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal("{}~^"))
+		})
+
+		It("errors on truncated strings", func() {
+			b := appendString(nil, 7, 0, strings.Repeat("foobar", 10))
+			_, _, err := readString(b[:len(b)-1], 7)
+			Expect(err).To(MatchError(errTruncated))
+		})
+
+		It("errors on invalid Huffman-encoded data", func() {
+			_, _, err := readString([]byte{0x81, 0x00}, 7)
+			Expect(err).To(MatchError(errInvalidHuffman))
+		})
+	})
+})
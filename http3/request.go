@@ -0,0 +1,110 @@
+package http3
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/lucas-clemente/quic-go/http3/qpack"
+)
+
+func requestFromHeaders(headers []qpack.HeaderField) (*http.Request, error) {
+	var path, authority, method, protocol, contentLengthStr string
+	httpHeaders := http.Header{}
+	var trailer http.Header
+
+	for _, h := range headers {
+		switch h.Name {
+		case ":path":
+			path = h.Value
+		case ":method":
+			method = h.Value
+		case ":authority":
+			authority = h.Value
+		case ":protocol":
+			protocol = h.Value
+		case "content-length":
+			contentLengthStr = h.Value
+		case "trailer":
+			// The trailers are sent after the body, in a HEADERS frame.
+			if trailer == nil {
+				trailer = http.Header{}
+			}
+			foreachHeaderElement(h.Value, func(v string) {
+				if key := http.CanonicalHeaderKey(v); httpguts.ValidTrailerHeader(key) {
+					trailer[key] = nil
+				}
+			})
+		default:
+			if !h.IsPseudo() {
+				httpHeaders.Add(h.Name, h.Value)
+			}
+		}
+	}
+
+	// concatenate cookie headers, see https://tools.ietf.org/html/rfc6265#section-5.4
+	if len(httpHeaders["Cookie"]) > 0 {
+		httpHeaders.Set("Cookie", strings.Join(httpHeaders["Cookie"], "; "))
+	}
+
+	if len(path) == 0 || len(authority) == 0 || len(method) == 0 {
+		return nil, errors.New(":path, :authority and :method must not be empty")
+	}
+	// The :protocol pseudo-header turns a CONNECT request into an Extended CONNECT request, see Section 3 of RFC 9220.
+	proto := "HTTP/3.0"
+	if len(protocol) > 0 {
+		if method != http.MethodConnect {
+			return nil, errors.New(":protocol must only be used with CONNECT")
+		}
+		proto = protocol
+	}
+
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var contentLength int64
+	if len(contentLengthStr) > 0 {
+		contentLength, err = strconv.ParseInt(contentLengthStr, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &http.Request{
+		Method:        method,
+		URL:           u,
+		Proto:         proto,
+		ProtoMajor:    3,
+		ProtoMinor:    0,
+		Header:        httpHeaders,
+		Trailer:       trailer,
+		Body:          nil,
+		ContentLength: contentLength,
+		Host:          authority,
+		RequestURI:    path,
+		TLS:           &tls.ConnectionState{},
+	}, nil
+}
+
+// isExtendedConnect says if the request is an Extended CONNECT request.
+// For these requests, the Proto is the protocol that the client wants to use on the request stream (e.g. "webtransport").
+func isExtendedConnect(req *http.Request) bool {
+	return req.Method == http.MethodConnect && len(req.Proto) > 0 && !strings.HasPrefix(req.Proto, "HTTP/")
+}
+
+func hostnameFromRequest(req *http.Request) string {
+	if len(req.Host) > 0 {
+		return req.Host
+	}
+	if req.URL != nil {
+		return req.URL.Host
+	}
+	return ""
+}
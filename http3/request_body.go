@@ -0,0 +1,22 @@
+package http3
+
+import "io"
+
+// The requestBody is the body of a request received by the server.
+type requestBody struct {
+	*body
+	requestRead bool
+}
+
+// make sure the requestBody can be used as a http.Request.Body
+var _ io.ReadCloser = &requestBody{}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	b.requestRead = true
+	return b.body.Read(p)
+}
+
+func (b *requestBody) Close() error {
+	// stream's Close() closes the write side, not the read side
+	return nil
+}
@@ -0,0 +1,60 @@
+package http3
+
+import (
+	"context"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// A requestCanceler resets the request stream when the request context is canceled while the handler is running,
+// e.g. because the client reset the stream, or the connection was closed.
+// This frees the resources of the stream right away, and tells the client to stop sending the request body.
+type requestCanceler struct {
+	ctx context.Context
+	str quic.Stream
+
+	mutex    sync.Mutex
+	stopped  bool
+	canceled bool
+}
+
+// newRequestCanceler starts a requestCanceler.
+// The context must be canceled eventually, so that the go routine returns.
+func newRequestCanceler(ctx context.Context, str quic.Stream) *requestCanceler {
+	c := &requestCanceler{ctx: ctx, str: str}
+	go c.run()
+	return c
+}
+
+func (c *requestCanceler) run() {
+	<-c.ctx.Done()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.stopped {
+		return
+	}
+	c.cancel()
+}
+
+// must be called with the mutex locked
+func (c *requestCanceler) cancel() {
+	c.canceled = true
+	cancelStream(c.str, errorRequestCanceled)
+}
+
+// stop is called when the handler returned, or when a WebTransport session took over the request stream.
+// It returns true if the stream was reset.
+// The context might have been canceled right before the handler returned, before run got a chance to reset the stream.
+func (c *requestCanceler) stop() (canceled bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.stopped {
+		return c.canceled
+	}
+	c.stopped = true
+	if !c.canceled && c.ctx.Err() != nil {
+		c.cancel()
+	}
+	return c.canceled
+}
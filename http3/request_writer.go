@@ -0,0 +1,272 @@
+package http3
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http/httpguts"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3/qpack"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+const defaultUserAgent = "quic-go HTTP/3"
+
+type requestWriter struct {
+	mutex   sync.Mutex
+	encoder *qpack.DynamicEncoder
+	fields  []qpack.HeaderField // the fields of the request that is currently being encoded
+
+	logger utils.Logger
+}
+
+func newRequestWriter(encoder *qpack.DynamicEncoder, logger utils.Logger) *requestWriter {
+	return &requestWriter{
+		encoder: encoder,
+		logger:  logger,
+	}
+}
+
+// WriteRequestHeader writes the HEADERS frame of a request to the request stream.
+func (w *requestWriter) WriteRequestHeader(str quic.Stream, req *http.Request, requestGzip bool) error {
+	headers, err := w.encodeRequestHeader(str.StreamID(), req, requestGzip)
+	if err != nil {
+		return err
+	}
+	return writeHeadersFrame(str, headers)
+}
+
+func (w *requestWriter) encodeRequestHeader(id quic.StreamID, req *http.Request, requestGzip bool) ([]byte, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.fields = w.fields[:0]
+	if err := w.encodeHeaders(req, requestGzip, actualContentLength(req)); err != nil {
+		return nil, err
+	}
+	return w.encoder.EncodeFieldSection(uint64(id), w.fields)
+}
+
+// WriteRequestTrailer writes the trailers of a request in a HEADERS frame after the request body.
+func (w *requestWriter) WriteRequestTrailer(str quic.Stream, trailer http.Header) error {
+	trailers, err := w.encodeRequestTrailer(str.StreamID(), trailer)
+	if err != nil || trailers == nil {
+		return err
+	}
+	return writeHeadersFrame(str, trailers)
+}
+
+// encodeRequestTrailer encodes the trailers.
+// It returns nil if there are no trailers to send.
+func (w *requestWriter) encodeRequestTrailer(id quic.StreamID, trailer http.Header) ([]byte, error) {
+	// The values of the trailers are set by the application while the body is sent, so they are validated here.
+	for k, vv := range trailer {
+		if !httpguts.ValidHeaderFieldName(k) {
+			return nil, fmt.Errorf("invalid HTTP trailer name %q", k)
+		}
+		for _, v := range vv {
+			if !httpguts.ValidHeaderFieldValue(v) {
+				return nil, fmt.Errorf("invalid HTTP trailer value %q for trailer %q", v, k)
+			}
+		}
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.fields = w.fields[:0]
+	for k, vv := range trailer {
+		// Transfer-Encoding, Content-Length, and Trailer are rejected when the header is encoded.
+		lowKey := strings.ToLower(k)
+		for _, v := range vv {
+			w.writeHeader(lowKey, v)
+		}
+	}
+	if len(w.fields) == 0 {
+		return nil, nil
+	}
+	return w.encoder.EncodeFieldSection(uint64(id), w.fields)
+}
+
+// writeHeadersFrame writes a HEADERS frame containing the encoded field section.
+// It is called without holding the mutex, so that a blocked stream doesn't block other requests.
+func writeHeadersFrame(str quic.Stream, fieldSection []byte) error {
+	b := &bytes.Buffer{}
+	(&headersFrame{Length: uint64(len(fieldSection))}).Write(b)
+	_, err := str.WriteVectored([][]byte{b.Bytes(), fieldSection})
+	return err
+}
+
+// the rest of this files is copied from http2.Transport
+func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, contentLength int64) error {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	host, err := httpguts.PunycodeHostPort(host)
+	if err != nil {
+		return err
+	}
+
+	// Extended CONNECT requests use the :path and :scheme, see Section 4 of RFC 8441.
+	extendedConnect := isExtendedConnect(req)
+	var path string
+	if req.Method != "CONNECT" || extendedConnect {
+		path = req.URL.RequestURI()
+		if !validPseudoPath(path) {
+			orig := path
+			path = strings.TrimPrefix(path, req.URL.Scheme+"://"+host)
+			if !validPseudoPath(path) {
+				if req.URL.Opaque != "" {
+					return fmt.Errorf("invalid request :path %q from URL.Opaque = %q", orig, req.URL.Opaque)
+				}
+				return fmt.Errorf("invalid request :path %q", orig)
+			}
+		}
+	}
+
+	// Check for any invalid headers and return an error before we
+	// start writing the field section.
+	trailers, err := commaSeparatedTrailers(req)
+	if err != nil {
+		return err
+	}
+	for k, vv := range req.Header {
+		if !httpguts.ValidHeaderFieldName(k) {
+			return fmt.Errorf("invalid HTTP header name %q", k)
+		}
+		for _, v := range vv {
+			if !httpguts.ValidHeaderFieldValue(v) {
+				return fmt.Errorf("invalid HTTP header value %q for header %q", v, k)
+			}
+		}
+	}
+
+	// 8.1.2.3 Request Pseudo-Header Fields
+	// The :path pseudo-header field includes the path and query parts of the
+	// target URI (the path-absolute production and optionally a '?' character
+	// followed by the query production (see Sections 3.3 and 3.4 of
+	// [RFC3986]).
+	w.writeHeader(":authority", host)
+	w.writeHeader(":method", req.Method)
+	if req.Method != "CONNECT" || extendedConnect {
+		w.writeHeader(":path", path)
+		w.writeHeader(":scheme", req.URL.Scheme)
+	}
+	if extendedConnect {
+		w.writeHeader(":protocol", req.Proto)
+	}
+
+	var didUA bool
+	for k, vv := range req.Header {
+		lowKey := strings.ToLower(k)
+		switch lowKey {
+		case "host", "content-length":
+			// Host is :authority, already sent.
+			// Content-Length is automatic, set below.
+			continue
+		case "connection", "proxy-connection", "transfer-encoding", "upgrade", "keep-alive":
+			// Per 8.1.2.2 Connection-Specific Header
+			// Fields, don't send connection-specific
+			// fields. We have already checked if any
+			// are error-worthy so just ignore the rest.
+			continue
+		case "user-agent":
+			// Match Go's http1 behavior: at most one
+			// User-Agent. If set to nil or empty string,
+			// then omit it. Otherwise if not mentioned,
+			// include the default (below).
+			didUA = true
+			if len(vv) < 1 {
+				continue
+			}
+			vv = vv[:1]
+			if vv[0] == "" {
+				continue
+			}
+		}
+		for _, v := range vv {
+			w.writeHeader(lowKey, v)
+		}
+	}
+	if trailers != "" {
+		w.writeHeader("trailer", trailers)
+	}
+	if shouldSendReqContentLength(req.Method, contentLength) {
+		w.writeHeader("content-length", strconv.FormatInt(contentLength, 10))
+	}
+	if addGzipHeader {
+		w.writeHeader("accept-encoding", "gzip")
+	}
+	if !didUA {
+		w.writeHeader("user-agent", defaultUserAgent)
+	}
+	return nil
+}
+
+func (w *requestWriter) writeHeader(name, value string) {
+	w.logger.Debugf("http3: Transport encoding header %q = %q", name, value)
+	w.fields = append(w.fields, qpack.HeaderField{Name: name, Value: value})
+}
+
+// commaSeparatedTrailers returns the keys of req.Trailer, for the Trailer header.
+func commaSeparatedTrailers(req *http.Request) (string, error) {
+	keys := make([]string, 0, len(req.Trailer))
+	for k := range req.Trailer {
+		k = http.CanonicalHeaderKey(k)
+		switch k {
+		case "Transfer-Encoding", "Trailer", "Content-Length":
+			return "", fmt.Errorf("invalid Trailer key %q", k)
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) > 0 {
+		sort.Strings(keys)
+		return strings.Join(keys, ","), nil
+	}
+	return "", nil
+}
+
+// shouldSendReqContentLength reports whether the Transport should send
+// a "content-length" request header. This logic is basically a copy of the net/http
+// transferWriter.shouldSendContentLength.
+// The contentLength is the corrected contentLength (so 0 means actually 0, not unknown).
+// -1 means unknown.
+func shouldSendReqContentLength(method string, contentLength int64) bool {
+	if contentLength > 0 {
+		return true
+	}
+	if contentLength < 0 {
+		return false
+	}
+	// For zero bodies, whether we send a content-length depends on the method.
+	switch method {
+	case "POST", "PUT", "PATCH":
+		return true
+	default:
+		return false
+	}
+}
+
+func validPseudoPath(v string) bool {
+	return (len(v) > 0 && v[0] == '/' && (len(v) == 1 || v[1] != '/')) || v == "*"
+}
+
+// actualContentLength returns a sanitized version of
+// req.ContentLength, where 0 actually means zero (not unknown) and -1
+// means unknown.
+func actualContentLength(req *http.Request) int64 {
+	if req.Body == nil {
+		return 0
+	}
+	if req.ContentLength != 0 {
+		return req.ContentLength
+	}
+	return -1
+}
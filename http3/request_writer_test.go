@@ -0,0 +1,150 @@
+package http3
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/lucas-clemente/quic-go/http3/qpack"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Request Writer", func() {
+	var (
+		rw  *requestWriter
+		str *mockStream
+	)
+
+	BeforeEach(func() {
+		rw = newRequestWriter(qpack.NewDynamicEncoder(&qpack.Config{}, ioutil.Discard), utils.DefaultLogger)
+		str = newMockStream(4)
+	})
+
+	It("writes a GET request", func() {
+		req, err := http.NewRequest("GET", "https://quic.clemente.io/index.html?foo=bar", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rw.WriteRequestHeader(str, req, false)).To(Succeed())
+		headers := readHeaders(&str.dataWritten)
+		Expect(headers).To(HaveKeyWithValue(":authority", []string{"quic.clemente.io"}))
+		Expect(headers).To(HaveKeyWithValue(":method", []string{"GET"}))
+		Expect(headers).To(HaveKeyWithValue(":path", []string{"/index.html?foo=bar"}))
+		Expect(headers).To(HaveKeyWithValue(":scheme", []string{"https"}))
+		Expect(headers).To(HaveKeyWithValue("user-agent", []string{defaultUserAgent}))
+		Expect(headers).ToNot(HaveKey("accept-encoding"))
+		Expect(headers).ToNot(HaveKey("content-length"))
+		Expect(str.dataWritten.Len()).To(BeZero())
+	})
+
+	It("sends the content-length", func() {
+		req, err := http.NewRequest("POST", "https://quic.clemente.io/upload.html", bytes.NewReader([]byte("foo")))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rw.WriteRequestHeader(str, req, false)).To(Succeed())
+		headers := readHeaders(&str.dataWritten)
+		Expect(headers).To(HaveKeyWithValue(":method", []string{"POST"}))
+		Expect(headers).To(HaveKeyWithValue("content-length", []string{"3"}))
+	})
+
+	It("doesn't send a content-length if the length of the body is unknown", func() {
+		req, err := http.NewRequest("POST", "https://quic.clemente.io/upload.html", ioutil.NopCloser(bytes.NewReader([]byte("foo"))))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rw.WriteRequestHeader(str, req, false)).To(Succeed())
+		headers := readHeaders(&str.dataWritten)
+		Expect(headers).ToNot(HaveKey("content-length"))
+	})
+
+	It("requests gzip compression", func() {
+		req, err := http.NewRequest("GET", "https://quic.clemente.io/index.html", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rw.WriteRequestHeader(str, req, true)).To(Succeed())
+		headers := readHeaders(&str.dataWritten)
+		Expect(headers).To(HaveKeyWithValue("accept-encoding", []string{"gzip"}))
+	})
+
+	It("writes headers, except connection-specific ones", func() {
+		req, err := http.NewRequest("GET", "https://quic.clemente.io/index.html", nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Foo", "bar")
+		req.Header.Set("Connection", "keep-alive")
+		req.Header.Set("User-Agent", "quic-go test")
+		Expect(rw.WriteRequestHeader(str, req, false)).To(Succeed())
+		headers := readHeaders(&str.dataWritten)
+		Expect(headers).To(HaveKeyWithValue("foo", []string{"bar"}))
+		Expect(headers).To(HaveKeyWithValue("user-agent", []string{"quic-go test"}))
+		Expect(headers).ToNot(HaveKey("connection"))
+	})
+
+	It("doesn't send pseudo headers for the path and the scheme for CONNECT requests", func() {
+		req := &http.Request{
+			Method: "CONNECT",
+			URL:    &url.URL{Host: "quic.clemente.io:443"},
+			Header: http.Header{},
+		}
+		Expect(rw.WriteRequestHeader(str, req, false)).To(Succeed())
+		headers := readHeaders(&str.dataWritten)
+		Expect(headers).To(HaveKeyWithValue(":authority", []string{"quic.clemente.io:443"}))
+		Expect(headers).ToNot(HaveKey(":path"))
+		Expect(headers).ToNot(HaveKey(":scheme"))
+	})
+
+	It("sends the pseudo headers for Extended CONNECT requests", func() {
+		req, err := http.NewRequest("CONNECT", "https://quic.clemente.io/chat", nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Proto = "webtransport"
+		Expect(rw.WriteRequestHeader(str, req, false)).To(Succeed())
+		headers := readHeaders(&str.dataWritten)
+		Expect(headers).To(HaveKeyWithValue(":method", []string{"CONNECT"}))
+		Expect(headers).To(HaveKeyWithValue(":protocol", []string{"webtransport"}))
+		Expect(headers).To(HaveKeyWithValue(":path", []string{"/chat"}))
+		Expect(headers).To(HaveKeyWithValue(":scheme", []string{"https"}))
+	})
+
+	It("announces the trailers", func() {
+		req, err := http.NewRequest("POST", "https://quic.clemente.io/upload.html", bytes.NewReader([]byte("foo")))
+		Expect(err).ToNot(HaveOccurred())
+		req.Trailer = http.Header{"Foo": nil, "bar": nil}
+		Expect(rw.WriteRequestHeader(str, req, false)).To(Succeed())
+		headers := readHeaders(&str.dataWritten)
+		Expect(headers).To(HaveKeyWithValue("trailer", []string{"Bar,Foo"}))
+	})
+
+	It("rejects invalid trailers", func() {
+		req, err := http.NewRequest("POST", "https://quic.clemente.io/upload.html", bytes.NewReader([]byte("foo")))
+		Expect(err).ToNot(HaveOccurred())
+		req.Trailer = http.Header{"Content-Length": nil}
+		Expect(rw.WriteRequestHeader(str, req, false)).To(MatchError(`invalid Trailer key "Content-Length"`))
+		Expect(str.dataWritten.Len()).To(BeZero())
+	})
+
+	It("writes the trailers", func() {
+		Expect(rw.WriteRequestTrailer(str, http.Header{"Foo": {"bar", "baz"}})).To(Succeed())
+		trailers := readHeaders(&str.dataWritten)
+		Expect(trailers).To(Equal(map[string][]string{"foo": {"bar", "baz"}}))
+	})
+
+	It("rejects trailers with invalid names", func() {
+		Expect(rw.WriteRequestTrailer(str, http.Header{"Foo Bar": {"baz"}})).To(MatchError(`invalid HTTP trailer name "Foo Bar"`))
+		Expect(str.dataWritten.Len()).To(BeZero())
+	})
+
+	It("rejects trailers with invalid values", func() {
+		Expect(rw.WriteRequestTrailer(str, http.Header{"Foo": {"bar\n"}})).To(MatchError(`invalid HTTP trailer value "bar\n" for trailer "Foo"`))
+		Expect(str.dataWritten.Len()).To(BeZero())
+	})
+
+	It("doesn't write trailers without values", func() {
+		Expect(rw.WriteRequestTrailer(str, http.Header{"Foo": nil})).To(Succeed())
+		Expect(str.dataWritten.Len()).To(BeZero())
+	})
+
+	It("rejects invalid header values", func() {
+		req, err := http.NewRequest("GET", "https://quic.clemente.io/index.html", nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Foo", "bar\n")
+		Expect(rw.WriteRequestHeader(str, req, false)).To(MatchError(`invalid HTTP header value "bar\n" for header "Foo"`))
+		Expect(str.dataWritten.Len()).To(BeZero())
+	})
+})
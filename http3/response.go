@@ -0,0 +1,86 @@
+package http3
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/lucas-clemente/quic-go/http3/qpack"
+)
+
+var noBody = ioutil.NopCloser(bytes.NewReader(nil))
+
+// adapted from the handleResponse function in net/http2/transport.go
+func responseFromHeaders(headers []qpack.HeaderField) (*http.Response, error) {
+	var status string
+	header := make(http.Header)
+	res := &http.Response{
+		Proto:      "HTTP/3.0",
+		ProtoMajor: 3,
+		Header:     header,
+	}
+	for _, hf := range headers {
+		if hf.IsPseudo() {
+			if hf.Name != ":status" {
+				return nil, errors.New("invalid response pseudo header " + hf.Name)
+			}
+			status = hf.Value
+			continue
+		}
+		key := http.CanonicalHeaderKey(hf.Name)
+		if key == "Trailer" {
+			t := res.Trailer
+			if t == nil {
+				t = make(http.Header)
+				res.Trailer = t
+			}
+			foreachHeaderElement(hf.Value, func(v string) {
+				t[http.CanonicalHeaderKey(v)] = nil
+			})
+		} else {
+			header[key] = append(header[key], hf.Value)
+		}
+	}
+
+	if status == "" {
+		return nil, errors.New("missing status pseudo header")
+	}
+	statusCode, err := strconv.Atoi(status)
+	if err != nil {
+		return nil, errors.New("malformed non-numeric status pseudo header")
+	}
+	res.StatusCode = statusCode
+	res.Status = status + " " + http.StatusText(statusCode)
+
+	res.ContentLength = -1
+	if clens := res.Header["Content-Length"]; len(clens) == 1 {
+		if clen64, err := strconv.ParseInt(clens[0], 10, 64); err == nil {
+			res.ContentLength = clen64
+		}
+	}
+	return res, nil
+}
+
+// copied from net/http/server.go
+
+// foreachHeaderElement splits v according to the "#rule" construction
+// in RFC 2616 section 2.1 and calls fn for each non-empty element.
+func foreachHeaderElement(v string, fn func(string)) {
+	v = textproto.TrimString(v)
+	if v == "" {
+		return
+	}
+	if !strings.Contains(v, ",") {
+		fn(v)
+		return
+	}
+	for _, f := range strings.Split(v, ",") {
+		if f = textproto.TrimString(f); f != "" {
+			fn(f)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package http3
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// The responseBody is the body of a response received by the client.
+// If the request context is canceled before the body was read completely, the request stream is canceled.
+type responseBody struct {
+	*body
+	str quic.Stream
+	ctx context.Context
+
+	doneOnce sync.Once
+	done     chan struct{} // closed when the body was read completely, or closed
+	onDone   func()        // called when done is closed, might be nil
+}
+
+// make sure the responseBody can be used as a http.Response.Body
+var _ io.ReadCloser = &responseBody{}
+
+func newResponseBody(b *body, str quic.Stream, ctx context.Context, onDone func()) *responseBody {
+	rb := &responseBody{
+		body:   b,
+		str:    str,
+		ctx:    ctx,
+		done:   make(chan struct{}),
+		onDone: onDone,
+	}
+	// contexts that can't be canceled return a nil channel
+	if ctx.Done() != nil {
+		go rb.cancelOnContextDone()
+	}
+	return rb
+}
+
+func (b *responseBody) cancelOnContextDone() {
+	select {
+	case <-b.ctx.Done():
+		// If the body was completed before the goroutine was scheduled, both channels might be closed.
+		select {
+		case <-b.done:
+			return
+		default:
+		}
+		cancelStream(b.str, errorRequestCanceled)
+	case <-b.done:
+	}
+}
+
+func (b *responseBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if err != nil {
+		if ctxErr := b.ctx.Err(); ctxErr != nil && err != io.EOF {
+			err = ctxErr
+		}
+		b.finish()
+	}
+	return n, err
+}
+
+// Close tells the server to stop sending the response body.
+func (b *responseBody) Close() error {
+	b.finish()
+	b.str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+	return nil
+}
+
+func (b *responseBody) finish() {
+	b.doneOnce.Do(func() {
+		close(b.done)
+		if b.onDone != nil {
+			b.onDone()
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package http3
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// a stream whose Read returns an error
+type erroringReadStream struct {
+	*mockStream
+	readErr error
+}
+
+func (s *erroringReadStream) Read(p []byte) (int, error) {
+	return 0, s.readErr
+}
+
+var _ = Describe("Response body", func() {
+	var (
+		str       *mockStream
+		ctx       context.Context
+		ctxCancel context.CancelFunc
+	)
+
+	newRespBody := func() *responseBody {
+		return newResponseBody(newBody(str, func(*connectionError) {}), str, ctx, nil)
+	}
+
+	BeforeEach(func() {
+		str = newMockStream(4)
+		(&dataFrame{Length: 6}).Write(&str.dataToRead)
+		str.dataToRead.Write([]byte("foobar"))
+		ctx, ctxCancel = context.WithCancel(context.Background())
+	})
+
+	It("reads from the stream", func() {
+		rb := newRespBody()
+		b := make([]byte, 10)
+		n, err := rb.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("foobar")))
+	})
+
+	It("stops reading from the stream when closed", func() {
+		rb := newRespBody()
+		Expect(rb.Close()).To(Succeed())
+		Expect(str.canceledRead).To(BeTrue())
+		Expect(str.readErrorCode).To(BeEquivalentTo(errorRequestCanceled))
+		Expect(str.canceledWrite).To(BeFalse())
+	})
+
+	It("cancels the stream when the context is canceled", func() {
+		newRespBody()
+		ctxCancel()
+		Eventually(str.Context().Done()).Should(BeClosed())
+		Expect(str.canceledRead).To(BeTrue())
+		Expect(str.canceledWrite).To(BeTrue())
+		Expect(str.writeErrorCode).To(BeEquivalentTo(errorRequestCanceled))
+	})
+
+	It("doesn't cancel the stream after the body was read completely", func() {
+		rb := newRespBody()
+		_, err := rb.Read(make([]byte, 10))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rb.Read(make([]byte, 10))
+		Expect(err).To(MatchError(io.EOF))
+		ctxCancel()
+		Consistently(str.Context().Done()).ShouldNot(BeClosed())
+	})
+
+	It("returns the context error when reading is canceled", func() {
+		rstr := &erroringReadStream{
+			mockStream: str,
+			readErr:    errors.New("Read on stream 4 canceled with error code 0x10c"),
+		}
+		rb := newResponseBody(newBody(rstr, func(*connectionError) {}), rstr, ctx, nil)
+		ctxCancel()
+		_, err := rb.Read(make([]byte, 10))
+		Expect(err).To(MatchError(context.Canceled))
+	})
+})
@@ -0,0 +1,189 @@
+package http3
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3/qpack"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+type responseWriter struct {
+	stream  quic.SendStream // the request stream, or a push stream
+	encoder *qpack.DynamicEncoder
+	pusher  *pusher // nil for pushed responses
+
+	// the request stream and its connection, nil for pushed responses
+	requestStream quic.Stream
+	conn          *connection
+	canceler      *requestCanceler
+	upgraded      bool // set when a WebTransport session took over the request stream
+
+	header        http.Header
+	trailers      []string // the trailers declared in the Trailer header when the header was written
+	status        int      // status code passed to WriteHeader
+	headerWritten bool
+	isHead        bool // if the request was a HEAD request, the body is discarded
+
+	logger utils.Logger
+}
+
+func newResponseWriter(stream quic.SendStream, encoder *qpack.DynamicEncoder, isHead bool, logger utils.Logger) *responseWriter {
+	return &responseWriter{
+		stream:  stream,
+		encoder: encoder,
+		header:  http.Header{},
+		isHead:  isHead,
+		logger:  logger,
+	}
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.headerWritten {
+		return
+	}
+	w.headerWritten = true
+	w.status = status
+	for _, v := range w.header["Trailer"] {
+		foreachHeaderElement(v, func(key string) {
+			key = http.CanonicalHeaderKey(key)
+			if httpguts.ValidTrailerHeader(key) {
+				w.trailers = append(w.trailers, key)
+			}
+		})
+	}
+
+	fields := []qpack.HeaderField{{Name: ":status", Value: strconv.Itoa(status)}}
+	for k, v := range w.header {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			continue
+		}
+		name := strings.ToLower(k)
+		// Connection-specific header fields must not be used in HTTP/3, see Section 4.2 of RFC 9114.
+		switch name {
+		case "connection", "proxy-connection", "transfer-encoding", "upgrade", "keep-alive":
+			continue
+		}
+		for index := range v {
+			fields = append(fields, qpack.HeaderField{Name: name, Value: v[index]})
+		}
+	}
+	headers, err := w.encoder.EncodeFieldSection(uint64(w.stream.StreamID()), fields)
+	if err != nil {
+		w.logger.Errorf("could not encode headers: %s", err.Error())
+		return
+	}
+
+	w.logger.Infof("Responding with %d", status)
+	b := &bytes.Buffer{}
+	(&headersFrame{Length: uint64(len(headers))}).Write(b)
+	if _, err := w.stream.WriteVectored([][]byte{b.Bytes(), headers}); err != nil {
+		w.logger.Errorf("could not write HEADERS frame: %s", err.Error())
+	}
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if !w.headerWritten {
+		w.WriteHeader(200)
+	}
+	if !bodyAllowedForStatus(w.status) {
+		return 0, http.ErrBodyNotAllowed
+	}
+	// Just like net/http, silently discard the body of responses to HEAD requests.
+	if w.isHead || len(p) == 0 {
+		return len(p), nil
+	}
+	b := &bytes.Buffer{}
+	(&dataFrame{Length: uint64(len(p))}).Write(b)
+	n, err := w.stream.WriteVectored([][]byte{b.Bytes(), p})
+	// only report the number of bytes of the body that were written
+	n -= b.Len()
+	if n < 0 {
+		n = 0
+	}
+	return n, err
+}
+
+// finish must be called after the handler returned.
+// If the handler didn't write anything, the response is sent with the given status code, without a body.
+// It writes the trailers, and closes the stream.
+func (w *responseWriter) finish(status int) {
+	w.WriteHeader(status)
+	w.writeTrailers()
+	w.stream.Close()
+}
+
+// writeTrailers writes the trailers in a HEADERS frame after the body.
+// Just like net/http, the trailers are the fields that were declared in the Trailer header before the header was written,
+// and the fields prefixed with http.TrailerPrefix.
+func (w *responseWriter) writeTrailers() {
+	var fields []qpack.HeaderField
+	for _, k := range w.trailers {
+		for _, v := range w.header[k] {
+			fields = append(fields, qpack.HeaderField{Name: strings.ToLower(k), Value: v})
+		}
+	}
+	for k, vv := range w.header {
+		if !strings.HasPrefix(k, http.TrailerPrefix) {
+			continue
+		}
+		k = http.CanonicalHeaderKey(strings.TrimPrefix(k, http.TrailerPrefix))
+		if !httpguts.ValidTrailerHeader(k) {
+			continue
+		}
+		for _, v := range vv {
+			fields = append(fields, qpack.HeaderField{Name: strings.ToLower(k), Value: v})
+		}
+	}
+	if len(fields) == 0 {
+		return
+	}
+	trailers, err := w.encoder.EncodeFieldSection(uint64(w.stream.StreamID()), fields)
+	if err != nil {
+		w.logger.Errorf("could not encode trailers: %s", err.Error())
+		return
+	}
+	b := &bytes.Buffer{}
+	(&headersFrame{Length: uint64(len(trailers))}).Write(b)
+	if _, err := w.stream.WriteVectored([][]byte{b.Bytes(), trailers}); err != nil {
+		w.logger.Errorf("could not write trailers: %s", err.Error())
+	}
+}
+
+func (w *responseWriter) Flush() {}
+
+// Push pushes a response for the target, see http.Pusher.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if w.pusher == nil {
+		return errRecursivePush
+	}
+	return w.pusher.Push(target, opts)
+}
+
+// test that we implement http.Flusher and http.Pusher
+var _ http.Flusher = &responseWriter{}
+var _ http.Pusher = &responseWriter{}
+
+// copied from http2/http2.go
+// bodyAllowedForStatus reports whether a given response status code
+// permits a body. See RFC 2616, section 4.4.
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == 204:
+		return false
+	case status == 304:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,255 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3/qpack"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type mockStream struct {
+	id             protocol.StreamID
+	dataToRead     bytes.Buffer
+	dataWritten    bytes.Buffer
+	canceledRead   bool
+	canceledWrite  bool
+	readErrorCode  quic.ErrorCode
+	writeErrorCode quic.ErrorCode
+	closed         bool
+	readDeadline   time.Time
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+}
+
+var _ quic.Stream = &mockStream{}
+
+func newMockStream(id protocol.StreamID) *mockStream {
+	s := &mockStream{id: id}
+	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+	return s
+}
+
+func (s *mockStream) Close() error { s.closed = true; s.ctxCancel(); return nil }
+func (s *mockStream) CancelRead(code quic.ErrorCode) error {
+	s.canceledRead = true
+	s.readErrorCode = code
+	return nil
+}
+func (s *mockStream) CancelWrite(code quic.ErrorCode) error {
+	s.canceledWrite = true
+	s.writeErrorCode = code
+	s.ctxCancel()
+	return nil
+}
+func (s *mockStream) StreamID() protocol.StreamID       { return s.id }
+func (s *mockStream) Context() context.Context          { return s.ctx }
+func (s *mockStream) SetDeadline(time.Time) error       { panic("not implemented") }
+func (s *mockStream) SetReadDeadline(t time.Time) error { s.readDeadline = t; return nil }
+func (s *mockStream) SetWriteDeadline(time.Time) error  { panic("not implemented") }
+func (s *mockStream) SetDataLifetime(time.Duration)     { panic("not implemented") }
+func (s *mockStream) Stats() quic.StreamStats           { panic("not implemented") }
+func (s *mockStream) Read(p []byte) (int, error)        { return s.dataToRead.Read(p) }
+func (s *mockStream) Write(p []byte) (int, error)       { return s.dataWritten.Write(p) }
+func (s *mockStream) WriteVectored(bufs [][]byte) (int, error) {
+	var n int
+	for _, b := range bufs {
+		m, err := s.Write(b)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// readHeaders reads a HEADERS frame from r, and decodes the field section
+func readHeaders(r io.Reader) map[string][]string {
+	frame, err := parseNextFrame(r)
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	ExpectWithOffset(1, frame).To(BeAssignableToTypeOf(&headersFrame{}))
+	headerBlock := make([]byte, frame.(*headersFrame).Length)
+	_, err = io.ReadFull(r, headerBlock)
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	fields, err := qpack.NewDecoder().DecodeFull(headerBlock)
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	headers := make(map[string][]string)
+	for _, f := range fields {
+		headers[f.Name] = append(headers[f.Name], f.Value)
+	}
+	return headers
+}
+
+// readData reads the payload of all DATA frames from r
+func readData(r io.Reader) []byte {
+	var data []byte
+	for {
+		frame, err := parseNextFrame(r)
+		if err == io.EOF {
+			return data
+		}
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		ExpectWithOffset(1, frame).To(BeAssignableToTypeOf(&dataFrame{}))
+		payload := make([]byte, frame.(*dataFrame).Length)
+		_, err = io.ReadFull(r, payload)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		data = append(data, payload...)
+	}
+}
+
+var _ = Describe("Response Writer", func() {
+	var (
+		w   *responseWriter
+		str *mockStream
+	)
+
+	BeforeEach(func() {
+		str = newMockStream(4)
+		w = newResponseWriter(str, qpack.NewDynamicEncoder(&qpack.Config{}, ioutil.Discard), false, utils.DefaultLogger)
+	})
+
+	It("writes status", func() {
+		w.WriteHeader(http.StatusTeapot)
+		fields := readHeaders(&str.dataWritten)
+		Expect(fields).To(HaveLen(1))
+		Expect(fields).To(HaveKeyWithValue(":status", []string{"418"}))
+	})
+
+	It("writes headers", func() {
+		w.Header().Add("content-length", "42")
+		w.WriteHeader(http.StatusTeapot)
+		fields := readHeaders(&str.dataWritten)
+		Expect(fields).To(HaveKeyWithValue("content-length", []string{"42"}))
+	})
+
+	It("writes multiple headers with the same name", func() {
+		const cookie1 = "test1=1; Max-Age=7200; path=/"
+		const cookie2 = "test2=2; Max-Age=7200; path=/"
+		w.Header().Add("set-cookie", cookie1)
+		w.Header().Add("set-cookie", cookie2)
+		w.WriteHeader(http.StatusTeapot)
+		fields := readHeaders(&str.dataWritten)
+		Expect(fields).To(HaveKey("set-cookie"))
+		cookies := fields["set-cookie"]
+		Expect(cookies).To(ContainElement(cookie1))
+		Expect(cookies).To(ContainElement(cookie2))
+	})
+
+	It("doesn't send connection-specific headers", func() {
+		w.Header().Add("Connection", "close")
+		w.Header().Add("Transfer-Encoding", "chunked")
+		w.Header().Add("Foo", "bar")
+		w.WriteHeader(http.StatusOK)
+		fields := readHeaders(&str.dataWritten)
+		Expect(fields).To(HaveLen(2))
+		Expect(fields).To(HaveKeyWithValue("foo", []string{"bar"}))
+	})
+
+	It("writes data in DATA frames", func() {
+		n, err := w.Write([]byte("foo"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(3))
+		n, err = w.Write([]byte("bar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(3))
+		fields := readHeaders(&str.dataWritten)
+		Expect(fields).To(HaveKeyWithValue(":status", []string{"200"}))
+		Expect(readData(&str.dataWritten)).To(Equal([]byte("foobar")))
+	})
+
+	It("doesn't write empty DATA frames", func() {
+		n, err := w.Write(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(BeZero())
+		readHeaders(&str.dataWritten)
+		Expect(str.dataWritten.Len()).To(BeZero())
+	})
+
+	It("does not WriteHeader() twice", func() {
+		w.WriteHeader(200)
+		w.WriteHeader(500)
+		fields := readHeaders(&str.dataWritten)
+		Expect(fields).To(HaveKeyWithValue(":status", []string{"200"}))
+		Expect(str.dataWritten.Len()).To(BeZero())
+	})
+
+	It("doesn't allow writes if the status code doesn't allow a body", func() {
+		w.WriteHeader(304)
+		n, err := w.Write([]byte("foobar"))
+		Expect(n).To(BeZero())
+		Expect(err).To(MatchError(http.ErrBodyNotAllowed))
+	})
+
+	It("discards the body of responses to HEAD requests", func() {
+		w = newResponseWriter(str, qpack.NewDynamicEncoder(&qpack.Config{}, ioutil.Discard), true, utils.DefaultLogger)
+		n, err := w.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(6))
+		readHeaders(&str.dataWritten)
+		Expect(str.dataWritten.Len()).To(BeZero())
+	})
+
+	It("writes the status when finishing, and closes the stream", func() {
+		w.finish(http.StatusInternalServerError)
+		fields := readHeaders(&str.dataWritten)
+		Expect(fields).To(HaveKeyWithValue(":status", []string{"500"}))
+		Expect(str.closed).To(BeTrue())
+	})
+
+	It("doesn't change the status when finishing", func() {
+		w.WriteHeader(http.StatusTeapot)
+		w.finish(http.StatusOK)
+		fields := readHeaders(&str.dataWritten)
+		Expect(fields).To(HaveKeyWithValue(":status", []string{"418"}))
+		Expect(str.closed).To(BeTrue())
+	})
+
+	It("writes the trailers declared in the Trailer header when finishing", func() {
+		w.Header().Set("Trailer", "Foo, Content-Length")
+		w.Write([]byte("foobar"))
+		w.Header().Set("Foo", "bar")
+		w.Header().Set("Content-Length", "6")
+		w.finish(http.StatusOK)
+		fields := readHeaders(&str.dataWritten)
+		Expect(fields).To(HaveKeyWithValue("trailer", []string{"Foo, Content-Length"}))
+		frame, err := parseNextFrame(&str.dataWritten)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(BeAssignableToTypeOf(&dataFrame{}))
+		str.dataWritten.Next(6)
+		trailers := readHeaders(&str.dataWritten)
+		Expect(trailers).To(Equal(map[string][]string{"foo": {"bar"}}))
+		Expect(str.dataWritten.Len()).To(BeZero())
+		Expect(str.closed).To(BeTrue())
+	})
+
+	It("writes the trailers prefixed with http.TrailerPrefix", func() {
+		w.Header().Set(http.TrailerPrefix+"Foo", "bar")
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set(http.TrailerPrefix+"Baz", "qux")
+		w.finish(http.StatusOK)
+		fields := readHeaders(&str.dataWritten)
+		Expect(fields).To(HaveLen(1))
+		trailers := readHeaders(&str.dataWritten)
+		Expect(trailers).To(Equal(map[string][]string{
+			"foo": {"bar"},
+			"baz": {"qux"},
+		}))
+	})
+
+	It("doesn't write trailers if none are set", func() {
+		w.Header().Set("Trailer", "Foo")
+		w.finish(http.StatusOK)
+		readHeaders(&str.dataWritten)
+		Expect(str.dataWritten.Len()).To(BeZero())
+	})
+})
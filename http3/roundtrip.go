@@ -0,0 +1,291 @@
+package http3
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3/qpack"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+type roundTripCloser interface {
+	http.RoundTripper
+	io.Closer
+	isGoingAway() bool
+}
+
+// RoundTripper implements the http.RoundTripper interface, using HTTP/3.
+// Warning: This API should not be considered stable and might change soon.
+type RoundTripper struct {
+	mutex sync.Mutex
+
+	// DisableCompression, if true, prevents the Transport from
+	// requesting compression with an "Accept-Encoding: gzip"
+	// request header when the Request contains no existing
+	// Accept-Encoding value. If the Transport requests gzip on
+	// its own and gets a gzipped response, it's transparently
+	// decoded in the Response.Body. However, if the user
+	// explicitly requested gzip it is not automatically
+	// uncompressed.
+	DisableCompression bool
+
+	// DisableContentLengthCheck, if true, prevents the Transport from
+	// checking that the length of a response body matches the
+	// Content-Length sent by the server. By default, reading a
+	// body that is longer or shorter than the Content-Length
+	// results in an error, just like for http.Transport.
+	DisableContentLengthCheck bool
+
+	// MaxResponseHeaderBytes specifies a limit on how many
+	// response bytes are allowed in the server's response
+	// header, and in the response trailers.
+	// Zero means to use a default limit (http.DefaultMaxHeaderBytes).
+	MaxResponseHeaderBytes int64
+
+	// TLSClientConfig specifies the TLS configuration to use with
+	// tls.Client. If nil, the default configuration is used.
+	TLSClientConfig *tls.Config
+
+	// QuicConfig is the quic.Config used for dialing new connections.
+	// If nil, reasonable default values will be used.
+	// The Versions are ignored, HTTP/3 always uses IETF QUIC.
+	QuicConfig *quic.Config
+
+	// QPACKConfig configures the QPACK dynamic table used to compress request and response headers.
+	// If nil, a dynamic table with a capacity of 4 KB is used, and up to 16 streams may be blocked.
+	QPACKConfig *qpack.Config
+
+	// Dial specifies an optional dial function for creating QUIC
+	// connections for requests.
+	// If Dial is nil, quic.DialAddr will be used.
+	Dial func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error)
+
+	// Proxy specifies a function to return a proxy for a given
+	// Request. QUIC can't be used through HTTP proxies, so if the
+	// function returns a non-nil URL, the request is sent over
+	// TCP, using the ProxyTransport.
+	// If Proxy is nil, no proxy is used. Use http.ProxyFromEnvironment
+	// to respect the standard proxy environment variables.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// ProxyTransport is used for requests that are sent via a proxy.
+	// If nil, an http.Transport with the same Proxy function,
+	// TLSClientConfig and DisableCompression setting is used.
+	ProxyTransport http.RoundTripper
+
+	clients        map[string]roundTripCloser
+	proxyTransport http.RoundTripper
+}
+
+// RoundTripOpt are options for the Transport.RoundTripOpt method.
+type RoundTripOpt struct {
+	// OnlyCachedConn controls whether the RoundTripper may
+	// create a new QUIC connection. If set true and
+	// no cached connection is available, RoundTrip
+	// will return ErrNoCachedConn.
+	OnlyCachedConn bool
+}
+
+var _ http.RoundTripper = &RoundTripper{}
+
+// ErrNoCachedConn is returned when RoundTripper.OnlyCachedConn is set
+var ErrNoCachedConn = errors.New("http3: no cached connection was available")
+
+// RoundTripOpt is like RoundTrip, but takes options.
+func (r *RoundTripper) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Response, error) {
+	if req.URL == nil {
+		closeRequestBody(req)
+		return nil, errors.New("quic: nil Request.URL")
+	}
+	if req.URL.Host == "" {
+		closeRequestBody(req)
+		return nil, errors.New("quic: no Host in request URL")
+	}
+	if req.Header == nil {
+		closeRequestBody(req)
+		return nil, errors.New("quic: nil Request.Header")
+	}
+
+	if req.URL.Scheme == "https" {
+		for k, vv := range req.Header {
+			if !httpguts.ValidHeaderFieldName(k) {
+				return nil, fmt.Errorf("quic: invalid http header field name %q", k)
+			}
+			for _, v := range vv {
+				if !httpguts.ValidHeaderFieldValue(v) {
+					return nil, fmt.Errorf("quic: invalid http header field value %q for key %v", v, k)
+				}
+			}
+		}
+	} else {
+		closeRequestBody(req)
+		return nil, fmt.Errorf("quic: unsupported protocol scheme: %s", req.URL.Scheme)
+	}
+
+	if req.Method != "" && !validMethod(req.Method) {
+		closeRequestBody(req)
+		return nil, fmt.Errorf("quic: invalid method %q", req.Method)
+	}
+
+	if r.Proxy != nil {
+		proxyURL, err := r.Proxy(req)
+		if err != nil {
+			closeRequestBody(req)
+			return nil, err
+		}
+		if proxyURL != nil {
+			return r.getProxyTransport().RoundTrip(req)
+		}
+	}
+
+	hostname := authorityAddr("https", hostnameFromRequest(req))
+	for {
+		cl, err := r.getClient(hostname, opt.OnlyCachedConn)
+		if err != nil {
+			return nil, err
+		}
+		rsp, err := cl.RoundTrip(req)
+		if err != errGoingAway && err != errRequestRejected {
+			return rsp, err
+		}
+		// The server didn't process the request, since it raced with a GOAWAY frame.
+		// Retry it on a new connection.
+		// errGoingAway is returned before the request is sent, so the body only needs to be rewound for rejected requests.
+		if err == errRequestRejected {
+			newReq, rerr := rewindRequestBody(req)
+			if rerr != nil {
+				return nil, err
+			}
+			req = newReq
+		}
+	}
+}
+
+// rewindRequestBody returns a request that can be sent again.
+// It fails if the request body was (partially) sent, and can't be obtained again using GetBody.
+func rewindRequestBody(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("http3: the request body can't be rewound")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	newReq := *req
+	newReq.Body = body
+	return &newReq, nil
+}
+
+// RoundTrip does a round trip.
+func (r *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return r.RoundTripOpt(req, RoundTripOpt{})
+}
+
+func (r *RoundTripper) getClient(hostname string, onlyCached bool) (http.RoundTripper, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.clients == nil {
+		r.clients = make(map[string]roundTripCloser)
+	}
+
+	client, ok := r.clients[hostname]
+	// After the server sent a GOAWAY frame, requests are sent on a new connection.
+	// Requests that are still in flight on the old connection are allowed to complete.
+	if ok && client.isGoingAway() {
+		delete(r.clients, hostname)
+		ok = false
+	}
+	if !ok {
+		if onlyCached {
+			return nil, ErrNoCachedConn
+		}
+		client = newClient(
+			hostname,
+			r.TLSClientConfig,
+			&roundTripperOpts{
+				DisableCompression:        r.DisableCompression,
+				DisableContentLengthCheck: r.DisableContentLengthCheck,
+				MaxHeaderBytes:            r.MaxResponseHeaderBytes,
+				QPACKConfig:               r.QPACKConfig,
+			},
+			r.QuicConfig,
+			r.Dial,
+		)
+		r.clients[hostname] = client
+	}
+	return client, nil
+}
+
+func (r *RoundTripper) getProxyTransport() http.RoundTripper {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.ProxyTransport != nil {
+		return r.ProxyTransport
+	}
+	if r.proxyTransport == nil {
+		r.proxyTransport = &http.Transport{
+			Proxy:              r.Proxy,
+			TLSClientConfig:    r.TLSClientConfig,
+			DisableCompression: r.DisableCompression,
+		}
+	}
+	return r.proxyTransport
+}
+
+// Close closes the QUIC connections that this RoundTripper has used,
+// as well as idle connections of the transport used for proxied requests.
+func (r *RoundTripper) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if t, ok := r.proxyTransport.(*http.Transport); ok {
+		t.CloseIdleConnections()
+	}
+	for _, client := range r.clients {
+		if err := client.Close(); err != nil {
+			return err
+		}
+	}
+	r.clients = nil
+	return nil
+}
+
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+func validMethod(method string) bool {
+	/*
+				     Method         = "OPTIONS"                ; Section 9.2
+		   		                    | "GET"                    ; Section 9.3
+		   		                    | "HEAD"                   ; Section 9.4
+		   		                    | "POST"                   ; Section 9.5
+		   		                    | "PUT"                    ; Section 9.6
+		   		                    | "DELETE"                 ; Section 9.7
+		   		                    | "TRACE"                  ; Section 9.8
+		   		                    | "CONNECT"                ; Section 9.9
+		   		                    | extension-method
+		   		   extension-method = token
+		   		     token          = 1*<any CHAR except CTLs or separators>
+	*/
+	return len(method) > 0 && strings.IndexFunc(method, isNotToken) == -1
+}
+
+// copied from net/http/http.go
+func isNotToken(r rune) bool {
+	return !httpguts.IsTokenRune(r)
+}
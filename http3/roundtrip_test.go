@@ -0,0 +1,354 @@
+package http3
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type mockClient struct {
+	closed    bool
+	goingAway bool
+	// if set, RoundTrip returns this error, and the client is going away afterwards
+	roundTripErr error
+	requests     []*http.Request
+}
+
+func (m *mockClient) RoundTrip(req *http.Request) (*http.Response, error) {
+	m.requests = append(m.requests, req)
+	if m.roundTripErr != nil {
+		m.goingAway = true
+		return nil, m.roundTripErr
+	}
+	return &http.Response{Request: req}, nil
+}
+func (m *mockClient) Close() error {
+	m.closed = true
+	return nil
+}
+func (m *mockClient) isGoingAway() bool { return m.goingAway }
+
+var _ roundTripCloser = &mockClient{}
+
+type mockBody struct {
+	reader   bytes.Reader
+	readErr  error
+	closeErr error
+	closed   bool
+}
+
+func (m *mockBody) Read(p []byte) (int, error) {
+	if m.readErr != nil {
+		return 0, m.readErr
+	}
+	return m.reader.Read(p)
+}
+
+func (m *mockBody) SetData(data []byte) {
+	m.reader = *bytes.NewReader(data)
+}
+
+func (m *mockBody) Close() error {
+	m.closed = true
+	return m.closeErr
+}
+
+// make sure the mockBody can be used as a http.Request.Body
+var _ io.ReadCloser = &mockBody{}
+
+var _ = Describe("RoundTripper", func() {
+	var (
+		rt   *RoundTripper
+		req1 *http.Request
+	)
+
+	BeforeEach(func() {
+		rt = &RoundTripper{}
+		var err error
+		req1, err = http.NewRequest("GET", "https://www.example.org/file1.html", nil)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Context("dialing hosts", func() {
+		origDialAddr := dialAddr
+		dialErr := errors.New("dial error")
+
+		BeforeEach(func() {
+			origDialAddr = dialAddr
+			dialAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+				// we don't want to test all the dial logic here, just that dialing happens at all
+				return nil, dialErr
+			}
+		})
+
+		AfterEach(func() {
+			dialAddr = origDialAddr
+		})
+
+		It("creates new clients", func() {
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(dialErr))
+			Expect(rt.clients).To(HaveLen(1))
+		})
+
+		It("uses the quic.Config, if provided, but always uses IETF QUIC", func() {
+			config := &quic.Config{
+				HandshakeTimeout: time.Millisecond,
+				Versions:         []quic.VersionNumber{protocol.Version39},
+			}
+			var receivedConfig *quic.Config
+			dialAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+				receivedConfig = config
+				return nil, errors.New("err")
+			}
+			rt.QuicConfig = config
+			rt.RoundTrip(req1)
+			Expect(receivedConfig.HandshakeTimeout).To(Equal(time.Millisecond))
+			Expect(receivedConfig.Versions).To(Equal([]quic.VersionNumber{protocol.VersionTLS}))
+			Expect(config.Versions).To(Equal([]quic.VersionNumber{protocol.Version39}))
+		})
+
+		It("negotiates h3, without modifying the tls.Config", func() {
+			var receivedTLSConf *tls.Config
+			dialAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+				receivedTLSConf = tlsConf
+				return nil, errors.New("err")
+			}
+			rt.TLSClientConfig = &tls.Config{ServerName: "foo.bar"}
+			rt.RoundTrip(req1)
+			Expect(receivedTLSConf.ServerName).To(Equal("foo.bar"))
+			Expect(receivedTLSConf.NextProtos).To(Equal([]string{"h3"}))
+			Expect(rt.TLSClientConfig.NextProtos).To(BeEmpty())
+		})
+
+		It("uses the custom dialer, if provided", func() {
+			var dialed bool
+			dialer := func(_, _ string, tlsCfgP *tls.Config, cfg *quic.Config) (quic.Session, error) {
+				dialed = true
+				return nil, errors.New("err")
+			}
+			rt.Dial = dialer
+			rt.RoundTrip(req1)
+			Expect(dialed).To(BeTrue())
+		})
+
+		It("reuses existing clients", func() {
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/file1.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(dialErr))
+			Expect(rt.clients).To(HaveLen(1))
+			req2, err := http.NewRequest("GET", "https://quic.clemente.io/file2.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req2)
+			Expect(err).To(MatchError(dialErr))
+			Expect(rt.clients).To(HaveLen(1))
+		})
+
+		It("replaces clients that are going away", func() {
+			rt.clients = make(map[string]roundTripCloser)
+			cl := &mockClient{goingAway: true}
+			rt.clients["quic.clemente.io:443"] = cl
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(dialErr))
+			Expect(rt.clients).To(HaveLen(1))
+			Expect(rt.clients["quic.clemente.io:443"]).ToNot(Equal(cl))
+			// requests that are still in flight are allowed to complete
+			Expect(cl.closed).To(BeFalse())
+		})
+
+		It("retries requests on a new connection when the server is going away", func() {
+			rt.clients = make(map[string]roundTripCloser)
+			cl := &mockClient{roundTripErr: errGoingAway}
+			rt.clients["quic.clemente.io:443"] = cl
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(dialErr))
+			Expect(cl.requests).To(HaveLen(1))
+			Expect(rt.clients["quic.clemente.io:443"]).ToNot(Equal(cl))
+		})
+
+		It("retries rejected requests on a new connection, rewinding the body", func() {
+			rt.clients = make(map[string]roundTripCloser)
+			cl := &mockClient{roundTripErr: errRequestRejected}
+			rt.clients["quic.clemente.io:443"] = cl
+			req, err := http.NewRequest("POST", "https://quic.clemente.io/foobar.html", bytes.NewReader([]byte("foobar")))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(req.GetBody).ToNot(BeNil())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(dialErr))
+			Expect(cl.requests).To(HaveLen(1))
+			Expect(rt.clients["quic.clemente.io:443"]).ToNot(Equal(cl))
+		})
+
+		It("doesn't retry rejected requests if the body can't be rewound", func() {
+			rt.clients = make(map[string]roundTripCloser)
+			cl := &mockClient{roundTripErr: errRequestRejected}
+			rt.clients["quic.clemente.io:443"] = cl
+			req, err := http.NewRequest("POST", "https://quic.clemente.io/foobar.html", &mockBody{})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(errRequestRejected))
+			Expect(cl.requests).To(HaveLen(1))
+			Expect(rt.clients["quic.clemente.io:443"]).To(Equal(cl))
+		})
+
+		It("doesn't use clients that are going away if RoundTripOpt.OnlyCachedConn is set", func() {
+			rt.clients = make(map[string]roundTripCloser)
+			rt.clients["quic.clemente.io:443"] = &mockClient{goingAway: true}
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTripOpt(req, RoundTripOpt{OnlyCachedConn: true})
+			Expect(err).To(MatchError(ErrNoCachedConn))
+		})
+
+		It("doesn't create new clients if RoundTripOpt.OnlyCachedConn is set", func() {
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTripOpt(req, RoundTripOpt{OnlyCachedConn: true})
+			Expect(err).To(MatchError(ErrNoCachedConn))
+		})
+	})
+
+	Context("validating request", func() {
+		It("rejects plain HTTP requests", func() {
+			req, err := http.NewRequest("GET", "http://www.example.org/", nil)
+			req.Body = &mockBody{}
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("quic: unsupported protocol scheme: http"))
+			Expect(req.Body.(*mockBody).closed).To(BeTrue())
+		})
+
+		It("rejects requests without a URL", func() {
+			req1.URL = nil
+			req1.Body = &mockBody{}
+			_, err := rt.RoundTrip(req1)
+			Expect(err).To(MatchError("quic: nil Request.URL"))
+			Expect(req1.Body.(*mockBody).closed).To(BeTrue())
+		})
+
+		It("rejects request without a URL Host", func() {
+			req1.URL.Host = ""
+			req1.Body = &mockBody{}
+			_, err := rt.RoundTrip(req1)
+			Expect(err).To(MatchError("quic: no Host in request URL"))
+			Expect(req1.Body.(*mockBody).closed).To(BeTrue())
+		})
+
+		It("doesn't try to close the body if the request doesn't have one", func() {
+			req1.URL = nil
+			Expect(req1.Body).To(BeNil())
+			_, err := rt.RoundTrip(req1)
+			Expect(err).To(MatchError("quic: nil Request.URL"))
+		})
+
+		It("rejects requests without a header", func() {
+			req1.Header = nil
+			req1.Body = &mockBody{}
+			_, err := rt.RoundTrip(req1)
+			Expect(err).To(MatchError("quic: nil Request.Header"))
+			Expect(req1.Body.(*mockBody).closed).To(BeTrue())
+		})
+
+		It("rejects requests with invalid header name fields", func() {
+			req1.Header.Add("foobär", "value")
+			_, err := rt.RoundTrip(req1)
+			Expect(err).To(MatchError("quic: invalid http header field name \"foobär\""))
+		})
+
+		It("rejects requests with invalid header name values", func() {
+			req1.Header.Add("foo", string([]byte{0x7}))
+			_, err := rt.RoundTrip(req1)
+			Expect(err.Error()).To(ContainSubstring("quic: invalid http header field value"))
+		})
+
+		It("rejects requests with an invalid request method", func() {
+			req1.Method = "foobär"
+			req1.Body = &mockBody{}
+			_, err := rt.RoundTrip(req1)
+			Expect(err).To(MatchError("quic: invalid method \"foobär\""))
+			Expect(req1.Body.(*mockBody).closed).To(BeTrue())
+		})
+	})
+
+	Context("proxies", func() {
+		var proxyTransport *mockClient
+
+		BeforeEach(func() {
+			proxyTransport = &mockClient{}
+			rt.ProxyTransport = proxyTransport
+		})
+
+		It("uses the ProxyTransport for proxied requests", func() {
+			rt.Proxy = func(req *http.Request) (*url.URL, error) {
+				Expect(req).To(Equal(req1))
+				return url.Parse("http://proxy.example.org:3128")
+			}
+			rsp, err := rt.RoundTrip(req1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Request).To(Equal(req1))
+			Expect(rt.clients).To(BeEmpty())
+		})
+
+		It("uses QUIC if the Proxy function doesn't return a proxy", func() {
+			rt.Proxy = func(*http.Request) (*url.URL, error) { return nil, nil }
+			_, err := rt.RoundTripOpt(req1, RoundTripOpt{OnlyCachedConn: true})
+			Expect(err).To(MatchError(ErrNoCachedConn))
+		})
+
+		It("returns the error returned by the Proxy function", func() {
+			testErr := errors.New("proxy error")
+			rt.Proxy = func(*http.Request) (*url.URL, error) { return nil, testErr }
+			req1.Body = &mockBody{}
+			_, err := rt.RoundTrip(req1)
+			Expect(err).To(MatchError(testErr))
+			Expect(req1.Body.(*mockBody).closed).To(BeTrue())
+		})
+
+		It("creates an http.Transport, if no ProxyTransport is set", func() {
+			rt.ProxyTransport = nil
+			rt.Proxy = http.ProxyFromEnvironment
+			rt.TLSClientConfig = &tls.Config{ServerName: "foo.bar"}
+			t, ok := rt.getProxyTransport().(*http.Transport)
+			Expect(ok).To(BeTrue())
+			Expect(t.TLSClientConfig).To(Equal(rt.TLSClientConfig))
+			Expect(t.Proxy).ToNot(BeNil())
+			Expect(rt.getProxyTransport()).To(BeIdenticalTo(t))
+		})
+	})
+
+	Context("closing", func() {
+		It("closes", func() {
+			rt.clients = make(map[string]roundTripCloser)
+			cl := &mockClient{}
+			rt.clients["foo.bar"] = cl
+			err := rt.Close()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(rt.clients)).To(BeZero())
+			Expect(cl.closed).To(BeTrue())
+		})
+
+		It("closes a RoundTripper that has never been used", func() {
+			Expect(len(rt.clients)).To(BeZero())
+			err := rt.Close()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(rt.clients)).To(BeZero())
+		})
+	})
+})
@@ -0,0 +1,596 @@
+package http3
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3/qpack"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// nextProtoH3 is the ALPN token used for HTTP/3
+const nextProtoH3 = "h3"
+
+// allows mocking of quic.Listen and quic.ListenAddr
+var (
+	quicListen     = quic.Listen
+	quicListenAddr = quic.ListenAddr
+)
+
+// Server is a HTTP/3 server.
+// HTTP/3 runs on top of IETF QUIC, so it is not compatible with the gQUIC versions used by the h2quic.Server.
+// Warning: This API should not be considered stable and might change soon.
+type Server struct {
+	*http.Server
+
+	// By providing a quic.Config, it is possible to set parameters of the QUIC connection.
+	// If nil, it uses reasonable default values.
+	// The Versions are ignored, HTTP/3 is always served over IETF QUIC.
+	QuicConfig *quic.Config
+
+	// QPACKConfig configures the QPACK dynamic table used to compress request and response headers.
+	// If nil, a dynamic table with a capacity of 4 KB is used, and up to 16 streams may be blocked.
+	QPACKConfig *qpack.Config
+
+	// EnableExtendedConnect enables Extended CONNECT requests (see RFC 9220), which are used for CONNECT-UDP (see ProxyConnectUDP).
+	// It is implied by EnableWebTransport.
+	EnableExtendedConnect bool
+
+	// EnableWebTransport enables WebTransport sessions, see draft-ietf-webtrans-http3-02.
+	// Handlers establish a session by passing an Extended CONNECT request to UpgradeWebTransport.
+	EnableWebTransport bool
+
+	port uint32 // used atomically
+
+	listenerMutex sync.Mutex
+	listener      quic.Listener
+	closed        bool
+
+	connMutex    sync.Mutex
+	conns        map[*connection]struct{}
+	shuttingDown bool
+
+	logger utils.Logger // will be set by Server.serveImpl()
+}
+
+// ListenAndServe listens on the UDP address s.Addr and calls s.Handler to handle HTTP/3 requests on incoming connections.
+func (s *Server) ListenAndServe() error {
+	if s.Server == nil {
+		return errors.New("use of http3.Server without http.Server")
+	}
+	return s.serveImpl(s.TLSConfig, nil)
+}
+
+// ListenAndServeTLS listens on the UDP address s.Addr and calls s.Handler to handle HTTP/3 requests on incoming connections.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	var err error
+	certs := make([]tls.Certificate, 1)
+	certs[0], err = tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	// We currently only use the cert-related stuff from tls.Config,
+	// so we don't need to make a full copy.
+	config := &tls.Config{
+		Certificates: certs,
+	}
+	return s.serveImpl(config, nil)
+}
+
+// Serve an existing UDP connection.
+func (s *Server) Serve(conn net.PacketConn) error {
+	return s.serveImpl(s.TLSConfig, conn)
+}
+
+func (s *Server) serveImpl(tlsConfig *tls.Config, conn net.PacketConn) error {
+	if s.Server == nil {
+		return errors.New("use of http3.Server without http.Server")
+	}
+	s.logger = utils.DefaultLogger.WithPrefix("server")
+	s.listenerMutex.Lock()
+	if s.closed {
+		s.listenerMutex.Unlock()
+		return errors.New("Server is already closed")
+	}
+	if s.listener != nil {
+		s.listenerMutex.Unlock()
+		return errors.New("ListenAndServe may only be called once")
+	}
+
+	var tlsConf *tls.Config
+	if tlsConfig == nil {
+		tlsConf = &tls.Config{}
+	} else {
+		tlsConf = tlsConfig.Clone()
+	}
+	tlsConf.NextProtos = []string{nextProtoH3}
+	quicConf := s.quicConfig()
+
+	var ln quic.Listener
+	var err error
+	if conn == nil {
+		ln, err = quicListenAddr(s.Addr, tlsConf, quicConf)
+	} else {
+		ln, err = quicListen(conn, tlsConf, quicConf)
+	}
+	if err != nil {
+		s.listenerMutex.Unlock()
+		return err
+	}
+	s.listener = ln
+	s.listenerMutex.Unlock()
+	// Advertise the port that the listener is actually bound to,
+	// which might not be the port of s.Addr (e.g. if it is 0).
+	if addr, ok := ln.Addr().(*net.UDPAddr); ok {
+		atomic.StoreUint32(&s.port, uint32(addr.Port))
+	}
+
+	for {
+		sess, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConn(sess)
+	}
+}
+
+// quicConfig returns a copy of the QuicConfig, restricted to IETF QUIC
+func (s *Server) quicConfig() *quic.Config {
+	conf := &quic.Config{}
+	if s.QuicConfig != nil {
+		c := *s.QuicConfig
+		conf = &c
+	}
+	conf.Versions = []quic.VersionNumber{protocol.VersionTLS}
+	conf.AcceptedVersions = nil
+	return conf
+}
+
+func (s *Server) handleConn(sess quic.Session) {
+	if proto := sess.ConnectionState().NegotiatedProtocol; proto != nextProtoH3 {
+		s.logger.Debugf("Client didn't negotiate HTTP/3 (ALPN: %q)", proto)
+		sess.CloseWithError(quic.ErrorCode(errorVersionFallback), "")
+		return
+	}
+	settings := map[uint64]uint64{settingMaxFieldSectionSize: uint64(s.maxHeaderBytes())}
+	if s.extendedConnectEnabled() {
+		settings[settingEnableConnectProtocol] = 1
+	}
+	if s.EnableWebTransport {
+		settings[settingEnableWebTransport] = 1
+	}
+	conn := newConnection(sess, true, settings, s.QPACKConfig, nil, s.logger)
+	conn.enableWebTransport = s.EnableWebTransport
+	if err := conn.start(); err != nil {
+		s.logger.Debugf("Opening the control and QPACK streams failed: %s", err)
+		return
+	}
+	if !s.addConn(conn) {
+		// The server is shutting down.
+		sess.CloseWithError(quic.ErrorCode(errorNoError), "")
+		return
+	}
+	defer s.removeConn(conn)
+	for {
+		str, err := sess.AcceptStream()
+		if err != nil {
+			s.logger.Debugf("Accepting streams failed: %s", err)
+			return
+		}
+		if !conn.acceptRequest(uint64(str.StreamID())) {
+			// The client opened the stream after we sent the GOAWAY frame.
+			// The request wasn't processed, so it's safe for the client to retry it.
+			cancelStream(str, errorRequestRejected)
+			continue
+		}
+		go func() {
+			s.handleRequest(conn, str)
+			conn.completeRequest(uint64(str.StreamID()))
+		}()
+	}
+}
+
+// addConn adds a connection to the connections that are shut down by Shutdown.
+// It returns false if the server is already shutting down.
+func (s *Server) addConn(conn *connection) bool {
+	s.connMutex.Lock()
+	defer s.connMutex.Unlock()
+	if s.shuttingDown {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[*connection]struct{})
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) removeConn(conn *connection) {
+	s.connMutex.Lock()
+	delete(s.conns, conn)
+	s.connMutex.Unlock()
+}
+
+func (s *Server) handleRequest(conn *connection, str quic.Stream) {
+	if s.ReadHeaderTimeout > 0 {
+		str.SetReadDeadline(time.Now().Add(s.ReadHeaderTimeout))
+	}
+	// Bidirectional WebTransport streams start with a signal value instead of a HEADERS frame.
+	t, err := utils.ReadVarInt(&byteReader{Reader: str})
+	var f frame
+	if err == nil {
+		if t == frameTypeWebTransportStream && conn.enableWebTransport {
+			conn.handleWebTransportStream(str)
+			return
+		}
+		f, err = parseFrame(str, t)
+		if f == nil && err == nil {
+			f, err = parseNextFrame(str)
+		}
+	}
+	if err != nil {
+		if connErr, ok := err.(*connectionError); ok {
+			conn.closeWithError(connErr)
+			return
+		}
+		s.logger.Debugf("Reading the request headers on stream %d failed: %s", str.StreamID(), err)
+		cancelStream(str, errorRequestIncomplete)
+		return
+	}
+	hf, ok := f.(*headersFrame)
+	if !ok {
+		conn.closeWithError(&connectionError{code: errorFrameUnexpected, reason: "expected first frame to be a HEADERS frame"})
+		return
+	}
+	if hf.Length > uint64(s.maxHeaderBytes()) {
+		s.logger.Debugf("HEADERS frame on stream %d too large (%d bytes)", str.StreamID(), hf.Length)
+		cancelStream(str, errorExcessiveLoad)
+		return
+	}
+	headerBlock := make([]byte, hf.Length)
+	if _, err := io.ReadFull(str, headerBlock); err != nil {
+		s.logger.Debugf("Reading the request headers on stream %d failed: %s", str.StreamID(), err)
+		cancelStream(str, errorRequestIncomplete)
+		return
+	}
+	headers, err := conn.decoder.DecodeFieldSection(str.Context(), uint64(str.StreamID()), headerBlock, uint64(s.maxHeaderBytes()))
+	if err != nil {
+		if str.Context().Err() != nil {
+			// The stream was reset while the field section was blocked.
+			return
+		}
+		if err == qpack.ErrFieldSectionTooLarge {
+			s.logger.Debugf("Request headers on stream %d too large", str.StreamID())
+			cancelStream(str, errorExcessiveLoad)
+			return
+		}
+		conn.closeWithError(&connectionError{code: errorQPACKDecompressionFailed, reason: err.Error()})
+		return
+	}
+	req, err := requestFromHeaders(headers)
+	if err != nil {
+		s.logger.Debugf("Invalid request on stream %d: %s", str.StreamID(), err)
+		cancelStream(str, errorMessageError)
+		return
+	}
+	if isExtendedConnect(req) && !s.extendedConnectEnabled() {
+		// We didn't enable the Extended CONNECT method in our SETTINGS.
+		s.logger.Debugf("Invalid request on stream %d: unexpected Extended CONNECT request", str.StreamID())
+		cancelStream(str, errorMessageError)
+		return
+	}
+
+	if s.logger.Debug() {
+		s.logger.Infof("%s %s%s, on stream %d", req.Method, req.Host, req.RequestURI, str.StreamID())
+	} else {
+		s.logger.Infof("%s %s%s", req.Method, req.Host, req.RequestURI)
+	}
+
+	var bodyDeadline time.Time
+	if s.ReadTimeout > 0 {
+		bodyDeadline = time.Now().Add(s.ReadTimeout)
+	}
+	str.SetReadDeadline(bodyDeadline)
+
+	// Just like with net/http, the request context is canceled when the client cancels the request,
+	// when the connection is closed, or when the handler returns.
+	// The stream context is canceled when the client resets the stream, or asks us to stop sending the response.
+	ctx, cancel := context.WithCancel(str.Context())
+	defer cancel()
+	req = req.WithContext(ctx)
+	reqBody := &requestBody{body: newBody(str, conn.closeWithError)}
+	reqBody.onTrailers = func(f *headersFrame) error {
+		return conn.readTrailers(ctx, str, f, uint64(s.maxHeaderBytes()), &req.Trailer)
+	}
+	req.Body = reqBody
+	req.RemoteAddr = conn.session.RemoteAddr().String()
+
+	responseWriter := newResponseWriter(str, conn.encoder, req.Method == http.MethodHead, s.logger)
+	responseWriter.pusher = &pusher{server: s, conn: conn, str: str, req: req}
+	responseWriter.requestStream = str
+	responseWriter.conn = conn
+	responseWriter.canceler = newRequestCanceler(ctx, str)
+
+	status := s.runHandler(responseWriter, req)
+	canceled := responseWriter.canceler.stop()
+	if responseWriter.upgraded {
+		// The request stream now belongs to the WebTransport session.
+		return
+	}
+	if canceled {
+		// The stream was already reset.
+		return
+	}
+	if !reqBody.requestRead {
+		// The client is allowed to send a request body, even if the handler doesn't read it.
+		// H3_NO_ERROR tells the client to stop sending it, without aborting the response.
+		str.CancelRead(quic.ErrorCode(errorNoError))
+	}
+	responseWriter.finish(status)
+}
+
+// runHandler runs the handler, recovering from panics.
+// It returns the status code that is used if the handler didn't write the response header.
+func (s *Server) runHandler(w http.ResponseWriter, req *http.Request) (status int) {
+	handler := s.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			// Copied from net/http/server.go
+			const size = 64 << 10
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+			s.logger.Errorf("http: panic serving: %v\n%s", p, buf)
+			status = http.StatusInternalServerError
+		}
+	}()
+	handler.ServeHTTP(w, req)
+	return http.StatusOK
+}
+
+func (s *Server) extendedConnectEnabled() bool {
+	return s.EnableExtendedConnect || s.EnableWebTransport
+}
+
+// maxHeaderBytes is the maximum size of a HEADERS frame
+func (s *Server) maxHeaderBytes() int {
+	if s.MaxHeaderBytes <= 0 {
+		return http.DefaultMaxHeaderBytes
+	}
+	return s.MaxHeaderBytes
+}
+
+// Close the server immediately, aborting requests and sending CONNECTION_CLOSE frames to connected clients.
+// Close in combination with ListenAndServe() (instead of Serve()) may race if it is called before a UDP socket is established.
+func (s *Server) Close() error {
+	s.listenerMutex.Lock()
+	defer s.listenerMutex.Unlock()
+	s.closed = true
+	if s.listener != nil {
+		err := s.listener.Close()
+		s.listener = nil
+		return err
+	}
+	return nil
+}
+
+// Shutdown gracefully shuts down the server.
+// It sends a GOAWAY frame on every connection, so that clients stop sending new requests,
+// and waits for the requests that are in flight to complete.
+// Once the responses were acknowledged by the client, the connection is closed with H3_NO_ERROR.
+// New connections are closed right away. When all connections are closed, it stops listening.
+// If ctx expires before that, the remaining connections are closed, and the context's error is returned.
+// Shutdown doesn't wait for WebTransport sessions.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.connMutex.Lock()
+	s.shuttingDown = true
+	conns := make([]*connection, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.connMutex.Unlock()
+
+	done := make([]<-chan struct{}, 0, len(conns))
+	for _, conn := range conns {
+		requestsDone, err := conn.goAway()
+		if err != nil {
+			s.logger.Debugf("Sending the GOAWAY frame failed: %s", err)
+		}
+		done = append(done, requestsDone)
+	}
+	var err error
+	for i, conn := range conns {
+		select {
+		case <-done[i]:
+		case <-conn.session.Context().Done():
+			continue
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err == nil {
+			// Closing the connection right after the last response would discard response data that the client didn't receive yet.
+			err = waitForAcks(ctx, conn.session)
+		}
+		if err != nil {
+			break
+		}
+	}
+	for _, conn := range conns {
+		conn.session.CloseWithError(quic.ErrorCode(errorNoError), "")
+	}
+	if cerr := s.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// the interval at which waitForAcks checks if all data was acknowledged
+const ackPollInterval = 5 * time.Millisecond
+
+// waitForAcks waits until all data sent on the session was acknowledged, or the session was closed.
+// Data is considered acknowledged if nothing is in flight or queued, and no packet was sent for one ackPollInterval.
+// The last condition makes sure that stream data that wasn't packed yet when the stats were taken is accounted for.
+func waitForAcks(ctx context.Context, sess quic.Session) error {
+	ticker := time.NewTicker(ackPollInterval)
+	defer ticker.Stop()
+	var packetsSent uint64
+	var idle bool
+	for {
+		stats := sess.Stats()
+		if stats.BytesInFlight == 0 && stats.SendQueueLength == 0 {
+			if idle && stats.PacketsSent == packetsSent {
+				return nil
+			}
+			idle = true
+		} else {
+			idle = false
+		}
+		packetsSent = stats.PacketsSent
+		select {
+		case <-ticker.C:
+		case <-sess.Context().Done():
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// SetQuicHeaders can be used to set the proper headers that announce that this server supports HTTP/3.
+// The values that are set depend on the port that the server listens on.
+// If the server is not listening yet, the port is taken from s.Server.Addr.
+// They currently look like this (if the port is 443):
+//  Alt-Svc: h3=":443"; ma=2592000
+func (s *Server) SetQuicHeaders(hdr http.Header) error {
+	port := atomic.LoadUint32(&s.port)
+
+	if port == 0 {
+		// Extract port from s.Server.Addr
+		_, portStr, err := net.SplitHostPort(s.Server.Addr)
+		if err != nil {
+			return err
+		}
+		portInt, err := net.LookupPort("tcp", portStr)
+		if err != nil {
+			return err
+		}
+		port = uint32(portInt)
+		atomic.StoreUint32(&s.port, port)
+	}
+
+	hdr.Add("Alt-Svc", fmt.Sprintf(`%s=":%d"; ma=2592000`, nextProtoH3, port))
+	return nil
+}
+
+// ListenAndServeQUIC listens on the UDP network address addr and calls the
+// handler for HTTP/3 requests on incoming connections. http.DefaultServeMux is
+// used when handler is nil.
+func ListenAndServeQUIC(addr, certFile, keyFile string, handler http.Handler) error {
+	server := &Server{
+		Server: &http.Server{
+			Addr:    addr,
+			Handler: handler,
+		},
+	}
+	return server.ListenAndServeTLS(certFile, keyFile)
+}
+
+// ListenAndServe listens on the given network address for both TLS and QUIC connections in parallel.
+// HTTP/1.1 and HTTP/2 are served on the TCP listener, and HTTP/3 on the QUIC listener, using the same handler.
+// Responses sent over TCP carry the Alt-Svc header, announcing that the server supports HTTP/3.
+// It returns if one of the two servers returns an error, after closing the other one.
+// http.DefaultServeMux is used when handler is nil.
+func ListenAndServe(addr, certFile, keyFile string, handler http.Handler) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		// The http.Server only serves HTTP/2 if h2 is offered.
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	// Open the listeners
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	udpConn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return err
+	}
+	defer udpConn.Close()
+
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return err
+	}
+	tcpConn, err := net.ListenTCP("tcp", tcpAddr)
+	if err != nil {
+		return err
+	}
+	defer tcpConn.Close()
+
+	tlsConn := tls.NewListener(tcpConn, config)
+	defer tlsConn.Close()
+
+	// Start the servers
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	quicServer := &Server{
+		Server: &http.Server{
+			Addr:      addr,
+			Handler:   handler,
+			TLSConfig: config,
+		},
+	}
+	// Requests on the TCP listener might be served before the QUIC server has started.
+	atomic.StoreUint32(&quicServer.port, uint32(udpConn.LocalAddr().(*net.UDPAddr).Port))
+	httpServer := &http.Server{
+		Addr:      addr,
+		TLSConfig: config,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			quicServer.SetQuicHeaders(w.Header())
+			handler.ServeHTTP(w, r)
+		}),
+	}
+
+	hErr := make(chan error, 1)
+	qErr := make(chan error, 1)
+	go func() {
+		hErr <- httpServer.Serve(tlsConn)
+	}()
+	go func() {
+		qErr <- quicServer.Serve(udpConn)
+	}()
+
+	select {
+	case err := <-hErr:
+		quicServer.Close()
+		return err
+	case err := <-qErr:
+		httpServer.Close()
+		return err
+	}
+}
+
+// cancelStream aborts both directions of a request stream
+func cancelStream(str quic.Stream, code errorCode) {
+	str.CancelRead(quic.ErrorCode(code))
+	str.CancelWrite(quic.ErrorCode(code))
+}
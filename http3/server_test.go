@@ -0,0 +1,1118 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3/qpack"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// the certificate in the testdata is valid for this hostname
+const testServerName = "quic.clemente.io"
+
+func getClientTLSConfig() *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         testServerName,
+	}
+}
+
+// startServer starts a HTTP/3 server on a random port on localhost
+func startServer(handler http.Handler) (*Server, string) {
+	s := &Server{
+		Server: &http.Server{
+			Handler:   handler,
+			TLSConfig: testdata.GetTLSConfig(),
+		},
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	go func() {
+		defer GinkgoRecover()
+		s.Serve(conn)
+	}()
+	return s, conn.LocalAddr().String()
+}
+
+// dialRaw establishes a QUIC session to a HTTP/3 server, without starting a HTTP/3 connection
+func dialRaw(addr string) quic.Session {
+	tlsConf := getClientTLSConfig()
+	tlsConf.NextProtos = []string{nextProtoH3}
+	sess, err := quic.DialAddr(addr, tlsConf, &quic.Config{Versions: []quic.VersionNumber{protocol.VersionTLS}})
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	return sess
+}
+
+// openControlStream opens the control stream, and sends a SETTINGS frame
+func openControlStream(sess quic.Session) quic.SendStream {
+	str, err := sess.OpenUniStream()
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	b := &bytes.Buffer{}
+	utils.WriteVarInt(b, streamTypeControl)
+	(&settingsFrame{}).Write(b)
+	_, err = str.Write(b.Bytes())
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	return str
+}
+
+// expectSessionClosedWithError waits until the session is closed, and checks the error code
+func expectSessionClosedWithError(sess quic.Session, code errorCode) {
+	_, err := sess.AcceptStream()
+	ExpectWithOffset(1, err).To(HaveOccurred())
+	appErr, ok := err.(quic.ApplicationError)
+	ExpectWithOffset(1, ok).To(BeTrue(), "expected an application error, got "+err.Error())
+	ExpectWithOffset(1, appErr.ErrorCode()).To(BeEquivalentTo(code))
+}
+
+var _ = Describe("Server", func() {
+	var (
+		s    *Server
+		addr string
+		rt   *RoundTripper
+		mux  *http.ServeMux
+	)
+
+	BeforeEach(func() {
+		mux = http.NewServeMux()
+		s, addr = startServer(mux)
+		rt = &RoundTripper{TLSClientConfig: getClientTLSConfig()}
+	})
+
+	AfterEach(func() {
+		Expect(rt.Close()).To(Succeed())
+		Expect(s.Close()).To(Succeed())
+	})
+
+	It("serves a request", func() {
+		mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal("GET"))
+			Expect(r.Proto).To(Equal("HTTP/3.0"))
+			Expect(r.Header.Get("Foo")).To(Equal("bar"))
+			Expect(r.RemoteAddr).ToNot(BeEmpty())
+			w.Header().Set("Baz", "qux")
+			w.Write([]byte("Hello, World!"))
+		})
+		req, err := http.NewRequest("GET", "https://"+addr+"/hello", nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Foo", "bar")
+		rsp, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(200))
+		Expect(rsp.Proto).To(Equal("HTTP/3.0"))
+		Expect(rsp.Header.Get("Baz")).To(Equal("qux"))
+		body, err := ioutil.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(Equal("Hello, World!"))
+	})
+
+	It("reads the request body", func() {
+		mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.ContentLength).To(BeEquivalentTo(6))
+			io.Copy(w, r.Body)
+		})
+		rsp, err := (&http.Client{Transport: rt}).Post("https://"+addr+"/echo", "text/plain", bytes.NewReader([]byte("foobar")))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(200))
+		body, err := ioutil.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(Equal("foobar"))
+	})
+
+	It("reads a large request body", func() {
+		data := make([]byte, 5*requestBodyFrameSize/2)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(w, r.Body)
+		})
+		rsp, err := (&http.Client{Transport: rt}).Post("https://"+addr+"/echo", "text/plain", ioutil.NopCloser(bytes.NewReader(data)))
+		Expect(err).ToNot(HaveOccurred())
+		body, err := ioutil.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body).To(Equal(data))
+	})
+
+	It("responds with status 500 if the handler panics", func() {
+		mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+			panic("foobar")
+		})
+		rsp, err := (&http.Client{Transport: rt}).Get("https://" + addr + "/panic")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(500))
+	})
+
+	It("responds with status 200 if the handler doesn't write anything", func() {
+		mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {})
+		rsp, err := (&http.Client{Transport: rt}).Get("https://" + addr + "/empty")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(200))
+		body, err := ioutil.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body).To(BeEmpty())
+	})
+
+	It("responds to HEAD requests", func() {
+		mux.HandleFunc("/head", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal("HEAD"))
+			w.Header().Set("Content-Length", "6")
+			w.Write([]byte("foobar"))
+		})
+		rsp, err := (&http.Client{Transport: rt}).Head("https://" + addr + "/head")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(200))
+		Expect(rsp.ContentLength).To(BeEquivalentTo(6))
+		body, err := ioutil.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body).To(BeEmpty())
+	})
+
+	It("serves multiple requests on the same connection", func() {
+		mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("Hello, World!"))
+		})
+		cl := &http.Client{Transport: rt}
+		for i := 0; i < 5; i++ {
+			rsp, err := cl.Get("https://" + addr + "/hello")
+			Expect(err).ToNot(HaveOccurred())
+			body, err := ioutil.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal("Hello, World!"))
+		}
+		Expect(rt.clients).To(HaveLen(1))
+	})
+
+	Context("using the QPACK dynamic table", func() {
+		// doRequests sends requests with the same headers, and checks that the server receives them
+		doRequests := func() {
+			mux.HandleFunc("/headers", func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Header.Get("Foo")).To(Equal("bar"))
+				Expect(r.Header.Get("Lorem")).To(Equal("ipsum"))
+				w.Header().Set("Baz", "qux")
+				w.Header().Set("Dolor", r.URL.Query().Get("dolor"))
+			})
+			for i := 0; i < 10; i++ {
+				req, err := http.NewRequest("GET", fmt.Sprintf("https://%s/headers?dolor=%d", addr, i%3), nil)
+				Expect(err).ToNot(HaveOccurred())
+				req.Header.Set("Foo", "bar")
+				req.Header.Set("Lorem", "ipsum")
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(rsp.Header.Get("Baz")).To(Equal("qux"))
+				Expect(rsp.Header.Get("Dolor")).To(Equal(strconv.Itoa(i % 3)))
+				Expect(rsp.Body.Close()).To(Succeed())
+			}
+		}
+
+		It("serves requests", func() {
+			doRequests()
+		})
+
+		It("serves requests if the server disables the dynamic table", func() {
+			s.QPACKConfig = &qpack.Config{}
+			doRequests()
+		})
+
+		It("serves requests if the client disables the dynamic table", func() {
+			rt.QPACKConfig = &qpack.Config{}
+			doRequests()
+		})
+	})
+
+	Context("server push", func() {
+		// dialPush establishes a session, and allows the server to push
+		dialPush := func(maxPushID uint64) (quic.Session, quic.SendStream) {
+			sess := dialRaw(addr)
+			ctrl := openControlStream(sess)
+			b := &bytes.Buffer{}
+			(&maxPushIDFrame{PushID: maxPushID}).Write(b)
+			_, err := ctrl.Write(b.Bytes())
+			ExpectWithOffset(1, err).ToNot(HaveOccurred())
+			return sess, ctrl
+		}
+
+		// push pushes a response.
+		// The MAX_PUSH_ID frame is sent on the control stream, so it might be processed after the request.
+		push := func(w http.ResponseWriter, target string, opts *http.PushOptions) {
+			EventuallyWithOffset(1, func() error { return w.(http.Pusher).Push(target, opts) }).Should(Succeed())
+		}
+
+		// sendRequest sends a GET request for the path
+		sendRequest := func(sess quic.Session, path string) quic.Stream {
+			str, err := sess.OpenStreamSync()
+			ExpectWithOffset(1, err).ToNot(HaveOccurred())
+			headerBlock := &bytes.Buffer{}
+			enc := qpack.NewEncoder(headerBlock)
+			enc.WriteField(qpack.HeaderField{Name: ":method", Value: "GET"})
+			enc.WriteField(qpack.HeaderField{Name: ":scheme", Value: "https"})
+			enc.WriteField(qpack.HeaderField{Name: ":authority", Value: testServerName})
+			enc.WriteField(qpack.HeaderField{Name: ":path", Value: path})
+			ExpectWithOffset(1, enc.Close()).To(Succeed())
+			b := &bytes.Buffer{}
+			(&headersFrame{Length: uint64(headerBlock.Len())}).Write(b)
+			b.Write(headerBlock.Bytes())
+			_, err = str.Write(b.Bytes())
+			ExpectWithOffset(1, err).ToNot(HaveOccurred())
+			ExpectWithOffset(1, str.Close()).To(Succeed())
+			return str
+		}
+
+		// readPushPromise reads a PUSH_PROMISE frame, and decodes the field section
+		readPushPromise := func(r io.Reader) (uint64, map[string][]string) {
+			frame, err := parseNextFrame(r)
+			ExpectWithOffset(1, err).ToNot(HaveOccurred())
+			ExpectWithOffset(1, frame).To(BeAssignableToTypeOf(&pushPromiseFrame{}))
+			pp := frame.(*pushPromiseFrame)
+			headerBlock := make([]byte, pp.Length)
+			_, err = io.ReadFull(r, headerBlock)
+			ExpectWithOffset(1, err).ToNot(HaveOccurred())
+			fields, err := qpack.NewDecoder().DecodeFull(headerBlock)
+			ExpectWithOffset(1, err).ToNot(HaveOccurred())
+			headers := make(map[string][]string)
+			for _, f := range fields {
+				headers[f.Name] = append(headers[f.Name], f.Value)
+			}
+			return pp.PushID, headers
+		}
+
+		// acceptPushStream accepts the next push stream, skipping the control and QPACK streams
+		acceptPushStream := func(sess quic.Session) (uint64, quic.ReceiveStream) {
+			for {
+				str, err := sess.AcceptUniStream()
+				ExpectWithOffset(1, err).ToNot(HaveOccurred())
+				t, err := utils.ReadVarInt(&byteReader{Reader: str})
+				ExpectWithOffset(1, err).ToNot(HaveOccurred())
+				if t != streamTypePush {
+					continue
+				}
+				pushID, err := utils.ReadVarInt(&byteReader{Reader: str})
+				ExpectWithOffset(1, err).ToNot(HaveOccurred())
+				return pushID, str
+			}
+		}
+
+		It("pushes responses", func() {
+			mux.HandleFunc("/index.html", func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				push(w, "/style.css", &http.PushOptions{Header: http.Header{"Foo": []string{"bar"}}})
+				w.Write([]byte("index"))
+			})
+			mux.HandleFunc("/style.css", func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Method).To(Equal("GET"))
+				Expect(r.Host).To(Equal(testServerName))
+				Expect(r.Header.Get("Foo")).To(Equal("bar"))
+				Expect(r.RemoteAddr).ToNot(BeEmpty())
+				Expect(w.(http.Pusher).Push("/foo", nil)).To(MatchError(errRecursivePush))
+				w.Write([]byte("style"))
+			})
+			sess, _ := dialPush(10)
+			str := sendRequest(sess, "/index.html")
+			pushID, headers := readPushPromise(str)
+			Expect(pushID).To(BeZero())
+			Expect(headers).To(HaveKeyWithValue(":method", []string{"GET"}))
+			Expect(headers).To(HaveKeyWithValue(":scheme", []string{"https"}))
+			Expect(headers).To(HaveKeyWithValue(":authority", []string{testServerName}))
+			Expect(headers).To(HaveKeyWithValue(":path", []string{"/style.css"}))
+			Expect(headers).To(HaveKeyWithValue("foo", []string{"bar"}))
+			Expect(readHeaders(str)).To(HaveKeyWithValue(":status", []string{"200"}))
+			Expect(readData(str)).To(Equal([]byte("index")))
+
+			pushID, pushStr := acceptPushStream(sess)
+			Expect(pushID).To(BeZero())
+			Expect(readHeaders(pushStr)).To(HaveKeyWithValue(":status", []string{"200"}))
+			Expect(readData(pushStr)).To(Equal([]byte("style")))
+			sess.Close(nil)
+		})
+
+		It("uses consecutive push IDs, up to the maximum push ID", func() {
+			mux.HandleFunc("/index.html", func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				push(w, "/foo", nil)
+				push(w, "https://"+testServerName+"/bar", &http.PushOptions{Method: http.MethodHead})
+				Expect(w.(http.Pusher).Push("/baz", nil)).To(MatchError(http.ErrNotSupported))
+			})
+			sess, _ := dialPush(1)
+			str := sendRequest(sess, "/index.html")
+			pushID, headers := readPushPromise(str)
+			Expect(pushID).To(BeEquivalentTo(0))
+			Expect(headers).To(HaveKeyWithValue(":path", []string{"/foo"}))
+			pushID, headers = readPushPromise(str)
+			Expect(pushID).To(BeEquivalentTo(1))
+			Expect(headers).To(HaveKeyWithValue(":method", []string{"HEAD"}))
+			Expect(headers).To(HaveKeyWithValue(":path", []string{"/bar"}))
+			Expect(readHeaders(str)).To(HaveKeyWithValue(":status", []string{"200"}))
+			sess.Close(nil)
+		})
+
+		It("doesn't push if the client didn't send a MAX_PUSH_ID frame", func() {
+			errChan := make(chan error, 1)
+			mux.HandleFunc("/index.html", func(w http.ResponseWriter, r *http.Request) {
+				errChan <- w.(http.Pusher).Push("/style.css", nil)
+			})
+			rsp, err := rt.RoundTrip(httptest.NewRequest("GET", "https://"+addr+"/index.html", nil))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(errChan).To(Receive(Equal(http.ErrNotSupported)))
+		})
+
+		It("rejects invalid push requests", func() {
+			done := make(chan struct{})
+			mux.HandleFunc("/index.html", func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				defer close(done)
+				pusher := w.(http.Pusher)
+				Expect(pusher.Push("/foo", &http.PushOptions{Method: http.MethodPost})).To(MatchError(`http3: method "POST" must be GET or HEAD`))
+				Expect(pusher.Push("foo", nil)).To(MatchError(`http3: target must be an absolute URL or an absolute path: "foo"`))
+				Expect(pusher.Push("http://"+testServerName+"/foo", nil)).To(MatchError(`http3: cannot push URL with scheme "http"`))
+				Expect(pusher.Push("https:///foo", nil)).To(MatchError("http3: URL must have a host"))
+				Expect(pusher.Push("/foo", &http.PushOptions{Header: http.Header{"Content-Length": []string{"42"}}})).To(MatchError(`http3: promised request headers cannot include "Content-Length"`))
+				Expect(pusher.Push("/foo", &http.PushOptions{Header: http.Header{":path": []string{"/bar"}}})).To(MatchError(`http3: promised request headers cannot include pseudo header ":path"`))
+			})
+			sess, _ := dialPush(10)
+			str := sendRequest(sess, "/index.html")
+			Eventually(done).Should(BeClosed())
+			Expect(readHeaders(str)).To(HaveKeyWithValue(":status", []string{"200"}))
+			sess.Close(nil)
+		})
+
+		It("cancels pushes when the client sends a CANCEL_PUSH frame", func() {
+			pushCanceled := make(chan struct{})
+			mux.HandleFunc("/index.html", func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				push(w, "/style.css", nil)
+			})
+			mux.HandleFunc("/style.css", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("style"))
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+				close(pushCanceled)
+			})
+			sess, ctrl := dialPush(10)
+			str := sendRequest(sess, "/index.html")
+			pushID, _ := readPushPromise(str)
+			_, pushStr := acceptPushStream(sess)
+			Expect(readHeaders(pushStr)).To(HaveKeyWithValue(":status", []string{"200"}))
+			b := &bytes.Buffer{}
+			(&cancelPushFrame{PushID: pushID}).Write(b)
+			_, err := ctrl.Write(b.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(pushCanceled).Should(BeClosed())
+			_, err = ioutil.ReadAll(pushStr)
+			Expect(err).To(HaveOccurred())
+			Expect(err.(quic.StreamError).ErrorCode()).To(BeEquivalentTo(errorRequestCanceled))
+			sess.Close(nil)
+		})
+
+		It("closes the connection if the client cancels a push that wasn't promised", func() {
+			sess, ctrl := dialPush(10)
+			b := &bytes.Buffer{}
+			(&cancelPushFrame{PushID: 0}).Write(b)
+			_, err := ctrl.Write(b.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			expectSessionClosedWithError(sess, errorIDError)
+		})
+
+		It("closes the connection if the client reduces the maximum push ID", func() {
+			sess, ctrl := dialPush(10)
+			b := &bytes.Buffer{}
+			(&maxPushIDFrame{PushID: 9}).Write(b)
+			_, err := ctrl.Write(b.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			expectSessionClosedWithError(sess, errorIDError)
+		})
+	})
+
+	It("tells the client to stop sending the body if the handler doesn't read it", func() {
+		mux.HandleFunc("/ignore", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ignored"))
+		})
+		// the body doesn't end until the pipe is closed
+		pr, pw := io.Pipe()
+		go pw.Write([]byte("foobar"))
+		rsp, err := (&http.Client{Transport: rt}).Post("https://"+addr+"/ignore", "text/plain", pr)
+		Expect(err).ToNot(HaveOccurred())
+		body, err := ioutil.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(Equal("ignored"))
+		pw.Close()
+	})
+
+	Context("trailers", func() {
+		It("reads the request trailers", func() {
+			trailers := make(chan http.Header, 1)
+			mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Trailer).To(Equal(http.Header{"Foo": nil}))
+				body, err := ioutil.ReadAll(r.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(Equal("foobar"))
+				trailers <- r.Trailer
+			})
+			req, err := http.NewRequest("POST", "https://"+addr+"/upload", bytes.NewReader([]byte("foobar")))
+			Expect(err).ToNot(HaveOccurred())
+			req.Trailer = http.Header{"Foo": {"bar"}}
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Eventually(trailers).Should(Receive(Equal(http.Header{"Foo": {"bar"}})))
+		})
+
+		It("sends the response trailers", func() {
+			mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Trailer", "Grpc-Status")
+				w.Write([]byte("Hello, World!"))
+				w.Header().Set("Grpc-Status", "0")
+				w.Header().Set(http.TrailerPrefix+"Grpc-Message", "foobar")
+			})
+			rsp, err := (&http.Client{Transport: rt}).Get("https://" + addr + "/hello")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Header).ToNot(HaveKey("Trailer"))
+			Expect(rsp.Trailer).To(Equal(http.Header{"Grpc-Status": nil}))
+			body, err := ioutil.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal("Hello, World!"))
+			Expect(rsp.Trailer).To(Equal(http.Header{
+				"Grpc-Status":  {"0"},
+				"Grpc-Message": {"foobar"},
+			}))
+		})
+	})
+
+	Context("graceful shutdown", func() {
+		// writeRequest writes a GET request for the path on str
+		writeRequest := func(str quic.Stream, path string) {
+			headerBlock := &bytes.Buffer{}
+			enc := qpack.NewEncoder(headerBlock)
+			Expect(enc.WriteField(qpack.HeaderField{Name: ":method", Value: "GET"})).To(Succeed())
+			Expect(enc.WriteField(qpack.HeaderField{Name: ":scheme", Value: "https"})).To(Succeed())
+			Expect(enc.WriteField(qpack.HeaderField{Name: ":authority", Value: "localhost"})).To(Succeed())
+			Expect(enc.WriteField(qpack.HeaderField{Name: ":path", Value: path})).To(Succeed())
+			Expect(enc.Close()).To(Succeed())
+			b := &bytes.Buffer{}
+			(&headersFrame{Length: uint64(headerBlock.Len())}).Write(b)
+			b.Write(headerBlock.Bytes())
+			_, err := str.Write(b.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		// acceptControlStream accepts the server's control stream, and reads the SETTINGS frame
+		acceptControlStream := func(sess quic.Session) quic.ReceiveStream {
+			for {
+				str, err := sess.AcceptUniStream()
+				Expect(err).ToNot(HaveOccurred())
+				t, err := utils.ReadVarInt(&byteReader{Reader: str})
+				Expect(err).ToNot(HaveOccurred())
+				if t != streamTypeControl {
+					continue
+				}
+				f, err := parseNextFrame(str)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(f).To(BeAssignableToTypeOf(&settingsFrame{}))
+				return str
+			}
+		}
+
+		It("waits for requests in flight, and sends a GOAWAY frame", func() {
+			data := make([]byte, 5*requestBodyFrameSize/2)
+			for i := range data {
+				data[i] = byte(i)
+			}
+			handlerStarted := make(chan struct{})
+			unblockHandler := make(chan struct{})
+			mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+				close(handlerStarted)
+				<-unblockHandler
+				w.Write(data)
+			})
+			rspChan := make(chan *http.Response, 1)
+			go func() {
+				defer GinkgoRecover()
+				rsp, err := (&http.Client{Transport: rt}).Get("https://" + addr + "/slow")
+				Expect(err).ToNot(HaveOccurred())
+				rspChan <- rsp
+			}()
+			Eventually(handlerStarted).Should(BeClosed())
+			shutdownErr := make(chan error, 1)
+			go func() { shutdownErr <- s.Shutdown(context.Background()) }()
+			cl, err := rt.getClient(addr, true)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(cl.(*client).isGoingAway).Should(BeTrue())
+			Consistently(shutdownErr).ShouldNot(Receive())
+			close(unblockHandler)
+			var rsp *http.Response
+			Eventually(rspChan).Should(Receive(&rsp))
+			body, err := ioutil.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(body).To(Equal(data))
+			Eventually(shutdownErr).Should(Receive(BeNil()))
+		})
+
+		It("rejects requests opened after the GOAWAY frame", func() {
+			handlerStarted := make(chan struct{})
+			unblockHandler := make(chan struct{})
+			mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+				close(handlerStarted)
+				<-unblockHandler
+				w.Write([]byte("foobar"))
+			})
+			sess := dialRaw(addr)
+			openControlStream(sess)
+			ctrl := acceptControlStream(sess)
+			str, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			writeRequest(str, "/slow")
+			Eventually(handlerStarted).Should(BeClosed())
+			shutdownErr := make(chan error, 1)
+			go func() { shutdownErr <- s.Shutdown(context.Background()) }()
+			f, err := parseNextFrame(ctrl)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f).To(Equal(&goAwayFrame{ID: uint64(str.StreamID()) + 4}))
+			// This request is not processed, since it was opened after the GOAWAY frame.
+			str2, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			writeRequest(str2, "/slow")
+			_, err = str2.Read([]byte{0})
+			Expect(err).To(HaveOccurred())
+			Expect(err.(quic.StreamError).ErrorCode()).To(BeEquivalentTo(errorRequestRejected))
+			// The first request is still served.
+			close(unblockHandler)
+			Expect(readHeaders(str)).To(HaveKeyWithValue(":status", []string{"200"}))
+			Expect(readData(str)).To(Equal([]byte("foobar")))
+			// Once the response was acknowledged, the server closes the connection.
+			expectSessionClosedWithError(sess, errorNoError)
+			Eventually(shutdownErr).Should(Receive(BeNil()))
+		})
+
+		It("closes the connections when the context expires", func() {
+			handlerStarted := make(chan struct{})
+			mux.HandleFunc("/hang", func(w http.ResponseWriter, r *http.Request) {
+				close(handlerStarted)
+				<-r.Context().Done()
+			})
+			errChan := make(chan error, 1)
+			go func() {
+				_, err := (&http.Client{Transport: rt}).Get("https://" + addr + "/hang")
+				errChan <- err
+			}()
+			Eventually(handlerStarted).Should(BeClosed())
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			Expect(s.Shutdown(ctx)).To(MatchError(context.DeadlineExceeded))
+			Eventually(errChan).Should(Receive(HaveOccurred()))
+		})
+
+		It("closes new connections", func() {
+			handlerStarted := make(chan struct{})
+			unblockHandler := make(chan struct{})
+			mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+				close(handlerStarted)
+				<-unblockHandler
+			})
+			go func() {
+				defer GinkgoRecover()
+				rsp, err := (&http.Client{Transport: rt}).Get("https://" + addr + "/slow")
+				Expect(err).ToNot(HaveOccurred())
+				rsp.Body.Close()
+			}()
+			Eventually(handlerStarted).Should(BeClosed())
+			shutdownErr := make(chan error, 1)
+			go func() { shutdownErr <- s.Shutdown(context.Background()) }()
+			Eventually(func() bool {
+				s.connMutex.Lock()
+				defer s.connMutex.Unlock()
+				return s.shuttingDown
+			}).Should(BeTrue())
+			sess := dialRaw(addr)
+			expectSessionClosedWithError(sess, errorNoError)
+			close(unblockHandler)
+			Eventually(shutdownErr).Should(Receive(BeNil()))
+		})
+	})
+
+	Context("canceling requests", func() {
+		// writeRequestHeaders writes the HEADERS frame of a POST request for the path on str
+		writeRequestHeaders := func(str quic.Stream, path string) {
+			headerBlock := &bytes.Buffer{}
+			enc := qpack.NewEncoder(headerBlock)
+			Expect(enc.WriteField(qpack.HeaderField{Name: ":method", Value: "POST"})).To(Succeed())
+			Expect(enc.WriteField(qpack.HeaderField{Name: ":scheme", Value: "https"})).To(Succeed())
+			Expect(enc.WriteField(qpack.HeaderField{Name: ":authority", Value: "localhost"})).To(Succeed())
+			Expect(enc.WriteField(qpack.HeaderField{Name: ":path", Value: path})).To(Succeed())
+			Expect(enc.Close()).To(Succeed())
+			b := &bytes.Buffer{}
+			(&headersFrame{Length: uint64(headerBlock.Len())}).Write(b)
+			b.Write(headerBlock.Bytes())
+			_, err := str.Write(b.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		It("cancels the request context and resets the stream when the client stops reading the response", func() {
+			handlerStarted := make(chan struct{})
+			ctxErr := make(chan error, 1)
+			mux.HandleFunc("/hang", func(w http.ResponseWriter, r *http.Request) {
+				close(handlerStarted)
+				<-r.Context().Done()
+				ctxErr <- r.Context().Err()
+			})
+			sess := dialRaw(addr)
+			openControlStream(sess)
+			str, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			writeRequestHeaders(str, "/hang")
+			Eventually(handlerStarted).Should(BeClosed())
+			str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+			// The stream context is canceled with the error that the stream was reset with.
+			Eventually(ctxErr).Should(Receive(&err))
+			Expect(err.(quic.StreamError).ErrorCode()).To(BeEquivalentTo(errorRequestCanceled))
+			// The server tells us to stop sending the request body.
+			Eventually(func() error {
+				_, err := str.Write([]byte("foobar"))
+				return err
+			}).Should(HaveOccurred())
+			_, err = str.Write([]byte("foobar"))
+			Expect(err.(quic.StreamError).ErrorCode()).To(BeEquivalentTo(errorRequestCanceled))
+			sess.Close(nil)
+		})
+
+		It("cancels the request context and resets the stream when the client resets the request body", func() {
+			readErr := make(chan error, 1)
+			ctxErr := make(chan error, 1)
+			handlerStarted := make(chan struct{})
+			mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+				close(handlerStarted)
+				_, err := ioutil.ReadAll(r.Body)
+				readErr <- err
+				<-r.Context().Done()
+				ctxErr <- r.Context().Err()
+			})
+			sess := dialRaw(addr)
+			openControlStream(sess)
+			str, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			writeRequestHeaders(str, "/upload")
+			b := &bytes.Buffer{}
+			(&dataFrame{Length: 6}).Write(b)
+			b.WriteString("foo")
+			_, err = str.Write(b.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			// Data that wasn't sent yet is discarded when the stream is reset.
+			Eventually(handlerStarted).Should(BeClosed())
+			str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+			Eventually(readErr).Should(Receive(&err))
+			Expect(err.(quic.StreamError).ErrorCode()).To(BeEquivalentTo(errorRequestCanceled))
+			Eventually(ctxErr).Should(Receive(&err))
+			Expect(err.(quic.StreamError).ErrorCode()).To(BeEquivalentTo(errorRequestCanceled))
+			// The server resets the response stream.
+			_, err = str.Read([]byte{0})
+			Expect(err).To(HaveOccurred())
+			Expect(err.(quic.StreamError).ErrorCode()).To(BeEquivalentTo(errorRequestCanceled))
+			sess.Close(nil)
+		})
+
+		It("cancels the request context when the handler returns", func() {
+			ctxChan := make(chan context.Context, 1)
+			mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+				ctxChan <- r.Context()
+				w.Write([]byte("foobar"))
+			})
+			rsp, err := (&http.Client{Transport: rt}).Get("https://" + addr + "/hello")
+			Expect(err).ToNot(HaveOccurred())
+			body, err := ioutil.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal("foobar"))
+			var ctx context.Context
+			Eventually(ctxChan).Should(Receive(&ctx))
+			Eventually(ctx.Done()).Should(BeClosed())
+		})
+	})
+
+	Context("violations of the protocol", func() {
+		It("sends its SETTINGS on the control stream", func() {
+			s.MaxHeaderBytes = 1337
+			sess := dialRaw(addr)
+			str, err := sess.AcceptUniStream()
+			Expect(err).ToNot(HaveOccurred())
+			t, err := utils.ReadVarInt(&byteReader{Reader: str})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(t).To(BeEquivalentTo(streamTypeControl))
+			f, err := parseNextFrame(str)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f).To(Equal(&settingsFrame{settings: map[uint64]uint64{
+				settingMaxFieldSectionSize:   1337,
+				settingQPACKMaxTableCapacity: 4096,
+				settingQPACKBlockedStreams:   16,
+			}}))
+			sess.Close(nil)
+		})
+
+		It("closes the connection if the first frame on the control stream is not a SETTINGS frame", func() {
+			sess := dialRaw(addr)
+			str, err := sess.OpenUniStream()
+			Expect(err).ToNot(HaveOccurred())
+			b := &bytes.Buffer{}
+			utils.WriteVarInt(b, streamTypeControl)
+			(&goAwayFrame{ID: 0}).Write(b)
+			_, err = str.Write(b.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			expectSessionClosedWithError(sess, errorMissingSettings)
+		})
+
+		It("closes the connection if the client opens a second control stream", func() {
+			sess := dialRaw(addr)
+			openControlStream(sess)
+			openControlStream(sess)
+			expectSessionClosedWithError(sess, errorStreamCreationError)
+		})
+
+		It("closes the connection if the client closes the control stream", func() {
+			sess := dialRaw(addr)
+			str := openControlStream(sess)
+			Expect(str.Close()).To(Succeed())
+			expectSessionClosedWithError(sess, errorClosedCriticalStream)
+		})
+
+		It("closes the connection if the client sends an invalid instruction on the QPACK encoder stream", func() {
+			sess := dialRaw(addr)
+			openControlStream(sess)
+			str, err := sess.OpenUniStream()
+			Expect(err).ToNot(HaveOccurred())
+			// Set Dynamic Table Capacity, exceeding the maximum table capacity of 4096
+			_, err = str.Write([]byte{streamTypeQPACKEncoder, 0x3f, 0xe2, 0x1f})
+			Expect(err).ToNot(HaveOccurred())
+			expectSessionClosedWithError(sess, errorQPACKEncoderStreamError)
+		})
+
+		It("closes the connection if the client sends an invalid instruction on the QPACK decoder stream", func() {
+			sess := dialRaw(addr)
+			openControlStream(sess)
+			str, err := sess.OpenUniStream()
+			Expect(err).ToNot(HaveOccurred())
+			// Insert Count Increment of 0
+			_, err = str.Write([]byte{streamTypeQPACKDecoder, 0x00})
+			Expect(err).ToNot(HaveOccurred())
+			expectSessionClosedWithError(sess, errorQPACKDecoderStreamError)
+		})
+
+		It("closes the connection if the client closes a QPACK stream", func() {
+			sess := dialRaw(addr)
+			openControlStream(sess)
+			str, err := sess.OpenUniStream()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Write([]byte{streamTypeQPACKEncoder})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.Close()).To(Succeed())
+			expectSessionClosedWithError(sess, errorClosedCriticalStream)
+		})
+
+		It("closes the connection if the client opens a push stream", func() {
+			sess := dialRaw(addr)
+			openControlStream(sess)
+			str, err := sess.OpenUniStream()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Write([]byte{streamTypePush})
+			Expect(err).ToNot(HaveOccurred())
+			expectSessionClosedWithError(sess, errorStreamCreationError)
+		})
+
+		It("closes the connection if the first frame on a request stream is not a HEADERS frame", func() {
+			sess := dialRaw(addr)
+			openControlStream(sess)
+			str, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			b := &bytes.Buffer{}
+			(&dataFrame{Length: 3}).Write(b)
+			b.WriteString("foo")
+			_, err = str.Write(b.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			expectSessionClosedWithError(sess, errorFrameUnexpected)
+		})
+
+		It("closes the connection if the client uses a reserved frame type", func() {
+			sess := dialRaw(addr)
+			openControlStream(sess)
+			str, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Write([]byte{0x2, 0x0}) // an HTTP/2 PRIORITY frame
+			Expect(err).ToNot(HaveOccurred())
+			expectSessionClosedWithError(sess, errorFrameUnexpected)
+		})
+
+		It("closes the connection if the field section can't be decoded", func() {
+			sess := dialRaw(addr)
+			openControlStream(sess)
+			str, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			b := &bytes.Buffer{}
+			(&headersFrame{Length: 3}).Write(b)
+			b.Write([]byte{0, 0, 0xff}) // an Indexed Field Line with a truncated index
+			_, err = str.Write(b.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			expectSessionClosedWithError(sess, errorQPACKDecompressionFailed)
+		})
+
+		It("resets the stream if the HEADERS frame is too large", func() {
+			s.MaxHeaderBytes = 100
+			sess := dialRaw(addr)
+			openControlStream(sess)
+			str, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			b := &bytes.Buffer{}
+			(&headersFrame{Length: 101}).Write(b)
+			_, err = str.Write(b.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Read([]byte{0})
+			Expect(err).To(HaveOccurred())
+			Expect(err.(quic.StreamError).ErrorCode()).To(BeEquivalentTo(errorExcessiveLoad))
+			sess.Close(nil)
+		})
+
+		It("resets the stream if the decoded field section is too large", func() {
+			s.MaxHeaderBytes = 100
+			sess := dialRaw(addr)
+			openControlStream(sess)
+			str, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			// 10 Indexed Field Lines referencing ":method: GET" in the static table, 42 bytes each
+			headerBlock := []byte{0, 0}
+			for i := 0; i < 10; i++ {
+				headerBlock = append(headerBlock, 0xc0|17)
+			}
+			b := &bytes.Buffer{}
+			(&headersFrame{Length: uint64(len(headerBlock))}).Write(b)
+			b.Write(headerBlock)
+			_, err = str.Write(b.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Read([]byte{0})
+			Expect(err).To(HaveOccurred())
+			Expect(err.(quic.StreamError).ErrorCode()).To(BeEquivalentTo(errorExcessiveLoad))
+			sess.Close(nil)
+		})
+
+		It("resets the stream if the request is malformed", func() {
+			sess := dialRaw(addr)
+			openControlStream(sess)
+			str, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			// the :path and the :authority are missing
+			headerBlock := &bytes.Buffer{}
+			enc := qpack.NewEncoder(headerBlock)
+			Expect(enc.WriteField(qpack.HeaderField{Name: ":method", Value: "GET"})).To(Succeed())
+			Expect(enc.Close()).To(Succeed())
+			b := &bytes.Buffer{}
+			(&headersFrame{Length: uint64(headerBlock.Len())}).Write(b)
+			b.Write(headerBlock.Bytes())
+			_, err = str.Write(b.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Read([]byte{0})
+			Expect(err).To(HaveOccurred())
+			Expect(err.(quic.StreamError).ErrorCode()).To(BeEquivalentTo(errorMessageError))
+			sess.Close(nil)
+		})
+
+		It("rejects trailers that contain pseudo-header fields", func() {
+			errChan := make(chan error, 1)
+			mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+				_, err := ioutil.ReadAll(r.Body)
+				errChan <- err
+			})
+			sess := dialRaw(addr)
+			openControlStream(sess)
+			str, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			writeFieldSection := func(b *bytes.Buffer, fields ...qpack.HeaderField) {
+				headerBlock := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBlock)
+				for _, f := range fields {
+					Expect(enc.WriteField(f)).To(Succeed())
+				}
+				Expect(enc.Close()).To(Succeed())
+				(&headersFrame{Length: uint64(headerBlock.Len())}).Write(b)
+				b.Write(headerBlock.Bytes())
+			}
+			b := &bytes.Buffer{}
+			writeFieldSection(b,
+				qpack.HeaderField{Name: ":method", Value: "POST"},
+				qpack.HeaderField{Name: ":scheme", Value: "https"},
+				qpack.HeaderField{Name: ":authority", Value: "localhost"},
+				qpack.HeaderField{Name: ":path", Value: "/upload"},
+			)
+			(&dataFrame{Length: 6}).Write(b)
+			b.WriteString("foobar")
+			writeFieldSection(b, qpack.HeaderField{Name: ":path", Value: "/foo"})
+			_, err = str.Write(b.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(errChan).Should(Receive(MatchError("http3: pseudo-header field in trailers")))
+			sess.Close(nil)
+		})
+	})
+})
+
+var _ = Describe("Server setup", func() {
+	var s *Server
+
+	BeforeEach(func() {
+		s = &Server{
+			Server: &http.Server{
+				TLSConfig: testdata.GetTLSConfig(),
+			},
+		}
+	})
+
+	It("errors when used without an http.Server", func() {
+		s = &Server{}
+		Expect(s.ListenAndServe()).To(MatchError("use of http3.Server without http.Server"))
+	})
+
+	It("errors if the server was already closed", func() {
+		Expect(s.Close()).To(Succeed())
+		Expect(s.Serve(nil)).To(MatchError("Server is already closed"))
+	})
+
+	It("only serves once", func() {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			s.Serve(conn)
+		}()
+		Eventually(func() quic.Listener {
+			s.listenerMutex.Lock()
+			defer s.listenerMutex.Unlock()
+			return s.listener
+		}).ShouldNot(BeNil())
+		Expect(s.Serve(conn)).To(MatchError("ListenAndServe may only be called once"))
+		Expect(s.Close()).To(Succeed())
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("uses IETF QUIC, and negotiates h3", func() {
+		var tlsConf *tls.Config
+		var quicConf *quic.Config
+		origQuicListenAddr := quicListenAddr
+		defer func() { quicListenAddr = origQuicListenAddr }()
+		quicListenAddr = func(addr string, tlsc *tls.Config, qc *quic.Config) (quic.Listener, error) {
+			tlsConf = tlsc
+			quicConf = qc
+			return nil, io.EOF
+		}
+		s.QuicConfig = &quic.Config{
+			Versions:    []quic.VersionNumber{protocol.Version39},
+			IdleTimeout: 42 * time.Second,
+		}
+		Expect(s.ListenAndServe()).To(MatchError(io.EOF))
+		Expect(tlsConf.NextProtos).To(Equal([]string{"h3"}))
+		Expect(tlsConf.Certificates).To(Equal(s.TLSConfig.Certificates))
+		Expect(s.TLSConfig.NextProtos).To(BeEmpty())
+		Expect(quicConf.Versions).To(Equal([]quic.VersionNumber{protocol.VersionTLS}))
+		Expect(quicConf.IdleTimeout).To(Equal(42 * time.Second))
+		Expect(s.QuicConfig.Versions).To(Equal([]quic.VersionNumber{protocol.Version39}))
+	})
+
+	Context("setting the Alt-Svc header", func() {
+		It("sets the header", func() {
+			s.Server.Addr = "localhost:443"
+			hdr := http.Header{}
+			Expect(s.SetQuicHeaders(hdr)).To(Succeed())
+			Expect(hdr).To(Equal(http.Header{"Alt-Svc": {`h3=":443"; ma=2592000`}}))
+		})
+
+		It("errors if the port can't be determined", func() {
+			s.Server.Addr = "localhost"
+			Expect(s.SetQuicHeaders(http.Header{})).ToNot(Succeed())
+		})
+
+		It("uses the port that the server listens on", func() {
+			s.Server.Addr = "localhost:0"
+			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+			Expect(err).ToNot(HaveOccurred())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				s.Serve(conn)
+			}()
+			port := conn.LocalAddr().(*net.UDPAddr).Port
+			Eventually(func() http.Header {
+				hdr := http.Header{}
+				s.SetQuicHeaders(hdr)
+				return hdr
+			}).Should(Equal(http.Header{"Alt-Svc": {fmt.Sprintf(`h3=":%d"; ma=2592000`, port)}}))
+			Expect(s.Close()).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+	})
+})
+
+var _ = Describe("Serving over TCP and QUIC", func() {
+	It("serves the same handler over TCP and QUIC", func() {
+		// find a free port
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		addr := conn.LocalAddr().String()
+		port := conn.LocalAddr().(*net.UDPAddr).Port
+		Expect(conn.Close()).To(Succeed())
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/proto", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto))
+		})
+		go func() {
+			defer GinkgoRecover()
+			certFile, keyFile := testdata.GetCertificatePaths()
+			ListenAndServe(addr, certFile, keyFile, mux)
+		}()
+
+		tr := &http.Transport{TLSClientConfig: getClientTLSConfig()}
+		Expect(http2.ConfigureTransport(tr)).To(Succeed())
+		defer tr.CloseIdleConnections()
+		var rsp *http.Response
+		Eventually(func() error {
+			var err error
+			rsp, err = (&http.Client{Transport: tr}).Get("https://" + addr + "/proto")
+			return err
+		}).Should(Succeed())
+		Expect(rsp.Header.Get("Alt-Svc")).To(Equal(fmt.Sprintf(`h3=":%d"; ma=2592000`, port)))
+		body, err := ioutil.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(Equal("HTTP/2.0"))
+
+		rt := &RoundTripper{TLSClientConfig: getClientTLSConfig()}
+		defer rt.Close()
+		rsp, err = (&http.Client{Transport: rt}).Get("https://" + addr + "/proto")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.Header).ToNot(HaveKey("Alt-Svc"))
+		body, err = ioutil.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(Equal("HTTP/3.0"))
+	})
+
+	It("errors if the certificate can't be loaded", func() {
+		Expect(ListenAndServe("localhost:0", "foo.crt", "foo.key", nil)).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,61 @@
+package http3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/net/http/httpguts"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3/qpack"
+)
+
+// readTrailers reads the field section of the trailers, which is sent in a HEADERS frame after the body, see Section 4.1 of RFC 9114.
+// The trailers are added to trailer, which is created if the peer didn't announce any trailers in the Trailer header.
+// Fields that are not allowed in trailers are ignored.
+func (c *connection) readTrailers(ctx context.Context, str quic.Stream, f *headersFrame, maxSize uint64, trailer *http.Header) error {
+	if f.Length > maxSize {
+		str.CancelRead(quic.ErrorCode(errorExcessiveLoad))
+		return fmt.Errorf("http3: HEADERS frame too large (%d bytes)", f.Length)
+	}
+	headerBlock := make([]byte, f.Length)
+	if _, err := io.ReadFull(str, headerBlock); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return &connectionError{code: errorFrameError, reason: "stream ended within a frame"}
+		}
+		return err
+	}
+	fields, err := c.decoder.DecodeFieldSection(ctx, uint64(str.StreamID()), headerBlock, maxSize)
+	if err != nil {
+		if ctx.Err() != nil {
+			// The stream was canceled while the field section was blocked.
+			return err
+		}
+		if err == qpack.ErrFieldSectionTooLarge {
+			str.CancelRead(quic.ErrorCode(errorExcessiveLoad))
+			return errors.New("http3: trailers too large")
+		}
+		return &connectionError{code: errorQPACKDecompressionFailed, reason: err.Error()}
+	}
+	for _, hf := range fields {
+		if hf.IsPseudo() {
+			// Pseudo-header fields must not appear in trailers, see Section 4.3 of RFC 9114.
+			str.CancelRead(quic.ErrorCode(errorMessageError))
+			return errors.New("http3: pseudo-header field in trailers")
+		}
+	}
+	if *trailer == nil {
+		*trailer = make(http.Header)
+	}
+	for _, hf := range fields {
+		key := http.CanonicalHeaderKey(hf.Name)
+		if !httpguts.ValidTrailerHeader(key) {
+			continue
+		}
+		(*trailer)[key] = append((*trailer)[key], hf.Value)
+	}
+	return nil
+}
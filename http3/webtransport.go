@@ -0,0 +1,748 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// webTransportProtocol is the value of the :protocol pseudo-header of the Extended CONNECT request establishing a WebTransport session
+const webTransportProtocol = "webtransport"
+
+// maxCloseMessageLength is the maximum length of the error message of a CLOSE_WEBTRANSPORT_SESSION capsule
+const maxCloseMessageLength = 1024
+
+const (
+	// maxPendingWebTransportSessions is the maximum number of sessions that streams are buffered for,
+	// before the request establishing the session is handled.
+	maxPendingWebTransportSessions = 16
+	// maxBufferedWebTransportStreams is the maximum number of streams buffered for a single pending session.
+	maxBufferedWebTransportStreams = 16
+	// maxQueuedWebTransportDatagrams is the maximum number of datagrams queued for a session.
+	// Datagrams that arrive when the queue is full are dropped.
+	maxQueuedWebTransportDatagrams = 32
+	// maxWebTransportDatagramSize is the maximum size of a datagram, which is the maximum size of a UDP payload.
+	maxWebTransportDatagramSize = maxUDPPayloadSize
+)
+
+// A WebTransportSessionError is returned by the methods of a WebTransportSession after the session was closed,
+// either by calling CloseWithError, or by the client.
+type WebTransportSessionError struct {
+	Remote    bool // if the session was closed by the client
+	ErrorCode uint32
+	Message   string
+}
+
+func (e *WebTransportSessionError) Error() string {
+	closedBy := "locally"
+	if e.Remote {
+		closedBy = "by the client"
+	}
+	return fmt.Sprintf("http3: WebTransport session closed %s (error code %d): %s", closedBy, e.ErrorCode, e.Message)
+}
+
+// A WebTransportSession is a WebTransport session, see draft-ietf-webtrans-http3-02.
+// It is established by an Extended CONNECT request, see UpgradeWebTransport.
+// The streams of the session are multiplexed with the HTTP/3 requests on the same QUIC session.
+// The session is closed when either side closes the CONNECT stream, and all of its streams are reset.
+// Datagrams are sent in DATAGRAM capsules on the CONNECT stream, since the QUIC layer doesn't support the DATAGRAM frame yet.
+// The QUIC layer only supports 16 bit application error codes, so streams are reset using the HTTP/3 error codes.
+type WebTransportSession struct {
+	id   uint64 // the stream ID of the CONNECT stream
+	conn *connection
+
+	// canceled when the session is closed
+	ctx       context.Context
+	cancelCtx context.CancelFunc
+
+	// set until the request establishing the session was handled, protected by the connection's mutex
+	pending bool
+
+	mutex    sync.Mutex
+	str      quic.Stream // the CONNECT stream, nil until the session is established
+	closeErr error
+	// the streams of the session that are not done yet, see removeStream
+	streams        map[quic.StreamID]quic.Stream
+	receiveStreams map[quic.StreamID]quic.ReceiveStream
+	sendStreams    map[quic.StreamID]quic.SendStream
+
+	acceptQueue     []quic.Stream
+	uniAcceptQueue  []quic.ReceiveStream
+	streamQueued    chan struct{}
+	uniStreamQueued chan struct{}
+
+	datagramQueue  [][]byte
+	datagramQueued chan struct{}
+
+	writeMutex sync.Mutex // serializes the writes to the CONNECT stream
+}
+
+func newWebTransportSession(conn *connection, id uint64) *WebTransportSession {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WebTransportSession{
+		id:              id,
+		conn:            conn,
+		ctx:             ctx,
+		cancelCtx:       cancel,
+		pending:         true,
+		streams:         make(map[quic.StreamID]quic.Stream),
+		receiveStreams:  make(map[quic.StreamID]quic.ReceiveStream),
+		sendStreams:     make(map[quic.StreamID]quic.SendStream),
+		streamQueued:    make(chan struct{}, 1),
+		uniStreamQueued: make(chan struct{}, 1),
+		datagramQueued:  make(chan struct{}, 1),
+	}
+}
+
+// UpgradeWebTransport establishes a WebTransport session for an Extended CONNECT request using the webtransport protocol.
+// It sends a 200 response, and hands the request stream over to the session.
+// The handler must not write a response body, and the session stays open after the handler returns.
+// WebTransport must be enabled on the server, see Server.EnableWebTransport.
+func UpgradeWebTransport(w http.ResponseWriter, r *http.Request) (*WebTransportSession, error) {
+	if r.Method != http.MethodConnect || r.Proto != webTransportProtocol {
+		return nil, errors.New("http3: not a WebTransport request")
+	}
+	rw, ok := w.(*responseWriter)
+	if !ok || rw.requestStream == nil {
+		return nil, errors.New("http3: WebTransport requires a HTTP/3 request")
+	}
+	if rw.headerWritten {
+		return nil, errors.New("http3: response header already written")
+	}
+	// The client's SETTINGS frame might arrive after the request.
+	select {
+	case <-rw.conn.receivedSettings:
+	case <-r.Context().Done():
+		return nil, r.Context().Err()
+	}
+	if val, _ := rw.conn.peerSetting(settingEnableWebTransport); val != 1 {
+		return nil, errors.New("http3: client didn't enable WebTransport")
+	}
+	// From now on, the session controls the request stream.
+	if rw.canceler != nil && rw.canceler.stop() {
+		return nil, errors.New("http3: request canceled")
+	}
+	rw.Header().Set("Sec-Webtransport-Http3-Draft", "draft02")
+	rw.WriteHeader(http.StatusOK)
+	rw.upgraded = true
+	return rw.conn.establishWebTransportSession(rw.requestStream), nil
+}
+
+// Context returns a context that is canceled when the session is closed.
+func (s *WebTransportSession) Context() context.Context {
+	return s.ctx
+}
+
+// AcceptStream returns the next bidirectional stream opened by the client, blocking until one is available.
+func (s *WebTransportSession) AcceptStream(ctx context.Context) (quic.Stream, error) {
+	for {
+		s.mutex.Lock()
+		if len(s.acceptQueue) > 0 {
+			str := s.acceptQueue[0]
+			s.acceptQueue = s.acceptQueue[1:]
+			if len(s.acceptQueue) > 0 {
+				notify(s.streamQueued)
+			}
+			s.mutex.Unlock()
+			return str, nil
+		}
+		err := s.closeErr
+		s.mutex.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		select {
+		case <-s.streamQueued:
+		case <-s.ctx.Done():
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// AcceptUniStream returns the next unidirectional stream opened by the client, blocking until one is available.
+func (s *WebTransportSession) AcceptUniStream(ctx context.Context) (quic.ReceiveStream, error) {
+	for {
+		s.mutex.Lock()
+		if len(s.uniAcceptQueue) > 0 {
+			str := s.uniAcceptQueue[0]
+			s.uniAcceptQueue = s.uniAcceptQueue[1:]
+			if len(s.uniAcceptQueue) > 0 {
+				notify(s.uniStreamQueued)
+			}
+			s.mutex.Unlock()
+			return str, nil
+		}
+		err := s.closeErr
+		s.mutex.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		select {
+		case <-s.uniStreamQueued:
+		case <-s.ctx.Done():
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// OpenStream opens a new bidirectional stream.
+func (s *WebTransportSession) OpenStream() (quic.Stream, error) {
+	return s.openStream(s.conn.session.OpenStream)
+}
+
+// OpenStreamSync opens a new bidirectional stream.
+// It blocks until the client allows opening a new stream.
+func (s *WebTransportSession) OpenStreamSync() (quic.Stream, error) {
+	return s.openStream(s.conn.session.OpenStreamSync)
+}
+
+func (s *WebTransportSession) openStream(open func() (quic.Stream, error)) (quic.Stream, error) {
+	if err := s.closeError(); err != nil {
+		return nil, err
+	}
+	str, err := open()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := str.Write(s.streamHeader(frameTypeWebTransportStream)); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closeErr != nil {
+		cancelStream(str, errorRequestCanceled)
+		return nil, s.closeErr
+	}
+	s.streams[str.StreamID()] = str
+	return &webTransportStream{Stream: str, sess: s}, nil
+}
+
+// OpenUniStream opens a new unidirectional stream.
+func (s *WebTransportSession) OpenUniStream() (quic.SendStream, error) {
+	return s.openUniStream(s.conn.session.OpenUniStream)
+}
+
+// OpenUniStreamSync opens a new unidirectional stream.
+// It blocks until the client allows opening a new stream.
+func (s *WebTransportSession) OpenUniStreamSync() (quic.SendStream, error) {
+	return s.openUniStream(s.conn.session.OpenUniStreamSync)
+}
+
+func (s *WebTransportSession) openUniStream(open func() (quic.SendStream, error)) (quic.SendStream, error) {
+	if err := s.closeError(); err != nil {
+		return nil, err
+	}
+	str, err := open()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := str.Write(s.streamHeader(streamTypeWebTransport)); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closeErr != nil {
+		str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+		return nil, s.closeErr
+	}
+	s.sendStreams[str.StreamID()] = str
+	return &webTransportSendStream{SendStream: str, sess: s}, nil
+}
+
+// streamHeader is written at the beginning of the streams opened for the session
+func (s *WebTransportSession) streamHeader(streamType uint64) []byte {
+	b := &bytes.Buffer{}
+	utils.WriteVarInt(b, streamType)
+	utils.WriteVarInt(b, s.id)
+	return b.Bytes()
+}
+
+// CloseWithError closes the session, sending the error code and the message to the client.
+// All streams of the session are reset.
+func (s *WebTransportSession) CloseWithError(code uint32, msg string) error {
+	if len(msg) > maxCloseMessageLength {
+		return fmt.Errorf("http3: WebTransport error message too long (%d bytes)", len(msg))
+	}
+	if !s.close(&WebTransportSessionError{ErrorCode: code, Message: msg}) {
+		return nil
+	}
+	capsule := &bytes.Buffer{}
+	writeCapsuleHeader(capsule, capsuleTypeCloseWebTransportSession, uint64(4+len(msg)))
+	binary.Write(capsule, binary.BigEndian, code)
+	capsule.WriteString(msg)
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	err := s.writeCapsule(capsule.Bytes())
+	s.str.Close()
+	// The client is not allowed to send anything after the session was closed.
+	s.str.CancelRead(quic.ErrorCode(errorNoError))
+	return err
+}
+
+// SendDatagram sends a datagram to the client.
+// Just like a QUIC DATAGRAM frame, it is sent as a whole, but it is sent reliably, in a DATAGRAM capsule on the CONNECT stream.
+func (s *WebTransportSession) SendDatagram(b []byte) error {
+	if len(b) > maxWebTransportDatagramSize {
+		return fmt.Errorf("http3: datagram too large (%d bytes)", len(b))
+	}
+	if err := s.closeError(); err != nil {
+		return err
+	}
+	capsule := &bytes.Buffer{}
+	writeCapsuleHeader(capsule, capsuleTypeDatagram, uint64(len(b)))
+	capsule.Write(b)
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	if err := s.closeError(); err != nil {
+		return err
+	}
+	return s.writeCapsule(capsule.Bytes())
+}
+
+// ReceiveDatagram returns the next datagram sent by the client, blocking until one is available.
+// If the application doesn't receive the datagrams fast enough, datagrams are dropped.
+func (s *WebTransportSession) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	for {
+		s.mutex.Lock()
+		if len(s.datagramQueue) > 0 {
+			data := s.datagramQueue[0]
+			s.datagramQueue = s.datagramQueue[1:]
+			if len(s.datagramQueue) > 0 {
+				notify(s.datagramQueued)
+			}
+			s.mutex.Unlock()
+			return data, nil
+		}
+		err := s.closeErr
+		s.mutex.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		select {
+		case <-s.datagramQueued:
+		case <-s.ctx.Done():
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// writeCapsule writes a capsule to the CONNECT stream, in a DATA frame.
+// The writeMutex must be held.
+func (s *WebTransportSession) writeCapsule(capsule []byte) error {
+	b := &bytes.Buffer{}
+	(&dataFrame{Length: uint64(len(capsule))}).Write(b)
+	b.Write(capsule)
+	_, err := s.str.Write(b.Bytes())
+	return err
+}
+
+func (s *WebTransportSession) closeError() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closeErr
+}
+
+// establish is called when the request establishing the session was accepted.
+// From now on, the session reads the capsules sent on the CONNECT stream.
+func (s *WebTransportSession) establish(str quic.Stream) {
+	// Undo the http.Server's ReadTimeout, the session might stay open for a long time.
+	str.SetReadDeadline(time.Time{})
+	s.mutex.Lock()
+	s.str = str
+	s.mutex.Unlock()
+	go s.handleConnectStream()
+}
+
+func (s *WebTransportSession) addStream(str quic.Stream) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closeErr != nil {
+		cancelStream(str, errorRequestCanceled)
+		return
+	}
+	if s.str == nil && len(s.acceptQueue)+len(s.uniAcceptQueue) >= maxBufferedWebTransportStreams {
+		cancelStream(str, errorRequestRejected)
+		return
+	}
+	s.streams[str.StreamID()] = str
+	s.acceptQueue = append(s.acceptQueue, &webTransportStream{Stream: str, sess: s})
+	notify(s.streamQueued)
+}
+
+func (s *WebTransportSession) addUniStream(str quic.ReceiveStream) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closeErr != nil {
+		str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+		return
+	}
+	if s.str == nil && len(s.acceptQueue)+len(s.uniAcceptQueue) >= maxBufferedWebTransportStreams {
+		str.CancelRead(quic.ErrorCode(errorRequestRejected))
+		return
+	}
+	s.receiveStreams[str.StreamID()] = str
+	s.uniAcceptQueue = append(s.uniAcceptQueue, &webTransportReceiveStream{ReceiveStream: str, sess: s})
+	notify(s.uniStreamQueued)
+}
+
+// removeStream is called when a stream of the session is done.
+// Streams that are done are not reset when the session is closed.
+func (s *WebTransportSession) removeStream(id quic.StreamID) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.streams, id)
+	delete(s.receiveStreams, id)
+	delete(s.sendStreams, id)
+}
+
+func (s *WebTransportSession) queueDatagram(data []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.datagramQueue) >= maxQueuedWebTransportDatagrams {
+		s.conn.logger.Debugf("Dropping datagram for WebTransport session %d: queue full", s.id)
+		return
+	}
+	s.datagramQueue = append(s.datagramQueue, data)
+	notify(s.datagramQueued)
+}
+
+// handleConnectStream reads the capsules sent on the CONNECT stream, until the session is closed.
+func (s *WebTransportSession) handleConnectStream() {
+	closeErr, err := s.readCapsules()
+	if err != nil {
+		s.conn.logger.Debugf("Reading the CONNECT stream of WebTransport session %d failed: %s", s.id, err)
+		if s.close(err) {
+			code := errorRequestCanceled
+			if err == errMalformedCapsule {
+				code = errorMessageError
+			}
+			cancelStream(s.str, code)
+		}
+		return
+	}
+	if s.close(closeErr) {
+		s.str.Close()
+	}
+}
+
+// readCapsules reads capsules until the client closes the session.
+// Datagrams are queued, capsules of unknown types are skipped.
+func (s *WebTransportSession) readCapsules() (*WebTransportSessionError, error) {
+	r := newBody(s.str, s.conn.closeWithError)
+	for {
+		capsuleType, l, err := readCapsuleHeader(r)
+		if err == io.EOF {
+			// The client closed the CONNECT stream without sending a CLOSE_WEBTRANSPORT_SESSION capsule.
+			return &WebTransportSessionError{Remote: true}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if capsuleType == capsuleTypeDatagram {
+			if l > maxWebTransportDatagramSize {
+				return nil, errMalformedCapsule
+			}
+			data := make([]byte, l)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, capsuleError(err)
+			}
+			s.queueDatagram(data)
+			continue
+		}
+		if capsuleType != capsuleTypeCloseWebTransportSession {
+			if err := skipCapsule(r, l); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if l < 4 || l > 4+maxCloseMessageLength {
+			return nil, errMalformedCapsule
+		}
+		payload := make([]byte, l)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return nil, capsuleError(err)
+		}
+		return &WebTransportSessionError{
+			Remote:    true,
+			ErrorCode: binary.BigEndian.Uint32(payload),
+			Message:   string(payload[4:]),
+		}, nil
+	}
+}
+
+// close closes the session, and resets all of its streams.
+// It returns false if the session was already closed.
+func (s *WebTransportSession) close(err error) bool {
+	s.mutex.Lock()
+	if s.closeErr != nil {
+		s.mutex.Unlock()
+		return false
+	}
+	s.closeErr = err
+	s.cancelCtx()
+	for _, str := range s.streams {
+		cancelStream(str, errorRequestCanceled)
+	}
+	for _, str := range s.receiveStreams {
+		str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+	}
+	for _, str := range s.sendStreams {
+		str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+	}
+	s.streams = nil
+	s.receiveStreams = nil
+	s.sendStreams = nil
+	s.acceptQueue = nil
+	s.uniAcceptQueue = nil
+	s.datagramQueue = nil
+	s.mutex.Unlock()
+
+	s.conn.removeWebTransportSession(s.id)
+	return true
+}
+
+// notify signals a channel with a capacity of 1, without blocking
+func notify(c chan<- struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// getWebTransportSession returns the session with the given ID.
+// If the session doesn't exist yet, it is created as a pending session,
+// since streams might arrive before the request establishing the session is handled.
+// It returns nil if the session can't be established any more, or if there are too many pending sessions.
+func (c *connection) getWebTransportSession(id uint64) *WebTransportSession {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if sess, ok := c.webTransportSessions[id]; ok {
+		return sess
+	}
+	if id < c.nextRequestStreamID {
+		// The request stream was already accepted.
+		// Unless the request is still being handled, it didn't establish a session, or the session was already closed.
+		if _, ok := c.activeRequests[id]; !ok {
+			return nil
+		}
+	} else if c.goingAway {
+		// The request stream will be rejected.
+		return nil
+	}
+	var numPending int
+	for _, sess := range c.webTransportSessions {
+		if sess.pending {
+			numPending++
+		}
+	}
+	if numPending >= maxPendingWebTransportSessions {
+		return nil
+	}
+	sess := newWebTransportSession(c, id)
+	c.webTransportSessions[id] = sess
+	return sess
+}
+
+// establishWebTransportSession establishes the session on the request stream str.
+func (c *connection) establishWebTransportSession(str quic.Stream) *WebTransportSession {
+	id := uint64(str.StreamID())
+	c.mutex.Lock()
+	sess, ok := c.webTransportSessions[id]
+	if !ok {
+		sess = newWebTransportSession(c, id)
+		c.webTransportSessions[id] = sess
+	}
+	sess.pending = false
+	c.mutex.Unlock()
+	sess.establish(str)
+	return sess
+}
+
+// rejectWebTransportSession is called when a request was handled.
+// If it didn't establish a session, the streams that were buffered for a session on the request stream are reset.
+func (c *connection) rejectWebTransportSession(id uint64) {
+	c.mutex.Lock()
+	sess, ok := c.webTransportSessions[id]
+	ok = ok && sess.pending
+	c.mutex.Unlock()
+	if ok {
+		sess.close(errors.New("http3: WebTransport session rejected"))
+	}
+}
+
+func (c *connection) removeWebTransportSession(id uint64) {
+	c.mutex.Lock()
+	delete(c.webTransportSessions, id)
+	c.mutex.Unlock()
+}
+
+// readWebTransportSessionID reads the session ID of a WebTransport stream.
+// The session ID is the stream ID of a request stream, so it has to be a client-initiated bidirectional stream.
+func (c *connection) readWebTransportSessionID(str quic.ReceiveStream) (uint64, bool) {
+	id, err := utils.ReadVarInt(&byteReader{Reader: str})
+	if err != nil {
+		c.logger.Debugf("Reading the session ID of WebTransport stream %d failed: %s", str.StreamID(), err)
+		return 0, false
+	}
+	if id%4 != 0 {
+		c.closeWithError(&connectionError{code: errorIDError, reason: fmt.Sprintf("invalid WebTransport session ID %d", id)})
+		return 0, false
+	}
+	return id, true
+}
+
+// handleWebTransportStream handles a bidirectional stream, after the WEBTRANSPORT_STREAM signal value was read.
+func (c *connection) handleWebTransportStream(str quic.Stream) {
+	id, ok := c.readWebTransportSessionID(str)
+	if !ok {
+		cancelStream(str, errorRequestIncomplete)
+		return
+	}
+	sess := c.getWebTransportSession(id)
+	if sess == nil {
+		c.logger.Debugf("Rejecting stream %d for WebTransport session %d", str.StreamID(), id)
+		cancelStream(str, errorRequestRejected)
+		return
+	}
+	// Undo the ReadHeaderTimeout, the stream now belongs to the session.
+	str.SetReadDeadline(time.Time{})
+	sess.addStream(str)
+}
+
+// handleWebTransportUniStream handles a unidirectional stream, after the stream type was read.
+func (c *connection) handleWebTransportUniStream(str quic.ReceiveStream) {
+	id, ok := c.readWebTransportSessionID(str)
+	if !ok {
+		str.CancelRead(quic.ErrorCode(errorRequestIncomplete))
+		return
+	}
+	sess := c.getWebTransportSession(id)
+	if sess == nil {
+		c.logger.Debugf("Rejecting stream %d for WebTransport session %d", str.StreamID(), id)
+		str.CancelRead(quic.ErrorCode(errorRequestRejected))
+		return
+	}
+	sess.addUniStream(str)
+}
+
+// isTimeout says if the error was caused by a deadline, in which case the stream is not done yet
+func isTimeout(err error) bool {
+	nerr, ok := err.(net.Error)
+	return ok && nerr.Timeout()
+}
+
+// A webTransportStream is a bidirectional stream of a WebTransport session.
+// It is removed from the session once both its send and its receive side are done.
+type webTransportStream struct {
+	quic.Stream
+	sess *WebTransportSession
+
+	mutex               sync.Mutex
+	readDone, writeDone bool
+}
+
+func (s *webTransportStream) Read(b []byte) (int, error) {
+	n, err := s.Stream.Read(b)
+	if err != nil && !isTimeout(err) {
+		s.done(true, false)
+	}
+	return n, err
+}
+
+func (s *webTransportStream) CancelRead(code quic.ErrorCode) error {
+	err := s.Stream.CancelRead(code)
+	s.done(true, false)
+	return err
+}
+
+func (s *webTransportStream) Write(b []byte) (int, error) {
+	n, err := s.Stream.Write(b)
+	if err != nil && !isTimeout(err) {
+		s.done(false, true)
+	}
+	return n, err
+}
+
+func (s *webTransportStream) Close() error {
+	err := s.Stream.Close()
+	s.done(false, true)
+	return err
+}
+
+func (s *webTransportStream) CancelWrite(code quic.ErrorCode) error {
+	err := s.Stream.CancelWrite(code)
+	s.done(false, true)
+	return err
+}
+
+func (s *webTransportStream) done(read, write bool) {
+	s.mutex.Lock()
+	s.readDone = s.readDone || read
+	s.writeDone = s.writeDone || write
+	done := s.readDone && s.writeDone
+	s.mutex.Unlock()
+	if done {
+		s.sess.removeStream(s.StreamID())
+	}
+}
+
+// A webTransportReceiveStream is a unidirectional stream opened by the client.
+// It is removed from the session once it is done.
+type webTransportReceiveStream struct {
+	quic.ReceiveStream
+	sess *WebTransportSession
+}
+
+func (s *webTransportReceiveStream) Read(b []byte) (int, error) {
+	n, err := s.ReceiveStream.Read(b)
+	if err != nil && !isTimeout(err) {
+		s.sess.removeStream(s.StreamID())
+	}
+	return n, err
+}
+
+func (s *webTransportReceiveStream) CancelRead(code quic.ErrorCode) error {
+	err := s.ReceiveStream.CancelRead(code)
+	s.sess.removeStream(s.StreamID())
+	return err
+}
+
+// A webTransportSendStream is a unidirectional stream opened by the server.
+// It is removed from the session once it is done.
+type webTransportSendStream struct {
+	quic.SendStream
+	sess *WebTransportSession
+}
+
+func (s *webTransportSendStream) Write(b []byte) (int, error) {
+	n, err := s.SendStream.Write(b)
+	if err != nil && !isTimeout(err) {
+		s.sess.removeStream(s.StreamID())
+	}
+	return n, err
+}
+
+func (s *webTransportSendStream) Close() error {
+	err := s.SendStream.Close()
+	s.sess.removeStream(s.StreamID())
+	return err
+}
+
+func (s *webTransportSendStream) CancelWrite(code quic.ErrorCode) error {
+	err := s.SendStream.CancelWrite(code)
+	s.sess.removeStream(s.StreamID())
+	return err
+}
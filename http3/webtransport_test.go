@@ -0,0 +1,558 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3/qpack"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WebTransport", func() {
+	var (
+		s        *Server
+		addr     string
+		mux      *http.ServeMux
+		sessChan chan *WebTransportSession
+	)
+
+	startWebTransportServer := func(enable bool) {
+		server := &Server{
+			Server: &http.Server{
+				Handler:   mux,
+				TLSConfig: testdata.GetTLSConfig(),
+			},
+			EnableWebTransport: enable,
+		}
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		go func() {
+			defer GinkgoRecover()
+			server.Serve(conn)
+		}()
+		s = server
+		addr = conn.LocalAddr().String()
+	}
+
+	BeforeEach(func() {
+		sessChan = make(chan *WebTransportSession, 1)
+		mux = http.NewServeMux()
+		mux.HandleFunc("/webtransport", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			sess, err := UpgradeWebTransport(w, r)
+			Expect(err).ToNot(HaveOccurred())
+			sessChan <- sess
+		})
+		startWebTransportServer(true)
+	})
+
+	AfterEach(func() {
+		Expect(s.Close()).To(Succeed())
+	})
+
+	// dialWebTransport establishes a session, and sends a SETTINGS frame that enables WebTransport
+	dialWebTransport := func() quic.Session {
+		sess := dialRaw(addr)
+		str, err := sess.OpenUniStream()
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		b := &bytes.Buffer{}
+		utils.WriteVarInt(b, streamTypeControl)
+		(&settingsFrame{settings: map[uint64]uint64{settingEnableWebTransport: 1}}).Write(b)
+		_, err = str.Write(b.Bytes())
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		return sess
+	}
+
+	// sendConnect sends an Extended CONNECT request on str
+	sendConnect := func(str quic.Stream, protocol, path string) {
+		headerBlock := &bytes.Buffer{}
+		enc := qpack.NewEncoder(headerBlock)
+		enc.WriteField(qpack.HeaderField{Name: ":method", Value: http.MethodConnect})
+		enc.WriteField(qpack.HeaderField{Name: ":protocol", Value: protocol})
+		enc.WriteField(qpack.HeaderField{Name: ":scheme", Value: "https"})
+		enc.WriteField(qpack.HeaderField{Name: ":authority", Value: testServerName})
+		enc.WriteField(qpack.HeaderField{Name: ":path", Value: path})
+		ExpectWithOffset(1, enc.Close()).To(Succeed())
+		b := &bytes.Buffer{}
+		(&headersFrame{Length: uint64(headerBlock.Len())}).Write(b)
+		b.Write(headerBlock.Bytes())
+		_, err := str.Write(b.Bytes())
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	}
+
+	// establishSession establishes a WebTransport session, and returns the CONNECT stream
+	establishSession := func(sess quic.Session) (quic.Stream, *WebTransportSession) {
+		str, err := sess.OpenStreamSync()
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		sendConnect(str, webTransportProtocol, "/webtransport")
+		ExpectWithOffset(1, readHeaders(str)).To(And(
+			HaveKeyWithValue(":status", []string{"200"}),
+			HaveKeyWithValue("sec-webtransport-http3-draft", []string{"draft02"}),
+		))
+		var wsess *WebTransportSession
+		EventuallyWithOffset(1, sessChan).Should(Receive(&wsess))
+		return str, wsess
+	}
+
+	// openStream opens a bidirectional stream for the session on the CONNECT stream
+	openStream := func(sess quic.Session, connectStr quic.Stream) quic.Stream {
+		str, err := sess.OpenStreamSync()
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		b := &bytes.Buffer{}
+		utils.WriteVarInt(b, frameTypeWebTransportStream)
+		utils.WriteVarInt(b, uint64(connectStr.StreamID()))
+		_, err = str.Write(b.Bytes())
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		return str
+	}
+
+	// closeCapsule is a DATA frame containing a CLOSE_WEBTRANSPORT_SESSION capsule
+	closeCapsule := func(code uint32, msg string) []byte {
+		capsule := &bytes.Buffer{}
+		utils.WriteVarInt(capsule, capsuleTypeCloseWebTransportSession)
+		utils.WriteVarInt(capsule, uint64(4+len(msg)))
+		binary.Write(capsule, binary.BigEndian, code)
+		capsule.WriteString(msg)
+		b := &bytes.Buffer{}
+		(&dataFrame{Length: uint64(capsule.Len())}).Write(b)
+		b.Write(capsule.Bytes())
+		return b.Bytes()
+	}
+
+	It("enables WebTransport in the SETTINGS", func() {
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		for {
+			str, err := sess.AcceptUniStream()
+			Expect(err).ToNot(HaveOccurred())
+			t, err := utils.ReadVarInt(&byteReader{Reader: str})
+			Expect(err).ToNot(HaveOccurred())
+			if t != streamTypeControl {
+				continue
+			}
+			f, err := parseNextFrame(str)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f).To(BeAssignableToTypeOf(&settingsFrame{}))
+			settings := f.(*settingsFrame).settings
+			Expect(settings).To(HaveKeyWithValue(uint64(settingEnableConnectProtocol), uint64(1)))
+			Expect(settings).To(HaveKeyWithValue(uint64(settingEnableWebTransport), uint64(1)))
+			return
+		}
+	})
+
+	It("accepts bidirectional streams", func() {
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		connectStr, wsess := establishSession(sess)
+		str := openStream(sess, connectStr)
+		_, err := str.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(str.Close()).To(Succeed())
+
+		sstr, err := wsess.AcceptStream(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		data, err := ioutil.ReadAll(sstr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("foobar"))
+		_, err = sstr.Write([]byte("raboof"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sstr.Close()).To(Succeed())
+		data, err = ioutil.ReadAll(str)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("raboof"))
+	})
+
+	It("accepts unidirectional streams", func() {
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		connectStr, wsess := establishSession(sess)
+		str, err := sess.OpenUniStreamSync()
+		Expect(err).ToNot(HaveOccurred())
+		b := &bytes.Buffer{}
+		utils.WriteVarInt(b, streamTypeWebTransport)
+		utils.WriteVarInt(b, uint64(connectStr.StreamID()))
+		b.Write([]byte("foobar"))
+		_, err = str.Write(b.Bytes())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(str.Close()).To(Succeed())
+
+		sstr, err := wsess.AcceptUniStream(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		data, err := ioutil.ReadAll(sstr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("foobar"))
+	})
+
+	It("doesn't apply the ReadHeaderTimeout to the streams of the session", func() {
+		s.ReadHeaderTimeout = 20 * time.Millisecond
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		connectStr, wsess := establishSession(sess)
+		str := openStream(sess, connectStr)
+		sstr, err := wsess.AcceptStream(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		time.Sleep(50 * time.Millisecond)
+		_, err = str.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(str.Close()).To(Succeed())
+		data, err := ioutil.ReadAll(sstr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("foobar"))
+	})
+
+	It("removes streams that are done", func() {
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		connectStr, wsess := establishSession(sess)
+		str := openStream(sess, connectStr)
+		Expect(str.Close()).To(Succeed())
+		sstr, err := wsess.AcceptStream(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		numStreams := func() int {
+			wsess.mutex.Lock()
+			defer wsess.mutex.Unlock()
+			return len(wsess.streams) + len(wsess.receiveStreams) + len(wsess.sendStreams)
+		}
+		Expect(numStreams()).To(Equal(1))
+		_, err = ioutil.ReadAll(sstr)
+		Expect(err).ToNot(HaveOccurred())
+		// the send side is still open
+		Expect(numStreams()).To(Equal(1))
+		Expect(sstr.Close()).To(Succeed())
+		Expect(numStreams()).To(BeZero())
+
+		ustr, err := wsess.OpenUniStream()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(numStreams()).To(Equal(1))
+		Expect(ustr.CancelWrite(0)).To(Succeed())
+		Expect(numStreams()).To(BeZero())
+	})
+
+	It("receives datagrams", func() {
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		connectStr, wsess := establishSession(sess)
+		capsule := &bytes.Buffer{}
+		writeCapsuleHeader(capsule, capsuleTypeDatagram, 6)
+		capsule.WriteString("foobar")
+		b := &bytes.Buffer{}
+		(&dataFrame{Length: uint64(capsule.Len())}).Write(b)
+		b.Write(capsule.Bytes())
+		_, err := connectStr.Write(b.Bytes())
+		Expect(err).ToNot(HaveOccurred())
+		data, err := wsess.ReceiveDatagram(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("foobar"))
+	})
+
+	It("sends datagrams", func() {
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		connectStr, wsess := establishSession(sess)
+		Expect(wsess.SendDatagram([]byte("foobar"))).To(Succeed())
+		f, err := parseNextFrame(connectStr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(f).To(BeAssignableToTypeOf(&dataFrame{}))
+		capsuleType, l, err := readCapsuleHeader(connectStr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(capsuleType).To(BeEquivalentTo(capsuleTypeDatagram))
+		data := make([]byte, l)
+		_, err = io.ReadFull(connectStr, data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("foobar"))
+		Expect(wsess.SendDatagram(make([]byte, maxWebTransportDatagramSize+1))).To(MatchError(ContainSubstring("datagram too large")))
+	})
+
+	It("drops datagrams if the queue is full", func() {
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		_, wsess := establishSession(sess)
+		for i := 0; i < maxQueuedWebTransportDatagrams+1; i++ {
+			wsess.queueDatagram([]byte{byte(i)})
+		}
+		for i := 0; i < maxQueuedWebTransportDatagrams; i++ {
+			data, err := wsess.ReceiveDatagram(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte{byte(i)}))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := wsess.ReceiveDatagram(ctx)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+
+	It("rejects streams for sessions that were already closed", func() {
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		connectStr, wsess := establishSession(sess)
+		Expect(wsess.CloseWithError(0, "")).To(Succeed())
+		str := openStream(sess, connectStr)
+		_, err := str.Read([]byte{0})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(quic.StreamError).ErrorCode()).To(BeEquivalentTo(errorRequestRejected))
+		conn := wsess.conn
+		conn.mutex.Lock()
+		defer conn.mutex.Unlock()
+		Expect(conn.webTransportSessions).To(BeEmpty())
+	})
+
+	It("rejects streams for request streams that didn't establish a session", func() {
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		connectStr, err := sess.OpenStreamSync()
+		Expect(err).ToNot(HaveOccurred())
+		sendConnect(connectStr, webTransportProtocol, "/notfound")
+		Expect(readHeaders(connectStr)).To(HaveKeyWithValue(":status", []string{"404"}))
+		str := openStream(sess, connectStr)
+		_, err = str.Read([]byte{0})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(quic.StreamError).ErrorCode()).To(BeEquivalentTo(errorRequestRejected))
+		// a WebTransport stream is not a request stream either
+		str2 := openStream(sess, str)
+		_, err = str2.Read([]byte{0})
+		Expect(err).To(HaveOccurred())
+		_, ok := err.(quic.StreamError)
+		Expect(ok).To(BeTrue())
+	})
+
+	It("opens streams", func() {
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		connectStr, wsess := establishSession(sess)
+
+		sstr, err := wsess.OpenStreamSync()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = sstr.Write([]byte("foo"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sstr.Close()).To(Succeed())
+		str, err := sess.AcceptStream()
+		Expect(err).ToNot(HaveOccurred())
+		data, err := ioutil.ReadAll(str)
+		Expect(err).ToNot(HaveOccurred())
+		b := &bytes.Buffer{}
+		utils.WriteVarInt(b, frameTypeWebTransportStream)
+		utils.WriteVarInt(b, uint64(connectStr.StreamID()))
+		b.Write([]byte("foo"))
+		Expect(data).To(Equal(b.Bytes()))
+
+		usstr, err := wsess.OpenUniStreamSync()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = usstr.Write([]byte("bar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(usstr.Close()).To(Succeed())
+		for {
+			ustr, err := sess.AcceptUniStream()
+			Expect(err).ToNot(HaveOccurred())
+			t, err := utils.ReadVarInt(&byteReader{Reader: ustr})
+			Expect(err).ToNot(HaveOccurred())
+			if t != streamTypeWebTransport {
+				continue
+			}
+			id, err := utils.ReadVarInt(&byteReader{Reader: ustr})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(id).To(BeEquivalentTo(connectStr.StreamID()))
+			data, err := ioutil.ReadAll(ustr)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal("bar"))
+			break
+		}
+	})
+
+	It("buffers streams that arrive before the session is established", func() {
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		connectStr, err := sess.OpenStreamSync()
+		Expect(err).ToNot(HaveOccurred())
+		str := openStream(sess, connectStr)
+		_, err = str.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(str.Close()).To(Succeed())
+
+		sendConnect(connectStr, webTransportProtocol, "/webtransport")
+		Expect(readHeaders(connectStr)).To(HaveKeyWithValue(":status", []string{"200"}))
+		var wsess *WebTransportSession
+		Eventually(sessChan).Should(Receive(&wsess))
+		sstr, err := wsess.AcceptStream(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		data, err := ioutil.ReadAll(sstr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("foobar"))
+	})
+
+	It("resets the buffered streams if the session is not established", func() {
+		mux.HandleFunc("/notfound", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			// wait until the stream was buffered
+			conn := w.(*responseWriter).conn
+			Eventually(func() int {
+				conn.mutex.Lock()
+				defer conn.mutex.Unlock()
+				return len(conn.webTransportSessions)
+			}).Should(Equal(1))
+			w.WriteHeader(http.StatusNotFound)
+		})
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		connectStr, err := sess.OpenStreamSync()
+		Expect(err).ToNot(HaveOccurred())
+		sendConnect(connectStr, webTransportProtocol, "/notfound")
+		str := openStream(sess, connectStr)
+		_, err = str.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readHeaders(connectStr)).To(HaveKeyWithValue(":status", []string{"404"}))
+		_, err = str.Read([]byte{0})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(quic.StreamError).ErrorCode()).To(BeEquivalentTo(errorRequestCanceled))
+	})
+
+	It("closes the session", func() {
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		connectStr, wsess := establishSession(sess)
+		str := openStream(sess, connectStr)
+		_, err := wsess.AcceptStream(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(wsess.CloseWithError(1337, "foobar")).To(Succeed())
+		Expect(wsess.Context().Done()).To(BeClosed())
+		data, err := ioutil.ReadAll(connectStr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal(closeCapsule(1337, "foobar")))
+		// the stream of the session is reset
+		_, err = str.Read([]byte{0})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(quic.StreamError).ErrorCode()).To(BeEquivalentTo(errorRequestCanceled))
+		_, err = wsess.OpenStream()
+		Expect(err).To(MatchError(&WebTransportSessionError{ErrorCode: 1337, Message: "foobar"}))
+	})
+
+	It("handles the client closing the session", func() {
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		connectStr, wsess := establishSession(sess)
+		_, err := connectStr.Write(closeCapsule(42, "bye"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(connectStr.Close()).To(Succeed())
+
+		Eventually(wsess.Context().Done()).Should(BeClosed())
+		_, err = wsess.AcceptStream(context.Background())
+		Expect(err).To(MatchError(&WebTransportSessionError{Remote: true, ErrorCode: 42, Message: "bye"}))
+		// the server closes the CONNECT stream as well
+		data, err := ioutil.ReadAll(connectStr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(BeEmpty())
+	})
+
+	It("handles the client closing the CONNECT stream without a capsule", func() {
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		connectStr, wsess := establishSession(sess)
+		Expect(connectStr.Close()).To(Succeed())
+		Eventually(wsess.Context().Done()).Should(BeClosed())
+		_, err := wsess.AcceptUniStream(context.Background())
+		Expect(err).To(MatchError(&WebTransportSessionError{Remote: true}))
+	})
+
+	It("resets the CONNECT stream if the client sends a malformed capsule", func() {
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		connectStr, wsess := establishSession(sess)
+		// a DATA frame containing a truncated capsule
+		b := &bytes.Buffer{}
+		(&dataFrame{Length: 2}).Write(b)
+		utils.WriteVarInt(b, capsuleTypeCloseWebTransportSession)
+		_, err := connectStr.Write(b.Bytes())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(connectStr.Close()).To(Succeed())
+		Eventually(wsess.Context().Done()).Should(BeClosed())
+		_, err = connectStr.Read([]byte{0})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(quic.StreamError).ErrorCode()).To(BeEquivalentTo(errorMessageError))
+	})
+
+	It("closes the connection if a stream uses an invalid session ID", func() {
+		sess := dialWebTransport()
+		str, err := sess.OpenUniStreamSync()
+		Expect(err).ToNot(HaveOccurred())
+		b := &bytes.Buffer{}
+		utils.WriteVarInt(b, streamTypeWebTransport)
+		utils.WriteVarInt(b, 3) // a server-initiated unidirectional stream
+		_, err = str.Write(b.Bytes())
+		Expect(err).ToNot(HaveOccurred())
+		expectSessionClosedWithError(sess, errorIDError)
+	})
+
+	It("doesn't upgrade requests that are not WebTransport requests", func() {
+		mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			_, err := UpgradeWebTransport(w, r)
+			Expect(err).To(MatchError("http3: not a WebTransport request"))
+			w.Write([]byte("Hello, World!"))
+		})
+		rt := &RoundTripper{TLSClientConfig: getClientTLSConfig()}
+		defer rt.Close()
+		req, err := http.NewRequest("GET", "https://"+addr+"/hello", nil)
+		Expect(err).ToNot(HaveOccurred())
+		rsp, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(200))
+	})
+
+	It("doesn't upgrade requests if the client didn't enable WebTransport", func() {
+		mux.HandleFunc("/disabled", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			_, err := UpgradeWebTransport(w, r)
+			Expect(err).To(MatchError("http3: client didn't enable WebTransport"))
+			w.WriteHeader(http.StatusBadRequest)
+		})
+		sess := dialRaw(addr)
+		defer sess.Close(nil)
+		openControlStream(sess)
+		str, err := sess.OpenStreamSync()
+		Expect(err).ToNot(HaveOccurred())
+		sendConnect(str, webTransportProtocol, "/disabled")
+		Expect(readHeaders(str)).To(HaveKeyWithValue(":status", []string{"400"}))
+	})
+
+	It("rejects Extended CONNECT requests if WebTransport is disabled", func() {
+		Expect(s.Close()).To(Succeed())
+		startWebTransportServer(false)
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		str, err := sess.OpenStreamSync()
+		Expect(err).ToNot(HaveOccurred())
+		sendConnect(str, webTransportProtocol, "/webtransport")
+		_, err = str.Read([]byte{0})
+		Expect(err).To(HaveOccurred())
+		Expect(err.(quic.StreamError).ErrorCode()).To(BeEquivalentTo(errorMessageError))
+	})
+
+	It("ignores WebTransport streams if WebTransport is disabled", func() {
+		Expect(s.Close()).To(Succeed())
+		startWebTransportServer(false)
+		sess := dialWebTransport()
+		defer sess.Close(nil)
+		str, err := sess.OpenUniStreamSync()
+		Expect(err).ToNot(HaveOccurred())
+		b := &bytes.Buffer{}
+		utils.WriteVarInt(b, streamTypeWebTransport)
+		utils.WriteVarInt(b, 0)
+		_, err = str.Write(b.Bytes())
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(func() error {
+			_, err := str.Write([]byte("foobar"))
+			return err
+		}).Should(HaveOccurred())
+	})
+})
@@ -0,0 +1,106 @@
+package self_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/integrationtests/tools/testserver"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Transport", func() {
+	for _, v := range protocol.SupportedVersions {
+		version := v
+
+		Context(fmt.Sprintf("with QUIC version %s", version), func() {
+			var qconf *quic.Config
+
+			BeforeEach(func() {
+				qconf = &quic.Config{Versions: []protocol.VersionNumber{version}}
+			})
+
+			newTransport := func() *quic.Transport {
+				addr, err := net.ResolveUDPAddr("udp", "localhost:0")
+				Expect(err).ToNot(HaveOccurred())
+				conn, err := net.ListenUDP("udp", addr)
+				Expect(err).ToNot(HaveOccurred())
+				return quic.NewTransport(conn, nil)
+			}
+
+			runEchoServer := func(ln quic.Listener) {
+				go func() {
+					defer GinkgoRecover()
+					for {
+						sess, err := ln.Accept()
+						if err != nil {
+							return
+						}
+						go func() {
+							defer GinkgoRecover()
+							str, err := sess.AcceptStream()
+							Expect(err).ToNot(HaveOccurred())
+							data, err := ioutil.ReadAll(str)
+							Expect(err).ToNot(HaveOccurred())
+							_, err = str.Write(data)
+							Expect(err).ToNot(HaveOccurred())
+							Expect(str.Close()).To(Succeed())
+						}()
+					}
+				}()
+			}
+
+			dialAndEcho := func(t *quic.Transport, addr net.Addr, data []byte) {
+				host := fmt.Sprintf("quic.clemente.io:%d", addr.(*net.UDPAddr).Port)
+				sess, err := t.Dial(addr, host, nil, qconf)
+				Expect(err).ToNot(HaveOccurred())
+				str, err := sess.OpenStreamSync()
+				Expect(err).ToNot(HaveOccurred())
+				_, err = str.Write(data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(str.Close()).To(Succeed())
+				echoed, err := ioutil.ReadAll(str)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(echoed).To(Equal(data))
+				Expect(sess.Close(nil)).To(Succeed())
+			}
+
+			It("dials and accepts multiple connections over the same net.PacketConn", func() {
+				t1 := newTransport()
+				defer t1.Close()
+				t2 := newTransport()
+				defer t2.Close()
+
+				ln1, err := t1.Listen(testdata.GetTLSConfig(), qconf)
+				Expect(err).ToNot(HaveOccurred())
+				runEchoServer(ln1)
+				ln2, err := t2.Listen(testdata.GetTLSConfig(), qconf)
+				Expect(err).ToNot(HaveOccurred())
+				runEchoServer(ln2)
+
+				done := make(chan struct{}, 3)
+				for i := 0; i < 2; i++ {
+					data := testserver.GeneratePRData(10000 * (i + 1))
+					go func() {
+						defer GinkgoRecover()
+						dialAndEcho(t2, ln1.Addr(), data)
+						done <- struct{}{}
+					}()
+				}
+				go func() {
+					defer GinkgoRecover()
+					dialAndEcho(t1, ln2.Addr(), testserver.GeneratePRData(5000))
+					done <- struct{}{}
+				}()
+				for i := 0; i < 3; i++ {
+					Eventually(done, 5).Should(Receive())
+				}
+			})
+		})
+	}
+})
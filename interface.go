@@ -6,6 +6,8 @@ import (
 	"net"
 	"time"
 
+	"github.com/lucas-clemente/quic-go/internal/ackhandler"
+	"github.com/lucas-clemente/quic-go/internal/congestion"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 )
@@ -25,9 +27,129 @@ type Cookie = handshake.Cookie
 // ConnectionState records basic details about the QUIC connection.
 type ConnectionState = handshake.ConnectionState
 
+// A Feature is an optional protocol feature.
+// Endpoints announce the features they support during the handshake (see Config.Features).
+// Warning: This API should not be considered stable and might change soon.
+type Feature = protocol.Feature
+
+// FeatureAckFrequency is the support for the ACK_FREQUENCY frame (IETF QUIC only),
+// which allows the peer to change how often ACKs are sent (see Config.PeerAckPolicy).
+// It is currently the only feature that quic-go implements.
+const FeatureAckFrequency = protocol.FeatureAckFrequency
+
+// A FeatureSet is a set of features, as announced by the peer.
+// Warning: This API should not be considered stable and might change soon.
+type FeatureSet = protocol.FeatureSet
+
 // An ErrorCode is an application-defined error code.
 type ErrorCode = protocol.ApplicationErrorCode
 
+// A CongestionWindowDecay determines how the congestion window is reduced after the connection was idle.
+type CongestionWindowDecay = congestion.WindowDecay
+
+const (
+	// CongestionWindowDecayHalve halves the congestion window for every retransmission timeout that the connection was idle,
+	// but doesn't reduce it below the initial congestion window (RFC 2861).
+	CongestionWindowDecayHalve = congestion.WindowDecayHalve
+	// CongestionWindowDecayReset resets the congestion window to the initial congestion window (RFC 5681).
+	CongestionWindowDecayReset = congestion.WindowDecayReset
+	// CongestionWindowDecayNone keeps the congestion window.
+	// After an idle period, a full congestion window might be sent at once.
+	CongestionWindowDecayNone = congestion.WindowDecayNone
+)
+
+// A CongestionControlAlgorithm is a congestion control algorithm.
+// Warning: This API should not be considered stable and might change soon.
+type CongestionControlAlgorithm = congestion.Algorithm
+
+const (
+	// CongestionControlCubic is Cubic (RFC 8312).
+	CongestionControlCubic = congestion.AlgorithmCubic
+	// CongestionControlBBRv2 is a BBRv2-style algorithm, which paces packets at the estimated bottleneck bandwidth.
+	// Unlike BBRv1, it bounds the data in flight when it experiences a high loss rate, and it reduces the data in flight in response to CE marks (see Config.EnableECN).
+	// This makes it less aggressive towards competing Cubic flows.
+	// The CongestionWindowDecay doesn't apply to BBRv2.
+	CongestionControlBBRv2 = congestion.AlgorithmBBRv2
+	// CongestionControlNewReno is NewReno (RFC 6582), emulating a single TCP connection.
+	// Unlike RFC 6582, it reduces the congestion window by 30% (instead of 50%) on loss.
+	// It increases the congestion window more slowly than Cubic on paths with a large bandwidth-delay product,
+	// which makes it a simple baseline, e.g. for short-lived connections.
+	CongestionControlNewReno = congestion.AlgorithmNewReno
+)
+
+// An AckPolicy determines when ACKs are sent.
+// Sending fewer ACKs reduces the overhead on asymmetric links, but makes the peer react more slowly to loss.
+// Warning: This API should not be considered stable and might change soon.
+type AckPolicy = ackhandler.AckPolicy
+
+// An UnknownFramePolicy determines how frames of unknown types are handled.
+type UnknownFramePolicy uint8
+
+const (
+	// UnknownFramesClose closes the session when a frame of an unknown type is received.
+	UnknownFramesClose UnknownFramePolicy = iota
+	// UnknownFramesIgnore ignores frames of unknown types.
+	// Extension frames (frame types 0x18 to 0x1f) are length-prefixed, so they are skipped,
+	// and the other frames in the packet are processed.
+	// For all other frame types the length of the frame is unknown, so the rest of the packet can't be parsed.
+	// The frames before the unknown frame are processed, and the packet is acknowledged.
+	UnknownFramesIgnore
+)
+
+// A StreamCoalescingPolicy determines if STREAM frames of different streams are sent in the same packet.
+// Warning: This API should not be considered stable and might change soon.
+type StreamCoalescingPolicy uint8
+
+const (
+	// StreamCoalescingAll packs the data of multiple streams into the same packet, if it fits.
+	// Streams with data to send are served in a round-robin fashion.
+	StreamCoalescingAll StreamCoalescingPolicy = iota
+	// StreamCoalescingNone sends the data of different streams in different packets.
+	// When a packet is lost, only a single stream has to wait for the retransmission.
+	// This reduces head-of-line blocking between streams, at the cost of sending more packets when streams only send small amounts of data.
+	// Retransmitted data of different streams might still be sent in the same packet.
+	StreamCoalescingNone
+)
+
+// A PaddingPolicy determines which packets are padded to the maximum packet size.
+// Warning: This API should not be considered stable and might change soon.
+type PaddingPolicy uint8
+
+const (
+	// PaddingDefault only pads packets if required by the protocol, i.e. Initial packets in IETF QUIC.
+	PaddingDefault PaddingPolicy = iota
+	// PaddingHandshake pads all packets that are sent before the handshake completes (i.e. packets that are not forward-secure).
+	// Lost handshake packets delay the establishment of the connection, so this makes sure that
+	// packets of the maximum size can be delivered on the path before any application data is sent.
+	PaddingHandshake
+	// PaddingAll pads all packets.
+	// This hides the amount of data that is sent in every packet from an observer, making traffic analysis harder,
+	// but it significantly increases the bandwidth usage, especially for ACK-only packets.
+	PaddingAll
+)
+
+// An AcceptDecision is returned by the Config.AcceptConnection callback.
+type AcceptDecision uint8
+
+const (
+	// AcceptDecisionAccept continues with the handshake.
+	AcceptDecisionAccept AcceptDecision = iota
+	// AcceptDecisionDrop silently drops the packet.
+	// No state is created for the connection, and no packet is sent in response.
+	AcceptDecisionDrop
+	// AcceptDecisionRequireCookie makes the client prove ownership of its address by presenting a valid Cookie,
+	// as if Config.RequireCookie was set for this connection.
+	AcceptDecisionRequireCookie
+)
+
+// A ClientHelloInfo contains information about the first packet of a new connection.
+type ClientHelloInfo struct {
+	// Version is the QUIC version the client is using.
+	Version VersionNumber
+	// PacketSize is the size of the packet (in bytes).
+	PacketSize int
+}
+
 // Stream is the interface implemented by QUIC streams
 type Stream interface {
 	// StreamID returns the stream ID.
@@ -44,6 +166,11 @@ type Stream interface {
 	// If the stream was canceled by the peer, the error implements the StreamError
 	// interface, and Canceled() == true.
 	io.Writer
+	// WriteVectored writes the data of all buffers to the stream, as if they were concatenated.
+	// The buffers are not concatenated first, instead the data is copied directly into the STREAM frames.
+	// The buffers must not be modified until WriteVectored returns.
+	// Like Write, it blocks until all data has been passed to the packet packer, or an error occurs.
+	WriteVectored(bufs [][]byte) (int, error)
 	// Close closes the write-direction of the stream.
 	// Future calls to Write are not permitted after calling Close.
 	// It must not be called concurrently with Write.
@@ -59,7 +186,11 @@ type Stream interface {
 	// Read will unblock immediately, and future Read calls will fail.
 	CancelRead(ErrorCode) error
 	// The context is canceled as soon as the write-side of the stream is closed.
-	// This happens when Close() is called, or when the stream is reset (either locally or remotely).
+	// This happens when Close() is called, when the stream is reset (either locally or remotely),
+	// or when the session is closed.
+	// Err() returns the error that caused the cancelation:
+	// context.Canceled after Close(), a StreamError if the stream was reset,
+	// or the error that the session was closed with.
 	// Warning: This API should not be considered stable and might change soon.
 	Context() context.Context
 	// SetReadDeadline sets the deadline for future Read calls and
@@ -76,6 +207,17 @@ type Stream interface {
 	// with the connection. It is equivalent to calling both
 	// SetReadDeadline and SetWriteDeadline.
 	SetDeadline(t time.Time) error
+	// SetDataLifetime enables partial reliability for data written to this stream.
+	// Data that is lost, and that was first sent more than the lifetime ago, is not retransmitted.
+	// Instead, the peer is told to skip over it.
+	// This is useful for applications like live media, where stale data is worthless.
+	// A lifetime of 0 (the default) disables partial reliability.
+	// The peer has to support partial reliability.
+	// Warning: This API should not be considered stable and might change soon.
+	SetDataLifetime(time.Duration)
+	// Stats returns statistics about the data transferred on this stream.
+	// Warning: This API should not be considered stable and might change soon.
+	Stats() StreamStats
 }
 
 // A ReceiveStream is a unidirectional Receive Stream.
@@ -88,6 +230,8 @@ type ReceiveStream interface {
 	CancelRead(ErrorCode) error
 	// see Stream.SetReadDealine
 	SetReadDeadline(t time.Time) error
+	// see Stream.Stats
+	Stats() StreamStats
 }
 
 // A SendStream is a unidirectional Send Stream.
@@ -96,6 +240,8 @@ type SendStream interface {
 	StreamID() StreamID
 	// see Stream.Write
 	io.Writer
+	// see Stream.WriteVectored
+	WriteVectored(bufs [][]byte) (int, error)
 	// see Stream.Close
 	io.Closer
 	// see Stream.CancelWrite
@@ -104,6 +250,10 @@ type SendStream interface {
 	Context() context.Context
 	// see Stream.SetWriteDeadline
 	SetWriteDeadline(t time.Time) error
+	// see Stream.SetDataLifetime
+	SetDataLifetime(time.Duration)
+	// see Stream.Stats
+	Stats() StreamStats
 }
 
 // StreamError is returned by Read and Write when the peer cancels the stream.
@@ -113,6 +263,16 @@ type StreamError interface {
 	ErrorCode() ErrorCode
 }
 
+// ApplicationError is returned (e.g. by AcceptStream, Read and Write) when the session was closed using CloseWithError.
+type ApplicationError interface {
+	error
+	ErrorCode() ErrorCode
+	// Reason is the reason phrase passed to CloseWithError.
+	Reason() string
+	// Remote says if the session was closed by the peer.
+	Remote() bool
+}
+
 // A Session is a QUIC connection between two peers.
 type Session interface {
 	// AcceptStream returns the next stream opened by the peer, blocking until one is available.
@@ -135,18 +295,68 @@ type Session interface {
 	// OpenUniStreamSync opens a new outgoing unidirectional QUIC stream.
 	// It blocks until the peer's concurrent stream limit allows a new stream to be opened.
 	OpenUniStreamSync() (SendStream, error)
+	// CorrelationID returns a short identifier for the session, which is used as a prefix for log messages.
+	// It is derived from the connection ID chosen by the client (and not from the time the session was started),
+	// such that client and server use the same identifier, allowing their logs to be correlated.
+	// Warning: This API should not be considered stable and might change soon.
+	CorrelationID() string
 	// LocalAddr returns the local address.
 	LocalAddr() net.Addr
 	// RemoteAddr returns the address of the peer.
 	RemoteAddr() net.Addr
+	// Migrate moves the session to a new net.PacketConn, e.g. after the network interface changed.
+	// All packets are sent from the new net.PacketConn, and the server follows as soon as it receives them.
+	// The old net.PacketConn is not closed, but a read deadline is set to stop reading from it.
+	// Only clients can migrate.
+	// Warning: This API should not be considered stable and might change soon.
+	Migrate(net.PacketConn) error
+	// SetIdleTimeout changes the idle timeout of the session, e.g. to relax the timeout once the peer has been authenticated.
+	// The session is closed if no network activity occurs for the idle timeout, or for the idle timeout announced by the peer, whichever is smaller.
+	// The new timeout is not announced to the peer.
+	// If the timeout is zero, it is set to 30 seconds.
+	// Warning: This API should not be considered stable and might change soon.
+	SetIdleTimeout(time.Duration)
+	// SetDSCP changes the Differentiated Services Code Point that packets of this session are marked with,
+	// overriding Config.DSCP, e.g. to move latency-critical connections into a different QoS class.
+	// It returns an error if the DSCP is larger than 63.
+	// Warning: This API should not be considered stable and might change soon.
+	SetDSCP(uint8) error
+	// SetTTL changes the TTL (IPv4) or hop limit (IPv6) of packets of this session, overriding Config.TTL.
+	// If the TTL is zero, the default of the operating system is used.
+	// Warning: This API should not be considered stable and might change soon.
+	SetTTL(uint8)
 	// Close closes the connection. The error will be sent to the remote peer in a CONNECTION_CLOSE frame. An error value of nil is allowed and will cause a normal PeerGoingAway to be sent.
 	Close(error) error
+	// CloseWithError closes the connection with an application-defined error code and a reason, which must be valid UTF-8.
+	// The peer receives an ApplicationError carrying the code and the reason.
+	// Application error codes only exist in IETF QUIC. For gQUIC, a PeerGoingAway error with the reason is sent.
+	// Warning: This API should not be considered stable and might change soon.
+	CloseWithError(ErrorCode, string) error
 	// The context is cancelled when the session is closed.
 	// Warning: This API should not be considered stable and might change soon.
 	Context() context.Context
 	// ConnectionState returns basic details about the QUIC connection.
 	// Warning: This API should not be considered stable and might change soon.
 	ConnectionState() ConnectionState
+	// WaitForHandshakeConfirmation blocks until the handshake is confirmed, i.e. until it is known that the peer completed the handshake as well.
+	// Before that, the handshake packets might still need to be retransmitted.
+	// In gQUIC, this is the case for the server, in IETF QUIC for the client.
+	// It returns an error if the session is closed or the context is canceled before the handshake is confirmed.
+	// Warning: This API should not be considered stable and might change soon.
+	WaitForHandshakeConfirmation(context.Context) error
+	// Stats returns statistics about the data transferred on this session.
+	// Warning: This API should not be considered stable and might change soon.
+	Stats() SessionStats
+	// SetUserData attaches arbitrary data to the session, e.g. routing or authentication state.
+	// It is not used by quic-go.
+	SetUserData(interface{})
+	// UserData returns the data set by SetUserData, or nil if no data was set.
+	UserData() interface{}
+	// CongestionState returns the congestion state that was saved when the session was closed.
+	// It can be used to skip slow start on a new session to the same peer, see Config.ResumeCongestionState.
+	// It returns nil while the session is running, and if no valid congestion state was available.
+	// Warning: This API should not be considered stable and might change soon.
+	CongestionState() *CongestionState
 }
 
 // Config contains all configuration data needed for a QUIC server or client.
@@ -155,30 +365,189 @@ type Config struct {
 	// If not set, it uses all versions available.
 	// Warning: This API should not be considered stable and will change soon.
 	Versions []VersionNumber
+	// AcceptedVersions are the versions that the server accepts new connections for.
+	// It must be a subset of Versions. If not set, new connections are accepted for all Versions.
+	// Clients offering a different version receive a Version Negotiation Packet listing the AcceptedVersions.
+	// Unlike Versions, it can be changed using Listener.SetConfig,
+	// allowing staged rollouts of a new version, where only some listeners accept it.
+	// This option is only valid for the server.
+	// Warning: This API should not be considered stable and might change soon.
+	AcceptedVersions []VersionNumber
 	// Ask the server to omit the connection ID sent in the Public Header.
 	// This saves 8 bytes in the Public Header in every packet. However, if the IP address of the server changes, the connection cannot be migrated.
 	// Currently only valid for the client.
 	RequestConnectionIDOmission bool
+	// ConnectionIDLength is the length of the connection IDs that the peer uses to address this endpoint.
+	// It must be between 4 and 18 bytes. If this value is zero, 8 byte connection IDs are used.
+	// Only valid for IETF QUIC. The connection IDs used for gQUIC are always 8 bytes long.
+	ConnectionIDLength int
+	// ConnectionIDCount is the number of connection IDs that are issued to the peer (using NEW_CONNECTION_ID frames).
+	// The peer can switch to an unused connection ID when it migrates to a new network path,
+	// such that the migration can't be linked to its old path by an on-path observer.
+	// It must not be larger than 8. If this value is zero, only the connection ID chosen during the handshake is used.
+	// Only valid for IETF QUIC.
+	// Warning: This API should not be considered stable and might change soon.
+	ConnectionIDCount int
 	// HandshakeTimeout is the maximum duration that the cryptographic handshake may take.
 	// If the timeout is exceeded, the connection is closed.
 	// If this value is zero, the timeout is set to 10 seconds.
 	HandshakeTimeout time.Duration
+	// HandshakeRetransmissionTimeout is the minimum time after which handshake packets are retransmitted the first time.
+	// The timeout is never shorter than twice the RTT (or the initial RTT estimate, if no RTT was measured yet).
+	// Increasing it avoids spurious retransmissions on very high-latency links.
+	HandshakeRetransmissionTimeout time.Duration
+	// HandshakeRetransmissionBackoff is the factor by which the retransmission timeout for handshake packets
+	// grows with every retransmission. The timeout never exceeds 60 seconds.
+	// If this value is smaller than 1, it is set to 2.
+	HandshakeRetransmissionBackoff float64
+	// MaxHandshakeRetransmissions is the maximum number of times handshake packets are retransmitted
+	// without receiving an acknowledgement. If it is exceeded, the connection is closed.
+	// For a client, this limits the retransmissions of the CHLO (gQUIC) or the ClientHello (IETF QUIC).
+	// If this value is zero, handshake packets are retransmitted until the HandshakeTimeout is exceeded.
+	MaxHandshakeRetransmissions int
 	// IdleTimeout is the maximum duration that may pass without any incoming network activity.
+	// It is announced to the peer, and the smaller value of the two idle timeouts is used.
 	// This value only applies after the handshake has completed.
+	// It can be changed for an established session using Session.SetIdleTimeout.
 	// If the timeout is exceeded, the connection is closed.
 	// If this value is zero, the timeout is set to 30 seconds.
 	IdleTimeout time.Duration
+	// PathValidationTimeout is the time after which a PATH_CHALLENGE is retransmitted,
+	// when validating a new address of the peer.
+	// If this value is zero, the timeout is set to 1 second.
+	// Path validation is only used for IETF QUIC.
+	PathValidationTimeout time.Duration
+	// MaxPathValidationProbes is the maximum number of PATH_CHALLENGEs sent when validating a new address of the peer.
+	// If none of them is answered, the session continues using the old address.
+	// If this value is zero, it will default to 3.
+	MaxPathValidationProbes int
 	// AcceptCookie determines if a Cookie is accepted.
 	// It is called with cookie = nil if the client didn't send an Cookie.
 	// If not set, it verifies that the address matches, and that the Cookie was issued within the last 24 hours.
 	// This option is only valid for the server.
 	AcceptCookie func(clientAddr net.Addr, cookie *Cookie) bool
+	// AcceptCookieAcrossAddressFamilies makes the server accept Cookies that were issued for an IPv4 address
+	// from an IPv6 address, and vice versa, if the IPv6 address embeds the IPv4 address.
+	// This is the case for NAT64 addresses using the well-known prefix (64:ff9b::/96) and for 6to4 addresses (2002::/16).
+	// It avoids an additional round trip for dual-stack clients that switch between IPv4 and IPv6.
+	// Warning: This weakens the source address verification. Anyone who can send packets from the IPv6 address
+	// can use a Cookie issued for the embedded IPv4 address, and vice versa, e.g. any host behind the same NAT64 gateway.
+	// It is ignored if AcceptCookie is set.
+	// This option is only valid for the server.
+	AcceptCookieAcrossAddressFamilies bool
+	// RequireCookie makes the server reject every handshake attempt of a client that doesn't present a Cookie,
+	// even if AcceptCookie would accept it.
+	// The client then needs an additional round trip to obtain a Cookie, but the server never sends
+	// a full handshake reply to an address that wasn't validated, which limits its use for amplification attacks.
+	// This is useful if AcceptCookie is set, e.g. to accept connections without a Cookie when the server is under low load.
+	// This option is only valid for the server.
+	RequireCookie bool
+	// AcceptConnection is called for the first packet of every new connection, before any cryptographic operations are performed.
+	// It decides if the connection is accepted, dropped, or if the client first has to present a valid Cookie.
+	// If not set, all connections are accepted.
+	// This option is only valid for the server.
+	// Warning: This API should not be considered stable and might change soon.
+	AcceptConnection func(remoteAddr net.Addr, info *ClientHelloInfo) AcceptDecision
+	// MaxHandshakesPerSource is the maximum number of concurrent handshakes per source.
+	// A source is an IP address, or an address prefix (see SourcePrefixLengthIPv4 and SourcePrefixLengthIPv6).
+	// The first packets of new connections from a source that reached the limit are dropped,
+	// before any cryptographic operations are performed.
+	// If this value is zero, the number of handshakes is not limited.
+	// This option is only valid for the server.
+	// Warning: This API should not be considered stable and might change soon.
+	MaxHandshakesPerSource int
+	// MaxSessionsPerSource is the maximum number of sessions per source, including sessions that are still in the handshake.
+	// If this value is zero, the number of sessions is not limited.
+	// This option is only valid for the server.
+	// Warning: This API should not be considered stable and might change soon.
+	MaxSessionsPerSource int
+	// SourceLimits returns the limits for a new connection from the remoteAddr.
+	// If set, it is called for the first packet of every new connection, and the values it returns are used instead of
+	// MaxHandshakesPerSource and MaxSessionsPerSource.
+	// This allows applying custom policies, e.g. returning zero (no limit) for sources on an allowlist.
+	// This option is only valid for the server.
+	// Warning: This API should not be considered stable and might change soon.
+	SourceLimits func(remoteAddr net.Addr) (maxHandshakes, maxSessions int)
+	// MaxConcurrentClientHellos is the maximum number of Client Hellos that are processed concurrently (gQUIC only).
+	// When the server is overloaded, Client Hellos wait in a queue, and Client Hellos of returning clients,
+	// which present a valid Cookie and the current server config, are processed before those of new clients.
+	// If too many Client Hellos are waiting, the handshakes of new clients are aborted first.
+	// If this value is zero, it will default to the number of CPUs. If it is negative, the number is not limited.
+	// This option is only valid for the server.
+	// Warning: This API should not be considered stable and might change soon.
+	MaxConcurrentClientHellos int
+	// SourcePrefixLengthIPv4 is the length of the IPv4 address prefix that the per-source limits are applied to.
+	// If this value is zero, it will default to 32, i.e. every IPv4 address is a separate source.
+	// This option is only valid for the server.
+	// Warning: This API should not be considered stable and might change soon.
+	SourcePrefixLengthIPv4 int
+	// SourcePrefixLengthIPv6 is the length of the IPv6 address prefix that the per-source limits are applied to.
+	// If this value is zero, it will default to 64.
+	// This option is only valid for the server.
+	// Warning: This API should not be considered stable and might change soon.
+	SourcePrefixLengthIPv6 int
+	// StatelessResetKey is the key used to derive the stateless reset tokens.
+	// A server that receives a packet for a connection it doesn't have any state for sends a stateless reset,
+	// which causes the client to close the session.
+	// Servers that use the same key (e.g. multiple servers behind a load balancer)
+	// can reset each other's connections.
+	// If not set, a random key is generated when the Listener is created.
+	// This option is only valid for the server, and only used for IETF QUIC.
+	// Warning: This API should not be considered stable and might change soon.
+	StatelessResetKey []byte
+	// InitialReceiveStreamFlowControlWindow is the initial stream-level flow control window for receiving data.
+	// The window is increased by auto-tuning, up to MaxReceiveStreamFlowControlWindow.
+	// If this value is zero, it will default to 32 kB.
+	// If it is larger than MaxReceiveStreamFlowControlWindow, MaxReceiveStreamFlowControlWindow is used.
+	InitialReceiveStreamFlowControlWindow uint64
 	// MaxReceiveStreamFlowControlWindow is the maximum stream-level flow control window for receiving data.
 	// If this value is zero, it will default to 1 MB for the server and 6 MB for the client.
 	MaxReceiveStreamFlowControlWindow uint64
+	// InitialReceiveConnectionFlowControlWindow is the initial connection-level flow control window for receiving data.
+	// The window is increased by auto-tuning, up to MaxReceiveConnectionFlowControlWindow.
+	// If this value is zero, it will default to 48 kB.
+	// If it is larger than MaxReceiveConnectionFlowControlWindow, MaxReceiveConnectionFlowControlWindow is used.
+	InitialReceiveConnectionFlowControlWindow uint64
 	// MaxReceiveConnectionFlowControlWindow is the connection-level flow control window for receiving data.
 	// If this value is zero, it will default to 1.5 MB for the server and 15 MB for the client.
 	MaxReceiveConnectionFlowControlWindow uint64
+	// LimitReceiveWindowGrowth is called before a session sends a window update.
+	// If it returns true, e.g. because the application is running low on memory and the session has a low priority,
+	// auto-tuning doesn't increase the stream- and connection-level flow control windows of the session,
+	// and windows that were increased before shrink back to their initial size with the next window update.
+	// Windows that were already granted to the peer are never reduced, so the session continues to work, but at a lower throughput.
+	// It must not block, since it is called while processing packets.
+	// Warning: This API should not be considered stable and might change soon.
+	LimitReceiveWindowGrowth func(sess Session) bool
+	// MaxStreamReassemblyBuffer is the maximum number of bytes of out-of-order data that is buffered for a single stream.
+	// If the peer sends more out-of-order data, the connection is closed with a flow control error.
+	// If this value is zero, it will default to the MaxReceiveStreamFlowControlWindow.
+	MaxStreamReassemblyBuffer uint64
+	// MaxConnectionReassemblyBuffer is the maximum number of bytes of out-of-order data that is buffered for all streams.
+	// If the peer sends more out-of-order data, the connection is closed with a flow control error.
+	// If this value is zero, it will default to the MaxReceiveConnectionFlowControlWindow.
+	MaxConnectionReassemblyBuffer uint64
+	// MaxUndecryptablePackets is the maximum number of packets that are queued during the handshake
+	// because they can't be decrypted yet, e.g. because they were reordered with the packet that establishes the keys.
+	// Queued packets are decrypted as soon as the keys are available.
+	// If the queue runs full, the session is closed after a timeout, unless the packets could be decrypted in the mean time.
+	// If this value is zero or negative, it will default to 10.
+	MaxUndecryptablePackets int
+	// MaxUndecryptablePacketBytes is the maximum number of bytes of undecryptable packets that are queued during the handshake.
+	// If this value is zero, it will default to MaxUndecryptablePackets times the maximum packet size.
+	MaxUndecryptablePacketBytes uint64
+	// MaxTransientWriteErrors is the number of times writing a packet is retried when it fails with a transient error,
+	// i.e. ENOBUFS (the send buffer is full) or EPERM (e.g. the packet was rejected by a local firewall).
+	// Writes are retried with an exponential backoff. If the retries fail as well, the session is closed.
+	// The number of failed writes is reported in the SessionStats.
+	// If this value is zero, it will default to 10.
+	// If set to a negative value, the session is closed on the first failed write.
+	// Warning: This API should not be considered stable and might change soon.
+	MaxTransientWriteErrors int
+	// MaxReasonPhraseLength is the maximum length of the reason phrase of a CONNECTION_CLOSE or APPLICATION_CLOSE frame
+	// received from the peer. Longer reason phrases are truncated.
+	// If this value is zero, it will default to 1024.
+	MaxReasonPhraseLength int
 	// MaxIncomingStreams is the maximum number of concurrent bidirectional streams that a peer is allowed to open.
 	// If not set, it will default to 100.
 	// If set to a negative value, it doesn't allow any bidirectional streams.
@@ -192,6 +561,142 @@ type Config struct {
 	MaxIncomingUniStreams int
 	// KeepAlive defines whether this peer will periodically send PING frames to keep the connection alive.
 	KeepAlive bool
+	// KeepAlivePeriod is the time after which a PING frame is sent if no packet was received from the peer,
+	// as long as the session has open streams.
+	// This keeps NAT bindings and the peer's idle timer alive while the application is using the session.
+	// It should be smaller than the idle timeout.
+	// If this value is zero, PING frames are only sent if KeepAlive is set.
+	// Warning: This API should not be considered stable and might change soon.
+	KeepAlivePeriod time.Duration
+	// SendCoalescingDelay is the time that sending is delayed after the application writes data to a stream,
+	// such that data written by multiple Go routines in the mean time can be sent in fewer packets.
+	// Packets are still sent immediately when the session has to send a packet anyway, e.g. an ACK.
+	// This trades a small amount of latency for fewer packets on workloads with many small writes.
+	// If this value is zero, data is sent immediately. It is capped at 5ms.
+	// Warning: This API should not be considered stable and might change soon.
+	SendCoalescingDelay time.Duration
+	// CongestionWindowDecay determines how the congestion window is reduced when the connection starts sending after an idle period.
+	// If not set, it is halved for every retransmission timeout that the connection was idle.
+	CongestionWindowDecay CongestionWindowDecay
+	// EnableECN enables Explicit Congestion Notification (RFC 3168).
+	// Packets are marked with ECT(0), and CE marks reported by the peer are treated as a congestion signal.
+	// If the path or the peer doesn't correctly report the marks, ECN is disabled for the connection.
+	// ECN is only used with IETF QUIC, and only on platforms where the ECN bits can be set (currently Linux).
+	// Independent of this setting, the ECN marks of received packets are reported to the peer.
+	// Warning: This API should not be considered stable and might change soon.
+	EnableECN bool
+	// DSCP is the Differentiated Services Code Point (RFC 2474) that outgoing packets are marked with,
+	// allowing operators to map QUIC traffic into QoS classes. Valid values are 0 to 63.
+	// It can be overridden for a single session using Session.SetDSCP.
+	// The DSCP is only set on platforms where it can be set per packet (currently Linux).
+	// Warning: This API should not be considered stable and might change soon.
+	DSCP uint8
+	// TTL is the TTL (IPv4) or hop limit (IPv6) of outgoing packets.
+	// It can be changed for a single session using Session.SetTTL, e.g. for traceroute-like tools.
+	// If this value is zero, the default of the operating system is used.
+	// The TTL is only set on platforms where it can be set per packet (currently Linux).
+	// Warning: This API should not be considered stable and might change soon.
+	TTL uint8
+	// Features are the optional features that are announced to the peer during the handshake.
+	// Currently, the only feature that can be announced is FeatureAckFrequency.
+	// The features announced by the peer are reported in the ConnectionState.
+	// Warning: This API should not be considered stable and might change soon.
+	Features []Feature
+	// UnknownFrames determines how frames of unknown types are handled.
+	// Extension frames are always delivered to the handler registered for their frame type (if any).
+	// If not set, the session is closed when a frame of an unknown type is received.
+	UnknownFrames UnknownFramePolicy
+	// OnClose is called when a session is closed.
+	// If the session was closed due to an internal error, a DiagnosticSnapshot of the session state is passed to it,
+	// otherwise the snapshot is nil.
+	// It is called on a separate Go routine.
+	// Warning: This API should not be considered stable and might change soon.
+	OnClose func(sess Session, err error, snapshot *DiagnosticSnapshot)
+	// OnStreamCompleted is called for every stream once it is completed, i.e. when both its send and its receive side are done
+	// (because all data was sent and received, or because the stream was reset), or when the session is closed.
+	// The StreamRecord allows logging the usage of every stream, without wrapping the Read and Write calls.
+	// It is called on a separate Go routine, and might be called concurrently for different streams.
+	// Warning: This API should not be considered stable and might change soon.
+	OnStreamCompleted func(sess Session, record StreamRecord)
+	// OnInvariantViolation is called when the session detects that one of its internal invariants is violated
+	// (e.g. the flow control accounting, the monotonicity of packet numbers, or the state transitions of streams).
+	// Invariants are only checked when building with the quic_invariants build tag.
+	// Checking invariants costs CPU time, so this build mode is intended for tests and canary deployments.
+	// Violations are always logged, and the session keeps running after detecting a violation.
+	// It is called on a separate Go routine.
+	// Warning: This API should not be considered stable and might change soon.
+	OnInvariantViolation func(sess Session, v InvariantViolation)
+	// ReceiveBufferSize and SendBufferSize are the sizes that the receive and the send buffer of the UDP socket
+	// are increased to when listening or dialing, in bytes. Small buffers are a common cause of packet loss and low throughput.
+	// If zero, the buffers are increased to 2 MB. If negative, the buffer sizes are not changed.
+	// The sizes achieved are reported in the SessionStats.
+	// Warning: This API should not be considered stable and might change soon.
+	ReceiveBufferSize int
+	SendBufferSize    int
+	// OnSocketBufferWarning is called if the operating system doesn't allow increasing a socket buffer to the requested size.
+	// The warning is also logged.
+	// Warning: This API should not be considered stable and might change soon.
+	OnSocketBufferWarning func(SocketBufferWarning)
+	// DisablePathMTUDiscovery disables Path MTU Discovery.
+	// By default, the size of packets is increased beyond the default size,
+	// if probe packets show that the network path supports larger packets.
+	// MTU discovery requires setting the Don't Fragment bit, so it is only used on platforms where this is possible (currently Linux).
+	// The bit is only set on sockets used by sessions that use MTU discovery.
+	// If packets larger than the initial size are lost repeatedly, the packet size falls back to the initial size.
+	// Warning: This API should not be considered stable and might change soon.
+	DisablePathMTUDiscovery bool
+	// InitialPacketSize is the size of the UDP payload of the packets sent at the beginning of a session, in bytes.
+	// If this value is zero, it will default to 1252 bytes for IPv4 and to 1232 bytes for IPv6.
+	// It is clamped to the range from 1200 bytes to MaxPacketSize.
+	// Deployments behind tunnels (e.g. VPN or GRE) can use a smaller value to avoid IP fragmentation.
+	// Warning: This API should not be considered stable and might change soon.
+	InitialPacketSize uint16
+	// MaxPacketSize is the maximum size of the UDP payload of the packets sent, in bytes.
+	// It limits the packet size that Path MTU Discovery increases the packet size to.
+	// If this value is zero, it will default to 1452 bytes. It is clamped to the range from 1200 to 1452 bytes.
+	// Warning: This API should not be considered stable and might change soon.
+	MaxPacketSize uint16
+	// CongestionControl is the congestion control algorithm used for the session.
+	// If not set, Cubic is used. For a server, it applies to all sessions accepted by the Listener,
+	// unless ChooseCongestionControl is set.
+	// Warning: This API should not be considered stable and might change soon.
+	CongestionControl CongestionControlAlgorithm
+	// ChooseCongestionControl is called for every new connection that is accepted,
+	// and returns the congestion control algorithm used for this connection.
+	// This allows using different algorithms for different clients, e.g. NewReno for short RPC connections,
+	// and Cubic or BBRv2 for bulk transfers.
+	// If not set, CongestionControl is used for all connections.
+	// This option is only valid for the server.
+	// Warning: This API should not be considered stable and might change soon.
+	ChooseCongestionControl func(remoteAddr net.Addr, info *ClientHelloInfo) CongestionControlAlgorithm
+	// AckPolicy determines when ACKs are sent.
+	// If not set, ACKs are sent for every 2 retransmittable packets at the beginning of the connection,
+	// and for every 10 retransmittable packets later (ack decimation).
+	// Warning: This API should not be considered stable and might change soon.
+	AckPolicy AckPolicy
+	// PeerAckPolicy is the ACK policy that the peer is asked to use, by sending an ACK_FREQUENCY frame.
+	// It is only sent for IETF QUIC versions, if the peer announced FeatureAckFrequency.
+	// Endpoints that accept ACK_FREQUENCY frames from the peer have to include FeatureAckFrequency in the Features.
+	// Warning: This API should not be considered stable and might change soon.
+	PeerAckPolicy *AckPolicy
+	// ResumeCongestionState is the congestion state of a previous session to the same server.
+	// Instead of starting with the initial congestion window, the congestion window is increased to half of
+	// the saved congestion window, once the first RTT measurement shows that the RTT didn't change significantly (Careful Resume).
+	// If a packet is lost before this window was validated, the congestion window is reduced to half of
+	// what the path was shown to deliver.
+	// The state is ignored if it was saved for a different server address, or if it is older than one hour.
+	// Careful Resume is not supported by BBRv2.
+	// This option is only valid for the client.
+	// Warning: This API should not be considered stable and might change soon.
+	ResumeCongestionState *CongestionState
+	// StreamCoalescing determines if data of different streams is sent in the same packet.
+	// If not set, data of multiple streams is sent in the same packet.
+	// Warning: This API should not be considered stable and might change soon.
+	StreamCoalescing StreamCoalescingPolicy
+	// Padding determines which packets are padded to the maximum packet size.
+	// If not set, packets are only padded if required by the protocol.
+	// Warning: This API should not be considered stable and might change soon.
+	Padding PaddingPolicy
 }
 
 // A Listener for incoming QUIC connections
@@ -202,4 +707,15 @@ type Listener interface {
 	Addr() net.Addr
 	// Accept returns new sessions. It should be called in a loop.
 	Accept() (Session, error)
+	// AcceptContext returns new sessions. It should be called in a loop.
+	// If the context expires before a session is accepted, it returns the context's error.
+	// Sessions that are still being established are not affected.
+	// Warning: This API should not be considered stable and might change soon.
+	AcceptContext(ctx context.Context) (Session, error)
+	// SetConfig replaces the quic.Config used for new sessions.
+	// Sessions that were already established (or are currently being established) keep using the old config.
+	// The QUIC versions can't be changed. If config.Versions is not set, the versions of the Listener are kept.
+	// Certificates can be replaced by setting the GetCertificate callback on the tls.Config used for the Listener.
+	// Warning: This API should not be considered stable and might change soon.
+	SetConfig(config *Config) error
 }
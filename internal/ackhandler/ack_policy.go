@@ -0,0 +1,46 @@
+package ackhandler
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+// An AckPolicy determines when ACKs are sent.
+// The zero value is the default policy: An ACK is sent for every 2 retransmittable packets
+// at the beginning of the connection, and for every 10 retransmittable packets once ack decimation is used.
+type AckPolicy struct {
+	// PacketThreshold is the number of retransmittable packets received before an ACK is sent.
+	// If zero, the default thresholds are used.
+	PacketThreshold int
+	// MaxAckDelay is the maximum time that an ACK for a retransmittable packet is delayed.
+	// If zero, it defaults to 25ms. When requesting the policy from the peer, it is limited to 16.384s.
+	MaxAckDelay time.Duration
+	// IgnoreReordering disables sending ACKs early when packets are received out of order.
+	// ACKs are then only sent based on the PacketThreshold and the MaxAckDelay.
+	IgnoreReordering bool
+	// MaxAckRanges is the maximum number of ranges of received packets that are tracked.
+	// When a packet creates a new range, and this number is exceeded, the oldest range is forgotten.
+	// Packets in that range (and below) are not acknowledged any more.
+	// If zero, or larger than 1000, 1000 ranges are tracked.
+	MaxAckRanges int
+}
+
+// NewAckFrequencyFrame creates an ACK_FREQUENCY frame that asks the peer to use the policy.
+func NewAckFrequencyFrame(p AckPolicy, seq uint64) *wire.AckFrequencyFrame {
+	f := &wire.AckFrequencyFrame{
+		SequenceNumber:  seq,
+		PacketTolerance: retransmittablePacketsBeforeAck,
+		MaxAckDelay:     ackSendDelay,
+		IgnoreOrder:     p.IgnoreReordering,
+	}
+	if p.PacketThreshold > 0 {
+		f.PacketTolerance = uint64(p.PacketThreshold)
+	}
+	if p.MaxAckDelay > 0 {
+		f.MaxAckDelay = utils.MinDuration(p.MaxAckDelay, protocol.MaxAckFrequencyDelay)
+	}
+	return f
+}
@@ -0,0 +1,14 @@
+package ackhandler
+
+import "time"
+
+// The HandshakeRetransmissionPolicy determines when handshake packets are retransmitted.
+type HandshakeRetransmissionPolicy struct {
+	// MinTimeout is the minimum time after which handshake packets are retransmitted the first time.
+	MinTimeout time.Duration
+	// Backoff is the factor by which the timeout grows with every retransmission.
+	Backoff float64
+	// MaxRetransmissions is the maximum number of retransmissions without receiving an ACK.
+	// If 0, handshake packets are retransmitted until the handshake times out.
+	MaxRetransmissions int
+}
@@ -3,6 +3,7 @@ package ackhandler
 import (
 	"time"
 
+	"github.com/lucas-clemente/quic-go/internal/congestion"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 )
@@ -11,22 +12,35 @@ import (
 type SentPacketHandler interface {
 	// SentPacket may modify the packet
 	SentPacket(packet *Packet)
-	SentPacketsAsRetransmission(packets []*Packet, retransmissionOf protocol.PacketNumber)
+	// SentPacketsAsRetransmission is called for packets that retransmit the frames of the packets retransmissionOf.
+	SentPacketsAsRetransmission(packets []*Packet, retransmissionOf []protocol.PacketNumber)
 	ReceivedAck(ackFrame *wire.AckFrame, withPacketNumber protocol.PacketNumber, encLevel protocol.EncryptionLevel, recvTime time.Time) error
 	SetHandshakeComplete()
+	// SetPeerMaxAckDelay sets the maximum time that the peer delays ACKs.
+	// It is called when the peer is asked to use an ACK policy, and is included in the TLP and RTO timeouts.
+	SetPeerMaxAckDelay(time.Duration)
+	// SetMaxPacketSize sets the current max packet size.
+	// It is used to calculate how many packets the pacer allows sending.
+	SetMaxPacketSize(protocol.ByteCount)
 
 	// The SendMode determines if and what kind of packets can be sent.
 	SendMode() SendMode
 	// TimeUntilSend is the time when the next packet should be sent.
-	// It is used for pacing packets.
+	// It is used for pacing packets. It is the zero value if a packet can be sent immediately.
 	TimeUntilSend() time.Time
 	// ShouldSendNumPackets returns the number of packets that should be sent immediately.
 	// It always returns a number greater or equal than 1.
-	// A number greater than 1 is returned when the pacing delay is smaller than the minimum pacing delay.
+	// A number greater than 1 is returned when the pacer allows sending multiple packets at once.
 	// Note that the number of packets is only calculated based on the pacing algorithm.
 	// Before sending any packet, SendingAllowed() must be called to learn if we can actually send it.
 	ShouldSendNumPackets() int
 
+	// EnableECN starts marking packets with ECT(0).
+	EnableECN()
+	// ECN returns the ECN codepoint that outgoing packets should be marked with.
+	// It returns protocol.ECNNon if ECN is not enabled, or if ECN validation failed.
+	ECN() protocol.ECN
+
 	GetStopWaitingFrame(force bool) *wire.StopWaitingFrame
 	GetLowestPacketNotConfirmedAcked() protocol.PacketNumber
 	DequeuePacketForRetransmission() (packet *Packet)
@@ -34,12 +48,40 @@ type SentPacketHandler interface {
 
 	GetAlarmTimeout() time.Time
 	OnAlarm() error
+
+	// GetBytesInFlight returns the number of bytes that were sent, but not yet acknowledged or declared lost.
+	GetBytesInFlight() protocol.ByteCount
+	// GetCongestionWindow returns the current congestion window.
+	GetCongestionWindow() protocol.ByteCount
+	// GetBandwidthEstimate returns the congestion controller's current bandwidth estimate.
+	// It is 0 if the bandwidth can't be estimated yet.
+	GetBandwidthEstimate() congestion.Bandwidth
+	// GetPacingRate returns the rate that packets are currently paced at.
+	GetPacingRate() congestion.Bandwidth
+	// ResumeCongestionState passes the congestion state of a previous connection on the same path to the congestion controller.
+	// It must be called before any packet is sent.
+	ResumeCongestionState(congestion.ResumeState)
+	// GetResumeState returns the validated congestion state, such that it can be used by a future connection.
+	GetResumeState() (congestion.ResumeState, bool)
+	// GetStats returns statistics about lost packets and loss detection alarms.
+	GetStats() Stats
+}
+
+// Stats are statistics about lost packets and loss detection alarms.
+type Stats struct {
+	// PacketsLost is the number of packets declared lost, either by time-based or by threshold-based loss detection.
+	PacketsLost uint64
+	// TLPs is the number of times the tail loss probe alarm fired.
+	TLPs uint64
+	// RTOs is the number of times the retransmission timeout fired.
+	RTOs uint64
 }
 
 // ReceivedPacketHandler handles ACKs needed to send for incoming packets
 type ReceivedPacketHandler interface {
-	ReceivedPacket(packetNumber protocol.PacketNumber, rcvTime time.Time, shouldInstigateAck bool) error
+	ReceivedPacket(packetNumber protocol.PacketNumber, ecn protocol.ECN, rcvTime time.Time, shouldInstigateAck bool) error
 	IgnoreBelow(protocol.PacketNumber)
+	ReceivedAckFrequencyFrame(*wire.AckFrequencyFrame)
 
 	GetAlarmTimeout() time.Time
 	GetAckFrame() *wire.AckFrame
@@ -15,8 +15,12 @@ type Packet struct {
 	Length          protocol.ByteCount
 	EncryptionLevel protocol.EncryptionLevel
 	SendTime        time.Time
+	// IsMTUProbe is set for MTU probe packets.
+	// When they are lost, they are not retransmitted, and the loss is not reported to the congestion controller.
+	IsMTUProbe bool
 
 	largestAcked protocol.PacketNumber // if the packet contains an ACK, the LargestAcked value of that ACK
+	ecn          protocol.ECN          // the ECN codepoint the packet was sent with
 
 	// There are two reasons why a packet cannot be retransmitted:
 	// * it was already retransmitted
@@ -24,6 +28,7 @@ type Packet struct {
 	canBeRetransmitted      bool
 	includedInBytesInFlight bool
 	retransmittedAs         []protocol.PacketNumber
-	isRetransmission        bool // we need a separate bool here because 0 is a valid packet number
-	retransmissionOf        protocol.PacketNumber
+	// A retransmission can contain frames of multiple packets.
+	// A packet number is removed from this slice when that packet is acked.
+	retransmissionOf []protocol.PacketNumber
 }
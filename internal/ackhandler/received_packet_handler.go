@@ -18,6 +18,12 @@ type receivedPacketHandler struct {
 
 	ackSendDelay time.Duration
 	rttStats     *congestion.RTTStats
+	// the number of retransmittable packets that an ACK is sent for, if set by the AckPolicy or by the peer
+	packetThreshold  int
+	ignoreReordering bool
+	// the sequence number of the last ACK_FREQUENCY frame received
+	ackFrequencySeq      uint64
+	receivedAckFrequency bool
 
 	packetsReceivedSinceLastAck                int
 	retransmittablePacketsReceivedSinceLastAck int
@@ -25,6 +31,9 @@ type receivedPacketHandler struct {
 	ackAlarm                                   time.Time
 	lastAck                                    *wire.AckFrame
 
+	// ECN counts of all packets received, as reported in the ACK frame
+	ect0, ect1, ecnce uint64
+
 	logger utils.Logger
 
 	version protocol.VersionNumber
@@ -56,19 +65,43 @@ const (
 // NewReceivedPacketHandler creates a new receivedPacketHandler
 func NewReceivedPacketHandler(
 	rttStats *congestion.RTTStats,
+	policy AckPolicy,
 	logger utils.Logger,
 	version protocol.VersionNumber,
 ) ReceivedPacketHandler {
-	return &receivedPacketHandler{
-		packetHistory: newReceivedPacketHistory(),
-		ackSendDelay:  ackSendDelay,
-		rttStats:      rttStats,
-		logger:        logger,
-		version:       version,
+	maxAckRanges := protocol.MaxTrackedReceivedAckRanges
+	if policy.MaxAckRanges > 0 {
+		maxAckRanges = utils.Min(policy.MaxAckRanges, protocol.MaxTrackedReceivedAckRanges)
+	}
+	h := &receivedPacketHandler{
+		packetHistory:    newReceivedPacketHistory(maxAckRanges),
+		ackSendDelay:     ackSendDelay,
+		rttStats:         rttStats,
+		packetThreshold:  policy.PacketThreshold,
+		ignoreReordering: policy.IgnoreReordering,
+		logger:           logger,
+		version:          version,
+	}
+	if policy.MaxAckDelay > 0 {
+		h.ackSendDelay = policy.MaxAckDelay
+	}
+	return h
+}
+
+// ReceivedAckFrequencyFrame applies the ACK policy requested by the peer.
+// Frames that were reordered, i.e. that have a lower sequence number than a frame received before, are ignored.
+func (h *receivedPacketHandler) ReceivedAckFrequencyFrame(f *wire.AckFrequencyFrame) {
+	if h.receivedAckFrequency && f.SequenceNumber <= h.ackFrequencySeq {
+		return
 	}
+	h.receivedAckFrequency = true
+	h.ackFrequencySeq = f.SequenceNumber
+	h.packetThreshold = int(utils.MinUint64(f.PacketTolerance, protocol.MaxAckFrequencyPacketTolerance))
+	h.ackSendDelay = utils.MinDuration(f.MaxAckDelay, protocol.MaxAckFrequencyDelay)
+	h.ignoreReordering = f.IgnoreOrder
 }
 
-func (h *receivedPacketHandler) ReceivedPacket(packetNumber protocol.PacketNumber, rcvTime time.Time, shouldInstigateAck bool) error {
+func (h *receivedPacketHandler) ReceivedPacket(packetNumber protocol.PacketNumber, ecn protocol.ECN, rcvTime time.Time, shouldInstigateAck bool) error {
 	if packetNumber < h.ignoreBelow {
 		return nil
 	}
@@ -79,10 +112,16 @@ func (h *receivedPacketHandler) ReceivedPacket(packetNumber protocol.PacketNumbe
 		h.largestObservedReceivedTime = rcvTime
 	}
 
-	if err := h.packetHistory.ReceivedPacket(packetNumber); err != nil {
-		return err
+	h.packetHistory.ReceivedPacket(packetNumber)
+	switch ecn {
+	case protocol.ECT0:
+		h.ect0++
+	case protocol.ECT1:
+		h.ect1++
+	case protocol.ECNCE:
+		h.ecnce++
 	}
-	h.maybeQueueAck(packetNumber, rcvTime, shouldInstigateAck, isMissing)
+	h.maybeQueueAck(packetNumber, ecn, rcvTime, shouldInstigateAck, isMissing)
 	return nil
 }
 
@@ -118,7 +157,7 @@ func (h *receivedPacketHandler) hasNewMissingPackets() bool {
 // maybeQueueAck queues an ACK, if necessary.
 // It is implemented analogously to Chrome's QuicConnection::MaybeQueueAck()
 // in ACK_DECIMATION_WITH_REORDERING mode.
-func (h *receivedPacketHandler) maybeQueueAck(packetNumber protocol.PacketNumber, rcvTime time.Time, shouldInstigateAck, wasMissing bool) {
+func (h *receivedPacketHandler) maybeQueueAck(packetNumber protocol.PacketNumber, ecn protocol.ECN, rcvTime time.Time, shouldInstigateAck, wasMissing bool) {
 	h.packetsReceivedSinceLastAck++
 
 	// always ack the first packet
@@ -131,17 +170,39 @@ func (h *receivedPacketHandler) maybeQueueAck(packetNumber protocol.PacketNumber
 	// Send an ACK if this packet was reported missing in an ACK sent before.
 	// Ack decimation with reordering relies on the timer to send an ACK, but if
 	// missing packets we reported in the previous ack, send an ACK immediately.
-	if wasMissing {
+	if wasMissing && !h.ignoreReordering {
 		if h.logger.Debug() {
 			h.logger.Debugf("\tQueueing ACK because packet %#x was missing before.", packetNumber)
 		}
 		h.ackQueued = true
 	}
 
+	// Send an ACK immediately if the packet was CE marked,
+	// so that the peer can react to the congestion as quickly as possible.
+	if ecn == protocol.ECNCE {
+		if h.logger.Debug() {
+			h.logger.Debugf("\tQueueing ACK because packet %#x was CE marked.", packetNumber)
+		}
+		h.ackQueued = true
+	}
+
 	if !h.ackQueued && shouldInstigateAck {
 		h.retransmittablePacketsReceivedSinceLastAck++
 
-		if packetNumber > minReceivedBeforeAckDecimation {
+		if h.packetThreshold > 0 {
+			// use the threshold configured by the AckPolicy, or requested by the peer
+			if h.retransmittablePacketsReceivedSinceLastAck >= h.packetThreshold {
+				h.ackQueued = true
+				if h.logger.Debug() {
+					h.logger.Debugf("\tQueueing ACK because packet %d packets were received after the last ACK (using configured threshold: %d).", h.retransmittablePacketsReceivedSinceLastAck, h.packetThreshold)
+				}
+			} else if h.ackAlarm.IsZero() {
+				if h.logger.Debug() {
+					h.logger.Debugf("\tSetting ACK timer to max ack delay: %s", h.ackSendDelay)
+				}
+				h.ackAlarm = rcvTime.Add(h.ackSendDelay)
+			}
+		} else if packetNumber > minReceivedBeforeAckDecimation {
 			// ack up to 10 packets at once
 			if h.retransmittablePacketsReceivedSinceLastAck >= retransmittablePacketsBeforeAck {
 				h.ackQueued = true
@@ -150,7 +211,7 @@ func (h *receivedPacketHandler) maybeQueueAck(packetNumber protocol.PacketNumber
 				}
 			} else if h.ackAlarm.IsZero() {
 				// wait for the minimum of the ack decimation delay or the delayed ack time before sending an ack
-				ackDelay := utils.MinDuration(ackSendDelay, time.Duration(float64(h.rttStats.MinRTT())*float64(ackDecimationDelay)))
+				ackDelay := utils.MinDuration(h.ackSendDelay, time.Duration(float64(h.rttStats.MinRTT())*float64(ackDecimationDelay)))
 				h.ackAlarm = rcvTime.Add(ackDelay)
 				if h.logger.Debug() {
 					h.logger.Debugf("\tSetting ACK timer to min(1/4 min-RTT, max ack delay): %s (%s from now)", ackDelay, time.Until(h.ackAlarm))
@@ -165,13 +226,13 @@ func (h *receivedPacketHandler) maybeQueueAck(packetNumber protocol.PacketNumber
 				h.ackQueued = true
 			} else if h.ackAlarm.IsZero() {
 				if h.logger.Debug() {
-					h.logger.Debugf("\tSetting ACK timer to max ack delay: %s", ackSendDelay)
+					h.logger.Debugf("\tSetting ACK timer to max ack delay: %s", h.ackSendDelay)
 				}
-				h.ackAlarm = rcvTime.Add(ackSendDelay)
+				h.ackAlarm = rcvTime.Add(h.ackSendDelay)
 			}
 		}
 		// If there are new missing packets to report, set a short timer to send an ACK.
-		if h.hasNewMissingPackets() {
+		if !h.ignoreReordering && h.hasNewMissingPackets() {
 			// wait the minimum of 1/8 min RTT and the existing ack time
 			ackDelay := time.Duration(float64(h.rttStats.MinRTT()) * float64(shortAckDecimationDelay))
 			ackTime := rcvTime.Add(ackDelay)
@@ -202,6 +263,9 @@ func (h *receivedPacketHandler) GetAckFrame() *wire.AckFrame {
 	ack := &wire.AckFrame{
 		AckRanges: h.packetHistory.GetAckRanges(),
 		DelayTime: now.Sub(h.largestObservedReceivedTime),
+		ECT0:      h.ect0,
+		ECT1:      h.ect1,
+		ECNCE:     h.ecnce,
 	}
 
 	h.lastAck = ack
@@ -20,21 +20,21 @@ var _ = Describe("receivedPacketHandler", func() {
 
 	BeforeEach(func() {
 		rttStats = &congestion.RTTStats{}
-		handler = NewReceivedPacketHandler(rttStats, utils.DefaultLogger, protocol.VersionWhatever).(*receivedPacketHandler)
+		handler = NewReceivedPacketHandler(rttStats, AckPolicy{}, utils.DefaultLogger, protocol.VersionWhatever).(*receivedPacketHandler)
 	})
 
 	Context("accepting packets", func() {
 		It("handles a packet that arrives late", func() {
-			err := handler.ReceivedPacket(protocol.PacketNumber(1), time.Time{}, true)
+			err := handler.ReceivedPacket(protocol.PacketNumber(1), protocol.ECNNon, time.Time{}, true)
 			Expect(err).ToNot(HaveOccurred())
-			err = handler.ReceivedPacket(protocol.PacketNumber(3), time.Time{}, true)
+			err = handler.ReceivedPacket(protocol.PacketNumber(3), protocol.ECNNon, time.Time{}, true)
 			Expect(err).ToNot(HaveOccurred())
-			err = handler.ReceivedPacket(protocol.PacketNumber(2), time.Time{}, true)
+			err = handler.ReceivedPacket(protocol.PacketNumber(2), protocol.ECNNon, time.Time{}, true)
 			Expect(err).ToNot(HaveOccurred())
 		})
 
 		It("saves the time when each packet arrived", func() {
-			err := handler.ReceivedPacket(protocol.PacketNumber(3), time.Now(), true)
+			err := handler.ReceivedPacket(protocol.PacketNumber(3), protocol.ECNNon, time.Now(), true)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(handler.largestObservedReceivedTime).To(BeTemporally("~", time.Now(), 10*time.Millisecond))
 		})
@@ -43,7 +43,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			now := time.Now()
 			handler.largestObserved = 3
 			handler.largestObservedReceivedTime = now.Add(-1 * time.Second)
-			err := handler.ReceivedPacket(5, now, true)
+			err := handler.ReceivedPacket(5, protocol.ECNNon, now, true)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(handler.largestObserved).To(Equal(protocol.PacketNumber(5)))
 			Expect(handler.largestObservedReceivedTime).To(Equal(now))
@@ -54,23 +54,27 @@ var _ = Describe("receivedPacketHandler", func() {
 			timestamp := now.Add(-1 * time.Second)
 			handler.largestObserved = 5
 			handler.largestObservedReceivedTime = timestamp
-			err := handler.ReceivedPacket(4, now, true)
+			err := handler.ReceivedPacket(4, protocol.ECNNon, now, true)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(handler.largestObserved).To(Equal(protocol.PacketNumber(5)))
 			Expect(handler.largestObservedReceivedTime).To(Equal(timestamp))
 		})
 
-		It("passes on errors from receivedPacketHistory", func() {
-			var err error
+		It("limits the number of ACK ranges", func() {
 			for i := protocol.PacketNumber(0); i < 5*protocol.MaxTrackedReceivedAckRanges; i++ {
-				err = handler.ReceivedPacket(2*i+1, time.Time{}, true)
-				// this will eventually return an error
-				// details about when exactly the receivedPacketHistory errors are tested there
-				if err != nil {
-					break
-				}
+				Expect(handler.ReceivedPacket(2*i+1, protocol.ECNNon, time.Time{}, true)).To(Succeed())
+			}
+			Expect(handler.packetHistory.GetAckRanges()).To(HaveLen(protocol.MaxTrackedReceivedAckRanges))
+		})
+
+		It("uses the maximum number of ACK ranges from the ACK policy", func() {
+			handler = NewReceivedPacketHandler(&congestion.RTTStats{}, AckPolicy{MaxAckRanges: 10}, utils.DefaultLogger, protocol.VersionWhatever).(*receivedPacketHandler)
+			for i := protocol.PacketNumber(0); i < 100; i++ {
+				Expect(handler.ReceivedPacket(2*i+1, protocol.ECNNon, time.Time{}, true)).To(Succeed())
 			}
-			Expect(err).To(MatchError(errTooManyOutstandingReceivedAckRanges))
+			ranges := handler.packetHistory.GetAckRanges()
+			Expect(ranges).To(HaveLen(10))
+			Expect(ranges[0]).To(Equal(wire.AckRange{Smallest: 199, Largest: 199}))
 		})
 	})
 
@@ -78,7 +82,7 @@ var _ = Describe("receivedPacketHandler", func() {
 		Context("queueing ACKs", func() {
 			receiveAndAck10Packets := func() {
 				for i := 1; i <= 10; i++ {
-					err := handler.ReceivedPacket(protocol.PacketNumber(i), time.Time{}, true)
+					err := handler.ReceivedPacket(protocol.PacketNumber(i), protocol.ECNNon, time.Time{}, true)
 					Expect(err).ToNot(HaveOccurred())
 				}
 				Expect(handler.GetAckFrame()).ToNot(BeNil())
@@ -87,7 +91,7 @@ var _ = Describe("receivedPacketHandler", func() {
 
 			receiveAndAckPacketsUntilAckDecimation := func() {
 				for i := 1; i <= minReceivedBeforeAckDecimation; i++ {
-					err := handler.ReceivedPacket(protocol.PacketNumber(i), time.Time{}, true)
+					err := handler.ReceivedPacket(protocol.PacketNumber(i), protocol.ECNNon, time.Time{}, true)
 					Expect(err).ToNot(HaveOccurred())
 				}
 				Expect(handler.GetAckFrame()).ToNot(BeNil())
@@ -95,14 +99,14 @@ var _ = Describe("receivedPacketHandler", func() {
 			}
 
 			It("always queues an ACK for the first packet", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, false)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, false)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeTrue())
 				Expect(handler.GetAlarmTimeout()).To(BeZero())
 			})
 
 			It("works with packet number 0", func() {
-				err := handler.ReceivedPacket(0, time.Time{}, false)
+				err := handler.ReceivedPacket(0, protocol.ECNNon, time.Time{}, false)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeTrue())
 				Expect(handler.GetAlarmTimeout()).To(BeZero())
@@ -112,11 +116,11 @@ var _ = Describe("receivedPacketHandler", func() {
 				receiveAndAck10Packets()
 				p := protocol.PacketNumber(11)
 				for i := 0; i <= 20; i++ {
-					err := handler.ReceivedPacket(p, time.Time{}, true)
+					err := handler.ReceivedPacket(p, protocol.ECNNon, time.Time{}, true)
 					Expect(err).ToNot(HaveOccurred())
 					Expect(handler.ackQueued).To(BeFalse())
 					p++
-					err = handler.ReceivedPacket(p, time.Time{}, true)
+					err = handler.ReceivedPacket(p, protocol.ECNNon, time.Time{}, true)
 					Expect(err).ToNot(HaveOccurred())
 					Expect(handler.ackQueued).To(BeTrue())
 					p++
@@ -129,13 +133,13 @@ var _ = Describe("receivedPacketHandler", func() {
 				receiveAndAck10Packets()
 				p := protocol.PacketNumber(10000)
 				for i := 0; i < 9; i++ {
-					err := handler.ReceivedPacket(p, time.Now(), true)
+					err := handler.ReceivedPacket(p, protocol.ECNNon, time.Now(), true)
 					Expect(err).ToNot(HaveOccurred())
 					Expect(handler.ackQueued).To(BeFalse())
 					p++
 				}
 				Expect(handler.GetAlarmTimeout()).NotTo(BeZero())
-				err := handler.ReceivedPacket(p, time.Now(), true)
+				err := handler.ReceivedPacket(p, protocol.ECNNon, time.Now(), true)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeTrue())
 				Expect(handler.GetAlarmTimeout()).To(BeZero())
@@ -143,28 +147,39 @@ var _ = Describe("receivedPacketHandler", func() {
 
 			It("only sets the timer when receiving a retransmittable packets", func() {
 				receiveAndAck10Packets()
-				err := handler.ReceivedPacket(11, time.Now(), false)
+				err := handler.ReceivedPacket(11, protocol.ECNNon, time.Now(), false)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeFalse())
 				Expect(handler.GetAlarmTimeout()).To(BeZero())
 				rcvTime := time.Now().Add(10 * time.Millisecond)
-				err = handler.ReceivedPacket(12, rcvTime, true)
+				err = handler.ReceivedPacket(12, protocol.ECNNon, rcvTime, true)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeFalse())
 				Expect(handler.GetAlarmTimeout()).To(Equal(rcvTime.Add(ackSendDelay)))
 			})
 
+			It("queues an ACK for a CE marked packet", func() {
+				receiveAndAck10Packets()
+				err := handler.ReceivedPacket(11, protocol.ECT0, time.Now(), true)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(handler.ackQueued).To(BeFalse())
+				err = handler.ReceivedPacket(12, protocol.ECNCE, time.Now(), false)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(handler.ackQueued).To(BeTrue())
+				Expect(handler.GetAlarmTimeout()).To(BeZero())
+			})
+
 			It("queues an ACK if it was reported missing before", func() {
 				receiveAndAck10Packets()
-				err := handler.ReceivedPacket(11, time.Time{}, true)
+				err := handler.ReceivedPacket(11, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(13, time.Time{}, true)
+				err = handler.ReceivedPacket(13, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame() // ACK: 1-11 and 13, missing: 12
 				Expect(ack).ToNot(BeNil())
 				Expect(ack.HasMissingRanges()).To(BeTrue())
 				Expect(handler.ackQueued).To(BeFalse())
-				err = handler.ReceivedPacket(12, time.Time{}, false)
+				err = handler.ReceivedPacket(12, protocol.ECNNon, time.Time{}, false)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeTrue())
 			})
@@ -172,15 +187,15 @@ var _ = Describe("receivedPacketHandler", func() {
 			It("doesn't queue an ACK if it was reported missing before, but is below the threshold", func() {
 				receiveAndAck10Packets()
 				// 11 is missing
-				err := handler.ReceivedPacket(12, time.Time{}, true)
+				err := handler.ReceivedPacket(12, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(13, time.Time{}, true)
+				err = handler.ReceivedPacket(13, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame() // ACK: 1-10, 12-13
 				Expect(ack).ToNot(BeNil())
 				// now receive 11
 				handler.IgnoreBelow(12)
-				err = handler.ReceivedPacket(11, time.Time{}, false)
+				err = handler.ReceivedPacket(11, protocol.ECNNon, time.Time{}, false)
 				Expect(err).ToNot(HaveOccurred())
 				ack = handler.GetAckFrame()
 				Expect(ack).To(BeNil())
@@ -189,11 +204,11 @@ var _ = Describe("receivedPacketHandler", func() {
 			It("doesn't queue an ACK if the packet closes a gap that was not yet reported", func() {
 				receiveAndAckPacketsUntilAckDecimation()
 				p := protocol.PacketNumber(minReceivedBeforeAckDecimation + 1)
-				err := handler.ReceivedPacket(p+1, time.Now(), true) // p is missing now
+				err := handler.ReceivedPacket(p+1, protocol.ECNNon, time.Now(), true) // p is missing now
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeFalse())
 				Expect(handler.GetAlarmTimeout()).ToNot(BeZero())
-				err = handler.ReceivedPacket(p, time.Now(), true) // p is not missing any more
+				err = handler.ReceivedPacket(p, protocol.ECNNon, time.Now(), true) // p is not missing any more
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeFalse())
 			})
@@ -205,10 +220,10 @@ var _ = Describe("receivedPacketHandler", func() {
 				receiveAndAckPacketsUntilAckDecimation()
 				p := protocol.PacketNumber(minReceivedBeforeAckDecimation + 1)
 				for i := p; i < p+6; i++ {
-					err := handler.ReceivedPacket(i, now, true)
+					err := handler.ReceivedPacket(i, protocol.ECNNon, now, true)
 					Expect(err).ToNot(HaveOccurred())
 				}
-				err := handler.ReceivedPacket(p+10, now, true) // we now know that packets p+7, p+8 and p+9
+				err := handler.ReceivedPacket(p+10, protocol.ECNNon, now, true) // we now know that packets p+7, p+8 and p+9
 				Expect(err).ToNot(HaveOccurred())
 				Expect(rttStats.MinRTT()).To(Equal(rtt))
 				Expect(handler.ackAlarm.Sub(now)).To(Equal(rtt / 8))
@@ -218,15 +233,122 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 		})
 
+		Context("using a custom ACK policy", func() {
+			// receiveAndAck receives and acknowledges packets 1 to 10
+			receiveAndAck := func() {
+				for i := 1; i <= 10; i++ {
+					Expect(handler.ReceivedPacket(protocol.PacketNumber(i), protocol.ECNNon, time.Now(), true)).To(Succeed())
+				}
+				Expect(handler.GetAckFrame()).ToNot(BeNil())
+			}
+
+			It("queues an ACK for every Nth retransmittable packet", func() {
+				handler = NewReceivedPacketHandler(rttStats, AckPolicy{PacketThreshold: 4}, utils.DefaultLogger, protocol.VersionWhatever).(*receivedPacketHandler)
+				receiveAndAck()
+				for p := protocol.PacketNumber(11); p < 14; p++ {
+					Expect(handler.ReceivedPacket(p, protocol.ECNNon, time.Now(), true)).To(Succeed())
+					Expect(handler.ackQueued).To(BeFalse())
+				}
+				Expect(handler.ReceivedPacket(14, protocol.ECNNon, time.Now(), true)).To(Succeed())
+				Expect(handler.ackQueued).To(BeTrue())
+			})
+
+			It("uses the threshold after ack decimation started", func() {
+				handler = NewReceivedPacketHandler(rttStats, AckPolicy{PacketThreshold: 20}, utils.DefaultLogger, protocol.VersionWhatever).(*receivedPacketHandler)
+				receiveAndAck()
+				p := protocol.PacketNumber(10000)
+				for i := 0; i < 19; i++ {
+					Expect(handler.ReceivedPacket(p, protocol.ECNNon, time.Now(), true)).To(Succeed())
+					Expect(handler.ackQueued).To(BeFalse())
+					p++
+				}
+				Expect(handler.ReceivedPacket(p, protocol.ECNNon, time.Now(), true)).To(Succeed())
+				Expect(handler.ackQueued).To(BeTrue())
+			})
+
+			It("uses the max ack delay", func() {
+				handler = NewReceivedPacketHandler(rttStats, AckPolicy{MaxAckDelay: 100 * time.Millisecond}, utils.DefaultLogger, protocol.VersionWhatever).(*receivedPacketHandler)
+				receiveAndAck()
+				rcvTime := time.Now()
+				Expect(handler.ReceivedPacket(11, protocol.ECNNon, rcvTime, true)).To(Succeed())
+				Expect(handler.GetAlarmTimeout()).To(Equal(rcvTime.Add(100 * time.Millisecond)))
+			})
+
+			It("doesn't queue an ACK for reordered packets, if reordering is ignored", func() {
+				handler = NewReceivedPacketHandler(rttStats, AckPolicy{IgnoreReordering: true}, utils.DefaultLogger, protocol.VersionWhatever).(*receivedPacketHandler)
+				rttStats.UpdateRTT(80*time.Millisecond, 0, time.Now())
+				receiveAndAck()
+				// a new missing range doesn't shorten the ACK timer
+				rcvTime := time.Now().Add(-time.Hour)
+				Expect(handler.ReceivedPacket(12, protocol.ECNNon, rcvTime, true)).To(Succeed())
+				Expect(handler.GetAlarmTimeout()).To(Equal(rcvTime.Add(ackSendDelay)))
+				ack := handler.GetAckFrame() // ACK: 1-10 and 12, missing: 11
+				Expect(ack).ToNot(BeNil())
+				Expect(ack.HasMissingRanges()).To(BeTrue())
+				// a packet that was reported missing doesn't cause an immediate ACK
+				Expect(handler.ReceivedPacket(11, protocol.ECNNon, time.Now(), false)).To(Succeed())
+				Expect(handler.ackQueued).To(BeFalse())
+			})
+
+			It("applies the policy requested in an ACK_FREQUENCY frame", func() {
+				handler.ReceivedAckFrequencyFrame(&wire.AckFrequencyFrame{
+					SequenceNumber:  1,
+					PacketTolerance: 5,
+					MaxAckDelay:     50 * time.Millisecond,
+					IgnoreOrder:     true,
+				})
+				Expect(handler.packetThreshold).To(Equal(5))
+				Expect(handler.ackSendDelay).To(Equal(50 * time.Millisecond))
+				Expect(handler.ignoreReordering).To(BeTrue())
+			})
+
+			It("limits the packet tolerance requested in an ACK_FREQUENCY frame", func() {
+				handler.ReceivedAckFrequencyFrame(&wire.AckFrequencyFrame{
+					SequenceNumber:  1,
+					PacketTolerance: 1 << 40,
+				})
+				Expect(handler.packetThreshold).To(Equal(protocol.MaxAckFrequencyPacketTolerance))
+			})
+
+			It("limits the ACK delay requested in an ACK_FREQUENCY frame", func() {
+				handler.ReceivedAckFrequencyFrame(&wire.AckFrequencyFrame{
+					SequenceNumber:  1,
+					PacketTolerance: 2,
+					MaxAckDelay:     time.Hour,
+				})
+				Expect(handler.ackSendDelay).To(Equal(protocol.MaxAckFrequencyDelay))
+			})
+
+			It("ignores reordered ACK_FREQUENCY frames", func() {
+				handler.ReceivedAckFrequencyFrame(&wire.AckFrequencyFrame{
+					SequenceNumber:  0,
+					PacketTolerance: 5,
+				})
+				handler.ReceivedAckFrequencyFrame(&wire.AckFrequencyFrame{
+					SequenceNumber:  2,
+					PacketTolerance: 6,
+				})
+				handler.ReceivedAckFrequencyFrame(&wire.AckFrequencyFrame{
+					SequenceNumber:  1,
+					PacketTolerance: 7,
+				})
+				handler.ReceivedAckFrequencyFrame(&wire.AckFrequencyFrame{
+					SequenceNumber:  2,
+					PacketTolerance: 8,
+				})
+				Expect(handler.packetThreshold).To(Equal(6))
+			})
+		})
+
 		Context("ACK generation", func() {
 			BeforeEach(func() {
 				handler.ackQueued = true
 			})
 
 			It("generates a simple ACK frame", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(2, time.Time{}, true)
+				err = handler.ReceivedPacket(2, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -236,7 +358,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("generates an ACK for packet number 0", func() {
-				err := handler.ReceivedPacket(0, time.Time{}, true)
+				err := handler.ReceivedPacket(0, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -246,22 +368,51 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("sets the delay time", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(2, time.Now().Add(-1337*time.Millisecond), true)
+				err = handler.ReceivedPacket(2, protocol.ECNNon, time.Now().Add(-1337*time.Millisecond), true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
 				Expect(ack.DelayTime).To(BeNumerically("~", 1337*time.Millisecond, 50*time.Millisecond))
 			})
 
+			It("reports the ECN counts", func() {
+				for i, ecn := range []protocol.ECN{protocol.ECT0, protocol.ECNNon, protocol.ECT0, protocol.ECT1, protocol.ECNCE} {
+					err := handler.ReceivedPacket(protocol.PacketNumber(i+1), ecn, time.Time{}, true)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				ack := handler.GetAckFrame()
+				Expect(ack).ToNot(BeNil())
+				Expect(ack.ECT0).To(BeEquivalentTo(2))
+				Expect(ack.ECT1).To(BeEquivalentTo(1))
+				Expect(ack.ECNCE).To(BeEquivalentTo(1))
+				// the counts are cumulative
+				handler.ackQueued = true
+				err := handler.ReceivedPacket(6, protocol.ECT0, time.Time{}, true)
+				Expect(err).ToNot(HaveOccurred())
+				ack = handler.GetAckFrame()
+				Expect(ack).ToNot(BeNil())
+				Expect(ack.ECT0).To(BeEquivalentTo(3))
+				Expect(ack.ECT1).To(BeEquivalentTo(1))
+				Expect(ack.ECNCE).To(BeEquivalentTo(1))
+			})
+
+			It("doesn't report ECN counts if no packets were marked", func() {
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
+				Expect(err).ToNot(HaveOccurred())
+				ack := handler.GetAckFrame()
+				Expect(ack).ToNot(BeNil())
+				Expect(ack.HasECN()).To(BeFalse())
+			})
+
 			It("saves the last sent ACK", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
 				Expect(handler.lastAck).To(Equal(ack))
-				err = handler.ReceivedPacket(2, time.Time{}, true)
+				err = handler.ReceivedPacket(2, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				handler.ackQueued = true
 				ack = handler.GetAckFrame()
@@ -270,9 +421,9 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("generates an ACK frame with missing packets", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(4, time.Time{}, true)
+				err = handler.ReceivedPacket(4, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -285,11 +436,11 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("generates an ACK for packet number 0 and other packets", func() {
-				err := handler.ReceivedPacket(0, time.Time{}, true)
+				err := handler.ReceivedPacket(0, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(1, time.Time{}, true)
+				err = handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(3, time.Time{}, true)
+				err = handler.ReceivedPacket(3, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -303,15 +454,15 @@ var _ = Describe("receivedPacketHandler", func() {
 
 			It("accepts packets below the lower limit", func() {
 				handler.IgnoreBelow(6)
-				err := handler.ReceivedPacket(2, time.Time{}, true)
+				err := handler.ReceivedPacket(2, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 			})
 
 			It("doesn't add delayed packets to the packetHistory", func() {
 				handler.IgnoreBelow(7)
-				err := handler.ReceivedPacket(4, time.Time{}, true)
+				err := handler.ReceivedPacket(4, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(10, time.Time{}, true)
+				err = handler.ReceivedPacket(10, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -321,7 +472,7 @@ var _ = Describe("receivedPacketHandler", func() {
 
 			It("deletes packets from the packetHistory when a lower limit is set", func() {
 				for i := 1; i <= 12; i++ {
-					err := handler.ReceivedPacket(protocol.PacketNumber(i), time.Time{}, true)
+					err := handler.ReceivedPacket(protocol.PacketNumber(i), protocol.ECNNon, time.Time{}, true)
 					Expect(err).ToNot(HaveOccurred())
 				}
 				handler.IgnoreBelow(7)
@@ -336,7 +487,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			// TODO: remove this test when dropping support for STOP_WAITINGs
 			It("handles a lower limit of 0", func() {
 				handler.IgnoreBelow(0)
-				err := handler.ReceivedPacket(1337, time.Time{}, true)
+				err := handler.ReceivedPacket(1337, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -344,7 +495,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("resets all counters needed for the ACK queueing decision when sending an ACK", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				handler.ackAlarm = time.Now().Add(-time.Minute)
 				Expect(handler.GetAckFrame()).ToNot(BeNil())
@@ -355,7 +506,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("doesn't generate an ACK when none is queued and the timer is not set", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				handler.ackQueued = false
 				handler.ackAlarm = time.Time{}
@@ -363,7 +514,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("doesn't generate an ACK when none is queued and the timer has not yet expired", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				handler.ackQueued = false
 				handler.ackAlarm = time.Now().Add(time.Minute)
@@ -371,7 +522,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("generates an ACK when the timer has expired", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				handler.ackQueued = false
 				handler.ackAlarm = time.Now().Add(-time.Minute)
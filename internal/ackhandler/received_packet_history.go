@@ -4,41 +4,51 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
-	"github.com/lucas-clemente/quic-go/qerr"
 )
 
 // The receivedPacketHistory stores if a packet number has already been received.
 // It does not store packet contents.
 type receivedPacketHistory struct {
 	ranges *utils.PacketIntervalList
+	// the maximum number of ranges. When exceeded, the oldest range is deleted.
+	maxRanges int
 
 	lowestInReceivedPacketNumbers protocol.PacketNumber
 }
 
-var errTooManyOutstandingReceivedAckRanges = qerr.Error(qerr.TooManyOutstandingReceivedPackets, "Too many outstanding received ACK ranges")
-
 // newReceivedPacketHistory creates a new received packet history
-func newReceivedPacketHistory() *receivedPacketHistory {
+func newReceivedPacketHistory(maxRanges int) *receivedPacketHistory {
 	return &receivedPacketHistory{
-		ranges: utils.NewPacketIntervalList(),
+		ranges:    utils.NewPacketIntervalList(),
+		maxRanges: maxRanges,
 	}
 }
 
-// ReceivedPacket registers a packet with PacketNumber p and updates the ranges
-func (h *receivedPacketHistory) ReceivedPacket(p protocol.PacketNumber) error {
-	if h.ranges.Len() >= protocol.MaxTrackedReceivedAckRanges {
-		return errTooManyOutstandingReceivedAckRanges
+// ReceivedPacket registers a packet with PacketNumber p and updates the ranges.
+// Packets below the ranges that were already deleted are ignored.
+func (h *receivedPacketHistory) ReceivedPacket(p protocol.PacketNumber) {
+	if p < h.lowestInReceivedPacketNumbers {
+		return
+	}
+	h.addToRanges(p)
+	// Under heavy reordering or loss, the number of ranges might grow very large.
+	// Only the most recent ranges are reported in ACK frames anyway, so just delete the oldest ranges.
+	for h.ranges.Len() > h.maxRanges {
+		h.lowestInReceivedPacketNumbers = h.ranges.Front().Value.End + 1
+		h.ranges.Remove(h.ranges.Front())
 	}
+}
 
+func (h *receivedPacketHistory) addToRanges(p protocol.PacketNumber) {
 	if h.ranges.Len() == 0 {
 		h.ranges.PushBack(utils.PacketInterval{Start: p, End: p})
-		return nil
+		return
 	}
 
 	for el := h.ranges.Back(); el != nil; el = el.Prev() {
 		// p already included in an existing range. Nothing to do here
 		if p >= el.Value.Start && p <= el.Value.End {
-			return nil
+			return
 		}
 
 		var rangeExtended bool
@@ -56,22 +66,20 @@ func (h *receivedPacketHistory) ReceivedPacket(p protocol.PacketNumber) error {
 			if prev != nil && prev.Value.End+1 == el.Value.Start { // merge two ranges
 				prev.Value.End = el.Value.End
 				h.ranges.Remove(el)
-				return nil
+				return
 			}
-			return nil // if the two ranges were not merge, we're done here
+			return // if the two ranges were not merge, we're done here
 		}
 
 		// create a new range at the end
 		if p > el.Value.End {
 			h.ranges.InsertAfter(utils.PacketInterval{Start: p, End: p}, el)
-			return nil
+			return
 		}
 	}
 
 	// create a new range at the beginning
 	h.ranges.InsertBefore(utils.PacketInterval{Start: p, End: p}, h.ranges.Front())
-
-	return nil
 }
 
 // DeleteBelow deletes all entries below (but not including) p
@@ -14,7 +14,7 @@ var _ = Describe("receivedPacketHistory", func() {
 	)
 
 	BeforeEach(func() {
-		hist = newReceivedPacketHistory()
+		hist = newReceivedPacketHistory(protocol.MaxTrackedReceivedAckRanges)
 	})
 
 	Context("ranges", func() {
@@ -177,23 +177,55 @@ var _ = Describe("receivedPacketHistory", func() {
 		Context("DoS protection", func() {
 			It("doesn't create more than MaxTrackedReceivedAckRanges ranges", func() {
 				for i := protocol.PacketNumber(1); i <= protocol.MaxTrackedReceivedAckRanges; i++ {
-					err := hist.ReceivedPacket(2 * i)
-					Expect(err).ToNot(HaveOccurred())
+					hist.ReceivedPacket(2 * i)
 				}
-				err := hist.ReceivedPacket(2*protocol.MaxTrackedReceivedAckRanges + 2)
-				Expect(err).To(MatchError(errTooManyOutstandingReceivedAckRanges))
+				Expect(hist.ranges.Len()).To(Equal(protocol.MaxTrackedReceivedAckRanges))
+				hist.ReceivedPacket(2*protocol.MaxTrackedReceivedAckRanges + 2)
+				Expect(hist.ranges.Len()).To(Equal(protocol.MaxTrackedReceivedAckRanges))
+				// the oldest range was deleted
+				Expect(hist.ranges.Front().Value).To(Equal(utils.PacketInterval{Start: 4, End: 4}))
+				Expect(hist.ranges.Back().Value).To(Equal(utils.PacketInterval{Start: 2*protocol.MaxTrackedReceivedAckRanges + 2, End: 2*protocol.MaxTrackedReceivedAckRanges + 2}))
+			})
+
+			It("uses the configured maximum number of ranges", func() {
+				hist = newReceivedPacketHistory(3)
+				for _, p := range []protocol.PacketNumber{1, 3, 5, 7, 9} {
+					hist.ReceivedPacket(p)
+				}
+				Expect(hist.GetAckRanges()).To(Equal([]wire.AckRange{
+					{Smallest: 9, Largest: 9},
+					{Smallest: 7, Largest: 7},
+					{Smallest: 5, Largest: 5},
+				}))
+			})
+
+			It("doesn't add packets below the deleted ranges", func() {
+				hist = newReceivedPacketHistory(3)
+				for _, p := range []protocol.PacketNumber{2, 4, 6, 8} {
+					hist.ReceivedPacket(p)
+				}
+				hist.ReceivedPacket(1)
+				Expect(hist.GetAckRanges()).To(Equal([]wire.AckRange{
+					{Smallest: 8, Largest: 8},
+					{Smallest: 6, Largest: 6},
+					{Smallest: 4, Largest: 4},
+				}))
+				// packets above the deleted range are still added
+				hist.ReceivedPacket(3)
+				hist.ReceivedPacket(5)
+				Expect(hist.GetAckRanges()).To(Equal([]wire.AckRange{
+					{Smallest: 8, Largest: 8},
+					{Smallest: 3, Largest: 6},
+				}))
 			})
 
 			It("doesn't consider already deleted ranges for MaxTrackedReceivedAckRanges", func() {
 				for i := protocol.PacketNumber(1); i <= protocol.MaxTrackedReceivedAckRanges; i++ {
-					err := hist.ReceivedPacket(2 * i)
-					Expect(err).ToNot(HaveOccurred())
+					hist.ReceivedPacket(2 * i)
 				}
-				err := hist.ReceivedPacket(2*protocol.MaxTrackedReceivedAckRanges + 2)
-				Expect(err).To(MatchError(errTooManyOutstandingReceivedAckRanges))
 				hist.DeleteBelow(protocol.MaxTrackedReceivedAckRanges) // deletes about half of the ranges
-				err = hist.ReceivedPacket(2*protocol.MaxTrackedReceivedAckRanges + 4)
-				Expect(err).ToNot(HaveOccurred())
+				hist.ReceivedPacket(2*protocol.MaxTrackedReceivedAckRanges + 4)
+				Expect(hist.ranges.Front().Value.Start).To(Equal(protocol.PacketNumber(protocol.MaxTrackedReceivedAckRanges)))
 			})
 		})
 	})
@@ -20,6 +20,9 @@ func IsFrameRetransmittable(f wire.Frame) bool {
 		return false
 	case *wire.AckFrame:
 		return false
+	case *wire.PathChallengeFrame:
+		// PATH_CHALLENGEs are sent to the address being validated, and repeated by the path validator
+		return false
 	default:
 		return true
 	}
@@ -20,6 +20,8 @@ var _ = Describe("retransmittable frames", func() {
 		&wire.StreamFrame{}:          true,
 		&wire.MaxDataFrame{}:         true,
 		&wire.MaxStreamDataFrame{}:   true,
+		&wire.PathChallengeFrame{}:   false,
+		&wire.PathResponseFrame{}:    true,
 	} {
 		f := fl
 		e := el
@@ -26,6 +26,8 @@ const (
 	minRTOTimeout = 200 * time.Millisecond
 	// maxRTOTimeout is the maximum RTO time
 	maxRTOTimeout = 60 * time.Second
+	// maxHandshakeTimeout is the maximum retransmission timeout for handshake packets
+	maxHandshakeTimeout = maxRTOTimeout
 )
 
 type sentPacketHandler struct {
@@ -33,8 +35,7 @@ type sentPacketHandler struct {
 	lastSentRetransmittablePacketTime time.Time
 	lastSentHandshakePacketTime       time.Time
 
-	nextPacketSendTime time.Time
-	skippedPackets     []protocol.PacketNumber
+	skippedPackets []protocol.PacketNumber
 
 	largestAcked                 protocol.PacketNumber
 	largestReceivedPacketWithAck protocol.PacketNumber
@@ -50,13 +51,16 @@ type sentPacketHandler struct {
 	retransmissionQueue []*Packet
 
 	bytesInFlight protocol.ByteCount
+	// the current max packet size, used for pacing
+	maxPacketSize protocol.ByteCount
 
 	congestion congestion.SendAlgorithm
 	rttStats   *congestion.RTTStats
 
 	handshakeComplete bool
 	// The number of times the handshake packets have been retransmitted without receiving an ack.
-	handshakeCount uint32
+	handshakeCount  uint32
+	handshakePolicy HandshakeRetransmissionPolicy
 
 	// The number of times a TLP has been sent without receiving an ack.
 	tlpCount uint32
@@ -70,31 +74,88 @@ type sentPacketHandler struct {
 	// The time at which the next packet will be considered lost based on early transmit or exceeding the reordering window in time.
 	lossTime time.Time
 
+	// The maximum time that the peer delays ACKs, if it was asked to use an ACK policy.
+	peerMaxAckDelay time.Duration
+
 	// The alarm timeout
 	alarm time.Time
 
+	// The ECN codepoint that packets are marked with.
+	ecn protocol.ECN
+	// The ECN counts of the last ACK frame.
+	ect0, ect1, ecnce uint64
+
+	stats Stats
+
+	// onPacketSizeResult is called when a packet is acknowledged or declared lost.
+	// It is used for Path MTU Discovery, which needs to know about MTU probes, as well as about full-size packets.
+	onPacketSizeResult func(size protocol.ByteCount, isMTUProbe, acked bool)
+
 	logger utils.Logger
 }
 
 // NewSentPacketHandler creates a new sentPacketHandler
-func NewSentPacketHandler(rttStats *congestion.RTTStats, logger utils.Logger) SentPacketHandler {
-	congestion := congestion.NewCubicSender(
-		congestion.DefaultClock{},
-		rttStats,
-		false, /* don't use reno since chromium doesn't (why?) */
-		protocol.InitialCongestionWindow,
-		protocol.DefaultMaxCongestionWindow,
-	)
+func NewSentPacketHandler(
+	rttStats *congestion.RTTStats,
+	congestionControl congestion.Algorithm,
+	windowDecay congestion.WindowDecay,
+	handshakePolicy HandshakeRetransmissionPolicy,
+	onPacketSizeResult func(size protocol.ByteCount, isMTUProbe, acked bool),
+	logger utils.Logger,
+) SentPacketHandler {
+	var sendAlgorithm congestion.SendAlgorithm
+	switch congestionControl {
+	case congestion.AlgorithmBBRv2:
+		sendAlgorithm = congestion.NewBBR2Sender(
+			congestion.DefaultClock{},
+			rttStats,
+			protocol.InitialCongestionWindow,
+			protocol.DefaultMaxCongestionWindow,
+		)
+	case congestion.AlgorithmNewReno:
+		sendAlgorithm = congestion.NewCubicSender(
+			congestion.DefaultClock{},
+			rttStats,
+			true,
+			protocol.InitialCongestionWindow,
+			protocol.DefaultMaxCongestionWindow,
+			windowDecay,
+		)
+		// By default, the sender emulates 2 connections, which would double the window increase.
+		sendAlgorithm.SetNumEmulatedConnections(1)
+	default:
+		sendAlgorithm = congestion.NewCubicSender(
+			congestion.DefaultClock{},
+			rttStats,
+			false, /* don't use reno since chromium doesn't (why?) */
+			protocol.InitialCongestionWindow,
+			protocol.DefaultMaxCongestionWindow,
+			windowDecay,
+		)
+	}
+
+	// With a backoff factor smaller than 1, the timeout would shrink with every retransmission.
+	if handshakePolicy.Backoff < 1 {
+		handshakePolicy.Backoff = protocol.DefaultHandshakeRetransmissionBackoff
+	}
 
 	return &sentPacketHandler{
 		packetHistory:      newSentPacketHistory(),
 		stopWaitingManager: stopWaitingManager{},
 		rttStats:           rttStats,
-		congestion:         congestion,
+		congestion:         sendAlgorithm,
+		maxPacketSize:      protocol.MaxPacketSizeIPv4,
+		handshakePolicy:    handshakePolicy,
+		onPacketSizeResult: onPacketSizeResult,
 		logger:             logger,
 	}
 }
 
+func (h *sentPacketHandler) SetMaxPacketSize(size protocol.ByteCount) {
+	h.maxPacketSize = size
+	h.congestion.SetMaxPacketSize(size)
+}
+
 func (h *sentPacketHandler) lowestUnacked() protocol.PacketNumber {
 	if p := h.packetHistory.FirstOutstanding(); p != nil {
 		return p.PacketNumber
@@ -102,6 +163,10 @@ func (h *sentPacketHandler) lowestUnacked() protocol.PacketNumber {
 	return h.largestAcked + 1
 }
 
+func (h *sentPacketHandler) SetPeerMaxAckDelay(d time.Duration) {
+	h.peerMaxAckDelay = d
+}
+
 func (h *sentPacketHandler) SetHandshakeComplete() {
 	h.logger.Debugf("Handshake complete. Discarding all outstanding handshake packets.")
 	var queue []*Packet
@@ -118,6 +183,10 @@ func (h *sentPacketHandler) SetHandshakeComplete() {
 		return true, nil
 	})
 	for _, p := range handshakePackets {
+		// the packets will never be acknowledged, so they must not count towards the bytes in flight any more
+		if p.includedInBytesInFlight {
+			h.bytesInFlight -= p.Length
+		}
 		h.packetHistory.Remove(p.PacketNumber)
 	}
 	h.retransmissionQueue = queue
@@ -131,7 +200,7 @@ func (h *sentPacketHandler) SentPacket(packet *Packet) {
 	}
 }
 
-func (h *sentPacketHandler) SentPacketsAsRetransmission(packets []*Packet, retransmissionOf protocol.PacketNumber) {
+func (h *sentPacketHandler) SentPacketsAsRetransmission(packets []*Packet, retransmissionOf []protocol.PacketNumber) {
 	var p []*Packet
 	for _, packet := range packets {
 		if isRetransmittable := h.sentPacketImpl(packet); isRetransmittable {
@@ -151,6 +220,7 @@ func (h *sentPacketHandler) sentPacketImpl(packet *Packet) bool /* isRetransmitt
 	}
 
 	h.lastSentPacketNumber = packet.PacketNumber
+	packet.ecn = h.ecn
 
 	if len(packet.Frames) > 0 {
 		if ackFrame, ok := packet.Frames[0].(*wire.AckFrame); ok {
@@ -175,8 +245,6 @@ func (h *sentPacketHandler) sentPacketImpl(packet *Packet) bool /* isRetransmitt
 		h.allowTLP = false
 	}
 	h.congestion.OnPacketSent(packet.SendTime, h.bytesInFlight, packet.PacketNumber, packet.Length, isRetransmittable)
-
-	h.nextPacketSendTime = utils.MaxTime(h.nextPacketSendTime, packet.SendTime).Add(h.congestion.TimeUntilSend(h.bytesInFlight))
 	return isRetransmittable
 }
 
@@ -226,6 +294,8 @@ func (h *sentPacketHandler) ReceivedAck(ackFrame *wire.AckFrame, withPacketNumbe
 		}
 	}
 
+	h.processECN(ackFrame, ackedPackets, priorInFlight)
+
 	if err := h.detectLostPackets(rcvTime, priorInFlight); err != nil {
 		return err
 	}
@@ -237,6 +307,53 @@ func (h *sentPacketHandler) ReceivedAck(ackFrame *wire.AckFrame, withPacketNumbe
 	return nil
 }
 
+// processECN validates the ECN counts reported by the peer, and notifies the congestion controller about CE marks.
+// If the path (or the peer) doesn't correctly report ECN marks, ECN is disabled for this connection.
+func (h *sentPacketHandler) processECN(ackFrame *wire.AckFrame, ackedPackets []*Packet, priorInFlight protocol.ByteCount) {
+	if h.ecn == protocol.ECNNon {
+		return
+	}
+	var numECT0Acked uint64
+	var largestECT0Acked protocol.PacketNumber
+	for _, p := range ackedPackets {
+		if p.ecn == protocol.ECT0 {
+			numECT0Acked++
+			largestECT0Acked = p.PacketNumber
+		}
+	}
+	if ackFrame.ECT0 < h.ect0 || ackFrame.ECT1 < h.ect1 || ackFrame.ECNCE < h.ecnce {
+		h.disableECN("ECN counts decreased")
+		return
+	}
+	// Every newly acknowledged packet that was sent with ECT(0) must have been counted,
+	// either as ECT(0) or, if a router experienced congestion, as CE.
+	newECNCE := ackFrame.ECNCE - h.ecnce
+	if (ackFrame.ECT0-h.ect0)+newECNCE < numECT0Acked {
+		h.disableECN("ECN marks were not reported")
+		return
+	}
+	h.ect0 = ackFrame.ECT0
+	h.ect1 = ackFrame.ECT1
+	h.ecnce = ackFrame.ECNCE
+	if newECNCE > 0 && numECT0Acked > 0 {
+		h.logger.Debugf("\tPeer reported %d new CE marks.", newECNCE)
+		h.congestion.OnCongestionExperienced(largestECT0Acked, newECNCE, priorInFlight)
+	}
+}
+
+func (h *sentPacketHandler) disableECN(reason string) {
+	h.logger.Debugf("\tECN validation failed (%s). Disabling ECN.", reason)
+	h.ecn = protocol.ECNNon
+}
+
+func (h *sentPacketHandler) EnableECN() {
+	h.ecn = protocol.ECT0
+}
+
+func (h *sentPacketHandler) ECN() protocol.ECN {
+	return h.ecn
+}
+
 func (h *sentPacketHandler) GetLowestPacketNotConfirmedAcked() protocol.PacketNumber {
 	return h.lowestPacketNotConfirmedAcked
 }
@@ -353,6 +470,22 @@ func (h *sentPacketHandler) detectLostPackets(now time.Time, priorInFlight proto
 	}
 
 	for _, p := range lostPackets {
+		if p.IsMTUProbe {
+			// The probe was probably lost because it was too large for the path.
+			// This is not a sign of congestion, and a probe is never retransmitted.
+			if p.includedInBytesInFlight {
+				h.bytesInFlight -= p.Length
+			}
+			h.packetHistory.Remove(p.PacketNumber)
+			if h.onPacketSizeResult != nil {
+				h.onPacketSizeResult(p.Length, true, false)
+			}
+			continue
+		}
+		h.stats.PacketsLost++
+		if h.onPacketSizeResult != nil {
+			h.onPacketSizeResult(p.Length, false, false)
+		}
 		// the bytes in flight need to be reduced no matter if this packet will be retransmitted
 		if p.includedInBytesInFlight {
 			h.bytesInFlight -= p.Length
@@ -378,6 +511,9 @@ func (h *sentPacketHandler) OnAlarm() error {
 			h.logger.Debugf("Loss detection alarm fired in handshake mode")
 		}
 		h.handshakeCount++
+		if max := h.handshakePolicy.MaxRetransmissions; max > 0 && h.handshakeCount > uint32(max) {
+			return qerr.Error(qerr.HandshakeTimeout, fmt.Sprintf("Handshake packets were retransmitted %d times without being acknowledged", max))
+		}
 		err = h.queueHandshakePacketsForRetransmission()
 	} else if !h.lossTime.IsZero() {
 		if h.logger.Debug() {
@@ -391,12 +527,14 @@ func (h *sentPacketHandler) OnAlarm() error {
 		}
 		h.allowTLP = true
 		h.tlpCount++
+		h.stats.TLPs++
 	} else {
 		if h.logger.Debug() {
 			h.logger.Debugf("Loss detection alarm fired in RTO mode")
 		}
 		// RTO
 		h.rtoCount++
+		h.stats.RTOs++
 		h.numRTOs += 2
 		err = h.queueRTOs()
 	}
@@ -422,27 +560,19 @@ func (h *sentPacketHandler) onPacketAcked(p *Packet, rcvTime time.Time) error {
 	// only report the acking of this packet to the congestion controller if:
 	// * it is a retransmittable packet
 	// * this packet wasn't retransmitted yet
-	if p.isRetransmission {
+	for _, pn := range p.retransmissionOf {
 		// that the parent doesn't exist is expected to happen every time the original packet was already acked
-		if parent := h.packetHistory.GetPacket(p.retransmissionOf); parent != nil {
-			if len(parent.retransmittedAs) == 1 {
-				parent.retransmittedAs = nil
-			} else {
-				// remove this packet from the slice of retransmission
-				retransmittedAs := make([]protocol.PacketNumber, 0, len(parent.retransmittedAs)-1)
-				for _, pn := range parent.retransmittedAs {
-					if pn != p.PacketNumber {
-						retransmittedAs = append(retransmittedAs, pn)
-					}
-				}
-				parent.retransmittedAs = retransmittedAs
-			}
+		if parent := h.packetHistory.GetPacket(pn); parent != nil {
+			parent.retransmittedAs = removePacketNumber(parent.retransmittedAs, p.PacketNumber)
 		}
 	}
 	// this also applies to packets that have been retransmitted as probe packets
 	if p.includedInBytesInFlight {
 		h.bytesInFlight -= p.Length
 	}
+	if h.onPacketSizeResult != nil {
+		h.onPacketSizeResult(p.Length, p.IsMTUProbe, true)
+	}
 	if h.rtoCount > 0 {
 		h.verifyRTO(p.PacketNumber)
 	}
@@ -464,11 +594,28 @@ func (h *sentPacketHandler) stopRetransmissionsFor(p *Packet) error {
 		if packet == nil {
 			return fmt.Errorf("sent packet handler BUG: marking packet as not retransmittable %d (retransmission of %d) not found in history", r, p.PacketNumber)
 		}
+		// The retransmission might also contain frames of other packets.
+		// It still needs to be retransmitted, unless all of these packets were acked.
+		packet.retransmissionOf = removePacketNumber(packet.retransmissionOf, p.PacketNumber)
+		if len(packet.retransmissionOf) > 0 {
+			continue
+		}
 		h.stopRetransmissionsFor(packet)
 	}
 	return nil
 }
 
+// removePacketNumber removes pn from the slice of packet numbers
+func removePacketNumber(pns []protocol.PacketNumber, pn protocol.PacketNumber) []protocol.PacketNumber {
+	var res []protocol.PacketNumber
+	for _, p := range pns {
+		if p != pn {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
 func (h *sentPacketHandler) verifyRTO(pn protocol.PacketNumber) {
 	if pn <= h.largestSentBeforeRTO {
 		h.logger.Debugf("Spurious RTO detected. Received an ACK for %#x (largest sent before RTO: %#x)", pn, h.largestSentBeforeRTO)
@@ -541,7 +688,35 @@ func (h *sentPacketHandler) SendMode() SendMode {
 }
 
 func (h *sentPacketHandler) TimeUntilSend() time.Time {
-	return h.nextPacketSendTime
+	return h.congestion.TimeUntilSend(h.bytesInFlight)
+}
+
+func (h *sentPacketHandler) GetBytesInFlight() protocol.ByteCount {
+	return h.bytesInFlight
+}
+
+func (h *sentPacketHandler) GetCongestionWindow() protocol.ByteCount {
+	return h.congestion.GetCongestionWindow()
+}
+
+func (h *sentPacketHandler) GetBandwidthEstimate() congestion.Bandwidth {
+	return h.congestion.BandwidthEstimate()
+}
+
+func (h *sentPacketHandler) GetPacingRate() congestion.Bandwidth {
+	return h.congestion.PacingRate()
+}
+
+func (h *sentPacketHandler) ResumeCongestionState(state congestion.ResumeState) {
+	h.congestion.Resume(state)
+}
+
+func (h *sentPacketHandler) GetResumeState() (congestion.ResumeState, bool) {
+	return h.congestion.GetResumeState()
+}
+
+func (h *sentPacketHandler) GetStats() Stats {
+	return h.stats
 }
 
 func (h *sentPacketHandler) ShouldSendNumPackets() int {
@@ -549,11 +724,10 @@ func (h *sentPacketHandler) ShouldSendNumPackets() int {
 		// RTO probes should not be paced, but must be sent immediately.
 		return h.numRTOs
 	}
-	delay := h.congestion.TimeUntilSend(h.bytesInFlight)
-	if delay == 0 || delay > protocol.MinPacingDelay {
-		return 1
-	}
-	return int(math.Ceil(float64(protocol.MinPacingDelay) / float64(delay)))
+	// If packets are not paced (yet), the budget is infinite.
+	// We can't send more than MaxOutstandingSentPackets packets anyway.
+	numPackets := h.congestion.PacingBudget(time.Now()) / h.maxPacketSize
+	return int(utils.MaxByteCount(1, utils.MinByteCount(numPackets, protocol.MaxOutstandingSentPackets)))
 }
 
 // retransmit the oldest two packets
@@ -604,14 +778,15 @@ func (h *sentPacketHandler) queuePacketForRetransmission(p *Packet) error {
 
 func (h *sentPacketHandler) computeHandshakeTimeout() time.Duration {
 	duration := utils.MaxDuration(2*h.rttStats.SmoothedOrInitialRTT(), minTPLTimeout)
+	duration = utils.MaxDuration(duration, h.handshakePolicy.MinTimeout)
 	// exponential backoff
-	// There's an implicit limit to this set by the handshake timeout.
-	return duration << h.handshakeCount
+	// The limit is applied to the float, since a large backoff would overflow the time.Duration.
+	return time.Duration(math.Min(float64(duration)*math.Pow(h.handshakePolicy.Backoff, float64(h.handshakeCount)), float64(maxHandshakeTimeout)))
 }
 
 func (h *sentPacketHandler) computeTLPTimeout() time.Duration {
-	// TODO(#1236): include the max_ack_delay
-	return utils.MaxDuration(h.rttStats.SmoothedOrInitialRTT()*3/2, minTPLTimeout)
+	// TODO(#1236): include the max_ack_delay of the default ACK policy
+	return utils.MaxDuration(h.rttStats.SmoothedOrInitialRTT()*3/2, minTPLTimeout) + h.peerMaxAckDelay
 }
 
 func (h *sentPacketHandler) computeRTOTimeout() time.Duration {
@@ -622,7 +797,7 @@ func (h *sentPacketHandler) computeRTOTimeout() time.Duration {
 	} else {
 		rto = rtt + 4*h.rttStats.MeanDeviation()
 	}
-	rto = utils.MaxDuration(rto, minRTOTimeout)
+	rto = utils.MaxDuration(rto, minRTOTimeout) + h.peerMaxAckDelay
 	// Exponential backoff
 	rto = rto << h.rtoCount
 	return utils.MinDuration(rto, maxRTOTimeout)
@@ -9,6 +9,7 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
+	"github.com/lucas-clemente/quic-go/qerr"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -49,7 +50,14 @@ var _ = Describe("SentPacketHandler", func() {
 
 	BeforeEach(func() {
 		rttStats := &congestion.RTTStats{}
-		handler = NewSentPacketHandler(rttStats, utils.DefaultLogger).(*sentPacketHandler)
+		handler = NewSentPacketHandler(
+			rttStats,
+			congestion.AlgorithmCubic,
+			congestion.WindowDecayHalve,
+			HandshakeRetransmissionPolicy{Backoff: 2},
+			nil,
+			utils.DefaultLogger,
+		).(*sentPacketHandler)
 		handler.SetHandshakeComplete()
 		streamFrame = wire.StreamFrame{
 			StreamID: 5,
@@ -167,7 +175,7 @@ var _ = Describe("SentPacketHandler", func() {
 				for i := protocol.PacketNumber(0); i < protocol.MaxTrackedSkippedPackets+5; i++ {
 					handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2*i + 1}))
 				}
-				Expect(handler.skippedPackets).To(HaveLen(protocol.MaxUndecryptablePackets))
+				Expect(handler.skippedPackets).To(HaveLen(protocol.MaxTrackedSkippedPackets))
 				Expect(handler.skippedPackets[0]).To(Equal(protocol.PacketNumber(10)))
 				Expect(handler.skippedPackets[protocol.MaxTrackedSkippedPackets-1]).To(Equal(protocol.PacketNumber(10 + 2*(protocol.MaxTrackedSkippedPackets-1))))
 			})
@@ -480,7 +488,7 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(10)))
 			losePacket(5)
 			Expect(handler.bytesInFlight).To(BeZero())
-			handler.SentPacketsAsRetransmission([]*Packet{retransmittablePacket(&Packet{PacketNumber: 6, Length: 11})}, 5)
+			handler.SentPacketsAsRetransmission([]*Packet{retransmittablePacket(&Packet{PacketNumber: 6, Length: 11})}, []protocol.PacketNumber{5})
 			Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(11)))
 		})
 
@@ -488,7 +496,7 @@ var _ = Describe("SentPacketHandler", func() {
 			// packet 5 was retransmitted as packet 6
 			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 5, Length: 10}))
 			losePacket(5)
-			handler.SentPacketsAsRetransmission([]*Packet{retransmittablePacket(&Packet{PacketNumber: 6, Length: 11})}, 5)
+			handler.SentPacketsAsRetransmission([]*Packet{retransmittablePacket(&Packet{PacketNumber: 6, Length: 11})}, []protocol.PacketNumber{5})
 			Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(11)))
 			// ack 5
 			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 5, Largest: 5}}}
@@ -502,7 +510,7 @@ var _ = Describe("SentPacketHandler", func() {
 			// packet 5 was retransmitted as packet 7
 			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 5, Length: 10}))
 			losePacket(5)
-			handler.SentPacketsAsRetransmission([]*Packet{retransmittablePacket(&Packet{PacketNumber: 7, Length: 11})}, 5)
+			handler.SentPacketsAsRetransmission([]*Packet{retransmittablePacket(&Packet{PacketNumber: 7, Length: 11})}, []protocol.PacketNumber{5})
 			// ack 5 and 7
 			ack := &wire.AckFrame{
 				AckRanges: []wire.AckRange{
@@ -515,6 +523,30 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.packetHistory.Len()).To(BeZero())
 			Expect(handler.bytesInFlight).To(BeZero())
 		})
+
+		It("stops retransmitting a retransmission when the original packet is acked", func() {
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 5, Length: 10}))
+			losePacket(5)
+			handler.SentPacketsAsRetransmission([]*Packet{retransmittablePacket(&Packet{PacketNumber: 6, Length: 11})}, []protocol.PacketNumber{5})
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 5, Largest: 5}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(getPacket(6).canBeRetransmitted).To(BeFalse())
+		})
+
+		It("keeps retransmitting a retransmission of multiple packets until all of them are acked", func() {
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 5, Length: 10}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 6, Length: 10}))
+			losePacket(5)
+			losePacket(6)
+			handler.SentPacketsAsRetransmission([]*Packet{retransmittablePacket(&Packet{PacketNumber: 7, Length: 11})}, []protocol.PacketNumber{5, 6})
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 5, Largest: 5}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(getPacket(7).canBeRetransmitted).To(BeTrue())
+			Expect(getPacket(7).retransmissionOf).To(Equal([]protocol.PacketNumber{6}))
+			ack = &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 5, Largest: 6}}}
+			Expect(handler.ReceivedAck(ack, 2, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(getPacket(7).canBeRetransmitted).To(BeFalse())
+		})
 	})
 
 	Context("Retransmission handling", func() {
@@ -542,6 +574,31 @@ var _ = Describe("SentPacketHandler", func() {
 		})
 	})
 
+	It("uses the configured congestion control algorithm", func() {
+		rttStats := &congestion.RTTStats{}
+		Expect(handler.congestion).To(BeAssignableToTypeOf(congestion.NewCubicSender(congestion.DefaultClock{}, rttStats, false, 0, 0, congestion.WindowDecayHalve)))
+		h := NewSentPacketHandler(
+			rttStats,
+			congestion.AlgorithmBBRv2,
+			congestion.WindowDecayHalve,
+			HandshakeRetransmissionPolicy{},
+			nil,
+			utils.DefaultLogger,
+		).(*sentPacketHandler)
+		Expect(h.congestion).To(BeAssignableToTypeOf(congestion.NewBBR2Sender(congestion.DefaultClock{}, rttStats, 0, 0)))
+		h = NewSentPacketHandler(
+			rttStats,
+			congestion.AlgorithmNewReno,
+			congestion.WindowDecayHalve,
+			HandshakeRetransmissionPolicy{},
+			nil,
+			utils.DefaultLogger,
+		).(*sentPacketHandler)
+		Expect(h.congestion).To(BeAssignableToTypeOf(congestion.NewCubicSender(congestion.DefaultClock{}, rttStats, true, 0, 0, congestion.WindowDecayHalve)))
+		// NewReno emulates a single connection
+		Expect(h.congestion.(congestion.SendAlgorithmWithDebugInfo).RenoBeta()).To(BeNumerically("~", 0.7, 0.001))
+	})
+
 	Context("congestion", func() {
 		var cong *mocks.MockSendAlgorithm
 
@@ -558,7 +615,6 @@ var _ = Describe("SentPacketHandler", func() {
 				protocol.ByteCount(42),
 				true,
 			)
-			cong.EXPECT().TimeUntilSend(gomock.Any())
 			p := &Packet{
 				PacketNumber: 1,
 				Length:       42,
@@ -567,10 +623,35 @@ var _ = Describe("SentPacketHandler", func() {
 			handler.SentPacket(p)
 		})
 
+		It("returns the congestion window and the bytes in flight", func() {
+			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, Length: 100}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, Length: 200}))
+			Expect(handler.GetBytesInFlight()).To(Equal(protocol.ByteCount(300)))
+			cong.EXPECT().GetCongestionWindow().Return(protocol.ByteCount(1337))
+			Expect(handler.GetCongestionWindow()).To(Equal(protocol.ByteCount(1337)))
+		})
+
+		It("returns the bandwidth estimate and the pacing rate", func() {
+			cong.EXPECT().BandwidthEstimate().Return(congestion.Bandwidth(8e6))
+			Expect(handler.GetBandwidthEstimate()).To(Equal(congestion.Bandwidth(8e6)))
+			cong.EXPECT().PacingRate().Return(congestion.Bandwidth(1e7))
+			Expect(handler.GetPacingRate()).To(Equal(congestion.Bandwidth(1e7)))
+		})
+
+		It("passes the congestion state to and from the congestion controller", func() {
+			state := congestion.ResumeState{CongestionWindow: 100000, RTT: 20 * time.Millisecond}
+			cong.EXPECT().Resume(state)
+			handler.ResumeCongestionState(state)
+			cong.EXPECT().GetResumeState().Return(state, true)
+			s, ok := handler.GetResumeState()
+			Expect(ok).To(BeTrue())
+			Expect(s).To(Equal(state))
+		})
+
 		It("should call MaybeExitSlowStart and OnPacketAcked", func() {
 			rcvTime := time.Now().Add(-5 * time.Second)
 			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(3)
-			cong.EXPECT().TimeUntilSend(gomock.Any()).Times(3)
 			gomock.InOrder(
 				cong.EXPECT().MaybeExitSlowStart(), // must be called before packets are acked
 				cong.EXPECT().OnPacketAcked(protocol.PacketNumber(1), protocol.ByteCount(1), protocol.ByteCount(3), rcvTime),
@@ -587,7 +668,6 @@ var _ = Describe("SentPacketHandler", func() {
 		It("doesn't call OnPacketLost and OnRetransmissionTimeout when queuing RTOs", func() {
 			for i := protocol.PacketNumber(1); i < 3; i++ {
 				cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
-				cong.EXPECT().TimeUntilSend(gomock.Any())
 				handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: i}))
 			}
 			handler.OnAlarm() // TLP
@@ -601,7 +681,6 @@ var _ = Describe("SentPacketHandler", func() {
 
 		It("declares all lower packets lost and call OnRetransmissionTimeout when verifying an RTO", func() {
 			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(5)
-			cong.EXPECT().TimeUntilSend(gomock.Any()).Times(5)
 			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, SendTime: time.Now().Add(-time.Hour)}))
 			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, SendTime: time.Now().Add(-time.Hour)}))
 			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 3, SendTime: time.Now().Add(-time.Hour)}))
@@ -630,7 +709,6 @@ var _ = Describe("SentPacketHandler", func() {
 
 		It("doesn't call OnRetransmissionTimeout when a spurious RTO occurs", func() {
 			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(3)
-			cong.EXPECT().TimeUntilSend(gomock.Any()).Times(3)
 			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, SendTime: time.Now().Add(-time.Hour)}))
 			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, SendTime: time.Now()}))
 			handler.OnAlarm() // TLP
@@ -655,7 +733,6 @@ var _ = Describe("SentPacketHandler", func() {
 
 		It("doesn't call OnPacketAcked when a retransmitted packet is acked", func() {
 			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
-			cong.EXPECT().TimeUntilSend(gomock.Any()).Times(2)
 			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, SendTime: time.Now().Add(-time.Hour)}))
 			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2}))
 			// lose packet 1
@@ -675,7 +752,6 @@ var _ = Describe("SentPacketHandler", func() {
 
 		It("calls OnPacketAcked and OnPacketLost with the right bytes_in_flight value", func() {
 			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(4)
-			cong.EXPECT().TimeUntilSend(gomock.Any()).Times(4)
 			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, SendTime: time.Now().Add(-time.Hour)}))
 			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, SendTime: time.Now().Add(-30 * time.Minute)}))
 			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 3, SendTime: time.Now().Add(-30 * time.Minute)}))
@@ -710,7 +786,6 @@ var _ = Describe("SentPacketHandler", func() {
 
 		It("only allows sending of ACKs when we're keeping track of MaxOutstandingSentPackets packets", func() {
 			cong.EXPECT().GetCongestionWindow().Return(protocol.MaxByteCount).AnyTimes()
-			cong.EXPECT().TimeUntilSend(gomock.Any()).AnyTimes()
 			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
 			for i := protocol.PacketNumber(1); i < protocol.MaxOutstandingSentPackets; i++ {
 				handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: i}))
@@ -750,13 +825,11 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.SendMode()).To(Equal(SendRTO))
 		})
 
-		It("gets the pacing delay", func() {
-			sendTime := time.Now().Add(-time.Minute)
+		It("gets the time when the next packet should be sent", func() {
+			sendTime := time.Now().Add(time.Millisecond)
 			handler.bytesInFlight = 100
-			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
-			cong.EXPECT().TimeUntilSend(protocol.ByteCount(100)).Return(time.Hour)
-			handler.SentPacket(&Packet{PacketNumber: 1, SendTime: sendTime})
-			Expect(handler.TimeUntilSend()).To(Equal(sendTime.Add(time.Hour)))
+			cong.EXPECT().TimeUntilSend(protocol.ByteCount(100)).Return(sendTime)
+			Expect(handler.TimeUntilSend()).To(Equal(sendTime))
 		})
 
 		It("allows sending of all RTO probe packets", func() {
@@ -764,22 +837,117 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.ShouldSendNumPackets()).To(Equal(5))
 		})
 
-		It("allows sending of one packet, if it should be sent immediately", func() {
-			cong.EXPECT().TimeUntilSend(gomock.Any()).Return(time.Duration(0))
+		It("allows sending of one packet, if the pacing budget is smaller than a packet", func() {
+			cong.EXPECT().PacingBudget(gomock.Any()).Return(protocol.ByteCount(100))
 			Expect(handler.ShouldSendNumPackets()).To(Equal(1))
 		})
 
-		It("allows sending of multiple packets, if the pacing delay is smaller than the minimum", func() {
-			pacingDelay := protocol.MinPacingDelay / 10
-			cong.EXPECT().TimeUntilSend(gomock.Any()).Return(pacingDelay)
-			Expect(handler.ShouldSendNumPackets()).To(Equal(10))
+		It("allows sending of multiple packets, if the pacing budget allows it", func() {
+			cong.EXPECT().PacingBudget(gomock.Any()).Return(protocol.ByteCount(3*protocol.MaxPacketSizeIPv4 + 100))
+			Expect(handler.ShouldSendNumPackets()).To(Equal(3))
 		})
 
-		It("allows sending of multiple packets, if the pacing delay is smaller than the minimum, and not a fraction", func() {
-			pacingDelay := protocol.MinPacingDelay * 2 / 5
-			cong.EXPECT().TimeUntilSend(gomock.Any()).Return(pacingDelay)
+		It("uses the max packet size to calculate the number of packets", func() {
+			cong.EXPECT().SetMaxPacketSize(protocol.ByteCount(1500))
+			handler.SetMaxPacketSize(1500)
+			cong.EXPECT().PacingBudget(gomock.Any()).Return(protocol.ByteCount(3*1500 + 100))
 			Expect(handler.ShouldSendNumPackets()).To(Equal(3))
 		})
+
+		It("limits the number of packets, if packets are not paced", func() {
+			cong.EXPECT().PacingBudget(gomock.Any()).Return(protocol.MaxByteCount)
+			Expect(handler.ShouldSendNumPackets()).To(Equal(protocol.MaxOutstandingSentPackets))
+		})
+	})
+
+	Context("ECN", func() {
+		var cong *mocks.MockSendAlgorithm
+
+		BeforeEach(func() {
+			cong = mocks.NewMockSendAlgorithm(mockCtrl)
+			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+			cong.EXPECT().MaybeExitSlowStart().AnyTimes()
+			cong.EXPECT().OnPacketAcked(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+			handler.congestion = cong
+		})
+
+		sendPackets := func(pns ...protocol.PacketNumber) {
+			for _, pn := range pns {
+				handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: pn}))
+			}
+		}
+
+		It("doesn't mark packets if ECN is not enabled", func() {
+			Expect(handler.ECN()).To(Equal(protocol.ECNNon))
+			sendPackets(1)
+			Expect(getPacket(1).ecn).To(Equal(protocol.ECNNon))
+		})
+
+		It("marks packets with ECT(0)", func() {
+			handler.EnableECN()
+			Expect(handler.ECN()).To(Equal(protocol.ECT0))
+			sendPackets(1)
+			Expect(getPacket(1).ecn).To(Equal(protocol.ECT0))
+		})
+
+		It("accepts correct ECN counts", func() {
+			handler.EnableECN()
+			sendPackets(1, 2, 3)
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 2}}, ECT0: 2}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			ack = &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 3}}, ECT0: 3}
+			Expect(handler.ReceivedAck(ack, 2, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(handler.ECN()).To(Equal(protocol.ECT0))
+		})
+
+		It("tells the congestion controller about CE marks", func() {
+			handler.EnableECN()
+			sendPackets(1, 2, 3)
+			priorInFlight := handler.bytesInFlight
+			cong.EXPECT().OnCongestionExperienced(protocol.PacketNumber(3), uint64(1), priorInFlight)
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 3}}, ECT0: 2, ECNCE: 1}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(handler.ECN()).To(Equal(protocol.ECT0))
+			// the CE count didn't increase
+			sendPackets(4)
+			ack = &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 4}}, ECT0: 3, ECNCE: 1}
+			Expect(handler.ReceivedAck(ack, 2, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+		})
+
+		It("disables ECN if the peer doesn't report ECN counts", func() {
+			handler.EnableECN()
+			sendPackets(1, 2)
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 2}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(handler.ECN()).To(Equal(protocol.ECNNon))
+			sendPackets(3)
+			Expect(getPacket(3).ecn).To(Equal(protocol.ECNNon))
+		})
+
+		It("disables ECN if the marks were stripped for some packets", func() {
+			handler.EnableECN()
+			sendPackets(1, 2, 3)
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 3}}, ECT0: 2}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(handler.ECN()).To(Equal(protocol.ECNNon))
+		})
+
+		It("disables ECN if the ECN counts decrease", func() {
+			handler.EnableECN()
+			sendPackets(1, 2)
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}, ECT0: 1, ECT1: 1}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(handler.ECN()).To(Equal(protocol.ECT0))
+			ack = &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 2}}, ECT0: 2}
+			Expect(handler.ReceivedAck(ack, 2, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(handler.ECN()).To(Equal(protocol.ECNNon))
+		})
+
+		It("ignores ECN counts if ECN is not enabled", func() {
+			sendPackets(1)
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}, ECNCE: 1}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+		})
 	})
 
 	Context("TLPs", func() {
@@ -795,6 +963,13 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.computeTLPTimeout()).To(Equal(minTPLTimeout))
 		})
 
+		It("includes the peer's max ACK delay", func() {
+			rtt := 2 * time.Second
+			updateRTT(rtt)
+			handler.SetPeerMaxAckDelay(200 * time.Millisecond)
+			Expect(handler.computeTLPTimeout()).To(Equal(rtt*3/2 + 200*time.Millisecond))
+		})
+
 		It("sets the TLP send mode until one retransmittable packet is sent", func() {
 			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, SendTime: time.Now().Add(-time.Hour)}))
 			handler.OnAlarm()
@@ -822,6 +997,8 @@ var _ = Describe("SentPacketHandler", func() {
 			// fire alarm a third time
 			handler.OnAlarm()
 			Expect(handler.SendMode()).To(Equal(SendRTO))
+			Expect(handler.GetStats().TLPs).To(BeEquivalentTo(2))
+			Expect(handler.GetStats().RTOs).To(BeEquivalentTo(1))
 		})
 	})
 
@@ -845,6 +1022,13 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.computeRTOTimeout()).To(Equal(minRTOTimeout))
 		})
 
+		It("includes the peer's max ACK delay", func() {
+			handler.SetPeerMaxAckDelay(200 * time.Millisecond)
+			Expect(handler.computeRTOTimeout()).To(Equal(defaultRTOTimeout + 200*time.Millisecond))
+			handler.rtoCount = 1
+			Expect(handler.computeRTOTimeout()).To(Equal(2 * (defaultRTOTimeout + 200*time.Millisecond)))
+		})
+
 		It("limits RTO max", func() {
 			updateRTT(time.Hour)
 			Expect(handler.computeRTOTimeout()).To(Equal(maxRTOTimeout))
@@ -947,7 +1131,7 @@ var _ = Describe("SentPacketHandler", func() {
 			handler.OnAlarm() // TLP
 			handler.OnAlarm() // RTO
 			Expect(handler.DequeuePacketForRetransmission()).ToNot(BeNil())
-			handler.SentPacketsAsRetransmission([]*Packet{retransmittablePacket(&Packet{PacketNumber: 6})}, 5)
+			handler.SentPacketsAsRetransmission([]*Packet{retransmittablePacket(&Packet{PacketNumber: 6})}, []protocol.PacketNumber{5})
 			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 5, Largest: 5}}}
 			err := handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())
 			Expect(err).ToNot(HaveOccurred())
@@ -980,6 +1164,7 @@ var _ = Describe("SentPacketHandler", func() {
 			// no need to set an alarm, since packet 1 was already declared lost
 			Expect(handler.lossTime.IsZero()).To(BeTrue())
 			Expect(handler.bytesInFlight).To(BeZero())
+			Expect(handler.GetStats().PacketsLost).To(BeEquivalentTo(1))
 		})
 
 		It("sets the early retransmit alarm", func() {
@@ -1007,6 +1192,68 @@ var _ = Describe("SentPacketHandler", func() {
 		})
 	})
 
+	Context("MTU probes", func() {
+		type probeResult struct {
+			size     protocol.ByteCount
+			mtuProbe bool
+			acked    bool
+		}
+		var results []probeResult
+
+		BeforeEach(func() {
+			results = nil
+			handler.onPacketSizeResult = func(size protocol.ByteCount, isMTUProbe, acked bool) {
+				results = append(results, probeResult{size: size, mtuProbe: isMTUProbe, acked: acked})
+			}
+		})
+
+		It("reports acknowledged probes", func() {
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, Length: 1400, IsMTUProbe: true}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, Length: 1200}))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 2}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(results).To(ConsistOf(
+				probeResult{size: 1400, mtuProbe: true, acked: true},
+				probeResult{size: 1200, acked: true},
+			))
+			Expect(handler.bytesInFlight).To(BeZero())
+		})
+
+		It("reports lost probes, and doesn't retransmit them", func() {
+			cong := mocks.NewMockSendAlgorithm(mockCtrl)
+			handler.congestion = cong
+			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
+			cong.EXPECT().MaybeExitSlowStart()
+			cong.EXPECT().OnPacketAcked(protocol.PacketNumber(2), gomock.Any(), gomock.Any(), gomock.Any())
+			// no call to OnPacketLost
+			now := time.Now()
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, Length: 1400, IsMTUProbe: true, SendTime: now.Add(-time.Hour)}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, Length: 1200, SendTime: now.Add(-time.Second)}))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 2, Largest: 2}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, now)).To(Succeed())
+			Expect(results).To(ConsistOf(
+				probeResult{size: 1400, mtuProbe: true, acked: false},
+				probeResult{size: 1200, acked: true},
+			))
+			Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
+			Expect(handler.bytesInFlight).To(BeZero())
+			Expect(getPacket(1)).To(BeNil())
+			Expect(handler.GetStats().PacketsLost).To(BeZero())
+		})
+
+		It("reports the sizes of lost packets", func() {
+			now := time.Now()
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, Length: 1400, SendTime: now.Add(-time.Hour)}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, Length: 1200, SendTime: now.Add(-time.Second)}))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 2, Largest: 2}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, now)).To(Succeed())
+			Expect(results).To(ConsistOf(
+				probeResult{size: 1400, acked: false},
+				probeResult{size: 1200, acked: true},
+			))
+		})
+	})
+
 	Context("handshake packets", func() {
 		BeforeEach(func() {
 			handler.handshakeComplete = false
@@ -1014,8 +1261,8 @@ var _ = Describe("SentPacketHandler", func() {
 
 		It("detects the handshake timeout", func() {
 			now := time.Now()
-			sendTime := now.Add(-time.Minute)
-			lastHandshakePacketSendTime := now.Add(-30 * time.Second)
+			sendTime := now.Add(-10 * time.Second)
+			lastHandshakePacketSendTime := now.Add(-5 * time.Second)
 			// send handshake packets: 1, 2, 4
 			// send a forward-secure packet: 3
 			handler.SentPacket(handshakePacket(&Packet{PacketNumber: 1, SendTime: sendTime}))
@@ -1026,11 +1273,11 @@ var _ = Describe("SentPacketHandler", func() {
 
 			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}}
 			err := handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, now)
-			// RTT is now 1 minute
-			Expect(handler.rttStats.SmoothedRTT()).To(Equal(time.Minute))
+			// RTT is now 10 seconds
+			Expect(handler.rttStats.SmoothedRTT()).To(Equal(10 * time.Second))
 			Expect(err).NotTo(HaveOccurred())
 			Expect(handler.lossTime.IsZero()).To(BeTrue())
-			Expect(handler.GetAlarmTimeout().Sub(lastHandshakePacketSendTime)).To(Equal(2 * time.Minute))
+			Expect(handler.GetAlarmTimeout().Sub(lastHandshakePacketSendTime)).To(Equal(20 * time.Second))
 
 			err = handler.OnAlarm()
 			Expect(err).ToNot(HaveOccurred())
@@ -1043,7 +1290,47 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(getPacket(3)).ToNot(BeNil())
 			Expect(handler.handshakeCount).To(BeEquivalentTo(1))
 			// make sure the exponential backoff is used
-			Expect(handler.GetAlarmTimeout().Sub(lastHandshakePacketSendTime)).To(Equal(4 * time.Minute))
+			Expect(handler.GetAlarmTimeout().Sub(lastHandshakePacketSendTime)).To(Equal(40 * time.Second))
+		})
+
+		It("uses the minimum retransmission timeout", func() {
+			handler.handshakePolicy.MinTimeout = 3 * time.Second
+			Expect(handler.computeHandshakeTimeout()).To(Equal(3 * time.Second))
+			handler.rttStats.UpdateRTT(2*time.Second, 0, time.Now())
+			Expect(handler.computeHandshakeTimeout()).To(Equal(4 * time.Second))
+		})
+
+		It("uses the backoff factor", func() {
+			handler.handshakePolicy.MinTimeout = time.Second
+			handler.handshakePolicy.Backoff = 1.5
+			Expect(handler.computeHandshakeTimeout()).To(Equal(time.Second))
+			handler.handshakeCount = 1
+			Expect(handler.computeHandshakeTimeout()).To(Equal(1500 * time.Millisecond))
+			handler.handshakeCount = 2
+			Expect(handler.computeHandshakeTimeout()).To(Equal(2250 * time.Millisecond))
+		})
+
+		It("uses the default backoff factor if none is set", func() {
+			handler = NewSentPacketHandler(&congestion.RTTStats{}, congestion.AlgorithmCubic, congestion.WindowDecayHalve, HandshakeRetransmissionPolicy{MinTimeout: time.Second}, nil, utils.DefaultLogger).(*sentPacketHandler)
+			handler.handshakeCount = 1
+			Expect(handler.computeHandshakeTimeout()).To(Equal(2 * time.Second))
+		})
+
+		It("limits the retransmission timeout", func() {
+			handler.handshakePolicy.MinTimeout = time.Second
+			handler.handshakePolicy.Backoff = 1e10
+			handler.handshakeCount = 1000
+			Expect(handler.computeHandshakeTimeout()).To(Equal(maxHandshakeTimeout))
+		})
+
+		It("errors when the maximum number of retransmissions is exceeded", func() {
+			handler.handshakePolicy.MaxRetransmissions = 2
+			handler.SentPacket(handshakePacket(&Packet{PacketNumber: 1, SendTime: time.Now().Add(-time.Hour)}))
+			Expect(handler.OnAlarm()).To(Succeed())
+			Expect(handler.OnAlarm()).To(Succeed())
+			err := handler.OnAlarm()
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.HandshakeTimeout))
 		})
 
 		It("rejects an ACK that acks packets with a higher encryption level", func() {
@@ -1071,5 +1358,15 @@ var _ = Describe("SentPacketHandler", func() {
 			packet := handler.DequeuePacketForRetransmission()
 			Expect(packet).To(BeNil())
 		})
+
+		It("removes discarded handshake packets from the bytes in flight", func() {
+			p := retransmittablePacket(&Packet{PacketNumber: 1, Length: 42})
+			p.EncryptionLevel = protocol.EncryptionSecure
+			handler.SentPacket(p)
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, Length: 100}))
+			Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(142)))
+			handler.SetHandshakeComplete()
+			Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(100)))
+		})
 	})
 })
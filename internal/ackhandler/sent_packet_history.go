@@ -33,24 +33,22 @@ func (h *sentPacketHistory) sentPacketImpl(p *Packet) *PacketElement {
 	return el
 }
 
-func (h *sentPacketHistory) SentPacketsAsRetransmission(packets []*Packet, retransmissionOf protocol.PacketNumber) {
-	retransmission, ok := h.packetMap[retransmissionOf]
-	// The retransmitted packet is not present anymore.
-	// This can happen if it was acked in between dequeueing of the retransmission and sending.
-	// Just treat the retransmissions as normal packets.
-	// TODO: This won't happen if we clear packets queued for retransmission on new ACKs.
-	if !ok {
-		for _, packet := range packets {
-			h.sentPacketImpl(packet)
-		}
-		return
-	}
-	retransmission.Value.retransmittedAs = make([]protocol.PacketNumber, len(packets))
-	for i, packet := range packets {
-		retransmission.Value.retransmittedAs[i] = packet.PacketNumber
+func (h *sentPacketHistory) SentPacketsAsRetransmission(packets []*Packet, retransmissionOf []protocol.PacketNumber) {
+	for _, packet := range packets {
 		el := h.sentPacketImpl(packet)
-		el.Value.isRetransmission = true
-		el.Value.retransmissionOf = retransmissionOf
+		for _, pn := range retransmissionOf {
+			retransmission, ok := h.packetMap[pn]
+			// The retransmitted packet is not present anymore.
+			// This can happen if it was acked in between dequeueing of the retransmission and sending,
+			// or if it was declared lost.
+			// Just treat the retransmissions as normal packets.
+			// TODO: This won't happen if we clear packets queued for retransmission on new ACKs.
+			if !ok {
+				continue
+			}
+			retransmission.Value.retransmittedAs = append(retransmission.Value.retransmittedAs, packet.PacketNumber)
+			el.Value.retransmissionOf = append(el.Value.retransmissionOf, pn)
+		}
 	}
 }
 
@@ -174,27 +174,38 @@ var _ = Describe("SentPacketHistory", func() {
 		})
 
 		It("adds a sent packets as a retransmission", func() {
-			hist.SentPacketsAsRetransmission([]*Packet{{PacketNumber: 13}}, 2)
+			hist.SentPacketsAsRetransmission([]*Packet{{PacketNumber: 13}}, []protocol.PacketNumber{2})
 			expectInHistory([]protocol.PacketNumber{1, 2, 3, 4, 5, 13})
-			Expect(hist.GetPacket(13).isRetransmission).To(BeTrue())
-			Expect(hist.GetPacket(13).retransmissionOf).To(Equal(protocol.PacketNumber(2)))
+			Expect(hist.GetPacket(13).retransmissionOf).To(Equal([]protocol.PacketNumber{2}))
 			Expect(hist.GetPacket(2).retransmittedAs).To(Equal([]protocol.PacketNumber{13}))
 		})
 
 		It("adds multiple packets sent as a retransmission", func() {
-			hist.SentPacketsAsRetransmission([]*Packet{{PacketNumber: 13}, {PacketNumber: 15}}, 2)
+			hist.SentPacketsAsRetransmission([]*Packet{{PacketNumber: 13}, {PacketNumber: 15}}, []protocol.PacketNumber{2})
 			expectInHistory([]protocol.PacketNumber{1, 2, 3, 4, 5, 13, 15})
-			Expect(hist.GetPacket(13).isRetransmission).To(BeTrue())
-			Expect(hist.GetPacket(13).retransmissionOf).To(Equal(protocol.PacketNumber(2)))
-			Expect(hist.GetPacket(15).retransmissionOf).To(Equal(protocol.PacketNumber(2)))
+			Expect(hist.GetPacket(13).retransmissionOf).To(Equal([]protocol.PacketNumber{2}))
+			Expect(hist.GetPacket(15).retransmissionOf).To(Equal([]protocol.PacketNumber{2}))
 			Expect(hist.GetPacket(2).retransmittedAs).To(Equal([]protocol.PacketNumber{13, 15}))
 		})
 
+		It("adds a packet sent as a retransmission of multiple packets", func() {
+			hist.SentPacketsAsRetransmission([]*Packet{{PacketNumber: 13}}, []protocol.PacketNumber{2, 4})
+			expectInHistory([]protocol.PacketNumber{1, 2, 3, 4, 5, 13})
+			Expect(hist.GetPacket(13).retransmissionOf).To(Equal([]protocol.PacketNumber{2, 4}))
+			Expect(hist.GetPacket(2).retransmittedAs).To(Equal([]protocol.PacketNumber{13}))
+			Expect(hist.GetPacket(4).retransmittedAs).To(Equal([]protocol.PacketNumber{13}))
+		})
+
 		It("adds a packet as a normal packet if the retransmitted packet doesn't exist", func() {
-			hist.SentPacketsAsRetransmission([]*Packet{{PacketNumber: 13}}, 7)
+			hist.SentPacketsAsRetransmission([]*Packet{{PacketNumber: 13}}, []protocol.PacketNumber{7})
 			expectInHistory([]protocol.PacketNumber{1, 2, 3, 4, 5, 13})
-			Expect(hist.GetPacket(13).isRetransmission).To(BeFalse())
-			Expect(hist.GetPacket(13).retransmissionOf).To(BeZero())
+			Expect(hist.GetPacket(13).retransmissionOf).To(BeEmpty())
+		})
+
+		It("only links a retransmission to the packets that still exist", func() {
+			hist.SentPacketsAsRetransmission([]*Packet{{PacketNumber: 13}}, []protocol.PacketNumber{7, 3})
+			Expect(hist.GetPacket(13).retransmissionOf).To(Equal([]protocol.PacketNumber{3}))
+			Expect(hist.GetPacket(3).retransmittedAs).To(Equal([]protocol.PacketNumber{13}))
 		})
 	})
 })
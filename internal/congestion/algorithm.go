@@ -0,0 +1,29 @@
+package congestion
+
+// An Algorithm is a congestion control algorithm.
+type Algorithm uint8
+
+const (
+	// AlgorithmCubic is Cubic (RFC 8312), with hybrid slow start and proportional rate reduction.
+	AlgorithmCubic Algorithm = iota
+	// AlgorithmBBRv2 is a BBRv2-style model-based algorithm.
+	// It paces at the estimated bottleneck bandwidth, and bounds the data in flight based on the loss rate and on ECN marks.
+	AlgorithmBBRv2
+	// AlgorithmNewReno is NewReno (RFC 6582), emulating a single TCP connection.
+	// It uses the same slow start and loss recovery as Cubic, but increases the congestion window by one packet per RTT.
+	// Unlike RFC 6582, it reduces the congestion window by 30% (instead of 50%) on loss.
+	AlgorithmNewReno
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case AlgorithmCubic:
+		return "Cubic"
+	case AlgorithmBBRv2:
+		return "BBRv2"
+	case AlgorithmNewReno:
+		return "NewReno"
+	default:
+		return "unknown congestion control algorithm"
+	}
+}
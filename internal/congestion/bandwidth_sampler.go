@@ -0,0 +1,128 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// A sendState is the state of the connection at the time a packet was sent.
+type sendState struct {
+	sentTime time.Time
+	size     protocol.ByteCount
+	// the bytes in flight when the packet was sent, including the packet itself
+	bytesInFlight protocol.ByteCount
+	// the number of bytes delivered, and the time of the last delivery, when the packet was sent
+	delivered     protocol.ByteCount
+	deliveredTime time.Time
+	// the send time of the first packet of the flight that the packet belongs to
+	firstSentTime time.Time
+	isAppLimited  bool
+}
+
+// A bandwidthSample is the delivery rate that was measured when a packet was acknowledged.
+type bandwidthSample struct {
+	bandwidth Bandwidth
+	// the bytes in flight when the acknowledged packet was sent
+	bytesInFlight protocol.ByteCount
+	// the number of bytes delivered when the acknowledged packet was sent
+	priorDelivered protocol.ByteCount
+	isAppLimited   bool
+}
+
+// The bandwidthSampler measures the delivery rate of a connection,
+// as described in draft-cheng-iccrg-delivery-rate-estimation.
+type bandwidthSampler struct {
+	packets map[protocol.PacketNumber]*sendState
+
+	delivered     protocol.ByteCount
+	deliveredTime time.Time
+	firstSentTime time.Time
+	// If non-zero, packets are sent application-limited until this number of bytes is delivered.
+	appLimitedUntil protocol.ByteCount
+}
+
+func newBandwidthSampler() *bandwidthSampler {
+	return &bandwidthSampler{packets: make(map[protocol.PacketNumber]*sendState)}
+}
+
+// OnPacketSent is called for every packet that is counted towards the bytes in flight.
+// The bytes in flight include the packet.
+func (s *bandwidthSampler) OnPacketSent(sentTime time.Time, packetNumber protocol.PacketNumber, size, bytesInFlight protocol.ByteCount) {
+	// If nothing else is in flight, this packet starts a new flight.
+	if bytesInFlight <= size {
+		s.firstSentTime = sentTime
+		s.deliveredTime = sentTime
+	}
+	s.packets[packetNumber] = &sendState{
+		sentTime:      sentTime,
+		size:          size,
+		bytesInFlight: bytesInFlight,
+		delivered:     s.delivered,
+		deliveredTime: s.deliveredTime,
+		firstSentTime: s.firstSentTime,
+		isAppLimited:  s.appLimitedUntil != 0,
+	}
+}
+
+// OnAppLimited is called when the sender doesn't have enough data to fully utilize the congestion window.
+// Samples are application-limited until all the bytes in flight are delivered.
+func (s *bandwidthSampler) OnAppLimited(bytesInFlight protocol.ByteCount) {
+	s.appLimitedUntil = utils.MaxByteCount(s.delivered+bytesInFlight, 1)
+}
+
+// OnPacketAcked is called when a packet is acknowledged.
+// It returns false if the packet is not tracked (any more).
+func (s *bandwidthSampler) OnPacketAcked(packetNumber protocol.PacketNumber, ackTime time.Time) (bandwidthSample, bool) {
+	p, ok := s.packets[packetNumber]
+	if !ok {
+		return bandwidthSample{}, false
+	}
+	delete(s.packets, packetNumber)
+	s.delivered += p.size
+	s.deliveredTime = ackTime
+	if s.appLimitedUntil != 0 && s.delivered > s.appLimitedUntil {
+		s.appLimitedUntil = 0
+	}
+	if p.sentTime.After(s.firstSentTime) {
+		s.firstSentTime = p.sentTime
+	}
+	sample := bandwidthSample{
+		bytesInFlight:  p.bytesInFlight,
+		priorDelivered: p.delivered,
+		isAppLimited:   p.isAppLimited,
+	}
+	// The delivery rate is limited by both the send rate and the ack rate.
+	interval := utils.MaxDuration(p.sentTime.Sub(p.firstSentTime), ackTime.Sub(p.deliveredTime))
+	if interval > 0 {
+		sample.bandwidth = BandwidthFromDelta(s.delivered-p.delivered, interval)
+	}
+	return sample, true
+}
+
+// OnPacketLost is called when a packet is declared lost.
+// It returns the state at the time the packet was sent, or nil if the packet is not tracked (any more).
+func (s *bandwidthSampler) OnPacketLost(packetNumber protocol.PacketNumber) *sendState {
+	p, ok := s.packets[packetNumber]
+	if !ok {
+		return nil
+	}
+	delete(s.packets, packetNumber)
+	return p
+}
+
+// RemoveOlderThan stops tracking all packets with a packet number smaller than the given packet number.
+// It is used for packets that are neither acknowledged nor declared lost, e.g. because they were discarded.
+func (s *bandwidthSampler) RemoveOlderThan(packetNumber protocol.PacketNumber) {
+	for pn := range s.packets {
+		if pn < packetNumber {
+			delete(s.packets, pn)
+		}
+	}
+}
+
+// Delivered returns the number of bytes delivered
+func (s *bandwidthSampler) Delivered() protocol.ByteCount {
+	return s.delivered
+}
@@ -0,0 +1,109 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bandwidth Sampler", func() {
+	var (
+		s   *bandwidthSampler
+		now time.Time
+	)
+
+	BeforeEach(func() {
+		s = newBandwidthSampler()
+		now = time.Now()
+	})
+
+	It("measures the delivery rate", func() {
+		// send 10 packets at once, and receive an ACK for every packet 10ms later
+		for i := 1; i <= 10; i++ {
+			s.OnPacketSent(now, protocol.PacketNumber(i), 1000, protocol.ByteCount(i)*1000)
+		}
+		for i := 1; i <= 10; i++ {
+			sample, ok := s.OnPacketAcked(protocol.PacketNumber(i), now.Add(100*time.Millisecond+time.Duration(i)*10*time.Millisecond))
+			Expect(ok).To(BeTrue())
+			Expect(sample.bytesInFlight).To(Equal(protocol.ByteCount(i) * 1000))
+			Expect(sample.priorDelivered).To(BeZero())
+			Expect(sample.isAppLimited).To(BeFalse())
+			Expect(sample.bandwidth).To(Equal(BandwidthFromDelta(protocol.ByteCount(i)*1000, 100*time.Millisecond+time.Duration(i)*10*time.Millisecond)))
+		}
+		Expect(s.Delivered()).To(Equal(protocol.ByteCount(10000)))
+	})
+
+	It("measures the delivery rate when packets are sent after packets are acknowledged", func() {
+		s.OnPacketSent(now, 1, 1000, 1000)
+		now = now.Add(100 * time.Millisecond)
+		_, ok := s.OnPacketAcked(1, now)
+		Expect(ok).To(BeTrue())
+		s.OnPacketSent(now, 2, 1000, 1000)
+		s.OnPacketSent(now, 3, 1000, 2000)
+		sample, ok := s.OnPacketAcked(2, now.Add(50*time.Millisecond))
+		Expect(ok).To(BeTrue())
+		Expect(sample.priorDelivered).To(Equal(protocol.ByteCount(1000)))
+		Expect(sample.bandwidth).To(Equal(BandwidthFromDelta(1000, 50*time.Millisecond)))
+		sample, ok = s.OnPacketAcked(3, now.Add(60*time.Millisecond))
+		Expect(ok).To(BeTrue())
+		Expect(sample.bandwidth).To(Equal(BandwidthFromDelta(2000, 60*time.Millisecond)))
+	})
+
+	It("uses the send rate if it's lower than the ACK rate", func() {
+		s.OnPacketSent(now, 1, 1000, 1000)
+		s.OnPacketSent(now, 2, 1000, 2000)
+		_, ok := s.OnPacketAcked(1, now.Add(50*time.Millisecond))
+		Expect(ok).To(BeTrue())
+		s.OnPacketSent(now.Add(100*time.Millisecond), 3, 1000, 2000)
+		_, ok = s.OnPacketAcked(2, now.Add(101*time.Millisecond))
+		Expect(ok).To(BeTrue())
+		sample, ok := s.OnPacketAcked(3, now.Add(102*time.Millisecond))
+		Expect(ok).To(BeTrue())
+		// 2000 bytes were acknowledged in 52ms, but it took 100ms to send them
+		Expect(sample.bandwidth).To(Equal(BandwidthFromDelta(2000, 100*time.Millisecond)))
+	})
+
+	It("marks samples as application-limited", func() {
+		s.OnPacketSent(now, 1, 1000, 1000)
+		s.OnAppLimited(1000)
+		s.OnPacketSent(now, 2, 1000, 2000)
+		sample, ok := s.OnPacketAcked(1, now.Add(10*time.Millisecond))
+		Expect(ok).To(BeTrue())
+		Expect(sample.isAppLimited).To(BeFalse())
+		sample, ok = s.OnPacketAcked(2, now.Add(20*time.Millisecond))
+		Expect(ok).To(BeTrue())
+		Expect(sample.isAppLimited).To(BeTrue())
+		// all the bytes that were in flight were delivered, so the application-limited phase ended
+		s.OnPacketSent(now.Add(20*time.Millisecond), 3, 1000, 1000)
+		sample, ok = s.OnPacketAcked(3, now.Add(30*time.Millisecond))
+		Expect(ok).To(BeTrue())
+		Expect(sample.isAppLimited).To(BeFalse())
+	})
+
+	It("returns the send state of lost packets", func() {
+		s.OnPacketSent(now, 1, 1000, 1000)
+		s.OnPacketSent(now, 2, 1200, 2200)
+		p := s.OnPacketLost(2)
+		Expect(p).ToNot(BeNil())
+		Expect(p.size).To(Equal(protocol.ByteCount(1200)))
+		Expect(p.bytesInFlight).To(Equal(protocol.ByteCount(2200)))
+		Expect(s.OnPacketLost(2)).To(BeNil())
+		_, ok := s.OnPacketAcked(2, now)
+		Expect(ok).To(BeFalse())
+		Expect(s.Delivered()).To(BeZero())
+	})
+
+	It("removes old packets", func() {
+		for i := 1; i <= 10; i++ {
+			s.OnPacketSent(now, protocol.PacketNumber(i), 1000, protocol.ByteCount(i)*1000)
+		}
+		s.RemoveOlderThan(5)
+		Expect(s.packets).To(HaveLen(6))
+		_, ok := s.OnPacketAcked(4, now)
+		Expect(ok).To(BeFalse())
+		_, ok = s.OnPacketAcked(5, now)
+		Expect(ok).To(BeTrue())
+	})
+})
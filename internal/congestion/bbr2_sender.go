@@ -0,0 +1,652 @@
+package congestion
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+const (
+	// the pacing and congestion window gain in Startup: 2/ln(2)
+	bbrStartupGain = 2.885
+	// the pacing gain in Drain, which drains the queue built up in Startup
+	bbrDrainGain = 1 / bbrStartupGain
+	// the congestion window gain, which allows for delayed and aggregated ACKs
+	bbrCwndGain = 2
+	// the pacing gains when probing for more bandwidth, and when draining the queue afterwards
+	bbrProbeUpGain   = 1.25
+	bbrProbeDownGain = 0.9
+	// the pacing rate is slightly lower than the bandwidth estimate, to reduce queueing
+	bbrPacingMargin = 0.01
+	// the number of rounds that the maximum bandwidth filter covers
+	bbrBandwidthFilterRounds = 10
+	// Startup is exited when the bandwidth didn't increase by 25% for 3 rounds
+	bbrFullBandwidthThreshold = 1.25
+	bbrFullBandwidthRounds    = 3
+	// the minimum RTT expires after this time, and is then measured in ProbeRTT
+	bbrMinRTTExpiry     = 5 * time.Second
+	bbrProbeRTTDuration = 200 * time.Millisecond
+	bbrProbeRTTCwndGain = 0.5
+	// If more than 2% of the data in flight is lost, the data in flight is too high.
+	bbrLossThreshold = 0.02
+	// If more than half of the packets acknowledged in a round were marked CE, the data in flight is too high.
+	bbrECNThreshold = 0.5
+	// the gain of the moving average of the fraction of CE marked packets
+	bbrECNAlphaGain = 1.0 / 16
+	// the reduction of the data in flight in response to CE marks, scaled by the fraction of CE marked packets
+	bbrECNFactor = 1.0 / 3
+	// the multiplicative decrease in response to loss
+	bbrBeta = 0.7
+	// the headroom left for other flows when not probing for bandwidth
+	bbrHeadroom = 0.15
+	// the minimum congestion window
+	bbrMinPipeCwnd = 4 * protocol.DefaultTCPMSS
+	// the number of bytes that the congestion window exceeds the target
+	bbrCwndQuantum = 3 * protocol.DefaultTCPMSS
+	// the maximum number of rounds between probes for bandwidth, for coexistence with Reno and Cubic flows
+	bbrMaxProbeRounds = 63
+	// the time between probes for bandwidth is randomized between 2 and 3 seconds
+	bbrProbeWaitBase = 2 * time.Second
+	bbrProbeWaitRand = time.Second
+)
+
+// infiniteBandwidth is used for bandwidth bounds that are not set
+const infiniteBandwidth Bandwidth = math.MaxUint64
+
+type bbrMode uint8
+
+const (
+	bbrModeStartup bbrMode = iota
+	bbrModeDrain
+	bbrModeProbeBW
+	bbrModeProbeRTT
+)
+
+// the phases of the ProbeBW mode
+type bbrProbeBWPhase uint8
+
+const (
+	bbrPhaseDown bbrProbeBWPhase = iota
+	bbrPhaseCruise
+	bbrPhaseRefill
+	bbrPhaseUp
+)
+
+// The bbr2Sender is a BBRv2-style congestion controller.
+// It builds a model of the path from the measured delivery rate and the minimum RTT, and paces packets at the estimated bandwidth.
+// In addition to BBR, it bounds the data in flight when it experiences loss or ECN marks:
+// * inflightHi is an upper bound, which is set when probing for bandwidth causes loss or a large fraction of CE marks.
+// * bandwidthLo and inflightLo are lower bounds, which are reduced in every round that experiences loss or CE marks,
+//   and reset when probing for bandwidth.
+type bbr2Sender struct {
+	clock    Clock
+	rttStats *RTTStats
+	sampler  *bandwidthSampler
+	pacer    *pacer
+	// the max packet size used by the pacer
+	maxPacketSize protocol.ByteCount
+
+	mode  bbrMode
+	phase bbrProbeBWPhase
+
+	// round trip counting
+	roundCount         uint64
+	roundStart         bool
+	nextRoundDelivered protocol.ByteCount
+	// the largest packet sent, and the largest packet sent when the previous round started
+	largestSentPacketNumber         protocol.PacketNumber
+	largestSentAtPreviousRoundStart protocol.PacketNumber
+
+	// the model of the path
+	maxBandwidth    *maxBandwidthFilter
+	bandwidthLo     Bandwidth
+	inflightHi      protocol.ByteCount
+	inflightLo      protocol.ByteCount
+	minRTT          time.Duration
+	minRTTTimestamp time.Time
+	// the latest RTT sample, which is processed with the next ACK
+	rttSample time.Duration
+
+	// the congestion signals of the current round
+	bytesLostInRound     protocol.ByteCount
+	packetsAckedInRound  uint64
+	packetsMarkedInRound uint64
+	// the maximum delivery rate, the maximum number of bytes delivered and the maximum bytes in flight of the samples of the current round
+	latestBandwidth     Bandwidth
+	latestDelivered     protocol.ByteCount
+	latestBytesInFlight protocol.ByteCount
+	// the moving average of the fraction of CE marked packets
+	ecnAlpha float64
+	// whether the data in flight can be found to be too high, which only happens once per probe for bandwidth
+	bandwidthProbeSamples bool
+
+	// Startup
+	fullBandwidthReached bool
+	fullBandwidth        Bandwidth
+	fullBandwidthCount   int
+
+	// ProbeBW
+	cycleStart       time.Time
+	probeWait        time.Duration
+	roundsSinceProbe uint64
+	phaseStartRound  uint64
+	probeUpIncrease  protocol.ByteCount
+
+	// ProbeRTT
+	probeRTTDoneTime  time.Time
+	probeRTTRoundDone bool
+	priorCwnd         protocol.ByteCount
+
+	congestionWindow        protocol.ByteCount
+	initialCongestionWindow protocol.ByteCount
+	maxCongestionWindow     protocol.ByteCount
+}
+
+var _ SendAlgorithm = &bbr2Sender{}
+
+// NewBBR2Sender makes a new BBRv2 sender
+func NewBBR2Sender(clock Clock, rttStats *RTTStats, initialCongestionWindow, maxCongestionWindow protocol.ByteCount) SendAlgorithm {
+	return newBBR2Sender(clock, rttStats, initialCongestionWindow, maxCongestionWindow)
+}
+
+func newBBR2Sender(clock Clock, rttStats *RTTStats, initialCongestionWindow, maxCongestionWindow protocol.ByteCount) *bbr2Sender {
+	b := &bbr2Sender{
+		clock:                   clock,
+		rttStats:                rttStats,
+		initialCongestionWindow: initialCongestionWindow,
+		maxCongestionWindow:     maxCongestionWindow,
+		maxPacketSize:           protocol.MaxPacketSizeIPv4,
+	}
+	b.reset()
+	return b
+}
+
+func (b *bbr2Sender) reset() {
+	b.sampler = newBandwidthSampler()
+	b.pacer = newPacer(b.PacingRate)
+	b.pacer.SetMaxPacketSize(b.maxPacketSize)
+	b.mode = bbrModeStartup
+	b.roundCount = 0
+	b.roundStart = false
+	b.nextRoundDelivered = 0
+	b.largestSentPacketNumber = 0
+	b.largestSentAtPreviousRoundStart = 0
+	b.maxBandwidth = newMaxBandwidthFilter(bbrBandwidthFilterRounds)
+	b.bandwidthLo = infiniteBandwidth
+	b.inflightHi = protocol.MaxByteCount
+	b.inflightLo = protocol.MaxByteCount
+	b.minRTT = 0
+	b.minRTTTimestamp = time.Time{}
+	b.rttSample = 0
+	b.resetCongestionSignals()
+	b.ecnAlpha = 0
+	b.bandwidthProbeSamples = true
+	b.fullBandwidthReached = false
+	b.fullBandwidth = 0
+	b.fullBandwidthCount = 0
+	b.probeRTTDoneTime = time.Time{}
+	b.congestionWindow = b.initialCongestionWindow
+}
+
+// TimeUntilSend returns when the next packet should be sent.
+// It returns the zero value if a packet can be sent immediately.
+func (b *bbr2Sender) TimeUntilSend(protocol.ByteCount) time.Time {
+	return b.pacer.TimeUntilSend()
+}
+
+// PacingBudget returns the number of bytes that the pacer allows sending at the given time.
+func (b *bbr2Sender) PacingBudget(now time.Time) protocol.ByteCount {
+	return b.pacer.Budget(now)
+}
+
+func (b *bbr2Sender) OnPacketSent(
+	sentTime time.Time,
+	bytesInFlight protocol.ByteCount,
+	packetNumber protocol.PacketNumber,
+	bytes protocol.ByteCount,
+	isRetransmittable bool,
+) {
+	if !isRetransmittable {
+		return
+	}
+	// Nothing else is in flight. The connection was idle, because the application didn't send any data.
+	if bytesInFlight <= bytes && b.largestSentPacketNumber != 0 {
+		b.sampler.OnAppLimited(bytesInFlight)
+	}
+	b.largestSentPacketNumber = packetNumber
+	b.sampler.OnPacketSent(sentTime, packetNumber, bytes, bytesInFlight)
+	b.pacer.SentPacket(sentTime, bytes)
+}
+
+// GetCongestionWindow returns the congestion window, bounded by the model of the path.
+func (b *bbr2Sender) GetCongestionWindow() protocol.ByteCount {
+	cwnd := b.congestionWindow
+	if b.mode == bbrModeProbeBW && (b.phase == bbrPhaseDown || b.phase == bbrPhaseCruise) {
+		cwnd = utils.MinByteCount(cwnd, b.inflightWithHeadroom())
+	} else {
+		cwnd = utils.MinByteCount(cwnd, b.inflightHi)
+	}
+	cwnd = utils.MinByteCount(cwnd, b.inflightLo)
+	if b.mode == bbrModeProbeRTT {
+		cwnd = utils.MinByteCount(cwnd, b.probeRTTCwnd())
+	}
+	return utils.MaxByteCount(cwnd, bbrMinPipeCwnd)
+}
+
+// MaybeExitSlowStart is called when the RTT was updated.
+// BBR doesn't use slow start, Startup is exited based on the bandwidth estimate.
+func (b *bbr2Sender) MaybeExitSlowStart() {
+	b.rttSample = b.rttStats.LatestRTT()
+}
+
+func (b *bbr2Sender) OnPacketAcked(
+	ackedPacketNumber protocol.PacketNumber,
+	ackedBytes protocol.ByteCount,
+	priorInFlight protocol.ByteCount,
+	eventTime time.Time,
+) {
+	sample, ok := b.sampler.OnPacketAcked(ackedPacketNumber, eventTime)
+	if !ok {
+		return
+	}
+	b.updateRound(sample)
+	b.updateMinRTT(eventTime)
+	b.updateBandwidth(sample)
+	b.packetsAckedInRound++
+	if b.roundStart {
+		b.checkFullBandwidthReached(sample)
+	}
+	// the data in flight after this packet was acknowledged
+	bytesInFlight := priorInFlight - utils.MinByteCount(ackedBytes, priorInFlight)
+	b.updateMode(bytesInFlight, eventTime)
+	b.updateCongestionWindow(ackedBytes)
+}
+
+func (b *bbr2Sender) updateRound(sample bandwidthSample) {
+	b.roundStart = false
+	if sample.priorDelivered < b.nextRoundDelivered {
+		return
+	}
+	b.onRoundEnd()
+	b.roundStart = true
+	b.roundCount++
+	b.roundsSinceProbe++
+	b.nextRoundDelivered = b.sampler.Delivered()
+	// Packets sent before the previous round started are neither acknowledged nor lost any more.
+	b.sampler.RemoveOlderThan(b.largestSentAtPreviousRoundStart)
+	b.largestSentAtPreviousRoundStart = b.largestSentPacketNumber
+}
+
+// onRoundEnd reacts to the congestion signals of the round that just ended.
+func (b *bbr2Sender) onRoundEnd() {
+	if b.packetsAckedInRound > 0 {
+		markedFraction := float64(b.packetsMarkedInRound) / float64(b.packetsAckedInRound)
+		b.ecnAlpha = (1-bbrECNAlphaGain)*b.ecnAlpha + bbrECNAlphaGain*markedFraction
+		if markedFraction > bbrECNThreshold {
+			b.onInflightTooHigh(b.latestBytesInFlight, false)
+		}
+	}
+	if b.bytesLostInRound > 0 || b.packetsMarkedInRound > 0 {
+		b.adaptLowerBounds()
+	}
+	b.resetCongestionSignals()
+}
+
+func (b *bbr2Sender) resetCongestionSignals() {
+	b.bytesLostInRound = 0
+	b.packetsAckedInRound = 0
+	b.packetsMarkedInRound = 0
+	b.latestBandwidth = 0
+	b.latestDelivered = 0
+	b.latestBytesInFlight = 0
+}
+
+// adaptLowerBounds reduces the lower bounds in response to loss and CE marks.
+// The lower bounds are not used while probing for bandwidth.
+func (b *bbr2Sender) adaptLowerBounds() {
+	if b.isProbingBandwidth() {
+		return
+	}
+	if b.bandwidthLo == infiniteBandwidth {
+		b.bandwidthLo = b.maxBandwidth.Get()
+	}
+	if b.inflightLo == protocol.MaxByteCount {
+		b.inflightLo = b.congestionWindow
+	}
+	if b.bytesLostInRound > 0 {
+		b.bandwidthLo = Bandwidth(math.Max(float64(b.latestBandwidth), bbrBeta*float64(b.bandwidthLo)))
+		b.inflightLo = protocol.ByteCount(math.Max(float64(b.latestDelivered), bbrBeta*float64(b.inflightLo)))
+	}
+	if b.packetsMarkedInRound > 0 {
+		b.inflightLo = protocol.ByteCount((1 - b.ecnAlpha*bbrECNFactor) * float64(b.inflightLo))
+	}
+	b.inflightLo = utils.MaxByteCount(b.inflightLo, bbrMinPipeCwnd)
+}
+
+func (b *bbr2Sender) resetLowerBounds() {
+	b.bandwidthLo = infiniteBandwidth
+	b.inflightLo = protocol.MaxByteCount
+}
+
+func (b *bbr2Sender) updateMinRTT(now time.Time) {
+	expired := !b.minRTTTimestamp.IsZero() && now.Sub(b.minRTTTimestamp) > bbrMinRTTExpiry
+	if b.rttSample > 0 && (b.minRTT == 0 || b.rttSample <= b.minRTT || expired) {
+		b.minRTT = b.rttSample
+		b.minRTTTimestamp = now
+	}
+	b.rttSample = 0
+	if expired && b.mode != bbrModeProbeRTT {
+		b.enterProbeRTT()
+	}
+}
+
+func (b *bbr2Sender) updateBandwidth(sample bandwidthSample) {
+	if sample.bandwidth > b.latestBandwidth {
+		b.latestBandwidth = sample.bandwidth
+	}
+	if delivered := b.sampler.Delivered() - sample.priorDelivered; delivered > b.latestDelivered {
+		b.latestDelivered = delivered
+	}
+	if sample.bytesInFlight > b.latestBytesInFlight {
+		b.latestBytesInFlight = sample.bytesInFlight
+	}
+	// Application-limited samples underestimate the bandwidth, unless they're larger than the current estimate.
+	if !sample.isAppLimited || sample.bandwidth >= b.maxBandwidth.Get() {
+		b.maxBandwidth.Update(sample.bandwidth, b.roundCount)
+	}
+}
+
+func (b *bbr2Sender) checkFullBandwidthReached(sample bandwidthSample) {
+	if b.fullBandwidthReached || sample.isAppLimited {
+		return
+	}
+	if bw := b.maxBandwidth.Get(); float64(bw) >= bbrFullBandwidthThreshold*float64(b.fullBandwidth) {
+		b.fullBandwidth = bw
+		b.fullBandwidthCount = 0
+		return
+	}
+	b.fullBandwidthCount++
+	if b.fullBandwidthCount >= bbrFullBandwidthRounds {
+		b.fullBandwidthReached = true
+	}
+}
+
+func (b *bbr2Sender) updateMode(bytesInFlight protocol.ByteCount, now time.Time) {
+	switch b.mode {
+	case bbrModeStartup:
+		if b.fullBandwidthReached {
+			b.mode = bbrModeDrain
+		}
+	case bbrModeProbeRTT:
+		b.updateProbeRTT(bytesInFlight, now)
+	}
+	if b.mode == bbrModeDrain && bytesInFlight <= b.bdp(1) {
+		b.enterProbeBW(now)
+	}
+	if b.mode == bbrModeProbeBW {
+		b.updateProbeBWPhase(bytesInFlight, now)
+	}
+}
+
+func (b *bbr2Sender) enterProbeBW(now time.Time) {
+	b.mode = bbrModeProbeBW
+	b.enterPhaseDown(now)
+}
+
+func (b *bbr2Sender) updateProbeBWPhase(bytesInFlight protocol.ByteCount, now time.Time) {
+	switch b.phase {
+	case bbrPhaseDown:
+		if b.isTimeToProbe(now) {
+			b.enterPhaseRefill()
+		} else if bytesInFlight <= b.inflightWithHeadroom() && bytesInFlight <= b.bdp(1) {
+			b.setPhase(bbrPhaseCruise)
+		}
+	case bbrPhaseCruise:
+		if b.isTimeToProbe(now) {
+			b.enterPhaseRefill()
+		}
+	case bbrPhaseRefill:
+		// Refill the pipe for one round, before probing for more bandwidth.
+		if b.roundStart && b.roundCount > b.phaseStartRound {
+			b.setPhase(bbrPhaseUp)
+			b.probeUpIncrease = protocol.DefaultTCPMSS
+		}
+	case bbrPhaseUp:
+		if b.roundStart && b.inflightHi != protocol.MaxByteCount && bytesInFlight >= b.inflightHi {
+			// The data in flight reached the upper bound without excessive loss. Raise the bound, exponentially in every round.
+			b.inflightHi += b.probeUpIncrease
+			b.probeUpIncrease *= 2
+		}
+		if b.roundCount > b.phaseStartRound && bytesInFlight > b.bdp(bbrProbeUpGain) {
+			b.enterPhaseDown(now)
+		}
+	}
+}
+
+func (b *bbr2Sender) setPhase(phase bbrProbeBWPhase) {
+	b.phase = phase
+	b.phaseStartRound = b.roundCount
+}
+
+func (b *bbr2Sender) enterPhaseDown(now time.Time) {
+	b.setPhase(bbrPhaseDown)
+	b.cycleStart = now
+	b.roundsSinceProbe = 0
+	b.probeWait = bbrProbeWaitBase + time.Duration(rand.Int63n(int64(bbrProbeWaitRand)))
+}
+
+func (b *bbr2Sender) enterPhaseRefill() {
+	b.setPhase(bbrPhaseRefill)
+	b.resetLowerBounds()
+	b.bandwidthProbeSamples = true
+}
+
+// isTimeToProbe says if it's time to probe for more bandwidth.
+// The time between probes is randomized, and it is bounded by the time a Reno flow would need to utilize the bandwidth.
+func (b *bbr2Sender) isTimeToProbe(now time.Time) bool {
+	if now.Sub(b.cycleStart) >= b.probeWait {
+		return true
+	}
+	renoRounds := utils.MinUint64(uint64(b.bdp(1)/protocol.DefaultTCPMSS), bbrMaxProbeRounds)
+	return b.roundsSinceProbe >= renoRounds
+}
+
+func (b *bbr2Sender) isProbingBandwidth() bool {
+	return b.mode == bbrModeStartup || (b.mode == bbrModeProbeBW && (b.phase == bbrPhaseRefill || b.phase == bbrPhaseUp))
+}
+
+func (b *bbr2Sender) enterProbeRTT() {
+	b.mode = bbrModeProbeRTT
+	b.priorCwnd = b.congestionWindow
+	b.probeRTTDoneTime = time.Time{}
+	b.probeRTTRoundDone = false
+}
+
+func (b *bbr2Sender) updateProbeRTT(bytesInFlight protocol.ByteCount, now time.Time) {
+	if b.probeRTTDoneTime.IsZero() {
+		if bytesInFlight <= b.probeRTTCwnd() {
+			// The queue was drained. Stay in ProbeRTT for at least 200ms and one round.
+			b.probeRTTDoneTime = now.Add(bbrProbeRTTDuration)
+			b.nextRoundDelivered = b.sampler.Delivered()
+		}
+		return
+	}
+	if b.roundStart {
+		b.probeRTTRoundDone = true
+	}
+	if !b.probeRTTRoundDone || now.Before(b.probeRTTDoneTime) {
+		return
+	}
+	b.minRTTTimestamp = now
+	b.congestionWindow = utils.MaxByteCount(b.congestionWindow, b.priorCwnd)
+	b.resetLowerBounds()
+	if !b.fullBandwidthReached {
+		b.mode = bbrModeStartup
+		return
+	}
+	b.enterProbeBW(now)
+	b.setPhase(bbrPhaseCruise)
+}
+
+func (b *bbr2Sender) updateCongestionWindow(ackedBytes protocol.ByteCount) {
+	target := b.bdp(bbrCwndGain) + bbrCwndQuantum
+	if b.fullBandwidthReached {
+		b.congestionWindow = utils.MinByteCount(b.congestionWindow+ackedBytes, target)
+	} else if b.congestionWindow < target || b.sampler.Delivered() < b.initialCongestionWindow {
+		b.congestionWindow += ackedBytes
+	}
+	b.congestionWindow = utils.MaxByteCount(b.congestionWindow, bbrMinPipeCwnd)
+	b.congestionWindow = utils.MinByteCount(b.congestionWindow, b.maxCongestionWindow)
+}
+
+func (b *bbr2Sender) OnPacketLost(
+	packetNumber protocol.PacketNumber,
+	lostBytes protocol.ByteCount,
+	priorInFlight protocol.ByteCount,
+) {
+	p := b.sampler.OnPacketLost(packetNumber)
+	b.bytesLostInRound += lostBytes
+	if p == nil {
+		return
+	}
+	if float64(b.bytesLostInRound) > bbrLossThreshold*float64(priorInFlight) {
+		b.onInflightTooHigh(priorInFlight, p.isAppLimited)
+	}
+}
+
+// OnCongestionExperienced is called when the peer reports CE marks (RFC 3168).
+// The fraction of CE marked packets is evaluated at the end of every round.
+func (b *bbr2Sender) OnCongestionExperienced(_ protocol.PacketNumber, numMarked uint64, _ protocol.ByteCount) {
+	b.packetsMarkedInRound += numMarked
+}
+
+// onInflightTooHigh is called when probing for bandwidth caused too much loss, or too many CE marks.
+// The data in flight at the time is an upper bound for the data in flight.
+func (b *bbr2Sender) onInflightTooHigh(bytesInFlight protocol.ByteCount, isAppLimited bool) {
+	if !b.bandwidthProbeSamples {
+		return
+	}
+	// only react once per probe for bandwidth
+	b.bandwidthProbeSamples = false
+	if !isAppLimited {
+		target := utils.MinByteCount(b.bdp(1), b.congestionWindow)
+		b.inflightHi = utils.MaxByteCount(bytesInFlight, protocol.ByteCount(bbrBeta*float64(target)))
+	}
+	switch b.mode {
+	case bbrModeStartup:
+		b.fullBandwidthReached = true
+		b.mode = bbrModeDrain
+	case bbrModeProbeBW:
+		if b.phase == bbrPhaseUp || b.phase == bbrPhaseRefill {
+			b.enterPhaseDown(b.clock.Now())
+		}
+	}
+}
+
+// bdp returns the bandwidth-delay product, multiplied by the gain.
+// If the bandwidth or the minimum RTT is not known yet, it returns the initial congestion window.
+func (b *bbr2Sender) bdp(gain float64) protocol.ByteCount {
+	bw := b.bandwidth()
+	if bw == 0 || b.minRTT == 0 {
+		return b.initialCongestionWindow
+	}
+	return protocol.ByteCount(gain * float64(bw/BytesPerSecond) * b.minRTT.Seconds())
+}
+
+func (b *bbr2Sender) inflightWithHeadroom() protocol.ByteCount {
+	if b.inflightHi == protocol.MaxByteCount {
+		return protocol.MaxByteCount
+	}
+	return utils.MaxByteCount(protocol.ByteCount((1-bbrHeadroom)*float64(b.inflightHi)), bbrMinPipeCwnd)
+}
+
+func (b *bbr2Sender) probeRTTCwnd() protocol.ByteCount {
+	return utils.MaxByteCount(b.bdp(bbrProbeRTTCwndGain), bbrMinPipeCwnd)
+}
+
+// bandwidth is the bandwidth estimate, bounded by the lower bound
+func (b *bbr2Sender) bandwidth() Bandwidth {
+	bw := b.maxBandwidth.Get()
+	if b.bandwidthLo < bw {
+		return b.bandwidthLo
+	}
+	return bw
+}
+
+func (b *bbr2Sender) pacingGain() float64 {
+	switch b.mode {
+	case bbrModeStartup:
+		return bbrStartupGain
+	case bbrModeDrain:
+		return bbrDrainGain
+	case bbrModeProbeBW:
+		switch b.phase {
+		case bbrPhaseDown:
+			return bbrProbeDownGain
+		case bbrPhaseUp:
+			return bbrProbeUpGain
+		}
+	}
+	return 1
+}
+
+// PacingRate is the rate that packets are paced at.
+// Before the bandwidth was measured, it is derived from the initial congestion window and the RTT.
+func (b *bbr2Sender) PacingRate() Bandwidth {
+	bw := b.bandwidth()
+	if bw == 0 {
+		srtt := b.rttStats.SmoothedRTT()
+		if srtt == 0 {
+			return 0
+		}
+		bw = BandwidthFromDelta(b.initialCongestionWindow, srtt)
+	}
+	return Bandwidth(b.pacingGain() * (1 - bbrPacingMargin) * float64(bw))
+}
+
+// BandwidthEstimate returns the current bandwidth estimate
+func (b *bbr2Sender) BandwidthEstimate() Bandwidth {
+	return b.bandwidth()
+}
+
+// SetMaxPacketSize sets the max packet size used by the pacer
+func (b *bbr2Sender) SetMaxPacketSize(size protocol.ByteCount) {
+	b.maxPacketSize = size
+	b.pacer.SetMaxPacketSize(size)
+}
+
+// SetNumEmulatedConnections is not supported by BBR
+func (b *bbr2Sender) SetNumEmulatedConnections(int) {}
+
+// Resume is not supported by BBR.
+// BBR measures the bandwidth during startup, and doesn't use a saved congestion window.
+func (b *bbr2Sender) Resume(ResumeState) {}
+
+// GetResumeState returns the bandwidth-delay product as the congestion window,
+// once the bandwidth and the minimum RTT were measured.
+func (b *bbr2Sender) GetResumeState() (ResumeState, bool) {
+	if b.bandwidth() == 0 || b.minRTT == 0 {
+		return ResumeState{}, false
+	}
+	return ResumeState{CongestionWindow: b.bdp(1), RTT: b.minRTT}, true
+}
+
+// OnRetransmissionTimeout is called on an retransmission timeout
+func (b *bbr2Sender) OnRetransmissionTimeout(packetsRetransmitted bool) {
+	if !packetsRetransmitted {
+		return
+	}
+	b.congestionWindow = bbrMinPipeCwnd
+}
+
+// OnConnectionMigration is called when the connection is migrated.
+// The model of the old path doesn't apply to the new path.
+func (b *bbr2Sender) OnConnectionMigration() {
+	b.reset()
+}
+
+// SetSlowStartLargeReduction is not supported by BBR
+func (b *bbr2Sender) SetSlowStartLargeReduction(bool) {}
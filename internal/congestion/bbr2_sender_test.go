@@ -0,0 +1,309 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BBRv2 Sender", func() {
+	const (
+		packetSize = protocol.ByteCount(1200)
+		rtt        = 50 * time.Millisecond
+		// the bandwidth of the bottleneck link
+		bottleneck = 1000 * Bandwidth(packetSize) * BytesPerSecond // 1000 packets per second
+		bdp        = 50 * packetSize
+	)
+
+	type simulatedPacket struct {
+		packetNumber protocol.PacketNumber
+		sentTime     time.Time
+		ackTime      time.Time
+	}
+
+	var (
+		sender        *bbr2Sender
+		clock         mockClock
+		rttStats      *RTTStats
+		bytesInFlight protocol.ByteCount
+		packetNumber  protocol.PacketNumber
+		inFlight      []simulatedPacket
+		lastDelivery  time.Time
+	)
+
+	BeforeEach(func() {
+		clock = mockClock(time.Now())
+		rttStats = NewRTTStats()
+		sender = newBBR2Sender(&clock, rttStats, initialCongestionWindowPackets*packetSize, MaxCongestionWindow)
+		bytesInFlight = 0
+		packetNumber = 0
+		inFlight = nil
+		lastDelivery = time.Time{}
+	})
+
+	canSend := func() bool {
+		if bytesInFlight >= sender.GetCongestionWindow() {
+			return false
+		}
+		t := sender.TimeUntilSend(bytesInFlight)
+		return t.IsZero() || !t.After(clock.Now())
+	}
+
+	// sendPackets sends as many packets as the congestion window and the pacer allow.
+	// Packets are queued at the bottleneck link, and acknowledged one RTT after they left the queue.
+	sendPackets := func() {
+		for canSend() {
+			packetNumber++
+			bytesInFlight += packetSize
+			sender.OnPacketSent(clock.Now(), bytesInFlight, packetNumber, packetSize, true)
+			delivery := utils.MaxTime(clock.Now(), lastDelivery).Add(time.Second / 1000)
+			lastDelivery = delivery
+			inFlight = append(inFlight, simulatedPacket{
+				packetNumber: packetNumber,
+				sentTime:     clock.Now(),
+				ackTime:      delivery.Add(rtt),
+			})
+		}
+	}
+
+	// ackPacket advances the clock to the time the next packet is acknowledged, and acknowledges it
+	ackPacket := func() simulatedPacket {
+		p := inFlight[0]
+		inFlight = inFlight[1:]
+		if p.ackTime.After(clock.Now()) {
+			clock = mockClock(p.ackTime)
+		}
+		rttStats.UpdateRTT(clock.Now().Sub(p.sentTime), 0, clock.Now())
+		sender.MaybeExitSlowStart()
+		sender.OnPacketAcked(p.packetNumber, packetSize, bytesInFlight, clock.Now())
+		bytesInFlight -= packetSize
+		return p
+	}
+
+	losePacket := func() {
+		p := inFlight[0]
+		inFlight = inFlight[1:]
+		sender.OnPacketLost(p.packetNumber, packetSize, bytesInFlight)
+		bytesInFlight -= packetSize
+	}
+
+	// step sends packets, and then advances the clock to the next event:
+	// Either the pacer allows sending the next packet, or the next packet is acknowledged.
+	step := func() {
+		sendPackets()
+		if bytesInFlight < sender.GetCongestionWindow() {
+			if t := sender.TimeUntilSend(bytesInFlight); t.Before(inFlight[0].ackTime) {
+				clock = mockClock(t)
+				return
+			}
+		}
+		ackPacket()
+	}
+
+	run := func(d time.Duration) {
+		end := clock.Now().Add(d)
+		for clock.Now().Before(end) {
+			step()
+		}
+	}
+
+	// runUntilRoundStart runs the simulation until the next round starts
+	runUntilRoundStart := func() {
+		round := sender.roundCount
+		for sender.roundCount == round {
+			step()
+		}
+	}
+
+	It("starts in Startup, with the initial congestion window", func() {
+		Expect(sender.mode).To(Equal(bbrModeStartup))
+		Expect(sender.GetCongestionWindow()).To(Equal(initialCongestionWindowPackets * packetSize))
+		Expect(sender.TimeUntilSend(0)).To(BeZero())
+		Expect(sender.BandwidthEstimate()).To(BeZero())
+	})
+
+	It("paces the initial congestion window over the RTT, before the bandwidth is known", func() {
+		Expect(sender.PacingRate()).To(BeZero())
+		rttStats.UpdateRTT(rtt, 0, clock.Now())
+		Expect(sender.PacingRate()).To(BeNumerically("~", bbrStartupGain*float64(BandwidthFromDelta(initialCongestionWindowPackets*packetSize, rtt)), 1e5))
+	})
+
+	It("estimates the bandwidth, exits Startup and drains the queue", func() {
+		run(2 * time.Second)
+		Expect(sender.fullBandwidthReached).To(BeTrue())
+		Expect(sender.mode).To(Equal(bbrModeProbeBW))
+		Expect(sender.BandwidthEstimate()).To(BeNumerically("~", bottleneck, bottleneck/20))
+		Expect(sender.minRTT).To(BeNumerically("~", rtt, 2*time.Millisecond))
+		// the congestion window is bounded by the BDP
+		Expect(sender.GetCongestionWindow()).To(BeNumerically("<=", bbrCwndGain*bdp*11/10+bbrCwndQuantum))
+		Expect(sender.GetCongestionWindow()).To(BeNumerically(">=", bdp))
+	})
+
+	It("paces at the bandwidth estimate", func() {
+		run(2 * time.Second)
+		sender.phase = bbrPhaseCruise
+		Expect(sender.PacingRate()).To(BeNumerically("~", (1-bbrPacingMargin)*float64(sender.BandwidthEstimate()), 1e3))
+		sender.phase = bbrPhaseUp
+		Expect(sender.PacingRate()).To(BeNumerically("~", bbrProbeUpGain*(1-bbrPacingMargin)*float64(sender.BandwidthEstimate()), 1e3))
+	})
+
+	It("regularly probes for more bandwidth", func() {
+		run(2 * time.Second)
+		phases := make(map[bbrProbeBWPhase]bool)
+		for i := 0; i < 20000; i++ {
+			step()
+			phases[sender.phase] = true
+		}
+		Expect(phases).To(HaveLen(4))
+	})
+
+	Context("reacting to loss", func() {
+		It("sets an upper bound for the data in flight, when the loss rate in Startup is too high", func() {
+			rttStats.UpdateRTT(rtt, 0, clock.Now())
+			sendPackets()
+			Expect(bytesInFlight).To(Equal(initialCongestionWindowPackets * packetSize))
+			losePacket()
+			// 1 of 10 packets was lost
+			Expect(sender.fullBandwidthReached).To(BeTrue())
+			Expect(sender.mode).To(Equal(bbrModeDrain))
+			Expect(sender.inflightHi).To(Equal(initialCongestionWindowPackets * packetSize))
+			Expect(sender.GetCongestionWindow()).To(Equal(initialCongestionWindowPackets * packetSize))
+		})
+
+		It("ignores a low loss rate", func() {
+			run(300 * time.Millisecond)
+			Expect(bytesInFlight).To(BeNumerically(">", 50*packetSize))
+			losePacket()
+			Expect(sender.inflightHi).To(Equal(protocol.MaxByteCount))
+			Expect(sender.mode).To(Equal(bbrModeStartup))
+		})
+
+		It("only reacts once per probe for bandwidth", func() {
+			rttStats.UpdateRTT(rtt, 0, clock.Now())
+			sendPackets()
+			losePacket()
+			inflightHi := sender.inflightHi
+			Expect(inflightHi).To(BeNumerically("<", protocol.MaxByteCount))
+			losePacket()
+			losePacket()
+			Expect(sender.inflightHi).To(Equal(inflightHi))
+		})
+
+		It("reduces the lower bounds at the end of a round with loss", func() {
+			run(2 * time.Second)
+			sender.setPhase(bbrPhaseCruise)
+			sender.cycleStart = clock.Now()
+			sender.roundsSinceProbe = 0
+			cwnd := sender.GetCongestionWindow()
+			runUntilRoundStart()
+			Expect(sender.inflightLo).To(Equal(protocol.MaxByteCount))
+			losePacket()
+			runUntilRoundStart()
+			Expect(sender.inflightLo).To(BeNumerically("<", cwnd))
+			Expect(sender.bandwidthLo).To(BeNumerically("<", infiniteBandwidth))
+			Expect(sender.GetCongestionWindow()).To(BeNumerically("<=", sender.inflightLo))
+		})
+
+		It("resets the lower bounds when probing for bandwidth", func() {
+			run(2 * time.Second)
+			sender.inflightLo = bdp / 2
+			sender.bandwidthLo = bottleneck / 2
+			sender.enterPhaseRefill()
+			Expect(sender.inflightLo).To(Equal(protocol.MaxByteCount))
+			Expect(sender.bandwidthLo).To(Equal(infiniteBandwidth))
+			Expect(sender.bandwidthProbeSamples).To(BeTrue())
+		})
+
+		It("stops probing for bandwidth when the loss rate is too high", func() {
+			run(2 * time.Second)
+			sender.enterPhaseRefill()
+			sender.setPhase(bbrPhaseUp)
+			sendPackets()
+			for i := 0; i < 5; i++ {
+				losePacket()
+			}
+			Expect(sender.phase).To(Equal(bbrPhaseDown))
+			Expect(sender.inflightHi).To(BeNumerically("<", protocol.MaxByteCount))
+			// leave headroom for other flows
+			Expect(sender.GetCongestionWindow()).To(BeNumerically("<", sender.inflightHi))
+		})
+	})
+
+	Context("reacting to ECN", func() {
+		It("sets an upper bound for the data in flight, when most packets in Startup are marked", func() {
+			rttStats.UpdateRTT(rtt, 0, clock.Now())
+			sendPackets()
+			for len(inFlight) > 0 {
+				p := ackPacket()
+				sender.OnCongestionExperienced(p.packetNumber, 1, bytesInFlight)
+			}
+			sendPackets()
+			ackPacket()
+			Expect(sender.ecnAlpha).To(BeNumerically("~", bbrECNAlphaGain, 0.001))
+			Expect(sender.fullBandwidthReached).To(BeTrue())
+			Expect(sender.inflightHi).To(BeNumerically("<", protocol.MaxByteCount))
+		})
+
+		It("reduces the lower bound for the data in flight at the end of a round with CE marks", func() {
+			run(2 * time.Second)
+			sender.setPhase(bbrPhaseCruise)
+			sender.cycleStart = clock.Now()
+			sender.roundsSinceProbe = 0
+			runUntilRoundStart()
+			cwnd := sender.GetCongestionWindow()
+			sendPackets()
+			p := ackPacket()
+			sender.OnCongestionExperienced(p.packetNumber, 1, bytesInFlight)
+			runUntilRoundStart()
+			Expect(sender.ecnAlpha).To(BeNumerically(">", 0))
+			Expect(sender.inflightLo).To(BeNumerically("<", cwnd))
+			// a single CE mark doesn't limit the data in flight
+			Expect(sender.inflightHi).To(Equal(protocol.MaxByteCount))
+			// the bandwidth is not reduced
+			Expect(sender.bandwidthLo).To(Equal(sender.maxBandwidth.Get()))
+		})
+	})
+
+	It("measures the minimum RTT in ProbeRTT", func() {
+		run(2 * time.Second)
+		sender.minRTTTimestamp = clock.Now().Add(-bbrMinRTTExpiry - time.Millisecond)
+		sendPackets()
+		ackPacket()
+		Expect(sender.mode).To(Equal(bbrModeProbeRTT))
+		Expect(sender.GetCongestionWindow()).To(Equal(sender.probeRTTCwnd()))
+		Expect(sender.GetCongestionWindow()).To(BeNumerically("~", bdp/2, 2*packetSize))
+		run(bbrProbeRTTDuration + 2*rtt)
+		Expect(sender.mode).To(Equal(bbrModeProbeBW))
+		Expect(sender.minRTT).To(BeNumerically("~", rtt, 2*time.Millisecond))
+		Expect(sender.minRTTTimestamp).To(BeTemporally("~", clock.Now(), bbrProbeRTTDuration+2*rtt))
+	})
+
+	It("reduces the congestion window on a retransmission timeout", func() {
+		run(2 * time.Second)
+		sender.OnRetransmissionTimeout(false)
+		Expect(sender.GetCongestionWindow()).To(BeNumerically(">", bbrMinPipeCwnd))
+		sender.OnRetransmissionTimeout(true)
+		Expect(sender.GetCongestionWindow()).To(Equal(bbrMinPipeCwnd))
+	})
+
+	It("resets the model on connection migration", func() {
+		run(2 * time.Second)
+		sender.OnConnectionMigration()
+		Expect(sender.mode).To(Equal(bbrModeStartup))
+		Expect(sender.BandwidthEstimate()).To(BeZero())
+		Expect(sender.GetCongestionWindow()).To(Equal(initialCongestionWindowPackets * packetSize))
+	})
+
+	It("returns the bandwidth-delay product as the congestion state", func() {
+		_, ok := sender.GetResumeState()
+		Expect(ok).To(BeFalse())
+		run(time.Second)
+		state, ok := sender.GetResumeState()
+		Expect(ok).To(BeTrue())
+		Expect(state.RTT).To(Equal(sender.minRTT))
+		Expect(state.CongestionWindow).To(BeNumerically("~", bdp, bdp/10))
+	})
+})
@@ -0,0 +1,53 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// A ResumeState is the congestion state of a previous connection on the same network path.
+// It is used to skip slow start, following the Careful Resume algorithm.
+type ResumeState struct {
+	// CongestionWindow is the congestion window of the previous connection.
+	CongestionWindow protocol.ByteCount
+	// RTT is the minimum RTT measured by the previous connection.
+	RTT time.Duration
+}
+
+type resumePhase uint8
+
+const (
+	// Careful Resume is not used (any more).
+	resumeNone resumePhase = iota
+	// The RTT of the path is measured, and compared to the saved RTT.
+	resumeReconnaissance
+	// The congestion window was increased, but the path didn't confirm that it can handle the increased window yet.
+	resumeUnvalidated
+	// A full increased congestion window was sent, waiting for the acknowledgments.
+	resumeValidating
+)
+
+// carefulResume is the state of the Careful Resume algorithm (draft-ietf-tsvwg-careful-resume).
+type carefulResume struct {
+	phase resumePhase
+	saved ResumeState
+
+	// the first and the last packet sent using the increased congestion window
+	firstUnvalidated protocol.PacketNumber
+	lastUnvalidated  protocol.PacketNumber
+	// pipeSize is the amount of data that the path was shown to deliver:
+	// the congestion window before the jump, plus all unvalidated packets that were acknowledged.
+	pipeSize protocol.ByteCount
+}
+
+// unvalidated says if the congestion window was increased, but not yet validated.
+func (r *carefulResume) unvalidated() bool {
+	return r.phase == resumeUnvalidated || r.phase == resumeValidating
+}
+
+// rttMatches checks that the RTT of the path is similar to the RTT that was saved.
+// Otherwise, this is probably a different path, and the saved congestion window doesn't apply.
+func (r *carefulResume) rttMatches(rtt time.Duration) bool {
+	return rtt >= r.saved.RTT/2 && rtt <= 10*r.saved.RTT
+}
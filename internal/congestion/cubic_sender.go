@@ -19,6 +19,7 @@ type cubicSender struct {
 	rttStats        *RTTStats
 	stats           connectionStats
 	cubic           *Cubic
+	pacer           *pacer
 
 	reno bool
 
@@ -60,14 +61,21 @@ type cubicSender struct {
 	initialMaxCongestionWindow protocol.ByteCount
 
 	minSlowStartExitWindow protocol.ByteCount
+
+	// The policy for reducing the congestion window after an idle period.
+	windowDecay WindowDecay
+	// The time when the last retransmittable packet was sent.
+	lastSentTime time.Time
+
+	resume carefulResume
 }
 
 var _ SendAlgorithm = &cubicSender{}
 var _ SendAlgorithmWithDebugInfo = &cubicSender{}
 
 // NewCubicSender makes a new cubic sender
-func NewCubicSender(clock Clock, rttStats *RTTStats, reno bool, initialCongestionWindow, initialMaxCongestionWindow protocol.ByteCount) SendAlgorithmWithDebugInfo {
-	return &cubicSender{
+func NewCubicSender(clock Clock, rttStats *RTTStats, reno bool, initialCongestionWindow, initialMaxCongestionWindow protocol.ByteCount, windowDecay WindowDecay) SendAlgorithmWithDebugInfo {
+	c := &cubicSender{
 		rttStats:                   rttStats,
 		initialCongestionWindow:    initialCongestionWindow,
 		initialMaxCongestionWindow: initialMaxCongestionWindow,
@@ -78,22 +86,42 @@ func NewCubicSender(clock Clock, rttStats *RTTStats, reno bool, initialCongestio
 		numConnections:             defaultNumConnections,
 		cubic:                      NewCubic(clock),
 		reno:                       reno,
+		windowDecay:                windowDecay,
 	}
+	c.pacer = newPacer(c.PacingRate)
+	return c
 }
 
 // TimeUntilSend returns when the next packet should be sent.
-func (c *cubicSender) TimeUntilSend(bytesInFlight protocol.ByteCount) time.Duration {
+// It returns the zero value if a packet can be sent immediately.
+func (c *cubicSender) TimeUntilSend(bytesInFlight protocol.ByteCount) time.Time {
 	if c.InRecovery() {
 		// PRR is used when in recovery.
 		if c.prr.CanSend(c.GetCongestionWindow(), bytesInFlight, c.GetSlowStartThreshold()) {
-			return 0
+			return time.Time{}
 		}
 	}
-	delay := c.rttStats.SmoothedRTT() / time.Duration(2*c.GetCongestionWindow())
-	if !c.InSlowStart() { // adjust delay, such that it's 1.25*cwd/rtt
-		delay = delay * 8 / 5
+	return c.pacer.TimeUntilSend()
+}
+
+// PacingBudget returns the number of bytes that the pacer allows sending at the given time.
+func (c *cubicSender) PacingBudget(now time.Time) protocol.ByteCount {
+	return c.pacer.Budget(now)
+}
+
+// PacingRate is the rate that packets are paced at.
+// It is higher than the bandwidth estimate (twice as high in slow start, and 1.25 times as high in congestion avoidance),
+// such that pacing doesn't prevent the congestion window from growing.
+func (c *cubicSender) PacingRate() Bandwidth {
+	if c.resume.unvalidated() {
+		// Spread the increased congestion window over (at least) the RTT of the previous connection.
+		return BandwidthFromDelta(c.congestionWindow, utils.MaxDuration(c.rttStats.SmoothedRTT(), c.resume.saved.RTT))
+	}
+	bandwidth := c.BandwidthEstimate()
+	if c.InSlowStart() {
+		return 2 * bandwidth
 	}
-	return delay
+	return bandwidth * 5 / 4
 }
 
 func (c *cubicSender) OnPacketSent(
@@ -106,12 +134,47 @@ func (c *cubicSender) OnPacketSent(
 	if !isRetransmittable {
 		return
 	}
+	// Nothing else is in flight. Check if we're sending after an idle period.
+	if bytesInFlight <= bytes && !c.lastSentTime.IsZero() {
+		c.maybeDecayWindowAfterIdle(sentTime.Sub(c.lastSentTime))
+	}
+	c.lastSentTime = sentTime
+	c.pacer.SentPacket(sentTime, bytes)
 	if c.InRecovery() {
 		// PRR is used when in recovery.
 		c.prr.OnPacketSent(bytes)
 	}
 	c.largestSentPacketNumber = packetNumber
 	c.hybridSlowStart.OnPacketSent(packetNumber)
+	if c.resume.phase == resumeUnvalidated && bytesInFlight >= c.congestionWindow {
+		c.resume.phase = resumeValidating
+		c.resume.lastUnvalidated = packetNumber
+	}
+}
+
+// maybeDecayWindowAfterIdle performs congestion window validation.
+// A connection that was idle for a while must not send a full congestion window worth of data at once,
+// since the window might not reflect the current state of the network any more.
+func (c *cubicSender) maybeDecayWindowAfterIdle(idle time.Duration) {
+	rto := utils.MaxDuration(c.rttStats.SmoothedOrInitialRTT()+4*c.rttStats.MeanDeviation(), minIdleTimeout)
+	if idle < rto {
+		return
+	}
+	restartWindow := utils.MinByteCount(c.initialCongestionWindow, c.congestionWindow)
+	switch c.windowDecay {
+	case WindowDecayHalve:
+		c.slowstartThreshold = utils.MaxByteCount(c.slowstartThreshold, c.congestionWindow*3/4)
+		for i := time.Duration(0); i < idle/rto && c.congestionWindow > restartWindow; i++ {
+			c.congestionWindow /= 2
+		}
+		c.congestionWindow = utils.MaxByteCount(c.congestionWindow, restartWindow)
+	case WindowDecayReset:
+		c.slowstartThreshold = utils.MaxByteCount(c.slowstartThreshold, c.congestionWindow*3/4)
+		c.congestionWindow = restartWindow
+	case WindowDecayNone:
+		return
+	}
+	c.cubic.OnApplicationLimited()
 }
 
 func (c *cubicSender) InRecovery() bool {
@@ -151,6 +214,10 @@ func (c *cubicSender) OnPacketAcked(
 	eventTime time.Time,
 ) {
 	c.largestAckedPacketNumber = utils.MaxPacketNumber(ackedPacketNumber, c.largestAckedPacketNumber)
+	if c.resume.unvalidated() {
+		c.onUnvalidatedPacketAcked(ackedPacketNumber, ackedBytes)
+		return
+	}
 	if c.InRecovery() {
 		// PRR is used when in recovery.
 		c.prr.OnPacketAcked(ackedBytes)
@@ -160,6 +227,75 @@ func (c *cubicSender) OnPacketAcked(
 	if c.InSlowStart() {
 		c.hybridSlowStart.OnPacketAcked(ackedPacketNumber)
 	}
+	if c.resume.phase == resumeReconnaissance {
+		c.maybeJumpToResumedWindow()
+	}
+}
+
+// Resume starts Careful Resume, using the congestion state of a previous connection on the same path.
+// The congestion window is increased to half the saved congestion window once the first RTT sample
+// confirmed that the RTT didn't change significantly.
+func (c *cubicSender) Resume(state ResumeState) {
+	if state.RTT <= 0 || state.CongestionWindow/2 <= c.congestionWindow {
+		return
+	}
+	c.resume = carefulResume{phase: resumeReconnaissance, saved: state}
+}
+
+// GetResumeState returns the congestion state that a future connection on the same path can resume from.
+// It returns false if no RTT was measured yet, or if the congestion window was not validated.
+func (c *cubicSender) GetResumeState() (ResumeState, bool) {
+	if c.rttStats.MinRTT() == 0 || c.resume.unvalidated() {
+		return ResumeState{}, false
+	}
+	return ResumeState{CongestionWindow: c.congestionWindow, RTT: c.rttStats.MinRTT()}, true
+}
+
+func (c *cubicSender) maybeJumpToResumedWindow() {
+	rtt := c.rttStats.MinRTT()
+	if rtt == 0 {
+		return
+	}
+	jumpWindow := utils.MinByteCount(c.resume.saved.CongestionWindow/2, c.maxCongestionWindow)
+	if !c.InSlowStart() || !c.resume.rttMatches(rtt) || jumpWindow <= c.congestionWindow {
+		c.resume.phase = resumeNone
+		return
+	}
+	c.resume.phase = resumeUnvalidated
+	c.resume.pipeSize = c.congestionWindow
+	c.resume.firstUnvalidated = c.largestSentPacketNumber + 1
+	c.congestionWindow = jumpWindow
+}
+
+// onUnvalidatedPacketAcked is called for acknowledgments received while the resumed congestion window is validated.
+// The congestion window isn't increased during that time.
+func (c *cubicSender) onUnvalidatedPacketAcked(ackedPacketNumber protocol.PacketNumber, ackedBytes protocol.ByteCount) {
+	if ackedPacketNumber < c.resume.firstUnvalidated {
+		return
+	}
+	c.resume.pipeSize += ackedBytes
+	if c.resume.phase == resumeUnvalidated {
+		// the first packet sent with the increased window was acknowledged
+		c.resume.phase = resumeValidating
+		c.resume.lastUnvalidated = c.largestSentPacketNumber
+	}
+	if ackedPacketNumber >= c.resume.lastUnvalidated {
+		// All packets sent using the increased window were acknowledged.
+		// Reduce the congestion window if the path delivered less than the window.
+		c.congestionWindow = utils.MaxByteCount(utils.MinByteCount(c.congestionWindow, c.resume.pipeSize), c.minCongestionWindow)
+		c.resume.phase = resumeNone
+	}
+}
+
+// retreatFromResumedWindow is called when a packet is lost while the resumed congestion window is validated (safe retreat).
+// The congestion window is reduced to half of the amount of data that the path was shown to deliver, and slow start is exited.
+func (c *cubicSender) retreatFromResumedWindow(priorInFlight protocol.ByteCount) {
+	c.resume.phase = resumeNone
+	c.prr.OnPacketLost(priorInFlight)
+	c.congestionWindow = utils.MaxByteCount(c.resume.pipeSize/2, c.minCongestionWindow)
+	c.slowstartThreshold = c.congestionWindow
+	c.largestSentAtLastCutback = c.largestSentPacketNumber
+	c.numAckedPackets = 0
 }
 
 func (c *cubicSender) OnPacketLost(
@@ -167,6 +303,11 @@ func (c *cubicSender) OnPacketLost(
 	lostBytes protocol.ByteCount,
 	priorInFlight protocol.ByteCount,
 ) {
+	if c.resume.unvalidated() {
+		c.retreatFromResumedWindow(priorInFlight)
+		return
+	}
+	c.resume.phase = resumeNone
 	// TCP NewReno (RFC6582) says that once a loss occurs, any losses in packets
 	// already sent should be treated as a single loss event, since it's expected.
 	if packetNumber <= c.largestSentAtLastCutback {
@@ -209,6 +350,15 @@ func (c *cubicSender) OnPacketLost(
 	c.numAckedPackets = 0
 }
 
+// OnCongestionExperienced reacts to a CE mark (RFC 3168) the same way as to a packet loss.
+// Like losses, all CE marks within one round trip are treated as a single congestion event.
+func (c *cubicSender) OnCongestionExperienced(packetNumber protocol.PacketNumber, _ uint64, priorInFlight protocol.ByteCount) {
+	if packetNumber <= c.largestSentAtLastCutback {
+		return
+	}
+	c.OnPacketLost(packetNumber, 0, priorInFlight)
+}
+
 func (c *cubicSender) RenoBeta() float32 {
 	// kNConnectionBeta is the backoff factor after loss for our N-connection
 	// emulation, which emulates the effective backoff of an ensemble of N
@@ -279,6 +429,11 @@ func (c *cubicSender) HybridSlowStart() *HybridSlowStart {
 	return &c.hybridSlowStart
 }
 
+// SetMaxPacketSize sets the max packet size used by the pacer
+func (c *cubicSender) SetMaxPacketSize(size protocol.ByteCount) {
+	c.pacer.SetMaxPacketSize(size)
+}
+
 // SetNumEmulatedConnections sets the number of emulated connections
 func (c *cubicSender) SetNumEmulatedConnections(n int) {
 	c.numConnections = utils.Max(n, 1)
@@ -288,6 +443,7 @@ func (c *cubicSender) SetNumEmulatedConnections(n int) {
 // OnRetransmissionTimeout is called on an retransmission timeout
 func (c *cubicSender) OnRetransmissionTimeout(packetsRetransmitted bool) {
 	c.largestSentAtLastCutback = 0
+	c.resume.phase = resumeNone
 	if !packetsRetransmitted {
 		return
 	}
@@ -307,9 +463,12 @@ func (c *cubicSender) OnConnectionMigration() {
 	c.lastCutbackExitedSlowstart = false
 	c.cubic.Reset()
 	c.numAckedPackets = 0
+	c.lastSentTime = time.Time{}
 	c.congestionWindow = c.initialCongestionWindow
 	c.slowstartThreshold = c.initialMaxCongestionWindow
 	c.maxCongestionWindow = c.initialMaxCongestionWindow
+	// the saved congestion state doesn't apply to the new path
+	c.resume = carefulResume{}
 }
 
 // SetSlowStartLargeReduction allows enabling the SSLR experiment
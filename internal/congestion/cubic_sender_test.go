@@ -4,7 +4,6 @@ import (
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
-	"github.com/lucas-clemente/quic-go/internal/utils"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -40,7 +39,7 @@ var _ = Describe("Cubic Sender", func() {
 		ackedPacketNumber = 0
 		clock = mockClock{}
 		rttStats = NewRTTStats()
-		sender = NewCubicSender(&clock, rttStats, true /*reno*/, initialCongestionWindowPackets*protocol.DefaultTCPMSS, MaxCongestionWindow)
+		sender = NewCubicSender(&clock, rttStats, true /*reno*/, initialCongestionWindowPackets*protocol.DefaultTCPMSS, MaxCongestionWindow, WindowDecayHalve)
 	})
 
 	canSend := func() bool {
@@ -102,13 +101,26 @@ var _ = Describe("Cubic Sender", func() {
 	})
 
 	It("paces", func() {
+		rttStats.UpdateRTT(10*time.Millisecond, 0, clock.Now())
 		clock.Advance(time.Hour)
-		// Fill the send window with data, then verify that we can't send.
+		// Fill the send window with data at once, then verify that the pacer doesn't allow sending.
 		SendAvailableSendWindow()
-		AckNPackets(1)
-		delay := sender.TimeUntilSend(bytesInFlight)
-		Expect(delay).ToNot(BeZero())
-		Expect(delay).ToNot(Equal(utils.InfDuration))
+		t := sender.TimeUntilSend(bytesInFlight)
+		Expect(t).To(BeTemporally(">", clock.Now()))
+		Expect(sender.PacingBudget(clock.Now())).To(BeNumerically("<", protocol.MaxPacketSizeIPv4))
+		Expect(sender.PacingBudget(t)).To(BeNumerically(">=", protocol.MaxPacketSizeIPv4))
+	})
+
+	It("paces faster than the bandwidth estimate", func() {
+		Expect(sender.PacingRate()).To(BeZero())
+		SendAvailableSendWindow()
+		AckNPackets(2)
+		// in slow start, packets are paced at twice the bandwidth estimate
+		Expect(sender.BandwidthEstimate()).ToNot(BeZero())
+		Expect(sender.PacingRate()).To(Equal(2 * sender.BandwidthEstimate()))
+		// in congestion avoidance, packets are paced at 1.25 times the bandwidth estimate
+		LoseNPackets(1)
+		Expect(sender.PacingRate()).To(Equal(sender.BandwidthEstimate() * 5 / 4))
 	})
 
 	It("application limited slow start", func() {
@@ -405,7 +417,7 @@ var _ = Describe("Cubic Sender", func() {
 	It("tcp cubic reset epoch on quiescence", func() {
 		const maxCongestionWindow = 50
 		const maxCongestionWindowBytes = maxCongestionWindow * protocol.DefaultTCPMSS
-		sender = NewCubicSender(&clock, rttStats, false, initialCongestionWindowPackets*protocol.DefaultTCPMSS, maxCongestionWindowBytes)
+		sender = NewCubicSender(&clock, rttStats, false, initialCongestionWindowPackets*protocol.DefaultTCPMSS, maxCongestionWindowBytes, WindowDecayHalve)
 
 		numSent := SendAvailableSendWindow()
 
@@ -458,6 +470,21 @@ var _ = Describe("Cubic Sender", func() {
 		Expect(postLossWindow).To(BeNumerically(">", sender.GetCongestionWindow()))
 	})
 
+	It("reduces the congestion window once per window on CE marks", func() {
+		SendAvailableSendWindow()
+		initialWindow := sender.GetCongestionWindow()
+		AckNPackets(1)
+		sender.OnCongestionExperienced(ackedPacketNumber, 1, bytesInFlight)
+		postCEWindow := sender.GetCongestionWindow()
+		Expect(initialWindow).To(BeNumerically(">", postCEWindow))
+		Expect(sender.SlowstartThreshold()).To(Equal(postCEWindow))
+		sender.OnCongestionExperienced(packetNumber-1, 1, bytesInFlight)
+		Expect(sender.GetCongestionWindow()).To(Equal(postCEWindow))
+		// a CE mark on a packet sent after the reduction reduces the window again
+		sender.OnCongestionExperienced(packetNumber, 1, bytesInFlight)
+		Expect(postCEWindow).To(BeNumerically(">", sender.GetCongestionWindow()))
+	})
+
 	It("2 connection congestion avoidance at end of recovery", func() {
 		sender.SetNumEmulatedConnections(2)
 		// Ack 10 packets in 5 acks to raise the CWND to 20.
@@ -591,7 +618,7 @@ var _ = Describe("Cubic Sender", func() {
 	})
 
 	It("default max cwnd", func() {
-		sender = NewCubicSender(&clock, rttStats, true /*reno*/, initialCongestionWindowPackets*protocol.DefaultTCPMSS, protocol.DefaultMaxCongestionWindow)
+		sender = NewCubicSender(&clock, rttStats, true /*reno*/, initialCongestionWindowPackets*protocol.DefaultTCPMSS, protocol.DefaultMaxCongestionWindow, WindowDecayHalve)
 
 		defaultMaxCongestionWindowPackets := protocol.DefaultMaxCongestionWindow / protocol.DefaultTCPMSS
 		for i := 1; i < int(defaultMaxCongestionWindowPackets); i++ {
@@ -603,7 +630,7 @@ var _ = Describe("Cubic Sender", func() {
 
 	It("limit cwnd increase in congestion avoidance", func() {
 		// Enable Cubic.
-		sender = NewCubicSender(&clock, rttStats, false, initialCongestionWindowPackets*protocol.DefaultTCPMSS, MaxCongestionWindow)
+		sender = NewCubicSender(&clock, rttStats, false, initialCongestionWindowPackets*protocol.DefaultTCPMSS, MaxCongestionWindow, WindowDecayHalve)
 		numSent := SendAvailableSendWindow()
 
 		// Make sure we fall out of slow start.
@@ -637,4 +664,182 @@ var _ = Describe("Cubic Sender", func() {
 		AckNPackets(2)
 		Expect(sender.GetCongestionWindow()).To(Equal(savedCwnd + protocol.DefaultTCPMSS))
 	})
+
+	Context("congestion window validation after idle periods", func() {
+		// grow the congestion window to 4 times the initial window, then ack all outstanding packets
+		growWindowAndDrain := func() {
+			for sender.GetCongestionWindow() < 4*defaultWindowTCP {
+				SendAvailableSendWindow()
+				AckNPackets(2)
+			}
+			for bytesInFlight > 0 {
+				AckNPackets(1)
+			}
+		}
+
+		It("halves the congestion window for every RTO the connection was idle", func() {
+			growWindowAndDrain()
+			cwnd := sender.GetCongestionWindow()
+			// the RTO is 200ms, since the RTT is 60ms
+			clock.Advance(450 * time.Millisecond)
+			sender.OnPacketSent(clock.Now(), 0, packetNumber, protocol.DefaultTCPMSS, true)
+			Expect(sender.GetCongestionWindow()).To(Equal(cwnd / 4))
+			Expect(sender.SlowstartThreshold()).To(BeNumerically(">=", cwnd*3/4))
+		})
+
+		It("doesn't halve the congestion window below the initial congestion window", func() {
+			growWindowAndDrain()
+			clock.Advance(time.Hour)
+			sender.OnPacketSent(clock.Now(), 0, packetNumber, protocol.DefaultTCPMSS, true)
+			Expect(sender.GetCongestionWindow()).To(Equal(defaultWindowTCP))
+		})
+
+		It("doesn't decay the congestion window when there are packets in flight", func() {
+			growWindowAndDrain()
+			cwnd := sender.GetCongestionWindow()
+			clock.Advance(time.Hour)
+			sender.OnPacketSent(clock.Now(), 10*protocol.DefaultTCPMSS, packetNumber, protocol.DefaultTCPMSS, true)
+			Expect(sender.GetCongestionWindow()).To(Equal(cwnd))
+		})
+
+		It("doesn't decay the congestion window after short idle periods", func() {
+			growWindowAndDrain()
+			cwnd := sender.GetCongestionWindow()
+			clock.Advance(100 * time.Millisecond)
+			sender.OnPacketSent(clock.Now(), 0, packetNumber, protocol.DefaultTCPMSS, true)
+			Expect(sender.GetCongestionWindow()).To(Equal(cwnd))
+		})
+
+		It("resets the congestion window", func() {
+			sender = NewCubicSender(&clock, rttStats, true /*reno*/, initialCongestionWindowPackets*protocol.DefaultTCPMSS, MaxCongestionWindow, WindowDecayReset)
+			growWindowAndDrain()
+			clock.Advance(250 * time.Millisecond)
+			sender.OnPacketSent(clock.Now(), 0, packetNumber, protocol.DefaultTCPMSS, true)
+			Expect(sender.GetCongestionWindow()).To(Equal(defaultWindowTCP))
+		})
+
+		It("keeps the congestion window, if configured to do so", func() {
+			sender = NewCubicSender(&clock, rttStats, true /*reno*/, initialCongestionWindowPackets*protocol.DefaultTCPMSS, MaxCongestionWindow, WindowDecayNone)
+			growWindowAndDrain()
+			cwnd := sender.GetCongestionWindow()
+			clock.Advance(time.Hour)
+			sender.OnPacketSent(clock.Now(), 0, packetNumber, protocol.DefaultTCPMSS, true)
+			Expect(sender.GetCongestionWindow()).To(Equal(cwnd))
+		})
+	})
+
+	Context("Careful Resume", func() {
+		const savedWindow = 100 * protocol.DefaultTCPMSS
+
+		BeforeEach(func() {
+			sender.Resume(ResumeState{CongestionWindow: savedWindow, RTT: 50 * time.Millisecond})
+		})
+
+		// jump sends the initial window, and acknowledges the first packet
+		jump := func() {
+			SendAvailableSendWindow()
+			AckNPackets(1)
+		}
+
+		It("jumps to half the saved congestion window, once the RTT was measured", func() {
+			Expect(sender.GetCongestionWindow()).To(Equal(defaultWindowTCP))
+			jump()
+			Expect(sender.GetCongestionWindow()).To(Equal(savedWindow / 2))
+			// the increased window is paced over the RTT
+			Expect(sender.PacingRate()).To(Equal(BandwidthFromDelta(savedWindow/2, 60*time.Millisecond)))
+			_, ok := sender.GetResumeState()
+			Expect(ok).To(BeFalse())
+		})
+
+		It("doesn't jump beyond the maximum congestion window", func() {
+			sender.Resume(ResumeState{CongestionWindow: 4 * MaxCongestionWindow, RTT: 50 * time.Millisecond})
+			jump()
+			Expect(sender.GetCongestionWindow()).To(Equal(MaxCongestionWindow))
+		})
+
+		It("validates the increased congestion window", func() {
+			jump()
+			// send the increased window, and acknowledge all packets
+			Expect(SendAvailableSendWindow()).To(Equal(41))
+			for bytesInFlight > 0 {
+				AckNPackets(1)
+				Expect(sender.GetCongestionWindow()).To(Equal(savedWindow / 2))
+			}
+			state, ok := sender.GetResumeState()
+			Expect(ok).To(BeTrue())
+			Expect(state.CongestionWindow).To(Equal(savedWindow / 2))
+			Expect(state.RTT).To(Equal(60 * time.Millisecond))
+			// continue in slow start
+			SendAvailableSendWindow()
+			AckNPackets(1)
+			Expect(sender.GetCongestionWindow()).To(Equal(savedWindow/2 + protocol.DefaultTCPMSS))
+		})
+
+		It("reduces the congestion window, if the increased window was not used", func() {
+			jump()
+			// the application only sends 10 packets using the increased window
+			for i := 0; i < 10; i++ {
+				bytesInFlight += protocol.DefaultTCPMSS
+				sender.OnPacketSent(clock.Now(), bytesInFlight, packetNumber, protocol.DefaultTCPMSS, true)
+				packetNumber++
+			}
+			for bytesInFlight > 0 {
+				AckNPackets(1)
+			}
+			// The path delivered the window before the jump (11 packets), and 10 packets after the jump.
+			Expect(sender.GetCongestionWindow()).To(Equal(21 * protocol.DefaultTCPMSS))
+		})
+
+		It("retreats when a packet is lost before the window was validated", func() {
+			jump()
+			SendAvailableSendWindow()
+			AckNPackets(9)  // acknowledge the rest of the initial window
+			AckNPackets(10) // acknowledge 10 packets sent with the increased window
+			LoseNPackets(1)
+			// The path delivered the window before the jump (11 packets), and 10 packets after the jump.
+			Expect(sender.GetCongestionWindow()).To(Equal(21 * protocol.DefaultTCPMSS / 2))
+			Expect(sender.SlowstartThreshold()).To(Equal(sender.GetCongestionWindow()))
+			Expect(sender.InRecovery()).To(BeTrue())
+		})
+
+		It("doesn't jump if the RTT changed", func() {
+			sender.Resume(ResumeState{CongestionWindow: savedWindow, RTT: 200 * time.Millisecond})
+			jump()
+			Expect(sender.GetCongestionWindow()).To(Equal(defaultWindowTCP + protocol.DefaultTCPMSS))
+			SendAvailableSendWindow()
+			AckNPackets(1)
+			Expect(sender.GetCongestionWindow()).To(Equal(defaultWindowTCP + 2*protocol.DefaultTCPMSS))
+		})
+
+		It("doesn't jump if a packet was lost before", func() {
+			SendAvailableSendWindow()
+			LoseNPackets(1)
+			AckNPackets(1)
+			Expect(sender.GetCongestionWindow()).To(BeNumerically("<", defaultWindowTCP))
+		})
+
+		It("ignores saved congestion windows that are not larger than the current window", func() {
+			sender = NewCubicSender(&clock, rttStats, true /*reno*/, initialCongestionWindowPackets*protocol.DefaultTCPMSS, MaxCongestionWindow, WindowDecayHalve)
+			sender.Resume(ResumeState{CongestionWindow: 2 * defaultWindowTCP, RTT: 50 * time.Millisecond})
+			jump()
+			Expect(sender.GetCongestionWindow()).To(Equal(defaultWindowTCP + protocol.DefaultTCPMSS))
+		})
+
+		It("doesn't jump after a connection migration", func() {
+			sender.OnConnectionMigration()
+			jump()
+			Expect(sender.GetCongestionWindow()).To(Equal(defaultWindowTCP + protocol.DefaultTCPMSS))
+		})
+	})
+
+	It("returns the congestion state, once the RTT was measured", func() {
+		_, ok := sender.GetResumeState()
+		Expect(ok).To(BeFalse())
+		SendAvailableSendWindow()
+		AckNPackets(2)
+		state, ok := sender.GetResumeState()
+		Expect(ok).To(BeTrue())
+		Expect(state.CongestionWindow).To(Equal(sender.GetCongestionWindow()))
+		Expect(state.RTT).To(Equal(60 * time.Millisecond))
+	})
 })
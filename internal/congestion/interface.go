@@ -8,13 +8,32 @@ import (
 
 // A SendAlgorithm performs congestion control and calculates the congestion window
 type SendAlgorithm interface {
-	TimeUntilSend(bytesInFlight protocol.ByteCount) time.Duration
+	// TimeUntilSend returns when the next packet should be sent.
+	// It returns the zero value if a packet can be sent immediately.
+	TimeUntilSend(bytesInFlight protocol.ByteCount) time.Time
+	// PacingBudget returns the number of bytes that the pacer allows sending at the given time.
+	PacingBudget(now time.Time) protocol.ByteCount
 	OnPacketSent(sentTime time.Time, bytesInFlight protocol.ByteCount, packetNumber protocol.PacketNumber, bytes protocol.ByteCount, isRetransmittable bool)
 	GetCongestionWindow() protocol.ByteCount
+	// BandwidthEstimate returns the current estimate of the bandwidth.
+	// It returns 0 if the bandwidth can't be estimated yet.
+	BandwidthEstimate() Bandwidth
+	// PacingRate returns the rate that packets are currently paced at.
+	PacingRate() Bandwidth
 	MaybeExitSlowStart()
 	OnPacketAcked(number protocol.PacketNumber, ackedBytes protocol.ByteCount, priorInFlight protocol.ByteCount, eventTime time.Time)
 	OnPacketLost(number protocol.PacketNumber, lostBytes protocol.ByteCount, priorInFlight protocol.ByteCount)
+	// OnCongestionExperienced is called when the peer reports that packets were marked CE (RFC 3168).
+	// The packet number is the largest newly acknowledged packet that was sent ECN-capable, numMarked is the number of newly marked packets.
+	OnCongestionExperienced(number protocol.PacketNumber, numMarked uint64, priorInFlight protocol.ByteCount)
 	SetNumEmulatedConnections(n int)
+	// SetMaxPacketSize sets the current max packet size, e.g. after it was increased by Path MTU Discovery.
+	SetMaxPacketSize(protocol.ByteCount)
+	// Resume uses the congestion state of a previous connection on the same path to skip slow start (Careful Resume).
+	// It must be called before any packet is sent.
+	Resume(ResumeState)
+	// GetResumeState returns the validated congestion state, such that it can be used by a future connection.
+	GetResumeState() (ResumeState, bool)
 	OnRetransmissionTimeout(packetsRetransmitted bool)
 	OnConnectionMigration()
 
@@ -25,7 +44,6 @@ type SendAlgorithm interface {
 // SendAlgorithmWithDebugInfo adds some debug functions to SendAlgorithm
 type SendAlgorithmWithDebugInfo interface {
 	SendAlgorithm
-	BandwidthEstimate() Bandwidth
 
 	// Stuff only used in testing
 
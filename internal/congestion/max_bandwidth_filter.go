@@ -0,0 +1,45 @@
+package congestion
+
+type bandwidthFilterSample struct {
+	bandwidth Bandwidth
+	round     uint64
+}
+
+// A maxBandwidthFilter tracks the maximum bandwidth over a window of round trips.
+type maxBandwidthFilter struct {
+	windowRounds uint64
+	// the maximum of every round in the window, in increasing order of the rounds
+	samples []bandwidthFilterSample
+}
+
+func newMaxBandwidthFilter(windowRounds uint64) *maxBandwidthFilter {
+	return &maxBandwidthFilter{windowRounds: windowRounds}
+}
+
+// Update adds a bandwidth sample taken in the given round.
+func (f *maxBandwidthFilter) Update(bw Bandwidth, round uint64) {
+	var i int
+	for i < len(f.samples) && f.samples[i].round+f.windowRounds <= round {
+		i++
+	}
+	f.samples = f.samples[i:]
+	if l := len(f.samples); l > 0 && f.samples[l-1].round == round {
+		if bw > f.samples[l-1].bandwidth {
+			f.samples[l-1].bandwidth = bw
+		}
+		return
+	}
+	f.samples = append(f.samples, bandwidthFilterSample{bandwidth: bw, round: round})
+}
+
+// Get returns the maximum bandwidth in the window.
+// It returns 0 if there are no samples.
+func (f *maxBandwidthFilter) Get() Bandwidth {
+	var max Bandwidth
+	for _, s := range f.samples {
+		if s.bandwidth > max {
+			max = s.bandwidth
+		}
+	}
+	return max
+}
@@ -0,0 +1,38 @@
+package congestion
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Max Bandwidth Filter", func() {
+	var f *maxBandwidthFilter
+
+	BeforeEach(func() {
+		f = newMaxBandwidthFilter(3)
+	})
+
+	It("returns 0 if there are no samples", func() {
+		Expect(f.Get()).To(BeZero())
+	})
+
+	It("returns the maximum", func() {
+		f.Update(100, 1)
+		f.Update(200, 1)
+		f.Update(150, 2)
+		Expect(f.Get()).To(Equal(Bandwidth(200)))
+		Expect(f.samples).To(HaveLen(2))
+	})
+
+	It("expires samples that are older than the window", func() {
+		f.Update(200, 1)
+		f.Update(100, 2)
+		f.Update(50, 3)
+		Expect(f.Get()).To(Equal(Bandwidth(200)))
+		f.Update(50, 4)
+		Expect(f.Get()).To(Equal(Bandwidth(100)))
+		f.Update(50, 10)
+		Expect(f.Get()).To(Equal(Bandwidth(50)))
+		Expect(f.samples).To(HaveLen(1))
+	})
+})
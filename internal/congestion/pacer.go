@@ -0,0 +1,88 @@
+package congestion
+
+import (
+	"math"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// the maximum number of packets that are sent at once, after the connection was idle
+const maxBurstPackets = 10
+
+// The timers used for pacing usually fire later than scheduled.
+// The pacer allows bursts that make up for this delay.
+const timerGranularity = time.Millisecond
+
+// A pacer spreads the packets of a congestion window over the RTT, instead of sending them in bursts.
+// It is a token bucket that is filled at the pacing rate. Sending a packet takes its size from the bucket.
+type pacer struct {
+	// getPacingRate returns the pacing rate.
+	// If it is 0, the rate is not known (yet), and packets are not paced.
+	getPacingRate func() Bandwidth
+	// maxPacketSize is the size of a full-size packet
+	maxPacketSize protocol.ByteCount
+
+	budgetAtLastSent protocol.ByteCount
+	lastSentTime     time.Time
+}
+
+func newPacer(getPacingRate func() Bandwidth) *pacer {
+	return &pacer{
+		getPacingRate: getPacingRate,
+		maxPacketSize: protocol.MaxPacketSizeIPv4,
+	}
+}
+
+// SetMaxPacketSize sets the size of a full-size packet.
+// The pacer waits until a full-size packet can be sent, and allows bursts of multiple full-size packets.
+func (p *pacer) SetMaxPacketSize(size protocol.ByteCount) {
+	p.maxPacketSize = size
+}
+
+// SentPacket is called when a packet is sent
+func (p *pacer) SentPacket(sendTime time.Time, size protocol.ByteCount) {
+	budget := p.Budget(sendTime)
+	if size > budget {
+		p.budgetAtLastSent = 0
+	} else {
+		p.budgetAtLastSent = budget - size
+	}
+	p.lastSentTime = sendTime
+}
+
+// Budget returns the number of bytes that can be sent at the given time
+func (p *pacer) Budget(now time.Time) protocol.ByteCount {
+	rate := p.getBytesPerSecond()
+	if rate == 0 {
+		return protocol.MaxByteCount
+	}
+	if p.lastSentTime.IsZero() {
+		return p.maxBurstSize(rate)
+	}
+	budget := float64(p.budgetAtLastSent) + float64(rate)*now.Sub(p.lastSentTime).Seconds()
+	return protocol.ByteCount(math.Min(budget, float64(p.maxBurstSize(rate))))
+}
+
+// TimeUntilSend returns when the next packet can be sent.
+// It returns the zero value if a packet can be sent immediately.
+func (p *pacer) TimeUntilSend() time.Time {
+	rate := p.getBytesPerSecond()
+	if rate == 0 || p.lastSentTime.IsZero() || p.budgetAtLastSent >= p.maxPacketSize {
+		return time.Time{}
+	}
+	delay := time.Duration(math.Ceil(float64(p.maxPacketSize-p.budgetAtLastSent) * 1e9 / float64(rate)))
+	return p.lastSentTime.Add(utils.MaxDuration(protocol.MinPacingDelay, delay))
+}
+
+func (p *pacer) getBytesPerSecond() uint64 {
+	return uint64(p.getPacingRate() / BytesPerSecond)
+}
+
+func (p *pacer) maxBurstSize(bytesPerSecond uint64) protocol.ByteCount {
+	return utils.MaxByteCount(
+		protocol.ByteCount(float64(bytesPerSecond)*(protocol.MinPacingDelay+timerGranularity).Seconds()),
+		maxBurstPackets*p.maxPacketSize,
+	)
+}
@@ -0,0 +1,91 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pacer", func() {
+	var p *pacer
+	var rate Bandwidth
+
+	const packetSize protocol.ByteCount = protocol.MaxPacketSizeIPv4
+
+	BeforeEach(func() {
+		rate = 1000 * Bandwidth(packetSize) * BytesPerSecond // 1000 packets per second
+		p = newPacer(func() Bandwidth { return rate })
+	})
+
+	It("allows a burst at the beginning", func() {
+		t := time.Now()
+		Expect(p.TimeUntilSend()).To(BeZero())
+		Expect(p.Budget(t)).To(Equal(maxBurstPackets * packetSize))
+		for i := 0; i < maxBurstPackets; i++ {
+			Expect(p.TimeUntilSend()).To(BeZero())
+			p.SentPacket(t, packetSize)
+		}
+		Expect(p.Budget(t)).To(BeZero())
+		Expect(p.TimeUntilSend()).To(Equal(t.Add(time.Millisecond)))
+	})
+
+	It("spreads packets according to the pacing rate", func() {
+		t := time.Now()
+		for i := 0; i < maxBurstPackets; i++ {
+			p.SentPacket(t, packetSize)
+		}
+		for i := 0; i < 10; i++ {
+			t = p.TimeUntilSend()
+			Expect(p.Budget(t)).To(Equal(packetSize))
+			p.SentPacket(t, packetSize)
+		}
+		Expect(p.TimeUntilSend()).To(Equal(t.Add(time.Millisecond)))
+	})
+
+	It("uses the minimum pacing delay", func() {
+		rate = 1e6 * Bandwidth(packetSize) * BytesPerSecond // one packet per microsecond
+		t := time.Now()
+		for p.Budget(t) >= packetSize {
+			p.SentPacket(t, packetSize)
+		}
+		Expect(p.TimeUntilSend()).To(Equal(t.Add(protocol.MinPacingDelay)))
+		// the budget accumulated during the minimum pacing delay allows sending multiple packets at once
+		Expect(p.Budget(p.TimeUntilSend())).To(BeNumerically(">=", 50*packetSize))
+	})
+
+	It("doesn't accumulate more than the maximum burst size", func() {
+		t := time.Now()
+		p.SentPacket(t, packetSize)
+		Expect(p.Budget(t.Add(time.Hour))).To(Equal(maxBurstPackets * packetSize))
+	})
+
+	It("allows larger bursts for high pacing rates", func() {
+		rate = 1e6 * Bandwidth(packetSize) * BytesPerSecond
+		t := time.Now()
+		p.SentPacket(t, packetSize)
+		Expect(p.Budget(t.Add(time.Hour))).To(BeNumerically(">", 1000*packetSize))
+	})
+
+	It("uses the max packet size", func() {
+		p.SetMaxPacketSize(2 * packetSize)
+		t := time.Now()
+		Expect(p.Budget(t)).To(Equal(maxBurstPackets * 2 * packetSize))
+		for i := 0; i < maxBurstPackets; i++ {
+			p.SentPacket(t, 2*packetSize)
+		}
+		// it takes 2ms until the budget allows sending a packet
+		Expect(p.TimeUntilSend()).To(Equal(t.Add(2 * time.Millisecond)))
+	})
+
+	It("doesn't pace if the pacing rate is not known", func() {
+		rate = 0
+		t := time.Now()
+		for i := 0; i < 100; i++ {
+			p.SentPacket(t, packetSize)
+		}
+		Expect(p.TimeUntilSend()).To(BeZero())
+		Expect(p.Budget(t)).To(Equal(protocol.MaxByteCount))
+	})
+})
@@ -0,0 +1,32 @@
+package congestion
+
+import "time"
+
+// minIdleTimeout is the minimum time that a connection has to be idle before the congestion window is decayed
+const minIdleTimeout = 200 * time.Millisecond
+
+// A WindowDecay determines how the congestion window is reduced after the connection was idle.
+type WindowDecay uint8
+
+const (
+	// WindowDecayHalve halves the congestion window for every retransmission timeout that the connection was idle,
+	// but doesn't reduce it below the initial congestion window (RFC 2861).
+	WindowDecayHalve WindowDecay = iota
+	// WindowDecayReset resets the congestion window to the initial congestion window (RFC 5681, Section 4.1).
+	WindowDecayReset
+	// WindowDecayNone keeps the congestion window.
+	WindowDecayNone
+)
+
+func (d WindowDecay) String() string {
+	switch d {
+	case WindowDecayHalve:
+		return "halve"
+	case WindowDecayReset:
+		return "reset"
+	case WindowDecayNone:
+		return "none"
+	default:
+		return "unknown window decay"
+	}
+}
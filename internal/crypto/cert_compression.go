@@ -9,9 +9,12 @@ import (
 	"fmt"
 	"hash/fnv"
 
+	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
 )
 
+var errCertChainTooLong = errors.New("certificate chain too long")
+
 type entryType uint8
 
 const (
@@ -151,6 +154,10 @@ func decompressChain(data []byte) ([][]byte, error) {
 			fmt.Println(4)
 			return nil, err
 		}
+		// the chain is decompressed into memory, so a peer must not be able to make us allocate arbitrary amounts of it
+		if uncompressedLength > protocol.MaxUncompressedCertChainSize {
+			return nil, errCertChainTooLong
+		}
 
 		zlibDict := buildZlibDictForEntries(entries, chain)
 		gz, err := zlib.NewReaderDict(r, zlibDict)
@@ -168,6 +175,9 @@ func decompressChain(data []byte) ([][]byte, error) {
 				return nil, err
 			}
 			certLen := binary.LittleEndian.Uint32(lenBytes)
+			if uint64(totalLength)+4+uint64(certLen) > uint64(uncompressedLength) {
+				return nil, errCertChainTooLong
+			}
 
 			cert := make([]byte, certLen)
 			n, err := gz.Read(cert)
@@ -9,6 +9,7 @@ import (
 	"hash/fnv"
 
 	"github.com/lucas-clemente/quic-go-certificates"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -77,6 +78,39 @@ var _ = Describe("Cert compression and decompression", func() {
 		Expect(uncompressed).To(Equal(chain))
 	})
 
+	Context("limiting the size of the chain", func() {
+		compressCert := func(certLen uint32, cert []byte) []byte {
+			certZlib := &bytes.Buffer{}
+			z, err := zlib.NewWriterLevelDict(certZlib, flate.BestCompression, certDictZlib)
+			Expect(err).ToNot(HaveOccurred())
+			lenBytes := make([]byte, 4)
+			binary.LittleEndian.PutUint32(lenBytes, certLen)
+			z.Write(lenBytes)
+			z.Write(cert)
+			z.Close()
+			return certZlib.Bytes()
+		}
+
+		It("rejects chains that are too long", func() {
+			data := []byte{0x01, 0x00}
+			lenBytes := make([]byte, 4)
+			binary.LittleEndian.PutUint32(lenBytes, protocol.MaxUncompressedCertChainSize+1)
+			data = append(data, lenBytes...)
+			data = append(data, compressCert(4, []byte("cert"))...)
+			_, err := decompressChain(data)
+			Expect(err).To(MatchError(errCertChainTooLong))
+		})
+
+		It("rejects certificates that are longer than the chain", func() {
+			data := []byte{0x01, 0x00,
+				0x08, 0x00, 0x00, 0x00, // uncompressed length
+			}
+			data = append(data, compressCert(0xffffffff, []byte("cert"))...)
+			_, err := decompressChain(data)
+			Expect(err).To(MatchError(errCertChainTooLong))
+		})
+	})
+
 	It("gives correct cert and intermediate", func() {
 		cert1 := []byte{0xde, 0xca, 0xfb, 0xad}
 		cert2 := []byte{0xde, 0xad, 0xbe, 0xef}
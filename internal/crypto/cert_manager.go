@@ -38,6 +38,9 @@ func NewCertManager(tlsConfig *tls.Config) CertManager {
 // SetData takes the byte-slice sent in the SHLO and decompresses it into the certificate chain
 func (c *certManager) SetData(data []byte) error {
 	byteChain, err := decompressChain(data)
+	if err == errCertChainTooLong {
+		return qerr.Error(qerr.CryptoInvalidValueLength, "Certificate chain too long")
+	}
 	if err != nil {
 		return qerr.Error(qerr.InvalidCryptoMessageParameter, "Certificate data invalid")
 	}
@@ -64,6 +64,12 @@ var _ = Describe("Cert Manager", func() {
 			Expect(cm.chain[1].Raw).To(Equal(cert2))
 		})
 
+		It("errors if the chain is too long", func() {
+			data := []byte{0x01, 0x00, 0xff, 0xff, 0xff, 0xff}
+			err := cm.SetData(data)
+			Expect(err).To(MatchError(qerr.Error(qerr.CryptoInvalidValueLength, "Certificate chain too long")))
+		})
+
 		It("errors if it can't decompress the chain", func() {
 			err := cm.SetData([]byte("invalid data"))
 			Expect(err).To(MatchError(qerr.Error(qerr.InvalidCryptoMessageParameter, "Certificate data invalid")))
@@ -35,18 +35,8 @@ func DeriveQuicCryptoAESKeys(forwardSecure bool, sharedSecret, nonces []byte, co
 // deriveKeys derives the keys and the IVs
 // swap should be set true if generating the values for the client, and false for the server
 func deriveKeys(forwardSecure bool, sharedSecret, nonces []byte, connID protocol.ConnectionID, chlo, scfg, cert, divNonce []byte, keyLen int, swap bool) ([]byte, []byte, []byte, []byte, error) {
-	var info bytes.Buffer
-	if forwardSecure {
-		info.Write([]byte("QUIC forward secure key expansion\x00"))
-	} else {
-		info.Write([]byte("QUIC key expansion\x00"))
-	}
-	info.Write(connID)
-	info.Write(chlo)
-	info.Write(scfg)
-	info.Write(cert)
-
-	r := hkdf.New(sha256.New, sharedSecret, nonces, info.Bytes())
+	info := keyExpansionInfo(forwardSecure, connID, chlo, scfg, cert)
+	r := hkdf.New(sha256.New, sharedSecret, nonces, info)
 
 	s := make([]byte, 2*keyLen+2*4)
 	if _, err := io.ReadFull(r, s); err != nil {
@@ -82,6 +72,21 @@ func deriveKeys(forwardSecure bool, sharedSecret, nonces []byte, connID protocol
 	return otherKey, myKey, otherIV, myIV, nil
 }
 
+// keyExpansionInfo is the info parameter of the HKDF used for the key derivation
+func keyExpansionInfo(forwardSecure bool, connID protocol.ConnectionID, chlo, scfg, cert []byte) []byte {
+	var info bytes.Buffer
+	if forwardSecure {
+		info.Write([]byte("QUIC forward secure key expansion\x00"))
+	} else {
+		info.Write([]byte("QUIC key expansion\x00"))
+	}
+	info.Write(connID)
+	info.Write(chlo)
+	info.Write(scfg)
+	info.Write(cert)
+	return info.Bytes()
+}
+
 func diversify(key, iv, divNonce []byte) error {
 	secret := make([]byte, len(key)+len(iv))
 	copy(secret, key)
@@ -0,0 +1,167 @@
+package crypto
+
+import (
+	"crypto"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/bifurcation/mint"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// A TestVector is a named input or output of a key derivation or of the packet protection.
+type TestVector struct {
+	Name  string
+	Value []byte
+}
+
+// A TestVectorSet contains the test vectors for one key derivation, in the order they are computed.
+type TestVectorSet struct {
+	Description string
+	Vectors     []TestVector
+}
+
+func (s *TestVectorSet) add(name string, value []byte) {
+	s.Vectors = append(s.Vectors, TestVector{Name: name, Value: value})
+}
+
+// The fixed transcript used to generate the test vectors.
+// The connection ID is the one used in the test vector on the QUIC WG Wiki.
+var (
+	testVectorConnID       = protocol.ConnectionID{0x83, 0x94, 0xc8, 0xf0, 0x3e, 0x51, 0x57, 0x08}
+	testVectorPacketNumber = protocol.PacketNumber(0x1337)
+	testVectorHeader       = []byte("packet header")
+	testVectorPayload      = []byte("packet payload")
+)
+
+// GenerateTestVectors generates test vectors for the key derivations and the packet protection.
+// All inputs are fixed, such that the output is the same every time.
+// Other implementations can use these values to verify their implementation.
+func GenerateTestVectors() ([]TestVectorSet, error) {
+	gquicInitial, err := generateQuicCryptoTestVectors(false)
+	if err != nil {
+		return nil, err
+	}
+	gquicForwardSecure, err := generateQuicCryptoTestVectors(true)
+	if err != nil {
+		return nil, err
+	}
+	return []TestVectorSet{
+		generateNullAEADAESGCMTestVectors(),
+		generateNullAEADFNV128aTestVectors(),
+		gquicInitial,
+		gquicForwardSecure,
+	}, nil
+}
+
+func generateNullAEADAESGCMTestVectors() TestVectorSet {
+	s := TestVectorSet{Description: "IETF QUIC: cleartext AEAD (AES-GCM), derived from the connection ID"}
+	s.add("connection ID", testVectorConnID)
+	s.add("salt", quicVersion1Salt)
+	s.add("handshake secret", mint.HkdfExtract(crypto.SHA256, quicVersion1Salt, testVectorConnID))
+	clientSecret, serverSecret := computeSecrets(testVectorConnID)
+	s.add("client secret", clientSecret)
+	s.add("server secret", serverSecret)
+	clientKey, clientIV := computeNullAEADKeyAndIV(clientSecret)
+	s.add("client key", clientKey)
+	s.add("client IV", clientIV)
+	serverKey, serverIV := computeNullAEADKeyAndIV(serverSecret)
+	s.add("server key", serverKey)
+	s.add("server IV", serverIV)
+	// this never fails, since the key and the IV have the right length
+	client, _ := newNullAEADAESGCM(testVectorConnID, protocol.PerspectiveClient)
+	server, _ := newNullAEADAESGCM(testVectorConnID, protocol.PerspectiveServer)
+	addSealedPackets(&s, client, server)
+	return s
+}
+
+func generateNullAEADFNV128aTestVectors() TestVectorSet {
+	s := TestVectorSet{Description: "gQUIC: null AEAD (FNV-1a 128 bit hash)"}
+	addSealedPackets(&s, &nullAEADFNV128a{perspective: protocol.PerspectiveClient}, &nullAEADFNV128a{perspective: protocol.PerspectiveServer})
+	return s
+}
+
+func generateQuicCryptoTestVectors(forwardSecure bool) (TestVectorSet, error) {
+	var s TestVectorSet
+	if forwardSecure {
+		s.Description = "gQUIC: forward-secure key derivation (AES-GCM with 12 byte tags)"
+	} else {
+		s.Description = "gQUIC: initial key derivation (AES-GCM with 12 byte tags), with diversification of the server's key"
+	}
+	sharedSecret := testVectorSequence(0x10, 32)
+	nonces := testVectorSequence(0x30, 64)
+	chlo := []byte("CHLO message")
+	scfg := []byte("server config")
+	cert := []byte("leaf certificate")
+	var divNonce []byte
+	s.add("shared secret", sharedSecret)
+	s.add("nonces", nonces)
+	s.add("connection ID", testVectorConnID)
+	s.add("CHLO", chlo)
+	s.add("server config", scfg)
+	s.add("certificate", cert)
+	if !forwardSecure {
+		divNonce = testVectorSequence(0x70, 32)
+		s.add("diversification nonce", divNonce)
+	}
+	s.add("HKDF info", keyExpansionInfo(forwardSecure, testVectorConnID, chlo, scfg, cert))
+	clientKey, serverKey, clientIV, serverIV, err := deriveKeys(forwardSecure, sharedSecret, nonces, testVectorConnID, chlo, scfg, cert, divNonce, 16, false)
+	if err != nil {
+		return TestVectorSet{}, err
+	}
+	s.add("client key", clientKey)
+	s.add("client IV", clientIV)
+	s.add("server key", serverKey)
+	s.add("server IV", serverIV)
+	client, err := NewAEADAESGCM12(serverKey, clientKey, serverIV, clientIV)
+	if err != nil {
+		return TestVectorSet{}, err
+	}
+	server, err := NewAEADAESGCM12(clientKey, serverKey, clientIV, serverIV)
+	if err != nil {
+		return TestVectorSet{}, err
+	}
+	addSealedPackets(&s, client, server)
+	return s, nil
+}
+
+func addSealedPackets(s *TestVectorSet, client, server AEAD) {
+	pn := make([]byte, 8)
+	binary.BigEndian.PutUint64(pn, uint64(testVectorPacketNumber))
+	s.add("packet number", pn)
+	s.add("associated data", testVectorHeader)
+	s.add("plaintext", testVectorPayload)
+	s.add("sealed by the client", client.Seal(nil, testVectorPayload, testVectorPacketNumber, testVectorHeader))
+	s.add("sealed by the server", server.Seal(nil, testVectorPayload, testVectorPacketNumber, testVectorHeader))
+}
+
+func testVectorSequence(start byte, length int) []byte {
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = start + byte(i)
+	}
+	return b
+}
+
+// WriteTestVectors writes the test vectors in a human readable format.
+// All values are hex encoded.
+func WriteTestVectors(w io.Writer, sets []TestVectorSet) error {
+	for i, s := range sets {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "# %s\n", s.Description); err != nil {
+			return err
+		}
+		for _, v := range s.Vectors {
+			if _, err := fmt.Fprintf(w, "%s: %s\n", v.Name, hex.EncodeToString(v.Value)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package crypto
+
+import (
+	"bytes"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test Vectors", func() {
+	getVector := func(s TestVectorSet, name string) []byte {
+		for _, v := range s.Vectors {
+			if v.Name == name {
+				return v.Value
+			}
+		}
+		Fail("test vector " + name + " not found")
+		return nil
+	}
+
+	It("generates the same test vectors every time", func() {
+		sets1, err := GenerateTestVectors()
+		Expect(err).ToNot(HaveOccurred())
+		sets2, err := GenerateTestVectors()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sets1).To(Equal(sets2))
+	})
+
+	It("uses the values from the QUIC WG Wiki for the cleartext AEAD", func() {
+		sets, err := GenerateTestVectors()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(getVector(sets[0], "client key")).To(Equal([]byte{
+			0x3a, 0xd0, 0x54, 0x2c, 0x4a, 0x85, 0x84, 0x74,
+			0x00, 0x63, 0x04, 0x9e, 0x3b, 0x3c, 0xaa, 0xb2,
+		}))
+	})
+
+	It("generates sealed packets that can be opened by the peer", func() {
+		sets, err := GenerateTestVectors()
+		Expect(err).ToNot(HaveOccurred())
+		for _, s := range sets[2:] {
+			client, err := NewAEADAESGCM12(getVector(s, "server key"), getVector(s, "client key"), getVector(s, "server IV"), getVector(s, "client IV"))
+			Expect(err).ToNot(HaveOccurred())
+			server, err := NewAEADAESGCM12(getVector(s, "client key"), getVector(s, "server key"), getVector(s, "client IV"), getVector(s, "server IV"))
+			Expect(err).ToNot(HaveOccurred())
+			data, err := server.Open(nil, getVector(s, "sealed by the client"), testVectorPacketNumber, testVectorHeader)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(testVectorPayload))
+			data, err = client.Open(nil, getVector(s, "sealed by the server"), testVectorPacketNumber, testVectorHeader)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(testVectorPayload))
+		}
+	})
+
+	It("derives the same keys as the AEAD used by the session", func() {
+		sets, err := GenerateTestVectors()
+		Expect(err).ToNot(HaveOccurred())
+		s := sets[3]
+		Expect(s.Description).To(ContainSubstring("forward-secure"))
+		aead, err := DeriveQuicCryptoAESKeys(true, getVector(s, "shared secret"), getVector(s, "nonces"), getVector(s, "connection ID"), getVector(s, "CHLO"), getVector(s, "server config"), getVector(s, "certificate"), nil, protocol.PerspectiveServer)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(aead.Seal(nil, testVectorPayload, testVectorPacketNumber, testVectorHeader)).To(Equal(getVector(s, "sealed by the server")))
+	})
+
+	It("writes the test vectors", func() {
+		sets := []TestVectorSet{
+			{Description: "foo", Vectors: []TestVector{{Name: "key", Value: []byte{0xde, 0xca, 0xfb, 0xad}}}},
+			{Description: "bar", Vectors: []TestVector{{Name: "iv", Value: []byte{0x13, 0x37}}}},
+		}
+		b := &bytes.Buffer{}
+		Expect(WriteTestVectors(b, sets)).To(Succeed())
+		Expect(b.String()).To(Equal("# foo\nkey: decafbad\n\n# bar\niv: 1337\n"))
+	})
+})
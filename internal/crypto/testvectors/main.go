@@ -0,0 +1,22 @@
+// The testvectors tool prints test vectors for the key derivations and the packet protection used by quic-go.
+// The values are generated from a fixed transcript, and can be used to verify other QUIC implementations.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lucas-clemente/quic-go/internal/crypto"
+)
+
+func main() {
+	sets, err := crypto.GenerateTestVectors()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Generating test vectors failed: %s\n", err)
+		os.Exit(1)
+	}
+	if err := crypto.WriteTestVectors(os.Stdout, sets); err != nil {
+		fmt.Fprintf(os.Stderr, "Writing test vectors failed: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -9,6 +9,15 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/utils"
 )
 
+// Offsets is a snapshot of the offsets tracked by a flow controller.
+type Offsets struct {
+	BytesSent       protocol.ByteCount
+	SendWindow      protocol.ByteCount
+	BytesRead       protocol.ByteCount
+	HighestReceived protocol.ByteCount
+	ReceiveWindow   protocol.ByteCount
+}
+
 type baseFlowController struct {
 	// for sending data
 	bytesSent  protocol.ByteCount
@@ -21,6 +30,9 @@ type baseFlowController struct {
 	receiveWindow        protocol.ByteCount
 	receiveWindowSize    protocol.ByteCount
 	maxReceiveWindowSize protocol.ByteCount
+	// the window size the flow controller started with.
+	// When window growth is limited, the window size shrinks back to this value.
+	initialReceiveWindowSize protocol.ByteCount
 
 	epochStartTime   time.Time
 	epochStartOffset protocol.ByteCount
@@ -69,12 +81,20 @@ func (c *baseFlowController) hasWindowUpdate() bool {
 
 // getWindowUpdate updates the receive window, if necessary
 // it returns the new offset
-func (c *baseFlowController) getWindowUpdate() protocol.ByteCount {
+// If limitGrowth is set, auto-tuning doesn't increase the window size, and a window size that was increased before
+// shrinks back to the initial window size. This never reduces the window that was already advertised to the peer,
+// the next window update is just sent later, and advertises a smaller window.
+func (c *baseFlowController) getWindowUpdate(limitGrowth bool) protocol.ByteCount {
+	if limitGrowth {
+		c.receiveWindowSize = c.initialReceiveWindowSize
+	}
 	if !c.hasWindowUpdate() {
 		return 0
 	}
 
-	c.maybeAdjustWindowSize()
+	if !limitGrowth {
+		c.maybeAdjustWindowSize()
+	}
 	c.receiveWindow = c.bytesRead + c.receiveWindowSize
 	return c.receiveWindow
 }
@@ -105,6 +125,19 @@ func (c *baseFlowController) startNewAutoTuningEpoch() {
 	c.epochStartOffset = c.bytesRead
 }
 
+func (c *baseFlowController) GetOffsets() Offsets {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return Offsets{
+		BytesSent:       c.bytesSent,
+		SendWindow:      c.sendWindow,
+		BytesRead:       c.bytesRead,
+		HighestReceived: c.highestReceived,
+		ReceiveWindow:   c.receiveWindow,
+	}
+}
+
 func (c *baseFlowController) checkFlowControlViolation() bool {
 	return c.highestReceived > c.receiveWindow
 }
@@ -86,7 +86,7 @@ var _ = Describe("Base Flow controller", func() {
 			bytesRemaining := receiveWindowSize - protocol.ByteCount(bytesConsumed)
 			readPosition := receiveWindow - bytesRemaining
 			controller.bytesRead = readPosition
-			offset := controller.getWindowUpdate()
+			offset := controller.getWindowUpdate(false)
 			Expect(offset).To(Equal(readPosition + receiveWindowSize))
 			Expect(controller.receiveWindow).To(Equal(readPosition + receiveWindowSize))
 		})
@@ -96,7 +96,7 @@ var _ = Describe("Base Flow controller", func() {
 			bytesRemaining := receiveWindowSize - protocol.ByteCount(bytesConsumed)
 			readPosition := receiveWindow - bytesRemaining
 			controller.bytesRead = readPosition
-			offset := controller.getWindowUpdate()
+			offset := controller.getWindowUpdate(false)
 			Expect(offset).To(BeZero())
 		})
 
@@ -123,7 +123,7 @@ var _ = Describe("Base Flow controller", func() {
 				setRtt(0)
 				controller.startNewAutoTuningEpoch()
 				controller.AddBytesRead(400)
-				offset := controller.getWindowUpdate()
+				offset := controller.getWindowUpdate(false)
 				Expect(offset).ToNot(BeZero()) // make sure a window update is sent
 				Expect(controller.receiveWindowSize).To(Equal(oldWindowSize))
 			})
@@ -138,7 +138,7 @@ var _ = Describe("Base Flow controller", func() {
 				controller.epochStartOffset = controller.bytesRead
 				controller.epochStartTime = time.Now().Add(-rtt * 4 * 2 / 3)
 				controller.AddBytesRead(dataRead)
-				offset := controller.getWindowUpdate()
+				offset := controller.getWindowUpdate(false)
 				Expect(offset).ToNot(BeZero())
 				// check that the window size was increased
 				newWindowSize := controller.receiveWindowSize
@@ -159,7 +159,7 @@ var _ = Describe("Base Flow controller", func() {
 				controller.epochStartOffset = controller.bytesRead
 				controller.epochStartTime = time.Now().Add(-rtt * 4 * 1 / 3)
 				controller.AddBytesRead(dataRead)
-				offset := controller.getWindowUpdate()
+				offset := controller.getWindowUpdate(false)
 				Expect(offset).ToNot(BeZero())
 				// check that the window size was not increased
 				newWindowSize := controller.receiveWindowSize
@@ -178,7 +178,7 @@ var _ = Describe("Base Flow controller", func() {
 				controller.epochStartOffset = controller.bytesRead
 				controller.epochStartTime = time.Now().Add(-rtt * 4 * 2 / 3)
 				controller.AddBytesRead(dataRead)
-				offset := controller.getWindowUpdate()
+				offset := controller.getWindowUpdate(false)
 				Expect(offset).ToNot(BeZero())
 				// check that the window size was not increased
 				Expect(controller.receiveWindowSize).To(Equal(oldWindowSize))
@@ -207,6 +207,51 @@ var _ = Describe("Base Flow controller", func() {
 				controller.maybeAdjustWindowSize()
 				Expect(controller.receiveWindowSize).To(Equal(controller.maxReceiveWindowSize)) // 5000
 			})
+
+			It("doesn't increase the window size if growth is limited", func() {
+				controller.initialReceiveWindowSize = receiveWindowSize
+				rtt := scaleDuration(20 * time.Millisecond)
+				setRtt(rtt)
+				// read so fast that the window would be increased if growth wasn't limited
+				controller.epochStartOffset = controller.bytesRead
+				controller.epochStartTime = time.Now().Add(-rtt * 4 * 2 / 3)
+				controller.AddBytesRead(receiveWindowSize*2/3 + 1)
+				offset := controller.getWindowUpdate(true)
+				Expect(offset).ToNot(BeZero())
+				Expect(controller.receiveWindowSize).To(Equal(oldWindowSize))
+			})
+
+			It("shrinks the window size back to the initial window size if growth is limited", func() {
+				controller.initialReceiveWindowSize = receiveWindowSize
+				controller.receiveWindowSize = 4 * receiveWindowSize
+				controller.receiveWindow = controller.bytesRead + 4*receiveWindowSize
+				oldReceiveWindow := controller.receiveWindow
+				// the window would be updated with the larger window size, but not with the initial window size
+				controller.AddBytesRead(2 * receiveWindowSize)
+				Expect(controller.getWindowUpdate(true)).To(BeZero())
+				Expect(controller.receiveWindowSize).To(Equal(receiveWindowSize))
+				Expect(controller.receiveWindow).To(Equal(oldReceiveWindow))
+				// once enough data was read, the window is updated using the initial window size
+				controller.AddBytesRead(receiveWindowSize * 3 / 2)
+				offset := controller.getWindowUpdate(true)
+				Expect(offset).To(Equal(controller.bytesRead + receiveWindowSize))
+				Expect(offset).To(BeNumerically(">", oldReceiveWindow))
+			})
 		})
 	})
+
+	It("returns a snapshot of the offsets", func() {
+		controller.bytesSent = 1
+		controller.sendWindow = 2
+		controller.bytesRead = 3
+		controller.highestReceived = 4
+		controller.receiveWindow = 5
+		Expect(controller.GetOffsets()).To(Equal(Offsets{
+			BytesSent:       1,
+			SendWindow:      2,
+			BytesRead:       3,
+			HighestReceived: 4,
+			ReceiveWindow:   5,
+		}))
+	})
 })
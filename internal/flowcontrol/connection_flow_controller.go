@@ -14,6 +14,9 @@ type connectionFlowController struct {
 	baseFlowController
 
 	queueWindowUpdate func()
+	// limitWindowGrowth is called before the receive window is updated, it may be nil.
+	// If it returns true, the receive windows of the connection and its streams don't grow, see getWindowUpdate.
+	limitWindowGrowth func() bool
 }
 
 var _ ConnectionFlowController = &connectionFlowController{}
@@ -24,18 +27,21 @@ func NewConnectionFlowController(
 	receiveWindow protocol.ByteCount,
 	maxReceiveWindow protocol.ByteCount,
 	queueWindowUpdate func(),
+	limitWindowGrowth func() bool,
 	rttStats *congestion.RTTStats,
 	logger utils.Logger,
 ) ConnectionFlowController {
 	return &connectionFlowController{
 		baseFlowController: baseFlowController{
-			rttStats:             rttStats,
-			receiveWindow:        receiveWindow,
-			receiveWindowSize:    receiveWindow,
-			maxReceiveWindowSize: maxReceiveWindow,
-			logger:               logger,
+			rttStats:                 rttStats,
+			receiveWindow:            receiveWindow,
+			receiveWindowSize:        receiveWindow,
+			maxReceiveWindowSize:     maxReceiveWindow,
+			initialReceiveWindowSize: receiveWindow,
+			logger:                   logger,
 		},
 		queueWindowUpdate: queueWindowUpdate,
+		limitWindowGrowth: limitWindowGrowth,
 	}
 }
 
@@ -76,23 +82,34 @@ func (c *connectionFlowController) MaybeQueueWindowUpdate() {
 }
 
 func (c *connectionFlowController) GetWindowUpdate() protocol.ByteCount {
+	limitGrowth := c.windowGrowthLimited()
 	c.mutex.Lock()
 	oldWindowSize := c.receiveWindowSize
-	offset := c.baseFlowController.getWindowUpdate()
+	offset := c.baseFlowController.getWindowUpdate(limitGrowth)
 	if oldWindowSize < c.receiveWindowSize {
 		c.logger.Debugf("Increasing receive flow control window for the connection to %d kB", c.receiveWindowSize/(1<<10))
+	} else if oldWindowSize > c.receiveWindowSize {
+		c.logger.Debugf("Decreasing receive flow control window for the connection to %d kB", c.receiveWindowSize/(1<<10))
 	}
 	c.mutex.Unlock()
 	return offset
 }
 
+// windowGrowthLimited says if the receive windows of the connection and its streams should not grow at the moment
+func (c *connectionFlowController) windowGrowthLimited() bool {
+	return c.limitWindowGrowth != nil && c.limitWindowGrowth()
+}
+
 // EnsureMinimumWindowSize sets a minimum window size
 // it should make sure that the connection-level window is increased when a stream-level window grows
 func (c *connectionFlowController) EnsureMinimumWindowSize(inc protocol.ByteCount) {
+	if c.windowGrowthLimited() {
+		return
+	}
 	c.mutex.Lock()
 	if inc > c.receiveWindowSize {
-		c.logger.Debugf("Increasing receive flow control window for the connection to %d kB, in response to stream flow control window increase", c.receiveWindowSize/(1<<10))
 		c.receiveWindowSize = utils.MinByteCount(inc, c.maxReceiveWindowSize)
+		c.logger.Debugf("Increasing receive flow control window for the connection to %d kB, in response to stream flow control window increase", c.receiveWindowSize/(1<<10))
 		c.startNewAutoTuningEpoch()
 	}
 	c.mutex.Unlock()
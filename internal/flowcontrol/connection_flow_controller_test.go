@@ -36,7 +36,7 @@ var _ = Describe("Connection Flow controller", func() {
 			receiveWindow := protocol.ByteCount(2000)
 			maxReceiveWindow := protocol.ByteCount(3000)
 
-			fc := NewConnectionFlowController(receiveWindow, maxReceiveWindow, nil, rttStats, utils.DefaultLogger).(*connectionFlowController)
+			fc := NewConnectionFlowController(receiveWindow, maxReceiveWindow, nil, nil, rttStats, utils.DefaultLogger).(*connectionFlowController)
 			Expect(fc.receiveWindow).To(Equal(receiveWindow))
 			Expect(fc.maxReceiveWindowSize).To(Equal(maxReceiveWindow))
 		})
@@ -92,6 +92,20 @@ var _ = Describe("Connection Flow controller", func() {
 				Expect(newWindowSize).To(Equal(2 * oldWindowSize))
 				Expect(offset).To(Equal(protocol.ByteCount(oldOffset + dataRead + newWindowSize)))
 			})
+
+			It("doesn't autotune the window if growth is limited", func() {
+				controller.initialReceiveWindowSize = controller.receiveWindowSize
+				var limited bool
+				controller.limitWindowGrowth = func() bool { return limited }
+				oldWindowSize := controller.receiveWindowSize
+				setRtt(scaleDuration(20 * time.Millisecond))
+				controller.epochStartTime = time.Now().Add(-time.Millisecond)
+				controller.epochStartOffset = controller.bytesRead
+				controller.AddBytesRead(oldWindowSize/2 + 1)
+				limited = true
+				Expect(controller.GetWindowUpdate()).ToNot(BeZero())
+				Expect(controller.receiveWindowSize).To(Equal(oldWindowSize))
+			})
 		})
 	})
 
@@ -150,6 +164,12 @@ var _ = Describe("Connection Flow controller", func() {
 			Expect(controller.receiveWindowSize).To(Equal(max))
 		})
 
+		It("doesn't increase the window size if growth is limited", func() {
+			controller.limitWindowGrowth = func() bool { return true }
+			controller.EnsureMinimumWindowSize(1800)
+			Expect(controller.receiveWindowSize).To(Equal(oldWindowSize))
+		})
+
 		It("starts a new epoch after the window size was increased", func() {
 			controller.EnsureMinimumWindowSize(1912)
 			Expect(controller.epochStartTime).To(BeTemporally("~", time.Now(), 100*time.Millisecond))
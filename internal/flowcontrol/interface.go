@@ -11,6 +11,8 @@ type flowController interface {
 	AddBytesRead(protocol.ByteCount)
 	GetWindowUpdate() protocol.ByteCount // returns 0 if no update is necessary
 	MaybeQueueWindowUpdate()             //  queues a window update, if necessary
+	// GetOffsets returns a snapshot of the current offsets
+	GetOffsets() Offsets
 }
 
 // A StreamFlowController is a flow controller for a QUIC stream.
@@ -38,4 +40,5 @@ type connectionFlowControllerI interface {
 	EnsureMinimumWindowSize(protocol.ByteCount)
 	// for receiving
 	IncrementHighestReceived(protocol.ByteCount) error
+	windowGrowthLimited() bool
 }
@@ -42,12 +42,13 @@ func NewStreamFlowController(
 		connection:              cfc.(connectionFlowControllerI),
 		queueWindowUpdate:       func() { queueWindowUpdate(streamID) },
 		baseFlowController: baseFlowController{
-			rttStats:             rttStats,
-			receiveWindow:        receiveWindow,
-			receiveWindowSize:    receiveWindow,
-			maxReceiveWindowSize: maxReceiveWindow,
-			sendWindow:           initialSendWindow,
-			logger:               logger,
+			rttStats:                 rttStats,
+			receiveWindow:            receiveWindow,
+			receiveWindowSize:        receiveWindow,
+			maxReceiveWindowSize:     maxReceiveWindow,
+			initialReceiveWindowSize: receiveWindow,
+			sendWindow:               initialSendWindow,
+			logger:                   logger,
 		},
 	}
 }
@@ -137,6 +138,7 @@ func (c *streamFlowController) MaybeQueueWindowUpdate() {
 }
 
 func (c *streamFlowController) GetWindowUpdate() protocol.ByteCount {
+	limitGrowth := c.connection.windowGrowthLimited()
 	// don't use defer for unlocking the mutex here, GetWindowUpdate() is called frequently and defer shows up in the profiler
 	c.mutex.Lock()
 	// if we already received the final offset for this stream, the peer won't need any additional flow control credit
@@ -146,12 +148,14 @@ func (c *streamFlowController) GetWindowUpdate() protocol.ByteCount {
 	}
 
 	oldWindowSize := c.receiveWindowSize
-	offset := c.baseFlowController.getWindowUpdate()
+	offset := c.baseFlowController.getWindowUpdate(limitGrowth)
 	if c.receiveWindowSize > oldWindowSize { // auto-tuning enlarged the window size
 		c.logger.Debugf("Increasing receive flow control window for stream %d to %d kB", c.streamID, c.receiveWindowSize/(1<<10))
 		if c.contributesToConnection {
 			c.connection.EnsureMinimumWindowSize(protocol.ByteCount(float64(c.receiveWindowSize) * protocol.ConnectionFlowControlMultiplier))
 		}
+	} else if c.receiveWindowSize < oldWindowSize {
+		c.logger.Debugf("Decreasing receive flow control window for stream %d to %d kB", c.streamID, c.receiveWindowSize/(1<<10))
 	}
 	c.mutex.Unlock()
 	return offset
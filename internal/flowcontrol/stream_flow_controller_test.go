@@ -24,7 +24,7 @@ var _ = Describe("Stream Flow controller", func() {
 		rttStats := &congestion.RTTStats{}
 		controller = &streamFlowController{
 			streamID:   10,
-			connection: NewConnectionFlowController(1000, 1000, func() { queuedConnWindowUpdate = true }, rttStats, utils.DefaultLogger).(*connectionFlowController),
+			connection: NewConnectionFlowController(1000, 1000, func() { queuedConnWindowUpdate = true }, nil, rttStats, utils.DefaultLogger).(*connectionFlowController),
 		}
 		controller.maxReceiveWindowSize = 10000
 		controller.rttStats = rttStats
@@ -39,7 +39,7 @@ var _ = Describe("Stream Flow controller", func() {
 		sendWindow := protocol.ByteCount(4000)
 
 		It("sets the send and receive windows", func() {
-			cc := NewConnectionFlowController(0, 0, nil, nil, utils.DefaultLogger)
+			cc := NewConnectionFlowController(0, 0, nil, nil, nil, utils.DefaultLogger)
 			fc := NewStreamFlowController(5, true, cc, receiveWindow, maxReceiveWindow, sendWindow, nil, rttStats, utils.DefaultLogger).(*streamFlowController)
 			Expect(fc.streamID).To(Equal(protocol.StreamID(5)))
 			Expect(fc.receiveWindow).To(Equal(receiveWindow))
@@ -55,7 +55,7 @@ var _ = Describe("Stream Flow controller", func() {
 				queued = true
 			}
 
-			cc := NewConnectionFlowController(0, 0, nil, nil, utils.DefaultLogger)
+			cc := NewConnectionFlowController(0, 0, nil, nil, nil, utils.DefaultLogger)
 			fc := NewStreamFlowController(5, true, cc, receiveWindow, maxReceiveWindow, sendWindow, queueWindowUpdate, rttStats, utils.DefaultLogger).(*streamFlowController)
 			fc.AddBytesRead(receiveWindow)
 			fc.MaybeQueueWindowUpdate()
@@ -243,6 +243,21 @@ var _ = Describe("Stream Flow controller", func() {
 				Expect(controller.connection.(*connectionFlowController).receiveWindowSize).To(Equal(protocol.ByteCount(2 * oldWindowSize))) // unchanged
 			})
 
+			It("shrinks the window back to the initial size if the connection limits window growth", func() {
+				controller.initialReceiveWindowSize = oldWindowSize
+				controller.receiveWindowSize = 2 * oldWindowSize
+				controller.contributesToConnection = true
+				controller.connection.(*connectionFlowController).limitWindowGrowth = func() bool { return true }
+				setRtt(scaleDuration(20 * time.Millisecond))
+				controller.epochStartOffset = controller.bytesRead
+				controller.epochStartTime = time.Now().Add(-time.Millisecond)
+				controller.AddBytesRead(55)
+				offset := controller.GetWindowUpdate()
+				Expect(offset).To(Equal(controller.bytesRead + oldWindowSize))
+				Expect(controller.receiveWindowSize).To(Equal(oldWindowSize))
+				Expect(controller.connection.(*connectionFlowController).receiveWindowSize).To(BeEquivalentTo(120)) // unchanged
+			})
+
 			It("doesn't increase the window after a final offset was already received", func() {
 				controller.AddBytesRead(30)
 				err := controller.UpdateHighestReceived(90, true)
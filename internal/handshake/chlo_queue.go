@@ -0,0 +1,134 @@
+package handshake
+
+import (
+	"sync"
+	"time"
+)
+
+// A CHLOQueue limits the number of CHLOs that are processed concurrently.
+// Processing a CHLO is expensive: an inchoate CHLO requires signing the server config, a full CHLO requires a key exchange.
+// When the limit is reached, CHLOs wait in the queue.
+// CHLOs of returning clients (that present a valid STK and the current server config ID)
+// are processed before inchoate CHLOs, such that existing users are still served during an attack or a flash crowd.
+// If the queue is full, inchoate CHLOs are dropped first.
+type CHLOQueue struct {
+	mutex sync.Mutex
+
+	maxProcessing int
+	maxQueued     int
+	maxWait       time.Duration
+
+	processing int
+	// the waiting CHLOs, in the order they arrived.
+	// true is sent on the channel when processing can start, false when the CHLO is dropped.
+	returning []chan bool
+	inchoate  []chan bool
+}
+
+// NewCHLOQueue creates a new CHLOQueue.
+// A CHLO that waits longer than maxWait is dropped, since the client has probably given up by then.
+func NewCHLOQueue(maxProcessing, maxQueued int, maxWait time.Duration) *CHLOQueue {
+	return &CHLOQueue{
+		maxProcessing: maxProcessing,
+		maxQueued:     maxQueued,
+		maxWait:       maxWait,
+	}
+}
+
+// SetMaxProcessing changes the number of CHLOs that are processed concurrently.
+func (q *CHLOQueue) SetMaxProcessing(n int) {
+	q.mutex.Lock()
+	q.maxProcessing = n
+	q.dispatch()
+	q.mutex.Unlock()
+}
+
+// Acquire waits until a CHLO can be processed.
+// It returns false if the CHLO was dropped.
+// If it returns true, Release must be called when processing the CHLO is done.
+func (q *CHLOQueue) Acquire(returning bool) bool {
+	q.mutex.Lock()
+	if q.processing < q.maxProcessing && q.numQueued() == 0 {
+		q.processing++
+		q.mutex.Unlock()
+		return true
+	}
+	if q.numQueued() >= q.maxQueued {
+		if !returning || len(q.inchoate) == 0 {
+			q.mutex.Unlock()
+			return false
+		}
+		// make room by dropping the inchoate CHLO that arrived last
+		last := q.inchoate[len(q.inchoate)-1]
+		q.inchoate = q.inchoate[:len(q.inchoate)-1]
+		last <- false
+	}
+	c := make(chan bool, 1)
+	if returning {
+		q.returning = append(q.returning, c)
+	} else {
+		q.inchoate = append(q.inchoate, c)
+	}
+	q.mutex.Unlock()
+
+	timer := time.NewTimer(q.maxWait)
+	defer timer.Stop()
+	select {
+	case ok := <-c:
+		return ok
+	case <-timer.C:
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.remove(c, returning) {
+		return false
+	}
+	// processing was started (or the CHLO was dropped) concurrently with the timer firing
+	return <-c
+}
+
+// Release is called when processing a CHLO is done.
+func (q *CHLOQueue) Release() {
+	q.mutex.Lock()
+	q.processing--
+	q.dispatch()
+	q.mutex.Unlock()
+}
+
+func (q *CHLOQueue) numQueued() int {
+	return len(q.returning) + len(q.inchoate)
+}
+
+// dispatch starts processing waiting CHLOs, as long as the limit allows it
+func (q *CHLOQueue) dispatch() {
+	for q.processing < q.maxProcessing {
+		var c chan bool
+		if len(q.returning) > 0 {
+			c = q.returning[0]
+			q.returning = q.returning[1:]
+		} else if len(q.inchoate) > 0 {
+			c = q.inchoate[0]
+			q.inchoate = q.inchoate[1:]
+		} else {
+			return
+		}
+		q.processing++
+		c <- true
+	}
+}
+
+// remove removes a waiting CHLO from the queue.
+// It returns false if the CHLO is not in the queue any more.
+func (q *CHLOQueue) remove(c chan bool, returning bool) bool {
+	queue := &q.inchoate
+	if returning {
+		queue = &q.returning
+	}
+	for i, qc := range *queue {
+		if qc == c {
+			*queue = append((*queue)[:i], (*queue)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
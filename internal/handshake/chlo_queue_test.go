@@ -0,0 +1,115 @@
+package handshake
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CHLO queue", func() {
+	// acquire calls Acquire on a new Go routine, and returns a channel that the result is sent on
+	acquire := func(q *CHLOQueue, returning bool) <-chan bool {
+		c := make(chan bool, 1)
+		go func() {
+			defer GinkgoRecover()
+			c <- q.Acquire(returning)
+		}()
+		return c
+	}
+
+	It("processes CHLOs immediately, as long as the limit is not reached", func() {
+		q := NewCHLOQueue(2, 10, time.Hour)
+		Expect(q.Acquire(false)).To(BeTrue())
+		Expect(q.Acquire(true)).To(BeTrue())
+		c := acquire(q, false)
+		Consistently(c).ShouldNot(Receive())
+		q.Release()
+		Eventually(c).Should(Receive(BeTrue()))
+	})
+
+	It("processes CHLOs of returning clients first", func() {
+		q := NewCHLOQueue(1, 10, time.Hour)
+		Expect(q.Acquire(false)).To(BeTrue())
+		inchoate := acquire(q, false)
+		Eventually(func() int { return queueLen(q) }).Should(Equal(1))
+		returning := acquire(q, true)
+		Eventually(func() int { return queueLen(q) }).Should(Equal(2))
+		q.Release()
+		Eventually(returning).Should(Receive(BeTrue()))
+		Consistently(inchoate).ShouldNot(Receive())
+		q.Release()
+		Eventually(inchoate).Should(Receive(BeTrue()))
+	})
+
+	It("processes CHLOs in the order they arrived", func() {
+		q := NewCHLOQueue(1, 10, time.Hour)
+		Expect(q.Acquire(true)).To(BeTrue())
+		first := acquire(q, true)
+		Eventually(func() int { return queueLen(q) }).Should(Equal(1))
+		second := acquire(q, true)
+		Eventually(func() int { return queueLen(q) }).Should(Equal(2))
+		q.Release()
+		Eventually(first).Should(Receive(BeTrue()))
+		Consistently(second).ShouldNot(Receive())
+		q.Release()
+		Eventually(second).Should(Receive(BeTrue()))
+	})
+
+	It("drops inchoate CHLOs if the queue is full", func() {
+		q := NewCHLOQueue(1, 1, time.Hour)
+		Expect(q.Acquire(true)).To(BeTrue())
+		queued := acquire(q, false)
+		Eventually(func() int { return queueLen(q) }).Should(Equal(1))
+		Expect(q.Acquire(false)).To(BeFalse())
+		Consistently(queued).ShouldNot(Receive())
+	})
+
+	It("drops the inchoate CHLO that arrived last to make room for a returning client", func() {
+		q := NewCHLOQueue(1, 2, time.Hour)
+		Expect(q.Acquire(false)).To(BeTrue())
+		first := acquire(q, false)
+		Eventually(func() int { return queueLen(q) }).Should(Equal(1))
+		second := acquire(q, false)
+		Eventually(func() int { return queueLen(q) }).Should(Equal(2))
+		returning := acquire(q, true)
+		Eventually(second).Should(Receive(BeFalse()))
+		Eventually(func() int { return queueLen(q) }).Should(Equal(2))
+		q.Release()
+		Eventually(returning).Should(Receive(BeTrue()))
+		q.Release()
+		Eventually(first).Should(Receive(BeTrue()))
+	})
+
+	It("drops CHLOs of returning clients if the queue is full of CHLOs of returning clients", func() {
+		q := NewCHLOQueue(1, 1, time.Hour)
+		Expect(q.Acquire(true)).To(BeTrue())
+		acquire(q, true)
+		Eventually(func() int { return queueLen(q) }).Should(Equal(1))
+		Expect(q.Acquire(true)).To(BeFalse())
+	})
+
+	It("drops CHLOs that wait too long", func() {
+		q := NewCHLOQueue(1, 10, 50*time.Millisecond)
+		Expect(q.Acquire(false)).To(BeTrue())
+		start := time.Now()
+		Expect(q.Acquire(true)).To(BeFalse())
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+		Expect(queueLen(q)).To(BeZero())
+	})
+
+	It("processes more CHLOs when the limit is increased", func() {
+		q := NewCHLOQueue(1, 10, time.Hour)
+		Expect(q.Acquire(false)).To(BeTrue())
+		c := acquire(q, false)
+		Consistently(c).ShouldNot(Receive())
+		q.SetMaxProcessing(2)
+		Eventually(c).Should(Receive(BeTrue()))
+	})
+})
+
+func queueLen(q *CHLOQueue) int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.numQueued()
+}
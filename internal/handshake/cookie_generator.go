@@ -81,9 +81,15 @@ func (g *CookieGenerator) DecodeToken(encrypted []byte) (*Cookie, error) {
 }
 
 // encodeRemoteAddr encodes a remote address such that it can be saved in the Cookie
+// IPv4 addresses (including IPv4-mapped IPv6 addresses) are always encoded in their 4 byte form,
+// such that the same address always results in the same encoding.
 func encodeRemoteAddr(remoteAddr net.Addr) []byte {
 	if udpAddr, ok := remoteAddr.(*net.UDPAddr); ok {
-		return append([]byte{cookiePrefixIP}, udpAddr.IP...)
+		ip := udpAddr.IP
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		return append([]byte{cookiePrefixIP}, ip...)
 	}
 	return append([]byte{cookiePrefixString}, []byte(remoteAddr.String())...)
 }
@@ -97,6 +97,21 @@ var _ = Describe("Cookie Generator", func() {
 		}
 	})
 
+	It("encodes IPv4 and IPv4-mapped IPv6 addresses the same way", func() {
+		ip4 := net.IPv4(192, 168, 13, 37).To4()
+		Expect(ip4).To(HaveLen(4))
+		ip6 := net.ParseIP("::ffff:192.168.13.37")
+		Expect(ip6).To(HaveLen(16))
+		Expect(encodeRemoteAddr(&net.UDPAddr{IP: ip4})).To(Equal(encodeRemoteAddr(&net.UDPAddr{IP: ip6})))
+		for _, ip := range []net.IP{ip4, ip6} {
+			token, err := cookieGen.NewToken(&net.UDPAddr{IP: ip, Port: 1337})
+			Expect(err).ToNot(HaveOccurred())
+			cookie, err := cookieGen.DecodeToken(token)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cookie.RemoteAddr).To(Equal("192.168.13.37"))
+		}
+	})
+
 	It("uses the string representation an address that is not a UDP address", func() {
 		raddr := &net.TCPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337}
 		token, err := cookieGen.NewToken(raddr)
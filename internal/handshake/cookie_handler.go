@@ -25,11 +25,17 @@ func NewCookieHandler(callback func(net.Addr, *Cookie) bool, logger utils.Logger
 	if err != nil {
 		return nil, err
 	}
+	return NewCookieHandlerWithGenerator(callback, cookieGenerator, logger), nil
+}
+
+// NewCookieHandlerWithGenerator creates a new CookieHandler that uses the keys of the CookieGenerator.
+// Cookies are accepted by all CookieHandlers using the same CookieGenerator.
+func NewCookieHandlerWithGenerator(callback func(net.Addr, *Cookie) bool, cookieGenerator *CookieGenerator, logger utils.Logger) *CookieHandler {
 	return &CookieHandler{
 		callback:        callback,
 		cookieGenerator: cookieGenerator,
 		logger:          logger,
-	}, nil
+	}
 }
 
 // Generate a new cookie for a mint connection.
@@ -49,3 +55,14 @@ func (h *CookieHandler) Validate(conn *mint.Conn, token []byte) bool {
 	}
 	return h.callback(conn.RemoteAddr(), data)
 }
+
+// RequireCookie returns a CookieHandler that uses the same keys, but always requires the client to present a cookie.
+func (h *CookieHandler) RequireCookie() *CookieHandler {
+	return &CookieHandler{
+		callback: func(addr net.Addr, cookie *Cookie) bool {
+			return cookie != nil && h.callback(addr, cookie)
+		},
+		cookieGenerator: h.cookieGenerator,
+		logger:          h.logger,
+	}
+}
@@ -63,4 +63,15 @@ var _ = Describe("Cookie Handler", func() {
 		cookie := []byte("unparseable cookie")
 		Expect(ch.Validate(conn, cookie)).To(BeFalse())
 	})
+
+	It("always generates a token if a cookie is required", func() {
+		callbackReturn = true
+		rch := ch.RequireCookie()
+		cookie, err := rch.Generate(conn)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cookie).ToNot(BeNil())
+		// the token can be validated by the original handler as well
+		Expect(rch.Validate(conn, cookie)).To(BeTrue())
+		Expect(ch.Validate(conn, cookie)).To(BeTrue())
+	})
 })
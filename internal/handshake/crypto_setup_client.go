@@ -49,6 +49,7 @@ type cryptoSetupClient struct {
 	nullAEAD             crypto.AEAD
 	secureAEAD           crypto.AEAD
 	forwardSecureAEAD    crypto.AEAD
+	earlyKeysDiscarded   bool
 
 	paramsChan     chan<- TransportParameters
 	handshakeEvent chan<- struct{}
@@ -203,6 +204,9 @@ func (h *cryptoSetupClient) handleREJMessage(cryptoData map[Tag][]byte) error {
 	if crt, ok := cryptoData[TagCERT]; ok {
 		err := h.certManager.SetData(crt)
 		if err != nil {
+			if qErr, ok := err.(*qerr.QuicError); ok {
+				return qErr
+			}
 			return qerr.Error(qerr.InvalidCryptoMessageParameter, "Certificate data invalid")
 		}
 
@@ -280,9 +284,21 @@ func (h *cryptoSetupClient) handleSHLOMessage(cryptoData map[Tag][]byte) (*Trans
 	if err != nil {
 		return nil, qerr.InvalidCryptoMessageParameter
 	}
+	params.ServerSupportedVersions = parseVersionList(verTag)
 	return params, nil
 }
 
+// parseVersionList parses the version list sent in the VER tag of the SHLO
+func parseVersionList(verTags []byte) []protocol.VersionNumber {
+	versions := make([]protocol.VersionNumber, 0, len(verTags)/4)
+	b := bytes.NewReader(verTags)
+	for b.Len() >= 4 {
+		v, _ := utils.BigEndian.ReadUint32(b)
+		versions = append(versions, protocol.VersionNumber(v))
+	}
+	return versions
+}
+
 func (h *cryptoSetupClient) validateVersionList(verTags []byte) bool {
 	numNegotiatedVersions := len(h.negotiatedVersions)
 	if numNegotiatedVersions == 0 {
@@ -348,6 +364,11 @@ func (h *cryptoSetupClient) GetSealer() (protocol.EncryptionLevel, Sealer) {
 }
 
 func (h *cryptoSetupClient) GetSealerForCryptoStream() (protocol.EncryptionLevel, Sealer) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.earlyKeysDiscarded {
+		return protocol.EncryptionForwardSecure, h.forwardSecureAEAD
+	}
 	return protocol.EncryptionUnencrypted, h.nullAEAD
 }
 
@@ -357,6 +378,9 @@ func (h *cryptoSetupClient) GetSealerWithEncryptionLevel(encLevel protocol.Encry
 
 	switch encLevel {
 	case protocol.EncryptionUnencrypted:
+		if h.nullAEAD == nil {
+			return nil, errors.New("CryptoSetupClient: nullAEAD already discarded")
+		}
 		return h.nullAEAD, nil
 	case protocol.EncryptionSecure:
 		if h.secureAEAD == nil {
@@ -375,14 +399,38 @@ func (h *cryptoSetupClient) GetSealerWithEncryptionLevel(encLevel protocol.Encry
 func (h *cryptoSetupClient) ConnectionState() ConnectionState {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
-	return ConnectionState{
-		HandshakeComplete: h.forwardSecureAEAD != nil,
-		PeerCertificates:  h.certManager.GetChain(),
+	state := ConnectionState{
+		HandshakeComplete:  h.forwardSecureAEAD != nil,
+		EarlyKeysDiscarded: h.earlyKeysDiscarded,
+		PeerCertificates:   h.certManager.GetChain(),
+	}
+	if state.HandshakeComplete {
+		state.CipherSuite = aeadAESG
 	}
+	return state
+}
+
+func (h *cryptoSetupClient) DiscardEarlyKeys() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.logger.Debugf("Discarding the null and the secure AEAD.")
+	h.earlyKeysDiscarded = true
+	h.nullAEAD = nil
+	h.secureAEAD = nil
+	h.diversificationNonce = nil
+	h.lastSentCHLO = nil
+	h.chloForSignature = nil
+	h.proof = nil
 }
 
 func (h *cryptoSetupClient) SetDiversificationNonce(divNonce []byte) error {
 	h.mutex.Lock()
+	// the diversification nonce is only needed for the secure AEAD
+	if h.earlyKeysDiscarded {
+		h.mutex.Unlock()
+		return nil
+	}
 	if len(h.diversificationNonce) > 0 {
 		defer h.mutex.Unlock()
 		if !bytes.Equal(h.diversificationNonce, divNonce) {
@@ -459,7 +507,7 @@ func (h *cryptoSetupClient) getTags() (map[Tag][]byte, error) {
 			tags[TagNONC] = h.nonc
 			tags[TagXLCT] = xlct
 			tags[TagKEXS] = []byte("C255")
-			tags[TagAEAD] = []byte("AESG")
+			tags[TagAEAD] = []byte(aeadAESG)
 			tags[TagPUBS] = h.serverConfig.kex.PublicKey() // TODO: check if 3 bytes need to be prepended
 		}
 	}
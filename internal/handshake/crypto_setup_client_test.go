@@ -257,6 +257,13 @@ var _ = Describe("Client Crypto Setup", func() {
 				Expect(err).To(MatchError(qerr.Error(qerr.InvalidCryptoMessageParameter, "Certificate data invalid")))
 			})
 
+			It("passes on QUIC errors returned by the CertManager", func() {
+				tagMap[TagCERT] = []byte("cert")
+				certManager.setDataError = qerr.Error(qerr.CryptoInvalidValueLength, "Certificate chain too long")
+				err := cs.handleREJMessage(tagMap)
+				Expect(err).To(MatchError(qerr.Error(qerr.CryptoInvalidValueLength, "Certificate chain too long")))
+			})
+
 			Context("verifying the certificate chain", func() {
 				It("returns a ProofInvalid error if the certificate chain is not valid", func() {
 					tagMap[TagCERT] = []byte("cert")
@@ -445,6 +452,16 @@ var _ = Describe("Client Crypto Setup", func() {
 			Expect(params.IdleTimeout).To(Equal(13 * time.Second))
 		})
 
+		It("reads the versions supported by the server", func() {
+			b := &bytes.Buffer{}
+			utils.BigEndian.WriteUint32(b, uint32(protocol.Version39))
+			utils.BigEndian.WriteUint32(b, 0x1337)
+			shloMap[TagVER] = b.Bytes()
+			params, err := cs.handleSHLOMessage(shloMap)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(params.ServerSupportedVersions).To(Equal([]protocol.VersionNumber{protocol.Version39, 0x1337}))
+		})
+
 		It("closes the handshakeEvent chan when receiving an SHLO", func() {
 			HandshakeMessage{Tag: TagSHLO, Data: shloMap}.Write(&stream.dataToRead)
 			done := make(chan struct{})
@@ -857,6 +874,7 @@ var _ = Describe("Client Crypto Setup", func() {
 				certManager.chain = chain
 				state := cs.ConnectionState()
 				Expect(state.HandshakeComplete).To(BeFalse())
+				Expect(state.CipherSuite).To(BeEmpty())
 				Expect(state.PeerCertificates).To(Equal(chain))
 			})
 
@@ -864,6 +882,8 @@ var _ = Describe("Client Crypto Setup", func() {
 				doSHLO()
 				state := cs.ConnectionState()
 				Expect(state.HandshakeComplete).To(BeTrue())
+				Expect(state.CipherSuite).To(Equal("AESG"))
+				Expect(state.Used0RTT).To(BeFalse())
 			})
 		})
 
@@ -912,6 +932,43 @@ var _ = Describe("Client Crypto Setup", func() {
 				Expect(sealer).To(BeNil())
 			})
 		})
+
+		Context("discarding the early keys", func() {
+			It("discards the null and the secure AEAD", func() {
+				doSHLO()
+				Expect(cs.ConnectionState().EarlyKeysDiscarded).To(BeFalse())
+				cs.DiscardEarlyKeys()
+				Expect(cs.ConnectionState().EarlyKeysDiscarded).To(BeTrue())
+				Expect(cs.nullAEAD).To(BeNil())
+				Expect(cs.secureAEAD).To(BeNil())
+				Expect(cs.diversificationNonce).To(BeNil())
+				Expect(cs.lastSentCHLO).To(BeNil())
+				_, err := cs.GetSealerWithEncryptionLevel(protocol.EncryptionUnencrypted)
+				Expect(err).To(MatchError("CryptoSetupClient: nullAEAD already discarded"))
+				_, err = cs.GetSealerWithEncryptionLevel(protocol.EncryptionSecure)
+				Expect(err).To(MatchError("CryptoSetupClient: no secureAEAD"))
+				encLevel, sealer := cs.GetSealerForCryptoStream()
+				Expect(encLevel).To(Equal(protocol.EncryptionForwardSecure))
+				Expect(sealer).To(Equal(cs.forwardSecureAEAD))
+			})
+
+			It("ignores diversification nonces after discarding the early keys", func() {
+				doSHLO()
+				cs.DiscardEarlyKeys()
+				Expect(cs.SetDiversificationNonce([]byte("foobar"))).To(Succeed())
+				Expect(cs.diversificationNonce).To(BeNil())
+			})
+
+			It("still opens forward-secure packets", func() {
+				doSHLO()
+				cs.DiscardEarlyKeys()
+				cs.forwardSecureAEAD.(*mockcrypto.MockAEAD).EXPECT().Open(nil, []byte("forward secure encrypted"), protocol.PacketNumber(10), []byte{}).Return([]byte("decrypted"), nil)
+				d, enc, err := cs.Open(nil, []byte("forward secure encrypted"), 10, []byte{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(enc).To(Equal(protocol.EncryptionForwardSecure))
+				Expect(d).To(Equal([]byte("decrypted")))
+			})
+		})
 	})
 
 	Context("Diversification Nonces", func() {
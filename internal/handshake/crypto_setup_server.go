@@ -38,6 +38,7 @@ type cryptoSetupServer struct {
 	nullAEAD                    crypto.AEAD
 	secureAEAD                  crypto.AEAD
 	forwardSecureAEAD           crypto.AEAD
+	earlyKeysDiscarded          bool
 	receivedForwardSecurePacket bool
 	receivedSecurePacket        bool
 	sentSHLO                    chan struct{} // this channel is closed as soon as the SHLO has been written
@@ -182,7 +183,15 @@ func (h *cryptoSetupServer) handleMessage(chloData []byte, cryptoData map[Tag][]
 		h.paramsChan <- *params
 	}
 
-	if !h.isInchoateCHLO(cryptoData, certUncompressed) {
+	inchoate := h.isInchoateCHLO(cryptoData, certUncompressed)
+	if q := h.scfg.chloQueue; q != nil {
+		if !q.Acquire(!inchoate) {
+			return false, qerr.Error(qerr.HandshakeFailed, "server busy")
+		}
+		defer q.Release()
+	}
+
+	if !inchoate {
 		// We have a CHLO with a proper server config ID, do a 0-RTT handshake
 		reply, err = h.handleCHLO(sni, chloData, cryptoData)
 		if err != nil {
@@ -256,6 +265,9 @@ func (h *cryptoSetupServer) GetSealer() (protocol.EncryptionLevel, Sealer) {
 func (h *cryptoSetupServer) GetSealerForCryptoStream() (protocol.EncryptionLevel, Sealer) {
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
+	if h.earlyKeysDiscarded {
+		return protocol.EncryptionForwardSecure, h.forwardSecureAEAD
+	}
 	if h.secureAEAD != nil {
 		return protocol.EncryptionSecure, h.secureAEAD
 	}
@@ -268,6 +280,9 @@ func (h *cryptoSetupServer) GetSealerWithEncryptionLevel(encLevel protocol.Encry
 
 	switch encLevel {
 	case protocol.EncryptionUnencrypted:
+		if h.nullAEAD == nil {
+			return nil, errors.New("CryptoSetupServer: nullAEAD already discarded")
+		}
 		return h.nullAEAD, nil
 	case protocol.EncryptionSecure:
 		if h.secureAEAD == nil {
@@ -379,7 +394,7 @@ func (h *cryptoSetupServer) handleCHLO(sni string, data []byte, cryptoData map[T
 	}
 
 	aead := cryptoData[TagAEAD]
-	if !bytes.Equal(aead, []byte("AESG")) {
+	if !bytes.Equal(aead, []byte(aeadAESG)) {
 		return nil, qerr.Error(qerr.CryptoNoSupport, "Unsupported AEAD or KEXS")
 	}
 
@@ -458,10 +473,26 @@ func (h *cryptoSetupServer) handleCHLO(sni string, data []byte, cryptoData map[T
 func (h *cryptoSetupServer) ConnectionState() ConnectionState {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
-	return ConnectionState{
-		ServerName:        h.sni,
-		HandshakeComplete: h.receivedForwardSecurePacket,
+	state := ConnectionState{
+		ServerName:         h.sni,
+		HandshakeComplete:  h.receivedForwardSecurePacket,
+		EarlyKeysDiscarded: h.earlyKeysDiscarded,
 	}
+	if state.HandshakeComplete {
+		state.CipherSuite = aeadAESG
+	}
+	return state
+}
+
+func (h *cryptoSetupServer) DiscardEarlyKeys() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.logger.Debugf("Discarding the null and the secure AEAD.")
+	h.earlyKeysDiscarded = true
+	h.nullAEAD = nil
+	h.secureAEAD = nil
+	h.diversificationNonce = nil
 }
 
 func (h *cryptoSetupServer) validateClientNonce(nonce []byte) error {
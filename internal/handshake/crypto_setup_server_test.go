@@ -367,6 +367,23 @@ var _ = Describe("Server Crypto Setup", func() {
 			Expect(handshakeEvent).ToNot(BeClosed())
 		})
 
+		It("releases the CHLO queue after processing a CHLO", func() {
+			q := NewCHLOQueue(1, 10, time.Hour)
+			cs.scfg.SetCHLOQueue(q)
+			HandshakeMessage{Tag: TagCHLO, Data: fullCHLO}.Write(&stream.dataToRead)
+			Expect(cs.HandleCryptoStream()).To(Succeed())
+			Expect(stream.dataWritten.Bytes()).To(HavePrefix("SHLO"))
+			Expect(q.Acquire(false)).To(BeTrue())
+		})
+
+		It("aborts the handshake if the CHLO is dropped from the CHLO queue", func() {
+			cs.scfg.SetCHLOQueue(NewCHLOQueue(0, 0, time.Hour))
+			HandshakeMessage{Tag: TagCHLO, Data: fullCHLO}.Write(&stream.dataToRead)
+			err := cs.HandleCryptoStream()
+			Expect(err).To(MatchError(qerr.Error(qerr.HandshakeFailed, "server busy")))
+			Expect(stream.dataWritten.Len()).To(BeZero())
+		})
+
 		It("recognizes inchoate CHLOs missing SCID", func() {
 			delete(fullCHLO, TagSCID)
 			Expect(cs.isInchoateCHLO(fullCHLO, cert)).To(BeTrue())
@@ -651,6 +668,7 @@ var _ = Describe("Server Crypto Setup", func() {
 				cs.sni = "server name"
 				state := cs.ConnectionState()
 				Expect(state.HandshakeComplete).To(BeFalse())
+				Expect(state.CipherSuite).To(BeEmpty())
 				Expect(state.ServerName).To(Equal("server name"))
 			})
 
@@ -662,6 +680,7 @@ var _ = Describe("Server Crypto Setup", func() {
 				Expect(err).ToNot(HaveOccurred())
 				state := cs.ConnectionState()
 				Expect(state.HandshakeComplete).To(BeTrue())
+				Expect(state.CipherSuite).To(Equal("AESG"))
 			})
 		})
 
@@ -710,6 +729,33 @@ var _ = Describe("Server Crypto Setup", func() {
 				Expect(seal).To(BeNil())
 			})
 		})
+
+		Context("discarding the early keys", func() {
+			It("discards the null and the secure AEAD", func() {
+				doCHLO()
+				// receive a forward secure packet
+				cs.forwardSecureAEAD.(*mockcrypto.MockAEAD).EXPECT().Open(nil, []byte("forward secure encrypted"), protocol.PacketNumber(11), []byte{})
+				_, _, err := cs.Open(nil, []byte("forward secure encrypted"), 11, []byte{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(cs.ConnectionState().EarlyKeysDiscarded).To(BeFalse())
+				cs.DiscardEarlyKeys()
+				Expect(cs.ConnectionState().EarlyKeysDiscarded).To(BeTrue())
+				Expect(cs.nullAEAD).To(BeNil())
+				Expect(cs.secureAEAD).To(BeNil())
+				Expect(cs.diversificationNonce).To(BeNil())
+				_, err = cs.GetSealerWithEncryptionLevel(protocol.EncryptionUnencrypted)
+				Expect(err).To(MatchError("CryptoSetupServer: nullAEAD already discarded"))
+				_, err = cs.GetSealerWithEncryptionLevel(protocol.EncryptionSecure)
+				Expect(err).To(MatchError("CryptoSetupServer: no secureAEAD"))
+				encLevel, sealer := cs.GetSealerForCryptoStream()
+				Expect(encLevel).To(Equal(protocol.EncryptionForwardSecure))
+				Expect(sealer).To(Equal(cs.forwardSecureAEAD))
+				// packets that can't be opened with the forward-secure AEAD are rejected
+				cs.forwardSecureAEAD.(*mockcrypto.MockAEAD).EXPECT().Open(nil, []byte("unencrypted"), protocol.PacketNumber(12), []byte{}).Return(nil, errors.New("authentication failed"))
+				_, _, err = cs.Open(nil, []byte("unencrypted"), 12, []byte{})
+				Expect(err).To(MatchError("authentication failed"))
+			})
+		})
 	})
 
 	Context("STK verification and creation", func() {
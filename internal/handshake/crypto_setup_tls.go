@@ -155,13 +155,23 @@ func (h *cryptoSetupTLS) GetSealerForCryptoStream() (protocol.EncryptionLevel, S
 	return protocol.EncryptionUnencrypted, h.nullAEAD
 }
 
+// DiscardEarlyKeys is a no-op for IETF QUIC.
+// The crypto stream is always sent in packets protected with the null AEAD,
+// so the null AEAD is needed for the whole lifetime of the connection.
+func (h *cryptoSetupTLS) DiscardEarlyKeys() {}
+
 func (h *cryptoSetupTLS) ConnectionState() ConnectionState {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 	mintConnState := h.tls.ConnectionState()
-	return ConnectionState{
+	state := ConnectionState{
 		// TODO: set the ServerName, once mint exports it
-		HandshakeComplete: h.aead != nil,
-		PeerCertificates:  mintConnState.PeerCertificates,
+		HandshakeComplete:  h.aead != nil,
+		NegotiatedProtocol: mintConnState.NextProto,
+		PeerCertificates:   mintConnState.PeerCertificates,
+	}
+	if state.HandshakeComplete {
+		state.CipherSuite = mintConnState.CipherSuite.Suite.String()
 	}
+	return state
 }
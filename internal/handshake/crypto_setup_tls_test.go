@@ -72,12 +72,16 @@ var _ = Describe("TLS Crypto Setup", func() {
 			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ConnectionState().Return(mint.ConnectionState{})
 			state := cs.ConnectionState()
 			Expect(state.HandshakeComplete).To(BeFalse())
+			Expect(state.CipherSuite).To(BeEmpty())
 			Expect(state.PeerCertificates).To(BeNil())
 		})
 
 		It("reports after the handshake completes", func() {
 			cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
-			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ConnectionState().Return(mint.ConnectionState{})
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ConnectionState().Return(mint.ConnectionState{
+				CipherSuite: mint.CipherSuiteParams{Suite: mint.TLS_AES_128_GCM_SHA256},
+				NextProto:   "h3",
+			})
 			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertNoAlert)
 			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateServerConnected)
 			cs.keyDerivation = mockKeyDerivation
@@ -85,10 +89,19 @@ var _ = Describe("TLS Crypto Setup", func() {
 			Expect(err).ToNot(HaveOccurred())
 			state := cs.ConnectionState()
 			Expect(state.HandshakeComplete).To(BeTrue())
+			Expect(state.CipherSuite).To(Equal("TLS_AES_128_GCM_SHA256"))
+			Expect(state.NegotiatedProtocol).To(Equal("h3"))
 			Expect(state.PeerCertificates).To(BeNil())
 		})
 	})
 
+	It("doesn't discard the null AEAD", func() {
+		cs.DiscardEarlyKeys()
+		sealer, err := cs.GetSealerWithEncryptionLevel(protocol.EncryptionUnencrypted)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sealer).ToNot(BeNil())
+	})
+
 	Context("escalating crypto", func() {
 		doHandshake := func() {
 			cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
@@ -38,6 +38,9 @@ type MintTLS interface {
 type baseCryptoSetup interface {
 	HandleCryptoStream() error
 	ConnectionState() ConnectionState
+	// DiscardEarlyKeys drops the keys and the state that are only needed during the handshake.
+	// It must only be called after the handshake was confirmed.
+	DiscardEarlyKeys()
 
 	GetSealer() (protocol.EncryptionLevel, Sealer)
 	GetSealerWithEncryptionLevel(protocol.EncryptionLevel) (Sealer, error)
@@ -62,7 +65,19 @@ type CryptoSetupTLS interface {
 // ConnectionState records basic details about the QUIC connection.
 // Warning: This API should not be considered stable and might change soon.
 type ConnectionState struct {
-	HandshakeComplete bool                // handshake is complete
-	ServerName        string              // server name requested by client, if any (server side only)
-	PeerCertificates  []*x509.Certificate // certificate chain presented by remote peer
+	Version            protocol.VersionNumber   // QUIC version used, set by the session
+	HandshakeComplete  bool                     // handshake is complete, the forward-secure keys are available
+	HandshakeConfirmed bool                     // the peer completed the handshake as well, set by the session
+	CipherSuite        string                   // cipher suite used for the forward-secure keys, once the handshake is complete (for gQUIC, the tag of the AEAD)
+	NegotiatedProtocol string                   // application protocol negotiated using ALPN, if any (IETF QUIC only)
+	Used0RTT           bool                     // application data was sent before the handshake completed. This is never the case, since 0-RTT is not supported yet.
+	EarlyKeysDiscarded bool                     // the keys used during the handshake were dropped, after the handshake was confirmed (gQUIC only)
+	ServerName         string                   // server name requested by client, if any (server side only)
+	PeerCertificates   []*x509.Certificate      // certificate chain presented by remote peer
+	SupportedVersions  []protocol.VersionNumber // versions the server announced during the handshake, set by the session (client side only)
+	PeerFeatures       protocol.FeatureSet      // optional features the peer announced support for during the handshake, set by the session
+	ReceivedTTL        uint8                    // TTL (IPv4) or hop limit (IPv6) of the last packet received from the peer, if the platform allows reading it (currently Linux), set by the session
 }
+
+// the AEAD used for gQUIC, AES-128-GCM with a 12 byte tag
+const aeadAESG = "AESG"
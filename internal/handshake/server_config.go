@@ -14,6 +14,9 @@ type ServerConfig struct {
 	ID              []byte
 	obit            []byte
 	cookieGenerator *CookieGenerator
+	// chloQueue limits the number of CHLOs processed concurrently.
+	// If nil, CHLOs are processed without any limit.
+	chloQueue *CHLOQueue
 }
 
 // NewServerConfig creates a new server config
@@ -44,6 +47,12 @@ func NewServerConfig(kex crypto.KeyExchange, certChain crypto.CertChain) (*Serve
 	}, nil
 }
 
+// SetCHLOQueue sets the queue that limits the number of CHLOs processed concurrently.
+// It must be called before the server config is used.
+func (s *ServerConfig) SetCHLOQueue(q *CHLOQueue) {
+	s.chloQueue = q
+}
+
 // Get the server config binary representation
 func (s *ServerConfig) Get() []byte {
 	var serverConfig bytes.Buffer
@@ -52,7 +61,7 @@ func (s *ServerConfig) Get() []byte {
 		Data: map[Tag][]byte{
 			TagSCID: s.ID,
 			TagKEXS: []byte("C255"),
-			TagAEAD: []byte("AESG"),
+			TagAEAD: []byte(aeadAESG),
 			TagPUBS: append([]byte{0x20, 0x00, 0x00}, s.kex.PublicKey()...),
 			TagOBIT: s.obit,
 			TagEXPY: {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
@@ -87,7 +87,7 @@ func (s *serverConfigClient) parseValues(tagMap map[Tag][]byte) error {
 	}
 	var aesgFound bool
 	for i := 0; i < len(aead)/4; i++ {
-		if bytes.Equal(aead[4*i:4*i+4], []byte("AESG")) {
+		if bytes.Equal(aead[4*i:4*i+4], []byte(aeadAESG)) {
 			aesgFound = true
 			break
 		}
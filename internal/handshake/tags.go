@@ -85,6 +85,9 @@ const (
 	// TagCERT is the CERT data
 	TagCERT Tag = 0xff545243
 
+	// TagFEAT is the set of optional features supported (quic-go specific)
+	TagFEAT Tag = 'F' + 'E'<<8 + 'A'<<16 + 'T'<<24
+
 	// TagSHLO is the server hello
 	TagSHLO Tag = 'S' + 'H'<<8 + 'L'<<16 + 'O'<<24
 
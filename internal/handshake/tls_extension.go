@@ -16,6 +16,7 @@ const (
 	maxPacketSizeParameterID         transportParameterID = 0x5
 	statelessResetTokenParameterID   transportParameterID = 0x6
 	initialMaxUniStreamsParameterID  transportParameterID = 0x8
+	featuresParameterID              transportParameterID = 0xff01 // quic-go specific
 )
 
 type transportParameter struct {
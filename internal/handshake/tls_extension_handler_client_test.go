@@ -101,6 +101,7 @@ var _ = Describe("TLS Extension Handler, for the client", func() {
 			var params TransportParameters
 			Eventually(handler.GetPeerParams()).Should(Receive(&params))
 			Expect(params.StreamFlowControlWindow).To(BeEquivalentTo(0x11223344))
+			Expect(params.ServerSupportedVersions).To(Equal([]protocol.VersionNumber{handler.version}))
 			Eventually(done).Should(BeClosed())
 		})
 
@@ -62,6 +62,20 @@ var _ = Describe("TLS Extension Handler, for the server", func() {
 				Expect(eetp.SupportedVersions).To(ContainElement(uint32(version)))
 			}
 		})
+
+		It("sends the stateless reset token", func() {
+			token := [16]byte{0xde, 0xad, 0xbe, 0xef}
+			handler.ourParams.StatelessResetToken = &token
+			err := handler.Send(mint.HandshakeTypeEncryptedExtensions, &el)
+			Expect(err).ToNot(HaveOccurred())
+			ext := &tlsExtensionBody{}
+			_, err = el.Find(ext)
+			Expect(err).ToNot(HaveOccurred())
+			eetp := &encryptedExtensionsTransportParameters{}
+			_, err = syntax.Unmarshal(ext.data, eetp)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(eetp.Parameters).To(ContainElement(transportParameter{statelessResetTokenParameterID, token[:]}))
+		})
 	})
 
 	Context("receiving", func() {
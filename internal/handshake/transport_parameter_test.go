@@ -1,6 +1,7 @@
 package handshake
 
 import (
+	"bytes"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -45,6 +46,19 @@ var _ = Describe("Transport Parameters", func() {
 				Expect(params.IdleTimeout).To(Equal(protocol.MinRemoteIdleTimeout))
 			})
 
+			It("reads the features", func() {
+				values := map[Tag][]byte{TagFEAT: {0x5, 0, 0, 0}}
+				params, err := readHelloMap(values)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(params.Features).To(Equal(protocol.NewFeatureSet(protocol.FeatureDatagrams, protocol.FeatureMigration)))
+			})
+
+			It("errors when given an invalid FEAT value", func() {
+				values := map[Tag][]byte{TagFEAT: {2, 0, 0}} // 1 byte too short
+				_, err := readHelloMap(values)
+				Expect(err).To(MatchError(errMalformedTag))
+			})
+
 			It("errors when given an invalid SFCW value", func() {
 				values := map[Tag][]byte{TagSFCW: {2, 0, 0}} // 1 byte too short
 				_, err := readHelloMap(values)
@@ -98,6 +112,12 @@ var _ = Describe("Transport Parameters", func() {
 				entryMap := params.getHelloMap()
 				Expect(entryMap).To(HaveKeyWithValue(TagTCID, []byte{0, 0, 0, 0}))
 			})
+
+			It("announces the features", func() {
+				params := &TransportParameters{Features: protocol.NewFeatureSet(protocol.FeatureKeyUpdate)}
+				entryMap := params.getHelloMap()
+				Expect(entryMap).To(HaveKeyWithValue(TagFEAT, []byte{0x2, 0, 0, 0}))
+			})
 		})
 	})
 
@@ -117,8 +137,9 @@ var _ = Describe("Transport Parameters", func() {
 				MaxBidiStreams:              1337,
 				MaxUniStreams:               7331,
 				IdleTimeout:                 42 * time.Second,
+				Features:                    protocol.NewFeatureSet(protocol.FeatureMigration),
 			}
-			Expect(p.String()).To(Equal("&handshake.TransportParameters{StreamFlowControlWindow: 0x1234, ConnectionFlowControlWindow: 0x4321, MaxBidiStreams: 1337, MaxUniStreams: 7331, IdleTimeout: 42s}"))
+			Expect(p.String()).To(Equal("&handshake.TransportParameters{StreamFlowControlWindow: 0x1234, ConnectionFlowControlWindow: 0x4321, MaxBidiStreams: 1337, MaxUniStreams: 7331, IdleTimeout: 42s, Features: {migration}}"))
 		})
 
 		Context("parsing", func() {
@@ -144,6 +165,34 @@ var _ = Describe("Transport Parameters", func() {
 				Expect(params.IdleTimeout).To(Equal(0x1337 * time.Second))
 				Expect(params.OmitConnectionID).To(BeFalse())
 				Expect(params.MaxPacketSize).To(Equal(protocol.ByteCount(0x7331)))
+				Expect(params.StatelessResetToken).To(BeNil())
+			})
+
+			It("reads the stateless reset token", func() {
+				parameters[statelessResetTokenParameterID] = bytes.Repeat([]byte{0xde}, 16)
+				params, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(params.StatelessResetToken).ToNot(BeNil())
+				Expect(params.StatelessResetToken[:]).To(Equal(bytes.Repeat([]byte{0xde}, 16)))
+			})
+
+			It("reads the features", func() {
+				parameters[featuresParameterID] = []byte{0, 0, 0, 0x3}
+				params, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(params.Features).To(Equal(protocol.NewFeatureSet(protocol.FeatureDatagrams, protocol.FeatureKeyUpdate)))
+			})
+
+			It("rejects the parameters if the features have the wrong length", func() {
+				parameters[featuresParameterID] = []byte{0, 0, 0x3}
+				_, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).To(MatchError("wrong length for features: 3 (expected 4)"))
+			})
+
+			It("rejects the parameters if the stateless reset token has the wrong length", func() {
+				parameters[statelessResetTokenParameterID] = bytes.Repeat([]byte{0xde}, 15)
+				_, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).To(MatchError("wrong length for stateless_reset_token: 15 (expected 16)"))
 			})
 
 			It("rejects the parameters if the initial_max_stream_data is missing", func() {
@@ -253,6 +302,21 @@ var _ = Describe("Transport Parameters", func() {
 				Expect(values).To(HaveKeyWithValue(idleTimeoutParameterID, []byte{0xca, 0xfe}))
 				Expect(values).To(HaveKeyWithValue(maxPacketSizeParameterID, []byte{0x5, 0xac})) // 1452 = 0x5ac
 			})
+
+			It("adds the stateless reset token", func() {
+				token := [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+				params.StatelessResetToken = &token
+				values := paramsListToMap(params.getTransportParameters())
+				Expect(values).To(HaveLen(7))
+				Expect(values).To(HaveKeyWithValue(statelessResetTokenParameterID, token[:]))
+			})
+
+			It("adds the features", func() {
+				params.Features = protocol.NewFeatureSet(protocol.FeatureMigration)
+				values := paramsListToMap(params.getTransportParameters())
+				Expect(values).To(HaveLen(7))
+				Expect(values).To(HaveKeyWithValue(featuresParameterID, []byte{0, 0, 0, 0x4}))
+			})
 		})
 	})
 })
@@ -28,6 +28,14 @@ type TransportParameters struct {
 
 	OmitConnectionID bool // only used for gQUIC
 	IdleTimeout      time.Duration
+
+	StatelessResetToken *[16]byte // only used for IETF QUIC, only sent by the server
+
+	Features protocol.FeatureSet // the optional features supported
+
+	// ServerSupportedVersions are the versions the server announced during the handshake.
+	// It is only set on the client, and never serialized.
+	ServerSupportedVersions []protocol.VersionNumber
 }
 
 // readHelloMap reads the transport parameters from the tags sent in a gQUIC handshake message
@@ -68,6 +76,13 @@ func readHelloMap(tags map[Tag][]byte) (*TransportParameters, error) {
 		}
 		params.ConnectionFlowControlWindow = protocol.ByteCount(v)
 	}
+	if value, ok := tags[TagFEAT]; ok {
+		v, err := utils.LittleEndian.ReadUint32(bytes.NewBuffer(value))
+		if err != nil {
+			return nil, errMalformedTag
+		}
+		params.Features = protocol.FeatureSet(v)
+	}
 	return params, nil
 }
 
@@ -91,6 +106,11 @@ func (p *TransportParameters) getHelloMap() map[Tag][]byte {
 	if p.OmitConnectionID {
 		tags[TagTCID] = []byte{0, 0, 0, 0}
 	}
+	if p.Features != 0 {
+		feat := &bytes.Buffer{}
+		utils.LittleEndian.WriteUint32(feat, uint32(p.Features))
+		tags[TagFEAT] = feat.Bytes()
+	}
 	return tags
 }
 
@@ -141,6 +161,18 @@ func readTransportParameters(paramsList []transportParameter) (*TransportParamet
 				return nil, fmt.Errorf("invalid value for max_packet_size: %d (minimum 1200)", maxPacketSize)
 			}
 			params.MaxPacketSize = maxPacketSize
+		case statelessResetTokenParameterID:
+			if len(p.Value) != 16 {
+				return nil, fmt.Errorf("wrong length for stateless_reset_token: %d (expected 16)", len(p.Value))
+			}
+			var token [16]byte
+			copy(token[:], p.Value)
+			params.StatelessResetToken = &token
+		case featuresParameterID:
+			if len(p.Value) != 4 {
+				return nil, fmt.Errorf("wrong length for features: %d (expected 4)", len(p.Value))
+			}
+			params.Features = protocol.FeatureSet(binary.BigEndian.Uint32(p.Value))
 		}
 	}
 
@@ -173,11 +205,19 @@ func (p *TransportParameters) getTransportParameters() []transportParameter {
 		{idleTimeoutParameterID, idleTimeout},
 		{maxPacketSizeParameterID, maxPacketSize},
 	}
+	if p.StatelessResetToken != nil {
+		params = append(params, transportParameter{statelessResetTokenParameterID, p.StatelessResetToken[:]})
+	}
+	if p.Features != 0 {
+		features := make([]byte, 4)
+		binary.BigEndian.PutUint32(features, uint32(p.Features))
+		params = append(params, transportParameter{featuresParameterID, features})
+	}
 	return params
 }
 
 // String returns a string representation, intended for logging.
 // It should only used for IETF QUIC.
 func (p *TransportParameters) String() string {
-	return fmt.Sprintf("&handshake.TransportParameters{StreamFlowControlWindow: %#x, ConnectionFlowControlWindow: %#x, MaxBidiStreams: %d, MaxUniStreams: %d, IdleTimeout: %s}", p.StreamFlowControlWindow, p.ConnectionFlowControlWindow, p.MaxBidiStreams, p.MaxUniStreams, p.IdleTimeout)
+	return fmt.Sprintf("&handshake.TransportParameters{StreamFlowControlWindow: %#x, ConnectionFlowControlWindow: %#x, MaxBidiStreams: %d, MaxUniStreams: %d, IdleTimeout: %s, Features: %s}", p.StreamFlowControlWindow, p.ConnectionFlowControlWindow, p.MaxBidiStreams, p.MaxUniStreams, p.IdleTimeout, p.Features)
 }
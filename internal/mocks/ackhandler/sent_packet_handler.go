@@ -10,6 +10,7 @@ import (
 
 	gomock "github.com/golang/mock/gomock"
 	ackhandler "github.com/lucas-clemente/quic-go/internal/ackhandler"
+	congestion "github.com/lucas-clemente/quic-go/internal/congestion"
 	protocol "github.com/lucas-clemente/quic-go/internal/protocol"
 	wire "github.com/lucas-clemente/quic-go/internal/wire"
 )
@@ -49,6 +50,28 @@ func (mr *MockSentPacketHandlerMockRecorder) DequeuePacketForRetransmission() *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DequeuePacketForRetransmission", reflect.TypeOf((*MockSentPacketHandler)(nil).DequeuePacketForRetransmission))
 }
 
+// ECN mocks base method
+func (m *MockSentPacketHandler) ECN() protocol.ECN {
+	ret := m.ctrl.Call(m, "ECN")
+	ret0, _ := ret[0].(protocol.ECN)
+	return ret0
+}
+
+// ECN indicates an expected call of ECN
+func (mr *MockSentPacketHandlerMockRecorder) ECN() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ECN", reflect.TypeOf((*MockSentPacketHandler)(nil).ECN))
+}
+
+// EnableECN mocks base method
+func (m *MockSentPacketHandler) EnableECN() {
+	m.ctrl.Call(m, "EnableECN")
+}
+
+// EnableECN indicates an expected call of EnableECN
+func (mr *MockSentPacketHandlerMockRecorder) EnableECN() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableECN", reflect.TypeOf((*MockSentPacketHandler)(nil).EnableECN))
+}
+
 // GetAlarmTimeout mocks base method
 func (m *MockSentPacketHandler) GetAlarmTimeout() time.Time {
 	ret := m.ctrl.Call(m, "GetAlarmTimeout")
@@ -61,6 +84,42 @@ func (mr *MockSentPacketHandlerMockRecorder) GetAlarmTimeout() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAlarmTimeout", reflect.TypeOf((*MockSentPacketHandler)(nil).GetAlarmTimeout))
 }
 
+// GetBandwidthEstimate mocks base method
+func (m *MockSentPacketHandler) GetBandwidthEstimate() congestion.Bandwidth {
+	ret := m.ctrl.Call(m, "GetBandwidthEstimate")
+	ret0, _ := ret[0].(congestion.Bandwidth)
+	return ret0
+}
+
+// GetBandwidthEstimate indicates an expected call of GetBandwidthEstimate
+func (mr *MockSentPacketHandlerMockRecorder) GetBandwidthEstimate() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBandwidthEstimate", reflect.TypeOf((*MockSentPacketHandler)(nil).GetBandwidthEstimate))
+}
+
+// GetBytesInFlight mocks base method
+func (m *MockSentPacketHandler) GetBytesInFlight() protocol.ByteCount {
+	ret := m.ctrl.Call(m, "GetBytesInFlight")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// GetBytesInFlight indicates an expected call of GetBytesInFlight
+func (mr *MockSentPacketHandlerMockRecorder) GetBytesInFlight() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBytesInFlight", reflect.TypeOf((*MockSentPacketHandler)(nil).GetBytesInFlight))
+}
+
+// GetCongestionWindow mocks base method
+func (m *MockSentPacketHandler) GetCongestionWindow() protocol.ByteCount {
+	ret := m.ctrl.Call(m, "GetCongestionWindow")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// GetCongestionWindow indicates an expected call of GetCongestionWindow
+func (mr *MockSentPacketHandlerMockRecorder) GetCongestionWindow() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCongestionWindow", reflect.TypeOf((*MockSentPacketHandler)(nil).GetCongestionWindow))
+}
+
 // GetLowestPacketNotConfirmedAcked mocks base method
 func (m *MockSentPacketHandler) GetLowestPacketNotConfirmedAcked() protocol.PacketNumber {
 	ret := m.ctrl.Call(m, "GetLowestPacketNotConfirmedAcked")
@@ -73,6 +132,18 @@ func (mr *MockSentPacketHandlerMockRecorder) GetLowestPacketNotConfirmedAcked()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLowestPacketNotConfirmedAcked", reflect.TypeOf((*MockSentPacketHandler)(nil).GetLowestPacketNotConfirmedAcked))
 }
 
+// GetPacingRate mocks base method
+func (m *MockSentPacketHandler) GetPacingRate() congestion.Bandwidth {
+	ret := m.ctrl.Call(m, "GetPacingRate")
+	ret0, _ := ret[0].(congestion.Bandwidth)
+	return ret0
+}
+
+// GetPacingRate indicates an expected call of GetPacingRate
+func (mr *MockSentPacketHandlerMockRecorder) GetPacingRate() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPacingRate", reflect.TypeOf((*MockSentPacketHandler)(nil).GetPacingRate))
+}
+
 // GetPacketNumberLen mocks base method
 func (m *MockSentPacketHandler) GetPacketNumberLen(arg0 protocol.PacketNumber) protocol.PacketNumberLen {
 	ret := m.ctrl.Call(m, "GetPacketNumberLen", arg0)
@@ -85,6 +156,31 @@ func (mr *MockSentPacketHandlerMockRecorder) GetPacketNumberLen(arg0 interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPacketNumberLen", reflect.TypeOf((*MockSentPacketHandler)(nil).GetPacketNumberLen), arg0)
 }
 
+// GetResumeState mocks base method
+func (m *MockSentPacketHandler) GetResumeState() (congestion.ResumeState, bool) {
+	ret := m.ctrl.Call(m, "GetResumeState")
+	ret0, _ := ret[0].(congestion.ResumeState)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// GetResumeState indicates an expected call of GetResumeState
+func (mr *MockSentPacketHandlerMockRecorder) GetResumeState() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetResumeState", reflect.TypeOf((*MockSentPacketHandler)(nil).GetResumeState))
+}
+
+// GetStats mocks base method
+func (m *MockSentPacketHandler) GetStats() ackhandler.Stats {
+	ret := m.ctrl.Call(m, "GetStats")
+	ret0, _ := ret[0].(ackhandler.Stats)
+	return ret0
+}
+
+// GetStats indicates an expected call of GetStats
+func (mr *MockSentPacketHandlerMockRecorder) GetStats() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStats", reflect.TypeOf((*MockSentPacketHandler)(nil).GetStats))
+}
+
 // GetStopWaitingFrame mocks base method
 func (m *MockSentPacketHandler) GetStopWaitingFrame(arg0 bool) *wire.StopWaitingFrame {
 	ret := m.ctrl.Call(m, "GetStopWaitingFrame", arg0)
@@ -121,6 +217,16 @@ func (mr *MockSentPacketHandlerMockRecorder) ReceivedAck(arg0, arg1, arg2, arg3
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReceivedAck", reflect.TypeOf((*MockSentPacketHandler)(nil).ReceivedAck), arg0, arg1, arg2, arg3)
 }
 
+// ResumeCongestionState mocks base method
+func (m *MockSentPacketHandler) ResumeCongestionState(arg0 congestion.ResumeState) {
+	m.ctrl.Call(m, "ResumeCongestionState", arg0)
+}
+
+// ResumeCongestionState indicates an expected call of ResumeCongestionState
+func (mr *MockSentPacketHandlerMockRecorder) ResumeCongestionState(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResumeCongestionState", reflect.TypeOf((*MockSentPacketHandler)(nil).ResumeCongestionState), arg0)
+}
+
 // SendMode mocks base method
 func (m *MockSentPacketHandler) SendMode() ackhandler.SendMode {
 	ret := m.ctrl.Call(m, "SendMode")
@@ -144,7 +250,7 @@ func (mr *MockSentPacketHandlerMockRecorder) SentPacket(arg0 interface{}) *gomoc
 }
 
 // SentPacketsAsRetransmission mocks base method
-func (m *MockSentPacketHandler) SentPacketsAsRetransmission(arg0 []*ackhandler.Packet, arg1 protocol.PacketNumber) {
+func (m *MockSentPacketHandler) SentPacketsAsRetransmission(arg0 []*ackhandler.Packet, arg1 []protocol.PacketNumber) {
 	m.ctrl.Call(m, "SentPacketsAsRetransmission", arg0, arg1)
 }
 
@@ -163,6 +269,26 @@ func (mr *MockSentPacketHandlerMockRecorder) SetHandshakeComplete() *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetHandshakeComplete", reflect.TypeOf((*MockSentPacketHandler)(nil).SetHandshakeComplete))
 }
 
+// SetMaxPacketSize mocks base method
+func (m *MockSentPacketHandler) SetMaxPacketSize(arg0 protocol.ByteCount) {
+	m.ctrl.Call(m, "SetMaxPacketSize", arg0)
+}
+
+// SetMaxPacketSize indicates an expected call of SetMaxPacketSize
+func (mr *MockSentPacketHandlerMockRecorder) SetMaxPacketSize(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMaxPacketSize", reflect.TypeOf((*MockSentPacketHandler)(nil).SetMaxPacketSize), arg0)
+}
+
+// SetPeerMaxAckDelay mocks base method
+func (m *MockSentPacketHandler) SetPeerMaxAckDelay(arg0 time.Duration) {
+	m.ctrl.Call(m, "SetPeerMaxAckDelay", arg0)
+}
+
+// SetPeerMaxAckDelay indicates an expected call of SetPeerMaxAckDelay
+func (mr *MockSentPacketHandlerMockRecorder) SetPeerMaxAckDelay(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPeerMaxAckDelay", reflect.TypeOf((*MockSentPacketHandler)(nil).SetPeerMaxAckDelay), arg0)
+}
+
 // ShouldSendNumPackets mocks base method
 func (m *MockSentPacketHandler) ShouldSendNumPackets() int {
 	ret := m.ctrl.Call(m, "ShouldSendNumPackets")
@@ -9,6 +9,7 @@ import (
 	time "time"
 
 	gomock "github.com/golang/mock/gomock"
+	congestion "github.com/lucas-clemente/quic-go/internal/congestion"
 	protocol "github.com/lucas-clemente/quic-go/internal/protocol"
 )
 
@@ -35,6 +36,18 @@ func (m *MockSendAlgorithm) EXPECT() *MockSendAlgorithmMockRecorder {
 	return m.recorder
 }
 
+// BandwidthEstimate mocks base method
+func (m *MockSendAlgorithm) BandwidthEstimate() congestion.Bandwidth {
+	ret := m.ctrl.Call(m, "BandwidthEstimate")
+	ret0, _ := ret[0].(congestion.Bandwidth)
+	return ret0
+}
+
+// BandwidthEstimate indicates an expected call of BandwidthEstimate
+func (mr *MockSendAlgorithmMockRecorder) BandwidthEstimate() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BandwidthEstimate", reflect.TypeOf((*MockSendAlgorithm)(nil).BandwidthEstimate))
+}
+
 // GetCongestionWindow mocks base method
 func (m *MockSendAlgorithm) GetCongestionWindow() protocol.ByteCount {
 	ret := m.ctrl.Call(m, "GetCongestionWindow")
@@ -47,6 +60,19 @@ func (mr *MockSendAlgorithmMockRecorder) GetCongestionWindow() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCongestionWindow", reflect.TypeOf((*MockSendAlgorithm)(nil).GetCongestionWindow))
 }
 
+// GetResumeState mocks base method
+func (m *MockSendAlgorithm) GetResumeState() (congestion.ResumeState, bool) {
+	ret := m.ctrl.Call(m, "GetResumeState")
+	ret0, _ := ret[0].(congestion.ResumeState)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// GetResumeState indicates an expected call of GetResumeState
+func (mr *MockSendAlgorithmMockRecorder) GetResumeState() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetResumeState", reflect.TypeOf((*MockSendAlgorithm)(nil).GetResumeState))
+}
+
 // MaybeExitSlowStart mocks base method
 func (m *MockSendAlgorithm) MaybeExitSlowStart() {
 	m.ctrl.Call(m, "MaybeExitSlowStart")
@@ -57,6 +83,16 @@ func (mr *MockSendAlgorithmMockRecorder) MaybeExitSlowStart() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MaybeExitSlowStart", reflect.TypeOf((*MockSendAlgorithm)(nil).MaybeExitSlowStart))
 }
 
+// OnCongestionExperienced mocks base method
+func (m *MockSendAlgorithm) OnCongestionExperienced(arg0 protocol.PacketNumber, arg1 uint64, arg2 protocol.ByteCount) {
+	m.ctrl.Call(m, "OnCongestionExperienced", arg0, arg1, arg2)
+}
+
+// OnCongestionExperienced indicates an expected call of OnCongestionExperienced
+func (mr *MockSendAlgorithmMockRecorder) OnCongestionExperienced(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnCongestionExperienced", reflect.TypeOf((*MockSendAlgorithm)(nil).OnCongestionExperienced), arg0, arg1, arg2)
+}
+
 // OnConnectionMigration mocks base method
 func (m *MockSendAlgorithm) OnConnectionMigration() {
 	m.ctrl.Call(m, "OnConnectionMigration")
@@ -107,6 +143,50 @@ func (mr *MockSendAlgorithmMockRecorder) OnRetransmissionTimeout(arg0 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnRetransmissionTimeout", reflect.TypeOf((*MockSendAlgorithm)(nil).OnRetransmissionTimeout), arg0)
 }
 
+// PacingBudget mocks base method
+func (m *MockSendAlgorithm) PacingBudget(arg0 time.Time) protocol.ByteCount {
+	ret := m.ctrl.Call(m, "PacingBudget", arg0)
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// PacingBudget indicates an expected call of PacingBudget
+func (mr *MockSendAlgorithmMockRecorder) PacingBudget(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PacingBudget", reflect.TypeOf((*MockSendAlgorithm)(nil).PacingBudget), arg0)
+}
+
+// PacingRate mocks base method
+func (m *MockSendAlgorithm) PacingRate() congestion.Bandwidth {
+	ret := m.ctrl.Call(m, "PacingRate")
+	ret0, _ := ret[0].(congestion.Bandwidth)
+	return ret0
+}
+
+// PacingRate indicates an expected call of PacingRate
+func (mr *MockSendAlgorithmMockRecorder) PacingRate() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PacingRate", reflect.TypeOf((*MockSendAlgorithm)(nil).PacingRate))
+}
+
+// Resume mocks base method
+func (m *MockSendAlgorithm) Resume(arg0 congestion.ResumeState) {
+	m.ctrl.Call(m, "Resume", arg0)
+}
+
+// Resume indicates an expected call of Resume
+func (mr *MockSendAlgorithmMockRecorder) Resume(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resume", reflect.TypeOf((*MockSendAlgorithm)(nil).Resume), arg0)
+}
+
+// SetMaxPacketSize mocks base method
+func (m *MockSendAlgorithm) SetMaxPacketSize(arg0 protocol.ByteCount) {
+	m.ctrl.Call(m, "SetMaxPacketSize", arg0)
+}
+
+// SetMaxPacketSize indicates an expected call of SetMaxPacketSize
+func (mr *MockSendAlgorithmMockRecorder) SetMaxPacketSize(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMaxPacketSize", reflect.TypeOf((*MockSendAlgorithm)(nil).SetMaxPacketSize), arg0)
+}
+
 // SetNumEmulatedConnections mocks base method
 func (m *MockSendAlgorithm) SetNumEmulatedConnections(arg0 int) {
 	m.ctrl.Call(m, "SetNumEmulatedConnections", arg0)
@@ -128,9 +208,9 @@ func (mr *MockSendAlgorithmMockRecorder) SetSlowStartLargeReduction(arg0 interfa
 }
 
 // TimeUntilSend mocks base method
-func (m *MockSendAlgorithm) TimeUntilSend(arg0 protocol.ByteCount) time.Duration {
+func (m *MockSendAlgorithm) TimeUntilSend(arg0 protocol.ByteCount) time.Time {
 	ret := m.ctrl.Call(m, "TimeUntilSend", arg0)
-	ret0, _ := ret[0].(time.Duration)
+	ret0, _ := ret[0].(time.Time)
 	return ret0
 }
 
@@ -8,6 +8,7 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	flowcontrol "github.com/lucas-clemente/quic-go/internal/flowcontrol"
 	protocol "github.com/lucas-clemente/quic-go/internal/protocol"
 )
 
@@ -54,6 +55,18 @@ func (mr *MockConnectionFlowControllerMockRecorder) AddBytesSent(arg0 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBytesSent", reflect.TypeOf((*MockConnectionFlowController)(nil).AddBytesSent), arg0)
 }
 
+// GetOffsets mocks base method
+func (m *MockConnectionFlowController) GetOffsets() flowcontrol.Offsets {
+	ret := m.ctrl.Call(m, "GetOffsets")
+	ret0, _ := ret[0].(flowcontrol.Offsets)
+	return ret0
+}
+
+// GetOffsets indicates an expected call of GetOffsets
+func (mr *MockConnectionFlowControllerMockRecorder) GetOffsets() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOffsets", reflect.TypeOf((*MockConnectionFlowController)(nil).GetOffsets))
+}
+
 // GetWindowUpdate mocks base method
 func (m *MockConnectionFlowController) GetWindowUpdate() protocol.ByteCount {
 	ret := m.ctrl.Call(m, "GetWindowUpdate")
@@ -2,7 +2,6 @@ package protocol
 
 import (
 	"bytes"
-	"crypto/rand"
 	"fmt"
 	"io"
 )
@@ -10,10 +9,10 @@ import (
 // A ConnectionID in QUIC
 type ConnectionID []byte
 
-// GenerateConnectionID generates a connection ID using cryptographic random
-func GenerateConnectionID() (ConnectionID, error) {
-	b := make([]byte, ConnectionIDLen)
-	if _, err := rand.Read(b); err != nil {
+// GenerateConnectionID generates a connection ID of length len using cryptographic random, see ReadRandom
+func GenerateConnectionID(len int) (ConnectionID, error) {
+	b := make([]byte, len)
+	if err := ReadRandom(b); err != nil {
 		return nil, err
 	}
 	return ConnectionID(b), nil
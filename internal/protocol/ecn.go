@@ -0,0 +1,31 @@
+package protocol
+
+// ECN is the ECN codepoint of an IP packet (RFC 3168)
+type ECN uint8
+
+// the ECN codepoints
+const (
+	ECNNon ECN = iota // 00: not ECN-capable transport
+	ECT1              // 01: ECN-capable transport, ECT(1)
+	ECT0              // 10: ECN-capable transport, ECT(0)
+	ECNCE             // 11: congestion experienced
+)
+
+func (e ECN) String() string {
+	switch e {
+	case ECNNon:
+		return "Not-ECT"
+	case ECT1:
+		return "ECT(1)"
+	case ECT0:
+		return "ECT(0)"
+	case ECNCE:
+		return "CE"
+	default:
+		return "invalid ECN value"
+	}
+}
+
+// MaxDSCP is the largest Differentiated Services Code Point (RFC 2474).
+// The DSCP is stored in the upper 6 bits of the TOS / Traffic Class field, the ECN codepoint in the lower 2 bits.
+const MaxDSCP = 63
@@ -0,0 +1,23 @@
+package protocol
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ECN", func() {
+	It("uses the codepoints of the IP header", func() {
+		Expect(ECNNon).To(BeEquivalentTo(0x0))
+		Expect(ECT1).To(BeEquivalentTo(0x1))
+		Expect(ECT0).To(BeEquivalentTo(0x2))
+		Expect(ECNCE).To(BeEquivalentTo(0x3))
+	})
+
+	It("has the correct string representation", func() {
+		Expect(ECNNon.String()).To(Equal("Not-ECT"))
+		Expect(ECT1.String()).To(Equal("ECT(1)"))
+		Expect(ECT0.String()).To(Equal("ECT(0)"))
+		Expect(ECNCE.String()).To(Equal("CE"))
+		Expect(ECN(42).String()).To(Equal("invalid ECN value"))
+	})
+})
@@ -0,0 +1,67 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Feature is an optional protocol feature.
+// Endpoints announce the features they support during the handshake.
+type Feature uint8
+
+// the features
+const (
+	// FeatureDatagrams is the support for unreliable datagrams
+	FeatureDatagrams Feature = iota
+	// FeatureKeyUpdate is the support for updating the keys during the connection
+	FeatureKeyUpdate
+	// FeatureMigration is the support for connection migration
+	FeatureMigration
+	// FeatureAckFrequency is the support for the ACK_FREQUENCY frame
+	FeatureAckFrequency
+)
+
+func (f Feature) String() string {
+	switch f {
+	case FeatureDatagrams:
+		return "datagrams"
+	case FeatureKeyUpdate:
+		return "key update"
+	case FeatureMigration:
+		return "migration"
+	case FeatureAckFrequency:
+		return "ACK frequency"
+	default:
+		return fmt.Sprintf("unknown feature (%d)", uint8(f))
+	}
+}
+
+// A FeatureSet is a set of features, encoded as a bitmask.
+// It can hold features up to 31, features that are not known yet are preserved.
+type FeatureSet uint32
+
+// NewFeatureSet creates a FeatureSet containing the features
+func NewFeatureSet(features ...Feature) FeatureSet {
+	var s FeatureSet
+	for _, f := range features {
+		if f < 32 {
+			s |= 1 << f
+		}
+	}
+	return s
+}
+
+// Has says if the feature is contained in the set
+func (s FeatureSet) Has(f Feature) bool {
+	return f < 32 && s&(1<<f) != 0
+}
+
+func (s FeatureSet) String() string {
+	var features []string
+	for f := Feature(0); f < 32; f++ {
+		if s.Has(f) {
+			features = append(features, f.String())
+		}
+	}
+	return "{" + strings.Join(features, ", ") + "}"
+}
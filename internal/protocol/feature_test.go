@@ -0,0 +1,33 @@
+package protocol
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Features", func() {
+	It("has a string representation", func() {
+		Expect(FeatureDatagrams.String()).To(Equal("datagrams"))
+		Expect(FeatureKeyUpdate.String()).To(Equal("key update"))
+		Expect(FeatureMigration.String()).To(Equal("migration"))
+		Expect(Feature(42).String()).To(Equal("unknown feature (42)"))
+	})
+
+	It("creates feature sets", func() {
+		s := NewFeatureSet(FeatureDatagrams, FeatureMigration)
+		Expect(s.Has(FeatureDatagrams)).To(BeTrue())
+		Expect(s.Has(FeatureKeyUpdate)).To(BeFalse())
+		Expect(s.Has(FeatureMigration)).To(BeTrue())
+		Expect(s).To(Equal(FeatureSet(0x5)))
+	})
+
+	It("ignores features that don't fit into a set", func() {
+		Expect(NewFeatureSet(Feature(32), Feature(200))).To(BeZero())
+		Expect(FeatureSet(0xffffffff).Has(Feature(32))).To(BeFalse())
+	})
+
+	It("has a string representation for feature sets", func() {
+		Expect(NewFeatureSet().String()).To(Equal("{}"))
+		Expect(NewFeatureSet(FeatureKeyUpdate, FeatureDatagrams, Feature(10)).String()).To(Equal("{datagrams, key update, unknown feature (10)}"))
+	})
+})
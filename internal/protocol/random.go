@@ -0,0 +1,62 @@
+package protocol
+
+import (
+	"crypto/rand"
+	"flag"
+	"io"
+	mrand "math/rand"
+	"sync"
+)
+
+var (
+	randomMutex  sync.RWMutex
+	randomReader io.Reader = rand.Reader
+)
+
+// ReadRandom fills b with random bytes.
+// It is used to generate connection IDs, packet numbers and other random values sent on the wire.
+// It must not be used for nonces or key material, these are always read from crypto/rand.
+// The random bytes are read from crypto/rand, unless a different source was set using SetRandomReader.
+func ReadRandom(b []byte) error {
+	randomMutex.RLock()
+	r := randomReader
+	randomMutex.RUnlock()
+	_, err := io.ReadFull(r, b)
+	return err
+}
+
+// SetRandomReader replaces the source of randomness used by ReadRandom.
+// It returns a function that restores the previous source.
+// It can only be used in tests, e.g. to make packets reproducible for golden-packet tests.
+// It panics when called outside of a test binary.
+func SetRandomReader(r io.Reader) (restore func()) {
+	if flag.Lookup("test.v") == nil {
+		panic("SetRandomReader can only be used in tests")
+	}
+	randomMutex.Lock()
+	orig := randomReader
+	randomReader = r
+	randomMutex.Unlock()
+	return func() {
+		randomMutex.Lock()
+		randomReader = orig
+		randomMutex.Unlock()
+	}
+}
+
+type deterministicReader struct {
+	mutex sync.Mutex
+	rand  *mrand.Rand
+}
+
+// NewDeterministicReader creates an io.Reader that returns a reproducible sequence of pseudo-random bytes for a seed.
+// It is safe for concurrent use. It must only be used in tests, see SetRandomReader.
+func NewDeterministicReader(seed int64) io.Reader {
+	return &deterministicReader{rand: mrand.New(mrand.NewSource(seed))}
+}
+
+func (r *deterministicReader) Read(b []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.rand.Read(b)
+}
@@ -0,0 +1,72 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type erroringReader struct{}
+
+func (erroringReader) Read([]byte) (int, error) { return 0, errors.New("read error") }
+
+var _ = Describe("Random", func() {
+	It("reads random bytes", func() {
+		b1 := make([]byte, 16)
+		b2 := make([]byte, 16)
+		Expect(ReadRandom(b1)).To(Succeed())
+		Expect(ReadRandom(b2)).To(Succeed())
+		Expect(b1).ToNot(Equal(b2))
+	})
+
+	It("uses a different source of randomness, and restores the original one", func() {
+		restore := SetRandomReader(bytes.NewReader([]byte{1, 2, 3, 4, 5, 6, 7, 8}))
+		c, err := GenerateConnectionID(8)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).To(Equal(ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}))
+		restore()
+		c, err = GenerateConnectionID(8)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).ToNot(Equal(ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}))
+	})
+
+	It("returns errors of the source of randomness", func() {
+		defer SetRandomReader(erroringReader{})()
+		Expect(ReadRandom(make([]byte, 4))).To(MatchError("read error"))
+		_, err := GenerateConnectionID(8)
+		Expect(err).To(MatchError("read error"))
+	})
+
+	It("generates a reproducible sequence of bytes", func() {
+		read := func(r *deterministicReader) []byte {
+			b := make([]byte, 100)
+			_, err := r.Read(b)
+			Expect(err).ToNot(HaveOccurred())
+			return b
+		}
+		r1 := NewDeterministicReader(42).(*deterministicReader)
+		r2 := NewDeterministicReader(42).(*deterministicReader)
+		r3 := NewDeterministicReader(1337).(*deterministicReader)
+		b := read(r1)
+		Expect(read(r2)).To(Equal(b))
+		Expect(read(r3)).ToNot(Equal(b))
+		Expect(read(r1)).ToNot(Equal(b))
+	})
+
+	It("generates the same connection IDs for the same seed", func() {
+		generate := func(seed int64) []ConnectionID {
+			defer SetRandomReader(NewDeterministicReader(seed))()
+			var ids []ConnectionID
+			for i := 0; i < 3; i++ {
+				c, err := GenerateConnectionID(8)
+				Expect(err).ToNot(HaveOccurred())
+				ids = append(ids, c)
+			}
+			return ids
+		}
+		Expect(generate(42)).To(Equal(generate(42)))
+		Expect(generate(42)).ToNot(Equal(generate(43)))
+	})
+})
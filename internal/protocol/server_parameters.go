@@ -8,10 +8,6 @@ const MaxPacketSizeIPv4 = 1252
 // MaxPacketSizeIPv6 is the maximum packet size that we use for sending IPv6 packets.
 const MaxPacketSizeIPv6 = 1232
 
-// NonForwardSecurePacketSizeReduction is the number of bytes a non forward-secure packet has to be smaller than a forward-secure packet
-// This makes sure that those packets can always be retransmitted without splitting the contained StreamFrames
-const NonForwardSecurePacketSizeReduction = 50
-
 const defaultMaxCongestionWindowPackets = 1000
 
 // DefaultMaxCongestionWindow is the default for the max congestion window
@@ -20,9 +16,13 @@ const DefaultMaxCongestionWindow ByteCount = defaultMaxCongestionWindowPackets *
 // InitialCongestionWindow is the initial congestion window in QUIC packets
 const InitialCongestionWindow ByteCount = 32 * DefaultTCPMSS
 
-// MaxUndecryptablePackets limits the number of undecryptable packets that a
+// MaxCongestionStateAge is the maximum age of a saved congestion state that is used to skip slow start (Careful Resume).
+// Network conditions change, so older states are ignored.
+const MaxCongestionStateAge = time.Hour
+
+// DefaultMaxUndecryptablePackets is the default number of undecryptable packets that a
 // session queues for later until it sends a public reset.
-const MaxUndecryptablePackets = 10
+const DefaultMaxUndecryptablePackets = 10
 
 // PublicResetTimeout is the time to wait before sending a Public Reset when receiving too many undecryptable packets during the handshake
 // This timeout allows the Go scheduler to switch to the Go rountine that reads the crypto stream and to escalate the crypto
@@ -36,6 +36,17 @@ const ReceiveStreamFlowControlWindow = (1 << 10) * 32 // 32 kB
 // This is the value that Google servers are using
 const ReceiveConnectionFlowControlWindow = (1 << 10) * 48 // 48 kB
 
+// MaxQueuedClientHellos is the maximum number of Client Hellos that wait to be processed by the server.
+// See Config.MaxConcurrentClientHellos.
+const MaxQueuedClientHellos = 1024
+
+// MaxClientHelloQueueTime is the maximum time that a Client Hello waits to be processed by the server.
+// After that time, the handshake is aborted.
+const MaxClientHelloQueueTime = 5 * time.Second
+
+// DefaultSocketBufferSize is the default size that the receive and the send buffer of UDP sockets are increased to
+const DefaultSocketBufferSize = 2 * (1 << 20) // 2 MB
+
 // DefaultMaxReceiveStreamFlowControlWindowServer is the default maximum stream-level flow control window for receiving data, for the server
 // This is the value that Google servers are using
 const DefaultMaxReceiveStreamFlowControlWindowServer = 1 * (1 << 20) // 1 MB
@@ -74,12 +85,37 @@ const MaxStreamsMinimumIncrement = 10
 // MaxSessionUnprocessedPackets is the max number of packets stored in each session that are not yet processed.
 const MaxSessionUnprocessedPackets = defaultMaxCongestionWindowPackets
 
+// MaxSendQueueLength is the number of packets that can be queued for sending in each session.
+// When the send queue is full, no more packets are packed until the queued packets were written to the network.
+const MaxSendQueueLength = 32
+
+// DefaultMaxTransientWriteErrors is the default number of times writing a packet is retried after a transient error,
+// before the session is closed.
+const DefaultMaxTransientWriteErrors = 10
+
+// MaxBatchSegments is the maximum number of packets that are sent in a single system call, using UDP GSO or sendmmsg.
+// For GSO, the kernel allows up to 64 segments, with a total size of less than 64 kB.
+const MaxBatchSegments = 32
+
+// MinWriteRetryBackoff is the time to wait before retrying a write that failed with a transient error.
+// It is doubled for every retry, up to MaxWriteRetryBackoff.
+const MinWriteRetryBackoff = time.Millisecond
+
+// MaxWriteRetryBackoff is the maximum time to wait before retrying a write that failed with a transient error.
+const MaxWriteRetryBackoff = 100 * time.Millisecond
+
 // SkipPacketAveragePeriodLength is the average period length in which one packet number is skipped to prevent an Optimistic ACK attack
 const SkipPacketAveragePeriodLength PacketNumber = 500
 
 // MaxTrackedSkippedPackets is the maximum number of skipped packet numbers the SentPacketHandler keep track of for Optimistic ACK attack mitigation
 const MaxTrackedSkippedPackets = 10
 
+// DefaultSourcePrefixLengthIPv4 is the default length of the IPv4 address prefix that the per-source limits are applied to
+const DefaultSourcePrefixLengthIPv4 = 32
+
+// DefaultSourcePrefixLengthIPv6 is the default length of the IPv6 address prefix that the per-source limits are applied to
+const DefaultSourcePrefixLengthIPv6 = 64
+
 // CookieExpiryTime is the valid time of a cookie
 const CookieExpiryTime = 24 * time.Hour
 
@@ -93,16 +129,27 @@ const MaxOutstandingSentPackets = 2 * defaultMaxCongestionWindowPackets
 // This value *must* be larger than MaxOutstandingSentPackets.
 const MaxTrackedSentPackets = MaxOutstandingSentPackets * 5 / 4
 
-// MaxTrackedReceivedAckRanges is the maximum number of ACK ranges tracked
+// MaxTrackedReceivedAckRanges is the maximum number of ACK ranges tracked.
+// When a new range is created, the oldest range is deleted.
 const MaxTrackedReceivedAckRanges = defaultMaxCongestionWindowPackets
 
 // MaxNonRetransmittableAcks is the maximum number of packets containing an ACK, but no retransmittable frames, that we send in a row
 const MaxNonRetransmittableAcks = 19
 
+// MaxAckFrequencyPacketTolerance is the maximum number of retransmittable packets that we receive before sending an ACK,
+// if the peer requests a higher packet tolerance in an ACK_FREQUENCY frame
+const MaxAckFrequencyPacketTolerance = MaxTrackedReceivedAckRanges
+
+// MaxAckFrequencyDelay is the maximum ACK delay that can be requested in an ACK_FREQUENCY frame (2^14 ms)
+const MaxAckFrequencyDelay = (1 << 14) * time.Millisecond
+
 // MaxStreamFrameSorterGaps is the maximum number of gaps between received StreamFrames
 // prevents DoS attacks against the streamFrameSorter
 const MaxStreamFrameSorterGaps = 1000
 
+// DiagnosticFrameHistorySize is the number of recently sent and received frames that are saved for a DiagnosticSnapshot
+const DiagnosticFrameHistorySize = 32
+
 // CryptoMaxParams is the upper limit for the number of parameters in a crypto message.
 // Value taken from Chrome.
 const CryptoMaxParams = 128
@@ -110,6 +157,13 @@ const CryptoMaxParams = 128
 // CryptoParameterMaxLength is the upper limit for the length of a parameter in a crypto message.
 const CryptoParameterMaxLength = 4000
 
+// MaxUncompressedCertChainSize is the upper limit for the size of a certificate chain after decompression.
+// Value taken from Chrome.
+const MaxUncompressedCertChainSize = 128 * 1024
+
+// DefaultMaxReasonPhraseLength is the default length that a reason phrase received in a CONNECTION_CLOSE or APPLICATION_CLOSE frame is truncated to.
+const DefaultMaxReasonPhraseLength = 1024
+
 // EphermalKeyLifetime is the lifetime of the ephermal key during the handshake, see handshake.getEphermalKEX.
 const EphermalKeyLifetime = time.Minute
 
@@ -119,9 +173,25 @@ const MinRemoteIdleTimeout = 5 * time.Second
 // DefaultIdleTimeout is the default idle timeout
 const DefaultIdleTimeout = 30 * time.Second
 
+// DefaultClientPoolIdleTimeout is the default time after which a ClientPool closes a session that doesn't have any open streams
+const DefaultClientPoolIdleTimeout = 30 * time.Second
+
 // DefaultHandshakeTimeout is the default timeout for a connection until the crypto handshake succeeds.
 const DefaultHandshakeTimeout = 10 * time.Second
 
+// DefaultHandshakeRetransmissionBackoff is the default factor by which the retransmission timeout for handshake packets grows with every retransmission.
+const DefaultHandshakeRetransmissionBackoff = 2
+
+// DefaultPathValidationTimeout is the default time after which a PATH_CHALLENGE is retransmitted.
+const DefaultPathValidationTimeout = time.Second
+
+// DefaultMaxPathValidationProbes is the default maximum number of PATH_CHALLENGEs sent when validating a new peer address.
+const DefaultMaxPathValidationProbes = 3
+
+// MaxSendCoalescingDelay is the maximum delay that can be configured for coalescing stream data into fewer packets.
+// It is well below the ACK delay, such that it doesn't affect the RTT estimate noticeably.
+const MaxSendCoalescingDelay = 5 * time.Millisecond
+
 // ClosedSessionDeleteTimeout the server ignores packets arriving on a connection that is already closed
 // after this time all information about the old connection will be deleted
 const ClosedSessionDeleteTimeout = time.Minute
@@ -135,19 +205,54 @@ const NumCachedCertificates = 128
 // 2. it reduces the head-of-line blocking, when a packet is lost
 const MinStreamFrameSize ByteCount = 128
 
-// MaxAckFrameSize is the maximum size for an (IETF QUIC) ACK frame that we write
-// Due to the varint encoding, ACK frames can grow (almost) indefinitely large.
+// MaxAckFrameSize is the maximum size for an ACK frame that we write
+// Due to the varint encoding, IETF QUIC ACK frames can grow (almost) indefinitely large.
+// gQUIC ACK frames are limited to 256 ACK blocks, but they can still exceed this size for long packet numbers.
 // The MaxAckFrameSize should be large enough to encode many ACK range,
 // but must ensure that a maximum size ACK frame fits into one packet.
 const MaxAckFrameSize ByteCount = 1000
 
+// MaxUnpacedPackets is the maximum number of packets containing only ACK and control frames
+// that are sent while the pacer doesn't allow sending.
+const MaxUnpacedPackets = 2
+
 // MinPacingDelay is the minimum duration that is used for packet pacing
 // If the packet packing frequency is higher, multiple packets might be sent at once.
 // Example: For a packet pacing delay of 20 microseconds, we would send 5 packets at once, wait for 100 microseconds, and so forth.
 const MinPacingDelay time.Duration = 100 * time.Microsecond
 
-// ConnectionIDLen is the length of the source Connection ID used on IETF QUIC packets.
+// ConnectionIDLen is the default length of the source Connection ID used on IETF QUIC packets.
 // The Short Header contains the connection ID, but not the length,
 // so we need to know this value in advance (or encode it into the connection ID).
-// TODO: make this configurable
 const ConnectionIDLen = 8
+
+// MinConnectionIDLen is the minimum length of a (non-empty) connection ID
+const MinConnectionIDLen = 4
+
+// MaxConnectionIDLen is the maximum length of a connection ID
+const MaxConnectionIDLen = 18
+
+// MaxActiveConnectionIDs is the maximum number of connection IDs that are issued to the peer, and
+// the maximum number of unused connection IDs issued by the peer that we keep track of
+const MaxActiveConnectionIDs = 8
+
+// MinStatelessResetSize is the size of a Stateless Reset:
+// the type byte, 20 random bytes (long enough to look like a connection ID and a packet number), and the 16 byte token.
+// Stateless Resets are only sent in response to larger packets, such that two endpoints can't send Stateless Resets back and forth.
+const MinStatelessResetSize = 1 + 20 + 16
+
+// StreamReadFromBufferSize is the size of the buffers that a stream's ReadFrom reads into.
+// The buffers are handed to the stream without copying, so a buffer is never reused: consecutive reads fill consecutive parts of it.
+// It holds enough data to fill multiple packets, such that a stream doesn't need to wait for the reader after every packet.
+const StreamReadFromBufferSize = 16 * MaxReceivePacketSize
+
+// CorrelationIDLen is the number of bytes of the connection ID hash used for a session's correlation ID.
+// The correlation ID is hex encoded, so it is twice as long.
+const CorrelationIDLen = 4
+
+// MaxExtensionFrameDataLen is the maximum length of the payload of an extension frame.
+// Frames are never split across packets, so an extension frame must fit into a single packet.
+const MaxExtensionFrameDataLen ByteCount = 1000
+
+// MaxServerVersionCacheSize is the maximum number of hosts the client remembers the supported versions for.
+const MaxServerVersionCacheSize = 100
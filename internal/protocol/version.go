@@ -1,7 +1,6 @@
 package protocol
 
 import (
-	"crypto/rand"
 	"encoding/binary"
 	"fmt"
 	"math"
@@ -129,14 +128,14 @@ func ChooseSupportedVersion(ours, theirs []VersionNumber) (VersionNumber, bool)
 // generateReservedVersion generates a reserved version number (v & 0x0f0f0f0f == 0x0a0a0a0a)
 func generateReservedVersion() VersionNumber {
 	b := make([]byte, 4)
-	_, _ = rand.Read(b) // ignore the error here. Failure to read random data doesn't break anything
+	_ = ReadRandom(b) // ignore the error here. Failure to read random data doesn't break anything
 	return VersionNumber((binary.BigEndian.Uint32(b) | 0x0a0a0a0a) & 0xfafafafa)
 }
 
 // GetGreasedVersions adds one reserved version number to a slice of version numbers, at a random position
 func GetGreasedVersions(supported []VersionNumber) []VersionNumber {
 	b := make([]byte, 1)
-	_, _ = rand.Read(b) // ignore the error here. Failure to read random data doesn't break anything
+	_ = ReadRandom(b) // ignore the error here. Failure to read random data doesn't break anything
 	randPos := int(b[0]) % (len(supported) + 1)
 	greased := make([]VersionNumber, len(supported)+1)
 	copy(greased, supported[:randPos])
@@ -13,10 +13,20 @@ import (
 // TODO: use the value sent in the transport parameters
 const ackDelayExponent = 3
 
+// the type bytes of the ACK frame, and of the ACK frame carrying ECN counts
+const (
+	ackFrameType    = 0xd
+	ackECNFrameType = 0x22
+)
+
 // An AckFrame is an ACK frame
 type AckFrame struct {
 	AckRanges []AckRange // has to be ordered. The highest ACK range goes first, the lowest ACK range goes last
 	DelayTime time.Duration
+
+	// the number of packets received with the respective ECN codepoint
+	// ECN counts are only sent in IETF QUIC, and only if one of them is non-zero
+	ECT0, ECT1, ECNCE uint64
 }
 
 // parseAckFrame reads an ACK frame
@@ -25,7 +35,8 @@ func parseAckFrame(r *bytes.Reader, version protocol.VersionNumber) (*AckFrame,
 		return parseAckFrameLegacy(r, version)
 	}
 
-	if _, err := r.ReadByte(); err != nil {
+	typeByte, err := r.ReadByte()
+	if err != nil {
 		return nil, err
 	}
 
@@ -57,6 +68,9 @@ func parseAckFrame(r *bytes.Reader, version protocol.VersionNumber) (*AckFrame,
 	}
 	smallest := largestAcked - ackBlock
 
+	// Allocate all ACK ranges at once.
+	// Every ACK range takes at least 2 bytes, so numBlocks can't be larger than half the remaining length.
+	frame.AckRanges = make([]AckRange, 0, 1+utils.MinUint64(numBlocks, uint64(r.Len()/2)))
 	// read all the other ACK ranges
 	frame.AckRanges = append(frame.AckRanges, AckRange{Smallest: smallest, Largest: largestAcked})
 	for i := uint64(0); i < numBlocks; i++ {
@@ -86,6 +100,18 @@ func parseAckFrame(r *bytes.Reader, version protocol.VersionNumber) (*AckFrame,
 	if !frame.validateAckRanges() {
 		return nil, errInvalidAckRanges
 	}
+
+	if typeByte == ackECNFrameType {
+		if frame.ECT0, err = utils.ReadVarInt(r); err != nil {
+			return nil, err
+		}
+		if frame.ECT1, err = utils.ReadVarInt(r); err != nil {
+			return nil, err
+		}
+		if frame.ECNCE, err = utils.ReadVarInt(r); err != nil {
+			return nil, err
+		}
+	}
 	return frame, nil
 }
 
@@ -95,7 +121,11 @@ func (f *AckFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error
 		return f.writeLegacy(b, version)
 	}
 
-	b.WriteByte(0x0d)
+	if f.HasECN() {
+		b.WriteByte(ackECNFrameType)
+	} else {
+		b.WriteByte(ackFrameType)
+	}
 	utils.WriteVarInt(b, uint64(f.LargestAcked()))
 	utils.WriteVarInt(b, encodeAckDelay(f.DelayTime))
 
@@ -112,6 +142,12 @@ func (f *AckFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error
 		utils.WriteVarInt(b, gap)
 		utils.WriteVarInt(b, len)
 	}
+
+	if f.HasECN() {
+		utils.WriteVarInt(b, f.ECT0)
+		utils.WriteVarInt(b, f.ECT1)
+		utils.WriteVarInt(b, f.ECNCE)
+	}
 	return nil
 }
 
@@ -135,13 +171,21 @@ func (f *AckFrame) Length(version protocol.VersionNumber) protocol.ByteCount {
 		length += utils.VarIntLen(gap)
 		length += utils.VarIntLen(len)
 	}
-	return length
+	return length + f.ecnLength()
+}
+
+// the length of the ECN counts
+func (f *AckFrame) ecnLength() protocol.ByteCount {
+	if !f.HasECN() {
+		return 0
+	}
+	return utils.VarIntLen(f.ECT0) + utils.VarIntLen(f.ECT1) + utils.VarIntLen(f.ECNCE)
 }
 
 // gets the number of ACK ranges that can be encoded
 // such that the resulting frame is smaller than the maximum ACK frame size
 func (f *AckFrame) numEncodableAckRanges() int {
-	length := 1 + utils.VarIntLen(uint64(f.LargestAcked())) + utils.VarIntLen(encodeAckDelay(f.DelayTime))
+	length := 1 + utils.VarIntLen(uint64(f.LargestAcked())) + utils.VarIntLen(encodeAckDelay(f.DelayTime)) + f.ecnLength()
 	length += 2 // assume that the number of ranges will consume 2 bytes
 	for i := 1; i < len(f.AckRanges); i++ {
 		gap, len := f.encodeAckRange(i)
@@ -164,6 +208,11 @@ func (f *AckFrame) encodeAckRange(i int) (uint64 /* gap */, uint64 /* length */)
 		uint64(f.AckRanges[i].Largest - f.AckRanges[i].Smallest)
 }
 
+// HasECN says if this frame reports ECN counts
+func (f *AckFrame) HasECN() bool {
+	return f.ECT0 > 0 || f.ECT1 > 0 || f.ECNCE > 0
+}
+
 // HasMissingRanges returns if this frame reports any missing packets
 func (f *AckFrame) HasMissingRanges() bool {
 	return len(f.AckRanges) > 1
@@ -68,6 +68,7 @@ func parseAckFrameLegacy(r *bytes.Reader, _ protocol.VersionNumber) (*AckFrame,
 	}
 
 	if hasMissingRanges {
+		frame.AckRanges = make([]AckRange, 0, int(numAckBlocks)+1)
 		ackRange := AckRange{
 			Smallest: largestAcked - ackBlockLength + 1,
 			Largest:  largestAcked,
@@ -308,11 +309,19 @@ func (f *AckFrame) lengthLegacy(_ protocol.VersionNumber) protocol.ByteCount {
 
 // numWritableNackRanges calculates the number of ACK blocks that are about to be written
 // this number is different from len(f.AckRanges) for the case of long gaps (> 255 packets)
+// It is limited such that the ACK frame doesn't exceed the MaxAckFrameSize.
 func (f *AckFrame) numWritableNackRanges() uint64 {
 	if len(f.AckRanges) == 0 {
 		return 0
 	}
 
+	// every ACK block (including the first one) consumes 1 byte for the gap (or the number of blocks) and the length
+	blockLen := 1 + protocol.ByteCount(f.getMissingSequenceNumberDeltaLen())
+	maxNumRanges := uint64((protocol.MaxAckFrameSize - 1 - 2 - 1 - protocol.ByteCount(protocol.GetPacketNumberLength(f.LargestAcked()))) / blockLen)
+	if maxNumRanges > 0xFF {
+		maxNumRanges = 0xFF
+	}
+
 	var numRanges uint64
 	for i, ackRange := range f.AckRanges {
 		if i == 0 {
@@ -326,7 +335,7 @@ func (f *AckFrame) numWritableNackRanges() uint64 {
 			rangeLength--
 		}
 
-		if numRanges+rangeLength < 0xFF {
+		if numRanges+rangeLength < maxNumRanges {
 			numRanges += rangeLength
 		} else {
 			break
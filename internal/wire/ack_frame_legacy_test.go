@@ -3,6 +3,7 @@ package wire
 import (
 	"bytes"
 	"io"
+	"testing"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -297,6 +298,27 @@ var _ = Describe("ACK Frame (for gQUIC)", func() {
 				Expect(b.Len()).To(BeZero())
 			})
 
+			It("only allocates the frame and the ACK ranges", func() {
+				data := []byte{0x60,
+					0x52,      // largest acked
+					0xd1, 0x0, //delay time
+					0x3,       // num ACK blocks
+					0x17,      // 1st block
+					0xa, 0x10, // 2nd block
+					0x4, 0x8, // 3rd block
+					0x2, 0x12, // 4th block
+					0,
+				}
+				b := bytes.NewReader(nil)
+				allocs := testing.AllocsPerRun(100, func() {
+					b.Reset(data)
+					if _, err := parseAckFrame(b, versionBigEndian); err != nil {
+						Fail(err.Error())
+					}
+				})
+				Expect(allocs).To(BeEquivalentTo(2))
+			})
+
 			Context("more than 256 lost packets in a row", func() {
 				// 255 missing packets fit into a single ACK block
 				It("parses a frame with a range of 255 missing packets", func() {
@@ -962,6 +984,27 @@ var _ = Describe("ACK Frame (for gQUIC)", func() {
 					Expect(frame.validateAckRanges()).To(BeTrue())
 				})
 
+				It("skips the lowest ACK ranges, if the frame would exceed the MaxAckFrameSize", func() {
+					ackRanges := make([]AckRange, 300)
+					// every ACK range needs a 4 byte length
+					for i := 1; i <= 300; i++ {
+						ackRanges[300-i] = AckRange{Smallest: protocol.PacketNumber(100000 * i), Largest: protocol.PacketNumber(100000*i + 99990)}
+					}
+					frameOrig := &AckFrame{AckRanges: ackRanges}
+					err := frameOrig.Write(b, versionBigEndian)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(frameOrig.Length(versionBigEndian)).To(BeEquivalentTo(b.Len()))
+					Expect(b.Len()).To(BeNumerically("<=", protocol.MaxAckFrameSize))
+					Expect(b.Len()).To(BeNumerically(">", protocol.MaxAckFrameSize-5))
+					r := bytes.NewReader(b.Bytes())
+					frame, err := parseAckFrame(r, versionBigEndian)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(frame.LargestAcked()).To(Equal(frameOrig.LargestAcked()))
+					Expect(len(frame.AckRanges)).To(BeNumerically("<", 0xFF))
+					Expect(frame.LowestAcked()).To(Equal(ackRanges[len(frame.AckRanges)-1].Smallest))
+					Expect(frame.validateAckRanges()).To(BeTrue())
+				})
+
 				It("works with huge gaps", func() {
 					ackRanges := []AckRange{
 						{Smallest: 2 * 255 * 200, Largest: 2*255*200 + 1},
@@ -3,6 +3,7 @@ package wire
 import (
 	"bytes"
 	"io"
+	"testing"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -111,6 +112,64 @@ var _ = Describe("ACK Frame (for IETF QUIC)", func() {
 				{Largest: 95, Smallest: 94},
 			}))
 			Expect(b.Len()).To(BeZero())
+			// parsing only allocates the frame and the ACK ranges
+			allocs := testing.AllocsPerRun(100, func() {
+				b.Reset(data)
+				if _, err := parseAckFrame(b, versionIETFFrames); err != nil {
+					Fail(err.Error())
+				}
+			})
+			Expect(allocs).To(BeEquivalentTo(2))
+		})
+
+		It("parses an ACK frame with ECN counts", func() {
+			data := []byte{0x22}
+			data = append(data, encodeVarInt(100)...) // largest acked
+			data = append(data, encodeVarInt(0)...)   // delay
+			data = append(data, encodeVarInt(0)...)   // num blocks
+			data = append(data, encodeVarInt(10)...)  // first ack block
+			data = append(data, encodeVarInt(42)...)  // ECT(0)
+			data = append(data, encodeVarInt(1)...)   // ECT(1)
+			data = append(data, encodeVarInt(7)...)   // CE
+			b := bytes.NewReader(data)
+			frame, err := parseAckFrame(b, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.LargestAcked()).To(Equal(protocol.PacketNumber(100)))
+			Expect(frame.LowestAcked()).To(Equal(protocol.PacketNumber(90)))
+			Expect(frame.HasECN()).To(BeTrue())
+			Expect(frame.ECT0).To(BeEquivalentTo(42))
+			Expect(frame.ECT1).To(BeEquivalentTo(1))
+			Expect(frame.ECNCE).To(BeEquivalentTo(7))
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("errors on EOF when parsing ECN counts", func() {
+			data := []byte{0x22}
+			data = append(data, encodeVarInt(100)...) // largest acked
+			data = append(data, encodeVarInt(0)...)   // delay
+			data = append(data, encodeVarInt(0)...)   // num blocks
+			data = append(data, encodeVarInt(10)...)  // first ack block
+			data = append(data, encodeVarInt(42)...)  // ECT(0)
+			data = append(data, encodeVarInt(1)...)   // ECT(1)
+			data = append(data, encodeVarInt(7)...)   // CE
+			_, err := parseAckFrame(bytes.NewReader(data), versionIETFFrames)
+			Expect(err).NotTo(HaveOccurred())
+			for i := range data {
+				_, err := parseAckFrame(bytes.NewReader(data[0:i]), versionIETFFrames)
+				Expect(err).To(MatchError(io.EOF))
+			}
+		})
+
+		It("errors when the number of blocks is larger than the frame", func() {
+			data := []byte{0xd}
+			data = append(data, encodeVarInt(100)...)   // largest acked
+			data = append(data, encodeVarInt(0)...)     // delay
+			data = append(data, encodeVarInt(1<<40)...) // num blocks
+			data = append(data, encodeVarInt(0)...)     // first ack block
+			data = append(data, encodeVarInt(0)...)     // gap
+			data = append(data, encodeVarInt(0)...)     // ack block
+			_, err := parseAckFrame(bytes.NewReader(data), versionIETFFrames)
+			Expect(err).To(MatchError(io.EOF))
 		})
 
 		It("errors on EOF", func() {
@@ -146,6 +205,24 @@ var _ = Describe("ACK Frame (for IETF QUIC)", func() {
 			Expect(buf.Bytes()).To(Equal(expected))
 		})
 
+		It("writes a frame with ECN counts", func() {
+			buf := &bytes.Buffer{}
+			f := &AckFrame{
+				AckRanges: []AckRange{{Smallest: 100, Largest: 1337}},
+				ECT0:      1000,
+				ECNCE:     3,
+			}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.Bytes()[0]).To(Equal(byte(0x22)))
+			Expect(f.Length(versionIETFFrames)).To(BeEquivalentTo(buf.Len()))
+			b := bytes.NewReader(buf.Bytes())
+			frame, err := parseAckFrame(b, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+			Expect(b.Len()).To(BeZero())
+		})
+
 		It("writes a frame that acks a single packet", func() {
 			buf := &bytes.Buffer{}
 			f := &AckFrame{
@@ -0,0 +1,85 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+const ackFrequencyFrameType = 0x23
+
+// An AckFrequencyFrame is an ACK_FREQUENCY frame.
+// It asks the peer to change how often it sends ACKs (see draft-iyengar-quic-delayed-ack).
+// It can only be sent to peers that announced support for the ACK frequency extension.
+// Like the RETIRE_CONNECTION_ID frame, it uses a frame type that is unused both by gQUIC and by IETF QUIC.
+type AckFrequencyFrame struct {
+	// SequenceNumber allows the receiver to ignore reordered ACK_FREQUENCY frames.
+	SequenceNumber uint64
+	// PacketTolerance is the number of retransmittable packets the peer receives before sending an ACK.
+	PacketTolerance uint64
+	// MaxAckDelay is the maximum time the peer delays an ACK.
+	MaxAckDelay time.Duration
+	// IgnoreOrder says if the peer should not send an ACK immediately when receiving packets out of order.
+	IgnoreOrder bool
+}
+
+func parseAckFrequencyFrame(r *bytes.Reader, _ protocol.VersionNumber) (*AckFrequencyFrame, error) {
+	if _, err := r.ReadByte(); err != nil {
+		return nil, err
+	}
+
+	seq, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	tolerance, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if tolerance == 0 {
+		return nil, errors.New("invalid packet tolerance 0")
+	}
+	delay, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	// Also prevents the conversion to a time.Duration from overflowing.
+	if delay > uint64(protocol.MaxAckFrequencyDelay/time.Microsecond) {
+		return nil, fmt.Errorf("invalid Max Ack Delay %dus", delay)
+	}
+	ignoreOrder, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if ignoreOrder > 1 {
+		return nil, errors.New("invalid value for Ignore Order")
+	}
+	return &AckFrequencyFrame{
+		SequenceNumber:  seq,
+		PacketTolerance: tolerance,
+		MaxAckDelay:     time.Duration(delay) * time.Microsecond,
+		IgnoreOrder:     ignoreOrder == 1,
+	}, nil
+}
+
+func (f *AckFrequencyFrame) Write(b *bytes.Buffer, _ protocol.VersionNumber) error {
+	b.WriteByte(ackFrequencyFrameType)
+	utils.WriteVarInt(b, f.SequenceNumber)
+	utils.WriteVarInt(b, f.PacketTolerance)
+	utils.WriteVarInt(b, uint64(f.MaxAckDelay/time.Microsecond))
+	if f.IgnoreOrder {
+		b.WriteByte(1)
+	} else {
+		b.WriteByte(0)
+	}
+	return nil
+}
+
+// Length of a written frame
+func (f *AckFrequencyFrame) Length(_ protocol.VersionNumber) protocol.ByteCount {
+	return 1 + utils.VarIntLen(f.SequenceNumber) + utils.VarIntLen(f.PacketTolerance) + utils.VarIntLen(uint64(f.MaxAckDelay/time.Microsecond)) + 1
+}
@@ -0,0 +1,122 @@
+package wire
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ACK_FREQUENCY frame", func() {
+	Context("when parsing", func() {
+		It("accepts a sample frame", func() {
+			data := []byte{0x23}
+			data = append(data, encodeVarInt(0xdeadbeef)...) // sequence number
+			data = append(data, encodeVarInt(0x42)...)       // packet tolerance
+			data = append(data, encodeVarInt(12345)...)      // max ack delay
+			data = append(data, 0x1)                         // ignore order
+			b := bytes.NewReader(data)
+			frame, err := parseAckFrequencyFrame(b, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.SequenceNumber).To(Equal(uint64(0xdeadbeef)))
+			Expect(frame.PacketTolerance).To(Equal(uint64(0x42)))
+			Expect(frame.MaxAckDelay).To(Equal(12345 * time.Microsecond))
+			Expect(frame.IgnoreOrder).To(BeTrue())
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("errors on a packet tolerance of 0", func() {
+			data := []byte{0x23}
+			data = append(data, encodeVarInt(1)...) // sequence number
+			data = append(data, encodeVarInt(0)...) // packet tolerance
+			data = append(data, encodeVarInt(1000)...)
+			data = append(data, 0x0)
+			_, err := parseAckFrequencyFrame(bytes.NewReader(data), versionIETFFrames)
+			Expect(err).To(MatchError("invalid packet tolerance 0"))
+		})
+
+		It("errors on a too large Max Ack Delay", func() {
+			data := []byte{0x23}
+			data = append(data, encodeVarInt(1)...) // sequence number
+			data = append(data, encodeVarInt(2)...) // packet tolerance
+			data = append(data, encodeVarInt(1<<14*1000+1)...)
+			data = append(data, 0x0)
+			_, err := parseAckFrequencyFrame(bytes.NewReader(data), versionIETFFrames)
+			Expect(err).To(MatchError("invalid Max Ack Delay 16384001us"))
+			data = []byte{0x23}
+			data = append(data, encodeVarInt(1)...)
+			data = append(data, encodeVarInt(2)...)
+			data = append(data, encodeVarInt(1<<14*1000)...)
+			data = append(data, 0x0)
+			frame, err := parseAckFrequencyFrame(bytes.NewReader(data), versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.MaxAckDelay).To(Equal(16384 * time.Millisecond))
+		})
+
+		It("errors on invalid values for Ignore Order", func() {
+			data := []byte{0x23}
+			data = append(data, encodeVarInt(1)...) // sequence number
+			data = append(data, encodeVarInt(2)...) // packet tolerance
+			data = append(data, encodeVarInt(1000)...)
+			data = append(data, 0x2)
+			_, err := parseAckFrequencyFrame(bytes.NewReader(data), versionIETFFrames)
+			Expect(err).To(MatchError("invalid value for Ignore Order"))
+		})
+
+		It("errors on EOFs", func() {
+			data := []byte{0x23}
+			data = append(data, encodeVarInt(0xdeadbeef)...) // sequence number
+			data = append(data, encodeVarInt(0x42)...)       // packet tolerance
+			data = append(data, encodeVarInt(12345)...)      // max ack delay
+			data = append(data, 0x0)                         // ignore order
+			_, err := parseAckFrequencyFrame(bytes.NewReader(data), versionIETFFrames)
+			Expect(err).NotTo(HaveOccurred())
+			for i := range data {
+				_, err := parseAckFrequencyFrame(bytes.NewReader(data[0:i]), versionIETFFrames)
+				Expect(err).To(MatchError(io.EOF))
+			}
+		})
+	})
+
+	Context("when writing", func() {
+		It("writes a sample frame", func() {
+			frame := &AckFrequencyFrame{
+				SequenceNumber:  0x1337,
+				PacketTolerance: 10,
+				MaxAckDelay:     25 * time.Millisecond,
+			}
+			b := &bytes.Buffer{}
+			Expect(frame.Write(b, versionIETFFrames)).To(Succeed())
+			expected := []byte{0x23}
+			expected = append(expected, encodeVarInt(0x1337)...)
+			expected = append(expected, encodeVarInt(10)...)
+			expected = append(expected, encodeVarInt(25000)...)
+			expected = append(expected, 0x0)
+			Expect(b.Bytes()).To(Equal(expected))
+		})
+
+		It("writes the Ignore Order flag", func() {
+			frame := &AckFrequencyFrame{
+				SequenceNumber:  1,
+				PacketTolerance: 2,
+				IgnoreOrder:     true,
+			}
+			b := &bytes.Buffer{}
+			Expect(frame.Write(b, versionIETFFrames)).To(Succeed())
+			Expect(b.Bytes()[b.Len()-1]).To(Equal(byte(0x1)))
+		})
+
+		It("has the correct length", func() {
+			frame := &AckFrequencyFrame{
+				SequenceNumber:  0xdecafbad,
+				PacketTolerance: 1000,
+				MaxAckDelay:     time.Second,
+			}
+			b := &bytes.Buffer{}
+			Expect(frame.Write(b, versionIETFFrames)).To(Succeed())
+			Expect(frame.Length(versionIETFFrames)).To(BeEquivalentTo(b.Len()))
+		})
+	})
+})
@@ -12,14 +12,17 @@ import (
 )
 
 // A ConnectionCloseFrame in QUIC
+// For IETF QUIC, it is also used for the APPLICATION_CLOSE frame, which carries an application-defined error code.
 type ConnectionCloseFrame struct {
-	ErrorCode    qerr.ErrorCode
-	ReasonPhrase string
+	IsApplicationError bool
+	ErrorCode          qerr.ErrorCode
+	ReasonPhrase       string
 }
 
-// parseConnectionCloseFrame reads a CONNECTION_CLOSE frame
+// parseConnectionCloseFrame reads a CONNECTION_CLOSE or an APPLICATION_CLOSE frame
 func parseConnectionCloseFrame(r *bytes.Reader, version protocol.VersionNumber) (*ConnectionCloseFrame, error) {
-	if _, err := r.ReadByte(); err != nil { // read the TypeByte
+	typeByte, err := r.ReadByte()
+	if err != nil {
 		return nil, err
 	}
 
@@ -62,8 +65,9 @@ func parseConnectionCloseFrame(r *bytes.Reader, version protocol.VersionNumber)
 	}
 
 	return &ConnectionCloseFrame{
-		ErrorCode:    errorCode,
-		ReasonPhrase: string(reasonPhrase),
+		IsApplicationError: version.UsesIETFFrameFormat() && typeByte == 0x3,
+		ErrorCode:          errorCode,
+		ReasonPhrase:       string(reasonPhrase),
 	}, nil
 }
 
@@ -75,13 +79,20 @@ func (f *ConnectionCloseFrame) Length(version protocol.VersionNumber) protocol.B
 	return 1 + 4 + 2 + protocol.ByteCount(len(f.ReasonPhrase))
 }
 
-// Write writes an CONNECTION_CLOSE frame.
+// Write writes an CONNECTION_CLOSE or an APPLICATION_CLOSE frame.
 func (f *ConnectionCloseFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error {
-	b.WriteByte(0x02)
-
 	if len(f.ReasonPhrase) > math.MaxUint16 {
 		return errors.New("ConnectionFrame: ReasonPhrase too long")
 	}
+	if f.IsApplicationError && !version.UsesIETFFrameFormat() {
+		return errors.New("ConnectionFrame: APPLICATION_CLOSE frames only exist in IETF QUIC")
+	}
+
+	if f.IsApplicationError {
+		b.WriteByte(0x03)
+	} else {
+		b.WriteByte(0x02)
+	}
 
 	if version.UsesIETFFrameFormat() {
 		utils.BigEndian.WriteUint16(b, uint16(f.ErrorCode))
@@ -22,12 +22,26 @@ var _ = Describe("CONNECTION_CLOSE Frame", func() {
 				b := bytes.NewReader(data)
 				frame, err := parseConnectionCloseFrame(b, versionIETFFrames)
 				Expect(err).ToNot(HaveOccurred())
+				Expect(frame.IsApplicationError).To(BeFalse())
 				Expect(frame.ErrorCode).To(Equal(qerr.ErrorCode(0x19)))
 				Expect(frame.ReasonPhrase).To(Equal("No recent network activity."))
 				Expect(b.Len()).To(BeZero())
 			})
 
-			It("rejects long reason phrases", func() {
+			It("accepts an APPLICATION_CLOSE frame", func() {
+				data := []byte{0x3, 0x13, 0x37}
+				data = append(data, encodeVarInt(6)...) // reason phrase length
+				data = append(data, []byte("foobar")...)
+				b := bytes.NewReader(data)
+				frame, err := parseConnectionCloseFrame(b, versionIETFFrames)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frame.IsApplicationError).To(BeTrue())
+				Expect(frame.ErrorCode).To(Equal(qerr.ErrorCode(0x1337)))
+				Expect(frame.ReasonPhrase).To(Equal("foobar"))
+				Expect(b.Len()).To(BeZero())
+			})
+
+			It("errors if the reason phrase is longer than the frame", func() {
 				data := []byte{0x2, 0xca, 0xfe}
 				data = append(data, encodeVarInt(0xffff)...) // reason phrase length
 				b := bytes.NewReader(data)
@@ -35,6 +49,15 @@ var _ = Describe("CONNECTION_CLOSE Frame", func() {
 				Expect(err).To(MatchError(io.EOF))
 			})
 
+			It("accepts long reason phrases", func() {
+				data := []byte{0x2, 0xca, 0xfe}
+				data = append(data, encodeVarInt(2000)...) // reason phrase length
+				data = append(data, bytes.Repeat([]byte{'a'}, 2000)...)
+				frame, err := parseConnectionCloseFrame(bytes.NewReader(data), versionIETFFrames)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frame.ReasonPhrase).To(HaveLen(2000))
+			})
+
 			It("errors on EOFs", func() {
 				data := []byte{0x2, 0x0, 0x19}
 				data = append(data, encodeVarInt(0x1b)...) // reason phrase length
@@ -74,7 +97,7 @@ var _ = Describe("CONNECTION_CLOSE Frame", func() {
 				Expect(b.Len()).To(BeZero())
 			})
 
-			It("rejects long reason phrases", func() {
+			It("errors if the reason phrase is longer than the frame", func() {
 				b := bytes.NewReader([]byte{0x2,
 					0xad, 0xfb, 0xca, 0xde, // error code
 					0xff, 0x0, // reason phrase length
@@ -138,6 +161,22 @@ var _ = Describe("CONNECTION_CLOSE Frame", func() {
 				Expect(b.Bytes()).To(Equal(expected))
 			})
 
+			It("writes an APPLICATION_CLOSE frame", func() {
+				b := &bytes.Buffer{}
+				frame := &ConnectionCloseFrame{
+					IsApplicationError: true,
+					ErrorCode:          0x1337,
+					ReasonPhrase:       "foobar",
+				}
+				err := frame.Write(b, versionIETFFrames)
+				Expect(err).ToNot(HaveOccurred())
+				expected := []byte{0x3, 0x13, 0x37}
+				expected = append(expected, encodeVarInt(6)...)
+				expected = append(expected, []byte{'f', 'o', 'o', 'b', 'a', 'r'}...)
+				Expect(b.Bytes()).To(Equal(expected))
+				Expect(frame.Length(versionIETFFrames)).To(Equal(protocol.ByteCount(b.Len())))
+			})
+
 			It("has proper min length", func() {
 				b := &bytes.Buffer{}
 				f := &ConnectionCloseFrame{
@@ -181,6 +220,15 @@ var _ = Describe("CONNECTION_CLOSE Frame", func() {
 				}))
 			})
 
+			It("refuses to write an APPLICATION_CLOSE frame", func() {
+				frame := &ConnectionCloseFrame{
+					IsApplicationError: true,
+					ErrorCode:          0x1337,
+				}
+				err := frame.Write(&bytes.Buffer{}, versionBigEndian)
+				Expect(err).To(MatchError("ConnectionFrame: APPLICATION_CLOSE frames only exist in IETF QUIC"))
+			})
+
 			It("has proper min length", func() {
 				b := &bytes.Buffer{}
 				f := &ConnectionCloseFrame{
@@ -0,0 +1,68 @@
+package wire
+
+import (
+	"bytes"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// An ExpiredStreamDataFrame is sent by a partially reliable stream.
+// It tells the receiver that data below the offset won't be retransmitted, and should be skipped.
+// It is not part of gQUIC or IETF QUIC, and can only be sent to peers that support partial reliability.
+type ExpiredStreamDataFrame struct {
+	StreamID protocol.StreamID
+	Offset   protocol.ByteCount
+}
+
+// parseExpiredStreamDataFrame parses an EXPIRED_STREAM_DATA frame
+func parseExpiredStreamDataFrame(r *bytes.Reader, version protocol.VersionNumber) (*ExpiredStreamDataFrame, error) {
+	if _, err := r.ReadByte(); err != nil { // read the TypeByte
+		return nil, err
+	}
+
+	var streamID, offset uint64
+	if version.UsesIETFFrameFormat() {
+		var err error
+		if streamID, err = utils.ReadVarInt(r); err != nil {
+			return nil, err
+		}
+		if offset, err = utils.ReadVarInt(r); err != nil {
+			return nil, err
+		}
+	} else {
+		sid, err := utils.BigEndian.ReadUint32(r)
+		if err != nil {
+			return nil, err
+		}
+		streamID = uint64(sid)
+		if offset, err = utils.BigEndian.ReadUint64(r); err != nil {
+			return nil, err
+		}
+	}
+	return &ExpiredStreamDataFrame{
+		StreamID: protocol.StreamID(streamID),
+		Offset:   protocol.ByteCount(offset),
+	}, nil
+}
+
+// Write writes an EXPIRED_STREAM_DATA frame
+func (f *ExpiredStreamDataFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error {
+	b.WriteByte(0x20)
+	if version.UsesIETFFrameFormat() {
+		utils.WriteVarInt(b, uint64(f.StreamID))
+		utils.WriteVarInt(b, uint64(f.Offset))
+	} else {
+		utils.BigEndian.WriteUint32(b, uint32(f.StreamID))
+		utils.BigEndian.WriteUint64(b, uint64(f.Offset))
+	}
+	return nil
+}
+
+// Length of a written frame
+func (f *ExpiredStreamDataFrame) Length(version protocol.VersionNumber) protocol.ByteCount {
+	if !version.UsesIETFFrameFormat() {
+		return 1 + 4 + 8
+	}
+	return 1 + utils.VarIntLen(uint64(f.StreamID)) + utils.VarIntLen(uint64(f.Offset))
+}
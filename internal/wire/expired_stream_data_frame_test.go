@@ -0,0 +1,83 @@
+package wire
+
+import (
+	"bytes"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EXPIRED_STREAM_DATA frame", func() {
+	Context("when parsing", func() {
+		It("accepts sample frame, for IETF QUIC", func() {
+			data := []byte{0x20}
+			data = append(data, encodeVarInt(0xdeadbeef)...) // Stream ID
+			data = append(data, encodeVarInt(0x12345678)...) // Offset
+			b := bytes.NewReader(data)
+			frame, err := parseExpiredStreamDataFrame(b, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.StreamID).To(Equal(protocol.StreamID(0xdeadbeef)))
+			Expect(frame.Offset).To(Equal(protocol.ByteCount(0x12345678)))
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("accepts sample frame, for gQUIC", func() {
+			b := bytes.NewReader([]byte{0x20,
+				0xde, 0xad, 0xbe, 0xef, // Stream ID
+				0x0, 0x0, 0x0, 0x0, 0x12, 0x34, 0x56, 0x78, // Offset
+			})
+			frame, err := parseExpiredStreamDataFrame(b, versionBigEndian)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.StreamID).To(Equal(protocol.StreamID(0xdeadbeef)))
+			Expect(frame.Offset).To(Equal(protocol.ByteCount(0x12345678)))
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("errors on EOFs", func() {
+			for _, v := range []protocol.VersionNumber{versionIETFFrames, versionBigEndian} {
+				b := &bytes.Buffer{}
+				f := &ExpiredStreamDataFrame{StreamID: 0xdeadbeef, Offset: 0x12345678}
+				Expect(f.Write(b, v)).To(Succeed())
+				data := b.Bytes()
+				_, err := parseExpiredStreamDataFrame(bytes.NewReader(data), v)
+				Expect(err).NotTo(HaveOccurred())
+				for i := range data {
+					_, err := parseExpiredStreamDataFrame(bytes.NewReader(data[0:i]), v)
+					Expect(err).To(HaveOccurred())
+				}
+			}
+		})
+	})
+
+	Context("when writing", func() {
+		It("writes a sample frame, for IETF QUIC", func() {
+			b := &bytes.Buffer{}
+			f := &ExpiredStreamDataFrame{
+				StreamID: 0xdecafbad,
+				Offset:   0xdeadbeefcafe42,
+			}
+			expected := []byte{0x20}
+			expected = append(expected, encodeVarInt(0xdecafbad)...)
+			expected = append(expected, encodeVarInt(0xdeadbeefcafe42)...)
+			Expect(f.Write(b, versionIETFFrames)).To(Succeed())
+			Expect(b.Bytes()).To(Equal(expected))
+			Expect(f.Length(versionIETFFrames)).To(Equal(1 + utils.VarIntLen(0xdecafbad) + utils.VarIntLen(0xdeadbeefcafe42)))
+		})
+
+		It("writes a sample frame, for gQUIC", func() {
+			b := &bytes.Buffer{}
+			f := &ExpiredStreamDataFrame{
+				StreamID: 0xdecafbad,
+				Offset:   0xdeadbeefcafe42,
+			}
+			Expect(f.Write(b, versionBigEndian)).To(Succeed())
+			Expect(b.Bytes()).To(Equal([]byte{0x20,
+				0xde, 0xca, 0xfb, 0xad,
+				0x0, 0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x42,
+			}))
+			Expect(f.Length(versionBigEndian)).To(Equal(protocol.ByteCount(b.Len())))
+		})
+	})
+})
@@ -0,0 +1,66 @@
+package wire
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+const (
+	// MinExtensionFrameType is the smallest frame type that can be used for extension frames.
+	MinExtensionFrameType byte = 0x18
+	// MaxExtensionFrameType is the largest frame type that can be used for extension frames.
+	// The range from MinExtensionFrameType to MaxExtensionFrameType is unused both by gQUIC and by IETF QUIC.
+	MaxExtensionFrameType byte = 0x1f
+)
+
+// IsExtensionFrameType says if a frame type can be used for extension frames.
+func IsExtensionFrameType(typeByte byte) bool {
+	return typeByte >= MinExtensionFrameType && typeByte <= MaxExtensionFrameType
+}
+
+// An ExtensionFrame is a frame that is not defined by QUIC, but used by an experimental extension.
+// The payload is length-prefixed, such that the frame can be parsed without knowing the extension.
+type ExtensionFrame struct {
+	FrameType byte
+	Data      []byte
+}
+
+func parseExtensionFrame(r *bytes.Reader, _ protocol.VersionNumber) (*ExtensionFrame, error) {
+	typeByte, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	dataLen, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	// shortcut to prevent the unnecessary allocation of dataLen bytes
+	// if the dataLen is larger than the remaining length of the packet
+	if dataLen > uint64(r.Len()) {
+		return nil, io.EOF
+	}
+	frame := &ExtensionFrame{
+		FrameType: typeByte,
+		Data:      make([]byte, dataLen),
+	}
+	if _, err := io.ReadFull(r, frame.Data); err != nil {
+		// this should never happen, since we already checked the dataLen earlier
+		return nil, err
+	}
+	return frame, nil
+}
+
+func (f *ExtensionFrame) Write(b *bytes.Buffer, _ protocol.VersionNumber) error {
+	b.WriteByte(f.FrameType)
+	utils.WriteVarInt(b, uint64(len(f.Data)))
+	b.Write(f.Data)
+	return nil
+}
+
+// Length of a written frame
+func (f *ExtensionFrame) Length(_ protocol.VersionNumber) protocol.ByteCount {
+	return 1 + utils.VarIntLen(uint64(len(f.Data))) + protocol.ByteCount(len(f.Data))
+}
@@ -0,0 +1,64 @@
+package wire
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("extension frame", func() {
+	It("recognizes extension frame types", func() {
+		Expect(IsExtensionFrameType(0x17)).To(BeFalse())
+		Expect(IsExtensionFrameType(0x18)).To(BeTrue())
+		Expect(IsExtensionFrameType(0x1f)).To(BeTrue())
+		Expect(IsExtensionFrameType(0x20)).To(BeFalse())
+	})
+
+	Context("when parsing", func() {
+		It("accepts sample frame", func() {
+			b := bytes.NewReader([]byte{0x19, 0x3, 'f', 'o', 'o'})
+			f, err := parseExtensionFrame(b, protocol.VersionWhatever)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b.Len()).To(BeZero())
+			Expect(f.FrameType).To(Equal(byte(0x19)))
+			Expect(f.Data).To(Equal([]byte("foo")))
+		})
+
+		It("accepts frames without data", func() {
+			b := bytes.NewReader([]byte{0x19, 0x0})
+			f, err := parseExtensionFrame(b, protocol.VersionWhatever)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b.Len()).To(BeZero())
+			Expect(f.Data).To(BeEmpty())
+		})
+
+		It("errors on EOFs", func() {
+			data := []byte{0x19, 0x3, 'f', 'o', 'o'}
+			_, err := parseExtensionFrame(bytes.NewReader(data), protocol.VersionWhatever)
+			Expect(err).NotTo(HaveOccurred())
+			for i := range data {
+				_, err := parseExtensionFrame(bytes.NewReader(data[0:i]), protocol.VersionWhatever)
+				Expect(err).To(MatchError(io.EOF))
+			}
+		})
+	})
+
+	Context("when writing", func() {
+		It("writes a sample frame", func() {
+			b := &bytes.Buffer{}
+			frame := ExtensionFrame{FrameType: 0x1a, Data: []byte("foobar")}
+			err := frame.Write(b, protocol.VersionWhatever)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b.Bytes()).To(Equal([]byte{0x1a, 0x6, 'f', 'o', 'o', 'b', 'a', 'r'}))
+		})
+
+		It("has the correct length", func() {
+			frame := ExtensionFrame{FrameType: 0x1a, Data: make([]byte, 1000)}
+			Expect(frame.Length(protocol.VersionWhatever)).To(Equal(1 + utils.VarIntLen(1000) + 1000))
+		})
+	})
+})
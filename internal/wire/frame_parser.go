@@ -8,8 +8,19 @@ import (
 	"github.com/lucas-clemente/quic-go/qerr"
 )
 
+// An UnknownFrameTypeError is returned when parsing a frame of an unknown type.
+// Since the length of the frame is unknown, the rest of the packet can't be parsed.
+type UnknownFrameTypeError struct {
+	FrameType byte
+}
+
+func (e *UnknownFrameTypeError) Error() string {
+	return fmt.Sprintf("unknown type byte 0x%x", e.FrameType)
+}
+
 // ParseNextFrame parses the next frame
 // It skips PADDING frames.
+// For frames of unknown types, it returns an UnknownFrameTypeError.
 func ParseNextFrame(r *bytes.Reader, hdr *Header, v protocol.VersionNumber) (Frame, error) {
 	for r.Len() != 0 {
 		typeByte, _ := r.ReadByte()
@@ -43,7 +54,7 @@ func parseIETFFrame(r *bytes.Reader, typeByte byte, v protocol.VersionNumber) (F
 		if err != nil {
 			err = qerr.Error(qerr.InvalidRstStreamData, err.Error())
 		}
-	case 0x2:
+	case 0x2, 0x3:
 		frame, err = parseConnectionCloseFrame(r, v)
 		if err != nil {
 			err = qerr.Error(qerr.InvalidConnectionCloseData, err.Error())
@@ -80,12 +91,17 @@ func parseIETFFrame(r *bytes.Reader, typeByte byte, v protocol.VersionNumber) (F
 		if err != nil {
 			err = qerr.Error(qerr.InvalidFrameData, err.Error())
 		}
+	case 0xb:
+		frame, err = parseNewConnectionIDFrame(r, v)
+		if err != nil {
+			err = qerr.Error(qerr.InvalidFrameData, err.Error())
+		}
 	case 0xc:
 		frame, err = parseStopSendingFrame(r, v)
 		if err != nil {
 			err = qerr.Error(qerr.InvalidFrameData, err.Error())
 		}
-	case 0xd:
+	case ackFrameType, ackECNFrameType:
 		frame, err = parseAckFrame(r, v)
 		if err != nil {
 			err = qerr.Error(qerr.InvalidAckData, err.Error())
@@ -100,8 +116,30 @@ func parseIETFFrame(r *bytes.Reader, typeByte byte, v protocol.VersionNumber) (F
 		if err != nil {
 			err = qerr.Error(qerr.InvalidFrameData, err.Error())
 		}
+	case 0x20:
+		frame, err = parseExpiredStreamDataFrame(r, v)
+		if err != nil {
+			err = qerr.Error(qerr.InvalidFrameData, err.Error())
+		}
+	case 0x21:
+		frame, err = parseRetireConnectionIDFrame(r, v)
+		if err != nil {
+			err = qerr.Error(qerr.InvalidFrameData, err.Error())
+		}
+	case ackFrequencyFrameType:
+		frame, err = parseAckFrequencyFrame(r, v)
+		if err != nil {
+			err = qerr.Error(qerr.InvalidFrameData, err.Error())
+		}
 	default:
-		err = qerr.Error(qerr.InvalidFrameData, fmt.Sprintf("unknown type byte 0x%x", typeByte))
+		if IsExtensionFrameType(typeByte) {
+			frame, err = parseExtensionFrame(r, v)
+			if err != nil {
+				err = qerr.Error(qerr.InvalidFrameData, err.Error())
+			}
+			break
+		}
+		err = &UnknownFrameTypeError{FrameType: typeByte}
 	}
 	return frame, err
 }
@@ -155,8 +193,20 @@ func parseGQUICFrame(r *bytes.Reader, typeByte byte, hdr *Header, v protocol.Ver
 		}
 	case 0x7:
 		frame, err = parsePingFrame(r, v)
+	case 0x20:
+		frame, err = parseExpiredStreamDataFrame(r, v)
+		if err != nil {
+			err = qerr.Error(qerr.InvalidFrameData, err.Error())
+		}
 	default:
-		err = qerr.Error(qerr.InvalidFrameData, fmt.Sprintf("unknown type byte 0x%x", typeByte))
+		if IsExtensionFrameType(typeByte) {
+			frame, err = parseExtensionFrame(r, v)
+			if err != nil {
+				err = qerr.Error(qerr.InvalidFrameData, err.Error())
+			}
+			break
+		}
+		err = &UnknownFrameTypeError{FrameType: typeByte}
 	}
 	return frame, err
 }
@@ -2,6 +2,7 @@ package wire
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/qerr"
@@ -154,9 +155,27 @@ var _ = Describe("Frame parsing", func() {
 			Expect(frame.(*AckFrame).LargestAcked()).To(Equal(protocol.PacketNumber(0x13)))
 		})
 
+		It("unpacks EXPIRED_STREAM_DATA frames", func() {
+			f := &ExpiredStreamDataFrame{StreamID: 0x1337, Offset: 0xdeadbeef}
+			err := f.Write(buf, versionBigEndian)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionBigEndian)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
+		It("unpacks extension frames", func() {
+			f := &ExtensionFrame{FrameType: 0x18, Data: []byte("foobar")}
+			err := f.Write(buf, versionBigEndian)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionBigEndian)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
 		It("errors on invalid type", func() {
 			_, err := ParseNextFrame(bytes.NewReader([]byte{0xf}), nil, versionBigEndian)
-			Expect(err).To(MatchError("InvalidFrameData: unknown type byte 0xf"))
+			Expect(err).To(MatchError(&UnknownFrameTypeError{FrameType: 0xf}))
 		})
 
 		It("errors on invalid frames", func() {
@@ -169,6 +188,8 @@ var _ = Describe("Frame parsing", func() {
 				0x04: qerr.InvalidWindowUpdateData,
 				0x05: qerr.InvalidBlockedData,
 				0x06: qerr.InvalidStopWaitingData,
+				0x18: qerr.InvalidFrameData,
+				0x20: qerr.InvalidFrameData,
 			} {
 				_, err := ParseNextFrame(bytes.NewReader([]byte{b}), &Header{PacketNumberLen: 2}, versionBigEndian)
 				Expect(err).To(HaveOccurred())
@@ -200,6 +221,15 @@ var _ = Describe("Frame parsing", func() {
 			Expect(frame).To(Equal(f))
 		})
 
+		It("unpacks APPLICATION_CLOSE frames", func() {
+			f := &ConnectionCloseFrame{IsApplicationError: true, ErrorCode: 0x1337, ReasonPhrase: "foo"}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
 		It("unpacks MAX_DATA frames", func() {
 			f := &MaxDataFrame{
 				ByteOffset: 0xcafe,
@@ -289,6 +319,19 @@ var _ = Describe("Frame parsing", func() {
 			Expect(frame.(*AckFrame).LargestAcked()).To(Equal(protocol.PacketNumber(0x13)))
 		})
 
+		It("unpacks ACK frames with ECN counts", func() {
+			f := &AckFrame{
+				AckRanges: []AckRange{{Smallest: 1, Largest: 0x13}},
+				ECT0:      0x10,
+				ECNCE:     0x2,
+			}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
 		It("unpacks PATH_CHALLENGE frames", func() {
 			f := &PathChallengeFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}
 			err := f.Write(buf, versionIETFFrames)
@@ -311,26 +354,86 @@ var _ = Describe("Frame parsing", func() {
 			Expect(frame.(*PathResponseFrame).Data).To(Equal([8]byte{1, 2, 3, 4, 5, 6, 7, 8}))
 		})
 
+		It("unpacks NEW_CONNECTION_ID frames", func() {
+			f := &NewConnectionIDFrame{
+				SequenceNumber:      0x1337,
+				ConnectionID:        protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+				StatelessResetToken: [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+			}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
+		It("unpacks RETIRE_CONNECTION_ID frames", func() {
+			f := &RetireConnectionIDFrame{SequenceNumber: 0x1337}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
+		It("unpacks ACK_FREQUENCY frames", func() {
+			f := &AckFrequencyFrame{
+				SequenceNumber:  0x1337,
+				PacketTolerance: 10,
+				MaxAckDelay:     10 * time.Millisecond,
+				IgnoreOrder:     true,
+			}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
+		It("unpacks EXPIRED_STREAM_DATA frames", func() {
+			f := &ExpiredStreamDataFrame{StreamID: 0x1337, Offset: 0xdeadbeef}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
+		It("unpacks extension frames", func() {
+			f := &ExtensionFrame{FrameType: 0x1f, Data: []byte("foobar")}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
 		It("errors on invalid type", func() {
 			_, err := ParseNextFrame(bytes.NewReader([]byte{0x42}), nil, versionIETFFrames)
-			Expect(err).To(MatchError("InvalidFrameData: unknown type byte 0x42"))
+			Expect(err).To(MatchError(&UnknownFrameTypeError{FrameType: 0x42}))
 		})
 
 		It("errors on invalid frames", func() {
 			for b, e := range map[byte]qerr.ErrorCode{
 				0x01: qerr.InvalidRstStreamData,
 				0x02: qerr.InvalidConnectionCloseData,
+				0x03: qerr.InvalidConnectionCloseData,
 				0x04: qerr.InvalidWindowUpdateData,
 				0x05: qerr.InvalidWindowUpdateData,
 				0x06: qerr.InvalidFrameData,
 				0x08: qerr.InvalidBlockedData,
 				0x09: qerr.InvalidBlockedData,
 				0x0a: qerr.InvalidFrameData,
+				0x0b: qerr.InvalidFrameData,
 				0x0c: qerr.InvalidFrameData,
 				0x0d: qerr.InvalidAckData,
 				0x0e: qerr.InvalidFrameData,
 				0x0f: qerr.InvalidFrameData,
 				0x10: qerr.InvalidStreamData,
+				0x1f: qerr.InvalidFrameData,
+				0x20: qerr.InvalidFrameData,
+				0x21: qerr.InvalidFrameData,
+				0x23: qerr.InvalidFrameData,
 			} {
 				_, err := ParseNextFrame(bytes.NewReader([]byte{b}), nil, versionIETFFrames)
 				Expect(err).To(HaveOccurred())
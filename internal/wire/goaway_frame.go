@@ -41,8 +41,10 @@ func parseGoawayFrame(r *bytes.Reader, _ protocol.VersionNumber) (*GoawayFrame,
 		return nil, err
 	}
 
-	if reasonPhraseLen > uint16(protocol.MaxReceivePacketSize) {
-		return nil, qerr.Error(qerr.InvalidGoawayData, "reason phrase too long")
+	// The reason phrase can't be longer than the packet.
+	// This check prevents the allocation of a large buffer for a short packet.
+	if int(reasonPhraseLen) > r.Len() {
+		return nil, io.EOF
 	}
 
 	reasonPhrase := make([]byte, reasonPhraseLen)
@@ -2,9 +2,9 @@ package wire
 
 import (
 	"bytes"
+	"io"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
-	"github.com/lucas-clemente/quic-go/qerr"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -46,14 +46,14 @@ var _ = Describe("GoawayFrame", func() {
 			})
 		})
 
-		It("rejects long reason phrases", func() {
+		It("errors if the reason phrase is longer than the frame", func() {
 			b := bytes.NewReader([]byte{0x3,
 				0x1, 0x0, 0x0, 0x0, // error code
 				0x2, 0x0, 0x0, 0x0, // last good stream id
 				0xff, 0xff, // reason phrase length
 			})
 			_, err := parseGoawayFrame(b, protocol.VersionWhatever)
-			Expect(err).To(MatchError(qerr.Error(qerr.InvalidGoawayData, "reason phrase too long")))
+			Expect(err).To(MatchError(io.EOF))
 		})
 	})
 
@@ -2,6 +2,8 @@ package wire
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
@@ -36,10 +38,17 @@ type Header struct {
 	IsLongHeader bool
 	KeyPhase     int
 	PayloadLen   protocol.ByteCount
+
+	// When parsing a header, the connection IDs and the diversification nonce are read into these arrays.
+	// This way, parsing a header only allocates the Header itself.
+	destConnIDBuf [protocol.MaxConnectionIDLen]byte
+	srcConnIDBuf  [protocol.MaxConnectionIDLen]byte
+	divNonceBuf   [32]byte
 }
 
 // ParseHeaderSentByServer parses the header for a packet that was sent by the server.
-func ParseHeaderSentByServer(b *bytes.Reader) (*Header, error) {
+// shortHeaderConnIDLen is the length of the connection ID used in IETF QUIC Short Headers.
+func ParseHeaderSentByServer(b *bytes.Reader, shortHeaderConnIDLen int) (*Header, error) {
 	typeByte, err := b.ReadByte()
 	if err != nil {
 		return nil, err
@@ -53,11 +62,12 @@ func ParseHeaderSentByServer(b *bytes.Reader) (*Header, error) {
 		// gQUIC never uses 6 byte packet numbers, so the third and fourth bit will never be 11
 		isPublicHeader = typeByte&0x30 != 0x30
 	}
-	return parsePacketHeader(b, protocol.PerspectiveServer, isPublicHeader)
+	return parsePacketHeader(b, protocol.PerspectiveServer, isPublicHeader, shortHeaderConnIDLen)
 }
 
 // ParseHeaderSentByClient parses the header for a packet that was sent by the client.
-func ParseHeaderSentByClient(b *bytes.Reader) (*Header, error) {
+// shortHeaderConnIDLen is the length of the connection ID used in IETF QUIC Short Headers.
+func ParseHeaderSentByClient(b *bytes.Reader, shortHeaderConnIDLen int) (*Header, error) {
 	typeByte, err := b.ReadByte()
 	if err != nil {
 		return nil, err
@@ -71,10 +81,10 @@ func ParseHeaderSentByClient(b *bytes.Reader) (*Header, error) {
 	// * 0x80 is always unset and
 	// * and 0x8 is always set (this is the Connection ID flag, which the client always sets)
 	isPublicHeader := typeByte&0x88 == 0x8
-	return parsePacketHeader(b, protocol.PerspectiveClient, isPublicHeader)
+	return parsePacketHeader(b, protocol.PerspectiveClient, isPublicHeader, shortHeaderConnIDLen)
 }
 
-func parsePacketHeader(b *bytes.Reader, sentBy protocol.Perspective, isPublicHeader bool) (*Header, error) {
+func parsePacketHeader(b *bytes.Reader, sentBy protocol.Perspective, isPublicHeader bool, shortHeaderConnIDLen int) (*Header, error) {
 	// This is a gQUIC Public Header.
 	if isPublicHeader {
 		hdr, err := parsePublicHeader(b, sentBy)
@@ -84,7 +94,27 @@ func parsePacketHeader(b *bytes.Reader, sentBy protocol.Perspective, isPublicHea
 		hdr.IsPublicHeader = true // save that this is a Public Header, so we can log it correctly later
 		return hdr, nil
 	}
-	return parseHeader(b)
+	return parseHeader(b, shortHeaderConnIDLen)
+}
+
+// readConnectionID reads a connection ID of length len into buf.
+// The connection ID returned uses buf as its backing array.
+// It returns io.EOF if there are not enough bytes to read.
+func readConnectionID(b *bytes.Reader, buf []byte, len int) (protocol.ConnectionID, error) {
+	if len == 0 {
+		return nil, nil
+	}
+	if len > cap(buf) {
+		return nil, fmt.Errorf("connection ID too long: %d bytes", len)
+	}
+	c := buf[:len]
+	if _, err := io.ReadFull(b, c); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	return protocol.ConnectionID(c), nil
 }
 
 // Write writes the Header.
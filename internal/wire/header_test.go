@@ -5,6 +5,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"testing"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
@@ -31,7 +32,7 @@ var _ = Describe("Header", func() {
 				PacketNumberLen:  protocol.PacketNumberLen2,
 			}).writeHeader(buf)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()))
+			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.KeyPhase).To(BeEquivalentTo(1))
 			Expect(hdr.PacketNumber).To(Equal(protocol.PacketNumber(0x42)))
@@ -49,7 +50,7 @@ var _ = Describe("Header", func() {
 				Version:          0x1234,
 			}).writeHeader(buf)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()))
+			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.Type).To(Equal(protocol.PacketType0RTT))
 			Expect(hdr.PacketNumber).To(Equal(protocol.PacketNumber(0x42)))
@@ -68,7 +69,7 @@ var _ = Describe("Header", func() {
 				PacketNumber:     0x42,
 			}).writeHeader(buf)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByServer(bytes.NewReader(buf.Bytes()))
+			hdr, err := ParseHeaderSentByServer(bytes.NewReader(buf.Bytes()), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.IsPublicHeader).To(BeFalse())
 		})
@@ -85,7 +86,7 @@ var _ = Describe("Header", func() {
 				PacketNumberLen:  protocol.PacketNumberLen4,
 			}).writePublicHeader(buf, protocol.PerspectiveClient, versionPublicHeader)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()))
+			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.DestConnectionID).To(Equal(connID))
 			Expect(hdr.SrcConnectionID).To(Equal(connID))
@@ -105,7 +106,7 @@ var _ = Describe("Header", func() {
 				DiversificationNonce: bytes.Repeat([]byte{'f'}, 32),
 			}).writePublicHeader(buf, protocol.PerspectiveServer, versionPublicHeader)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByServer(bytes.NewReader(buf.Bytes()))
+			hdr, err := ParseHeaderSentByServer(bytes.NewReader(buf.Bytes()), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.DestConnectionID).To(Equal(connID))
 			Expect(hdr.SrcConnectionID).To(Equal(connID))
@@ -125,14 +126,14 @@ var _ = Describe("Header", func() {
 				PacketNumberLen:  protocol.PacketNumberLen2,
 			}).writePublicHeader(buf, protocol.PerspectiveClient, versionPublicHeader)
 			Expect(err).ToNot(HaveOccurred())
-			_, err = ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()[0:12]))
+			_, err = ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()[0:12]), 8)
 			Expect(err).To(MatchError(io.EOF))
 		})
 
 		It("errors when given no data", func() {
-			_, err := ParseHeaderSentByServer(bytes.NewReader([]byte{}))
+			_, err := ParseHeaderSentByServer(bytes.NewReader([]byte{}), 8)
 			Expect(err).To(MatchError(io.EOF))
-			_, err = ParseHeaderSentByClient(bytes.NewReader([]byte{}))
+			_, err = ParseHeaderSentByClient(bytes.NewReader([]byte{}), 8)
 			Expect(err).To(MatchError(io.EOF))
 		})
 
@@ -140,7 +141,7 @@ var _ = Describe("Header", func() {
 			connID := protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0xde, 0xca, 0xfb, 0xad}
 			versions := []protocol.VersionNumber{0x13, 0x37}
 			data := ComposeGQUICVersionNegotiation(connID, versions)
-			hdr, err := ParseHeaderSentByServer(bytes.NewReader(data))
+			hdr, err := ParseHeaderSentByServer(bytes.NewReader(data), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.IsPublicHeader).To(BeTrue())
 			Expect(hdr.DestConnectionID).To(Equal(connID))
@@ -157,7 +158,7 @@ var _ = Describe("Header", func() {
 			versions := []protocol.VersionNumber{0x13, 0x37}
 			data, err := ComposeVersionNegotiation(destConnID, srcConnID, versions)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByServer(bytes.NewReader(data))
+			hdr, err := ParseHeaderSentByServer(bytes.NewReader(data), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.IsPublicHeader).To(BeFalse())
 			Expect(hdr.IsVersionNegotiation).To(BeTrue())
@@ -169,6 +170,78 @@ var _ = Describe("Header", func() {
 				Expect(hdr.SupportedVersions).To(ContainElement(version))
 			}
 		})
+
+		Context("allocations", func() {
+			parseAllocs := func(data []byte, parse func(*bytes.Reader, int) (*Header, error)) float64 {
+				r := bytes.NewReader(nil)
+				return testing.AllocsPerRun(100, func() {
+					r.Reset(data)
+					if _, err := parse(r, 8); err != nil {
+						Fail(err.Error())
+					}
+				})
+			}
+
+			It("only allocates the Header when parsing a Short Header", func() {
+				buf := &bytes.Buffer{}
+				err := (&Header{
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+					PacketNumber:     0x42,
+					PacketNumberLen:  protocol.PacketNumberLen2,
+				}).writeHeader(buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(parseAllocs(buf.Bytes(), ParseHeaderSentByClient)).To(BeEquivalentTo(1))
+			})
+
+			It("only allocates the Header when parsing a Long Header", func() {
+				buf := &bytes.Buffer{}
+				err := (&Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeHandshake,
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+					SrcConnectionID:  protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1, 0},
+					PacketNumber:     0x42,
+					Version:          versionIETFHeader,
+				}).writeHeader(buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(parseAllocs(buf.Bytes(), ParseHeaderSentByServer)).To(BeEquivalentTo(1))
+			})
+
+			It("only allocates the Header when parsing a gQUIC Public Header", func() {
+				buf := &bytes.Buffer{}
+				err := (&Header{
+					DestConnectionID:     protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+					SrcConnectionID:      protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+					PacketNumber:         0x1337,
+					PacketNumberLen:      protocol.PacketNumberLen4,
+					DiversificationNonce: bytes.Repeat([]byte{'f'}, 32),
+				}).writePublicHeader(buf, protocol.PerspectiveServer, versionPublicHeader)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(parseAllocs(buf.Bytes(), ParseHeaderSentByServer)).To(BeEquivalentTo(1))
+			})
+
+			It("doesn't reference the packet data", func() {
+				buf := &bytes.Buffer{}
+				err := (&Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeHandshake,
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+					SrcConnectionID:  protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+					PacketNumber:     0x42,
+					Version:          versionIETFHeader,
+				}).writeHeader(buf)
+				Expect(err).ToNot(HaveOccurred())
+				data := buf.Bytes()
+				hdr, err := ParseHeaderSentByServer(bytes.NewReader(data), 8)
+				Expect(err).ToNot(HaveOccurred())
+				// the packet buffer might be reused after parsing the header
+				for i := range data {
+					data[i] = 0
+				}
+				Expect(hdr.DestConnectionID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}))
+				Expect(hdr.SrcConnectionID).To(Equal(protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}))
+			})
+		})
 	})
 
 	Context("writing", func() {
@@ -199,7 +272,7 @@ var _ = Describe("Header", func() {
 			}
 			err := hdr.Write(buf, protocol.PerspectiveServer, versionIETFHeader)
 			Expect(err).ToNot(HaveOccurred())
-			_, err = ParseHeaderSentByServer(bytes.NewReader(buf.Bytes()))
+			_, err = ParseHeaderSentByServer(bytes.NewReader(buf.Bytes()), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.IsPublicHeader).To(BeFalse())
 		})
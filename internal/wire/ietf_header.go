@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"io"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
@@ -12,7 +11,8 @@ import (
 )
 
 // parseHeader parses the header.
-func parseHeader(b *bytes.Reader) (*Header, error) {
+// The length of the connection ID in the Short Header is not encoded, so it has to be known in advance.
+func parseHeader(b *bytes.Reader, shortHeaderConnIDLen int) (*Header, error) {
 	typeByte, err := b.ReadByte()
 	if err != nil {
 		return nil, err
@@ -20,7 +20,7 @@ func parseHeader(b *bytes.Reader) (*Header, error) {
 	if typeByte&0x80 > 0 {
 		return parseLongHeader(b, typeByte)
 	}
-	return parseShortHeader(b, typeByte)
+	return parseShortHeader(b, typeByte, shortHeaderConnIDLen)
 }
 
 // parse long header and version negotiation packets
@@ -35,22 +35,19 @@ func parseLongHeader(b *bytes.Reader, typeByte byte) (*Header, error) {
 		return nil, err
 	}
 	dcil, scil := decodeConnIDLen(connIDLenByte)
-	destConnID, err := protocol.ReadConnectionID(b, dcil)
+	h := &Header{
+		IsLongHeader: true,
+		Version:      protocol.VersionNumber(v),
+	}
+	h.DestConnectionID, err = readConnectionID(b, h.destConnIDBuf[:], dcil)
 	if err != nil {
 		return nil, err
 	}
-	srcConnID, err := protocol.ReadConnectionID(b, scil)
+	h.SrcConnectionID, err = readConnectionID(b, h.srcConnIDBuf[:], scil)
 	if err != nil {
 		return nil, err
 	}
 
-	h := &Header{
-		IsLongHeader:     true,
-		Version:          protocol.VersionNumber(v),
-		DestConnectionID: destConnID,
-		SrcConnectionID:  srcConnID,
-	}
-
 	if v == 0 { // version negotiation packet
 		if b.Len() == 0 {
 			return nil, qerr.Error(qerr.InvalidVersionNegotiationPacket, "empty version list")
@@ -86,12 +83,10 @@ func parseLongHeader(b *bytes.Reader, typeByte byte) (*Header, error) {
 	return h, nil
 }
 
-func parseShortHeader(b *bytes.Reader, typeByte byte) (*Header, error) {
-	connID := make(protocol.ConnectionID, 8)
-	if _, err := io.ReadFull(b, connID); err != nil {
-		if err == io.ErrUnexpectedEOF {
-			err = io.EOF
-		}
+func parseShortHeader(b *bytes.Reader, typeByte byte, connIDLen int) (*Header, error) {
+	h := &Header{}
+	connID, err := readConnectionID(b, h.destConnIDBuf[:], connIDLen)
+	if err != nil {
 		return nil, err
 	}
 	// bits 2 and 3 must be set, bit 4 must be unset
@@ -113,12 +108,11 @@ func parseShortHeader(b *bytes.Reader, typeByte byte) (*Header, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Header{
-		KeyPhase:         int(typeByte&0x40) >> 6,
-		DestConnectionID: connID,
-		PacketNumber:     protocol.PacketNumber(pn),
-		PacketNumberLen:  pnLen,
-	}, nil
+	h.KeyPhase = int(typeByte&0x40) >> 6
+	h.DestConnectionID = connID
+	h.PacketNumber = protocol.PacketNumber(pn)
+	h.PacketNumberLen = pnLen
+	return h, nil
 }
 
 // writeHeader writes the Header.
@@ -131,8 +125,8 @@ func (h *Header) writeHeader(b *bytes.Buffer) error {
 
 // TODO: add support for the key phase
 func (h *Header) writeLongHeader(b *bytes.Buffer) error {
-	if h.SrcConnectionID.Len() != protocol.ConnectionIDLen {
-		return fmt.Errorf("Header: source connection ID must be %d bytes, is %d", protocol.ConnectionIDLen, h.SrcConnectionID.Len())
+	if h.SrcConnectionID.Len() < protocol.MinConnectionIDLen || h.SrcConnectionID.Len() > protocol.MaxConnectionIDLen {
+		return fmt.Errorf("Header: source connection ID must be between %d and %d bytes, is %d", protocol.MinConnectionIDLen, protocol.MaxConnectionIDLen, h.SrcConnectionID.Len())
 	}
 	b.WriteByte(byte(0x80 | h.Type))
 	utils.BigEndian.WriteUint32(b, uint32(h.Version))
@@ -25,7 +25,7 @@ var _ = Describe("IETF QUIC Header", func() {
 				data, err := ComposeVersionNegotiation(connID, connID, versions)
 				Expect(err).ToNot(HaveOccurred())
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b)
+				h, err := parseHeader(b, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.IsVersionNegotiation).To(BeTrue())
 				Expect(h.Version).To(BeZero())
@@ -42,7 +42,7 @@ var _ = Describe("IETF QUIC Header", func() {
 				data, err := ComposeVersionNegotiation(connID, connID, versions)
 				Expect(err).ToNot(HaveOccurred())
 				b := bytes.NewReader(data[:len(data)-2])
-				_, err = parseHeader(b)
+				_, err = parseHeader(b, 8)
 				Expect(err).To(MatchError(qerr.InvalidVersionNegotiationPacket))
 			})
 
@@ -52,7 +52,7 @@ var _ = Describe("IETF QUIC Header", func() {
 				data, err := ComposeVersionNegotiation(connID, connID, versions)
 				Expect(err).ToNot(HaveOccurred())
 				// remove 8 bytes (two versions), since ComposeVersionNegotiation also added a reserved version number
-				_, err = parseHeader(bytes.NewReader(data[:len(data)-8]))
+				_, err = parseHeader(bytes.NewReader(data[:len(data)-8]), 8)
 				Expect(err).To(MatchError("InvalidVersionNegotiationPacket: empty version list"))
 			})
 		})
@@ -73,7 +73,7 @@ var _ = Describe("IETF QUIC Header", func() {
 
 			It("parses a long header", func() {
 				b := bytes.NewReader(generatePacket(protocol.PacketTypeInitial))
-				h, err := parseHeader(b)
+				h, err := parseHeader(b, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.Type).To(Equal(protocol.PacketTypeInitial))
 				Expect(h.IsLongHeader).To(BeTrue())
@@ -98,7 +98,7 @@ var _ = Describe("IETF QUIC Header", func() {
 				data = append(data, encodeVarInt(0x42)...) // payload length
 				data = append(data, []byte{0xde, 0xca, 0xfb, 0xad}...)
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b)
+				h, err := parseHeader(b, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.SrcConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}))
 				Expect(h.DestConnectionID).To(BeEmpty())
@@ -114,7 +114,7 @@ var _ = Describe("IETF QUIC Header", func() {
 				data = append(data, encodeVarInt(0x42)...) // payload length
 				data = append(data, []byte{0xde, 0xca, 0xfb, 0xad}...)
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b)
+				h, err := parseHeader(b, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.SrcConnectionID).To(BeEmpty())
 				Expect(h.DestConnectionID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}))
@@ -130,7 +130,7 @@ var _ = Describe("IETF QUIC Header", func() {
 				}).Write(buf, protocol.PerspectiveClient, protocol.VersionTLS)
 				Expect(err).ToNot(HaveOccurred())
 				b := bytes.NewReader(buf.Bytes())
-				_, err = parseHeader(b)
+				_, err = parseHeader(b, 8)
 				Expect(err).To(MatchError("InvalidPacketHeader: Received packet with invalid packet type: 42"))
 			})
 
@@ -144,7 +144,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0xde, 0xca, 0xfb, 0xad, // packet number
 				}
 				for i := 0; i < len(data); i++ {
-					_, err := parseHeader(bytes.NewReader(data[:i]))
+					_, err := parseHeader(bytes.NewReader(data[:i]), 8)
 					Expect(err).To(Equal(io.EOF))
 				}
 			})
@@ -158,7 +158,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0x42, // packet number
 				}
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b)
+				h, err := parseHeader(b, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.IsLongHeader).To(BeFalse())
 				Expect(h.KeyPhase).To(Equal(0))
@@ -170,6 +170,21 @@ var _ = Describe("IETF QUIC Header", func() {
 				Expect(b.Len()).To(BeZero())
 			})
 
+			It("reads a short header with a connection ID of a different length", func() {
+				data := []byte{
+					0x30,                   // 1 byte packet number
+					0xde, 0xad, 0xbe, 0xef, // connection ID
+					0x13, 0x37, // connection ID
+					0x42, // packet number
+				}
+				b := bytes.NewReader(data)
+				h, err := parseHeader(b, 6)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(h.DestConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0x13, 0x37}))
+				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0x42)))
+				Expect(b.Len()).To(BeZero())
+			})
+
 			It("reads the Key Phase Bit", func() {
 				data := []byte{
 					0x30 ^ 0x40,
@@ -177,7 +192,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0x11,
 				}
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b)
+				h, err := parseHeader(b, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.IsLongHeader).To(BeFalse())
 				Expect(h.KeyPhase).To(Equal(1))
@@ -191,7 +206,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0x13, 0x37, // packet number
 				}
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b)
+				h, err := parseHeader(b, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.IsLongHeader).To(BeFalse())
 				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0x1337)))
@@ -206,7 +221,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0xde, 0xad, 0xbe, 0xef, // packet number
 				}
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b)
+				h, err := parseHeader(b, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.IsLongHeader).To(BeFalse())
 				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0xdeadbeef)))
@@ -221,7 +236,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0xde, 0xad, 0xbe, 0xef, // packet number
 				}
 				b := bytes.NewReader(data)
-				_, err := parseHeader(b)
+				_, err := parseHeader(b, 8)
 				Expect(err).To(MatchError("invalid short header type"))
 			})
 
@@ -232,7 +247,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0xde, 0xca, 0xfb, 0xad, // packet number
 				}
 				b := bytes.NewReader(data)
-				_, err := parseHeader(b)
+				_, err := parseHeader(b, 8)
 				Expect(err).To(MatchError("invalid bits 3, 4 and 5"))
 			})
 
@@ -243,7 +258,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0xde, 0xca, 0xfb, 0xad, // packet number
 				}
 				for i := 0; i < len(data); i++ {
-					_, err := parseHeader(bytes.NewReader(data[:i]))
+					_, err := parseHeader(bytes.NewReader(data[:i]), 8)
 					Expect(err).To(Equal(io.EOF))
 				}
 			})
@@ -305,6 +320,29 @@ var _ = Describe("IETF QUIC Header", func() {
 				Expect(err).To(MatchError("invalid connection ID length: 19 bytes"))
 			})
 
+			It("writes a header with a source connection ID of a non-default length", func() {
+				err := (&Header{
+					IsLongHeader:     true,
+					Type:             0x5,
+					SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4},
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+					PacketNumber:     0xdecafbad,
+					Version:          0x1020304,
+				}).writeHeader(buf)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("refuses to write a header with a too short source connection ID", func() {
+				err := (&Header{
+					IsLongHeader:     true,
+					Type:             0x5,
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+					PacketNumber:     0xdecafbad,
+					Version:          0x1020304,
+				}).writeHeader(buf)
+				Expect(err).To(MatchError("Header: source connection ID must be between 4 and 18 bytes, is 0"))
+			})
+
 			It("writes a header with an 18 byte connection ID", func() {
 				err := (&Header{
 					IsLongHeader:     true,
@@ -65,6 +65,17 @@ var _ = Describe("Frame logging", func() {
 		Expect(buf.String()).To(ContainSubstring("\t<- &wire.AckFrame{LargestAcked: 0x1337, LowestAcked: 0x42, DelayTime: 1ms}\n"))
 	})
 
+	It("logs ACK frames with ECN counts", func() {
+		frame := &AckFrame{
+			AckRanges: []AckRange{{Smallest: 0x42, Largest: 0x1337}},
+			DelayTime: 1 * time.Millisecond,
+			ECT0:      10,
+			ECNCE:     2,
+		}
+		LogFrame(logger, frame, false)
+		Expect(buf.String()).To(ContainSubstring("\t<- &wire.AckFrame{LargestAcked: 0x1337, LowestAcked: 0x42, DelayTime: 1ms, ECT0: 10, ECT1: 0, CE: 2}\n"))
+	})
+
 	It("logs ACK frames with missing packets", func() {
 		frame := &AckFrame{
 			AckRanges: []AckRange{
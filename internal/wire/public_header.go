@@ -131,11 +131,8 @@ func parsePublicHeader(b *bytes.Reader, packetSentBy protocol.Perspective) (*Hea
 
 	// Connection ID
 	if !header.OmitConnectionID {
-		connID := make(protocol.ConnectionID, 8)
-		if _, err := io.ReadFull(b, connID); err != nil {
-			if err == io.ErrUnexpectedEOF {
-				err = io.EOF
-			}
+		connID, err := readConnectionID(b, header.destConnIDBuf[:], 8)
+		if err != nil {
 			return nil, err
 		}
 		if connID[0] == 0 && connID[1] == 0 && connID[2] == 0 && connID[3] == 0 && connID[4] == 0 && connID[5] == 0 && connID[6] == 0 && connID[7] == 0 {
@@ -149,7 +146,7 @@ func parsePublicHeader(b *bytes.Reader, packetSentBy protocol.Perspective) (*Hea
 	// It doesn't have any meaning when sent by the client.
 	if packetSentBy == protocol.PerspectiveServer && publicFlagByte&0x04 > 0 {
 		if !header.VersionFlag && !header.ResetFlag {
-			header.DiversificationNonce = make([]byte, 32)
+			header.DiversificationNonce = header.divNonceBuf[:]
 			if _, err := io.ReadFull(b, header.DiversificationNonce); err != nil {
 				return nil, err
 			}
@@ -0,0 +1,16 @@
+package wire
+
+import "github.com/lucas-clemente/quic-go/internal/protocol"
+
+// ComposeStatelessReset composes a Stateless Reset.
+// It looks like a Short Header packet with random contents, followed by the stateless reset token.
+func ComposeStatelessReset(token [16]byte) ([]byte, error) {
+	b := make([]byte, protocol.MinStatelessResetSize)
+	if err := protocol.ReadRandom(b[:len(b)-16]); err != nil {
+		return nil, err
+	}
+	// use a random key phase, and a 1 or 2 byte packet number
+	b[0] = 0x30 | (b[0] & 0x41)
+	copy(b[len(b)-16:], token[:])
+	return b, nil
+}
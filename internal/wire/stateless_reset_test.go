@@ -0,0 +1,33 @@
+package wire
+
+import (
+	"bytes"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stateless Reset", func() {
+	token := [16]byte{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+
+	It("composes a Stateless Reset that looks like a Short Header packet", func() {
+		b, err := ComposeStatelessReset(token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b).To(HaveLen(protocol.MinStatelessResetSize))
+		Expect(b[len(b)-16:]).To(Equal(token[:]))
+		hdr, err := ParseHeaderSentByServer(bytes.NewReader(b), protocol.MaxConnectionIDLen)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(hdr.IsPublicHeader).To(BeFalse())
+		Expect(hdr.IsLongHeader).To(BeFalse())
+	})
+
+	It("uses random bytes", func() {
+		b1, err := ComposeStatelessReset(token)
+		Expect(err).ToNot(HaveOccurred())
+		b2, err := ComposeStatelessReset(token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b1).ToNot(Equal(b2))
+	})
+})
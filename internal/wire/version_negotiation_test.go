@@ -28,7 +28,7 @@ var _ = Describe("Version Negotiation Packets", func() {
 		data, err := ComposeVersionNegotiation(destConnID, srcConnID, versions)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(data[0] & 0x80).ToNot(BeZero())
-		hdr, err := parseHeader(bytes.NewReader(data))
+		hdr, err := parseHeader(bytes.NewReader(data), 8)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(hdr.IsVersionNegotiation).To(BeTrue())
 		Expect(hdr.DestConnectionID).To(Equal(destConnID))
@@ -40,4 +40,14 @@ var _ = Describe("Version Negotiation Packets", func() {
 			Expect(hdr.SupportedVersions).To(ContainElement(version))
 		}
 	})
+
+	It("writes reproducible packets when using a deterministic source of randomness", func() {
+		compose := func() []byte {
+			defer protocol.SetRandomReader(protocol.NewDeterministicReader(42))()
+			data, err := ComposeVersionNegotiation(protocol.ConnectionID{1, 2, 3, 4}, protocol.ConnectionID{5, 6, 7, 8}, []protocol.VersionNumber{1001, 1003})
+			Expect(err).ToNot(HaveOccurred())
+			return data
+		}
+		Expect(compose()).To(Equal(compose()))
+	})
 })
@@ -0,0 +1,206 @@
+package quic
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// An InvariantViolation describes an internal invariant of a session that was found to be violated.
+// Invariants are only checked when building with the quic_invariants build tag.
+// A violation indicates a bug in quic-go, and it is reported at most once per invariant and session.
+// Warning: This API should not be considered stable and might change soon.
+type InvariantViolation struct {
+	// Invariant is the name of the invariant, e.g. "flow control accounting".
+	Invariant string
+	// Details describes how the invariant was violated.
+	Details string
+	// Snapshot captures the state of the session at the moment the violation was detected.
+	Snapshot *DiagnosticSnapshot
+}
+
+func (v InvariantViolation) String() string {
+	return fmt.Sprintf("invariant violated (%s): %s", v.Invariant, v.Details)
+}
+
+// the names of the invariants
+const (
+	invariantPacketNumbers     = "packet number monotonicity"
+	invariantFlowControl       = "flow control accounting"
+	invariantStreamTransitions = "stream state transitions"
+)
+
+// The invariantChecker verifies internal invariants of a session at runtime:
+// * packet numbers of sent packets are strictly increasing
+// * the connection-level flow controller accounts for exactly the data sent and received on all streams
+//   (for bytes read, that's an upper bound, since streams are read concurrently)
+// * streams are opened once, and completed once, and they're never reopened after being completed
+// It is only used when building with the quic_invariants build tag. Otherwise, the session doesn't create one.
+// All methods may be called on a nil invariantChecker, which doesn't check anything.
+// SentPacket and Check must be called from the session's run loop.
+// StreamOpened and StreamCompleted are also called from the Go routines opening, reading and writing streams.
+// Violations are therefore only collected by these methods, and reported by the run loop.
+type invariantChecker struct {
+	version            protocol.VersionNumber
+	connFlowController flowcontrol.ConnectionFlowController
+	report             func(InvariantViolation)
+
+	hasSentPacket        bool
+	lastSentPacketNumber protocol.PacketNumber
+
+	mutex sync.Mutex
+
+	// the flow controllers of streams that were opened, but not yet completed
+	streams map[protocol.StreamID]flowcontrol.StreamFlowController
+	// the IDs of the completed streams
+	completedStreams map[protocol.StreamID]struct{}
+	// the sums of the offsets of the completed streams that contribute to connection-level flow control
+	completedOffsets flowcontrol.Offsets
+
+	// every invariant is only reported once
+	reported map[string]struct{}
+	// violations that were detected, but not yet reported
+	pending []InvariantViolation
+}
+
+func newInvariantChecker(
+	version protocol.VersionNumber,
+	connFlowController flowcontrol.ConnectionFlowController,
+	report func(InvariantViolation),
+) *invariantChecker {
+	return &invariantChecker{
+		version:            version,
+		connFlowController: connFlowController,
+		report:             report,
+		streams:            make(map[protocol.StreamID]flowcontrol.StreamFlowController),
+		completedStreams:   make(map[protocol.StreamID]struct{}),
+		reported:           make(map[string]struct{}),
+	}
+}
+
+// SentPacket is called for every packet sent.
+func (c *invariantChecker) SentPacket(pn protocol.PacketNumber) {
+	if c == nil {
+		return
+	}
+	if c.hasSentPacket && pn <= c.lastSentPacketNumber {
+		c.mutex.Lock()
+		c.violated(invariantPacketNumbers, "sent packet %#x after packet %#x", pn, c.lastSentPacketNumber)
+		c.mutex.Unlock()
+		c.reportPending()
+	}
+	c.hasSentPacket = true
+	c.lastSentPacketNumber = pn
+}
+
+// StreamOpened is called when the flow controller for a new stream is created.
+func (c *invariantChecker) StreamOpened(id protocol.StreamID, fc flowcontrol.StreamFlowController) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.completedStreams[id]; ok {
+		c.violated(invariantStreamTransitions, "stream %d was reopened after it was completed", id)
+		return
+	}
+	if _, ok := c.streams[id]; ok {
+		c.violated(invariantStreamTransitions, "stream %d was opened twice", id)
+		return
+	}
+	c.streams[id] = fc
+}
+
+// StreamCompleted is called when a stream is completed.
+func (c *invariantChecker) StreamCompleted(id protocol.StreamID) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.completedStreams[id]; ok {
+		c.violated(invariantStreamTransitions, "stream %d was completed twice", id)
+		return
+	}
+	fc, ok := c.streams[id]
+	if !ok {
+		c.violated(invariantStreamTransitions, "stream %d was completed, but it was never opened", id)
+		return
+	}
+	delete(c.streams, id)
+	c.completedStreams[id] = struct{}{}
+	if c.version.StreamContributesToConnectionFlowControl(id) {
+		offsets := fc.GetOffsets()
+		c.completedOffsets.BytesSent += offsets.BytesSent
+		c.completedOffsets.BytesRead += offsets.BytesRead
+		c.completedOffsets.HighestReceived += offsets.HighestReceived
+	}
+}
+
+// Check checks the flow control invariants,
+// and reports all violations that were detected since the last call.
+func (c *invariantChecker) Check() {
+	if c == nil {
+		return
+	}
+	c.check()
+	c.reportPending()
+}
+
+func (c *invariantChecker) check() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// Get the connection-level offsets first.
+	// Streams are read concurrently, and they increase their bytes read before the connection's.
+	conn := c.connFlowController.GetOffsets()
+	if conn.BytesRead > conn.HighestReceived || conn.HighestReceived > conn.ReceiveWindow {
+		c.violated(invariantFlowControl, "connection: read %d bytes, highest received offset %d, receive window %d", conn.BytesRead, conn.HighestReceived, conn.ReceiveWindow)
+	}
+	sum := c.completedOffsets
+	for id, fc := range c.streams {
+		offsets := fc.GetOffsets()
+		if offsets.BytesRead > offsets.HighestReceived || offsets.HighestReceived > offsets.ReceiveWindow {
+			c.violated(invariantFlowControl, "stream %d: read %d bytes, highest received offset %d, receive window %d", id, offsets.BytesRead, offsets.HighestReceived, offsets.ReceiveWindow)
+		}
+		if !c.version.StreamContributesToConnectionFlowControl(id) {
+			continue
+		}
+		sum.BytesSent += offsets.BytesSent
+		sum.BytesRead += offsets.BytesRead
+		sum.HighestReceived += offsets.HighestReceived
+	}
+	if conn.BytesSent != sum.BytesSent {
+		c.violated(invariantFlowControl, "connection sent %d bytes, streams sent %d bytes", conn.BytesSent, sum.BytesSent)
+	}
+	if conn.HighestReceived != sum.HighestReceived {
+		c.violated(invariantFlowControl, "connection received %d bytes, streams received %d bytes", conn.HighestReceived, sum.HighestReceived)
+	}
+	if conn.BytesRead > sum.BytesRead {
+		c.violated(invariantFlowControl, "connection read %d bytes, streams read %d bytes", conn.BytesRead, sum.BytesRead)
+	}
+}
+
+// violated records a violation, it is reported by reportPending.
+// must be called after locking the mutex
+func (c *invariantChecker) violated(invariant, format string, args ...interface{}) {
+	if _, ok := c.reported[invariant]; ok {
+		return
+	}
+	c.reported[invariant] = struct{}{}
+	c.pending = append(c.pending, InvariantViolation{
+		Invariant: invariant,
+		Details:   fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *invariantChecker) reportPending() {
+	c.mutex.Lock()
+	pending := c.pending
+	c.pending = nil
+	c.mutex.Unlock()
+	for _, v := range pending {
+		c.report(v)
+	}
+}
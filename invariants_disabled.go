@@ -0,0 +1,7 @@
+// +build !quic_invariants
+
+package quic
+
+// invariantChecksEnabled says if sessions verify internal invariants at runtime, see invariantChecker.
+// Invariants are checked when building with the quic_invariants build tag.
+const invariantChecksEnabled = false
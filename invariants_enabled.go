@@ -0,0 +1,7 @@
+// +build quic_invariants
+
+package quic
+
+// invariantChecksEnabled says if sessions verify internal invariants at runtime, see invariantChecker.
+// Violations are logged, and passed to Config.OnInvariantViolation.
+const invariantChecksEnabled = true
@@ -0,0 +1,213 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
+	"github.com/lucas-clemente/quic-go/internal/mocks"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Invariant Checker", func() {
+	var (
+		checker            *invariantChecker
+		connFlowController *mocks.MockConnectionFlowController
+		violations         []InvariantViolation
+	)
+
+	BeforeEach(func() {
+		violations = nil
+		connFlowController = mocks.NewMockConnectionFlowController(mockCtrl)
+		checker = newInvariantChecker(
+			protocol.VersionWhatever,
+			connFlowController,
+			func(v InvariantViolation) { violations = append(violations, v) },
+		)
+	})
+
+	It("doesn't do anything when it is nil", func() {
+		var c *invariantChecker
+		c.SentPacket(1)
+		c.StreamOpened(5, nil)
+		c.StreamCompleted(5)
+		c.Check()
+	})
+
+	Context("packet numbers", func() {
+		It("accepts increasing packet numbers", func() {
+			checker.SentPacket(1)
+			checker.SentPacket(2)
+			checker.SentPacket(10)
+			Expect(violations).To(BeEmpty())
+		})
+
+		It("reports a packet number that was used before", func() {
+			checker.SentPacket(5)
+			checker.SentPacket(5)
+			Expect(violations).To(HaveLen(1))
+			Expect(violations[0].Invariant).To(Equal(invariantPacketNumbers))
+			Expect(violations[0].Details).To(ContainSubstring("0x5"))
+		})
+
+		It("reports every invariant only once", func() {
+			checker.SentPacket(5)
+			checker.SentPacket(4)
+			checker.SentPacket(3)
+			Expect(violations).To(HaveLen(1))
+		})
+	})
+
+	Context("stream state transitions", func() {
+		It("accepts streams that are opened and completed", func() {
+			fc := mocks.NewMockStreamFlowController(mockCtrl)
+			fc.EXPECT().GetOffsets()
+			checker.StreamOpened(5, mocks.NewMockStreamFlowController(mockCtrl))
+			checker.StreamOpened(7, fc)
+			checker.StreamCompleted(7)
+			checker.reportPending()
+			Expect(violations).To(BeEmpty())
+		})
+
+		It("reports a stream that is opened twice", func() {
+			checker.StreamOpened(5, mocks.NewMockStreamFlowController(mockCtrl))
+			checker.StreamOpened(5, mocks.NewMockStreamFlowController(mockCtrl))
+			// the violation is only reported by the run loop
+			Expect(violations).To(BeEmpty())
+			checker.reportPending()
+			Expect(violations).To(HaveLen(1))
+			Expect(violations[0].Invariant).To(Equal(invariantStreamTransitions))
+			Expect(violations[0].Details).To(Equal("stream 5 was opened twice"))
+		})
+
+		It("reports a stream that is reopened after it was completed", func() {
+			fc := mocks.NewMockStreamFlowController(mockCtrl)
+			fc.EXPECT().GetOffsets()
+			checker.StreamOpened(5, fc)
+			checker.StreamCompleted(5)
+			checker.StreamOpened(5, mocks.NewMockStreamFlowController(mockCtrl))
+			checker.reportPending()
+			Expect(violations).To(HaveLen(1))
+			Expect(violations[0].Details).To(Equal("stream 5 was reopened after it was completed"))
+		})
+
+		It("reports a stream that is completed twice", func() {
+			fc := mocks.NewMockStreamFlowController(mockCtrl)
+			fc.EXPECT().GetOffsets()
+			checker.StreamOpened(5, fc)
+			checker.StreamCompleted(5)
+			checker.StreamCompleted(5)
+			checker.reportPending()
+			Expect(violations).To(HaveLen(1))
+			Expect(violations[0].Details).To(Equal("stream 5 was completed twice"))
+		})
+
+		It("reports a stream that is completed without being opened", func() {
+			checker.StreamCompleted(5)
+			checker.reportPending()
+			Expect(violations).To(HaveLen(1))
+			Expect(violations[0].Details).To(Equal("stream 5 was completed, but it was never opened"))
+		})
+
+		It("can be used concurrently with Check", func() {
+			connFlowController.EXPECT().GetOffsets().AnyTimes()
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				for i := 0; i < 100; i++ {
+					fc := mocks.NewMockStreamFlowController(mockCtrl)
+					fc.EXPECT().GetOffsets().AnyTimes()
+					id := protocol.StreamID(4*i + 1)
+					checker.StreamOpened(id, fc)
+					checker.StreamCompleted(id)
+				}
+			}()
+			for i := 0; i < 100; i++ {
+				checker.Check()
+			}
+			Eventually(done).Should(BeClosed())
+			checker.Check()
+			Expect(violations).To(BeEmpty())
+		})
+	})
+
+	Context("flow control accounting", func() {
+		var str1, str2 *mocks.MockStreamFlowController
+
+		BeforeEach(func() {
+			str1 = mocks.NewMockStreamFlowController(mockCtrl)
+			str2 = mocks.NewMockStreamFlowController(mockCtrl)
+			checker.StreamOpened(5, str1)
+			checker.StreamOpened(7, str2)
+		})
+
+		It("accepts consistent offsets", func() {
+			str1.EXPECT().GetOffsets().Return(flowcontrol.Offsets{BytesSent: 100, BytesRead: 10, HighestReceived: 20, ReceiveWindow: 50}).Times(2)
+			str2.EXPECT().GetOffsets().Return(flowcontrol.Offsets{BytesSent: 200, BytesRead: 30, HighestReceived: 30, ReceiveWindow: 50}).Times(2)
+			connFlowController.EXPECT().GetOffsets().Return(flowcontrol.Offsets{BytesSent: 300, BytesRead: 35, HighestReceived: 50, ReceiveWindow: 100}).Times(2)
+			checker.Check()
+			// the offsets of completed streams are still accounted for
+			checker.StreamCompleted(7)
+			checker.Check()
+			Expect(violations).To(BeEmpty())
+		})
+
+		It("ignores streams that don't contribute to connection-level flow control", func() {
+			cryptoStream := mocks.NewMockStreamFlowController(mockCtrl)
+			checker.StreamOpened(protocol.VersionWhatever.CryptoStreamID(), cryptoStream)
+			cryptoStream.EXPECT().GetOffsets().Return(flowcontrol.Offsets{BytesSent: 1000, BytesRead: 1000, HighestReceived: 1000, ReceiveWindow: 1000})
+			str1.EXPECT().GetOffsets().Return(flowcontrol.Offsets{BytesSent: 100, ReceiveWindow: 50})
+			str2.EXPECT().GetOffsets().Return(flowcontrol.Offsets{ReceiveWindow: 50})
+			connFlowController.EXPECT().GetOffsets().Return(flowcontrol.Offsets{BytesSent: 100, ReceiveWindow: 100})
+			checker.Check()
+			Expect(violations).To(BeEmpty())
+		})
+
+		It("reports when the connection sent a different number of bytes than the streams", func() {
+			str1.EXPECT().GetOffsets().Return(flowcontrol.Offsets{BytesSent: 100, ReceiveWindow: 50})
+			str2.EXPECT().GetOffsets().Return(flowcontrol.Offsets{BytesSent: 200, ReceiveWindow: 50})
+			connFlowController.EXPECT().GetOffsets().Return(flowcontrol.Offsets{BytesSent: 299, ReceiveWindow: 100})
+			checker.Check()
+			Expect(violations).To(HaveLen(1))
+			Expect(violations[0].Invariant).To(Equal(invariantFlowControl))
+			Expect(violations[0].Details).To(Equal("connection sent 299 bytes, streams sent 300 bytes"))
+		})
+
+		It("reports when the connection received a different number of bytes than the streams", func() {
+			str1.EXPECT().GetOffsets().Return(flowcontrol.Offsets{HighestReceived: 20, ReceiveWindow: 50})
+			str2.EXPECT().GetOffsets().Return(flowcontrol.Offsets{HighestReceived: 30, ReceiveWindow: 50})
+			connFlowController.EXPECT().GetOffsets().Return(flowcontrol.Offsets{HighestReceived: 51, ReceiveWindow: 100})
+			checker.Check()
+			Expect(violations).To(HaveLen(1))
+			Expect(violations[0].Details).To(Equal("connection received 51 bytes, streams received 50 bytes"))
+		})
+
+		It("reports when the connection read more bytes than the streams", func() {
+			str1.EXPECT().GetOffsets().Return(flowcontrol.Offsets{BytesRead: 20, HighestReceived: 30, ReceiveWindow: 50})
+			str2.EXPECT().GetOffsets().Return(flowcontrol.Offsets{BytesRead: 30, HighestReceived: 30, ReceiveWindow: 50})
+			connFlowController.EXPECT().GetOffsets().Return(flowcontrol.Offsets{BytesRead: 51, HighestReceived: 60, ReceiveWindow: 100})
+			checker.Check()
+			Expect(violations).To(HaveLen(1))
+			Expect(violations[0].Details).To(Equal("connection read 51 bytes, streams read 50 bytes"))
+		})
+
+		It("reports when a stream received data beyond its receive window", func() {
+			str1.EXPECT().GetOffsets().Return(flowcontrol.Offsets{HighestReceived: 51, ReceiveWindow: 50})
+			str2.EXPECT().GetOffsets().Return(flowcontrol.Offsets{ReceiveWindow: 50})
+			connFlowController.EXPECT().GetOffsets().Return(flowcontrol.Offsets{HighestReceived: 51, ReceiveWindow: 100})
+			checker.Check()
+			Expect(violations).To(HaveLen(1))
+			Expect(violations[0].Details).To(Equal("stream 5: read 0 bytes, highest received offset 51, receive window 50"))
+		})
+
+		It("reports when the connection read more than it received", func() {
+			str1.EXPECT().GetOffsets().Return(flowcontrol.Offsets{BytesRead: 20, HighestReceived: 20, ReceiveWindow: 50})
+			str2.EXPECT().GetOffsets().Return(flowcontrol.Offsets{ReceiveWindow: 50})
+			connFlowController.EXPECT().GetOffsets().Return(flowcontrol.Offsets{BytesRead: 20, HighestReceived: 10, ReceiveWindow: 100})
+			checker.Check()
+			Expect(violations).To(HaveLen(1))
+			Expect(violations[0].Details).To(Equal("connection: read 20 bytes, highest received offset 10, receive window 100"))
+		})
+	})
+})
@@ -79,6 +79,7 @@ func tlsToMintConfig(tlsConf *tls.Config, pers protocol.Perspective) (*mint.Conf
 		mconf.Certificates = make([]*mint.Certificate, len(tlsConf.Certificates))
 		mconf.RootCAs = tlsConf.RootCAs
 		mconf.VerifyPeerCertificate = tlsConf.VerifyPeerCertificate
+		mconf.NextProtos = tlsConf.NextProtos
 		for i, certChain := range tlsConf.Certificates {
 			mconf.Certificates[i] = &mint.Certificate{
 				Chain:      make([]*x509.Certificate, len(certChain.Certificate)),
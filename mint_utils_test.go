@@ -64,6 +64,7 @@ var _ = Describe("Packing and unpacking Initial packets", func() {
 				VerifyPeerCertificate: func(_ [][]byte, _ [][]*x509.Certificate) error {
 					return verifyErr
 				},
+				NextProtos: []string{"h3", "hq"},
 			}
 			mintConf, err := tlsToMintConfig(tlsConf, protocol.PerspectiveClient)
 			Expect(err).ToNot(HaveOccurred())
@@ -71,6 +72,7 @@ var _ = Describe("Packing and unpacking Initial packets", func() {
 			Expect(mintConf.ServerName).To(Equal("www.example.com"))
 			Expect(mintConf.InsecureSkipVerify).To(BeTrue())
 			Expect(mintConf.VerifyPeerCertificate(nil, nil)).To(MatchError(verifyErr))
+			Expect(mintConf.NextProtos).To(Equal([]string{"h3", "hq"}))
 		})
 
 		It("requires client authentication", func() {
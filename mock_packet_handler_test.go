@@ -8,6 +8,7 @@ import (
 	context "context"
 	net "net"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	handshake "github.com/lucas-clemente/quic-go/internal/handshake"
@@ -75,6 +76,30 @@ func (mr *MockPacketHandlerMockRecorder) Close(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockPacketHandler)(nil).Close), arg0)
 }
 
+// CloseWithError mocks base method
+func (m *MockPacketHandler) CloseWithError(arg0 protocol.ApplicationErrorCode, arg1 string) error {
+	ret := m.ctrl.Call(m, "CloseWithError", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CloseWithError indicates an expected call of CloseWithError
+func (mr *MockPacketHandlerMockRecorder) CloseWithError(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CloseWithError", reflect.TypeOf((*MockPacketHandler)(nil).CloseWithError), arg0, arg1)
+}
+
+// CongestionState mocks base method
+func (m *MockPacketHandler) CongestionState() *CongestionState {
+	ret := m.ctrl.Call(m, "CongestionState")
+	ret0, _ := ret[0].(*CongestionState)
+	return ret0
+}
+
+// CongestionState indicates an expected call of CongestionState
+func (mr *MockPacketHandlerMockRecorder) CongestionState() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CongestionState", reflect.TypeOf((*MockPacketHandler)(nil).CongestionState))
+}
+
 // ConnectionState mocks base method
 func (m *MockPacketHandler) ConnectionState() handshake.ConnectionState {
 	ret := m.ctrl.Call(m, "ConnectionState")
@@ -99,6 +124,18 @@ func (mr *MockPacketHandlerMockRecorder) Context() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Context", reflect.TypeOf((*MockPacketHandler)(nil).Context))
 }
 
+// CorrelationID mocks base method
+func (m *MockPacketHandler) CorrelationID() string {
+	ret := m.ctrl.Call(m, "CorrelationID")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// CorrelationID indicates an expected call of CorrelationID
+func (mr *MockPacketHandlerMockRecorder) CorrelationID() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CorrelationID", reflect.TypeOf((*MockPacketHandler)(nil).CorrelationID))
+}
+
 // GetVersion mocks base method
 func (m *MockPacketHandler) GetVersion() protocol.VersionNumber {
 	ret := m.ctrl.Call(m, "GetVersion")
@@ -123,6 +160,18 @@ func (mr *MockPacketHandlerMockRecorder) LocalAddr() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LocalAddr", reflect.TypeOf((*MockPacketHandler)(nil).LocalAddr))
 }
 
+// Migrate mocks base method
+func (m *MockPacketHandler) Migrate(arg0 net.PacketConn) error {
+	ret := m.ctrl.Call(m, "Migrate", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Migrate indicates an expected call of Migrate
+func (mr *MockPacketHandlerMockRecorder) Migrate(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Migrate", reflect.TypeOf((*MockPacketHandler)(nil).Migrate), arg0)
+}
+
 // OpenStream mocks base method
 func (m *MockPacketHandler) OpenStream() (Stream, error) {
 	ret := m.ctrl.Call(m, "OpenStream")
@@ -187,6 +236,84 @@ func (mr *MockPacketHandlerMockRecorder) RemoteAddr() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoteAddr", reflect.TypeOf((*MockPacketHandler)(nil).RemoteAddr))
 }
 
+// SetDSCP mocks base method
+func (m *MockPacketHandler) SetDSCP(arg0 byte) error {
+	ret := m.ctrl.Call(m, "SetDSCP", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetDSCP indicates an expected call of SetDSCP
+func (mr *MockPacketHandlerMockRecorder) SetDSCP(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDSCP", reflect.TypeOf((*MockPacketHandler)(nil).SetDSCP), arg0)
+}
+
+// SetIdleTimeout mocks base method
+func (m *MockPacketHandler) SetIdleTimeout(arg0 time.Duration) {
+	m.ctrl.Call(m, "SetIdleTimeout", arg0)
+}
+
+// SetIdleTimeout indicates an expected call of SetIdleTimeout
+func (mr *MockPacketHandlerMockRecorder) SetIdleTimeout(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetIdleTimeout", reflect.TypeOf((*MockPacketHandler)(nil).SetIdleTimeout), arg0)
+}
+
+// SetTTL mocks base method
+func (m *MockPacketHandler) SetTTL(arg0 byte) {
+	m.ctrl.Call(m, "SetTTL", arg0)
+}
+
+// SetTTL indicates an expected call of SetTTL
+func (mr *MockPacketHandlerMockRecorder) SetTTL(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTTL", reflect.TypeOf((*MockPacketHandler)(nil).SetTTL), arg0)
+}
+
+// SetUserData mocks base method
+func (m *MockPacketHandler) SetUserData(arg0 interface{}) {
+	m.ctrl.Call(m, "SetUserData", arg0)
+}
+
+// SetUserData indicates an expected call of SetUserData
+func (mr *MockPacketHandlerMockRecorder) SetUserData(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserData", reflect.TypeOf((*MockPacketHandler)(nil).SetUserData), arg0)
+}
+
+// Stats mocks base method
+func (m *MockPacketHandler) Stats() SessionStats {
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(SessionStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats
+func (mr *MockPacketHandlerMockRecorder) Stats() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockPacketHandler)(nil).Stats))
+}
+
+// UserData mocks base method
+func (m *MockPacketHandler) UserData() interface{} {
+	ret := m.ctrl.Call(m, "UserData")
+	ret0, _ := ret[0].(interface{})
+	return ret0
+}
+
+// UserData indicates an expected call of UserData
+func (mr *MockPacketHandlerMockRecorder) UserData() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserData", reflect.TypeOf((*MockPacketHandler)(nil).UserData))
+}
+
+// WaitForHandshakeConfirmation mocks base method
+func (m *MockPacketHandler) WaitForHandshakeConfirmation(arg0 context.Context) error {
+	ret := m.ctrl.Call(m, "WaitForHandshakeConfirmation", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WaitForHandshakeConfirmation indicates an expected call of WaitForHandshakeConfirmation
+func (mr *MockPacketHandlerMockRecorder) WaitForHandshakeConfirmation(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitForHandshakeConfirmation", reflect.TypeOf((*MockPacketHandler)(nil).WaitForHandshakeConfirmation), arg0)
+}
+
 // closeRemote mocks base method
 func (m *MockPacketHandler) closeRemote(arg0 error) {
 	m.ctrl.Call(m, "closeRemote", arg0)
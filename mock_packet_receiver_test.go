@@ -0,0 +1,58 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/lucas-clemente/quic-go (interfaces: PacketReceiver)
+
+// Package quic is a generated GoMock package.
+package quic
+
+import (
+	net "net"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockPacketReceiver is a mock of PacketReceiver interface
+type MockPacketReceiver struct {
+	ctrl     *gomock.Controller
+	recorder *MockPacketReceiverMockRecorder
+}
+
+// MockPacketReceiverMockRecorder is the mock recorder for MockPacketReceiver
+type MockPacketReceiverMockRecorder struct {
+	mock *MockPacketReceiver
+}
+
+// NewMockPacketReceiver creates a new mock instance
+func NewMockPacketReceiver(ctrl *gomock.Controller) *MockPacketReceiver {
+	mock := &MockPacketReceiver{ctrl: ctrl}
+	mock.recorder = &MockPacketReceiverMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockPacketReceiver) EXPECT() *MockPacketReceiverMockRecorder {
+	return m.recorder
+}
+
+// closeWithError mocks base method
+func (m *MockPacketReceiver) closeWithError(arg0 error) {
+	m.ctrl.Call(m, "closeWithError", arg0)
+}
+
+// closeWithError indicates an expected call of closeWithError
+func (mr *MockPacketReceiverMockRecorder) closeWithError(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "closeWithError", reflect.TypeOf((*MockPacketReceiver)(nil).closeWithError), arg0)
+}
+
+// handlePacket mocks base method
+func (m *MockPacketReceiver) handlePacket(arg0 net.Addr, arg1 []byte, arg2 *[]byte, arg3 packetInfo) error {
+	ret := m.ctrl.Call(m, "handlePacket", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// handlePacket indicates an expected call of handlePacket
+func (mr *MockPacketReceiverMockRecorder) handlePacket(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handlePacket", reflect.TypeOf((*MockPacketReceiver)(nil).handlePacket), arg0, arg1, arg2, arg3)
+}
+
@@ -73,6 +73,18 @@ func (mr *MockReceiveStreamIMockRecorder) SetReadDeadline(arg0 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReadDeadline", reflect.TypeOf((*MockReceiveStreamI)(nil).SetReadDeadline), arg0)
 }
 
+// Stats mocks base method
+func (m *MockReceiveStreamI) Stats() StreamStats {
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(StreamStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats
+func (mr *MockReceiveStreamIMockRecorder) Stats() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockReceiveStreamI)(nil).Stats))
+}
+
 // StreamID mocks base method
 func (m *MockReceiveStreamI) StreamID() protocol.StreamID {
 	ret := m.ctrl.Call(m, "StreamID")
@@ -107,6 +119,18 @@ func (mr *MockReceiveStreamIMockRecorder) getWindowUpdate() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "getWindowUpdate", reflect.TypeOf((*MockReceiveStreamI)(nil).getWindowUpdate))
 }
 
+// handleExpiredStreamDataFrame mocks base method
+func (m *MockReceiveStreamI) handleExpiredStreamDataFrame(arg0 *wire.ExpiredStreamDataFrame) error {
+	ret := m.ctrl.Call(m, "handleExpiredStreamDataFrame", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// handleExpiredStreamDataFrame indicates an expected call of handleExpiredStreamDataFrame
+func (mr *MockReceiveStreamIMockRecorder) handleExpiredStreamDataFrame(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleExpiredStreamDataFrame", reflect.TypeOf((*MockReceiveStreamI)(nil).handleExpiredStreamDataFrame), arg0)
+}
+
 // handleRstStreamFrame mocks base method
 func (m *MockReceiveStreamI) handleRstStreamFrame(arg0 *wire.RstStreamFrame) error {
 	ret := m.ctrl.Call(m, "handleRstStreamFrame", arg0)
@@ -73,6 +73,16 @@ func (mr *MockSendStreamIMockRecorder) Context() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Context", reflect.TypeOf((*MockSendStreamI)(nil).Context))
 }
 
+// SetDataLifetime mocks base method
+func (m *MockSendStreamI) SetDataLifetime(arg0 time.Duration) {
+	m.ctrl.Call(m, "SetDataLifetime", arg0)
+}
+
+// SetDataLifetime indicates an expected call of SetDataLifetime
+func (mr *MockSendStreamIMockRecorder) SetDataLifetime(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDataLifetime", reflect.TypeOf((*MockSendStreamI)(nil).SetDataLifetime), arg0)
+}
+
 // SetWriteDeadline mocks base method
 func (m *MockSendStreamI) SetWriteDeadline(arg0 time.Time) error {
 	ret := m.ctrl.Call(m, "SetWriteDeadline", arg0)
@@ -85,6 +95,18 @@ func (mr *MockSendStreamIMockRecorder) SetWriteDeadline(arg0 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetWriteDeadline", reflect.TypeOf((*MockSendStreamI)(nil).SetWriteDeadline), arg0)
 }
 
+// Stats mocks base method
+func (m *MockSendStreamI) Stats() StreamStats {
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(StreamStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats
+func (mr *MockSendStreamIMockRecorder) Stats() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockSendStreamI)(nil).Stats))
+}
+
 // StreamID mocks base method
 func (m *MockSendStreamI) StreamID() protocol.StreamID {
 	ret := m.ctrl.Call(m, "StreamID")
@@ -110,6 +132,29 @@ func (mr *MockSendStreamIMockRecorder) Write(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Write", reflect.TypeOf((*MockSendStreamI)(nil).Write), arg0)
 }
 
+// WriteVectored mocks base method
+func (m *MockSendStreamI) WriteVectored(arg0 [][]byte) (int, error) {
+	ret := m.ctrl.Call(m, "WriteVectored", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WriteVectored indicates an expected call of WriteVectored
+func (mr *MockSendStreamIMockRecorder) WriteVectored(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteVectored", reflect.TypeOf((*MockSendStreamI)(nil).WriteVectored), arg0)
+}
+
+// addRetransmittedBytes mocks base method
+func (m *MockSendStreamI) addRetransmittedBytes(arg0 protocol.ByteCount) {
+	m.ctrl.Call(m, "addRetransmittedBytes", arg0)
+}
+
+// addRetransmittedBytes indicates an expected call of addRetransmittedBytes
+func (mr *MockSendStreamIMockRecorder) addRetransmittedBytes(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "addRetransmittedBytes", reflect.TypeOf((*MockSendStreamI)(nil).addRetransmittedBytes), arg0)
+}
+
 // closeForShutdown mocks base method
 func (m *MockSendStreamI) closeForShutdown(arg0 error) {
 	m.ctrl.Call(m, "closeForShutdown", arg0)
@@ -120,6 +165,18 @@ func (mr *MockSendStreamIMockRecorder) closeForShutdown(arg0 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "closeForShutdown", reflect.TypeOf((*MockSendStreamI)(nil).closeForShutdown), arg0)
 }
 
+// dropExpiredData mocks base method
+func (m *MockSendStreamI) dropExpiredData(arg0 *wire.StreamFrame) *wire.StreamFrame {
+	ret := m.ctrl.Call(m, "dropExpiredData", arg0)
+	ret0, _ := ret[0].(*wire.StreamFrame)
+	return ret0
+}
+
+// dropExpiredData indicates an expected call of dropExpiredData
+func (mr *MockSendStreamIMockRecorder) dropExpiredData(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "dropExpiredData", reflect.TypeOf((*MockSendStreamI)(nil).dropExpiredData), arg0)
+}
+
 // handleMaxStreamDataFrame mocks base method
 func (m *MockSendStreamI) handleMaxStreamDataFrame(arg0 *wire.MaxStreamDataFrame) {
 	m.ctrl.Call(m, "handleMaxStreamDataFrame", arg0)
@@ -34,6 +34,38 @@ func (m *MockSessionRunner) EXPECT() *MockSessionRunnerMockRecorder {
 	return m.recorder
 }
 
+// addConnectionID mocks base method
+func (m *MockSessionRunner) addConnectionID(arg0 protocol.ConnectionID, arg1 packetHandler) {
+	m.ctrl.Call(m, "addConnectionID", arg0, arg1)
+}
+
+// addConnectionID indicates an expected call of addConnectionID
+func (mr *MockSessionRunnerMockRecorder) addConnectionID(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "addConnectionID", reflect.TypeOf((*MockSessionRunner)(nil).addConnectionID), arg0, arg1)
+}
+
+// addResetToken mocks base method
+func (m *MockSessionRunner) addResetToken(arg0 [16]byte) {
+	m.ctrl.Call(m, "addResetToken", arg0)
+}
+
+// addResetToken indicates an expected call of addResetToken
+func (mr *MockSessionRunnerMockRecorder) addResetToken(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "addResetToken", reflect.TypeOf((*MockSessionRunner)(nil).addResetToken), arg0)
+}
+
+// getStatelessResetToken mocks base method
+func (m *MockSessionRunner) getStatelessResetToken(arg0 protocol.ConnectionID) [16]byte {
+	ret := m.ctrl.Call(m, "getStatelessResetToken", arg0)
+	ret0, _ := ret[0].([16]byte)
+	return ret0
+}
+
+// getStatelessResetToken indicates an expected call of getStatelessResetToken
+func (mr *MockSessionRunnerMockRecorder) getStatelessResetToken(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "getStatelessResetToken", reflect.TypeOf((*MockSessionRunner)(nil).getStatelessResetToken), arg0)
+}
+
 // onHandshakeComplete mocks base method
 func (m *MockSessionRunner) onHandshakeComplete(arg0 packetHandler) {
 	m.ctrl.Call(m, "onHandshakeComplete", arg0)
@@ -53,3 +85,13 @@ func (m *MockSessionRunner) removeConnectionID(arg0 protocol.ConnectionID) {
 func (mr *MockSessionRunnerMockRecorder) removeConnectionID(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "removeConnectionID", reflect.TypeOf((*MockSessionRunner)(nil).removeConnectionID), arg0)
 }
+
+// removeResetToken mocks base method
+func (m *MockSessionRunner) removeResetToken(arg0 [16]byte) {
+	m.ctrl.Call(m, "removeResetToken", arg0)
+}
+
+// removeResetToken indicates an expected call of removeResetToken
+func (mr *MockSessionRunnerMockRecorder) removeResetToken(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "removeResetToken", reflect.TypeOf((*MockSessionRunner)(nil).removeResetToken), arg0)
+}
@@ -98,6 +98,16 @@ func (mr *MockStreamIMockRecorder) Read(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockStreamI)(nil).Read), arg0)
 }
 
+// SetDataLifetime mocks base method
+func (m *MockStreamI) SetDataLifetime(arg0 time.Duration) {
+	m.ctrl.Call(m, "SetDataLifetime", arg0)
+}
+
+// SetDataLifetime indicates an expected call of SetDataLifetime
+func (mr *MockStreamIMockRecorder) SetDataLifetime(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDataLifetime", reflect.TypeOf((*MockStreamI)(nil).SetDataLifetime), arg0)
+}
+
 // SetDeadline mocks base method
 func (m *MockStreamI) SetDeadline(arg0 time.Time) error {
 	ret := m.ctrl.Call(m, "SetDeadline", arg0)
@@ -134,6 +144,18 @@ func (mr *MockStreamIMockRecorder) SetWriteDeadline(arg0 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetWriteDeadline", reflect.TypeOf((*MockStreamI)(nil).SetWriteDeadline), arg0)
 }
 
+// Stats mocks base method
+func (m *MockStreamI) Stats() StreamStats {
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(StreamStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats
+func (mr *MockStreamIMockRecorder) Stats() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockStreamI)(nil).Stats))
+}
+
 // StreamID mocks base method
 func (m *MockStreamI) StreamID() protocol.StreamID {
 	ret := m.ctrl.Call(m, "StreamID")
@@ -159,6 +181,29 @@ func (mr *MockStreamIMockRecorder) Write(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Write", reflect.TypeOf((*MockStreamI)(nil).Write), arg0)
 }
 
+// WriteVectored mocks base method
+func (m *MockStreamI) WriteVectored(arg0 [][]byte) (int, error) {
+	ret := m.ctrl.Call(m, "WriteVectored", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WriteVectored indicates an expected call of WriteVectored
+func (mr *MockStreamIMockRecorder) WriteVectored(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteVectored", reflect.TypeOf((*MockStreamI)(nil).WriteVectored), arg0)
+}
+
+// addRetransmittedBytes mocks base method
+func (m *MockStreamI) addRetransmittedBytes(arg0 protocol.ByteCount) {
+	m.ctrl.Call(m, "addRetransmittedBytes", arg0)
+}
+
+// addRetransmittedBytes indicates an expected call of addRetransmittedBytes
+func (mr *MockStreamIMockRecorder) addRetransmittedBytes(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "addRetransmittedBytes", reflect.TypeOf((*MockStreamI)(nil).addRetransmittedBytes), arg0)
+}
+
 // closeForShutdown mocks base method
 func (m *MockStreamI) closeForShutdown(arg0 error) {
 	m.ctrl.Call(m, "closeForShutdown", arg0)
@@ -169,6 +214,18 @@ func (mr *MockStreamIMockRecorder) closeForShutdown(arg0 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "closeForShutdown", reflect.TypeOf((*MockStreamI)(nil).closeForShutdown), arg0)
 }
 
+// dropExpiredData mocks base method
+func (m *MockStreamI) dropExpiredData(arg0 *wire.StreamFrame) *wire.StreamFrame {
+	ret := m.ctrl.Call(m, "dropExpiredData", arg0)
+	ret0, _ := ret[0].(*wire.StreamFrame)
+	return ret0
+}
+
+// dropExpiredData indicates an expected call of dropExpiredData
+func (mr *MockStreamIMockRecorder) dropExpiredData(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "dropExpiredData", reflect.TypeOf((*MockStreamI)(nil).dropExpiredData), arg0)
+}
+
 // getWindowUpdate mocks base method
 func (m *MockStreamI) getWindowUpdate() protocol.ByteCount {
 	ret := m.ctrl.Call(m, "getWindowUpdate")
@@ -181,6 +238,18 @@ func (mr *MockStreamIMockRecorder) getWindowUpdate() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "getWindowUpdate", reflect.TypeOf((*MockStreamI)(nil).getWindowUpdate))
 }
 
+// handleExpiredStreamDataFrame mocks base method
+func (m *MockStreamI) handleExpiredStreamDataFrame(arg0 *wire.ExpiredStreamDataFrame) error {
+	ret := m.ctrl.Call(m, "handleExpiredStreamDataFrame", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// handleExpiredStreamDataFrame indicates an expected call of handleExpiredStreamDataFrame
+func (mr *MockStreamIMockRecorder) handleExpiredStreamDataFrame(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleExpiredStreamDataFrame", reflect.TypeOf((*MockStreamI)(nil).handleExpiredStreamDataFrame), arg0)
+}
+
 // handleMaxStreamDataFrame mocks base method
 func (m *MockStreamI) handleMaxStreamDataFrame(arg0 *wire.MaxStreamDataFrame) {
 	m.ctrl.Call(m, "handleMaxStreamDataFrame", arg0)
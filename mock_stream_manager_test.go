@@ -122,6 +122,18 @@ func (mr *MockStreamManagerMockRecorder) HandleMaxStreamIDFrame(arg0 interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandleMaxStreamIDFrame", reflect.TypeOf((*MockStreamManager)(nil).HandleMaxStreamIDFrame), arg0)
 }
 
+// NumStreams mocks base method
+func (m *MockStreamManager) NumStreams() int {
+	ret := m.ctrl.Call(m, "NumStreams")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// NumStreams indicates an expected call of NumStreams
+func (mr *MockStreamManagerMockRecorder) NumStreams() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NumStreams", reflect.TypeOf((*MockStreamManager)(nil).NumStreams))
+}
+
 // OpenStream mocks base method
 func (m *MockStreamManager) OpenStream() (Stream, error) {
 	ret := m.ctrl.Call(m, "OpenStream")
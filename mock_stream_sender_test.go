@@ -55,6 +55,16 @@ func (mr *MockStreamSenderMockRecorder) onStreamCompleted(arg0 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "onStreamCompleted", reflect.TypeOf((*MockStreamSender)(nil).onStreamCompleted), arg0)
 }
 
+// onStreamOpened mocks base method
+func (m *MockStreamSender) onStreamOpened(arg0 streamRecorder) {
+	m.ctrl.Call(m, "onStreamOpened", arg0)
+}
+
+// onStreamOpened indicates an expected call of onStreamOpened
+func (mr *MockStreamSenderMockRecorder) onStreamOpened(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "onStreamOpened", reflect.TypeOf((*MockStreamSender)(nil).onStreamOpened), arg0)
+}
+
 // queueControlFrame mocks base method
 func (m *MockStreamSender) queueControlFrame(arg0 wire.Frame) {
 	m.ctrl.Call(m, "queueControlFrame", arg0)
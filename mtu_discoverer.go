@@ -0,0 +1,205 @@
+package quic
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+const (
+	// the time between two MTU probes, in multiples of the smoothed RTT
+	mtuProbeDelay = 5
+	// the number of times a probe of the same size is lost before we give up on that size
+	maxLostMTUProbes = 3
+	// the search is finished when the difference between the largest size that worked
+	// and the smallest size that didn't work is smaller than this value
+	mtuSearchPrecision = 20
+	// when the search is finished, it is restarted after this time, in case the path MTU increased
+	mtuReprobeInterval = 10 * time.Minute
+	// the number of packets larger than the base size that are lost in a row (without any of these packets being acknowledged)
+	// before we assume that the path MTU decreased, and fall back to the base size
+	maxLostFullSizePackets = 5
+)
+
+// The mtuDiscoverer implements Datagram Packetization Layer Path MTU Discovery (DPLPMTUD).
+// It starts with a packet size that is known to be safe, and periodically sends probe packets
+// (PING frames padded to the probe size), using a binary search between the current size and the maximum size.
+// When a probe is acknowledged, the max packet size is increased to the size of the probe.
+// When a probe is lost repeatedly, the upper bound of the search is lowered.
+// Lost probes are not retransmitted, and they are not considered a sign of congestion, see ackhandler.Packet.
+// If the path MTU decreases (a black hole), packets larger than the base size are lost repeatedly.
+// The discoverer then falls back to the base size, and restarts the search.
+type mtuDiscoverer struct {
+	rttStats *congestion.RTTStats
+
+	// base is the packet size used before the discovery was started, it is assumed to work on every path
+	base protocol.ByteCount
+	// current is the largest packet size that is known to work
+	current protocol.ByteCount
+	// max is the maximum packet size the peer is willing to receive
+	max protocol.ByteCount
+	// upper is the upper bound of the current search
+	upper protocol.ByteCount
+
+	// the size of the probe that is in flight, 0 if no probe is in flight
+	inFlight protocol.ByteCount
+	// the number of lost probes of the next probe size
+	numLost int
+	// the number of packets larger than the base size that were lost since the last one was acknowledged
+	numLostFullSize int
+	// the time when the next probe should be sent, the zero time if discovery wasn't started
+	nextProbe time.Time
+}
+
+func newMTUDiscoverer(rttStats *congestion.RTTStats) *mtuDiscoverer {
+	return &mtuDiscoverer{rttStats: rttStats}
+}
+
+// Start starts the discovery, with base being the packet size that is known to be safe.
+func (d *mtuDiscoverer) Start(base, max protocol.ByteCount, now time.Time) {
+	d.base = base
+	d.current = base
+	d.max = max
+	d.upper = max
+	d.inFlight = 0
+	d.numLost = 0
+	d.numLostFullSize = 0
+	d.scheduleNextProbe(now)
+}
+
+// Restart restarts the discovery from the base size, e.g. after the session migrated to a new path.
+// It does nothing if the discovery wasn't started yet.
+func (d *mtuDiscoverer) Restart(now time.Time) {
+	if d.base == 0 {
+		return
+	}
+	d.Start(d.base, d.max, now)
+}
+
+// BaseSize returns the packet size that is used before the discovery was started.
+func (d *mtuDiscoverer) BaseSize() protocol.ByteCount {
+	return d.base
+}
+
+// CurrentSize returns the largest packet size that is known to work.
+func (d *mtuDiscoverer) CurrentSize() protocol.ByteCount {
+	return d.current
+}
+
+// ShouldSendProbe says if a probe packet should be sent now.
+func (d *mtuDiscoverer) ShouldSendProbe(now time.Time) bool {
+	return d.inFlight == 0 && !d.nextProbe.IsZero() && !now.Before(d.nextProbe)
+}
+
+// NextProbeSize returns the size of the next probe packet.
+// It must be called right before the probe packet is sent.
+func (d *mtuDiscoverer) NextProbeSize() protocol.ByteCount {
+	d.inFlight = (d.current + d.upper + 1) / 2
+	return d.inFlight
+}
+
+// OnProbeAcked is called when a probe packet of size bytes is acknowledged.
+// It returns true if the max packet size increased.
+// Probes sent before the discovery was restarted are ignored.
+func (d *mtuDiscoverer) OnProbeAcked(size protocol.ByteCount, now time.Time) bool {
+	if size != d.inFlight {
+		return false
+	}
+	d.inFlight = 0
+	d.numLost = 0
+	increased := size > d.current
+	if increased {
+		d.current = size
+	}
+	d.scheduleNextProbe(now)
+	return increased
+}
+
+// OnProbeLost is called when a probe packet of size bytes is declared lost.
+// Probes sent before the discovery was restarted are ignored.
+func (d *mtuDiscoverer) OnProbeLost(size protocol.ByteCount, now time.Time) {
+	if size != d.inFlight {
+		return
+	}
+	d.inFlight = 0
+	d.numLost++
+	if d.numLost >= maxLostMTUProbes {
+		d.numLost = 0
+		d.upper = size - 1
+	}
+	d.scheduleNextProbe(now)
+}
+
+// OnProbeRejected is called when sending a probe packet of size bytes failed,
+// because it is larger than the path MTU known to the kernel.
+// There's no need to try this size again.
+func (d *mtuDiscoverer) OnProbeRejected(size protocol.ByteCount, now time.Time) {
+	if size != d.inFlight {
+		return
+	}
+	d.inFlight = 0
+	d.numLost = 0
+	d.upper = size - 1
+	d.scheduleNextProbe(now)
+}
+
+// OnPacketAcked is called when a packet (that is not a probe) of size bytes is acknowledged.
+func (d *mtuDiscoverer) OnPacketAcked(size protocol.ByteCount) {
+	if size > d.base {
+		d.numLostFullSize = 0
+	}
+}
+
+// OnPacketLost is called when a packet (that is not a probe) of size bytes is declared lost.
+// It returns true if the discoverer fell back to the base size.
+func (d *mtuDiscoverer) OnPacketLost(size protocol.ByteCount, now time.Time) bool {
+	if d.current <= d.base || size <= d.base {
+		return false
+	}
+	d.numLostFullSize++
+	if d.numLostFullSize < maxLostFullSizePackets {
+		return false
+	}
+	d.fallBack(d.max, now)
+	return true
+}
+
+// OnPacketRejected is called when sending a packet (that is not a probe) of size bytes failed,
+// because it is larger than the path MTU known to the kernel.
+// It returns false if the packet was not larger than the base size.
+// In that case, there is no smaller size the discoverer could fall back to.
+func (d *mtuDiscoverer) OnPacketRejected(size protocol.ByteCount, now time.Time) bool {
+	if size <= d.base {
+		return false
+	}
+	if d.current > d.base {
+		d.fallBack(size-1, now)
+	}
+	return true
+}
+
+// fallBack falls back to the base size, and restarts the search.
+func (d *mtuDiscoverer) fallBack(upper protocol.ByteCount, now time.Time) {
+	d.current = d.base
+	d.upper = upper
+	d.inFlight = 0
+	d.numLost = 0
+	d.numLostFullSize = 0
+	d.scheduleNextProbe(now)
+}
+
+func (d *mtuDiscoverer) scheduleNextProbe(now time.Time) {
+	if d.max < d.current+mtuSearchPrecision {
+		// there's nothing left to discover
+		d.nextProbe = time.Time{}
+		return
+	}
+	if d.upper < d.current+mtuSearchPrecision {
+		// The search is finished. Restart it later, since the path might have changed.
+		d.upper = d.max
+		d.nextProbe = now.Add(mtuReprobeInterval)
+		return
+	}
+	d.nextProbe = now.Add(mtuProbeDelay * d.rttStats.SmoothedOrInitialRTT())
+}
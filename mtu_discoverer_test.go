@@ -0,0 +1,149 @@
+package quic
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MTU Discoverer", func() {
+	const rtt = 100 * time.Millisecond
+	var (
+		d   *mtuDiscoverer
+		now time.Time
+	)
+
+	BeforeEach(func() {
+		rttStats := &congestion.RTTStats{}
+		rttStats.UpdateRTT(rtt, 0, time.Now())
+		Expect(rttStats.SmoothedRTT()).To(Equal(rtt))
+		d = newMTUDiscoverer(rttStats)
+		now = time.Now()
+	})
+
+	It("doesn't send probes before it is started", func() {
+		Expect(d.ShouldSendProbe(now.Add(time.Hour))).To(BeFalse())
+	})
+
+	It("increases the packet size when probes are acknowledged", func() {
+		d.Start(1252, 1452, now)
+		Expect(d.CurrentSize()).To(Equal(protocol.ByteCount(1252)))
+		Expect(d.ShouldSendProbe(now)).To(BeFalse())
+		now = now.Add(5 * rtt)
+		Expect(d.ShouldSendProbe(now)).To(BeTrue())
+		Expect(d.NextProbeSize()).To(Equal(protocol.ByteCount(1352)))
+		// only one probe is sent at a time
+		Expect(d.ShouldSendProbe(now.Add(time.Hour))).To(BeFalse())
+		Expect(d.OnProbeAcked(1352, now)).To(BeTrue())
+		Expect(d.CurrentSize()).To(Equal(protocol.ByteCount(1352)))
+		Expect(d.ShouldSendProbe(now)).To(BeFalse())
+		now = now.Add(5 * rtt)
+		Expect(d.ShouldSendProbe(now)).To(BeTrue())
+		Expect(d.NextProbeSize()).To(Equal(protocol.ByteCount(1402)))
+	})
+
+	It("lowers the upper bound of the search when probes of the same size are lost repeatedly", func() {
+		d.Start(1252, 1452, now)
+		for i := 0; i < maxLostMTUProbes; i++ {
+			now = now.Add(5 * rtt)
+			Expect(d.ShouldSendProbe(now)).To(BeTrue())
+			Expect(d.NextProbeSize()).To(Equal(protocol.ByteCount(1352)))
+			d.OnProbeLost(1352, now)
+		}
+		Expect(d.CurrentSize()).To(Equal(protocol.ByteCount(1252)))
+		now = now.Add(5 * rtt)
+		Expect(d.ShouldSendProbe(now)).To(BeTrue())
+		Expect(d.NextProbeSize()).To(Equal(protocol.ByteCount(1302)))
+	})
+
+	It("restarts the search after some time, when the search is finished", func() {
+		d.Start(1252, 1452, now)
+		for d.ShouldSendProbe(now.Add(5 * rtt)) {
+			now = now.Add(5 * rtt)
+			d.OnProbeLost(d.NextProbeSize(), now)
+		}
+		Expect(d.CurrentSize()).To(Equal(protocol.ByteCount(1252)))
+		Expect(d.ShouldSendProbe(now.Add(mtuReprobeInterval - time.Nanosecond))).To(BeFalse())
+		Expect(d.ShouldSendProbe(now.Add(mtuReprobeInterval))).To(BeTrue())
+		Expect(d.NextProbeSize()).To(Equal(protocol.ByteCount(1352)))
+	})
+
+	It("doesn't send probes if the maximum size is reached", func() {
+		d.Start(1252, 1452, now)
+		for d.ShouldSendProbe(now.Add(5 * rtt)) {
+			now = now.Add(5 * rtt)
+			Expect(d.OnProbeAcked(d.NextProbeSize(), now)).To(BeTrue())
+		}
+		Expect(d.CurrentSize()).To(BeNumerically(">", 1452-mtuSearchPrecision))
+		Expect(d.ShouldSendProbe(now.Add(time.Hour))).To(BeFalse())
+	})
+
+	It("lowers the upper bound of the search when a probe is rejected", func() {
+		d.Start(1252, 1452, now)
+		now = now.Add(5 * rtt)
+		Expect(d.NextProbeSize()).To(Equal(protocol.ByteCount(1352)))
+		d.OnProbeRejected(1352, now)
+		Expect(d.CurrentSize()).To(Equal(protocol.ByteCount(1252)))
+		now = now.Add(5 * rtt)
+		Expect(d.ShouldSendProbe(now)).To(BeTrue())
+		Expect(d.NextProbeSize()).To(Equal(protocol.ByteCount(1302)))
+	})
+
+	It("ignores results of probes that were sent before the discovery was restarted", func() {
+		d.Start(1252, 1452, now)
+		now = now.Add(5 * rtt)
+		Expect(d.NextProbeSize()).To(Equal(protocol.ByteCount(1352)))
+		d.Restart(now)
+		Expect(d.OnProbeAcked(1352, now)).To(BeFalse())
+		Expect(d.CurrentSize()).To(Equal(protocol.ByteCount(1252)))
+	})
+
+	It("falls back to the base size when full-size packets are lost repeatedly", func() {
+		d.Start(1252, 1452, now)
+		now = now.Add(5 * rtt)
+		Expect(d.OnProbeAcked(d.NextProbeSize(), now)).To(BeTrue())
+		Expect(d.CurrentSize()).To(Equal(protocol.ByteCount(1352)))
+		for i := 0; i < maxLostFullSizePackets-1; i++ {
+			Expect(d.OnPacketLost(1352, now)).To(BeFalse())
+		}
+		// losing smaller packets doesn't count
+		Expect(d.OnPacketLost(1252, now)).To(BeFalse())
+		Expect(d.OnPacketLost(1352, now)).To(BeTrue())
+		Expect(d.CurrentSize()).To(Equal(protocol.ByteCount(1252)))
+		// the search is restarted
+		now = now.Add(5 * rtt)
+		Expect(d.ShouldSendProbe(now)).To(BeTrue())
+		Expect(d.NextProbeSize()).To(Equal(protocol.ByteCount(1352)))
+	})
+
+	It("doesn't fall back when full-size packets are acknowledged", func() {
+		d.Start(1252, 1452, now)
+		now = now.Add(5 * rtt)
+		Expect(d.OnProbeAcked(d.NextProbeSize(), now)).To(BeTrue())
+		for i := 0; i < 2*maxLostFullSizePackets; i++ {
+			Expect(d.OnPacketLost(1352, now)).To(BeFalse())
+			d.OnPacketAcked(1352)
+		}
+		Expect(d.CurrentSize()).To(Equal(protocol.ByteCount(1352)))
+	})
+
+	It("falls back to the base size when a packet is rejected", func() {
+		d.Start(1252, 1452, now)
+		now = now.Add(5 * rtt)
+		Expect(d.OnProbeAcked(d.NextProbeSize(), now)).To(BeTrue())
+		Expect(d.OnPacketRejected(1352, now)).To(BeTrue())
+		Expect(d.CurrentSize()).To(Equal(protocol.ByteCount(1252)))
+		Expect(d.upper).To(Equal(protocol.ByteCount(1351)))
+		// there's nothing to fall back to if a packet of the base size is rejected
+		Expect(d.OnPacketRejected(1252, now)).To(BeFalse())
+	})
+
+	It("doesn't send probes if the maximum size is smaller than the current size", func() {
+		d.Start(1252, 1232, now)
+		Expect(d.ShouldSendProbe(now.Add(time.Hour))).To(BeFalse())
+	})
+})
@@ -0,0 +1,287 @@
+package quic
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"golang.org/x/net/ipv4"
+)
+
+// A packetInfo is the information about a packet that is transmitted in control messages.
+type packetInfo struct {
+	// ecn is the ECN codepoint of the packet
+	ecn protocol.ECN
+	// dscp is the Differentiated Services Code Point of the packet
+	dscp uint8
+	// ttl is the TTL (IPv4) or the hop limit (IPv6) of the packet.
+	// When sending, 0 means that the default of the socket is used.
+	ttl uint8
+	// localAddr and ifIndex are the local address and the interface that a packet was received on, or is sent from.
+	// They are only set for sockets that are bound to the unspecified address.
+	localAddr net.IP
+	ifIndex   uint32
+}
+
+// replyInfo returns the packetInfo for sending a reply to a packet that was received with this packetInfo.
+// The reply is sent from the address that the packet was received on, and it uses the default TOS and TTL.
+func (i packetInfo) replyInfo() packetInfo {
+	return packetInfo{localAddr: i.localAddr, ifIndex: i.ifIndex}
+}
+
+// An oobConn is a UDP connection that reads and writes control messages, see the platform-specific files.
+// It is used to read and set the TOS / Traffic Class field of the IP header, which contains the ECN codepoint and the DSCP,
+// as well as the TTL / hop limit.
+// If the socket is bound to the unspecified address (e.g. 0.0.0.0), it is also used to
+// learn the address a packet was sent to, such that the reply can be sent from the same address.
+// This is required on multi-homed hosts, where the kernel might otherwise choose a different source address.
+// Multiple packets are read and written in a single system call, using recvmmsg and sendmmsg,
+// or UDP GSO (generic segmentation offload) if the kernel supports it.
+type oobConn struct {
+	*net.UDPConn
+	// batchConn reads and writes batches of packets.
+	// It works for IPv4 and IPv6 sockets.
+	batchConn *ipv4.PacketConn
+	// oob is the buffer that ReadPacket reads the control messages into.
+	// Packets are only read by a single go routine, so it can be reused for every packet.
+	oob []byte
+
+	ttlEnabled        bool
+	packetInfoEnabled bool
+	// Reading the ECN codepoint is only enabled once a session uses ECN, see enableECN.
+	ecnOnce    sync.Once
+	ecnEnabled bool
+	// The Don't Fragment bit is only set once a session uses MTU discovery, see enableDF.
+	dfOnce    sync.Once
+	dfEnabled bool
+	// gsoEnabled is 1 if GSO is used, accessed atomically.
+	// It is reset to 0 if the network interface turns out not to support GSO.
+	gsoEnabled uint32
+}
+
+// wrapConn enables reading of control messages, if the net.PacketConn is a UDP connection and the platform supports it.
+// Otherwise, the net.PacketConn is returned unmodified.
+func wrapConn(pconn net.PacketConn) net.PacketConn {
+	if _, ok := pconn.(*oobConn); ok {
+		return pconn
+	}
+	c, ok := pconn.(*net.UDPConn)
+	if !ok {
+		return pconn
+	}
+	oc := &oobConn{
+		UDPConn:   c,
+		batchConn: ipv4.NewPacketConn(c),
+		oob:       make([]byte, oobSize),
+	}
+	if err := enableTTL(c); err != nil {
+		utils.DefaultLogger.Debugf("Not using the TTL on %s: %s", c.LocalAddr(), err)
+	} else {
+		oc.ttlEnabled = true
+	}
+	if addr, ok := c.LocalAddr().(*net.UDPAddr); ok && addr.IP.IsUnspecified() {
+		if err := enablePacketInfo(c); err != nil {
+			utils.DefaultLogger.Debugf("Not reading the destination address of packets on %s: %s", c.LocalAddr(), err)
+		} else {
+			oc.packetInfoEnabled = true
+		}
+	}
+	if err := enableGSO(c); err != nil {
+		utils.DefaultLogger.Debugf("Not using GSO on %s: %s", c.LocalAddr(), err)
+	} else {
+		oc.gsoEnabled = 1
+	}
+	if !oc.ttlEnabled && !oc.packetInfoEnabled && oc.gsoEnabled == 0 {
+		return pconn
+	}
+	return oc
+}
+
+// ReadPacket reads a packet, and returns the information contained in the control messages.
+// It must not be called concurrently.
+func (c *oobConn) ReadPacket(b []byte) (int, net.Addr, packetInfo, error) {
+	n, oobn, _, addr, err := c.ReadMsgUDP(b, c.oob)
+	if err != nil {
+		return 0, nil, packetInfo{}, err
+	}
+	return n, addr, parseControlMessages(c.oob[:oobn]), nil
+}
+
+// WritePacket writes a packet, marked with the ECN codepoint and the DSCP, with the TTL, and sent from the local address of the packetInfo.
+func (c *oobConn) WritePacket(b []byte, addr net.Addr, info packetInfo) (int, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return c.WriteTo(b, addr)
+	}
+	oob := c.appendControlMessages(nil, udpAddr, info)
+	if len(oob) == 0 {
+		return c.WriteTo(b, addr)
+	}
+	n, _, err := c.WriteMsgUDP(b, oob, udpAddr)
+	return n, err
+}
+
+// WriteSegments writes multiple packets of the size segmentSize (the last one may be smaller).
+// If GSO is enabled, they are sent in a single system call.
+// Otherwise, and if the network interface turns out not to support GSO, they are sent using writeBatch.
+// It returns the number of packets that were written.
+func (c *oobConn) WriteSegments(b []byte, segmentSize int, addr net.Addr, info packetInfo) (int, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok || len(b) <= segmentSize {
+		return writeSegmentsIndividually(c, b, segmentSize, addr, info)
+	}
+	if atomic.LoadUint32(&c.gsoEnabled) == 0 {
+		return c.writeBatch(b, segmentSize, udpAddr, info)
+	}
+	oob := appendUDPSegment(c.appendControlMessages(nil, udpAddr, info), segmentSize)
+	// With GSO, either all packets or none of them are written.
+	if _, _, err := c.WriteMsgUDP(b, oob, udpAddr); err != nil {
+		if isGSOError(err) {
+			utils.DefaultLogger.Debugf("Disabling GSO on %s: %s", c.LocalAddr(), err)
+			atomic.StoreUint32(&c.gsoEnabled, 0)
+			return c.writeBatch(b, segmentSize, udpAddr, info)
+		}
+		return 0, err
+	}
+	return (len(b) + segmentSize - 1) / segmentSize, nil
+}
+
+// writeBatch writes multiple packets of the size segmentSize (the last one may be smaller),
+// using a single system call (sendmmsg on Linux).
+func (c *oobConn) writeBatch(b []byte, segmentSize int, addr *net.UDPAddr, info packetInfo) (int, error) {
+	if batchSize == 1 {
+		return writeSegmentsIndividually(c, b, segmentSize, addr, info)
+	}
+	oob := c.appendControlMessages(nil, addr, info)
+	msgs := make([]ipv4.Message, 0, (len(b)+segmentSize-1)/segmentSize)
+	for len(b) > 0 {
+		n := utils.Min(len(b), segmentSize)
+		msgs = append(msgs, ipv4.Message{Buffers: [][]byte{b[:n]}, OOB: oob, Addr: addr})
+		b = b[n:]
+	}
+	// sendmmsg might not send all packets at once
+	var sent int
+	for sent < len(msgs) {
+		n, err := c.batchConn.WriteBatch(msgs[sent:], 0)
+		if n > 0 {
+			sent += n
+		}
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// appendControlMessages appends the control messages for sending a packet to addr.
+func (c *oobConn) appendControlMessages(oob []byte, addr *net.UDPAddr, info packetInfo) []byte {
+	if info.ecn != protocol.ECNNon || info.dscp != 0 {
+		oob = appendTOS(oob, addr, info.dscp<<2|uint8(info.ecn))
+	}
+	if c.ttlEnabled && info.ttl != 0 {
+		oob = appendTTL(oob, addr, info.ttl)
+	}
+	if c.packetInfoEnabled && info.localAddr != nil {
+		oob = appendPacketInfo(oob, info.localAddr, info.ifIndex)
+	}
+	return oob
+}
+
+// enableECN enables reading of the ECN codepoint of received packets, which is required for ECN.
+// It returns false if the ECN codepoint can't be read.
+func enableECN(pconn net.PacketConn) bool {
+	c, ok := pconn.(*oobConn)
+	return ok && c.enableECN()
+}
+
+// enableECN enables reading of the TOS / Traffic Class field, when it is called for the first time.
+// It is not enabled by default, since it is only needed if a session uses ECN.
+func (c *oobConn) enableECN() bool {
+	c.ecnOnce.Do(func() {
+		if err := enableTOS(c.UDPConn); err != nil {
+			utils.DefaultLogger.Debugf("Not using ECN on %s: %s", c.LocalAddr(), err)
+			return
+		}
+		c.ecnEnabled = true
+	})
+	return c.ecnEnabled
+}
+
+// enableMTUDiscovery sets the Don't Fragment bit on outgoing packets, which is required for MTU discovery.
+// It returns false if the bit can't be set.
+func enableMTUDiscovery(pconn net.PacketConn) bool {
+	c, ok := pconn.(*oobConn)
+	return ok && c.enableDF()
+}
+
+// enableDF sets the Don't Fragment bit, when it is called for the first time.
+// The bit is not set by default: without MTU discovery, packets that are larger than the path MTU are fragmented,
+// which allows sessions to work on paths with an MTU smaller than the initial packet size.
+// If multiple sessions share the socket, the bit is set as soon as one of them uses MTU discovery.
+func (c *oobConn) enableDF() bool {
+	c.dfOnce.Do(func() {
+		if err := enableDF(c.UDPConn); err != nil {
+			utils.DefaultLogger.Debugf("Not setting the Don't Fragment bit on %s: %s", c.LocalAddr(), err)
+			return
+		}
+		c.dfEnabled = true
+	})
+	return c.dfEnabled
+}
+
+func supportsGSO(pconn net.PacketConn) bool {
+	c, ok := pconn.(*oobConn)
+	return ok && atomic.LoadUint32(&c.gsoEnabled) == 1
+}
+
+// supportsBatching says if multiple packets can be written in a single system call, using GSO or sendmmsg.
+func supportsBatching(pconn net.PacketConn) bool {
+	c, ok := pconn.(*oobConn)
+	return ok && (batchSize > 1 || atomic.LoadUint32(&c.gsoEnabled) == 1)
+}
+
+// readPacket reads a packet from a net.PacketConn.
+// If the net.PacketConn doesn't support control messages, the packetInfo is empty.
+func readPacket(pconn net.PacketConn, b []byte) (int, net.Addr, packetInfo, error) {
+	if c, ok := pconn.(*oobConn); ok {
+		return c.ReadPacket(b)
+	}
+	n, addr, err := pconn.ReadFrom(b)
+	return n, addr, packetInfo{}, err
+}
+
+// writePacket writes a packet to a net.PacketConn.
+// If the net.PacketConn doesn't support control messages, the packetInfo is ignored.
+func writePacket(pconn net.PacketConn, b []byte, addr net.Addr, info packetInfo) error {
+	var err error
+	if c, ok := pconn.(*oobConn); ok {
+		_, err = c.WritePacket(b, addr, info)
+	} else {
+		_, err = pconn.WriteTo(b, addr)
+	}
+	return err
+}
+
+// writeSegments writes multiple packets of the size segmentSize (the last one may be smaller) to a net.PacketConn.
+// If the net.PacketConn doesn't support GSO, the packets are written one by one.
+func writeSegments(pconn net.PacketConn, b []byte, segmentSize int, addr net.Addr, info packetInfo) (int, error) {
+	if c, ok := pconn.(*oobConn); ok {
+		return c.WriteSegments(b, segmentSize, addr, info)
+	}
+	return writeSegmentsIndividually(pconn, b, segmentSize, addr, info)
+}
+
+func writeSegmentsIndividually(pconn net.PacketConn, b []byte, segmentSize int, addr net.Addr, info packetInfo) (int, error) {
+	var sent int
+	for len(b) > 0 {
+		n := utils.Min(len(b), segmentSize)
+		if err := writePacket(pconn, b[:n], addr, info); err != nil {
+			return sent, err
+		}
+		sent++
+		b = b[n:]
+	}
+	return sent, nil
+}
@@ -0,0 +1,209 @@
+// +build linux
+
+package quic
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// large enough for the TOS, the TTL and the packet info control messages, for both IPv4 and IPv6
+// (IPv4 packets received on a dual-stack socket might carry both)
+const oobSize = 256
+
+// the maximum number of packets read (using recvmmsg) in a single system call
+const batchSize = 16
+
+// the ECN codepoint is stored in the lowest two bits of the TOS / Traffic Class field, the DSCP in the upper six bits
+const ecnMask = 0x3
+
+// the UDP_SEGMENT socket option and control message, used for GSO (Linux 4.18 and newer).
+// It is not defined in the syscall package.
+const udpSegment = 103
+
+func enableTOS(c *net.UDPConn) error {
+	return setSockoptIPv4AndIPv6(c, syscall.IP_RECVTOS, syscall.IPV6_RECVTCLASS, 1)
+}
+
+func enableTTL(c *net.UDPConn) error {
+	return setSockoptIPv4AndIPv6(c, syscall.IP_RECVTTL, syscall.IPV6_RECVHOPLIMIT, 1)
+}
+
+func enablePacketInfo(c *net.UDPConn) error {
+	return setSockoptIPv4AndIPv6(c, syscall.IP_PKTINFO, syscall.IPV6_RECVPKTINFO, 1)
+}
+
+// enableDF sets the Don't Fragment bit on outgoing packets.
+// Packets larger than the path MTU known to the kernel are rejected with EMSGSIZE, instead of being fragmented.
+// This is required for MTU discovery.
+func enableDF(c *net.UDPConn) error {
+	return setSockoptIPv4AndIPv6(c, syscall.IP_MTU_DISCOVER, syscall.IPV6_MTU_DISCOVER, syscall.IP_PMTUDISC_DO)
+}
+
+// enableGSO checks if the kernel supports GSO.
+// GSO doesn't need to be enabled on the socket, the segment size is set for every write.
+func enableGSO(c *net.UDPConn) error {
+	rawConn, err := c.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := rawConn.Control(func(fd uintptr) {
+		_, serr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_UDP, udpSegment)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+// getSocketBufferSizes returns the sizes of the receive and the send buffer of a UDP socket.
+// The kernel doubles the size set using setsockopt (to allow space for bookkeeping overhead),
+// and reports the doubled value. We return the value that corresponds to the size that was set.
+func getSocketBufferSizes(c *net.UDPConn) (receive, send int, err error) {
+	rawConn, err := c.SyscallConn()
+	if err != nil {
+		return 0, 0, err
+	}
+	var errReceive, errSend error
+	if err := rawConn.Control(func(fd uintptr) {
+		receive, errReceive = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+		send, errSend = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	}); err != nil {
+		return 0, 0, err
+	}
+	if errReceive != nil {
+		return 0, 0, errReceive
+	}
+	if errSend != nil {
+		return 0, 0, errSend
+	}
+	return receive / 2, send / 2, nil
+}
+
+// isGSOError says if a write failed because the network interface doesn't support GSO,
+// e.g. because it doesn't support checksum offloading.
+func isGSOError(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	return err == syscall.EIO
+}
+
+// setSockoptIPv4AndIPv6 sets a socket option for IPv4 and for IPv6.
+// The IPv6 option fails on IPv4 sockets.
+// Dual-stack IPv6 sockets receive (and send) IPv4 packets as well, so they need both options.
+func setSockoptIPv4AndIPv6(c *net.UDPConn, optIPv4, optIPv6, value int) error {
+	rawConn, err := c.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errIPv4, errIPv6 error
+	if err := rawConn.Control(func(fd uintptr) {
+		errIPv4 = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, optIPv4, value)
+		errIPv6 = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, optIPv6, value)
+	}); err != nil {
+		return err
+	}
+	if errIPv4 != nil && errIPv6 != nil {
+		return errIPv4
+	}
+	return nil
+}
+
+func parseControlMessages(oob []byte) packetInfo {
+	var info packetInfo
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return info
+	}
+	for _, msg := range msgs {
+		switch {
+		case msg.Header.Level == syscall.IPPROTO_IP && msg.Header.Type == syscall.IP_TOS && len(msg.Data) >= 1:
+			info.ecn = protocol.ECN(msg.Data[0] & ecnMask)
+			info.dscp = msg.Data[0] >> 2
+		case msg.Header.Level == syscall.IPPROTO_IPV6 && msg.Header.Type == syscall.IPV6_TCLASS && len(msg.Data) >= 4:
+			tclass := uint8(*(*int32)(unsafe.Pointer(&msg.Data[0])))
+			info.ecn = protocol.ECN(tclass & ecnMask)
+			info.dscp = tclass >> 2
+		case msg.Header.Level == syscall.IPPROTO_IP && msg.Header.Type == syscall.IP_TTL && len(msg.Data) >= 4:
+			info.ttl = uint8(*(*int32)(unsafe.Pointer(&msg.Data[0])))
+		case msg.Header.Level == syscall.IPPROTO_IPV6 && msg.Header.Type == syscall.IPV6_HOPLIMIT && len(msg.Data) >= 4:
+			info.ttl = uint8(*(*int32)(unsafe.Pointer(&msg.Data[0])))
+		case msg.Header.Level == syscall.IPPROTO_IP && msg.Header.Type == syscall.IP_PKTINFO && len(msg.Data) >= syscall.SizeofInet4Pktinfo:
+			pktInfo := (*syscall.Inet4Pktinfo)(unsafe.Pointer(&msg.Data[0]))
+			info.localAddr = net.IPv4(pktInfo.Addr[0], pktInfo.Addr[1], pktInfo.Addr[2], pktInfo.Addr[3])
+			info.ifIndex = uint32(pktInfo.Ifindex)
+		case msg.Header.Level == syscall.IPPROTO_IPV6 && msg.Header.Type == syscall.IPV6_PKTINFO && len(msg.Data) >= syscall.SizeofInet6Pktinfo:
+			pktInfo := (*syscall.Inet6Pktinfo)(unsafe.Pointer(&msg.Data[0]))
+			info.localAddr = make(net.IP, net.IPv6len)
+			copy(info.localAddr, pktInfo.Addr[:])
+			info.ifIndex = pktInfo.Ifindex
+		}
+	}
+	return info
+}
+
+// appendControlMessage appends a control message header, and space for dataLen bytes of data.
+// It returns a pointer to the data.
+func appendControlMessage(oob []byte, level, typ, dataLen int) ([]byte, unsafe.Pointer) {
+	start := len(oob)
+	oob = append(oob, make([]byte, syscall.CmsgSpace(dataLen))...)
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&oob[start]))
+	h.Level = int32(level)
+	h.Type = int32(typ)
+	h.SetLen(syscall.CmsgLen(dataLen))
+	return oob, unsafe.Pointer(&oob[start+syscall.CmsgLen(0)])
+}
+
+// appendTOS appends a control message that sets the TOS / Traffic Class field of a packet sent to addr.
+// IPv4 packets (including packets sent to IPv4-mapped IPv6 addresses) use IP_TOS, IPv6 packets IPV6_TCLASS.
+func appendTOS(oob []byte, addr *net.UDPAddr, tos uint8) []byte {
+	level, typ := syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS
+	if addr.IP.To4() != nil {
+		level, typ = syscall.IPPROTO_IP, syscall.IP_TOS
+	}
+	oob, data := appendControlMessage(oob, level, typ, 4)
+	*(*int32)(data) = int32(tos)
+	return oob
+}
+
+// appendTTL appends a control message that sets the TTL / hop limit of a packet sent to addr.
+func appendTTL(oob []byte, addr *net.UDPAddr, ttl uint8) []byte {
+	level, typ := syscall.IPPROTO_IPV6, syscall.IPV6_HOPLIMIT
+	if addr.IP.To4() != nil {
+		level, typ = syscall.IPPROTO_IP, syscall.IP_TTL
+	}
+	oob, data := appendControlMessage(oob, level, typ, 4)
+	*(*int32)(data) = int32(ttl)
+	return oob
+}
+
+// appendPacketInfo appends a control message that sets the source address and the interface of a packet.
+func appendPacketInfo(oob []byte, localAddr net.IP, ifIndex uint32) []byte {
+	if ip4 := localAddr.To4(); ip4 != nil {
+		oob, data := appendControlMessage(oob, syscall.IPPROTO_IP, syscall.IP_PKTINFO, syscall.SizeofInet4Pktinfo)
+		pktInfo := (*syscall.Inet4Pktinfo)(data)
+		pktInfo.Ifindex = int32(ifIndex)
+		copy(pktInfo.Spec_dst[:], ip4)
+		return oob
+	}
+	oob, data := appendControlMessage(oob, syscall.IPPROTO_IPV6, syscall.IPV6_PKTINFO, syscall.SizeofInet6Pktinfo)
+	pktInfo := (*syscall.Inet6Pktinfo)(data)
+	pktInfo.Ifindex = ifIndex
+	copy(pktInfo.Addr[:], localAddr.To16())
+	return oob
+}
+
+// appendUDPSegment appends a control message that splits the data into packets of segmentSize bytes (GSO).
+func appendUDPSegment(oob []byte, segmentSize int) []byte {
+	oob, data := appendControlMessage(oob, syscall.IPPROTO_UDP, udpSegment, 2)
+	*(*uint16)(data) = uint16(segmentSize)
+	return oob
+}
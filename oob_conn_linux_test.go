@@ -0,0 +1,385 @@
+// +build linux
+
+package quic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OOB connection", func() {
+	listen := func(network, addr string) *net.UDPConn {
+		udpAddr, err := net.ResolveUDPAddr(network, addr)
+		Expect(err).ToNot(HaveOccurred())
+		c, err := net.ListenUDP(network, udpAddr)
+		Expect(err).ToNot(HaveOccurred())
+		return c
+	}
+
+	It("doesn't wrap a net.PacketConn that is not a UDP connection", func() {
+		pconn := newMockPacketConn()
+		Expect(wrapConn(pconn)).To(Equal(pconn))
+		Expect(enableECN(pconn)).To(BeFalse())
+		Expect(enableMTUDiscovery(pconn)).To(BeFalse())
+	})
+
+	It("wraps a UDP connection only once", func() {
+		c := wrapConn(listen("udp4", "127.0.0.1:0"))
+		defer c.Close()
+		Expect(enableECN(c)).To(BeTrue())
+		Expect(wrapConn(c)).To(BeIdenticalTo(c))
+	})
+
+	It("only reads the ECN codepoint once ECN was enabled", func() {
+		sender := wrapConn(listen("udp4", "127.0.0.1:0"))
+		defer sender.Close()
+		receiver := wrapConn(listen("udp4", "127.0.0.1:0"))
+		defer receiver.Close()
+		b := make([]byte, 100)
+		Expect(writePacket(sender, []byte("foobar"), receiver.LocalAddr(), packetInfo{ecn: protocol.ECT0})).To(Succeed())
+		_, _, info, err := readPacket(receiver, b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.ecn).To(Equal(protocol.ECNNon))
+		Expect(enableECN(receiver)).To(BeTrue())
+		Expect(writePacket(sender, []byte("foobar"), receiver.LocalAddr(), packetInfo{ecn: protocol.ECT0})).To(Succeed())
+		_, _, info, err = readPacket(receiver, b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.ecn).To(Equal(protocol.ECT0))
+	})
+
+	for _, network := range []string{"udp4", "udp6"} {
+		network := network
+		addr := "127.0.0.1:0"
+		if network == "udp6" {
+			addr = "[::1]:0"
+		}
+
+		Context(network, func() {
+			var sender, receiver net.PacketConn
+
+			BeforeEach(func() {
+				sender = wrapConn(listen(network, addr))
+				receiver = wrapConn(listen(network, addr))
+				Expect(enableECN(sender)).To(BeTrue())
+				Expect(enableECN(receiver)).To(BeTrue())
+			})
+
+			AfterEach(func() {
+				sender.Close()
+				receiver.Close()
+			})
+
+			for _, ecn := range []protocol.ECN{protocol.ECNNon, protocol.ECT0, protocol.ECT1, protocol.ECNCE} {
+				ecn := ecn
+
+				It("sends and receives packets marked with "+ecn.String(), func() {
+					Expect(writePacket(sender, []byte("foobar"), receiver.LocalAddr(), packetInfo{ecn: ecn})).To(Succeed())
+					b := make([]byte, 100)
+					n, remoteAddr, info, err := readPacket(receiver, b)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(b[:n]).To(Equal([]byte("foobar")))
+					Expect(remoteAddr.String()).To(Equal(sender.LocalAddr().String()))
+					Expect(info.ecn).To(Equal(ecn))
+					// the receiver is bound to a specific address
+					Expect(info.localAddr).To(BeNil())
+				})
+			}
+
+			It("sends and receives packets marked with a DSCP", func() {
+				Expect(writePacket(sender, []byte("foobar"), receiver.LocalAddr(), packetInfo{dscp: 46, ecn: protocol.ECT0})).To(Succeed())
+				b := make([]byte, 100)
+				n, _, info, err := readPacket(receiver, b)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(b[:n]).To(Equal([]byte("foobar")))
+				Expect(info.dscp).To(BeEquivalentTo(46))
+				Expect(info.ecn).To(Equal(protocol.ECT0))
+			})
+
+			It("sends and receives packets with a TTL", func() {
+				Expect(writePacket(sender, []byte("foobar"), receiver.LocalAddr(), packetInfo{ttl: 3})).To(Succeed())
+				b := make([]byte, 100)
+				n, _, info, err := readPacket(receiver, b)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(b[:n]).To(Equal([]byte("foobar")))
+				Expect(info.ttl).To(BeEquivalentTo(3))
+			})
+
+			It("reads the TTL of packets sent with the default TTL", func() {
+				Expect(writePacket(sender, []byte("foobar"), receiver.LocalAddr(), packetInfo{})).To(Succeed())
+				b := make([]byte, 100)
+				_, _, info, err := readPacket(receiver, b)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(info.ttl).ToNot(BeZero())
+			})
+
+			It("sets the Don't Fragment bit when MTU discovery is enabled", func() {
+				rawConn, err := sender.(*oobConn).SyscallConn()
+				Expect(err).ToNot(HaveOccurred())
+				level, opt := syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER
+				if network == "udp6" {
+					level, opt = syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER
+				}
+				getMTUDiscover := func() int {
+					var val int
+					Expect(rawConn.Control(func(fd uintptr) {
+						val, err = syscall.GetsockoptInt(int(fd), level, opt)
+					})).To(Succeed())
+					Expect(err).ToNot(HaveOccurred())
+					return val
+				}
+				Expect(getMTUDiscover()).ToNot(Equal(syscall.IP_PMTUDISC_DO))
+				Expect(enableMTUDiscovery(sender)).To(BeTrue())
+				Expect(getMTUDiscover()).To(Equal(syscall.IP_PMTUDISC_DO))
+				Expect(enableMTUDiscovery(sender)).To(BeTrue())
+			})
+
+			readSegments := func() {
+				b := make([]byte, 100)
+				for _, data := range []string{"foobar", "foobar", "foo"} {
+					n, _, info, err := readPacket(receiver, b)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(b[:n]).To(Equal([]byte(data)))
+					Expect(info.ecn).To(Equal(protocol.ECT0))
+				}
+			}
+
+			It("sends multiple packets in a single write, using GSO", func() {
+				if !supportsGSO(sender) {
+					Skip("GSO not supported by the kernel")
+				}
+				n, err := writeSegments(sender, []byte("foobarfoobarfoo"), 6, receiver.LocalAddr(), packetInfo{ecn: protocol.ECT0})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(Equal(3))
+				readSegments()
+			})
+
+			It("sends multiple packets using sendmmsg, if GSO is disabled", func() {
+				atomic.StoreUint32(&sender.(*oobConn).gsoEnabled, 0)
+				n, err := writeSegments(sender, []byte("foobarfoobarfoo"), 6, receiver.LocalAddr(), packetInfo{ecn: protocol.ECT0})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(Equal(3))
+				readSegments()
+			})
+		})
+	}
+
+	It("reads batches of packets, including the control messages", func() {
+		sender := wrapConn(listen("udp4", "127.0.0.1:0"))
+		defer sender.Close()
+		receiver := wrapConn(listen("udp4", "127.0.0.1:0"))
+		defer receiver.Close()
+		Expect(enableECN(receiver)).To(BeTrue())
+		r := newPacketReader(receiver)
+		Expect(r.batchConn).ToNot(BeNil())
+		for i := 0; i < batchSize+1; i++ {
+			ecn := protocol.ECT0
+			if i%2 == 1 {
+				ecn = protocol.ECNCE
+			}
+			Expect(writePacket(sender, []byte{byte(i)}, receiver.LocalAddr(), packetInfo{ecn: ecn})).To(Succeed())
+		}
+		for i := 0; i < batchSize+1; i++ {
+			buf, _, info, err := r.ReadPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(*buf).To(Equal([]byte{byte(i)}))
+			if i%2 == 1 {
+				Expect(info.ecn).To(Equal(protocol.ECNCE))
+			} else {
+				Expect(info.ecn).To(Equal(protocol.ECT0))
+			}
+		}
+	})
+
+	It("writes segments one by one on a net.PacketConn that is not a UDP connection", func() {
+		pconn := newMockPacketConn()
+		Expect(supportsGSO(pconn)).To(BeFalse())
+		Expect(supportsBatching(pconn)).To(BeFalse())
+		n, err := writeSegments(pconn, []byte("foobarfoo"), 6, &net.UDPAddr{}, packetInfo{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(2))
+		Expect(pconn.dataWritten.Bytes()).To(Equal([]byte("foobarfoo")))
+	})
+
+	It("recognizes errors caused by network interfaces that don't support GSO", func() {
+		Expect(isGSOError(&net.OpError{Op: "write", Net: "udp", Err: os.NewSyscallError("sendmsg", syscall.EIO)})).To(BeTrue())
+		Expect(isGSOError(&net.OpError{Op: "write", Net: "udp", Err: os.NewSyscallError("sendmsg", syscall.ENOBUFS)})).To(BeFalse())
+		Expect(isGSOError(errors.New("foobar"))).To(BeFalse())
+	})
+
+	It("sends ECN marked IPv4 packets on a dual-stack socket", func() {
+		sender := wrapConn(listen("udp", ":0"))
+		defer sender.Close()
+		receiver := wrapConn(listen("udp4", "127.0.0.1:0"))
+		defer receiver.Close()
+		Expect(enableECN(receiver)).To(BeTrue())
+		Expect(writePacket(sender, []byte("foobar"), receiver.LocalAddr(), packetInfo{ecn: protocol.ECT0})).To(Succeed())
+		b := make([]byte, 100)
+		n, _, info, err := readPacket(receiver, b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("foobar")))
+		Expect(info.ecn).To(Equal(protocol.ECT0))
+	})
+
+	It("sends IPv4 packets with a TTL on a dual-stack socket", func() {
+		sender := wrapConn(listen("udp", ":0"))
+		defer sender.Close()
+		receiver := wrapConn(listen("udp4", "127.0.0.1:0"))
+		defer receiver.Close()
+		Expect(writePacket(sender, []byte("foobar"), receiver.LocalAddr(), packetInfo{ttl: 5})).To(Succeed())
+		b := make([]byte, 100)
+		_, _, info, err := readPacket(receiver, b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.ttl).To(BeEquivalentTo(5))
+	})
+
+	Context("packet info", func() {
+		It("only reads the packet info on sockets bound to the unspecified address", func() {
+			c := wrapConn(listen("udp4", "127.0.0.1:0"))
+			defer c.Close()
+			Expect(c.(*oobConn).packetInfoEnabled).To(BeFalse())
+			c = wrapConn(listen("udp4", "0.0.0.0:0"))
+			defer c.Close()
+			Expect(c.(*oobConn).packetInfoEnabled).To(BeTrue())
+		})
+
+		for _, network := range []string{"udp4", "udp"} {
+			network := network
+
+			// 127.0.0.2 is a loopback address as well, but the kernel would choose 127.0.0.1 as the source address
+			It(fmt.Sprintf("replies from the address the packet was sent to, using %s", network), func() {
+				server := wrapConn(listen(network, ":0"))
+				defer server.Close()
+				client := wrapConn(listen("udp4", "127.0.0.1:0"))
+				defer client.Close()
+				serverAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: server.LocalAddr().(*net.UDPAddr).Port}
+				Expect(writePacket(client, []byte("foo"), serverAddr, packetInfo{})).To(Succeed())
+				b := make([]byte, 100)
+				n, remoteAddr, info, err := readPacket(server, b)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(b[:n]).To(Equal([]byte("foo")))
+				Expect(info.localAddr.Equal(net.IPv4(127, 0, 0, 2))).To(BeTrue())
+				Expect(info.ifIndex).ToNot(BeZero())
+				Expect(writePacket(server, []byte("bar"), remoteAddr, info.replyInfo())).To(Succeed())
+				n, remoteAddr, _, err = readPacket(client, b)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(b[:n]).To(Equal([]byte("bar")))
+				Expect(remoteAddr.(*net.UDPAddr).IP.Equal(net.IPv4(127, 0, 0, 2))).To(BeTrue())
+			})
+		}
+
+		It("replies from the address the packet was sent to, for IPv6", func() {
+			server := wrapConn(listen("udp6", "[::]:0"))
+			defer server.Close()
+			client := wrapConn(listen("udp6", "[::1]:0"))
+			defer client.Close()
+			serverAddr := &net.UDPAddr{IP: net.IPv6loopback, Port: server.LocalAddr().(*net.UDPAddr).Port}
+			Expect(writePacket(client, []byte("foo"), serverAddr, packetInfo{})).To(Succeed())
+			b := make([]byte, 100)
+			n, remoteAddr, info, err := readPacket(server, b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b[:n]).To(Equal([]byte("foo")))
+			Expect(info.localAddr.Equal(net.IPv6loopback)).To(BeTrue())
+			Expect(writePacket(server, []byte("bar"), remoteAddr, info.replyInfo())).To(Succeed())
+			n, remoteAddr, _, err = readPacket(client, b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b[:n]).To(Equal([]byte("bar")))
+			Expect(remoteAddr.(*net.UDPAddr).IP.Equal(net.IPv6loopback)).To(BeTrue())
+		})
+
+		It("doesn't send ECN marks in replies", func() {
+			info := packetInfo{ecn: protocol.ECNCE, localAddr: net.IPv4(127, 0, 0, 2), ifIndex: 1}
+			Expect(info.replyInfo()).To(Equal(packetInfo{localAddr: net.IPv4(127, 0, 0, 2), ifIndex: 1}))
+		})
+	})
+
+	Context("socket buffers", func() {
+		It("increases the buffer sizes", func() {
+			c := listen("udp4", "127.0.0.1:0")
+			defer c.Close()
+			setSocketBuffers(c, &Config{
+				ReceiveBufferSize:     1 << 17,
+				SendBufferSize:        1 << 17,
+				OnSocketBufferWarning: func(w SocketBufferWarning) { Fail(w.String()) },
+			})
+			receive, send := socketBufferSizes(wrapConn(c))
+			Expect(receive).To(Equal(1 << 17))
+			Expect(send).To(Equal(1 << 17))
+		})
+
+		It("increases the buffer sizes of a Transport once", func() {
+			c := listen("udp4", "127.0.0.1:0")
+			t := NewTransport(c, &Config{
+				ReceiveBufferSize:     1 << 17,
+				SendBufferSize:        1 << 17,
+				OnSocketBufferWarning: func(w SocketBufferWarning) { Fail(w.String()) },
+			})
+			defer t.Close()
+			receive, send := socketBufferSizes(c)
+			Expect(receive).To(Equal(1 << 17))
+			Expect(send).To(Equal(1 << 17))
+			// the sizes requested when dialing are ignored
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := t.DialContext(ctx, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}, "localhost:1234", nil, &Config{
+				ReceiveBufferSize: 1 << 18,
+				SendBufferSize:    1 << 18,
+			})
+			Expect(err).To(MatchError(context.Canceled))
+			receive, send = socketBufferSizes(c)
+			Expect(receive).To(Equal(1 << 17))
+			Expect(send).To(Equal(1 << 17))
+		})
+
+		It("doesn't change the buffer sizes if the sizes are negative", func() {
+			c := listen("udp4", "127.0.0.1:0")
+			defer c.Close()
+			receive, send, err := getSocketBufferSizes(c)
+			Expect(err).ToNot(HaveOccurred())
+			setSocketBuffers(c, &Config{ReceiveBufferSize: -1, SendBufferSize: -1})
+			newReceive, newSend := socketBufferSizes(c)
+			Expect(newReceive).To(Equal(receive))
+			Expect(newSend).To(Equal(send))
+		})
+
+		It("reports a warning if the operating system caps the buffer sizes", func() {
+			c := listen("udp4", "127.0.0.1:0")
+			defer c.Close()
+			var warnings []SocketBufferWarning
+			setSocketBuffers(c, &Config{
+				ReceiveBufferSize:     1 << 30,
+				SendBufferSize:        1 << 30,
+				OnSocketBufferWarning: func(w SocketBufferWarning) { warnings = append(warnings, w) },
+			})
+			Expect(warnings).To(HaveLen(2))
+			Expect(warnings[0].Send).To(BeFalse())
+			Expect(warnings[1].Send).To(BeTrue())
+			receive, send := socketBufferSizes(c)
+			for _, w := range warnings {
+				Expect(w.LocalAddr).To(Equal(c.LocalAddr()))
+				Expect(w.Requested).To(Equal(1 << 30))
+				Expect(w.Achieved).To(BeNumerically(">", 0))
+				Expect(w.Achieved).To(BeNumerically("<", 1<<30))
+			}
+			Expect(warnings[0].Achieved).To(Equal(receive))
+			Expect(warnings[1].Achieved).To(Equal(send))
+			Expect(warnings[0].String()).To(ContainSubstring("net.core.rmem_max"))
+			Expect(warnings[1].String()).To(ContainSubstring("net.core.wmem_max"))
+		})
+
+		It("doesn't report buffer sizes for a net.PacketConn that is not a UDP connection", func() {
+			setSocketBuffers(newMockPacketConn(), &Config{ReceiveBufferSize: 1 << 30})
+			receive, send := socketBufferSizes(newMockPacketConn())
+			Expect(receive).To(BeZero())
+			Expect(send).To(BeZero())
+		})
+	})
+})
@@ -0,0 +1,49 @@
+// +build !linux
+
+package quic
+
+import (
+	"errors"
+	"net"
+)
+
+const oobSize = 0
+
+// reading and writing batches of packets is not supported on this platform
+const batchSize = 1
+
+func enableTOS(*net.UDPConn) error {
+	return errors.New("setting the TOS field is not supported on this platform")
+}
+
+func enableTTL(*net.UDPConn) error {
+	return errors.New("setting the TTL is not supported on this platform")
+}
+
+func enablePacketInfo(*net.UDPConn) error {
+	return errors.New("reading the destination address is not supported on this platform")
+}
+
+func enableDF(*net.UDPConn) error {
+	return errors.New("setting the Don't Fragment bit is not supported on this platform")
+}
+
+func enableGSO(*net.UDPConn) error {
+	return errors.New("GSO is not supported on this platform")
+}
+
+func getSocketBufferSizes(*net.UDPConn) (int, int, error) {
+	return 0, 0, errors.New("reading the socket buffer sizes is not supported on this platform")
+}
+
+func isGSOError(error) bool { return false }
+
+func parseControlMessages([]byte) packetInfo { return packetInfo{} }
+
+func appendTOS(oob []byte, _ *net.UDPAddr, _ uint8) []byte { return oob }
+
+func appendTTL(oob []byte, _ *net.UDPAddr, _ uint8) []byte { return oob }
+
+func appendPacketInfo(oob []byte, _ net.IP, _ uint32) []byte { return oob }
+
+func appendUDPSegment(oob []byte, _ int) []byte { return oob }
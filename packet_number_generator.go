@@ -1,7 +1,6 @@
 package quic
 
 import (
-	"crypto/rand"
 	"math"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -18,10 +17,12 @@ type packetNumberGenerator struct {
 }
 
 func newPacketNumberGenerator(initial, averagePeriod protocol.PacketNumber) *packetNumberGenerator {
-	return &packetNumberGenerator{
+	g := &packetNumberGenerator{
 		next:          initial,
 		averagePeriod: averagePeriod,
 	}
+	g.generateNewSkip()
+	return g
 }
 
 func (p *packetNumberGenerator) Peek() protocol.PacketNumber {
@@ -59,8 +60,7 @@ func (p *packetNumberGenerator) generateNewSkip() error {
 // The expectation value is 65535/2
 func (p *packetNumberGenerator) getRandomNumber() (uint16, error) {
 	b := make([]byte, 2)
-	_, err := rand.Read(b)
-	if err != nil {
+	if err := protocol.ReadRandom(b); err != nil {
 		return 0, err
 	}
 
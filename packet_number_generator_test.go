@@ -35,6 +35,22 @@ var _ = Describe("Packet Number Generator", func() {
 		Expect(png.Peek()).To(Equal(protocol.PacketNumber(2)))
 	})
 
+	It("skips packet numbers from the start", func() {
+		png = *newPacketNumberGenerator(1, protocol.SkipPacketAveragePeriodLength)
+		var skipped int
+		last := png.Pop()
+		for i := 0; i < 100000; i++ {
+			num := png.Pop()
+			Expect(num - last).To(BeNumerically("<=", 2)) // never skip two consecutive packet numbers
+			if num-last == 2 {
+				skipped++
+			}
+			last = num
+		}
+		// 100000 packets, skipping one packet number every 500 packets on average
+		Expect(skipped).To(BeNumerically("~", 100000/int(protocol.SkipPacketAveragePeriodLength), 50))
+	})
+
 	It("skips a packet number", func() {
 		png.nextToSkip = 2
 		num := png.Pop()
@@ -20,6 +20,24 @@ type packedPacket struct {
 	raw             []byte
 	frames          []wire.Frame
 	encryptionLevel protocol.EncryptionLevel
+	isMTUProbe      bool
+	// for retransmissions: the packets whose frames are retransmitted in this packet
+	retransmissionOf []protocol.PacketNumber
+}
+
+// IsAckOnly says if the packet only contains ACK and STOP_WAITING frames.
+func (p *packedPacket) IsAckOnly() bool {
+	if len(p.frames) == 0 {
+		return false
+	}
+	for _, f := range p.frames {
+		switch f.(type) {
+		case *wire.AckFrame, *wire.StopWaitingFrame:
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 func (p *packedPacket) ToAckHandlerPacket() *ackhandler.Packet {
@@ -30,6 +48,7 @@ func (p *packedPacket) ToAckHandlerPacket() *ackhandler.Packet {
 		Length:          protocol.ByteCount(len(p.raw)),
 		EncryptionLevel: p.encryptionLevel,
 		SendTime:        time.Now(),
+		IsMTUProbe:      p.isMTUProbe,
 	}
 }
 
@@ -65,6 +84,7 @@ type packetPacker struct {
 	ackFrame                  *wire.AckFrame
 	omitConnectionID          bool
 	maxPacketSize             protocol.ByteCount
+	padding                   PaddingPolicy
 	hasSentPacket             bool // has the packetPacker already sent a packet
 	numNonRetransmittableAcks int
 }
@@ -74,24 +94,29 @@ func newPacketPacker(
 	srcConnID protocol.ConnectionID,
 	initialPacketNumber protocol.PacketNumber,
 	getPacketNumberLen func(protocol.PacketNumber) protocol.PacketNumberLen,
-	remoteAddr net.Addr, // only used for determining the max packet size
+	remoteAddr net.Addr, // only used for determining the initial packet size
+	initialPacketSize protocol.ByteCount, // if 0, the initial packet size is determined from the remote address
+	maxPacketSize protocol.ByteCount,
 	divNonce []byte,
 	cryptoSetup sealingManager,
 	streamFramer streamFrameSource,
 	perspective protocol.Perspective,
 	version protocol.VersionNumber,
 ) *packetPacker {
-	maxPacketSize := protocol.ByteCount(protocol.MinInitialPacketSize)
-	// If this is not a UDP address, we don't know anything about the MTU.
-	// Use the minimum size of an Initial packet as the max packet size.
-	if udpAddr, ok := remoteAddr.(*net.UDPAddr); ok {
-		// If ip is not an IPv4 address, To4 returns nil.
-		// Note that there might be some corner cases, where this is not correct.
-		// See https://stackoverflow.com/questions/22751035/golang-distinguish-ipv4-ipv6.
-		if udpAddr.IP.To4() == nil {
-			maxPacketSize = protocol.MaxPacketSizeIPv6
-		} else {
-			maxPacketSize = protocol.MaxPacketSizeIPv4
+	packetSize := initialPacketSize
+	if packetSize == 0 {
+		packetSize = protocol.ByteCount(protocol.MinInitialPacketSize)
+		// If this is not a UDP address, we don't know anything about the MTU.
+		// Use the minimum size of an Initial packet as the max packet size.
+		if udpAddr, ok := remoteAddr.(*net.UDPAddr); ok {
+			// If ip is not an IPv4 address, To4 returns nil.
+			// Note that there might be some corner cases, where this is not correct.
+			// See https://stackoverflow.com/questions/22751035/golang-distinguish-ipv4-ipv6.
+			if udpAddr.IP.To4() == nil {
+				packetSize = protocol.MaxPacketSizeIPv6
+			} else {
+				packetSize = protocol.MaxPacketSizeIPv4
+			}
 		}
 	}
 	return &packetPacker{
@@ -104,16 +129,37 @@ func newPacketPacker(
 		streams:               streamFramer,
 		getPacketNumberLen:    getPacketNumberLen,
 		packetNumberGenerator: newPacketNumberGenerator(initialPacketNumber, protocol.SkipPacketAveragePeriodLength),
-		maxPacketSize:         maxPacketSize,
+		maxPacketSize:         utils.MinByteCount(packetSize, maxPacketSize),
 	}
 }
 
+// getPacketSizes returns the initial and the maximum packet size to use for configured sizes.
+// An initial size of 0 means that it is determined from the remote address.
+func getPacketSizes(initial, max uint16) (uint16, uint16) {
+	if max == 0 || max > uint16(protocol.MaxReceivePacketSize) {
+		max = uint16(protocol.MaxReceivePacketSize)
+	}
+	if max < protocol.MinInitialPacketSize {
+		max = protocol.MinInitialPacketSize
+	}
+	if initial == 0 {
+		return 0, max
+	}
+	if initial < protocol.MinInitialPacketSize {
+		initial = protocol.MinInitialPacketSize
+	}
+	if initial > max {
+		initial = max
+	}
+	return initial, max
+}
+
 // PackConnectionClose packs a packet that ONLY contains a ConnectionCloseFrame
 func (p *packetPacker) PackConnectionClose(ccf *wire.ConnectionCloseFrame) (*packedPacket, error) {
 	frames := []wire.Frame{ccf}
 	encLevel, sealer := p.cryptoSetup.GetSealer()
 	header := p.getHeader(encLevel)
-	raw, err := p.writeAndSealPacket(header, frames, sealer)
+	raw, err := p.writeAndSealPacket(header, frames, encLevel, sealer)
 	return &packedPacket{
 		header:          header,
 		raw:             raw,
@@ -122,6 +168,43 @@ func (p *packetPacker) PackConnectionClose(ccf *wire.ConnectionCloseFrame) (*pac
 	}, err
 }
 
+// PackPathChallenge packs a packet that ONLY contains a PathChallengeFrame
+func (p *packetPacker) PackPathChallenge(frame *wire.PathChallengeFrame) (*packedPacket, error) {
+	frames := []wire.Frame{frame}
+	encLevel, sealer := p.cryptoSetup.GetSealer()
+	header := p.getHeader(encLevel)
+	raw, err := p.writeAndSealPacket(header, frames, encLevel, sealer)
+	return &packedPacket{
+		header:          header,
+		raw:             raw,
+		frames:          frames,
+		encryptionLevel: encLevel,
+	}, err
+}
+
+// PackMTUProbePacket packs a packet that contains a PING frame, padded to size bytes.
+// The packet may be larger than the current max packet size.
+// MTU probes are only sent after the handshake completed.
+func (p *packetPacker) PackMTUProbePacket(size protocol.ByteCount) (*packedPacket, error) {
+	encLevel, sealer := p.cryptoSetup.GetSealer()
+	if encLevel != protocol.EncryptionForwardSecure {
+		return nil, errors.New("packet packer BUG: MTU probes can only be sent in forward-secure packets")
+	}
+	frames := []wire.Frame{&wire.PingFrame{}}
+	header := p.getHeader(encLevel)
+	raw, err := p.writeAndSealPacketWithPadding(header, frames, sealer, size)
+	if err != nil {
+		return nil, err
+	}
+	return &packedPacket{
+		header:          header,
+		raw:             raw,
+		frames:          frames,
+		encryptionLevel: encLevel,
+		isMTUProbe:      true,
+	}, nil
+}
+
 func (p *packetPacker) PackAckPacket() (*packedPacket, error) {
 	if p.ackFrame == nil {
 		return nil, errors.New("packet packer BUG: no ack frame queued")
@@ -136,7 +219,7 @@ func (p *packetPacker) PackAckPacket() (*packedPacket, error) {
 		p.stopWaiting = nil
 	}
 	p.ackFrame = nil
-	raw, err := p.writeAndSealPacket(header, frames, sealer)
+	raw, err := p.writeAndSealPacket(header, frames, encLevel, sealer)
 	return &packedPacket{
 		header:          header,
 		raw:             raw,
@@ -145,112 +228,92 @@ func (p *packetPacker) PackAckPacket() (*packedPacket, error) {
 	}, err
 }
 
-// PackRetransmission packs a retransmission
-// For packets sent after completion of the handshake, it might happen that 2 packets have to be sent.
-// This can happen e.g. when a longer packet number is used in the header.
-func (p *packetPacker) PackRetransmission(packet *ackhandler.Packet) ([]*packedPacket, error) {
-	if packet.EncryptionLevel != protocol.EncryptionForwardSecure {
-		p, err := p.packHandshakeRetransmission(packet)
-		return []*packedPacket{p}, err
+// PackRetransmission packs a forward-secure packet containing frames from the retransmission queue.
+// Frames that don't fit into the packet stay in the queue, STREAM frames are split if necessary.
+// It returns nil if there's nothing to retransmit.
+func (p *packetPacker) PackRetransmission(q *retransmissionQueue) (*packedPacket, error) {
+	if !q.HasData() {
+		return nil, nil
 	}
 
-	var controlFrames []wire.Frame
-	var streamFrames []*wire.StreamFrame
-	for _, f := range packet.Frames {
-		if sf, ok := f.(*wire.StreamFrame); ok {
-			sf.DataLenPresent = true
-			streamFrames = append(streamFrames, sf)
-		} else {
-			controlFrames = append(controlFrames, f)
-		}
-	}
+	var frames []wire.Frame
+	var payloadLength protocol.ByteCount
 
-	var packets []*packedPacket
 	encLevel, sealer := p.cryptoSetup.GetSealer()
-	for len(controlFrames) > 0 || len(streamFrames) > 0 {
-		var frames []wire.Frame
-		var payloadLength protocol.ByteCount
-
-		header := p.getHeader(encLevel)
-		headerLength, err := header.GetLength(p.perspective, p.version)
-		if err != nil {
-			return nil, err
-		}
-		maxSize := p.maxPacketSize - protocol.ByteCount(sealer.Overhead()) - headerLength
+	header := p.getHeader(encLevel)
+	headerLength, err := header.GetLength(p.perspective, p.version)
+	if err != nil {
+		return nil, err
+	}
+	maxSize := p.maxPacketSize - protocol.ByteCount(sealer.Overhead()) - headerLength
 
-		// for gQUIC: add a STOP_WAITING for *every* retransmission
-		if p.version.UsesStopWaitingFrames() {
-			if p.stopWaiting == nil {
-				return nil, errors.New("PacketPacker BUG: Handshake retransmissions must contain a STOP_WAITING frame")
-			}
-			// create a new StopWaitingFrame, since we might need to send more than one packet as a retransmission
-			swf := &wire.StopWaitingFrame{
-				LeastUnacked:    p.stopWaiting.LeastUnacked,
-				PacketNumber:    header.PacketNumber,
-				PacketNumberLen: header.PacketNumberLen,
-			}
-			payloadLength += swf.Length(p.version)
-			frames = append(frames, swf)
+	// for gQUIC: add a STOP_WAITING for *every* retransmission
+	var swf *wire.StopWaitingFrame
+	if p.version.UsesStopWaitingFrames() {
+		if p.stopWaiting == nil {
+			return nil, errors.New("PacketPacker BUG: Handshake retransmissions must contain a STOP_WAITING frame")
 		}
+		swf = p.stopWaiting
+		swf.PacketNumber = header.PacketNumber
+		swf.PacketNumberLen = header.PacketNumberLen
+		payloadLength += swf.Length(p.version)
+	}
 
-		for len(controlFrames) > 0 {
-			frame := controlFrames[0]
-			length := frame.Length(p.version)
-			if payloadLength+length > maxSize {
-				break
-			}
-			payloadLength += length
-			frames = append(frames, frame)
-			controlFrames = controlFrames[1:]
+	// Control frames can't be split.
+	// If the maximum packet size was reduced, a control frame might not fit into a packet any more.
+	q.DropControlFramesLargerThan(maxSize-payloadLength, p.version)
+	var retransmissionOf []protocol.PacketNumber
+	for {
+		frame, pn := q.PopControlFrame(maxSize-payloadLength, p.version)
+		if frame == nil {
+			break
 		}
+		payloadLength += frame.Length(p.version)
+		frames = append(frames, frame)
+		retransmissionOf = appendPacketNumber(retransmissionOf, pn)
+	}
 
-		// temporarily increase the maxFrameSize by the (minimum) length of the DataLen field
-		// this leads to a properly sized packet in all cases, since we do all the packet length calculations with StreamFrames that have the DataLen set
-		// however, for the last STREAM frame in the packet, we can omit the DataLen, thus yielding a packet of exactly the correct size
-		// for gQUIC STREAM frames, DataLen is always 2 bytes
-		// for IETF draft style STREAM frames, the length is encoded to either 1 or 2 bytes
-		if p.version.UsesIETFFrameFormat() {
-			maxSize++
-		} else {
-			maxSize += 2
-		}
-		for len(streamFrames) > 0 && payloadLength+protocol.MinStreamFrameSize < maxSize {
-			// TODO: optimize by setting DataLenPresent = false on all but the last STREAM frame
-			frame := streamFrames[0]
-			frameToAdd := frame
-
-			sf, err := frame.MaybeSplitOffFrame(maxSize-payloadLength, p.version)
-			if err != nil {
-				return nil, err
-			}
-			if sf != nil {
-				frameToAdd = sf
-			} else {
-				streamFrames = streamFrames[1:]
-			}
-			payloadLength += frameToAdd.Length(p.version)
-			frames = append(frames, frameToAdd)
-		}
-		if sf, ok := frames[len(frames)-1].(*wire.StreamFrame); ok {
-			sf.DataLenPresent = false
-		}
-		raw, err := p.writeAndSealPacket(header, frames, sealer)
+	maxSize = p.maxSizeForStreamFrames(maxSize, p.shouldPad(encLevel))
+	for payloadLength+protocol.MinStreamFrameSize < maxSize {
+		// TODO: optimize by setting DataLenPresent = false on all but the last STREAM frame
+		frame, pns, err := q.PopStreamFrame(maxSize-payloadLength, p.version)
 		if err != nil {
 			return nil, err
 		}
-		packets = append(packets, &packedPacket{
-			header:          header,
-			raw:             raw,
-			frames:          frames,
-			encryptionLevel: encLevel,
-		})
+		if frame == nil {
+			break
+		}
+		payloadLength += frame.Length(p.version)
+		frames = append(frames, frame)
+		for _, pn := range pns {
+			retransmissionOf = appendPacketNumber(retransmissionOf, pn)
+		}
 	}
-	p.stopWaiting = nil
-	return packets, nil
+	if len(frames) == 0 {
+		return nil, nil
+	}
+	if sf, ok := frames[len(frames)-1].(*wire.StreamFrame); ok {
+		sf.DataLenPresent = false
+	}
+	if swf != nil {
+		p.stopWaiting = nil
+		frames = append([]wire.Frame{swf}, frames...)
+	}
+	raw, err := p.writeAndSealPacket(header, frames, encLevel, sealer)
+	if err != nil {
+		return nil, err
+	}
+	return &packedPacket{
+		header:           header,
+		raw:              raw,
+		frames:           frames,
+		encryptionLevel:  encLevel,
+		retransmissionOf: retransmissionOf,
+	}, nil
 }
 
-// packHandshakeRetransmission retransmits a handshake packet, that was sent with less than forward-secure encryption
-func (p *packetPacker) packHandshakeRetransmission(packet *ackhandler.Packet) (*packedPacket, error) {
+// PackHandshakeRetransmission retransmits a handshake packet, that was sent with less than forward-secure encryption
+func (p *packetPacker) PackHandshakeRetransmission(packet *ackhandler.Packet) (*packedPacket, error) {
 	sealer, err := p.cryptoSetup.GetSealerWithEncryptionLevel(packet.EncryptionLevel)
 	if err != nil {
 		return nil, err
@@ -274,7 +337,7 @@ func (p *packetPacker) packHandshakeRetransmission(packet *ackhandler.Packet) (*
 	} else {
 		frames = packet.Frames
 	}
-	raw, err := p.writeAndSealPacket(header, frames, sealer)
+	raw, err := p.writeAndSealPacket(header, frames, packet.EncryptionLevel, sealer)
 	return &packedPacket{
 		header:          header,
 		raw:             raw,
@@ -294,7 +357,19 @@ func (p *packetPacker) PackPacket() (*packedPacket, error) {
 	if hasCryptoStreamFrame {
 		return p.packCryptoPacket()
 	}
+	return p.packPacket(true)
+}
+
+// PackControlPacket packs a packet that only contains the queued ACK and control frames, but no stream data.
+// It returns nil if no frames are queued.
+func (p *packetPacker) PackControlPacket() (*packedPacket, error) {
+	if !p.hasSentPacket {
+		return nil, nil
+	}
+	return p.packPacket(false)
+}
 
+func (p *packetPacker) packPacket(canSendStreamData bool) (*packedPacket, error) {
 	encLevel, sealer := p.cryptoSetup.GetSealer()
 
 	header := p.getHeader(encLevel)
@@ -308,7 +383,7 @@ func (p *packetPacker) PackPacket() (*packedPacket, error) {
 	}
 
 	maxSize := p.maxPacketSize - protocol.ByteCount(sealer.Overhead()) - headerLength
-	payloadFrames, err := p.composeNextPacket(maxSize, p.canSendData(encLevel))
+	payloadFrames, err := p.composeNextPacket(maxSize, canSendStreamData && p.canSendData(encLevel), p.shouldPad(encLevel))
 	if err != nil {
 		return nil, err
 	}
@@ -337,7 +412,7 @@ func (p *packetPacker) PackPacket() (*packedPacket, error) {
 	p.stopWaiting = nil
 	p.ackFrame = nil
 
-	raw, err := p.writeAndSealPacket(header, payloadFrames, sealer)
+	raw, err := p.writeAndSealPacket(header, payloadFrames, encLevel, sealer)
 	if err != nil {
 		return nil, err
 	}
@@ -356,11 +431,12 @@ func (p *packetPacker) packCryptoPacket() (*packedPacket, error) {
 	if err != nil {
 		return nil, err
 	}
-	maxLen := p.maxPacketSize - protocol.ByteCount(sealer.Overhead()) - protocol.NonForwardSecurePacketSizeReduction - headerLength
+	// Fill the packet, but leave enough space such that it can be retransmitted without splitting the STREAM frame.
+	maxLen := p.maxPacketSize - protocol.ByteCount(sealer.Overhead()) - p.handshakeRetransmissionOverhead(header) - headerLength
 	sf := p.streams.PopCryptoStreamFrame(maxLen)
 	sf.DataLenPresent = false
 	frames := []wire.Frame{sf}
-	raw, err := p.writeAndSealPacket(header, frames, sealer)
+	raw, err := p.writeAndSealPacket(header, frames, encLevel, sealer)
 	if err != nil {
 		return nil, err
 	}
@@ -372,9 +448,25 @@ func (p *packetPacker) packCryptoPacket() (*packedPacket, error) {
 	}, nil
 }
 
+// handshakeRetransmissionOverhead is the number of bytes that a handshake packet might grow when it is retransmitted,
+// see PackHandshakeRetransmission.
+// For gQUIC, a longer packet number might be used, and a STOP_WAITING frame might be added.
+// IETF QUIC always uses 4 byte packet numbers in the long header, so the retransmission has the same size.
+func (p *packetPacker) handshakeRetransmissionOverhead(header *wire.Header) protocol.ByteCount {
+	var overhead protocol.ByteCount
+	if !header.IsLongHeader {
+		overhead += protocol.ByteCount(protocol.PacketNumberLen6 - header.PacketNumberLen)
+	}
+	if p.version.UsesStopWaitingFrames() {
+		overhead += (&wire.StopWaitingFrame{PacketNumberLen: protocol.PacketNumberLen6}).Length(p.version)
+	}
+	return overhead
+}
+
 func (p *packetPacker) composeNextPacket(
 	maxFrameSize protocol.ByteCount,
 	canSendStreamFrames bool,
+	padded bool,
 ) ([]wire.Frame, error) {
 	var payloadLength protocol.ByteCount
 	var payloadFrames []wire.Frame
@@ -411,17 +503,7 @@ func (p *packetPacker) composeNextPacket(
 		return payloadFrames, nil
 	}
 
-	// temporarily increase the maxFrameSize by the (minimum) length of the DataLen field
-	// this leads to a properly sized packet in all cases, since we do all the packet length calculations with StreamFrames that have the DataLen set
-	// however, for the last STREAM frame in the packet, we can omit the DataLen, thus yielding a packet of exactly the correct size
-	// for gQUIC STREAM frames, DataLen is always 2 bytes
-	// for IETF draft style STREAM frames, the length is encoded to either 1 or 2 bytes
-	if p.version.UsesIETFFrameFormat() {
-		maxFrameSize++
-	} else {
-		maxFrameSize += 2
-	}
-
+	maxFrameSize = p.maxSizeForStreamFrames(maxFrameSize, padded)
 	fs := p.streams.PopStreamFrames(maxFrameSize - payloadLength)
 	if len(fs) != 0 {
 		fs[len(fs)-1].DataLenPresent = false
@@ -433,6 +515,36 @@ func (p *packetPacker) composeNextPacket(
 	return payloadFrames, nil
 }
 
+// maxSizeForStreamFrames returns the size that is available for STREAM frames.
+// We do all the packet length calculations with STREAM frames that have the DataLen set.
+// However, for the last STREAM frame in the packet, we can omit the DataLen,
+// so the size is temporarily increased by the (minimum) length of the DataLen field.
+// This leads to a properly sized packet in all cases.
+// For gQUIC STREAM frames, DataLen is always 2 bytes.
+// For IETF draft style STREAM frames, the length is encoded to either 1 or 2 bytes.
+// In padded packets the DataLen can't be omitted, since the padding would be interpreted as stream data.
+func (p *packetPacker) maxSizeForStreamFrames(maxSize protocol.ByteCount, padded bool) protocol.ByteCount {
+	if padded {
+		return maxSize
+	}
+	if p.version.UsesIETFFrameFormat() {
+		return maxSize + 1
+	}
+	return maxSize + 2
+}
+
+// shouldPad says if a packet sent with this encryption level is padded to the maximum packet size.
+func (p *packetPacker) shouldPad(encLevel protocol.EncryptionLevel) bool {
+	switch p.padding {
+	case PaddingAll:
+		return true
+	case PaddingHandshake:
+		return encLevel != protocol.EncryptionForwardSecure
+	default:
+		return false
+	}
+}
+
 func (p *packetPacker) QueueControlFrame(frame wire.Frame) {
 	switch f := frame.(type) {
 	case *wire.StopWaitingFrame:
@@ -489,19 +601,44 @@ func (p *packetPacker) getHeader(encLevel protocol.EncryptionLevel) *wire.Header
 	return header
 }
 
+// writeAndSealPacket writes and seals a packet.
+// Depending on the padding policy, the packet is padded to the max packet size.
 func (p *packetPacker) writeAndSealPacket(
+	header *wire.Header,
+	payloadFrames []wire.Frame,
+	encLevel protocol.EncryptionLevel,
+	sealer handshake.Sealer,
+) ([]byte, error) {
+	var paddedSize protocol.ByteCount
+	if p.shouldPad(encLevel) {
+		paddedSize = p.maxPacketSize
+	}
+	return p.writeAndSealPacketWithPadding(header, payloadFrames, sealer, paddedSize)
+}
+
+// writeAndSealPacketWithPadding writes and seals a packet.
+// If paddedSize is not 0, the packet is padded to paddedSize bytes,
+// and it is allowed to exceed the max packet size (this is used for MTU probes).
+func (p *packetPacker) writeAndSealPacketWithPadding(
 	header *wire.Header,
 	payloadFrames []wire.Frame,
 	sealer handshake.Sealer,
+	paddedSize protocol.ByteCount,
 ) ([]byte, error) {
 	raw := *getPacketBuffer()
 	buffer := bytes.NewBuffer(raw[:0])
 
+	// if this is an IETF QUIC Initial packet, we need to pad it to fulfill the minimum size requirement
+	// in gQUIC, padding is handled in the CHLO
+	if header.Type == protocol.PacketTypeInitial && paddedSize < protocol.MinInitialPacketSize {
+		paddedSize = protocol.MinInitialPacketSize
+	}
+
 	// the payload length is only needed for Long Headers
 	if header.IsLongHeader {
-		if header.Type == protocol.PacketTypeInitial {
+		if paddedSize > 0 {
 			headerLen, _ := header.GetLength(p.perspective, p.version)
-			header.PayloadLen = protocol.ByteCount(protocol.MinInitialPacketSize) - headerLen
+			header.PayloadLen = paddedSize - headerLen
 		} else {
 			payloadLen := protocol.ByteCount(sealer.Overhead())
 			for _, frame := range payloadFrames {
@@ -516,8 +653,8 @@ func (p *packetPacker) writeAndSealPacket(
 	}
 	payloadStartIndex := buffer.Len()
 
-	// the Initial packet needs to be padded, so the last STREAM frame must have the data length present
-	if header.Type == protocol.PacketTypeInitial {
+	// if the packet is padded, the last STREAM frame must have the data length present
+	if paddedSize > 0 && len(payloadFrames) > 0 {
 		lastFrame := payloadFrames[len(payloadFrames)-1]
 		if sf, ok := lastFrame.(*wire.StreamFrame); ok {
 			sf.DataLenPresent = true
@@ -528,17 +665,20 @@ func (p *packetPacker) writeAndSealPacket(
 			return nil, err
 		}
 	}
-	// if this is an IETF QUIC Initial packet, we need to pad it to fulfill the minimum size requirement
-	// in gQUIC, padding is handled in the CHLO
-	if header.Type == protocol.PacketTypeInitial {
-		paddingLen := protocol.MinInitialPacketSize - sealer.Overhead() - buffer.Len()
-		if paddingLen > 0 {
+
+	maxPacketSize := p.maxPacketSize
+	if paddedSize > 0 {
+		if paddedSize > protocol.MaxReceivePacketSize {
+			return nil, fmt.Errorf("PacketPacker BUG: can't pad packet to %d bytes", paddedSize)
+		}
+		if paddingLen := int(paddedSize) - sealer.Overhead() - buffer.Len(); paddingLen > 0 {
 			buffer.Write(bytes.Repeat([]byte{0}, paddingLen))
 		}
+		maxPacketSize = utils.MaxByteCount(maxPacketSize, paddedSize)
 	}
 
-	if size := protocol.ByteCount(buffer.Len() + sealer.Overhead()); size > p.maxPacketSize {
-		return nil, fmt.Errorf("PacketPacker BUG: packet too large (%d bytes, allowed %d bytes)", size, p.maxPacketSize)
+	if size := protocol.ByteCount(buffer.Len() + sealer.Overhead()); size > maxPacketSize {
+		return nil, fmt.Errorf("PacketPacker BUG: packet too large (%d bytes, allowed %d bytes)", size, maxPacketSize)
 	}
 
 	raw = raw[0:buffer.Len()]
@@ -564,10 +704,26 @@ func (p *packetPacker) SetOmitConnectionID() {
 	p.omitConnectionID = true
 }
 
+// SetPaddingPolicy sets the policy which packets are padded to the max packet size.
+func (p *packetPacker) SetPaddingPolicy(policy PaddingPolicy) {
+	p.padding = policy
+}
+
 func (p *packetPacker) ChangeDestConnectionID(connID protocol.ConnectionID) {
 	p.destConnID = connID
 }
 
+// SetMaxPacketSize limits the max packet size, e.g. to the max_packet_size transport parameter sent by the peer.
 func (p *packetPacker) SetMaxPacketSize(size protocol.ByteCount) {
 	p.maxPacketSize = utils.MinByteCount(p.maxPacketSize, size)
 }
+
+// IncreaseMaxPacketSize increases the max packet size to a size that was confirmed by MTU discovery.
+func (p *packetPacker) IncreaseMaxPacketSize(size protocol.ByteCount) {
+	p.maxPacketSize = utils.MaxByteCount(p.maxPacketSize, size)
+}
+
+// MaxPacketSize returns the current max packet size.
+func (p *packetPacker) MaxPacketSize() protocol.ByteCount {
+	return p.maxPacketSize
+}
@@ -28,6 +28,7 @@ type mockCryptoSetup struct {
 	encLevelSeal       protocol.EncryptionLevel
 	encLevelSealCrypto protocol.EncryptionLevel
 	divNonce           []byte
+	earlyKeysDiscarded bool
 }
 
 var _ handshake.CryptoSetup = &mockCryptoSetup{}
@@ -51,7 +52,8 @@ func (m *mockCryptoSetup) SetDiversificationNonce(divNonce []byte) error {
 	m.divNonce = divNonce
 	return nil
 }
-func (m *mockCryptoSetup) ConnectionState() ConnectionState { panic("not implemented") }
+func (m *mockCryptoSetup) ConnectionState() ConnectionState { return ConnectionState{} }
+func (m *mockCryptoSetup) DiscardEarlyKeys()                { m.earlyKeysDiscarded = true }
 
 var _ = Describe("Packet packer", func() {
 	const maxPacketSize protocol.ByteCount = 1357
@@ -76,6 +78,8 @@ var _ = Describe("Packet packer", func() {
 			1,
 			func(protocol.PacketNumber) protocol.PacketNumberLen { return protocol.PacketNumberLen2 },
 			&net.TCPAddr{},
+			0,
+			protocol.MaxReceivePacketSize,
 			divNonce,
 			&mockCryptoSetup{encLevelSeal: protocol.EncryptionForwardSecure},
 			mockStreamFramer,
@@ -93,22 +97,62 @@ var _ = Describe("Packet packer", func() {
 		connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
 		It("uses the minimum initial size, if it can't determine if the remote address is IPv4 or IPv6", func() {
 			remoteAddr := &net.TCPAddr{}
-			packer = newPacketPacker(connID, connID, 1, nil, remoteAddr, nil, nil, nil, protocol.PerspectiveServer, protocol.VersionWhatever)
+			packer = newPacketPacker(connID, connID, 1, nil, remoteAddr, 0, protocol.MaxReceivePacketSize, nil, nil, nil, protocol.PerspectiveServer, protocol.VersionWhatever)
 			Expect(packer.maxPacketSize).To(BeEquivalentTo(protocol.MinInitialPacketSize))
 		})
 
 		It("uses the maximum IPv4 packet size, if the remote address is IPv4", func() {
 			remoteAddr := &net.UDPAddr{IP: net.IPv4(11, 12, 13, 14), Port: 1337}
-			packer = newPacketPacker(connID, connID, 1, nil, remoteAddr, nil, nil, nil, protocol.PerspectiveServer, protocol.VersionWhatever)
+			packer = newPacketPacker(connID, connID, 1, nil, remoteAddr, 0, protocol.MaxReceivePacketSize, nil, nil, nil, protocol.PerspectiveServer, protocol.VersionWhatever)
 			Expect(packer.maxPacketSize).To(BeEquivalentTo(protocol.MaxPacketSizeIPv4))
 		})
 
 		It("uses the maximum IPv6 packet size, if the remote address is IPv6", func() {
 			ip := net.ParseIP("2001:0db8:85a3:0000:0000:8a2e:0370:7334")
 			remoteAddr := &net.UDPAddr{IP: ip, Port: 1337}
-			packer = newPacketPacker(connID, connID, 1, nil, remoteAddr, nil, nil, nil, protocol.PerspectiveServer, protocol.VersionWhatever)
+			packer = newPacketPacker(connID, connID, 1, nil, remoteAddr, 0, protocol.MaxReceivePacketSize, nil, nil, nil, protocol.PerspectiveServer, protocol.VersionWhatever)
 			Expect(packer.maxPacketSize).To(BeEquivalentTo(protocol.MaxPacketSizeIPv6))
 		})
+
+		It("uses the initial packet size, if set", func() {
+			remoteAddr := &net.UDPAddr{IP: net.IPv4(11, 12, 13, 14), Port: 1337}
+			packer = newPacketPacker(connID, connID, 1, nil, remoteAddr, 1400, protocol.MaxReceivePacketSize, nil, nil, nil, protocol.PerspectiveServer, protocol.VersionWhatever)
+			Expect(packer.maxPacketSize).To(Equal(protocol.ByteCount(1400)))
+		})
+
+		It("doesn't use packets larger than the maximum packet size", func() {
+			remoteAddr := &net.UDPAddr{IP: net.IPv4(11, 12, 13, 14), Port: 1337}
+			packer = newPacketPacker(connID, connID, 1, nil, remoteAddr, 0, 1220, nil, nil, nil, protocol.PerspectiveServer, protocol.VersionWhatever)
+			Expect(packer.maxPacketSize).To(Equal(protocol.ByteCount(1220)))
+		})
+	})
+
+	Context("getting the packet sizes", func() {
+		It("uses the default maximum packet size", func() {
+			initial, max := getPacketSizes(0, 0)
+			Expect(initial).To(BeZero())
+			Expect(max).To(BeEquivalentTo(protocol.MaxReceivePacketSize))
+		})
+
+		It("uses the configured packet sizes", func() {
+			initial, max := getPacketSizes(1300, 1400)
+			Expect(initial).To(Equal(uint16(1300)))
+			Expect(max).To(Equal(uint16(1400)))
+		})
+
+		It("clamps the maximum packet size", func() {
+			_, max := getPacketSizes(0, 1000)
+			Expect(max).To(BeEquivalentTo(protocol.MinInitialPacketSize))
+			_, max = getPacketSizes(0, 9000)
+			Expect(max).To(BeEquivalentTo(protocol.MaxReceivePacketSize))
+		})
+
+		It("clamps the initial packet size", func() {
+			initial, _ := getPacketSizes(1000, 1400)
+			Expect(initial).To(BeEquivalentTo(protocol.MinInitialPacketSize))
+			initial, _ = getPacketSizes(1450, 1400)
+			Expect(initial).To(Equal(uint16(1400)))
+		})
 	})
 
 	It("returns nil when no packet is queued", func() {
@@ -280,7 +324,7 @@ var _ = Describe("Packet packer", func() {
 		Expect(err).ToNot(HaveOccurred())
 		// parse the packet
 		r := bytes.NewReader(p.raw)
-		hdr, err := wire.ParseHeaderSentByServer(r)
+		hdr, err := wire.ParseHeaderSentByServer(r, protocol.ConnectionIDLen)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(hdr.PayloadLen).To(BeEquivalentTo(r.Len()))
 	})
@@ -308,6 +352,17 @@ var _ = Describe("Packet packer", func() {
 		Expect(p.frames).To(Equal([]wire.Frame{ccf}))
 	})
 
+	It("packs a packet that only contains a PATH_CHALLENGE", func() {
+		// expect no mockStreamFramer.PopStreamFrames
+		frame := &wire.PathChallengeFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}
+		packer.controlFrames = []wire.Frame{&wire.MaxStreamDataFrame{StreamID: 37}}
+		p, err := packer.PackPathChallenge(frame)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.frames).To(Equal([]wire.Frame{frame}))
+		Expect(p.raw).ToNot(BeEmpty())
+		Expect(packer.controlFrames).To(HaveLen(1))
+	})
+
 	It("packs only control frames", func() {
 		mockStreamFramer.EXPECT().HasCryptoStreamData()
 		mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
@@ -320,6 +375,34 @@ var _ = Describe("Packet packer", func() {
 		Expect(p.raw).NotTo(BeEmpty())
 	})
 
+	Context("packing packets with only control frames", func() {
+		It("packs ACK and control frames, but no stream data", func() {
+			// expect no mockStreamFramer.PopStreamFrames
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 10}}}
+			packer.QueueControlFrame(ack)
+			packer.QueueControlFrame(&wire.MaxDataFrame{ByteOffset: 0x1337})
+			p, err := packer.PackControlPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).ToNot(BeNil())
+			Expect(p.frames).To(Equal([]wire.Frame{ack, &wire.MaxDataFrame{ByteOffset: 0x1337}}))
+			Expect(p.raw).ToNot(BeEmpty())
+		})
+
+		It("doesn't pack a packet if no frames are queued", func() {
+			p, err := packer.PackControlPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+		})
+
+		It("doesn't pack a packet before the first packet was sent", func() {
+			packer.hasSentPacket = false
+			packer.QueueControlFrame(&wire.MaxDataFrame{ByteOffset: 0x1337})
+			p, err := packer.PackControlPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+		})
+	})
+
 	It("increases the packet number", func() {
 		mockStreamFramer.EXPECT().HasCryptoStreamData().Times(2)
 		mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any()).Times(2)
@@ -399,10 +482,10 @@ var _ = Describe("Packet packer", func() {
 			controlFrames = append(controlFrames, f)
 		}
 		packer.controlFrames = controlFrames
-		payloadFrames, err := packer.composeNextPacket(maxFrameSize, false)
+		payloadFrames, err := packer.composeNextPacket(maxFrameSize, false, false)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(payloadFrames).To(HaveLen(maxFramesPerPacket))
-		payloadFrames, err = packer.composeNextPacket(maxFrameSize, false)
+		payloadFrames, err = packer.composeNextPacket(maxFrameSize, false, false)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(payloadFrames).To(BeEmpty())
 	})
@@ -415,10 +498,10 @@ var _ = Describe("Packet packer", func() {
 			controlFrames = append(controlFrames, blockedFrame)
 		}
 		packer.controlFrames = controlFrames
-		payloadFrames, err := packer.composeNextPacket(maxFrameSize, false)
+		payloadFrames, err := packer.composeNextPacket(maxFrameSize, false, false)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(payloadFrames).To(HaveLen(maxFramesPerPacket))
-		payloadFrames, err = packer.composeNextPacket(maxFrameSize, false)
+		payloadFrames, err = packer.composeNextPacket(maxFrameSize, false, false)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(payloadFrames).To(HaveLen(10))
 	})
@@ -624,16 +707,43 @@ var _ = Describe("Packet packer", func() {
 			p, err := packer.PackPacket()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(p.frames).To(HaveLen(1))
-			expectedPacketLen := packer.maxPacketSize - protocol.NonForwardSecurePacketSizeReduction
-			Expect(p.raw).To(HaveLen(int(expectedPacketLen)))
+			// IETF QUIC handshake packets don't grow when they are retransmitted
+			Expect(p.raw).To(HaveLen(int(packer.maxPacketSize)))
 			Expect(p.header.IsLongHeader).To(BeTrue())
 			// parse the packet
 			r := bytes.NewReader(p.raw)
-			hdr, err := wire.ParseHeaderSentByServer(r)
+			hdr, err := wire.ParseHeaderSentByServer(r, protocol.ConnectionIDLen)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.PayloadLen).To(BeEquivalentTo(r.Len()))
 		})
 
+		It("packs a gQUIC crypto packet such that it can be retransmitted", func() {
+			var f *wire.StreamFrame
+			mockStreamFramer.EXPECT().HasCryptoStreamData().Return(true)
+			mockStreamFramer.EXPECT().PopCryptoStreamFrame(gomock.Any()).DoAndReturn(func(size protocol.ByteCount) *wire.StreamFrame {
+				f = &wire.StreamFrame{
+					StreamID: packer.version.CryptoStreamID(),
+					Offset:   0x1337,
+				}
+				f.Data = bytes.Repeat([]byte{'f'}, int(size-f.Length(packer.version)))
+				return f
+			})
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{f}))
+			// leave space for a 6 byte packet number and a STOP_WAITING frame
+			swfLen := (&wire.StopWaitingFrame{PacketNumberLen: protocol.PacketNumberLen6}).Length(packer.version)
+			Expect(p.raw).To(HaveLen(int(packer.maxPacketSize - swfLen - protocol.ByteCount(protocol.PacketNumberLen6-p.header.PacketNumberLen))))
+			// retransmit the packet
+			packer.QueueControlFrame(&wire.StopWaitingFrame{LeastUnacked: 1})
+			retransmission, err := packer.PackHandshakeRetransmission(&ackhandler.Packet{
+				EncryptionLevel: p.encryptionLevel,
+				Frames:          p.frames,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(retransmission.raw)).To(BeNumerically("<=", packer.maxPacketSize))
+		})
+
 		It("sends unencrypted stream data on the crypto stream", func() {
 			f := &wire.StreamFrame{
 				StreamID: packer.version.CryptoStreamID(),
@@ -712,12 +822,11 @@ var _ = Describe("Packet packer", func() {
 				EncryptionLevel: protocol.EncryptionUnencrypted,
 				Frames:          []wire.Frame{sf},
 			}
-			p, err := packer.PackRetransmission(packet)
+			p, err := packer.PackHandshakeRetransmission(packet)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(p).To(HaveLen(1))
-			Expect(p[0].header.Type).To(Equal(protocol.PacketTypeHandshake))
-			Expect(p[0].frames).To(Equal([]wire.Frame{swf, sf}))
-			Expect(p[0].encryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
+			Expect(p.header.Type).To(Equal(protocol.PacketTypeHandshake))
+			Expect(p.frames).To(Equal([]wire.Frame{swf, sf}))
+			Expect(p.encryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
 		})
 
 		It("doesn't add a STOP_WAITING frame for IETF QUIC", func() {
@@ -726,11 +835,10 @@ var _ = Describe("Packet packer", func() {
 				EncryptionLevel: protocol.EncryptionUnencrypted,
 				Frames:          []wire.Frame{sf},
 			}
-			p, err := packer.PackRetransmission(packet)
+			p, err := packer.PackHandshakeRetransmission(packet)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(p).To(HaveLen(1))
-			Expect(p[0].frames).To(Equal([]wire.Frame{sf}))
-			Expect(p[0].encryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
+			Expect(p.frames).To(Equal([]wire.Frame{sf}))
+			Expect(p.encryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
 		})
 
 		It("packs a retransmission for a packet sent with initial encryption", func() {
@@ -738,14 +846,13 @@ var _ = Describe("Packet packer", func() {
 				EncryptionLevel: protocol.EncryptionSecure,
 				Frames:          []wire.Frame{sf},
 			}
-			p, err := packer.PackRetransmission(packet)
+			p, err := packer.PackHandshakeRetransmission(packet)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(p).To(HaveLen(1))
-			Expect(p[0].frames).To(Equal([]wire.Frame{swf, sf}))
-			Expect(p[0].encryptionLevel).To(Equal(protocol.EncryptionSecure))
+			Expect(p.frames).To(Equal([]wire.Frame{swf, sf}))
+			Expect(p.encryptionLevel).To(Equal(protocol.EncryptionSecure))
 			// a packet sent by the server with initial encryption contains the SHLO
 			// it needs to have a diversification nonce
-			Expect(p[0].raw).To(ContainSubstring(string(divNonce)))
+			Expect(p.raw).To(ContainSubstring(string(divNonce)))
 		})
 
 		It("includes the diversification nonce on packets sent with initial encryption", func() {
@@ -753,13 +860,12 @@ var _ = Describe("Packet packer", func() {
 				EncryptionLevel: protocol.EncryptionSecure,
 				Frames:          []wire.Frame{sf},
 			}
-			p, err := packer.PackRetransmission(packet)
+			p, err := packer.PackHandshakeRetransmission(packet)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(p).To(HaveLen(1))
-			Expect(p[0].encryptionLevel).To(Equal(protocol.EncryptionSecure))
+			Expect(p.encryptionLevel).To(Equal(protocol.EncryptionSecure))
 		})
 
-		// this should never happen, since non forward-secure packets are limited to a size smaller than MaxPacketSize, such that it is always possible to retransmit them without splitting the StreamFrame
+		// this should never happen, since crypto packets leave enough space, such that it is always possible to retransmit them without splitting the StreamFrame
 		// (note that the retransmitted packet needs to have enough space for the StopWaitingFrame)
 		It("refuses to send a packet larger than MaxPacketSize", func() {
 			packet := &ackhandler.Packet{
@@ -771,7 +877,7 @@ var _ = Describe("Packet packer", func() {
 					},
 				},
 			}
-			_, err := packer.PackRetransmission(packet)
+			_, err := packer.PackHandshakeRetransmission(packet)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("PacketPacker BUG: packet too large"))
 		})
@@ -810,7 +916,7 @@ var _ = Describe("Packet packer", func() {
 			Expect(err).ToNot(HaveOccurred())
 			// parse the header and check the values
 			r := bytes.NewReader(packet.raw)
-			hdr, err := wire.ParseHeaderSentByClient(r)
+			hdr, err := wire.ParseHeaderSentByClient(r, protocol.ConnectionIDLen)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.PayloadLen).To(BeEquivalentTo(r.Len()))
 		})
@@ -823,17 +929,16 @@ var _ = Describe("Packet packer", func() {
 				EncryptionLevel: protocol.EncryptionUnencrypted,
 				Frames:          []wire.Frame{sf},
 			}
-			p, err := packer.PackRetransmission(packet)
+			p, err := packer.PackHandshakeRetransmission(packet)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(p).To(HaveLen(1))
-			Expect(p[0].frames).To(Equal([]wire.Frame{sf}))
-			Expect(p[0].encryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
-			Expect(p[0].header.Type).To(Equal(protocol.PacketTypeInitial))
+			Expect(p.frames).To(Equal([]wire.Frame{sf}))
+			Expect(p.encryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
+			Expect(p.header.Type).To(Equal(protocol.PacketTypeInitial))
 		})
 
 		It("refuses to retransmit packets without a STOP_WAITING Frame", func() {
 			packer.stopWaiting = nil
-			_, err := packer.PackRetransmission(&ackhandler.Packet{
+			_, err := packer.PackHandshakeRetransmission(&ackhandler.Packet{
 				EncryptionLevel: protocol.EncryptionSecure,
 			})
 			Expect(err).To(MatchError("PacketPacker BUG: Handshake retransmissions must contain a STOP_WAITING frame"))
@@ -841,9 +946,18 @@ var _ = Describe("Packet packer", func() {
 	})
 
 	Context("retransmission of forward-secure packets", func() {
+		var q *retransmissionQueue
+
 		BeforeEach(func() {
 			packer.packetNumberGenerator.next = 15
 			packer.stopWaiting = &wire.StopWaitingFrame{LeastUnacked: 7}
+			q = newRetransmissionQueue()
+		})
+
+		It("returns nil if there's nothing to retransmit", func() {
+			p, err := packer.PackRetransmission(q)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
 		})
 
 		It("retransmits a small packet", func() {
@@ -851,13 +965,9 @@ var _ = Describe("Packet packer", func() {
 				&wire.MaxDataFrame{ByteOffset: 0x1234},
 				&wire.StreamFrame{StreamID: 42, Data: []byte("foobar")},
 			}
-			packets, err := packer.PackRetransmission(&ackhandler.Packet{
-				EncryptionLevel: protocol.EncryptionForwardSecure,
-				Frames:          frames,
-			})
+			q.AddFrames(frames, 10)
+			p, err := packer.PackRetransmission(q)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(packets).To(HaveLen(1))
-			p := packets[0]
 			Expect(p.encryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
 			Expect(p.frames).To(HaveLen(3))
 			Expect(p.frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
@@ -865,17 +975,50 @@ var _ = Describe("Packet packer", func() {
 			Expect(p.frames[0].(*wire.StopWaitingFrame).PacketNumber).To(Equal(p.header.PacketNumber))
 			Expect(p.frames[0].(*wire.StopWaitingFrame).PacketNumberLen).To(Equal(p.header.PacketNumberLen))
 			Expect(p.frames[1:]).To(Equal(frames))
+			Expect(q.HasData()).To(BeFalse())
 		})
 
 		It("refuses to retransmit packets without a STOP_WAITING Frame", func() {
 			packer.stopWaiting = nil
-			_, err := packer.PackRetransmission(&ackhandler.Packet{
-				EncryptionLevel: protocol.EncryptionForwardSecure,
-				Frames:          []wire.Frame{&wire.MaxDataFrame{ByteOffset: 0x1234}},
-			})
+			q.AddFrames([]wire.Frame{&wire.MaxDataFrame{ByteOffset: 0x1234}}, 10)
+			_, err := packer.PackRetransmission(q)
 			Expect(err).To(MatchError("PacketPacker BUG: Handshake retransmissions must contain a STOP_WAITING frame"))
 		})
 
+		It("packs the frames of multiple lost packets into one packet", func() {
+			packer.version = versionIETFFrames
+			q.AddFrames([]wire.Frame{
+				&wire.MaxDataFrame{ByteOffset: 0x1234},
+				&wire.StreamFrame{StreamID: 42, Data: []byte("foo")},
+			}, 10)
+			q.AddFrames([]wire.Frame{&wire.StreamFrame{StreamID: 42, Offset: 3, Data: []byte("bar")}}, 11)
+			p, err := packer.PackRetransmission(q)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{
+				&wire.MaxDataFrame{ByteOffset: 0x1234},
+				&wire.StreamFrame{StreamID: 42, Data: []byte("foobar")},
+			}))
+			Expect(p.retransmissionOf).To(Equal([]protocol.PacketNumber{10, 11}))
+			Expect(q.HasData()).To(BeFalse())
+		})
+
+		It("drops control frames that don't fit into a packet", func() {
+			packer.version = versionIETFFrames
+			q.AddFrames([]wire.Frame{&wire.ConnectionCloseFrame{ReasonPhrase: string(bytes.Repeat([]byte{'a'}, int(maxPacketSize)))}}, 10)
+			p, err := packer.PackRetransmission(q)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+			Expect(q.HasData()).To(BeFalse())
+		})
+
+		It("doesn't consume the STOP_WAITING frame if there's nothing to retransmit", func() {
+			q.AddFrames([]wire.Frame{&wire.ConnectionCloseFrame{ReasonPhrase: string(bytes.Repeat([]byte{'a'}, int(maxPacketSize)))}}, 10)
+			p, err := packer.PackRetransmission(q)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+			Expect(packer.stopWaiting).ToNot(BeNil())
+		})
+
 		It("packs two packets for retransmission if the original packet contained many control frames", func() {
 			var frames []wire.Frame
 			var totalLen protocol.ByteCount
@@ -885,39 +1028,42 @@ var _ = Describe("Packet packer", func() {
 				frames = append(frames, f)
 				totalLen += f.Length(packer.version)
 			}
-			packets, err := packer.PackRetransmission(&ackhandler.Packet{
-				EncryptionLevel: protocol.EncryptionForwardSecure,
-				Frames:          frames,
-			})
+			q.AddFrames(frames, 10)
+			p1, err := packer.PackRetransmission(q)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(packets).To(HaveLen(2))
-			Expect(len(packets[0].frames) + len(packets[1].frames)).To(Equal(len(frames) + 2)) // all frames, plus 2 STOP_WAITING frames
-			Expect(packets[0].frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
-			Expect(packets[1].frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
-			Expect(packets[0].frames[1:]).To(Equal(frames[:len(packets[0].frames)-1]))
-			Expect(packets[1].frames[1:]).To(Equal(frames[len(packets[0].frames)-1:]))
+			packer.stopWaiting = &wire.StopWaitingFrame{LeastUnacked: 7}
+			p2, err := packer.PackRetransmission(q)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(q.HasData()).To(BeFalse())
+			Expect(len(p1.frames) + len(p2.frames)).To(Equal(len(frames) + 2)) // all frames, plus 2 STOP_WAITING frames
+			Expect(p1.frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
+			Expect(p2.frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
+			Expect(p1.frames[1:]).To(Equal(frames[:len(p1.frames)-1]))
+			Expect(p2.frames[1:]).To(Equal(frames[len(p1.frames)-1:]))
 			// check that the first packet was filled up as far as possible:
 			// if the first frame (after the STOP_WAITING) was packed into the first packet, it would have overflown the MaxPacketSize
-			Expect(len(packets[0].raw) + int(packets[1].frames[1].Length(packer.version))).To(BeNumerically(">", maxPacketSize))
+			Expect(len(p1.raw) + int(p2.frames[1].Length(packer.version))).To(BeNumerically(">", maxPacketSize))
 		})
 
 		It("splits a STREAM frame that doesn't fit", func() {
-			packets, err := packer.PackRetransmission(&ackhandler.Packet{
-				EncryptionLevel: protocol.EncryptionForwardSecure,
-				Frames: []wire.Frame{&wire.StreamFrame{
-					StreamID: 42,
-					Offset:   1337,
-					Data:     bytes.Repeat([]byte{'a'}, int(maxPacketSize)*3/2),
-				}},
-			})
+			q.AddFrames([]wire.Frame{&wire.StreamFrame{
+				StreamID: 42,
+				Offset:   1337,
+				Data:     bytes.Repeat([]byte{'a'}, int(maxPacketSize)*3/2),
+			}}, 10)
+			p1, err := packer.PackRetransmission(q)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(packets).To(HaveLen(2))
-			Expect(packets[0].frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
-			Expect(packets[1].frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
-			Expect(packets[0].frames[1]).To(BeAssignableToTypeOf(&wire.StreamFrame{}))
-			Expect(packets[1].frames[1]).To(BeAssignableToTypeOf(&wire.StreamFrame{}))
-			sf1 := packets[0].frames[1].(*wire.StreamFrame)
-			sf2 := packets[1].frames[1].(*wire.StreamFrame)
+			Expect(q.HasData()).To(BeTrue())
+			packer.stopWaiting = &wire.StopWaitingFrame{LeastUnacked: 7}
+			p2, err := packer.PackRetransmission(q)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(q.HasData()).To(BeFalse())
+			Expect(p1.frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
+			Expect(p2.frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
+			Expect(p1.frames[1]).To(BeAssignableToTypeOf(&wire.StreamFrame{}))
+			Expect(p2.frames[1]).To(BeAssignableToTypeOf(&wire.StreamFrame{}))
+			sf1 := p1.frames[1].(*wire.StreamFrame)
+			sf2 := p2.frames[1].(*wire.StreamFrame)
 			Expect(sf1.StreamID).To(Equal(protocol.StreamID(42)))
 			Expect(sf1.Offset).To(Equal(protocol.ByteCount(1337)))
 			Expect(sf1.DataLenPresent).To(BeFalse())
@@ -925,7 +1071,7 @@ var _ = Describe("Packet packer", func() {
 			Expect(sf2.Offset).To(Equal(protocol.ByteCount(1337) + sf1.DataLen()))
 			Expect(sf2.DataLenPresent).To(BeFalse())
 			Expect(sf1.DataLen() + sf2.DataLen()).To(Equal(maxPacketSize * 3 / 2))
-			Expect(packets[0].raw).To(HaveLen(int(maxPacketSize)))
+			Expect(p1.raw).To(HaveLen(int(maxPacketSize)))
 		})
 
 		It("packs two packets for retransmission if the original packet contained many STREAM frames", func() {
@@ -941,34 +1087,30 @@ var _ = Describe("Packet packer", func() {
 				frames = append(frames, f)
 				totalLen += f.Length(packer.version)
 			}
-			packets, err := packer.PackRetransmission(&ackhandler.Packet{
-				EncryptionLevel: protocol.EncryptionForwardSecure,
-				Frames:          frames,
-			})
+			q.AddFrames(frames, 10)
+			p1, err := packer.PackRetransmission(q)
+			Expect(err).ToNot(HaveOccurred())
+			packer.stopWaiting = &wire.StopWaitingFrame{LeastUnacked: 7}
+			p2, err := packer.PackRetransmission(q)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(packets).To(HaveLen(2))
-			Expect(len(packets[0].frames) + len(packets[1].frames)).To(Equal(len(frames) + 2)) // all frames, plus 2 STOP_WAITING frames
-			Expect(packets[0].frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
-			Expect(packets[1].frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
-			Expect(packets[0].frames[1:]).To(Equal(frames[:len(packets[0].frames)-1]))
-			Expect(packets[1].frames[1:]).To(Equal(frames[len(packets[0].frames)-1:]))
+			Expect(q.HasData()).To(BeFalse())
+			Expect(len(p1.frames) + len(p2.frames)).To(Equal(len(frames) + 2)) // all frames, plus 2 STOP_WAITING frames
+			Expect(p1.frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
+			Expect(p2.frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
+			Expect(p1.frames[1:]).To(Equal(frames[:len(p1.frames)-1]))
+			Expect(p2.frames[1:]).To(Equal(frames[len(p1.frames)-1:]))
 			// check that the first packet was filled up as far as possible:
 			// if the first frame (after the STOP_WAITING) was packed into the first packet, it would have overflown the MaxPacketSize
-			Expect(len(packets[0].raw) + int(packets[1].frames[1].Length(packer.version))).To(BeNumerically(">", maxPacketSize-protocol.MinStreamFrameSize))
+			Expect(len(p1.raw) + int(p2.frames[1].Length(packer.version))).To(BeNumerically(">", maxPacketSize-protocol.MinStreamFrameSize))
 		})
 
 		It("correctly sets the DataLenPresent on STREAM frames", func() {
-			frames := []wire.Frame{
+			q.AddFrames([]wire.Frame{
 				&wire.StreamFrame{StreamID: 4, Data: []byte("foobar"), DataLenPresent: true},
 				&wire.StreamFrame{StreamID: 5, Data: []byte("barfoo")},
-			}
-			packets, err := packer.PackRetransmission(&ackhandler.Packet{
-				EncryptionLevel: protocol.EncryptionForwardSecure,
-				Frames:          frames,
-			})
+			}, 10)
+			p, err := packer.PackRetransmission(q)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(packets).To(HaveLen(1))
-			p := packets[0]
 			Expect(p.frames).To(HaveLen(3))
 			Expect(p.frames[1]).To(BeAssignableToTypeOf(&wire.StreamFrame{}))
 			Expect(p.frames[2]).To(BeAssignableToTypeOf(&wire.StreamFrame{}))
@@ -1003,6 +1145,111 @@ var _ = Describe("Packet packer", func() {
 		})
 	})
 
+	Context("padding", func() {
+		It("doesn't pad packets by default", func() {
+			mockStreamFramer.EXPECT().HasCryptoStreamData()
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
+			packer.QueueControlFrame(&wire.MaxDataFrame{ByteOffset: 0x1337})
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(p.raw)).To(BeNumerically("<", maxPacketSize))
+		})
+
+		It("pads all packets", func() {
+			packer.SetPaddingPolicy(PaddingAll)
+			packer.QueueControlFrame(&wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 10}}})
+			p, err := packer.PackAckPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.raw).To(HaveLen(int(maxPacketSize)))
+		})
+
+		It("sets the data length on the last STREAM frame of a padded packet", func() {
+			packer.SetPaddingPolicy(PaddingAll)
+			f := &wire.StreamFrame{StreamID: 5, Data: []byte("foobar")}
+			mockStreamFramer.EXPECT().HasCryptoStreamData()
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any()).Return([]*wire.StreamFrame{f})
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.raw).To(HaveLen(int(maxPacketSize)))
+			Expect(f.DataLenPresent).To(BeTrue())
+			// the padding must not be interpreted as stream data
+			r := bytes.NewReader(p.raw[publicHeaderLen : len(p.raw)-(&mockSealer{}).Overhead()])
+			frame, err := wire.ParseNextFrame(r, nil, packer.version)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+			frame, err = wire.ParseNextFrame(r, nil, packer.version)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(BeNil())
+		})
+
+		It("doesn't exceed the max packet size when padding a full packet", func() {
+			packer.SetPaddingPolicy(PaddingAll)
+			mockStreamFramer.EXPECT().HasCryptoStreamData()
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any()).DoAndReturn(func(maxLen protocol.ByteCount) []*wire.StreamFrame {
+				f := &wire.StreamFrame{StreamID: 5, DataLenPresent: true}
+				f.Data = bytes.Repeat([]byte{'f'}, int(f.MaxDataLen(maxLen, packer.version)))
+				return []*wire.StreamFrame{f}
+			})
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.raw).To(HaveLen(int(maxPacketSize)))
+			Expect(p.frames[0].(*wire.StreamFrame).DataLenPresent).To(BeTrue())
+		})
+
+		It("pads retransmissions", func() {
+			packer.SetPaddingPolicy(PaddingAll)
+			packer.QueueControlFrame(&wire.StopWaitingFrame{LeastUnacked: 1})
+			q := newRetransmissionQueue()
+			q.AddFrames([]wire.Frame{&wire.StreamFrame{StreamID: 5, Data: []byte("foobar")}}, 10)
+			p, err := packer.PackRetransmission(q)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.raw).To(HaveLen(int(maxPacketSize)))
+			Expect(p.frames[1].(*wire.StreamFrame).DataLenPresent).To(BeTrue())
+		})
+
+		It("pads handshake packets", func() {
+			packer.SetPaddingPolicy(PaddingHandshake)
+			packer.cryptoSetup.(*mockCryptoSetup).encLevelSealCrypto = protocol.EncryptionSecure
+			mockStreamFramer.EXPECT().HasCryptoStreamData().Return(true)
+			mockStreamFramer.EXPECT().PopCryptoStreamFrame(gomock.Any()).Return(&wire.StreamFrame{
+				StreamID: packer.version.CryptoStreamID(),
+				Data:     []byte("foobar"),
+			})
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.raw).To(HaveLen(int(maxPacketSize)))
+			Expect(p.frames[0].(*wire.StreamFrame).DataLenPresent).To(BeTrue())
+		})
+
+		It("doesn't pad forward-secure packets when only padding handshake packets", func() {
+			packer.SetPaddingPolicy(PaddingHandshake)
+			packer.QueueControlFrame(&wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 10}}})
+			p, err := packer.PackAckPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(p.raw)).To(BeNumerically("<", maxPacketSize))
+		})
+
+		It("pads handshake packets of IETF QUIC", func() {
+			packer.SetPaddingPolicy(PaddingHandshake)
+			packer.version = protocol.VersionTLS
+			packer.cryptoSetup.(*mockCryptoSetup).encLevelSealCrypto = protocol.EncryptionUnencrypted
+			mockStreamFramer.EXPECT().HasCryptoStreamData().Return(true)
+			mockStreamFramer.EXPECT().PopCryptoStreamFrame(gomock.Any()).Return(&wire.StreamFrame{
+				StreamID: packer.version.CryptoStreamID(),
+				Data:     []byte("foobar"),
+			})
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.header.Type).To(Equal(protocol.PacketTypeHandshake))
+			Expect(p.raw).To(HaveLen(int(maxPacketSize)))
+			// the payload length includes the padding
+			r := bytes.NewReader(p.raw)
+			hdr, err := wire.ParseHeaderSentByServer(r, protocol.ConnectionIDLen)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.PayloadLen).To(BeEquivalentTo(r.Len()))
+		})
+	})
+
 	Context("max packet size", func() {
 		It("sets the maximum packet size", func() {
 			for i := 0; i < 10*int(maxPacketSize); i++ {
@@ -1035,5 +1282,47 @@ var _ = Describe("Packet packer", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(p.raw).To(HaveLen(int(maxPacketSize)))
 		})
+
+		It("increases the max packet size after MTU discovery", func() {
+			for i := 0; i < 10*int(maxPacketSize); i++ {
+				packer.QueueControlFrame(&wire.PingFrame{})
+			}
+			mockStreamFramer.EXPECT().HasCryptoStreamData().AnyTimes()
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any()).AnyTimes()
+			packer.IncreaseMaxPacketSize(maxPacketSize + 10)
+			Expect(packer.MaxPacketSize()).To(Equal(maxPacketSize + 10))
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.raw).To(HaveLen(int(maxPacketSize) + 10))
+			// a smaller size doesn't decrease the max packet size
+			packer.IncreaseMaxPacketSize(maxPacketSize)
+			Expect(packer.MaxPacketSize()).To(Equal(maxPacketSize + 10))
+		})
+	})
+
+	Context("MTU probes", func() {
+		It("packs a PING frame, padded to the probe size", func() {
+			packer.controlFrames = []wire.Frame{&wire.MaxStreamDataFrame{StreamID: 37}}
+			p, err := packer.PackMTUProbePacket(maxPacketSize + 50)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{&wire.PingFrame{}}))
+			Expect(p.raw).To(HaveLen(int(maxPacketSize) + 50))
+			Expect(p.isMTUProbe).To(BeTrue())
+			Expect(p.ToAckHandlerPacket().IsMTUProbe).To(BeTrue())
+			Expect(packer.controlFrames).To(HaveLen(1))
+			// the max packet size is not changed
+			Expect(packer.MaxPacketSize()).To(Equal(maxPacketSize))
+		})
+
+		It("doesn't pack probes larger than the maximum receive packet size", func() {
+			_, err := packer.PackMTUProbePacket(protocol.MaxReceivePacketSize + 1)
+			Expect(err).To(MatchError("PacketPacker BUG: can't pad packet to 1453 bytes"))
+		})
+
+		It("only sends probes in forward-secure packets", func() {
+			packer.cryptoSetup = &mockCryptoSetup{encLevelSeal: protocol.EncryptionSecure}
+			_, err := packer.PackMTUProbePacket(maxPacketSize)
+			Expect(err).To(MatchError("packet packer BUG: MTU probes can only be sent in forward-secure packets"))
+		})
 	})
 })
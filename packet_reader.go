@@ -0,0 +1,76 @@
+package quic
+
+import (
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"golang.org/x/net/ipv4"
+)
+
+// A packetReader reads packets from a net.PacketConn into buffers from the buffer pool.
+// If the net.PacketConn supports it (see oobConn), multiple packets are read in a single system call (recvmmsg on Linux),
+// into a ring of buffers. When a packet is returned, its buffer is replaced by a new buffer from the pool.
+// A packetReader must only be used by a single Go routine.
+type packetReader struct {
+	pconn net.PacketConn
+	// batchConn is set if batches of packets are read
+	batchConn *oobConn
+
+	msgs    []ipv4.Message
+	buffers []*[]byte
+	// the number of packets read by the last system call, and the index of the next packet to return
+	numRead, next int
+}
+
+func newPacketReader(pconn net.PacketConn) *packetReader {
+	r := &packetReader{pconn: pconn}
+	c, ok := pconn.(*oobConn)
+	if !ok || batchSize == 1 {
+		return r
+	}
+	r.batchConn = c
+	r.msgs = make([]ipv4.Message, batchSize)
+	r.buffers = make([]*[]byte, batchSize)
+	for i := range r.msgs {
+		r.buffers[i] = getPacketBuffer()
+		r.msgs[i].Buffers = [][]byte{(*r.buffers[i])[:protocol.MaxReceivePacketSize]}
+		r.msgs[i].OOB = make([]byte, oobSize)
+	}
+	return r
+}
+
+// ReadPacket reads the next packet into a buffer from the buffer pool.
+// The buffer is sliced to the length of the packet. It is owned by the caller, who must return it to the pool
+// (see receivedPacket.release) once the packet was processed.
+// The packet size should not exceed protocol.MaxReceivePacketSize bytes.
+// If it does, we only read a truncated packet, which will then end up undecryptable.
+func (r *packetReader) ReadPacket() (*[]byte, net.Addr, packetInfo, error) {
+	if r.batchConn == nil {
+		buf := getPacketBuffer()
+		n, addr, info, err := readPacket(r.pconn, (*buf)[:protocol.MaxReceivePacketSize])
+		if err != nil {
+			putPacketBuffer(buf)
+			return nil, nil, packetInfo{}, err
+		}
+		*buf = (*buf)[:n]
+		return buf, addr, info, nil
+	}
+	if r.next == r.numRead {
+		n, err := r.batchConn.batchConn.ReadBatch(r.msgs, 0)
+		if err != nil {
+			return nil, nil, packetInfo{}, err
+		}
+		r.numRead = n
+		r.next = 0
+	}
+	msg := &r.msgs[r.next]
+	buf := r.buffers[r.next]
+	*buf = (*buf)[:msg.N]
+	addr := msg.Addr
+	info := parseControlMessages(msg.OOB[:msg.NN])
+	// hand the buffer to the caller, and replace it with a new one
+	r.buffers[r.next] = getPacketBuffer()
+	msg.Buffers[0] = (*r.buffers[r.next])[:protocol.MaxReceivePacketSize]
+	r.next++
+	return buf, addr, info, nil
+}
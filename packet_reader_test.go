@@ -0,0 +1,83 @@
+package quic
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Packet Reader", func() {
+	It("reads packets from a net.PacketConn that doesn't support batching", func() {
+		pconn := newMockPacketConn()
+		pconn.dataReadFrom = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
+		pconn.dataToRead <- []byte("foo")
+		pconn.dataToRead <- []byte("bar")
+		r := newPacketReader(pconn)
+		Expect(r.batchConn).To(BeNil())
+		buf, addr, _, err := r.ReadPacket()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*buf).To(Equal([]byte("foo")))
+		Expect(cap(*buf)).To(BeEquivalentTo(protocol.MaxReceivePacketSize))
+		Expect(addr).To(Equal(pconn.dataReadFrom))
+		buf, _, _, err = r.ReadPacket()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*buf).To(Equal([]byte("bar")))
+	})
+
+	It("returns read errors", func() {
+		pconn := newMockPacketConn()
+		pconn.readErr = fmt.Errorf("read failed")
+		_, _, _, err := newPacketReader(pconn).ReadPacket()
+		Expect(err).To(MatchError("read failed"))
+	})
+
+	It("hands out a new buffer for every packet", func() {
+		pconn := newMockPacketConn()
+		pconn.dataReadFrom = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
+		pconn.dataToRead <- []byte("foo")
+		pconn.dataToRead <- []byte("bar")
+		r := newPacketReader(pconn)
+		buf1, _, _, err := r.ReadPacket()
+		Expect(err).ToNot(HaveOccurred())
+		buf2, _, _, err := r.ReadPacket()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buf1).ToNot(BeIdenticalTo(buf2))
+		Expect(*buf1).To(Equal([]byte("foo")))
+	})
+
+	It("reads packets from a UDP connection", func() {
+		addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		udpConn, err := net.ListenUDP("udp", addr)
+		Expect(err).ToNot(HaveOccurred())
+		pconn := wrapConn(udpConn)
+		defer pconn.Close()
+		sender, err := net.ListenUDP("udp", addr)
+		Expect(err).ToNot(HaveOccurred())
+		defer sender.Close()
+
+		// send more packets than are read in a single system call
+		numPackets := 3*batchSize + 1
+		for i := 0; i < numPackets; i++ {
+			_, err := sender.WriteTo([]byte(fmt.Sprintf("packet %d", i)), pconn.LocalAddr())
+			Expect(err).ToNot(HaveOccurred())
+		}
+		r := newPacketReader(pconn)
+		var packets [][]byte
+		for i := 0; i < numPackets; i++ {
+			buf, remoteAddr, _, err := r.ReadPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(remoteAddr.String()).To(Equal(sender.LocalAddr().String()))
+			Expect(cap(*buf)).To(BeEquivalentTo(protocol.MaxReceivePacketSize))
+			packets = append(packets, *buf)
+		}
+		// make sure that the buffers of the packets are not reused
+		for i, data := range packets {
+			Expect(string(data)).To(Equal(fmt.Sprintf("packet %d", i)))
+		}
+	})
+})
@@ -13,6 +13,21 @@ type unpackedPacket struct {
 	frames          []wire.Frame
 }
 
+// unpackResult returns the unpacked packet, and the error that occurred when parsing the frames.
+// If a frame of an unknown type was encountered, the frames before it are returned along with the error,
+// so that the session can still process (and acknowledge) the packet, if it ignores unknown frames.
+func unpackResult(encLevel protocol.EncryptionLevel, fs []wire.Frame, err error) (*unpackedPacket, error) {
+	if err != nil {
+		if _, ok := err.(*wire.UnknownFrameTypeError); !ok {
+			return nil, err
+		}
+	}
+	return &unpackedPacket{
+		encryptionLevel: encLevel,
+		frames:          fs,
+	}, err
+}
+
 type gQUICAEAD interface {
 	Open(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, protocol.EncryptionLevel, error)
 }
@@ -37,7 +52,7 @@ func (u *packetUnpackerBase) parseFrames(decrypted []byte, hdr *wire.Header) ([]
 	for {
 		frame, err := wire.ParseNextFrame(r, hdr, u.version)
 		if err != nil {
-			return nil, err
+			return fs, err
 		}
 		if frame == nil {
 			break
@@ -70,14 +85,7 @@ func (u *packetUnpackerGQUIC) Unpack(headerBinary []byte, hdr *wire.Header, data
 	}
 
 	fs, err := u.parseFrames(decrypted, hdr)
-	if err != nil {
-		return nil, err
-	}
-
-	return &unpackedPacket{
-		encryptionLevel: encryptionLevel,
-		frames:          fs,
-	}, nil
+	return unpackResult(encryptionLevel, fs, err)
 }
 
 // The packetUnpacker unpacks IETF QUIC packets.
@@ -116,12 +124,5 @@ func (u *packetUnpacker) Unpack(headerBinary []byte, hdr *wire.Header, data []by
 	}
 
 	fs, err := u.parseFrames(decrypted, hdr)
-	if err != nil {
-		return nil, err
-	}
-
-	return &unpackedPacket{
-		encryptionLevel: encryptionLevel,
-		frames:          fs,
-	}, nil
+	return unpackResult(encryptionLevel, fs, err)
 }
@@ -95,4 +95,15 @@ var _ = Describe("Packet Unpacker (for IETF QUIC)", func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(packet.frames).To(Equal([]wire.Frame{&wire.PingFrame{}, &wire.BlockedFrame{}}))
 	})
+
+	It("returns the frames before a frame of an unknown type", func() {
+		buf := &bytes.Buffer{}
+		(&wire.PingFrame{}).Write(buf, versionIETFFrames)
+		buf.Write([]byte{0x42, 0x13, 0x37})
+		aead.EXPECT().Open1RTT(gomock.Any(), gomock.Any(), hdr.PacketNumber, hdr.Raw).Return(buf.Bytes(), nil)
+		packet, err := unpacker.Unpack(hdr.Raw, hdr, nil)
+		Expect(err).To(BeAssignableToTypeOf(&wire.UnknownFrameTypeError{}))
+		Expect(packet).ToNot(BeNil())
+		Expect(packet.frames).To(Equal([]wire.Frame{&wire.PingFrame{}}))
+	})
 })
@@ -0,0 +1,94 @@
+package quic
+
+import (
+	"net"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+// The pathValidator validates a new peer address before the session starts sending to it.
+// It sends PATH_CHALLENGE frames to the new address, and only accepts the address once
+// a PATH_RESPONSE frame echoing the data of one of these PATH_CHALLENGEs is received.
+// This prevents an attacker from redirecting traffic to a victim by spoofing the source address of a packet.
+type pathValidator struct {
+	timeout   time.Duration
+	maxProbes int
+
+	// the address that is being validated, nil if no validation is in progress
+	addr       net.Addr
+	challenges [][8]byte
+	alarm      time.Time
+}
+
+func newPathValidator(timeout time.Duration, maxProbes int) *pathValidator {
+	return &pathValidator{
+		timeout:   timeout,
+		maxProbes: maxProbes,
+	}
+}
+
+// IsValidating says if addr is currently being validated.
+func (v *pathValidator) IsValidating(addr net.Addr) bool {
+	return v.addr != nil && addr.Network() == v.addr.Network() && addr.String() == v.addr.String()
+}
+
+// Addr returns the address that is currently being validated.
+func (v *pathValidator) Addr() net.Addr {
+	return v.addr
+}
+
+// Start starts the validation of addr.
+// A validation that is already in progress is abandoned.
+func (v *pathValidator) Start(addr net.Addr, now time.Time) (*wire.PathChallengeFrame, error) {
+	v.addr = addr
+	v.challenges = v.challenges[:0]
+	return v.newChallenge(now)
+}
+
+// HandlePathResponse handles a PATH_RESPONSE frame.
+// It returns the validated address, or nil if the frame doesn't match any of the PATH_CHALLENGEs sent.
+func (v *pathValidator) HandlePathResponse(frame *wire.PathResponseFrame) net.Addr {
+	for _, data := range v.challenges {
+		if data == frame.Data {
+			addr := v.addr
+			v.reset()
+			return addr
+		}
+	}
+	return nil
+}
+
+// GetAlarmTimeout returns the time when the next PATH_CHALLENGE has to be sent,
+// or the zero time if no validation is in progress.
+func (v *pathValidator) GetAlarmTimeout() time.Time {
+	return v.alarm
+}
+
+// OnAlarm is called when the probe timeout expires.
+// It returns the next PATH_CHALLENGE, or nil if the maximum number of probes was sent,
+// in which case the validation failed.
+func (v *pathValidator) OnAlarm(now time.Time) (*wire.PathChallengeFrame, error) {
+	if len(v.challenges) >= v.maxProbes {
+		v.reset()
+		return nil, nil
+	}
+	return v.newChallenge(now)
+}
+
+func (v *pathValidator) newChallenge(now time.Time) (*wire.PathChallengeFrame, error) {
+	frame := &wire.PathChallengeFrame{}
+	if err := protocol.ReadRandom(frame.Data[:]); err != nil {
+		return nil, err
+	}
+	v.challenges = append(v.challenges, frame.Data)
+	v.alarm = now.Add(v.timeout)
+	return frame, nil
+}
+
+func (v *pathValidator) reset() {
+	v.addr = nil
+	v.challenges = nil
+	v.alarm = time.Time{}
+}
@@ -0,0 +1,88 @@
+package quic
+
+import (
+	"net"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Path Validator", func() {
+	var (
+		v    *pathValidator
+		addr *net.UDPAddr
+	)
+
+	BeforeEach(func() {
+		v = newPathValidator(time.Second, 3)
+		addr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
+	})
+
+	It("doesn't set an alarm if no validation is in progress", func() {
+		Expect(v.GetAlarmTimeout()).To(BeZero())
+		Expect(v.Addr()).To(BeNil())
+		Expect(v.IsValidating(addr)).To(BeFalse())
+	})
+
+	It("validates an address", func() {
+		now := time.Now()
+		frame, err := v.Start(addr, now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame.Data).ToNot(BeZero())
+		Expect(v.IsValidating(addr)).To(BeTrue())
+		Expect(v.IsValidating(&net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1338})).To(BeFalse())
+		Expect(v.GetAlarmTimeout()).To(Equal(now.Add(time.Second)))
+		Expect(v.HandlePathResponse(&wire.PathResponseFrame{Data: frame.Data})).To(Equal(addr))
+		Expect(v.Addr()).To(BeNil())
+		Expect(v.GetAlarmTimeout()).To(BeZero())
+	})
+
+	It("ignores PATH_RESPONSEs that don't match a PATH_CHALLENGE", func() {
+		frame, err := v.Start(addr, time.Now())
+		Expect(err).ToNot(HaveOccurred())
+		data := frame.Data
+		data[0]++
+		Expect(v.HandlePathResponse(&wire.PathResponseFrame{Data: data})).To(BeNil())
+		Expect(v.IsValidating(addr)).To(BeTrue())
+	})
+
+	It("accepts PATH_RESPONSEs for retransmitted PATH_CHALLENGEs", func() {
+		now := time.Now()
+		frame1, err := v.Start(addr, now)
+		Expect(err).ToNot(HaveOccurred())
+		frame2, err := v.OnAlarm(now.Add(time.Second))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame2.Data).ToNot(Equal(frame1.Data))
+		Expect(v.GetAlarmTimeout()).To(Equal(now.Add(2 * time.Second)))
+		Expect(v.HandlePathResponse(&wire.PathResponseFrame{Data: frame1.Data})).To(Equal(addr))
+	})
+
+	It("gives up after the maximum number of probes", func() {
+		now := time.Now()
+		_, err := v.Start(addr, now)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 1; i < 3; i++ {
+			frame, err := v.OnAlarm(now)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).ToNot(BeNil())
+		}
+		frame, err := v.OnAlarm(now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(BeNil())
+		Expect(v.Addr()).To(BeNil())
+		Expect(v.GetAlarmTimeout()).To(BeZero())
+	})
+
+	It("abandons a validation when a new one is started", func() {
+		frame, err := v.Start(addr, time.Now())
+		Expect(err).ToNot(HaveOccurred())
+		newAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 2), Port: 1337}
+		_, err = v.Start(newAddr, time.Now())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v.HandlePathResponse(&wire.PathResponseFrame{Data: frame.Data})).To(BeNil())
+		Expect(v.IsValidating(newAddr)).To(BeTrue())
+	})
+})
@@ -2,6 +2,7 @@ package qerr
 
 import (
 	"fmt"
+	"net"
 )
 
 // ErrorCode can be used as a normal error without reason.
@@ -15,8 +16,15 @@ func (e ErrorCode) Error() string {
 type QuicError struct {
 	ErrorCode    ErrorCode
 	ErrorMessage string
+	// Remote is set if the error was sent by the peer, e.g. in a CONNECTION_CLOSE frame
+	Remote bool
+
+	// the error that caused this QuicError, if it was converted from a different error by ToQuicError
+	err error
 }
 
+var _ net.Error = &QuicError{}
+
 // Error creates a new QuicError instance
 func Error(errorCode ErrorCode, errorMessage string) *QuicError {
 	return &QuicError{
@@ -25,6 +33,15 @@ func Error(errorCode ErrorCode, errorMessage string) *QuicError {
 	}
 }
 
+// RemoteError creates a new QuicError for an error sent by the peer
+func RemoteError(errorCode ErrorCode, errorMessage string) *QuicError {
+	return &QuicError{
+		ErrorCode:    errorCode,
+		ErrorMessage: errorMessage,
+		Remote:       true,
+	}
+}
+
 func (e *QuicError) Error() string {
 	return fmt.Sprintf("%s: %s", e.ErrorCode.String(), e.ErrorMessage)
 }
@@ -40,6 +57,30 @@ func (e *QuicError) Timeout() bool {
 	return false
 }
 
+// Temporary says if this error is temporary.
+// QuicErrors always close the session, so they are never temporary.
+func (e *QuicError) Temporary() bool {
+	return false
+}
+
+// Is says if the target is an ErrorCode or a QuicError with the same error code.
+// This allows using errors.Is(err, qerr.HandshakeTimeout) instead of comparing the error messages.
+func (e *QuicError) Is(target error) bool {
+	switch t := target.(type) {
+	case ErrorCode:
+		return e.ErrorCode == t
+	case *QuicError:
+		return e.ErrorCode == t.ErrorCode
+	}
+	return false
+}
+
+// Unwrap returns the error that was converted to this QuicError by ToQuicError.
+// It returns nil for all other QuicErrors.
+func (e *QuicError) Unwrap() error {
+	return e.err
+}
+
 // ToQuicError converts an arbitrary error to a QuicError. It leaves QuicErrors
 // unchanged, and properly handles `ErrorCode`s.
 func ToQuicError(err error) *QuicError {
@@ -49,5 +90,9 @@ func ToQuicError(err error) *QuicError {
 	case ErrorCode:
 		return Error(e, "")
 	}
-	return Error(InternalError, err.Error())
+	return &QuicError{
+		ErrorCode:    InternalError,
+		ErrorMessage: err.Error(),
+		err:          err,
+	}
 }
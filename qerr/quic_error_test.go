@@ -26,6 +26,38 @@ var _ = Describe("Quic error", func() {
 		It("works as timeout error", func() {
 			err := Error(HandshakeTimeout, "handshake timeout")
 			Expect(err.Timeout()).Should(BeTrue())
+			Expect(err.Temporary()).To(BeFalse())
+		})
+
+		It("is not a timeout error for other error codes", func() {
+			Expect(Error(DecryptionFailure, "foobar").Timeout()).To(BeFalse())
+		})
+	})
+
+	Context("remote errors", func() {
+		It("creates remote errors", func() {
+			err := RemoteError(PeerGoingAway, "bye")
+			Expect(err.Remote).To(BeTrue())
+			Expect(err.ErrorCode).To(Equal(PeerGoingAway))
+			Expect(err.ErrorMessage).To(Equal("bye"))
+			Expect(Error(PeerGoingAway, "bye").Remote).To(BeFalse())
+		})
+	})
+
+	Context("comparing errors", func() {
+		It("is an error with the same error code", func() {
+			err := Error(HandshakeTimeout, "foobar")
+			Expect(err.Is(HandshakeTimeout)).To(BeTrue())
+			Expect(err.Is(DecryptionFailure)).To(BeFalse())
+			Expect(err.Is(Error(HandshakeTimeout, "other reason"))).To(BeTrue())
+			Expect(err.Is(RemoteError(HandshakeTimeout, ""))).To(BeTrue())
+			Expect(err.Is(Error(DecryptionFailure, "foobar"))).To(BeFalse())
+			Expect(err.Is(io.EOF)).To(BeFalse())
+		})
+
+		It("unwraps errors converted by ToQuicError", func() {
+			Expect(ToQuicError(io.EOF).Unwrap()).To(Equal(io.EOF))
+			Expect(Error(DecryptionFailure, "foobar").Unwrap()).To(BeNil())
 		})
 	})
 
@@ -41,7 +73,10 @@ var _ = Describe("Quic error", func() {
 		})
 
 		It("changes default errors to InternalError", func() {
-			Expect(ToQuicError(io.EOF)).To(Equal(Error(InternalError, "EOF")))
+			err := ToQuicError(io.EOF)
+			Expect(err.ErrorCode).To(Equal(InternalError))
+			Expect(err.ErrorMessage).To(Equal("EOF"))
+			Expect(err.Remote).To(BeFalse())
 		})
 	})
 })
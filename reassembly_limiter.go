@@ -0,0 +1,46 @@
+package quic
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/qerr"
+)
+
+// The reassemblyLimiter limits the amount of out-of-order stream data that is buffered,
+// both for every single stream and for all streams of a session.
+// All methods may be called on a nil reassemblyLimiter, which doesn't enforce any limits.
+type reassemblyLimiter struct {
+	mutex sync.Mutex
+
+	maxStreamBytes     protocol.ByteCount
+	maxConnectionBytes protocol.ByteCount
+	bufferedBytes      protocol.ByteCount
+}
+
+func newReassemblyLimiter(maxStreamBytes, maxConnectionBytes protocol.ByteCount) *reassemblyLimiter {
+	return &reassemblyLimiter{
+		maxStreamBytes:     maxStreamBytes,
+		maxConnectionBytes: maxConnectionBytes,
+	}
+}
+
+// Update updates the amount of out-of-order data buffered for a stream.
+// It returns an error if the new amount exceeds the stream or the connection limit.
+func (l *reassemblyLimiter) Update(streamID protocol.StreamID, oldLen, newLen protocol.ByteCount) error {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.bufferedBytes = l.bufferedBytes - oldLen + newLen
+	if newLen > l.maxStreamBytes {
+		return qerr.Error(qerr.FlowControlReceivedTooMuchData, fmt.Sprintf("Buffered %d bytes of out-of-order data on stream %d, allowed %d bytes", newLen, streamID, l.maxStreamBytes))
+	}
+	if l.bufferedBytes > l.maxConnectionBytes {
+		return qerr.Error(qerr.FlowControlReceivedTooMuchData, fmt.Sprintf("Buffered %d bytes of out-of-order data for the connection, allowed %d bytes", l.bufferedBytes, l.maxConnectionBytes))
+	}
+	return nil
+}
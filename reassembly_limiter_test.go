@@ -0,0 +1,46 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/qerr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reassembly Limiter", func() {
+	var l *reassemblyLimiter
+
+	BeforeEach(func() {
+		l = newReassemblyLimiter(100, 150)
+	})
+
+	It("accepts data up to the stream limit", func() {
+		Expect(l.Update(5, 0, 100)).To(Succeed())
+		Expect(l.bufferedBytes).To(Equal(protocol.ByteCount(100)))
+	})
+
+	It("errors when the stream limit is exceeded", func() {
+		err := l.Update(5, 0, 101)
+		Expect(err).To(MatchError(qerr.Error(qerr.FlowControlReceivedTooMuchData, "Buffered 101 bytes of out-of-order data on stream 5, allowed 100 bytes")))
+	})
+
+	It("errors when the connection limit is exceeded", func() {
+		Expect(l.Update(5, 0, 80)).To(Succeed())
+		err := l.Update(7, 0, 71)
+		Expect(err).To(MatchError(qerr.Error(qerr.FlowControlReceivedTooMuchData, "Buffered 151 bytes of out-of-order data for the connection, allowed 150 bytes")))
+	})
+
+	It("releases data", func() {
+		Expect(l.Update(5, 0, 80)).To(Succeed())
+		Expect(l.Update(5, 80, 20)).To(Succeed())
+		Expect(l.Update(7, 0, 100)).To(Succeed())
+		Expect(l.bufferedBytes).To(Equal(protocol.ByteCount(120)))
+		Expect(l.Update(7, 100, 0)).To(Succeed())
+		Expect(l.bufferedBytes).To(Equal(protocol.ByteCount(20)))
+	})
+
+	It("doesn't enforce any limits when nil", func() {
+		var l *reassemblyLimiter
+		Expect(l.Update(5, 0, protocol.MaxByteCount)).To(Succeed())
+	})
+})
@@ -8,7 +8,6 @@ import (
 
 	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
-	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 )
 
@@ -17,6 +16,7 @@ type receiveStreamI interface {
 
 	handleStreamFrame(*wire.StreamFrame) error
 	handleRstStreamFrame(*wire.RstStreamFrame) error
+	handleExpiredStreamDataFrame(*wire.ExpiredStreamDataFrame) error
 	closeForShutdown(error)
 	getWindowUpdate() protocol.ByteCount
 }
@@ -25,42 +25,53 @@ type receiveStream struct {
 	mutex sync.Mutex
 
 	streamID protocol.StreamID
+	openedAt time.Time
 
 	sender streamSender
 
 	frameQueue     *streamFrameSorter
+	finReceived    bool
 	readPosInFrame int
 	readOffset     protocol.ByteCount
 
+	state receiveStreamState
+
 	closeForShutdownErr error
 	cancelReadErr       error
 	resetRemotelyErr    StreamError
 
-	closedForShutdown bool // set when CloseForShutdown() is called
-	finRead           bool // set once we read a frame with a FinBit
-	canceledRead      bool // set when CancelRead() is called
-	resetRemotely     bool // set when HandleRstStreamFrame() is called
-
 	readChan     chan struct{}
 	readDeadline time.Time
 
 	flowController flowcontrol.StreamFlowController
-	version        protocol.VersionNumber
+	reassembly     *reassemblyLimiter
+	// the number of out-of-order bytes accounted for in the reassemblyLimiter
+	reassemblyBytes protocol.ByteCount
+
+	// statistics
+	bytesReceived  protocol.ByteCount
+	framesReceived uint64
+
+	version protocol.VersionNumber
 }
 
 var _ ReceiveStream = &receiveStream{}
+var _ io.WriterTo = &receiveStream{}
 var _ receiveStreamI = &receiveStream{}
 
 func newReceiveStream(
 	streamID protocol.StreamID,
 	sender streamSender,
 	flowController flowcontrol.StreamFlowController,
+	reassembly *reassemblyLimiter,
 	version protocol.VersionNumber,
 ) *receiveStream {
 	return &receiveStream{
 		streamID:       streamID,
+		openedAt:       time.Now(),
 		sender:         sender,
 		flowController: flowController,
+		reassembly:     reassembly,
 		frameQueue:     newStreamFrameSorter(),
 		readChan:       make(chan struct{}, 1),
 		version:        version,
@@ -76,59 +87,21 @@ func (s *receiveStream) Read(p []byte) (int, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if s.finRead {
+	if s.state == receiveStreamStateDataRead {
 		return 0, io.EOF
 	}
-	if s.canceledRead {
-		return 0, s.cancelReadErr
-	}
-	if s.resetRemotely {
-		return 0, s.resetRemotelyErr
-	}
-	if s.closedForShutdown {
-		return 0, s.closeForShutdownErr
+	if err := s.getReadError(); err != nil {
+		return 0, err
 	}
 
 	bytesRead := 0
 	for bytesRead < len(p) {
-		frame := s.frameQueue.Head()
-		if frame == nil && bytesRead > 0 {
+		if s.frameQueue.Head() == nil && bytesRead > 0 {
 			return bytesRead, s.closeForShutdownErr
 		}
-
-		for {
-			// Stop waiting on errors
-			if s.closedForShutdown {
-				return bytesRead, s.closeForShutdownErr
-			}
-			if s.canceledRead {
-				return bytesRead, s.cancelReadErr
-			}
-			if s.resetRemotely {
-				return bytesRead, s.resetRemotelyErr
-			}
-
-			deadline := s.readDeadline
-			if !deadline.IsZero() && !time.Now().Before(deadline) {
-				return bytesRead, errDeadline
-			}
-
-			if frame != nil {
-				s.readPosInFrame = int(s.readOffset - frame.Offset)
-				break
-			}
-
-			s.mutex.Unlock()
-			if deadline.IsZero() {
-				<-s.readChan
-			} else {
-				select {
-				case <-s.readChan:
-				case <-time.After(time.Until(deadline)):
-				}
-			}
-			s.mutex.Lock()
-			frame = s.frameQueue.Head()
+		frame, err := s.waitForFrame()
+		if err != nil {
+			return bytesRead, err
 		}
 
 		if bytesRead > len(p) {
@@ -138,45 +111,134 @@ func (s *receiveStream) Read(p []byte) (int, error) {
 			return bytesRead, fmt.Errorf("BUG: readPosInFrame (%d) > frame.DataLen (%d) in stream.Read", s.readPosInFrame, frame.DataLen())
 		}
 
+		readOffset := s.readOffset
 		s.mutex.Unlock()
+		m := copy(p[bytesRead:], frame.Data[s.readPosInFrame:])
+		s.mutex.Lock()
 
-		copy(p[bytesRead:], frame.Data[s.readPosInFrame:])
-		m := utils.Min(len(p)-bytesRead, int(frame.DataLen())-s.readPosInFrame)
-		s.readPosInFrame += m
 		bytesRead += m
-		s.readOffset += protocol.ByteCount(m)
+		// If expired data was skipped while copying, the frame was already removed from the frame queue.
+		if s.readOffset != readOffset {
+			continue
+		}
+		if s.consumeFrameData(frame, m) {
+			return bytesRead, io.EOF
+		}
+	}
+	return bytesRead, nil
+}
 
-		s.mutex.Lock()
-		// when a RST_STREAM was received, the was already informed about the final byteOffset for this stream
-		if !s.resetRemotely {
-			s.flowController.AddBytesRead(protocol.ByteCount(m))
+// WriteTo implements io.WriterTo.
+// It passes the data of the received STREAM frames to w, without copying it to an intermediate buffer.
+func (s *receiveStream) WriteTo(w io.Writer) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.state == receiveStreamStateDataRead {
+		return 0, nil
+	}
+	if err := s.getReadError(); err != nil {
+		return 0, err
+	}
+
+	var bytesWritten int64
+	for {
+		frame, err := s.waitForFrame()
+		if err != nil {
+			return bytesWritten, err
+		}
+		if s.readPosInFrame > int(frame.DataLen()) {
+			return bytesWritten, fmt.Errorf("BUG: readPosInFrame (%d) > frame.DataLen (%d) in stream.WriteTo", s.readPosInFrame, frame.DataLen())
+		}
+
+		var m int
+		var writeErr error
+		readOffset := s.readOffset
+		if data := frame.Data[s.readPosInFrame:]; len(data) > 0 {
+			s.mutex.Unlock()
+			m, writeErr = w.Write(data)
+			s.mutex.Lock()
+		}
+
+		bytesWritten += int64(m)
+		// If expired data was skipped while writing, the frame was already removed from the frame queue.
+		if s.readOffset == readOffset && s.consumeFrameData(frame, m) {
+			return bytesWritten, nil
+		}
+		if writeErr != nil {
+			return bytesWritten, writeErr
 		}
-		// increase the flow control window, if necessary
-		s.flowController.MaybeQueueWindowUpdate()
-
-		if s.readPosInFrame >= int(frame.DataLen()) {
-			s.frameQueue.Pop()
-			s.finRead = frame.FinBit
-			if frame.FinBit {
-				s.sender.onStreamCompleted(s.streamID)
-				return bytesRead, io.EOF
+	}
+}
+
+// waitForFrame blocks until the next frame can be read from the frame queue.
+// It sets the readPosInFrame for the frame it returns.
+// must be called after locking the mutex
+func (s *receiveStream) waitForFrame() (*wire.StreamFrame, error) {
+	frame := s.frameQueue.Head()
+	for {
+		// Stop waiting on errors
+		if err := s.getReadError(); err != nil {
+			return nil, err
+		}
+
+		deadline := s.readDeadline
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return nil, errDeadline
+		}
+
+		if frame != nil {
+			s.readPosInFrame = int(s.readOffset - frame.Offset)
+			return frame, nil
+		}
+
+		s.mutex.Unlock()
+		if deadline.IsZero() {
+			<-s.readChan
+		} else {
+			select {
+			case <-s.readChan:
+			case <-time.After(time.Until(deadline)):
 			}
 		}
+		s.mutex.Lock()
+		frame = s.frameQueue.Head()
 	}
-	return bytesRead, nil
+}
+
+// consumeFrameData marks n bytes of the frame as read.
+// It returns true if the frame had the FIN bit set, and all its data was read.
+// must be called after locking the mutex
+func (s *receiveStream) consumeFrameData(frame *wire.StreamFrame, n int) bool {
+	s.readPosInFrame += n
+	s.readOffset += protocol.ByteCount(n)
+
+	// when a RST_STREAM was received, the was already informed about the final byteOffset for this stream
+	if s.state != receiveStreamStateResetReceived {
+		s.flowController.AddBytesRead(protocol.ByteCount(n))
+	}
+	// increase the flow control window, if necessary
+	s.flowController.MaybeQueueWindowUpdate()
+
+	if s.readPosInFrame >= int(frame.DataLen()) {
+		s.frameQueue.Pop()
+		// If the stream was reset or canceled while the data was read, it was already completed.
+		if frame.FinBit && s.transitionTo(receiveStreamStateDataRead) == nil {
+			s.sender.onStreamCompleted(s.streamID)
+			return true
+		}
+	}
+	return false
 }
 
 func (s *receiveStream) CancelRead(errorCode protocol.ApplicationErrorCode) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if s.finRead {
-		return nil
-	}
-	if s.canceledRead {
+	// CancelRead is a no-op if the stream was already completed or canceled
+	if err := s.transitionTo(receiveStreamStateCanceled); err != nil {
 		return nil
 	}
-	s.canceledRead = true
 	s.cancelReadErr = fmt.Errorf("Read on stream %d canceled with error code %d", s.streamID, errorCode)
 	s.signalRead()
 	if s.version.UsesIETFFrameFormat() {
@@ -185,9 +247,23 @@ func (s *receiveStream) CancelRead(errorCode protocol.ApplicationErrorCode) erro
 			ErrorCode: errorCode,
 		})
 	}
+	s.maybeCompleteCanceled()
 	return nil
 }
 
+// maybeCompleteCanceled completes the stream after CancelRead was called, as soon as the FIN was received.
+// Otherwise the stream would never be completed (unless the peer resets it), since the remaining data will never be read.
+// must be called after locking the mutex
+func (s *receiveStream) maybeCompleteCanceled() {
+	if !s.finReceived || s.transitionTo(receiveStreamStateCanceledFinReceived) != nil {
+		return
+	}
+	// The buffered data will never be read, so it doesn't count towards the reassembly limit any more.
+	s.reassembly.Update(s.streamID, s.reassemblyBytes, 0)
+	s.reassemblyBytes = 0
+	s.sender.onStreamCompleted(s.streamID)
+}
+
 func (s *receiveStream) handleStreamFrame(frame *wire.StreamFrame) error {
 	maxOffset := frame.Offset + frame.DataLen()
 	if err := s.flowController.UpdateHighestReceived(maxOffset, frame.FinBit); err != nil {
@@ -196,9 +272,23 @@ func (s *receiveStream) handleStreamFrame(frame *wire.StreamFrame) error {
 
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	s.bytesReceived += frame.DataLen()
+	s.framesReceived++
 	if err := s.frameQueue.Push(frame); err != nil && err != errDuplicateStreamData {
 		return err
 	}
+	if frame.FinBit {
+		s.finReceived = true
+	}
+	// After receiving a RST_STREAM, the buffered data will never be read.
+	if s.state != receiveStreamStateResetReceived && s.state != receiveStreamStateCanceledFinReceived {
+		oldLen := s.reassemblyBytes
+		s.reassemblyBytes = s.frameQueue.OutOfOrderDataLen()
+		if err := s.reassembly.Update(s.streamID, oldLen, s.reassemblyBytes); err != nil {
+			return err
+		}
+	}
+	s.maybeCompleteCanceled()
 	s.signalRead()
 	return nil
 }
@@ -207,7 +297,7 @@ func (s *receiveStream) handleRstStreamFrame(frame *wire.RstStreamFrame) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if s.closedForShutdown {
+	if s.state == receiveStreamStateShutdown {
 		return nil
 	}
 	if err := s.flowController.UpdateHighestReceived(frame.ByteOffset, true); err != nil {
@@ -220,11 +310,14 @@ func (s *receiveStream) handleRstStreamFrame(frame *wire.RstStreamFrame) error {
 		return nil
 	}
 
-	// ignore duplicate RST_STREAM frames for this stream (after checking their final offset)
-	if s.resetRemotely {
+	// Ignore duplicate RST_STREAM frames for this stream (after checking their final offset),
+	// and RST_STREAM frames received after all data was read.
+	if err := s.transitionTo(receiveStreamStateResetReceived); err != nil {
 		return nil
 	}
-	s.resetRemotely = true
+	// The buffered data will never be read, so it doesn't count towards the reassembly limit any more.
+	s.reassembly.Update(s.streamID, s.reassemblyBytes, 0)
+	s.reassemblyBytes = 0
 	s.resetRemotelyErr = streamCanceledError{
 		errorCode: frame.ErrorCode,
 		error:     fmt.Errorf("Stream %d was reset with error code %d", s.streamID, frame.ErrorCode),
@@ -234,12 +327,39 @@ func (s *receiveStream) handleRstStreamFrame(frame *wire.RstStreamFrame) error {
 	return nil
 }
 
+// handleExpiredStreamDataFrame skips over data that the peer won't retransmit.
+func (s *receiveStream) handleExpiredStreamDataFrame(frame *wire.ExpiredStreamDataFrame) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.flowController.UpdateHighestReceived(frame.Offset, false); err != nil {
+		return err
+	}
+	if s.state != receiveStreamStateOpen || frame.Offset <= s.readOffset {
+		return nil
+	}
+	s.frameQueue.Skip(frame.Offset)
+	s.flowController.AddBytesRead(frame.Offset - s.readOffset)
+	s.flowController.MaybeQueueWindowUpdate()
+	s.readOffset = frame.Offset
+	oldLen := s.reassemblyBytes
+	s.reassemblyBytes = s.frameQueue.OutOfOrderDataLen()
+	if err := s.reassembly.Update(s.streamID, oldLen, s.reassemblyBytes); err != nil {
+		return err
+	}
+	s.signalRead()
+	return nil
+}
+
 func (s *receiveStream) CloseRemote(offset protocol.ByteCount) {
 	s.handleStreamFrame(&wire.StreamFrame{FinBit: true, Offset: offset})
 }
 
 func (s *receiveStream) onClose(offset protocol.ByteCount) {
-	if s.canceledRead && !s.version.UsesIETFFrameFormat() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.cancelReadErr != nil && !s.version.UsesIETFFrameFormat() {
 		s.sender.queueControlFrame(&wire.RstStreamFrame{
 			StreamID:   s.streamID,
 			ByteOffset: offset,
@@ -265,16 +385,73 @@ func (s *receiveStream) SetReadDeadline(t time.Time) error {
 // The peer will NOT be informed about this: the stream is closed without sending a FIN or RST.
 func (s *receiveStream) closeForShutdown(err error) {
 	s.mutex.Lock()
-	s.closedForShutdown = true
+	// streams that were already completed are not affected
+	if transitionErr := s.transitionTo(receiveStreamStateShutdown); transitionErr != nil {
+		s.mutex.Unlock()
+		return
+	}
 	s.closeForShutdownErr = err
 	s.mutex.Unlock()
 	s.signalRead()
 }
 
+func (s *receiveStream) Stats() StreamStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return StreamStats{
+		BytesReceived:  uint64(s.bytesReceived),
+		FramesReceived: s.framesReceived,
+	}
+}
+
+// record returns the StreamRecord of the receive side of the stream
+func (s *receiveStream) record() StreamRecord {
+	r := StreamRecord{
+		StreamID: s.streamID,
+		OpenedAt: s.openedAt,
+		Stats:    s.Stats(),
+	}
+	s.mutex.Lock()
+	if s.state == receiveStreamStateResetReceived {
+		r.ReadReset = true
+		r.ReadResetCode = s.resetRemotelyErr.ErrorCode()
+	}
+	s.mutex.Unlock()
+	return r
+}
+
 func (s *receiveStream) getWindowUpdate() protocol.ByteCount {
 	return s.flowController.GetWindowUpdate()
 }
 
+// getReadError returns the error that Read returns, after the stream was canceled, reset or closed.
+// must be called after locking the mutex
+func (s *receiveStream) getReadError() error {
+	switch s.state {
+	case receiveStreamStateCanceled, receiveStreamStateCanceledFinReceived:
+		return s.cancelReadErr
+	case receiveStreamStateResetReceived:
+		// CancelRead might have been called before the RST_STREAM was received
+		if s.cancelReadErr != nil {
+			return s.cancelReadErr
+		}
+		return s.resetRemotelyErr
+	case receiveStreamStateShutdown:
+		return s.closeForShutdownErr
+	}
+	return nil
+}
+
+// transitionTo moves the stream to the next state, if this is a valid state transition.
+// must be called after locking the mutex
+func (s *receiveStream) transitionTo(state receiveStreamState) error {
+	if !s.state.canTransitionTo(state) {
+		return &streamStateTransitionError{streamID: s.streamID, from: s.state, to: state}
+	}
+	s.state = state
+	return nil
+}
+
 // signalRead performs a non-blocking send on the readChan
 func (s *receiveStream) signalRead() {
 	select {
@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"runtime"
@@ -10,6 +11,7 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/mocks"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/wire"
+	"github.com/lucas-clemente/quic-go/qerr"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -29,7 +31,7 @@ var _ = Describe("Receive Stream", func() {
 	BeforeEach(func() {
 		mockSender = NewMockStreamSender(mockCtrl)
 		mockFC = mocks.NewMockStreamFlowController(mockCtrl)
-		str = newReceiveStream(streamID, mockSender, mockFC, versionIETFFrames)
+		str = newReceiveStream(streamID, mockSender, mockFC, nil, versionIETFFrames)
 
 		timeout := scaleDuration(250 * time.Millisecond)
 		strWithTimeout = gbytes.TimeoutReader(str, timeout)
@@ -418,6 +420,75 @@ var _ = Describe("Receive Stream", func() {
 		})
 	})
 
+	Context("writing to an io.Writer", func() {
+		It("writes all data until the FIN", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(2), false)
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(4), true)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(2)).Times(2)
+			mockFC.EXPECT().MaybeQueueWindowUpdate().Times(2)
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			err := str.handleStreamFrame(&wire.StreamFrame{
+				Offset: 0,
+				Data:   []byte{0xDE, 0xAD},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			done := make(chan struct{})
+			buf := &bytes.Buffer{}
+			go func() {
+				defer GinkgoRecover()
+				n, err := str.WriteTo(buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(BeEquivalentTo(4))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			err = str.handleStreamFrame(&wire.StreamFrame{
+				Offset: 2,
+				Data:   []byte{0xBE, 0xEF},
+				FinBit: true,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(done).Should(BeClosed())
+			Expect(buf.Bytes()).To(Equal([]byte{0xDE, 0xAD, 0xBE, 0xEF}))
+			// all data was read
+			n, err := str.WriteTo(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(BeZero())
+		})
+
+		It("returns the error of the writer", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(4), false)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(0))
+			mockFC.EXPECT().MaybeQueueWindowUpdate()
+			err := str.handleStreamFrame(&wire.StreamFrame{
+				Offset: 0,
+				Data:   []byte{0xDE, 0xAD, 0xBE, 0xEF},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			testErr := errors.New("write failed")
+			pr, pw := io.Pipe()
+			pr.CloseWithError(testErr)
+			n, err := str.WriteTo(pw)
+			Expect(err).To(MatchError(testErr))
+			Expect(n).To(BeZero())
+		})
+
+		It("unblocks when reading is canceled", func() {
+			mockSender.EXPECT().queueControlFrame(gomock.Any())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := str.WriteTo(&bytes.Buffer{})
+				Expect(err).To(MatchError("Read on stream 1337 canceled with error code 1234"))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			err := str.CancelRead(1234)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
 	Context("stream cancelations", func() {
 		Context("canceling read", func() {
 			It("unblocks Read", func() {
@@ -471,6 +542,45 @@ var _ = Describe("Receive Stream", func() {
 				Expect(err).ToNot(HaveOccurred())
 			})
 
+			It("completes the stream when the FIN is received after canceling", func() {
+				mockSender.EXPECT().queueControlFrame(gomock.Any())
+				Expect(str.CancelRead(1234)).To(Succeed())
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), true)
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				err := str.handleStreamFrame(&wire.StreamFrame{
+					StreamID: streamID,
+					Offset:   3,
+					Data:     []byte("bar"),
+					FinBit:   true,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				_, err = strWithTimeout.Read([]byte{0})
+				Expect(err).To(MatchError("Read on stream 1337 canceled with error code 1234"))
+				// the stream is only completed once
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), true)
+				Expect(str.handleStreamFrame(&wire.StreamFrame{
+					StreamID: streamID,
+					Offset:   3,
+					Data:     []byte("bar"),
+					FinBit:   true,
+				})).To(Succeed())
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), true)
+				Expect(str.handleRstStreamFrame(&wire.RstStreamFrame{StreamID: streamID, ByteOffset: 6})).To(Succeed())
+			})
+
+			It("completes the stream when canceling after the FIN was received", func() {
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), true)
+				err := str.handleStreamFrame(&wire.StreamFrame{
+					StreamID: streamID,
+					Data:     []byte("foobar"),
+					FinBit:   true,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				mockSender.EXPECT().queueControlFrame(gomock.Any())
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				Expect(str.CancelRead(1234)).To(Succeed())
+			})
+
 			It("queues a STOP_SENDING frame, for IETF QUIC", func() {
 				str.version = versionIETFFrames
 				mockSender.EXPECT().queueControlFrame(&wire.StopSendingFrame{
@@ -542,6 +652,36 @@ var _ = Describe("Receive Stream", func() {
 				Expect(err).ToNot(HaveOccurred())
 			})
 
+			It("ignores RST_STREAM frames received after the FIN was read", func() {
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true).Times(2)
+				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(42))
+				mockFC.EXPECT().MaybeQueueWindowUpdate()
+				mockSender.EXPECT().onStreamCompleted(streamID) // only once
+				err := str.handleStreamFrame(&wire.StreamFrame{
+					StreamID: streamID,
+					Data:     make([]byte, 42),
+					FinBit:   true,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				_, err = strWithTimeout.Read(make([]byte, 100))
+				Expect(err).To(MatchError(io.EOF))
+				err = str.handleRstStreamFrame(rst)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = strWithTimeout.Read(make([]byte, 100))
+				Expect(err).To(MatchError(io.EOF))
+			})
+
+			It("returns the CancelRead error, if reading was canceled before the RST_STREAM was received", func() {
+				mockSender.EXPECT().queueControlFrame(gomock.Any())
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true)
+				Expect(str.CancelRead(4321)).To(Succeed())
+				err := str.handleRstStreamFrame(rst)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = strWithTimeout.Read([]byte{0})
+				Expect(err).To(MatchError("Read on stream 1337 canceled with error code 4321"))
+			})
+
 			It("doesn't do anyting when it was closed for shutdown", func() {
 				str.closeForShutdown(nil)
 				err := str.handleRstStreamFrame(rst)
@@ -610,6 +750,109 @@ var _ = Describe("Receive Stream", func() {
 		})
 	})
 
+	Context("receiving EXPIRED_STREAM_DATA frames", func() {
+		It("skips over the expired data", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(10), false)
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(6))
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(4))
+			mockFC.EXPECT().MaybeQueueWindowUpdate().Times(2)
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 6, Data: []byte("lore")})).To(Succeed())
+			Expect(str.handleExpiredStreamDataFrame(&wire.ExpiredStreamDataFrame{StreamID: streamID, Offset: 6})).To(Succeed())
+			b := make([]byte, 4)
+			n, err := strWithTimeout.Read(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(4))
+			Expect(b).To(Equal([]byte("lore")))
+		})
+
+		It("unblocks Read", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(9), false)
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(3), false)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(3)).Times(2)
+			mockFC.EXPECT().MaybeQueueWindowUpdate().Times(2)
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 3, Data: []byte("foobar")})).To(Succeed())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				b := make([]byte, 3)
+				n, err := strWithTimeout.Read(b)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(Equal(3))
+				Expect(b).To(Equal([]byte("foo")))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(str.handleExpiredStreamDataFrame(&wire.ExpiredStreamDataFrame{StreamID: streamID, Offset: 3})).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("reads the FIN after skipping all data", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), true)
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(6))
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(0))
+			mockFC.EXPECT().MaybeQueueWindowUpdate().Times(2)
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 6, FinBit: true})).To(Succeed())
+			Expect(str.handleExpiredStreamDataFrame(&wire.ExpiredStreamDataFrame{StreamID: streamID, Offset: 6})).To(Succeed())
+			_, err := strWithTimeout.Read(make([]byte, 4))
+			Expect(err).To(MatchError(io.EOF))
+		})
+
+		It("ignores offsets that were already read", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(3), false)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(6))
+			mockFC.EXPECT().MaybeQueueWindowUpdate()
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 0, Data: []byte("foobar")})).To(Succeed())
+			_, err := strWithTimeout.Read(make([]byte, 6))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.handleExpiredStreamDataFrame(&wire.ExpiredStreamDataFrame{StreamID: streamID, Offset: 3})).To(Succeed())
+			Expect(str.readOffset).To(Equal(protocol.ByteCount(6)))
+		})
+
+		It("errors when the frame causes a flow control violation", func() {
+			testErr := errors.New("flow control violation")
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(0x1337), false).Return(testErr)
+			err := str.handleExpiredStreamDataFrame(&wire.ExpiredStreamDataFrame{StreamID: streamID, Offset: 0x1337})
+			Expect(err).To(MatchError(testErr))
+		})
+	})
+
+	Context("statistics", func() {
+		It("counts the data received, including duplicate data", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(4), false).Times(2)
+			frame := &wire.StreamFrame{
+				Offset: 0,
+				Data:   []byte{0xDE, 0xAD, 0xBE, 0xEF},
+			}
+			Expect(str.handleStreamFrame(frame)).To(Succeed())
+			Expect(str.handleStreamFrame(frame)).To(Succeed())
+			stats := str.Stats()
+			Expect(stats.BytesReceived).To(BeEquivalentTo(8))
+			Expect(stats.FramesReceived).To(BeEquivalentTo(2))
+			Expect(stats.BytesSent).To(BeZero())
+		})
+
+		It("records the error code of a RST_STREAM frame", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true)
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			Expect(str.record().ReadReset).To(BeFalse())
+			Expect(str.handleRstStreamFrame(&wire.RstStreamFrame{
+				StreamID:   streamID,
+				ByteOffset: 42,
+				ErrorCode:  1234,
+			})).To(Succeed())
+			r := str.record()
+			Expect(r.StreamID).To(Equal(streamID))
+			Expect(r.OpenedAt).To(BeTemporally("~", time.Now(), time.Second))
+			Expect(r.ReadReset).To(BeTrue())
+			Expect(r.ReadResetCode).To(BeEquivalentTo(1234))
+			Expect(r.WriteReset).To(BeFalse())
+		})
+	})
+
 	Context("flow control", func() {
 		It("errors when a STREAM frame causes a flow control violation", func() {
 			testErr := errors.New("flow control violation")
@@ -627,4 +870,36 @@ var _ = Describe("Receive Stream", func() {
 			Expect(str.getWindowUpdate()).To(Equal(protocol.ByteCount(0x100)))
 		})
 	})
+
+	Context("limiting out-of-order data", func() {
+		BeforeEach(func() {
+			str.reassembly = newReassemblyLimiter(10, 15)
+		})
+
+		It("accounts for out-of-order data", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(12), false)
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 6, Data: []byte("foobar")})).To(Succeed())
+			Expect(str.reassembly.bufferedBytes).To(Equal(protocol.ByteCount(6)))
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 0, Data: []byte("foobar")})).To(Succeed())
+			Expect(str.reassembly.bufferedBytes).To(BeZero())
+		})
+
+		It("errors when the limit is exceeded", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(13), false)
+			err := str.handleStreamFrame(&wire.StreamFrame{Offset: 2, Data: []byte("foobarfooba")})
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.FlowControlReceivedTooMuchData))
+		})
+
+		It("releases the data when a RST_STREAM is received", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(12), false)
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true)
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 6, Data: []byte("foobar")})).To(Succeed())
+			Expect(str.reassembly.bufferedBytes).To(Equal(protocol.ByteCount(6)))
+			Expect(str.handleRstStreamFrame(&wire.RstStreamFrame{StreamID: streamID, ByteOffset: 42, ErrorCode: 1234})).To(Succeed())
+			Expect(str.reassembly.bufferedBytes).To(BeZero())
+		})
+	})
 })
@@ -0,0 +1,134 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+// The retransmissionQueue holds the frames of lost forward-secure packets.
+// Instead of retransmitting lost packets one by one, the frames are packed into new packets,
+// such that the frames of multiple lost packets can be sent in a single packet.
+// Handshake packets are still retransmitted as a whole, since they have to be sent with the same encryption level.
+// For every frame, it remembers the packet numbers of the packets it was lost in,
+// such that the sent packet handler can link the retransmissions to the original packets.
+type retransmissionQueue struct {
+	controlFrames []queuedControlFrame
+	streamFrames  []queuedStreamFrame
+}
+
+type queuedControlFrame struct {
+	frame        wire.Frame
+	packetNumber protocol.PacketNumber
+}
+
+type queuedStreamFrame struct {
+	frame *wire.StreamFrame
+	// if STREAM frames of multiple packets were merged, this contains all of their packet numbers
+	packetNumbers []protocol.PacketNumber
+}
+
+func newRetransmissionQueue() *retransmissionQueue {
+	return &retransmissionQueue{}
+}
+
+// AddFrames adds the frames of a lost packet.
+func (q *retransmissionQueue) AddFrames(frames []wire.Frame, pn protocol.PacketNumber) {
+	for _, f := range frames {
+		if sf, ok := f.(*wire.StreamFrame); ok {
+			q.addStreamFrame(sf, pn)
+		} else {
+			q.controlFrames = append(q.controlFrames, queuedControlFrame{frame: f, packetNumber: pn})
+		}
+	}
+}
+
+// addStreamFrame adds a STREAM frame.
+// If the frame continues the data of a STREAM frame that is already queued, the two frames are merged.
+func (q *retransmissionQueue) addStreamFrame(f *wire.StreamFrame, pn protocol.PacketNumber) {
+	for i := len(q.streamFrames) - 1; i >= 0; i-- {
+		queued := q.streamFrames[i].frame
+		if queued.StreamID != f.StreamID || queued.FinBit || queued.Offset+queued.DataLen() != f.Offset {
+			continue
+		}
+		// Don't append to the Data of the queued frame.
+		// Its underlying array might be shared with other STREAM frames.
+		data := make([]byte, 0, len(queued.Data)+len(f.Data))
+		data = append(data, queued.Data...)
+		data = append(data, f.Data...)
+		q.streamFrames[i] = queuedStreamFrame{
+			frame: &wire.StreamFrame{
+				StreamID:       queued.StreamID,
+				Offset:         queued.Offset,
+				FinBit:         f.FinBit,
+				Data:           data,
+				DataLenPresent: true,
+			},
+			packetNumbers: appendPacketNumber(q.streamFrames[i].packetNumbers, pn),
+		}
+		return
+	}
+	f.DataLenPresent = true
+	q.streamFrames = append(q.streamFrames, queuedStreamFrame{frame: f, packetNumbers: []protocol.PacketNumber{pn}})
+}
+
+// HasData says if there are any frames to retransmit.
+func (q *retransmissionQueue) HasData() bool {
+	return len(q.controlFrames) > 0 || len(q.streamFrames) > 0
+}
+
+// DropControlFramesLargerThan drops all control frames that are larger than maxLen.
+// This can happen if the maximum packet size was reduced after the frames were sent.
+// These frames would never fit into a packet, and would prevent all other control frames from being sent.
+// It returns the number of frames dropped.
+func (q *retransmissionQueue) DropControlFramesLargerThan(maxLen protocol.ByteCount, version protocol.VersionNumber) int {
+	var dropped int
+	controlFrames := q.controlFrames[:0]
+	for _, f := range q.controlFrames {
+		if f.frame.Length(version) > maxLen {
+			dropped++
+			continue
+		}
+		controlFrames = append(controlFrames, f)
+	}
+	q.controlFrames = controlFrames
+	return dropped
+}
+
+// PopControlFrame returns the next control frame, if it's not larger than maxLen,
+// together with the packet number of the packet it was lost in.
+func (q *retransmissionQueue) PopControlFrame(maxLen protocol.ByteCount, version protocol.VersionNumber) (wire.Frame, protocol.PacketNumber) {
+	if len(q.controlFrames) == 0 || q.controlFrames[0].frame.Length(version) > maxLen {
+		return nil, 0
+	}
+	f := q.controlFrames[0]
+	q.controlFrames = q.controlFrames[1:]
+	return f.frame, f.packetNumber
+}
+
+// PopStreamFrame returns the next STREAM frame, together with the packet numbers of the packets it was lost in.
+// If the frame is larger than maxLen, it is split, and the remainder stays in the queue.
+func (q *retransmissionQueue) PopStreamFrame(maxLen protocol.ByteCount, version protocol.VersionNumber) (*wire.StreamFrame, []protocol.PacketNumber, error) {
+	if len(q.streamFrames) == 0 {
+		return nil, nil, nil
+	}
+	f := q.streamFrames[0]
+	sf, err := f.frame.MaybeSplitOffFrame(maxLen, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sf != nil {
+		return sf, f.packetNumbers, nil
+	}
+	q.streamFrames = q.streamFrames[1:]
+	return f.frame, f.packetNumbers, nil
+}
+
+// appendPacketNumber appends pn to pns, unless it's already contained
+func appendPacketNumber(pns []protocol.PacketNumber, pn protocol.PacketNumber) []protocol.PacketNumber {
+	for _, p := range pns {
+		if p == pn {
+			return pns
+		}
+	}
+	return append(pns, pn)
+}
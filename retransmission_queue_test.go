@@ -0,0 +1,162 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retransmission queue", func() {
+	var q *retransmissionQueue
+
+	BeforeEach(func() {
+		q = newRetransmissionQueue()
+	})
+
+	It("is empty when created", func() {
+		Expect(q.HasData()).To(BeFalse())
+		f, _ := q.PopControlFrame(protocol.MaxByteCount, versionIETFFrames)
+		Expect(f).To(BeNil())
+		sf, _, err := q.PopStreamFrame(protocol.MaxByteCount, versionIETFFrames)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sf).To(BeNil())
+	})
+
+	It("queues control frames", func() {
+		f1 := &wire.MaxDataFrame{ByteOffset: 0x42}
+		f2 := &wire.MaxStreamDataFrame{StreamID: 5, ByteOffset: 0x1337}
+		q.AddFrames([]wire.Frame{f1}, 10)
+		q.AddFrames([]wire.Frame{f2}, 11)
+		Expect(q.HasData()).To(BeTrue())
+		f, pn := q.PopControlFrame(protocol.MaxByteCount, versionIETFFrames)
+		Expect(f).To(Equal(f1))
+		Expect(pn).To(Equal(protocol.PacketNumber(10)))
+		f, pn = q.PopControlFrame(protocol.MaxByteCount, versionIETFFrames)
+		Expect(f).To(Equal(f2))
+		Expect(pn).To(Equal(protocol.PacketNumber(11)))
+		f, _ = q.PopControlFrame(protocol.MaxByteCount, versionIETFFrames)
+		Expect(f).To(BeNil())
+		Expect(q.HasData()).To(BeFalse())
+	})
+
+	It("doesn't pop a control frame that is too large", func() {
+		f := &wire.MaxDataFrame{ByteOffset: 0x1337}
+		q.AddFrames([]wire.Frame{f}, 10)
+		frame, _ := q.PopControlFrame(f.Length(versionIETFFrames)-1, versionIETFFrames)
+		Expect(frame).To(BeNil())
+		frame, _ = q.PopControlFrame(f.Length(versionIETFFrames), versionIETFFrames)
+		Expect(frame).To(Equal(f))
+	})
+
+	It("drops control frames that are too large", func() {
+		small := &wire.MaxDataFrame{ByteOffset: 0x42}
+		large := &wire.ConnectionCloseFrame{ReasonPhrase: "too long"}
+		q.AddFrames([]wire.Frame{large, small}, 10)
+		Expect(q.DropControlFramesLargerThan(small.Length(versionIETFFrames), versionIETFFrames)).To(Equal(1))
+		f, _ := q.PopControlFrame(protocol.MaxByteCount, versionIETFFrames)
+		Expect(f).To(Equal(small))
+		Expect(q.HasData()).To(BeFalse())
+	})
+
+	It("queues STREAM frames", func() {
+		f := &wire.StreamFrame{StreamID: 5, Data: []byte("foobar")}
+		q.AddFrames([]wire.Frame{f}, 10)
+		Expect(q.HasData()).To(BeTrue())
+		sf, pns, err := q.PopStreamFrame(protocol.MaxByteCount, versionIETFFrames)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sf).To(Equal(&wire.StreamFrame{StreamID: 5, Data: []byte("foobar"), DataLenPresent: true}))
+		Expect(pns).To(Equal([]protocol.PacketNumber{10}))
+		Expect(q.HasData()).To(BeFalse())
+	})
+
+	It("splits STREAM frames that are too large", func() {
+		f := &wire.StreamFrame{StreamID: 5, Offset: 10, Data: []byte("foobar")}
+		q.AddFrames([]wire.Frame{f}, 10)
+		sf, pns, err := q.PopStreamFrame(f.Length(versionIETFFrames)-3, versionIETFFrames)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sf.Offset).To(Equal(protocol.ByteCount(10)))
+		Expect(sf.Data).To(Equal([]byte("foo")))
+		Expect(pns).To(Equal([]protocol.PacketNumber{10}))
+		sf, pns, err = q.PopStreamFrame(protocol.MaxByteCount, versionIETFFrames)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sf.Offset).To(Equal(protocol.ByteCount(13)))
+		Expect(sf.Data).To(Equal([]byte("bar")))
+		Expect(pns).To(Equal([]protocol.PacketNumber{10}))
+		Expect(q.HasData()).To(BeFalse())
+	})
+
+	Context("merging STREAM frames", func() {
+		It("merges STREAM frames of the same stream", func() {
+			q.AddFrames([]wire.Frame{&wire.StreamFrame{StreamID: 5, Offset: 10, Data: []byte("foo")}}, 10)
+			q.AddFrames([]wire.Frame{&wire.StreamFrame{StreamID: 5, Offset: 13, Data: []byte("bar"), FinBit: true}}, 11)
+			sf, pns, err := q.PopStreamFrame(protocol.MaxByteCount, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sf).To(Equal(&wire.StreamFrame{
+				StreamID:       5,
+				Offset:         10,
+				Data:           []byte("foobar"),
+				FinBit:         true,
+				DataLenPresent: true,
+			}))
+			Expect(pns).To(Equal([]protocol.PacketNumber{10, 11}))
+			Expect(q.HasData()).To(BeFalse())
+		})
+
+		It("merges STREAM frames that are not adjacent in the queue", func() {
+			q.AddFrames([]wire.Frame{
+				&wire.StreamFrame{StreamID: 5, Data: []byte("foo")},
+				&wire.StreamFrame{StreamID: 7, Data: []byte("lorem")},
+			}, 10)
+			q.AddFrames([]wire.Frame{&wire.StreamFrame{StreamID: 5, Offset: 3, Data: []byte("bar")}}, 11)
+			sf, pns, err := q.PopStreamFrame(protocol.MaxByteCount, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sf.StreamID).To(Equal(protocol.StreamID(5)))
+			Expect(sf.Data).To(Equal([]byte("foobar")))
+			Expect(pns).To(Equal([]protocol.PacketNumber{10, 11}))
+			sf, pns, err = q.PopStreamFrame(protocol.MaxByteCount, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sf.StreamID).To(Equal(protocol.StreamID(7)))
+			Expect(pns).To(Equal([]protocol.PacketNumber{10}))
+			Expect(q.HasData()).To(BeFalse())
+		})
+
+		It("doesn't merge STREAM frames that aren't contiguous", func() {
+			q.AddFrames([]wire.Frame{
+				&wire.StreamFrame{StreamID: 5, Data: []byte("foo")},
+				&wire.StreamFrame{StreamID: 5, Offset: 4, Data: []byte("bar")},
+			}, 10)
+			Expect(q.streamFrames).To(HaveLen(2))
+		})
+
+		It("doesn't merge STREAM frames of different streams", func() {
+			q.AddFrames([]wire.Frame{
+				&wire.StreamFrame{StreamID: 5, Data: []byte("foo")},
+				&wire.StreamFrame{StreamID: 7, Offset: 3, Data: []byte("bar")},
+			}, 10)
+			Expect(q.streamFrames).To(HaveLen(2))
+		})
+
+		It("doesn't merge STREAM frames after a FIN", func() {
+			q.AddFrames([]wire.Frame{
+				&wire.StreamFrame{StreamID: 5, Data: []byte("foo"), FinBit: true},
+				&wire.StreamFrame{StreamID: 5, Offset: 3, Data: []byte("bar")},
+			}, 10)
+			Expect(q.streamFrames).To(HaveLen(2))
+		})
+
+		It("doesn't modify the data of STREAM frames that were split", func() {
+			data := []byte("foobar")
+			// the two frames share the underlying array, as they would after calling MaybeSplitOffFrame
+			f1 := &wire.StreamFrame{StreamID: 5, Data: data[:3]}
+			f2 := &wire.StreamFrame{StreamID: 5, Offset: 3, Data: data[3:]}
+			q.AddFrames([]wire.Frame{f1}, 10)
+			q.AddFrames([]wire.Frame{&wire.StreamFrame{StreamID: 5, Offset: 3, Data: []byte("BAR")}}, 11)
+			Expect(f2.Data).To(Equal([]byte("bar")))
+			sf, _, err := q.PopStreamFrame(protocol.MaxByteCount, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sf.Data).To(Equal([]byte("fooBAR")))
+		})
+	})
+})
@@ -0,0 +1,109 @@
+package quic
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// ListenAddrShards creates n Listeners for the same address. Every Listener uses its own UDP socket,
+// and the sockets are bound to the same port using the SO_REUSEPORT socket option.
+// The operating system distributes incoming packets between the sockets based on the client's address,
+// so that packet processing is spread across multiple CPU cores. Accept has to be called for every Listener.
+// When the address of a client changes, its packets might arrive at a different Listener.
+// These packets are passed on to the Listener that owns the session.
+// Every Listener has to be closed. Closing a Listener closes the sessions it accepted.
+// SO_REUSEPORT is only supported on Linux.
+// Warning: This API should not be considered stable and might change soon.
+func ListenAddrShards(addr string, n int, tlsConf *tls.Config, config *Config) ([]Listener, error) {
+	if n <= 0 {
+		return nil, errors.New("the number of shards must be positive")
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &Config{}
+	}
+	// All shards have to use the same key,
+	// since a Stateless Reset for a connection might be sent by any of them.
+	if config.StatelessResetKey == nil {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		c := *config
+		c.StatelessResetKey = key
+		config = &c
+	}
+	// All shards share the limits, the queue of Client Hellos, the server config and the cookie keys.
+	state, err := newServerState(tlsConf, populateServerConfig(config))
+	if err != nil {
+		return nil, err
+	}
+	shards := &shardGroup{
+		state:   state,
+		servers: make([]*server, 0, n),
+	}
+	for i := 0; i < n; i++ {
+		s, err := newShard(udpAddr, tlsConf, config, state)
+		if err != nil {
+			for _, s := range shards.servers {
+				s.conn.Close()
+			}
+			return nil, err
+		}
+		if i == 0 {
+			// If no port was given, the other shards use the port chosen for the first one.
+			udpAddr = s.conn.LocalAddr().(*net.UDPAddr)
+		}
+		s.shards = shards
+		shards.servers = append(shards.servers, s)
+	}
+	listeners := make([]Listener, n)
+	for i, s := range shards.servers {
+		go s.serve()
+		s.logger.Debugf("Listening for %s connections on %s (shard %d of %d)", udpAddr.Network(), udpAddr.String(), i+1, n)
+		listeners[i] = s
+	}
+	return listeners, nil
+}
+
+// newShard creates a server that uses a UDP socket with the SO_REUSEPORT socket option.
+// It doesn't start reading from the socket.
+func newShard(addr *net.UDPAddr, tlsConf *tls.Config, config *Config, state *serverState) (*server, error) {
+	conn, err := listenUDPReusePort(addr)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newServer(conn, tlsConf, config, state)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	setSocketBuffers(conn, s.config)
+	return s, nil
+}
+
+// A shardGroup is a group of servers that listen on the same address, see ListenAddrShards.
+type shardGroup struct {
+	state   *serverState
+	servers []*server
+}
+
+// getSession looks up the session for a connection ID in the servers of the group, except for the server s.
+func (g *shardGroup) getSession(s *server, connID protocol.ConnectionID) (packetHandler, bool) {
+	for _, srv := range g.servers {
+		if srv == s {
+			continue
+		}
+		if sess, ok := srv.sessionHandler.Get(connID); ok {
+			return sess, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,60 @@
+// +build linux
+
+package quic
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// the SO_REUSEPORT socket option (Linux 3.9 and newer).
+// It is not defined in the syscall package (except on a few architectures, which use the same value).
+const soReusePort = 0xf
+
+// listenUDPReusePort creates a UDP socket with the SO_REUSEPORT socket option set, and binds it to addr.
+// The kernel distributes the packets received on addr between all sockets bound to it,
+// based on a hash of the source and the destination address of the packet.
+func listenUDPReusePort(addr *net.UDPAddr) (*net.UDPConn, error) {
+	// Like net.ListenUDP, use a dual-stack IPv6 socket, unless an IPv4 address is given.
+	family := syscall.AF_INET6
+	if addr.IP.To4() != nil {
+		family = syscall.AF_INET
+	}
+	fd, err := syscall.Socket(family, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, syscall.IPPROTO_UDP)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err := bindReusePort(fd, family, addr); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "udp")
+	// net.FilePacketConn duplicates the file descriptor
+	defer f.Close()
+	c, err := net.FilePacketConn(f)
+	if err != nil {
+		return nil, err
+	}
+	return c.(*net.UDPConn), nil
+}
+
+func bindReusePort(fd, family int, addr *net.UDPAddr) error {
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, soReusePort, 1); err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	if family == syscall.AF_INET {
+		sa := &syscall.SockaddrInet4{Port: addr.Port}
+		copy(sa.Addr[:], addr.IP.To4())
+		return os.NewSyscallError("bind", syscall.Bind(fd, sa))
+	}
+	if addr.IP == nil || addr.IP.IsUnspecified() {
+		// accept IPv4 packets as well
+		if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY, 0); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	sa := &syscall.SockaddrInet6{Port: addr.Port}
+	copy(sa.Addr[:], addr.IP.To16())
+	return os.NewSyscallError("bind", syscall.Bind(fd, sa))
+}
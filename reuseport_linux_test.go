@@ -0,0 +1,124 @@
+// +build linux
+
+package quic
+
+import (
+	"crypto/tls"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SO_REUSEPORT", func() {
+	getReusePort := func(c *net.UDPConn) int {
+		rawConn, err := c.SyscallConn()
+		Expect(err).ToNot(HaveOccurred())
+		var val int
+		var serr error
+		Expect(rawConn.Control(func(fd uintptr) {
+			val, serr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort)
+		})).To(Succeed())
+		Expect(serr).ToNot(HaveOccurred())
+		return val
+	}
+
+	Context("listening", func() {
+		It("binds multiple sockets to the same port", func() {
+			c1, err := listenUDPReusePort(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			Expect(err).ToNot(HaveOccurred())
+			defer c1.Close()
+			Expect(getReusePort(c1)).To(Equal(1))
+			c2, err := listenUDPReusePort(c1.LocalAddr().(*net.UDPAddr))
+			Expect(err).ToNot(HaveOccurred())
+			defer c2.Close()
+			Expect(getReusePort(c2)).To(Equal(1))
+			Expect(c2.LocalAddr()).To(Equal(c1.LocalAddr()))
+		})
+
+		It("doesn't bind to a port used by a socket without SO_REUSEPORT", func() {
+			c, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			Expect(err).ToNot(HaveOccurred())
+			defer c.Close()
+			_, err = listenUDPReusePort(c.LocalAddr().(*net.UDPAddr))
+			Expect(err).To(MatchError(ContainSubstring("bind")))
+		})
+
+		It("receives IPv4 packets when listening on the unspecified address", func() {
+			c, err := listenUDPReusePort(&net.UDPAddr{})
+			Expect(err).ToNot(HaveOccurred())
+			defer c.Close()
+			port := c.LocalAddr().(*net.UDPAddr).Port
+			sender, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+			Expect(err).ToNot(HaveOccurred())
+			defer sender.Close()
+			_, err = sender.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			b := make([]byte, 100)
+			Expect(c.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+			n, _, err := c.ReadFromUDP(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b[:n]).To(Equal([]byte("foobar")))
+		})
+	})
+
+	Context("creating Listeners", func() {
+		It("errors if the number of shards is not positive", func() {
+			_, err := ListenAddrShards("127.0.0.1:0", 0, testdata.GetTLSConfig(), nil)
+			Expect(err).To(MatchError("the number of shards must be positive"))
+		})
+
+		It("creates Listeners for the same address", func() {
+			lns, err := ListenAddrShards("127.0.0.1:0", 3, testdata.GetTLSConfig(), nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lns).To(HaveLen(3))
+			key := lns[0].(*server).getConfig().StatelessResetKey
+			Expect(key).ToNot(BeEmpty())
+			for _, ln := range lns {
+				Expect(ln.Addr()).To(Equal(lns[0].Addr()))
+				Expect(ln.(*server).shards.servers).To(HaveLen(3))
+				// all shards use the same key for Stateless Resets
+				Expect(ln.(*server).getConfig().StatelessResetKey).To(Equal(key))
+				// all shards share the limits, the Client Hello queue, the server config and the cookie keys
+				state := ln.(*server).shards.state
+				Expect(ln.(*server).sourceLimiter).To(BeIdenticalTo(state.sourceLimiter))
+				Expect(ln.(*server).chloQueue).To(BeIdenticalTo(state.chloQueue))
+				Expect(ln.(*server).scfg).To(BeIdenticalTo(state.scfg))
+				Expect(ln.(*server).cookieGenerator).To(BeIdenticalTo(state.cookieGenerator))
+				Expect(ln.(*server).cookieProtector).To(BeIdenticalTo(state.cookieProtector))
+			}
+			for _, ln := range lns {
+				Expect(ln.Close()).To(Succeed())
+			}
+		})
+
+		It("accepts sessions", func() {
+			lns, err := ListenAddrShards("127.0.0.1:0", 2, testdata.GetTLSConfig(), nil)
+			Expect(err).ToNot(HaveOccurred())
+			defer func() {
+				for _, ln := range lns {
+					Expect(ln.Close()).To(Succeed())
+				}
+			}()
+			sessChan := make(chan Session, 1)
+			for _, ln := range lns {
+				go func(ln Listener) {
+					sess, err := ln.Accept()
+					if err == nil {
+						sessChan <- sess
+					}
+				}(ln)
+			}
+			sess, err := DialAddr(lns[0].Addr().String(), &tls.Config{InsecureSkipVerify: true}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			var serverSess Session
+			Eventually(sessChan).Should(Receive(&serverSess))
+			Expect(serverSess.RemoteAddr().(*net.UDPAddr).Port).To(Equal(sess.LocalAddr().(*net.UDPAddr).Port))
+			Expect(sess.Close(nil)).To(Succeed())
+		})
+	})
+})
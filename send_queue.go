@@ -0,0 +1,321 @@
+package quic
+
+import (
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// A queuedPacket is a packet waiting in the sendQueue.
+type queuedPacket struct {
+	raw []byte
+	// the address the packet is sent to, nil for the current remote address
+	addr net.Addr
+	// ackOnly is set for packets that only contain ACK (and STOP_WAITING) frames.
+	ackOnly bool
+	// mtuProbe is set for MTU probe packets. They are never written together with other packets.
+	mtuProbe bool
+}
+
+// The sendQueue decouples packing packets from writing them to the network.
+// Packets are written on a separate Go routine, in the order they were queued.
+// When the network can't keep up, an ACK-only packet that is still queued is replaced by a newer ACK-only packet,
+// since the newer ACK frame contains all the information of the older one.
+// Writes that fail with a transient error (see isTransientWriteError) are retried with an exponential backoff.
+// Packets that are too large for the path MTU known to the kernel (see isMsgSizeError) are dropped,
+// and reported using onPacketTooLarge, so that the session can adjust its packet size.
+// If the connection supports it (using GSO or sendmmsg), consecutive packets of the same size are written in a single system call.
+type sendQueue struct {
+	conn connection
+	// the number of times writing a packet is retried after a transient error
+	maxTransientWriteErrors int
+
+	mutex sync.Mutex
+	queue []*queuedPacket
+	// stopped is set when Run returned. Packets queued after that are dropped right away.
+	stopped bool
+	// the number of ACK-only packets that were replaced by a newer ACK-only packet before being written
+	droppedAckOnlyPackets uint64
+	// the number of writes that failed with a transient error
+	transientWriteErrors uint64
+
+	// available signals the Go routine writing packets that a packet was queued
+	available chan struct{}
+	// onSpaceAvailable is called when a packet was written after the queue was full
+	onSpaceAvailable func()
+	// onPacketTooLarge is called when a packet of size bytes was rejected with EMSGSIZE
+	onPacketTooLarge func(size protocol.ByteCount, mtuProbe bool)
+
+	// batch holds the packets that are currently being written,
+	// and segmentsBuf is used to concatenate them when they are written using WriteSegments.
+	// They are only accessed by the Go routine writing packets.
+	batch       []*queuedPacket
+	segmentsBuf []byte
+
+	closeChan chan struct{}
+	runDone   chan struct{}
+}
+
+func newSendQueue(
+	conn connection,
+	maxTransientWriteErrors int,
+	onSpaceAvailable func(),
+	onPacketTooLarge func(size protocol.ByteCount, mtuProbe bool),
+) *sendQueue {
+	return &sendQueue{
+		conn:                    conn,
+		maxTransientWriteErrors: maxTransientWriteErrors,
+		available:               make(chan struct{}, 1),
+		onSpaceAvailable:        onSpaceAvailable,
+		onPacketTooLarge:        onPacketTooLarge,
+		closeChan:               make(chan struct{}),
+		runDone:                 make(chan struct{}),
+	}
+}
+
+// Send queues a packet.
+// The queue can grow beyond protocol.MaxSendQueueLength, it is the caller's responsibility to check if it is Full.
+func (q *sendQueue) Send(p *queuedPacket) {
+	q.mutex.Lock()
+	if q.stopped {
+		q.mutex.Unlock()
+		putPacketBuffer(&p.raw)
+		return
+	}
+	queued := false
+	if p.ackOnly {
+		for i, qp := range q.queue {
+			if qp.ackOnly {
+				putPacketBuffer(&qp.raw)
+				q.queue[i] = p
+				q.droppedAckOnlyPackets++
+				queued = true
+				break
+			}
+		}
+	}
+	if !queued {
+		q.queue = append(q.queue, p)
+	}
+	q.mutex.Unlock()
+
+	select {
+	case q.available <- struct{}{}:
+	default:
+	}
+}
+
+// Len returns the number of packets waiting to be written.
+func (q *sendQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.queue)
+}
+
+// Full says if the queue is full.
+// Packets can still be queued, but no more packets should be packed until the queue has space again.
+func (q *sendQueue) Full() bool {
+	return q.Len() >= protocol.MaxSendQueueLength
+}
+
+// DroppedAckOnlyPackets returns the number of ACK-only packets that were replaced by a newer ACK-only packet.
+func (q *sendQueue) DroppedAckOnlyPackets() uint64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.droppedAckOnlyPackets
+}
+
+// TransientWriteErrors returns the number of writes that failed with a transient error.
+func (q *sendQueue) TransientWriteErrors() uint64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.transientWriteErrors
+}
+
+// Run writes the queued packets to the network.
+// It returns when Close is called, or when writing a packet fails with a permanent error,
+// or with a transient error more than maxTransientWriteErrors times.
+func (q *sendQueue) Run() error {
+	defer close(q.runDone)
+	defer q.dropQueued()
+	for {
+		batching := q.conn.SupportsBatching()
+		q.mutex.Lock()
+		if len(q.queue) == 0 {
+			q.mutex.Unlock()
+			select {
+			case <-q.closeChan:
+				return nil
+			case <-q.available:
+			}
+			continue
+		}
+		wasFull := len(q.queue) >= protocol.MaxSendQueueLength
+		n := 1
+		if batching {
+			n = q.batchSize()
+		}
+		packets := append(q.batch[:0], q.queue[:n]...)
+		for i := 0; i < n; i++ {
+			q.queue[i] = nil
+		}
+		q.queue = q.queue[n:]
+		q.mutex.Unlock()
+
+		var err error
+		if n == 1 {
+			err = q.write(packets[0])
+		} else {
+			err = q.writeSegments(packets)
+		}
+		// The packet was larger than the path MTU known to the kernel.
+		// This is expected for MTU probes, for all other packets it means that the path MTU decreased.
+		// The packets will be declared lost by the sent packet handler.
+		if err != nil && isMsgSizeError(err) {
+			q.onPacketTooLarge(protocol.ByteCount(len(packets[0].raw)), packets[0].mtuProbe)
+			err = nil
+		}
+		for i, p := range packets {
+			putPacketBuffer(&p.raw)
+			packets[i] = nil
+		}
+		q.batch = packets
+		if err != nil {
+			return err
+		}
+		if wasFull {
+			q.onSpaceAvailable()
+		}
+		select {
+		case <-q.closeChan:
+			return nil
+		default:
+		}
+	}
+}
+
+// dropQueued drops all packets that are still queued, and returns their buffers to the pool.
+func (q *sendQueue) dropQueued() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i, p := range q.queue {
+		putPacketBuffer(&p.raw)
+		q.queue[i] = nil
+	}
+	q.queue = q.queue[:0]
+	q.stopped = true
+}
+
+// batchSize returns the number of packets at the front of the queue that can be written in a single call to WriteSegments.
+// These are packets sent to the current remote address, that all have the same size, except for the last one, which may be smaller.
+// must be called after locking the mutex
+func (q *sendQueue) batchSize() int {
+	first := q.queue[0]
+	if first.addr != nil || first.mtuProbe {
+		return 1
+	}
+	segmentSize := len(first.raw)
+	n := 1
+	for n < len(q.queue) && n < protocol.MaxBatchSegments {
+		p := q.queue[n]
+		if p.addr != nil || p.mtuProbe || len(p.raw) > segmentSize {
+			break
+		}
+		n++
+		if len(p.raw) < segmentSize {
+			break
+		}
+	}
+	return n
+}
+
+// write writes a packet, retrying transient errors.
+func (q *sendQueue) write(p *queuedPacket) error {
+	return q.writeWithRetries(func() error {
+		if p.addr == nil {
+			return q.conn.Write(p.raw)
+		}
+		return q.conn.WriteTo(p.raw, p.addr)
+	})
+}
+
+// writeSegments writes multiple packets in a single call to WriteSegments, retrying transient errors.
+// If only some of the packets were written, the retry starts with the first packet that wasn't written.
+// The packets must have been selected by batchSize.
+func (q *sendQueue) writeSegments(packets []*queuedPacket) error {
+	q.segmentsBuf = q.segmentsBuf[:0]
+	for _, p := range packets {
+		q.segmentsBuf = append(q.segmentsBuf, p.raw...)
+	}
+	segmentSize := len(packets[0].raw)
+	b := q.segmentsBuf
+	return q.writeWithRetries(func() error {
+		n, err := q.conn.WriteSegments(b, segmentSize)
+		b = b[utils.Min(n*segmentSize, len(b)):]
+		return err
+	})
+}
+
+// writeWithRetries calls write, and retries it if it fails with a transient error.
+// It returns nil if the queue is closed while waiting for the next retry.
+func (q *sendQueue) writeWithRetries(write func() error) error {
+	backoff := protocol.MinWriteRetryBackoff
+	for retries := 0; ; retries++ {
+		err := write()
+		if err == nil || !isTransientWriteError(err) {
+			return err
+		}
+		q.mutex.Lock()
+		q.transientWriteErrors++
+		q.mutex.Unlock()
+		if retries >= q.maxTransientWriteErrors {
+			return err
+		}
+		select {
+		case <-q.closeChan:
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = utils.MinDuration(2*backoff, protocol.MaxWriteRetryBackoff)
+	}
+}
+
+// isTransientWriteError says if writing a packet might succeed when retried.
+// ENOBUFS is returned when the kernel's send buffer is full,
+// and EPERM is returned when a packet is (temporarily) rejected by a local firewall.
+func isTransientWriteError(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	errno, ok := err.(syscall.Errno)
+	return ok && (errno == syscall.ENOBUFS || errno == syscall.EPERM)
+}
+
+// isMsgSizeError says if writing a packet failed because the packet was larger than the path MTU.
+// Since the Don't Fragment bit is set (see enableDF), the kernel rejects such packets with EMSGSIZE.
+func isMsgSizeError(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	errno, ok := err.(syscall.Errno)
+	return ok && errno == syscall.EMSGSIZE
+}
+
+// Close stops the Go routine writing packets, and waits for it to return.
+// Packets that are still queued are dropped, and their buffers are returned to the pool.
+// It must only be called after Run was started.
+func (q *sendQueue) Close() {
+	close(q.closeChan)
+	<-q.runDone
+}
@@ -0,0 +1,377 @@
+package quic
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type erroringConnection struct {
+	*mockConnection
+	err error
+}
+
+func (c *erroringConnection) Write([]byte) error { return c.err }
+
+// A flakyConnection fails the first writes, and writes all packets after that.
+type flakyConnection struct {
+	*mockConnection
+	err      error
+	failures int32 // the number of writes that fail, accessed atomically
+	attempts int32 // the number of calls to Write, accessed atomically
+}
+
+func (c *flakyConnection) Write(p []byte) error {
+	atomic.AddInt32(&c.attempts, 1)
+	if atomic.AddInt32(&c.failures, -1) >= 0 {
+		return c.err
+	}
+	return c.mockConnection.Write(p)
+}
+
+// A partialWriteConnection only writes the first numWritten packets of the first call to WriteSegments.
+type partialWriteConnection struct {
+	*mockConnection
+	err        error
+	numWritten int
+	failed     bool
+}
+
+func (c *partialWriteConnection) WriteSegments(b []byte, segmentSize int) (int, error) {
+	if c.failed {
+		return c.mockConnection.WriteSegments(b, segmentSize)
+	}
+	c.failed = true
+	n, _ := c.mockConnection.WriteSegments(b[:c.numWritten*segmentSize], segmentSize)
+	return n, c.err
+}
+
+var _ = Describe("Send Queue", func() {
+	var (
+		q              *sendQueue
+		c              *mockConnection
+		spaceAvailable chan struct{}
+	)
+
+	getPacket := func(b []byte, ackOnly bool) *queuedPacket {
+		buf := getPacketBuffer()
+		return &queuedPacket{raw: append((*buf)[:0], b...), ackOnly: ackOnly}
+	}
+
+	BeforeEach(func() {
+		c = newMockConnection()
+		spaceAvailable = make(chan struct{}, protocol.MaxSendQueueLength)
+		q = newSendQueue(c, protocol.DefaultMaxTransientWriteErrors, func() { spaceAvailable <- struct{}{} }, func(protocol.ByteCount, bool) {})
+	})
+
+	It("writes packets in order", func() {
+		q.Send(getPacket([]byte("foo"), false))
+		q.Send(getPacket([]byte("bar"), false))
+		Expect(q.Len()).To(Equal(2))
+		go q.Run()
+		Eventually(c.written).Should(Receive(Equal([]byte("foo"))))
+		Eventually(c.written).Should(Receive(Equal([]byte("bar"))))
+		Expect(q.Len()).To(BeZero())
+		q.Send(getPacket([]byte("foobar"), false))
+		Eventually(c.written).Should(Receive(Equal([]byte("foobar"))))
+		q.Close()
+	})
+
+	It("writes packets to a different address", func() {
+		addr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
+		p := getPacket([]byte("foobar"), false)
+		p.addr = addr
+		q.Send(p)
+		go q.Run()
+		Eventually(c.writtenTo).Should(Receive(Equal(writtenToPacket{data: []byte("foobar"), addr: addr})))
+		Expect(c.written).To(BeEmpty())
+		q.Close()
+	})
+
+	It("replaces a queued ACK-only packet with a newer ACK-only packet", func() {
+		q.Send(getPacket([]byte("ack1"), true))
+		q.Send(getPacket([]byte("data"), false))
+		q.Send(getPacket([]byte("ack2"), true))
+		Expect(q.Len()).To(Equal(2))
+		Expect(q.DroppedAckOnlyPackets()).To(BeEquivalentTo(1))
+		go q.Run()
+		Eventually(c.written).Should(Receive(Equal([]byte("ack2"))))
+		Eventually(c.written).Should(Receive(Equal([]byte("data"))))
+		Consistently(c.written).ShouldNot(Receive())
+		q.Close()
+	})
+
+	It("doesn't replace packets that contain more than ACKs", func() {
+		q.Send(getPacket([]byte("data1"), false))
+		q.Send(getPacket([]byte("data2"), false))
+		q.Send(getPacket([]byte("ack"), true))
+		Expect(q.Len()).To(Equal(3))
+		Expect(q.DroppedAckOnlyPackets()).To(BeZero())
+	})
+
+	It("says when it is full, and calls the callback when space becomes available", func() {
+		for i := 0; i < protocol.MaxSendQueueLength-1; i++ {
+			q.Send(getPacket([]byte("foobar"), false))
+		}
+		Expect(q.Full()).To(BeFalse())
+		q.Send(getPacket([]byte("foobar"), false))
+		Expect(q.Full()).To(BeTrue())
+		go q.Run()
+		Eventually(spaceAvailable).Should(Receive())
+		Eventually(c.written).Should(HaveLen(protocol.MaxSendQueueLength))
+		Expect(q.Full()).To(BeFalse())
+		// the callback is only called once, for the first packet written from a full queue
+		Expect(spaceAvailable).To(BeEmpty())
+		q.Close()
+	})
+
+	It("returns the error when writing fails", func() {
+		testErr := errors.New("write failed")
+		q = newSendQueue(&erroringConnection{mockConnection: c, err: testErr}, protocol.DefaultMaxTransientWriteErrors, func() {}, func(protocol.ByteCount, bool) {})
+		q.Send(getPacket([]byte("foobar"), false))
+		Expect(q.Run()).To(MatchError(testErr))
+		// Close doesn't block after Run returned
+		q.Close()
+	})
+
+	It("drops the queued packets when it is closed", func() {
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			Expect(q.Run()).To(Succeed())
+			close(done)
+		}()
+		q.Close()
+		Eventually(done).Should(BeClosed())
+		q.Send(getPacket([]byte("foobar"), false))
+		Consistently(c.written).ShouldNot(Receive())
+	})
+
+	It("returns the buffers of dropped packets", func() {
+		q = newSendQueue(&erroringConnection{mockConnection: c, err: errors.New("write failed")}, 0, func() {}, func(protocol.ByteCount, bool) {})
+		p1 := getPacket([]byte("foo"), false)
+		p2 := getPacket([]byte("bar"), false)
+		q.Send(p1)
+		q.Send(p2)
+		Expect(q.Run()).To(HaveOccurred())
+		Expect(p1.raw).To(BeEmpty())
+		Expect(p2.raw).To(BeEmpty())
+		Expect(q.Len()).To(BeZero())
+		// packets queued after Run returned are dropped right away
+		p3 := getPacket([]byte("baz"), false)
+		q.Send(p3)
+		Expect(p3.raw).To(BeEmpty())
+		Expect(q.Len()).To(BeZero())
+	})
+
+	Context("batching packets", func() {
+		BeforeEach(func() {
+			c.supportsBatching = true
+		})
+
+		It("writes packets of the same size in a single call", func() {
+			q.Send(getPacket([]byte("foo"), false))
+			q.Send(getPacket([]byte("bar"), false))
+			q.Send(getPacket([]byte("baz"), false))
+			q.Send(getPacket([]byte("f"), false))
+			go q.Run()
+			Eventually(c.segmentSizes).Should(Receive(Equal(3)))
+			Eventually(c.written).Should(Receive(Equal([]byte("foo"))))
+			Eventually(c.written).Should(Receive(Equal([]byte("bar"))))
+			Eventually(c.written).Should(Receive(Equal([]byte("baz"))))
+			Eventually(c.written).Should(Receive(Equal([]byte("f"))))
+			Consistently(c.segmentSizes).ShouldNot(Receive())
+			q.Close()
+		})
+
+		It("ends a batch with a smaller packet", func() {
+			q.Send(getPacket([]byte("foobar"), false))
+			q.Send(getPacket([]byte("foo"), false))
+			q.Send(getPacket([]byte("bar"), false))
+			q.Send(getPacket([]byte("foobar"), false))
+			go q.Run()
+			Eventually(c.segmentSizes).Should(Receive(Equal(6)))
+			Eventually(c.written).Should(HaveLen(4))
+			// the packets following the smaller packet are written on their own,
+			// since the last one is larger than the one before
+			Consistently(c.segmentSizes).ShouldNot(Receive())
+			q.Close()
+		})
+
+		It("doesn't batch packets sent to a different address", func() {
+			addr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
+			p := getPacket([]byte("foo"), false)
+			p.addr = addr
+			q.Send(p)
+			q.Send(getPacket([]byte("bar"), false))
+			q.Send(getPacket([]byte("baz"), false))
+			go q.Run()
+			Eventually(c.writtenTo).Should(Receive(Equal(writtenToPacket{data: []byte("foo"), addr: addr})))
+			Eventually(c.segmentSizes).Should(Receive(Equal(3)))
+			Eventually(c.written).Should(HaveLen(2))
+			q.Close()
+		})
+
+		It("limits the number of packets in a batch", func() {
+			for i := 0; i < protocol.MaxBatchSegments+1; i++ {
+				q.Send(getPacket([]byte("foobar"), false))
+			}
+			go q.Run()
+			Eventually(c.written).Should(HaveLen(protocol.MaxBatchSegments + 1))
+			Expect(c.segmentSizes).To(Receive(Equal(6)))
+			Expect(c.segmentSizes).To(BeEmpty())
+			q.Close()
+		})
+
+		It("doesn't batch MTU probes", func() {
+			p := getPacket([]byte("foo"), false)
+			p.mtuProbe = true
+			q.Send(p)
+			q.Send(getPacket([]byte("bar"), false))
+			q.Send(getPacket([]byte("baz"), false))
+			go q.Run()
+			Eventually(c.written).Should(Receive(Equal([]byte("foo"))))
+			Eventually(c.segmentSizes).Should(Receive(Equal(3)))
+			Eventually(c.written).Should(HaveLen(2))
+			Expect(c.segmentSizes).To(BeEmpty())
+			q.Close()
+		})
+
+		It("only retries the packets that weren't written, if writing a batch fails", func() {
+			transientErr := &net.OpError{Op: "write", Net: "udp", Err: os.NewSyscallError("sendmmsg", syscall.ENOBUFS)}
+			q = newSendQueue(&partialWriteConnection{mockConnection: c, err: transientErr, numWritten: 2}, 3, func() {}, func(protocol.ByteCount, bool) {})
+			q.Send(getPacket([]byte("foo"), false))
+			q.Send(getPacket([]byte("bar"), false))
+			q.Send(getPacket([]byte("baz"), false))
+			q.Send(getPacket([]byte("f"), false))
+			go q.Run()
+			Eventually(c.written).Should(Receive(Equal([]byte("foo"))))
+			Eventually(c.written).Should(Receive(Equal([]byte("bar"))))
+			Eventually(c.written).Should(Receive(Equal([]byte("baz"))))
+			Eventually(c.written).Should(Receive(Equal([]byte("f"))))
+			Consistently(c.written).ShouldNot(Receive())
+			Expect(q.TransientWriteErrors()).To(BeEquivalentTo(1))
+			q.Close()
+		})
+
+		It("doesn't batch packets if batching is not supported", func() {
+			c.supportsBatching = false
+			q.Send(getPacket([]byte("foo"), false))
+			q.Send(getPacket([]byte("bar"), false))
+			go q.Run()
+			Eventually(c.written).Should(HaveLen(2))
+			Expect(c.segmentSizes).To(BeEmpty())
+			q.Close()
+		})
+	})
+
+	It("drops and reports packets that are larger than the path MTU", func() {
+		type tooLarge struct {
+			size     protocol.ByteCount
+			mtuProbe bool
+		}
+		reported := make(chan tooLarge, 2)
+		msgSizeErr := &net.OpError{Op: "write", Net: "udp", Err: os.NewSyscallError("sendto", syscall.EMSGSIZE)}
+		conn := &flakyConnection{mockConnection: c, err: msgSizeErr, failures: 2}
+		q = newSendQueue(conn, 3, func() {}, func(size protocol.ByteCount, mtuProbe bool) {
+			reported <- tooLarge{size: size, mtuProbe: mtuProbe}
+		})
+		probe := getPacket([]byte("foobar"), false)
+		probe.mtuProbe = true
+		q.Send(probe)
+		q.Send(getPacket([]byte("foob"), false))
+		q.Send(getPacket([]byte("foo"), false))
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			Expect(q.Run()).To(Succeed())
+			close(done)
+		}()
+		Eventually(c.written).Should(Receive(Equal([]byte("foo"))))
+		Expect(atomic.LoadInt32(&conn.attempts)).To(BeEquivalentTo(3))
+		Expect(reported).To(Receive(Equal(tooLarge{size: 6, mtuProbe: true})))
+		Expect(reported).To(Receive(Equal(tooLarge{size: 4})))
+		Expect(q.TransientWriteErrors()).To(BeZero())
+		q.Close()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("recognizes errors caused by packets larger than the path MTU", func() {
+		Expect(isMsgSizeError(&net.OpError{Op: "write", Net: "udp", Err: os.NewSyscallError("sendmsg", syscall.EMSGSIZE)})).To(BeTrue())
+		Expect(isMsgSizeError(syscall.EMSGSIZE)).To(BeTrue())
+		Expect(isMsgSizeError(syscall.ENOBUFS)).To(BeFalse())
+		Expect(isMsgSizeError(errors.New("write failed"))).To(BeFalse())
+	})
+
+	Context("transient write errors", func() {
+		transientErr := &net.OpError{Op: "write", Net: "udp", Err: os.NewSyscallError("sendto", syscall.ENOBUFS)}
+
+		It("retries writes that fail with a transient error", func() {
+			conn := &flakyConnection{mockConnection: c, err: transientErr, failures: 3}
+			q = newSendQueue(conn, 3, func() {}, func(protocol.ByteCount, bool) {})
+			q.Send(getPacket([]byte("foobar"), false))
+			go q.Run()
+			Eventually(c.written).Should(Receive(Equal([]byte("foobar"))))
+			Expect(atomic.LoadInt32(&conn.attempts)).To(BeEquivalentTo(4))
+			Expect(q.TransientWriteErrors()).To(BeEquivalentTo(3))
+			q.Close()
+		})
+
+		It("returns the error when retrying fails", func() {
+			conn := &flakyConnection{mockConnection: c, err: transientErr, failures: 100}
+			q = newSendQueue(conn, 3, func() {}, func(protocol.ByteCount, bool) {})
+			q.Send(getPacket([]byte("foobar"), false))
+			Expect(q.Run()).To(MatchError(transientErr))
+			Expect(atomic.LoadInt32(&conn.attempts)).To(BeEquivalentTo(4))
+			Expect(q.TransientWriteErrors()).To(BeEquivalentTo(4))
+		})
+
+		It("doesn't retry if retries are disabled", func() {
+			conn := &flakyConnection{mockConnection: c, err: transientErr, failures: 100}
+			q = newSendQueue(conn, 0, func() {}, func(protocol.ByteCount, bool) {})
+			q.Send(getPacket([]byte("foobar"), false))
+			Expect(q.Run()).To(MatchError(transientErr))
+			Expect(atomic.LoadInt32(&conn.attempts)).To(BeEquivalentTo(1))
+		})
+
+		It("doesn't retry permanent errors", func() {
+			testErr := errors.New("write failed")
+			conn := &flakyConnection{mockConnection: c, err: testErr, failures: 100}
+			q = newSendQueue(conn, 3, func() {}, func(protocol.ByteCount, bool) {})
+			q.Send(getPacket([]byte("foobar"), false))
+			Expect(q.Run()).To(MatchError(testErr))
+			Expect(atomic.LoadInt32(&conn.attempts)).To(BeEquivalentTo(1))
+			Expect(q.TransientWriteErrors()).To(BeZero())
+		})
+
+		It("stops retrying when it is closed", func() {
+			conn := &flakyConnection{mockConnection: c, err: transientErr, failures: 100}
+			q = newSendQueue(conn, 1000, func() {}, func(protocol.ByteCount, bool) {})
+			q.Send(getPacket([]byte("foobar"), false))
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(q.Run()).To(Succeed())
+				close(done)
+			}()
+			Eventually(func() int32 { return atomic.LoadInt32(&conn.attempts) }).Should(BeNumerically(">", 1))
+			q.Close()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("recognizes transient errors", func() {
+			Expect(isTransientWriteError(transientErr)).To(BeTrue())
+			Expect(isTransientWriteError(&net.OpError{Op: "write", Net: "udp", Err: os.NewSyscallError("sendto", syscall.EPERM)})).To(BeTrue())
+			Expect(isTransientWriteError(syscall.ENOBUFS)).To(BeTrue())
+			Expect(isTransientWriteError(&net.OpError{Op: "write", Net: "udp", Err: os.NewSyscallError("sendto", syscall.ECONNREFUSED)})).To(BeFalse())
+			Expect(isTransientWriteError(errors.New("write failed"))).To(BeFalse())
+		})
+	})
+})
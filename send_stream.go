@@ -3,6 +3,7 @@ package quic
 import (
 	"context"
 	"fmt"
+	"io"
 	"sync"
 	"time"
 
@@ -18,37 +19,58 @@ type sendStreamI interface {
 	popStreamFrame(maxBytes protocol.ByteCount) (*wire.StreamFrame, bool)
 	closeForShutdown(error)
 	handleMaxStreamDataFrame(*wire.MaxStreamDataFrame)
+	addRetransmittedBytes(protocol.ByteCount)
+	dropExpiredData(*wire.StreamFrame) *wire.StreamFrame
 }
 
 type sendStream struct {
 	mutex sync.Mutex
 
-	ctx       context.Context
-	ctxCancel context.CancelFunc
+	ctx *streamContext
 
 	streamID protocol.StreamID
 	sender   streamSender
+	openedAt time.Time
 
 	writeOffset protocol.ByteCount
 
+	state sendStreamState
+
 	cancelWriteErr      error
+	cancelWriteCode     protocol.ApplicationErrorCode // the error code of the RST_STREAM frame, if the stream was canceled
 	closeForShutdownErr error
 
-	closedForShutdown bool // set when CloseForShutdown() is called
-	finishedWriting   bool // set once Close() is called
-	canceledWrite     bool // set when CancelWrite() is called, or a STOP_SENDING frame is received
-	finSent           bool // set when a STREAM_FRAME with FIN bit has b
-
-	dataForWriting []byte
-	writeChan      chan struct{}
-	writeDeadline  time.Time
+	dataForWriting     []byte
+	moreDataForWriting [][]byte // more buffers passed to WriteVectored, sent after dataForWriting
+	dataIsBorrowed     bool     // if set, the data is owned by the caller, and must be copied into the STREAM frames
+	writeChan          chan struct{}
+	writeDeadline      time.Time
 
 	flowController flowcontrol.StreamFlowController
 
+	// partial reliability
+	dataLifetime  time.Duration
+	sentTimes     []sentDataTime     // the times when the stream data was first sent, ordered by offset
+	expiredOffset protocol.ByteCount // data below this offset expired, and won't be retransmitted
+
+	// statistics
+	bytesSent          protocol.ByteCount
+	bytesRetransmitted protocol.ByteCount
+	framesSent         uint64
+	blockedSince       time.Time // set when the stream becomes blocked by flow control
+	blockedTime        time.Duration
+
 	version protocol.VersionNumber
 }
 
+// A sentDataTime records when the stream data up to offset was first sent.
+type sentDataTime struct {
+	offset protocol.ByteCount
+	time   time.Time
+}
+
 var _ SendStream = &sendStream{}
+var _ io.ReaderFrom = &sendStream{}
 var _ sendStreamI = &sendStream{}
 
 func newSendStream(
@@ -60,11 +82,12 @@ func newSendStream(
 	s := &sendStream{
 		streamID:       streamID,
 		sender:         sender,
+		openedAt:       time.Now(),
 		flowController: flowController,
 		writeChan:      make(chan struct{}, 1),
 		version:        version,
 	}
-	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+	s.ctx = newStreamContext()
 	return s
 }
 
@@ -72,41 +95,119 @@ func (s *sendStream) StreamID() protocol.StreamID {
 	return s.streamID // same for receiveStream and sendStream
 }
 
+// A writeMode determines how the data passed to writeImpl is handed to the STREAM frames.
+type writeMode uint8
+
+const (
+	// writeModeCopy copies the data before sending it
+	writeModeCopy writeMode = iota
+	// writeModeHandOver uses the data for the STREAM frames without copying it.
+	// The caller must not modify it afterwards.
+	writeModeHandOver
+	// writeModeBorrow copies the data into the STREAM frames when they are sent.
+	// The caller must not modify it until writeImpl returns.
+	writeModeBorrow
+)
+
 func (s *sendStream) Write(p []byte) (int, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if s.finishedWriting {
-		return 0, fmt.Errorf("write on closed stream %d", s.streamID)
+	return s.writeImpl([][]byte{p}, writeModeCopy)
+}
+
+// WriteVectored writes the data of all buffers to the stream, as if they were concatenated.
+// The buffers are not concatenated first, instead the data is copied directly into the STREAM frames.
+func (s *sendStream) WriteVectored(bufs [][]byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.writeImpl(bufs, writeModeBorrow)
+}
+
+// ReadFrom implements io.ReaderFrom.
+// It reads directly into buffers that are passed to the stream without copying them again.
+func (s *sendStream) ReadFrom(r io.Reader) (int64, error) {
+	var bytesWritten int64
+	// The stream keeps references to the data until it is acknowledged, so we can't reuse the buffer.
+	// Instead, every read fills the part of the buffer following the data of the previous read.
+	// A new buffer is only allocated once the buffer is full.
+	var buf []byte
+	for {
+		if len(buf) == 0 {
+			buf = make([]byte, protocol.StreamReadFromBufferSize)
+		}
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			data := buf[:n:n]
+			buf = buf[n:]
+			s.mutex.Lock()
+			m, err := s.writeImpl([][]byte{data}, writeModeHandOver)
+			s.mutex.Unlock()
+			bytesWritten += int64(m)
+			if err != nil {
+				return bytesWritten, err
+			}
+		}
+		if readErr == io.EOF {
+			return bytesWritten, nil
+		}
+		if readErr != nil {
+			return bytesWritten, readErr
+		}
 	}
-	if s.canceledWrite {
+}
+
+// writeImpl blocks until all data has been passed on to the packet packer.
+// must be called after locking the mutex
+func (s *sendStream) writeImpl(bufs [][]byte, mode writeMode) (int, error) {
+	switch s.state {
+	case sendStreamStateClosed, sendStreamStateFinSent:
+		return 0, fmt.Errorf("write on closed stream %d", s.streamID)
+	case sendStreamStateResetSent:
 		return 0, s.cancelWriteErr
-	}
-	if s.closeForShutdownErr != nil {
+	case sendStreamStateShutdown:
 		return 0, s.closeForShutdownErr
 	}
 	if !s.writeDeadline.IsZero() && !time.Now().Before(s.writeDeadline) {
 		return 0, errDeadline
 	}
-	if len(p) == 0 {
+	var dataLen int
+	nonEmptyBufs := make([][]byte, 0, len(bufs))
+	for _, b := range bufs {
+		if len(b) > 0 {
+			nonEmptyBufs = append(nonEmptyBufs, b)
+			dataLen += len(b)
+		}
+	}
+	if dataLen == 0 {
 		return 0, nil
 	}
 
-	s.dataForWriting = make([]byte, len(p))
-	copy(s.dataForWriting, p)
+	if mode == writeModeCopy {
+		data := make([]byte, 0, dataLen)
+		for _, b := range nonEmptyBufs {
+			data = append(data, b...)
+		}
+		s.dataForWriting = data
+	} else {
+		s.dataForWriting = nonEmptyBufs[0]
+		s.moreDataForWriting = nonEmptyBufs[1:]
+	}
+	s.dataIsBorrowed = mode == writeModeBorrow
 	s.sender.onHasStreamData(s.streamID)
 
 	var bytesWritten int
 	var err error
 	for {
-		bytesWritten = len(p) - len(s.dataForWriting)
+		bytesWritten = dataLen - int(s.dataForWritingLen())
 		deadline := s.writeDeadline
 		if !deadline.IsZero() && !time.Now().Before(deadline) {
-			s.dataForWriting = nil
+			s.dropDataForWriting()
 			err = errDeadline
 			break
 		}
-		if s.dataForWriting == nil || s.canceledWrite || s.closedForShutdown {
+		if s.dataForWriting == nil || s.state != sendStreamStateOpen {
 			break
 		}
 
@@ -122,21 +223,68 @@ func (s *sendStream) Write(p []byte) (int, error) {
 		s.mutex.Lock()
 	}
 
-	if s.closeForShutdownErr != nil {
-		err = s.closeForShutdownErr
-	} else if s.cancelWriteErr != nil {
+	switch s.state {
+	case sendStreamStateResetSent:
 		err = s.cancelWriteErr
+	case sendStreamStateShutdown:
+		err = s.closeForShutdownErr
+	}
+	if err != nil {
+		// don't send any of the remaining data
+		s.dropDataForWriting()
 	}
 	return bytesWritten, err
 }
 
+func (s *sendStream) dataForWritingLen() protocol.ByteCount {
+	l := protocol.ByteCount(len(s.dataForWriting))
+	for _, b := range s.moreDataForWriting {
+		l += protocol.ByteCount(len(b))
+	}
+	return l
+}
+
+// nextDataForWriting moves on to the next buffer passed to WriteVectored.
+// It sets dataForWriting to nil if there are no more buffers.
+func (s *sendStream) nextDataForWriting() {
+	if len(s.moreDataForWriting) == 0 {
+		s.dataForWriting = nil
+		s.moreDataForWriting = nil
+		return
+	}
+	s.dataForWriting = s.moreDataForWriting[0]
+	s.moreDataForWriting = s.moreDataForWriting[1:]
+}
+
+func (s *sendStream) dropDataForWriting() {
+	s.dataForWriting = nil
+	s.moreDataForWriting = nil
+}
+
+// copyDataForWriting copies up to maxBytes of borrowed data into a new slice.
+// The copy may span multiple buffers passed to WriteVectored.
+func (s *sendStream) copyDataForWriting(maxBytes protocol.ByteCount) []byte {
+	ret := make([]byte, utils.MinByteCount(maxBytes, s.dataForWritingLen()))
+	var n int
+	for n < len(ret) {
+		c := copy(ret[n:], s.dataForWriting)
+		n += c
+		s.dataForWriting = s.dataForWriting[c:]
+		if len(s.dataForWriting) == 0 {
+			s.nextDataForWriting()
+		}
+	}
+	return ret
+}
+
 // popStreamFrame returns the next STREAM frame that is supposed to be sent on this stream
 // maxBytes is the maximum length this frame (including frame header) will have.
 func (s *sendStream) popStreamFrame(maxBytes protocol.ByteCount) (*wire.StreamFrame, bool /* has more data to send */) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if s.closeForShutdownErr != nil {
+	// Data written before the stream was canceled must not be sent after the RST_STREAM.
+	if s.state == sendStreamStateResetSent || s.state == sendStreamStateShutdown {
 		return nil, false
 	}
 
@@ -159,13 +307,26 @@ func (s *sendStream) popStreamFrame(maxBytes protocol.ByteCount) (*wire.StreamFr
 			return nil, false
 		}
 		isBlocked, _ := s.flowController.IsBlocked()
+		if isBlocked {
+			s.setBlocked()
+		}
 		return nil, !isBlocked
 	}
+	s.bytesSent += frame.DataLen()
+	s.framesSent++
+	if s.dataLifetime > 0 && frame.DataLen() > 0 {
+		now := time.Now()
+		s.updateExpiredOffset(now)
+		s.sentTimes = append(s.sentTimes, sentDataTime{offset: s.writeOffset, time: now})
+	}
 	if frame.FinBit {
-		s.finSent = true
+		if err := s.transitionTo(sendStreamStateFinSent); err != nil {
+			return nil, false
+		}
 		s.sender.onStreamCompleted(s.streamID)
 	} else if s.streamID != s.version.CryptoStreamID() { // TODO(#657): Flow control for the crypto stream
 		if isBlocked, offset := s.flowController.IsBlocked(); isBlocked {
+			s.setBlocked()
 			s.sender.queueControlFrame(&wire.StreamBlockedFrame{
 				StreamID: s.streamID,
 				Offset:   offset,
@@ -178,7 +339,7 @@ func (s *sendStream) popStreamFrame(maxBytes protocol.ByteCount) (*wire.StreamFr
 
 func (s *sendStream) getDataForWriting(maxBytes protocol.ByteCount) ([]byte, bool /* should send FIN */) {
 	if s.dataForWriting == nil {
-		return nil, s.finishedWriting && !s.finSent
+		return nil, s.state == sendStreamStateClosed
 	}
 
 	// TODO(#657): Flow control for the crypto stream
@@ -190,29 +351,41 @@ func (s *sendStream) getDataForWriting(maxBytes protocol.ByteCount) ([]byte, boo
 	}
 
 	var ret []byte
-	if protocol.ByteCount(len(s.dataForWriting)) > maxBytes {
+	if s.dataIsBorrowed {
+		ret = s.copyDataForWriting(maxBytes)
+	} else if protocol.ByteCount(len(s.dataForWriting)) > maxBytes {
 		ret = s.dataForWriting[:maxBytes]
 		s.dataForWriting = s.dataForWriting[maxBytes:]
 	} else {
 		ret = s.dataForWriting
-		s.dataForWriting = nil
+		s.nextDataForWriting()
+	}
+	if s.dataForWriting == nil {
 		s.signalWrite()
 	}
 	s.writeOffset += protocol.ByteCount(len(ret))
 	s.flowController.AddBytesSent(protocol.ByteCount(len(ret)))
-	return ret, s.finishedWriting && s.dataForWriting == nil && !s.finSent
+	return ret, s.state == sendStreamStateClosed && s.dataForWriting == nil
 }
 
 func (s *sendStream) Close() error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if s.canceledWrite {
+	switch s.state {
+	case sendStreamStateClosed, sendStreamStateFinSent:
+		return nil
+	case sendStreamStateShutdown:
+		// The session was closed. There's nothing left to close.
+		return nil
+	case sendStreamStateResetSent:
 		return fmt.Errorf("Close called for canceled stream %d", s.streamID)
 	}
-	s.finishedWriting = true
+	if err := s.transitionTo(sendStreamStateClosed); err != nil {
+		return err
+	}
 	s.sender.onHasStreamData(s.streamID) // need to send the FIN
-	s.ctxCancel()
+	s.ctx.cancel(context.Canceled)
 	return nil
 }
 
@@ -225,14 +398,17 @@ func (s *sendStream) CancelWrite(errorCode protocol.ApplicationErrorCode) error
 
 // must be called after locking the mutex
 func (s *sendStream) cancelWriteImpl(errorCode protocol.ApplicationErrorCode, writeErr error) error {
-	if s.canceledWrite {
+	switch s.state {
+	case sendStreamStateResetSent, sendStreamStateShutdown:
 		return nil
-	}
-	if s.finishedWriting {
+	case sendStreamStateClosed, sendStreamStateFinSent:
 		return fmt.Errorf("CancelWrite for closed stream %d", s.streamID)
 	}
-	s.canceledWrite = true
+	if err := s.transitionTo(sendStreamStateResetSent); err != nil {
+		return err
+	}
 	s.cancelWriteErr = writeErr
+	s.cancelWriteCode = errorCode
 	s.signalWrite()
 	s.sender.queueControlFrame(&wire.RstStreamFrame{
 		StreamID:   s.streamID,
@@ -240,7 +416,7 @@ func (s *sendStream) cancelWriteImpl(errorCode protocol.ApplicationErrorCode, wr
 		ErrorCode:  errorCode,
 	})
 	// TODO(#991): cancel retransmissions for this stream
-	s.ctxCancel()
+	s.ctx.cancel(writeErr)
 	s.sender.onStreamCompleted(s.streamID)
 	return nil
 }
@@ -254,6 +430,10 @@ func (s *sendStream) handleStopSendingFrame(frame *wire.StopSendingFrame) {
 func (s *sendStream) handleMaxStreamDataFrame(frame *wire.MaxStreamDataFrame) {
 	s.flowController.UpdateSendWindow(frame.ByteOffset)
 	s.mutex.Lock()
+	if !s.blockedSince.IsZero() {
+		s.blockedTime += time.Since(s.blockedSince)
+		s.blockedSince = time.Time{}
+	}
 	if s.dataForWriting != nil {
 		s.sender.onHasStreamData(s.streamID)
 	}
@@ -288,22 +468,137 @@ func (s *sendStream) SetWriteDeadline(t time.Time) error {
 	return nil
 }
 
+func (s *sendStream) SetDataLifetime(d time.Duration) {
+	s.mutex.Lock()
+	s.dataLifetime = d
+	if d == 0 {
+		s.sentTimes = nil
+	}
+	s.mutex.Unlock()
+}
+
+// updateExpiredOffset advances the expiredOffset to the end of the data that was first sent more than the lifetime ago.
+// must be called after locking the mutex
+func (s *sendStream) updateExpiredOffset(now time.Time) {
+	for len(s.sentTimes) > 0 && now.Sub(s.sentTimes[0].time) >= s.dataLifetime {
+		s.expiredOffset = s.sentTimes[0].offset
+		s.sentTimes = s.sentTimes[1:]
+	}
+}
+
+// dropExpiredData is called for STREAM frames that are about to be retransmitted.
+// It removes the expired data from the frame, and tells the peer to skip over it.
+// It returns nil if nothing needs to be retransmitted.
+func (s *sendStream) dropExpiredData(frame *wire.StreamFrame) *wire.StreamFrame {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.dataLifetime == 0 {
+		return frame
+	}
+	s.updateExpiredOffset(time.Now())
+	if frame.Offset >= s.expiredOffset {
+		return frame
+	}
+	end := frame.Offset + frame.DataLen()
+	s.sender.queueControlFrame(&wire.ExpiredStreamDataFrame{
+		StreamID: s.streamID,
+		Offset:   utils.MinByteCount(end, s.expiredOffset),
+	})
+	if end <= s.expiredOffset {
+		if !frame.FinBit {
+			return nil
+		}
+		// the FIN still has to be delivered
+		return &wire.StreamFrame{
+			StreamID:       s.streamID,
+			Offset:         end,
+			FinBit:         true,
+			DataLenPresent: true,
+		}
+	}
+	frame.Data = frame.Data[s.expiredOffset-frame.Offset:]
+	frame.Offset = s.expiredOffset
+	return frame
+}
+
 // CloseForShutdown closes a stream abruptly.
 // It makes Write unblock (and return the error) immediately.
 // The peer will NOT be informed about this: the stream is closed without sending a FIN or RST.
 func (s *sendStream) closeForShutdown(err error) {
 	s.mutex.Lock()
-	s.closedForShutdown = true
+	// streams that already sent a FIN or a RST_STREAM are not affected
+	if transitionErr := s.transitionTo(sendStreamStateShutdown); transitionErr != nil {
+		s.mutex.Unlock()
+		return
+	}
 	s.closeForShutdownErr = err
 	s.mutex.Unlock()
 	s.signalWrite()
-	s.ctxCancel()
+	s.ctx.cancel(err)
+}
+
+func (s *sendStream) Stats() StreamStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	blockedTime := s.blockedTime
+	if !s.blockedSince.IsZero() {
+		blockedTime += time.Since(s.blockedSince)
+	}
+	return StreamStats{
+		BytesSent:              uint64(s.bytesSent),
+		BytesRetransmitted:     uint64(s.bytesRetransmitted),
+		FramesSent:             s.framesSent,
+		FlowControlBlockedTime: blockedTime,
+	}
+}
+
+// record returns the StreamRecord of the send side of the stream
+func (s *sendStream) record() StreamRecord {
+	r := StreamRecord{
+		StreamID: s.streamID,
+		OpenedAt: s.openedAt,
+		Stats:    s.Stats(),
+	}
+	s.mutex.Lock()
+	if s.state == sendStreamStateResetSent {
+		r.WriteReset = true
+		r.WriteResetCode = s.cancelWriteCode
+	}
+	s.mutex.Unlock()
+	return r
+}
+
+// addRetransmittedBytes is called when STREAM frames of this stream are retransmitted
+func (s *sendStream) addRetransmittedBytes(n protocol.ByteCount) {
+	s.mutex.Lock()
+	s.bytesRetransmitted += n
+	s.mutex.Unlock()
+}
+
+// setBlocked records the time when the stream became blocked by flow control
+// must be called after locking the mutex
+func (s *sendStream) setBlocked() {
+	if s.blockedSince.IsZero() {
+		s.blockedSince = time.Now()
+	}
 }
 
 func (s *sendStream) getWriteOffset() protocol.ByteCount {
 	return s.writeOffset
 }
 
+// transitionTo moves the stream to the next state, if this is a valid state transition.
+// must be called after locking the mutex
+func (s *sendStream) transitionTo(state sendStreamState) error {
+	if !s.state.canTransitionTo(state) {
+		return &streamStateTransitionError{streamID: s.streamID, from: s.state, to: state}
+	}
+	s.state = state
+	return nil
+}
+
 // signalWrite performs a non-blocking send on the writeChan
 func (s *sendStream) signalWrite() {
 	select {
@@ -2,9 +2,11 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/golang/mock/gomock"
@@ -177,6 +179,187 @@ var _ = Describe("Send Stream", func() {
 			Expect(str.Context().Done()).ToNot(BeClosed())
 			str.Close()
 			Expect(str.Context().Done()).To(BeClosed())
+			Expect(str.Context().Err()).To(MatchError(context.Canceled))
+		})
+
+		Context("vectored writes", func() {
+			It("packs multiple buffers into one STREAM frame", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999))
+				mockFC.EXPECT().AddBytesSent(protocol.ByteCount(9))
+				mockFC.EXPECT().IsBlocked()
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					n, err := str.WriteVectored([][]byte{[]byte("foo"), nil, []byte("bar"), []byte("baz")})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(n).To(Equal(9))
+					close(done)
+				}()
+				waitForWrite()
+				f, hasMoreData := str.popStreamFrame(1000)
+				Expect(f.Data).To(Equal([]byte("foobarbaz")))
+				Expect(hasMoreData).To(BeFalse())
+				Expect(str.writeOffset).To(Equal(protocol.ByteCount(9)))
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("splits buffers across STREAM frames", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				frameHeaderSize := protocol.ByteCount(4)
+				mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999)).Times(2)
+				mockFC.EXPECT().AddBytesSent(protocol.ByteCount(4))
+				mockFC.EXPECT().AddBytesSent(protocol.ByteCount(2))
+				mockFC.EXPECT().IsBlocked().Times(2)
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					n, err := str.WriteVectored([][]byte{[]byte("foo"), []byte("bar")})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(n).To(Equal(6))
+					close(done)
+				}()
+				waitForWrite()
+				f, hasMoreData := str.popStreamFrame(frameHeaderSize + 4)
+				Expect(f.Data).To(Equal([]byte("foob")))
+				Expect(hasMoreData).To(BeTrue())
+				Consistently(done).ShouldNot(BeClosed())
+				f, hasMoreData = str.popStreamFrame(1000)
+				Expect(f.Data).To(Equal([]byte("ar")))
+				Expect(f.Offset).To(Equal(protocol.ByteCount(4)))
+				Expect(hasMoreData).To(BeFalse())
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("copies the data into the STREAM frames", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999))
+				mockFC.EXPECT().AddBytesSent(protocol.ByteCount(6))
+				mockFC.EXPECT().IsBlocked()
+				bufs := [][]byte{[]byte("foo"), []byte("bar")}
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					_, err := str.WriteVectored(bufs)
+					Expect(err).ToNot(HaveOccurred())
+					close(done)
+				}()
+				waitForWrite()
+				f, _ := str.popStreamFrame(1000)
+				Eventually(done).Should(BeClosed())
+				bufs[0][0] = 'g'
+				Expect(f.Data).To(Equal([]byte("foobar")))
+			})
+
+			It("returns when given only empty buffers", func() {
+				n, err := str.WriteVectored([][]byte{nil, {}})
+				Expect(n).To(BeZero())
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("returns the number of bytes written, when the deadline expires", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				frameHeaderSize := protocol.ByteCount(4)
+				mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(10000)).AnyTimes()
+				mockFC.EXPECT().AddBytesSent(protocol.ByteCount(5))
+				mockFC.EXPECT().IsBlocked()
+				deadline := time.Now().Add(scaleDuration(50 * time.Millisecond))
+				str.SetWriteDeadline(deadline)
+				var n int
+				writeReturned := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					var err error
+					n, err = str.WriteVectored([][]byte{[]byte("foo"), []byte("bar"), []byte("baz")})
+					Expect(err).To(MatchError(errDeadline))
+					close(writeReturned)
+				}()
+				waitForWrite()
+				frame, hasMoreData := str.popStreamFrame(frameHeaderSize + 5)
+				Expect(frame.Data).To(Equal([]byte("fooba")))
+				Expect(hasMoreData).To(BeTrue())
+				Eventually(writeReturned, scaleDuration(80*time.Millisecond)).Should(BeClosed())
+				Expect(n).To(Equal(5))
+				frame, _ = str.popStreamFrame(1000)
+				Expect(frame).To(BeNil())
+			})
+		})
+
+		Context("reading from an io.Reader", func() {
+			It("reads all data from the reader", func() {
+				mockSender.EXPECT().onHasStreamData(streamID).Times(2)
+				mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999)).Times(2)
+				mockFC.EXPECT().AddBytesSent(protocol.ByteCount(3)).Times(2)
+				mockFC.EXPECT().IsBlocked().Times(2)
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					n, err := str.ReadFrom(io.MultiReader(strings.NewReader("foo"), strings.NewReader("bar")))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(n).To(BeEquivalentTo(6))
+					close(done)
+				}()
+				waitForWrite()
+				f, _ := str.popStreamFrame(1000)
+				Expect(f.Data).To(Equal([]byte("foo")))
+				Expect(f.Offset).To(BeZero())
+				waitForWrite()
+				f2, _ := str.popStreamFrame(1000)
+				Expect(f2.Data).To(Equal([]byte("bar")))
+				Expect(f2.Offset).To(Equal(protocol.ByteCount(3)))
+				Eventually(done).Should(BeClosed())
+				// the second read didn't overwrite the data of the first read
+				Expect(f.Data).To(Equal([]byte("foo")))
+			})
+
+			It("returns the error of the reader", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999))
+				mockFC.EXPECT().AddBytesSent(protocol.ByteCount(3))
+				mockFC.EXPECT().IsBlocked()
+				testErr := errors.New("read failed")
+				pr, pw := io.Pipe()
+				go func() {
+					defer GinkgoRecover()
+					pw.Write([]byte("foo"))
+					pw.CloseWithError(testErr)
+				}()
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					n, err := str.ReadFrom(pr)
+					Expect(err).To(MatchError(testErr))
+					Expect(n).To(BeEquivalentTo(3))
+					close(done)
+				}()
+				waitForWrite()
+				f, _ := str.popStreamFrame(1000)
+				Expect(f.Data).To(Equal([]byte("foo")))
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("stops reading when writing is canceled", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().queueControlFrame(gomock.Any())
+				pr, pw := io.Pipe()
+				go func() {
+					defer GinkgoRecover()
+					pw.Write([]byte("foobar"))
+				}()
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					n, err := str.ReadFrom(pr)
+					Expect(err).To(MatchError("Write on stream 1337 canceled with error code 1234"))
+					Expect(n).To(BeZero())
+					close(done)
+				}()
+				waitForWrite()
+				err := str.CancelWrite(1234)
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(done).Should(BeClosed())
+			})
 		})
 
 		Context("flow control blocking", func() {
@@ -418,6 +601,30 @@ var _ = Describe("Send Stream", func() {
 				Expect(f.FinBit).To(BeTrue())
 			})
 
+			It("only sends one FIN when Close is called multiple times", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				Expect(str.Close()).To(Succeed())
+				Expect(str.Close()).To(Succeed())
+				f, _ := str.popStreamFrame(1000)
+				Expect(f.FinBit).To(BeTrue())
+				Expect(str.Close()).To(Succeed())
+				f, _ = str.popStreamFrame(1000)
+				Expect(f).To(BeNil())
+			})
+
+			It("isn't affected by a shutdown after the FIN was sent", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				Expect(str.Close()).To(Succeed())
+				f, _ := str.popStreamFrame(1000)
+				Expect(f.FinBit).To(BeTrue())
+				str.closeForShutdown(errors.New("shutdown"))
+				Expect(str.Context().Err()).To(MatchError(context.Canceled))
+				_, err := strWithTimeout.Write([]byte("foobar"))
+				Expect(err).To(MatchError("write on closed stream 1337"))
+			})
+
 			It("doesn't allow FIN after it is closed for shutdown", func() {
 				str.closeForShutdown(errors.New("test"))
 				f, hasMoreData := str.popStreamFrame(1000)
@@ -472,10 +679,17 @@ var _ = Describe("Send Stream", func() {
 				Eventually(done).Should(BeClosed())
 			})
 
+			It("doesn't return an error when closing or canceling the stream after shutdown", func() {
+				str.closeForShutdown(testErr)
+				Expect(str.Close()).To(Succeed())
+				Expect(str.CancelWrite(1234)).To(Succeed())
+			})
+
 			It("cancels the context", func() {
 				Expect(str.Context().Done()).ToNot(BeClosed())
 				str.closeForShutdown(testErr)
 				Expect(str.Context().Done()).To(BeClosed())
+				Expect(str.Context().Err()).To(MatchError(testErr))
 			})
 		})
 	})
@@ -510,6 +724,170 @@ var _ = Describe("Send Stream", func() {
 		})
 	})
 
+	Context("partial reliability", func() {
+		BeforeEach(func() {
+			str.SetDataLifetime(time.Second)
+		})
+
+		// sendData writes the data and pops a single STREAM frame containing all of it
+		sendData := func(data []byte) *wire.StreamFrame {
+			mockSender.EXPECT().onHasStreamData(streamID)
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999))
+			mockFC.EXPECT().AddBytesSent(protocol.ByteCount(len(data)))
+			mockFC.EXPECT().IsBlocked()
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := strWithTimeout.Write(data)
+				Expect(err).ToNot(HaveOccurred())
+				close(done)
+			}()
+			waitForWrite()
+			f, _ := str.popStreamFrame(1000)
+			Expect(f.Data).To(Equal(data))
+			Eventually(done).Should(BeClosed())
+			return f
+		}
+
+		// expire makes all data that was sent so far expire
+		expire := func() {
+			str.mutex.Lock()
+			for i := range str.sentTimes {
+				str.sentTimes[i].time = str.sentTimes[i].time.Add(-time.Second)
+			}
+			str.mutex.Unlock()
+		}
+
+		It("retransmits data that didn't expire yet", func() {
+			f := sendData([]byte("foobar"))
+			Expect(str.dropExpiredData(f)).To(Equal(f))
+		})
+
+		It("retransmits all data if partial reliability is disabled", func() {
+			f := sendData([]byte("foobar"))
+			expire()
+			str.SetDataLifetime(0)
+			Expect(str.dropExpiredData(f)).To(Equal(f))
+		})
+
+		It("drops expired data, and tells the peer to skip it", func() {
+			f1 := sendData([]byte("foo"))
+			f2 := sendData([]byte("bar"))
+			expire()
+			mockSender.EXPECT().queueControlFrame(&wire.ExpiredStreamDataFrame{StreamID: streamID, Offset: 3})
+			Expect(str.dropExpiredData(f1)).To(BeNil())
+			mockSender.EXPECT().queueControlFrame(&wire.ExpiredStreamDataFrame{StreamID: streamID, Offset: 6})
+			Expect(str.dropExpiredData(f2)).To(BeNil())
+			Expect(str.sentTimes).To(BeEmpty())
+		})
+
+		It("cuts frames that contain both expired and current data", func() {
+			sendData([]byte("foo"))
+			expire()
+			sendData([]byte("bar"))
+			f := &wire.StreamFrame{StreamID: streamID, Data: []byte("foobar"), DataLenPresent: true}
+			mockSender.EXPECT().queueControlFrame(&wire.ExpiredStreamDataFrame{StreamID: streamID, Offset: 3})
+			Expect(str.dropExpiredData(f)).To(Equal(&wire.StreamFrame{
+				StreamID:       streamID,
+				Offset:         3,
+				Data:           []byte("bar"),
+				DataLenPresent: true,
+			}))
+		})
+
+		It("still retransmits the FIN", func() {
+			f := sendData([]byte("foobar"))
+			f.FinBit = true
+			expire()
+			mockSender.EXPECT().queueControlFrame(&wire.ExpiredStreamDataFrame{StreamID: streamID, Offset: 6})
+			Expect(str.dropExpiredData(f)).To(Equal(&wire.StreamFrame{
+				StreamID:       streamID,
+				Offset:         6,
+				FinBit:         true,
+				DataLenPresent: true,
+			}))
+		})
+	})
+
+	Context("statistics", func() {
+		It("counts the data sent", func() {
+			mockSender.EXPECT().onHasStreamData(streamID)
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999)).Times(2)
+			mockFC.EXPECT().AddBytesSent(gomock.Any()).Times(2)
+			mockFC.EXPECT().IsBlocked().Times(2)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := strWithTimeout.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				close(done)
+			}()
+			waitForWrite()
+			f, _ := str.popStreamFrame(3 + 4) // 3 bytes of data, 4 bytes of frame header
+			Expect(f.Data).To(Equal([]byte("foo")))
+			f, _ = str.popStreamFrame(1000)
+			Expect(f.Data).To(Equal([]byte("bar")))
+			Eventually(done).Should(BeClosed())
+			stats := str.Stats()
+			Expect(stats.BytesSent).To(BeEquivalentTo(6))
+			Expect(stats.FramesSent).To(BeEquivalentTo(2))
+			Expect(stats.BytesReceived).To(BeZero())
+		})
+
+		It("counts retransmitted data", func() {
+			str.addRetransmittedBytes(10)
+			str.addRetransmittedBytes(20)
+			Expect(str.Stats().BytesRetransmitted).To(BeEquivalentTo(30))
+		})
+
+		It("records the error code of CancelWrite", func() {
+			mockSender.EXPECT().queueControlFrame(gomock.Any())
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			Expect(str.record().WriteReset).To(BeFalse())
+			Expect(str.CancelWrite(1234)).To(Succeed())
+			r := str.record()
+			Expect(r.StreamID).To(Equal(streamID))
+			Expect(r.OpenedAt).To(BeTemporally("~", time.Now(), time.Second))
+			Expect(r.WriteReset).To(BeTrue())
+			Expect(r.WriteResetCode).To(BeEquivalentTo(1234))
+			Expect(r.ReadReset).To(BeFalse())
+		})
+
+		It("measures the time that the stream was blocked by flow control", func() {
+			mockSender.EXPECT().onHasStreamData(streamID).Times(2) // once for Write, once for the MAX_STREAM_DATA frame
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(0))
+			mockFC.EXPECT().IsBlocked().Return(true, protocol.ByteCount(0))
+			testErr := errors.New("test error")
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := str.Write([]byte("foobar"))
+				Expect(err).To(MatchError(testErr))
+				close(done)
+			}()
+			waitForWrite()
+			f, hasMoreData := str.popStreamFrame(1000)
+			Expect(f).To(BeNil())
+			Expect(hasMoreData).To(BeFalse())
+			str.mutex.Lock()
+			Expect(str.blockedSince).ToNot(BeZero())
+			str.blockedSince = str.blockedSince.Add(-time.Second)
+			str.mutex.Unlock()
+			Expect(str.Stats().FlowControlBlockedTime).To(BeNumerically(">=", time.Second))
+			mockFC.EXPECT().UpdateSendWindow(protocol.ByteCount(100))
+			str.handleMaxStreamDataFrame(&wire.MaxStreamDataFrame{
+				StreamID:   streamID,
+				ByteOffset: 100,
+			})
+			blockedTime := str.Stats().FlowControlBlockedTime
+			Expect(blockedTime).To(BeNumerically("~", time.Second, 100*time.Millisecond))
+			Consistently(func() time.Duration { return str.Stats().FlowControlBlockedTime }, 50*time.Millisecond).Should(Equal(blockedTime))
+			// make sure the Write go routine returns
+			str.closeForShutdown(testErr)
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
 	Context("stream cancelations", func() {
 		Context("canceling writing", func() {
 			It("queues a RST_STREAM frame", func() {
@@ -549,12 +927,32 @@ var _ = Describe("Send Stream", func() {
 				Expect(n).To(BeEquivalentTo(frame.DataLen()))
 			})
 
+			It("doesn't send data that was written before the stream was canceled", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().queueControlFrame(gomock.Any())
+				writeReturned := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					_, err := strWithTimeout.Write([]byte("foobar"))
+					Expect(err).To(MatchError("Write on stream 1337 canceled with error code 1234"))
+					close(writeReturned)
+				}()
+				waitForWrite()
+				Expect(str.CancelWrite(1234)).To(Succeed())
+				Eventually(writeReturned).Should(BeClosed())
+				f, hasMoreData := str.popStreamFrame(1000)
+				Expect(f).To(BeNil())
+				Expect(hasMoreData).To(BeFalse())
+			})
+
 			It("cancels the context", func() {
 				mockSender.EXPECT().queueControlFrame(gomock.Any())
 				mockSender.EXPECT().onStreamCompleted(streamID)
 				Expect(str.Context().Done()).ToNot(BeClosed())
 				str.CancelWrite(1234)
 				Expect(str.Context().Done()).To(BeClosed())
+				Expect(str.Context().Err()).To(MatchError("Write on stream 1337 canceled with error code 1234"))
 			})
 
 			It("doesn't allow further calls to Write", func() {
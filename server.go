@@ -2,12 +2,18 @@ package quic
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"math"
 	"net"
+	"runtime"
+	"sync"
 	"time"
 
+	"github.com/bifurcation/mint"
 	"github.com/lucas-clemente/quic-go/internal/crypto"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -28,16 +34,34 @@ type packetHandler interface {
 
 type sessionRunner interface {
 	onHandshakeComplete(packetHandler)
+	addConnectionID(protocol.ConnectionID, packetHandler)
 	removeConnectionID(protocol.ConnectionID)
+	// getStatelessResetToken returns the stateless reset token for one of our connection IDs
+	getStatelessResetToken(protocol.ConnectionID) [16]byte
+	// addResetToken and removeResetToken keep track of the stateless reset tokens issued by the peer
+	addResetToken([16]byte)
+	removeResetToken([16]byte)
 }
 
 type runner struct {
-	onHandshakeCompleteImpl func(packetHandler)
-	removeConnectionIDImpl  func(protocol.ConnectionID)
+	onHandshakeCompleteImpl    func(packetHandler)
+	addConnectionIDImpl        func(protocol.ConnectionID, packetHandler)
+	removeConnectionIDImpl     func(protocol.ConnectionID)
+	getStatelessResetTokenImpl func(protocol.ConnectionID) [16]byte
+	addResetTokenImpl          func([16]byte)
+	removeResetTokenImpl       func([16]byte)
 }
 
-func (r *runner) onHandshakeComplete(p packetHandler)        { r.onHandshakeCompleteImpl(p) }
+func (r *runner) onHandshakeComplete(p packetHandler) { r.onHandshakeCompleteImpl(p) }
+func (r *runner) addConnectionID(c protocol.ConnectionID, p packetHandler) {
+	r.addConnectionIDImpl(c, p)
+}
 func (r *runner) removeConnectionID(c protocol.ConnectionID) { r.removeConnectionIDImpl(c) }
+func (r *runner) getStatelessResetToken(c protocol.ConnectionID) [16]byte {
+	return r.getStatelessResetTokenImpl(c)
+}
+func (r *runner) addResetToken(t [16]byte)    { r.addResetTokenImpl(t) }
+func (r *runner) removeResetToken(t [16]byte) { r.removeResetTokenImpl(t) }
 
 var _ sessionRunner = &runner{}
 
@@ -51,23 +75,36 @@ type sessionHandler interface {
 // A Listener of QUIC
 type server struct {
 	tlsConf *tls.Config
-	config  *Config
+
+	configMutex sync.RWMutex
+	config      *Config
 
 	conn net.PacketConn
 
 	supportsTLS bool
 	serverTLS   *serverTLS
 
-	certChain crypto.CertChain
-	scfg      *handshake.ServerConfig
+	certChain       crypto.CertChain
+	scfg            *handshake.ServerConfig
+	chloQueue       *handshake.CHLOQueue
+	cookieGenerator *handshake.CookieGenerator
+	cookieProtector mint.CookieProtector
 
 	sessionHandler sessionHandler
+	sourceLimiter  *sourceLimiter
+	// shards is set if the server is one of the Listeners created by ListenAddrShards
+	shards *shardGroup
 
 	serverError error
 
 	sessionQueue chan Session
 	errorChan    chan struct{}
 
+	// transport is set if the server shares its net.PacketConn with other connections.
+	// In that case, the Transport reads from the net.PacketConn, and owns it.
+	transport *Transport
+	closeOnce sync.Once
+
 	sessionRunner sessionRunner
 	// set as a member, so they can be set in the tests
 	newSession func(connection, sessionRunner, protocol.VersionNumber, protocol.ConnectionID, *handshake.ServerConfig, *tls.Config, *Config, utils.Logger) (packetHandler, error)
@@ -77,6 +114,49 @@ type server struct {
 
 var _ Listener = &server{}
 
+// serverState is the part of a server that is independent of the net.PacketConn it listens on.
+// The Listeners created by ListenAddrShards share a serverState,
+// such that the limits apply to all of them, and they accept each other's cookies.
+type serverState struct {
+	certChain       crypto.CertChain
+	scfg            *handshake.ServerConfig
+	chloQueue       *handshake.CHLOQueue
+	cookieGenerator *handshake.CookieGenerator // used for the cookies sent in the TLS Retry
+	cookieProtector mint.CookieProtector       // used by mint for the cookies sent in the HelloRetryRequest
+	sourceLimiter   *sourceLimiter
+}
+
+// newServerState creates a new serverState. The config must be populated.
+func newServerState(tlsConf *tls.Config, config *Config) (*serverState, error) {
+	certChain := crypto.NewCertChain(tlsConf)
+	kex, err := crypto.NewCurve25519KEX()
+	if err != nil {
+		return nil, err
+	}
+	scfg, err := handshake.NewServerConfig(kex, certChain)
+	if err != nil {
+		return nil, err
+	}
+	chloQueue := handshake.NewCHLOQueue(maxProcessedClientHellos(config), protocol.MaxQueuedClientHellos, protocol.MaxClientHelloQueueTime)
+	scfg.SetCHLOQueue(chloQueue)
+	cookieGenerator, err := handshake.NewCookieGenerator()
+	if err != nil {
+		return nil, err
+	}
+	cookieProtector, err := mint.NewDefaultCookieProtector()
+	if err != nil {
+		return nil, err
+	}
+	return &serverState{
+		certChain:       certChain,
+		scfg:            scfg,
+		chloQueue:       chloQueue,
+		cookieGenerator: cookieGenerator,
+		cookieProtector: cookieProtector,
+		sourceLimiter:   newSourceLimiter(),
+	}, nil
+}
+
 // ListenAddr creates a QUIC server listening on a given address.
 // The tls.Config must not be nil, the quic.Config may be nil.
 func ListenAddr(addr string, tlsConf *tls.Config, config *Config) (Listener, error) {
@@ -92,18 +172,48 @@ func ListenAddr(addr string, tlsConf *tls.Config, config *Config) (Listener, err
 }
 
 // Listen listens for QUIC connections on a given net.PacketConn.
+// The net.PacketConn is provided by the caller, e.g. a socket with custom options, or an in-memory connection for testing.
+// The Listener takes ownership of it: it is closed when the Listener is closed.
 // The tls.Config must not be nil, the quic.Config may be nil.
 func Listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (Listener, error) {
-	certChain := crypto.NewCertChain(tlsConf)
-	kex, err := crypto.NewCurve25519KEX()
+	s, err := newServer(conn, tlsConf, config, nil)
 	if err != nil {
 		return nil, err
 	}
-	scfg, err := handshake.NewServerConfig(kex, certChain)
-	if err != nil {
+	setSocketBuffers(conn, s.config)
+	go s.serve()
+	s.logger.Debugf("Listening for %s connections on %s", conn.LocalAddr().Network(), conn.LocalAddr().String())
+	return s, nil
+}
+
+// newServer creates a new server.
+// It doesn't start reading from the net.PacketConn.
+// If state is nil, a new serverState is created.
+func newServer(conn net.PacketConn, tlsConf *tls.Config, config *Config, state *serverState) (*server, error) {
+	config = populateServerConfig(config)
+	if err := checkConnectionIDConfig(config); err != nil {
 		return nil, err
 	}
-	config = populateServerConfig(config)
+	if err := checkDSCP(config.DSCP); err != nil {
+		return nil, err
+	}
+	if err := checkAcceptedVersions(config); err != nil {
+		return nil, err
+	}
+	if state == nil {
+		var err error
+		state, err = newServerState(tlsConf, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.StatelessResetKey == nil {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		config.StatelessResetKey = key
+	}
 
 	var supportsTLS bool
 	for _, v := range config.Versions {
@@ -118,17 +228,21 @@ func Listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (Listener,
 	}
 
 	s := &server{
-		conn:           conn,
-		tlsConf:        tlsConf,
-		config:         config,
-		certChain:      certChain,
-		scfg:           scfg,
-		newSession:     newSession,
-		sessionHandler: newSessionMap(),
-		sessionQueue:   make(chan Session, 5),
-		errorChan:      make(chan struct{}),
-		supportsTLS:    supportsTLS,
-		logger:         utils.DefaultLogger.WithPrefix("server"),
+		conn:            wrapConn(conn),
+		tlsConf:         tlsConf,
+		config:          config,
+		certChain:       state.certChain,
+		scfg:            state.scfg,
+		chloQueue:       state.chloQueue,
+		cookieGenerator: state.cookieGenerator,
+		cookieProtector: state.cookieProtector,
+		newSession:      newSession,
+		sessionHandler:  newSessionMap(),
+		sourceLimiter:   state.sourceLimiter,
+		sessionQueue:    make(chan Session, 5),
+		errorChan:       make(chan struct{}),
+		supportsTLS:     supportsTLS,
+		logger:          utils.DefaultLogger.WithPrefix("server"),
 	}
 	s.setup()
 	if supportsTLS {
@@ -136,24 +250,33 @@ func Listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (Listener,
 			return nil, err
 		}
 	}
-	go s.serve()
-	s.logger.Debugf("Listening for %s connections on %s", conn.LocalAddr().Network(), conn.LocalAddr().String())
 	return s, nil
 }
 
 func (s *server) setup() {
 	s.sessionRunner = &runner{
-		onHandshakeCompleteImpl: func(sess packetHandler) { s.sessionQueue <- sess },
-		removeConnectionIDImpl:  s.sessionHandler.Remove,
+		onHandshakeCompleteImpl: func(sess packetHandler) {
+			s.sourceLimiter.HandshakeComplete(sess)
+			s.sessionQueue <- sess
+		},
+		addConnectionIDImpl:    s.sessionHandler.Add,
+		removeConnectionIDImpl: s.sessionHandler.Remove,
+		getStatelessResetTokenImpl: func(connID protocol.ConnectionID) [16]byte {
+			return getStatelessResetToken(s.getConfig().StatelessResetKey, connID)
+		},
+		// the server doesn't need to detect stateless resets sent by the client
+		addResetTokenImpl:    func([16]byte) {},
+		removeResetTokenImpl: func([16]byte) {},
 	}
 }
 
 func (s *server) setupTLS() error {
-	cookieHandler, err := handshake.NewCookieHandler(s.config.AcceptCookie, s.logger)
-	if err != nil {
-		return err
+	// look up the AcceptCookie callback for every cookie, so that it can be replaced by SetConfig
+	acceptCookie := func(clientAddr net.Addr, cookie *Cookie) bool {
+		return s.getConfig().AcceptCookie(clientAddr, cookie)
 	}
-	serverTLS, sessionChan, err := newServerTLS(s.conn, s.config, s.sessionRunner, cookieHandler, s.tlsConf, s.logger)
+	cookieHandler := handshake.NewCookieHandlerWithGenerator(acceptCookie, s.cookieGenerator, s.logger)
+	serverTLS, sessionChan, err := newServerTLS(s.conn, s.config, s.sessionRunner, cookieHandler, s.cookieProtector, s.tlsConf, s.logger)
 	if err != nil {
 		return err
 	}
@@ -169,6 +292,7 @@ func (s *server) setupTLS() error {
 				// The connection ID is a randomly chosen 8 byte value.
 				// It is safe to assume that it doesn't collide with other randomly chosen values.
 				s.sessionHandler.Add(tlsSession.connID, sess)
+				s.trackSource(sess, tlsSession.reservation)
 				go sess.run()
 			}
 		}
@@ -183,13 +307,137 @@ var defaultAcceptCookie = func(clientAddr net.Addr, cookie *Cookie) bool {
 	if time.Now().After(cookie.SentTime.Add(protocol.CookieExpiryTime)) {
 		return false
 	}
-	var sourceAddr string
 	if udpAddr, ok := clientAddr.(*net.UDPAddr); ok {
-		sourceAddr = udpAddr.IP.String()
-	} else {
-		sourceAddr = clientAddr.String()
+		// net.IP.Equal treats an IPv4 address and its IPv4-mapped IPv6 form as equal
+		return udpAddr.IP.Equal(net.ParseIP(cookie.RemoteAddr))
+	}
+	return clientAddr.String() == cookie.RemoteAddr
+}
+
+// acceptCookieAcrossAddressFamilies is used if Config.AcceptCookieAcrossAddressFamilies is set.
+// In addition to the cookies accepted by the defaultAcceptCookie,
+// it accepts cookies that were issued for an address of the other address family,
+// if the IPv6 address embeds the IPv4 address (see embeddedIPv4).
+var acceptCookieAcrossAddressFamilies = func(clientAddr net.Addr, cookie *Cookie) bool {
+	if defaultAcceptCookie(clientAddr, cookie) {
+		return true
+	}
+	if cookie == nil || time.Now().After(cookie.SentTime.Add(protocol.CookieExpiryTime)) {
+		return false
+	}
+	udpAddr, ok := clientAddr.(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+	cookieIP := net.ParseIP(cookie.RemoteAddr)
+	if cookieIP == nil {
+		return false
+	}
+	clientIPv4 := udpAddr.IP.To4()
+	if clientIPv4 == nil {
+		clientIPv4 = embeddedIPv4(udpAddr.IP)
+	}
+	cookieIPv4 := cookieIP.To4()
+	if cookieIPv4 == nil {
+		cookieIPv4 = embeddedIPv4(cookieIP)
+	}
+	return clientIPv4 != nil && clientIPv4.Equal(cookieIPv4)
+}
+
+// the well-known prefix used by NAT64, see RFC 6052
+var nat64Prefix = net.IP{0x0, 0x64, 0xff, 0x9b, 0, 0, 0, 0, 0, 0, 0, 0}
+
+// embeddedIPv4 returns the IPv4 address embedded in an IPv6 address of a dual-stack client.
+// This is the case for NAT64 addresses using the well-known prefix (64:ff9b::/96), and for 6to4 addresses (2002::/16).
+// It returns nil if the address doesn't embed an IPv4 address.
+func embeddedIPv4(ip net.IP) net.IP {
+	if len(ip) != net.IPv6len {
+		return nil
+	}
+	if bytes.Equal(ip[:12], nat64Prefix) {
+		return net.IPv4(ip[12], ip[13], ip[14], ip[15])
+	}
+	if ip[0] == 0x20 && ip[1] == 0x02 {
+		return net.IPv4(ip[2], ip[3], ip[4], ip[5])
+	}
+	return nil
+}
+
+// requireCookie wraps an AcceptCookie callback, such that clients that didn't present a Cookie are rejected
+func requireCookie(acceptCookie func(net.Addr, *Cookie) bool) func(net.Addr, *Cookie) bool {
+	return func(clientAddr net.Addr, cookie *Cookie) bool {
+		return cookie != nil && acceptCookie(clientAddr, cookie)
+	}
+}
+
+// admitConnection applies the AcceptConnection callback of a (populated) quic.Config to a new connection.
+// It returns the config that should be used for the connection, and false if the packet should be dropped.
+func admitConnection(config *Config, remoteAddr net.Addr, info *ClientHelloInfo) (*Config, bool) {
+	if config.AcceptConnection == nil {
+		return config, true
+	}
+	switch config.AcceptConnection(remoteAddr, info) {
+	case AcceptDecisionDrop:
+		return nil, false
+	case AcceptDecisionRequireCookie:
+		if config.RequireCookie {
+			return config, true
+		}
+		c := *config
+		c.RequireCookie = true
+		c.AcceptCookie = requireCookie(config.AcceptCookie)
+		return &c, true
+	default:
+		return config, true
+	}
+}
+
+// chooseCongestionControl applies the ChooseCongestionControl callback of a (populated) quic.Config to a new connection.
+// It returns the config that should be used for the connection.
+func chooseCongestionControl(config *Config, remoteAddr net.Addr, info *ClientHelloInfo) *Config {
+	if config.ChooseCongestionControl == nil {
+		return config
+	}
+	c := *config
+	c.CongestionControl = config.ChooseCongestionControl(remoteAddr, info)
+	return &c
+}
+
+// checkAcceptedVersions checks that the accepted versions of a (populated) quic.Config are a subset of its versions
+func checkAcceptedVersions(config *Config) error {
+	for _, v := range config.AcceptedVersions {
+		if !protocol.IsSupportedVersion(config.Versions, v) {
+			return fmt.Errorf("accepted version %s is not supported", v)
+		}
+	}
+	return nil
+}
+
+// checkConnectionIDConfig checks the connection ID options of a (populated) quic.Config
+func checkConnectionIDConfig(config *Config) error {
+	if config.ConnectionIDLength < protocol.MinConnectionIDLen || config.ConnectionIDLength > protocol.MaxConnectionIDLen {
+		return fmt.Errorf("invalid connection ID length: %d bytes", config.ConnectionIDLength)
+	}
+	if config.ConnectionIDCount < 1 || config.ConnectionIDCount > protocol.MaxActiveConnectionIDs {
+		return fmt.Errorf("invalid connection ID count: %d", config.ConnectionIDCount)
+	}
+	return nil
+}
+
+// checkDSCP checks that a DSCP fits into the 6 bits of the DS field
+func checkDSCP(dscp uint8) error {
+	if dscp > protocol.MaxDSCP {
+		return fmt.Errorf("invalid DSCP: %d", dscp)
+	}
+	return nil
+}
+
+// maxProcessedClientHellos returns the number of Client Hellos that are processed concurrently
+func maxProcessedClientHellos(config *Config) int {
+	if config.MaxConcurrentClientHellos < 0 {
+		return math.MaxInt32
 	}
-	return sourceAddr == cookie.RemoteAddr
+	return config.MaxConcurrentClientHellos
 }
 
 // populateServerConfig populates fields in the quic.Config with their default values, if none are set
@@ -202,20 +450,58 @@ func populateServerConfig(config *Config) *Config {
 	if len(versions) == 0 {
 		versions = protocol.SupportedVersions
 	}
+	acceptedVersions := config.AcceptedVersions
+	if len(acceptedVersions) == 0 {
+		acceptedVersions = versions
+	}
 
 	vsa := defaultAcceptCookie
+	if config.AcceptCookieAcrossAddressFamilies {
+		vsa = acceptCookieAcrossAddressFamilies
+	}
 	if config.AcceptCookie != nil {
 		vsa = config.AcceptCookie
 	}
+	if config.RequireCookie {
+		vsa = requireCookie(vsa)
+	}
 
 	handshakeTimeout := protocol.DefaultHandshakeTimeout
 	if config.HandshakeTimeout != 0 {
 		handshakeTimeout = config.HandshakeTimeout
 	}
+	maxConcurrentClientHellos := config.MaxConcurrentClientHellos
+	if maxConcurrentClientHellos == 0 {
+		maxConcurrentClientHellos = runtime.NumCPU()
+	}
+	handshakeRetransmissionBackoff := config.HandshakeRetransmissionBackoff
+	if handshakeRetransmissionBackoff < 1 {
+		handshakeRetransmissionBackoff = protocol.DefaultHandshakeRetransmissionBackoff
+	}
 	idleTimeout := protocol.DefaultIdleTimeout
 	if config.IdleTimeout != 0 {
 		idleTimeout = config.IdleTimeout
 	}
+	connIDLen := config.ConnectionIDLength
+	if connIDLen == 0 {
+		connIDLen = protocol.ConnectionIDLen
+	}
+	connIDCount := config.ConnectionIDCount
+	if connIDCount == 0 {
+		connIDCount = 1
+	}
+	pathValidationTimeout := protocol.DefaultPathValidationTimeout
+	if config.PathValidationTimeout != 0 {
+		pathValidationTimeout = config.PathValidationTimeout
+	}
+	maxPathValidationProbes := protocol.DefaultMaxPathValidationProbes
+	if config.MaxPathValidationProbes != 0 {
+		maxPathValidationProbes = config.MaxPathValidationProbes
+	}
+	sendCoalescingDelay := config.SendCoalescingDelay
+	if sendCoalescingDelay > protocol.MaxSendCoalescingDelay {
+		sendCoalescingDelay = protocol.MaxSendCoalescingDelay
+	}
 
 	maxReceiveStreamFlowControlWindow := config.MaxReceiveStreamFlowControlWindow
 	if maxReceiveStreamFlowControlWindow == 0 {
@@ -225,6 +511,55 @@ func populateServerConfig(config *Config) *Config {
 	if maxReceiveConnectionFlowControlWindow == 0 {
 		maxReceiveConnectionFlowControlWindow = protocol.DefaultMaxReceiveConnectionFlowControlWindowServer
 	}
+	initialReceiveStreamFlowControlWindow := config.InitialReceiveStreamFlowControlWindow
+	if initialReceiveStreamFlowControlWindow == 0 {
+		initialReceiveStreamFlowControlWindow = protocol.ReceiveStreamFlowControlWindow
+	}
+	if initialReceiveStreamFlowControlWindow > maxReceiveStreamFlowControlWindow {
+		initialReceiveStreamFlowControlWindow = maxReceiveStreamFlowControlWindow
+	}
+	initialReceiveConnectionFlowControlWindow := config.InitialReceiveConnectionFlowControlWindow
+	if initialReceiveConnectionFlowControlWindow == 0 {
+		initialReceiveConnectionFlowControlWindow = protocol.ReceiveConnectionFlowControlWindow
+	}
+	if initialReceiveConnectionFlowControlWindow > maxReceiveConnectionFlowControlWindow {
+		initialReceiveConnectionFlowControlWindow = maxReceiveConnectionFlowControlWindow
+	}
+	maxStreamReassemblyBuffer := config.MaxStreamReassemblyBuffer
+	if maxStreamReassemblyBuffer == 0 {
+		maxStreamReassemblyBuffer = maxReceiveStreamFlowControlWindow
+	}
+	maxConnectionReassemblyBuffer := config.MaxConnectionReassemblyBuffer
+	if maxConnectionReassemblyBuffer == 0 {
+		maxConnectionReassemblyBuffer = maxReceiveConnectionFlowControlWindow
+	}
+	maxUndecryptablePackets := config.MaxUndecryptablePackets
+	if maxUndecryptablePackets <= 0 {
+		maxUndecryptablePackets = protocol.DefaultMaxUndecryptablePackets
+	}
+	maxUndecryptablePacketBytes := config.MaxUndecryptablePacketBytes
+	if maxUndecryptablePacketBytes == 0 {
+		maxUndecryptablePacketBytes = uint64(maxUndecryptablePackets) * uint64(protocol.MaxReceivePacketSize)
+	}
+	maxTransientWriteErrors := config.MaxTransientWriteErrors
+	if maxTransientWriteErrors == 0 {
+		maxTransientWriteErrors = protocol.DefaultMaxTransientWriteErrors
+	} else if maxTransientWriteErrors < 0 {
+		maxTransientWriteErrors = 0
+	}
+	maxReasonPhraseLength := config.MaxReasonPhraseLength
+	if maxReasonPhraseLength <= 0 {
+		maxReasonPhraseLength = protocol.DefaultMaxReasonPhraseLength
+	}
+	sourcePrefixLengthIPv4 := config.SourcePrefixLengthIPv4
+	if sourcePrefixLengthIPv4 <= 0 || sourcePrefixLengthIPv4 > 8*net.IPv4len {
+		sourcePrefixLengthIPv4 = protocol.DefaultSourcePrefixLengthIPv4
+	}
+	sourcePrefixLengthIPv6 := config.SourcePrefixLengthIPv6
+	if sourcePrefixLengthIPv6 <= 0 || sourcePrefixLengthIPv6 > 8*net.IPv6len {
+		sourcePrefixLengthIPv6 = protocol.DefaultSourcePrefixLengthIPv6
+	}
+	initialPacketSize, maxPacketSize := getPacketSizes(config.InitialPacketSize, config.MaxPacketSize)
 	maxIncomingStreams := config.MaxIncomingStreams
 	if maxIncomingStreams == 0 {
 		maxIncomingStreams = protocol.DefaultMaxIncomingStreams
@@ -239,34 +574,80 @@ func populateServerConfig(config *Config) *Config {
 	}
 
 	return &Config{
-		Versions:                              versions,
-		HandshakeTimeout:                      handshakeTimeout,
-		IdleTimeout:                           idleTimeout,
-		AcceptCookie:                          vsa,
-		KeepAlive:                             config.KeepAlive,
-		MaxReceiveStreamFlowControlWindow:     maxReceiveStreamFlowControlWindow,
-		MaxReceiveConnectionFlowControlWindow: maxReceiveConnectionFlowControlWindow,
-		MaxIncomingStreams:                    maxIncomingStreams,
-		MaxIncomingUniStreams:                 maxIncomingUniStreams,
+		Versions:                                  versions,
+		AcceptedVersions:                          acceptedVersions,
+		HandshakeTimeout:                          handshakeTimeout,
+		HandshakeRetransmissionTimeout:            config.HandshakeRetransmissionTimeout,
+		HandshakeRetransmissionBackoff:            handshakeRetransmissionBackoff,
+		MaxHandshakeRetransmissions:               config.MaxHandshakeRetransmissions,
+		IdleTimeout:                               idleTimeout,
+		ConnectionIDLength:                        connIDLen,
+		ConnectionIDCount:                         connIDCount,
+		PathValidationTimeout:                     pathValidationTimeout,
+		MaxPathValidationProbes:                   maxPathValidationProbes,
+		AcceptCookie:                              vsa,
+		AcceptCookieAcrossAddressFamilies:         config.AcceptCookieAcrossAddressFamilies,
+		RequireCookie:                             config.RequireCookie,
+		AcceptConnection:                          config.AcceptConnection,
+		MaxHandshakesPerSource:                    config.MaxHandshakesPerSource,
+		MaxSessionsPerSource:                      config.MaxSessionsPerSource,
+		SourceLimits:                              config.SourceLimits,
+		SourcePrefixLengthIPv4:                    sourcePrefixLengthIPv4,
+		SourcePrefixLengthIPv6:                    sourcePrefixLengthIPv6,
+		StatelessResetKey:                         config.StatelessResetKey,
+		KeepAlive:                                 config.KeepAlive,
+		KeepAlivePeriod:                           config.KeepAlivePeriod,
+		SendCoalescingDelay:                       sendCoalescingDelay,
+		CongestionWindowDecay:                     config.CongestionWindowDecay,
+		Features:                                  config.Features,
+		UnknownFrames:                             config.UnknownFrames,
+		OnClose:                                   config.OnClose,
+		OnStreamCompleted:                         config.OnStreamCompleted,
+		OnInvariantViolation:                      config.OnInvariantViolation,
+		LimitReceiveWindowGrowth:                  config.LimitReceiveWindowGrowth,
+		ReceiveBufferSize:                         getSocketBufferSize(config.ReceiveBufferSize),
+		SendBufferSize:                            getSocketBufferSize(config.SendBufferSize),
+		OnSocketBufferWarning:                     config.OnSocketBufferWarning,
+		MaxConcurrentClientHellos:                 maxConcurrentClientHellos,
+		DisablePathMTUDiscovery:                   config.DisablePathMTUDiscovery,
+		InitialPacketSize:                         initialPacketSize,
+		MaxPacketSize:                             maxPacketSize,
+		InitialReceiveStreamFlowControlWindow:     initialReceiveStreamFlowControlWindow,
+		InitialReceiveConnectionFlowControlWindow: initialReceiveConnectionFlowControlWindow,
+		MaxReceiveStreamFlowControlWindow:         maxReceiveStreamFlowControlWindow,
+		MaxReceiveConnectionFlowControlWindow:     maxReceiveConnectionFlowControlWindow,
+		MaxStreamReassemblyBuffer:                 maxStreamReassemblyBuffer,
+		MaxConnectionReassemblyBuffer:             maxConnectionReassemblyBuffer,
+		MaxUndecryptablePackets:                   maxUndecryptablePackets,
+		MaxUndecryptablePacketBytes:               maxUndecryptablePacketBytes,
+		MaxTransientWriteErrors:                   maxTransientWriteErrors,
+		MaxReasonPhraseLength:                     maxReasonPhraseLength,
+		MaxIncomingStreams:                        maxIncomingStreams,
+		MaxIncomingUniStreams:                     maxIncomingUniStreams,
+		EnableECN:                                 config.EnableECN,
+		DSCP:                                      config.DSCP,
+		TTL:                                       config.TTL,
+		CongestionControl:                         config.CongestionControl,
+		ChooseCongestionControl:                   config.ChooseCongestionControl,
+		AckPolicy:                                 config.AckPolicy,
+		PeerAckPolicy:                             config.PeerAckPolicy,
+		StreamCoalescing:                          config.StreamCoalescing,
+		Padding:                                   config.Padding,
 	}
 }
 
 // serve listens on an existing PacketConn
 func (s *server) serve() {
+	r := newPacketReader(s.conn)
 	for {
-		data := *getPacketBuffer()
-		data = data[:protocol.MaxReceivePacketSize]
-		// The packet size should not exceed protocol.MaxReceivePacketSize bytes
-		// If it does, we only read a truncated packet, which will then end up undecryptable
-		n, remoteAddr, err := s.conn.ReadFrom(data)
+		buf, remoteAddr, info, err := r.ReadPacket()
 		if err != nil {
 			s.serverError = err
 			close(s.errorChan)
 			_ = s.Close()
 			return
 		}
-		data = data[:n]
-		if err := s.handlePacket(remoteAddr, data); err != nil {
+		if err := s.handlePacket(remoteAddr, *buf, buf, info); err != nil {
 			s.logger.Errorf("error handling packet: %s", err.Error())
 		}
 	}
@@ -274,163 +655,359 @@ func (s *server) serve() {
 
 // Accept returns newly openend sessions
 func (s *server) Accept() (Session, error) {
+	return s.AcceptContext(context.Background())
+}
+
+// AcceptContext returns newly openend sessions, or the context's error if the context expires first
+func (s *server) AcceptContext(ctx context.Context) (Session, error) {
 	var sess Session
 	select {
 	case sess = <-s.sessionQueue:
 		return sess, nil
 	case <-s.errorChan:
 		return nil, s.serverError
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
 // Close the server
 func (s *server) Close() error {
+	if s.transport != nil {
+		s.transport.removeListener(s)
+		s.closeWithError(nil)
+		return nil
+	}
 	s.sessionHandler.Close()
 	err := s.conn.Close()
 	<-s.errorChan // wait for serve() to return
 	return err
 }
 
+// closeWithError closes a server that uses a Transport.
+// The net.PacketConn is owned by the Transport, so it is not closed.
+// A nil error means that the server was closed by the application.
+func (s *server) closeWithError(err error) {
+	if err == nil {
+		err = errListenerClosed
+	}
+	s.closeOnce.Do(func() {
+		s.sessionHandler.Close()
+		s.serverError = err
+		close(s.errorChan)
+	})
+}
+
+// SetConfig replaces the quic.Config used for new sessions
+func (s *server) SetConfig(config *Config) error {
+	s.configMutex.Lock()
+	defer s.configMutex.Unlock()
+
+	newConfig := populateServerConfig(config)
+	if config == nil || len(config.Versions) == 0 {
+		newConfig.Versions = s.config.Versions
+	} else if !sameVersions(newConfig.Versions, s.config.Versions) {
+		return errors.New("the QUIC versions of a Listener can't be changed")
+	}
+	if config == nil || len(config.AcceptedVersions) == 0 {
+		newConfig.AcceptedVersions = newConfig.Versions
+	}
+	if err := checkAcceptedVersions(newConfig); err != nil {
+		return err
+	}
+	if config == nil || config.ConnectionIDLength == 0 {
+		newConfig.ConnectionIDLength = s.config.ConnectionIDLength
+	} else if newConfig.ConnectionIDLength != s.config.ConnectionIDLength {
+		return errors.New("the connection ID length of a Listener can't be changed")
+	}
+	// the stateless reset tokens of existing sessions were derived from this key
+	if config == nil || config.StatelessResetKey == nil {
+		newConfig.StatelessResetKey = s.config.StatelessResetKey
+	} else if !bytes.Equal(newConfig.StatelessResetKey, s.config.StatelessResetKey) {
+		return errors.New("the stateless reset key of a Listener can't be changed")
+	}
+	if err := checkConnectionIDConfig(newConfig); err != nil {
+		return err
+	}
+	if err := checkDSCP(newConfig.DSCP); err != nil {
+		return err
+	}
+	s.config = newConfig
+	s.chloQueue.SetMaxProcessing(maxProcessedClientHellos(newConfig))
+	if s.serverTLS != nil {
+		s.serverTLS.setConfig(newConfig)
+	}
+	return nil
+}
+
+func (s *server) getConfig() *Config {
+	s.configMutex.RLock()
+	defer s.configMutex.RUnlock()
+	return s.config
+}
+
+func sameVersions(a, b []protocol.VersionNumber) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // Addr returns the server's network address
 func (s *server) Addr() net.Addr {
 	return s.conn.LocalAddr()
 }
 
-func (s *server) handlePacket(remoteAddr net.Addr, packet []byte) error {
-	rcvTime := time.Now()
+// handlePacket handles a packet received on the server's net.PacketConn.
+// The buffer is the buffer from the buffer pool that backs the packet, if any.
+// It is returned to the pool, unless the packet is passed on to a session.
+func (s *server) handlePacket(remoteAddr net.Addr, packet []byte, buffer *[]byte, info packetInfo) error {
+	p := &receivedPacket{
+		remoteAddr: remoteAddr,
+		rcvTime:    time.Now(),
+		ecn:        info.ecn,
+		ttl:        info.ttl,
+		buffer:     buffer,
+	}
+	session, err := s.handlePacketImpl(p, packet, info)
+	if session == nil {
+		p.release()
+		return err
+	}
+	session.handlePacket(p)
+	return nil
+}
 
+// handlePacketImpl parses the header of a packet, and returns the session that the packet has to be passed to.
+func (s *server) handlePacketImpl(p *receivedPacket, packet []byte, info packetInfo) (packetHandler, error) {
 	r := bytes.NewReader(packet)
-	hdr, err := wire.ParseHeaderSentByClient(r)
+	hdr, err := wire.ParseHeaderSentByClient(r, s.getConfig().ConnectionIDLength)
 	if err != nil {
-		return qerr.Error(qerr.InvalidPacketHeader, err.Error())
+		return nil, qerr.Error(qerr.InvalidPacketHeader, err.Error())
 	}
 	hdr.Raw = packet[:len(packet)-r.Len()]
-	packetData := packet[len(packet)-r.Len():]
+	p.header = hdr
+	p.data = packet[len(packet)-r.Len():]
 
 	if hdr.IsPublicHeader {
-		return s.handleGQUICPacket(hdr, packetData, remoteAddr, rcvTime)
+		return s.handleGQUICPacket(p, info)
 	}
-	return s.handleIETFQUICPacket(hdr, packetData, remoteAddr, rcvTime)
+	return s.handleIETFQUICPacket(p, info)
 }
 
-func (s *server) handleIETFQUICPacket(hdr *wire.Header, packetData []byte, remoteAddr net.Addr, rcvTime time.Time) error {
+func (s *server) handleIETFQUICPacket(p *receivedPacket, info packetInfo) (packetHandler, error) {
+	hdr := p.header
+	packetData := p.data
+	remoteAddr := p.remoteAddr
 	if hdr.IsLongHeader {
 		if !s.supportsTLS {
-			return errors.New("Received an IETF QUIC Long Header")
+			return nil, errors.New("Received an IETF QUIC Long Header")
 		}
 		if protocol.ByteCount(len(packetData)) < hdr.PayloadLen {
-			return fmt.Errorf("packet payload (%d bytes) is smaller than the expected payload length (%d bytes)", len(packetData), hdr.PayloadLen)
+			return nil, fmt.Errorf("packet payload (%d bytes) is smaller than the expected payload length (%d bytes)", len(packetData), hdr.PayloadLen)
 		}
 		packetData = packetData[:int(hdr.PayloadLen)]
+		p.data = packetData
 		// TODO(#1312): implement parsing of compound packets
 
 		switch hdr.Type {
 		case protocol.PacketTypeInitial:
-			go s.serverTLS.HandleInitial(remoteAddr, hdr, packetData)
-			return nil
+			config := s.getConfig()
+			reservation, ok := s.reserveSource(remoteAddr, config)
+			if !ok {
+				s.logger.Debugf("Dropping Initial packet from %s: too many sessions from this source.", remoteAddr)
+				return nil, nil
+			}
+			config, ok = admitConnection(config, remoteAddr, &ClientHelloInfo{
+				Version:    hdr.Version,
+				PacketSize: len(hdr.Raw) + len(packetData),
+			})
+			if !ok {
+				s.sourceLimiter.Release(reservation)
+				s.logger.Debugf("Dropping Initial packet from %s: connection rejected.", remoteAddr)
+				return nil, nil
+			}
+			// The Initial is handled on a separate Go routine, so the buffer can't be reused.
+			p.buffer = nil
+			go func() {
+				// If a session is created, the reservation is attached to it when it is received from the sessionChan.
+				if !s.serverTLS.HandleInitial(remoteAddr, info.replyInfo(), hdr, packetData, config.RequireCookie, reservation) {
+					s.sourceLimiter.Release(reservation)
+				}
+			}()
+			return nil, nil
 		case protocol.PacketTypeHandshake:
 			// nothing to do here. Packet will be passed to the session.
 		default:
 			// Note that this also drops 0-RTT packets.
-			return fmt.Errorf("Received unsupported packet type: %s", hdr.Type)
+			return nil, fmt.Errorf("Received unsupported packet type: %s", hdr.Type)
 		}
 	}
 
-	session, sessionKnown := s.sessionHandler.Get(hdr.DestConnectionID)
+	session, sessionKnown := s.getSession(hdr.DestConnectionID)
 	if sessionKnown && session == nil {
 		// Late packet for closed session
-		return nil
+		return nil, nil
 	}
 	if !sessionKnown {
+		// We don't have any state for this connection, e.g. because the server was restarted.
+		// Tell the client by sending a Stateless Reset.
+		if !hdr.IsLongHeader {
+			return nil, s.sendStatelessReset(hdr, len(hdr.Raw)+len(packetData), remoteAddr, info)
+		}
 		s.logger.Debugf("Received %s packet for unknown connection %s.", hdr.Type, hdr.DestConnectionID)
-		return nil
+		return nil, nil
 	}
+	return session, nil
+}
 
-	session.handlePacket(&receivedPacket{
-		remoteAddr: remoteAddr,
-		header:     hdr,
-		data:       packetData,
-		rcvTime:    rcvTime,
-	})
-	return nil
+// getSession looks up the session for a connection ID.
+// If the server is one of the Listeners created by ListenAddrShards, the sessions of the other Listeners are looked up as well,
+// since packets can arrive at the wrong Listener when the address of the client changes.
+func (s *server) getSession(connID protocol.ConnectionID) (packetHandler, bool) {
+	session, sessionKnown := s.sessionHandler.Get(connID)
+	if sessionKnown || s.shards == nil {
+		return session, sessionKnown
+	}
+	session, sessionKnown = s.shards.getSession(s, connID)
+	if session != nil {
+		s.logger.Debugf("Passing packet for connection %s to the Listener that owns the session.", connID)
+	}
+	return session, sessionKnown
+}
+
+// reserveSource reserves a handshake for a new session from remoteAddr, if the Config limits the sessions per source.
+// It returns a nil reservation if it doesn't.
+func (s *server) reserveSource(remoteAddr net.Addr, config *Config) (*sourceReservation, bool) {
+	if !limitsSources(config) {
+		return nil, true
+	}
+	return s.sourceLimiter.Reserve(remoteAddr, config)
+}
+
+// trackSource counts the session towards the limits of its source, until it is closed.
+// It does nothing for a nil reservation.
+func (s *server) trackSource(sess packetHandler, reservation *sourceReservation) {
+	if reservation == nil {
+		return
+	}
+	s.sourceLimiter.Attach(reservation, sess)
+	go func() {
+		<-sess.Context().Done()
+		s.sourceLimiter.Remove(sess)
+	}()
+}
+
+func (s *server) sendStatelessReset(hdr *wire.Header, packetLen int, remoteAddr net.Addr, info packetInfo) error {
+	// Don't send a Stateless Reset in response to a packet that could itself be a Stateless Reset.
+	// Otherwise two endpoints might end up sending Stateless Resets back and forth.
+	if packetLen <= protocol.MinStatelessResetSize {
+		return nil
+	}
+	s.logger.Debugf("Received Short Header packet for unknown connection %s. Sending a Stateless Reset.", hdr.DestConnectionID)
+	data, err := wire.ComposeStatelessReset(getStatelessResetToken(s.getConfig().StatelessResetKey, hdr.DestConnectionID))
+	if err != nil {
+		return err
+	}
+	return writePacket(s.conn, data, remoteAddr, info.replyInfo())
 }
 
-func (s *server) handleGQUICPacket(hdr *wire.Header, packetData []byte, remoteAddr net.Addr, rcvTime time.Time) error {
+func (s *server) handleGQUICPacket(p *receivedPacket, info packetInfo) (packetHandler, error) {
+	hdr := p.header
+	packetData := p.data
+	remoteAddr := p.remoteAddr
+	config := s.getConfig()
+
 	// ignore all Public Reset packets
 	if hdr.ResetFlag {
 		s.logger.Infof("Received unexpected Public Reset for connection %s.", hdr.DestConnectionID)
-		return nil
+		return nil, nil
 	}
 
-	session, sessionKnown := s.sessionHandler.Get(hdr.DestConnectionID)
+	session, sessionKnown := s.getSession(hdr.DestConnectionID)
 	if sessionKnown && session == nil {
 		// Late packet for closed session
-		return nil
+		return nil, nil
 	}
 
 	// If we don't have a session for this connection, and this packet cannot open a new connection, send a Public Reset
 	// This should only happen after a server restart, when we still receive packets for connections that we lost the state for.
 	if !sessionKnown && !hdr.VersionFlag {
-		_, err := s.conn.WriteTo(wire.WritePublicReset(hdr.DestConnectionID, 0, 0), remoteAddr)
-		return err
+		return nil, writePacket(s.conn, wire.WritePublicReset(hdr.DestConnectionID, 0, 0), remoteAddr, info.replyInfo())
 	}
 
 	// a session is only created once the client sent a supported version
 	// if we receive a packet for a connection that already has session, it's probably an old packet that was sent by the client before the version was negotiated
 	// it is safe to drop it
-	if sessionKnown && hdr.VersionFlag && !protocol.IsSupportedVersion(s.config.Versions, hdr.Version) {
-		return nil
+	if sessionKnown && hdr.VersionFlag && !protocol.IsSupportedVersion(config.Versions, hdr.Version) {
+		return nil, nil
 	}
 
-	// send a Version Negotiation Packet if the client is speaking a different protocol version
+	// send a Version Negotiation Packet if the client is speaking a different protocol version,
+	// or a version that new connections are not accepted for
 	// since the client send a Public Header (only gQUIC has a Version Flag), we need to send a gQUIC Version Negotiation Packet
-	if hdr.VersionFlag && !protocol.IsSupportedVersion(s.config.Versions, hdr.Version) {
+	if !sessionKnown && hdr.VersionFlag && !protocol.IsSupportedVersion(config.AcceptedVersions, hdr.Version) {
 		// drop packets that are too small to be valid first packets
 		if len(packetData) < protocol.MinClientHelloSize {
-			return errors.New("dropping small packet with unknown version")
+			return nil, errors.New("dropping small packet with unknown version")
 		}
 		s.logger.Infof("Client offered version %s, sending Version Negotiation Packet", hdr.Version)
-		_, err := s.conn.WriteTo(wire.ComposeGQUICVersionNegotiation(hdr.SrcConnectionID, s.config.Versions), remoteAddr)
-		return err
+		return nil, writePacket(s.conn, wire.ComposeGQUICVersionNegotiation(hdr.SrcConnectionID, config.AcceptedVersions), remoteAddr, info.replyInfo())
 	}
 
 	if !sessionKnown {
 		// This is (potentially) a Client Hello.
 		// Make sure it has the minimum required size before spending any more ressources on it.
 		if len(packetData) < protocol.MinClientHelloSize {
-			return errors.New("dropping small packet for unknown connection")
+			return nil, errors.New("dropping small packet for unknown connection")
 		}
 
 		version := hdr.Version
-		if !protocol.IsSupportedVersion(s.config.Versions, version) {
-			return errors.New("Server BUG: negotiated version not supported")
+		if !protocol.IsSupportedVersion(config.AcceptedVersions, version) {
+			return nil, errors.New("Server BUG: negotiated version not supported")
+		}
+		reservation, ok := s.reserveSource(remoteAddr, config)
+		if !ok {
+			s.logger.Debugf("Dropping Client Hello from %s: too many sessions from this source.", remoteAddr)
+			return nil, nil
+		}
+		helloInfo := &ClientHelloInfo{
+			Version:    version,
+			PacketSize: len(hdr.Raw) + len(packetData),
 		}
+		config, ok = admitConnection(config, remoteAddr, helloInfo)
+		if !ok {
+			s.sourceLimiter.Release(reservation)
+			s.logger.Debugf("Dropping Client Hello from %s: connection rejected.", remoteAddr)
+			return nil, nil
+		}
+		config = chooseCongestionControl(config, remoteAddr, helloInfo)
 
 		s.logger.Infof("Serving new connection: %s, version %s from %v", hdr.DestConnectionID, version, remoteAddr)
 		var err error
 		session, err = s.newSession(
-			&conn{pconn: s.conn, currentAddr: remoteAddr},
+			&conn{pconn: s.conn, currentAddr: remoteAddr, info: info.replyInfo()},
 			s.sessionRunner,
 			version,
 			hdr.DestConnectionID,
 			s.scfg,
 			s.tlsConf,
-			s.config,
+			config,
 			s.logger,
 		)
 		if err != nil {
-			return err
+			s.sourceLimiter.Release(reservation)
+			return nil, err
 		}
 		s.sessionHandler.Add(hdr.DestConnectionID, session)
+		s.trackSource(session, reservation)
 
 		go session.run()
 	}
-
-	session.handlePacket(&receivedPacket{
-		remoteAddr: remoteAddr,
-		header:     hdr,
-		data:       packetData,
-		rcvTime:    rcvTime,
-	})
-	return nil
+	return session, nil
 }
@@ -2,10 +2,13 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
+	"math"
 	"net"
 	"reflect"
+	"runtime"
 	"time"
 
 	"github.com/golang/mock/gomock"
@@ -27,6 +30,10 @@ type mockSession struct {
 	runner sessionRunner
 }
 
+// getPacketInfo returns the packetInfo that a connection uses for sending packets.
+// It is defined here, since the Server tests shadow the conn type.
+func getPacketInfo(c connection) packetInfo { return c.(*conn).info }
+
 var _ = Describe("Server", func() {
 	var (
 		conn    *mockPacketConn
@@ -37,17 +44,39 @@ var _ = Describe("Server", func() {
 	BeforeEach(func() {
 		conn = newMockPacketConn()
 		conn.addr = &net.UDPAddr{}
-		config = &Config{Versions: protocol.SupportedVersions}
+		config = &Config{
+			Versions:         protocol.SupportedVersions,
+			AcceptedVersions: protocol.SupportedVersions,
+		}
 	})
 
 	Context("quic.Config", func() {
 		It("setups with the right values", func() {
 			config := &Config{
-				HandshakeTimeout:            1337 * time.Minute,
-				IdleTimeout:                 42 * time.Hour,
-				RequestConnectionIDOmission: true,
-				MaxIncomingStreams:          1234,
-				MaxIncomingUniStreams:       4321,
+				HandshakeTimeout:               1337 * time.Minute,
+				IdleTimeout:                    42 * time.Hour,
+				RequestConnectionIDOmission:    true,
+				MaxIncomingStreams:             1234,
+				MaxIncomingUniStreams:          4321,
+				CongestionWindowDecay:          CongestionWindowDecayReset,
+				CongestionControl:              CongestionControlBBRv2,
+				UnknownFrames:                  UnknownFramesIgnore,
+				HandshakeRetransmissionTimeout: 3 * time.Second,
+				HandshakeRetransmissionBackoff: 1.5,
+				MaxHandshakeRetransmissions:    7,
+				PathValidationTimeout:          5 * time.Second,
+				MaxPathValidationProbes:        5,
+				ConnectionIDLength:             12,
+				ConnectionIDCount:              4,
+				StatelessResetKey:              []byte("foobar"),
+				Features:                       []Feature{FeatureAckFrequency},
+				EnableECN:                      true,
+				DSCP:                           46,
+				TTL:                            64,
+				AckPolicy:                      AckPolicy{PacketThreshold: 4},
+				PeerAckPolicy:                  &AckPolicy{PacketThreshold: 10},
+				StreamCoalescing:               StreamCoalescingNone,
+				Padding:                        PaddingHandshake,
 			}
 			c := populateServerConfig(config)
 			Expect(c.HandshakeTimeout).To(Equal(1337 * time.Minute))
@@ -55,6 +84,221 @@ var _ = Describe("Server", func() {
 			Expect(c.RequestConnectionIDOmission).To(BeFalse())
 			Expect(c.MaxIncomingStreams).To(Equal(1234))
 			Expect(c.MaxIncomingUniStreams).To(Equal(4321))
+			Expect(c.CongestionWindowDecay).To(Equal(CongestionWindowDecayReset))
+			Expect(c.CongestionControl).To(Equal(CongestionControlBBRv2))
+			Expect(c.UnknownFrames).To(Equal(UnknownFramesIgnore))
+			Expect(c.HandshakeRetransmissionTimeout).To(Equal(3 * time.Second))
+			Expect(c.HandshakeRetransmissionBackoff).To(Equal(1.5))
+			Expect(c.MaxHandshakeRetransmissions).To(Equal(7))
+			Expect(c.PathValidationTimeout).To(Equal(5 * time.Second))
+			Expect(c.MaxPathValidationProbes).To(Equal(5))
+			Expect(c.Features).To(Equal([]Feature{FeatureAckFrequency}))
+			Expect(c.EnableECN).To(BeTrue())
+			Expect(c.DSCP).To(BeEquivalentTo(46))
+			Expect(c.TTL).To(BeEquivalentTo(64))
+			Expect(c.ConnectionIDLength).To(Equal(12))
+			Expect(c.ConnectionIDCount).To(Equal(4))
+			Expect(c.StatelessResetKey).To(Equal([]byte("foobar")))
+			Expect(c.AckPolicy).To(Equal(AckPolicy{PacketThreshold: 4}))
+			Expect(c.PeerAckPolicy).To(Equal(&AckPolicy{PacketThreshold: 10}))
+			Expect(c.StreamCoalescing).To(Equal(StreamCoalescingNone))
+			Expect(c.Padding).To(Equal(PaddingHandshake))
+		})
+
+		It("sets the initial flow control windows", func() {
+			c := populateServerConfig(&Config{
+				InitialReceiveStreamFlowControlWindow:     1000,
+				InitialReceiveConnectionFlowControlWindow: 2000,
+			})
+			Expect(c.InitialReceiveStreamFlowControlWindow).To(BeEquivalentTo(1000))
+			Expect(c.InitialReceiveConnectionFlowControlWindow).To(BeEquivalentTo(2000))
+			c = populateServerConfig(&Config{})
+			Expect(c.InitialReceiveStreamFlowControlWindow).To(BeEquivalentTo(protocol.ReceiveStreamFlowControlWindow))
+			Expect(c.InitialReceiveConnectionFlowControlWindow).To(BeEquivalentTo(protocol.ReceiveConnectionFlowControlWindow))
+			Expect(c.MaxReceiveStreamFlowControlWindow).To(BeEquivalentTo(protocol.DefaultMaxReceiveStreamFlowControlWindowServer))
+			Expect(c.MaxReceiveConnectionFlowControlWindow).To(BeEquivalentTo(protocol.DefaultMaxReceiveConnectionFlowControlWindowServer))
+		})
+
+		It("limits the initial flow control windows to the maximum flow control windows", func() {
+			c := populateServerConfig(&Config{
+				InitialReceiveStreamFlowControlWindow:     1000,
+				MaxReceiveStreamFlowControlWindow:         500,
+				InitialReceiveConnectionFlowControlWindow: 2000,
+				MaxReceiveConnectionFlowControlWindow:     1500,
+			})
+			Expect(c.InitialReceiveStreamFlowControlWindow).To(BeEquivalentTo(500))
+			Expect(c.InitialReceiveConnectionFlowControlWindow).To(BeEquivalentTo(1500))
+		})
+
+		It("uses the default handshake retransmission backoff", func() {
+			c := populateServerConfig(&Config{})
+			Expect(c.HandshakeRetransmissionBackoff).To(BeEquivalentTo(protocol.DefaultHandshakeRetransmissionBackoff))
+			c = populateServerConfig(&Config{HandshakeRetransmissionBackoff: 0.5})
+			Expect(c.HandshakeRetransmissionBackoff).To(BeEquivalentTo(protocol.DefaultHandshakeRetransmissionBackoff))
+		})
+
+		It("uses the flow control windows as the default reassembly buffer sizes", func() {
+			c := populateServerConfig(&Config{
+				MaxReceiveStreamFlowControlWindow:     1000,
+				MaxReceiveConnectionFlowControlWindow: 2000,
+			})
+			Expect(c.MaxStreamReassemblyBuffer).To(BeEquivalentTo(1000))
+			Expect(c.MaxConnectionReassemblyBuffer).To(BeEquivalentTo(2000))
+			c = populateServerConfig(&Config{
+				MaxStreamReassemblyBuffer:     100,
+				MaxConnectionReassemblyBuffer: 200,
+			})
+			Expect(c.MaxStreamReassemblyBuffer).To(BeEquivalentTo(100))
+			Expect(c.MaxConnectionReassemblyBuffer).To(BeEquivalentTo(200))
+		})
+
+		It("sets the limits for undecryptable packets", func() {
+			c := populateServerConfig(&Config{})
+			Expect(c.MaxUndecryptablePackets).To(Equal(protocol.DefaultMaxUndecryptablePackets))
+			Expect(c.MaxUndecryptablePacketBytes).To(BeEquivalentTo(protocol.DefaultMaxUndecryptablePackets * protocol.MaxReceivePacketSize))
+			c = populateServerConfig(&Config{MaxUndecryptablePackets: -1})
+			Expect(c.MaxUndecryptablePackets).To(Equal(protocol.DefaultMaxUndecryptablePackets))
+			c = populateServerConfig(&Config{MaxUndecryptablePackets: 5})
+			Expect(c.MaxUndecryptablePackets).To(Equal(5))
+			Expect(c.MaxUndecryptablePacketBytes).To(BeEquivalentTo(5 * protocol.MaxReceivePacketSize))
+			c = populateServerConfig(&Config{
+				MaxUndecryptablePackets:     5,
+				MaxUndecryptablePacketBytes: 3000,
+			})
+			Expect(c.MaxUndecryptablePackets).To(Equal(5))
+			Expect(c.MaxUndecryptablePacketBytes).To(BeEquivalentTo(3000))
+		})
+
+		It("sets the number of retries for transient write errors", func() {
+			Expect(populateServerConfig(&Config{}).MaxTransientWriteErrors).To(Equal(protocol.DefaultMaxTransientWriteErrors))
+			Expect(populateServerConfig(&Config{MaxTransientWriteErrors: 3}).MaxTransientWriteErrors).To(Equal(3))
+			Expect(populateServerConfig(&Config{MaxTransientWriteErrors: -1}).MaxTransientWriteErrors).To(BeZero())
+		})
+
+		It("sets the maximum reason phrase length", func() {
+			Expect(populateServerConfig(&Config{}).MaxReasonPhraseLength).To(Equal(protocol.DefaultMaxReasonPhraseLength))
+			Expect(populateServerConfig(&Config{MaxReasonPhraseLength: 10}).MaxReasonPhraseLength).To(Equal(10))
+		})
+
+		It("requires a cookie, even if the AcceptCookie callback accepts clients without a cookie", func() {
+			acceptCookie := func(_ net.Addr, cookie *Cookie) bool { return cookie == nil || cookie.RemoteAddr == "192.168.0.1" }
+			remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
+			c := populateServerConfig(&Config{AcceptCookie: acceptCookie})
+			Expect(c.RequireCookie).To(BeFalse())
+			Expect(c.AcceptCookie(remoteAddr, nil)).To(BeTrue())
+			c = populateServerConfig(&Config{
+				AcceptCookie:  acceptCookie,
+				RequireCookie: true,
+			})
+			Expect(c.RequireCookie).To(BeTrue())
+			Expect(c.AcceptCookie(remoteAddr, nil)).To(BeFalse())
+			Expect(c.AcceptCookie(remoteAddr, &Cookie{RemoteAddr: "192.168.0.1"})).To(BeTrue())
+			Expect(c.AcceptCookie(remoteAddr, &Cookie{RemoteAddr: "127.0.0.1"})).To(BeFalse())
+		})
+
+		It("accepts all versions, if the accepted versions are not set", func() {
+			versions := []protocol.VersionNumber{protocol.VersionTLS, protocol.Version39}
+			c := populateServerConfig(&Config{Versions: versions})
+			Expect(c.AcceptedVersions).To(Equal(versions))
+			c = populateServerConfig(&Config{
+				Versions:         versions,
+				AcceptedVersions: []protocol.VersionNumber{protocol.Version39},
+			})
+			Expect(c.AcceptedVersions).To(Equal([]protocol.VersionNumber{protocol.Version39}))
+		})
+
+		It("copies the ChooseCongestionControl callback", func() {
+			c := populateServerConfig(&Config{
+				ChooseCongestionControl: func(net.Addr, *ClientHelloInfo) CongestionControlAlgorithm { return CongestionControlNewReno },
+			})
+			Expect(c.ChooseCongestionControl(nil, nil)).To(Equal(CongestionControlNewReno))
+		})
+
+		It("copies the AcceptConnection callback", func() {
+			c := populateServerConfig(&Config{
+				AcceptConnection: func(net.Addr, *ClientHelloInfo) AcceptDecision { return AcceptDecisionDrop },
+			})
+			Expect(c.AcceptConnection(nil, nil)).To(Equal(AcceptDecisionDrop))
+		})
+
+		It("sets the source prefix lengths", func() {
+			c := populateServerConfig(&Config{})
+			Expect(c.SourcePrefixLengthIPv4).To(Equal(protocol.DefaultSourcePrefixLengthIPv4))
+			Expect(c.SourcePrefixLengthIPv6).To(Equal(protocol.DefaultSourcePrefixLengthIPv6))
+			c = populateServerConfig(&Config{
+				SourcePrefixLengthIPv4: 24,
+				SourcePrefixLengthIPv6: 48,
+			})
+			Expect(c.SourcePrefixLengthIPv4).To(Equal(24))
+			Expect(c.SourcePrefixLengthIPv6).To(Equal(48))
+			c = populateServerConfig(&Config{
+				SourcePrefixLengthIPv4: 33,
+				SourcePrefixLengthIPv6: 129,
+			})
+			Expect(c.SourcePrefixLengthIPv4).To(Equal(protocol.DefaultSourcePrefixLengthIPv4))
+			Expect(c.SourcePrefixLengthIPv6).To(Equal(protocol.DefaultSourcePrefixLengthIPv6))
+		})
+
+		It("copies the OnClose callback", func() {
+			var called bool
+			c := populateServerConfig(&Config{OnClose: func(Session, error, *DiagnosticSnapshot) { called = true }})
+			c.OnClose(nil, nil, nil)
+			Expect(called).To(BeTrue())
+		})
+
+		It("copies the OnStreamCompleted callback", func() {
+			var called bool
+			c := populateServerConfig(&Config{OnStreamCompleted: func(Session, StreamRecord) { called = true }})
+			c.OnStreamCompleted(nil, StreamRecord{})
+			Expect(called).To(BeTrue())
+		})
+
+		It("copies the OnInvariantViolation callback", func() {
+			var called bool
+			c := populateServerConfig(&Config{OnInvariantViolation: func(Session, InvariantViolation) { called = true }})
+			c.OnInvariantViolation(nil, InvariantViolation{})
+			Expect(called).To(BeTrue())
+		})
+
+		It("copies the LimitReceiveWindowGrowth callback", func() {
+			c := populateServerConfig(&Config{LimitReceiveWindowGrowth: func(Session) bool { return true }})
+			Expect(c.LimitReceiveWindowGrowth(nil)).To(BeTrue())
+		})
+
+		It("copies the OnSocketBufferWarning callback", func() {
+			var warning SocketBufferWarning
+			c := populateServerConfig(&Config{OnSocketBufferWarning: func(w SocketBufferWarning) { warning = w }})
+			c.OnSocketBufferWarning(SocketBufferWarning{Requested: 1234})
+			Expect(warning.Requested).To(Equal(1234))
+		})
+
+		It("disables Path MTU Discovery", func() {
+			Expect(populateServerConfig(&Config{}).DisablePathMTUDiscovery).To(BeFalse())
+			Expect(populateServerConfig(&Config{DisablePathMTUDiscovery: true}).DisablePathMTUDiscovery).To(BeTrue())
+		})
+
+		It("sets the packet sizes", func() {
+			c := populateServerConfig(&Config{InitialPacketSize: 1300, MaxPacketSize: 1400})
+			Expect(c.InitialPacketSize).To(Equal(uint16(1300)))
+			Expect(c.MaxPacketSize).To(Equal(uint16(1400)))
+		})
+
+		It("uses the default packet sizes", func() {
+			c := populateServerConfig(&Config{})
+			Expect(c.InitialPacketSize).To(BeZero())
+			Expect(c.MaxPacketSize).To(BeEquivalentTo(protocol.MaxReceivePacketSize))
+		})
+
+		It("doesn't limit the number of Client Hellos processed concurrently if the limit is negative", func() {
+			c := populateServerConfig(&Config{MaxConcurrentClientHellos: -1})
+			Expect(c.MaxConcurrentClientHellos).To(Equal(-1))
+			Expect(maxProcessedClientHellos(c)).To(Equal(math.MaxInt32))
+		})
+
+		It("doesn't change the socket buffers if the sizes are negative", func() {
+			c := populateServerConfig(&Config{ReceiveBufferSize: 1234, SendBufferSize: -1})
+			Expect(c.ReceiveBufferSize).To(Equal(1234))
+			Expect(c.SendBufferSize).To(Equal(-1))
 		})
 
 		It("disables bidirectional streams", func() {
@@ -108,6 +352,7 @@ var _ = Describe("Server", func() {
 			}
 			serv = &server{
 				sessionHandler: sessionHandler,
+				sourceLimiter:  newSourceLimiter(),
 				newSession:     newMockSession,
 				conn:           conn,
 				config:         config,
@@ -146,11 +391,151 @@ var _ = Describe("Server", func() {
 			sessionHandler.EXPECT().Add(connID, gomock.Any()).Do(func(_ protocol.ConnectionID, sess packetHandler) {
 				Expect(sess.(*mockSession).connID).To(Equal(connID))
 			})
-			err := serv.handlePacket(nil, firstPacket)
+			err := serv.handlePacket(nil, firstPacket, nil, packetInfo{})
 			Expect(err).ToNot(HaveOccurred())
 			Eventually(run).Should(BeClosed())
 		})
 
+		It("limits the number of sessions per source", func() {
+			serv.config = populateServerConfig(&Config{MaxSessionsPerSource: 1})
+			remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1234}
+			ctx, cancel := context.WithCancel(context.Background())
+			runs := make(chan struct{}, 3)
+			s1 := NewMockPacketHandler(mockCtrl)
+			s1.EXPECT().handlePacket(gomock.Any())
+			s1.EXPECT().run().Do(func() { runs <- struct{}{} })
+			s1.EXPECT().Context().Return(ctx)
+			sessions = append(sessions, s1)
+			sessionHandler.EXPECT().Get(connID)
+			sessionHandler.EXPECT().Add(connID, gomock.Any())
+			Expect(serv.handlePacket(remoteAddr, firstPacket, nil, packetInfo{})).To(Succeed())
+
+			// a second connection from the same address is dropped
+			connID2 := protocol.ConnectionID{0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0x42}
+			secondPacket := make([]byte, len(firstPacket))
+			copy(secondPacket, firstPacket)
+			copy(secondPacket[1:9], connID2)
+			sessionHandler.EXPECT().Get(connID2).Times(2)
+			Expect(serv.handlePacket(remoteAddr, secondPacket, nil, packetInfo{})).To(Succeed())
+			// a connection from a different address is accepted
+			s2 := NewMockPacketHandler(mockCtrl)
+			s2.EXPECT().handlePacket(gomock.Any())
+			s2.EXPECT().run().Do(func() { runs <- struct{}{} })
+			s2.EXPECT().Context().Return(context.Background())
+			sessions = append(sessions, s2)
+			sessionHandler.EXPECT().Get(connID)
+			sessionHandler.EXPECT().Add(connID, gomock.Any())
+			Expect(serv.handlePacket(&net.UDPAddr{IP: net.IPv4(192, 168, 0, 2), Port: 1234}, firstPacket, nil, packetInfo{})).To(Succeed())
+
+			// once the first session is closed, a new connection from the same address is accepted
+			cancel()
+			Eventually(func() bool {
+				r, ok := serv.sourceLimiter.Reserve(remoteAddr, serv.config)
+				serv.sourceLimiter.Release(r)
+				return ok
+			}).Should(BeTrue())
+			s3 := NewMockPacketHandler(mockCtrl)
+			s3.EXPECT().handlePacket(gomock.Any())
+			s3.EXPECT().run().Do(func() { runs <- struct{}{} })
+			s3.EXPECT().Context().Return(context.Background())
+			sessions = append(sessions, s3)
+			sessionHandler.EXPECT().Add(connID2, gomock.Any())
+			Expect(serv.handlePacket(remoteAddr, secondPacket, nil, packetInfo{})).To(Succeed())
+			Eventually(runs).Should(HaveLen(3))
+		})
+
+		It("drops new connections, if the AcceptConnection callback says so", func() {
+			remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1234}
+			var info *ClientHelloInfo
+			serv.config = populateServerConfig(&Config{
+				AcceptConnection: func(addr net.Addr, i *ClientHelloInfo) AcceptDecision {
+					Expect(addr).To(Equal(remoteAddr))
+					info = i
+					return AcceptDecisionDrop
+				},
+			})
+			sessionHandler.EXPECT().Get(connID)
+			Expect(serv.handlePacket(remoteAddr, firstPacket, nil, packetInfo{})).To(Succeed())
+			Expect(info.Version).To(Equal(protocol.SupportedVersions[0]))
+			Expect(info.PacketSize).To(Equal(len(firstPacket)))
+			Expect(conn.dataWritten.Len()).To(BeZero())
+		})
+
+		It("requires a cookie, if the AcceptConnection callback says so", func() {
+			serv.config = populateServerConfig(&Config{
+				AcceptCookie:     func(net.Addr, *Cookie) bool { return true },
+				AcceptConnection: func(net.Addr, *ClientHelloInfo) AcceptDecision { return AcceptDecisionRequireCookie },
+			})
+			var sessConf *Config
+			run := make(chan struct{})
+			serv.newSession = func(_ connection, _ sessionRunner, _ protocol.VersionNumber, _ protocol.ConnectionID, _ *handshake.ServerConfig, _ *tls.Config, c *Config, _ utils.Logger) (packetHandler, error) {
+				sessConf = c
+				s := NewMockPacketHandler(mockCtrl)
+				s.EXPECT().handlePacket(gomock.Any())
+				s.EXPECT().run().Do(func() { close(run) })
+				return s, nil
+			}
+			sessionHandler.EXPECT().Get(connID)
+			sessionHandler.EXPECT().Add(connID, gomock.Any())
+			Expect(serv.handlePacket(nil, firstPacket, nil, packetInfo{})).To(Succeed())
+			Eventually(run).Should(BeClosed())
+			Expect(sessConf.RequireCookie).To(BeTrue())
+			Expect(sessConf.AcceptCookie(nil, nil)).To(BeFalse())
+			Expect(sessConf.AcceptCookie(nil, &Cookie{})).To(BeTrue())
+			// the server's config is not modified
+			Expect(serv.config.RequireCookie).To(BeFalse())
+			Expect(serv.config.AcceptCookie(nil, nil)).To(BeTrue())
+		})
+
+		It("uses the congestion control algorithm chosen by the ChooseCongestionControl callback", func() {
+			remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1234}
+			var info *ClientHelloInfo
+			serv.config = populateServerConfig(&Config{
+				CongestionControl: CongestionControlBBRv2,
+				ChooseCongestionControl: func(addr net.Addr, i *ClientHelloInfo) CongestionControlAlgorithm {
+					Expect(addr).To(Equal(remoteAddr))
+					info = i
+					return CongestionControlNewReno
+				},
+			})
+			var sessConf *Config
+			run := make(chan struct{})
+			serv.newSession = func(_ connection, _ sessionRunner, _ protocol.VersionNumber, _ protocol.ConnectionID, _ *handshake.ServerConfig, _ *tls.Config, c *Config, _ utils.Logger) (packetHandler, error) {
+				sessConf = c
+				s := NewMockPacketHandler(mockCtrl)
+				s.EXPECT().handlePacket(gomock.Any())
+				s.EXPECT().run().Do(func() { close(run) })
+				return s, nil
+			}
+			sessionHandler.EXPECT().Get(connID)
+			sessionHandler.EXPECT().Add(connID, gomock.Any())
+			Expect(serv.handlePacket(remoteAddr, firstPacket, nil, packetInfo{})).To(Succeed())
+			Eventually(run).Should(BeClosed())
+			Expect(info.Version).To(Equal(protocol.SupportedVersions[0]))
+			Expect(info.PacketSize).To(Equal(len(firstPacket)))
+			Expect(sessConf.CongestionControl).To(Equal(CongestionControlNewReno))
+			// the config used for new sessions is not modified
+			Expect(serv.config.CongestionControl).To(Equal(CongestionControlBBRv2))
+		})
+
+		It("creates sessions that send from the address the Client Hello was received on", func() {
+			var sessConn connection
+			run := make(chan struct{})
+			serv.newSession = func(c connection, _ sessionRunner, _ protocol.VersionNumber, _ protocol.ConnectionID, _ *handshake.ServerConfig, _ *tls.Config, _ *Config, _ utils.Logger) (packetHandler, error) {
+				sessConn = c
+				s := NewMockPacketHandler(mockCtrl)
+				s.EXPECT().handlePacket(gomock.Any())
+				s.EXPECT().run().Do(func() { close(run) })
+				return s, nil
+			}
+			sessionHandler.EXPECT().Get(connID)
+			sessionHandler.EXPECT().Add(connID, gomock.Any())
+			info := packetInfo{ecn: protocol.ECT0, localAddr: net.IPv4(192, 168, 0, 2), ifIndex: 3}
+			Expect(serv.handlePacket(nil, firstPacket, nil, info)).To(Succeed())
+			Eventually(run).Should(BeClosed())
+			Expect(getPacketInfo(sessConn)).To(Equal(packetInfo{localAddr: net.IPv4(192, 168, 0, 2), ifIndex: 3}))
+		})
+
 		It("accepts new TLS sessions", func() {
 			connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
 			run := make(chan struct{})
@@ -185,12 +570,26 @@ var _ = Describe("Server", func() {
 				Consistently(done).ShouldNot(BeClosed())
 				sess.(*mockSession).runner.onHandshakeComplete(sess)
 			})
-			err := serv.handlePacket(nil, firstPacket)
+			err := serv.handlePacket(nil, firstPacket, nil, packetInfo{})
 			Expect(err).ToNot(HaveOccurred())
 			Eventually(done).Should(BeClosed())
 			Eventually(run).Should(BeClosed())
 		})
 
+		It("returns when the context passed to AcceptContext is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := serv.AcceptContext(ctx)
+				Expect(err).To(MatchError(context.Canceled))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			cancel()
+			Eventually(done).Should(BeClosed())
+		})
+
 		It("doesn't accept sessions that error during the handshake", func() {
 			run := make(chan error, 1)
 			sess := NewMockPacketHandler(mockCtrl)
@@ -207,7 +606,7 @@ var _ = Describe("Server", func() {
 			sessionHandler.EXPECT().Add(connID, gomock.Any()).Do(func(_ protocol.ConnectionID, sess packetHandler) {
 				run <- errors.New("handshake error")
 			})
-			err := serv.handlePacket(nil, firstPacket)
+			err := serv.handlePacket(nil, firstPacket, nil, packetInfo{})
 			Expect(err).ToNot(HaveOccurred())
 			Consistently(done).ShouldNot(BeClosed())
 			// make the go routine return
@@ -222,10 +621,66 @@ var _ = Describe("Server", func() {
 			sess.EXPECT().handlePacket(gomock.Any())
 
 			sessionHandler.EXPECT().Get(connID).Return(sess, true)
-			err := serv.handlePacket(nil, []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01})
+			err := serv.handlePacket(nil, []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01}, nil, packetInfo{})
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("passes the buffer of the packet to the session", func() {
+			buf := getPacketBuffer()
+			*buf = append(*buf, 0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01)
+			sess := NewMockPacketHandler(mockCtrl)
+			sess.EXPECT().handlePacket(gomock.Any()).Do(func(p *receivedPacket) {
+				Expect(p.buffer).To(Equal(buf))
+				Expect(p.header.Raw).To(Equal(*buf))
+			})
+			sessionHandler.EXPECT().Get(connID).Return(sess, true)
+			Expect(serv.handlePacket(nil, *buf, buf, packetInfo{})).To(Succeed())
+			Expect(*buf).ToNot(BeEmpty())
+		})
+
+		Context("sharding", func() {
+			var otherSessionHandler *MockSessionHandler
+
+			BeforeEach(func() {
+				otherSessionHandler = NewMockSessionHandler(mockCtrl)
+				serv.shards = &shardGroup{servers: []*server{serv, {sessionHandler: otherSessionHandler}}}
+			})
+
+			It("passes packets to sessions of other shards", func() {
+				sess := NewMockPacketHandler(mockCtrl)
+				sess.EXPECT().handlePacket(gomock.Any())
+				sessionHandler.EXPECT().Get(connID)
+				otherSessionHandler.EXPECT().Get(connID).Return(sess, true)
+				err := serv.handlePacket(nil, []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01}, nil, packetInfo{})
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("doesn't look up other shards if the session is known", func() {
+				sess := NewMockPacketHandler(mockCtrl)
+				sess.EXPECT().handlePacket(gomock.Any())
+				sessionHandler.EXPECT().Get(connID).Return(sess, true)
+				err := serv.handlePacket(nil, []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01}, nil, packetInfo{})
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("ignores packets for sessions that were closed by other shards", func() {
+				sessionHandler.EXPECT().Get(connID)
+				otherSessionHandler.EXPECT().Get(connID).Return(nil, true)
+				err := serv.handlePacket(nil, []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01}, nil, packetInfo{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(conn.dataWritten.Len()).To(BeZero())
+			})
+
+			It("sends a Public Reset if no shard knows the connection", func() {
+				sessionHandler.EXPECT().Get(connID)
+				otherSessionHandler.EXPECT().Get(connID)
+				err := serv.handlePacket(&net.UDPAddr{}, []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01}, nil, packetInfo{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(conn.dataWritten.Len()).ToNot(BeZero())
+				Expect(conn.dataWritten.Bytes()[0] & 0x02).ToNot(BeZero()) // check that the ResetFlag is set
+			})
+		})
+
 		It("closes the sessionHandler and the connection when Close is called", func() {
 			go func() {
 				defer GinkgoRecover()
@@ -239,7 +694,7 @@ var _ = Describe("Server", func() {
 
 		It("ignores packets for closed sessions", func() {
 			sessionHandler.EXPECT().Get(connID).Return(nil, true)
-			err := serv.handlePacket(nil, firstPacket)
+			err := serv.handlePacket(nil, firstPacket, nil, packetInfo{})
 			Expect(err).ToNot(HaveOccurred())
 		})
 
@@ -291,14 +746,14 @@ var _ = Describe("Server", func() {
 			data := []byte{0x09, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6}
 			utils.BigEndian.WriteUint32(b, uint32(protocol.SupportedVersions[0]+1))
 			data = append(append(data, b.Bytes()...), 0x01)
-			err := serv.handlePacket(nil, data)
+			err := serv.handlePacket(nil, data, nil, packetInfo{})
 			Expect(err).ToNot(HaveOccurred())
 			// if we didn't ignore the packet, the server would try to send a version negotiation packet, which would make the test panic because it doesn't have a udpConn
 			Expect(conn.dataWritten.Bytes()).To(BeEmpty())
 		})
 
 		It("errors on invalid public header", func() {
-			err := serv.handlePacket(nil, nil)
+			err := serv.handlePacket(nil, nil, nil, packetInfo{})
 			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.InvalidPacketHeader))
 		})
 
@@ -314,7 +769,7 @@ var _ = Describe("Server", func() {
 				Version:          versionIETFFrames,
 			}
 			Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
-			err := serv.handlePacket(nil, append(b.Bytes(), make([]byte, 456)...))
+			err := serv.handlePacket(nil, append(b.Bytes(), make([]byte, 456)...), nil, packetInfo{})
 			Expect(err).To(MatchError("packet payload (456 bytes) is smaller than the expected payload length (1000 bytes)"))
 		})
 
@@ -336,7 +791,7 @@ var _ = Describe("Server", func() {
 			}
 			Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
 			sessionHandler.EXPECT().Get(connID).Return(sess, true)
-			err := serv.handlePacket(nil, append(b.Bytes(), make([]byte, 456)...))
+			err := serv.handlePacket(nil, append(b.Bytes(), make([]byte, 456)...), nil, packetInfo{})
 			Expect(err).ToNot(HaveOccurred())
 		})
 
@@ -352,15 +807,28 @@ var _ = Describe("Server", func() {
 				Version:          versionIETFFrames,
 			}
 			Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
-			err := serv.handlePacket(nil, append(b.Bytes(), make([]byte, 456)...))
+			err := serv.handlePacket(nil, append(b.Bytes(), make([]byte, 456)...), nil, packetInfo{})
 			Expect(err).To(MatchError("Received unsupported packet type: Retry"))
 		})
 
 		It("ignores Public Resets", func() {
-			err := serv.handlePacket(nil, wire.WritePublicReset(connID, 1, 1337))
+			err := serv.handlePacket(nil, wire.WritePublicReset(connID, 1, 1337), nil, packetInfo{})
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("returns the buffer of packets that are dropped", func() {
+			buf := getPacketBuffer()
+			*buf = append(*buf, wire.WritePublicReset(connID, 1, 1337)...)
+			Expect(serv.handlePacket(nil, *buf, buf, packetInfo{})).To(Succeed())
+			Expect(*buf).To(BeEmpty())
+		})
+
+		It("returns the buffer of packets that can't be parsed", func() {
+			buf := getPacketBuffer()
+			Expect(serv.handlePacket(nil, *buf, buf, packetInfo{})).ToNot(Succeed())
+			Expect(*buf).To(BeEmpty())
+		})
+
 		It("doesn't try to process a packet after sending a gQUIC Version Negotiation Packet", func() {
 			config.Versions = []protocol.VersionNumber{99}
 			b := &bytes.Buffer{}
@@ -375,7 +843,7 @@ var _ = Describe("Server", func() {
 			b.Write(bytes.Repeat([]byte{0}, protocol.MinClientHelloSize)) // add a fake CHLO
 			serv.conn = conn
 			sessionHandler.EXPECT().Get(connID)
-			err := serv.handlePacket(nil, b.Bytes())
+			err := serv.handlePacket(nil, b.Bytes(), nil, packetInfo{})
 			Expect(conn.dataWritten.Bytes()).ToNot(BeEmpty())
 			Expect(err).ToNot(HaveOccurred())
 		})
@@ -393,7 +861,7 @@ var _ = Describe("Server", func() {
 			b.Write(bytes.Repeat([]byte{0}, protocol.MinClientHelloSize-1)) // this packet is 1 byte too small
 			serv.conn = conn
 			sessionHandler.EXPECT().Get(connID)
-			err := serv.handlePacket(udpAddr, b.Bytes())
+			err := serv.handlePacket(udpAddr, b.Bytes(), nil, packetInfo{})
 			Expect(err).To(MatchError("dropping small packet with unknown version"))
 			Expect(conn.dataWritten.Len()).Should(BeZero())
 		})
@@ -403,11 +871,13 @@ var _ = Describe("Server", func() {
 		supportedVersions := []protocol.VersionNumber{protocol.VersionTLS, protocol.Version39}
 		acceptCookie := func(_ net.Addr, _ *Cookie) bool { return true }
 		config := Config{
-			Versions:         supportedVersions,
-			AcceptCookie:     acceptCookie,
-			HandshakeTimeout: 1337 * time.Hour,
-			IdleTimeout:      42 * time.Minute,
-			KeepAlive:        true,
+			Versions:            supportedVersions,
+			AcceptCookie:        acceptCookie,
+			HandshakeTimeout:    1337 * time.Hour,
+			IdleTimeout:         42 * time.Minute,
+			KeepAlive:           true,
+			KeepAlivePeriod:     15 * time.Second,
+			SendCoalescingDelay: 200 * time.Microsecond,
 		}
 		ln, err := Listen(conn, &tls.Config{}, &config)
 		Expect(err).ToNot(HaveOccurred())
@@ -419,6 +889,8 @@ var _ = Describe("Server", func() {
 		Expect(server.config.IdleTimeout).To(Equal(42 * time.Minute))
 		Expect(reflect.ValueOf(server.config.AcceptCookie)).To(Equal(reflect.ValueOf(acceptCookie)))
 		Expect(server.config.KeepAlive).To(BeTrue())
+		Expect(server.config.KeepAlivePeriod).To(Equal(15 * time.Second))
+		Expect(server.config.SendCoalescingDelay).To(Equal(200 * time.Microsecond))
 	})
 
 	It("errors when the Config contains an invalid version", func() {
@@ -427,6 +899,31 @@ var _ = Describe("Server", func() {
 		Expect(err).To(MatchError("0x1234 is not a valid QUIC version"))
 	})
 
+	It("errors when the Config accepts a version that it doesn't support", func() {
+		_, err := Listen(conn, &tls.Config{}, &Config{
+			Versions:         []protocol.VersionNumber{protocol.Version39},
+			AcceptedVersions: []protocol.VersionNumber{protocol.VersionTLS},
+		})
+		Expect(err).To(MatchError("accepted version TLS dev version (WIP) is not supported"))
+	})
+
+	It("errors when the Config contains an invalid connection ID length", func() {
+		_, err := Listen(conn, &tls.Config{}, &Config{ConnectionIDLength: 3})
+		Expect(err).To(MatchError("invalid connection ID length: 3 bytes"))
+		_, err = Listen(conn, &tls.Config{}, &Config{ConnectionIDLength: 19})
+		Expect(err).To(MatchError("invalid connection ID length: 19 bytes"))
+	})
+
+	It("errors when the Config contains an invalid connection ID count", func() {
+		_, err := Listen(conn, &tls.Config{}, &Config{ConnectionIDCount: 9})
+		Expect(err).To(MatchError("invalid connection ID count: 9"))
+	})
+
+	It("errors when the Config contains an invalid DSCP", func() {
+		_, err := Listen(conn, &tls.Config{}, &Config{DSCP: 64})
+		Expect(err).To(MatchError("invalid DSCP: 64"))
+	})
+
 	It("fills in default values if options are not set in the Config", func() {
 		ln, err := Listen(conn, &tls.Config{}, &Config{})
 		Expect(err).ToNot(HaveOccurred())
@@ -434,8 +931,128 @@ var _ = Describe("Server", func() {
 		Expect(server.config.Versions).To(Equal(protocol.SupportedVersions))
 		Expect(server.config.HandshakeTimeout).To(Equal(protocol.DefaultHandshakeTimeout))
 		Expect(server.config.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
+		Expect(server.config.PathValidationTimeout).To(Equal(protocol.DefaultPathValidationTimeout))
+		Expect(server.config.MaxPathValidationProbes).To(Equal(protocol.DefaultMaxPathValidationProbes))
+		Expect(server.config.ConnectionIDLength).To(Equal(protocol.ConnectionIDLen))
+		Expect(server.config.ConnectionIDCount).To(Equal(1))
+		Expect(server.config.StatelessResetKey).To(HaveLen(32))
 		Expect(reflect.ValueOf(server.config.AcceptCookie)).To(Equal(reflect.ValueOf(defaultAcceptCookie)))
 		Expect(server.config.KeepAlive).To(BeFalse())
+		Expect(server.config.ReceiveBufferSize).To(Equal(protocol.DefaultSocketBufferSize))
+		Expect(server.config.SendBufferSize).To(Equal(protocol.DefaultSocketBufferSize))
+		Expect(server.config.MaxConcurrentClientHellos).To(Equal(runtime.NumCPU()))
+	})
+
+	Context("replacing the config", func() {
+		var serv *server
+
+		BeforeEach(func() {
+			ln, err := Listen(conn, &tls.Config{}, &Config{Versions: []protocol.VersionNumber{protocol.VersionTLS, protocol.Version39}})
+			Expect(err).ToNot(HaveOccurred())
+			serv = ln.(*server)
+		})
+
+		It("replaces the config used for new sessions", func() {
+			acceptCookie := func(_ net.Addr, _ *Cookie) bool { return true }
+			oldConfig := serv.getConfig()
+			err := serv.SetConfig(&Config{
+				IdleTimeout:        42 * time.Minute,
+				AcceptCookie:       acceptCookie,
+				MaxIncomingStreams: 1234,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			c := serv.getConfig()
+			Expect(c.IdleTimeout).To(Equal(42 * time.Minute))
+			Expect(c.MaxIncomingStreams).To(Equal(1234))
+			Expect(c.HandshakeTimeout).To(Equal(protocol.DefaultHandshakeTimeout))
+			Expect(reflect.ValueOf(c.AcceptCookie)).To(Equal(reflect.ValueOf(acceptCookie)))
+			// existing sessions keep using the old config
+			Expect(oldConfig.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
+		})
+
+		It("changes the number of Client Hellos processed concurrently", func() {
+			Expect(serv.SetConfig(&Config{MaxConcurrentClientHellos: 1})).To(Succeed())
+			Expect(serv.chloQueue.Acquire(false)).To(BeTrue())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(serv.chloQueue.Acquire(false)).To(BeTrue())
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(serv.SetConfig(&Config{MaxConcurrentClientHellos: 2})).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("replaces the config used for new TLS sessions", func() {
+			err := serv.SetConfig(&Config{
+				IdleTimeout:        42 * time.Minute,
+				MaxIncomingStreams: 1234,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			c, params := serv.serverTLS.getConfig()
+			Expect(c).To(Equal(serv.getConfig()))
+			Expect(params.IdleTimeout).To(Equal(42 * time.Minute))
+			Expect(params.MaxBidiStreams).To(BeEquivalentTo(1234))
+		})
+
+		It("keeps the versions, if none are set", func() {
+			Expect(serv.SetConfig(nil)).To(Succeed())
+			Expect(serv.getConfig().Versions).To(Equal([]protocol.VersionNumber{protocol.VersionTLS, protocol.Version39}))
+			Expect(serv.SetConfig(&Config{Versions: []protocol.VersionNumber{protocol.VersionTLS, protocol.Version39}})).To(Succeed())
+		})
+
+		It("doesn't allow changing the versions", func() {
+			err := serv.SetConfig(&Config{Versions: []protocol.VersionNumber{protocol.Version39}})
+			Expect(err).To(MatchError("the QUIC versions of a Listener can't be changed"))
+			Expect(serv.getConfig().Versions).To(Equal([]protocol.VersionNumber{protocol.VersionTLS, protocol.Version39}))
+		})
+
+		It("changes the accepted versions", func() {
+			Expect(serv.getConfig().AcceptedVersions).To(Equal([]protocol.VersionNumber{protocol.VersionTLS, protocol.Version39}))
+			Expect(serv.SetConfig(&Config{AcceptedVersions: []protocol.VersionNumber{protocol.Version39}})).To(Succeed())
+			Expect(serv.getConfig().AcceptedVersions).To(Equal([]protocol.VersionNumber{protocol.Version39}))
+			c, _ := serv.serverTLS.getConfig()
+			Expect(c.AcceptedVersions).To(Equal([]protocol.VersionNumber{protocol.Version39}))
+			// if not set, all versions are accepted
+			Expect(serv.SetConfig(&Config{})).To(Succeed())
+			Expect(serv.getConfig().AcceptedVersions).To(Equal([]protocol.VersionNumber{protocol.VersionTLS, protocol.Version39}))
+		})
+
+		It("doesn't accept versions that are not supported", func() {
+			err := serv.SetConfig(&Config{AcceptedVersions: []protocol.VersionNumber{0x1234}})
+			Expect(err).To(MatchError("accepted version 0x1234 is not supported"))
+			Expect(serv.getConfig().AcceptedVersions).To(Equal([]protocol.VersionNumber{protocol.VersionTLS, protocol.Version39}))
+		})
+
+		It("doesn't allow changing the connection ID length", func() {
+			Expect(serv.SetConfig(&Config{ConnectionIDLength: protocol.ConnectionIDLen})).To(Succeed())
+			err := serv.SetConfig(&Config{ConnectionIDLength: 4})
+			Expect(err).To(MatchError("the connection ID length of a Listener can't be changed"))
+			Expect(serv.getConfig().ConnectionIDLength).To(Equal(protocol.ConnectionIDLen))
+		})
+
+		It("doesn't allow changing the stateless reset key", func() {
+			key := serv.getConfig().StatelessResetKey
+			Expect(serv.SetConfig(&Config{})).To(Succeed())
+			Expect(serv.getConfig().StatelessResetKey).To(Equal(key))
+			Expect(serv.SetConfig(&Config{StatelessResetKey: key})).To(Succeed())
+			err := serv.SetConfig(&Config{StatelessResetKey: []byte("foobar")})
+			Expect(err).To(MatchError("the stateless reset key of a Listener can't be changed"))
+			Expect(serv.getConfig().StatelessResetKey).To(Equal(key))
+		})
+
+		It("allows changing the connection ID count", func() {
+			Expect(serv.SetConfig(&Config{ConnectionIDCount: 3})).To(Succeed())
+			Expect(serv.getConfig().ConnectionIDCount).To(Equal(3))
+			Expect(serv.SetConfig(&Config{ConnectionIDCount: 9})).To(MatchError("invalid connection ID count: 9"))
+		})
+
+		It("allows changing the DSCP", func() {
+			Expect(serv.SetConfig(&Config{DSCP: 46})).To(Succeed())
+			Expect(serv.getConfig().DSCP).To(BeEquivalentTo(46))
+			Expect(serv.SetConfig(&Config{DSCP: 64})).To(MatchError("invalid DSCP: 64"))
+		})
 	})
 
 	It("listens on a given address", func() {
@@ -485,7 +1102,7 @@ var _ = Describe("Server", func() {
 		Eventually(func() int { return conn.dataWritten.Len() }).ShouldNot(BeZero())
 		Expect(conn.dataWrittenTo).To(Equal(udpAddr))
 		r := bytes.NewReader(conn.dataWritten.Bytes())
-		packet, err := wire.ParseHeaderSentByServer(r)
+		packet, err := wire.ParseHeaderSentByServer(r, protocol.ConnectionIDLen)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(packet.VersionFlag).To(BeTrue())
 		Expect(packet.DestConnectionID).To(Equal(connID))
@@ -497,6 +1114,35 @@ var _ = Describe("Server", func() {
 		Eventually(done).Should(BeClosed())
 	})
 
+	It("sends a gQUIC Version Negotiation Packet, if the client offered a version that is supported, but not accepted", func() {
+		connID := protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}
+		b := &bytes.Buffer{}
+		hdr := wire.Header{
+			VersionFlag:      true,
+			DestConnectionID: connID,
+			SrcConnectionID:  connID,
+			PacketNumber:     1,
+			PacketNumberLen:  protocol.PacketNumberLen2,
+		}
+		hdr.Write(b, protocol.PerspectiveClient, protocol.Version39)
+		b.Write(bytes.Repeat([]byte{0}, protocol.MinClientHelloSize)) // add a fake CHLO
+		conn.dataToRead <- b.Bytes()
+		conn.dataReadFrom = udpAddr
+		ln, err := Listen(conn, testdata.GetTLSConfig(), &Config{
+			Versions:         []protocol.VersionNumber{protocol.VersionTLS, protocol.Version39},
+			AcceptedVersions: []protocol.VersionNumber{protocol.VersionTLS},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+
+		Eventually(func() int { return conn.dataWritten.Len() }).ShouldNot(BeZero())
+		r := bytes.NewReader(conn.dataWritten.Bytes())
+		packet, err := wire.ParseHeaderSentByServer(r, protocol.ConnectionIDLen)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(packet.VersionFlag).To(BeTrue())
+		Expect(packet.SupportedVersions).To(Equal([]protocol.VersionNumber{protocol.VersionTLS}))
+	})
+
 	It("sends an IETF draft style Version Negotaion Packet, if the client sent a IETF draft style header", func() {
 		connID := protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}
 		config.Versions = append(config.Versions, protocol.VersionTLS)
@@ -528,7 +1174,7 @@ var _ = Describe("Server", func() {
 		Eventually(func() int { return conn.dataWritten.Len() }).ShouldNot(BeZero())
 		Expect(conn.dataWrittenTo).To(Equal(udpAddr))
 		r := bytes.NewReader(conn.dataWritten.Bytes())
-		packet, err := wire.ParseHeaderSentByServer(r)
+		packet, err := wire.ParseHeaderSentByServer(r, protocol.ConnectionIDLen)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(packet.IsVersionNegotiation).To(BeTrue())
 		Expect(packet.DestConnectionID).To(Equal(connID))
@@ -583,6 +1229,47 @@ var _ = Describe("Server", func() {
 		Consistently(func() int { return conn.dataWritten.Len() }).Should(BeZero())
 	})
 
+	It("sends a Stateless Reset for Short Header packets for unknown connections", func() {
+		connID := protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}
+		b := &bytes.Buffer{}
+		hdr := wire.Header{
+			DestConnectionID: connID,
+			PacketNumber:     0x55,
+			PacketNumberLen:  protocol.PacketNumberLen2,
+		}
+		Expect(hdr.Write(b, protocol.PerspectiveClient, protocol.VersionTLS)).To(Succeed())
+		b.Write(bytes.Repeat([]byte{0}, 100)) // add some payload
+		conn.dataToRead <- b.Bytes()
+		conn.dataReadFrom = udpAddr
+		config.StatelessResetKey = []byte("foobar")
+		ln, err := Listen(conn, testdata.GetTLSConfig(), config)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		Eventually(func() int { return conn.dataWritten.Len() }).ShouldNot(BeZero())
+		Expect(conn.dataWrittenTo).To(Equal(udpAddr))
+		data := conn.dataWritten.Bytes()
+		Expect(data).To(HaveLen(protocol.MinStatelessResetSize))
+		token := getStatelessResetToken([]byte("foobar"), connID)
+		Expect(data[len(data)-16:]).To(Equal(token[:]))
+	})
+
+	It("doesn't send a Stateless Reset in response to small packets", func() {
+		b := &bytes.Buffer{}
+		hdr := wire.Header{
+			DestConnectionID: protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+			PacketNumber:     0x55,
+			PacketNumberLen:  protocol.PacketNumberLen2,
+		}
+		Expect(hdr.Write(b, protocol.PerspectiveClient, protocol.VersionTLS)).To(Succeed())
+		b.Write(bytes.Repeat([]byte{0}, protocol.MinStatelessResetSize-b.Len()))
+		conn.dataToRead <- b.Bytes()
+		conn.dataReadFrom = udpAddr
+		ln, err := Listen(conn, testdata.GetTLSConfig(), config)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		Consistently(func() int { return conn.dataWritten.Len() }).Should(BeZero())
+	})
+
 	It("sends a PublicReset for new connections that don't have the VersionFlag set", func() {
 		conn.dataReadFrom = udpAddr
 		conn.dataToRead <- []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01}
@@ -650,4 +1337,104 @@ var _ = Describe("default source address verification", func() {
 		}
 		Expect(defaultAcceptCookie(remoteAddr, cookie)).To(BeFalse())
 	})
+
+	It("accepts a token for an IPv4-mapped IPv6 address", func() {
+		remoteAddr := &net.UDPAddr{IP: net.ParseIP("::ffff:192.168.0.1")}
+		cookie := &Cookie{
+			RemoteAddr: "192.168.0.1",
+			SentTime:   time.Now(),
+		}
+		Expect(defaultAcceptCookie(remoteAddr, cookie)).To(BeTrue())
+	})
+
+	It("rejects a token issued for an address of the other address family", func() {
+		remoteAddr := &net.UDPAddr{IP: net.ParseIP("2001:db8::68")}
+		cookie := &Cookie{
+			RemoteAddr: "192.168.0.1",
+			SentTime:   time.Now(),
+		}
+		Expect(defaultAcceptCookie(remoteAddr, cookie)).To(BeFalse())
+	})
+
+	Context("accepting tokens across address families", func() {
+		It("uses this verification if configured", func() {
+			config := populateServerConfig(&Config{AcceptCookieAcrossAddressFamilies: true})
+			Expect(reflect.ValueOf(config.AcceptCookie)).To(Equal(reflect.ValueOf(acceptCookieAcrossAddressFamilies)))
+			config = populateServerConfig(&Config{
+				AcceptCookieAcrossAddressFamilies: true,
+				AcceptCookie:                      func(net.Addr, *Cookie) bool { return true },
+			})
+			Expect(reflect.ValueOf(config.AcceptCookie)).ToNot(Equal(reflect.ValueOf(acceptCookieAcrossAddressFamilies)))
+		})
+
+		It("accepts a token issued for the same address", func() {
+			remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
+			cookie := &Cookie{
+				RemoteAddr: "192.168.0.1",
+				SentTime:   time.Now(),
+			}
+			Expect(acceptCookieAcrossAddressFamilies(remoteAddr, cookie)).To(BeTrue())
+		})
+
+		It("accepts a token issued for an IPv4 address from a NAT64 address embedding it", func() {
+			remoteAddr := &net.UDPAddr{IP: net.ParseIP("64:ff9b::c0a8:1")}
+			cookie := &Cookie{
+				RemoteAddr: "192.168.0.1",
+				SentTime:   time.Now(),
+			}
+			Expect(acceptCookieAcrossAddressFamilies(remoteAddr, cookie)).To(BeTrue())
+		})
+
+		It("accepts a token issued for a 6to4 address from the IPv4 address embedded in it", func() {
+			remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
+			cookie := &Cookie{
+				RemoteAddr: "2002:c0a8:1::1",
+				SentTime:   time.Now(),
+			}
+			Expect(acceptCookieAcrossAddressFamilies(remoteAddr, cookie)).To(BeTrue())
+		})
+
+		It("rejects a token issued for an IPv4 address from an IPv6 address that doesn't embed it", func() {
+			for _, addr := range []string{"2001:db8::68", "64:ff9b::7f00:1", "2002:7f00:1::1"} {
+				remoteAddr := &net.UDPAddr{IP: net.ParseIP(addr)}
+				cookie := &Cookie{
+					RemoteAddr: "192.168.0.1",
+					SentTime:   time.Now(),
+				}
+				Expect(acceptCookieAcrossAddressFamilies(remoteAddr, cookie)).To(BeFalse())
+			}
+		})
+
+		It("rejects a token issued for an IPv6 address that doesn't embed the IPv4 address", func() {
+			remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
+			cookie := &Cookie{
+				RemoteAddr: "2001:db8::68",
+				SentTime:   time.Now(),
+			}
+			Expect(acceptCookieAcrossAddressFamilies(remoteAddr, cookie)).To(BeFalse())
+		})
+
+		It("rejects a token issued for a different address of the same address family", func() {
+			remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
+			cookie := &Cookie{
+				RemoteAddr: "127.0.0.1",
+				SentTime:   time.Now(),
+			}
+			Expect(acceptCookieAcrossAddressFamilies(remoteAddr, cookie)).To(BeFalse())
+		})
+
+		It("rejects an expired token", func() {
+			remoteAddr := &net.UDPAddr{IP: net.ParseIP("64:ff9b::c0a8:1")}
+			cookie := &Cookie{
+				RemoteAddr: "192.168.0.1",
+				SentTime:   time.Now().Add(-protocol.CookieExpiryTime).Add(-time.Second), // expired 1 second ago
+			}
+			Expect(acceptCookieAcrossAddressFamilies(remoteAddr, cookie)).To(BeFalse())
+		})
+
+		It("requests verification if no token is provided", func() {
+			remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
+			Expect(acceptCookieAcrossAddressFamilies(remoteAddr, nil)).To(BeFalse())
+		})
+	})
 })
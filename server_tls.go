@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 
 	"github.com/bifurcation/mint"
 	"github.com/lucas-clemente/quic-go/internal/crypto"
@@ -32,19 +33,24 @@ func (n *nullAEAD) Open1RTT(dst, src []byte, packetNumber protocol.PacketNumber,
 type tlsSession struct {
 	connID protocol.ConnectionID
 	sess   packetHandler
+	// reservation is the handshake reserved for the session, see sourceLimiter
+	reservation *sourceReservation
 }
 
 type serverTLS struct {
-	conn              net.PacketConn
-	config            *Config
-	supportedVersions []protocol.VersionNumber
-	mintConf          *mint.Config
-	params            *handshake.TransportParameters
-	newMintConn       func(*handshake.CryptoStreamConn, protocol.VersionNumber) (handshake.MintTLS, <-chan handshake.TransportParameters, error)
+	conn          net.PacketConn
+	mintConf      *mint.Config
+	cookieHandler *handshake.CookieHandler
+	newMintConn   func(*handshake.CryptoStreamConn, protocol.VersionNumber, *Config, *handshake.TransportParameters) (handshake.MintTLS, <-chan handshake.TransportParameters, error)
 
 	sessionRunner sessionRunner
 	sessionChan   chan<- tlsSession
 
+	// the config and the transport parameters can be replaced by setConfig
+	configMutex sync.RWMutex
+	config      *Config
+	params      *handshake.TransportParameters
+
 	logger utils.Logger
 }
 
@@ -53,6 +59,7 @@ func newServerTLS(
 	config *Config,
 	runner sessionRunner,
 	cookieHandler *handshake.CookieHandler,
+	cookieProtector mint.CookieProtector,
 	tlsConf *tls.Config,
 	logger utils.Logger,
 ) (*serverTLS, <-chan tlsSession, error) {
@@ -61,60 +68,79 @@ func newServerTLS(
 		return nil, nil, err
 	}
 	mconf.RequireCookie = true
-	cs, err := mint.NewDefaultCookieProtector()
-	if err != nil {
-		return nil, nil, err
-	}
-	mconf.CookieProtector = cs
+	mconf.CookieProtector = cookieProtector
 	mconf.CookieHandler = cookieHandler
 
 	sessionChan := make(chan tlsSession)
 	s := &serverTLS{
-		conn:              conn,
-		config:            config,
-		supportedVersions: config.Versions,
-		mintConf:          mconf,
-		sessionRunner:     runner,
-		sessionChan:       sessionChan,
-		params: &handshake.TransportParameters{
-			StreamFlowControlWindow:     protocol.ReceiveStreamFlowControlWindow,
-			ConnectionFlowControlWindow: protocol.ReceiveConnectionFlowControlWindow,
-			IdleTimeout:                 config.IdleTimeout,
-			MaxBidiStreams:              uint16(config.MaxIncomingStreams),
-			MaxUniStreams:               uint16(config.MaxIncomingUniStreams),
-		},
-		logger: logger,
+		conn:          conn,
+		mintConf:      mconf,
+		cookieHandler: cookieHandler,
+		sessionRunner: runner,
+		sessionChan:   sessionChan,
+		logger:        logger,
 	}
+	s.setConfig(config)
 	s.newMintConn = s.newMintConnImpl
 	return s, sessionChan, nil
 }
 
-func (s *serverTLS) HandleInitial(remoteAddr net.Addr, hdr *wire.Header, data []byte) {
+// setConfig sets the config used for new sessions.
+func (s *serverTLS) setConfig(config *Config) {
+	s.configMutex.Lock()
+	defer s.configMutex.Unlock()
+	s.config = config
+	s.params = &handshake.TransportParameters{
+		StreamFlowControlWindow:     protocol.ByteCount(config.InitialReceiveStreamFlowControlWindow),
+		ConnectionFlowControlWindow: protocol.ByteCount(config.InitialReceiveConnectionFlowControlWindow),
+		IdleTimeout:                 config.IdleTimeout,
+		MaxBidiStreams:              uint16(config.MaxIncomingStreams),
+		MaxUniStreams:               uint16(config.MaxIncomingUniStreams),
+		Features:                    protocol.NewFeatureSet(config.Features...),
+	}
+}
+
+func (s *serverTLS) getConfig() (*Config, *handshake.TransportParameters) {
+	s.configMutex.RLock()
+	defer s.configMutex.RUnlock()
+	return s.config, s.params
+}
+
+// HandleInitial handles an Initial packet statelessly.
+// If requireCookie is set, the client has to present a valid Cookie, even if the AcceptCookie callback would accept it without one.
+// The info is used for all packets sent to the client.
+// If a session is created, it is passed to the sessionChan along with the reservation, and true is returned.
+func (s *serverTLS) HandleInitial(remoteAddr net.Addr, info packetInfo, hdr *wire.Header, data []byte, requireCookie bool, reservation *sourceReservation) bool {
 	// TODO: add a check that DestConnID == SrcConnID
 	s.logger.Debugf("Received a Packet. Handling it statelessly.")
-	sess, connID, err := s.handleInitialImpl(remoteAddr, hdr, data)
+	sess, connID, err := s.handleInitialImpl(remoteAddr, info, hdr, data, requireCookie)
 	if err != nil {
 		s.logger.Errorf("Error occurred handling initial packet: %s", err)
-		return
+		return false
 	}
 	if sess == nil { // a stateless reset was done
-		return
+		return false
 	}
 	s.sessionChan <- tlsSession{
-		connID: connID,
-		sess:   sess,
+		connID:      connID,
+		sess:        sess,
+		reservation: reservation,
 	}
+	return true
 }
 
 // will be set to s.newMintConn by the constructor
-func (s *serverTLS) newMintConnImpl(bc *handshake.CryptoStreamConn, v protocol.VersionNumber) (handshake.MintTLS, <-chan handshake.TransportParameters, error) {
-	extHandler := handshake.NewExtensionHandlerServer(s.params, s.config.Versions, v, s.logger)
+func (s *serverTLS) newMintConnImpl(bc *handshake.CryptoStreamConn, v protocol.VersionNumber, config *Config, params *handshake.TransportParameters) (handshake.MintTLS, <-chan handshake.TransportParameters, error) {
+	extHandler := handshake.NewExtensionHandlerServer(params, config.AcceptedVersions, v, s.logger)
 	conf := s.mintConf.Clone()
 	conf.ExtensionHandler = extHandler
+	if config.RequireCookie {
+		conf.CookieHandler = s.cookieHandler.RequireCookie()
+	}
 	return newMintController(bc, conf, protocol.PerspectiveServer), extHandler.GetPeerParams(), nil
 }
 
-func (s *serverTLS) sendConnectionClose(remoteAddr net.Addr, clientHdr *wire.Header, aead crypto.AEAD, closeErr error) error {
+func (s *serverTLS) sendConnectionClose(remoteAddr net.Addr, info packetInfo, clientHdr *wire.Header, aead crypto.AEAD, closeErr error) error {
 	ccf := &wire.ConnectionCloseFrame{
 		ErrorCode:    qerr.HandshakeFailed,
 		ReasonPhrase: closeErr.Error(),
@@ -131,23 +157,23 @@ func (s *serverTLS) sendConnectionClose(remoteAddr net.Addr, clientHdr *wire.Hea
 	if err != nil {
 		return err
 	}
-	_, err = s.conn.WriteTo(data, remoteAddr)
-	return err
+	return writePacket(s.conn, data, remoteAddr, info)
 }
 
-func (s *serverTLS) handleInitialImpl(remoteAddr net.Addr, hdr *wire.Header, data []byte) (packetHandler, protocol.ConnectionID, error) {
+func (s *serverTLS) handleInitialImpl(remoteAddr net.Addr, info packetInfo, hdr *wire.Header, data []byte, requireCookie bool) (packetHandler, protocol.ConnectionID, error) {
 	if len(hdr.Raw)+len(data) < protocol.MinInitialPacketSize {
 		return nil, nil, errors.New("dropping too small Initial packet")
 	}
 	// check version, if not matching send VNP
-	if !protocol.IsSupportedVersion(s.supportedVersions, hdr.Version) {
+	// new connections are only accepted for the accepted versions, which can be changed by setConfig
+	config, _ := s.getConfig()
+	if !protocol.IsSupportedVersion(config.AcceptedVersions, hdr.Version) {
 		s.logger.Debugf("Client offered version %s, sending VersionNegotiationPacket", hdr.Version)
-		vnp, err := wire.ComposeVersionNegotiation(hdr.SrcConnectionID, hdr.DestConnectionID, s.supportedVersions)
+		vnp, err := wire.ComposeVersionNegotiation(hdr.SrcConnectionID, hdr.DestConnectionID, config.AcceptedVersions)
 		if err != nil {
 			return nil, nil, err
 		}
-		_, err = s.conn.WriteTo(vnp, remoteAddr)
-		return nil, nil, err
+		return nil, nil, writePacket(s.conn, vnp, remoteAddr, info)
 	}
 
 	// unpack packet and check stream frame contents
@@ -160,9 +186,13 @@ func (s *serverTLS) handleInitialImpl(remoteAddr net.Addr, hdr *wire.Header, dat
 		s.logger.Debugf("Error unpacking initial packet: %s", err)
 		return nil, nil, nil
 	}
-	sess, connID, err := s.handleUnpackedInitial(remoteAddr, hdr, frame, aead)
+	helloInfo := &ClientHelloInfo{
+		Version:    hdr.Version,
+		PacketSize: len(hdr.Raw) + len(data),
+	}
+	sess, connID, err := s.handleUnpackedInitial(remoteAddr, info, hdr, helloInfo, frame, aead, requireCookie)
 	if err != nil {
-		if ccerr := s.sendConnectionClose(remoteAddr, hdr, aead, err); ccerr != nil {
+		if ccerr := s.sendConnectionClose(remoteAddr, info, hdr, aead, err); ccerr != nil {
 			s.logger.Debugf("Error sending CONNECTION_CLOSE: %s", ccerr)
 		}
 		return nil, nil, err
@@ -170,11 +200,27 @@ func (s *serverTLS) handleInitialImpl(remoteAddr net.Addr, hdr *wire.Header, dat
 	return sess, connID, nil
 }
 
-func (s *serverTLS) handleUnpackedInitial(remoteAddr net.Addr, hdr *wire.Header, frame *wire.StreamFrame, aead crypto.AEAD) (packetHandler, protocol.ConnectionID, error) {
+func (s *serverTLS) handleUnpackedInitial(remoteAddr net.Addr, info packetInfo, hdr *wire.Header, helloInfo *ClientHelloInfo, frame *wire.StreamFrame, aead crypto.AEAD, requireCookie bool) (packetHandler, protocol.ConnectionID, error) {
 	version := hdr.Version
 	bc := handshake.NewCryptoStreamConn(remoteAddr)
 	bc.AddDataForReading(frame.Data)
-	tls, paramsChan, err := s.newMintConn(bc, version)
+	// use the same config for the transport parameters and the session, even if it is replaced concurrently
+	config, ownParams := s.getConfig()
+	if requireCookie && !config.RequireCookie {
+		c := *config
+		c.RequireCookie = true
+		config = &c
+	}
+	// The connection ID has to be chosen before the handshake,
+	// since the stateless reset token (derived from the connection ID) is sent in the transport parameters.
+	connID, err := protocol.GenerateConnectionID(config.ConnectionIDLength)
+	if err != nil {
+		return nil, nil, err
+	}
+	params := *ownParams
+	token := s.sessionRunner.getStatelessResetToken(connID)
+	params.StatelessResetToken = &token
+	tls, paramsChan, err := s.newMintConn(bc, version, config, &params)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -199,8 +245,7 @@ func (s *serverTLS) handleUnpackedInitial(remoteAddr net.Addr, hdr *wire.Header,
 		if err != nil {
 			return nil, nil, err
 		}
-		_, err = s.conn.WriteTo(data, remoteAddr)
-		return nil, nil, err
+		return nil, nil, writePacket(s.conn, data, remoteAddr, info)
 	}
 	if alert != mint.AlertNoAlert {
 		return nil, nil, alert
@@ -214,23 +259,20 @@ func (s *serverTLS) handleUnpackedInitial(remoteAddr net.Addr, hdr *wire.Header,
 	if tls.State() != mint.StateServerWaitFlight2 {
 		return nil, nil, fmt.Errorf("Expected mint state to be %s, got %s", mint.StateServerWaitFlight2, tls.State())
 	}
-	params := <-paramsChan
-	connID, err := protocol.GenerateConnectionID()
-	if err != nil {
-		return nil, nil, err
-	}
+	peerParams := <-paramsChan
+	config = chooseCongestionControl(config, remoteAddr, helloInfo)
 	s.logger.Debugf("Changing source connection ID to %s.", connID)
 	sess, err := newTLSServerSession(
-		&conn{pconn: s.conn, currentAddr: remoteAddr},
+		&conn{pconn: s.conn, currentAddr: remoteAddr, info: info},
 		s.sessionRunner,
 		hdr.SrcConnectionID,
 		connID,
 		protocol.PacketNumber(1), // TODO: use a random packet number here
-		s.config,
+		config,
 		tls,
 		bc,
 		aead,
-		&params,
+		&peerParams,
 		version,
 		s.logger,
 	)
@@ -3,8 +3,10 @@ package quic
 import (
 	"bytes"
 	"io"
+	"net"
 
 	"github.com/bifurcation/mint"
+	"github.com/golang/mock/gomock"
 	"github.com/lucas-clemente/quic-go/internal/crypto"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/mocks"
@@ -27,6 +29,9 @@ var _ = Describe("Stateless TLS handling", func() {
 		mintTLS     *mockhandshake.MockMintTLS
 		extHandler  *mocks.MockTLSExtensionHandler
 		mintReply   io.Writer
+		ownParams   *handshake.TransportParameters
+
+		sessionRunner *MockSessionRunner
 	)
 
 	BeforeEach(func() {
@@ -34,13 +39,17 @@ var _ = Describe("Stateless TLS handling", func() {
 		extHandler = mocks.NewMockTLSExtensionHandler(mockCtrl)
 		conn = newMockPacketConn()
 		config := &Config{
-			Versions: []protocol.VersionNumber{protocol.VersionTLS},
+			Versions:         []protocol.VersionNumber{protocol.VersionTLS},
+			AcceptedVersions: []protocol.VersionNumber{protocol.VersionTLS},
 		}
+		sessionRunner = NewMockSessionRunner(mockCtrl)
+		sessionRunner.EXPECT().getStatelessResetToken(gomock.Any()).Return([16]byte{0xde, 0xca, 0xfb, 0xad}).AnyTimes()
 		var err error
-		server, sessionChan, err = newServerTLS(conn, config, nil, nil, testdata.GetTLSConfig(), utils.DefaultLogger)
+		server, sessionChan, err = newServerTLS(conn, config, sessionRunner, nil, nil, testdata.GetTLSConfig(), utils.DefaultLogger)
 		Expect(err).ToNot(HaveOccurred())
-		server.newMintConn = func(bc *handshake.CryptoStreamConn, v protocol.VersionNumber) (handshake.MintTLS, <-chan handshake.TransportParameters, error) {
+		server.newMintConn = func(bc *handshake.CryptoStreamConn, v protocol.VersionNumber, _ *Config, params *handshake.TransportParameters) (handshake.MintTLS, <-chan handshake.TransportParameters, error) {
 			mintReply = bc
+			ownParams = params
 			return mintTLS, extHandler.GetPeerParams(), nil
 		}
 	})
@@ -71,7 +80,7 @@ var _ = Describe("Stateless TLS handling", func() {
 
 	unpackPacket := func(data []byte) (*wire.Header, []byte) {
 		r := bytes.NewReader(conn.dataWritten.Bytes())
-		hdr, err := wire.ParseHeaderSentByServer(r)
+		hdr, err := wire.ParseHeaderSentByServer(r, protocol.ConnectionIDLen)
 		Expect(err).ToNot(HaveOccurred())
 		hdr.Raw = data[:len(data)-r.Len()]
 		aead, err := crypto.NewNullAEAD(protocol.PerspectiveClient, hdr.SrcConnectionID, protocol.VersionTLS)
@@ -81,30 +90,68 @@ var _ = Describe("Stateless TLS handling", func() {
 		return hdr, payload
 	}
 
+	It("uses the initial flow control windows from the config", func() {
+		config := populateServerConfig(&Config{
+			Versions:                                  []protocol.VersionNumber{protocol.VersionTLS},
+			InitialReceiveStreamFlowControlWindow:     0x1234,
+			InitialReceiveConnectionFlowControlWindow: 0x4321,
+		})
+		s, _, err := newServerTLS(conn, config, nil, nil, nil, testdata.GetTLSConfig(), utils.DefaultLogger)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s.params.StreamFlowControlWindow).To(Equal(protocol.ByteCount(0x1234)))
+		Expect(s.params.ConnectionFlowControlWindow).To(Equal(protocol.ByteCount(0x4321)))
+	})
+
+	It("announces the features from the config", func() {
+		config := populateServerConfig(&Config{
+			Versions: []protocol.VersionNumber{protocol.VersionTLS},
+			Features: []Feature{FeatureAckFrequency},
+		})
+		s, _, err := newServerTLS(conn, config, nil, nil, nil, testdata.GetTLSConfig(), utils.DefaultLogger)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s.params.Features).To(Equal(protocol.NewFeatureSet(protocol.FeatureAckFrequency)))
+	})
+
 	It("sends a version negotiation packet if it doesn't support the version", func() {
 		hdr := &wire.Header{
 			DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
 			SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
 			Version:          0x1337,
 		}
-		server.HandleInitial(nil, hdr, bytes.Repeat([]byte{0}, protocol.MinInitialPacketSize))
+		server.HandleInitial(nil, packetInfo{}, hdr, bytes.Repeat([]byte{0}, protocol.MinInitialPacketSize), false, nil)
 		Expect(conn.dataWritten.Len()).ToNot(BeZero())
-		hdr, err := wire.ParseHeaderSentByServer(bytes.NewReader(conn.dataWritten.Bytes()))
+		hdr, err := wire.ParseHeaderSentByServer(bytes.NewReader(conn.dataWritten.Bytes()), protocol.ConnectionIDLen)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(hdr.IsVersionNegotiation).To(BeTrue())
 		Expect(sessionChan).ToNot(Receive())
 	})
 
+	It("sends a version negotiation packet if the version is not accepted", func() {
+		server.setConfig(&Config{
+			Versions:         []protocol.VersionNumber{protocol.VersionTLS, protocol.Version39},
+			AcceptedVersions: []protocol.VersionNumber{protocol.Version39},
+		})
+		hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+		server.HandleInitial(nil, packetInfo{}, hdr, data, false, nil)
+		Expect(conn.dataWritten.Len()).ToNot(BeZero())
+		replyHdr, err := wire.ParseHeaderSentByServer(bytes.NewReader(conn.dataWritten.Bytes()), protocol.ConnectionIDLen)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(replyHdr.IsVersionNegotiation).To(BeTrue())
+		Expect(replyHdr.SupportedVersions).To(ContainElement(protocol.Version39))
+		Expect(replyHdr.SupportedVersions).ToNot(ContainElement(protocol.VersionTLS))
+		Expect(sessionChan).ToNot(Receive())
+	})
+
 	It("drops too small packets", func() {
 		hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
 		data = data[:len(data)-1] // the packet is now 1 byte too small
-		server.HandleInitial(nil, hdr, data)
+		server.HandleInitial(nil, packetInfo{}, hdr, data, false, nil)
 		Expect(conn.dataWritten.Len()).To(BeZero())
 	})
 
 	It("ignores packets with invalid contents", func() {
 		hdr, data := getPacket(&wire.StreamFrame{StreamID: 10, Offset: 11, Data: []byte("foobar")})
-		server.HandleInitial(nil, hdr, data)
+		server.HandleInitial(nil, packetInfo{}, hdr, data, false, nil)
 		Expect(conn.dataWritten.Len()).To(BeZero())
 		Expect(sessionChan).ToNot(Receive())
 	})
@@ -115,10 +162,10 @@ var _ = Describe("Stateless TLS handling", func() {
 			mintReply.Write([]byte("Retry with this Cookie"))
 		})
 		hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
-		server.HandleInitial(nil, hdr, data)
+		server.HandleInitial(nil, packetInfo{}, hdr, data, false, nil)
 		Expect(conn.dataWritten.Len()).ToNot(BeZero())
 		r := bytes.NewReader(conn.dataWritten.Bytes())
-		replyHdr, err := wire.ParseHeaderSentByServer(r)
+		replyHdr, err := wire.ParseHeaderSentByServer(r, protocol.ConnectionIDLen)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(replyHdr.Type).To(Equal(protocol.PacketTypeRetry))
 		Expect(replyHdr.SrcConnectionID).To(Equal(hdr.DestConnectionID))
@@ -141,7 +188,7 @@ var _ = Describe("Stateless TLS handling", func() {
 		done := make(chan struct{})
 		go func() {
 			defer GinkgoRecover()
-			server.HandleInitial(nil, hdr, data)
+			server.HandleInitial(nil, packetInfo{}, hdr, data, false, nil)
 			// the Handshake packet is written by the session
 			Expect(conn.dataWritten.Len()).To(BeZero())
 			close(done)
@@ -152,13 +199,62 @@ var _ = Describe("Stateless TLS handling", func() {
 		Expect(tlsSess.connID).ToNot(Equal(hdr.SrcConnectionID))
 		Expect(tlsSess.connID).ToNot(Equal(hdr.DestConnectionID))
 		Eventually(done).Should(BeClosed())
+		// the stateless reset token is sent in the transport parameters
+		Expect(ownParams.StatelessResetToken).To(Equal(&[16]byte{0xde, 0xca, 0xfb, 0xad}))
+		Expect(server.params.StatelessResetToken).To(BeNil())
+	})
+
+	It("uses the congestion control algorithm chosen by the ChooseCongestionControl callback", func() {
+		var info *ClientHelloInfo
+		server.setConfig(&Config{
+			Versions:         []protocol.VersionNumber{protocol.VersionTLS},
+			AcceptedVersions: []protocol.VersionNumber{protocol.VersionTLS},
+			ChooseCongestionControl: func(_ net.Addr, i *ClientHelloInfo) CongestionControlAlgorithm {
+				info = i
+				return CongestionControlNewReno
+			},
+		})
+		mintTLS.EXPECT().Handshake().Return(mint.AlertNoAlert)
+		mintTLS.EXPECT().Handshake().Return(mint.AlertNoAlert)
+		mintTLS.EXPECT().State().Return(mint.StateServerNegotiated)
+		mintTLS.EXPECT().State().Return(mint.StateServerWaitFlight2)
+		paramsChan := make(chan handshake.TransportParameters, 1)
+		paramsChan <- handshake.TransportParameters{}
+		extHandler.EXPECT().GetPeerParams().Return(paramsChan)
+		hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+		go func() {
+			defer GinkgoRecover()
+			server.HandleInitial(nil, packetInfo{}, hdr, data, false, nil)
+		}()
+		var tlsSess tlsSession
+		Eventually(sessionChan).Should(Receive(&tlsSess))
+		Expect(info.Version).To(Equal(protocol.VersionTLS))
+		Expect(info.PacketSize).To(Equal(len(hdr.Raw) + len(data)))
+		Expect(tlsSess.sess.(*session).config.CongestionControl).To(Equal(CongestionControlNewReno))
+	})
+
+	It("requires a Cookie, if requested", func() {
+		var conf *Config
+		server.newMintConn = func(bc *handshake.CryptoStreamConn, v protocol.VersionNumber, c *Config, params *handshake.TransportParameters) (handshake.MintTLS, <-chan handshake.TransportParameters, error) {
+			mintReply = bc
+			conf = c
+			return mintTLS, extHandler.GetPeerParams(), nil
+		}
+		extHandler.EXPECT().GetPeerParams()
+		mintTLS.EXPECT().Handshake().Return(mint.AlertStatelessRetry)
+		hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+		server.HandleInitial(nil, packetInfo{}, hdr, data, true, nil)
+		Expect(conf.RequireCookie).To(BeTrue())
+		// the config used for new sessions is not modified
+		c, _ := server.getConfig()
+		Expect(c.RequireCookie).To(BeFalse())
 	})
 
 	It("sends a CONNECTION_CLOSE, if mint returns an error", func() {
 		mintTLS.EXPECT().Handshake().Return(mint.AlertAccessDenied)
 		extHandler.EXPECT().GetPeerParams()
 		hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
-		server.HandleInitial(nil, hdr, data)
+		server.HandleInitial(nil, packetInfo{}, hdr, data, false, nil)
 		// the Handshake packet is written by the session
 		Expect(conn.dataWritten.Bytes()).ToNot(BeEmpty())
 		// unpack the packet to check that it actually contains a CONNECTION_CLOSE
@@ -0,0 +1,73 @@
+package quic
+
+import (
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// The serverVersionCache remembers the versions that a server announced during the handshake.
+// When dialing the same host again, the client starts with the version it would have negotiated,
+// instead of using the first version in Config.Versions and relying on version negotiation.
+type serverVersionCache struct {
+	mutex sync.Mutex
+
+	maxSize int
+	// hosts is ordered by the time the versions were recorded, oldest first
+	hosts    []string
+	versions map[string][]protocol.VersionNumber
+}
+
+// the cache shared by all clients
+var serverVersions = newServerVersionCache(protocol.MaxServerVersionCacheSize)
+
+func newServerVersionCache(maxSize int) *serverVersionCache {
+	return &serverVersionCache{
+		maxSize:  maxSize,
+		versions: make(map[string][]protocol.VersionNumber),
+	}
+}
+
+// Add records the versions supported by a host.
+// If the cache is full, the oldest entry is evicted.
+func (c *serverVersionCache) Add(host string, versions []protocol.VersionNumber) {
+	if len(versions) == 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.versions[host]; ok {
+		c.remove(host)
+	} else if len(c.hosts) >= c.maxSize {
+		c.remove(c.hosts[0])
+	}
+	c.hosts = append(c.hosts, host)
+	c.versions[host] = versions
+}
+
+func (c *serverVersionCache) remove(host string) {
+	delete(c.versions, host)
+	for i, h := range c.hosts {
+		if h == host {
+			c.hosts = append(c.hosts[:i], c.hosts[i+1:]...)
+			return
+		}
+	}
+}
+
+// ChooseVersion chooses the version to use when dialing a host.
+// It returns the first of our versions that the host announced the last time we connected to it,
+// and the first of our versions if the host is not in the cache, or doesn't support any of our versions.
+func (c *serverVersionCache) ChooseVersion(host string, ourVersions []protocol.VersionNumber) protocol.VersionNumber {
+	c.mutex.Lock()
+	theirVersions, ok := c.versions[host]
+	c.mutex.Unlock()
+
+	if ok {
+		if v, ok := protocol.ChooseSupportedVersion(ourVersions, theirVersions); ok {
+			return v
+		}
+	}
+	return ourVersions[0]
+}
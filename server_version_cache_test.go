@@ -0,0 +1,57 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server Version Cache", func() {
+	var c *serverVersionCache
+
+	ourVersions := []protocol.VersionNumber{10, 11, 12}
+
+	BeforeEach(func() {
+		c = newServerVersionCache(2)
+	})
+
+	It("uses our first version for unknown hosts", func() {
+		Expect(c.ChooseVersion("foo:443", ourVersions)).To(Equal(protocol.VersionNumber(10)))
+	})
+
+	It("chooses our preferred version of the versions the host supports", func() {
+		c.Add("foo:443", []protocol.VersionNumber{13, 12, 11})
+		Expect(c.ChooseVersion("foo:443", ourVersions)).To(Equal(protocol.VersionNumber(11)))
+		Expect(c.ChooseVersion("bar:443", ourVersions)).To(Equal(protocol.VersionNumber(10)))
+	})
+
+	It("uses our first version if the host doesn't support any of our versions", func() {
+		c.Add("foo:443", []protocol.VersionNumber{13, 14})
+		Expect(c.ChooseVersion("foo:443", ourVersions)).To(Equal(protocol.VersionNumber(10)))
+	})
+
+	It("replaces the versions of a host", func() {
+		c.Add("foo:443", []protocol.VersionNumber{11})
+		c.Add("foo:443", []protocol.VersionNumber{12})
+		Expect(c.ChooseVersion("foo:443", ourVersions)).To(Equal(protocol.VersionNumber(12)))
+		Expect(c.hosts).To(Equal([]string{"foo:443"}))
+	})
+
+	It("doesn't add empty version lists", func() {
+		c.Add("foo:443", []protocol.VersionNumber{11})
+		c.Add("foo:443", nil)
+		Expect(c.ChooseVersion("foo:443", ourVersions)).To(Equal(protocol.VersionNumber(11)))
+	})
+
+	It("evicts the oldest host when it is full", func() {
+		c.Add("foo:443", []protocol.VersionNumber{11})
+		c.Add("bar:443", []protocol.VersionNumber{11})
+		c.Add("foo:443", []protocol.VersionNumber{12}) // moves foo to the end
+		c.Add("baz:443", []protocol.VersionNumber{11})
+		Expect(c.hosts).To(Equal([]string{"foo:443", "baz:443"}))
+		Expect(c.versions).To(HaveLen(2))
+		Expect(c.ChooseVersion("bar:443", ourVersions)).To(Equal(protocol.VersionNumber(10)))
+		Expect(c.ChooseVersion("foo:443", ourVersions)).To(Equal(protocol.VersionNumber(12)))
+	})
+})
@@ -3,12 +3,17 @@ package quic
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
+	"runtime/pprof"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/lucas-clemente/quic-go/internal/ackhandler"
 	"github.com/lucas-clemente/quic-go/internal/congestion"
@@ -40,6 +45,8 @@ type streamManager interface {
 	AcceptStream() (Stream, error)
 	AcceptUniStream() (ReceiveStream, error)
 	DeleteStream(protocol.StreamID) error
+	// NumStreams returns the number of streams that haven't been completed yet
+	NumStreams() int
 	UpdateLimits(*handshake.TransportParameters)
 	HandleMaxStreamIDFrame(*wire.MaxStreamIDFrame) error
 	CloseWithError(error)
@@ -48,6 +55,7 @@ type streamManager interface {
 type cryptoStreamHandler interface {
 	HandleCryptoStream() error
 	ConnectionState() handshake.ConnectionState
+	DiscardEarlyKeys()
 }
 
 type divNonceSetter interface {
@@ -59,6 +67,22 @@ type receivedPacket struct {
 	header     *wire.Header
 	data       []byte
 	rcvTime    time.Time
+	ecn        protocol.ECN
+	ttl        uint8
+	// buffer is the buffer from the buffer pool that the packet was read into.
+	// The header and the data of the packet point into this buffer.
+	// It is nil if the packet isn't backed by a buffer from the pool.
+	buffer *[]byte
+}
+
+// release returns the buffer of the packet to the buffer pool.
+// It must be called once the packet was processed (or dropped), and the header and the data are not used any more.
+func (p *receivedPacket) release() {
+	if p.buffer == nil {
+		return
+	}
+	putPacketBuffer(p.buffer)
+	p.buffer = nil
 }
 
 var (
@@ -66,17 +90,44 @@ var (
 	newCryptoSetupClient = handshake.NewCryptoSetupClient
 )
 
+type migration struct {
+	pconn net.PacketConn
+	done  chan struct{}
+}
+
 type closeError struct {
 	err    error
 	remote bool
 }
 
+// An applicationError is the error of a session that was closed using CloseWithError, either locally or by the peer.
+type applicationError struct {
+	errorCode protocol.ApplicationErrorCode
+	reason    string
+	remote    bool
+}
+
+var _ ApplicationError = &applicationError{}
+
+func (e *applicationError) Error() string {
+	if e.remote {
+		return fmt.Sprintf("Session closed by the peer with application error %d: %s", e.errorCode, e.reason)
+	}
+	return fmt.Sprintf("Session closed with application error %d: %s", e.errorCode, e.reason)
+}
+
+func (e *applicationError) ErrorCode() ErrorCode { return e.errorCode }
+func (e *applicationError) Reason() string       { return e.reason }
+func (e *applicationError) Remote() bool         { return e.remote }
+
 // A Session is a QUIC session
 type session struct {
 	sessionRunner sessionRunner
 
 	destConnID protocol.ConnectionID
 	srcConnID  protocol.ConnectionID
+	// correlationID identifies the session in the logs, see getCorrelationID
+	correlationID string
 
 	perspective protocol.Perspective
 	version     protocol.VersionNumber
@@ -93,7 +144,20 @@ type session struct {
 	receivedPacketHandler ackhandler.ReceivedPacketHandler
 	streamFramer          *streamFramer
 	windowUpdateQueue     *windowUpdateQueue
+	retransmissionQueue   *retransmissionQueue
 	connFlowController    flowcontrol.ConnectionFlowController
+	reassemblyLimiter     *reassemblyLimiter
+	pathValidator         *pathValidator
+	connIDGenerator       *connIDGenerator
+	connIDManager         *connIDManager
+	// streamAccounting is only set if the OnStreamCompleted callback is used
+	streamAccounting *streamAccounting
+	// mtuDiscoverer is only set if Path MTU Discovery is enabled, and supported by the connection
+	mtuDiscoverer *mtuDiscoverer
+	// packets rejected by the kernel with EMSGSIZE are reported by the send queue, and handled by the run loop
+	packetTooLargeChan chan packetTooLarge
+	// invariants is only set when building with the quic_invariants build tag
+	invariants *invariantChecker
 
 	unpacker unpacker
 	packer   *packetPacker
@@ -101,7 +165,17 @@ type session struct {
 	cryptoStreamHandler cryptoStreamHandler
 
 	receivedPackets  chan *receivedPacket
+	sendQueue        *sendQueue
 	sendingScheduled chan struct{}
+	// streamDataScheduled signals that stream data is ready for sending.
+	// If Config.SendCoalescingDelay is set, sending this data is delayed.
+	streamDataScheduled chan struct{}
+	// migrations are handled by the run loop, see Migrate
+	migrationChan chan migration
+	// changes of the idle timeout are handled by the run loop, see SetIdleTimeout
+	idleTimeoutChan chan time.Duration
+	// handshakeConfirmedChan is closed as soon as we know that the peer completed the handshake
+	handshakeConfirmedChan chan struct{}
 	// closeChan is used to notify the run loop that it should terminate.
 	closeChan chan closeError
 	closeOnce sync.Once
@@ -112,6 +186,7 @@ type session struct {
 	// when we receive too many undecryptable packets during the handshake, we send a Public reset
 	// but only after a time of protocol.PublicResetTimeout has passed
 	undecryptablePackets                   []*receivedPacket
+	undecryptablePacketBytes               uint64
 	receivedTooManyUndecrytablePacketsTime time.Time
 
 	// this channel is passed to the CryptoSetup and receives the transport parameters, as soon as the peer sends them
@@ -130,15 +205,44 @@ type session struct {
 
 	sessionCreationTime     time.Time
 	lastNetworkActivityTime time.Time
+	// idleTimeout is our idle timeout, it can be changed using SetIdleTimeout
+	idleTimeout time.Duration
 	// pacingDeadline is the time when the next packet should be sent
 	pacingDeadline time.Time
+	// numUnpacedPackets is the number of packets sent before the pacing deadline, see maybeSendUnpacedPacket
+	numUnpacedPackets int
+	// coalescingDeadline is the time when delayed stream data should be sent, see Config.SendCoalescingDelay
+	coalescingDeadline time.Time
 
 	peerParams *handshake.TransportParameters
+	// peerFeatures and serverSupportedVersions (client only) were announced by the peer during the handshake.
+	// They are set from the run loop, but read by ConnectionState.
+	peerAnnouncementsMutex  sync.Mutex
+	peerFeatures            protocol.FeatureSet
+	serverSupportedVersions []protocol.VersionNumber
+	// receivedTTL is the TTL of the last packet received from the peer.
+	// It is accessed atomically, since it is set from the run loop, but read by ConnectionState.
+	receivedTTL uint32
+
+	statsMutex sync.Mutex
+	stats      SessionStats
+	// congestionState is saved when the session is closed
+	congestionState *CongestionState
+	// connBlockedSince is set when sending becomes blocked by connection-level flow control
+	connBlockedSince time.Time
 
 	timer *utils.Timer
 	// keepAlivePingSent stores whether a Ping frame was sent to the peer or not
 	// it is reset as soon as we receive a packet from the peer
 	keepAlivePingSent bool
+	// ecnEnabled is set while outgoing packets are marked with ECT(0)
+	ecnEnabled bool
+
+	// frameHistory is only used when the application asked for a DiagnosticSnapshot
+	frameHistory *frameHistory
+
+	userDataMutex sync.Mutex
+	userData      interface{}
 
 	logger utils.Logger
 }
@@ -173,10 +277,11 @@ func newSession(
 	}
 	s.preSetup()
 	transportParams := &handshake.TransportParameters{
-		StreamFlowControlWindow:     protocol.ReceiveStreamFlowControlWindow,
-		ConnectionFlowControlWindow: protocol.ReceiveConnectionFlowControlWindow,
+		StreamFlowControlWindow:     protocol.ByteCount(s.config.InitialReceiveStreamFlowControlWindow),
+		ConnectionFlowControlWindow: protocol.ByteCount(s.config.InitialReceiveConnectionFlowControlWindow),
 		MaxStreams:                  uint32(s.config.MaxIncomingStreams),
 		IdleTimeout:                 s.config.IdleTimeout,
+		Features:                    protocol.NewFeatureSet(s.config.Features...),
 	}
 	divNonce := make([]byte, 32)
 	if _, err := rand.Read(divNonce); err != nil {
@@ -190,7 +295,7 @@ func newSession(
 		divNonce,
 		scfg,
 		transportParams,
-		s.config.Versions,
+		s.config.AcceptedVersions,
 		s.config.AcceptCookie,
 		paramsChan,
 		handshakeEvent,
@@ -202,13 +307,15 @@ func newSession(
 	s.cryptoStreamHandler = cs
 	s.unpacker = newPacketUnpackerGQUIC(cs, s.version)
 	s.streamsMap = newStreamsMapLegacy(s.newStream, s.config.MaxIncomingStreams, s.perspective)
-	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, s.version)
+	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, s.config.StreamCoalescing, s.version)
 	s.packer = newPacketPacker(
 		connectionID,
 		connectionID,
 		1,
 		s.sentPacketHandler.GetPacketNumberLen,
 		s.RemoteAddr(),
+		protocol.ByteCount(s.config.InitialPacketSize),
+		protocol.ByteCount(s.config.MaxPacketSize),
 		divNonce,
 		cs,
 		s.streamFramer,
@@ -247,10 +354,11 @@ var newClientSession = func(
 	}
 	s.preSetup()
 	transportParams := &handshake.TransportParameters{
-		StreamFlowControlWindow:     protocol.ReceiveStreamFlowControlWindow,
-		ConnectionFlowControlWindow: protocol.ReceiveConnectionFlowControlWindow,
+		StreamFlowControlWindow:     protocol.ByteCount(s.config.InitialReceiveStreamFlowControlWindow),
+		ConnectionFlowControlWindow: protocol.ByteCount(s.config.InitialReceiveConnectionFlowControlWindow),
 		MaxStreams:                  uint32(s.config.MaxIncomingStreams),
 		IdleTimeout:                 s.config.IdleTimeout,
+		Features:                    protocol.NewFeatureSet(s.config.Features...),
 		OmitConnectionID:            s.config.RequestConnectionIDOmission,
 	}
 	cs, err := newCryptoSetupClient(
@@ -272,13 +380,15 @@ var newClientSession = func(
 	s.cryptoStreamHandler = cs
 	s.unpacker = newPacketUnpackerGQUIC(cs, s.version)
 	s.streamsMap = newStreamsMapLegacy(s.newStream, s.config.MaxIncomingStreams, s.perspective)
-	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, s.version)
+	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, s.config.StreamCoalescing, s.version)
 	s.packer = newPacketPacker(
 		connectionID,
 		connectionID,
 		1,
 		s.sentPacketHandler.GetPacketNumberLen,
 		s.RemoteAddr(),
+		protocol.ByteCount(s.config.InitialPacketSize),
+		protocol.ByteCount(s.config.MaxPacketSize),
 		nil, // no diversification nonce
 		cs,
 		s.streamFramer,
@@ -323,14 +433,16 @@ func newTLSServerSession(
 		v,
 	)
 	s.cryptoStreamHandler = cs
-	s.streamsMap = newStreamsMap(s, s.newFlowController, s.config.MaxIncomingStreams, s.config.MaxIncomingUniStreams, s.perspective, s.version)
-	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, s.version)
+	s.streamsMap = newStreamsMap(s, s.newFlowController, s.reassemblyLimiter, s.config.MaxIncomingStreams, s.config.MaxIncomingUniStreams, s.perspective, s.version)
+	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, s.config.StreamCoalescing, s.version)
 	s.packer = newPacketPacker(
 		s.destConnID,
 		s.srcConnID,
 		initialPacketNumber,
 		s.sentPacketHandler.GetPacketNumberLen,
 		s.RemoteAddr(),
+		protocol.ByteCount(s.config.InitialPacketSize),
+		protocol.ByteCount(s.config.MaxPacketSize),
 		nil, // no diversification nonce
 		cs,
 		s.streamFramer,
@@ -388,14 +500,16 @@ var newTLSClientSession = func(
 	}
 	s.cryptoStreamHandler = cs
 	s.unpacker = newPacketUnpacker(cs, s.version)
-	s.streamsMap = newStreamsMap(s, s.newFlowController, s.config.MaxIncomingStreams, s.config.MaxIncomingUniStreams, s.perspective, s.version)
-	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, s.version)
+	s.streamsMap = newStreamsMap(s, s.newFlowController, s.reassemblyLimiter, s.config.MaxIncomingStreams, s.config.MaxIncomingUniStreams, s.perspective, s.version)
+	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, s.config.StreamCoalescing, s.version)
 	s.packer = newPacketPacker(
 		s.destConnID,
 		s.srcConnID,
 		initialPacketNumber,
 		s.sentPacketHandler.GetPacketNumberLen,
 		s.RemoteAddr(),
+		protocol.ByteCount(s.config.InitialPacketSize),
+		protocol.ByteCount(s.config.MaxPacketSize),
 		nil, // no diversification nonce
 		cs,
 		s.streamFramer,
@@ -406,23 +520,69 @@ var newTLSClientSession = func(
 }
 
 func (s *session) preSetup() {
+	if s.perspective == protocol.PerspectiveClient {
+		s.correlationID = getCorrelationID(s.srcConnID)
+	} else {
+		s.correlationID = getCorrelationID(s.destConnID)
+	}
+	s.logger = s.logger.WithPrefix(s.correlationID)
 	s.rttStats = &congestion.RTTStats{}
-	s.sentPacketHandler = ackhandler.NewSentPacketHandler(s.rttStats, s.logger)
+	s.sentPacketHandler = ackhandler.NewSentPacketHandler(
+		s.rttStats,
+		s.config.CongestionControl,
+		s.config.CongestionWindowDecay,
+		ackhandler.HandshakeRetransmissionPolicy{
+			MinTimeout:         s.config.HandshakeRetransmissionTimeout,
+			Backoff:            s.config.HandshakeRetransmissionBackoff,
+			MaxRetransmissions: s.config.MaxHandshakeRetransmissions,
+		},
+		s.onPacketSizeResult,
+		s.logger,
+	)
+	if s.config.ResumeCongestionState != nil {
+		s.resumeCongestionState(s.config.ResumeCongestionState)
+	}
+	if !s.config.DisablePathMTUDiscovery && s.conn.EnableMTUDiscovery() {
+		s.mtuDiscoverer = newMTUDiscoverer(s.rttStats)
+	}
+	var limitWindowGrowth func() bool
+	if s.config.LimitReceiveWindowGrowth != nil {
+		limitWindowGrowth = func() bool { return s.config.LimitReceiveWindowGrowth(s) }
+	}
 	s.connFlowController = flowcontrol.NewConnectionFlowController(
-		protocol.ReceiveConnectionFlowControlWindow,
+		protocol.ByteCount(s.config.InitialReceiveConnectionFlowControlWindow),
 		protocol.ByteCount(s.config.MaxReceiveConnectionFlowControlWindow),
 		s.onHasConnectionWindowUpdate,
+		limitWindowGrowth,
 		s.rttStats,
 		s.logger,
 	)
+	if invariantChecksEnabled {
+		s.invariants = newInvariantChecker(s.version, s.connFlowController, s.reportInvariantViolation)
+	}
+	s.reassemblyLimiter = newReassemblyLimiter(
+		protocol.ByteCount(s.config.MaxStreamReassemblyBuffer),
+		protocol.ByteCount(s.config.MaxConnectionReassemblyBuffer),
+	)
+	s.pathValidator = newPathValidator(s.config.PathValidationTimeout, s.config.MaxPathValidationProbes)
+	if s.config.OnStreamCompleted != nil {
+		s.streamAccounting = newStreamAccounting(func(r StreamRecord) { s.config.OnStreamCompleted(s, r) })
+	}
+	s.idleTimeout = s.config.IdleTimeout
 	s.cryptoStream = s.newCryptoStream()
 }
 
 func (s *session) postSetup() error {
 	s.receivedPackets = make(chan *receivedPacket, protocol.MaxSessionUnprocessedPackets)
 	s.closeChan = make(chan closeError, 1)
+	s.sendQueue = newSendQueue(s.conn, s.config.MaxTransientWriteErrors, s.scheduleSending, s.onPacketTooLarge)
+	s.packetTooLargeChan = make(chan packetTooLarge, 1)
 	s.sendingScheduled = make(chan struct{}, 1)
-	s.undecryptablePackets = make([]*receivedPacket, 0, protocol.MaxUndecryptablePackets)
+	s.streamDataScheduled = make(chan struct{}, 1)
+	s.migrationChan = make(chan migration)
+	s.idleTimeoutChan = make(chan time.Duration)
+	s.handshakeConfirmedChan = make(chan struct{})
+	s.undecryptablePackets = make([]*receivedPacket, 0, s.config.MaxUndecryptablePackets)
 	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
 
 	s.timer = utils.NewTimer()
@@ -430,20 +590,66 @@ func (s *session) postSetup() error {
 	s.lastNetworkActivityTime = now
 	s.sessionCreationTime = now
 
-	s.receivedPacketHandler = ackhandler.NewReceivedPacketHandler(s.rttStats, s.logger, s.version)
+	s.receivedPacketHandler = ackhandler.NewReceivedPacketHandler(s.rttStats, s.config.AckPolicy, s.logger, s.version)
 	s.windowUpdateQueue = newWindowUpdateQueue(s.streamsMap, s.cryptoStream, s.connFlowController, s.packer.QueueControlFrame)
+	s.retransmissionQueue = newRetransmissionQueue()
+	s.packer.SetPaddingPolicy(s.config.Padding)
+	s.sentPacketHandler.SetMaxPacketSize(s.packer.MaxPacketSize())
+	s.connIDGenerator = newConnIDGenerator(
+		s.srcConnID,
+		s.config.ConnectionIDLength,
+		s.config.ConnectionIDCount,
+		func(connID protocol.ConnectionID) { s.sessionRunner.addConnectionID(connID, s) },
+		func(connID protocol.ConnectionID) { s.sessionRunner.removeConnectionID(connID) },
+		func(connID protocol.ConnectionID) [16]byte { return s.sessionRunner.getStatelessResetToken(connID) },
+		s.queueControlFrame,
+	)
+	s.connIDManager = newConnIDManager(
+		func(connID protocol.ConnectionID) {
+			s.destConnID = connID
+			s.packer.ChangeDestConnectionID(connID)
+		},
+		func(token [16]byte) { s.sessionRunner.addResetToken(token) },
+		func(token [16]byte) { s.sessionRunner.removeResetToken(token) },
+		s.queueControlFrame,
+	)
+	if s.config.OnClose != nil {
+		s.frameHistory = newFrameHistory(protocol.DiagnosticFrameHistorySize)
+	}
+	s.maybeEnableECN()
+	s.conn.SetDSCP(s.config.DSCP)
+	s.conn.SetTTL(s.config.TTL)
 	return nil
 }
 
+// maybeEnableECN starts marking packets with ECT(0), if ECN is enabled in the config and the connection supports it.
+func (s *session) maybeEnableECN() {
+	// gQUIC ACK frames can't carry ECN counts, so the marks couldn't be validated
+	if !s.config.EnableECN || !s.version.UsesIETFFrameFormat() || !s.conn.EnableECN() {
+		return
+	}
+	s.sentPacketHandler.EnableECN()
+	s.conn.SetECN(protocol.ECT0)
+	s.ecnEnabled = true
+}
+
 // run the session main loop
 func (s *session) run() error {
 	defer s.ctxCancel()
 
+	// The go routine running the crypto stream inherits these labels.
+	pprof.SetGoroutineLabels(pprof.WithLabels(s.ctx, s.profilingLabels("handshake")))
+
 	go func() {
 		if err := s.cryptoStreamHandler.HandleCryptoStream(); err != nil {
 			s.Close(err)
 		}
 	}()
+	go func() {
+		if err := s.sendQueue.Run(); err != nil {
+			s.closeLocal(err)
+		}
+	}()
 
 	var closeErr closeError
 
@@ -460,6 +666,7 @@ runLoop:
 		default:
 		}
 
+		s.updateNetworkStats()
 		s.maybeResetTimer()
 
 		select {
@@ -472,6 +679,17 @@ runLoop:
 		case <-s.sendingScheduled:
 			// We do all the interesting stuff after the switch statement, so
 			// nothing to see here.
+		case <-s.streamDataScheduled:
+			// Wait for more stream data, such that it can be sent in fewer packets.
+			// Anything else that makes us send a packet before the deadline also sends this data.
+			if delay := s.config.SendCoalescingDelay; delay > 0 && s.handshakeComplete {
+				if s.coalescingDeadline.IsZero() {
+					s.coalescingDeadline = time.Now().Add(delay)
+				}
+				if time.Now().Before(s.coalescingDeadline) {
+					continue
+				}
+			}
 		case p := <-s.receivedPackets:
 			err := s.handlePacketImpl(p)
 			if err != nil {
@@ -479,14 +697,22 @@ runLoop:
 					s.tryQueueingUndecryptablePacket(p)
 					continue
 				}
+				p.release()
 				s.closeLocal(err)
 				continue
 			}
-			// This is a bit unclean, but works properly, since the packet always
-			// begins with the public header and we never copy it.
-			putPacketBuffer(&p.header.Raw)
+			p.release()
 		case p := <-s.paramsChan:
 			s.processTransportParameters(&p)
+		case m := <-s.migrationChan:
+			s.migrate(m.pconn)
+			close(m.done)
+		case p := <-s.packetTooLargeChan:
+			if err := s.handlePacketTooLarge(p.size, p.mtuProbe); err != nil {
+				s.closeLocal(err)
+			}
+		case t := <-s.idleTimeoutChan:
+			s.idleTimeout = t
 		case _, ok := <-s.handshakeEvent:
 			// when the handshake is completed, the channel will be closed
 			s.handleHandshakeEvent(!ok)
@@ -500,12 +726,17 @@ runLoop:
 				s.closeLocal(err)
 			}
 		}
+		if timeout := s.pathValidator.GetAlarmTimeout(); !timeout.IsZero() && !timeout.After(now) {
+			if err := s.onPathValidationAlarm(now); err != nil {
+				s.closeLocal(err)
+			}
+		}
 
 		var pacingDeadline time.Time
 		if s.pacingDeadline.IsZero() { // the timer didn't have a pacing deadline set
 			pacingDeadline = s.sentPacketHandler.TimeUntilSend()
 		}
-		if s.config.KeepAlive && !s.keepAlivePingSent && s.handshakeComplete && time.Since(s.lastNetworkActivityTime) >= s.peerParams.IdleTimeout/2 {
+		if keepAliveInterval := s.getKeepAliveInterval(); keepAliveInterval > 0 && !s.keepAlivePingSent && time.Since(s.lastNetworkActivityTime) >= keepAliveInterval {
 			// send the PING frame since there is no activity in the session
 			s.packer.QueueControlFrame(&wire.PingFrame{})
 			s.keepAlivePingSent = true
@@ -513,7 +744,11 @@ runLoop:
 			// If we get to this point before the pacing deadline, we should wait until that deadline.
 			// This can happen when scheduleSending is called, or a packet is received.
 			// Set the timer and restart the run loop.
+			// ACKs and window updates are not paced.
 			s.pacingDeadline = pacingDeadline
+			if err := s.maybeSendUnpacedPacket(); err != nil {
+				s.closeLocal(err)
+			}
 			continue
 		}
 
@@ -527,16 +762,25 @@ runLoop:
 		if !s.handshakeComplete && now.Sub(s.sessionCreationTime) >= s.config.HandshakeTimeout {
 			s.closeLocal(qerr.Error(qerr.HandshakeTimeout, "Crypto handshake did not complete in time."))
 		}
-		if s.handshakeComplete && now.Sub(s.lastNetworkActivityTime) >= s.config.IdleTimeout {
+		if s.handshakeComplete && now.Sub(s.lastNetworkActivityTime) >= s.getIdleTimeout() {
 			s.closeLocal(qerr.Error(qerr.NetworkIdleTimeout, "No recent network activity."))
 		}
+		s.invariants.Check()
 	}
 
+	// stop writing queued packets before sending the CONNECTION_CLOSE
+	s.sendQueue.Close()
 	if err := s.handleCloseError(closeErr); err != nil {
 		s.logger.Infof("Handling close error failed: %s", err)
 	}
 	s.logger.Infof("Connection %s closed.", s.srcConnID)
-	s.sessionRunner.removeConnectionID(s.srcConnID)
+	s.connIDGenerator.RemoveAll()
+	s.connIDManager.Close()
+	s.saveCongestionState()
+	s.callOnClose(closeErr)
+	if s.streamAccounting != nil && closeErr.err != errCloseSessionForNewVersion && closeErr.err != handshake.ErrCloseSessionForRetry {
+		s.streamAccounting.Close(time.Now())
+	}
 	return closeErr.err
 }
 
@@ -545,15 +789,38 @@ func (s *session) Context() context.Context {
 }
 
 func (s *session) ConnectionState() ConnectionState {
-	return s.cryptoStreamHandler.ConnectionState()
+	state := s.cryptoStreamHandler.ConnectionState()
+	state.Version = s.version
+	select {
+	case <-s.handshakeConfirmedChan:
+		state.HandshakeConfirmed = true
+	default:
+	}
+	s.peerAnnouncementsMutex.Lock()
+	state.PeerFeatures = s.peerFeatures
+	state.SupportedVersions = s.serverSupportedVersions
+	s.peerAnnouncementsMutex.Unlock()
+	state.ReceivedTTL = uint8(atomic.LoadUint32(&s.receivedTTL))
+	return state
+}
+
+func (s *session) WaitForHandshakeConfirmation(ctx context.Context) error {
+	select {
+	case <-s.handshakeConfirmedChan:
+		return nil
+	case <-s.ctx.Done():
+		return errors.New("session closed before the handshake was confirmed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (s *session) maybeResetTimer() {
 	var deadline time.Time
-	if s.config.KeepAlive && s.handshakeComplete && !s.keepAlivePingSent {
-		deadline = s.lastNetworkActivityTime.Add(s.peerParams.IdleTimeout / 2)
+	if keepAliveInterval := s.getKeepAliveInterval(); keepAliveInterval > 0 && !s.keepAlivePingSent {
+		deadline = s.lastNetworkActivityTime.Add(keepAliveInterval)
 	} else {
-		deadline = s.lastNetworkActivityTime.Add(s.config.IdleTimeout)
+		deadline = s.lastNetworkActivityTime.Add(s.getIdleTimeout())
 	}
 
 	if ackAlarm := s.receivedPacketHandler.GetAlarmTimeout(); !ackAlarm.IsZero() {
@@ -562,6 +829,9 @@ func (s *session) maybeResetTimer() {
 	if lossTime := s.sentPacketHandler.GetAlarmTimeout(); !lossTime.IsZero() {
 		deadline = utils.MinTime(deadline, lossTime)
 	}
+	if pathValidationTime := s.pathValidator.GetAlarmTimeout(); !pathValidationTime.IsZero() {
+		deadline = utils.MinTime(deadline, pathValidationTime)
+	}
 	if !s.handshakeComplete {
 		handshakeDeadline := s.sessionCreationTime.Add(s.config.HandshakeTimeout)
 		deadline = utils.MinTime(deadline, handshakeDeadline)
@@ -572,10 +842,23 @@ func (s *session) maybeResetTimer() {
 	if !s.pacingDeadline.IsZero() {
 		deadline = utils.MinTime(deadline, s.pacingDeadline)
 	}
+	if !s.coalescingDeadline.IsZero() {
+		deadline = utils.MinTime(deadline, s.coalescingDeadline)
+	}
 
 	s.timer.Reset(deadline)
 }
 
+// profilingLabels returns the pprof labels for the go routines of this session.
+// They allow breaking down CPU profiles by connection and by connection phase.
+func (s *session) profilingLabels(phase string) pprof.LabelSet {
+	return pprof.Labels(
+		"quic_connection_id", s.srcConnID.String(),
+		"quic_perspective", s.perspective.String(),
+		"quic_phase", phase,
+	)
+}
+
 func (s *session) handleHandshakeEvent(completed bool) {
 	if !completed {
 		s.tryDecryptingQueuedPackets()
@@ -583,7 +866,20 @@ func (s *session) handleHandshakeEvent(completed bool) {
 	}
 	s.handshakeComplete = true
 	s.handshakeEvent = nil // prevent this case from ever being selected again
+	pprof.SetGoroutineLabels(pprof.WithLabels(s.ctx, s.profilingLabels("steady")))
 	s.sessionRunner.onHandshakeComplete(s)
+	if s.version.UsesIETFFrameFormat() {
+		if err := s.connIDGenerator.SetHandshakeComplete(); err != nil {
+			s.closeLocal(err)
+		}
+	}
+	if s.mtuDiscoverer != nil {
+		maxPacketSize := protocol.ByteCount(s.config.MaxPacketSize)
+		if s.peerParams != nil && s.peerParams.MaxPacketSize != 0 {
+			maxPacketSize = utils.MinByteCount(maxPacketSize, s.peerParams.MaxPacketSize)
+		}
+		s.mtuDiscoverer.Start(s.packer.MaxPacketSize(), maxPacketSize, time.Now())
+	}
 
 	// In gQUIC, the server completes the handshake first (after sending the SHLO).
 	// In TLS 1.3, the client completes the handshake first (after sending the CFIN).
@@ -595,10 +891,21 @@ func (s *session) handleHandshakeEvent(completed bool) {
 	if (!s.version.UsesTLS() && s.perspective == protocol.PerspectiveClient) ||
 		(s.version.UsesTLS() && s.perspective == protocol.PerspectiveServer) {
 		s.queueControlFrame(&wire.PingFrame{})
-		s.sentPacketHandler.SetHandshakeComplete()
+		s.confirmHandshake()
 	}
 }
 
+// confirmHandshake is called as soon as we know that the peer completed the handshake.
+// From this point on, handshake packets don't need to be retransmitted any more,
+// and the keys and buffers only needed during the handshake can be dropped.
+func (s *session) confirmHandshake() {
+	s.sentPacketHandler.SetHandshakeComplete()
+	s.cryptoStreamHandler.DiscardEarlyKeys()
+	s.undecryptablePackets = nil
+	s.undecryptablePacketBytes = 0
+	close(s.handshakeConfirmedChan)
+}
+
 func (s *session) handlePacketImpl(p *receivedPacket) error {
 	if s.perspective == protocol.PerspectiveClient {
 		if divNonce := p.header.DiversificationNonce; len(divNonce) > 0 {
@@ -624,6 +931,7 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 	)
 
 	packet, err := s.unpacker.Unpack(hdr.Raw, hdr, data)
+	var ignoredUnknownFrame bool
 	if s.logger.Debug() {
 		if err != nil {
 			s.logger.Debugf("<- Reading packet 0x%x (%d bytes) for connection %s", hdr.PacketNumber, len(data)+len(hdr.Raw), hdr.DestConnectionID)
@@ -632,9 +940,19 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 		}
 		hdr.Log(s.logger)
 	}
-	// if the decryption failed, this might be a packet sent by an attacker
 	if err != nil {
-		return err
+		unknownFrameErr, ok := err.(*wire.UnknownFrameTypeError)
+		if !ok {
+			// if the decryption failed, this might be a packet sent by an attacker
+			return err
+		}
+		if s.config.UnknownFrames != UnknownFramesIgnore || packet == nil {
+			return qerr.Error(qerr.InvalidFrameData, unknownFrameErr.Error())
+		}
+		// The length of the unknown frame is unknown, so the rest of the packet can't be parsed.
+		// The frames before it are processed, and the packet is acknowledged, such that the peer doesn't retransmit it.
+		s.logger.Debugf("Ignoring the rest of packet 0x%x, starting with a frame of unknown type 0x%x", hdr.PacketNumber, unknownFrameErr.FrameType)
+		ignoredUnknownFrame = true
 	}
 
 	if s.perspective == protocol.PerspectiveClient && !s.receivedFirstPacket && !hdr.SrcConnectionID.Equal(s.destConnID) {
@@ -646,6 +964,9 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 	s.receivedFirstPacket = true
 	s.lastNetworkActivityTime = p.rcvTime
 	s.keepAlivePingSent = false
+	if p.ttl != 0 {
+		atomic.StoreUint32(&s.receivedTTL, uint32(p.ttl))
+	}
 
 	// In gQUIC, the server completes the handshake first (after sending the SHLO).
 	// In TLS 1.3, the client completes the handshake first (after sending the CFIN).
@@ -654,10 +975,16 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 		(s.version.UsesTLS() && s.perspective == protocol.PerspectiveClient) {
 		if !s.receivedFirstForwardSecurePacket && packet.encryptionLevel == protocol.EncryptionForwardSecure {
 			s.receivedFirstForwardSecurePacket = true
-			s.sentPacketHandler.SetHandshakeComplete()
+			s.confirmHandshake()
 		}
 	}
 
+	s.updateReceiveStats(packet.frames)
+	if s.perspective == protocol.PerspectiveServer {
+		if err := s.maybeUpdateRemoteAddr(p, packet.encryptionLevel); err != nil {
+			return err
+		}
+	}
 	s.lastRcvdPacketNumber = hdr.PacketNumber
 	// Only do this after decrypting, so we are sure the packet is not attacker-controlled
 	s.largestRcvdPacketNumber = utils.MaxPacketNumber(s.largestRcvdPacketNumber, hdr.PacketNumber)
@@ -665,8 +992,9 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 	// If this is a Retry packet, there's no need to send an ACK.
 	// The session will be closed and recreated as soon as the crypto setup processed the HRR.
 	if hdr.Type != protocol.PacketTypeRetry {
-		isRetransmittable := ackhandler.HasRetransmittableFrames(packet.frames)
-		if err := s.receivedPacketHandler.ReceivedPacket(hdr.PacketNumber, p.rcvTime, isRetransmittable); err != nil {
+		// the unknown frame was most likely retransmittable
+		isRetransmittable := ignoredUnknownFrame || ackhandler.HasRetransmittableFrames(packet.frames)
+		if err := s.receivedPacketHandler.ReceivedPacket(hdr.PacketNumber, p.ecn, p.rcvTime, isRetransmittable); err != nil {
 			return err
 		}
 	}
@@ -674,17 +1002,73 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 	return s.handleFrames(packet.frames, packet.encryptionLevel)
 }
 
+// maybeUpdateRemoteAddr switches to the address a packet was received from.
+// The client's address changes when it migrates, or when a NAT rebinds.
+// Unencrypted packets can be spoofed, so they're not used to change the address.
+// Delayed packets sent from the old address are ignored, since they don't increase the largest packet number.
+// For IETF QUIC, the new address is validated first, see pathValidator.
+// must be called before updating the largestRcvdPacketNumber
+func (s *session) maybeUpdateRemoteAddr(p *receivedPacket, encLevel protocol.EncryptionLevel) error {
+	if p.remoteAddr == nil || encLevel < protocol.EncryptionSecure || p.header.PacketNumber <= s.largestRcvdPacketNumber {
+		return nil
+	}
+	addr := s.conn.RemoteAddr()
+	if addr.Network() == p.remoteAddr.Network() && addr.String() == p.remoteAddr.String() {
+		return nil
+	}
+	// gQUIC doesn't have PATH_CHALLENGE frames, so we can't validate the new address
+	if !s.version.UsesIETFFrameFormat() {
+		s.logger.Infof("Remote address changed from %s to %s", addr, p.remoteAddr)
+		s.conn.SetCurrentRemoteAddr(p.remoteAddr)
+		return nil
+	}
+	if s.pathValidator.IsValidating(p.remoteAddr) {
+		return nil
+	}
+	s.logger.Infof("Received a packet from %s, validating the new address", p.remoteAddr)
+	frame, err := s.pathValidator.Start(p.remoteAddr, p.rcvTime)
+	if err != nil {
+		return err
+	}
+	return s.sendPathChallenge(frame)
+}
+
+func (s *session) onPathValidationAlarm(now time.Time) error {
+	addr := s.pathValidator.Addr()
+	frame, err := s.pathValidator.OnAlarm(now)
+	if err != nil {
+		return err
+	}
+	if frame == nil {
+		s.logger.Infof("Validation of %s failed. Continuing to use %s", addr, s.conn.RemoteAddr())
+		return nil
+	}
+	return s.sendPathChallenge(frame)
+}
+
+// sendPathChallenge sends a PATH_CHALLENGE to the address that is being validated
+func (s *session) sendPathChallenge(frame *wire.PathChallengeFrame) error {
+	packet, err := s.packer.PackPathChallenge(frame)
+	if err != nil {
+		return err
+	}
+	s.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
+	s.sendPackedPacketTo(packet, s.pathValidator.Addr())
+	return nil
+}
+
 func (s *session) handleFrames(fs []wire.Frame, encLevel protocol.EncryptionLevel) error {
 	for _, ff := range fs {
 		var err error
 		wire.LogFrame(s.logger, ff, false)
+		s.frameHistory.Add(ff, false)
 		switch frame := ff.(type) {
 		case *wire.StreamFrame:
 			err = s.handleStreamFrame(frame, encLevel)
 		case *wire.AckFrame:
 			err = s.handleAckFrame(frame, encLevel)
 		case *wire.ConnectionCloseFrame:
-			s.closeRemote(qerr.Error(frame.ErrorCode, frame.ReasonPhrase))
+			s.handleConnectionCloseFrame(frame)
 		case *wire.GoawayFrame:
 			err = errors.New("unimplemented: handling GOAWAY frames")
 		case *wire.StopWaitingFrame: // ignore STOP_WAITINGs
@@ -705,8 +1089,17 @@ func (s *session) handleFrames(fs []wire.Frame, encLevel protocol.EncryptionLeve
 		case *wire.PathChallengeFrame:
 			s.handlePathChallengeFrame(frame)
 		case *wire.PathResponseFrame:
-			// since we don't send PATH_CHALLENGEs, we don't expect PATH_RESPONSEs
-			err = errors.New("unexpected PATH_RESPONSE frame")
+			s.handlePathResponseFrame(frame)
+		case *wire.NewConnectionIDFrame:
+			s.connIDManager.Add(frame)
+		case *wire.RetireConnectionIDFrame:
+			err = s.connIDGenerator.Retire(frame.SequenceNumber)
+		case *wire.ExpiredStreamDataFrame:
+			err = s.handleExpiredStreamDataFrame(frame)
+		case *wire.AckFrequencyFrame:
+			err = s.handleAckFrequencyFrame(frame)
+		case *wire.ExtensionFrame:
+			err = s.handleExtensionFrame(frame)
 		default:
 			return errors.New("Session BUG: unexpected frame type")
 		}
@@ -725,6 +1118,7 @@ func (s *session) handlePacket(p *receivedPacket) {
 	select {
 	case s.receivedPackets <- p:
 	default:
+		p.release()
 	}
 }
 
@@ -744,13 +1138,46 @@ func (s *session) handleStreamFrame(frame *wire.StreamFrame, encLevel protocol.E
 	if str == nil {
 		// Stream is closed and already garbage collected
 		// ignore this StreamFrame
+		s.handleFrameForClosedStream(frame.StreamID)
 		return nil
 	}
 	return str.handleStreamFrame(frame)
 }
 
+// truncateReasonPhrase truncates a reason phrase to at most maxLen bytes.
+// It doesn't split a multi-byte UTF-8 character.
+func truncateReasonPhrase(reason string, maxLen int) string {
+	if len(reason) <= maxLen {
+		return reason
+	}
+	n := maxLen
+	for n > 0 && !utf8.RuneStart(reason[n]) {
+		n--
+	}
+	return reason[:n]
+}
+
+func (s *session) handleConnectionCloseFrame(frame *wire.ConnectionCloseFrame) {
+	reason := truncateReasonPhrase(frame.ReasonPhrase, s.config.MaxReasonPhraseLength)
+	if frame.IsApplicationError {
+		s.closeRemote(&applicationError{
+			errorCode: protocol.ApplicationErrorCode(frame.ErrorCode),
+			reason:    reason,
+			remote:    true,
+		})
+		return
+	}
+	s.closeRemote(qerr.RemoteError(frame.ErrorCode, reason))
+}
+
 func (s *session) handleMaxDataFrame(frame *wire.MaxDataFrame) {
 	s.connFlowController.UpdateSendWindow(frame.ByteOffset)
+	s.statsMutex.Lock()
+	if !s.connBlockedSince.IsZero() {
+		s.stats.FlowControlBlockedTime += time.Since(s.connBlockedSince)
+		s.connBlockedSince = time.Time{}
+	}
+	s.statsMutex.Unlock()
 }
 
 func (s *session) handleMaxStreamDataFrame(frame *wire.MaxStreamDataFrame) error {
@@ -764,6 +1191,7 @@ func (s *session) handleMaxStreamDataFrame(frame *wire.MaxStreamDataFrame) error
 	}
 	if str == nil {
 		// stream is closed and already garbage collected
+		s.handleFrameForClosedStream(frame.StreamID)
 		return nil
 	}
 	str.handleMaxStreamDataFrame(frame)
@@ -784,11 +1212,36 @@ func (s *session) handleRstStreamFrame(frame *wire.RstStreamFrame) error {
 	}
 	if str == nil {
 		// stream is closed and already garbage collected
+		s.handleFrameForClosedStream(frame.StreamID)
 		return nil
 	}
 	return str.handleRstStreamFrame(frame)
 }
 
+func (s *session) handleAckFrequencyFrame(frame *wire.AckFrequencyFrame) error {
+	if !protocol.NewFeatureSet(s.config.Features...).Has(protocol.FeatureAckFrequency) {
+		return qerr.Error(qerr.InvalidFrameData, "received an ACK_FREQUENCY frame, but the ACK frequency extension is not enabled")
+	}
+	s.receivedPacketHandler.ReceivedAckFrequencyFrame(frame)
+	return nil
+}
+
+func (s *session) handleExpiredStreamDataFrame(frame *wire.ExpiredStreamDataFrame) error {
+	if frame.StreamID == s.version.CryptoStreamID() {
+		return errors.New("Received an EXPIRED_STREAM_DATA frame for the crypto stream")
+	}
+	str, err := s.streamsMap.GetOrOpenReceiveStream(frame.StreamID)
+	if err != nil {
+		return err
+	}
+	if str == nil {
+		// stream is closed and already garbage collected
+		s.handleFrameForClosedStream(frame.StreamID)
+		return nil
+	}
+	return str.handleExpiredStreamDataFrame(frame)
+}
+
 func (s *session) handleStopSendingFrame(frame *wire.StopSendingFrame) error {
 	if frame.StreamID == s.version.CryptoStreamID() {
 		return errors.New("Received a STOP_SENDING frame for the crypto stream")
@@ -799,6 +1252,7 @@ func (s *session) handleStopSendingFrame(frame *wire.StopSendingFrame) error {
 	}
 	if str == nil {
 		// stream is closed and already garbage collected
+		s.handleFrameForClosedStream(frame.StreamID)
 		return nil
 	}
 	str.handleStopSendingFrame(frame)
@@ -809,10 +1263,39 @@ func (s *session) handlePathChallengeFrame(frame *wire.PathChallengeFrame) {
 	s.queueControlFrame(&wire.PathResponseFrame{Data: frame.Data})
 }
 
+func (s *session) handlePathResponseFrame(frame *wire.PathResponseFrame) {
+	// PATH_RESPONSEs that don't match any PATH_CHALLENGE we sent are ignored
+	if addr := s.pathValidator.HandlePathResponse(frame); addr != nil {
+		s.logger.Infof("Validated %s. Remote address changed from %s to %s", addr, s.conn.RemoteAddr(), addr)
+		s.conn.SetCurrentRemoteAddr(addr)
+		// Don't use the same connection ID on the new path (if the peer issued any other connection IDs),
+		// such that the paths can't be linked by an on-path observer.
+		s.connIDManager.Rotate()
+	}
+}
+
+func (s *session) handleExtensionFrame(frame *wire.ExtensionFrame) error {
+	handler := extensionFrames.Get(frame.FrameType)
+	if handler == nil {
+		if s.config.UnknownFrames == UnknownFramesIgnore {
+			return nil
+		}
+		return qerr.Error(qerr.InvalidFrameData, fmt.Sprintf("unknown type byte 0x%x", frame.FrameType))
+	}
+	handler(s, frame.Data)
+	return nil
+}
+
 func (s *session) handleAckFrame(frame *wire.AckFrame, encLevel protocol.EncryptionLevel) error {
 	if err := s.sentPacketHandler.ReceivedAck(frame, s.lastRcvdPacketNumber, encLevel, s.lastNetworkActivityTime); err != nil {
 		return err
 	}
+	// stop marking packets if ECN validation failed
+	if s.ecnEnabled && s.sentPacketHandler.ECN() == protocol.ECNNon {
+		s.logger.Infof("ECN validation failed. Disabling ECN.")
+		s.conn.SetECN(protocol.ECNNon)
+		s.ecnEnabled = false
+	}
 	s.receivedPacketHandler.IgnoreBelow(s.sentPacketHandler.GetLowestPacketNotConfirmedAcked())
 	return nil
 }
@@ -837,11 +1320,32 @@ func (s *session) Close(e error) error {
 	return nil
 }
 
+// CloseWithError closes the connection with an application-defined error code and reason.
+// It waits until the run loop has stopped before returning
+func (s *session) CloseWithError(code protocol.ApplicationErrorCode, reason string) error {
+	if !utf8.ValidString(reason) {
+		return errors.New("the reason must be valid UTF-8")
+	}
+	s.closeLocal(&applicationError{errorCode: code, reason: reason})
+	<-s.ctx.Done()
+	return nil
+}
+
 func (s *session) handleCloseError(closeErr closeError) error {
 	if closeErr.err == nil {
 		closeErr.err = qerr.PeerGoingAway
 	}
 
+	if appErr, ok := closeErr.err.(*applicationError); ok {
+		s.logger.Infof("Closing session with application error %d: %s", appErr.errorCode, appErr.reason)
+		s.cryptoStream.closeForShutdown(appErr)
+		s.streamsMap.CloseWithError(appErr)
+		if closeErr.remote {
+			return nil
+		}
+		return s.sendApplicationClose(appErr)
+	}
+
 	var quicErr *qerr.QuicError
 	var ok bool
 	if quicErr, ok = closeErr.err.(*qerr.QuicError); !ok {
@@ -874,27 +1378,211 @@ func (s *session) handleCloseError(closeErr closeError) error {
 	return s.sendConnectionClose(quicErr)
 }
 
+// callOnClose calls the OnClose callback, if it is set.
+// If the session was closed due to an internal error, it takes a DiagnosticSnapshot.
+func (s *session) callOnClose(closeErr closeError) {
+	if s.config.OnClose == nil {
+		return
+	}
+	// the session is recreated, it is not actually closed
+	if closeErr.err == errCloseSessionForNewVersion || closeErr.err == handshake.ErrCloseSessionForRetry {
+		return
+	}
+	var snapshot *DiagnosticSnapshot
+	if _, isAppErr := closeErr.err.(*applicationError); closeErr.err != nil && !closeErr.remote && !isAppErr && qerr.ToQuicError(closeErr.err).ErrorCode == qerr.InternalError {
+		snapshot = s.getDiagnosticSnapshot()
+	}
+	go s.config.OnClose(s, closeErr.err, snapshot)
+}
+
+func (s *session) getDiagnosticSnapshot() *DiagnosticSnapshot {
+	offsets := s.connFlowController.GetOffsets()
+	return &DiagnosticSnapshot{
+		Time:              time.Now(),
+		RecentFrames:      s.frameHistory.Frames(),
+		SmoothedRTT:       s.rttStats.SmoothedRTT(),
+		MinRTT:            s.rttStats.MinRTT(),
+		LatestRTT:         s.rttStats.LatestRTT(),
+		CongestionWindow:  uint64(s.sentPacketHandler.GetCongestionWindow()),
+		BytesInFlight:     uint64(s.sentPacketHandler.GetBytesInFlight()),
+		BandwidthEstimate: uint64(s.sentPacketHandler.GetBandwidthEstimate()),
+		PacingRate:        uint64(s.sentPacketHandler.GetPacingRate()),
+		ConnectionFlowControl: FlowControlOffsets{
+			BytesSent:       uint64(offsets.BytesSent),
+			SendWindow:      uint64(offsets.SendWindow),
+			BytesRead:       uint64(offsets.BytesRead),
+			HighestReceived: uint64(offsets.HighestReceived),
+			ReceiveWindow:   uint64(offsets.ReceiveWindow),
+		},
+	}
+}
+
+// reportInvariantViolation logs a violated invariant, and passes it to the Config.OnInvariantViolation callback.
+// It is called from the run loop.
+func (s *session) reportInvariantViolation(v InvariantViolation) {
+	v.Snapshot = s.getDiagnosticSnapshot()
+	s.logger.Errorf("%s", v)
+	if s.config.OnInvariantViolation != nil {
+		go s.config.OnInvariantViolation(s, v)
+	}
+}
+
+func (s *session) SetUserData(data interface{}) {
+	s.userDataMutex.Lock()
+	s.userData = data
+	s.userDataMutex.Unlock()
+}
+
+func (s *session) UserData() interface{} {
+	s.userDataMutex.Lock()
+	defer s.userDataMutex.Unlock()
+	return s.userData
+}
+
+// updateNetworkStats copies RTT, congestion control and loss detection values into the stats.
+// The sentPacketHandler is not safe for concurrent use, so this has to be called from the run loop.
+func (s *session) updateNetworkStats() {
+	lossStats := s.sentPacketHandler.GetStats()
+	cwnd := s.sentPacketHandler.GetCongestionWindow()
+	bytesInFlight := s.sentPacketHandler.GetBytesInFlight()
+	bandwidth := s.sentPacketHandler.GetBandwidthEstimate()
+	pacingRate := s.sentPacketHandler.GetPacingRate()
+
+	s.statsMutex.Lock()
+	s.stats.SmoothedRTT = s.rttStats.SmoothedRTT()
+	s.stats.RTTVariance = s.rttStats.MeanDeviation()
+	s.stats.MinRTT = s.rttStats.MinRTT()
+	s.stats.LatestRTT = s.rttStats.LatestRTT()
+	s.stats.CongestionWindow = uint64(cwnd)
+	s.stats.BytesInFlight = uint64(bytesInFlight)
+	s.stats.BandwidthEstimate = uint64(bandwidth)
+	s.stats.PacingRate = uint64(pacingRate)
+	s.stats.PacketsLost = lossStats.PacketsLost
+	s.stats.TLPs = lossStats.TLPs
+	s.stats.RTOs = lossStats.RTOs
+	s.statsMutex.Unlock()
+}
+
+func (s *session) Stats() SessionStats {
+	s.statsMutex.Lock()
+	defer s.statsMutex.Unlock()
+
+	stats := s.stats
+	if !s.connBlockedSince.IsZero() {
+		stats.FlowControlBlockedTime += time.Since(s.connBlockedSince)
+	}
+	stats.OpenStreams = s.streamsMap.NumStreams()
+	stats.SendQueueLength = s.sendQueue.Len()
+	stats.DroppedAckOnlyPackets = s.sendQueue.DroppedAckOnlyPackets()
+	stats.TransientWriteErrors = s.sendQueue.TransientWriteErrors()
+	stats.ReceiveBufferSize, stats.SendBufferSize = s.conn.SocketBufferSizes()
+	return stats
+}
+
+func (s *session) updateReceiveStats(frames []wire.Frame) {
+	s.statsMutex.Lock()
+	s.stats.PacketsReceived++
+	s.stats.FramesReceived += uint64(len(frames))
+	s.stats.BytesReceived += uint64(s.getStreamDataLen(frames))
+	s.statsMutex.Unlock()
+}
+
+// dropExpiredStreamData removes stream data that expired on partially reliable streams from frames that are about to be retransmitted
+func (s *session) dropExpiredStreamData(frames []wire.Frame) []wire.Frame {
+	retransmitFrames := frames[:0]
+	for _, frame := range frames {
+		sf, ok := frame.(*wire.StreamFrame)
+		if !ok || sf.StreamID == s.version.CryptoStreamID() {
+			retransmitFrames = append(retransmitFrames, frame)
+			continue
+		}
+		str, err := s.streamsMap.GetOrOpenSendStream(sf.StreamID)
+		if err != nil || str == nil { // the stream might already have been garbage collected
+			retransmitFrames = append(retransmitFrames, frame)
+			continue
+		}
+		if sf = str.dropExpiredData(sf); sf != nil {
+			retransmitFrames = append(retransmitFrames, sf)
+		}
+	}
+	return retransmitFrames
+}
+
+// updateRetransmissionStats counts the retransmitted stream data, for the session and for the streams
+func (s *session) updateRetransmissionStats(packet *packedPacket) {
+	var retransmitted protocol.ByteCount
+	for _, frame := range packet.frames {
+		sf, ok := frame.(*wire.StreamFrame)
+		if !ok || sf.StreamID == s.version.CryptoStreamID() {
+			continue
+		}
+		retransmitted += sf.DataLen()
+		str, err := s.streamsMap.GetOrOpenSendStream(sf.StreamID)
+		if err != nil || str == nil { // the stream might already have been garbage collected
+			continue
+		}
+		str.addRetransmittedBytes(sf.DataLen())
+	}
+	s.statsMutex.Lock()
+	s.stats.BytesRetransmitted += uint64(retransmitted)
+	s.statsMutex.Unlock()
+}
+
+// getStreamDataLen returns the length of the stream data contained in STREAM frames, excluding the crypto stream
+func (s *session) getStreamDataLen(frames []wire.Frame) protocol.ByteCount {
+	var l protocol.ByteCount
+	for _, frame := range frames {
+		if sf, ok := frame.(*wire.StreamFrame); ok && sf.StreamID != s.version.CryptoStreamID() {
+			l += sf.DataLen()
+		}
+	}
+	return l
+}
+
 func (s *session) processTransportParameters(params *handshake.TransportParameters) {
 	s.peerParams = params
+	s.peerAnnouncementsMutex.Lock()
+	s.peerFeatures = params.Features
+	if len(params.ServerSupportedVersions) > 0 {
+		s.serverSupportedVersions = params.ServerSupportedVersions
+	}
+	s.peerAnnouncementsMutex.Unlock()
 	s.streamsMap.UpdateLimits(params)
 	if params.OmitConnectionID {
 		s.packer.SetOmitConnectionID()
 	}
 	if params.MaxPacketSize != 0 {
 		s.packer.SetMaxPacketSize(params.MaxPacketSize)
+		s.sentPacketHandler.SetMaxPacketSize(s.packer.MaxPacketSize())
+	}
+	if params.StatelessResetToken != nil {
+		s.connIDManager.SetStatelessResetToken(*params.StatelessResetToken)
 	}
 	s.connFlowController.UpdateSendWindow(params.ConnectionFlowControlWindow)
 	// the crypto stream is the only open stream at this moment
 	// so we don't need to update stream flow control windows
+	if s.config.PeerAckPolicy != nil && s.version.UsesIETFFrameFormat() && params.Features.Has(protocol.FeatureAckFrequency) {
+		f := ackhandler.NewAckFrequencyFrame(*s.config.PeerAckPolicy, 0)
+		s.sentPacketHandler.SetPeerMaxAckDelay(f.MaxAckDelay)
+		s.queueControlFrame(f)
+	}
 }
 
 func (s *session) sendPackets() error {
 	s.pacingDeadline = time.Time{}
+	s.numUnpacedPackets = 0
+	s.coalescingDeadline = time.Time{}
 
 	sendMode := s.sentPacketHandler.SendMode()
 	if sendMode == ackhandler.SendNone { // shortcut: return immediately if there's nothing to send
 		return nil
 	}
+	if s.sendQueue.Full() {
+		// Don't pack any more packets until the queued packets were written.
+		// The send queue calls scheduleSending once it has space again.
+		// An ACK-only packet replaces an ACK-only packet that is still queued, so the ACK is sent without delay.
+		return s.maybeSendAckOnlyPacket()
+	}
 
 	numPackets := s.sentPacketHandler.ShouldSendNumPackets()
 	var numPacketsSent int
@@ -950,6 +1638,25 @@ sendLoop:
 				// e.g. when an Initial is queued, but we already received a packet from the server.
 			}
 		case ackhandler.SendAny:
+			// send the frames of lost packets before sending new data
+			if s.retransmissionQueue.HasData() {
+				sentPacket, err := s.maybeSendRetransmission()
+				if err != nil {
+					return err
+				}
+				if sentPacket {
+					numPacketsSent++
+					break
+				}
+				// No packet was packed, e.g. because the queued control frames don't fit into a packet any more.
+			}
+			if s.mtuDiscoverer != nil && s.mtuDiscoverer.ShouldSendProbe(time.Now()) {
+				if err := s.sendMTUProbe(); err != nil {
+					return err
+				}
+				numPacketsSent++
+				break
+			}
 			sentPacket, err := s.sendPacket()
 			if err != nil {
 				return err
@@ -961,47 +1668,100 @@ sendLoop:
 		default:
 			return fmt.Errorf("BUG: invalid send mode %d", sendMode)
 		}
-		if numPacketsSent >= numPackets {
+		// The crypto stream is not paced, so that the handshake messages are sent in a single flight.
+		// The congestion controller still limits the number of packets sent.
+		if (numPacketsSent >= numPackets && !s.streamFramer.HasCryptoStreamData()) || s.sendQueue.Full() {
 			break
 		}
 		sendMode = s.sentPacketHandler.SendMode()
 	}
 	// Only start the pacing timer if we sent as many packets as we were allowed.
 	// There will probably be more to send when calling sendPacket again.
-	if numPacketsSent == numPackets {
+	if numPacketsSent >= numPackets {
 		s.pacingDeadline = s.sentPacketHandler.TimeUntilSend()
+		// The pacer allows sending more packets right away.
+		if s.pacingDeadline.IsZero() {
+			s.scheduleSending()
+		}
 	}
 	return nil
 }
 
-func (s *session) maybeSendAckOnlyPacket() error {
+// maybeSendUnpacedPacket is called when sending is blocked by the pacer.
+// If an ACK or a window update needs to be sent, it sends a packet containing only ACK and control frames,
+// so that the peer isn't slowed down by our pacer.
+// At most protocol.MaxUnpacedPackets packets are sent until the pacer allows sending again.
+func (s *session) maybeSendUnpacedPacket() error {
+	if s.numUnpacedPackets >= protocol.MaxUnpacedPackets || s.sendQueue.Full() {
+		return nil
+	}
+	hasWindowUpdates := s.windowUpdateQueue.HasWindowUpdates()
+	hasAck := s.queueAckFrame()
+	if !hasAck && !hasWindowUpdates {
+		return nil
+	}
+	var packet *packedPacket
+	var err error
+	switch s.sentPacketHandler.SendMode() {
+	case ackhandler.SendNone:
+		// the queued frames will be sent in the next packet
+		return nil
+	case ackhandler.SendAck:
+		if !hasAck {
+			return nil
+		}
+		packet, err = s.packer.PackAckPacket()
+	default:
+		s.windowUpdateQueue.QueueAll()
+		packet, err = s.packer.PackControlPacket()
+	}
+	if err != nil || packet == nil {
+		return err
+	}
+	s.numUnpacedPackets++
+	s.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
+	s.sendPackedPacket(packet)
+	return nil
+}
+
+// queueAckFrame queues an ACK frame (and a STOP_WAITING frame for gQUIC), if an ACK should be sent.
+// It returns if an ACK frame was queued.
+func (s *session) queueAckFrame() bool {
 	ack := s.receivedPacketHandler.GetAckFrame()
 	if ack == nil {
-		return nil
+		return false
 	}
 	s.packer.QueueControlFrame(ack)
-
 	if s.version.UsesStopWaitingFrames() { // for gQUIC, maybe add a STOP_WAITING
 		if swf := s.sentPacketHandler.GetStopWaitingFrame(false); swf != nil {
 			s.packer.QueueControlFrame(swf)
 		}
 	}
+	return true
+}
+
+func (s *session) maybeSendAckOnlyPacket() error {
+	if !s.queueAckFrame() {
+		return nil
+	}
 	packet, err := s.packer.PackAckPacket()
 	if err != nil {
 		return err
 	}
 	s.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
-	return s.sendPackedPacket(packet)
+	s.sendPackedPacket(packet)
+	return nil
 }
 
-// maybeSendRetransmission sends retransmissions for at most one packet.
+// maybeSendRetransmission sends at most one retransmission packet.
+// Handshake packets are retransmitted as a whole.
+// The frames of lost forward-secure packets are added to the retransmission queue, and packed into new packets.
 // It takes care that Initials aren't retransmitted, if a packet from the server was already received.
 func (s *session) maybeSendRetransmission() (bool, error) {
-	var retransmitPacket *ackhandler.Packet
 	for {
-		retransmitPacket = s.sentPacketHandler.DequeuePacketForRetransmission()
+		retransmitPacket := s.sentPacketHandler.DequeuePacketForRetransmission()
 		if retransmitPacket == nil {
-			return false, nil
+			break
 		}
 
 		// Don't retransmit Initial packets if we already received a response.
@@ -1011,79 +1771,205 @@ func (s *session) maybeSendRetransmission() (bool, error) {
 			s.logger.Debugf("Skipping retransmission of packet %d. Already received a response to an Initial.", retransmitPacket.PacketNumber)
 			continue
 		}
-		break
+		if retransmitPacket.EncryptionLevel != protocol.EncryptionForwardSecure {
+			return true, s.sendHandshakeRetransmission(retransmitPacket)
+		}
+		s.logger.Debugf("Queueing frames of packet 0x%x for retransmission", retransmitPacket.PacketNumber)
+		s.retransmissionQueue.AddFrames(s.dropExpiredStreamData(retransmitPacket.Frames), retransmitPacket.PacketNumber)
 	}
 
-	if retransmitPacket.EncryptionLevel != protocol.EncryptionForwardSecure {
-		s.logger.Debugf("Dequeueing handshake retransmission for packet 0x%x", retransmitPacket.PacketNumber)
-	} else {
-		s.logger.Debugf("Dequeueing retransmission for packet 0x%x", retransmitPacket.PacketNumber)
+	if !s.retransmissionQueue.HasData() {
+		return false, nil
 	}
-
 	if s.version.UsesStopWaitingFrames() {
 		s.packer.QueueControlFrame(s.sentPacketHandler.GetStopWaitingFrame(true))
 	}
-	packets, err := s.packer.PackRetransmission(retransmitPacket)
-	if err != nil {
+	packet, err := s.packer.PackRetransmission(s.retransmissionQueue)
+	if err != nil || packet == nil {
 		return false, err
 	}
-	ackhandlerPackets := make([]*ackhandler.Packet, len(packets))
-	for i, packet := range packets {
-		ackhandlerPackets[i] = packet.ToAckHandlerPacket()
+	s.sentPacketHandler.SentPacketsAsRetransmission([]*ackhandler.Packet{packet.ToAckHandlerPacket()}, packet.retransmissionOf)
+	s.updateRetransmissionStats(packet)
+	s.sendPackedPacket(packet)
+	return true, nil
+}
+
+// sendHandshakeRetransmission retransmits a handshake packet.
+// It is sent with the same encryption level as the original packet.
+func (s *session) sendHandshakeRetransmission(retransmitPacket *ackhandler.Packet) error {
+	s.logger.Debugf("Dequeueing handshake retransmission for packet 0x%x", retransmitPacket.PacketNumber)
+	if s.version.UsesStopWaitingFrames() {
+		s.packer.QueueControlFrame(s.sentPacketHandler.GetStopWaitingFrame(true))
 	}
-	s.sentPacketHandler.SentPacketsAsRetransmission(ackhandlerPackets, retransmitPacket.PacketNumber)
-	for _, packet := range packets {
-		if err := s.sendPackedPacket(packet); err != nil {
-			return false, err
-		}
+	packet, err := s.packer.PackHandshakeRetransmission(retransmitPacket)
+	if err != nil {
+		return err
 	}
-	return true, nil
+	s.sentPacketHandler.SentPacketsAsRetransmission([]*ackhandler.Packet{packet.ToAckHandlerPacket()}, []protocol.PacketNumber{retransmitPacket.PacketNumber})
+	s.updateRetransmissionStats(packet)
+	s.sendPackedPacket(packet)
+	return nil
 }
 
 func (s *session) sendPacket() (bool, error) {
 	if isBlocked, offset := s.connFlowController.IsNewlyBlocked(); isBlocked {
 		s.packer.QueueControlFrame(&wire.BlockedFrame{Offset: offset})
-	}
-	s.windowUpdateQueue.QueueAll()
-
-	if ack := s.receivedPacketHandler.GetAckFrame(); ack != nil {
-		s.packer.QueueControlFrame(ack)
-		if s.version.UsesStopWaitingFrames() {
-			if swf := s.sentPacketHandler.GetStopWaitingFrame(false); swf != nil {
-				s.packer.QueueControlFrame(swf)
-			}
+		s.statsMutex.Lock()
+		if s.connBlockedSince.IsZero() {
+			s.connBlockedSince = time.Now()
 		}
+		s.statsMutex.Unlock()
 	}
+	s.windowUpdateQueue.QueueAll()
+	s.queueAckFrame()
 
 	packet, err := s.packer.PackPacket()
 	if err != nil || packet == nil {
 		return false, err
 	}
 	s.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
-	if err := s.sendPackedPacket(packet); err != nil {
-		return false, err
-	}
+	s.statsMutex.Lock()
+	s.stats.BytesSent += uint64(s.getStreamDataLen(packet.frames))
+	s.statsMutex.Unlock()
+	s.sendPackedPacket(packet)
 	return true, nil
 }
 
-func (s *session) sendPackedPacket(packet *packedPacket) error {
-	defer putPacketBuffer(&packet.raw)
+// sendMTUProbe sends a probe packet that is larger than the current max packet size.
+func (s *session) sendMTUProbe() error {
+	size := s.mtuDiscoverer.NextProbeSize()
+	packet, err := s.packer.PackMTUProbePacket(size)
+	if err != nil {
+		return err
+	}
+	s.logger.Debugf("Sending MTU probe packet of %d bytes", size)
+	s.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
+	s.sendPackedPacket(packet)
+	return nil
+}
+
+// onPacketSizeResult is called by the sent packet handler when a packet is acknowledged or lost.
+func (s *session) onPacketSizeResult(size protocol.ByteCount, isMTUProbe, acked bool) {
+	if s.mtuDiscoverer == nil {
+		return
+	}
+	if !isMTUProbe {
+		if acked {
+			s.mtuDiscoverer.OnPacketAcked(size)
+		} else if s.mtuDiscoverer.OnPacketLost(size, time.Now()) {
+			s.logger.Debugf("Packets larger than %d bytes are lost repeatedly. Falling back to this size.", s.mtuDiscoverer.BaseSize())
+			s.packer.SetMaxPacketSize(s.mtuDiscoverer.BaseSize())
+			s.sentPacketHandler.SetMaxPacketSize(s.packer.MaxPacketSize())
+		}
+		return
+	}
+	if !acked {
+		s.logger.Debugf("MTU probe packet of %d bytes lost", size)
+		s.mtuDiscoverer.OnProbeLost(size, time.Now())
+		return
+	}
+	if s.mtuDiscoverer.OnProbeAcked(size, time.Now()) {
+		s.logger.Debugf("MTU probe packet of %d bytes acknowledged. Increasing the max packet size.", size)
+		s.packer.IncreaseMaxPacketSize(size)
+		s.sentPacketHandler.SetMaxPacketSize(s.packer.MaxPacketSize())
+	}
+}
+
+type packetTooLarge struct {
+	size     protocol.ByteCount
+	mtuProbe bool
+}
+
+// onPacketTooLarge is called by the send queue when a packet was rejected with EMSGSIZE.
+// It is called from the send queue's Go routine, the error is handled by the run loop.
+func (s *session) onPacketTooLarge(size protocol.ByteCount, mtuProbe bool) {
+	select {
+	case s.packetTooLargeChan <- packetTooLarge{size: size, mtuProbe: mtuProbe}:
+	default:
+		// An error is already waiting to be handled.
+		// If packets are rejected repeatedly, the session will handle one of the next errors.
+	}
+}
+
+// handlePacketTooLarge handles a packet that was rejected with EMSGSIZE.
+// The packet will be declared lost by the sent packet handler.
+func (s *session) handlePacketTooLarge(size protocol.ByteCount, mtuProbe bool) error {
+	if mtuProbe {
+		if s.mtuDiscoverer != nil {
+			s.logger.Debugf("MTU probe packet of %d bytes is larger than the path MTU", size)
+			s.mtuDiscoverer.OnProbeRejected(size, time.Now())
+		}
+		return nil
+	}
+	if s.mtuDiscoverer == nil || !s.mtuDiscoverer.OnPacketRejected(size, time.Now()) {
+		return fmt.Errorf("packet of %d bytes is larger than the path MTU", size)
+	}
+	s.logger.Debugf("Packet of %d bytes is larger than the path MTU. Falling back to %d bytes.", size, s.mtuDiscoverer.BaseSize())
+	s.packer.SetMaxPacketSize(s.mtuDiscoverer.BaseSize())
+	s.sentPacketHandler.SetMaxPacketSize(s.packer.MaxPacketSize())
+	return nil
+}
+
+func (s *session) sendPackedPacket(packet *packedPacket) {
+	s.sendPackedPacketTo(packet, nil)
+}
+
+// sendPackedPacketTo queues a packet for sending to addr.
+// If addr is nil, the packet is sent to the current remote address.
+func (s *session) sendPackedPacketTo(packet *packedPacket, addr net.Addr) {
+	s.invariants.SentPacket(packet.header.PacketNumber)
 	s.logPacket(packet)
-	return s.conn.Write(packet.raw)
+	s.addToFrameHistory(packet)
+	s.statsMutex.Lock()
+	s.stats.PacketsSent++
+	s.stats.FramesSent += uint64(len(packet.frames))
+	s.statsMutex.Unlock()
+	s.sendQueue.Send(&queuedPacket{
+		raw:      packet.raw,
+		addr:     addr,
+		ackOnly:  packet.IsAckOnly(),
+		mtuProbe: packet.isMTUProbe,
+	})
 }
 
 func (s *session) sendConnectionClose(quicErr *qerr.QuicError) error {
-	packet, err := s.packer.PackConnectionClose(&wire.ConnectionCloseFrame{
+	return s.sendConnectionCloseFrame(&wire.ConnectionCloseFrame{
 		ErrorCode:    quicErr.ErrorCode,
 		ReasonPhrase: quicErr.ErrorMessage,
 	})
+}
+
+func (s *session) sendApplicationClose(appErr *applicationError) error {
+	// gQUIC doesn't have application error codes
+	if !s.version.UsesIETFFrameFormat() {
+		return s.sendConnectionClose(qerr.Error(qerr.PeerGoingAway, appErr.reason))
+	}
+	return s.sendConnectionCloseFrame(&wire.ConnectionCloseFrame{
+		IsApplicationError: true,
+		ErrorCode:          qerr.ErrorCode(appErr.errorCode),
+		ReasonPhrase:       appErr.reason,
+	})
+}
+
+func (s *session) sendConnectionCloseFrame(ccf *wire.ConnectionCloseFrame) error {
+	packet, err := s.packer.PackConnectionClose(ccf)
 	if err != nil {
 		return err
 	}
 	s.logPacket(packet)
+	s.addToFrameHistory(packet)
 	return s.conn.Write(packet.raw)
 }
 
+func (s *session) addToFrameHistory(packet *packedPacket) {
+	if s.frameHistory == nil {
+		return
+	}
+	for _, frame := range packet.frames {
+		s.frameHistory.Add(frame, true)
+	}
+}
+
 func (s *session) logPacket(packet *packedPacket) {
 	if !s.logger.Debug() {
 		// We don't need to allocate the slices for calling the format functions
@@ -1139,7 +2025,9 @@ func (s *session) OpenUniStreamSync() (SendStream, error) {
 
 func (s *session) newStream(id protocol.StreamID) streamI {
 	flowController := s.newFlowController(id)
-	return newStream(id, s, flowController, s.version)
+	str := newStream(id, s, flowController, s.reassemblyLimiter, s.version)
+	s.onStreamOpened(str)
+	return str
 }
 
 func (s *session) newFlowController(id protocol.StreamID) flowcontrol.StreamFlowController {
@@ -1147,17 +2035,19 @@ func (s *session) newFlowController(id protocol.StreamID) flowcontrol.StreamFlow
 	if s.peerParams != nil {
 		initialSendWindow = s.peerParams.StreamFlowControlWindow
 	}
-	return flowcontrol.NewStreamFlowController(
+	fc := flowcontrol.NewStreamFlowController(
 		id,
 		s.version.StreamContributesToConnectionFlowControl(id),
 		s.connFlowController,
-		protocol.ReceiveStreamFlowControlWindow,
+		protocol.ByteCount(s.config.InitialReceiveStreamFlowControlWindow),
 		protocol.ByteCount(s.config.MaxReceiveStreamFlowControlWindow),
 		initialSendWindow,
 		s.onHasStreamWindowUpdate,
 		s.rttStats,
 		s.logger,
 	)
+	s.invariants.StreamOpened(id, fc)
+	return fc
 }
 
 func (s *session) newCryptoStream() cryptoStreamI {
@@ -1166,7 +2056,7 @@ func (s *session) newCryptoStream() cryptoStreamI {
 		id,
 		s.version.StreamContributesToConnectionFlowControl(id),
 		s.connFlowController,
-		protocol.ReceiveStreamFlowControlWindow,
+		protocol.ByteCount(s.config.InitialReceiveStreamFlowControlWindow),
 		protocol.ByteCount(s.config.MaxReceiveStreamFlowControlWindow),
 		0,
 		s.onHasStreamWindowUpdate,
@@ -1189,22 +2079,34 @@ func (s *session) scheduleSending() {
 	}
 }
 
+// scheduleSendingStreamData signals that we have stream data for sending
+func (s *session) scheduleSendingStreamData() {
+	select {
+	case s.streamDataScheduled <- struct{}{}:
+	default:
+	}
+}
+
 func (s *session) tryQueueingUndecryptablePacket(p *receivedPacket) {
 	if s.handshakeComplete {
 		s.logger.Debugf("Received undecryptable packet from %s after the handshake: %#v, %d bytes data", p.remoteAddr.String(), p.header, len(p.data))
+		p.release()
 		return
 	}
-	if len(s.undecryptablePackets)+1 > protocol.MaxUndecryptablePackets {
+	if len(s.undecryptablePackets)+1 > s.config.MaxUndecryptablePackets ||
+		s.undecryptablePacketBytes+uint64(len(p.data)) > s.config.MaxUndecryptablePacketBytes {
 		// if this is the first time the undecryptablePackets runs full, start the timer to send a Public Reset
 		if s.receivedTooManyUndecrytablePacketsTime.IsZero() {
 			s.receivedTooManyUndecrytablePacketsTime = time.Now()
 			s.maybeResetTimer()
 		}
 		s.logger.Infof("Dropping undecrytable packet 0x%x (undecryptable packet queue full)", p.header.PacketNumber)
+		p.release()
 		return
 	}
 	s.logger.Infof("Queueing packet 0x%x for later decryption", p.header.PacketNumber)
 	s.undecryptablePackets = append(s.undecryptablePackets, p)
+	s.undecryptablePacketBytes += uint64(len(p.data))
 }
 
 func (s *session) tryDecryptingQueuedPackets() {
@@ -1212,6 +2114,7 @@ func (s *session) tryDecryptingQueuedPackets() {
 		s.handlePacket(p)
 	}
 	s.undecryptablePackets = s.undecryptablePackets[:0]
+	s.undecryptablePacketBytes = 0
 }
 
 func (s *session) queueControlFrame(f wire.Frame) {
@@ -1219,6 +2122,20 @@ func (s *session) queueControlFrame(f wire.Frame) {
 	s.scheduleSending()
 }
 
+func (s *session) sendExtensionFrame(frameType byte, data []byte) error {
+	if !wire.IsExtensionFrameType(frameType) {
+		return fmt.Errorf("invalid extension frame type 0x%x", frameType)
+	}
+	if protocol.ByteCount(len(data)) > protocol.MaxExtensionFrameDataLen {
+		return fmt.Errorf("extension frame too large (%d bytes, maximum %d bytes)", len(data), protocol.MaxExtensionFrameDataLen)
+	}
+	s.queueControlFrame(&wire.ExtensionFrame{
+		FrameType: frameType,
+		Data:      append([]byte(nil), data...),
+	})
+	return nil
+}
+
 func (s *session) onHasStreamWindowUpdate(id protocol.StreamID) {
 	s.windowUpdateQueue.AddStream(id)
 	s.scheduleSending()
@@ -1231,15 +2148,49 @@ func (s *session) onHasConnectionWindowUpdate() {
 
 func (s *session) onHasStreamData(id protocol.StreamID) {
 	s.streamFramer.AddActiveStream(id)
-	s.scheduleSending()
+	s.scheduleSendingStreamData()
 }
 
 func (s *session) onStreamCompleted(id protocol.StreamID) {
 	if err := s.streamsMap.DeleteStream(id); err != nil {
 		s.Close(err)
+		return
+	}
+	s.invariants.StreamCompleted(id)
+	if s.streamAccounting != nil {
+		s.streamAccounting.Completed(id, time.Now())
+	}
+}
+
+func (s *session) onStreamOpened(str streamRecorder) {
+	if s.streamAccounting != nil {
+		s.streamAccounting.Opened(str)
 	}
 }
 
+// handleFrameForClosedStream is called when a frame is received for a stream that was already closed and garbage collected.
+// These frames are expected (e.g. retransmissions of frames that were already received), so they are only logged and counted.
+func (s *session) handleFrameForClosedStream(id protocol.StreamID) {
+	if s.logger.Debug() {
+		s.logger.Debugf("Ignoring frame for closed stream %d", id)
+	}
+	s.statsMutex.Lock()
+	s.stats.LateStreamFrames++
+	s.statsMutex.Unlock()
+}
+
+func (s *session) CorrelationID() string {
+	return s.correlationID
+}
+
+// getCorrelationID derives an identifier for a session from the connection ID chosen by the client.
+// Client and server derive the same identifier, so it can be used to correlate their logs.
+// The start time of the session is not included, since it differs between client and server.
+func getCorrelationID(clientConnID protocol.ConnectionID) string {
+	h := sha256.Sum256(clientConnID)
+	return hex.EncodeToString(h[:protocol.CorrelationIDLen])
+}
+
 func (s *session) LocalAddr() net.Addr {
 	return s.conn.LocalAddr()
 }
@@ -1248,6 +2199,94 @@ func (s *session) RemoteAddr() net.Addr {
 	return s.conn.RemoteAddr()
 }
 
+func (s *session) Migrate(pconn net.PacketConn) error {
+	if s.perspective == protocol.PerspectiveServer {
+		return errors.New("only clients can migrate a session")
+	}
+	done := make(chan struct{})
+	select {
+	case s.migrationChan <- migration{pconn: pconn, done: done}:
+		<-done
+		return nil
+	case <-s.ctx.Done():
+		return errors.New("session already closed")
+	}
+}
+
+func (s *session) SetIdleTimeout(t time.Duration) {
+	if t == 0 {
+		t = protocol.DefaultIdleTimeout
+	}
+	select {
+	case s.idleTimeoutChan <- t:
+	case <-s.ctx.Done():
+	}
+}
+
+func (s *session) SetDSCP(dscp uint8) error {
+	if err := checkDSCP(dscp); err != nil {
+		return err
+	}
+	s.conn.SetDSCP(dscp)
+	return nil
+}
+
+func (s *session) SetTTL(ttl uint8) {
+	s.conn.SetTTL(ttl)
+}
+
+// getIdleTimeout returns the idle timeout of the session.
+// This is the smaller value of our idle timeout and the idle timeout announced by the peer.
+func (s *session) getIdleTimeout() time.Duration {
+	if s.peerParams != nil && s.peerParams.IdleTimeout < s.idleTimeout {
+		return s.peerParams.IdleTimeout
+	}
+	return s.idleTimeout
+}
+
+// getKeepAliveInterval returns the time after which a PING frame is sent, if no packet was received from the peer.
+// It returns 0 if no PING frame should be sent.
+func (s *session) getKeepAliveInterval() time.Duration {
+	if !s.handshakeComplete {
+		return 0
+	}
+	if s.config.KeepAlivePeriod > 0 && s.streamsMap.NumStreams() > 0 {
+		return s.config.KeepAlivePeriod
+	}
+	if s.config.KeepAlive {
+		return s.getIdleTimeout() / 2
+	}
+	return 0
+}
+
+func (s *session) migrate(pconn net.PacketConn) {
+	s.logger.Infof("Migrating from %s to %s", s.conn.LocalAddr(), pconn.LocalAddr())
+	// Switch to a new connection ID (if the server issued any other connection IDs) before sending any packet on the new path,
+	// such that the paths can't be linked by an on-path observer.
+	if s.connIDManager.Rotate() {
+		s.logger.Debugf("Switched to connection ID %s", s.destConnID)
+	}
+	s.conn.SetPacketConn(wrapConn(pconn))
+	if s.ecnEnabled {
+		s.conn.EnableECN()
+	}
+	if s.mtuDiscoverer != nil {
+		// The path MTU of the new path is unknown.
+		// Fall back to the base packet size, and restart the discovery.
+		if base := s.mtuDiscoverer.BaseSize(); base > 0 {
+			s.packer.SetMaxPacketSize(base)
+			s.sentPacketHandler.SetMaxPacketSize(s.packer.MaxPacketSize())
+		}
+		if s.conn.EnableMTUDiscovery() {
+			s.mtuDiscoverer.Restart(time.Now())
+		} else {
+			s.mtuDiscoverer = nil
+		}
+	}
+	// send a packet right away, so that the server learns about the new address
+	s.queueControlFrame(&wire.PingFrame{})
+}
+
 func (s *session) getCryptoStream() cryptoStreamI {
 	return s.cryptoStream
 }
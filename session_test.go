@@ -5,17 +5,20 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"runtime/pprof"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
 	"github.com/lucas-clemente/quic-go/internal/ackhandler"
+	"github.com/lucas-clemente/quic-go/internal/congestion"
 	"github.com/lucas-clemente/quic-go/internal/crypto"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/mocks"
@@ -27,16 +30,39 @@ import (
 	"github.com/lucas-clemente/quic-go/qerr"
 )
 
+// writtenToPacket is a packet written using WriteTo, together with the address it was written to
+type writtenToPacket struct {
+	data []byte
+	addr net.Addr
+}
+
 type mockConnection struct {
 	remoteAddr net.Addr
 	localAddr  net.Addr
 	written    chan []byte
+	// packets written using WriteTo
+	writtenTo chan writtenToPacket
+
+	enableECN bool
+	ecn       protocol.ECN
+	dscp      uint8
+	ttl       uint8
+
+	supportsBatching bool
+	supportsDF       bool
+	// the segment sizes of the calls to WriteSegments.
+	// The packets are written to the written channel.
+	segmentSizes chan int
+
+	receiveBufferSize, sendBufferSize int
 }
 
 func newMockConnection() *mockConnection {
 	return &mockConnection{
-		remoteAddr: &net.UDPAddr{},
-		written:    make(chan []byte, 100),
+		remoteAddr:   &net.UDPAddr{},
+		written:      make(chan []byte, 100),
+		writtenTo:    make(chan writtenToPacket, 100),
+		segmentSizes: make(chan int, 100),
 	}
 }
 
@@ -50,14 +76,53 @@ func (m *mockConnection) Write(p []byte) error {
 	}
 	return nil
 }
-func (m *mockConnection) Read([]byte) (int, net.Addr, error) { panic("not implemented") }
+func (m *mockConnection) WriteSegments(b []byte, segmentSize int) (int, error) {
+	m.segmentSizes <- segmentSize
+	var sent int
+	for len(b) > 0 {
+		n := utils.Min(len(b), segmentSize)
+		if err := m.Write(b[:n]); err != nil {
+			return sent, err
+		}
+		sent++
+		b = b[n:]
+	}
+	return sent, nil
+}
+func (m *mockConnection) WriteTo(p []byte, addr net.Addr) error {
+	b := make([]byte, len(p))
+	copy(b, p)
+	select {
+	case m.writtenTo <- writtenToPacket{data: b, addr: addr}:
+	default:
+		panic("mockConnection channel full")
+	}
+	return nil
+}
+func (m *mockConnection) Read([]byte) (int, net.Addr, packetInfo, error) {
+	panic("not implemented")
+}
 
 func (m *mockConnection) SetCurrentRemoteAddr(addr net.Addr) {
 	m.remoteAddr = addr
 }
-func (m *mockConnection) LocalAddr() net.Addr  { return m.localAddr }
-func (m *mockConnection) RemoteAddr() net.Addr { return m.remoteAddr }
-func (*mockConnection) Close() error           { panic("not implemented") }
+func (m *mockConnection) SetPacketConn(pconn net.PacketConn) {
+	m.localAddr = pconn.LocalAddr()
+}
+func (m *mockConnection) EnableECN() bool         { return m.enableECN }
+func (m *mockConnection) SetECN(ecn protocol.ECN) { m.ecn = ecn }
+func (m *mockConnection) SetDSCP(dscp uint8)      { m.dscp = dscp }
+func (m *mockConnection) SetTTL(ttl uint8)        { m.ttl = ttl }
+func (m *mockConnection) SupportsBatching() bool  { return m.supportsBatching }
+func (m *mockConnection) LocalAddr() net.Addr     { return m.localAddr }
+func (m *mockConnection) RemoteAddr() net.Addr    { return m.remoteAddr }
+func (*mockConnection) Close() error              { panic("not implemented") }
+func (m *mockConnection) SocketBufferSizes() (int, int) {
+	return m.receiveBufferSize, m.sendBufferSize
+}
+func (m *mockConnection) EnableMTUDiscovery() bool {
+	return m.supportsDF
+}
 
 func areSessionsRunning() bool {
 	var b bytes.Buffer
@@ -227,6 +292,19 @@ var _ = Describe("Session", func() {
 				Expect(err).ToNot(HaveOccurred())
 			})
 
+			It("counts STREAM frames for closed streams", func() {
+				streamManager.EXPECT().GetOrOpenReceiveStream(protocol.StreamID(5)).Return(nil, nil).Times(2)
+				for _, id := range []protocol.StreamID{5, 5} {
+					err := sess.handleStreamFrame(&wire.StreamFrame{
+						StreamID: id,
+						Data:     []byte("foobar"),
+					}, protocol.EncryptionForwardSecure)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				streamManager.EXPECT().NumStreams()
+				Expect(sess.Stats().LateStreamFrames).To(BeEquivalentTo(2))
+			})
+
 			It("errors on a STREAM frame that would close the crypto stream", func() {
 				err := sess.handleStreamFrame(&wire.StreamFrame{
 					StreamID: sess.version.CryptoStreamID(),
@@ -288,6 +366,54 @@ var _ = Describe("Session", func() {
 			})
 		})
 
+		Context("ECN", func() {
+			BeforeEach(func() {
+				sess.config.EnableECN = true
+				sess.version = protocol.VersionTLS
+				mconn.enableECN = true
+			})
+
+			It("marks packets with ECT(0)", func() {
+				sess.maybeEnableECN()
+				Expect(sess.ecnEnabled).To(BeTrue())
+				Expect(mconn.ecn).To(Equal(protocol.ECT0))
+				Expect(sess.sentPacketHandler.ECN()).To(Equal(protocol.ECT0))
+			})
+
+			It("doesn't use ECN if it's not enabled in the config", func() {
+				sess.config.EnableECN = false
+				sess.maybeEnableECN()
+				Expect(sess.ecnEnabled).To(BeFalse())
+				Expect(mconn.ecn).To(Equal(protocol.ECNNon))
+			})
+
+			It("doesn't use ECN with gQUIC", func() {
+				sess.version = protocol.Version39
+				sess.maybeEnableECN()
+				Expect(sess.ecnEnabled).To(BeFalse())
+				Expect(mconn.ecn).To(Equal(protocol.ECNNon))
+			})
+
+			It("doesn't use ECN if the connection doesn't support it", func() {
+				mconn.enableECN = false
+				sess.maybeEnableECN()
+				Expect(sess.ecnEnabled).To(BeFalse())
+				Expect(mconn.ecn).To(Equal(protocol.ECNNon))
+			})
+
+			It("stops marking packets when ECN validation fails", func() {
+				sess.maybeEnableECN()
+				sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+				sph.EXPECT().ReceivedAck(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
+				sph.EXPECT().ECN().Return(protocol.ECNNon)
+				sph.EXPECT().GetLowestPacketNotConfirmedAcked()
+				sess.sentPacketHandler = sph
+				Expect(sess.handleAckFrame(&wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}}, protocol.EncryptionForwardSecure)).To(Succeed())
+				Expect(sess.ecnEnabled).To(BeFalse())
+				Expect(mconn.ecn).To(Equal(protocol.ECNNon))
+			})
+		})
+
 		Context("handling RST_STREAM frames", func() {
 			It("closes the streams for writing", func() {
 				f := &wire.RstStreamFrame{
@@ -333,6 +459,41 @@ var _ = Describe("Session", func() {
 			})
 		})
 
+		Context("handling EXPIRED_STREAM_DATA frames", func() {
+			It("passes the frame to the stream", func() {
+				f := &wire.ExpiredStreamDataFrame{StreamID: 555, Offset: 0x1337}
+				str := NewMockReceiveStreamI(mockCtrl)
+				streamManager.EXPECT().GetOrOpenReceiveStream(protocol.StreamID(555)).Return(str, nil)
+				str.EXPECT().handleExpiredStreamDataFrame(f)
+				err := sess.handleFrames([]wire.Frame{f}, protocol.EncryptionForwardSecure)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("returns errors", func() {
+				f := &wire.ExpiredStreamDataFrame{StreamID: 7, Offset: 0x1337}
+				testErr := errors.New("flow control violation")
+				str := NewMockReceiveStreamI(mockCtrl)
+				streamManager.EXPECT().GetOrOpenReceiveStream(protocol.StreamID(7)).Return(str, nil)
+				str.EXPECT().handleExpiredStreamDataFrame(f).Return(testErr)
+				err := sess.handleExpiredStreamDataFrame(f)
+				Expect(err).To(MatchError(testErr))
+			})
+
+			It("ignores EXPIRED_STREAM_DATA frames for closed streams", func() {
+				streamManager.EXPECT().GetOrOpenReceiveStream(protocol.StreamID(3)).Return(nil, nil)
+				err := sess.handleExpiredStreamDataFrame(&wire.ExpiredStreamDataFrame{StreamID: 3, Offset: 0x1337})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("errors when an EXPIRED_STREAM_DATA frame is received for the crypto stream", func() {
+				err := sess.handleExpiredStreamDataFrame(&wire.ExpiredStreamDataFrame{
+					StreamID: sess.version.CryptoStreamID(),
+					Offset:   0x1337,
+				})
+				Expect(err).To(MatchError("Received an EXPIRED_STREAM_DATA frame for the crypto stream"))
+			})
+		})
+
 		Context("handling MAX_DATA and MAX_STREAM_DATA frames", func() {
 			var connFC *mocks.MockConnectionFlowController
 
@@ -434,9 +595,11 @@ var _ = Describe("Session", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
-		It("rejects PATH_RESPONSE frames", func() {
+		It("ignores PATH_RESPONSE frames that don't match a PATH_CHALLENGE", func() {
+			origAddr := sess.conn.RemoteAddr()
 			err := sess.handleFrames([]wire.Frame{&wire.PathResponseFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}}, protocol.EncryptionUnspecified)
-			Expect(err).To(MatchError("unexpected PATH_RESPONSE frame"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.conn.RemoteAddr()).To(Equal(origAddr))
 		})
 
 		It("handles PATH_CHALLENGE frames", func() {
@@ -447,6 +610,104 @@ var _ = Describe("Session", func() {
 			Expect(sess.packer.controlFrames[0].(*wire.PathResponseFrame).Data).To(Equal([8]byte{1, 2, 3, 4, 5, 6, 7, 8}))
 		})
 
+		It("handles NEW_CONNECTION_ID frames", func() {
+			f := &wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{1, 3, 3, 7}}
+			err := sess.handleFrames([]wire.Frame{f}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.connIDManager.queue).To(Equal([]*wire.NewConnectionIDFrame{f}))
+		})
+
+		It("handles RETIRE_CONNECTION_ID frames", func() {
+			sessionRunner.EXPECT().addConnectionID(gomock.Any(), sess).Times(2)
+			sessionRunner.EXPECT().getStatelessResetToken(gomock.Any()).Times(2)
+			Expect(sess.connIDGenerator.SetHandshakeComplete()).To(Succeed()) // no-op, the connection ID count is 1
+			Expect(sess.connIDGenerator.issueNewConnID()).To(Succeed())
+			sessionRunner.EXPECT().removeConnectionID(sess.srcConnID)
+			err := sess.handleFrames([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 0}}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.connIDGenerator.activeSrcConnIDs).To(HaveLen(2))
+		})
+
+		It("errors when the peer retires a connection ID that was never issued", func() {
+			err := sess.handleFrames([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 1}}, protocol.EncryptionForwardSecure)
+			Expect(err).To(MatchError("InvalidFrameData: tried to retire connection ID 1, but the highest connection ID issued is 0"))
+		})
+
+		It("handles ACK_FREQUENCY frames", func() {
+			sess.config.Features = []Feature{FeatureAckFrequency}
+			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
+			sess.receivedPacketHandler = rph
+			f := &wire.AckFrequencyFrame{SequenceNumber: 1, PacketTolerance: 5, MaxAckDelay: 10 * time.Millisecond}
+			rph.EXPECT().ReceivedAckFrequencyFrame(f)
+			err := sess.handleFrames([]wire.Frame{f}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("errors when receiving an ACK_FREQUENCY frame, if the extension is not enabled", func() {
+			err := sess.handleFrames([]wire.Frame{&wire.AckFrequencyFrame{PacketTolerance: 5}}, protocol.EncryptionForwardSecure)
+			Expect(err).To(MatchError("InvalidFrameData: received an ACK_FREQUENCY frame, but the ACK frequency extension is not enabled"))
+		})
+
+		Context("handling extension frames", func() {
+			AfterEach(func() {
+				extensionFrames = extensionFrameRegistry{}
+			})
+
+			It("calls the registered handler", func() {
+				var receivedSess Session
+				var receivedData []byte
+				err := extensionFrames.Register(0x1a, func(s Session, data []byte) {
+					receivedSess = s
+					receivedData = data
+				})
+				Expect(err).ToNot(HaveOccurred())
+				err = sess.handleFrames([]wire.Frame{&wire.ExtensionFrame{FrameType: 0x1a, Data: []byte("foobar")}}, protocol.EncryptionUnspecified)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(receivedSess).To(Equal(sess))
+				Expect(receivedData).To(Equal([]byte("foobar")))
+			})
+
+			It("rejects extension frames that no handler was registered for", func() {
+				err := sess.handleFrames([]wire.Frame{&wire.ExtensionFrame{FrameType: 0x1a}}, protocol.EncryptionUnspecified)
+				Expect(err).To(MatchError("InvalidFrameData: unknown type byte 0x1a"))
+			})
+
+			It("ignores extension frames that no handler was registered for, if configured to ignore unknown frames", func() {
+				sess.config.UnknownFrames = UnknownFramesIgnore
+				err := sess.handleFrames([]wire.Frame{&wire.ExtensionFrame{FrameType: 0x1a}}, protocol.EncryptionUnspecified)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("doesn't register a frame type twice", func() {
+				Expect(extensionFrames.Register(0x1a, func(Session, []byte) {})).To(Succeed())
+				Expect(extensionFrames.Register(0x1a, func(Session, []byte) {})).To(MatchError("extension frame type 0x1a already registered"))
+			})
+
+			It("doesn't register invalid frame types", func() {
+				Expect(extensionFrames.Register(0x7, func(Session, []byte) {})).To(MatchError("invalid extension frame type 0x7 (must be between 0x18 and 0x1f)"))
+			})
+		})
+
+		Context("sending extension frames", func() {
+			It("queues extension frames", func() {
+				data := []byte("foobar")
+				Expect(sess.sendExtensionFrame(0x1b, data)).To(Succeed())
+				data[0] = 'F' // the data is copied
+				Expect(sess.packer.controlFrames).To(Equal([]wire.Frame{&wire.ExtensionFrame{FrameType: 0x1b, Data: []byte("foobar")}}))
+			})
+
+			It("refuses to send frames of invalid types", func() {
+				Expect(sess.sendExtensionFrame(0x42, nil)).To(MatchError("invalid extension frame type 0x42"))
+				Expect(sess.packer.controlFrames).To(BeEmpty())
+			})
+
+			It("refuses to send frames that are too large", func() {
+				err := sess.sendExtensionFrame(0x1b, make([]byte, protocol.MaxExtensionFrameDataLen+1))
+				Expect(err).To(MatchError(fmt.Sprintf("extension frame too large (%d bytes, maximum %d bytes)", protocol.MaxExtensionFrameDataLen+1, protocol.MaxExtensionFrameDataLen)))
+				Expect(sess.packer.controlFrames).To(BeEmpty())
+			})
+		})
+
 		It("handles BLOCKED frames", func() {
 			err := sess.handleFrames([]wire.Frame{&wire.BlockedFrame{}}, protocol.EncryptionUnspecified)
 			Expect(err).NotTo(HaveOccurred())
@@ -473,7 +734,22 @@ var _ = Describe("Session", func() {
 		})
 
 		It("handles CONNECTION_CLOSE frames", func() {
-			testErr := qerr.Error(qerr.ProofInvalid, "foobar")
+			testErr := qerr.RemoteError(qerr.ProofInvalid, "foobar")
+			streamManager.EXPECT().CloseWithError(testErr)
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			go func() {
+				defer GinkgoRecover()
+				err := sess.run()
+				Expect(err).To(MatchError(testErr))
+			}()
+			err := sess.handleFrames([]wire.Frame{&wire.ConnectionCloseFrame{ErrorCode: qerr.ProofInvalid, ReasonPhrase: "foobar"}}, protocol.EncryptionUnspecified)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess.Context().Done()).Should(BeClosed())
+		})
+
+		It("truncates long reason phrases", func() {
+			sess.config.MaxReasonPhraseLength = 3
+			testErr := qerr.RemoteError(qerr.ProofInvalid, "foo")
 			streamManager.EXPECT().CloseWithError(testErr)
 			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
 			go func() {
@@ -485,6 +761,55 @@ var _ = Describe("Session", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(sess.Context().Done()).Should(BeClosed())
 		})
+
+		It("truncates reason phrases without splitting a multi-byte character", func() {
+			sess.config.MaxReasonPhraseLength = 4
+			testErr := qerr.RemoteError(qerr.ProofInvalid, "foo")
+			streamManager.EXPECT().CloseWithError(testErr)
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			go func() {
+				defer GinkgoRecover()
+				err := sess.run()
+				Expect(err).To(MatchError(testErr))
+			}()
+			// ä is encoded in 2 bytes, the limit falls between them
+			err := sess.handleFrames([]wire.Frame{&wire.ConnectionCloseFrame{ErrorCode: qerr.ProofInvalid, ReasonPhrase: "fooäbar"}}, protocol.EncryptionUnspecified)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess.Context().Done()).Should(BeClosed())
+		})
+
+		It("truncates reason phrases to a valid UTF-8 string", func() {
+			Expect(truncateReasonPhrase("foobar", 10)).To(Equal("foobar"))
+			Expect(truncateReasonPhrase("foobar", 3)).To(Equal("foo"))
+			Expect(truncateReasonPhrase("fooäbar", 5)).To(Equal("fooä"))
+			Expect(truncateReasonPhrase("foo€bar", 5)).To(Equal("foo"))
+			Expect(truncateReasonPhrase("€", 2)).To(BeEmpty())
+			Expect(utf8.ValidString(truncateReasonPhrase("foo€bar", 4))).To(BeTrue())
+		})
+
+		It("handles APPLICATION_CLOSE frames", func() {
+			expectedErr := &applicationError{errorCode: 0x1337, reason: "foobar", remote: true}
+			streamManager.EXPECT().CloseWithError(expectedErr)
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			go func() {
+				defer GinkgoRecover()
+				err := sess.run()
+				Expect(err).To(Equal(expectedErr))
+				appErr, ok := err.(ApplicationError)
+				Expect(ok).To(BeTrue())
+				Expect(appErr.ErrorCode()).To(Equal(ErrorCode(0x1337)))
+				Expect(appErr.Reason()).To(Equal("foobar"))
+				Expect(appErr.Remote()).To(BeTrue())
+			}()
+			err := sess.handleFrames([]wire.Frame{&wire.ConnectionCloseFrame{
+				IsApplicationError: true,
+				ErrorCode:          0x1337,
+				ReasonPhrase:       "foobar",
+			}}, protocol.EncryptionUnspecified)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess.Context().Done()).Should(BeClosed())
+			Expect(mconn.written).To(BeEmpty())
+		})
 	})
 
 	It("tells its versions", func() {
@@ -533,9 +858,79 @@ var _ = Describe("Session", func() {
 			Expect(sess.Context().Done()).To(BeClosed())
 		})
 
+		It("closes when deleting a stream fails", func() {
+			testErr := errors.New("unknown stream")
+			streamManager.EXPECT().DeleteStream(protocol.StreamID(5)).Return(testErr)
+			streamManager.EXPECT().CloseWithError(qerr.ToQuicError(testErr))
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			sess.onStreamCompleted(5)
+			Eventually(areSessionsRunning).Should(BeFalse())
+			Expect(sess.Context().Done()).To(BeClosed())
+		})
+
+		It("delivers the records of completed streams", func() {
+			records := make(chan StreamRecord, 2)
+			sess.config.OnStreamCompleted = func(_ Session, r StreamRecord) { records <- r }
+			sess.streamAccounting = newStreamAccounting(func(r StreamRecord) { sess.config.OnStreamCompleted(sess, r) })
+			sess.onStreamOpened(&mockStreamRecorder{id: 5})
+			sess.onStreamOpened(&mockStreamRecorder{id: 7})
+			streamManager.EXPECT().DeleteStream(protocol.StreamID(5))
+			sess.onStreamCompleted(5)
+			var r StreamRecord
+			Eventually(records).Should(Receive(&r))
+			Expect(r.StreamID).To(Equal(protocol.StreamID(5)))
+			Expect(r.SessionClosed).To(BeFalse())
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			sess.Close(nil)
+			Eventually(areSessionsRunning).Should(BeFalse())
+			Eventually(records).Should(Receive(&r))
+			Expect(r.StreamID).To(Equal(protocol.StreamID(7)))
+			Expect(r.SessionClosed).To(BeTrue())
+		})
+
+		It("closes with an application error", func() {
+			sess.version = versionIETFFrames
+			sess.packer.version = versionIETFFrames
+			streamManager.EXPECT().CloseWithError(&applicationError{errorCode: 0x1337, reason: "foobar"})
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			Expect(sess.CloseWithError(0x1337, "foobar")).To(Succeed())
+			Eventually(areSessionsRunning).Should(BeFalse())
+			buf := &bytes.Buffer{}
+			err := (&wire.ConnectionCloseFrame{
+				IsApplicationError: true,
+				ErrorCode:          0x1337,
+				ReasonPhrase:       "foobar",
+			}).Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mconn.written).To(Receive(ContainSubstring(buf.String())))
+			Expect(sess.Context().Done()).To(BeClosed())
+		})
+
+		It("sends a CONNECTION_CLOSE when closing with an application error, for gQUIC", func() {
+			streamManager.EXPECT().CloseWithError(&applicationError{errorCode: 0x1337, reason: "foobar"})
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			Expect(sess.CloseWithError(0x1337, "foobar")).To(Succeed())
+			Eventually(areSessionsRunning).Should(BeFalse())
+			buf := &bytes.Buffer{}
+			err := (&wire.ConnectionCloseFrame{ErrorCode: qerr.PeerGoingAway, ReasonPhrase: "foobar"}).Write(buf, sess.version)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mconn.written).To(Receive(ContainSubstring(buf.String())))
+		})
+
+		It("refuses to close with a reason that is not valid UTF-8", func() {
+			Expect(sess.CloseWithError(0x1337, "\xff")).To(MatchError("the reason must be valid UTF-8"))
+			Expect(sess.Context().Done()).ToNot(BeClosed())
+			// make the go routine return
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			sess.Close(nil)
+			Eventually(areSessionsRunning).Should(BeFalse())
+		})
+
 		It("closes streams with proper error", func() {
 			testErr := errors.New("test error")
-			streamManager.EXPECT().CloseWithError(qerr.Error(qerr.InternalError, testErr.Error()))
+			streamManager.EXPECT().CloseWithError(qerr.ToQuicError(testErr))
 			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
 			sess.Close(testErr)
 			Eventually(areSessionsRunning).Should(BeFalse())
@@ -568,6 +963,68 @@ var _ = Describe("Session", func() {
 			Expect(sess.Context().Done()).To(BeClosed())
 		})
 
+		It("calls the OnClose callback with a diagnostic snapshot, when closing due to an internal error", func() {
+			type closeEvent struct {
+				err      error
+				snapshot *DiagnosticSnapshot
+			}
+			closed := make(chan closeEvent, 1)
+			sess.config.OnClose = func(_ Session, err error, snapshot *DiagnosticSnapshot) {
+				closed <- closeEvent{err: err, snapshot: snapshot}
+			}
+			sess.frameHistory = newFrameHistory(10)
+			sess.frameHistory.Add(&wire.PingFrame{}, false)
+			testErr := errors.New("test error")
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			sess.Close(testErr)
+			var event closeEvent
+			Eventually(closed).Should(Receive(&event))
+			Expect(event.err).To(MatchError(testErr))
+			Expect(event.snapshot).ToNot(BeNil())
+			Expect(event.snapshot.RecentFrames).To(HaveLen(2))
+			Expect(event.snapshot.RecentFrames[0]).To(Equal("<- &wire.PingFrame{}"))
+			Expect(event.snapshot.RecentFrames[1]).To(ContainSubstring("-> &wire.ConnectionCloseFrame{"))
+			Expect(event.snapshot.CongestionWindow).ToNot(BeZero())
+			Expect(event.snapshot.ConnectionFlowControl.ReceiveWindow).To(BeEquivalentTo(protocol.ReceiveConnectionFlowControlWindow))
+		})
+
+		It("calls the OnClose callback without a diagnostic snapshot, when closing regularly", func() {
+			closed := make(chan *DiagnosticSnapshot, 1)
+			sess.config.OnClose = func(_ Session, err error, snapshot *DiagnosticSnapshot) {
+				Expect(err).To(MatchError(qerr.NetworkIdleTimeout))
+				closed <- snapshot
+			}
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			sess.Close(qerr.NetworkIdleTimeout)
+			var snapshot *DiagnosticSnapshot
+			Eventually(closed).Should(Receive(&snapshot))
+			Expect(snapshot).To(BeNil())
+		})
+
+		It("calls the OnClose callback without a diagnostic snapshot, when closing with an application error", func() {
+			closed := make(chan *DiagnosticSnapshot, 1)
+			sess.config.OnClose = func(_ Session, err error, snapshot *DiagnosticSnapshot) {
+				Expect(err).To(BeAssignableToTypeOf(&applicationError{}))
+				closed <- snapshot
+			}
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			sess.CloseWithError(0x1337, "foobar")
+			var snapshot *DiagnosticSnapshot
+			Eventually(closed).Should(Receive(&snapshot))
+			Expect(snapshot).To(BeNil())
+		})
+
+		It("doesn't call the OnClose callback when the session is replaced with another QUIC version", func() {
+			sess.config.OnClose = func(Session, error, *DiagnosticSnapshot) { Fail("OnClose should not be called") }
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			sess.Close(errCloseSessionForNewVersion)
+			Eventually(areSessionsRunning).Should(BeFalse())
+		})
+
 		It("cancels the context when the run loop exists", func() {
 			streamManager.EXPECT().CloseWithError(gomock.Any())
 			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
@@ -605,17 +1062,54 @@ var _ = Describe("Session", func() {
 			Expect(sess.largestRcvdPacketNumber).To(Equal(protocol.PacketNumber(5)))
 		})
 
+		It("confirms the handshake when receiving the first forward-secure packet", func() {
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{encryptionLevel: protocol.EncryptionSecure}, nil)
+			hdr.PacketNumber = 5
+			Expect(sess.handlePacketImpl(&receivedPacket{header: hdr})).To(Succeed())
+			Expect(sess.ConnectionState().HandshakeConfirmed).To(BeFalse())
+			Expect(sess.ConnectionState().Version).To(Equal(protocol.Version39))
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{encryptionLevel: protocol.EncryptionForwardSecure}, nil)
+			hdr = &wire.Header{PacketNumber: 6, PacketNumberLen: protocol.PacketNumberLen6}
+			Expect(sess.handlePacketImpl(&receivedPacket{header: hdr})).To(Succeed())
+			Expect(sess.ConnectionState().HandshakeConfirmed).To(BeTrue())
+			Expect(sess.WaitForHandshakeConfirmation(context.Background())).To(Succeed())
+			Expect(cryptoSetup.earlyKeysDiscarded).To(BeTrue())
+			Expect(sess.undecryptablePackets).To(BeNil())
+		})
+
 		It("informs the ReceivedPacketHandler", func() {
 			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil)
 			now := time.Now().Add(time.Hour)
 			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
-			rph.EXPECT().ReceivedPacket(protocol.PacketNumber(5), now, false)
+			rph.EXPECT().ReceivedPacket(protocol.PacketNumber(5), protocol.ECNNon, now, false)
 			sess.receivedPacketHandler = rph
 			hdr.PacketNumber = 5
 			err := sess.handlePacketImpl(&receivedPacket{header: hdr, rcvTime: now})
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("passes the ECN codepoint to the ReceivedPacketHandler", func() {
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil)
+			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
+			rph.EXPECT().ReceivedPacket(protocol.PacketNumber(5), protocol.ECNCE, gomock.Any(), false)
+			sess.receivedPacketHandler = rph
+			hdr.PacketNumber = 5
+			err := sess.handlePacketImpl(&receivedPacket{header: hdr, ecn: protocol.ECNCE})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("records the TTL of received packets", func() {
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil).Times(2)
+			Expect(sess.ConnectionState().ReceivedTTL).To(BeZero())
+			hdr.PacketNumber = 5
+			Expect(sess.handlePacketImpl(&receivedPacket{header: hdr, ttl: 57})).To(Succeed())
+			Expect(sess.ConnectionState().ReceivedTTL).To(BeEquivalentTo(57))
+			// the TTL is not known, e.g. because the platform doesn't allow reading it
+			hdr.PacketNumber = 6
+			Expect(sess.handlePacketImpl(&receivedPacket{header: hdr})).To(Succeed())
+			Expect(sess.ConnectionState().ReceivedTTL).To(BeEquivalentTo(57))
+		})
+
 		It("doesn't inform the ReceivedPacketHandler about Retry packets", func() {
 			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil)
 			now := time.Now().Add(time.Hour)
@@ -645,6 +1139,31 @@ var _ = Describe("Session", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("closes when receiving a frame of an unknown type", func() {
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, &wire.UnknownFrameTypeError{FrameType: 0x42})
+			hdr.PacketNumber = 5
+			err := sess.handlePacketImpl(&receivedPacket{header: hdr})
+			Expect(err).To(MatchError(qerr.Error(qerr.InvalidFrameData, "unknown type byte 0x42")))
+		})
+
+		It("processes and acknowledges packets containing a frame of an unknown type, if configured to ignore unknown frames", func() {
+			sess.config.UnknownFrames = UnknownFramesIgnore
+			packet := &unpackedPacket{
+				encryptionLevel: protocol.EncryptionForwardSecure,
+				frames:          []wire.Frame{&wire.MaxDataFrame{ByteOffset: 0x1337}},
+			}
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(packet, &wire.UnknownFrameTypeError{FrameType: 0x42})
+			hdr.PacketNumber = 5
+			err := sess.handlePacketImpl(&receivedPacket{header: hdr})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.largestRcvdPacketNumber).To(Equal(protocol.PacketNumber(5)))
+			ack := sess.receivedPacketHandler.GetAckFrame()
+			Expect(ack).ToNot(BeNil())
+			Expect(ack.LargestAcked()).To(Equal(protocol.PacketNumber(5)))
+			// the MAX_DATA frame was processed
+			Expect(sess.connFlowController.SendWindowSize()).To(Equal(protocol.ByteCount(0x1337)))
+		})
+
 		It("sets the {last,largest}RcvdPacketNumber, for an out-of-order packet", func() {
 			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil).Times(2)
 			hdr.PacketNumber = 5
@@ -659,6 +1178,67 @@ var _ = Describe("Session", func() {
 			Expect(sess.largestRcvdPacketNumber).To(Equal(protocol.PacketNumber(5)))
 		})
 
+		Context("releasing packet buffers", func() {
+			It("doesn't do anything for packets that aren't backed by a buffer", func() {
+				p := &receivedPacket{}
+				p.release()
+				Expect(p.buffer).To(BeNil())
+			})
+
+			It("returns the buffer to the pool only once", func() {
+				buf := getPacketBuffer()
+				*buf = append(*buf, []byte("foobar")...)
+				p := &receivedPacket{buffer: buf}
+				p.release()
+				Expect(*buf).To(BeEmpty())
+				Expect(p.buffer).To(BeNil())
+				p.release()
+			})
+
+			It("returns the buffer after the packet was processed", func() {
+				buf := getPacketBuffer()
+				*buf = append(*buf, []byte("raw headerfoobar")...)
+				hdr.PacketNumber = 5
+				hdr.Raw = (*buf)[:10]
+				unpacked := make(chan struct{})
+				unpacker.EXPECT().Unpack([]byte("raw header"), hdr, []byte("foobar")).Do(func([]byte, *wire.Header, []byte) {
+					close(unpacked)
+				}).Return(&unpackedPacket{}, nil)
+				streamManager.EXPECT().CloseWithError(gomock.Any())
+				go func() {
+					defer GinkgoRecover()
+					sess.run()
+				}()
+				sess.handlePacket(&receivedPacket{header: hdr, data: (*buf)[10:], buffer: buf})
+				Eventually(unpacked).Should(BeClosed())
+				sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+				Expect(sess.Close(nil)).To(Succeed())
+				Eventually(sess.Context().Done()).Should(BeClosed())
+				Expect(*buf).To(BeEmpty())
+			})
+
+			It("returns the buffer when the packet is dropped because too many packets are queued", func() {
+				for i := 0; i < protocol.MaxSessionUnprocessedPackets; i++ {
+					sess.handlePacket(&receivedPacket{header: hdr})
+				}
+				buf := getPacketBuffer()
+				p := &receivedPacket{header: hdr, buffer: buf}
+				sess.handlePacket(p)
+				Expect(p.buffer).To(BeNil())
+			})
+
+			It("returns the buffer of undecryptable packets received after the handshake", func() {
+				sess.handshakeComplete = true
+				p := &receivedPacket{
+					header:     hdr,
+					remoteAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234},
+					buffer:     getPacketBuffer(),
+				}
+				sess.tryQueueingUndecryptablePacket(p)
+				Expect(p.buffer).To(BeNil())
+			})
+		})
+
 		It("handles duplicate packets", func() {
 			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil).Times(2)
 			hdr.PacketNumber = 5
@@ -669,40 +1249,410 @@ var _ = Describe("Session", func() {
 		})
 
 		Context("updating the remote address", func() {
-			It("doesn't support connection migration", func() {
-				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil)
+			It("updates the remote address when the client migrates", func() {
+				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{encryptionLevel: protocol.EncryptionForwardSecure}, nil)
 				origAddr := sess.conn.(*mockConnection).remoteAddr
 				remoteIP := &net.IPAddr{IP: net.IPv4(192, 168, 0, 100)}
 				Expect(origAddr).ToNot(Equal(remoteIP))
 				p := receivedPacket{
 					remoteAddr: remoteIP,
-					header:     &wire.Header{PacketNumber: 1337},
+					header:     &wire.Header{PacketNumber: 1337, PacketNumberLen: protocol.PacketNumberLen6},
 				}
 				err := sess.handlePacketImpl(&p)
 				Expect(err).ToNot(HaveOccurred())
-				Expect(sess.conn.(*mockConnection).remoteAddr).To(Equal(origAddr))
+				Expect(sess.conn.(*mockConnection).remoteAddr).To(Equal(remoteIP))
 			})
-		})
-	})
-
-	Context("sending packets", func() {
-		BeforeEach(func() {
-			sess.packer.hasSentPacket = true // make sure this is not the first packet the packer sends
-		})
 
-		It("sends ACK frames", func() {
-			packetNumber := protocol.PacketNumber(0x035e)
-			err := sess.receivedPacketHandler.ReceivedPacket(packetNumber, time.Now(), true)
-			Expect(err).ToNot(HaveOccurred())
-			sent, err := sess.sendPacket()
-			Expect(err).NotTo(HaveOccurred())
-			Expect(sent).To(BeTrue())
-			Expect(mconn.written).To(HaveLen(1))
-			Expect(mconn.written).To(Receive(ContainSubstring(string([]byte{0x03, 0x5e}))))
-		})
+			It("updates the remote address when a NAT rebinds", func() {
+				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{encryptionLevel: protocol.EncryptionSecure}, nil)
+				sess.conn.(*mockConnection).remoteAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 100), Port: 1337}
+				newAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 100), Port: 1338}
+				err := sess.handlePacketImpl(&receivedPacket{
+					remoteAddr: newAddr,
+					header:     &wire.Header{PacketNumber: 1337, PacketNumberLen: protocol.PacketNumberLen6},
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess.conn.(*mockConnection).remoteAddr).To(Equal(newAddr))
+			})
 
-		It("adds MAX_STREAM_DATA frames", func() {
-			sess.windowUpdateQueue.callback(&wire.MaxStreamDataFrame{
+			It("doesn't update the remote address for unencrypted packets", func() {
+				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{encryptionLevel: protocol.EncryptionUnencrypted}, nil)
+				origAddr := sess.conn.(*mockConnection).remoteAddr
+				err := sess.handlePacketImpl(&receivedPacket{
+					remoteAddr: &net.IPAddr{IP: net.IPv4(192, 168, 0, 100)},
+					header:     &wire.Header{PacketNumber: 1337, PacketNumberLen: protocol.PacketNumberLen6},
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess.conn.(*mockConnection).remoteAddr).To(Equal(origAddr))
+			})
+
+			It("doesn't update the remote address for reordered packets", func() {
+				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{encryptionLevel: protocol.EncryptionForwardSecure}, nil).Times(2)
+				origAddr := sess.conn.(*mockConnection).remoteAddr
+				err := sess.handlePacketImpl(&receivedPacket{
+					remoteAddr: origAddr,
+					header:     &wire.Header{PacketNumber: 1337, PacketNumberLen: protocol.PacketNumberLen6},
+				})
+				Expect(err).ToNot(HaveOccurred())
+				err = sess.handlePacketImpl(&receivedPacket{
+					remoteAddr: &net.IPAddr{IP: net.IPv4(192, 168, 0, 100)},
+					header:     &wire.Header{PacketNumber: 1336, PacketNumberLen: protocol.PacketNumberLen6},
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess.conn.(*mockConnection).remoteAddr).To(Equal(origAddr))
+			})
+
+			Context("validating the new address, for IETF QUIC", func() {
+				var newAddr *net.UDPAddr
+
+				BeforeEach(func() {
+					sess.version = versionIETFFrames
+					sess.packer.version = versionIETFFrames
+					sess.pathValidator = newPathValidator(time.Second, 2)
+					newAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 100), Port: 1337}
+					go sess.sendQueue.Run()
+				})
+
+				AfterEach(func() {
+					sess.sendQueue.Close()
+				})
+
+				receivePacketFrom := func(addr net.Addr, pn protocol.PacketNumber) {
+					err := sess.handlePacketImpl(&receivedPacket{
+						remoteAddr: addr,
+						header:     &wire.Header{PacketNumber: pn, PacketNumberLen: protocol.PacketNumberLen6},
+					})
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				It("sends a PATH_CHALLENGE to the new address, and switches to it when receiving the PATH_RESPONSE", func() {
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{encryptionLevel: protocol.EncryptionForwardSecure}, nil)
+					origAddr := sess.conn.RemoteAddr()
+					receivePacketFrom(newAddr, 1337)
+					Expect(sess.conn.RemoteAddr()).To(Equal(origAddr))
+					var p writtenToPacket
+					Eventually(mconn.writtenTo).Should(Receive(&p))
+					Expect(p.addr).To(Equal(newAddr))
+					Expect(mconn.written).To(BeEmpty())
+					Expect(sess.pathValidator.challenges).To(HaveLen(1))
+					err := sess.handleFrames([]wire.Frame{&wire.PathResponseFrame{Data: sess.pathValidator.challenges[0]}}, protocol.EncryptionForwardSecure)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(sess.conn.RemoteAddr()).To(Equal(newAddr))
+				})
+
+				It("switches to a new connection ID when switching to the new address", func() {
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{encryptionLevel: protocol.EncryptionForwardSecure}, nil)
+					newConnID := protocol.ConnectionID{1, 3, 3, 7, 1, 3, 3, 7}
+					sess.connIDManager.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: newConnID, StatelessResetToken: [16]byte{0xde, 0xad}})
+					receivePacketFrom(newAddr, 1337)
+					sessionRunner.EXPECT().addResetToken([16]byte{0xde, 0xad})
+					err := sess.handleFrames([]wire.Frame{&wire.PathResponseFrame{Data: sess.pathValidator.challenges[0]}}, protocol.EncryptionForwardSecure)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(sess.conn.RemoteAddr()).To(Equal(newAddr))
+					Expect(sess.destConnID).To(Equal(newConnID))
+					Expect(sess.packer.destConnID).To(Equal(newConnID))
+					Expect(sess.packer.controlFrames).To(ContainElement(&wire.RetireConnectionIDFrame{SequenceNumber: 0}))
+				})
+
+				It("doesn't restart the validation when receiving more packets from the new address", func() {
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{encryptionLevel: protocol.EncryptionForwardSecure}, nil).Times(2)
+					receivePacketFrom(newAddr, 1337)
+					challenge := sess.pathValidator.challenges[0]
+					receivePacketFrom(newAddr, 1338)
+					Eventually(mconn.writtenTo).Should(HaveLen(1))
+					Consistently(mconn.writtenTo).Should(HaveLen(1))
+					Expect(sess.pathValidator.challenges).To(Equal([][8]byte{challenge}))
+				})
+
+				It("retransmits the PATH_CHALLENGE, and keeps the old address if the validation fails", func() {
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{encryptionLevel: protocol.EncryptionForwardSecure}, nil)
+					origAddr := sess.conn.RemoteAddr()
+					receivePacketFrom(newAddr, 1337)
+					Expect(sess.pathValidator.GetAlarmTimeout()).ToNot(BeZero())
+					Expect(sess.onPathValidationAlarm(time.Now())).To(Succeed())
+					Eventually(mconn.writtenTo).Should(HaveLen(2))
+					Expect(sess.pathValidator.challenges).To(HaveLen(2))
+					challenge := sess.pathValidator.challenges[0]
+					Expect(sess.onPathValidationAlarm(time.Now())).To(Succeed())
+					Consistently(mconn.writtenTo).Should(HaveLen(2))
+					Expect(sess.pathValidator.GetAlarmTimeout()).To(BeZero())
+					// a late PATH_RESPONSE doesn't change the address
+					err := sess.handleFrames([]wire.Frame{&wire.PathResponseFrame{Data: challenge}}, protocol.EncryptionForwardSecure)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(sess.conn.RemoteAddr()).To(Equal(origAddr))
+				})
+			})
+
+			It("doesn't allow servers to migrate", func() {
+				Expect(sess.Migrate(newMockPacketConn())).To(MatchError("only clients can migrate a session"))
+			})
+		})
+	})
+
+	Context("profiling labels", func() {
+		getLabels := func(labels pprof.LabelSet) map[string]string {
+			m := make(map[string]string)
+			pprof.ForLabels(pprof.WithLabels(context.Background(), labels), func(key, value string) bool {
+				m[key] = value
+				return true
+			})
+			return m
+		}
+
+		It("labels the connection ID, perspective and phase", func() {
+			Expect(getLabels(sess.profilingLabels("handshake"))).To(Equal(map[string]string{
+				"quic_connection_id": "0x0807060504030201",
+				"quic_perspective":   "Server",
+				"quic_phase":         "handshake",
+			}))
+		})
+	})
+
+	Context("user data", func() {
+		It("returns nil if no user data was set", func() {
+			Expect(sess.UserData()).To(BeNil())
+		})
+
+		It("stores user data", func() {
+			sess.SetUserData("foobar")
+			Expect(sess.UserData()).To(Equal("foobar"))
+			sess.SetUserData(42)
+			Expect(sess.UserData()).To(Equal(42))
+		})
+	})
+
+	Context("correlation ID", func() {
+		It("derives the correlation ID from the connection ID", func() {
+			Expect(sess.CorrelationID()).To(HaveLen(2 * protocol.CorrelationIDLen))
+			Expect(sess.CorrelationID()).To(Equal(getCorrelationID(protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1})))
+		})
+
+		It("uses different correlation IDs for different connection IDs", func() {
+			Expect(getCorrelationID(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8})).ToNot(Equal(getCorrelationID(protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1})))
+		})
+	})
+
+	Context("statistics", func() {
+		BeforeEach(func() {
+			sess.packer.hasSentPacket = true // make sure this is not the first packet the packer sends
+			sess.packer.cryptoSetup = &mockCryptoSetup{encLevelSeal: protocol.EncryptionForwardSecure}
+		})
+
+		It("reports the number of open streams", func() {
+			streamManager.EXPECT().NumStreams().Return(42)
+			Expect(sess.Stats().OpenStreams).To(Equal(42))
+		})
+
+		It("reports the socket buffer sizes", func() {
+			mconn.receiveBufferSize = 1 << 20
+			mconn.sendBufferSize = 1 << 19
+			streamManager.EXPECT().NumStreams()
+			stats := sess.Stats()
+			Expect(stats.ReceiveBufferSize).To(Equal(1 << 20))
+			Expect(stats.SendBufferSize).To(Equal(1 << 19))
+		})
+
+		It("counts received packets, frames and stream data", func() {
+			unpacker := NewMockUnpacker(mockCtrl)
+			sess.unpacker = unpacker
+			f := &wire.StreamFrame{StreamID: 5, Data: []byte("foobar")}
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+				encryptionLevel: protocol.EncryptionForwardSecure,
+				frames:          []wire.Frame{f, &wire.PingFrame{}},
+			}, nil)
+			str := NewMockReceiveStreamI(mockCtrl)
+			str.EXPECT().handleStreamFrame(f)
+			streamManager.EXPECT().GetOrOpenReceiveStream(protocol.StreamID(5)).Return(str, nil)
+			err := sess.handlePacketImpl(&receivedPacket{header: &wire.Header{PacketNumber: 1}})
+			Expect(err).ToNot(HaveOccurred())
+			streamManager.EXPECT().NumStreams()
+			stats := sess.Stats()
+			Expect(stats.PacketsReceived).To(BeEquivalentTo(1))
+			Expect(stats.FramesReceived).To(BeEquivalentTo(2))
+			Expect(stats.BytesReceived).To(BeEquivalentTo(6))
+		})
+
+		It("reports RTT, congestion control and loss detection statistics", func() {
+			sess.rttStats.UpdateRTT(100*time.Millisecond, 0, time.Now())
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().GetStats().Return(ackhandler.Stats{PacketsLost: 3, TLPs: 2, RTOs: 1})
+			sph.EXPECT().GetCongestionWindow().Return(protocol.ByteCount(10000))
+			sph.EXPECT().GetBytesInFlight().Return(protocol.ByteCount(1234))
+			sph.EXPECT().GetBandwidthEstimate().Return(congestion.Bandwidth(8e6))
+			sph.EXPECT().GetPacingRate().Return(congestion.Bandwidth(1e7))
+			sess.sentPacketHandler = sph
+			sess.updateNetworkStats()
+			streamManager.EXPECT().NumStreams()
+			stats := sess.Stats()
+			Expect(stats.SmoothedRTT).To(Equal(100 * time.Millisecond))
+			Expect(stats.RTTVariance).To(Equal(50 * time.Millisecond))
+			Expect(stats.MinRTT).To(Equal(100 * time.Millisecond))
+			Expect(stats.LatestRTT).To(Equal(100 * time.Millisecond))
+			Expect(stats.CongestionWindow).To(BeEquivalentTo(10000))
+			Expect(stats.BytesInFlight).To(BeEquivalentTo(1234))
+			Expect(stats.BandwidthEstimate).To(BeEquivalentTo(8e6))
+			Expect(stats.PacingRate).To(BeEquivalentTo(1e7))
+			Expect(stats.PacketsLost).To(BeEquivalentTo(3))
+			Expect(stats.TLPs).To(BeEquivalentTo(2))
+			Expect(stats.RTOs).To(BeEquivalentTo(1))
+		})
+
+		It("doesn't count data on the crypto stream", func() {
+			Expect(sess.getStreamDataLen([]wire.Frame{
+				&wire.StreamFrame{StreamID: sess.version.CryptoStreamID(), Data: []byte("foo")},
+				&wire.StreamFrame{StreamID: 5, Data: []byte("foobar")},
+			})).To(Equal(protocol.ByteCount(6)))
+		})
+
+		It("counts sent packets, frames and stream data", func() {
+			sess.streamFramer.streamGetter = streamManager
+			sess.streamFramer.AddActiveStream(5)
+			str := NewMockSendStreamI(mockCtrl)
+			str.EXPECT().popStreamFrame(gomock.Any()).Return(&wire.StreamFrame{StreamID: 5, Data: []byte("foobar")}, false)
+			streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(5)).Return(str, nil)
+			sent, err := sess.sendPacket()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sent).To(BeTrue())
+			streamManager.EXPECT().NumStreams()
+			stats := sess.Stats()
+			Expect(stats.PacketsSent).To(BeEquivalentTo(1))
+			Expect(stats.FramesSent).To(BeEquivalentTo(1))
+			Expect(stats.BytesSent).To(BeEquivalentTo(6))
+			Expect(stats.BytesRetransmitted).To(BeZero())
+		})
+
+		It("measures the time that sending was blocked by connection-level flow control", func() {
+			fc := mocks.NewMockConnectionFlowController(mockCtrl)
+			fc.EXPECT().IsNewlyBlocked().Return(true, protocol.ByteCount(1337))
+			sess.connFlowController = fc
+			sent, err := sess.sendPacket()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sent).To(BeTrue())
+			Expect(sess.connBlockedSince).ToNot(BeZero())
+			sess.connBlockedSince = sess.connBlockedSince.Add(-time.Second)
+			streamManager.EXPECT().NumStreams().AnyTimes()
+			Expect(sess.Stats().FlowControlBlockedTime).To(BeNumerically(">=", time.Second))
+			fc.EXPECT().UpdateSendWindow(protocol.ByteCount(2000))
+			sess.handleMaxDataFrame(&wire.MaxDataFrame{ByteOffset: 2000})
+			blockedTime := sess.Stats().FlowControlBlockedTime
+			Expect(blockedTime).To(BeNumerically("~", time.Second, 100*time.Millisecond))
+			Consistently(func() time.Duration { return sess.Stats().FlowControlBlockedTime }, 50*time.Millisecond).Should(Equal(blockedTime))
+		})
+	})
+
+	Context("saving and resuming the congestion state", func() {
+		It("saves the congestion state when the session is closed", func() {
+			sess.rttStats.UpdateRTT(50*time.Millisecond, 0, time.Now())
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+			}()
+			Consistently(sess.CongestionState).Should(BeNil())
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			sess.Close(nil)
+			Eventually(sess.Context().Done()).Should(BeClosed())
+			state := sess.CongestionState()
+			Expect(state).ToNot(BeNil())
+			Expect(state.RemoteAddr).To(Equal(mconn.RemoteAddr().String()))
+			Expect(state.Time).To(BeTemporally("~", time.Now(), scaleDuration(10*time.Millisecond)))
+			Expect(state.CongestionWindow).To(BeEquivalentTo(protocol.InitialCongestionWindow))
+			Expect(state.RTT).To(Equal(50 * time.Millisecond))
+		})
+
+		It("doesn't save the congestion state if it is not valid", func() {
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().GetResumeState().Return(congestion.ResumeState{}, false)
+			sess.sentPacketHandler = sph
+			sess.saveCongestionState()
+			Expect(sess.CongestionState()).To(BeNil())
+		})
+
+		Context("resuming", func() {
+			var sph *mockackhandler.MockSentPacketHandler
+
+			BeforeEach(func() {
+				sph = mockackhandler.NewMockSentPacketHandler(mockCtrl)
+				sess.sentPacketHandler = sph
+			})
+
+			It("resumes a congestion state saved for the same peer", func() {
+				sph.EXPECT().ResumeCongestionState(congestion.ResumeState{CongestionWindow: 100000, RTT: 20 * time.Millisecond})
+				sess.resumeCongestionState(&CongestionState{
+					RemoteAddr:       mconn.RemoteAddr().String(),
+					Time:             time.Now().Add(-time.Minute),
+					CongestionWindow: 100000,
+					RTT:              20 * time.Millisecond,
+				})
+			})
+
+			It("doesn't resume a congestion state saved for a different peer", func() {
+				sess.resumeCongestionState(&CongestionState{
+					RemoteAddr:       "192.0.2.1:443",
+					Time:             time.Now(),
+					CongestionWindow: 100000,
+					RTT:              20 * time.Millisecond,
+				})
+			})
+
+			It("doesn't resume old congestion states", func() {
+				sess.resumeCongestionState(&CongestionState{
+					RemoteAddr:       mconn.RemoteAddr().String(),
+					Time:             time.Now().Add(-protocol.MaxCongestionStateAge - time.Second),
+					CongestionWindow: 100000,
+					RTT:              20 * time.Millisecond,
+				})
+			})
+
+			It("doesn't resume congestion states from the future", func() {
+				sess.resumeCongestionState(&CongestionState{
+					RemoteAddr:       mconn.RemoteAddr().String(),
+					Time:             time.Now().Add(time.Hour),
+					CongestionWindow: 100000,
+					RTT:              20 * time.Millisecond,
+				})
+			})
+		})
+	})
+
+	It("asks the application if receive windows may grow", func() {
+		var limitedSess Session
+		config := populateServerConfig(&Config{
+			LimitReceiveWindowGrowth: func(s Session) bool {
+				limitedSess = s
+				return true
+			},
+		})
+		s, err := newSession(mconn, sessionRunner, protocol.Version39, protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}, scfg, nil, config, utils.DefaultLogger)
+		Expect(err).ToNot(HaveOccurred())
+		fc := s.(*session).connFlowController
+		fc.AddBytesRead(protocol.ByteCount(config.InitialReceiveConnectionFlowControlWindow))
+		Expect(fc.GetWindowUpdate()).To(BeEquivalentTo(2 * config.InitialReceiveConnectionFlowControlWindow))
+		Expect(limitedSess).To(Equal(s))
+	})
+
+	Context("sending packets", func() {
+		BeforeEach(func() {
+			sess.packer.hasSentPacket = true // make sure this is not the first packet the packer sends
+			go sess.sendQueue.Run()
+		})
+
+		AfterEach(func() {
+			sess.sendQueue.Close()
+		})
+
+		It("sends ACK frames", func() {
+			packetNumber := protocol.PacketNumber(0x035e)
+			err := sess.receivedPacketHandler.ReceivedPacket(packetNumber, protocol.ECNNon, time.Now(), true)
+			Expect(err).ToNot(HaveOccurred())
+			sent, err := sess.sendPacket()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sent).To(BeTrue())
+			Eventually(mconn.written).Should(Receive(ContainSubstring(string([]byte{0x03, 0x5e}))))
+		})
+
+		It("adds MAX_STREAM_DATA frames", func() {
+			sess.windowUpdateQueue.callback(&wire.MaxStreamDataFrame{
 				StreamID:   2,
 				ByteOffset: 20,
 			})
@@ -751,7 +1701,7 @@ var _ = Describe("Session", func() {
 			})
 			sph.EXPECT().DequeuePacketForRetransmission()
 			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
-			rph.EXPECT().ReceivedPacket(gomock.Any(), gomock.Any(), gomock.Any())
+			rph.EXPECT().ReceivedPacket(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
 			sess.receivedPacketHandler = rph
 			sess.sentPacketHandler = sph
 			err := sess.handlePacketImpl(&receivedPacket{
@@ -779,7 +1729,7 @@ var _ = Describe("Session", func() {
 			sph.EXPECT().TimeUntilSend()
 			sph.EXPECT().GetStopWaitingFrame(gomock.Any()).Return(&wire.StopWaitingFrame{})
 			gomock.InOrder(
-				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), protocol.PacketNumber(10)).Do(func(packets []*ackhandler.Packet, _ protocol.PacketNumber) {
+				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), []protocol.PacketNumber{10}).Do(func(packets []*ackhandler.Packet, _ []protocol.PacketNumber) {
 					Expect(packets).To(HaveLen(1))
 					Expect(len(packets[0].Frames)).To(BeNumerically(">", 0))
 					Expect(packets[0].Frames[0]).To(BeAssignableToTypeOf(&wire.StopWaitingFrame{}))
@@ -796,6 +1746,28 @@ var _ = Describe("Session", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("doesn't pace data on the crypto stream", func() {
+			cryptoStream := NewMockCryptoStream(mockCtrl)
+			sess.streamFramer.cryptoStream = cryptoStream
+			sess.streamFramer.AddActiveStream(sess.version.CryptoStreamID())
+			f := &wire.StreamFrame{StreamID: sess.version.CryptoStreamID(), Data: []byte("foobar")}
+			gomock.InOrder(
+				cryptoStream.EXPECT().popStreamFrame(gomock.Any()).Return(f, true).Times(2),
+				cryptoStream.EXPECT().popStreamFrame(gomock.Any()).Return(f, false),
+			)
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
+			sph.EXPECT().SendMode().Return(ackhandler.SendAny).Times(3)
+			sph.EXPECT().ShouldSendNumPackets().Return(1)
+			sph.EXPECT().TimeUntilSend()
+			sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
+				Expect(p.Frames).To(Equal([]wire.Frame{f}))
+			}).Times(3)
+			sess.sentPacketHandler = sph
+			err := sess.sendPackets()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
 		It("sends a TLP probe packet", func() {
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
@@ -824,8 +1796,8 @@ var _ = Describe("Session", func() {
 			sph.EXPECT().ShouldSendNumPackets().Return(2)
 			sph.EXPECT().GetStopWaitingFrame(gomock.Any()).Return(&wire.StopWaitingFrame{}).Times(2)
 			gomock.InOrder(
-				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), protocol.PacketNumber(10)),
-				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), protocol.PacketNumber(11)),
+				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), []protocol.PacketNumber{10}),
+				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), []protocol.PacketNumber{11}),
 			)
 			sess.sentPacketHandler = sph
 			err := sess.sendPackets()
@@ -844,7 +1816,7 @@ var _ = Describe("Session", func() {
 			sph.EXPECT().ShouldSendNumPackets().Return(2)
 			sph.EXPECT().GetStopWaitingFrame(gomock.Any()).Return(&wire.StopWaitingFrame{})
 			gomock.InOrder(
-				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), protocol.PacketNumber(10)),
+				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), []protocol.PacketNumber{10}),
 				sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
 					Expect(p.Frames).To(HaveLen(1))
 					Expect(p.Frames[0]).To(BeAssignableToTypeOf(&wire.PingFrame{}))
@@ -862,6 +1834,267 @@ var _ = Describe("Session", func() {
 			err := sess.sendPackets()
 			Expect(err).ToNot(HaveOccurred())
 		})
+
+		Context("sending packets while waiting for the pacing deadline", func() {
+			var sph *mockackhandler.MockSentPacketHandler
+
+			BeforeEach(func() {
+				sph = mockackhandler.NewMockSentPacketHandler(mockCtrl)
+				sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
+				sess.sentPacketHandler = sph
+			})
+
+			It("sends window updates, without any stream data", func() {
+				sess.windowUpdateQueue.AddConnection()
+				sess.packer.QueueControlFrame(&wire.RstStreamFrame{StreamID: 5})
+				sph.EXPECT().SendMode().Return(ackhandler.SendAny)
+				sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
+					Expect(p.Frames).To(HaveLen(2))
+					Expect(p.Frames).To(ContainElement(&wire.RstStreamFrame{StreamID: 5}))
+					Expect(p.Frames).To(ContainElement(BeAssignableToTypeOf(&wire.MaxDataFrame{})))
+				})
+				Expect(sess.maybeSendUnpacedPacket()).To(Succeed())
+				Eventually(mconn.written).Should(Receive())
+			})
+
+			It("only sends an ACK when congestion limited", func() {
+				sess.windowUpdateQueue.AddConnection()
+				Expect(sess.receivedPacketHandler.ReceivedPacket(1, protocol.ECNNon, time.Now(), true)).To(Succeed())
+				sph.EXPECT().SendMode().Return(ackhandler.SendAck)
+				sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
+					Expect(p.Frames).To(HaveLen(1))
+					Expect(p.Frames[0]).To(BeAssignableToTypeOf(&wire.AckFrame{}))
+				})
+				if sess.version.UsesStopWaitingFrames() {
+					sph.EXPECT().GetStopWaitingFrame(false)
+				}
+				Expect(sess.maybeSendUnpacedPacket()).To(Succeed())
+				Eventually(mconn.written).Should(Receive())
+				Expect(sess.windowUpdateQueue.HasWindowUpdates()).To(BeTrue())
+			})
+
+			It("doesn't send anything if there are no ACKs and window updates", func() {
+				sess.packer.QueueControlFrame(&wire.RstStreamFrame{StreamID: 5})
+				// expect no calls to sph.SendMode
+				Expect(sess.maybeSendUnpacedPacket()).To(Succeed())
+				Expect(mconn.written).To(BeEmpty())
+			})
+
+			It("limits the number of packets", func() {
+				sph.EXPECT().SendMode().Return(ackhandler.SendAny).Times(protocol.MaxUnpacedPackets)
+				sph.EXPECT().SentPacket(gomock.Any()).Times(protocol.MaxUnpacedPackets)
+				for i := 0; i < protocol.MaxUnpacedPackets+1; i++ {
+					sess.windowUpdateQueue.AddConnection()
+					Expect(sess.maybeSendUnpacedPacket()).To(Succeed())
+				}
+				Eventually(mconn.written).Should(HaveLen(protocol.MaxUnpacedPackets))
+			})
+		})
+	})
+
+	Context("send queue", func() {
+		BeforeEach(func() {
+			sess.packer.hasSentPacket = true // make sure this is not the first packet the packer sends
+			// fill the send queue, but don't start writing the queued packets
+			for i := 0; i < protocol.MaxSendQueueLength; i++ {
+				buf := getPacketBuffer()
+				sess.sendQueue.Send(&queuedPacket{raw: append((*buf)[:0], []byte("foobar")...)})
+			}
+		})
+
+		It("doesn't pack packets when the send queue is full", func() {
+			sess.packer.QueueControlFrame(&wire.MaxDataFrame{ByteOffset: 1})
+			Expect(sess.sendPackets()).To(Succeed())
+			Expect(sess.sendQueue.Len()).To(Equal(protocol.MaxSendQueueLength))
+			Expect(sess.packer.controlFrames).To(HaveLen(1))
+		})
+
+		It("replaces queued ACK-only packets when the send queue is full", func() {
+			Expect(sess.receivedPacketHandler.ReceivedPacket(1, protocol.ECNNon, time.Now(), true)).To(Succeed())
+			Expect(sess.sendPackets()).To(Succeed())
+			Expect(sess.sendQueue.Len()).To(Equal(protocol.MaxSendQueueLength + 1))
+			Expect(sess.receivedPacketHandler.ReceivedPacket(2, protocol.ECNNon, time.Now(), true)).To(Succeed())
+			Expect(sess.sendPackets()).To(Succeed())
+			Expect(sess.sendQueue.Len()).To(Equal(protocol.MaxSendQueueLength + 1))
+			streamManager.EXPECT().NumStreams()
+			stats := sess.Stats()
+			Expect(stats.SendQueueLength).To(Equal(protocol.MaxSendQueueLength + 1))
+			Expect(stats.DroppedAckOnlyPackets).To(BeEquivalentTo(1))
+		})
+
+		It("continues sending when the send queue has space again", func() {
+			sess.packer.QueueControlFrame(&wire.MaxDataFrame{ByteOffset: 1})
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().GetAlarmTimeout().AnyTimes()
+			sph.EXPECT().GetStats().AnyTimes()
+			sph.EXPECT().GetCongestionWindow().AnyTimes()
+			sph.EXPECT().GetBandwidthEstimate().AnyTimes()
+			sph.EXPECT().GetPacingRate().AnyTimes()
+			sph.EXPECT().GetResumeState().AnyTimes()
+			sph.EXPECT().GetBytesInFlight().AnyTimes()
+			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
+			sph.EXPECT().DequeuePacketForRetransmission().AnyTimes()
+			sph.EXPECT().TimeUntilSend().AnyTimes()
+			sph.EXPECT().ShouldSendNumPackets().Return(1000).AnyTimes()
+			sph.EXPECT().SendMode().Return(ackhandler.SendAny).AnyTimes()
+			sph.EXPECT().SentPacket(gomock.Any())
+			sess.sentPacketHandler = sph
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+				close(done)
+			}()
+			sess.scheduleSending()
+			// the queued packets are written first, followed by the MAX_DATA frame
+			Eventually(mconn.written).Should(HaveLen(protocol.MaxSendQueueLength + 1))
+			// make the go routine return
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			sess.Close(nil)
+			Eventually(done).Should(BeClosed())
+			Expect(sess.packer.controlFrames).To(BeEmpty())
+		})
+	})
+
+	It("only checks invariants when building with the quic_invariants build tag", func() {
+		Expect(sess.invariants != nil).To(Equal(invariantChecksEnabled))
+	})
+
+	Context("MTU discovery", func() {
+		It("doesn't use MTU discovery if the connection doesn't set the Don't Fragment bit", func() {
+			Expect(sess.mtuDiscoverer).To(BeNil())
+		})
+
+		It("errors when a packet is rejected by the kernel", func() {
+			Expect(sess.handlePacketTooLarge(1300, false)).To(MatchError("packet of 1300 bytes is larger than the path MTU"))
+		})
+
+		Context("with MTU discovery", func() {
+			BeforeEach(func() {
+				sess.packer.hasSentPacket = true // make sure this is not the first packet the packer sends
+				sess.packer.cryptoSetup = &mockCryptoSetup{encLevelSeal: protocol.EncryptionForwardSecure}
+				sess.mtuDiscoverer = newMTUDiscoverer(sess.rttStats)
+				go sess.sendQueue.Run()
+			})
+
+			AfterEach(func() {
+				sess.sendQueue.Close()
+			})
+
+			It("starts MTU discovery when the handshake completes", func() {
+				sess.peerParams = &handshake.TransportParameters{MaxPacketSize: 1400}
+				sessionRunner.EXPECT().onHandshakeComplete(sess)
+				sess.handleHandshakeEvent(true)
+				Expect(sess.mtuDiscoverer.CurrentSize()).To(Equal(sess.packer.MaxPacketSize()))
+				Expect(sess.mtuDiscoverer.max).To(Equal(protocol.ByteCount(1400)))
+			})
+
+			It("doesn't discover packet sizes larger than the configured maximum packet size", func() {
+				sess.config.MaxPacketSize = 1300
+				sessionRunner.EXPECT().onHandshakeComplete(sess)
+				sess.handleHandshakeEvent(true)
+				Expect(sess.mtuDiscoverer.max).To(Equal(protocol.ByteCount(1300)))
+			})
+
+			It("sends MTU probe packets", func() {
+				current := sess.packer.MaxPacketSize()
+				sess.mtuDiscoverer.Start(current, protocol.MaxReceivePacketSize, time.Now().Add(-time.Hour))
+				probeSize := (current + protocol.MaxReceivePacketSize + 1) / 2
+				sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+				sph.EXPECT().SendMode().Return(ackhandler.SendAny)
+				sph.EXPECT().ShouldSendNumPackets().Return(1)
+				sph.EXPECT().TimeUntilSend().Return(time.Now().Add(time.Hour))
+				sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
+				sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
+					Expect(p.IsMTUProbe).To(BeTrue())
+					Expect(p.Length).To(Equal(probeSize))
+					Expect(p.Frames).To(Equal([]wire.Frame{&wire.PingFrame{}}))
+				})
+				sess.sentPacketHandler = sph
+				Expect(sess.sendPackets()).To(Succeed())
+				Eventually(mconn.written).Should(Receive(HaveLen(int(probeSize))))
+				// the max packet size is only increased when the probe is acknowledged
+				Expect(sess.packer.MaxPacketSize()).To(Equal(current))
+			})
+
+			It("increases the max packet size when a probe is acknowledged", func() {
+				current := sess.packer.MaxPacketSize()
+				sess.mtuDiscoverer.Start(current, protocol.MaxReceivePacketSize, time.Now().Add(-time.Hour))
+				probeSize := sess.mtuDiscoverer.NextProbeSize()
+				sess.onPacketSizeResult(probeSize, true, true)
+				Expect(sess.packer.MaxPacketSize()).To(Equal(probeSize))
+			})
+
+			It("doesn't change the max packet size when a probe is lost", func() {
+				current := sess.packer.MaxPacketSize()
+				sess.mtuDiscoverer.Start(current, protocol.MaxReceivePacketSize, time.Now().Add(-time.Hour))
+				sess.onPacketSizeResult(sess.mtuDiscoverer.NextProbeSize(), true, false)
+				Expect(sess.packer.MaxPacketSize()).To(Equal(current))
+			})
+
+			It("lowers the upper bound of the search when a probe is rejected by the kernel", func() {
+				current := sess.packer.MaxPacketSize()
+				sess.mtuDiscoverer.Start(current, protocol.MaxReceivePacketSize, time.Now().Add(-time.Hour))
+				probeSize := sess.mtuDiscoverer.NextProbeSize()
+				Expect(sess.handlePacketTooLarge(probeSize, true)).To(Succeed())
+				Expect(sess.mtuDiscoverer.upper).To(Equal(probeSize - 1))
+				Expect(sess.packer.MaxPacketSize()).To(Equal(current))
+			})
+
+			It("falls back to the base size when a packet is rejected by the kernel", func() {
+				base := sess.packer.MaxPacketSize()
+				sess.mtuDiscoverer.Start(base, protocol.MaxReceivePacketSize, time.Now().Add(-time.Hour))
+				probeSize := sess.mtuDiscoverer.NextProbeSize()
+				sess.onPacketSizeResult(probeSize, true, true)
+				Expect(sess.packer.MaxPacketSize()).To(Equal(probeSize))
+				Expect(sess.handlePacketTooLarge(probeSize, false)).To(Succeed())
+				Expect(sess.packer.MaxPacketSize()).To(Equal(base))
+				Expect(sess.mtuDiscoverer.CurrentSize()).To(Equal(base))
+			})
+
+			It("errors when a packet of the base size is rejected by the kernel", func() {
+				base := sess.packer.MaxPacketSize()
+				sess.mtuDiscoverer.Start(base, protocol.MaxReceivePacketSize, time.Now().Add(-time.Hour))
+				Expect(sess.handlePacketTooLarge(base, false)).To(MatchError(fmt.Sprintf("packet of %d bytes is larger than the path MTU", base)))
+			})
+
+			It("falls back to the base size when full-size packets are lost repeatedly", func() {
+				base := sess.packer.MaxPacketSize()
+				sess.mtuDiscoverer.Start(base, protocol.MaxReceivePacketSize, time.Now().Add(-time.Hour))
+				probeSize := sess.mtuDiscoverer.NextProbeSize()
+				sess.onPacketSizeResult(probeSize, true, true)
+				Expect(sess.packer.MaxPacketSize()).To(Equal(probeSize))
+				for i := 0; i < maxLostFullSizePackets-1; i++ {
+					sess.onPacketSizeResult(probeSize, false, false)
+				}
+				Expect(sess.packer.MaxPacketSize()).To(Equal(probeSize))
+				sess.onPacketSizeResult(probeSize, false, false)
+				Expect(sess.packer.MaxPacketSize()).To(Equal(base))
+			})
+
+			It("falls back to the base size and restarts the discovery when migrating", func() {
+				base := sess.packer.MaxPacketSize()
+				sess.mtuDiscoverer.Start(base, protocol.MaxReceivePacketSize, time.Now().Add(-time.Hour))
+				probeSize := sess.mtuDiscoverer.NextProbeSize()
+				sess.onPacketSizeResult(probeSize, true, true)
+				Expect(sess.packer.MaxPacketSize()).To(Equal(probeSize))
+				mconn.supportsDF = true
+				sess.migrate(newMockPacketConn())
+				Expect(sess.packer.MaxPacketSize()).To(Equal(base))
+				Expect(sess.mtuDiscoverer.CurrentSize()).To(Equal(base))
+				Expect(sess.mtuDiscoverer.ShouldSendProbe(time.Now())).To(BeFalse())
+			})
+
+			It("stops the discovery when migrating to a connection that doesn't support it", func() {
+				base := sess.packer.MaxPacketSize()
+				sess.mtuDiscoverer.Start(base, protocol.MaxReceivePacketSize, time.Now().Add(-time.Hour))
+				sess.onPacketSizeResult(sess.mtuDiscoverer.NextProbeSize(), true, true)
+				sess.migrate(newMockPacketConn())
+				Expect(sess.packer.MaxPacketSize()).To(Equal(base))
+				Expect(sess.mtuDiscoverer).To(BeNil())
+			})
+		})
 	})
 
 	Context("packet pacing", func() {
@@ -870,6 +2103,12 @@ var _ = Describe("Session", func() {
 		BeforeEach(func() {
 			sph = mockackhandler.NewMockSentPacketHandler(mockCtrl)
 			sph.EXPECT().GetAlarmTimeout().AnyTimes()
+			sph.EXPECT().GetStats().AnyTimes()
+			sph.EXPECT().GetCongestionWindow().AnyTimes()
+			sph.EXPECT().GetBandwidthEstimate().AnyTimes()
+			sph.EXPECT().GetPacingRate().AnyTimes()
+			sph.EXPECT().GetResumeState().AnyTimes()
+			sph.EXPECT().GetBytesInFlight().AnyTimes()
 			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
 			sph.EXPECT().DequeuePacketForRetransmission().AnyTimes()
 			sess.sentPacketHandler = sph
@@ -953,6 +2192,30 @@ var _ = Describe("Session", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("continues sending, if the pacer allows sending more packets", func() {
+			sph.EXPECT().SentPacket(gomock.Any()).Times(2)
+			sph.EXPECT().ShouldSendNumPackets().Return(1).Times(2)
+			sph.EXPECT().TimeUntilSend().Return(time.Time{}).Times(3)
+			sph.EXPECT().TimeUntilSend().Return(time.Now().Add(time.Hour)).AnyTimes()
+			sph.EXPECT().SendMode().Return(ackhandler.SendAny).Do(func() {
+				// make sure there's something to send
+				sess.packer.QueueControlFrame(&wire.MaxDataFrame{ByteOffset: 1})
+			}).Times(2)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+				close(done)
+			}()
+			sess.scheduleSending()
+			Eventually(mconn.written).Should(HaveLen(2))
+			Consistently(mconn.written).Should(HaveLen(2))
+			// make the go routine return
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			sess.Close(nil)
+			Eventually(done).Should(BeClosed())
+		})
+
 		It("sends multiple packets at once", func() {
 			sph.EXPECT().SentPacket(gomock.Any()).Times(3)
 			sph.EXPECT().ShouldSendNumPackets().Return(3)
@@ -976,6 +2239,35 @@ var _ = Describe("Session", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		Context("sending packets while waiting for the pacing deadline", func() {
+			It("sends ACKs", func() {
+				sph.EXPECT().TimeUntilSend().Return(time.Now().Add(time.Hour)).AnyTimes()
+				sph.EXPECT().SendMode().Return(ackhandler.SendAny)
+				sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
+					Expect(p.Frames).To(HaveLen(1))
+					Expect(p.Frames[0]).To(BeAssignableToTypeOf(&wire.AckFrame{}))
+				})
+				if sess.version.UsesStopWaitingFrames() {
+					sph.EXPECT().GetStopWaitingFrame(false)
+				}
+				Expect(sess.receivedPacketHandler.ReceivedPacket(1, protocol.ECNNon, time.Now(), true)).To(Succeed())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					sess.run()
+					close(done)
+				}()
+				sess.scheduleSending()
+				Eventually(mconn.written).Should(HaveLen(1))
+				Consistently(mconn.written).Should(HaveLen(1))
+				// make the go routine return
+				sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+				sess.Close(nil)
+				Eventually(done).Should(BeClosed())
+			})
+
+		})
+
 		It("doesn't set a pacing timer when there is no data to send", func() {
 			sph.EXPECT().TimeUntilSend().Return(time.Now())
 			sph.EXPECT().ShouldSendNumPackets().Return(1)
@@ -996,6 +2288,73 @@ var _ = Describe("Session", func() {
 			sess.Close(nil)
 			Eventually(done).Should(BeClosed())
 		})
+
+		Context("coalescing stream data", func() {
+			var coalescingDelay time.Duration
+
+			BeforeEach(func() {
+				coalescingDelay = scaleDuration(50 * time.Millisecond)
+				sess.config.SendCoalescingDelay = coalescingDelay
+				sess.handshakeComplete = true
+				sph.EXPECT().SentPacket(gomock.Any()).AnyTimes()
+				sph.EXPECT().ShouldSendNumPackets().Return(1000).AnyTimes()
+				sph.EXPECT().TimeUntilSend().AnyTimes()
+				sph.EXPECT().SendMode().Return(ackhandler.SendAny).AnyTimes()
+			})
+
+			It("delays sending stream data", func() {
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					sess.run()
+					close(done)
+				}()
+				// use a control frame instead of stream data, since it's easier to set up
+				sess.packer.QueueControlFrame(&wire.MaxDataFrame{ByteOffset: 1})
+				sess.scheduleSendingStreamData()
+				Consistently(mconn.written, coalescingDelay/2).Should(BeEmpty())
+				Eventually(mconn.written, coalescingDelay).Should(HaveLen(1))
+				// make the go routine return
+				sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+				sess.Close(nil)
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("doesn't delay stream data when something else is sent", func() {
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					sess.run()
+					close(done)
+				}()
+				sess.packer.QueueControlFrame(&wire.MaxDataFrame{ByteOffset: 1})
+				sess.scheduleSendingStreamData()
+				Consistently(mconn.written, coalescingDelay/4).Should(BeEmpty())
+				sess.scheduleSending()
+				Eventually(mconn.written, coalescingDelay/4).Should(HaveLen(1))
+				// make the go routine return
+				sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+				sess.Close(nil)
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("doesn't delay stream data during the handshake", func() {
+				sess.handshakeComplete = false
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					sess.run()
+					close(done)
+				}()
+				sess.packer.QueueControlFrame(&wire.MaxDataFrame{ByteOffset: 1})
+				sess.scheduleSendingStreamData()
+				Eventually(mconn.written, coalescingDelay/2).Should(HaveLen(1))
+				// make the go routine return
+				sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+				sess.Close(nil)
+				Eventually(done).Should(BeClosed())
+			})
+		})
 	})
 
 	Context("sending ACK only packets", func() {
@@ -1012,6 +2371,12 @@ var _ = Describe("Session", func() {
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
 			sph.EXPECT().GetAlarmTimeout().AnyTimes()
+			sph.EXPECT().GetStats().AnyTimes()
+			sph.EXPECT().GetCongestionWindow().AnyTimes()
+			sph.EXPECT().GetBandwidthEstimate().AnyTimes()
+			sph.EXPECT().GetPacingRate().AnyTimes()
+			sph.EXPECT().GetResumeState().AnyTimes()
+			sph.EXPECT().GetBytesInFlight().AnyTimes()
 			sph.EXPECT().SendMode().Return(ackhandler.SendAck)
 			sph.EXPECT().ShouldSendNumPackets().Return(1000)
 			sph.EXPECT().GetStopWaitingFrame(false).Return(swf)
@@ -1024,7 +2389,7 @@ var _ = Describe("Session", func() {
 			})
 			sess.sentPacketHandler = sph
 			sess.packer.packetNumberGenerator.next = 0x1338
-			sess.receivedPacketHandler.ReceivedPacket(1, time.Now(), true)
+			sess.receivedPacketHandler.ReceivedPacket(1, protocol.ECNNon, time.Now(), true)
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
@@ -1046,6 +2411,12 @@ var _ = Describe("Session", func() {
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
 			sph.EXPECT().GetAlarmTimeout().AnyTimes()
+			sph.EXPECT().GetStats().AnyTimes()
+			sph.EXPECT().GetCongestionWindow().AnyTimes()
+			sph.EXPECT().GetBandwidthEstimate().AnyTimes()
+			sph.EXPECT().GetPacingRate().AnyTimes()
+			sph.EXPECT().GetResumeState().AnyTimes()
+			sph.EXPECT().GetBytesInFlight().AnyTimes()
 			sph.EXPECT().SendMode().Return(ackhandler.SendAck)
 			sph.EXPECT().ShouldSendNumPackets().Return(1000)
 			sph.EXPECT().TimeUntilSend()
@@ -1056,7 +2427,7 @@ var _ = Describe("Session", func() {
 			})
 			sess.sentPacketHandler = sph
 			sess.packer.packetNumberGenerator.next = 0x1338
-			sess.receivedPacketHandler.ReceivedPacket(1, time.Now(), true)
+			sess.receivedPacketHandler.ReceivedPacket(1, protocol.ECNNon, time.Now(), true)
 			go func() {
 				defer GinkgoRecover()
 				sess.run()
@@ -1082,6 +2453,12 @@ var _ = Describe("Session", func() {
 			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
 			sess.sentPacketHandler = sph
 			sess.packer.cryptoSetup = &mockCryptoSetup{encLevelSeal: protocol.EncryptionForwardSecure}
+			streamManager.EXPECT().NumStreams().AnyTimes()
+			go sess.sendQueue.Run()
+		})
+
+		AfterEach(func() {
+			sess.sendQueue.Close()
 		})
 
 		Context("for handshake packets", func() {
@@ -1094,7 +2471,7 @@ var _ = Describe("Session", func() {
 					Frames:          []wire.Frame{sf},
 					EncryptionLevel: protocol.EncryptionUnencrypted,
 				})
-				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), protocol.PacketNumber(42)).Do(func(packets []*ackhandler.Packet, _ protocol.PacketNumber) {
+				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), []protocol.PacketNumber{42}).Do(func(packets []*ackhandler.Packet, _ []protocol.PacketNumber) {
 					Expect(packets).To(HaveLen(1))
 					p := packets[0]
 					Expect(p.EncryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
@@ -1104,7 +2481,7 @@ var _ = Describe("Session", func() {
 				sent, err := sess.maybeSendRetransmission()
 				Expect(err).NotTo(HaveOccurred())
 				Expect(sent).To(BeTrue())
-				Expect(mconn.written).To(HaveLen(1))
+				Eventually(mconn.written).Should(HaveLen(1))
 			})
 
 			It("retransmits an unencrypted packet, and doesn't add a STOP_WAITING frame (for IETF QUIC)", func() {
@@ -1116,7 +2493,8 @@ var _ = Describe("Session", func() {
 					Frames:          []wire.Frame{sf},
 					EncryptionLevel: protocol.EncryptionUnencrypted,
 				})
-				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), protocol.PacketNumber(1337)).Do(func(packets []*ackhandler.Packet, _ protocol.PacketNumber) {
+				streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(1))
+				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), []protocol.PacketNumber{1337}).Do(func(packets []*ackhandler.Packet, _ []protocol.PacketNumber) {
 					Expect(packets).To(HaveLen(1))
 					p := packets[0]
 					Expect(p.EncryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
@@ -1126,7 +2504,7 @@ var _ = Describe("Session", func() {
 				sent, err := sess.maybeSendRetransmission()
 				Expect(err).NotTo(HaveOccurred())
 				Expect(sent).To(BeTrue())
-				Expect(mconn.written).To(HaveLen(1))
+				Eventually(mconn.written).Should(HaveLen(1))
 			})
 		})
 
@@ -1143,7 +2521,12 @@ var _ = Describe("Session", func() {
 					Frames:          []wire.Frame{f},
 					EncryptionLevel: protocol.EncryptionForwardSecure,
 				})
-				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), protocol.PacketNumber(0x1337)).Do(func(packets []*ackhandler.Packet, _ protocol.PacketNumber) {
+				sph.EXPECT().DequeuePacketForRetransmission()
+				str := NewMockSendStreamI(mockCtrl)
+				str.EXPECT().dropExpiredData(f).Return(f)
+				str.EXPECT().addRetransmittedBytes(protocol.ByteCount(6))
+				streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(5)).Return(str, nil).Times(2)
+				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), []protocol.PacketNumber{4919}).Do(func(packets []*ackhandler.Packet, _ []protocol.PacketNumber) {
 					Expect(packets).To(HaveLen(1))
 					p := packets[0]
 					Expect(p.Frames).To(HaveLen(2))
@@ -1154,57 +2537,193 @@ var _ = Describe("Session", func() {
 				sent, err := sess.maybeSendRetransmission()
 				Expect(err).NotTo(HaveOccurred())
 				Expect(sent).To(BeTrue())
-				Expect(mconn.written).To(HaveLen(1))
+				Eventually(mconn.written).Should(HaveLen(1))
+				Expect(sess.Stats().BytesRetransmitted).To(BeEquivalentTo(6))
+				Expect(sess.Stats().BytesSent).To(BeZero())
+			})
+
+			It("sends a STREAM frame from a packet queued for retransmission, and doesn't add a STOP_WAITING (for IETF QUIC)", func() {
+				sess.version = versionIETFFrames
+				sess.packer.version = versionIETFFrames
+				f := &wire.StreamFrame{
+					StreamID: 0x5,
+					Data:     []byte("foobar"),
+				}
+				sph.EXPECT().DequeuePacketForRetransmission().Return(&ackhandler.Packet{
+					PacketNumber:    42,
+					Frames:          []wire.Frame{f},
+					EncryptionLevel: protocol.EncryptionForwardSecure,
+				})
+				sph.EXPECT().DequeuePacketForRetransmission()
+				// the stream was already garbage collected
+				streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(5)).Times(2)
+				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), []protocol.PacketNumber{42}).Do(func(packets []*ackhandler.Packet, _ []protocol.PacketNumber) {
+					Expect(packets).To(HaveLen(1))
+					p := packets[0]
+					Expect(p.Frames).To(Equal([]wire.Frame{f}))
+					Expect(p.EncryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
+				})
+				sent, err := sess.maybeSendRetransmission()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sent).To(BeTrue())
+				Eventually(mconn.written).Should(HaveLen(1))
+			})
+
+			It("sends multiple packets, if the retransmission is split", func() {
+				sess.version = versionIETFFrames
+				sess.packer.version = versionIETFFrames
+				f := &wire.StreamFrame{
+					StreamID: 0x5,
+					Data:     bytes.Repeat([]byte{'b'}, int(protocol.MaxPacketSizeIPv4)*3/2),
+				}
+				sph.EXPECT().DequeuePacketForRetransmission().Return(&ackhandler.Packet{
+					PacketNumber:    42,
+					Frames:          []wire.Frame{f},
+					EncryptionLevel: protocol.EncryptionForwardSecure,
+				})
+				sph.EXPECT().DequeuePacketForRetransmission().Times(2)
+				streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(5)).Times(3)
+				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), []protocol.PacketNumber{42}).Do(func(packets []*ackhandler.Packet, _ []protocol.PacketNumber) {
+					Expect(packets).To(HaveLen(1))
+					p := packets[0]
+					Expect(p.Frames).To(HaveLen(1))
+					Expect(p.Frames[0]).To(BeAssignableToTypeOf(&wire.StreamFrame{}))
+					Expect(p.EncryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
+				}).Times(2)
+				sent, err := sess.maybeSendRetransmission()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sent).To(BeTrue())
+				Expect(sess.retransmissionQueue.HasData()).To(BeTrue())
+				sent, err = sess.maybeSendRetransmission()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sent).To(BeTrue())
+				Expect(sess.retransmissionQueue.HasData()).To(BeFalse())
+				Eventually(mconn.written).Should(HaveLen(2))
+				Expect(sess.Stats().BytesRetransmitted).To(BeEquivalentTo(protocol.MaxPacketSizeIPv4 * 3 / 2))
+				Expect(sess.Stats().PacketsSent).To(BeEquivalentTo(2))
+			})
+
+			It("doesn't retransmit expired stream data", func() {
+				sess.version = versionIETFFrames
+				sess.packer.version = versionIETFFrames
+				f1 := &wire.StreamFrame{StreamID: 0x5, Data: []byte("foo")}
+				f2 := &wire.StreamFrame{StreamID: 0x7, Data: []byte("foobar")}
+				f2Trimmed := &wire.StreamFrame{StreamID: 0x7, Offset: 3, Data: []byte("bar")}
+				sph.EXPECT().DequeuePacketForRetransmission().Return(&ackhandler.Packet{
+					PacketNumber:    42,
+					Frames:          []wire.Frame{f1, &wire.MaxDataFrame{ByteOffset: 0x1337}, f2},
+					EncryptionLevel: protocol.EncryptionForwardSecure,
+				})
+				sph.EXPECT().DequeuePacketForRetransmission()
+				str1 := NewMockSendStreamI(mockCtrl)
+				str1.EXPECT().dropExpiredData(f1)
+				str2 := NewMockSendStreamI(mockCtrl)
+				str2.EXPECT().dropExpiredData(f2).Return(f2Trimmed)
+				str2.EXPECT().addRetransmittedBytes(protocol.ByteCount(3))
+				streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(5)).Return(str1, nil)
+				streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(7)).Return(str2, nil).Times(2)
+				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), []protocol.PacketNumber{42}).Do(func(packets []*ackhandler.Packet, _ []protocol.PacketNumber) {
+					Expect(packets).To(HaveLen(1))
+					p := packets[0]
+					Expect(p.Frames).To(Equal([]wire.Frame{&wire.MaxDataFrame{ByteOffset: 0x1337}, f2Trimmed}))
+				})
+				sent, err := sess.maybeSendRetransmission()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sent).To(BeTrue())
+				Eventually(mconn.written).Should(HaveLen(1))
+				Expect(sess.Stats().BytesRetransmitted).To(BeEquivalentTo(3))
 			})
 
-			It("sends a STREAM frame from a packet queued for retransmission, and doesn't add a STOP_WAITING (for IETF QUIC)", func() {
+			It("doesn't send a packet if all stream data expired", func() {
 				sess.version = versionIETFFrames
 				sess.packer.version = versionIETFFrames
-				f := &wire.StreamFrame{
-					StreamID: 0x5,
-					Data:     []byte("foobar"),
-				}
+				f := &wire.StreamFrame{StreamID: 0x5, Data: []byte("foobar")}
 				sph.EXPECT().DequeuePacketForRetransmission().Return(&ackhandler.Packet{
 					PacketNumber:    42,
 					Frames:          []wire.Frame{f},
 					EncryptionLevel: protocol.EncryptionForwardSecure,
 				})
-				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), protocol.PacketNumber(42)).Do(func(packets []*ackhandler.Packet, _ protocol.PacketNumber) {
-					Expect(packets).To(HaveLen(1))
-					p := packets[0]
-					Expect(p.Frames).To(Equal([]wire.Frame{f}))
-					Expect(p.EncryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
-				})
+				sph.EXPECT().DequeuePacketForRetransmission()
+				str := NewMockSendStreamI(mockCtrl)
+				str.EXPECT().dropExpiredData(f)
+				streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(5)).Return(str, nil)
 				sent, err := sess.maybeSendRetransmission()
 				Expect(err).NotTo(HaveOccurred())
-				Expect(sent).To(BeTrue())
-				Expect(mconn.written).To(HaveLen(1))
+				Expect(sent).To(BeFalse())
+				Expect(mconn.written).To(BeEmpty())
 			})
 
-			It("sends multiple packets, if the retransmission is split", func() {
+			It("sends the frames of multiple lost packets in one packet", func() {
 				sess.version = versionIETFFrames
 				sess.packer.version = versionIETFFrames
-				f := &wire.StreamFrame{
-					StreamID: 0x5,
-					Data:     bytes.Repeat([]byte{'b'}, int(protocol.MaxPacketSizeIPv4)*3/2),
-				}
+				f1 := &wire.StreamFrame{StreamID: 0x5, Data: []byte("foo")}
+				f2 := &wire.StreamFrame{StreamID: 0x5, Offset: 3, Data: []byte("bar")}
 				sph.EXPECT().DequeuePacketForRetransmission().Return(&ackhandler.Packet{
 					PacketNumber:    42,
-					Frames:          []wire.Frame{f},
+					Frames:          []wire.Frame{&wire.MaxDataFrame{ByteOffset: 0x1337}, f1},
 					EncryptionLevel: protocol.EncryptionForwardSecure,
 				})
-				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), protocol.PacketNumber(42)).Do(func(packets []*ackhandler.Packet, _ protocol.PacketNumber) {
-					Expect(packets).To(HaveLen(2))
-					for _, p := range packets {
-						Expect(p.Frames).To(HaveLen(1))
-						Expect(p.Frames[0]).To(BeAssignableToTypeOf(&wire.StreamFrame{}))
-						Expect(p.EncryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
-					}
+				sph.EXPECT().DequeuePacketForRetransmission().Return(&ackhandler.Packet{
+					PacketNumber:    43,
+					Frames:          []wire.Frame{f2},
+					EncryptionLevel: protocol.EncryptionForwardSecure,
+				})
+				sph.EXPECT().DequeuePacketForRetransmission()
+				// the stream was already garbage collected
+				streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(5)).Times(3)
+				sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), []protocol.PacketNumber{42, 43}).Do(func(packets []*ackhandler.Packet, _ []protocol.PacketNumber) {
+					Expect(packets).To(HaveLen(1))
+					p := packets[0]
+					Expect(p.Frames).To(Equal([]wire.Frame{
+						&wire.MaxDataFrame{ByteOffset: 0x1337},
+						&wire.StreamFrame{StreamID: 0x5, Data: []byte("foobar")},
+					}))
 				})
 				sent, err := sess.maybeSendRetransmission()
 				Expect(err).NotTo(HaveOccurred())
 				Expect(sent).To(BeTrue())
-				Expect(mconn.written).To(HaveLen(2))
+				Eventually(mconn.written).Should(HaveLen(1))
+				Expect(sess.Stats().BytesRetransmitted).To(BeEquivalentTo(6))
+			})
+
+			It("sends queued retransmissions before new data", func() {
+				sess.version = versionIETFFrames
+				sess.packer.version = versionIETFFrames
+				sess.retransmissionQueue.AddFrames([]wire.Frame{&wire.MaxDataFrame{ByteOffset: 0x1337}}, 10)
+				sess.packer.QueueControlFrame(&wire.BlockedFrame{})
+				sph.EXPECT().SendMode().Return(ackhandler.SendAny).Times(2)
+				sph.EXPECT().ShouldSendNumPackets().Return(2)
+				sph.EXPECT().TimeUntilSend()
+				sph.EXPECT().DequeuePacketForRetransmission()
+				gomock.InOrder(
+					sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), []protocol.PacketNumber{10}).Do(func(packets []*ackhandler.Packet, _ []protocol.PacketNumber) {
+						Expect(packets).To(HaveLen(1))
+						p := packets[0]
+						Expect(p.Frames).To(Equal([]wire.Frame{&wire.MaxDataFrame{ByteOffset: 0x1337}}))
+					}),
+					sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
+						Expect(p.Frames).To(Equal([]wire.Frame{&wire.BlockedFrame{}}))
+					}),
+				)
+				Expect(sess.sendPackets()).To(Succeed())
+				Eventually(mconn.written).Should(HaveLen(2))
+			})
+
+			It("sends new data if the queued retransmissions don't result in a packet", func() {
+				sess.version = versionIETFFrames
+				sess.packer.version = versionIETFFrames
+				// this frame doesn't fit into a packet, and is dropped when packing the retransmission
+				sess.retransmissionQueue.AddFrames([]wire.Frame{&wire.ConnectionCloseFrame{ReasonPhrase: strings.Repeat("f", int(protocol.MaxPacketSizeIPv4))}}, 10)
+				sess.packer.QueueControlFrame(&wire.BlockedFrame{})
+				sph.EXPECT().SendMode().Return(ackhandler.SendAny).Times(2)
+				sph.EXPECT().ShouldSendNumPackets().Return(2)
+				sph.EXPECT().DequeuePacketForRetransmission()
+				sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
+					Expect(p.Frames).To(Equal([]wire.Frame{&wire.BlockedFrame{}}))
+				})
+				Expect(sess.sendPackets()).To(Succeed())
+				Expect(sess.retransmissionQueue.HasData()).To(BeFalse())
+				Eventually(mconn.written).Should(HaveLen(1))
 			})
 		})
 	})
@@ -1220,6 +2739,12 @@ var _ = Describe("Session", func() {
 			sess.packer.QueueControlFrame(&wire.BlockedFrame{})
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 			sph.EXPECT().GetAlarmTimeout().AnyTimes()
+			sph.EXPECT().GetStats().AnyTimes()
+			sph.EXPECT().GetCongestionWindow().AnyTimes()
+			sph.EXPECT().GetBandwidthEstimate().AnyTimes()
+			sph.EXPECT().GetPacingRate().AnyTimes()
+			sph.EXPECT().GetResumeState().AnyTimes()
+			sph.EXPECT().GetBytesInFlight().AnyTimes()
 			sph.EXPECT().TimeUntilSend().AnyTimes()
 			sph.EXPECT().SendMode().Return(ackhandler.SendAny).AnyTimes()
 			sph.EXPECT().ShouldSendNumPackets().AnyTimes().Return(1)
@@ -1246,6 +2771,12 @@ var _ = Describe("Session", func() {
 			sph.EXPECT().TimeUntilSend().Return(time.Now())
 			sph.EXPECT().TimeUntilSend().Return(time.Now().Add(time.Hour))
 			sph.EXPECT().GetAlarmTimeout().AnyTimes()
+			sph.EXPECT().GetStats().AnyTimes()
+			sph.EXPECT().GetCongestionWindow().AnyTimes()
+			sph.EXPECT().GetBandwidthEstimate().AnyTimes()
+			sph.EXPECT().GetPacingRate().AnyTimes()
+			sph.EXPECT().GetResumeState().AnyTimes()
+			sph.EXPECT().GetBytesInFlight().AnyTimes()
 			sph.EXPECT().SendMode().Return(ackhandler.SendAny).AnyTimes()
 			sph.EXPECT().GetStopWaitingFrame(gomock.Any())
 			sph.EXPECT().ShouldSendNumPackets().Return(1)
@@ -1275,7 +2806,7 @@ var _ = Describe("Session", func() {
 
 	It("closes when crypto stream errors", func() {
 		testErr := errors.New("crypto setup error")
-		streamManager.EXPECT().CloseWithError(qerr.Error(qerr.InternalError, testErr.Error()))
+		streamManager.EXPECT().CloseWithError(qerr.ToQuicError(testErr))
 		sessionRunner.EXPECT().removeConnectionID(gomock.Any())
 		cryptoSetup.handleErr = testErr
 		go func() {
@@ -1287,10 +2818,10 @@ var _ = Describe("Session", func() {
 	})
 
 	Context("sending a Public Reset when receiving undecryptable packets during the handshake", func() {
-		// sends protocol.MaxUndecryptablePackets+1 undecrytable packets
+		// sends MaxUndecryptablePackets+1 undecrytable packets
 		// this completely fills up the undecryptable packets queue and triggers the public reset timer
 		sendUndecryptablePackets := func() {
-			for i := 0; i < protocol.MaxUndecryptablePackets+1; i++ {
+			for i := 0; i < sess.config.MaxUndecryptablePackets+1; i++ {
 				hdr := &wire.Header{
 					PacketNumber: protocol.PacketNumber(i + 1),
 				}
@@ -1343,7 +2874,7 @@ var _ = Describe("Session", func() {
 				sess.run()
 			}()
 			sendUndecryptablePackets()
-			Eventually(func() []*receivedPacket { return sess.undecryptablePackets }).Should(HaveLen(protocol.MaxUndecryptablePackets))
+			Eventually(func() []*receivedPacket { return sess.undecryptablePackets }).Should(HaveLen(sess.config.MaxUndecryptablePackets))
 			// check that old packets are kept, and the new packets are dropped
 			Expect(sess.undecryptablePackets[0].header.PacketNumber).To(Equal(protocol.PacketNumber(1)))
 			// make the go routine return
@@ -1387,6 +2918,22 @@ var _ = Describe("Session", func() {
 			Eventually(sess.Context().Done()).Should(BeClosed())
 		})
 
+		It("drops undecryptable packets when the undecryptable packet queue exceeds the byte limit", func() {
+			sess.config.MaxUndecryptablePacketBytes = 15
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+			}()
+			sendUndecryptablePackets()
+			// every packet is 6 bytes long, so only 2 packets fit into the queue
+			Eventually(func() []*receivedPacket { return sess.undecryptablePackets }).Should(HaveLen(2))
+			Eventually(func() time.Time { return sess.receivedTooManyUndecrytablePacketsTime }).ShouldNot(BeZero())
+			// make the go routine return
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			Expect(sess.Close(nil)).To(Succeed())
+			Eventually(sess.Context().Done()).Should(BeClosed())
+		})
+
 		It("ignores undecryptable packets after the handshake is complete", func() {
 			sess.handshakeComplete = true
 			go func() {
@@ -1405,9 +2952,11 @@ var _ = Describe("Session", func() {
 			sess.undecryptablePackets = []*receivedPacket{{
 				header: &wire.Header{PacketNumber: protocol.PacketNumber(42)},
 			}}
+			sess.undecryptablePacketBytes = 100
 			Expect(sess.receivedPackets).NotTo(Receive())
 			sess.tryDecryptingQueuedPackets()
 			Expect(sess.undecryptablePackets).To(BeEmpty())
+			Expect(sess.undecryptablePacketBytes).To(BeZero())
 			Expect(sess.receivedPackets).To(Receive())
 		})
 	})
@@ -1441,6 +2990,62 @@ var _ = Describe("Session", func() {
 		Eventually(sess.Context().Done()).Should(BeClosed())
 	})
 
+	It("doesn't confirm the handshake when it completes, for the gQUIC server", func() {
+		go func() {
+			defer GinkgoRecover()
+			sess.run()
+		}()
+		sessionRunner.EXPECT().onHandshakeComplete(gomock.Any())
+		close(handshakeChan)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		Expect(sess.WaitForHandshakeConfirmation(ctx)).To(MatchError(context.DeadlineExceeded))
+		// make sure the go routine returns
+		sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+		streamManager.EXPECT().CloseWithError(gomock.Any())
+		Expect(sess.Close(nil)).To(Succeed())
+		Eventually(sess.Context().Done()).Should(BeClosed())
+	})
+
+	It("stops waiting for the handshake confirmation when the session is closed", func() {
+		go func() {
+			defer GinkgoRecover()
+			sess.run()
+		}()
+		errChan := make(chan error, 1)
+		go func() {
+			defer GinkgoRecover()
+			errChan <- sess.WaitForHandshakeConfirmation(context.Background())
+		}()
+		Consistently(errChan).ShouldNot(Receive())
+		sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+		streamManager.EXPECT().CloseWithError(gomock.Any())
+		Expect(sess.Close(nil)).To(Succeed())
+		Eventually(errChan).Should(Receive(MatchError("session closed before the handshake was confirmed")))
+	})
+
+	It("issues new connection IDs when the handshake completes, for IETF QUIC", func() {
+		sess.version = versionIETFFrames
+		sess.packer.version = versionIETFFrames
+		sess.connIDGenerator.connIDCount = 3
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			sess.run()
+		}()
+		sessionRunner.EXPECT().onHandshakeComplete(gomock.Any())
+		sessionRunner.EXPECT().getStatelessResetToken(gomock.Any()).Times(2)
+		sessionRunner.EXPECT().addConnectionID(gomock.Any(), sess)
+		sessionRunner.EXPECT().addConnectionID(gomock.Any(), sess).Do(func(protocol.ConnectionID, packetHandler) { close(done) })
+		close(handshakeChan)
+		Eventually(done).Should(BeClosed())
+		// make sure the go routine returns
+		sessionRunner.EXPECT().removeConnectionID(gomock.Any()).Times(3)
+		streamManager.EXPECT().CloseWithError(gomock.Any())
+		Expect(sess.Close(nil)).To(Succeed())
+		Eventually(sess.Context().Done()).Should(BeClosed())
+	})
+
 	It("passes errors to the session runner", func() {
 		testErr := errors.New("handshake error")
 		done := make(chan struct{})
@@ -1483,6 +3088,88 @@ var _ = Describe("Session", func() {
 		Eventually(sess.Context().Done()).Should(BeClosed())
 	})
 
+	It("reports the features and the versions announced by the peer in the ConnectionState", func() {
+		paramsChan := make(chan handshake.TransportParameters)
+		sess.paramsChan = paramsChan
+		go func() {
+			defer GinkgoRecover()
+			sess.run()
+		}()
+		Expect(sess.ConnectionState().SupportedVersions).To(BeEmpty())
+		Expect(sess.ConnectionState().PeerFeatures).To(BeZero())
+		params := handshake.TransportParameters{
+			ServerSupportedVersions: []protocol.VersionNumber{protocol.Version39, 0x1337},
+			Features:                protocol.NewFeatureSet(protocol.FeatureDatagrams),
+		}
+		streamManager.EXPECT().UpdateLimits(&params)
+		paramsChan <- params
+		Eventually(func() []protocol.VersionNumber { return sess.ConnectionState().SupportedVersions }).Should(Equal([]protocol.VersionNumber{protocol.Version39, 0x1337}))
+		Expect(sess.ConnectionState().PeerFeatures.Has(protocol.FeatureDatagrams)).To(BeTrue())
+		Expect(sess.ConnectionState().PeerFeatures.Has(FeatureAckFrequency)).To(BeFalse())
+		// make the go routine return
+		streamManager.EXPECT().CloseWithError(gomock.Any())
+		sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+		sess.Close(nil)
+		Eventually(sess.Context().Done()).Should(BeClosed())
+	})
+
+	It("registers the stateless reset token received in the transport parameters", func() {
+		paramsChan := make(chan handshake.TransportParameters)
+		sess.paramsChan = paramsChan
+		go func() {
+			defer GinkgoRecover()
+			sess.run()
+		}()
+		token := [16]byte{0xde, 0xca, 0xfb, 0xad}
+		params := handshake.TransportParameters{StatelessResetToken: &token}
+		streamManager.EXPECT().UpdateLimits(&params)
+		added := make(chan struct{})
+		sessionRunner.EXPECT().addResetToken(token).Do(func([16]byte) { close(added) })
+		paramsChan <- params
+		Eventually(added).Should(BeClosed())
+		// the token is removed when the session is closed
+		streamManager.EXPECT().CloseWithError(gomock.Any())
+		sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+		sessionRunner.EXPECT().removeResetToken(token)
+		sess.Close(nil)
+		Eventually(sess.Context().Done()).Should(BeClosed())
+	})
+
+	Context("requesting an ACK policy from the peer", func() {
+		BeforeEach(func() {
+			sess.version = protocol.VersionTLS
+			sess.config.PeerAckPolicy = &AckPolicy{PacketThreshold: 20}
+		})
+
+		It("sends an ACK_FREQUENCY frame, if the peer supports the extension", func() {
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sess.sentPacketHandler = sph
+			sph.EXPECT().SetPeerMaxAckDelay(25 * time.Millisecond)
+			params := &handshake.TransportParameters{Features: protocol.NewFeatureSet(protocol.FeatureAckFrequency)}
+			streamManager.EXPECT().UpdateLimits(params)
+			sess.processTransportParameters(params)
+			Expect(sess.packer.controlFrames).To(ContainElement(&wire.AckFrequencyFrame{
+				PacketTolerance: 20,
+				MaxAckDelay:     25 * time.Millisecond,
+			}))
+		})
+
+		It("doesn't send an ACK_FREQUENCY frame, if the peer doesn't support the extension", func() {
+			params := &handshake.TransportParameters{}
+			streamManager.EXPECT().UpdateLimits(params)
+			sess.processTransportParameters(params)
+			Expect(sess.packer.controlFrames).To(BeEmpty())
+		})
+
+		It("doesn't send an ACK_FREQUENCY frame when using gQUIC", func() {
+			sess.version = protocol.Version39
+			params := &handshake.TransportParameters{Features: protocol.NewFeatureSet(protocol.FeatureAckFrequency)}
+			streamManager.EXPECT().UpdateLimits(params)
+			sess.processTransportParameters(params)
+			Expect(sess.packer.controlFrames).To(BeEmpty())
+		})
+	})
+
 	Context("keep-alives", func() {
 		// should be shorter than the local timeout for these tests
 		// otherwise we'd send a CONNECTION_CLOSE in the tests where we're testing that no PING is sent
@@ -1532,6 +3219,48 @@ var _ = Describe("Session", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("sends a PING after the keep-alive period, if there are open streams", func() {
+			sess.handshakeComplete = true
+			sess.config.KeepAlivePeriod = time.Second
+			sess.lastNetworkActivityTime = time.Now().Add(-time.Second)
+			sess.packer.hasSentPacket = true // make sure this is not the first packet the packer sends
+			streamManager.EXPECT().NumStreams().Return(1).AnyTimes()
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+				close(done)
+			}()
+			var data []byte
+			Eventually(mconn.written).Should(Receive(&data))
+			// -12 because of the crypto tag. This should be 7 (the frame id for a ping frame).
+			Expect(data[len(data)-12-1 : len(data)-12]).To(Equal([]byte{0x07}))
+			// make the go routine return
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sess.Close(nil)
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("doesn't send a PING after the keep-alive period, if there are no open streams", func() {
+			sess.handshakeComplete = true
+			sess.config.KeepAlivePeriod = time.Second
+			sess.lastNetworkActivityTime = time.Now().Add(-time.Second)
+			streamManager.EXPECT().NumStreams().Return(0).AnyTimes()
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+				close(done)
+			}()
+			Consistently(mconn.written).ShouldNot(Receive())
+			// make the go routine return
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sess.Close(nil)
+			Eventually(done).Should(BeClosed())
+		})
+
 		It("doesn't send a PING if the handshake isn't completed yet", func() {
 			sess.handshakeComplete = false
 			sess.config.KeepAlive = true
@@ -1586,7 +3315,7 @@ var _ = Describe("Session", func() {
 		})
 
 		It("does not use the idle timeout before the handshake complete", func() {
-			sess.config.IdleTimeout = 9999 * time.Second
+			sess.idleTimeout = 9999 * time.Second
 			defer sess.Close(nil)
 			sess.lastNetworkActivityTime = time.Now().Add(-time.Minute)
 			// the handshake timeout is irrelevant here, since it depends on the time the session was created,
@@ -1605,7 +3334,7 @@ var _ = Describe("Session", func() {
 		It("closes the session due to the idle timeout after handshake", func() {
 			sessionRunner.EXPECT().onHandshakeComplete(sess)
 			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
-			sess.config.IdleTimeout = 0
+			sess.idleTimeout = 0
 			close(handshakeChan)
 			done := make(chan struct{})
 			go func() {
@@ -1617,6 +3346,104 @@ var _ = Describe("Session", func() {
 			Eventually(done).Should(BeClosed())
 			Expect(mconn.written).To(Receive(ContainSubstring("No recent network activity.")))
 		})
+
+		It("uses the idle timeout of the peer, if it is smaller", func() {
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			sess.handshakeComplete = true
+			sess.idleTimeout = time.Hour
+			sess.peerParams = &handshake.TransportParameters{IdleTimeout: 10 * time.Second}
+			sess.lastNetworkActivityTime = time.Now().Add(-time.Minute)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				err := sess.run()
+				Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.NetworkIdleTimeout))
+				close(done)
+			}()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("changes the idle timeout", func() {
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			sess.handshakeComplete = true
+			sess.idleTimeout = time.Hour
+			sess.lastNetworkActivityTime = time.Now().Add(-time.Minute)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				err := sess.run()
+				Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.NetworkIdleTimeout))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			sess.SetIdleTimeout(time.Second)
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("doesn't block when changing the idle timeout of a closed session", func() {
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+			}()
+			sess.Close(nil)
+			Eventually(sess.Context().Done()).Should(BeClosed())
+			sess.SetIdleTimeout(time.Second)
+		})
+	})
+
+	Context("DSCP", func() {
+		It("marks packets with the DSCP from the config", func() {
+			mconn = newMockConnection()
+			_, err := newSession(
+				mconn,
+				sessionRunner,
+				protocol.Version39,
+				protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+				scfg,
+				nil,
+				populateServerConfig(&Config{DSCP: 46}),
+				utils.DefaultLogger,
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mconn.dscp).To(BeEquivalentTo(46))
+		})
+
+		It("changes the DSCP", func() {
+			Expect(sess.SetDSCP(10)).To(Succeed())
+			Expect(mconn.dscp).To(BeEquivalentTo(10))
+			Expect(sess.SetDSCP(0)).To(Succeed())
+			Expect(mconn.dscp).To(BeZero())
+		})
+
+		It("rejects invalid DSCPs", func() {
+			Expect(sess.SetDSCP(10)).To(Succeed())
+			Expect(sess.SetDSCP(64)).To(MatchError("invalid DSCP: 64"))
+			Expect(mconn.dscp).To(BeEquivalentTo(10))
+		})
+	})
+
+	Context("TTL", func() {
+		It("sets the TTL from the config", func() {
+			mconn = newMockConnection()
+			_, err := newSession(
+				mconn,
+				sessionRunner,
+				protocol.Version39,
+				protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+				scfg,
+				nil,
+				populateServerConfig(&Config{TTL: 32}),
+				utils.DefaultLogger,
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mconn.ttl).To(BeEquivalentTo(32))
+		})
+
+		It("changes the TTL", func() {
+			sess.SetTTL(3)
+			Expect(mconn.ttl).To(BeEquivalentTo(3))
+		})
 	})
 
 	It("stores up to MaxSessionUnprocessedPackets packets", func(done Done) {
@@ -1767,6 +3594,10 @@ var _ = Describe("Client Session", func() {
 		newCryptoSetupClient = handshake.NewCryptoSetupClient
 	})
 
+	It("uses the same correlation ID as the server", func() {
+		Expect(sess.CorrelationID()).To(Equal(getCorrelationID(protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1})))
+	})
+
 	It("sends a forward-secure packet when the handshake completes", func() {
 		sessionRunner.EXPECT().onHandshakeComplete(gomock.Any())
 		sess.packer.hasSentPacket = true
@@ -1776,6 +3607,7 @@ var _ = Describe("Client Session", func() {
 		}()
 		close(handshakeChan)
 		Eventually(mconn.written).Should(Receive())
+		Expect(sess.WaitForHandshakeConfirmation(context.Background())).To(Succeed())
 		//make sure the go routine returns
 		sessionRunner.EXPECT().removeConnectionID(gomock.Any())
 		Expect(sess.Close(nil)).To(Succeed())
@@ -1806,7 +3638,7 @@ var _ = Describe("Client Session", func() {
 		sess.queueControlFrame(&wire.PingFrame{})
 		var packet []byte
 		Eventually(mconn.written).Should(Receive(&packet))
-		hdr, err := wire.ParseHeaderSentByClient(bytes.NewReader(packet))
+		hdr, err := wire.ParseHeaderSentByClient(bytes.NewReader(packet), protocol.ConnectionIDLen)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(hdr.DestConnectionID).To(Equal(protocol.ConnectionID{1, 3, 3, 7, 1, 3, 3, 7}))
 		// make sure the go routine returns
@@ -1815,6 +3647,54 @@ var _ = Describe("Client Session", func() {
 		Eventually(sess.Context().Done()).Should(BeClosed())
 	})
 
+	It("migrates to a new net.PacketConn", func() {
+		sess.packer.hasSentPacket = true
+		go func() {
+			defer GinkgoRecover()
+			sess.run()
+		}()
+		pconn := newMockPacketConn()
+		pconn.addr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1234}
+		Expect(sess.Migrate(pconn)).To(Succeed())
+		Expect(sess.LocalAddr()).To(Equal(pconn.addr))
+		// a PING is sent, such that the server learns about the new address
+		Eventually(mconn.written).Should(Receive())
+		// make sure the go routine returns
+		sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+		Expect(sess.Close(nil)).To(Succeed())
+		Eventually(sess.Context().Done()).Should(BeClosed())
+	})
+
+	It("switches to a new connection ID when migrating", func() {
+		newConnID := protocol.ConnectionID{1, 3, 3, 7, 1, 3, 3, 7}
+		token := [16]byte{0xde, 0xca, 0xfb, 0xad}
+		sess.connIDManager.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: newConnID, StatelessResetToken: token})
+		go func() {
+			defer GinkgoRecover()
+			sess.run()
+		}()
+		sessionRunner.EXPECT().addResetToken(token)
+		Expect(sess.Migrate(newMockPacketConn())).To(Succeed())
+		// make sure the go routine returns
+		sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+		sessionRunner.EXPECT().removeResetToken(token)
+		Expect(sess.Close(nil)).To(Succeed())
+		Eventually(sess.Context().Done()).Should(BeClosed())
+		Expect(sess.destConnID).To(Equal(newConnID))
+		Expect(sess.packer.destConnID).To(Equal(newConnID))
+	})
+
+	It("errors when migrating a closed session", func() {
+		go func() {
+			defer GinkgoRecover()
+			sess.run()
+		}()
+		sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+		Expect(sess.Close(nil)).To(Succeed())
+		Eventually(sess.Context().Done()).Should(BeClosed())
+		Expect(sess.Migrate(newMockPacketConn())).To(MatchError("session already closed"))
+	})
+
 	Context("receiving packets", func() {
 		var hdr *wire.Header
 
@@ -0,0 +1,104 @@
+package quic
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// A SocketBufferWarning is reported when the operating system doesn't allow increasing the size of a UDP socket buffer
+// to the size requested by Config.ReceiveBufferSize or Config.SendBufferSize.
+// Small socket buffers are a common cause of packet loss and low throughput.
+// On Linux, the maximum sizes are configured using the net.core.rmem_max and net.core.wmem_max sysctls.
+// Warning: This API should not be considered stable and might change soon.
+type SocketBufferWarning struct {
+	// Send is true if the send buffer couldn't be increased, and false for the receive buffer.
+	Send bool
+	// LocalAddr is the local address of the socket.
+	LocalAddr net.Addr
+	// Requested is the requested size, in bytes.
+	Requested int
+	// Achieved is the size of the buffer, as reported by the operating system.
+	Achieved int
+}
+
+func (w *SocketBufferWarning) String() string {
+	buffer, sysctl := "receive", "net.core.rmem_max"
+	if w.Send {
+		buffer, sysctl = "send", "net.core.wmem_max"
+	}
+	return fmt.Sprintf("failed to increase the %s buffer size of %s to %d bytes, it is %d bytes (on Linux, see the %s sysctl)", buffer, w.LocalAddr, w.Requested, w.Achieved, sysctl)
+}
+
+// getSocketBufferSize returns the socket buffer size to use for a configured size
+func getSocketBufferSize(size int) int {
+	if size == 0 {
+		return protocol.DefaultSocketBufferSize
+	}
+	return size
+}
+
+// getUDPConn returns the UDP connection underlying a net.PacketConn, or nil if it isn't a UDP connection
+func getUDPConn(pconn net.PacketConn) *net.UDPConn {
+	switch c := pconn.(type) {
+	case *net.UDPConn:
+		return c
+	case *oobConn:
+		return c.UDPConn
+	}
+	return nil
+}
+
+// setSocketBuffers tries to increase the receive and send buffer of a UDP socket to the sizes requested in the config.
+// Negative sizes leave the buffer unchanged.
+// If the operating system caps a buffer at a smaller size, a SocketBufferWarning is reported.
+func setSocketBuffers(pconn net.PacketConn, config *Config) {
+	c := getUDPConn(pconn)
+	if c == nil {
+		return
+	}
+	if config.ReceiveBufferSize > 0 {
+		if err := c.SetReadBuffer(config.ReceiveBufferSize); err != nil {
+			utils.DefaultLogger.Debugf("Failed to set the receive buffer size of %s: %s", c.LocalAddr(), err)
+		}
+	}
+	if config.SendBufferSize > 0 {
+		if err := c.SetWriteBuffer(config.SendBufferSize); err != nil {
+			utils.DefaultLogger.Debugf("Failed to set the send buffer size of %s: %s", c.LocalAddr(), err)
+		}
+	}
+	receive, send, err := getSocketBufferSizes(c)
+	if err != nil {
+		utils.DefaultLogger.Debugf("Not checking the buffer sizes of %s: %s", c.LocalAddr(), err)
+		return
+	}
+	if config.ReceiveBufferSize > 0 && receive < config.ReceiveBufferSize {
+		reportSocketBufferWarning(config, &SocketBufferWarning{LocalAddr: c.LocalAddr(), Requested: config.ReceiveBufferSize, Achieved: receive})
+	}
+	if config.SendBufferSize > 0 && send < config.SendBufferSize {
+		reportSocketBufferWarning(config, &SocketBufferWarning{Send: true, LocalAddr: c.LocalAddr(), Requested: config.SendBufferSize, Achieved: send})
+	}
+}
+
+func reportSocketBufferWarning(config *Config, w *SocketBufferWarning) {
+	utils.DefaultLogger.Infof("%s", w)
+	if config.OnSocketBufferWarning != nil {
+		config.OnSocketBufferWarning(*w)
+	}
+}
+
+// socketBufferSizes returns the sizes of the receive and the send buffer of a UDP socket.
+// It returns 0 if the sizes can't be determined.
+func socketBufferSizes(pconn net.PacketConn) (receive, send int) {
+	c := getUDPConn(pconn)
+	if c == nil {
+		return 0, 0
+	}
+	receive, send, err := getSocketBufferSizes(c)
+	if err != nil {
+		return 0, 0
+	}
+	return receive, send
+}
@@ -0,0 +1,165 @@
+package quic
+
+import (
+	"net"
+	"strconv"
+	"sync"
+)
+
+type sourceState struct {
+	handshakes int
+	sessions   int
+}
+
+type limitedSession struct {
+	source string
+	// handshakeComplete is set when the session was moved from the handshakes to the sessions
+	handshakeComplete bool
+}
+
+// A sourceReservation counts as a handshake of its source, from the first packet of a connection until the session is created.
+// It is either attached to the session, or released if no session is created.
+type sourceReservation struct {
+	source string
+	// done is set when the reservation was attached or released
+	done bool
+}
+
+// The sourceLimiter keeps track of the sessions of every source, i.e. of every IP address or address prefix.
+// It limits the number of concurrent handshakes and the number of sessions per source.
+// Since sessions are created asynchronously (for IETF QUIC), a handshake is reserved as soon as the first packet is received.
+type sourceLimiter struct {
+	mutex sync.Mutex
+
+	sources  map[string]*sourceState
+	sessions map[packetHandler]*limitedSession
+}
+
+func newSourceLimiter() *sourceLimiter {
+	return &sourceLimiter{
+		sources:  make(map[string]*sourceState),
+		sessions: make(map[packetHandler]*limitedSession),
+	}
+}
+
+// limitsSources says if the Config limits the number of sessions per source
+func limitsSources(config *Config) bool {
+	return config.MaxHandshakesPerSource > 0 || config.MaxSessionsPerSource > 0 || config.SourceLimits != nil
+}
+
+// Reserve checks if a new session from this address can be accepted, and if so, reserves a handshake for it.
+// The reservation has to be passed to Attach when the session is created, or to Release otherwise.
+func (l *sourceLimiter) Reserve(remoteAddr net.Addr, config *Config) (*sourceReservation, bool) {
+	maxHandshakes, maxSessions := config.MaxHandshakesPerSource, config.MaxSessionsPerSource
+	if config.SourceLimits != nil {
+		maxHandshakes, maxSessions = config.SourceLimits(remoteAddr)
+	}
+	key := sourceKey(remoteAddr, config)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	state, ok := l.sources[key]
+	if !ok {
+		state = &sourceState{}
+		l.sources[key] = state
+	}
+	if maxHandshakes > 0 && state.handshakes >= maxHandshakes {
+		return nil, false
+	}
+	// sessions that are still in the handshake count towards the session limit as well
+	if maxSessions > 0 && state.handshakes+state.sessions >= maxSessions {
+		return nil, false
+	}
+	state.handshakes++
+	return &sourceReservation{source: key}, true
+}
+
+// Attach starts tracking a new session, using the handshake reserved by Reserve.
+// It is counted as a handshake until HandshakeComplete is called.
+// It does nothing for a nil reservation.
+func (l *sourceLimiter) Attach(r *sourceReservation, sess packetHandler) {
+	if r == nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if r.done {
+		return
+	}
+	r.done = true
+	l.sessions[sess] = &limitedSession{source: r.source}
+}
+
+// Release releases a reservation that was not attached to a session.
+// It does nothing for a nil reservation, or for a reservation that was already attached or released.
+func (l *sourceLimiter) Release(r *sourceReservation) {
+	if r == nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if r.done {
+		return
+	}
+	r.done = true
+	state := l.sources[r.source]
+	state.handshakes--
+	l.maybeDeleteSource(r.source, state)
+}
+
+// HandshakeComplete is called when the handshake of a session completes.
+func (l *sourceLimiter) HandshakeComplete(sess packetHandler) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	ls, ok := l.sessions[sess]
+	if !ok || ls.handshakeComplete {
+		return
+	}
+	ls.handshakeComplete = true
+	state := l.sources[ls.source]
+	state.handshakes--
+	state.sessions++
+}
+
+// Remove is called when a session is closed.
+func (l *sourceLimiter) Remove(sess packetHandler) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	ls, ok := l.sessions[sess]
+	if !ok {
+		return
+	}
+	delete(l.sessions, sess)
+	state := l.sources[ls.source]
+	if ls.handshakeComplete {
+		state.sessions--
+	} else {
+		state.handshakes--
+	}
+	l.maybeDeleteSource(ls.source, state)
+}
+
+// must be called after locking the mutex
+func (l *sourceLimiter) maybeDeleteSource(key string, state *sourceState) {
+	if state.handshakes == 0 && state.sessions == 0 {
+		delete(l.sources, key)
+	}
+}
+
+// sourceKey returns the address prefix that the limits are applied to.
+// For addresses that are not UDP addresses, the whole address is used.
+func sourceKey(remoteAddr net.Addr, config *Config) string {
+	udpAddr, ok := remoteAddr.(*net.UDPAddr)
+	if !ok {
+		return remoteAddr.String()
+	}
+	if ip := udpAddr.IP.To4(); ip != nil {
+		return ip.Mask(net.CIDRMask(config.SourcePrefixLengthIPv4, 8*net.IPv4len)).String() + "/" + strconv.Itoa(config.SourcePrefixLengthIPv4)
+	}
+	return udpAddr.IP.Mask(net.CIDRMask(config.SourcePrefixLengthIPv6, 8*net.IPv6len)).String() + "/" + strconv.Itoa(config.SourcePrefixLengthIPv6)
+}
@@ -0,0 +1,184 @@
+package quic
+
+import (
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Source Limiter", func() {
+	var (
+		l      *sourceLimiter
+		config *Config
+		addr   = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1234}
+	)
+
+	BeforeEach(func() {
+		l = newSourceLimiter()
+		config = populateServerConfig(&Config{})
+	})
+
+	newSession := func() packetHandler {
+		return &mockSession{MockPacketHandler: NewMockPacketHandler(mockCtrl)}
+	}
+
+	// allow says if a new session from this address would be accepted, without reserving a handshake
+	allow := func(addr net.Addr) bool {
+		r, ok := l.Reserve(addr, config)
+		l.Release(r)
+		return ok
+	}
+
+	add := func(sess packetHandler, addr net.Addr) {
+		r, ok := l.Reserve(addr, config)
+		ExpectWithOffset(1, ok).To(BeTrue())
+		l.Attach(r, sess)
+	}
+
+	It("tells if a config limits sources", func() {
+		Expect(limitsSources(&Config{})).To(BeFalse())
+		Expect(limitsSources(&Config{MaxHandshakesPerSource: 1})).To(BeTrue())
+		Expect(limitsSources(&Config{MaxSessionsPerSource: 1})).To(BeTrue())
+		Expect(limitsSources(&Config{SourceLimits: func(net.Addr) (int, int) { return 0, 0 }})).To(BeTrue())
+	})
+
+	It("limits the number of handshakes", func() {
+		config.MaxHandshakesPerSource = 2
+		sess1 := newSession()
+		sess2 := newSession()
+		add(sess1, addr)
+		Expect(allow(addr)).To(BeTrue())
+		add(sess2, addr)
+		Expect(allow(addr)).To(BeFalse())
+		// completed handshakes don't count towards the limit
+		l.HandshakeComplete(sess1)
+		Expect(allow(addr)).To(BeTrue())
+		add(newSession(), addr)
+		Expect(allow(addr)).To(BeFalse())
+		l.Remove(sess2)
+		Expect(allow(addr)).To(BeTrue())
+	})
+
+	It("limits the number of sessions, including sessions in the handshake", func() {
+		config.MaxSessionsPerSource = 2
+		sess1 := newSession()
+		sess2 := newSession()
+		add(sess1, addr)
+		l.HandshakeComplete(sess1)
+		Expect(allow(addr)).To(BeTrue())
+		add(sess2, addr)
+		Expect(allow(addr)).To(BeFalse())
+		l.HandshakeComplete(sess2)
+		Expect(allow(addr)).To(BeFalse())
+		l.Remove(sess1)
+		Expect(allow(addr)).To(BeTrue())
+	})
+
+	It("uses the limits returned by the callback", func() {
+		allowed := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}
+		config.MaxSessionsPerSource = 1
+		config.SourceLimits = func(remoteAddr net.Addr) (int, int) {
+			if remoteAddr.(*net.UDPAddr).IP.Equal(allowed.IP) {
+				return 0, 0
+			}
+			return config.MaxHandshakesPerSource, config.MaxSessionsPerSource
+		}
+		for i := 0; i < 10; i++ {
+			Expect(allow(allowed)).To(BeTrue())
+			add(newSession(), allowed)
+		}
+		add(newSession(), addr)
+		Expect(allow(addr)).To(BeFalse())
+	})
+
+	It("applies the limits to address prefixes", func() {
+		config.MaxSessionsPerSource = 1
+		config.SourcePrefixLengthIPv4 = 24
+		add(newSession(), addr)
+		Expect(allow(&net.UDPAddr{IP: net.IPv4(192, 168, 0, 42), Port: 4321})).To(BeFalse())
+		Expect(allow(&net.UDPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 1234})).To(BeTrue())
+	})
+
+	It("reserves handshakes before the session is created", func() {
+		config.MaxHandshakesPerSource = 2
+		r1, ok := l.Reserve(addr, config)
+		Expect(ok).To(BeTrue())
+		_, ok = l.Reserve(addr, config)
+		Expect(ok).To(BeTrue())
+		_, ok = l.Reserve(addr, config)
+		Expect(ok).To(BeFalse())
+		// attaching the reservation doesn't count the session again
+		l.Attach(r1, newSession())
+		Expect(allow(addr)).To(BeFalse())
+	})
+
+	It("releases reservations", func() {
+		config.MaxSessionsPerSource = 1
+		r, ok := l.Reserve(addr, config)
+		Expect(ok).To(BeTrue())
+		Expect(allow(addr)).To(BeFalse())
+		l.Release(r)
+		Expect(l.sources).To(BeEmpty())
+		// releasing a reservation twice has no effect
+		l.Release(r)
+		Expect(l.sources).To(BeEmpty())
+	})
+
+	It("doesn't release reservations that were attached", func() {
+		config.MaxSessionsPerSource = 1
+		r, ok := l.Reserve(addr, config)
+		Expect(ok).To(BeTrue())
+		l.Attach(r, newSession())
+		l.Release(r)
+		Expect(allow(addr)).To(BeFalse())
+	})
+
+	It("accepts nil reservations", func() {
+		l.Attach(nil, newSession())
+		l.Release(nil)
+		Expect(l.sessions).To(BeEmpty())
+	})
+
+	It("ignores calls for sessions it doesn't track", func() {
+		sess := newSession()
+		l.HandshakeComplete(sess)
+		l.Remove(sess)
+		Expect(l.sources).To(BeEmpty())
+	})
+
+	It("removes sources without any sessions", func() {
+		sess := newSession()
+		add(sess, addr)
+		l.HandshakeComplete(sess)
+		l.Remove(sess)
+		Expect(l.sources).To(BeEmpty())
+		Expect(l.sessions).To(BeEmpty())
+	})
+
+	Context("source keys", func() {
+		It("uses the whole IPv4 address by default", func() {
+			Expect(sourceKey(addr, config)).To(Equal("192.168.0.1/32"))
+		})
+
+		It("uses IPv4 prefixes", func() {
+			config.SourcePrefixLengthIPv4 = 16
+			Expect(sourceKey(addr, config)).To(Equal("192.168.0.0/16"))
+		})
+
+		It("treats IPv4-mapped IPv6 addresses as IPv4 addresses", func() {
+			Expect(sourceKey(&net.UDPAddr{IP: net.ParseIP("::ffff:192.168.0.1")}, config)).To(Equal("192.168.0.1/32"))
+		})
+
+		It("uses a /64 prefix for IPv6 addresses by default", func() {
+			Expect(config.SourcePrefixLengthIPv6).To(Equal(protocol.DefaultSourcePrefixLengthIPv6))
+			Expect(sourceKey(&net.UDPAddr{IP: net.ParseIP("2001:db8::1:2:3:4")}, config)).To(Equal("2001:db8::/64"))
+		})
+
+		It("uses the string representation for other addresses", func() {
+			Expect(sourceKey(&net.TCPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}, config)).To(Equal("192.168.0.1:1337"))
+		})
+	})
+})
@@ -0,0 +1,36 @@
+package quic
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/qerr"
+)
+
+// ErrStatelessReset is the error that a session is closed with when the peer sent a stateless reset.
+// A server sends a stateless reset when it receives a packet for a connection that it doesn't have any state for,
+// e.g. after it was restarted.
+// Only used for IETF QUIC.
+var ErrStatelessReset = qerr.RemoteError(qerr.PublicReset, "received a stateless reset")
+
+// getStatelessResetToken derives the stateless reset token for a connection ID from a static key.
+// Servers that use the same key derive the same token, such that any of them
+// can reset a connection, even if it doesn't have any state for it.
+func getStatelessResetToken(key []byte, connID protocol.ConnectionID) [16]byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(connID)
+	var token [16]byte
+	copy(token[:], h.Sum(nil))
+	return token
+}
+
+// getRandomStatelessResetToken is used by the client.
+// The client never sends Stateless Resets, since it doesn't keep any state across sessions,
+// so it can use random tokens.
+func getRandomStatelessResetToken(protocol.ConnectionID) [16]byte {
+	var token [16]byte
+	_, _ = rand.Read(token[:]) // ignore the error here. Servers don't check for Stateless Resets.
+	return token
+}
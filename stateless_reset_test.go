@@ -0,0 +1,27 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stateless Reset Tokens", func() {
+	connID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37}
+
+	It("derives the same token from the same key", func() {
+		token := getStatelessResetToken([]byte("foobar"), connID)
+		Expect(token).ToNot(BeZero())
+		Expect(getStatelessResetToken([]byte("foobar"), connID)).To(Equal(token))
+	})
+
+	It("derives different tokens for different keys", func() {
+		Expect(getStatelessResetToken([]byte("foo"), connID)).ToNot(Equal(getStatelessResetToken([]byte("bar"), connID)))
+	})
+
+	It("derives different tokens for different connection IDs", func() {
+		connID2 := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x38}
+		Expect(getStatelessResetToken([]byte("foobar"), connID)).ToNot(Equal(getStatelessResetToken([]byte("foobar"), connID2)))
+	})
+})
@@ -0,0 +1,118 @@
+package quic
+
+import (
+	"time"
+)
+
+// StreamStats are statistics about the data transferred on a stream.
+// For a unidirectional stream, only the values for the respective direction are set.
+// Warning: This API should not be considered stable and might change soon.
+type StreamStats struct {
+	// BytesSent is the number of bytes of stream data sent, not counting retransmissions.
+	BytesSent uint64
+	// BytesRetransmitted is the number of bytes of stream data that were retransmitted.
+	BytesRetransmitted uint64
+	// BytesReceived is the number of bytes of stream data received, including duplicate data.
+	BytesReceived uint64
+	// FramesSent is the number of STREAM frames sent, not counting retransmissions.
+	FramesSent uint64
+	// FramesReceived is the number of STREAM frames received.
+	FramesReceived uint64
+	// FlowControlBlockedTime is the time that sending was blocked by stream-level flow control.
+	FlowControlBlockedTime time.Duration
+}
+
+// SessionStats are statistics about the data transferred on a session.
+// The byte counts are aggregated over all streams, excluding the crypto stream.
+// Warning: This API should not be considered stable and might change soon.
+type SessionStats struct {
+	// BytesSent is the number of bytes of stream data sent, not counting retransmissions.
+	BytesSent uint64
+	// BytesRetransmitted is the number of bytes of stream data that were retransmitted.
+	BytesRetransmitted uint64
+	// BytesReceived is the number of bytes of stream data received, including duplicate data.
+	BytesReceived uint64
+	// FramesSent is the number of frames (of any type) sent, including retransmissions.
+	FramesSent uint64
+	// FramesReceived is the number of frames (of any type) received.
+	FramesReceived uint64
+	// PacketsSent is the number of packets sent.
+	PacketsSent uint64
+	// PacketsReceived is the number of packets received and successfully decrypted.
+	PacketsReceived uint64
+	// FlowControlBlockedTime is the time that sending was blocked by connection-level flow control.
+	FlowControlBlockedTime time.Duration
+	// OpenStreams is the number of streams that the session currently keeps track of.
+	// A stream is removed as soon as both its send and its receive side have completed.
+	OpenStreams int
+	// LateStreamFrames is the number of frames received for streams that were already closed,
+	// e.g. retransmissions of frames that were already received, or a duplicate FIN or RST_STREAM.
+	// These frames are ignored.
+	LateStreamFrames uint64
+	// SendQueueLength is the number of packets waiting to be written to the network.
+	// If the network can't keep up, no more packets are packed once this reaches 32 packets.
+	SendQueueLength int
+	// DroppedAckOnlyPackets is the number of ACK-only packets that were dropped from the send queue before being written,
+	// because a newer ACK-only packet was queued.
+	DroppedAckOnlyPackets uint64
+	// TransientWriteErrors is the number of times writing a packet failed with a transient error (see Config.MaxTransientWriteErrors).
+	TransientWriteErrors uint64
+	// ReceiveBufferSize and SendBufferSize are the sizes of the receive and the send buffer of the UDP socket,
+	// as reported by the operating system (see Config.ReceiveBufferSize and Config.SendBufferSize).
+	// They are 0 if the sizes can't be determined (currently, they are only determined on Linux).
+	ReceiveBufferSize int
+	SendBufferSize    int
+
+	// The following values are updated by the session's run loop.
+	// They might lag behind the state of the session by the time it takes to process a single event.
+
+	// SmoothedRTT is the smoothed round-trip time. It is zero until the first RTT sample was taken.
+	SmoothedRTT time.Duration
+	// RTTVariance is the mean deviation of the RTT samples.
+	RTTVariance time.Duration
+	// MinRTT is the minimum RTT observed on the session.
+	MinRTT time.Duration
+	// LatestRTT is the most recent RTT sample.
+	LatestRTT time.Duration
+	// CongestionWindow is the current congestion window, in bytes.
+	CongestionWindow uint64
+	// BytesInFlight is the number of bytes sent, but not yet acknowledged or declared lost.
+	BytesInFlight uint64
+	// BandwidthEstimate is the congestion controller's estimate of the available bandwidth, in bits per second.
+	// It is zero until the bandwidth can be estimated.
+	// Applications can use it to adapt the bitrate of the data they send.
+	BandwidthEstimate uint64
+	// PacingRate is the rate that packets are currently paced at, in bits per second.
+	// It is usually higher than the BandwidthEstimate, to allow the congestion controller to probe for more bandwidth.
+	PacingRate uint64
+	// PacketsLost is the number of packets declared lost.
+	PacketsLost uint64
+	// TLPs is the number of tail loss probes sent.
+	TLPs uint64
+	// RTOs is the number of retransmission timeouts that fired.
+	// Together with TLPs, this is what newer drafts call the probe timeout (PTO) count.
+	RTOs uint64
+}
+
+// A StreamRecord summarizes a stream after it was completed, see Config.OnStreamCompleted.
+// Warning: This API should not be considered stable and might change soon.
+type StreamRecord struct {
+	StreamID StreamID
+	// OpenedAt is the time when the stream was opened, by the application or by the peer.
+	OpenedAt time.Time
+	// ClosedAt is the time when the stream was completed, or when the session was closed.
+	ClosedAt time.Time
+	// Stats are the statistics about the data transferred on the stream.
+	Stats StreamStats
+	// WriteReset is set if the send side of the stream was reset,
+	// either by calling CancelWrite, or because the peer asked to stop sending.
+	// WriteResetCode is the error code of the RST_STREAM frame that was sent.
+	WriteReset     bool
+	WriteResetCode ErrorCode
+	// ReadReset is set if the peer reset the stream.
+	// ReadResetCode is the error code of the RST_STREAM frame that was received.
+	ReadReset     bool
+	ReadResetCode ErrorCode
+	// SessionClosed is set if the stream was still open when the session was closed.
+	SessionClosed bool
+}
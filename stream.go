@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"fmt"
 	"net"
 	"sync"
 	"time"
@@ -19,6 +20,7 @@ const (
 type streamSender interface {
 	queueControlFrame(wire.Frame)
 	onHasStreamData(protocol.StreamID)
+	onStreamOpened(streamRecorder)
 	onStreamCompleted(protocol.StreamID)
 }
 
@@ -49,11 +51,14 @@ type streamI interface {
 	// for receiving
 	handleStreamFrame(*wire.StreamFrame) error
 	handleRstStreamFrame(*wire.RstStreamFrame) error
+	handleExpiredStreamDataFrame(*wire.ExpiredStreamDataFrame) error
 	getWindowUpdate() protocol.ByteCount
 	// for sending
 	handleStopSendingFrame(*wire.StopSendingFrame)
 	popStreamFrame(maxBytes protocol.ByteCount) (*wire.StreamFrame, bool)
 	handleMaxStreamDataFrame(*wire.MaxStreamDataFrame)
+	addRetransmittedBytes(protocol.ByteCount)
+	dropExpiredData(*wire.StreamFrame) *wire.StreamFrame
 }
 
 var _ receiveStreamI = (streamI)(nil)
@@ -98,6 +103,7 @@ var _ StreamError = &streamCanceledError{}
 func newStream(streamID protocol.StreamID,
 	sender streamSender,
 	flowController flowcontrol.StreamFlowController,
+	reassembly *reassemblyLimiter,
 	version protocol.VersionNumber,
 ) *stream {
 	s := &stream{sender: sender, version: version}
@@ -120,7 +126,7 @@ func newStream(streamID protocol.StreamID,
 			s.completedMutex.Unlock()
 		},
 	}
-	s.receiveStream = *newReceiveStream(streamID, senderForReceiveStream, flowController, version)
+	s.receiveStream = *newReceiveStream(streamID, senderForReceiveStream, flowController, reassembly, version)
 	return s
 }
 
@@ -139,6 +145,15 @@ func (s *stream) Close() error {
 	return nil
 }
 
+// need to define Stats() here, since both receiveStream and sendStream have a Stats()
+func (s *stream) Stats() StreamStats {
+	stats := s.sendStream.Stats()
+	receiveStats := s.receiveStream.Stats()
+	stats.BytesReceived = receiveStats.BytesReceived
+	stats.FramesReceived = receiveStats.FramesReceived
+	return stats
+}
+
 func (s *stream) SetDeadline(t time.Time) error {
 	_ = s.SetReadDeadline(t)  // SetReadDeadline never errors
 	_ = s.SetWriteDeadline(t) // SetWriteDeadline never errors
@@ -162,10 +177,27 @@ func (s *stream) handleRstStreamFrame(frame *wire.RstStreamFrame) error {
 			StreamID:  s.StreamID(),
 			ErrorCode: frame.ErrorCode,
 		})
+		return nil
 	}
+	// In IETF QUIC, a RST_STREAM only resets the receive side of the stream.
+	// Cancel the context anyway, since the peer is not interested in the stream any more.
+	s.sendStream.ctx.cancel(streamCanceledError{
+		errorCode: frame.ErrorCode,
+		error:     fmt.Errorf("Stream %d was reset with error code %d", s.StreamID(), frame.ErrorCode),
+	})
 	return nil
 }
 
+// record combines the records of the send and the receive side
+func (s *stream) record() StreamRecord {
+	r := s.sendStream.record()
+	receiveRecord := s.receiveStream.record()
+	r.Stats = s.Stats()
+	r.ReadReset = receiveRecord.ReadReset
+	r.ReadResetCode = receiveRecord.ReadResetCode
+	return r
+}
+
 // checkIfCompleted is called from the uniStreamSender, when one of the stream halves is completed.
 // It makes sure that the onStreamCompleted callback is only called if both receive and send side have completed.
 func (s *stream) checkIfCompleted() {
@@ -0,0 +1,70 @@
+package quic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// A streamRecorder produces the StreamRecord of a stream.
+type streamRecorder interface {
+	StreamID() protocol.StreamID
+	record() StreamRecord
+}
+
+// The streamAccounting keeps track of the open streams of a session,
+// and delivers a StreamRecord for every stream once it is completed, see Config.OnStreamCompleted.
+type streamAccounting struct {
+	mutex sync.Mutex
+
+	onCompleted func(StreamRecord)
+	streams     map[protocol.StreamID]streamRecorder
+}
+
+func newStreamAccounting(onCompleted func(StreamRecord)) *streamAccounting {
+	return &streamAccounting{
+		onCompleted: onCompleted,
+		streams:     make(map[protocol.StreamID]streamRecorder),
+	}
+}
+
+// Opened adds a stream that was opened.
+func (a *streamAccounting) Opened(str streamRecorder) {
+	a.mutex.Lock()
+	a.streams[str.StreamID()] = str
+	a.mutex.Unlock()
+}
+
+// Completed delivers the record of a stream that was completed.
+func (a *streamAccounting) Completed(id protocol.StreamID, now time.Time) {
+	a.mutex.Lock()
+	str, ok := a.streams[id]
+	delete(a.streams, id)
+	a.mutex.Unlock()
+	if ok {
+		a.deliver(str, now, false)
+	}
+}
+
+// Close delivers the records of all streams that were still open when the session was closed.
+func (a *streamAccounting) Close(now time.Time) {
+	a.mutex.Lock()
+	streams := a.streams
+	a.streams = make(map[protocol.StreamID]streamRecorder)
+	a.mutex.Unlock()
+	for _, str := range streams {
+		a.deliver(str, now, true)
+	}
+}
+
+// deliver calls the callback on a separate Go routine.
+// Streams are completed while holding the stream's mutex, so the record can't be taken synchronously.
+func (a *streamAccounting) deliver(str streamRecorder, closedAt time.Time, sessionClosed bool) {
+	go func() {
+		r := str.record()
+		r.ClosedAt = closedAt
+		r.SessionClosed = sessionClosed
+		a.onCompleted(r)
+	}()
+}
@@ -0,0 +1,76 @@
+package quic
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type mockStreamRecorder struct {
+	id       protocol.StreamID
+	openedAt time.Time
+}
+
+func (r *mockStreamRecorder) StreamID() protocol.StreamID { return r.id }
+func (r *mockStreamRecorder) record() StreamRecord {
+	return StreamRecord{StreamID: r.id, OpenedAt: r.openedAt}
+}
+
+var _ = Describe("Stream Accounting", func() {
+	var (
+		a       *streamAccounting
+		records chan StreamRecord
+	)
+
+	BeforeEach(func() {
+		records = make(chan StreamRecord, 10)
+		a = newStreamAccounting(func(r StreamRecord) { records <- r })
+	})
+
+	It("delivers the record of a completed stream", func() {
+		openedAt := time.Now().Add(-time.Second)
+		closedAt := time.Now()
+		a.Opened(&mockStreamRecorder{id: 5, openedAt: openedAt})
+		a.Opened(&mockStreamRecorder{id: 7})
+		a.Completed(5, closedAt)
+		var r StreamRecord
+		Eventually(records).Should(Receive(&r))
+		Expect(r.StreamID).To(Equal(protocol.StreamID(5)))
+		Expect(r.OpenedAt).To(Equal(openedAt))
+		Expect(r.ClosedAt).To(Equal(closedAt))
+		Expect(r.SessionClosed).To(BeFalse())
+		Consistently(records).ShouldNot(Receive())
+	})
+
+	It("delivers the record only once", func() {
+		a.Opened(&mockStreamRecorder{id: 5})
+		a.Completed(5, time.Now())
+		a.Completed(5, time.Now())
+		Eventually(records).Should(Receive())
+		Consistently(records).ShouldNot(Receive())
+	})
+
+	It("ignores streams that were never opened", func() {
+		a.Completed(5, time.Now())
+		Consistently(records).ShouldNot(Receive())
+	})
+
+	It("delivers the records of all open streams when the session is closed", func() {
+		a.Opened(&mockStreamRecorder{id: 5})
+		a.Opened(&mockStreamRecorder{id: 7})
+		a.Completed(5, time.Now())
+		var r StreamRecord
+		Eventually(records).Should(Receive(&r))
+		Expect(r.SessionClosed).To(BeFalse())
+		closedAt := time.Now()
+		a.Close(closedAt)
+		Eventually(records).Should(Receive(&r))
+		Expect(r.StreamID).To(Equal(protocol.StreamID(7)))
+		Expect(r.ClosedAt).To(Equal(closedAt))
+		Expect(r.SessionClosed).To(BeTrue())
+		Consistently(records).ShouldNot(Receive())
+	})
+})
@@ -0,0 +1,50 @@
+package quic
+
+import (
+	"net"
+	"sync"
+)
+
+// A streamConn is a net.Conn that sends and receives data on a single stream.
+type streamConn struct {
+	Stream
+
+	sess Session
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+var _ net.Conn = &streamConn{}
+
+// NewStreamConn wraps a stream into a net.Conn.
+// This allows using libraries that expect a net.Conn on top of a QUIC stream.
+// The local and remote address of the net.Conn are the addresses of the session.
+// Closing the net.Conn closes the write direction of the stream, and cancels the read direction.
+// It doesn't close the session.
+func NewStreamConn(sess Session, str Stream) net.Conn {
+	return &streamConn{
+		Stream: str,
+		sess:   sess,
+	}
+}
+
+func (c *streamConn) LocalAddr() net.Addr {
+	return c.sess.LocalAddr()
+}
+
+func (c *streamConn) RemoteAddr() net.Addr {
+	return c.sess.RemoteAddr()
+}
+
+// Close closes both directions of the stream.
+// Unlike Stream.Close, it may be called multiple times.
+func (c *streamConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = c.Stream.Close()
+		if err := c.Stream.CancelRead(0); err != nil && c.closeErr == nil {
+			c.closeErr = err
+		}
+	})
+	return c.closeErr
+}
@@ -0,0 +1,64 @@
+package quic
+
+import (
+	"errors"
+	"net"
+
+	"github.com/golang/mock/gomock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stream Conn", func() {
+	var (
+		conn net.Conn
+		sess *MockPacketHandler
+		str  *MockStreamI
+	)
+
+	BeforeEach(func() {
+		sess = NewMockPacketHandler(mockCtrl)
+		str = NewMockStreamI(mockCtrl)
+		conn = NewStreamConn(sess, str)
+	})
+
+	It("returns the addresses of the session", func() {
+		localAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
+		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 4242}
+		sess.EXPECT().LocalAddr().Return(localAddr)
+		sess.EXPECT().RemoteAddr().Return(remoteAddr)
+		Expect(conn.LocalAddr()).To(Equal(localAddr))
+		Expect(conn.RemoteAddr()).To(Equal(remoteAddr))
+	})
+
+	It("reads from and writes to the stream", func() {
+		str.EXPECT().Write([]byte("foobar")).Return(6, nil)
+		n, err := conn.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(6))
+		b := make([]byte, 6)
+		str.EXPECT().Read(b).DoAndReturn(func(p []byte) (int, error) {
+			return copy(p, "raboof"), nil
+		})
+		n, err = conn.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("raboof")))
+	})
+
+	It("closes both directions of the stream", func() {
+		gomock.InOrder(
+			str.EXPECT().Close(),
+			str.EXPECT().CancelRead(ErrorCode(0)),
+		)
+		Expect(conn.Close()).To(Succeed())
+	})
+
+	It("only closes the stream once", func() {
+		testErr := errors.New("test error")
+		str.EXPECT().Close().Return(testErr)
+		str.EXPECT().CancelRead(ErrorCode(0))
+		Expect(conn.Close()).To(MatchError(testErr))
+		Expect(conn.Close()).To(MatchError(testErr))
+	})
+})
@@ -0,0 +1,54 @@
+package quic
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// The streamContext is the context returned by Stream.Context.
+// Unlike a context created by context.WithCancel, its Err returns the error that caused the cancelation.
+type streamContext struct {
+	mutex sync.Mutex
+	done  chan struct{}
+	err   error
+}
+
+var _ context.Context = &streamContext{}
+
+func newStreamContext() *streamContext {
+	return &streamContext{done: make(chan struct{})}
+}
+
+func (c *streamContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (c *streamContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *streamContext) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+func (c *streamContext) Value(key interface{}) interface{} {
+	return nil
+}
+
+// cancel cancels the context.
+// Only the first call has an effect, such that Err returns the error that first caused the cancelation.
+func (c *streamContext) cancel(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err != nil {
+		return
+	}
+	if err == nil {
+		err = context.Canceled
+	}
+	c.err = err
+	close(c.done)
+}
@@ -0,0 +1,55 @@
+package quic
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stream Context", func() {
+	var ctx *streamContext
+
+	BeforeEach(func() {
+		ctx = newStreamContext()
+	})
+
+	It("doesn't have a deadline", func() {
+		_, ok := ctx.Deadline()
+		Expect(ok).To(BeFalse())
+	})
+
+	It("is not canceled initially", func() {
+		Expect(ctx.Done()).ToNot(BeClosed())
+		Expect(ctx.Err()).ToNot(HaveOccurred())
+	})
+
+	It("returns the error it was canceled with", func() {
+		testErr := errors.New("test error")
+		ctx.cancel(testErr)
+		Expect(ctx.Done()).To(BeClosed())
+		Expect(ctx.Err()).To(MatchError(testErr))
+	})
+
+	It("only uses the first error", func() {
+		testErr := errors.New("test error")
+		ctx.cancel(testErr)
+		ctx.cancel(errors.New("another error"))
+		Expect(ctx.Err()).To(MatchError(testErr))
+	})
+
+	It("uses context.Canceled if canceled without an error", func() {
+		ctx.cancel(nil)
+		Expect(ctx.Err()).To(MatchError(context.Canceled))
+	})
+
+	It("cancels derived contexts", func() {
+		testErr := errors.New("test error")
+		child, cancel := context.WithCancel(ctx)
+		defer cancel()
+		ctx.cancel(testErr)
+		Eventually(child.Done()).Should(BeClosed())
+		Expect(child.Err()).To(MatchError(testErr))
+	})
+})
@@ -12,6 +12,8 @@ type streamFrameSorter struct {
 	queuedFrames map[protocol.ByteCount]*wire.StreamFrame
 	readPosition protocol.ByteCount
 	gaps         *utils.ByteIntervalList
+	// the number of bytes of data held in queuedFrames
+	bufferedBytes protocol.ByteCount
 }
 
 var (
@@ -87,7 +89,10 @@ func (s *streamFrameSorter) Push(frame *wire.StreamFrame) error {
 			break
 		}
 		// delete queued frames completely covered by the current frame
-		delete(s.queuedFrames, endGap.Value.End)
+		if coveredFrame, ok := s.queuedFrames[endGap.Value.End]; ok {
+			s.bufferedBytes -= coveredFrame.DataLen()
+			delete(s.queuedFrames, endGap.Value.End)
+		}
 		endGap = nextEndGap
 	}
 
@@ -138,6 +143,7 @@ func (s *streamFrameSorter) Push(frame *wire.StreamFrame) error {
 	}
 
 	s.queuedFrames[frame.Offset] = frame
+	s.bufferedBytes += frame.DataLen()
 	return nil
 }
 
@@ -145,6 +151,7 @@ func (s *streamFrameSorter) Pop() *wire.StreamFrame {
 	frame := s.Head()
 	if frame != nil {
 		s.readPosition += frame.DataLen()
+		s.bufferedBytes -= frame.DataLen()
 		delete(s.queuedFrames, frame.Offset)
 	}
 	return frame
@@ -157,3 +164,58 @@ func (s *streamFrameSorter) Head() *wire.StreamFrame {
 	}
 	return nil
 }
+
+// Skip drops all data below offset, and moves the read position to offset.
+// It is used when the peer won't retransmit the data below offset (partial reliability).
+// A frame with the FIN bit is replaced by an empty frame at its end offset, so that the FIN can still be read.
+func (s *streamFrameSorter) Skip(offset protocol.ByteCount) {
+	if offset <= s.readPosition {
+		return
+	}
+	for frameOffset, frame := range s.queuedFrames {
+		if frameOffset >= offset {
+			continue
+		}
+		delete(s.queuedFrames, frameOffset)
+		end := frameOffset + frame.DataLen()
+		if end <= offset {
+			s.bufferedBytes -= frame.DataLen()
+			if frame.FinBit {
+				s.queuedFrames[end] = &wire.StreamFrame{StreamID: frame.StreamID, Offset: end, FinBit: true}
+			}
+			continue
+		}
+		cut := offset - frameOffset
+		s.bufferedBytes -= cut
+		frame.Data = frame.Data[cut:]
+		frame.Offset = offset
+		s.queuedFrames[offset] = frame
+	}
+
+	for gap := s.gaps.Front(); gap != nil; {
+		next := gap.Next()
+		if gap.Value.End > offset {
+			if gap.Value.Start < offset {
+				gap.Value.Start = offset
+			}
+			break
+		}
+		s.gaps.Remove(gap)
+		gap = next
+	}
+	s.readPosition = offset
+}
+
+// OutOfOrderDataLen returns the number of bytes buffered that can't be read yet,
+// because data at a lower offset is still missing.
+func (s *streamFrameSorter) OutOfOrderDataLen() protocol.ByteCount {
+	firstGap := s.gaps.Front()
+	if firstGap == nil || firstGap.Value.Start < s.readPosition {
+		return s.bufferedBytes
+	}
+	contiguous := firstGap.Value.Start - s.readPosition
+	if contiguous > s.bufferedBytes {
+		return 0
+	}
+	return s.bufferedBytes - contiguous
+}
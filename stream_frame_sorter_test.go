@@ -593,4 +593,95 @@ var _ = Describe("STREAM frame sorter", func() {
 			})
 		})
 	})
+
+	Context("skipping data", func() {
+		It("skips to a frame", func() {
+			Expect(s.Push(&wire.StreamFrame{Offset: 10, Data: []byte("foobar")})).To(Succeed())
+			Expect(s.Head()).To(BeNil())
+			s.Skip(10)
+			Expect(s.Head()).To(Equal(&wire.StreamFrame{Offset: 10, Data: []byte("foobar")}))
+			Expect(s.OutOfOrderDataLen()).To(BeZero())
+			checkGaps([]utils.ByteInterval{
+				{Start: 16, End: protocol.MaxByteCount},
+			})
+		})
+
+		It("drops frames below the offset, and cuts overlapping frames", func() {
+			Expect(s.Push(&wire.StreamFrame{Offset: 0, Data: []byte("foo")})).To(Succeed())
+			Expect(s.Push(&wire.StreamFrame{Offset: 5, Data: []byte("lorem")})).To(Succeed())
+			Expect(s.Push(&wire.StreamFrame{Offset: 12, Data: []byte("ipsum")})).To(Succeed())
+			s.Skip(7)
+			Expect(s.bufferedBytes).To(Equal(protocol.ByteCount(8)))
+			Expect(s.queuedFrames).To(HaveLen(2))
+			Expect(s.Pop()).To(Equal(&wire.StreamFrame{Offset: 7, Data: []byte("rem")}))
+			Expect(s.Head()).To(BeNil())
+			checkGaps([]utils.ByteInterval{
+				{Start: 10, End: 12},
+				{Start: 17, End: protocol.MaxByteCount},
+			})
+		})
+
+		It("shrinks a gap that starts below the offset", func() {
+			Expect(s.Push(&wire.StreamFrame{Offset: 10, Data: []byte("foobar")})).To(Succeed())
+			s.Skip(5)
+			Expect(s.Head()).To(BeNil())
+			checkGaps([]utils.ByteInterval{
+				{Start: 5, End: 10},
+				{Start: 16, End: protocol.MaxByteCount},
+			})
+			Expect(s.Push(&wire.StreamFrame{Offset: 0, Data: []byte("foobarfooba")})).To(Succeed())
+			Expect(s.Pop()).To(Equal(&wire.StreamFrame{Offset: 5, Data: []byte("rfoob")}))
+			Expect(s.Pop()).To(Equal(&wire.StreamFrame{Offset: 10, Data: []byte("foobar")}))
+		})
+
+		It("keeps the FIN", func() {
+			Expect(s.Push(&wire.StreamFrame{Offset: 3, Data: []byte("foobar"), FinBit: true})).To(Succeed())
+			s.Skip(9)
+			Expect(s.Pop()).To(Equal(&wire.StreamFrame{Offset: 9, FinBit: true}))
+		})
+
+		It("ignores offsets below the read position", func() {
+			Expect(s.Push(&wire.StreamFrame{Offset: 0, Data: []byte("foobar")})).To(Succeed())
+			Expect(s.Pop()).ToNot(BeNil())
+			s.Skip(3)
+			Expect(s.readPosition).To(Equal(protocol.ByteCount(6)))
+		})
+	})
+
+	Context("counting out-of-order data", func() {
+		It("doesn't count data that can be read", func() {
+			Expect(s.Push(&wire.StreamFrame{Offset: 0, Data: []byte("foobar")})).To(Succeed())
+			Expect(s.Push(&wire.StreamFrame{Offset: 6, Data: []byte("lorem")})).To(Succeed())
+			Expect(s.OutOfOrderDataLen()).To(BeZero())
+		})
+
+		It("counts data after a gap", func() {
+			Expect(s.Push(&wire.StreamFrame{Offset: 0, Data: []byte("foo")})).To(Succeed())
+			Expect(s.Push(&wire.StreamFrame{Offset: 10, Data: []byte("foobar")})).To(Succeed())
+			Expect(s.Push(&wire.StreamFrame{Offset: 20, Data: []byte("lorem")})).To(Succeed())
+			Expect(s.OutOfOrderDataLen()).To(Equal(protocol.ByteCount(11)))
+		})
+
+		It("stops counting data when the gap is filled", func() {
+			Expect(s.Push(&wire.StreamFrame{Offset: 6, Data: []byte("foobar")})).To(Succeed())
+			Expect(s.OutOfOrderDataLen()).To(Equal(protocol.ByteCount(6)))
+			Expect(s.Push(&wire.StreamFrame{Offset: 0, Data: []byte("lorem!")})).To(Succeed())
+			Expect(s.OutOfOrderDataLen()).To(BeZero())
+		})
+
+		It("doesn't count data that was popped", func() {
+			Expect(s.Push(&wire.StreamFrame{Offset: 0, Data: []byte("foobar")})).To(Succeed())
+			Expect(s.Push(&wire.StreamFrame{Offset: 10, Data: []byte("lorem")})).To(Succeed())
+			Expect(s.Pop()).ToNot(BeNil())
+			Expect(s.OutOfOrderDataLen()).To(Equal(protocol.ByteCount(5)))
+		})
+
+		It("doesn't double count frames that are covered by a new frame", func() {
+			Expect(s.Push(&wire.StreamFrame{Offset: 10, Data: []byte("foo")})).To(Succeed())
+			Expect(s.Push(&wire.StreamFrame{Offset: 15, Data: []byte("bar")})).To(Succeed())
+			Expect(s.OutOfOrderDataLen()).To(Equal(protocol.ByteCount(6)))
+			Expect(s.Push(&wire.StreamFrame{Offset: 8, Data: []byte("foobarfoobar")})).To(Succeed())
+			Expect(s.OutOfOrderDataLen()).To(Equal(protocol.ByteCount(12)))
+		})
+	})
 })
@@ -10,6 +10,7 @@ import (
 type streamFramer struct {
 	streamGetter streamGetter
 	cryptoStream cryptoStreamI
+	coalescing   StreamCoalescingPolicy
 	version      protocol.VersionNumber
 
 	streamQueueMutex    sync.Mutex
@@ -21,11 +22,13 @@ type streamFramer struct {
 func newStreamFramer(
 	cryptoStream cryptoStreamI,
 	streamGetter streamGetter,
+	coalescing StreamCoalescingPolicy,
 	v protocol.VersionNumber,
 ) *streamFramer {
 	return &streamFramer{
 		streamGetter:  streamGetter,
 		cryptoStream:  cryptoStream,
+		coalescing:    coalescing,
 		activeStreams: make(map[protocol.StreamID]struct{}),
 		version:       v,
 	}
@@ -71,6 +74,9 @@ func (f *streamFramer) PopStreamFrames(maxTotalLen protocol.ByteCount) []*wire.S
 		if maxTotalLen-currentLen < protocol.MinStreamFrameSize {
 			break
 		}
+		if f.coalescing == StreamCoalescingNone && len(frames) > 0 {
+			break
+		}
 		id := f.streamQueue[0]
 		f.streamQueue = f.streamQueue[1:]
 		// This should never return an error. Better check it anyway.
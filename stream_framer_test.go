@@ -31,7 +31,7 @@ var _ = Describe("Stream Framer", func() {
 		stream2 = NewMockSendStreamI(mockCtrl)
 		stream2.EXPECT().StreamID().Return(protocol.StreamID(6)).AnyTimes()
 		cryptoStream = NewMockCryptoStream(mockCtrl)
-		framer = newStreamFramer(cryptoStream, streamGetter, versionGQUICFrames)
+		framer = newStreamFramer(cryptoStream, streamGetter, StreamCoalescingAll, versionGQUICFrames)
 	})
 
 	Context("handling the crypto stream", func() {
@@ -153,6 +153,24 @@ var _ = Describe("Stream Framer", func() {
 			Expect(framer.PopStreamFrames(1000)).To(Equal([]*wire.StreamFrame{f1, f2}))
 		})
 
+		It("doesn't pop frames of multiple streams, if coalescing is disabled", func() {
+			framer.coalescing = StreamCoalescingNone
+			streamGetter.EXPECT().GetOrOpenSendStream(id1).Return(stream1, nil).Times(2)
+			streamGetter.EXPECT().GetOrOpenSendStream(id2).Return(stream2, nil)
+			f1 := &wire.StreamFrame{StreamID: id1, Data: []byte("foobar")}
+			f2 := &wire.StreamFrame{StreamID: id2, Data: []byte("raboof")}
+			f3 := &wire.StreamFrame{StreamID: id1, Data: []byte("lorem")}
+			stream1.EXPECT().popStreamFrame(gomock.Any()).Return(f1, true)
+			stream2.EXPECT().popStreamFrame(gomock.Any()).Return(f2, false)
+			stream1.EXPECT().popStreamFrame(gomock.Any()).Return(f3, false)
+			framer.AddActiveStream(id1)
+			framer.AddActiveStream(id2)
+			Expect(framer.PopStreamFrames(1000)).To(Equal([]*wire.StreamFrame{f1}))
+			Expect(framer.PopStreamFrames(1000)).To(Equal([]*wire.StreamFrame{f2}))
+			Expect(framer.PopStreamFrames(1000)).To(Equal([]*wire.StreamFrame{f3}))
+			Expect(framer.PopStreamFrames(1000)).To(BeEmpty())
+		})
+
 		It("returns multiple normal frames in the order they were reported active", func() {
 			streamGetter.EXPECT().GetOrOpenSendStream(id1).Return(stream1, nil)
 			streamGetter.EXPECT().GetOrOpenSendStream(id2).Return(stream2, nil)
@@ -0,0 +1,114 @@
+package quic
+
+import (
+	"fmt"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// The sendStreamState is the state of the send side of a stream.
+type sendStreamState uint8
+
+const (
+	// sendStreamStateOpen: the application can write data on the stream
+	sendStreamStateOpen sendStreamState = iota
+	// sendStreamStateClosed: Close was called, but the FIN was not sent yet
+	sendStreamStateClosed
+	// sendStreamStateFinSent: a STREAM frame with the FIN bit was sent
+	sendStreamStateFinSent
+	// sendStreamStateResetSent: the stream was canceled (by CancelWrite, or by a STOP_SENDING frame), and a RST_STREAM was queued
+	sendStreamStateResetSent
+	// sendStreamStateShutdown: the stream was closed because the session was closed
+	sendStreamStateShutdown
+)
+
+func (s sendStreamState) String() string {
+	switch s {
+	case sendStreamStateOpen:
+		return "open"
+	case sendStreamStateClosed:
+		return "closed"
+	case sendStreamStateFinSent:
+		return "FIN sent"
+	case sendStreamStateResetSent:
+		return "reset sent"
+	case sendStreamStateShutdown:
+		return "shut down"
+	default:
+		return fmt.Sprintf("unknown send stream state: %d", s)
+	}
+}
+
+// canTransitionTo says if the state can be changed to next.
+func (s sendStreamState) canTransitionTo(next sendStreamState) bool {
+	switch s {
+	case sendStreamStateOpen:
+		return next == sendStreamStateClosed || next == sendStreamStateResetSent || next == sendStreamStateShutdown
+	case sendStreamStateClosed:
+		return next == sendStreamStateFinSent || next == sendStreamStateShutdown
+	default: // all other states are terminal
+		return false
+	}
+}
+
+// The receiveStreamState is the state of the receive side of a stream.
+type receiveStreamState uint8
+
+const (
+	// receiveStreamStateOpen: the application can read data from the stream
+	receiveStreamStateOpen receiveStreamState = iota
+	// receiveStreamStateDataRead: the application has read all data, up to the FIN
+	receiveStreamStateDataRead
+	// receiveStreamStateCanceled: CancelRead was called
+	receiveStreamStateCanceled
+	// receiveStreamStateCanceledFinReceived: CancelRead was called, and the FIN was received.
+	// The remaining data will never be read.
+	receiveStreamStateCanceledFinReceived
+	// receiveStreamStateResetReceived: a RST_STREAM was received
+	receiveStreamStateResetReceived
+	// receiveStreamStateShutdown: the stream was closed because the session was closed
+	receiveStreamStateShutdown
+)
+
+func (s receiveStreamState) String() string {
+	switch s {
+	case receiveStreamStateOpen:
+		return "open"
+	case receiveStreamStateDataRead:
+		return "data read"
+	case receiveStreamStateCanceled:
+		return "canceled"
+	case receiveStreamStateCanceledFinReceived:
+		return "canceled, FIN received"
+	case receiveStreamStateResetReceived:
+		return "reset received"
+	case receiveStreamStateShutdown:
+		return "shut down"
+	default:
+		return fmt.Sprintf("unknown receive stream state: %d", s)
+	}
+}
+
+// canTransitionTo says if the state can be changed to next.
+func (s receiveStreamState) canTransitionTo(next receiveStreamState) bool {
+	switch s {
+	case receiveStreamStateOpen:
+		return next != receiveStreamStateOpen && next != receiveStreamStateCanceledFinReceived
+	case receiveStreamStateCanceled:
+		// Even after CancelRead, the peer might still reset the stream.
+		// A Read that was running concurrently with CancelRead might also still read the FIN.
+		return next == receiveStreamStateDataRead || next == receiveStreamStateCanceledFinReceived || next == receiveStreamStateResetReceived || next == receiveStreamStateShutdown
+	default: // all other states are terminal
+		return false
+	}
+}
+
+// A streamStateTransitionError occurs when trying to move a stream half into a state that is not reachable from its current state.
+type streamStateTransitionError struct {
+	streamID protocol.StreamID
+	from, to fmt.Stringer
+}
+
+func (e *streamStateTransitionError) Error() string {
+	return fmt.Sprintf("stream %d: invalid state transition from %s to %s", e.streamID, e.from, e.to)
+}
@@ -0,0 +1,108 @@
+package quic
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stream States", func() {
+	Context("send stream", func() {
+		allStates := []sendStreamState{
+			sendStreamStateOpen,
+			sendStreamStateClosed,
+			sendStreamStateFinSent,
+			sendStreamStateResetSent,
+			sendStreamStateShutdown,
+		}
+
+		validTransitions := map[sendStreamState][]sendStreamState{
+			sendStreamStateOpen:   {sendStreamStateClosed, sendStreamStateResetSent, sendStreamStateShutdown},
+			sendStreamStateClosed: {sendStreamStateFinSent, sendStreamStateShutdown},
+		}
+
+		It("has a string representation", func() {
+			Expect(sendStreamStateOpen.String()).To(Equal("open"))
+			Expect(sendStreamStateClosed.String()).To(Equal("closed"))
+			Expect(sendStreamStateFinSent.String()).To(Equal("FIN sent"))
+			Expect(sendStreamStateResetSent.String()).To(Equal("reset sent"))
+			Expect(sendStreamStateShutdown.String()).To(Equal("shut down"))
+			Expect(sendStreamState(42).String()).To(Equal("unknown send stream state: 42"))
+		})
+
+		It("only allows valid transitions", func() {
+			for _, from := range allStates {
+				for _, to := range allStates {
+					Expect(from.canTransitionTo(to)).To(Equal(containsSendStreamState(validTransitions[from], to)), "transition from %s to %s", from, to)
+				}
+			}
+		})
+
+		It("returns an error for invalid transitions", func() {
+			str := newSendStream(1337, nil, nil, versionIETFFrames)
+			str.state = sendStreamStateFinSent
+			err := str.transitionTo(sendStreamStateResetSent)
+			Expect(err).To(MatchError("stream 1337: invalid state transition from FIN sent to reset sent"))
+			Expect(str.state).To(Equal(sendStreamStateFinSent))
+		})
+	})
+
+	Context("receive stream", func() {
+		allStates := []receiveStreamState{
+			receiveStreamStateOpen,
+			receiveStreamStateDataRead,
+			receiveStreamStateCanceled,
+			receiveStreamStateCanceledFinReceived,
+			receiveStreamStateResetReceived,
+			receiveStreamStateShutdown,
+		}
+
+		validTransitions := map[receiveStreamState][]receiveStreamState{
+			receiveStreamStateOpen:     {receiveStreamStateDataRead, receiveStreamStateCanceled, receiveStreamStateResetReceived, receiveStreamStateShutdown},
+			receiveStreamStateCanceled: {receiveStreamStateDataRead, receiveStreamStateCanceledFinReceived, receiveStreamStateResetReceived, receiveStreamStateShutdown},
+		}
+
+		It("has a string representation", func() {
+			Expect(receiveStreamStateOpen.String()).To(Equal("open"))
+			Expect(receiveStreamStateDataRead.String()).To(Equal("data read"))
+			Expect(receiveStreamStateCanceled.String()).To(Equal("canceled"))
+			Expect(receiveStreamStateCanceledFinReceived.String()).To(Equal("canceled, FIN received"))
+			Expect(receiveStreamStateResetReceived.String()).To(Equal("reset received"))
+			Expect(receiveStreamStateShutdown.String()).To(Equal("shut down"))
+			Expect(receiveStreamState(42).String()).To(Equal("unknown receive stream state: 42"))
+		})
+
+		It("only allows valid transitions", func() {
+			for _, from := range allStates {
+				for _, to := range allStates {
+					Expect(from.canTransitionTo(to)).To(Equal(containsReceiveStreamState(validTransitions[from], to)), "transition from %s to %s", from, to)
+				}
+			}
+		})
+
+		It("returns an error for invalid transitions", func() {
+			str := newReceiveStream(1337, nil, nil, nil, versionIETFFrames)
+			str.state = receiveStreamStateDataRead
+			err := str.transitionTo(receiveStreamStateResetReceived)
+			Expect(err).To(MatchError("stream 1337: invalid state transition from data read to reset received"))
+			Expect(str.state).To(Equal(receiveStreamStateDataRead))
+		})
+	})
+})
+
+func containsSendStreamState(states []sendStreamState, s sendStreamState) bool {
+	for _, state := range states {
+		if state == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsReceiveStreamState(states []receiveStreamState, s receiveStreamState) bool {
+	for _, state := range states {
+		if state == s {
+			return true
+		}
+	}
+	return false
+}
@@ -39,7 +39,7 @@ var _ = Describe("Stream", func() {
 	BeforeEach(func() {
 		mockSender = NewMockStreamSender(mockCtrl)
 		mockFC = mocks.NewMockStreamFlowController(mockCtrl)
-		str = newStream(streamID, mockSender, mockFC, protocol.VersionWhatever)
+		str = newStream(streamID, mockSender, mockFC, nil, protocol.VersionWhatever)
 
 		timeout := scaleDuration(250 * time.Millisecond)
 		strWithTimeout = struct {
@@ -93,6 +93,8 @@ var _ = Describe("Stream", func() {
 				err := str.handleRstStreamFrame(f)
 				Expect(err).ToNot(HaveOccurred())
 				Eventually(writeReturned).Should(BeClosed())
+				Expect(str.Context().Done()).To(BeClosed())
+				Expect(str.Context().Err()).To(MatchError("Stream 1337 was reset with error code 123"))
 			})
 
 			It("unblocks Write when receiving a RST_STREAM frame with error code 0", func() {
@@ -165,6 +167,19 @@ var _ = Describe("Stream", func() {
 				Expect(err).ToNot(HaveOccurred())
 				Expect(str.Close()).To(Succeed())
 			})
+
+			It("cancels the context when receiving a RST_STREAM frame", func() {
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), true)
+				err := str.handleRstStreamFrame(&wire.RstStreamFrame{
+					StreamID:   streamID,
+					ByteOffset: 6,
+					ErrorCode:  123,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(str.Context().Done()).To(BeClosed())
+				Expect(str.Context().Err()).To(BeAssignableToTypeOf(streamCanceledError{}))
+				Expect(str.Context().Err()).To(MatchError("Stream 1337 was reset with error code 123"))
+			})
 		})
 	})
 
@@ -189,6 +204,42 @@ var _ = Describe("Stream", func() {
 		})
 	})
 
+	It("combines the statistics of both stream halves", func() {
+		mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+		err := str.handleStreamFrame(&wire.StreamFrame{
+			StreamID: streamID,
+			Data:     []byte("foobar"),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		str.addRetransmittedBytes(42)
+		stats := str.Stats()
+		Expect(stats.BytesReceived).To(BeEquivalentTo(6))
+		Expect(stats.FramesReceived).To(BeEquivalentTo(1))
+		Expect(stats.BytesRetransmitted).To(BeEquivalentTo(42))
+	})
+
+	It("combines the records of both stream halves", func() {
+		mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+		err := str.handleStreamFrame(&wire.StreamFrame{
+			StreamID: streamID,
+			Data:     []byte("foobar"),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true)
+		err = str.handleRstStreamFrame(&wire.RstStreamFrame{
+			StreamID:   streamID,
+			ByteOffset: 42,
+			ErrorCode:  1234,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		r := str.record()
+		Expect(r.StreamID).To(Equal(streamID))
+		Expect(r.Stats.BytesReceived).To(BeEquivalentTo(6))
+		Expect(r.ReadReset).To(BeTrue())
+		Expect(r.ReadResetCode).To(BeEquivalentTo(1234))
+		Expect(r.WriteReset).To(BeFalse())
+	})
+
 	Context("completing", func() {
 		It("is not completed when only the receive side is completed", func() {
 			// don't EXPECT a call to mockSender.onStreamCompleted()
@@ -23,6 +23,7 @@ type streamsMap struct {
 
 	sender            streamSender
 	newFlowController func(protocol.StreamID) flowcontrol.StreamFlowController
+	reassembly        *reassemblyLimiter
 
 	outgoingBidiStreams *outgoingBidiStreamsMap
 	outgoingUniStreams  *outgoingUniStreamsMap
@@ -35,6 +36,7 @@ var _ streamManager = &streamsMap{}
 func newStreamsMap(
 	sender streamSender,
 	newFlowController func(protocol.StreamID) flowcontrol.StreamFlowController,
+	reassembly *reassemblyLimiter,
 	maxIncomingStreams int,
 	maxIncomingUniStreams int,
 	perspective protocol.Perspective,
@@ -43,6 +45,7 @@ func newStreamsMap(
 	m := &streamsMap{
 		perspective:       perspective,
 		newFlowController: newFlowController,
+		reassembly:        reassembly,
 		sender:            sender,
 	}
 	var firstOutgoingBidiStream, firstOutgoingUniStream, firstIncomingBidiStream, firstIncomingUniStream protocol.StreamID
@@ -58,13 +61,19 @@ func newStreamsMap(
 		firstIncomingUniStream = 3
 	}
 	newBidiStream := func(id protocol.StreamID) streamI {
-		return newStream(id, m.sender, m.newFlowController(id), version)
+		str := newStream(id, m.sender, m.newFlowController(id), m.reassembly, version)
+		m.sender.onStreamOpened(str)
+		return str
 	}
 	newUniSendStream := func(id protocol.StreamID) sendStreamI {
-		return newSendStream(id, m.sender, m.newFlowController(id), version)
+		str := newSendStream(id, m.sender, m.newFlowController(id), version)
+		m.sender.onStreamOpened(str)
+		return str
 	}
 	newUniReceiveStream := func(id protocol.StreamID) receiveStreamI {
-		return newReceiveStream(id, m.sender, m.newFlowController(id), version)
+		str := newReceiveStream(id, m.sender, m.newFlowController(id), m.reassembly, version)
+		m.sender.onStreamOpened(str)
+		return str
 	}
 	m.outgoingBidiStreams = newOutgoingBidiStreamsMap(
 		firstOutgoingBidiStream,
@@ -159,6 +168,13 @@ func (m *streamsMap) DeleteStream(id protocol.StreamID) error {
 	}
 }
 
+func (m *streamsMap) NumStreams() int {
+	return m.incomingBidiStreams.NumStreams() +
+		m.outgoingBidiStreams.NumStreams() +
+		m.incomingUniStreams.NumStreams() +
+		m.outgoingUniStreams.NumStreams()
+}
+
 func (m *streamsMap) GetOrOpenReceiveStream(id protocol.StreamID) (receiveStreamI, error) {
 	switch m.getStreamType(id) {
 	case streamTypeOutgoingBidi:
@@ -7,6 +7,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/wire"
+	"github.com/lucas-clemente/quic-go/qerr"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -83,7 +84,7 @@ var _ = Describe("Streams Map (incoming)", func() {
 
 	It("errors when trying to get a stream ID higher than the maximum", func() {
 		_, err := m.GetOrOpenStream(initialMaxStream + 4)
-		Expect(err).To(MatchError(fmt.Errorf("peer tried to open stream %d (current limit: %d)", initialMaxStream+4, initialMaxStream)))
+		Expect(err).To(MatchError(qerr.Error(qerr.TooManyOpenStreams, fmt.Sprintf("peer tried to open stream %d (current limit: %d)", initialMaxStream+4, initialMaxStream))))
 	})
 
 	It("blocks AcceptStream until a new stream is available", func() {
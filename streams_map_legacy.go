@@ -237,6 +237,12 @@ func (m *streamsMapLegacy) DeleteStream(id protocol.StreamID) error {
 	return nil
 }
 
+func (m *streamsMapLegacy) NumStreams() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return len(m.streams)
+}
+
 func (m *streamsMapLegacy) putStream(s streamI) error {
 	id := s.StreamID()
 	if _, ok := m.streams[id]; ok {
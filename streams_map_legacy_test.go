@@ -523,6 +523,7 @@ var _ = Describe("Streams Map (for gQUIC)", func() {
 			Expect(m.streams).To(HaveLen(1))
 			Expect(m.streams).To(HaveKey(protocol.StreamID(5)))
 			Expect(m.numIncomingStreams).To(BeEquivalentTo(1))
+			Expect(m.NumStreams()).To(Equal(1))
 		})
 
 		It("deletes an outgoing stream", func() {
@@ -71,7 +71,8 @@ var _ = Describe("Streams Map (for IETF QUIC)", func() {
 
 			BeforeEach(func() {
 				mockSender = NewMockStreamSender(mockCtrl)
-				m = newStreamsMap(mockSender, newFlowController, maxBidiStreams, maxUniStreams, perspective, versionIETFFrames).(*streamsMap)
+				mockSender.EXPECT().onStreamOpened(gomock.Any()).AnyTimes()
+				m = newStreamsMap(mockSender, newFlowController, nil, maxBidiStreams, maxUniStreams, perspective, versionIETFFrames).(*streamsMap)
 			})
 
 			Context("opening", func() {
@@ -169,6 +170,22 @@ var _ = Describe("Streams Map (for IETF QUIC)", func() {
 					Expect(err).ToNot(HaveOccurred())
 					Expect(dstr).To(BeNil())
 				})
+
+				It("counts the streams", func() {
+					Expect(m.NumStreams()).To(BeZero())
+					_, err := m.OpenStream()
+					Expect(err).ToNot(HaveOccurred())
+					_, err = m.OpenUniStream()
+					Expect(err).ToNot(HaveOccurred())
+					_, err = m.GetOrOpenReceiveStream(ids.firstIncomingBidiStream)
+					Expect(err).ToNot(HaveOccurred())
+					_, err = m.GetOrOpenReceiveStream(ids.firstIncomingUniStream)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(m.NumStreams()).To(Equal(4))
+					Expect(m.DeleteStream(ids.firstOutgoingBidiStream)).To(Succeed())
+					Expect(m.DeleteStream(ids.firstIncomingUniStream)).To(Succeed())
+					Expect(m.NumStreams()).To(Equal(2))
+				})
 			})
 
 			Context("getting streams", func() {
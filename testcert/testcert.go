@@ -0,0 +1,166 @@
+// Package testcert generates self-signed certificate chains for testing.
+// The certificates can be used with both gQUIC and IETF QUIC (TLS).
+package testcert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/crypto"
+)
+
+// Validity is the duration that generated certificates are valid for.
+const Validity = 7 * 24 * time.Hour
+
+// A Chain is a certificate chain for testing.
+// It consists of a self-signed root CA, an intermediate CA, and a leaf certificate.
+type Chain struct {
+	// Root is the self-signed root CA.
+	Root *x509.Certificate
+	// Intermediate is the intermediate CA, signed by the Root.
+	Intermediate *x509.Certificate
+	// Leaf is the certificate of the server, signed by the Intermediate.
+	Leaf *x509.Certificate
+	// Certificate contains the leaf and the intermediate certificate, and the private key of the leaf.
+	// This is the chain that is sent by the server.
+	Certificate tls.Certificate
+}
+
+// Generate generates a new certificate chain.
+// The leaf certificate is valid for all hostnames, which may either be DNS names or IP addresses.
+// Clients that dial an IP address (e.g. "127.0.0.1:1234") verify the certificate for that IP address.
+func Generate(hostnames ...string) (*Chain, error) {
+	if len(hostnames) == 0 {
+		return nil, errors.New("testcert: no hostnames")
+	}
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	rootTemplate := newTemplate("quic-go test root CA")
+	rootTemplate.IsCA = true
+	rootTemplate.KeyUsage = x509.KeyUsageCertSign
+	root, err := createCertificate(rootTemplate, rootTemplate, rootKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+
+	intermediateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	intermediateTemplate := newTemplate("quic-go test intermediate CA")
+	intermediateTemplate.IsCA = true
+	intermediateTemplate.KeyUsage = x509.KeyUsageCertSign
+	intermediate, err := createCertificate(intermediateTemplate, root, intermediateKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	leafTemplate := newTemplate(hostnames[0])
+	leafTemplate.KeyUsage = x509.KeyUsageDigitalSignature
+	leafTemplate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, h := range hostnames {
+		if ip := net.ParseIP(h); ip != nil {
+			leafTemplate.IPAddresses = append(leafTemplate.IPAddresses, ip)
+		} else {
+			leafTemplate.DNSNames = append(leafTemplate.DNSNames, h)
+		}
+	}
+	leaf, err := createCertificate(leafTemplate, intermediate, leafKey, intermediateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Chain{
+		Root:         root,
+		Intermediate: intermediate,
+		Leaf:         leaf,
+		Certificate: tls.Certificate{
+			Certificate: [][]byte{leaf.Raw, intermediate.Raw},
+			PrivateKey:  leafKey,
+			Leaf:        leaf,
+		},
+	}, nil
+}
+
+func newTemplate(commonName string) *x509.Certificate {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		panic(err)
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-time.Hour), // allow for some clock skew
+		NotAfter:              now.Add(Validity),
+		BasicConstraintsValid: true,
+	}
+}
+
+func createCertificate(template, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// CertPool returns a certificate pool containing the root CA.
+func (c *Chain) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.Root)
+	return pool
+}
+
+// ServerTLSConfig returns a tls.Config for a server.
+func (c *Chain) ServerTLSConfig() *tls.Config {
+	return &tls.Config{Certificates: []tls.Certificate{c.Certificate}}
+}
+
+// ClientTLSConfig returns a tls.Config for a client, that trusts the root CA.
+func (c *Chain) ClientTLSConfig() *tls.Config {
+	return &tls.Config{RootCAs: c.CertPool()}
+}
+
+// Verify verifies that the certificate chain is accepted by a client connecting to hostname.
+// It performs the same steps as a gQUIC handshake:
+// the chain is compressed by the server, decompressed and verified by the client,
+// and a server proof signed by the server is verified using the leaf certificate.
+func (c *Chain) Verify(hostname string) error {
+	certChain := crypto.NewCertChain(c.ServerTLSConfig())
+	data, err := certChain.GetCertsCompressed(hostname, nil, nil)
+	if err != nil {
+		return err
+	}
+	certManager := crypto.NewCertManager(c.ClientTLSConfig())
+	if err := certManager.SetData(data); err != nil {
+		return err
+	}
+	if err := certManager.Verify(hostname); err != nil {
+		return err
+	}
+	chlo := []byte("client hello")
+	serverConfig := []byte("server config")
+	proof, err := certChain.SignServerProof(hostname, chlo, serverConfig)
+	if err != nil {
+		return err
+	}
+	if !certManager.VerifyServerProof(proof, chlo, serverConfig) {
+		return errors.New("testcert: invalid server proof")
+	}
+	return nil
+}
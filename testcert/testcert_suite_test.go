@@ -0,0 +1,13 @@
+package testcert
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestTestcert(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Testcert Suite")
+}
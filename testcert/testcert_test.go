@@ -0,0 +1,55 @@
+package testcert
+
+import (
+	"crypto/x509"
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test certificates", func() {
+	It("errors if no hostname is given", func() {
+		_, err := Generate()
+		Expect(err).To(MatchError("testcert: no hostnames"))
+	})
+
+	It("generates a chain", func() {
+		chain, err := Generate("quic.clemente.io", "127.0.0.1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(chain.Leaf.DNSNames).To(Equal([]string{"quic.clemente.io"}))
+		Expect(chain.Leaf.IPAddresses).To(HaveLen(1))
+		Expect(chain.Leaf.IPAddresses[0].Equal(net.IPv4(127, 0, 0, 1))).To(BeTrue())
+		Expect(chain.Certificate.Certificate).To(Equal([][]byte{chain.Leaf.Raw, chain.Intermediate.Raw}))
+		Expect(chain.Leaf.CheckSignatureFrom(chain.Intermediate)).To(Succeed())
+		Expect(chain.Intermediate.CheckSignatureFrom(chain.Root)).To(Succeed())
+		Expect(chain.ServerTLSConfig().Certificates).To(HaveLen(1))
+		Expect(chain.ClientTLSConfig().RootCAs).ToNot(BeNil())
+	})
+
+	It("verifies a chain", func() {
+		chain, err := Generate("quic.clemente.io", "127.0.0.1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(chain.Verify("quic.clemente.io")).To(Succeed())
+		Expect(chain.Verify("127.0.0.1")).To(Succeed())
+	})
+
+	It("rejects a hostname that the chain is not valid for", func() {
+		chain, err := Generate("quic.clemente.io")
+		Expect(err).ToNot(HaveOccurred())
+		err = chain.Verify("example.com")
+		Expect(err).To(HaveOccurred())
+		Expect(err).To(BeAssignableToTypeOf(x509.HostnameError{}))
+	})
+
+	It("doesn't trust the root of a different chain", func() {
+		chain1, err := Generate("quic.clemente.io")
+		Expect(err).ToNot(HaveOccurred())
+		chain2, err := Generate("quic.clemente.io")
+		Expect(err).ToNot(HaveOccurred())
+		chain1.Root = chain2.Root
+		err = chain1.Verify("quic.clemente.io")
+		Expect(err).To(HaveOccurred())
+		Expect(err).To(BeAssignableToTypeOf(x509.UnknownAuthorityError{}))
+	})
+})
@@ -0,0 +1,291 @@
+package quic
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+// A packetReceiver handles the packets that a Transport reads from its net.PacketConn.
+// It is implemented by the client and by the server.
+type packetReceiver interface {
+	handlePacket(remoteAddr net.Addr, packet []byte, buffer *[]byte, info packetInfo) error
+	// closeWithError is called when reading from the net.PacketConn fails.
+	// When the Transport is closed, it is called with a nil error.
+	closeWithError(error)
+}
+
+var (
+	errTransportClosed = errors.New("transport closed")
+	errListenerClosed  = errors.New("listener closed")
+)
+
+// A Transport multiplexes QUIC connections over a single net.PacketConn.
+// Any number of outgoing connections (see Dial) and one Listener (see Listen) can share the net.PacketConn.
+// Incoming packets are demultiplexed by their destination connection ID.
+// All connections need to use the same connection ID length (see Config.ConnectionIDLength).
+// Warning: This API should not be considered stable and might change soon.
+type Transport struct {
+	mutex sync.Mutex
+
+	conn      net.PacketConn
+	connIDLen int // 0 until the first connection was dialed, or the Listener was created
+
+	// clients are the dialed connections, by their connection IDs.
+	// A nil value means that the connection ID was recently retired.
+	// Late packets for these connection IDs are dropped.
+	clients map[string]packetReceiver
+	// resetTokens are the stateless reset tokens issued to the dialed connections, see addResetToken.
+	resetTokens map[[16]byte]packetReceiver
+	listener    packetReceiver
+
+	deleteRetiredConnIDsAfter time.Duration
+
+	closed    bool
+	runDone   chan struct{}
+	closeOnce sync.Once
+
+	logger utils.Logger
+}
+
+// NewTransport creates a new Transport.
+// It starts reading from the net.PacketConn immediately.
+// The quic.Config is only used to increase the socket buffers of the net.PacketConn (see Config.ReceiveBufferSize and Config.SendBufferSize).
+// The socket buffer options in the configs passed to Dial and Listen are ignored. The quic.Config may be nil.
+// Warning: This API should not be considered stable and might change soon.
+func NewTransport(conn net.PacketConn, config *Config) *Transport {
+	setSocketBuffers(conn, populateClientConfig(config))
+	t := &Transport{
+		conn:                      wrapConn(conn),
+		clients:                   make(map[string]packetReceiver),
+		resetTokens:               make(map[[16]byte]packetReceiver),
+		deleteRetiredConnIDsAfter: protocol.ClosedSessionDeleteTimeout,
+		runDone:                   make(chan struct{}),
+		logger:                    utils.DefaultLogger.WithPrefix("transport"),
+	}
+	go t.run()
+	return t
+}
+
+// Dial establishes a new QUIC connection to a server.
+// The host parameter is used for SNI.
+func (t *Transport) Dial(remoteAddr net.Addr, host string, tlsConf *tls.Config, config *Config) (Session, error) {
+	return t.DialContext(context.Background(), remoteAddr, host, tlsConf, config)
+}
+
+// DialContext establishes a new QUIC connection to a server, using the provided context.
+// The host parameter is used for SNI.
+func (t *Transport) DialContext(ctx context.Context, remoteAddr net.Addr, host string, tlsConf *tls.Config, config *Config) (Session, error) {
+	return dial(ctx, t.conn, remoteAddr, host, tlsConf, config, t, false)
+}
+
+// DialAddr establishes a new QUIC connection to a server.
+// The hostname for SNI is taken from the given address.
+func (t *Transport) DialAddr(addr string, tlsConf *tls.Config, config *Config) (Session, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return t.Dial(udpAddr, addr, tlsConf, config)
+}
+
+// Listen creates a Listener that accepts QUIC connections on the net.PacketConn of the Transport.
+// A Transport can only have a single Listener at a time.
+// The tls.Config must not be nil, the quic.Config may be nil.
+func (t *Transport) Listen(tlsConf *tls.Config, config *Config) (Listener, error) {
+	s, err := newServer(t.conn, tlsConf, config, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.checkConfig(s.config); err != nil {
+		return nil, err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return nil, errTransportClosed
+	}
+	if t.listener != nil {
+		return nil, errors.New("the Transport already has a Listener")
+	}
+	s.transport = t
+	t.listener = s
+	return s, nil
+}
+
+// Close closes all connections and the Listener, and then closes the net.PacketConn.
+func (t *Transport) Close() error {
+	t.mutex.Lock()
+	if t.closed {
+		t.mutex.Unlock()
+		return nil
+	}
+	t.closed = true
+	t.mutex.Unlock()
+
+	// close all connections before closing the net.PacketConn, so that they can still send a CONNECTION_CLOSE
+	t.closeReceivers(nil)
+	err := t.conn.Close()
+	<-t.runDone
+	return err
+}
+
+// checkConfig checks that a connection can use this Transport.
+// It must be called with a populated config.
+func (t *Transport) checkConfig(config *Config) error {
+	if config.RequestConnectionIDOmission {
+		return errors.New("connections using a Transport can't request the omission of the connection ID")
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return errTransportClosed
+	}
+	if t.connIDLen == 0 {
+		t.connIDLen = config.ConnectionIDLength
+		return nil
+	}
+	if config.ConnectionIDLength != t.connIDLen {
+		return fmt.Errorf("all connections using a Transport must use the same connection ID length (%d bytes)", t.connIDLen)
+	}
+	return nil
+}
+
+func (t *Transport) addClient(connID protocol.ConnectionID, c packetReceiver) {
+	t.mutex.Lock()
+	t.clients[string(connID)] = c
+	t.mutex.Unlock()
+}
+
+func (t *Transport) removeClient(connID protocol.ConnectionID) {
+	t.mutex.Lock()
+	t.clients[string(connID)] = nil
+	t.mutex.Unlock()
+
+	time.AfterFunc(t.deleteRetiredConnIDsAfter, func() {
+		t.mutex.Lock()
+		// the connection ID might have been added again in the mean time, e.g. after a Retry
+		if c, ok := t.clients[string(connID)]; ok && c == nil {
+			delete(t.clients, string(connID))
+		}
+		t.mutex.Unlock()
+	})
+}
+
+// addResetToken adds a stateless reset token issued by the server to a dialed connection.
+// Packets ending with the token are passed to that connection.
+func (t *Transport) addResetToken(token [16]byte, c packetReceiver) {
+	t.mutex.Lock()
+	t.resetTokens[token] = c
+	t.mutex.Unlock()
+}
+
+func (t *Transport) removeResetToken(token [16]byte, c packetReceiver) {
+	t.mutex.Lock()
+	if t.resetTokens[token] == c {
+		delete(t.resetTokens, token)
+	}
+	t.mutex.Unlock()
+}
+
+func (t *Transport) removeListener(s packetReceiver) {
+	t.mutex.Lock()
+	if t.listener == s {
+		t.listener = nil
+	}
+	t.mutex.Unlock()
+}
+
+func (t *Transport) run() {
+	defer close(t.runDone)
+	r := newPacketReader(t.conn)
+	for {
+		buf, remoteAddr, info, err := r.ReadPacket()
+		if err != nil {
+			t.closeReceivers(err)
+			return
+		}
+		if err := t.handlePacket(remoteAddr, *buf, buf, info); err != nil {
+			t.logger.Errorf("error handling packet: %s", err.Error())
+		}
+	}
+}
+
+func (t *Transport) handlePacket(remoteAddr net.Addr, packet []byte, buffer *[]byte, info packetInfo) error {
+	receiver, ok := t.getReceiver(packet)
+	if !ok || receiver == nil {
+		if buffer != nil {
+			putPacketBuffer(buffer)
+		}
+		if !ok {
+			return fmt.Errorf("dropping packet from %s: no connection to handle it", remoteAddr)
+		}
+		// late packet for a connection that was recently closed
+		return nil
+	}
+	return receiver.handlePacket(remoteAddr, packet, buffer, info)
+}
+
+// getReceiver returns the receiver for a packet.
+// Packets for the dialed connections are identified by the destination connection ID.
+// All other packets are passed to the Listener.
+func (t *Transport) getReceiver(packet []byte) (packetReceiver, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.clients) > 0 {
+		hdr, err := wire.ParseHeaderSentByServer(bytes.NewReader(packet), t.connIDLen)
+		if err == nil {
+			if c, ok := t.clients[string(hdr.DestConnectionID)]; ok {
+				return c, true
+			}
+			// A Stateless Reset looks like a Short Header packet with a random connection ID.
+			if !hdr.IsPublicHeader && !hdr.IsLongHeader && len(packet) >= 16 {
+				var token [16]byte
+				copy(token[:], packet[len(packet)-16:])
+				if c, ok := t.resetTokens[token]; ok {
+					return c, true
+				}
+			}
+		}
+	}
+	if t.listener != nil {
+		return t.listener, true
+	}
+	return nil, false
+}
+
+func (t *Transport) closeReceivers(err error) {
+	t.closeOnce.Do(func() {
+		t.mutex.Lock()
+		receivers := make(map[packetReceiver]struct{})
+		for _, c := range t.clients {
+			if c != nil {
+				receivers[c] = struct{}{}
+			}
+		}
+		if t.listener != nil {
+			receivers[t.listener] = struct{}{}
+		}
+		t.mutex.Unlock()
+
+		var wg sync.WaitGroup
+		for r := range receivers {
+			wg.Add(1)
+			go func(r packetReceiver) {
+				r.closeWithError(err)
+				wg.Done()
+			}(r)
+		}
+		wg.Wait()
+	})
+}
@@ -0,0 +1,233 @@
+package quic
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Transport", func() {
+	var (
+		t          *Transport
+		packetConn *mockPacketConn
+	)
+
+	getPacket := func(connID protocol.ConnectionID) []byte {
+		buf := &bytes.Buffer{}
+		err := (&wire.Header{
+			DestConnectionID: connID,
+			SrcConnectionID:  connID,
+			PacketNumber:     1,
+			PacketNumberLen:  protocol.PacketNumberLen1,
+		}).Write(buf, protocol.PerspectiveServer, versionGQUICFrames)
+		Expect(err).ToNot(HaveOccurred())
+		return append(buf.Bytes(), []byte("foobar")...)
+	}
+
+	BeforeEach(func() {
+		packetConn = newMockPacketConn()
+		packetConn.addr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}
+		packetConn.dataReadFrom = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 4321}
+		t = NewTransport(packetConn, nil)
+	})
+
+	AfterEach(func() {
+		// don't close the mocked receivers
+		t.mutex.Lock()
+		t.clients = make(map[string]packetReceiver)
+		t.listener = nil
+		t.mutex.Unlock()
+		packetConn.Close()
+		Eventually(t.runDone).Should(BeClosed())
+	})
+
+	Context("checking the config", func() {
+		It("uses the connection ID length of the first connection", func() {
+			Expect(t.checkConfig(&Config{ConnectionIDLength: 6})).To(Succeed())
+			Expect(t.checkConfig(&Config{ConnectionIDLength: 6})).To(Succeed())
+			Expect(t.checkConfig(&Config{ConnectionIDLength: 8})).To(MatchError("all connections using a Transport must use the same connection ID length (6 bytes)"))
+		})
+
+		It("rejects connections that request the omission of the connection ID", func() {
+			err := t.checkConfig(&Config{ConnectionIDLength: 8, RequestConnectionIDOmission: true})
+			Expect(err).To(MatchError("connections using a Transport can't request the omission of the connection ID"))
+		})
+
+		It("rejects connections after it was closed", func() {
+			Expect(t.Close()).To(Succeed())
+			Expect(t.checkConfig(&Config{ConnectionIDLength: 8})).To(MatchError(errTransportClosed))
+		})
+	})
+
+	Context("demultiplexing packets", func() {
+		BeforeEach(func() {
+			Expect(t.checkConfig(&Config{ConnectionIDLength: 8})).To(Succeed())
+		})
+
+		It("passes packets to the client by connection ID", func() {
+			connID1 := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+			connID2 := protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}
+			client1 := NewMockPacketReceiver(mockCtrl)
+			client2 := NewMockPacketReceiver(mockCtrl)
+			t.addClient(connID1, client1)
+			t.addClient(connID2, client2)
+			packet := getPacket(connID2)
+			handled := make(chan struct{})
+			client2.EXPECT().handlePacket(packetConn.dataReadFrom, packet, gomock.Any(), packetInfo{}).Do(func(net.Addr, []byte, *[]byte, packetInfo) { close(handled) })
+			packetConn.dataToRead <- packet
+			Eventually(handled).Should(BeClosed())
+		})
+
+		It("passes packets for unknown connection IDs to the Listener", func() {
+			client := NewMockPacketReceiver(mockCtrl)
+			listener := NewMockPacketReceiver(mockCtrl)
+			t.addClient(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}, client)
+			t.listener = listener
+			packet := getPacket(protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1})
+			handled := make(chan struct{})
+			listener.EXPECT().handlePacket(packetConn.dataReadFrom, packet, gomock.Any(), packetInfo{}).Do(func(net.Addr, []byte, *[]byte, packetInfo) { close(handled) })
+			packetConn.dataToRead <- packet
+			Eventually(handled).Should(BeClosed())
+		})
+
+		It("drops packets if there's no Listener", func() {
+			err := t.handlePacket(packetConn.dataReadFrom, getPacket(protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}), nil, packetInfo{})
+			Expect(err).To(MatchError("dropping packet from 192.168.0.1:4321: no connection to handle it"))
+		})
+
+		It("returns the buffer of dropped packets to the pool", func() {
+			buf := getPacketBuffer()
+			*buf = append(*buf, getPacket(protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1})...)
+			Expect(t.handlePacket(packetConn.dataReadFrom, *buf, buf, packetInfo{})).ToNot(Succeed())
+			Expect(*buf).To(BeEmpty())
+		})
+
+		It("drops late packets for retired connection IDs", func() {
+			t.deleteRetiredConnIDsAfter = 50 * time.Millisecond
+			connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+			listener := NewMockPacketReceiver(mockCtrl)
+			t.listener = listener
+			t.addClient(connID, NewMockPacketReceiver(mockCtrl))
+			t.removeClient(connID)
+			Expect(t.handlePacket(packetConn.dataReadFrom, getPacket(connID), nil, packetInfo{})).To(Succeed())
+			Eventually(func() bool {
+				t.mutex.Lock()
+				defer t.mutex.Unlock()
+				_, ok := t.clients[string(connID)]
+				return ok
+			}).Should(BeFalse())
+			listener.EXPECT().handlePacket(gomock.Any(), gomock.Any(), gomock.Any(), packetInfo{})
+			Expect(t.handlePacket(packetConn.dataReadFrom, getPacket(connID), nil, packetInfo{})).To(Succeed())
+		})
+
+		It("doesn't delete a connection ID that was added again after it was retired", func() {
+			t.deleteRetiredConnIDsAfter = 10 * time.Millisecond
+			connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+			client := NewMockPacketReceiver(mockCtrl)
+			t.addClient(connID, client)
+			t.removeClient(connID)
+			t.addClient(connID, client)
+			time.Sleep(30 * time.Millisecond)
+			packet := getPacket(connID)
+			client.EXPECT().handlePacket(gomock.Any(), packet, gomock.Any(), packetInfo{})
+			Expect(t.handlePacket(packetConn.dataReadFrom, packet, nil, packetInfo{})).To(Succeed())
+		})
+
+		It("passes Stateless Resets to the client that received the reset token", func() {
+			t.listener = NewMockPacketReceiver(mockCtrl)
+			client1 := NewMockPacketReceiver(mockCtrl)
+			client2 := NewMockPacketReceiver(mockCtrl)
+			t.addClient(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}, client1)
+			t.addClient(protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}, client2)
+			t.addResetToken([16]byte{1}, client1)
+			t.addResetToken([16]byte{0xde, 0xca, 0xfb, 0xad}, client2)
+			packet, err := wire.ComposeStatelessReset([16]byte{0xde, 0xca, 0xfb, 0xad})
+			Expect(err).ToNot(HaveOccurred())
+			client2.EXPECT().handlePacket(gomock.Any(), packet, gomock.Any(), packetInfo{})
+			Expect(t.handlePacket(packetConn.dataReadFrom, packet, nil, packetInfo{})).To(Succeed())
+			// once the token is removed, the packet is passed to the Listener
+			t.removeResetToken([16]byte{0xde, 0xca, 0xfb, 0xad}, client2)
+			t.listener.(*MockPacketReceiver).EXPECT().handlePacket(gomock.Any(), packet, gomock.Any(), packetInfo{})
+			Expect(t.handlePacket(packetConn.dataReadFrom, packet, nil, packetInfo{})).To(Succeed())
+		})
+
+		It("only removes reset tokens for the client that added them", func() {
+			client1 := NewMockPacketReceiver(mockCtrl)
+			client2 := NewMockPacketReceiver(mockCtrl)
+			t.addResetToken([16]byte{1}, client1)
+			t.addResetToken([16]byte{1}, client2)
+			t.removeResetToken([16]byte{1}, client1)
+			Expect(t.resetTokens).To(HaveKeyWithValue([16]byte{1}, client2))
+		})
+	})
+
+	Context("Listeners", func() {
+		It("only allows a single Listener", func() {
+			ln, err := t.Listen(testdata.GetTLSConfig(), nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = t.Listen(testdata.GetTLSConfig(), nil)
+			Expect(err).To(MatchError("the Transport already has a Listener"))
+			Expect(ln.Close()).To(Succeed())
+			ln, err = t.Listen(testdata.GetTLSConfig(), nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ln.Addr()).To(Equal(packetConn.addr))
+		})
+
+		It("doesn't close the net.PacketConn when the Listener is closed", func() {
+			ln, err := t.Listen(testdata.GetTLSConfig(), nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ln.Close()).To(Succeed())
+			Expect(packetConn.closed).To(BeFalse())
+			_, err = ln.Accept()
+			Expect(err).To(MatchError(errListenerClosed))
+			// closing it again is a no-op
+			Expect(ln.Close()).To(Succeed())
+		})
+	})
+
+	Context("closing", func() {
+		It("closes all connections and the Listener, and then the net.PacketConn", func() {
+			client := NewMockPacketReceiver(mockCtrl)
+			listener := NewMockPacketReceiver(mockCtrl)
+			t.addClient(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}, client)
+			t.addClient(protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}, client)
+			t.listener = listener
+			client.EXPECT().closeWithError(nil)
+			listener.EXPECT().closeWithError(nil)
+			Expect(t.Close()).To(Succeed())
+			Expect(packetConn.closed).To(BeTrue())
+			Expect(t.runDone).To(BeClosed())
+			// closing it again is a no-op
+			Expect(t.Close()).To(Succeed())
+		})
+
+		It("closes all connections when reading from the net.PacketConn fails", func() {
+			// replace the Transport created in the BeforeEach
+			Expect(t.Close()).To(Succeed())
+			testErr := errors.New("read failed")
+			packetConn = newMockPacketConn()
+			packetConn.readErr = testErr
+			t = &Transport{
+				conn:    packetConn,
+				clients: make(map[string]packetReceiver),
+				runDone: make(chan struct{}),
+				logger:  utils.DefaultLogger,
+			}
+			client := NewMockPacketReceiver(mockCtrl)
+			t.addClient(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}, client)
+			client.EXPECT().closeWithError(testErr)
+			t.run()
+			Expect(t.runDone).To(BeClosed())
+		})
+	})
+})
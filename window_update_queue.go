@@ -47,6 +47,13 @@ func (q *windowUpdateQueue) AddConnection() {
 	q.mutex.Unlock()
 }
 
+// HasWindowUpdates says if any window updates are waiting to be queued.
+func (q *windowUpdateQueue) HasWindowUpdates() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.queuedConn || len(q.queue) > 0
+}
+
 func (q *windowUpdateQueue) QueueAll() {
 	q.mutex.Lock()
 	// queue a connection-level window update
@@ -88,6 +88,17 @@ var _ = Describe("Window Update Queue", func() {
 		}))
 	})
 
+	It("says if it has window updates", func() {
+		Expect(q.HasWindowUpdates()).To(BeFalse())
+		q.AddConnection()
+		Expect(q.HasWindowUpdates()).To(BeTrue())
+		connFC.EXPECT().GetWindowUpdate().Return(protocol.ByteCount(0x1337))
+		q.QueueAll()
+		Expect(q.HasWindowUpdates()).To(BeFalse())
+		q.AddStream(10)
+		Expect(q.HasWindowUpdates()).To(BeTrue())
+	})
+
 	It("deduplicates", func() {
 		stream10 := NewMockStreamI(mockCtrl)
 		stream10.EXPECT().getWindowUpdate().Return(protocol.ByteCount(200))